@@ -5,6 +5,8 @@ import (
 	"scmp/cli"
 	"scmp/cli/subcommands"
 	"scmp/core/deployment"
+	"scmp/core/deployment/events"
+	"strings"
 )
 
 // Defines all commands/subcommands and their relationships and descriptions
@@ -21,7 +23,7 @@ func DefineOptions() (cmdOpts *cli.CommandSet) {
 	root.ChildCommands["deploy"] = &cli.CommandSet{
 		CommandName:     "deploy",
 		Description:     "Deploy configurations",
-		FullDescription: "Takes configuration files from local repository, transfers them to remote servers, and reloads associated services",
+		FullDescription: "Takes configuration files from local repository, transfers them to remote servers, and reloads associated services\n    Event types written with --events: " + strings.Join(events.Types, ", "),
 		PrimaryFunc:     subcommands.Deploy,
 		UsageOption:     "",
 		ChildCommands: map[string]*cli.CommandSet{
@@ -45,6 +47,32 @@ func DefineOptions() (cmdOpts *cli.CommandSet) {
 				Description:     "Deploy Configurations prior to commit",
 				FullDescription: "Deploy the previous version(s) of configurations before the given commit ID",
 			},
+			deployment.ModeExport: {
+				CommandName:     deployment.ModeExport,
+				Description:     "Export Resolved Deployment Content",
+				FullDescription: "Write the fully resolved content and metadata that would be deployed to each host into a local directory (nothing is deployed)",
+			},
+		},
+	}
+
+	// Offline deployment bundles
+	root.ChildCommands["bundle"] = &cli.CommandSet{
+		CommandName:     "bundle",
+		Description:     "Offline Deployment Bundles",
+		FullDescription: "Package the deployment of a commit into a single file and deploy it where the repository and configuration file are unavailable (bundles are authenticated with the vault password)",
+		PrimaryFunc:     subcommands.Bundle,
+		ChildCommands: map[string]*cli.CommandSet{
+			"create": {
+				CommandName:     "create",
+				Description:     "Create a deployment bundle",
+				FullDescription: "Writes the resolved files of the commit (files changed in it, or --all-files) for each host to --out, with the host configuration and vault entries needed to connect",
+			},
+			"deploy": {
+				CommandName:     "deploy",
+				UsageOption:     "<bundle file>",
+				Description:     "Deploy a deployment bundle",
+				FullDescription: "Verifies the bundle against the vault password and deploys it to its hosts (or --remote-hosts of them), known hosts are read from the local known_hosts file",
+			},
 		},
 	}
 
@@ -75,7 +103,7 @@ func DefineOptions() (cmdOpts *cli.CommandSet) {
 				CommandName:     "new",
 				UsageOption:     "<file path>",
 				Description:     "Create File with Template Metadata",
-				FullDescription: "Makes file at specified path with example metadata and data",
+				FullDescription: "Makes file at specified path with example metadata and data, a named repository template (--template), or the header of another file (--from)",
 			},
 			"replace-data": {
 				CommandName:     "replace-data",
@@ -83,6 +111,30 @@ func DefineOptions() (cmdOpts *cli.CommandSet) {
 				Description:     "Replace File Data",
 				FullDescription: "Replace Chosen File's Data with Given File's Data",
 			},
+			"to-artifact": {
+				CommandName:     "to-artifact",
+				UsageOption:     "<file path> <artifact directory>",
+				Description:     "Move File Content to Artifact",
+				FullDescription: "Moves file content into the artifact directory and replaces the file with a pointer, staging the change",
+			},
+			"from-artifact": {
+				CommandName:     "from-artifact",
+				UsageOption:     "<pointer file path>",
+				Description:     "Inline Artifact Content",
+				FullDescription: "Writes artifact content back into the repository and removes the pointer, staging the change",
+			},
+			"encrypt": {
+				CommandName:     "encrypt",
+				UsageOption:     "<file path>",
+				Description:     "Encrypt File Data",
+				FullDescription: "Encrypts the data after the metadata header with the vault password and marks the header as Encrypted, deployments decrypt it again",
+			},
+			"decrypt": {
+				CommandName:     "decrypt",
+				UsageOption:     "<file path>",
+				Description:     "Decrypt File Data",
+				FullDescription: "Writes the decrypted data of an Encrypted file back in place for editing (encrypt it again before committing)",
+			},
 		},
 	}
 
@@ -95,9 +147,9 @@ func DefineOptions() (cmdOpts *cli.CommandSet) {
 		ChildCommands: map[string]*cli.CommandSet{
 			"edit": {
 				CommandName:     "edit",
-				UsageOption:     "<file path>",
+				UsageOption:     "<file path or glob>",
 				Description:     "Change Metadata Header Values",
-				FullDescription: "Modify values in the existing JSON header via direct input JSON or via interactive prompts",
+				FullDescription: "Modify values in the existing JSON header via direct input JSON or via interactive prompts, or patch the headers of every matching file in place with --set, --set-owner, --append-reload and --json (use --dry-run to print the header diffs)",
 			},
 			"strip": {
 				CommandName:     "strip",
@@ -167,6 +219,87 @@ func DefineOptions() (cmdOpts *cli.CommandSet) {
 		},
 	}
 
+	// Repository checks
+	root.ChildCommands["lint"] = &cli.CommandSet{
+		CommandName:     "lint",
+		Description:     "Query Repository Layout",
+		FullDescription: "Answer questions about how repository files map to hosts without running a deployment",
+		PrimaryFunc:     subcommands.Lint,
+		ChildCommands: map[string]*cli.CommandSet{
+			"who-gets": {
+				CommandName:     "who-gets",
+				UsageOption:     "<repo path>",
+				Description:     "Show hosts receiving a file",
+				FullDescription: "Lists every host that would receive the given repository file from the HEAD commit and why (host directory, universal directory, or group tag)",
+			},
+			"headers": {
+				CommandName:     "headers",
+				Description:     "Check metadata headers for unsafe values",
+				FullDescription: "Checks every metadata header in the HEAD commit, reporting values deployments reject (errors) and suspicious commands or permissions (warnings)",
+			},
+			"config": {
+				CommandName:     "config",
+				Description:     "Check controller configuration",
+				FullDescription: "Reports every problem in the controller configuration and repository layout (hosts, identity files, groups, headers, dependencies, vault entries) instead of stopping at the first one",
+			},
+		},
+	}
+
+	// Deployment snapshots
+	root.ChildCommands["snapshot"] = &cli.CommandSet{
+		CommandName:     "snapshot",
+		Description:     "Manage Deployment Snapshots",
+		FullDescription: "List and restore snapshots of remote file state taken around deployments (deploy --snapshot or host option 'Snapshot yes')",
+		PrimaryFunc:     subcommands.Snapshot,
+		ChildCommands: map[string]*cli.CommandSet{
+			"list": {
+				CommandName:     "list",
+				Description:     "List snapshots of a host",
+				FullDescription: "Lists snapshot IDs saved for the --host, oldest first",
+			},
+			"restore": {
+				CommandName:     "restore",
+				Description:     "Restore a host to a snapshot",
+				FullDescription: "Puts the files planned by the --snapshot deployment back to their state before it (files absent before are removed only with --allow-deletions)",
+			},
+		},
+	}
+
+	// Trusted host keys
+	root.ChildCommands["ssh-keys"] = &cli.CommandSet{
+		CommandName:     "ssh-keys",
+		Description:     "Manage Trusted Host Keys",
+		FullDescription: "Read, trust, and remove the host keys of configured hosts in known_hosts (entries are always hashed)",
+		PrimaryFunc:     subcommands.SSHKeys,
+		ChildCommands: map[string]*cli.CommandSet{
+			"scan": {
+				CommandName:     "scan",
+				Description:     "Show host key fingerprints",
+				FullDescription: "Connects to every configured host (or --remote-hosts) and prints its host key fingerprint and whether known_hosts trusts it (known, new, or changed)",
+			},
+			"add": {
+				CommandName:     "add",
+				UsageOption:     "<host>",
+				Description:     "Trust the host key of a host",
+				FullDescription: "Writes a hashed known_hosts entry for the key the host presents (a different trusted key must be removed first)",
+			},
+			"remove": {
+				CommandName:     "remove",
+				UsageOption:     "<host>",
+				Description:     "Remove trusted host keys of a host",
+				FullDescription: "Removes every known_hosts entry stored under the host name, its addresses, or the addresses they resolve to",
+			},
+		},
+	}
+
+	// Persistent connections
+	root.ChildCommands["connect"] = &cli.CommandSet{
+		CommandName:     "connect",
+		Description:     "Hold Persistent Connections",
+		FullDescription: "Connects to --remote-hosts once and holds the connections (--persist), later deploy, exec, scp, seed, and snapshot commands reuse them through control sockets instead of connecting and authenticating again\n    Held connections close with --close, on interrupt, or once unused for --idle-timeout",
+		PrimaryFunc:     subcommands.Connect,
+	}
+
 	// Executions
 	root.ChildCommands["exec"] = &cli.CommandSet{
 		CommandName:     "exec",
@@ -189,7 +322,7 @@ func DefineOptions() (cmdOpts *cli.CommandSet) {
 	root.ChildCommands["git"] = &cli.CommandSet{
 		CommandName:     "git",
 		Description:     "Repository Actions",
-		FullDescription: "Standard git repository manipulations and support for artifact file tracking",
+		FullDescription: "Standard git repository manipulations, history of deployable files, and support for artifact file tracking",
 		PrimaryFunc:     subcommands.Git,
 		ChildCommands: map[string]*cli.CommandSet{
 			"add": {
@@ -208,6 +341,16 @@ func DefineOptions() (cmdOpts *cli.CommandSet) {
 				Description:     "Commit Changes to Repository",
 				FullDescription: "Commit any tracked changes in the worktree to the repository",
 			},
+			"log": {
+				CommandName:     "log",
+				Description:     "Show Commits of Deployable Files",
+				FullDescription: "List commits from HEAD with the deployable files they changed and the hosts receiving them",
+			},
+			"diff": {
+				CommandName:     "diff",
+				Description:     "Show Uncommitted Deployable Changes",
+				FullDescription: "Compare worktree changes of deployable files against HEAD, metadata headers are shown separately from content",
+			},
 		},
 	}
 
@@ -217,6 +360,18 @@ func DefineOptions() (cmdOpts *cli.CommandSet) {
 		Description:     "Modify Vault",
 		FullDescription: "Add/Modify/Delete entries in the local password vault",
 		PrimaryFunc:     subcommands.Secrets,
+		ChildCommands: map[string]*cli.CommandSet{
+			"verify": {
+				CommandName:     "verify",
+				Description:     "Check Vault Integrity",
+				FullDescription: "Checks the vault file and its backups can be decrypted and read (nothing is modified)",
+			},
+			"rekey": {
+				CommandName:     "rekey",
+				Description:     "Re-encrypt Vault",
+				FullDescription: "Re-encrypts every vault entry with a new master password and/or new argon2 parameters (--kdf-time, --kdf-memory, --kdf-threads)",
+			},
+		},
 	}
 
 	// Controller installation
@@ -225,6 +380,13 @@ func DefineOptions() (cmdOpts *cli.CommandSet) {
 		Description:     "Initial Setups",
 		FullDescription: "Install default configurations for apparmor and SSH and setup new repositories",
 		PrimaryFunc:     subcommands.Install,
+		ChildCommands: map[string]*cli.CommandSet{
+			"migrate-v4": {
+				CommandName:     "migrate-v4",
+				Description:     "Migrate v4 Configuration and Repository",
+				FullDescription: "Converts v4 YAML configuration to SSH config options, removes deprecated metadata header fields, and converts the failtracker file (changes are not committed)",
+			},
+		},
 	}
 
 	// Version Info
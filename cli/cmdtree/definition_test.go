@@ -0,0 +1,71 @@
+package cmdtree
+
+import (
+	"flag"
+	"os"
+	"scmp/cli"
+	"scmp/internal/logctx"
+	"testing"
+)
+
+func TestSubcommandFlagPairs(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	root := DefineOptions()
+	err := cli.WOCLICmds(root)
+	if err != nil {
+		t.Fatalf("failed setting CLI option tree: %v", err)
+	}
+
+	// Subcommands without arguments register their flags and print help
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("failed opening %s: %v", os.DevNull, err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	for commandName, command := range root.ChildCommands {
+		if command.PrimaryFunc != nil {
+			command.PrimaryFunc(ctx, []string{cli.RootCLICommand, commandName}, nil)
+		}
+	}
+	os.Stdout = stdout
+	_ = devNull.Close()
+
+	flagSets := cli.RegisteredFlagSets()
+	if len(flagSets) == 0 {
+		t.Fatalf("expected subcommands to register flags")
+	}
+
+	for _, fs := range flagSets {
+		shortByLong := cli.FlagPairs(fs)
+		longByShort := make(map[string][]string)
+		for longName, shortName := range shortByLong {
+			longByShort[shortName] = append(longByShort[shortName], longName)
+		}
+
+		fs.VisitAll(func(shortFlag *flag.Flag) {
+			if len(shortFlag.Name) != 1 {
+				return
+			}
+
+			longNames := longByShort[shortFlag.Name]
+			if len(longNames) != 1 {
+				t.Errorf("%s: short flag -%s has %d long counterparts, expected 1", fs.Name(), shortFlag.Name, len(longNames))
+				return
+			}
+			longFlag := fs.Lookup(longNames[0])
+			if longFlag == nil {
+				t.Errorf("%s: long flag --%s for -%s is not registered", fs.Name(), longNames[0], shortFlag.Name)
+				return
+			}
+			if shortFlag.DefValue != longFlag.DefValue {
+				t.Errorf("%s: -%s default '%s' does not match --%s default '%s'", fs.Name(), shortFlag.Name, shortFlag.DefValue, longFlag.Name, longFlag.DefValue)
+			}
+			if shortFlag.Usage != longFlag.Usage {
+				t.Errorf("%s: -%s usage '%s' does not match --%s usage '%s'", fs.Name(), shortFlag.Name, shortFlag.Usage, longFlag.Name, longFlag.Usage)
+			}
+		})
+	}
+}
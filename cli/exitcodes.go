@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"scmp/core/deployment/metrics"
+)
+
+// Exit codes of the program, distinct so automation can tell outcomes apart
+const (
+	ExitSuccess         int = 0
+	ExitFailure         int = 1 // Any failure without a more specific code
+	ExitUsage           int = 2 // Invalid configuration, options, or arguments
+	ExitPartialFailure  int = 3 // Some hosts failed to deploy
+	ExitTotalFailure    int = 4 // No host deployed
+	ExitNothingToDeploy int = 5
+	ExitInterrupted     int = 6
+	ExitDriftDetected   int = 7 // Audit found remote hosts differing from the repository
+)
+
+// Single error object written to stderr in quiet error mode
+type errorReport struct {
+	Error    string `json:"Error"`
+	ExitCode int    `json:"ExitCode"`
+	Status   string `json:"Status,omitempty"`
+}
+
+// Exit code of a finished deployment by its final status
+func DeploymentExitCode(status string) (exitCode int) {
+	switch status {
+	case "", "Deployed", metrics.StatusDryRun, metrics.StatusNoDrift:
+		exitCode = ExitSuccess
+	case "Partial":
+		exitCode = ExitPartialFailure
+	case "Failed", metrics.StatusConfirmationRequired:
+		exitCode = ExitTotalFailure
+	case metrics.StatusUpToDate:
+		exitCode = ExitNothingToDeploy
+	case metrics.StatusInterrupted:
+		exitCode = ExitInterrupted
+	case metrics.StatusDriftDetected:
+		exitCode = ExitDriftDetected
+	default:
+		exitCode = ExitFailure
+	}
+	return
+}
+
+// Prints an error on stderr and returns its exit code
+func ReportError(quiet bool, exitCode int, status string, description string, err error) int {
+	writeErrorReport(os.Stderr, quiet, exitCode, status, description, err)
+	return exitCode
+}
+
+// Writes the descriptive error message, or in quiet mode only a single line JSON object
+func writeErrorReport(w io.Writer, quiet bool, exitCode int, status string, description string, err error) {
+	if !quiet {
+		fmt.Fprintf(w, "%s: %v\n", description, err)
+		return
+	}
+
+	report := errorReport{
+		Error:    err.Error(),
+		ExitCode: exitCode,
+		Status:   status,
+	}
+	reportJSON, _ := json.Marshal(report) // Only strings and integers, cannot fail
+	fmt.Fprintf(w, "%s\n", reportJSON)
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"scmp/core/deployment/metrics"
+	"testing"
+)
+
+func TestDeploymentExitCode(t *testing.T) {
+	tests := []struct {
+		status   string
+		expected int
+	}{
+		{"", ExitSuccess},
+		{"Deployed", ExitSuccess},
+		{metrics.StatusDryRun, ExitSuccess},
+		{"Partial", ExitPartialFailure},
+		{"Failed", ExitTotalFailure},
+		{metrics.StatusConfirmationRequired, ExitTotalFailure},
+		{metrics.StatusUpToDate, ExitNothingToDeploy},
+		{metrics.StatusInterrupted, ExitInterrupted},
+		{metrics.StatusNoDrift, ExitSuccess},
+		{metrics.StatusDriftDetected, ExitDriftDetected},
+		{"Unknown", ExitFailure},
+	}
+
+	for _, test := range tests {
+		exitCode := DeploymentExitCode(test.status)
+		if exitCode != test.expected {
+			t.Errorf("status '%s': expected exit code %d, got %d", test.status, test.expected, exitCode)
+		}
+	}
+}
+
+func TestWriteErrorReport(t *testing.T) {
+	err := fmt.Errorf("host \"web01\" failed\nsecond line")
+
+	var output bytes.Buffer
+	writeErrorReport(&output, false, ExitFailure, "", "Deployment Failed", err)
+	expected := "Deployment Failed: host \"web01\" failed\nsecond line\n"
+	if output.String() != expected {
+		t.Errorf("expected message %q, got %q", expected, output.String())
+	}
+
+	output.Reset()
+	writeErrorReport(&output, true, ExitPartialFailure, "Partial", "Deployment Failed", err)
+	if bytes.Count(output.Bytes(), []byte("\n")) != 1 {
+		t.Fatalf("expected a single line, got %q", output.String())
+	}
+	var report errorReport
+	lerr := json.Unmarshal(output.Bytes(), &report)
+	if lerr != nil {
+		t.Fatalf("invalid JSON error object: %v", lerr)
+	}
+	if report.Error != err.Error() || report.ExitCode != ExitPartialFailure || report.Status != "Partial" {
+		t.Errorf("unexpected error object %+v", report)
+	}
+}
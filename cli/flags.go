@@ -3,35 +3,143 @@ package cli
 import (
 	"flag"
 	"scmp/internal/config"
+	"scmp/internal/logctx"
 	"scmp/internal/sshinternal"
+	"strings"
+	"time"
 )
 
 // Argument Groups
 
 func SetGlobalArguments(fs *flag.FlagSet, opts *config.Opts) (requestedLogLevel *int) {
 	requestedLogLevel = new(int)
-	fs.BoolVar(&opts.DetailedSummaryRequested, "with-summary", false, "Generate JSON summary of actions")
-	fs.BoolVar(&opts.ForceEnabled, "force", false, "Do not exit/abort on failures")
-	fs.BoolVar(&opts.AllowDeletions, "allow-deletions", false, "Permits deletions of files/entries")
-	fs.BoolVar(&opts.DryRunEnabled, "T", false, "Conducts non-mutating actions (no remote actions)")
-	fs.BoolVar(&opts.DryRunEnabled, "dry-run", false, "Conducts non-mutating actions (no remote actions)")
-	fs.BoolVar(&opts.WetRunEnabled, "w", false, "Conducts non-mutating actions (including remote actions)")
-	fs.BoolVar(&opts.WetRunEnabled, "wet-run", false, "Conducts non-mutating actions (including remote actions)")
-	fs.IntVar(requestedLogLevel, "v", 1, "Increase detailed progress messages (Higher is more verbose) <0...5>")
-	fs.IntVar(requestedLogLevel, "verbosity", 1, "Increase detailed progress messages (Higher is more verbose) <0...5>")
+	RegisterBool(fs, &opts.DetailedSummaryRequested, "", "with-summary", false, "Generate JSON summary of actions")
+	RegisterBool(fs, &opts.ForceEnabled, "", "force", false, "Do not exit/abort on failures")
+	RegisterBool(fs, &opts.AllowDeletions, "", "allow-deletions", false, "Permits deletions of files/entries")
+	RegisterBool(fs, &opts.DryRunEnabled, "T", "dry-run", false, "Conducts non-mutating actions (no remote actions)")
+	RegisterBool(fs, &opts.WetRunEnabled, "w", "wet-run", false, "Conducts non-mutating actions (including remote actions)")
+	RegisterInt(fs, requestedLogLevel, "v", "verbosity", 1, "Increase detailed progress messages (Higher is more verbose) <0...5>")
+	RegisterString(fs, &opts.LogFile, "", "log-file", "", "Append structured log entries (timestamp, level, host, file, message) to this file as they happen")
+	RegisterString(fs, &opts.LogFormat, "", "log-format", logctx.LogFormatText, "Format of log file entries ("+logctx.LogFormatText+" or "+logctx.LogFormatJSON+")")
+	RegisterBool(fs, &opts.LogJournald, "", "log-journald", false, "Send structured log entries to the systemd journal")
 	return
 }
 
 func SetDeployConfArguments(fs *flag.FlagSet, configPath *string) {
-	fs.StringVar(configPath, "c", sshinternal.DefaultConfigPath, "Path to the configuration file")
-	fs.StringVar(configPath, "config", sshinternal.DefaultConfigPath, "Path to the configuration file")
+	RegisterString(fs, configPath, "c", "config", sshinternal.DefaultConfigPath, "Path to the configuration file")
 }
 
 func SetSSHArguments(fs *flag.FlagSet, opts *config.Opts) {
-	fs.StringVar(&opts.RunAsUser, "u", "root", "User name to run sudo commands as")
-	fs.StringVar(&opts.RunAsUser, "run-as-user", "root", "User name to run sudo commands as")
-	fs.BoolVar(&opts.DisableSudo, "disable-privilege-escalation", false, "Disables use of sudo when executing commands remotely")
-	fs.IntVar(&opts.ExecutionTimeout, "execution-timeout", sshinternal.DefaultCommandTimeout, "Timeout in seconds for user-defined commands")
-	fs.IntVar(&opts.MaxSSHConcurrency, "m", sshinternal.MaxSSHConnections, "Maximum simultaneous SSH connections (1 disables threading)")
-	fs.IntVar(&opts.MaxSSHConcurrency, "max-conns", sshinternal.MaxSSHConnections, "Maximum simultaneous SSH connections (1 disables threading)")
+	RegisterString(fs, &opts.RunAsUser, "u", "run-as-user", "root", "User name to run sudo commands as")
+	RegisterBool(fs, &opts.DisableSudo, "", "disable-privilege-escalation", false, "Disables use of sudo when executing commands remotely")
+	RegisterInt(fs, &opts.ExecutionTimeout, "", "execution-timeout", sshinternal.DefaultCommandTimeout, "Timeout in seconds for user-defined commands")
+	RegisterDuration(fs, &opts.TransferTimeout, "", "transfer-timeout", 0, "Timeout for each file upload, failed uploads do not stop other files (0 scales with file size)")
+	RegisterInt(fs, &opts.MaxSSHConcurrency, "m", "max-conns", sshinternal.MaxSSHConnections, "Maximum simultaneous SSH connections (1 disables threading)")
+	RegisterInt(fs, &opts.ConnectAttempts, "", "connect-attempts", 0, "Connection attempts per host on network errors, overrides ConnectAttempts (0 uses configured value)")
+	RegisterDuration(fs, &opts.ConnectRetryDelay, "", "connect-retry-delay", 0, "Delay before the first connection retry, doubled on each retry, overrides ConnectRetryDelay (0 uses configured value)")
+	SetHostKeyArguments(fs, opts)
+}
+
+func SetHostKeyArguments(fs *flag.FlagSet, opts *config.Opts) {
+	RegisterString(fs, &opts.StrictHostKeyChecking, "", "strict-host-key-checking", "", "Handle unknown host keys without prompting: yes (refuse), no (trust), accept-new (trust unknown, refuse changed)")
+}
+
+func SetHostSelectionArguments(fs *flag.FlagSet, selectHosts *bool, selectionFile *string) {
+	RegisterBool(fs, selectHosts, "", "select", false, "Choose hosts from an interactive list of configured hosts (in place of --remote-hosts)")
+	RegisterString(fs, selectionFile, "", "select-from", "", "Use the hosts of a saved host selection file, one host per line (in place of --remote-hosts)")
+}
+
+func SetValuesArguments(fs *flag.FlagSet, opts *config.Opts) {
+	RegisterString(fs, &opts.ValuesFile, "", "values", "", "YAML or JSON file of values for {@VAR:name} macros (global values, per-host values under 'hosts', masked names under 'sensitive')")
+}
+
+// Registration Helpers
+// Short name is optional, when given it shares the target, default, and usage of the long name
+
+func RegisterBool(fs *flag.FlagSet, target *bool, shortName string, longName string, defaultValue bool, usage string) {
+	if shortName != "" {
+		fs.BoolVar(target, shortName, defaultValue, usage)
+	}
+	fs.BoolVar(target, longName, defaultValue, usage)
+	recordFlagPair(fs, shortName, longName)
+}
+
+func RegisterString(fs *flag.FlagSet, target *string, shortName string, longName string, defaultValue string, usage string) {
+	if shortName != "" {
+		fs.StringVar(target, shortName, defaultValue, usage)
+	}
+	fs.StringVar(target, longName, defaultValue, usage)
+	recordFlagPair(fs, shortName, longName)
+}
+
+func RegisterInt(fs *flag.FlagSet, target *int, shortName string, longName string, defaultValue int, usage string) {
+	if shortName != "" {
+		fs.IntVar(target, shortName, defaultValue, usage)
+	}
+	fs.IntVar(target, longName, defaultValue, usage)
+	recordFlagPair(fs, shortName, longName)
+}
+
+func RegisterDuration(fs *flag.FlagSet, target *time.Duration, shortName string, longName string, defaultValue time.Duration, usage string) {
+	if shortName != "" {
+		fs.DurationVar(target, shortName, defaultValue, usage)
+	}
+	fs.DurationVar(target, longName, defaultValue, usage)
+	recordFlagPair(fs, shortName, longName)
+}
+
+// Repeatable option, every occurrence is appended to the target
+func RegisterStringList(fs *flag.FlagSet, target *[]string, shortName string, longName string, usage string) {
+	if shortName != "" {
+		fs.Var(stringList{values: target}, shortName, usage)
+	}
+	fs.Var(stringList{values: target}, longName, usage)
+	recordFlagPair(fs, shortName, longName)
+}
+
+func (list stringList) String() (value string) {
+	if list.values != nil {
+		value = strings.Join(*list.values, ",")
+	}
+	return
+}
+
+func (list stringList) Set(value string) (err error) {
+	*list.values = append(*list.values, value)
+	return
+}
+
+func recordFlagPair(fs *flag.FlagSet, shortName string, longName string) {
+	flagPairsMutex.Lock()
+	defer flagPairsMutex.Unlock()
+
+	if flagPairs[fs] == nil {
+		flagPairs[fs] = make(map[string]string)
+	}
+	if shortName != "" {
+		flagPairs[fs][longName] = shortName
+	}
+}
+
+// Short flag names registered for the flag set, keyed by their long name
+func FlagPairs(fs *flag.FlagSet) (shortByLong map[string]string) {
+	flagPairsMutex.RLock()
+	defer flagPairsMutex.RUnlock()
+
+	shortByLong = make(map[string]string, len(flagPairs[fs]))
+	for longName, shortName := range flagPairs[fs] {
+		shortByLong[longName] = shortName
+	}
+	return
+}
+
+// Flag sets that have registered flags through the Register helpers
+func RegisteredFlagSets() (flagSets []*flag.FlagSet) {
+	flagPairsMutex.RLock()
+	defer flagPairsMutex.RUnlock()
+
+	for fs := range flagPairs {
+		flagSets = append(flagSets, fs)
+	}
+	return
 }
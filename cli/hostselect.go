@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"scmp/internal/config"
+	"scmp/internal/fsops"
+	"scmp/internal/global"
+	"scmp/internal/input"
+	"scmp/internal/logctx"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"strings"
+)
+
+// File name of the last interactive host selection (in config directory)
+const LastHostSelectionFile string = ".scmp-last-host-selection"
+
+// Host override of an interactive selection (--select) or a saved selection file (--select-from)
+// Without either the given host override is returned unchanged
+func ApplyHostSelection(ctx context.Context, selectHosts bool, selectionFile string, hostOverride string) (newOverride string, err error) {
+	newOverride = hostOverride
+	if !selectHosts && selectionFile == "" {
+		return
+	}
+	if selectHosts && selectionFile != "" {
+		err = fmt.Errorf("--select and --select-from cannot be combined")
+		return
+	}
+	if hostOverride != "" {
+		err = fmt.Errorf("host selection cannot be combined with --remote-hosts")
+		return
+	}
+
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	var hosts []str.RepoRootDir
+	if selectHosts {
+		var lastSelectionPath string
+		lastSelectionPath, err = fsops.ExpandHomeDirectory(filepath.Join(filepath.Dir(sshinternal.DefaultConfigPath), LastHostSelectionFile))
+		if err != nil {
+			err = fmt.Errorf("failed to find home directory for host selection: %w", err)
+			return
+		}
+
+		// Previous selection starts selected (missing on first use)
+		previousHosts, _ := input.ReadHostSelection(lastSelectionPath)
+
+		hosts, err = input.SelectHosts(cfg.HostInfo, previousHosts)
+		if err != nil {
+			return
+		}
+
+		lerr := input.WriteHostSelection(lastSelectionPath, hosts)
+		if lerr != nil {
+			logctx.LogStdWarn(ctx, "Unable to save host selection: %v\n", lerr)
+		} else {
+			logctx.LogStdInfo(ctx, "Selected %d host(s), saved to %s\n", len(hosts), lastSelectionPath)
+		}
+	} else {
+		hosts, err = input.ReadHostSelection(selectionFile)
+		if err != nil {
+			return
+		}
+		if len(hosts) == 0 {
+			err = fmt.Errorf("host selection file '%s' has no hosts", selectionFile)
+			return
+		}
+		for _, host := range hosts {
+			_, exists := cfg.HostInfo[host]
+			if !exists {
+				err = fmt.Errorf("host '%s' of selection file '%s' does not exist in config", host, selectionFile)
+				return
+			}
+		}
+	}
+
+	newOverride = selectionOverride(hosts, opts.RegexEnabled)
+	return
+}
+
+// Host override naming exactly the selected hosts (escaped when overrides are regular expressions)
+func selectionOverride(hosts []str.RepoRootDir, regexEnabled bool) (override string) {
+	var choices []string
+	for _, host := range hosts {
+		choice := string(host)
+		if regexEnabled {
+			choice = regexp.QuoteMeta(choice)
+		}
+		choices = append(choices, choice)
+	}
+	override = strings.Join(choices, ",")
+	return
+}
@@ -0,0 +1,16 @@
+package cli
+
+import (
+	"scmp/internal/str"
+	"testing"
+)
+
+func TestSelectionOverride(t *testing.T) {
+	hosts := []str.RepoRootDir{"db01", "web.01"}
+	if override := selectionOverride(hosts, false); override != "db01,web.01" {
+		t.Errorf("unexpected override '%s'", override)
+	}
+	if override := selectionOverride(hosts, true); override != `db01,web\.01` {
+		t.Errorf("expected host names escaped for regex overrides, got '%s'", override)
+	}
+}
@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"scmp/internal/config"
+	"scmp/internal/logctx"
+)
+
+// Applies the global verbosity and structured log outputs chosen at this command level
+func SetLogging(ctx context.Context, verbosity int, opts config.Opts) (err error) {
+	logctx.SetLogLevel(ctx, verbosity)
+
+	logger := logctx.GetLogger(ctx)
+	if logger == nil {
+		return
+	}
+
+	if opts.LogFile != "" {
+		var fileSink logctx.Sink
+		fileSink, err = logctx.NewFileSink(opts.LogFile, opts.LogFormat)
+		if err != nil {
+			return
+		}
+		logger.AddSink(fileSink)
+	} else if opts.LogFormat != logctx.LogFormatText && opts.LogFormat != "" {
+		err = fmt.Errorf("log format '%s' requires a log file (--log-file)", opts.LogFormat)
+		return
+	}
+
+	if opts.LogJournald {
+		var journaldSink logctx.Sink
+		journaldSink, err = logctx.NewJournaldSink()
+		if err != nil {
+			return
+		}
+		logger.AddSink(journaldSink)
+	}
+	return
+}
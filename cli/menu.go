@@ -103,7 +103,7 @@ func PrintHelpMenu(fs *flag.FlagSet, commands []string, rootCmd *CommandSet) {
 	}
 }
 
-// Custom printer to deduplicate short/long usages and indent automatically
+// Custom printer to join registered short/long pairs and indent automatically
 func printFlagOptions(fs *flag.FlagSet, baseIndentSpaces int) {
 	const shortArgPrefix string = "-"      // like "  [-]t, --test  Some usage text"
 	const shortLongArgJoiner string = ", " // like "  -t[, ]--test  Some usage text"
@@ -117,68 +117,36 @@ func printFlagOptions(fs *flag.FlagSet, baseIndentSpaces int) {
 		hasShort   bool
 	}
 
-	seen := make(map[string]*optInfo)
+	// Short names are printed alongside their registered long name
+	shortByLong := FlagPairs(fs)
+	pairedShort := make(map[string]bool, len(shortByLong))
+	for _, shortArgName := range shortByLong {
+		pairedShort[shortArgName] = true
+	}
 
-	// Deduplicate usages by exact usage text match
+	opts := []*optInfo{}
 	fs.VisitAll(func(arg *flag.Flag) {
-		name := arg.Name
-		var shortArgName, longArgName string
-		if len(name) == 1 {
-			shortArgName = name
-		} else {
-			longArgName = name
+		if pairedShort[arg.Name] {
+			return
 		}
 
-		usageText := arg.Usage
-
-		hasShort := shortArgName != ""
-
-		// Add formatted arg text
-		usage, seenUsage := seen[usageText]
-		if seenUsage {
-			if shortArgName != "" {
-				usage.names = append(usage.names, shortArgPrefix+shortArgName)
-				usage.hasShort = true
-			}
-			if longArgName != "" {
-				usage.names = append(usage.names, longArgPrefix+longArgName)
-			}
+		opt := &optInfo{
+			usage:      arg.Usage,
+			defaultVal: arg.DefValue,
+		}
+		if len(arg.Name) == 1 {
+			opt.names = append(opt.names, shortArgPrefix+arg.Name)
+			opt.hasShort = true
 		} else {
-			names := []string{}
-			if shortArgName != "" {
-				names = append(names, shortArgPrefix+shortArgName)
-			}
-			if longArgName != "" {
-				names = append(names, longArgPrefix+longArgName)
-			}
-			seen[usageText] = &optInfo{
-				names:      names,
-				usage:      arg.Usage,
-				defaultVal: arg.DefValue,
-				hasShort:   hasShort,
+			shortArgName, hasShort := shortByLong[arg.Name]
+			if hasShort {
+				opt.names = append(opt.names, shortArgPrefix+shortArgName)
+				opt.hasShort = true
 			}
+			opt.names = append(opt.names, longArgPrefix+arg.Name)
 		}
-	})
-
-	// Deduplicated option list
-	opts := []*optInfo{}
-	for _, opt := range seen {
 		opts = append(opts, opt)
-	}
-
-	// Ensure short args come before long args
-	for _, opt := range seen {
-		if len(opt.names) <= 1 {
-			continue
-		}
-
-		sort.Slice(opt.names, func(indexA, indexB int) bool {
-			flagNameA := opt.names[indexA]
-			flagNameB := opt.names[indexB]
-
-			return len(flagNameA) < len(flagNameB)
-		})
-	}
+	})
 
 	// Sort list to group long/short args
 	sort.Slice(opts, func(indexA, indexB int) bool {
@@ -188,7 +156,10 @@ func printFlagOptions(fs *flag.FlagSet, baseIndentSpaces int) {
 		firstNameA := strings.ToLower(flagA.names[0])
 		firstNameB := strings.ToLower(flagB.names[0])
 
-		return firstNameA < firstNameB
+		if firstNameA != firstNameB {
+			return firstNameA < firstNameB
+		}
+		return flagA.names[0] < flagB.names[0] // Uppercase short arg first
 	})
 
 	// accounts for short arg prefix length, short arg default len (1), and joiner length
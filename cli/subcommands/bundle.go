@@ -0,0 +1,146 @@
+package subcommands
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"scmp/cli"
+	"scmp/core/deployment"
+	"scmp/core/deployment/local"
+	"scmp/core/deployment/metrics"
+	"scmp/internal/config"
+	"scmp/internal/config/sshconfig"
+	"scmp/internal/global"
+	"scmp/internal/sshinternal"
+	"strings"
+)
+
+func Bundle(ctx context.Context, subcmdLineage []string, args []string) (exitCode int) {
+	var configPath string
+	var commitID string
+	var hostOverride string
+	var localFileOverride string
+	var bundlePath string
+	var allFiles bool
+	var quietErrors bool
+	var opts config.Opts
+
+	commandFlags := flag.NewFlagSet(subcmdLineage[len(subcmdLineage)-1], flag.ExitOnError)
+	cli.RegisterString(commandFlags, &hostOverride, "r", "remote-hosts", "", "Override hosts to bundle or deploy (group:NAME selects a group, !HOST excludes)")
+	cli.RegisterString(commandFlags, &localFileOverride, "l", "local-files", "", "Override file(s) to bundle (create only)")
+	cli.RegisterString(commandFlags, &commitID, "C", "commitid", "", "Commit ID (hash) to bundle (create only)")
+	cli.RegisterString(commandFlags, &bundlePath, "o", "out", "", "Bundle file to write, a gzip compressed tar (name it .tar.gz or .bundle) (create only)")
+	cli.RegisterBool(commandFlags, &allFiles, "", "all-files", false, "Bundle all files for the hosts instead of files changed in the commit (create only)")
+	cli.RegisterBool(commandFlags, &opts.RegexEnabled, "", "regex", false, "Enables regular expression parsing for file/host overrides")
+	cli.RegisterInt(commandFlags, &opts.MaxDeployConcurrency, "M", "max-deploy-threads", sshinternal.MaxSSHChannels, "Maximum simultaneous file deployments per host (1 disables threading)")
+	cli.RegisterBool(commandFlags, &opts.RunInstallCommands, "", "install", false, "Run installation commands during deployment")
+	cli.RegisterBool(commandFlags, &opts.ForceInstall, "", "force-install", false, "Run installation commands even when InstallOnce markers record them as run (implies --install)")
+	cli.RegisterBool(commandFlags, &opts.DisableReloads, "", "disable-reloads", false, "Disables running any reload commands")
+	cli.RegisterStringList(commandFlags, &opts.ConfirmHosts, "", "confirm-host", "Confirm deploying to a host marked RequireConfirmation (repeat for each host)")
+	cli.RegisterBool(commandFlags, &opts.AcknowledgeShrink, "", "acknowledge-shrink", false, "Deploy files shrinking by more than their MaxShrinkPercent without confirmation")
+	cli.RegisterBool(commandFlags, &opts.SkipPreflight, "", "skip-preflight", false, "Deploy without checking remote disk space and sudo access before transferring files")
+	cli.RegisterBool(commandFlags, &opts.AllowUserDeletions, "", "allow-user-deletions", false, "Permits removing users and groups marked Absent in user metadata files (with --allow-deletions)")
+	cli.RegisterString(commandFlags, &opts.SummaryFormat, "", "summary-format", deployment.SummaryFormatText, "Deployment summary output format <text|json>")
+	cli.RegisterString(commandFlags, &opts.SummaryFile, "", "summary-file", "", "Write JSON deployment summary to file instead of stdout")
+	cli.RegisterString(commandFlags, &opts.EventStream, "", "events", "", "Append JSON Lines deployment events to file as they happen (- for stdout)")
+	cli.RegisterBool(commandFlags, &opts.ShowContentDiff, "", "show-diff", false, "Show differences between remote and bundled content of planned files without deploying")
+	cli.RegisterInt(commandFlags, &opts.CanaryHosts, "", "canary", 0, "Deploy to this many hosts first, a failure on any of them halts every other host (0 disables)")
+	cli.RegisterInt(commandFlags, &opts.BatchSize, "", "batch-size", 0, "Deploy to hosts in batches of this size, a failed batch halts the remaining batches (0 deploys all remaining hosts at once)")
+	cli.RegisterBool(commandFlags, &opts.Snapshot, "", "snapshot", false, "Capture remote state of planned files before and after deploying (for snapshot restore)")
+	cli.RegisterBool(commandFlags, &opts.Progress, "", "progress", false, "Show a live progress line of hosts, files, and transferred size during deployment")
+	cli.RegisterBool(commandFlags, &quietErrors, "", "quiet-errors", false, "Report errors and unsuccessful outcomes on stderr only as a single JSON object (for automation)")
+	globalVerbosity := cli.SetGlobalArguments(commandFlags, &opts)
+	cli.SetSSHArguments(commandFlags, &opts)
+	cli.SetDeployConfArguments(commandFlags, &configPath)
+
+	commandFlags.Usage = func() {
+		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
+	}
+	if len(args) < 1 {
+		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
+		return cli.ExitUsage
+	}
+	subcommand := args[0]
+	newsub := append(subcmdLineage, subcommand)
+
+	// Bundle file of deploy comes before its options
+	flagArgs := args[1:]
+	var deployBundlePath string
+	if subcommand == "deploy" && len(flagArgs) > 0 && !strings.HasPrefix(flagArgs[0], "-") {
+		deployBundlePath = flagArgs[0]
+		flagArgs = flagArgs[1:]
+	}
+	err := commandFlags.Parse(flagArgs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return cli.ExitUsage
+	}
+	if deployBundlePath == "" {
+		deployBundlePath = commandFlags.Arg(0)
+	}
+
+	if opts.ForceInstall {
+		opts.RunInstallCommands = true
+	}
+
+	// Set verbosity and log outputs again if the user change at this command level
+	err = cli.SetLogging(ctx, *globalVerbosity, opts)
+	if err != nil {
+		return cli.ReportError(quietErrors, cli.ExitUsage, "", "Error", err)
+	}
+
+	// Set options in context
+	ctx = context.WithValue(ctx, global.OpsKey, opts)
+
+	switch subcommand {
+	case "create":
+		if bundlePath == "" {
+			fmt.Fprintf(os.Stderr, "Error: --out is required\n")
+			cli.PrintHelpMenu(commandFlags, newsub, cli.GetCLICmds())
+			return cli.ExitUsage
+		}
+
+		ctx, err = sshconfig.Set(ctx, configPath)
+		if err != nil {
+			return cli.ReportError(quietErrors, cli.ExitUsage, "", "Error in controller configuration", err)
+		}
+
+		err = local.CreateBundle(ctx, commitID, hostOverride, localFileOverride, bundlePath, allFiles)
+		if err != nil {
+			exitCode = cli.ExitFailure
+			if errors.Is(err, deployment.ErrInvalidOptions) {
+				exitCode = cli.ExitUsage
+			}
+			return cli.ReportError(quietErrors, exitCode, "", "Bundle Creation Failed", err)
+		}
+	case "deploy":
+		if deployBundlePath == "" {
+			fmt.Fprintf(os.Stderr, "Error: a bundle file is required\n")
+			cli.PrintHelpMenu(commandFlags, newsub, cli.GetCLICmds())
+			return cli.ExitUsage
+		}
+
+		var status string
+		status, err = local.StartBundleDeploy(ctx, deployBundlePath, hostOverride)
+		if err != nil {
+			exitCode = cli.ExitFailure
+			if errors.Is(err, deployment.ErrInvalidOptions) {
+				exitCode = cli.ExitUsage
+			} else if status == metrics.StatusInterrupted {
+				exitCode = cli.ExitInterrupted
+			}
+			return cli.ReportError(quietErrors, exitCode, status, "Bundle Deployment Failed", err)
+		}
+
+		exitCode = cli.DeploymentExitCode(status)
+		if exitCode != cli.ExitSuccess && quietErrors {
+			cli.ReportError(quietErrors, exitCode, status, "", fmt.Errorf("deployment finished with status %s", status))
+		}
+	default:
+		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
+		return cli.ExitUsage
+	}
+	return
+}
@@ -0,0 +1,89 @@
+package subcommands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"scmp/cli"
+	"scmp/core/connect"
+	"scmp/internal/config"
+	"scmp/internal/config/sshconfig"
+	"scmp/internal/global"
+	"scmp/internal/sshinternal"
+	"syscall"
+	"time"
+)
+
+func Connect(ctx context.Context, subcmdLineage []string, args []string) (exitCode int) {
+	var configPath string
+	var hostOverride string
+	var persist bool
+	var closeConnections bool
+	var idleTimeout time.Duration
+	var opts config.Opts
+
+	commandFlags := flag.NewFlagSet(subcmdLineage[len(subcmdLineage)-1], flag.ExitOnError)
+	cli.SetDeployConfArguments(commandFlags, &configPath)
+	cli.RegisterString(commandFlags, &hostOverride, "r", "remote-hosts", "", "Hosts to hold connections to (group:NAME selects a group, !HOST excludes)")
+	cli.RegisterBool(commandFlags, &persist, "", "persist", false, "Connect to the hosts and hold the connections for later controller commands (runs until closed)")
+	cli.RegisterBool(commandFlags, &closeConnections, "", "close", false, "Close all persistent connections")
+	cli.RegisterDuration(commandFlags, &idleTimeout, "", "idle-timeout", sshinternal.DefaultControlIdleTimeout, "Close a held connection once no command used it for this long")
+	cli.SetHostKeyArguments(commandFlags, &opts)
+	globalVerbosity := cli.SetGlobalArguments(commandFlags, &opts)
+
+	commandFlags.Usage = func() {
+		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
+	}
+	if len(args) < 1 {
+		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
+		return 1
+	}
+	err := commandFlags.Parse(args[0:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if persist == closeConnections {
+		fmt.Fprintf(os.Stderr, "Error: exactly one of --persist or --close is required\n")
+		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
+		return 1
+	}
+
+	// Set verbosity and log outputs again if the user change at this command level
+	err = cli.SetLogging(ctx, *globalVerbosity, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// Set options in context
+	ctx = context.WithValue(ctx, global.OpsKey, opts)
+
+	ctx, err = sshconfig.Set(ctx, configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in controller configuration: %v\n", err)
+		return 1
+	}
+
+	if closeConnections {
+		err = connect.Close(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to close persistent connections: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	// Interrupts close the held connections cleanly
+	ctx, stopSignals := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	err = connect.Persist(ctx, hostOverride, idleTimeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed persistent connections: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -3,11 +3,14 @@ package subcommands
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"scmp/cli"
+	"scmp/core/deployment"
 	"scmp/core/deployment/local"
+	"scmp/core/deployment/metrics"
 	"scmp/internal/config"
 	"scmp/internal/config/sshconfig"
 	"scmp/internal/gitinternal"
@@ -21,46 +24,102 @@ func Deploy(ctx context.Context, subcmdLineage []string, args []string) (exitCod
 	var hostOverride string
 	var localFileOverride string
 	var testConfig bool
+	var skipResolve bool
 	var calledByGitHook bool
 	var configPath string
+	var exportDirectory string
+	var exportAllFiles bool
+	var includeArtifacts bool
+	var includeSecrets bool
+	var quietErrors bool
+	var selectHosts bool
+	var selectionFile string
 	var opts config.Opts
 
 	commandFlags := flag.NewFlagSet(subcmdLineage[len(subcmdLineage)-1], flag.ExitOnError)
-	commandFlags.StringVar(&hostOverride, "r", "", "Override hosts for deployment")
-	commandFlags.StringVar(&hostOverride, "remote-hosts", "", "Override hosts for deployment")
-	commandFlags.StringVar(&localFileOverride, "l", "", "Override file(s) for deployment")
-	commandFlags.StringVar(&localFileOverride, "local-files", "", "Override file(s) for deployment")
-	commandFlags.StringVar(&commitID, "C", "", "Commit ID (hash) to deploy from")
-	commandFlags.StringVar(&commitID, "commitid", "", "Commit ID (hash) to deploy from")
-	commandFlags.IntVar(&opts.MaxDeployConcurrency, "M", sshinternal.MaxSSHChannels, "Maximum simultaneous file deployments per host (1 disables threading)")
-	commandFlags.IntVar(&opts.MaxDeployConcurrency, "max-deploy-threads", sshinternal.MaxSSHChannels, "Maximum simultaneous file deployments per host (1 disables threading)")
-	commandFlags.BoolVar(&opts.RunInstallCommands, "install", false, "Run installation commands during deployment")
-	commandFlags.BoolVar(&opts.DisableReloads, "disable-reloads", false, "Disables running any reload commands")
-	commandFlags.BoolVar(&opts.IgnoreDeploymentState, "ignore-deployment-state", false, "Ignores deployment state in configuration file")
-	commandFlags.BoolVar(&calledByGitHook, "enable-commit-auto-rollback", false, "Enable git commit rollback on local processing errors")
-	commandFlags.BoolVar(&testConfig, "t", false, "Test configuration syntax and option validity")
-	commandFlags.BoolVar(&testConfig, "test-config", false, "Test configuration syntax and option validity")
-	commandFlags.BoolVar(&opts.RegexEnabled, "regex", false, "Enables regular expression parsing for file/host overrides")
+	cli.RegisterString(commandFlags, &hostOverride, "r", "remote-hosts", "", "Override hosts for deployment (group:NAME selects a group, !HOST excludes)")
+	cli.SetHostSelectionArguments(commandFlags, &selectHosts, &selectionFile)
+	cli.RegisterString(commandFlags, &localFileOverride, "l", "local-files", "", "Override file(s) for deployment")
+	cli.RegisterString(commandFlags, &commitID, "C", "commitid", "", "Commit ID (hash) to deploy from")
+	cli.RegisterInt(commandFlags, &opts.MaxDeployConcurrency, "M", "max-deploy-threads", sshinternal.MaxSSHChannels, "Maximum simultaneous file deployments per host (1 disables threading)")
+	cli.RegisterBool(commandFlags, &opts.RunInstallCommands, "", "install", false, "Run installation commands during deployment")
+	cli.RegisterBool(commandFlags, &opts.ForceInstall, "", "force-install", false, "Run installation commands even when InstallOnce markers record them as run (implies --install)")
+	cli.RegisterBool(commandFlags, &opts.DisableReloads, "", "disable-reloads", false, "Disables running any reload commands")
+	cli.RegisterBool(commandFlags, &opts.IgnoreDeploymentState, "", "ignore-deployment-state", false, "Ignores deployment state in configuration file")
+	cli.RegisterBool(commandFlags, &opts.AcknowledgeFanout, "", "acknowledge-fanout", false, "Skip confirmation when universal files exceed the fanout warning threshold")
+	cli.RegisterStringList(commandFlags, &opts.ConfirmHosts, "", "confirm-host", "Confirm deploying to a host marked RequireConfirmation (repeat for each host)")
+	cli.RegisterBool(commandFlags, &opts.AcknowledgeShrink, "", "acknowledge-shrink", false, "Deploy files shrinking by more than their MaxShrinkPercent without confirmation")
+	cli.RegisterBool(commandFlags, &opts.AllowUserDeletions, "", "allow-user-deletions", false, "Permits removing users and groups marked Absent in user metadata files (with --allow-deletions)")
+	cli.RegisterString(commandFlags, &opts.ReplaceFiles, "", "replace-files", "", "File(s) intentionally replaced in this deployment, never held for shrinking (same syntax as --local-files)")
+	cli.RegisterDuration(commandFlags, &opts.ChangedSince, "", "changed-since", 0, "Deploy only files changed by commits within this duration before now (like 48h, all mode only)")
+	cli.RegisterBool(commandFlags, &opts.AllBranches, "", "all-branches", false, "Deploy each branch in BranchMappings to its hosts (unmapped hosts use HEAD)")
+	cli.RegisterString(commandFlags, &opts.SummaryFormat, "", "summary-format", deployment.SummaryFormatText, "Deployment summary output format <text|json>")
+	cli.RegisterInt(commandFlags, &opts.TopReport, "", "top", 0, "Print the N slowest files and hosts with their queue, transfer, and command time after deployment (text summary only)")
+	cli.RegisterString(commandFlags, &opts.FailOnSkipped, "", "fail-on-skipped", "", "Fail deployment planning when files are skipped for these reasons <all|reason[,reason]>")
+	cli.RegisterInt(commandFlags, &opts.SkippedListLimit, "", "skipped-limit", deployment.SkippedListLimit, "Maximum skipped files listed per skip reason (0 lists all)")
+	cli.RegisterBool(commandFlags, &opts.ShowContentDiff, "", "show-diff", false, "Show differences between remote and local content of planned files without deploying")
+	cli.RegisterBool(commandFlags, &opts.Audit, "", "audit", false, "Report remote files differing from the repository (and extraneous files in managed directories) without deploying (all deployments only)")
+	cli.RegisterInt(commandFlags, &opts.BandwidthLimit, "", "bwlimit", 0, "Limit uploads to each host in KiB/s, shared by its concurrent uploads (0 is unlimited)")
+	cli.RegisterBool(commandFlags, &opts.LargeFilesFirst, "", "large-first", false, "Deploy larger files first when dependencies allow (default is smallest first)")
+	cli.RegisterDuration(commandFlags, &opts.DeploymentDeadline, "", "deadline", 0, "Maximum total time for the deployment, in-flight hosts are cut off when reached (like 30m, 0 is unlimited)")
+	cli.RegisterInt(commandFlags, &opts.CanaryHosts, "", "canary", 0, "Deploy to this many hosts first, a failure on any of them halts every other host (0 disables)")
+	cli.RegisterInt(commandFlags, &opts.BatchSize, "", "batch-size", 0, "Deploy to hosts in batches of this size, a failed batch halts the remaining batches (0 deploys all remaining hosts at once)")
+	cli.RegisterInt(commandFlags, &opts.BatchPause, "", "batch-pause", 0, "Seconds to wait between rollout batches")
+	cli.RegisterString(commandFlags, &opts.BatchCheck, "", "batch-check", "", "Local executable run between rollout batches, a failure halts the remaining batches")
+	cli.RegisterInt(commandFlags, &opts.LockWait, "", "wait-for-lock", 0, "Seconds to wait for another deployment to release a host lock (0 fails the host immediately)")
+	cli.RegisterInt(commandFlags, &opts.LockStaleAge, "", "lock-stale-age", 3600, "Seconds after which a host lock is abandoned and broken with a warning (0 never breaks)")
+	cli.RegisterBool(commandFlags, &opts.SkipPreflight, "", "skip-preflight", false, "Deploy without checking remote disk space and sudo access before transferring files")
+	cli.RegisterBool(commandFlags, &opts.GatherFacts, "", "gather-facts", false, "Gather remote OS facts before deploying to evaluate file conditions and fact macros")
+	cli.RegisterBool(commandFlags, &opts.UseCache, "", "use-cache", false, "Skip files whose last deployed hash, permissions, and owner in the local state cache match, without checking the remote")
+	cli.RegisterBool(commandFlags, &opts.RefreshCache, "", "refresh-cache", false, "Verify all files on the remote and rewrite their state cache entries")
+	cli.RegisterBool(commandFlags, &opts.Snapshot, "", "snapshot", false, "Capture remote state of planned files before and after deploying (for snapshot restore)")
+	cli.RegisterBool(commandFlags, &opts.StatusLines, "", "status-lines", false, "Show one live status line per host during deployment (snapshots when output is not a terminal)")
+	cli.RegisterBool(commandFlags, &opts.Progress, "", "progress", false, "Show a live progress line of hosts, files, and transferred size during deployment")
+	cli.RegisterBool(commandFlags, &opts.RunHooksOnDryRun, "", "run-hooks-on-dry-run", false, "Run PreDeployHook and PostDeployHook during dry-runs")
+	cli.RegisterString(commandFlags, &opts.SummaryFile, "", "summary-file", "", "Write JSON deployment summary to file instead of stdout")
+	cli.RegisterString(commandFlags, &opts.EventStream, "", "events", "", "Append JSON Lines deployment events to file as they happen (- for stdout)")
+	cli.RegisterString(commandFlags, &exportDirectory, "", "out", "", "Directory to write exported deployment content to (export only)")
+	cli.RegisterBool(commandFlags, &exportAllFiles, "", "all-files", false, "Export all files for the hosts instead of files changed in the commit (export only)")
+	cli.RegisterBool(commandFlags, &includeArtifacts, "", "include-artifacts", false, "Export artifact file content instead of hash reference stubs (export only)")
+	cli.RegisterBool(commandFlags, &includeSecrets, "", "include-secrets", false, "Export sensitive values and decrypted encrypted content instead of masking them (export only)")
+	cli.RegisterBool(commandFlags, &calledByGitHook, "", "enable-commit-auto-rollback", false, "Enable git commit rollback on local processing errors")
+	cli.RegisterBool(commandFlags, &testConfig, "t", "test-config", false, "Test configuration syntax and option validity")
+	cli.RegisterBool(commandFlags, &skipResolve, "", "skip-resolve", false, "Skip resolving host names when testing configuration (offline use)")
+	cli.RegisterBool(commandFlags, &opts.RegexEnabled, "", "regex", false, "Enables regular expression parsing for file/host overrides")
+	cli.RegisterBool(commandFlags, &quietErrors, "", "quiet-errors", false, "Report errors and unsuccessful outcomes on stderr only as a single JSON object (for automation)")
 	globalVerbosity := cli.SetGlobalArguments(commandFlags, &opts)
 	cli.SetSSHArguments(commandFlags, &opts)
 	cli.SetDeployConfArguments(commandFlags, &configPath)
+	cli.SetValuesArguments(commandFlags, &opts)
 
 	commandFlags.Usage = func() {
 		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
 	}
 	if len(args) < 1 {
 		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
-		return 1
+		return cli.ExitUsage
 	}
 	err := commandFlags.Parse(args[1:])
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		return 1
+		return cli.ExitUsage
 	}
 	subcommand := args[0]
 
-	// Set verbosity again if the user change at this command level
-	logctx.SetLogLevel(ctx, *globalVerbosity)
+	if opts.ForceInstall {
+		opts.RunInstallCommands = true
+	}
+
+	// Set verbosity and log outputs again if the user change at this command level
+	err = cli.SetLogging(ctx, *globalVerbosity, opts)
+	if err != nil {
+		return cli.ReportError(quietErrors, cli.ExitUsage, "", "Error", err)
+	}
+
+	err = cli.LoadValues(ctx, &opts)
+	if err != nil {
+		return cli.ReportError(quietErrors, cli.ExitUsage, "", "Error", err)
+	}
 
 	// Set options in context
 	ctx = context.WithValue(ctx, global.OpsKey, opts)
@@ -73,37 +132,63 @@ func Deploy(ctx context.Context, subcmdLineage []string, args []string) (exitCod
 
 	ctx, err = sshconfig.Set(ctx, configPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error in controller configuration: %v\n", err)
+		exitCode = cli.ReportError(quietErrors, cli.ExitUsage, "", "Error in controller configuration", err)
 
 		err = gitinternal.RollBackOneCommit(ctx, commitID, calledByGitHook, true)
 		if err != nil {
 			fmt.Printf("Error rolling back commit. %v\n", err)
 		}
-
-		return 1
+		return
 	}
 
 	if testConfig {
+		err = sshconfig.CheckEndpoints(ctx, !skipResolve)
+		if err != nil {
+			return cli.ReportError(quietErrors, cli.ExitUsage, "", "Error in controller configuration", err)
+		}
+
 		logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.InfoLog, "configuration file %s test is successful\n", configPath)
-		return 0
+		return cli.ExitSuccess
+	}
+
+	hostOverride, err = cli.ApplyHostSelection(ctx, selectHosts, selectionFile, hostOverride)
+	if err != nil {
+		return cli.ReportError(quietErrors, cli.ExitUsage, "", "Error", err)
 	}
 
-	if cli.IsValidSubcommand(cli.GetCLICmds(), subcmdLineage[len(subcmdLineage)-1], subcommand) {
+	if subcommand == deployment.ModeExport {
+		err = local.StartExport(ctx, commitID, hostOverride, localFileOverride, exportDirectory, exportAllFiles, includeArtifacts, includeSecrets)
+		if err != nil {
+			return cli.ReportError(quietErrors, cli.ExitFailure, "", "Export Failed", cli.MaskError(ctx, err))
+		}
+	} else if cli.IsValidSubcommand(cli.GetCLICmds(), subcmdLineage[len(subcmdLineage)-1], subcommand) {
 		var rollbackCommit bool
-		rollbackCommit, err = local.StartDeploy(ctx, subcommand, commitID, hostOverride, localFileOverride)
+		var status string
+		rollbackCommit, status, err = local.StartDeploy(ctx, subcommand, commitID, hostOverride, localFileOverride)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Deployment Failed: %v\n", err)
+			exitCode = cli.ExitFailure
+			if errors.Is(err, deployment.ErrInvalidOptions) {
+				exitCode = cli.ExitUsage
+			} else if status == metrics.StatusInterrupted {
+				exitCode = cli.ExitInterrupted
+			}
+			cli.ReportError(quietErrors, exitCode, status, "Deployment Failed", cli.MaskError(ctx, err))
 
 			err = gitinternal.RollBackOneCommit(ctx, commitID, calledByGitHook, rollbackCommit)
 			if err != nil {
 				fmt.Printf("Error rolling back commit. %v\n", err)
 			}
+			return
+		}
 
-			return 1
+		// Failed hosts are reported by the deployment summary, automation only needs the outcome
+		exitCode = cli.DeploymentExitCode(status)
+		if exitCode != cli.ExitSuccess && quietErrors {
+			cli.ReportError(quietErrors, exitCode, status, "", fmt.Errorf("deployment finished with status %s", status))
 		}
 	} else {
 		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
-		return 1
+		return cli.ExitUsage
 	}
-	return 0
+	return
 }
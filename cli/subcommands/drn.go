@@ -26,8 +26,8 @@ func DRN(ctx context.Context, subcmdLineage []string, args []string) (exitCode i
 
 	commandFlags := flag.NewFlagSet(subcmdLineage[len(subcmdLineage)-1], flag.ExitOnError)
 	cli.SetDeployConfArguments(commandFlags, &configPath)
-	commandFlags.StringVar(&hostAlias, "host-alias", "", "Use host alias for lookup context")
-	commandFlags.StringVar(&repoFilePath, "repo-file-path", "", "Use repository relative path for lookup context")
+	cli.RegisterString(commandFlags, &hostAlias, "", "host-alias", "", "Use host alias for lookup context")
+	cli.RegisterString(commandFlags, &repoFilePath, "", "repo-file-path", "", "Use repository relative path for lookup context")
 	globalVerbosity := cli.SetGlobalArguments(commandFlags, &opts)
 
 	commandFlags.Usage = func() {
@@ -46,8 +46,12 @@ func DRN(ctx context.Context, subcmdLineage []string, args []string) (exitCode i
 	// Set options in context
 	ctx = context.WithValue(ctx, global.OpsKey, opts)
 
-	// Set verbosity again if the user change at this command level
-	logctx.SetLogLevel(ctx, *globalVerbosity)
+	// Set verbosity and log outputs again if the user change at this command level
+	err = cli.SetLogging(ctx, *globalVerbosity, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
 
 	ctx, err = sshconfig.Set(ctx, configPath)
 	if err != nil {
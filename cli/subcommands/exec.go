@@ -6,27 +6,34 @@ import (
 	"fmt"
 	"os"
 	"scmp/cli"
+	"scmp/core/deployment/local"
 	"scmp/core/execution"
 	"scmp/internal/config"
 	"scmp/internal/config/sshconfig"
 	"scmp/internal/global"
-	"scmp/internal/logctx"
 	"strings"
 )
 
 func Exec(ctx context.Context, subcmdLineage []string, args []string) (exitCode int) {
 	var hostOverride string
 	var remoteFileOverride string
+	var restoreBackupHost string
 	var configPath string
+	var selectHosts bool
+	var selectionFile string
 	var opts config.Opts
 
 	commandFlags := flag.NewFlagSet(subcmdLineage[len(subcmdLineage)-1], flag.ExitOnError)
 	cli.SetDeployConfArguments(commandFlags, &configPath)
-	commandFlags.StringVar(&hostOverride, "r", "", "Override remote hosts")
-	commandFlags.StringVar(&hostOverride, "remote-hosts", "", "Override remote hosts")
-	commandFlags.StringVar(&remoteFileOverride, "R", "", "Override remote file(s)")
-	commandFlags.StringVar(&remoteFileOverride, "remote-files", "", "Override remote file(s)")
-	commandFlags.BoolVar(&opts.RegexEnabled, "regex", false, "Enables regular expression parsing for file/host overrides")
+	cli.RegisterString(commandFlags, &hostOverride, "r", "remote-hosts", "", "Override remote hosts (group:NAME selects a group, !HOST excludes)")
+	cli.SetHostSelectionArguments(commandFlags, &selectHosts, &selectionFile)
+	cli.RegisterString(commandFlags, &remoteFileOverride, "R", "remote-files", "", "Override remote file(s)")
+	cli.RegisterBool(commandFlags, &opts.RegexEnabled, "", "regex", false, "Enables regular expression parsing for file/host overrides")
+	cli.RegisterString(commandFlags, &opts.OutputDirectory, "", "output-dir", "", "Write each host's output to <dir>/<host>.out and all results to <dir>/results.json")
+	cli.RegisterBool(commandFlags, &opts.FailFast, "", "fail-fast", false, "Stop starting new hosts after the first host fails")
+	cli.RegisterBool(commandFlags, &opts.RequestPTY, "", "request-pty", false, "Run the command on a pseudo-terminal (output and errors are merged, sudo password prompts are answered)")
+	cli.RegisterString(commandFlags, &restoreBackupHost, "", "restore-backup", "", "Restore every file of an archived deployment on this host (argument is the archive timestamp)")
+	cli.SetValuesArguments(commandFlags, &opts)
 	cli.SetSSHArguments(commandFlags, &opts)
 	globalVerbosity := cli.SetGlobalArguments(commandFlags, &opts)
 
@@ -43,8 +50,18 @@ func Exec(ctx context.Context, subcmdLineage []string, args []string) (exitCode
 		return 1
 	}
 
-	// Set verbosity again if the user change at this command level
-	logctx.SetLogLevel(ctx, *globalVerbosity)
+	// Set verbosity and log outputs again if the user change at this command level
+	err = cli.SetLogging(ctx, *globalVerbosity, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	err = cli.LoadValues(ctx, &opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
 
 	// Set options in context
 	ctx = context.WithValue(ctx, global.OpsKey, opts)
@@ -55,12 +72,33 @@ func Exec(ctx context.Context, subcmdLineage []string, args []string) (exitCode
 		return 1
 	}
 
+	// Archive backups are copied back instead of running a command
+	if restoreBackupHost != "" {
+		if commandFlags.NArg() != 1 {
+			fmt.Fprintf(os.Stderr, "Error: --restore-backup requires the timestamp of the archived deployment\n")
+			cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
+			return 1
+		}
+		err = local.RestoreBackupArchive(ctx, restoreBackupHost, commandFlags.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed backup restore: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
 	executeCommands := strings.Join(commandFlags.Args(), " ")
 	if executeCommands == "" {
 		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
 		return 1
 	}
 
+	hostOverride, err = cli.ApplyHostSelection(ctx, selectHosts, selectionFile, hostOverride)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
 	err = execution.CLIEntry(ctx, executeCommands, hostOverride, remoteFileOverride)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -6,20 +6,28 @@ import (
 	"fmt"
 	"os"
 	"scmp/cli"
+	"scmp/core/filesystem"
 	"scmp/core/filesystem/content"
 	"scmp/internal/config"
+	"scmp/internal/config/sshconfig"
+	"scmp/internal/gitinternal"
 	"scmp/internal/global"
 	"scmp/internal/logctx"
 	"scmp/internal/str"
 )
 
 func File(ctx context.Context, subcmdLineage []string, args []string) (exitCode int) {
+	var configPath string
 	var userConfirmed bool
+	var newFileOpts newFileOptions
 	var opts config.Opts
 
 	commandFlags := flag.NewFlagSet(subcmdLineage[len(subcmdLineage)-1], flag.ExitOnError)
-	commandFlags.BoolVar(&userConfirmed, "y", false, "Confirm file overwrites")
-	commandFlags.BoolVar(&userConfirmed, "yes", false, "Confirm file overwrites")
+	cli.SetDeployConfArguments(commandFlags, &configPath)
+	cli.RegisterBool(commandFlags, &userConfirmed, "y", "yes", false, "Confirm file overwrites")
+	cli.RegisterString(commandFlags, &newFileOpts.templateName, "", "template", "", "Create new files from this template of the repository "+filesystem.NewFileTemplateDir+" directory (new only)")
+	cli.RegisterString(commandFlags, &newFileOpts.fromFile, "", "from", "", "Create new files with the metadata header of this repository file (new only)")
+	cli.RegisterBool(commandFlags, &newFileOpts.listTemplates, "", "list-templates", false, "List the templates available to new files (new only)")
 	globalVerbosity := cli.SetGlobalArguments(commandFlags, &opts)
 
 	commandFlags.Usage = func() {
@@ -34,33 +42,72 @@ func File(ctx context.Context, subcmdLineage []string, args []string) (exitCode
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
 	}
-	remainingArgs := commandFlags.Args()
 
-	// Set verbosity again if the user change at this command level
-	logctx.SetLogLevel(ctx, *globalVerbosity)
+	// Options may also follow the file paths (file new <path> --template name)
+	var remainingArgs []string
+	for commandFlags.NArg() > 0 {
+		remainingArgs = append(remainingArgs, commandFlags.Arg(0))
+		err = commandFlags.Parse(commandFlags.Args()[1:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+
+	// Set verbosity and log outputs again if the user change at this command level
+	err = cli.SetLogging(ctx, *globalVerbosity, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
 
 	// Set options in context
 	ctx = context.WithValue(ctx, global.OpsKey, opts)
 
-	invalidArgs := fileSetup(ctx, args[0], remainingArgs, userConfirmed)
+	invalidArgs, exitCode := fileSetup(ctx, args[0], remainingArgs, userConfirmed, newFileOpts, configPath)
 	if invalidArgs {
 		cli.PrintHelpMenu(commandFlags, append(subcmdLineage, args[0]), cli.GetCLICmds())
 		return 1
 	}
-	return 0
+	return exitCode
 }
 
-func fileSetup(ctx context.Context, subcommand string, remainingArgs []string, userConfirmed bool) (invalidArgs bool) {
+// Options of 'file new'
+type newFileOptions struct {
+	templateName  string
+	fromFile      string
+	listTemplates bool
+}
+
+func fileSetup(ctx context.Context, subcommand string, remainingArgs []string, userConfirmed bool, newFileOpts newFileOptions, configPath string) (invalidArgs bool, exitCode int) {
 	ctx = logctx.AppendCtxTag(ctx, logctx.NSFiles)
 
 	switch subcommand {
 	case "new":
+		if newFileOpts.listTemplates {
+			templateNames, err := content.ListTemplates()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed listing templates: %v\n", err)
+				exitCode = 1
+				return
+			}
+
+			if len(templateNames) == 0 {
+				fmt.Printf("No templates in '%s'\n", filesystem.NewFileTemplateDir)
+				return
+			}
+			for _, templateName := range templateNames {
+				fmt.Printf("  %s\n", templateName)
+			}
+			return
+		}
+
 		if len(remainingArgs) < 1 {
 			invalidArgs = true
 			return
 		}
 
-		content.WriteTemplateFile(ctx, str.LocalRepoPath(remainingArgs[0]), userConfirmed)
+		content.WriteTemplateFile(ctx, str.LocalRepoPath(remainingArgs[0]), newFileOpts.templateName, str.LocalRepoPath(newFileOpts.fromFile), userConfirmed)
 	case "replace-data":
 		if len(remainingArgs) < 2 {
 			invalidArgs = true
@@ -70,6 +117,56 @@ func fileSetup(ctx context.Context, subcommand string, remainingArgs []string, u
 		srcFile := str.LocalRepoPath(remainingArgs[0])
 		dstFile := str.LocalRepoPath(remainingArgs[1])
 		content.ReplaceData(ctx, srcFile, dstFile, userConfirmed)
+	case "to-artifact":
+		if len(remainingArgs) < 2 {
+			invalidArgs = true
+			return
+		}
+
+		err := gitinternal.ToArtifact(ctx, remainingArgs[0], remainingArgs[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed artifact conversion: %v\n", err)
+			exitCode = 1
+			return
+		}
+	case "from-artifact":
+		if len(remainingArgs) < 1 {
+			invalidArgs = true
+			return
+		}
+
+		err := gitinternal.FromArtifact(ctx, remainingArgs[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed artifact conversion: %v\n", err)
+			exitCode = 1
+			return
+		}
+	case "encrypt", "decrypt":
+		if len(remainingArgs) < 1 {
+			invalidArgs = true
+			return
+		}
+
+		// Vault location comes from the configuration
+		var err error
+		ctx, err = sshconfig.Set(ctx, configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in controller configuration: %v\n", err)
+			exitCode = 1
+			return
+		}
+
+		filePath := str.LocalRepoPath(remainingArgs[0])
+		if subcommand == "encrypt" {
+			err = content.EncryptFile(ctx, filePath)
+		} else {
+			err = content.DecryptFile(ctx, filePath)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to %s file: %v\n", subcommand, err)
+			exitCode = 1
+			return
+		}
 	default:
 		invalidArgs = true
 		return
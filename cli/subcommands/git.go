@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"os"
 	"scmp/cli"
+	"scmp/core/deployment/local"
 	"scmp/internal/config"
+	"scmp/internal/config/sshconfig"
 	"scmp/internal/gitinternal"
 	"scmp/internal/global"
 	"scmp/internal/logctx"
@@ -14,13 +16,17 @@ import (
 
 func Git(ctx context.Context, subcmdLineage []string, args []string) (exitCode int) {
 	var commitMessage string
+	var configPath string
+	var hostOverride string
+	var maxCount int
 	var globalVerbosity int
 
 	commandFlags := flag.NewFlagSet(subcmdLineage[len(subcmdLineage)-1], flag.ExitOnError)
-	commandFlags.StringVar(&commitMessage, "m", "", "Commit message")
-	commandFlags.StringVar(&commitMessage, "message", "", "Commit message")
-	commandFlags.IntVar(&globalVerbosity, "v", 1, "Increase detailed progress messages (Higher is more verbose) <0...5>")
-	commandFlags.IntVar(&globalVerbosity, "verbosity", 1, "Increase detailed progress messages (Higher is more verbose) <0...5>")
+	cli.RegisterString(commandFlags, &commitMessage, "m", "message", "", "Commit message")
+	cli.SetDeployConfArguments(commandFlags, &configPath)
+	cli.RegisterString(commandFlags, &hostOverride, "", "host", "", "Log/Diff: only show files deployed to these hosts/groups (same syntax as --remote-hosts)")
+	cli.RegisterInt(commandFlags, &maxCount, "n", "max-count", 10, "Log: number of commits with deployable files to show (0 shows all)")
+	cli.RegisterInt(commandFlags, &globalVerbosity, "v", "verbosity", 1, "Increase detailed progress messages (Higher is more verbose) <0...5>")
 
 	commandFlags.Usage = func() {
 		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
@@ -43,6 +49,16 @@ func Git(ctx context.Context, subcmdLineage []string, args []string) (exitCode i
 
 	subcommand := args[0]
 
+	// History subcommands filter files like a deployment and require the controller configuration
+	if subcommand == "log" || subcommand == "diff" {
+		ctx, err = sshconfig.Set(ctx, configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in controller configuration: %v\n", err)
+			return 1
+		}
+		return gitHistory(ctx, subcommand, hostOverride, maxCount)
+	}
+
 	invalidArgs, err := gitinternal.CLIEntry(ctx, subcommand, args, commitMessage)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -54,3 +70,34 @@ func Git(ctx context.Context, subcmdLineage []string, args []string) (exitCode i
 	}
 	return 0
 }
+
+// Prints commits or worktree changes reduced to deployable files
+func gitHistory(ctx context.Context, subcommand string, hostOverride string, maxCount int) (exitCode int) {
+	switch subcommand {
+	case "log":
+		commits, err := local.DeployableLog(ctx, hostOverride, maxCount)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exitCode = 1
+			return
+		}
+		if len(commits) == 0 {
+			fmt.Printf("No commits with deployable files\n")
+			return
+		}
+		local.PrintDeployableLog(os.Stdout, commits)
+	case "diff":
+		changes, err := local.DeployableDiff(ctx, hostOverride)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exitCode = 1
+			return
+		}
+		if len(changes) == 0 {
+			fmt.Printf("No uncommitted changes to deployable files\n")
+			return
+		}
+		local.PrintDeployableDiff(os.Stdout, changes)
+	}
+	return
+}
@@ -17,15 +17,17 @@ func Header(ctx context.Context, subcmdLineage []string, args []string) (exitCod
 	var editInPlace bool
 	var inputMetadata string
 	var compactJSONMode bool
+	var patch header.Patch
 	var opts config.Opts
 
 	commandFlags := flag.NewFlagSet(subcmdLineage[len(subcmdLineage)-1], flag.ExitOnError)
-	commandFlags.BoolVar(&editInPlace, "i", false, "Modify file in-place")
-	commandFlags.BoolVar(&editInPlace, "in-place", false, "Modify file in-place")
-	commandFlags.StringVar(&inputMetadata, "j", "", "Use provided metadata JSON ('-' to read it from stdin)")
-	commandFlags.StringVar(&inputMetadata, "json-metadata", "", "Use provided metadata JSON ('-' to read it from stdin)")
-	commandFlags.BoolVar(&compactJSONMode, "C", false, "Print JSON headers in single-line format")
-	commandFlags.BoolVar(&compactJSONMode, "compact", false, "Print JSON headers in single-line format")
+	cli.RegisterBool(commandFlags, &editInPlace, "i", "in-place", false, "Modify file in-place")
+	cli.RegisterString(commandFlags, &inputMetadata, "j", "json-metadata", "", "Use provided metadata JSON ('-' to read it from stdin)")
+	cli.RegisterBool(commandFlags, &compactJSONMode, "C", "compact", false, "Print JSON headers in single-line format")
+	cli.RegisterString(commandFlags, &patch.JSON, "", "json", "", "Edit: replace header keys with the keys of this JSON object (null removes a key)")
+	cli.RegisterStringList(commandFlags, &patch.Set, "", "set", "Edit: set header key to a JSON or string value as KEY=VALUE (repeatable)")
+	cli.RegisterString(commandFlags, &patch.OwnerGroup, "", "set-owner", "", "Edit: set FileOwnerGroup to user:group")
+	cli.RegisterStringList(commandFlags, &patch.AppendReload, "", "append-reload", "Edit: append command to Reload when not already present (repeatable)")
 	globalVerbosity := cli.SetGlobalArguments(commandFlags, &opts)
 
 	commandFlags.Usage = func() {
@@ -44,12 +46,16 @@ func Header(ctx context.Context, subcmdLineage []string, args []string) (exitCod
 	// Set options in context
 	ctx = context.WithValue(ctx, global.OpsKey, opts)
 
-	// Set verbosity again if the user change at this command level
-	logctx.SetLogLevel(ctx, *globalVerbosity)
+	// Set verbosity and log outputs again if the user change at this command level
+	err = cli.SetLogging(ctx, *globalVerbosity, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
 
 	remainingArgs := commandFlags.Args()
 
-	invalidArgs := headerSetup(ctx, args[0], remainingArgs, editInPlace, compactJSONMode, inputMetadata)
+	invalidArgs := headerSetup(ctx, args[0], remainingArgs, editInPlace, compactJSONMode, inputMetadata, patch, opts.DryRunEnabled)
 	if invalidArgs {
 		cli.PrintHelpMenu(commandFlags, append(subcmdLineage, args[0]), cli.GetCLICmds())
 		return 1
@@ -57,7 +63,7 @@ func Header(ctx context.Context, subcmdLineage []string, args []string) (exitCod
 	return 0
 }
 
-func headerSetup(ctx context.Context, subcommand string, remainingArgs []string, editInPlace, compactJSONMode bool, inputMetadata string) (invalidArgs bool) {
+func headerSetup(ctx context.Context, subcommand string, remainingArgs []string, editInPlace, compactJSONMode bool, inputMetadata string, patch header.Patch, dryRun bool) (invalidArgs bool) {
 	ctx = logctx.AppendCtxTag(ctx, logctx.NSFiles)
 
 	if len(remainingArgs) < 1 {
@@ -69,7 +75,15 @@ func headerSetup(ctx context.Context, subcommand string, remainingArgs []string,
 
 	switch subcommand {
 	case "edit":
-		header.Modify(ctx, path, inputMetadata, editInPlace)
+		if patch.IsEmpty() {
+			header.Modify(ctx, path, inputMetadata, editInPlace)
+		} else if inputMetadata != "" {
+			fmt.Fprintf(os.Stderr, "Error: --json-metadata replaces the whole header and cannot be combined with patch options\n")
+			invalidArgs = true
+			return
+		} else {
+			header.ApplyPatch(ctx, path, patch, dryRun)
+		}
 	case "strip":
 		header.Strip(ctx, path, editInPlace)
 	case "insert":
@@ -0,0 +1,160 @@
+package subcommands
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"scmp/cli"
+	"scmp/core/deployment/local"
+	"scmp/internal/config"
+	"scmp/internal/config/sshconfig"
+	"scmp/internal/global"
+	"scmp/internal/str"
+)
+
+func Lint(ctx context.Context, subcmdLineage []string, args []string) (exitCode int) {
+	var configPath string
+	var jsonOutput bool
+	var checkVault bool
+	var opts config.Opts
+
+	commandFlags := flag.NewFlagSet(subcmdLineage[len(subcmdLineage)-1], flag.ExitOnError)
+	cli.SetDeployConfArguments(commandFlags, &configPath)
+	cli.RegisterBool(commandFlags, &opts.IgnoreDeploymentState, "", "ignore-deployment-state", false, "Ignores deployment state in configuration file")
+	cli.RegisterBool(commandFlags, &jsonOutput, "", "json", false, "Config: print the report as JSON")
+	cli.RegisterBool(commandFlags, &checkVault, "", "check-vault", false, "Config: compare vault entries with configured hosts (asks for the vault password)")
+	globalVerbosity := cli.SetGlobalArguments(commandFlags, &opts)
+
+	commandFlags.Usage = func() {
+		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
+	}
+	if len(args) < 1 {
+		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
+		return 1
+	}
+	err := commandFlags.Parse(args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// Set options in context
+	ctx = context.WithValue(ctx, global.OpsKey, opts)
+
+	// Set verbosity and log outputs again if the user change at this command level
+	err = cli.SetLogging(ctx, *globalVerbosity, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// Config lint reports configuration errors itself instead of stopping at the first one
+	if args[0] == "config" {
+		exitCode = lintConfig(ctx, configPath, checkVault, jsonOutput)
+		return
+	}
+
+	ctx, err = sshconfig.Set(ctx, configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in controller configuration: %v\n", err)
+		return 1
+	}
+
+	remainingArgs := commandFlags.Args()
+
+	newsub := append(subcmdLineage, args[0])
+
+	invalidArgs, exitCode := lintSetup(ctx, args[0], remainingArgs)
+	if invalidArgs {
+		cli.PrintHelpMenu(commandFlags, newsub, cli.GetCLICmds())
+		return 1
+	}
+	return exitCode
+}
+
+func lintSetup(ctx context.Context, subcommand string, remainingArgs []string) (invalidArgs bool, exitCode int) {
+	switch subcommand {
+	case "who-gets":
+		if len(remainingArgs) < 1 {
+			invalidArgs = true
+			exitCode = 1
+			return
+		}
+		repoFilePath := str.LocalRepoPath(remainingArgs[0])
+
+		fileFanout, err := local.WhoGets(ctx, repoFilePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed host lookup: %v\n", err)
+			exitCode = 1
+			return
+		}
+
+		fmt.Printf("Host(s) receiving '%s' via %s:\n", repoFilePath, fileFanout.Reason)
+		if len(fileFanout.Hosts) == 0 {
+			fmt.Printf("  **No Hosts Receive File**\n")
+			exitCode = 2
+		}
+		for _, host := range fileFanout.Hosts {
+			fmt.Printf("  %s\n", host)
+		}
+	case "headers":
+		findings, filesChecked, err := local.LintHeaders(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed header lint: %v\n", err)
+			exitCode = 1
+			return
+		}
+
+		var unsafeHeaders int
+		for _, finding := range findings {
+			if finding.Unsafe {
+				unsafeHeaders++
+				fmt.Printf("  ERROR %s: %s\n", finding.RepoFilePath, finding.Message)
+			} else {
+				fmt.Printf("  WARN  %s: %s\n", finding.RepoFilePath, finding.Message)
+			}
+		}
+		fmt.Printf("Checked %d metadata header(s): %d error(s), %d warning(s)\n", filesChecked, unsafeHeaders, len(findings)-unsafeHeaders)
+		if unsafeHeaders > 0 {
+			exitCode = 2
+		}
+	default:
+		invalidArgs = true
+		exitCode = 1
+		return
+	}
+	return
+}
+
+// Prints every configuration problem, exits 2 when errors were found and 3 when only warnings were found
+func lintConfig(ctx context.Context, configPath string, checkVault bool, jsonOutput bool) (exitCode int) {
+	report := local.LintConfig(ctx, configPath, checkVault)
+
+	if jsonOutput {
+		reportJSON, err := json.MarshalIndent(report, "", " ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create JSON report: %v\n", err)
+			exitCode = 1
+			return
+		}
+		fmt.Println(string(reportJSON))
+	} else {
+		for _, finding := range report.Findings {
+			if finding.Severity == local.SeverityError {
+				fmt.Printf("  ERROR %s: %s\n", finding.Subject, finding.Message)
+			} else {
+				fmt.Printf("  WARN  %s: %s\n", finding.Subject, finding.Message)
+			}
+		}
+		fmt.Printf("Checked controller configuration: %d error(s), %d warning(s)\n", report.Errors, report.Warnings)
+	}
+
+	if report.Errors > 0 {
+		exitCode = 2
+	} else if report.Warnings > 0 {
+		exitCode = 3
+	}
+	return
+}
@@ -4,12 +4,13 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"math"
 	"os"
 	"scmp/cli"
 	"scmp/internal/config"
 	"scmp/internal/config/sshconfig"
+	"scmp/internal/crypto"
 	"scmp/internal/global"
-	"scmp/internal/logctx"
 	"scmp/internal/secrets"
 	"scmp/internal/str"
 )
@@ -18,13 +19,16 @@ func Secrets(ctx context.Context, subcmdLineage []string, args []string) (exitCo
 	var modifyVaultHost string
 	var genNewHash bool
 	var configPath string
+	var kdfTime, kdfMemory, kdfThreads int
 	var opts config.Opts
 
 	commandFlags := flag.NewFlagSet(subcmdLineage[len(subcmdLineage)-1], flag.ExitOnError)
 	cli.SetDeployConfArguments(commandFlags, &configPath)
-	commandFlags.StringVar(&modifyVaultHost, "p", "", "Create/Update/Delete password for given host.Name")
-	commandFlags.StringVar(&modifyVaultHost, "modify-vault-password", "", "Create/Update/Delete password for given host.Name")
-	commandFlags.BoolVar(&genNewHash, "generate-password-hash", false, "Generate new user password hash for web")
+	cli.RegisterString(commandFlags, &modifyVaultHost, "p", "modify-vault-password", "", "Create/Update/Delete password for given host.Name")
+	cli.RegisterBool(commandFlags, &genNewHash, "", "generate-password-hash", false, "Generate new user password hash for web")
+	cli.RegisterInt(commandFlags, &kdfTime, "", "kdf-time", 0, "Argon2 passes of the re-encrypted vault (rekey only, 0 keeps the current value)")
+	cli.RegisterInt(commandFlags, &kdfMemory, "", "kdf-memory", 0, "Argon2 memory in MiB of the re-encrypted vault (rekey only, 0 keeps the current value)")
+	cli.RegisterInt(commandFlags, &kdfThreads, "", "kdf-threads", 0, "Argon2 threads of the re-encrypted vault (rekey only, 0 keeps the current value)")
 	globalVerbosity := cli.SetGlobalArguments(commandFlags, &opts)
 
 	commandFlags.Usage = func() {
@@ -34,14 +38,39 @@ func Secrets(ctx context.Context, subcmdLineage []string, args []string) (exitCo
 		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
 		return 1
 	}
+	// Verify and rekey are the only subcommands, all other actions are flags
+	var subcommand string
+	if args[0] == "verify" || args[0] == "rekey" {
+		subcommand = args[0]
+		args = args[1:]
+	}
+
 	err := commandFlags.Parse(args[0:])
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
 	}
 
-	// Set verbosity again if the user change at this command level
-	logctx.SetLogLevel(ctx, *globalVerbosity)
+	// Set verbosity and log outputs again if the user change at this command level
+	err = cli.SetLogging(ctx, *globalVerbosity, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if kdfTime < 0 || kdfMemory < 0 || kdfThreads < 0 {
+		fmt.Fprintf(os.Stderr, "Error: argon2 parameters cannot be negative\n")
+		return 1
+	}
+	if kdfThreads > math.MaxUint8 || kdfMemory > math.MaxUint32/1024 || int64(kdfTime) > math.MaxUint32 {
+		fmt.Fprintf(os.Stderr, "Error: argon2 parameters are too large\n")
+		return 1
+	}
+	if subcommand != "rekey" && kdfTime+kdfMemory+kdfThreads > 0 {
+		fmt.Fprintf(os.Stderr, "Error: argon2 parameters are only used by the rekey subcommand\n")
+		return 1
+	}
+	kdfOverride := crypto.KDFParams{Time: uint32(kdfTime), Memory: uint32(kdfMemory) * 1024, Threads: uint8(kdfThreads)}
 
 	// Set options in context
 	ctx = context.WithValue(ctx, global.OpsKey, opts)
@@ -54,7 +83,7 @@ func Secrets(ctx context.Context, subcmdLineage []string, args []string) (exitCo
 
 	config := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
 
-	err = secrets.CLIEntry(ctx, config, str.RepoRootDir(modifyVaultHost), genNewHash)
+	err = secrets.CLIEntry(ctx, config, str.RepoRootDir(modifyVaultHost), genNewHash, subcommand, kdfOverride)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
@@ -17,16 +17,21 @@ func Seed(ctx context.Context, subcmdLineage []string, args []string) (exitCode
 	var hostOverride string
 	var remoteFileOverride string
 	var configPath string
+	var selectHosts bool
+	var selectionFile string
 	var opts config.Opts
 
 	commandFlags := flag.NewFlagSet(subcmdLineage[len(subcmdLineage)-1], flag.ExitOnError)
 	cli.SetDeployConfArguments(commandFlags, &configPath)
-	commandFlags.StringVar(&hostOverride, "r", "", "Override remote hosts")
-	commandFlags.StringVar(&hostOverride, "remote-hosts", "", "Override remote hosts")
-	commandFlags.StringVar(&remoteFileOverride, "R", "", "Override remote file(s)")
-	commandFlags.StringVar(&remoteFileOverride, "remote-files", "", "Override remote file(s)")
-	commandFlags.BoolVar(&opts.RegexEnabled, "regex", false, "Enables regular expression parsing for file/host overrides")
-	commandFlags.BoolVar(&opts.IgnoreDeploymentState, "ignore-deployment-state", false, "Ignores deployment state in configuration file")
+	cli.RegisterString(commandFlags, &hostOverride, "r", "remote-hosts", "", "Override remote hosts (group:NAME selects a group, !HOST excludes)")
+	cli.SetHostSelectionArguments(commandFlags, &selectHosts, &selectionFile)
+	cli.RegisterString(commandFlags, &remoteFileOverride, "R", "remote-files", "", "Override remote file(s), absolute glob patterns are expanded on the host (** matches any directories)")
+	cli.RegisterBool(commandFlags, &opts.SeedBrowse, "", "browse", false, "Browse remote directories to select files, in addition to any remote files given")
+	cli.RegisterBool(commandFlags, &opts.RegexEnabled, "", "regex", false, "Enables regular expression parsing for file/host overrides")
+	cli.RegisterBool(commandFlags, &opts.IgnoreDeploymentState, "", "ignore-deployment-state", false, "Ignores deployment state in configuration file")
+	cli.RegisterInt(commandFlags, &opts.SeedParentDepth, "", "parent-depth", seed.DefaultParentDepth, "Maximum parent directories above selections to save non-default metadata for (0 disables)")
+	cli.RegisterBool(commandFlags, &opts.CaptureXattrs, "", "capture-xattrs", false, "Record user and trusted extended attributes of seeded files into their headers")
+	cli.SetHostKeyArguments(commandFlags, &opts)
 	globalVerbosity := cli.SetGlobalArguments(commandFlags, &opts)
 
 	commandFlags.Usage = func() {
@@ -42,8 +47,12 @@ func Seed(ctx context.Context, subcmdLineage []string, args []string) (exitCode
 		return 1
 	}
 
-	// Set verbosity again if the user change at this command level
-	logctx.SetLogLevel(ctx, *globalVerbosity)
+	// Set verbosity and log outputs again if the user change at this command level
+	err = cli.SetLogging(ctx, *globalVerbosity, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
 
 	// Set options in context
 	ctx = context.WithValue(ctx, global.OpsKey, opts)
@@ -56,6 +65,12 @@ func Seed(ctx context.Context, subcmdLineage []string, args []string) (exitCode
 		return 1
 	}
 
+	hostOverride, err = cli.ApplyHostSelection(ctx, selectHosts, selectionFile, hostOverride)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
 	seed.SeedRepositoryFiles(ctx, hostOverride, remoteFileOverride)
 	return 0
 }
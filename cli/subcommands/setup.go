@@ -7,6 +7,7 @@ import (
 	"os"
 	"scmp/cli"
 	"scmp/internal/config"
+	"scmp/internal/gitinternal"
 	"scmp/internal/global"
 	"scmp/internal/logctx"
 	"scmp/setup"
@@ -18,14 +19,18 @@ func Install(ctx context.Context, subcmdLineage []string, args []string) (exitCo
 	var installBashAutoComplete bool
 	var newRepoBranch string
 	var newRepoPath string
+	var legacyConfigPath string
+	var configPath string
 	var opts config.Opts
 
 	commandFlags := flag.NewFlagSet(subcmdLineage[len(subcmdLineage)-1], flag.ExitOnError)
-	commandFlags.StringVar(&newRepoPath, "repository-path", "", "Path to repository")
-	commandFlags.StringVar(&newRepoBranch, "repository-branch-name", "main", "Initial branch new for new repository")
-	commandFlags.BoolVar(&installDefaultConfig, "default-config", false, "Write default SSH configuration file")
-	commandFlags.BoolVar(&installBashAutoComplete, "bash-autocomplete", false, "Setup BASH autocompletion function")
-	commandFlags.BoolVar(&installAAProf, "apparmor-profile", false, "Enable apparmor profile if supported")
+	cli.RegisterString(commandFlags, &newRepoPath, "", "repository-path", "", "Path to repository")
+	cli.RegisterString(commandFlags, &newRepoBranch, "", "repository-branch-name", "main", "Initial branch new for new repository")
+	cli.RegisterBool(commandFlags, &installDefaultConfig, "", "default-config", false, "Write default SSH configuration file")
+	cli.RegisterBool(commandFlags, &installBashAutoComplete, "", "bash-autocomplete", false, "Setup BASH autocompletion function")
+	cli.RegisterBool(commandFlags, &installAAProf, "", "apparmor-profile", false, "Enable apparmor profile if supported")
+	cli.RegisterString(commandFlags, &legacyConfigPath, "", "legacy-config", setup.LegacyConfigPath, "Path to the v4 YAML configuration file (for migrate-v4)")
+	cli.SetDeployConfArguments(commandFlags, &configPath)
 	globalVerbosity := cli.SetGlobalArguments(commandFlags, &opts)
 
 	commandFlags.Usage = func() {
@@ -35,21 +40,48 @@ func Install(ctx context.Context, subcmdLineage []string, args []string) (exitCo
 		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
 		return 1
 	}
+
+	// Migration is the only subcommand, all other actions are flags
+	var subcommand string
+	if args[0] == "migrate-v4" {
+		subcommand = args[0]
+		args = args[1:]
+	}
+
 	err := commandFlags.Parse(args[0:])
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
 	}
 
-	// Set verbosity again if the user change at this command level
-	logctx.SetLogLevel(ctx, *globalVerbosity)
+	// Set verbosity and log outputs again if the user change at this command level
+	err = cli.SetLogging(ctx, *globalVerbosity, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
 
 	// Set options in context
 	ctx = context.WithValue(ctx, global.OpsKey, opts)
 
 	ctx = logctx.AppendCtxTag(ctx, logctx.NSSetup)
 
-	if installAAProf {
+	if subcommand == "migrate-v4" {
+		// Migrate repository in current directory unless told otherwise
+		if newRepoPath == "" {
+			newRepoPath, err = gitinternal.RetrieveRepoPath(ctx)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+		}
+
+		err = setup.MigrateV4(ctx, legacyConfigPath, configPath, newRepoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	} else if installAAProf {
 		setup.AAProfile(ctx, newRepoPath)
 	} else if installDefaultConfig {
 		setup.SSHConfig(ctx)
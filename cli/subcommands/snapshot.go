@@ -0,0 +1,115 @@
+package subcommands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"scmp/cli"
+	"scmp/core/deployment/local"
+	"scmp/internal/config"
+	"scmp/internal/config/sshconfig"
+	"scmp/internal/global"
+	"strings"
+)
+
+func Snapshot(ctx context.Context, subcmdLineage []string, args []string) (exitCode int) {
+	var configPath string
+	var hostName string
+	var snapshotID string
+	var opts config.Opts
+
+	commandFlags := flag.NewFlagSet(subcmdLineage[len(subcmdLineage)-1], flag.ExitOnError)
+	cli.SetDeployConfArguments(commandFlags, &configPath)
+	cli.RegisterString(commandFlags, &hostName, "", "host", "", "Host the snapshot was taken of")
+	cli.RegisterString(commandFlags, &snapshotID, "", "snapshot", "", "Snapshot ID to restore (restore only)")
+	cli.SetSSHArguments(commandFlags, &opts)
+	globalVerbosity := cli.SetGlobalArguments(commandFlags, &opts)
+
+	commandFlags.Usage = func() {
+		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
+	}
+	if len(args) < 1 {
+		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
+		return 1
+	}
+	err := commandFlags.Parse(args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// Set options in context
+	ctx = context.WithValue(ctx, global.OpsKey, opts)
+
+	// Set verbosity and log outputs again if the user change at this command level
+	err = cli.SetLogging(ctx, *globalVerbosity, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	newsub := append(subcmdLineage, args[0])
+
+	if hostName == "" {
+		fmt.Fprintf(os.Stderr, "Error: --host is required\n")
+		cli.PrintHelpMenu(commandFlags, newsub, cli.GetCLICmds())
+		return 1
+	}
+
+	ctx, err = sshconfig.Set(ctx, configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in controller configuration: %v\n", err)
+		return 1
+	}
+
+	invalidArgs, exitCode := snapshotSetup(ctx, args[0], hostName, snapshotID)
+	if invalidArgs {
+		cli.PrintHelpMenu(commandFlags, newsub, cli.GetCLICmds())
+		return 1
+	}
+	return exitCode
+}
+
+func snapshotSetup(ctx context.Context, subcommand string, hostName string, snapshotID string) (invalidArgs bool, exitCode int) {
+	switch subcommand {
+	case "list":
+		snapshots, err := local.ListSnapshots(ctx, hostName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed listing snapshots: %v\n", err)
+			exitCode = 1
+			return
+		}
+
+		if len(snapshots) == 0 {
+			fmt.Printf("No snapshots for host '%s'\n", hostName)
+			return
+		}
+		for _, info := range snapshots {
+			fmt.Printf("  %s  phases: %-8s items: %d", info.ID, strings.Join(info.Phases, ","), info.Entries)
+			if info.Skipped > 0 {
+				fmt.Printf(" (%d without content)", info.Skipped)
+			}
+			fmt.Printf("\n")
+		}
+	case "restore":
+		if snapshotID == "" {
+			fmt.Fprintf(os.Stderr, "Error: --snapshot is required for restore\n")
+			invalidArgs = true
+			exitCode = 1
+			return
+		}
+
+		err := local.RestoreSnapshot(ctx, hostName, snapshotID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed snapshot restore: %v\n", err)
+			exitCode = 1
+			return
+		}
+	default:
+		invalidArgs = true
+		exitCode = 1
+		return
+	}
+	return
+}
@@ -0,0 +1,99 @@
+package subcommands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"scmp/cli"
+	"scmp/core/hostkeys"
+	"scmp/internal/config"
+	"scmp/internal/config/sshconfig"
+	"scmp/internal/global"
+)
+
+func SSHKeys(ctx context.Context, subcmdLineage []string, args []string) (exitCode int) {
+	var configPath string
+	var hostOverride string
+	var opts config.Opts
+
+	commandFlags := flag.NewFlagSet(subcmdLineage[len(subcmdLineage)-1], flag.ExitOnError)
+	cli.SetDeployConfArguments(commandFlags, &configPath)
+	cli.RegisterString(commandFlags, &hostOverride, "r", "remote-hosts", "", "Override remote hosts to scan (group:NAME selects a group, !HOST excludes)")
+	cli.SetHostKeyArguments(commandFlags, &opts)
+	globalVerbosity := cli.SetGlobalArguments(commandFlags, &opts)
+
+	commandFlags.Usage = func() {
+		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
+	}
+	if len(args) < 1 {
+		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
+		return 1
+	}
+	err := commandFlags.Parse(args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// Set options in context
+	ctx = context.WithValue(ctx, global.OpsKey, opts)
+
+	// Set verbosity and log outputs again if the user change at this command level
+	err = cli.SetLogging(ctx, *globalVerbosity, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	newsub := append(subcmdLineage, args[0])
+
+	ctx, err = sshconfig.Set(ctx, configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in controller configuration: %v\n", err)
+		return 1
+	}
+
+	invalidArgs, exitCode := sshKeysSetup(ctx, args[0], hostOverride, commandFlags.Args())
+	if invalidArgs {
+		cli.PrintHelpMenu(commandFlags, newsub, cli.GetCLICmds())
+		return 1
+	}
+	return exitCode
+}
+
+func sshKeysSetup(ctx context.Context, subcommand string, hostOverride string, remainingArgs []string) (invalidArgs bool, exitCode int) {
+	switch subcommand {
+	case "scan":
+		err := hostkeys.Scan(ctx, hostOverride)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed host key scan: %v\n", err)
+			exitCode = 1
+			return
+		}
+	case "add", "remove":
+		if len(remainingArgs) != 1 {
+			fmt.Fprintf(os.Stderr, "Error: exactly one host name is required\n")
+			invalidArgs = true
+			exitCode = 1
+			return
+		}
+
+		var err error
+		if subcommand == "add" {
+			err = hostkeys.Add(ctx, remainingArgs[0])
+		} else {
+			err = hostkeys.Remove(ctx, remainingArgs[0])
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed host key %s: %v\n", subcommand, err)
+			exitCode = 1
+			return
+		}
+	default:
+		invalidArgs = true
+		exitCode = 1
+		return
+	}
+	return
+}
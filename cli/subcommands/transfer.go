@@ -10,7 +10,6 @@ import (
 	"scmp/internal/config"
 	"scmp/internal/config/sshconfig"
 	"scmp/internal/global"
-	"scmp/internal/logctx"
 )
 
 func SCP(ctx context.Context, subcmdLineage []string, args []string) (exitCode int) {
@@ -19,6 +18,7 @@ func SCP(ctx context.Context, subcmdLineage []string, args []string) (exitCode i
 
 	commandFlags := flag.NewFlagSet(subcmdLineage[len(subcmdLineage)-1], flag.ExitOnError)
 	cli.SetDeployConfArguments(commandFlags, &configPath)
+	cli.SetHostKeyArguments(commandFlags, &opts)
 	globalVerbosity := cli.SetGlobalArguments(commandFlags, &opts)
 
 	commandFlags.Usage = func() {
@@ -34,8 +34,12 @@ func SCP(ctx context.Context, subcmdLineage []string, args []string) (exitCode i
 		return 1
 	}
 
-	// Set verbosity again if the user change at this command level
-	logctx.SetLogLevel(ctx, *globalVerbosity)
+	// Set verbosity and log outputs again if the user change at this command level
+	err = cli.SetLogging(ctx, *globalVerbosity, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
 
 	// Set options in context
 	ctx = context.WithValue(ctx, global.OpsKey, opts)
@@ -8,7 +8,6 @@ import (
 	"scmp/cli"
 	"scmp/internal/config"
 	"scmp/internal/global"
-	"scmp/internal/logctx"
 	"scmp/web"
 )
 
@@ -18,10 +17,8 @@ func Web(ctx context.Context, subcmdLineage []string, args []string) (exitCode i
 	var opts config.Opts
 
 	commandFlags := flag.NewFlagSet(subcmdLineage[len(subcmdLineage)-1], flag.ExitOnError)
-	commandFlags.StringVar(&webConfigPath, "c", web.DefaultWebConfigPath, "Path to web configuration")
-	commandFlags.StringVar(&webConfigPath, "config", web.DefaultWebConfigPath, "Path to web configuration")
-	commandFlags.BoolVar(&startServer, "s", false, "Start HTTPS server")
-	commandFlags.BoolVar(&startServer, "start-server", false, "Start HTTPS server")
+	cli.RegisterString(commandFlags, &webConfigPath, "c", "config", web.DefaultWebConfigPath, "Path to web configuration")
+	cli.RegisterBool(commandFlags, &startServer, "s", "start-server", false, "Start HTTPS server")
 	globalVerbosity := cli.SetGlobalArguments(commandFlags, &opts)
 
 	commandFlags.Usage = func() {
@@ -33,8 +30,12 @@ func Web(ctx context.Context, subcmdLineage []string, args []string) (exitCode i
 		return 1
 	}
 
-	// Set verbosity again if the user change at this command level
-	logctx.SetLogLevel(ctx, *globalVerbosity)
+	// Set verbosity and log outputs again if the user change at this command level
+	err = cli.SetLogging(ctx, *globalVerbosity, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
 
 	// Set options in context
 	ctx = context.WithValue(ctx, global.OpsKey, opts)
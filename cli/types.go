@@ -5,6 +5,11 @@ import "context"
 
 const RootCLICommand string = "root"
 
+// Flag value collecting every occurrence of a repeatable option
+type stringList struct {
+	values *[]string
+}
+
 type CommandSet struct {
 	CommandName string // Exact name of cli command
 	PrimaryFunc func(ctx context.Context,
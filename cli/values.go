@@ -0,0 +1,27 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"scmp/internal/config"
+	"scmp/internal/logctx"
+)
+
+// Loads the values file of the options (--values) and masks its sensitive values in all further logs
+func LoadValues(ctx context.Context, opts *config.Opts) (err error) {
+	opts.Values, err = config.LoadValues(opts.ValuesFile)
+	if err != nil {
+		return
+	}
+	logctx.MaskValues(ctx, opts.Values.SensitiveValues()...)
+	return
+}
+
+// Error with every sensitive value masked, for errors reported outside of the logs
+func MaskError(ctx context.Context, err error) (masked error) {
+	if err == nil {
+		return
+	}
+	masked = errors.New(logctx.Mask(ctx, err.Error()))
+	return
+}
@@ -1,6 +1,9 @@
 package cli
 
-import "sync"
+import (
+	"flag"
+	"sync"
+)
 
 var (
 	// Store all commands, options, arguments and their relevant help menu text
@@ -8,4 +11,8 @@ var (
 	cliOptsSet   bool
 	cliOptsOnce  sync.Once
 	cliOptsMutex sync.RWMutex
+
+	// Short flag names by long name for each flag set using the Register helpers
+	flagPairs      = make(map[*flag.FlagSet]map[string]string)
+	flagPairsMutex sync.RWMutex
 )
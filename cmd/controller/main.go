@@ -33,12 +33,12 @@ func main() {
 	}
 	if len(args) < 2 {
 		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
-		os.Exit(1)
+		os.Exit(cli.ExitUsage)
 	}
 	err = commandFlags.Parse(args[1:])
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(cli.ExitUsage)
 	}
 
 	// Retrieve command and args
@@ -57,21 +57,22 @@ func main() {
 	ctx = context.WithValue(ctx, global.UserKey, global.GlobalUsername)
 
 	// Use primary function from CLI definition
-	exitCode := 0
+	exitCode := cli.ExitSuccess
 	cmdInfo := allOpts.ChildCommands[command]
 	if cmdInfo == nil {
 		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
-		exitCode = 1
+		exitCode = cli.ExitUsage
 	} else if cmdInfo.PrimaryFunc != nil {
 		exitCode = cmdInfo.PrimaryFunc(ctx, append(subcmdLineage, command), args)
 	} else {
 		cli.PrintHelpMenu(commandFlags, subcmdLineage, cli.GetCLICmds())
-		exitCode = 1
+		exitCode = cli.ExitUsage
 	}
 
 	// Finish up any stdout writes for global logger
 	cancel()
 	logger.Wake()
 	logger.Wait()
+	_ = logger.CloseSinks()
 	os.Exit(exitCode)
 }
@@ -0,0 +1,211 @@
+// Package for holding persistent SSH connections that later controller commands reuse
+package connect
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/parsing"
+	"scmp/internal/secrets"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Connection held for one host and the proxy hops it was reached through
+type heldConnection struct {
+	name   str.RepoRootDir
+	server *sshinternal.ControlServer
+	proxy  *sshinternal.ProxyLease
+	done   chan struct{} // Closed once the server stops serving (held connection dropped)
+}
+
+// Connects to every selected host and holds the connections until closed, the context ends, or they are idle for idleTimeout
+// Other controller commands reuse a held connection through its control socket instead of connecting again
+// Hosts that cannot be connected are reported and do not stop the others
+func Persist(ctx context.Context, hosts string, idleTimeout time.Duration) (err error) {
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSSSH)
+
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	if hosts == "" {
+		err = fmt.Errorf("remote-hosts cannot be empty when holding persistent connections")
+		return
+	}
+	hosts, err = parsing.RetrieveURIFile(ctx, hosts)
+	if err != nil {
+		err = fmt.Errorf("failed to parse remote-hosts URI: %w", err)
+		return
+	}
+	err = parsing.ValidateOverride(opts.RegexEnabled, hosts)
+	if err != nil {
+		err = fmt.Errorf("remote-hosts: %w", err)
+		return
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = sshinternal.DefaultControlIdleTimeout
+	}
+
+	// Held connections are always dialed directly, never through another process's control socket
+	dialCfg := cfg
+	dialCfg.ControlDirectory = ""
+	dialCtx := context.WithValue(ctx, global.ConfKey, dialCfg)
+
+	var held []*heldConnection
+	var failedHosts int
+	for _, endpointName := range slices.Sorted(maps.Keys(cfg.HostInfo)) {
+		if parsing.CheckForOverride(ctx, hosts, string(endpointName), cfg.HostInfo) {
+			continue
+		}
+
+		connection, lerr := holdHost(dialCtx, cfg, endpointName)
+		if lerr != nil {
+			fmt.Fprintf(os.Stderr, "  %-20s failed: %v\n", endpointName, lerr)
+			failedHosts++
+			continue
+		}
+		fmt.Printf("  %-20s connected\n", endpointName)
+		held = append(held, connection)
+	}
+	if len(held) == 0 {
+		err = fmt.Errorf("no persistent connections established (%d host(s) failed)", failedHosts)
+		return
+	}
+
+	var servers sync.WaitGroup
+	for _, connection := range held {
+		servers.Add(1)
+		go func() {
+			defer servers.Done()
+			defer close(connection.done)
+			connection.server.Serve(logctx.AppendCtxTag(ctx, string(connection.name)))
+		}()
+	}
+
+	fmt.Printf("Holding persistent connections to %d host(s), close them with 'controller connect --close' (idle timeout %s)\n", len(held), idleTimeout)
+	waitForClose(ctx, held, idleTimeout)
+
+	for _, connection := range held {
+		lerr := connection.server.Close()
+		if lerr != nil {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog, "Failed to close persistent connection to %s: %v\n", connection.name, lerr)
+		}
+		_ = connection.proxy.Close()
+	}
+	servers.Wait()
+	fmt.Printf("Closed persistent connections\n")
+
+	if failedHosts > 0 {
+		err = fmt.Errorf("failed to connect to %d host(s)", failedHosts)
+		return
+	}
+	return
+}
+
+// Connects to a single host and starts listening on its control socket
+func holdHost(ctx context.Context, cfg config.Config, endpointName str.RepoRootDir) (connection *heldConnection, err error) {
+	hostInfo, err := secrets.GetHostValues(ctx, cfg.HostInfo[endpointName])
+	if err != nil {
+		err = fmt.Errorf("error retrieving host secrets: %w", err)
+		return
+	}
+	cfg.HostInfo[endpointName] = hostInfo
+	err = secrets.GetProxyValues(ctx, cfg.HostInfo, endpointName)
+	if err != nil {
+		err = fmt.Errorf("error retrieving proxy secrets: %w", err)
+		return
+	}
+
+	client, proxyConn, _, err := sshinternal.ConnectToSSH(ctx, hostInfo, cfg.ProxyChainInfo(endpointName))
+	if err != nil {
+		return
+	}
+
+	server, err := sshinternal.NewControlServer(sshinternal.ControlSocketPath(cfg.ControlDirectory, hostInfo), client)
+	if err != nil {
+		_ = client.Close()
+		_ = proxyConn.Close()
+		return
+	}
+	connection = &heldConnection{name: endpointName, server: server, proxy: proxyConn, done: make(chan struct{})}
+	return
+}
+
+// Blocks until a close request, the end of the context, or every held connection is idle or dropped
+// Connections idle for longer than idleTimeout are closed individually
+func waitForClose(ctx context.Context, held []*heldConnection, idleTimeout time.Duration) {
+	closeRequested := make(chan struct{})
+	var closeOnce sync.Once
+	for _, connection := range held {
+		go func() {
+			select {
+			case <-connection.server.CloseRequested():
+				closeOnce.Do(func() { close(closeRequested) })
+			case <-connection.done:
+			}
+		}()
+	}
+
+	checkInterval := min(max(idleTimeout/10, 10*time.Millisecond), 10*time.Second)
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	expired := make(map[str.RepoRootDir]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-closeRequested:
+			return
+		case <-ticker.C:
+		}
+
+		var remaining int
+		for _, connection := range held {
+			if expired[connection.name] {
+				continue
+			}
+			select {
+			case <-connection.done:
+				expired[connection.name] = true
+				continue
+			default:
+			}
+			if connection.server.Idle() >= idleTimeout {
+				logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.InfoLog, "Closing persistent connection to %s, idle for %s\n", connection.name, idleTimeout)
+				_ = connection.server.Close()
+				expired[connection.name] = true
+				continue
+			}
+			remaining++
+		}
+		if remaining == 0 {
+			return
+		}
+	}
+}
+
+// Asks every process holding persistent connections to close them
+func Close(ctx context.Context) (err error) {
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSSSH)
+
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	closed, err := sshinternal.CloseControlSockets(ctx, cfg.ControlDirectory)
+	if err != nil {
+		return
+	}
+	if closed == 0 {
+		fmt.Printf("No persistent connections are held\n")
+		return
+	}
+	fmt.Printf("Requested close of %d persistent connection(s)\n", closed)
+	return
+}
@@ -0,0 +1,62 @@
+package accounts
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parses the output of getent passwd for one user, empty output means the user does not exist
+// Format: name:password:uid:gid:gecos:home:shell
+func ParsePasswdEntry(output string) (user RemoteUser, exists bool, err error) {
+	line := strings.TrimSpace(output)
+	if line == "" {
+		return
+	}
+
+	fields := strings.Split(line, ":")
+	if len(fields) != 7 {
+		err = fmt.Errorf("unexpected passwd entry '%s'", line)
+		return
+	}
+
+	user.Name = fields[0]
+	user.UID, err = strconv.Atoi(fields[2])
+	if err != nil {
+		err = fmt.Errorf("invalid UID in passwd entry '%s'", line)
+		return
+	}
+	user.GID, err = strconv.Atoi(fields[3])
+	if err != nil {
+		err = fmt.Errorf("invalid GID in passwd entry '%s'", line)
+		return
+	}
+	user.Home = fields[5]
+	user.Shell = fields[6]
+	exists = true
+	return
+}
+
+// Parses the output of getent group for one group, empty output means the group does not exist
+// Format: name:password:gid:members
+func ParseGroupEntry(output string) (group RemoteGroup, exists bool, err error) {
+	line := strings.TrimSpace(output)
+	if line == "" {
+		return
+	}
+
+	fields := strings.Split(line, ":")
+	if len(fields) != 4 {
+		err = fmt.Errorf("unexpected group entry '%s'", line)
+		return
+	}
+
+	group.Name = fields[0]
+	group.GID, err = strconv.Atoi(fields[2])
+	if err != nil {
+		err = fmt.Errorf("invalid GID in group entry '%s'", line)
+		return
+	}
+	exists = true
+	return
+}
@@ -0,0 +1,128 @@
+package accounts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Portable user and group names (never start with a dash, so never read as an option)
+var accountNameRegex = regexp.MustCompile(`^[a-z_][a-z0-9_.-]{0,31}$`)
+
+// Decodes and validates a user metadata file, unknown keys are refused so misspelled fields are not silently ignored
+func Parse(content []byte) (spec Spec, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&spec)
+	if err != nil {
+		err = fmt.Errorf("invalid user metadata JSON: %w", err)
+		return
+	}
+
+	err = spec.validate()
+	return
+}
+
+// Checks every entry, all problems are reported together
+func (spec Spec) validate() (err error) {
+	var fieldErrs []error
+
+	groups := make(map[string]Group)
+	for _, group := range spec.Groups {
+		if !accountNameRegex.MatchString(group.Name) {
+			fieldErrs = append(fieldErrs, fmt.Errorf("group name '%s' is not a valid account name", group.Name))
+		}
+		if _, duplicate := groups[group.Name]; duplicate {
+			fieldErrs = append(fieldErrs, fmt.Errorf("group '%s' is listed more than once", group.Name))
+		}
+		if group.GID < 0 {
+			fieldErrs = append(fieldErrs, fmt.Errorf("group '%s': GID must not be negative", group.Name))
+		}
+		groups[group.Name] = group
+	}
+
+	users := make(map[string]struct{})
+	for _, user := range spec.Users {
+		if !accountNameRegex.MatchString(user.Name) {
+			fieldErrs = append(fieldErrs, fmt.Errorf("user name '%s' is not a valid account name", user.Name))
+		}
+		if _, duplicate := users[user.Name]; duplicate {
+			fieldErrs = append(fieldErrs, fmt.Errorf("user '%s' is listed more than once", user.Name))
+		}
+		users[user.Name] = struct{}{}
+		if user.UID < 0 {
+			fieldErrs = append(fieldErrs, fmt.Errorf("user '%s': UID must not be negative", user.Name))
+		}
+		if user.Group != "" && !accountNameRegex.MatchString(user.Group) {
+			fieldErrs = append(fieldErrs, fmt.Errorf("user '%s': group name '%s' is not a valid account name", user.Name, user.Group))
+		}
+		if group, listed := groups[user.Group]; listed && group.Absent && !user.Absent {
+			fieldErrs = append(fieldErrs, fmt.Errorf("user '%s': primary group '%s' is marked Absent", user.Name, user.Group))
+		}
+		if user.Home != "" && !validAccountPath(user.Home) {
+			fieldErrs = append(fieldErrs, fmt.Errorf("user '%s': Home '%s' must be an absolute path without ':' or line breaks", user.Name, user.Home))
+		}
+		if user.Shell != "" && !validAccountPath(user.Shell) {
+			fieldErrs = append(fieldErrs, fmt.Errorf("user '%s': Shell '%s' must be an absolute path without ':' or line breaks", user.Name, user.Shell))
+		}
+	}
+
+	err = errors.Join(fieldErrs...)
+	return
+}
+
+// Home and shell paths are stored in colon separated passwd lines
+func validAccountPath(accountPath string) (valid bool) {
+	valid = path.IsAbs(accountPath) && !strings.ContainsAny(accountPath, ":\n\r")
+	return
+}
+
+// Reports whether any user or group is marked for removal
+func (spec Spec) HasRemovals() (removals bool) {
+	for _, group := range spec.Groups {
+		if group.Absent {
+			removals = true
+			return
+		}
+	}
+	for _, user := range spec.Users {
+		if user.Absent {
+			removals = true
+			return
+		}
+	}
+	return
+}
+
+// Fields of the user that differ from the remote user (only fields set in the spec are compared)
+// The primary group is compared by its GID (negative when the group does not exist on the remote yet)
+func (user User) Changes(remote RemoteUser, primaryGID int) (changes User, differs bool) {
+	changes.Name = user.Name
+	if user.UID != 0 && user.UID != remote.UID {
+		changes.UID = user.UID
+		differs = true
+	}
+	if user.Group != "" && (primaryGID < 0 || primaryGID != remote.GID) {
+		changes.Group = user.Group
+		differs = true
+	}
+	if user.Home != "" && user.Home != remote.Home {
+		changes.Home = user.Home
+		differs = true
+	}
+	if user.Shell != "" && user.Shell != remote.Shell {
+		changes.Shell = user.Shell
+		differs = true
+	}
+	return
+}
+
+// Reports whether the GID of the remote group differs from the spec
+func (group Group) Differs(remote RemoteGroup) (differs bool) {
+	differs = group.GID != 0 && group.GID != remote.GID
+	return
+}
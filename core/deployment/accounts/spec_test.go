@@ -0,0 +1,129 @@
+package accounts
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	type TestCase struct {
+		name        string
+		content     string
+		expectedErr string
+	}
+	testCases := []TestCase{
+		{
+			name:    "Valid",
+			content: `{"Groups": [{"Name": "app", "GID": 901, "System": true}], "Users": [{"Name": "app", "UID": 901, "Group": "app", "Home": "/srv/app", "Shell": "/usr/sbin/nologin"}]}`,
+		},
+		{
+			name:        "Unknown field",
+			content:     `{"Users": [{"Name": "app", "Homedir": "/srv/app"}]}`,
+			expectedErr: "unknown field",
+		},
+		{
+			name:        "Option as name",
+			content:     `{"Users": [{"Name": "-oroot"}]}`,
+			expectedErr: "not a valid account name",
+		},
+		{
+			name:        "Duplicate group",
+			content:     `{"Groups": [{"Name": "app"}, {"Name": "app", "GID": 5}]}`,
+			expectedErr: "listed more than once",
+		},
+		{
+			name:        "Relative home",
+			content:     `{"Users": [{"Name": "app", "Home": "srv/app"}]}`,
+			expectedErr: "must be an absolute path",
+		},
+		{
+			name:        "Colon in shell",
+			content:     `{"Users": [{"Name": "app", "Shell": "/bin/sh:x"}]}`,
+			expectedErr: "must be an absolute path",
+		},
+		{
+			name:        "Primary group removed",
+			content:     `{"Groups": [{"Name": "app", "Absent": true}], "Users": [{"Name": "app", "Group": "app"}]}`,
+			expectedErr: "is marked Absent",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse([]byte(test.content))
+			if test.expectedErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			} else if test.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), test.expectedErr)) {
+				t.Errorf("expected error containing '%s', got '%v'", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestHasRemovals(t *testing.T) {
+	spec := Spec{Users: []User{{Name: "app"}}, Groups: []Group{{Name: "app"}}}
+	if spec.HasRemovals() {
+		t.Errorf("expected no removals")
+	}
+	spec.Groups = append(spec.Groups, Group{Name: "old", Absent: true})
+	if !spec.HasRemovals() {
+		t.Errorf("expected group marked Absent to be a removal")
+	}
+}
+
+func TestUserChanges(t *testing.T) {
+	remote, exists, err := ParsePasswdEntry("app:x:901:901:App:/srv/app:/usr/sbin/nologin\n")
+	if err != nil || !exists {
+		t.Fatalf("unexpected passwd parse result (exists %t): %v", exists, err)
+	}
+
+	user := User{Name: "app", UID: 901, Group: "app", Home: "/srv/app"}
+	_, differs := user.Changes(remote, 901)
+	if differs {
+		t.Errorf("expected matching user to be unchanged")
+	}
+
+	// Unset fields are never compared
+	_, differs = User{Name: "app"}.Changes(remote, -1)
+	if differs {
+		t.Errorf("expected user without fields to be unchanged")
+	}
+
+	user.Shell = "/bin/bash"
+	changes, differs := user.Changes(remote, 902)
+	if !differs || changes.Shell != "/bin/bash" || changes.Group != "app" || changes.UID != 0 || changes.Home != "" {
+		t.Errorf("expected only shell and group changes, got %+v", changes)
+	}
+
+	// Group of GID 0 is a real group (root), only a missing group always differs
+	_, differs = User{Name: "app", Group: "root"}.Changes(RemoteUser{Name: "app", GID: 0}, 0)
+	if differs {
+		t.Errorf("expected root primary group to match GID 0")
+	}
+	_, differs = User{Name: "app", Group: "app"}.Changes(remote, -1)
+	if !differs {
+		t.Errorf("expected missing primary group to differ")
+	}
+}
+
+func TestParseEntries(t *testing.T) {
+	_, exists, err := ParsePasswdEntry("")
+	if exists || err != nil {
+		t.Errorf("expected empty output to be a missing user, got exists %t: %v", exists, err)
+	}
+	_, _, err = ParsePasswdEntry("app:x:abc:901::/srv/app:/bin/sh")
+	if err == nil {
+		t.Errorf("expected invalid UID to be an error")
+	}
+
+	group, exists, err := ParseGroupEntry("app:x:901:app,web\n")
+	if err != nil || !exists || group.GID != 901 {
+		t.Errorf("unexpected group parse result %+v (exists %t): %v", group, exists, err)
+	}
+	if (Group{Name: "app"}).Differs(group) {
+		t.Errorf("expected group without GID to match any GID")
+	}
+	if !(Group{Name: "app", GID: 902}).Differs(group) {
+		t.Errorf("expected different GID to differ")
+	}
+}
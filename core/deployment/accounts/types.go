@@ -0,0 +1,43 @@
+// Package for remote users and groups described by host directory user metadata files
+package accounts
+
+// Users and groups of one user metadata file
+type Spec struct {
+	Groups []Group `json:"Groups,omitempty"`
+	Users  []User  `json:"Users,omitempty"`
+}
+
+// Group to create (or remove when Absent), a GID of 0 lets the host choose
+type Group struct {
+	Name   string `json:"Name"`
+	GID    int    `json:"GID,omitempty"`
+	System bool   `json:"System,omitempty"`
+	Absent bool   `json:"Absent,omitempty"`
+}
+
+// User to create (or remove when Absent), unset fields are left to the host defaults
+// Group is the name of the primary group
+type User struct {
+	Name   string `json:"Name"`
+	UID    int    `json:"UID,omitempty"`
+	Group  string `json:"Group,omitempty"`
+	Home   string `json:"Home,omitempty"`
+	Shell  string `json:"Shell,omitempty"`
+	System bool   `json:"System,omitempty"`
+	Absent bool   `json:"Absent,omitempty"`
+}
+
+// Passwd database entry of a remote user
+type RemoteUser struct {
+	Name  string
+	UID   int
+	GID   int
+	Home  string
+	Shell string
+}
+
+// Group database entry of a remote group
+type RemoteGroup struct {
+	Name string
+	GID  int
+}
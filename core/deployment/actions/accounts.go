@@ -0,0 +1,195 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"scmp/core/deployment/accounts"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/sshinternal"
+)
+
+// Brings remote users and groups in line with a user metadata file
+// Groups are created first (users may need them as primary group), removals run last (users before their groups)
+// Every entry is looked up with getent first, so only missing or differing accounts are changed
+func DeployAccounts(ctx context.Context, host sshinternal.HostMeta, content []byte) (accountsModified bool, err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	spec, err := accounts.Parse(content)
+	if err != nil {
+		return
+	}
+
+	// Checked again on the host since bundles are planned separately from their deployment
+	if spec.HasRemovals() && !(opts.AllowDeletions && opts.AllowUserDeletions) {
+		err = fmt.Errorf("users or groups marked Absent require both --allow-deletions and --allow-user-deletions")
+		return
+	}
+
+	runner := &accountRunner{ctx: ctx, host: host, opts: opts}
+
+	for _, group := range spec.Groups {
+		if group.Absent {
+			continue
+		}
+		err = runner.applyGroup(group)
+		if err != nil {
+			return
+		}
+	}
+	for _, user := range spec.Users {
+		if user.Absent {
+			continue
+		}
+		err = runner.applyUser(user)
+		if err != nil {
+			return
+		}
+	}
+	for _, user := range spec.Users {
+		if !user.Absent {
+			continue
+		}
+		err = runner.removeUser(user.Name)
+		if err != nil {
+			return
+		}
+	}
+	for _, group := range spec.Groups {
+		if !group.Absent {
+			continue
+		}
+		err = runner.removeGroup(group.Name)
+		if err != nil {
+			return
+		}
+	}
+
+	accountsModified = runner.modified
+	return
+}
+
+// Remote account changes of one user metadata file
+type accountRunner struct {
+	ctx      context.Context
+	host     sshinternal.HostMeta
+	opts     config.Opts
+	modified bool
+}
+
+// Runs a changing command, wet-runs only record that a change would have been made
+func (runner *accountRunner) change(command sshinternal.RemoteCommand, description string) (err error) {
+	logctx.LogEvent(runner.ctx, logctx.VerbosityProgress, logctx.InfoLog, "%s\n", description)
+	runner.modified = true
+
+	if runner.opts.WetRunEnabled {
+		return
+	}
+
+	command.DisableSudo = runner.opts.DisableSudo
+	command.RunAsUser = runner.opts.RunAsUser
+	_, err = command.SSHexec(sshinternal.WithPhase(runner.ctx, sshinternal.PhaseTransfer), runner.host.SSHClient, runner.host.Password)
+	if err != nil {
+		err = fmt.Errorf("%s: %w", description, err)
+		return
+	}
+	return
+}
+
+func (runner *accountRunner) lookupUser(name string) (user accounts.RemoteUser, exists bool, err error) {
+	command := sshinternal.BuildGetentPasswd(name)
+	output, err := command.SSHexec(sshinternal.WithPhase(runner.ctx, sshinternal.PhaseInspect), runner.host.SSHClient, runner.host.Password)
+	if err != nil {
+		err = fmt.Errorf("failed looking up user '%s': %w", name, err)
+		return
+	}
+	user, exists, err = accounts.ParsePasswdEntry(output)
+	return
+}
+
+func (runner *accountRunner) lookupGroup(name string) (group accounts.RemoteGroup, exists bool, err error) {
+	command := sshinternal.BuildGetentGroup(name)
+	output, err := command.SSHexec(sshinternal.WithPhase(runner.ctx, sshinternal.PhaseInspect), runner.host.SSHClient, runner.host.Password)
+	if err != nil {
+		err = fmt.Errorf("failed looking up group '%s': %w", name, err)
+		return
+	}
+	group, exists, err = accounts.ParseGroupEntry(output)
+	return
+}
+
+func (runner *accountRunner) applyGroup(group accounts.Group) (err error) {
+	remoteGroup, exists, err := runner.lookupGroup(group.Name)
+	if err != nil {
+		return
+	}
+
+	if !exists {
+		err = runner.change(sshinternal.BuildGroupadd(group.Name, group.GID, group.System), fmt.Sprintf("Creating group '%s'", group.Name))
+		return
+	}
+	if group.Differs(remoteGroup) {
+		err = runner.change(sshinternal.BuildGroupmod(group.Name, group.GID),
+			fmt.Sprintf("Changing GID of group '%s' from %d to %d", group.Name, remoteGroup.GID, group.GID))
+		return
+	}
+
+	logctx.LogEvent(runner.ctx, logctx.VerbosityData, logctx.InfoLog, "Group '%s' is up-to-date\n", group.Name)
+	return
+}
+
+func (runner *accountRunner) applyUser(user accounts.User) (err error) {
+	remoteUser, exists, err := runner.lookupUser(user.Name)
+	if err != nil {
+		return
+	}
+
+	if !exists {
+		err = runner.change(sshinternal.BuildUseradd(user.Name, user.UID, user.Group, user.Home, user.Shell, user.System),
+			fmt.Sprintf("Creating user '%s'", user.Name))
+		return
+	}
+
+	// Primary group is named in the spec but recorded by GID in the passwd entry
+	primaryGID := -1
+	if user.Group != "" {
+		var primaryGroup accounts.RemoteGroup
+		var groupExists bool
+		primaryGroup, groupExists, err = runner.lookupGroup(user.Group)
+		if err != nil {
+			return
+		}
+		if groupExists {
+			primaryGID = primaryGroup.GID
+		}
+	}
+
+	changes, differs := user.Changes(remoteUser, primaryGID)
+	if differs {
+		err = runner.change(sshinternal.BuildUsermod(user.Name, changes.UID, changes.Group, changes.Home, changes.Shell),
+			fmt.Sprintf("Updating user '%s'", user.Name))
+		return
+	}
+
+	logctx.LogEvent(runner.ctx, logctx.VerbosityData, logctx.InfoLog, "User '%s' is up-to-date\n", user.Name)
+	return
+}
+
+func (runner *accountRunner) removeUser(name string) (err error) {
+	_, exists, err := runner.lookupUser(name)
+	if err != nil || !exists {
+		return
+	}
+	err = runner.change(sshinternal.BuildUserdel(name), fmt.Sprintf("Removing user '%s'", name))
+	return
+}
+
+func (runner *accountRunner) removeGroup(name string) (err error) {
+	_, exists, err := runner.lookupGroup(name)
+	if err != nil || !exists {
+		return
+	}
+	err = runner.change(sshinternal.BuildGroupdel(name), fmt.Sprintf("Removing group '%s'", name))
+	return
+}
@@ -3,27 +3,37 @@ package actions
 import (
 	"context"
 	"fmt"
+	"scmp/core/deployment"
 	"scmp/internal/config"
 	"scmp/internal/global"
 	"scmp/internal/logctx"
 	"scmp/internal/sshinternal"
+	"strings"
 )
 
 func RunCommandSet(ctx context.Context, host sshinternal.HostMeta, setName string, commands []string) (err error) {
+	err = runCommandSet(ctx, host, setName, commands, false)
+	return
+}
+
+// Read-only sets (checks) only inspect the remote and still run during wet-runs
+func runCommandSet(ctx context.Context, host sshinternal.HostMeta, setName string, commands []string, readOnly bool) (err error) {
 	if len(commands) == 0 {
 		return
 	}
 
 	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+	ctx = sshinternal.WithPhase(ctx, strings.ToLower(setName))
 
 	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
 		"Starting execution of %s commands\n", setName)
 
 	for _, command := range commands {
+		command = deployment.ExpandFactMacros(command, host.Facts)
 		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
 			"Running %s command '%s'\n", setName, command)
 
-		if opts.WetRunEnabled {
+		if opts.WetRunEnabled && !readOnly {
 			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
 				"Wet-run enabled, skipping command")
 			continue
@@ -32,17 +42,14 @@ func RunCommandSet(ctx context.Context, host sshinternal.HostMeta, setName strin
 		done := make(chan struct{})
 		go watchLongCommand(ctx, command, done)
 
-		rawCmd := sshinternal.RemoteCommand{
-			Raw:          command,
-			RunAsUser:    opts.RunAsUser,
-			DisableSudo:  opts.DisableSudo,
-			Timeout:      opts.ExecutionTimeout,
-			StreamStdout: false,
-		}
+		// Header commands are passed whole to their own shell, never spliced into SCMP command scaffolding
+		rawCmd := sshinternal.BuildUserCommand(command, opts.ExecutionTimeout)
+		rawCmd.RunAsUser = opts.RunAsUser
+		rawCmd.DisableSudo = opts.DisableSudo
 		_, err = rawCmd.SSHexec(ctx, host.SSHClient, host.Password)
 		close(done)
 		if err != nil {
-			err = fmt.Errorf("failed SSH Command on host during %s command %s: %w", setName, command, err)
+			err = fmt.Errorf("%s command failed: %w", setName, err)
 			return
 		}
 	}
@@ -25,6 +25,8 @@ func DeleteFile(ctx context.Context, host sshinternal.HostMeta, targetFilePath s
 		return
 	}
 
+	ctx = sshinternal.WithPhase(ctx, sshinternal.PhaseDelete)
+
 	// Attempt remove file
 	command := sshinternal.BuildRm(targetFilePath)
 	command.DisableSudo = opts.DisableSudo
@@ -17,7 +17,7 @@ func DeployDirectory(ctx context.Context, host sshinternal.HostMeta, dirInfo dep
 	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
 
 	// Retrieve metadata of remote file if it exists
-	remoteMetadata, err = remote.GetOldRemoteInfo(ctx, host, targetDirPath)
+	remoteMetadata, err = remote.GetOldRemoteInfo(sshinternal.WithPhase(ctx, sshinternal.PhaseInspect), host, targetDirPath)
 	if err != nil {
 		return
 	}
@@ -27,13 +27,14 @@ func DeployDirectory(ctx context.Context, host sshinternal.HostMeta, dirInfo dep
 		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Directory '%s' is missing, creating...\n", targetDirPath)
 
 		if opts.WetRunEnabled {
+			dirModified = true // would have been created
 			return
 		}
 
 		command := sshinternal.BuildMkdir(targetDirPath)
 		command.DisableSudo = opts.DisableSudo
 		command.RunAsUser = opts.RunAsUser
-		_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
+		_, err = command.SSHexec(sshinternal.WithPhase(ctx, sshinternal.PhaseTransfer), host.SSHClient, host.Password)
 		if err != nil {
 			return
 		}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"maps"
+	"path"
 	"scmp/core/deployment"
 	"scmp/core/deployment/remote"
 	"scmp/internal/config"
@@ -12,31 +14,33 @@ import (
 	"scmp/internal/parsing"
 	"scmp/internal/sshinternal"
 	"scmp/internal/str"
+	"slices"
 )
 
-func DeployFile(ctx context.Context, host sshinternal.HostMeta, localMetadata deployment.FileInfo, localContent []byte) (fileModified bool, deployedBytes int, remoteMetadata sshinternal.RemoteFileInfo, err error) {
+func DeployFile(ctx context.Context, host sshinternal.HostMeta, localMetadata deployment.FileInfo, localContent []byte, localStream deployment.StreamedContent) (fileModified bool, deployedBytes int, remoteMetadata sshinternal.RemoteFileInfo, err error) {
 	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
 
 	targetFilePath := localMetadata.TargetFilePath
 
 	// Retrieve metadata of remote file if it exists
-	remoteMetadata, err = remote.GetOldRemoteInfo(ctx, host, targetFilePath)
+	remoteMetadata, err = remote.GetOldRemoteInfo(sshinternal.WithPhase(ctx, sshinternal.PhaseInspect), host, targetFilePath)
 	if err != nil {
 		return
 	}
 
-	if remoteMetadata.Exists {
-		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Backing up file %s\n", remoteMetadata.Name)
-
-		backupFileName := str.RemotePath(base64.URLEncoding.EncodeToString([]byte(remoteMetadata.Name)))
-		tmpBackupFilePath := host.BackupPath + "/" + backupFileName
+	// Content much smaller than the remote file is held before anything is changed
+	if remoteMetadata.Exists && remoteMetadata.Hash != localMetadata.Hash {
+		err = confirmShrink(ctx, host, localMetadata, remoteMetadata)
+		if err != nil {
+			return
+		}
+	}
 
-		command := sshinternal.BuildCp(remoteMetadata.Name, tmpBackupFilePath)
-		command.DisableSudo = opts.DisableSudo
-		command.RunAsUser = opts.RunAsUser
-		_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
+	// Declared extended attributes are compared against the remote file before anything is changed
+	var xattrsDiffer, xattrsSupported bool
+	if len(localMetadata.Xattrs) > 0 {
+		xattrsDiffer, xattrsSupported, err = inspectXattrs(ctx, host, localMetadata, &remoteMetadata)
 		if err != nil {
-			err = fmt.Errorf("error making backup of old config file: %w", err)
 			return
 		}
 	}
@@ -44,11 +48,17 @@ func DeployFile(ctx context.Context, host sshinternal.HostMeta, localMetadata de
 	// Get remote vs local status
 	contentDiffers, metadataDiffers := remote.CheckForDiff(ctx, remoteMetadata, localMetadata)
 
-	// Next file if this one does not need updating
-	if !contentDiffers && !metadataDiffers {
+	// Next file if this one does not need updating (ACLs and SELinux contexts are not compared, they are always reapplied)
+	if !contentDiffers && !metadataDiffers && !xattrsDiffer {
 		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
 			"File '%s' hash matches local and metadata up-to-date... skipping this file\n",
 			targetFilePath)
+		if !opts.WetRunEnabled {
+			err = applyExtendedAttributes(ctx, host, localMetadata)
+		}
+
+		// Nothing was backed up, so there is nothing to restore
+		remoteMetadata = sshinternal.RemoteFileInfo{}
 		return
 	}
 
@@ -61,6 +71,16 @@ func DeployFile(ctx context.Context, host sshinternal.HostMeta, localMetadata de
 		return
 	}
 
+	// Backups are only made of files about to change (content kept in place needs no backup)
+	if remoteMetadata.Exists && !MetadataOnlyChange(localMetadata, remoteMetadata) {
+		err = backupRemoteFile(ctx, host, localMetadata, remoteMetadata)
+		if err != nil {
+			return
+		}
+	}
+
+	var contentPlaced bool
+
 	// Create file if local is empty
 	if localMetadata.FileSize == 0 && !remoteMetadata.Exists {
 		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog,
@@ -70,7 +90,7 @@ func DeployFile(ctx context.Context, host sshinternal.HostMeta, localMetadata de
 		command := sshinternal.BuildTouch(localMetadata.TargetFilePath)
 		command.DisableSudo = opts.DisableSudo
 		command.RunAsUser = opts.RunAsUser
-		_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
+		_, err = command.SSHexec(sshinternal.WithPhase(ctx, sshinternal.PhaseTransfer), host.SSHClient, host.Password)
 		if err != nil {
 			err = fmt.Errorf("unable to create empty file: %w", err)
 			return
@@ -82,10 +102,14 @@ func DeployFile(ctx context.Context, host sshinternal.HostMeta, localMetadata de
 		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog,
 			"Transferring config '%s' to remote\n", localMetadata.RepoFilePath)
 
-		// Transfer config file to remote with correct ownership and permissions
-		err = sshinternal.CreateRemoteFile(ctx, host, targetFilePath, localContent, string(localMetadata.Hash), localMetadata.OwnerGroup, localMetadata.Permissions)
+		// Transfer config file to remote with correct ownership and permissions (large artifacts are read from disk)
+		if localStream.LocalPath != "" {
+			err = sshinternal.CreateRemoteFileFromDisk(ctx, host, targetFilePath, localStream.LocalPath, localStream.Size, string(localMetadata.Hash), localMetadata.OwnerGroup, localMetadata.Permissions)
+		} else {
+			err = sshinternal.CreateRemoteFile(ctx, host, targetFilePath, localContent, string(localMetadata.Hash), localMetadata.OwnerGroup, localMetadata.Permissions)
+		}
 		if err != nil {
-			lerr := RestoreOldFile(ctx, host, targetFilePath, remoteMetadata)
+			lerr := RestoreOldFile(ctx, host, localMetadata, remoteMetadata)
 			if lerr != nil {
 				err = fmt.Errorf("%w: restoration failed: %w", err, lerr)
 			}
@@ -94,19 +118,20 @@ func DeployFile(ctx context.Context, host sshinternal.HostMeta, localMetadata de
 
 		// Increment byte metric always after a file was uploaded to remote
 		deployedBytes += localMetadata.FileSize
+		contentPlaced = true
 
 		// For metrics
 		fileModified = true
 	}
 
-	// Update file metadata
-	if metadataDiffers {
+	// Update file metadata (placed content already carries the expected owner/group and permissions)
+	if metadataDiffers && !contentPlaced {
 		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog,
 			"Checking if file '%s' needs its metadata updated\n", targetFilePath)
 
 		err = sshinternal.ModifyMetadata(ctx, host, remoteMetadata, localMetadata)
 		if err != nil {
-			lerr := RestoreOldFile(ctx, host, targetFilePath, remoteMetadata)
+			lerr := RestoreOldFile(ctx, host, localMetadata, remoteMetadata)
 			if lerr != nil {
 				err = fmt.Errorf("%w: restoration failed: %w", err, lerr)
 			}
@@ -119,55 +144,221 @@ func DeployFile(ctx context.Context, host sshinternal.HostMeta, localMetadata de
 		fileModified = true
 	}
 
+	err = applyExtendedAttributes(ctx, host, localMetadata)
+	if err != nil {
+		lerr := RestoreOldFile(ctx, host, localMetadata, remoteMetadata)
+		if lerr != nil {
+			err = fmt.Errorf("%w: restoration failed: %w", err, lerr)
+		}
+		return
+	}
+
+	// Placed content is a new file without the old attributes, so they are set after every change
+	if xattrsSupported {
+		err = applyXattrs(sshinternal.WithPhase(ctx, sshinternal.PhaseMetadata), host, targetFilePath, localMetadata.Xattrs)
+		if sshinternal.IsNotSupported(err) {
+			logctx.LogStdWarn(ctx, "File '%s': filesystem on host %s does not support extended attributes, Xattrs were not applied\n", targetFilePath, host.Name)
+			err = nil
+		} else if err != nil {
+			err = fmt.Errorf("extended attribute change: %w", err)
+			lerr := RestoreOldFile(ctx, host, localMetadata, remoteMetadata)
+			if lerr != nil {
+				err = fmt.Errorf("%w: restoration failed: %w", err, lerr)
+			}
+			return
+		}
+
+		// For metrics
+		fileModified = true
+	}
+
 	return
 }
 
-// Moves backup config file into original location after file deployment failure
-// Assumes backup file is located in the directory at backupFilePath
-// Ensures restoration worked by hashing and comparing to pre-deployment file hash
-func RestoreOldFile(ctx context.Context, host sshinternal.HostMeta, targetFilePath str.RemotePath, remoteMetadata sshinternal.RemoteFileInfo) (err error) {
-	// Empty oldRemoteFileHash indicates there was nothing to backup, therefore restore should not occur
-	if remoteMetadata.Hash == "" {
+// Copies the remote file to its backup path (sibling and archive backup directories are created in the same round trip)
+func backupRemoteFile(ctx context.Context, host sshinternal.HostMeta, localMetadata deployment.FileInfo, remoteMetadata sshinternal.RemoteFileInfo) (err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Backing up file %s\n", remoteMetadata.Name)
+	backupCtx := sshinternal.WithPhase(ctx, sshinternal.PhaseBackup)
+
+	backupFilePath := buildBackupPath(host, localMetadata.BackupStyle, cfg.BackupSuffix, remoteMetadata.Name)
+
+	var commands []sshinternal.RemoteCommand
+	archived := localMetadata.BackupStyle == sshinternal.BackupStyleArchive && host.BackupArchivePath != ""
+	if localMetadata.BackupStyle == sshinternal.BackupStyleSibling || archived {
+		commands = append(commands, sshinternal.BuildMkdir(str.RemotePath(path.Dir(string(backupFilePath)))))
+	}
+	commands = append(commands, sshinternal.BuildCp(remoteMetadata.Name, backupFilePath))
+
+	_, failedStep, err := sshinternal.RunBatch(backupCtx, host, commands...)
+	if err != nil && failedStep == 0 && len(commands) > 1 {
+		err = fmt.Errorf("error creating backup directory for old config file: %w", err)
+		return
+	} else if err != nil {
+		err = fmt.Errorf("error making backup of old config file: %w", err)
 		return
 	}
+	return
+}
 
-	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+// Reads the remote extended attributes and reports whether a declared attribute is missing or different
+// Hosts or filesystems without xattr support only get a warning, the attributes are then never set
+func inspectXattrs(ctx context.Context, host sshinternal.HostMeta, localMetadata deployment.FileInfo, remoteMetadata *sshinternal.RemoteFileInfo) (differ bool, supported bool, err error) {
+	if !host.Facts.Xattrs {
+		logctx.LogStdWarn(ctx, "File '%s': setfattr/getfattr are not available on host %s, Xattrs were not applied\n", localMetadata.TargetFilePath, host.Name)
+		return
+	}
+	supported = true
 
-	// Get the unique id for the backup for the given targetFilePath
-	backupFileName := str.RemotePath(base64.URLEncoding.EncodeToString([]byte(targetFilePath)))
-	backupFilePath := host.BackupPath + "/" + backupFileName
+	if !remoteMetadata.Exists {
+		differ = true
+		return
+	}
+
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
 
-	// Default user options for commands
-	var command sshinternal.RemoteCommand
+	command := sshinternal.BuildGetfattr(localMetadata.TargetFilePath)
 	command.DisableSudo = opts.DisableSudo
 	command.RunAsUser = opts.RunAsUser
-
-	// Move backup conf into place
-	command = sshinternal.BuildMv(backupFilePath, targetFilePath)
-	_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
-	if err != nil {
-		err = fmt.Errorf("failed SSH Command on host during restoration of old config file: %w", err)
+	output, err := command.SSHexec(sshinternal.WithPhase(ctx, sshinternal.PhaseInspect), host.SSHClient, host.Password)
+	if sshinternal.IsNotSupported(err) {
+		logctx.LogStdWarn(ctx, "File '%s': filesystem on host %s does not support extended attributes, Xattrs were not applied\n", localMetadata.TargetFilePath, host.Name)
+		supported = false
+		err = nil
+		return
+	} else if err != nil {
+		err = fmt.Errorf("extended attribute read: %w", err)
 		return
 	}
-	command = sshinternal.BuildChmod(remoteMetadata.Permissions, targetFilePath)
-	_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
+
+	remoteXattrs, err := sshinternal.ExtractXattrs(output)
 	if err != nil {
-		err = fmt.Errorf("failed SSH Command on host during restoration of old config file: %w", err)
 		return
 	}
-	targetRemoteOwnerGroup := remoteMetadata.Owner + ":" + remoteMetadata.Group
-	command = sshinternal.BuildChown(targetRemoteOwnerGroup, targetFilePath)
-	_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
-	if err != nil {
-		err = fmt.Errorf("failed SSH Command on host during restoration of old config file: %w", err)
+	remoteMetadata.XattrDump = output
+
+	for _, name := range slices.Sorted(maps.Keys(localMetadata.Xattrs)) {
+		remoteValue, present := remoteXattrs[name]
+		if present && remoteValue == localMetadata.Xattrs[name] {
+			continue
+		}
+		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog,
+			"File '%s': extended attribute '%s' differs from remote\n", localMetadata.TargetFilePath, name)
+		differ = true
+	}
+	return
+}
+
+// Sets extended attributes in name order
+func applyXattrs(ctx context.Context, host sshinternal.HostMeta, targetFilePath str.RemotePath, xattrs map[string]string) (err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	for _, name := range slices.Sorted(maps.Keys(xattrs)) {
+		command := sshinternal.BuildSetfattr(name, xattrs[name], targetFilePath)
+		command.DisableSudo = opts.DisableSudo
+		command.RunAsUser = opts.RunAsUser
+		_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Sets extended ACL entries and the SELinux context, always after owner/group and permissions (chmod rewrites the ACL mask)
+// Hosts without setfacl or chcon only get a warning, the file is still deployed
+func applyExtendedAttributes(ctx context.Context, host sshinternal.HostMeta, localMetadata deployment.FileInfo) (err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+	ctx = sshinternal.WithPhase(ctx, sshinternal.PhaseMetadata)
+
+	if len(localMetadata.ACLs) > 0 {
+		command := sshinternal.BuildSetfacl(localMetadata.ACLs, localMetadata.TargetFilePath)
+		command.DisableSudo = opts.DisableSudo
+		command.RunAsUser = opts.RunAsUser
+
+		_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
+		if sshinternal.IsCommandNotFound(err) {
+			logctx.LogStdWarn(ctx, "File '%s': setfacl is not available on host %s, ACLs were not applied\n", localMetadata.TargetFilePath, host.Name)
+			err = nil
+		} else if err != nil {
+			err = fmt.Errorf("ACL change: %w", err)
+			return
+		}
+	}
+
+	if localMetadata.SELinuxContext != "" {
+		command := sshinternal.BuildChcon(localMetadata.SELinuxContext, localMetadata.TargetFilePath)
+		command.DisableSudo = opts.DisableSudo
+		command.RunAsUser = opts.RunAsUser
+
+		_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
+		if sshinternal.IsCommandNotFound(err) {
+			logctx.LogStdWarn(ctx, "File '%s': chcon is not available on host %s, SELinux context was not applied\n", localMetadata.TargetFilePath, host.Name)
+			err = nil
+		} else if err != nil {
+			err = fmt.Errorf("SELinux context change: %w", err)
+			return
+		}
+	}
+	return
+}
+
+// Moves backup config file into original location after file deployment failure
+// Assumes backup file is located where the files backup style places it
+// Ensures restoration worked by hashing and comparing to pre-deployment file hash
+func RestoreOldFile(ctx context.Context, host sshinternal.HostMeta, localMetadata deployment.FileInfo, remoteMetadata sshinternal.RemoteFileInfo) (err error) {
+	// Empty oldRemoteFileHash indicates there was nothing to backup, therefore restore should not occur
+	if remoteMetadata.Hash == "" {
 		return
 	}
 
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+	ctx = sshinternal.WithPhase(ctx, sshinternal.PhaseRestore)
+
+	targetFilePath := localMetadata.TargetFilePath
+	backupFilePath := buildBackupPath(host, localMetadata.BackupStyle, cfg.BackupSuffix, targetFilePath)
+
+	// Backup goes back into place with the owner/group and permissions recorded before deployment
+	// Content kept in place was not backed up, only its owner/group and permissions go back
+	oldOwnerGroup := remoteMetadata.Owner + ":" + remoteMetadata.Group
+	if MetadataOnlyChange(localMetadata, remoteMetadata) {
+		oldMetadata := localMetadata
+		oldMetadata.OwnerGroup = oldOwnerGroup
+		oldMetadata.Permissions = remoteMetadata.Permissions
+		err = sshinternal.ModifyMetadata(ctx, host, sshinternal.RemoteFileInfo{}, oldMetadata)
+		if err != nil {
+			err = fmt.Errorf("restoration of old config file metadata: %w", err)
+			return
+		}
+	} else {
+		err = sshinternal.MoveIntoPlace(ctx, host, backupFilePath, targetFilePath, oldOwnerGroup, remoteMetadata.Permissions)
+		if err != nil {
+			err = fmt.Errorf("restoration of old config file: %w", err)
+			return
+		}
+	}
+
+	// Backups do not keep extended attributes, the ones read before deployment are set again
+	if remoteMetadata.XattrDump != "" {
+		var oldXattrs map[string]string
+		oldXattrs, err = sshinternal.ExtractXattrs(remoteMetadata.XattrDump)
+		if err == nil {
+			err = applyXattrs(ctx, host, targetFilePath, oldXattrs)
+		}
+		if err != nil {
+			err = fmt.Errorf("restoration of old extended attributes: %w", err)
+			return
+		}
+	}
+
 	// Check to make sure restore worked with hash
-	command = sshinternal.BuildHashCmd(targetFilePath)
+	command := sshinternal.BuildHostHash(host, targetFilePath)
+	command.DisableSudo = opts.DisableSudo
+	command.RunAsUser = opts.RunAsUser
 	commandOutput, err := command.SSHexec(ctx, host.SSHClient, host.Password)
 	if err != nil {
-		err = fmt.Errorf("failed SSH Command on host during hash of old config file: %w", err)
+		err = fmt.Errorf("hash of old config file: %w", err)
 		return
 	}
 
@@ -186,3 +377,44 @@ func RestoreOldFile(ctx context.Context, host sshinternal.HostMeta, targetFilePa
 
 	return
 }
+
+// True when only the metadata header of the file changed and the remote content already matches it
+// Such files are neither backed up nor transferred, only their metadata is updated
+func MetadataOnlyChange(localMetadata deployment.FileInfo, remoteMetadata sshinternal.RemoteFileInfo) (metadataOnly bool) {
+	metadataOnly = localMetadata.MetadataOnly && remoteMetadata.Exists && remoteMetadata.Hash == localMetadata.Hash
+	return
+}
+
+// Backup path of a file that is kept after the deployment (empty for backups in the temporary backup directory)
+func PersistentBackupPath(host sshinternal.HostMeta, localMetadata deployment.FileInfo, backupSuffix string) (backupFilePath str.RemotePath) {
+	switch localMetadata.BackupStyle {
+	case sshinternal.BackupStyleSuffix, sshinternal.BackupStyleSibling:
+	case sshinternal.BackupStyleArchive:
+		if host.BackupArchivePath == "" {
+			return
+		}
+	default:
+		return
+	}
+	backupFilePath = buildBackupPath(host, localMetadata.BackupStyle, backupSuffix, localMetadata.TargetFilePath)
+	return
+}
+
+// Creates remote backup path for a file based on backup style
+// Central (or unset) style uses a unique name inside the hosts temporary backup directory
+// Archive style keeps the full target path inside the deployment archive directory (central when the host has none, like restores and wet-runs)
+func buildBackupPath(host sshinternal.HostMeta, backupStyle string, backupSuffix string, targetFilePath str.RemotePath) (backupFilePath str.RemotePath) {
+	switch {
+	case backupStyle == sshinternal.BackupStyleSuffix:
+		backupFilePath = targetFilePath + str.RemotePath(backupSuffix)
+	case backupStyle == sshinternal.BackupStyleSibling:
+		targetDir, targetName := path.Split(string(targetFilePath))
+		backupFilePath = str.RemotePath(targetDir + sshinternal.SiblingBackupDir + "/" + targetName)
+	case backupStyle == sshinternal.BackupStyleArchive && host.BackupArchivePath != "":
+		backupFilePath = host.BackupArchivePath + str.RemotePath(path.Clean("/"+string(targetFilePath)))
+	default:
+		backupFileName := str.RemotePath(base64.URLEncoding.EncodeToString([]byte(targetFilePath)))
+		backupFilePath = host.BackupPath + "/" + backupFileName
+	}
+	return
+}
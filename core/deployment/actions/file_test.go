@@ -0,0 +1,78 @@
+package actions
+
+import (
+	"scmp/core/deployment"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"testing"
+)
+
+func TestBuildBackupPath(t *testing.T) {
+	host := sshinternal.HostMeta{BackupPath: "/tmp/scmp.abc"}
+	targetFilePath := str.RemotePath("/etc/nginx/nginx.conf")
+
+	tests := []struct {
+		backupStyle  string
+		expectedPath str.RemotePath
+	}{
+		{sshinternal.BackupStyleCentral, "/tmp/scmp.abc/L2V0Yy9uZ2lueC9uZ2lueC5jb25m"},
+		{"", "/tmp/scmp.abc/L2V0Yy9uZ2lueC9uZ2lueC5jb25m"},
+		{sshinternal.BackupStyleSibling, "/etc/nginx/.scmp-backup/nginx.conf"},
+		{sshinternal.BackupStyleSuffix, "/etc/nginx/nginx.conf.bak"},
+		{sshinternal.BackupStyleArchive, "/tmp/scmp.abc/L2V0Yy9uZ2lueC9uZ2lueC5jb25m"}, // No archive directory for this deployment
+	}
+
+	for _, test := range tests {
+		backupPath := buildBackupPath(host, test.backupStyle, ".bak", targetFilePath)
+		if backupPath != test.expectedPath {
+			t.Errorf("style '%s': expected backup path '%s', got '%s'", test.backupStyle, test.expectedPath, backupPath)
+		}
+	}
+}
+
+func TestPersistentBackupPath(t *testing.T) {
+	host := sshinternal.HostMeta{BackupPath: "/tmp/scmp.abc", BackupArchivePath: "/var/backups/scmp/20261017T142501Z"}
+	info := deployment.FileInfo{TargetFilePath: "/etc/nginx/nginx.conf", BackupStyle: sshinternal.BackupStyleArchive}
+
+	backupPath := PersistentBackupPath(host, info, ".bak")
+	if backupPath != "/var/backups/scmp/20261017T142501Z/etc/nginx/nginx.conf" {
+		t.Errorf("unexpected archive backup path '%s'", backupPath)
+	}
+
+	info.BackupStyle = sshinternal.BackupStyleCentral
+	backupPath = PersistentBackupPath(host, info, ".bak")
+	if backupPath != "" {
+		t.Errorf("expected no persistent path for central backups, got '%s'", backupPath)
+	}
+
+	info.BackupStyle = sshinternal.BackupStyleArchive
+	host.BackupArchivePath = ""
+	backupPath = PersistentBackupPath(host, info, ".bak")
+	if backupPath != "" {
+		t.Errorf("expected no persistent path without an archive directory, got '%s'", backupPath)
+	}
+}
+
+func TestMetadataOnlyChange(t *testing.T) {
+	info := deployment.FileInfo{Hash: "aaa", MetadataOnly: true}
+	remote := sshinternal.RemoteFileInfo{Hash: "aaa", Exists: true}
+	if !MetadataOnlyChange(info, remote) {
+		t.Errorf("expected matching remote content to be a metadata only change")
+	}
+
+	remote.Hash = "bbb"
+	if MetadataOnlyChange(info, remote) {
+		t.Errorf("expected drifted remote content to be transferred")
+	}
+
+	info.MetadataOnly = false
+	remote.Hash = "aaa"
+	if MetadataOnlyChange(info, remote) {
+		t.Errorf("expected files with changed content not to be metadata only")
+	}
+
+	info.MetadataOnly = true
+	if MetadataOnlyChange(info, sshinternal.RemoteFileInfo{}) {
+		t.Errorf("expected missing remote file not to be metadata only")
+	}
+}
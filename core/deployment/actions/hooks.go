@@ -3,10 +3,16 @@ package actions
 
 import (
 	"context"
+	"fmt"
+	"path"
 	"scmp/core/deployment"
 	"scmp/internal/config"
+	"scmp/internal/crypto"
 	"scmp/internal/global"
+	"scmp/internal/logctx"
 	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"strings"
 )
 
 func RunPreApplyCommands(ctx context.Context, host sshinternal.HostMeta, localMetadata deployment.FileInfo) (err error) {
@@ -23,10 +29,81 @@ func RunPostApplyCommands(ctx context.Context, host sshinternal.HostMeta, localM
 	return
 }
 
+// Preconditions block the file before any backup or transfer
+func RunPreChecks(ctx context.Context, host sshinternal.HostMeta, localMetadata deployment.FileInfo) (err error) {
+	err = runCommandSet(ctx, host, "PreCheck", localMetadata.PreChecks, true)
+	return
+}
+
+// Validation of the placed file before its reload group fires
+func RunPostChecks(ctx context.Context, host sshinternal.HostMeta, localMetadata deployment.FileInfo) (err error) {
+	err = runCommandSet(ctx, host, "PostCheck", localMetadata.PostChecks, true)
+	return
+}
+
 func RunInstallationCommands(ctx context.Context, host sshinternal.HostMeta, localMetadata deployment.FileInfo) (err error) {
 	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
-	if localMetadata.InstallOptional && opts.RunInstallCommands {
+	if !localMetadata.InstallOptional || !opts.RunInstallCommands {
+		return
+	}
+	if !localMetadata.InstallOnce || len(localMetadata.Install) == 0 {
 		err = RunCommandSet(ctx, host, "Install", localMetadata.Install)
+		return
+	}
+
+	markerPath, identity := installMarker(localMetadata.Install, host.Facts)
+	if !opts.ForceInstall {
+		var installed bool
+		installed, err = installMarkerPresent(ctx, host, markerPath, identity)
+		if err != nil {
+			return
+		}
+		if installed {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
+				"Install commands already run on this host (marker '%s')... skipping them\n", markerPath)
+			return
+		}
+	}
+
+	err = RunCommandSet(ctx, host, "Install", localMetadata.Install)
+	if err != nil || opts.WetRunEnabled {
+		return
+	}
+
+	command := sshinternal.BuildInstallMarkerWrite(markerPath, identity)
+	command.DisableSudo = opts.DisableSudo
+	command.RunAsUser = opts.RunAsUser
+	_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
+	if err != nil {
+		err = fmt.Errorf("install commands succeeded, but recording install marker '%s' failed: %w", markerPath, err)
+		return
+	}
+	return
+}
+
+// Marker location and content identifying the install commands as they run on this host (after fact macros)
+func installMarker(commands []string, facts config.HostFacts) (markerPath str.RemotePath, identity string) {
+	expandedCommands := make([]string, 0, len(commands))
+	for _, command := range commands {
+		expandedCommands = append(expandedCommands, deployment.ExpandFactMacros(command, facts))
+	}
+	identity = crypto.SHA256Sum([]byte(strings.Join(expandedCommands, "\n")))
+	markerPath = str.RemotePath(path.Join(string(deployment.InstallMarkerDir), identity))
+	return
+}
+
+// Checks the remote for a marker recording these install commands as run
+func installMarkerPresent(ctx context.Context, host sshinternal.HostMeta, markerPath str.RemotePath, identity string) (installed bool, err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	command := sshinternal.BuildInstallMarkerCheck(markerPath, identity)
+	command.DisableSudo = opts.DisableSudo
+	command.RunAsUser = opts.RunAsUser
+	output, err := command.SSHexec(ctx, host.SSHClient, host.Password)
+	if err != nil {
+		err = fmt.Errorf("failed checking install marker '%s': %w", markerPath, err)
+		return
 	}
+	installed = strings.TrimSpace(output) == "installed"
 	return
 }
@@ -0,0 +1,39 @@
+package actions
+
+import (
+	"path"
+	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/str"
+	"testing"
+)
+
+func TestInstallMarker(t *testing.T) {
+	commands := []string{"apt-get install -y nginx", "systemctl enable nginx"}
+	debianFacts := config.HostFacts{OSID: "debian"}
+
+	markerPath, identity := installMarker(commands, debianFacts)
+	if markerPath != str.RemotePath(path.Join(string(deployment.InstallMarkerDir), identity)) {
+		t.Errorf("expected marker named after its identity, got '%s'", markerPath)
+	}
+
+	// Same commands always map to the same marker
+	_, sameIdentity := installMarker(commands, config.HostFacts{OSID: "rocky"})
+	if sameIdentity != identity {
+		t.Errorf("expected identity independent of unused facts, got '%s' and '%s'", identity, sameIdentity)
+	}
+
+	// Changed commands run again
+	_, changedIdentity := installMarker([]string{"apt-get install -y nginx-full", "systemctl enable nginx"}, debianFacts)
+	if changedIdentity == identity {
+		t.Errorf("expected changed commands to change the identity")
+	}
+
+	// Commands are identified as they run on the host
+	macroCommands := []string{"install-{@OSID}.sh"}
+	_, debianIdentity := installMarker(macroCommands, debianFacts)
+	_, rockyIdentity := installMarker(macroCommands, config.HostFacts{OSID: "rocky"})
+	if debianIdentity == rockyIdentity {
+		t.Errorf("expected fact macros to be expanded before identifying commands")
+	}
+}
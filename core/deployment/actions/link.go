@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"scmp/core/deployment"
 	"scmp/core/deployment/remote"
 	"scmp/internal/config"
 	"scmp/internal/global"
@@ -19,7 +20,8 @@ func DeploySymLink(ctx context.Context, host sshinternal.HostMeta, linkName str.
 	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
 
 	// Check if a file is already there
-	oldSymLinkExists, statOutput, err := sshinternal.CheckRemoteFileDirExistence(ctx, host, linkName)
+	inspectCtx := sshinternal.WithPhase(ctx, sshinternal.PhaseInspect)
+	oldSymLinkExists, statOutput, err := sshinternal.CheckRemoteFileDirExistence(inspectCtx, host, linkName)
 	if err != nil {
 		err = fmt.Errorf("failed checking file existence before creating symbolic link: %w", err)
 		return
@@ -33,22 +35,33 @@ func DeploySymLink(ctx context.Context, host sshinternal.HostMeta, linkName str.
 			return
 		}
 
-		// Error if the remote file is not a link
-		if oldMetadata.FsType != remote.SymlinkType {
-			err = fmt.Errorf("file already exists where symbolic link is supposed to be created")
-			return
-		}
+		switch oldMetadata.FsType {
+		case remote.SymlinkType:
+			// Nothing to update, return
+			if oldMetadata.LinkTarget == linkTarget {
+				logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "link target is up-to-date\n")
+				return
+			}
+			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Replacing link target '%s' with '%s'\n", oldMetadata.LinkTarget, linkTarget)
 
-		// Nothing to update, return
-		if oldMetadata.LinkTarget == linkTarget {
-			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "link target is up-to-date\n")
+			// Failed reloads point the link back at its previous target
+			remoteMetadata = oldMetadata
+		case remote.FileType, remote.FileEmptyType:
+			// Regular files are only replaced on request, their content would be lost
+			if !opts.ForceEnabled {
+				err = fmt.Errorf("%w: regular file exists where symbolic link is supposed to be created (use --force to replace it)", deployment.ErrLinkPathOccupied)
+				return
+			}
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog, "Replacing regular file '%s' with a symbolic link (--force)\n", linkName)
+		default:
+			err = fmt.Errorf("%w: %s exists where symbolic link is supposed to be created", deployment.ErrLinkPathOccupied, oldMetadata.FsType)
 			return
 		}
 	}
 
 	// Check if parent directory exists
 	directory := str.RemotePath(filepath.Dir(string(linkName)))
-	parentDirExists, _, err := sshinternal.CheckRemoteFileDirExistence(ctx, host, directory)
+	parentDirExists, _, err := sshinternal.CheckRemoteFileDirExistence(inspectCtx, host, directory)
 	if err != nil {
 		err = fmt.Errorf("failed checking link parent directory existence before creating symbolic link: %w", err)
 		return
@@ -59,6 +72,8 @@ func DeploySymLink(ctx context.Context, host sshinternal.HostMeta, linkName str.
 		return
 	}
 
+	ctx = sshinternal.WithPhase(ctx, sshinternal.PhaseTransfer)
+
 	// Create parent directory if missing
 	if !parentDirExists {
 		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Link parent directory '%s' is missing, creating...\n", directory)
@@ -73,7 +88,7 @@ func DeploySymLink(ctx context.Context, host sshinternal.HostMeta, linkName str.
 	}
 
 	// Create symbolic link
-	command := sshinternal.BuildLink(linkTarget, linkName)
+	command := sshinternal.BuildLink(linkTarget, linkName, host.OSFamily)
 	command.DisableSudo = opts.DisableSudo
 	command.RunAsUser = opts.RunAsUser
 	_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
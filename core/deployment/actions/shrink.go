@@ -0,0 +1,46 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/input"
+	"scmp/internal/sshinternal"
+	"strings"
+	"sync"
+)
+
+// Hosts deploy concurrently, only one shrink confirmation is asked at a time
+var shrinkPromptMutex sync.Mutex
+
+// Holds a file whose new content shrinks by more than its MaxShrinkPercent against the remote file, unless acknowledged
+// Wet-runs report the hold without asking
+func confirmShrink(ctx context.Context, host sshinternal.HostMeta, localMetadata deployment.FileInfo, remoteMetadata sshinternal.RemoteFileInfo) (err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	if localMetadata.Replacement || opts.AcknowledgeShrink {
+		return
+	}
+	shrinkPercent, exceeds := deployment.ShrinkExceeds(remoteMetadata.Size, localMetadata.FileSize, localMetadata.MaxShrinkPercent)
+	if !exceeds {
+		return
+	}
+
+	err = fmt.Errorf("%w: content shrinks %d%% from %d to %d bytes (MaxShrinkPercent %d), deploy with --acknowledge-shrink or --replace-files",
+		deployment.ErrSuspiciousShrink, shrinkPercent, remoteMetadata.Size, localMetadata.FileSize, localMetadata.MaxShrinkPercent)
+	if opts.WetRunEnabled {
+		return
+	}
+
+	shrinkPromptMutex.Lock()
+	defer shrinkPromptMutex.Unlock()
+
+	userConfirmation, lerr := input.AskUser(ctx, fmt.Sprintf("Host '%s': '%s' shrinks %d%% (%d to %d bytes), deploy anyway? [y/N]",
+		host.Name, localMetadata.TargetFilePath, shrinkPercent, remoteMetadata.Size, localMetadata.FileSize), "")
+	if lerr == nil && strings.ToLower(strings.TrimSpace(userConfirmation)) == "y" {
+		err = nil
+	}
+	return
+}
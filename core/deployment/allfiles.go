@@ -8,6 +8,7 @@ func NewAllFiles() (files *AllFiles) {
 	files = &AllFiles{
 		metadata: make(map[str.LocalRepoPath]FileInfo),
 		data:     make(map[str.FileID][]byte),
+		streams:  make(map[str.FileID]StreamedContent),
 	}
 	return
 }
@@ -18,6 +19,30 @@ func (files *AllFiles) AddMetadata(path str.LocalRepoPath, metadata FileInfo) {
 	files.mutex.Unlock()
 }
 
+// Marks the selected files as intentionally replaced (never held for shrinking)
+func (files *AllFiles) MarkReplacement(selected func(path str.LocalRepoPath) bool) {
+	files.mutex.Lock()
+	for path, metadata := range files.metadata {
+		if selected(path) {
+			metadata.Replacement = true
+			files.metadata[path] = metadata
+		}
+	}
+	files.mutex.Unlock()
+}
+
+// Marks the selected files as only having their metadata header changed
+func (files *AllFiles) MarkMetadataOnly(selected func(path str.LocalRepoPath) bool) {
+	files.mutex.Lock()
+	for path, metadata := range files.metadata {
+		if selected(path) {
+			metadata.MetadataOnly = true
+			files.metadata[path] = metadata
+		}
+	}
+	files.mutex.Unlock()
+}
+
 func (files *AllFiles) StoreDataOnce(identifier str.FileID, content []byte) {
 	files.mutex.Lock()
 	_, alreadyLoaded := files.data[identifier]
@@ -27,10 +52,20 @@ func (files *AllFiles) StoreDataOnce(identifier str.FileID, content []byte) {
 	files.mutex.Unlock()
 }
 
+func (files *AllFiles) StoreStreamOnce(identifier str.FileID, stream StreamedContent) {
+	files.mutex.Lock()
+	_, alreadyLoaded := files.streams[identifier]
+	if !alreadyLoaded {
+		files.streams[identifier] = stream
+	}
+	files.mutex.Unlock()
+}
+
 func (files *AllFiles) AlreadyLoaded(identifier str.FileID) (loaded bool) {
 	files.mutex.RLock()
 	_, alreadyLoaded := files.data[identifier]
-	if alreadyLoaded {
+	_, alreadyStreamed := files.streams[identifier]
+	if alreadyLoaded || alreadyStreamed {
 		loaded = true
 	}
 	files.mutex.RUnlock()
@@ -69,3 +104,11 @@ func (files *AllFiles) GetFileData(identifier str.FileID) (data []byte) {
 	files.mutex.RUnlock()
 	return
 }
+
+// Retrieves local location of content that is not held in memory
+func (files *AllFiles) GetFileStream(identifier str.FileID) (stream StreamedContent, isStreamed bool) {
+	files.mutex.RLock()
+	stream, isStreamed = files.streams[identifier]
+	files.mutex.RUnlock()
+	return
+}
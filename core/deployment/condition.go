@@ -0,0 +1,170 @@
+package deployment
+
+import (
+	"fmt"
+	"scmp/internal/config"
+	"strings"
+)
+
+// Evaluates a file metadata condition against host facts
+// Conditions compare facts to quoted values with == or !=, joined by && (binds first) and ||
+// For example: os_id == 'debian' && arch != 'aarch64' || os_id == 'alpine'
+func EvaluateCondition(condition string, facts config.HostFacts) (matched bool, err error) {
+	if strings.TrimSpace(condition) == "" {
+		matched = true
+		return
+	}
+
+	alternatives, err := splitCondition(condition, "||")
+	if err != nil {
+		return
+	}
+	for _, alternative := range alternatives {
+		var comparisons []string
+		comparisons, err = splitCondition(alternative, "&&")
+		if err != nil {
+			return
+		}
+
+		allMatched := true
+		for _, comparison := range comparisons {
+			var comparisonMatched bool
+			comparisonMatched, err = evaluateComparison(comparison, facts)
+			if err != nil {
+				return
+			}
+			allMatched = allMatched && comparisonMatched
+		}
+		// Every comparison is still evaluated so syntax errors are reported regardless of facts
+		matched = matched || allMatched
+	}
+	return
+}
+
+// Checks condition syntax without any gathered facts
+func ValidateCondition(condition string) (err error) {
+	_, err = EvaluateCondition(condition, config.HostFacts{})
+	return
+}
+
+// Value of a named fact
+func FactValue(facts config.HostFacts, name string) (value string, known bool) {
+	known = true
+	switch name {
+	case FactKernel:
+		value = facts.Kernel
+	case FactKernelRelease:
+		value = facts.KernelRelease
+	case FactArch:
+		value = facts.Arch
+	case FactOSID:
+		value = facts.OSID
+	case FactOSVersion:
+		value = facts.OSVersion
+	default:
+		known = false
+	}
+	return
+}
+
+// Replaces host fact macros in a remote command
+func ExpandFactMacros(command string, facts config.HostFacts) (expanded string) {
+	replacer := strings.NewReplacer(
+		MacroOSID, facts.OSID,
+		MacroOSVersion, facts.OSVersion,
+		MacroKernelRelease, facts.KernelRelease,
+		MacroKernel, facts.Kernel,
+		MacroArch, facts.Arch,
+	)
+	expanded = replacer.Replace(command)
+	return
+}
+
+// Reports whether command references any host fact macro
+func UsesFactMacros(command string) (used bool) {
+	for _, macro := range []string{MacroOSID, MacroOSVersion, MacroKernel, MacroKernelRelease, MacroArch} {
+		if strings.Contains(command, macro) {
+			used = true
+			return
+		}
+	}
+	return
+}
+
+// Single fact comparison, like: os_id == 'debian'
+func evaluateComparison(comparison string, facts config.HostFacts) (matched bool, err error) {
+	comparison = strings.TrimSpace(comparison)
+
+	operator := "=="
+	operatorIndex := strings.Index(comparison, operator)
+	notEqualIndex := strings.Index(comparison, "!=")
+	if notEqualIndex >= 0 && (operatorIndex < 0 || notEqualIndex < operatorIndex) {
+		operator, operatorIndex = "!=", notEqualIndex
+	}
+	if operatorIndex < 0 {
+		err = fmt.Errorf("condition '%s' is missing a comparison operator (== or !=)", comparison)
+		return
+	}
+
+	factName := strings.TrimSpace(comparison[:operatorIndex])
+	factValue, known := FactValue(facts, factName)
+	if !known {
+		err = fmt.Errorf("condition '%s' uses unknown fact '%s' (expected one of %s, %s, %s, %s, %s)",
+			comparison, factName, FactOSID, FactOSVersion, FactKernel, FactKernelRelease, FactArch)
+		return
+	}
+
+	quotedValue := strings.TrimSpace(comparison[operatorIndex+len(operator):])
+	if len(quotedValue) < 2 || (quotedValue[0] != '\'' && quotedValue[0] != '"') || quotedValue[len(quotedValue)-1] != quotedValue[0] {
+		err = fmt.Errorf("condition '%s' must compare against a quoted value", comparison)
+		return
+	}
+	value := quotedValue[1 : len(quotedValue)-1]
+	if strings.ContainsAny(value, `'"`) {
+		err = fmt.Errorf("condition '%s' has a quote inside the compared value", comparison)
+		return
+	}
+
+	matched = factValue == value
+	if operator == "!=" {
+		matched = !matched
+	}
+	return
+}
+
+// Splits condition on separator outside of quoted values
+func splitCondition(condition string, separator string) (parts []string, err error) {
+	var quote byte
+	var partStart int
+	for index := 0; index < len(condition); index++ {
+		character := condition[index]
+		if quote != 0 {
+			if character == quote {
+				quote = 0
+			}
+			continue
+		}
+		if character == '\'' || character == '"' {
+			quote = character
+			continue
+		}
+		if strings.HasPrefix(condition[index:], separator) {
+			parts = append(parts, condition[partStart:index])
+			index += len(separator) - 1
+			partStart = index + 1
+		}
+	}
+	if quote != 0 {
+		err = fmt.Errorf("condition '%s' has an unterminated quote", condition)
+		return
+	}
+	parts = append(parts, condition[partStart:])
+
+	for _, part := range parts {
+		if strings.TrimSpace(part) == "" {
+			err = fmt.Errorf("condition '%s' has an empty comparison around '%s'", condition, separator)
+			return
+		}
+	}
+	return
+}
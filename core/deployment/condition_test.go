@@ -0,0 +1,57 @@
+package deployment
+
+import (
+	"scmp/internal/config"
+	"testing"
+)
+
+func TestEvaluateCondition(t *testing.T) {
+	debian := config.HostFacts{Kernel: "Linux", KernelRelease: "6.1.0-18-amd64", Arch: "x86_64", OSID: "debian", OSVersion: "12"}
+
+	tests := []struct {
+		condition       string
+		expectedMatched bool
+		expectedErr     bool
+	}{
+		{"", true, false},
+		{"os_id == 'debian'", true, false},
+		{`os_id == "alpine"`, false, false},
+		{"os_id != 'alpine'", true, false},
+		{"os_id == 'debian' && os_version == '11'", false, false},
+		{"os_id == 'alpine' || arch == 'x86_64'", true, false},
+		{"os_id == 'alpine' || os_id == 'debian' && arch != 'x86_64'", false, false},
+		{"os_id == 'a&&b || c'", false, false},
+		{"distro == 'debian'", false, true},
+		{"os_id = 'debian'", false, true},
+		{"os_id == debian", false, true},
+		{"os_id == 'debian", false, true},
+		{"os_id == 'debian' &&", false, true},
+		// Syntax errors are reported even when an earlier alternative matched
+		{"os_id == 'debian' || arch ~ 'x86_64'", false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.condition, func(t *testing.T) {
+			matched, err := EvaluateCondition(test.condition, debian)
+			if test.expectedErr != (err != nil) {
+				t.Fatalf("expected error %t, got '%v'", test.expectedErr, err)
+			}
+			if err == nil && matched != test.expectedMatched {
+				t.Errorf("expected matched %t, got %t", test.expectedMatched, matched)
+			}
+		})
+	}
+}
+
+func TestExpandFactMacros(t *testing.T) {
+	facts := config.HostFacts{Kernel: "Linux", KernelRelease: "6.6.7", Arch: "aarch64", OSID: "alpine", OSVersion: "3.19.1"}
+
+	expanded := ExpandFactMacros("apk add nginx # {@OSID} {@OSVERSION} {@KERNEL} {@KERNELRELEASE} {@ARCH}", facts)
+	expected := "apk add nginx # alpine 3.19.1 Linux 6.6.7 aarch64"
+	if expanded != expected {
+		t.Errorf("expected '%s', got '%s'", expected, expanded)
+	}
+	if !UsesFactMacros("systemctl reload {@OSID}") || UsesFactMacros("systemctl reload nginx") {
+		t.Errorf("fact macro detection mismatch")
+	}
+}
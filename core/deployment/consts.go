@@ -1,12 +1,27 @@
 package deployment
 
-import "scmp/internal/str"
+import (
+	"errors"
+	"scmp/internal/str"
+	"time"
+)
 
 const (
 	IgnoreDirectoryPrefix str.LocalRepoPath = "_"                                  // Top level only
 	FailTrackerFile       string            = ".scmp-last-deployment-summary.json" // file name for recording deployment summary details
 
 	FileCountPromptThreshold int = 50
+	FanoutHostListLimit      int = 10 // Universal file receivers above this count are summarized instead of listed
+	SkippedListLimit         int = 20 // Default skipped files listed per skip reason
+
+	DeadlineGracePeriod time.Duration = 30 * time.Second // Longest time in-flight work continues once a deadline stops new work
+
+	StatusRedrawInterval   time.Duration = 500 * time.Millisecond // Status line refresh on terminals
+	StatusSnapshotInterval time.Duration = 30 * time.Second       // Status snapshot frequency when output is not a terminal
+
+	RemoteDependencyPrefix str.LocalRepoPath = "remote:" // Dependency references a target (remote) path instead of a repository path
+
+	InstallMarkerDir str.RemotePath = "/var/lib/scmp/installed" // Remote directory of markers recording run InstallOnce commands
 
 	EmptyFileHash str.FileID = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
 
@@ -15,6 +30,11 @@ const (
 	ModeDiff     string = "diff"
 	ModeRetry    string = "failures"
 	ModeRollback string = "rollback"
+	ModeExport   string = "export" // Writes planned content locally instead of deploying
+
+	// Deployment summary output formats
+	SummaryFormatText string = "text"
+	SummaryFormatJSON string = "json"
 
 	ActionFileCreate    str.DeployAction = "fileCreate"
 	ActionFileModify    str.DeployAction = "fileModify"
@@ -25,4 +45,112 @@ const (
 	ActionSymLinkCreate str.DeployAction = "symlinkCreate"
 	ActionSymLinkModify str.DeployAction = "symlinkModify"
 	ActionSymLinkDelete str.DeployAction = "symlinkDelete"
+	ActionAccountsApply str.DeployAction = "accountsApply" // Users and groups of a host directory user metadata file
+)
+
+// Reasons repository files are left out of a deployment (names are used with --fail-on-skipped)
+const (
+	SkipUnsupportedMode  string = "unsupported-mode"
+	SkipRepoRoot         string = "repo-root"
+	SkipIgnoreDirectory  string = "ignore-directory"
+	SkipUnknownDirectory string = "unknown-directory"
+	SkipDeniedUniversal  string = "denied-universal"
+	SkipDeletion         string = "deletion-disabled"
+)
+
+// Host fact names usable in file metadata conditions
+const (
+	FactKernel        string = "kernel"
+	FactKernelRelease string = "kernel_release"
+	FactArch          string = "arch"
+	FactOSID          string = "os_id"
+	FactOSVersion     string = "os_version"
+)
+
+// Host fact macros replaced in remote commands (install, checks, reloads) when facts are gathered
+const (
+	MacroOSID          string = "{@OSID}"
+	MacroOSVersion     string = "{@OSVERSION}"
+	MacroKernel        string = "{@KERNEL}"
+	MacroKernelRelease string = "{@KERNELRELEASE}"
+	MacroArch          string = "{@ARCH}"
+)
+
+// Deployment phases of files on a host (metadata "Phase"), hosts deploy one phase at a time in this order
+const (
+	PhaseAccounts  string = "accounts" // Users and groups, never selectable by file metadata
+	PhaseInstall   string = "install"
+	PhaseConfigure string = "configure" // Default phase of files without a "Phase"
+	PhaseActivate  string = "activate"
+	PhaseVerify    string = "verify"
 )
+
+// Handling of a failed file in a phase (config "PhaseAbort")
+const (
+	PhaseAbortHost     string = "host"     // No further files of the host are started
+	PhaseAbortPhase    string = "phase"    // No further files of the failed phase are started, later phases still run
+	PhaseAbortContinue string = "continue" // Remaining files of the host still deploy
+)
+
+// Deployment options or arguments that cannot be used together or could not be parsed
+var ErrInvalidOptions = errors.New("invalid options")
+
+// Cause of deployment and host contexts stopped by a deadline
+var ErrDeadlineExceeded = errors.New("deadline exceeded")
+
+// Cause of deployment contexts stopped by a user interrupt (files already started still finish)
+var ErrInterrupted = errors.New("deployment interrupted")
+
+// Hosts stopped before any file was touched because a remote pre-flight check failed (disk space, sudo access)
+var ErrPreflightFailed = errors.New("pre-flight checks failed")
+
+// Files held because their new content is much smaller than the remote content
+var ErrSuspiciousShrink = errors.New("suspicious shrink")
+
+// Symbolic links refused because something other than a link (or a regular file with --force) is at their path
+var ErrLinkPathOccupied = errors.New("link path occupied")
+
+// Files restored because their reload group failed its post-reload checks
+var ErrReloadRolledBack = errors.New("reload rolled back")
+
+// Deployment bundles whose HMAC does not match their content (wrong vault password or altered bundle)
+var ErrBundleIntegrity = errors.New("bundle integrity check failed")
+
+// Report order of skip reasons
+var SkipReasons = []string{
+	SkipUnsupportedMode,
+	SkipRepoRoot,
+	SkipIgnoreDirectory,
+	SkipUnknownDirectory,
+	SkipDeniedUniversal,
+	SkipDeletion,
+}
+
+// Execution order of phases
+var Phases = []string{
+	PhaseAccounts,
+	PhaseInstall,
+	PhaseConfigure,
+	PhaseActivate,
+	PhaseVerify,
+}
+
+// Phases files can select with their metadata "Phase"
+var FilePhases = []string{
+	PhaseInstall,
+	PhaseConfigure,
+	PhaseActivate,
+	PhaseVerify,
+}
+
+var SkipReasonDescriptions = map[string]string{
+	SkipUnsupportedMode:  "unsupported file mode (git symbolic link, submodule, ect.)",
+	SkipRepoRoot:         "file is in the root of the repository",
+	SkipIgnoreDirectory:  "file is under a directory prefixed with '" + string(IgnoreDirectoryPrefix) + "'",
+	SkipUnknownDirectory: "top level directory is not a configured host or universal directory",
+	SkipDeniedUniversal:  "universal file is overridden by a host or higher precedence group file of the same path",
+	SkipDeletion:         "file was deleted but deletions are not allowed",
+}
+
+// Files whose metadata header cannot be parsed (the deployment is refused, --force skips the files)
+var ErrMalformedHeader = errors.New("malformed metadata header")
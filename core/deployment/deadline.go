@@ -0,0 +1,10 @@
+package deployment
+
+import "time"
+
+// Time before a deadline that new work stops starting, so in-flight work can finish before being cut off
+// Capped at a quarter of the deadline so short deadlines still admit work
+func DeadlineGrace(deadline time.Duration) (grace time.Duration) {
+	grace = min(DeadlineGracePeriod, deadline/4)
+	return
+}
@@ -0,0 +1,24 @@
+package deployment
+
+import (
+	"scmp/internal/str"
+	"strings"
+)
+
+// Splits a dependency on a file of another host ("HOST:/target/path") into the host and the target path
+// Repository paths and remote path dependencies are not host dependencies
+func ParseHostDependency(dependency str.LocalRepoPath) (endpointName str.RepoRootDir, targetPath str.RemotePath, isHostDependency bool) {
+	if str.HasPrefix(dependency, RemoteDependencyPrefix) {
+		return
+	}
+
+	hostName, remotePath, found := strings.Cut(string(dependency), ":")
+	if !found || hostName == "" || strings.Contains(hostName, "/") || !strings.HasPrefix(remotePath, "/") {
+		return
+	}
+
+	endpointName = str.RepoRootDir(hostName)
+	targetPath = str.RemotePath(remotePath)
+	isHostDependency = true
+	return
+}
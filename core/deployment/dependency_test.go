@@ -0,0 +1,31 @@
+package deployment
+
+import (
+	"scmp/internal/str"
+	"testing"
+)
+
+func TestParseHostDependency(t *testing.T) {
+	tests := []struct {
+		dependency   str.LocalRepoPath
+		expectHost   str.RepoRootDir
+		expectTarget str.RemotePath
+		isHost       bool
+	}{
+		{"dbhost:/etc/postgresql/pg_hba.conf", "dbhost", "/etc/postgresql/pg_hba.conf", true},
+		{"db-01.example.com:/etc/hosts", "db-01.example.com", "/etc/hosts", true},
+		{"remote:/etc/ssl/certs/internal-ca.crt", "", "", false},
+		{"host1/etc/resolv.conf", "", "", false},
+		{"host1/etc/odd:/name", "", "", false},
+		{"dbhost:etc/hosts", "", "", false},
+		{":/etc/hosts", "", "", false},
+	}
+
+	for _, test := range tests {
+		endpointName, targetPath, isHost := ParseHostDependency(test.dependency)
+		if isHost != test.isHost || endpointName != test.expectHost || targetPath != test.expectTarget {
+			t.Errorf("dependency '%s': expected (%q, %q, %t), got (%q, %q, %t)",
+				test.dependency, test.expectHost, test.expectTarget, test.isHost, endpointName, targetPath, isHost)
+		}
+	}
+}
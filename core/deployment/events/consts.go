@@ -0,0 +1,57 @@
+package events
+
+import (
+	"os"
+	"time"
+)
+
+const (
+	SchemaVersion int           = 1    // Bumped only on incompatible changes to the event fields
+	StdoutPath    string        = "-"  // Event stream path selecting stdout
+	queueSize     int           = 1024 // Events buffered for a slow consumer before the oldest are dropped
+	fileMode      os.FileMode   = 0644 // Permissions of created event files
+	timeFormat    string        = "2006-01-02T15:04:05.000000Z07:00"
+	closeTimeout  time.Duration = 10 * time.Second // Longest wait for the consumer to take remaining events on exit
+)
+
+// Event types, stable names for consumers
+const (
+	DeploymentStarted  string = "deployment_started"  // Details: item and host counts
+	DeploymentFinished string = "deployment_finished" // Details: final status, or the error stopping the deployment (always the last event)
+	HostStarted        string = "host_started"
+	HostConnected      string = "host_connected" // Details: address the host was reached on
+	HostFailed         string = "host_failed"    // Details: error
+	HostNotAttempted   string = "host_not_attempted"
+	HostUnconfirmed    string = "host_confirmation_required"
+	HostHalted         string = "host_halted"   // Details: failed rollout batch that halted the host
+	HostFinished       string = "host_finished" // Details: final host status
+	FileDeployed       string = "file_deployed"
+	FileUnchanged      string = "file_unchanged"
+	FileFailed         string = "file_failed"        // Details: error
+	FileSkipped        string = "file_skipped"       // Details: reason
+	FileWetRun         string = "file_wet_run"       // Details: wet-run outcome
+	ReloadFailed       string = "reload_failed"      // Details: reload group and error
+	ReloadRolledBack   string = "reload_rolled_back" // Details: reload group and failed post-reload check
+	EventsDropped      string = "events_dropped"     // Details: number of events dropped while the consumer stalled
+)
+
+// All event types in the order they are documented
+var Types = []string{
+	DeploymentStarted,
+	HostStarted,
+	HostConnected,
+	FileDeployed,
+	FileUnchanged,
+	FileFailed,
+	FileSkipped,
+	FileWetRun,
+	ReloadFailed,
+	ReloadRolledBack,
+	HostFailed,
+	HostNotAttempted,
+	HostUnconfirmed,
+	HostHalted,
+	HostFinished,
+	EventsDropped,
+	DeploymentFinished,
+}
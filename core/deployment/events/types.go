@@ -0,0 +1,35 @@
+// Package for streaming deployment events as JSON Lines while the deployment runs
+package events
+
+import (
+	"io"
+	"scmp/internal/str"
+	"sync"
+	"sync/atomic"
+)
+
+// Single line of the event stream
+type Event struct {
+	Schema       int               `json:"schema"`
+	Time         string            `json:"time"` // RFC 3339 with microseconds
+	DeploymentID string            `json:"deploymentID"`
+	Type         string            `json:"type"`
+	Host         str.RepoRootDir   `json:"host,omitempty"`
+	File         str.LocalRepoPath `json:"file,omitempty"`
+	Details      string            `json:"details,omitempty"`
+}
+
+// Non-blocking event sink, events are written by a single background routine
+// A nil writer discards all events
+type Writer struct {
+	deploymentID string
+	queue        chan Event
+	dropped      atomic.Int64
+	output       io.Writer
+	closeOutput  func() error
+	mask         func(text string) string // Masks secret values in details, nil writes details as given
+	closed       bool
+	mutex        sync.RWMutex // Protects closed against emits racing Close
+	done         chan struct{}
+	err          error // First write error, reported by Close
+}
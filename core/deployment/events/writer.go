@@ -0,0 +1,183 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"scmp/internal/fsops"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"strconv"
+	"time"
+)
+
+// Opens the event stream at path (appended to) or stdout for "-", events are written until Close
+// Values masked in the logs of ctx are masked in event details too
+func Open(ctx context.Context, path string, deploymentID string) (writer *Writer, err error) {
+	output := io.Writer(os.Stdout)
+	var closeOutput func() error
+	if path != StdoutPath {
+		path, err = fsops.ExpandHomeDirectory(path)
+		if err != nil {
+			err = fmt.Errorf("failed to find home directory for '%s': %w", path, err)
+			return
+		}
+		var eventFile *os.File
+		eventFile, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, fileMode)
+		if err != nil {
+			err = fmt.Errorf("failed opening event stream file: %w", err)
+			return
+		}
+		output = eventFile
+		closeOutput = eventFile.Close
+	}
+
+	writer = NewWriter(output, deploymentID)
+	writer.closeOutput = closeOutput
+	writer.mask = func(text string) string {
+		return logctx.Mask(ctx, text)
+	}
+	return
+}
+
+// Starts writing events for a deployment to output
+func NewWriter(output io.Writer, deploymentID string) (writer *Writer) {
+	writer = &Writer{
+		deploymentID: deploymentID,
+		queue:        make(chan Event, queueSize),
+		output:       output,
+		done:         make(chan struct{}),
+	}
+	go writer.run()
+	return
+}
+
+// Queues an event without blocking, the oldest queued event is dropped when the consumer stalls
+func (writer *Writer) Emit(eventType string, host str.RepoRootDir, file str.LocalRepoPath, details string) {
+	if writer == nil {
+		return
+	}
+
+	if writer.mask != nil {
+		details = writer.mask(details)
+	}
+
+	event := Event{
+		Schema:       SchemaVersion,
+		Time:         time.Now().UTC().Format(timeFormat),
+		DeploymentID: writer.deploymentID,
+		Type:         eventType,
+		Host:         host,
+		File:         file,
+		Details:      details,
+	}
+
+	writer.mutex.RLock()
+	defer writer.mutex.RUnlock()
+	if writer.closed {
+		return
+	}
+
+	for {
+		select {
+		case writer.queue <- event:
+			return
+		default:
+		}
+
+		select {
+		case <-writer.queue:
+			writer.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+// Writes all queued events and closes the output, returns the first write error
+// Gives up on events still queued when the consumer stops reading for closeTimeout
+// Safe to call on a nil writer
+func (writer *Writer) Close() (err error) {
+	if writer == nil {
+		return
+	}
+
+	writer.mutex.Lock()
+	if writer.closed {
+		writer.mutex.Unlock()
+		return
+	}
+	writer.closed = true
+	close(writer.queue)
+	writer.mutex.Unlock()
+
+	// A consumer that never reads again must not hold up exit
+	select {
+	case <-writer.done:
+		err = writer.err
+	case <-time.After(closeTimeout):
+		err = fmt.Errorf("event stream consumer stalled, %d queued event(s) not written", len(writer.queue))
+	}
+	if writer.closeOutput != nil {
+		lerr := writer.closeOutput()
+		if err == nil && lerr != nil {
+			err = lerr
+		}
+	}
+	return
+}
+
+// Number of events dropped because the consumer did not keep up
+func (writer *Writer) Dropped() (dropped int64) {
+	if writer == nil {
+		return
+	}
+	dropped = writer.dropped.Load()
+	return
+}
+
+// Background routine encoding queued events, output is flushed whenever the queue runs empty
+func (writer *Writer) run() {
+	defer close(writer.done)
+
+	buffer := bufio.NewWriter(writer.output)
+	encoder := json.NewEncoder(buffer)
+	var reportedDrops int64
+
+	write := func(event Event) {
+		if writer.err != nil {
+			return
+		}
+		writer.err = encoder.Encode(event)
+	}
+
+	// Drops are reported where the gap is, ahead of the next event written
+	reportDrops := func() {
+		dropped := writer.dropped.Load()
+		if dropped == reportedDrops {
+			return
+		}
+		write(Event{
+			Schema:       SchemaVersion,
+			Time:         time.Now().UTC().Format(timeFormat),
+			DeploymentID: writer.deploymentID,
+			Type:         EventsDropped,
+			Details:      strconv.FormatInt(dropped-reportedDrops, 10),
+		})
+		reportedDrops = dropped
+	}
+
+	for event := range writer.queue {
+		reportDrops()
+		write(event)
+		if len(writer.queue) == 0 && writer.err == nil {
+			writer.err = buffer.Flush()
+		}
+	}
+	reportDrops()
+	if writer.err == nil {
+		writer.err = buffer.Flush()
+	}
+}
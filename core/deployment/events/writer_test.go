@@ -0,0 +1,149 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"scmp/internal/logctx"
+	"strconv"
+	"testing"
+)
+
+// Output that blocks every write until released, like a consumer that stopped reading
+type stalledOutput struct {
+	release chan struct{}
+	buffer  bytes.Buffer
+}
+
+func (output *stalledOutput) Write(data []byte) (written int, err error) {
+	<-output.release
+	written, err = output.buffer.Write(data)
+	return
+}
+
+func readEvents(t *testing.T, data []byte) (events []Event) {
+	t.Helper()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var event Event
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			t.Fatalf("invalid event line '%s': %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	return
+}
+
+func TestWriterSchema(t *testing.T) {
+	var output bytes.Buffer
+	writer := NewWriter(&output, "deploy-1")
+	writer.Emit(HostStarted, "host1", "", "")
+	writer.Emit(FileFailed, "host1", "host1/etc/hosts", "permission denied")
+	err := writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected error closing: %v", err)
+	}
+
+	// Emits after close are discarded
+	writer.Emit(HostStarted, "host2", "", "")
+
+	events := readEvents(t, output.Bytes())
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	failed := events[1]
+	if failed.Schema != SchemaVersion || failed.DeploymentID != "deploy-1" || failed.Type != FileFailed || failed.Host != "host1" || failed.File != "host1/etc/hosts" || failed.Details != "permission denied" || failed.Time == "" {
+		t.Errorf("unexpected event fields: %+v", failed)
+	}
+
+	// Optional fields are left out when empty
+	firstLine, _, _ := bytes.Cut(output.Bytes(), []byte("\n"))
+	if bytes.Contains(firstLine, []byte(`"file"`)) || bytes.Contains(firstLine, []byte(`"details"`)) {
+		t.Errorf("expected empty fields omitted, got '%s'", firstLine)
+	}
+
+	// Nil writer is a no-op
+	var nilWriter *Writer
+	nilWriter.Emit(HostStarted, "host1", "", "")
+	if nilWriter.Close() != nil {
+		t.Errorf("expected nil writer close to succeed")
+	}
+}
+
+func TestWriterDropsOldest(t *testing.T) {
+	output := &stalledOutput{release: make(chan struct{})}
+	writer := NewWriter(output, "deploy-1")
+
+	// Emitting never blocks while the consumer is stalled
+	total := queueSize * 3
+	for index := range total {
+		writer.Emit(FileDeployed, "host1", "", strconv.Itoa(index))
+	}
+	if writer.Dropped() == 0 {
+		t.Fatalf("expected events dropped while the consumer is stalled")
+	}
+
+	close(output.release)
+	err := writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected error closing: %v", err)
+	}
+
+	events := readEvents(t, output.buffer.Bytes())
+	var reportedDrops int64
+	var delivered int
+	for _, event := range events {
+		if event.Type == EventsDropped {
+			count, err := strconv.ParseInt(event.Details, 10, 64)
+			if err != nil {
+				t.Fatalf("invalid dropped count '%s'", event.Details)
+			}
+			reportedDrops += count
+			continue
+		}
+		delivered++
+	}
+	if reportedDrops != writer.Dropped() {
+		t.Errorf("expected %d dropped events reported, got %d", writer.Dropped(), reportedDrops)
+	}
+	if int64(delivered)+reportedDrops != int64(total) {
+		t.Errorf("expected delivered and dropped to add up to %d, got %d and %d", total, delivered, reportedDrops)
+	}
+
+	// Newest events are the ones kept
+	last := events[len(events)-1]
+	if last.Details != fmt.Sprint(total-1) {
+		t.Errorf("expected newest event kept last, got %+v", last)
+	}
+}
+
+func TestOpenMasksDetails(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	ctx := logctx.New(t.Context(), logctx.NSTest, logctx.VerbosityNone, done)
+	logctx.MaskValues(ctx, "s3cret")
+
+	eventPath := filepath.Join(t.TempDir(), "events.jsonl")
+	writer, err := Open(ctx, eventPath, "deploy-1")
+	if err != nil {
+		t.Fatalf("unexpected error opening: %v", err)
+	}
+	writer.Emit(FileFailed, "host1", "host1/etc/app.conf", "error with command 'app-reload --token s3cret'")
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected error closing: %v", err)
+	}
+
+	data, err := os.ReadFile(eventPath)
+	if err != nil {
+		t.Fatalf("failed reading events: %v", err)
+	}
+	events := readEvents(t, data)
+	if len(events) != 1 || events[0].Details != "error with command 'app-reload --token ********'" {
+		t.Errorf("expected masked details, got %+v", events)
+	}
+}
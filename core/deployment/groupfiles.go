@@ -100,6 +100,12 @@ func (group *FileGroup) RecordReloadIDFileCount() {
 	group.mutex.Unlock()
 }
 
+func (group *FileGroup) SetPhase(phase string) {
+	group.mutex.Lock()
+	group.phase = phase
+	group.mutex.Unlock()
+}
+
 func (group *FileGroup) PurgePath(path str.LocalRepoPath) {
 	group.mutex.Lock()
 	defer group.mutex.Unlock()
@@ -239,6 +245,17 @@ func (group *FileGroup) GetReloadIDFileCount(reloadID str.ReloadID) (fileCount i
 	return
 }
 
+// Groups built without a phase belong to the default phase
+func (group *FileGroup) GetPhase() (phase string) {
+	group.mutex.RLock()
+	phase = group.phase
+	group.mutex.RUnlock()
+	if phase == "" {
+		phase = PhaseConfigure
+	}
+	return
+}
+
 // Retrieves list of files for a reloadID but reversed from deployment order
 func (group *FileGroup) GetReloadIDFilesReverse(reloadID str.ReloadID) (paths []str.LocalRepoPath) {
 	group.mutex.RLock()
@@ -0,0 +1,105 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Sets the archive directory name of this host's deployment (empty keeps archive style backups in the temporary backup directory)
+func (deployer *Deployer) SetBackupArchiveID(archiveID string) {
+	deployer.backupArchiveID = archiveID
+}
+
+// True when any file of the host is backed up with the archive style
+func usesArchiveBackups(deployFiles *deployment.HostFiles) (used bool) {
+	for _, repoFilePath := range deployFiles.GetUnorderedList() {
+		if deployFiles.GetFileInfo(repoFilePath).BackupStyle == sshinternal.BackupStyleArchive {
+			used = true
+			return
+		}
+	}
+	return
+}
+
+// Creates the backup directory only readable by root, deployment archive directories are created below it with their first backup
+func prepareBackupArchive(ctx context.Context, host sshinternal.HostMeta, backupDirectory str.RemotePath) (err error) {
+	_, _, err = sshinternal.RunBatch(ctx, host,
+		sshinternal.BuildMkdir(backupDirectory),
+		sshinternal.BuildChmod(700, backupDirectory),
+	)
+	if err != nil {
+		err = fmt.Errorf("failed to prepare backup directory '%s': %w", backupDirectory, err)
+		return
+	}
+	return
+}
+
+// Removes the oldest archived deployments of the host, keeping the newest retention ones (0 keeps all)
+func pruneBackupArchive(ctx context.Context, host sshinternal.HostMeta, backupDirectory str.RemotePath, retention int) (err error) {
+	if retention == 0 {
+		return
+	}
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	command := sshinternal.BuildLsList(backupDirectory)
+	command.DisableSudo = opts.DisableSudo
+	command.RunAsUser = opts.RunAsUser
+	listing, err := command.SSHexec(ctx, host.SSHClient, host.Password)
+	if err != nil {
+		err = fmt.Errorf("failed to list backup directory '%s': %w", backupDirectory, err)
+		return
+	}
+
+	expired := expiredArchives(listing, retention)
+	if len(expired) == 0 {
+		return
+	}
+
+	var expiredPaths []str.RemotePath
+	for _, archiveID := range expired {
+		expiredPaths = append(expiredPaths, backupDirectory+"/"+str.RemotePath(archiveID))
+	}
+	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Removing %d archived deployment backup(s) beyond retention of %d\n", len(expired), retention)
+
+	command = sshinternal.BuildRmAll(expiredPaths...)
+	command.DisableSudo = opts.DisableSudo
+	command.RunAsUser = opts.RunAsUser
+	_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
+	if err != nil {
+		err = fmt.Errorf("failed to remove archived deployment backups: %w", err)
+		return
+	}
+	return
+}
+
+// Archive directories of a backup directory listing (ls -1AF) that are older than the newest retention ones
+// Entries not named like an archive directory are never returned
+func expiredArchives(listing string, retention int) (expired []string) {
+	var archives []string
+	for _, line := range strings.Split(strings.ReplaceAll(listing, "\r", ""), "\n") {
+		name, isDirectory := strings.CutSuffix(strings.TrimSpace(line), "/")
+		if !isDirectory {
+			continue
+		}
+		_, err := time.Parse(sshinternal.BackupArchiveIDFormat, name)
+		if err != nil {
+			continue
+		}
+		archives = append(archives, name)
+	}
+	slices.Sort(archives)
+
+	if len(archives) > retention {
+		expired = archives[:len(archives)-retention]
+	}
+	return
+}
@@ -0,0 +1,26 @@
+package host
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExpiredArchives(t *testing.T) {
+	listing := "20261015T080000Z/\r\n" +
+		"20261017T142501Z/\n" +
+		"20261016T093000Z/\n" +
+		"notes.txt\n" +
+		"manual-copy/\n" +
+		"20261014T000000Z\n" + // Not a directory
+		"20261013T120000Z/\n"
+
+	expired := expiredArchives(listing, 2)
+	if !slices.Equal(expired, []string{"20261013T120000Z", "20261015T080000Z"}) {
+		t.Errorf("unexpected expired archives %v", expired)
+	}
+
+	expired = expiredArchives(listing, 4)
+	if len(expired) != 0 {
+		t.Errorf("expected nothing beyond retention, got %v", expired)
+	}
+}
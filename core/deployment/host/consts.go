@@ -1,5 +1,9 @@
 package host
 
+import "time"
+
 const (
-	RemoteTmpDir string = "/tmp" // Temporary directory to use on remote systems
+	RemoteTmpDir     string        = "/tmp"                   // Temporary directory to use on remote systems
+	RemoteLockPath   string        = "/tmp/.scmp-deploy.lock" // Lock directory held for the whole deployment to a host
+	lockPollInterval time.Duration = 5 * time.Second          // Time between lock attempts while waiting for another deployment
 )
@@ -0,0 +1,181 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"scmp/core/deployment"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+)
+
+func NewCrossHostCoordinator() (coordinator *CrossHostCoordinator) {
+	coordinator = &CrossHostCoordinator{
+		files:     make(map[crossHostKey]*crossHostFile),
+		dependsOn: make(map[str.RepoRootDir][]str.RepoRootDir),
+		started:   make(map[str.RepoRootDir]chan struct{}),
+	}
+	return
+}
+
+// Sets the coordinator of files depended on by other hosts
+func (deployer *Deployer) SetCrossHostCoordinator(coordinator *CrossHostCoordinator) {
+	deployer.crossHost = coordinator
+}
+
+// Records that a file on dependentHost waits on the file supplying targetPath on endpointName
+func (coordinator *CrossHostCoordinator) Watch(dependentHost str.RepoRootDir, endpointName str.RepoRootDir, targetPath str.RemotePath, repoFilePath str.LocalRepoPath) {
+	coordinator.mutex.Lock()
+	defer coordinator.mutex.Unlock()
+
+	key := crossHostKey{endpointName: endpointName, targetPath: targetPath}
+	_, watched := coordinator.files[key]
+	if !watched {
+		coordinator.files[key] = &crossHostFile{repoFilePath: repoFilePath, done: make(chan struct{})}
+	}
+	if !slices.Contains(coordinator.dependsOn[dependentHost], endpointName) {
+		coordinator.dependsOn[dependentHost] = append(coordinator.dependsOn[dependentHost], endpointName)
+		slices.Sort(coordinator.dependsOn[dependentHost])
+	}
+	for _, hostName := range []str.RepoRootDir{dependentHost, endpointName} {
+		_, tracked := coordinator.started[hostName]
+		if !tracked {
+			coordinator.started[hostName] = make(chan struct{})
+		}
+	}
+}
+
+// Hosts whose files the host waits on
+func (coordinator *CrossHostCoordinator) HostDependencies(endpointName str.RepoRootDir) (dependencyHosts []str.RepoRootDir) {
+	if coordinator == nil {
+		return
+	}
+	coordinator.mutex.Lock()
+	dependencyHosts = slices.Clone(coordinator.dependsOn[endpointName])
+	coordinator.mutex.Unlock()
+	return
+}
+
+// Waits until every host the host depends on has started, returns early once the deployment is stopped
+func (coordinator *CrossHostCoordinator) waitForDependencyHosts(ctx context.Context, endpointName str.RepoRootDir) {
+	for _, dependencyHost := range coordinator.HostDependencies(endpointName) {
+		coordinator.mutex.Lock()
+		started := coordinator.started[dependencyHost]
+		coordinator.mutex.Unlock()
+
+		select {
+		case <-started:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Marks the host as started, hosts depending on it may start
+func (coordinator *CrossHostCoordinator) hostStarted(endpointName str.RepoRootDir) {
+	if coordinator == nil {
+		return
+	}
+	coordinator.mutex.Lock()
+	defer coordinator.mutex.Unlock()
+
+	started, tracked := coordinator.started[endpointName]
+	if !tracked {
+		return
+	}
+	select {
+	case <-started:
+	default:
+		close(started)
+	}
+}
+
+// Records the result of a file of the host, hosts waiting on it continue
+func (coordinator *CrossHostCoordinator) fileFinished(endpointName str.RepoRootDir, repoFilePath str.LocalRepoPath, fileErr error) {
+	if coordinator == nil {
+		return
+	}
+	coordinator.mutex.Lock()
+	defer coordinator.mutex.Unlock()
+
+	for key, file := range coordinator.files {
+		if key.endpointName != endpointName || file.repoFilePath != repoFilePath {
+			continue
+		}
+		file.resolve(fileErr)
+	}
+}
+
+// Fails every depended on file of the host without a result, for hosts that finished (or never started) without deploying them
+func (coordinator *CrossHostCoordinator) HostFinished(endpointName str.RepoRootDir, reason error) {
+	if coordinator == nil {
+		return
+	}
+	coordinator.hostStarted(endpointName)
+
+	coordinator.mutex.Lock()
+	defer coordinator.mutex.Unlock()
+
+	for key, file := range coordinator.files {
+		if key.endpointName != endpointName {
+			continue
+		}
+		file.resolve(reason)
+	}
+}
+
+// Sets the file result once, later results are ignored
+func (file *crossHostFile) resolve(fileErr error) {
+	select {
+	case <-file.done:
+	default:
+		file.err = fileErr
+		close(file.done)
+	}
+}
+
+// Waits until the file supplying targetPath on endpointName has a result
+// Dependencies that are not watched (not part of the deployment) do not wait
+func (coordinator *CrossHostCoordinator) wait(ctx context.Context, endpointName str.RepoRootDir, targetPath str.RemotePath) (err error) {
+	if coordinator == nil {
+		return
+	}
+
+	coordinator.mutex.Lock()
+	file, watched := coordinator.files[crossHostKey{endpointName: endpointName, targetPath: targetPath}]
+	coordinator.mutex.Unlock()
+	if !watched {
+		return
+	}
+
+	select {
+	case <-file.done:
+	default:
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Waiting for '%s' on host %s\n", targetPath, endpointName)
+	}
+
+	select {
+	case <-file.done:
+		err = file.err
+	case <-ctx.Done():
+		err = fmt.Errorf("immediate stop requested while waiting for '%s' on host %s", targetPath, endpointName)
+	}
+	return
+}
+
+// Waits for the results of every file on other hosts the file depends on
+func (group fileGroup) waitForHostDependencies(ctx context.Context, info deployment.FileInfo) (skipReason error) {
+	for _, dependency := range info.Dependencies {
+		endpointName, targetPath, isHostDependency := deployment.ParseHostDependency(dependency)
+		if !isHostDependency {
+			continue
+		}
+
+		err := group.crossHost.wait(ctx, endpointName, targetPath)
+		if err != nil {
+			skipReason = fmt.Errorf("unable to deploy this file: dependency failed: '%s' on host %s did not deploy: %w", targetPath, endpointName, err)
+			return
+		}
+	}
+	return
+}
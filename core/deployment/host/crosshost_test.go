@@ -0,0 +1,162 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"scmp/core/deployment"
+	"scmp/core/deployment/metrics"
+	"scmp/internal/config"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCrossHostCoordinatorWait(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	coordinator := NewCrossHostCoordinator()
+	coordinator.Watch("web01", "db01", "/etc/postgresql/pg_hba.conf", "db01/etc/postgresql/pg_hba.conf")
+	coordinator.Watch("web01", "db01", "/etc/hosts", "UniversalConfs/etc/hosts")
+	coordinator.Watch("web02", "db01", "/etc/postgresql/pg_hba.conf", "db01/etc/postgresql/pg_hba.conf")
+
+	if dependencyHosts := coordinator.HostDependencies("web01"); len(dependencyHosts) != 1 || dependencyHosts[0] != "db01" {
+		t.Errorf("expected web01 to depend on db01, got %v", dependencyHosts)
+	}
+
+	// Paths nothing waits on never block
+	err := coordinator.wait(ctx, "db01", "/etc/motd")
+	if err != nil {
+		t.Errorf("unexpected error for unwatched path: %v", err)
+	}
+
+	waitResult := make(chan error, 1)
+	go func() {
+		waitResult <- coordinator.wait(ctx, "db01", "/etc/postgresql/pg_hba.conf")
+	}()
+	select {
+	case err = <-waitResult:
+		t.Fatalf("wait returned before the file finished: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	coordinator.fileFinished("db01", "db01/etc/postgresql/pg_hba.conf", nil)
+	err = <-waitResult
+	if err != nil {
+		t.Errorf("expected successful dependency, got %v", err)
+	}
+
+	// First result wins, unresolved files fail once their host finishes
+	coordinator.HostFinished("db01", fmt.Errorf("host db01 failed"))
+	err = coordinator.wait(ctx, "db01", "/etc/postgresql/pg_hba.conf")
+	if err != nil {
+		t.Errorf("expected earlier success to be kept, got %v", err)
+	}
+	err = coordinator.wait(ctx, "db01", "/etc/hosts")
+	if err == nil || err.Error() != "host db01 failed" {
+		t.Errorf("expected host failure, got %v", err)
+	}
+
+	// Stopped deployments do not wait
+	coordinator.Watch("web01", "db02", "/etc/hosts", "db02/etc/hosts")
+	stopCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	err = coordinator.wait(stopCtx, "db02", "/etc/hosts")
+	if err == nil || !strings.Contains(err.Error(), "immediate stop requested") {
+		t.Errorf("expected stop error, got %v", err)
+	}
+
+	// Deployments without cross-host dependencies have no coordinator
+	var noCoordinator *CrossHostCoordinator
+	err = noCoordinator.wait(ctx, "db01", "/etc/hosts")
+	if err != nil {
+		t.Errorf("unexpected error without coordinator: %v", err)
+	}
+	noCoordinator.HostFinished("db01", nil)
+}
+
+func TestDeployCrossHostOrder(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	tests := []struct {
+		name         string
+		dependencyOK bool
+	}{
+		{"dependency deployed", true},
+		{"dependency failed", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			coordinator := NewCrossHostCoordinator()
+			coordinator.Watch("web01", "db01", "/etc/postgresql/pg_hba.conf", "db01/etc/postgresql/pg_hba.conf")
+
+			deployMetrics := metrics.New()
+			var wg sync.WaitGroup
+			connLimiter := make(chan struct{}, 1) // Single slot would deadlock if web01 took it while waiting on db01
+
+			var dependentResult error
+			var startOrder []str.RepoRootDir
+			var orderMutex sync.Mutex
+
+			// Dependent host is launched first
+			for _, endpointName := range []str.RepoRootDir{"web01", "db01"} {
+				hostFiles, err := deployment.NewHostFiles()
+				if err != nil {
+					t.Fatalf("unexpected hostfiles create failure: %v", err)
+				}
+
+				deployer := New(&wg, connLimiter, config.EndpointInfo{EndpointName: endpointName}, nil, deployMetrics, 1, nil)
+				deployer.SetCrossHostCoordinator(coordinator)
+				deployer.hostDeploy = func(ctx context.Context, deployFiles *deployment.HostFiles) {
+					orderMutex.Lock()
+					startOrder = append(startOrder, endpointName)
+					orderMutex.Unlock()
+
+					group := newGroupDeployer(deployer)
+					if endpointName == "web01" {
+						dependentResult = group.waitForHostDependencies(ctx, deployment.FileInfo{
+							Dependencies: []str.LocalRepoPath{"db01:/etc/postgresql/pg_hba.conf"},
+						})
+						return
+					}
+					var fileErr error
+					if !test.dependencyOK {
+						fileErr = fmt.Errorf("reload failed")
+					}
+					coordinator.fileFinished("db01", "db01/etc/postgresql/pg_hba.conf", fileErr)
+				}
+
+				wg.Add(1)
+				go deployer.Deploy(ctx, hostFiles)
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("deployment deadlocked on cross-host dependency")
+			}
+			deployMetrics.Stop()
+
+			if len(startOrder) != 2 || startOrder[0] != "db01" {
+				t.Errorf("expected db01 to start first, got %v", startOrder)
+			}
+			if test.dependencyOK && dependentResult != nil {
+				t.Errorf("unexpected dependency failure: %v", dependentResult)
+			}
+			if !test.dependencyOK && (dependentResult == nil || !strings.Contains(dependentResult.Error(), "dependency failed")) {
+				t.Errorf("expected dependency failure, got %v", dependentResult)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"scmp/core/deployment"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Sets when in-flight work of this host is cut off because the deployment deadline is reached
+// The deployment context given to Deploy is expected to stop new work shortly before this time
+func (deployer *Deployer) SetRunDeadline(cutoff time.Time) {
+	deployer.runCutoff = cutoff
+}
+
+// Sets the context whose end force aborts in-flight work of this host (second interrupt of the deployment)
+func (deployer *Deployer) SetAbort(abortCtx context.Context) {
+	deployer.abortCtx = abortCtx
+}
+
+// Applies the host deadline to ctx and arms the cut off of in-flight work at the earliest of the host and deployment deadlines
+// New files stop starting a grace period before the host deadline, then the SSH connection is closed so stuck commands end
+func (deployer *Deployer) startDeadlines(ctx context.Context) (hostCtx context.Context, stop func()) {
+	hostCtx = ctx
+	cancelHost := func() {}
+	cutoff := deployer.runCutoff
+
+	if deployer.host.HostDeadline > 0 {
+		hostCutoff := time.Now().Add(deployer.host.HostDeadline)
+		stopStarting := hostCutoff.Add(-deployment.DeadlineGrace(deployer.host.HostDeadline))
+
+		var cancel context.CancelFunc
+		hostCtx, cancel = context.WithDeadlineCause(ctx, stopStarting, deployment.ErrDeadlineExceeded)
+		cancelHost = func() { cancel() }
+
+		if cutoff.IsZero() || hostCutoff.Before(cutoff) {
+			cutoff = hostCutoff
+		}
+	}
+
+	stopCutoff := func() bool { return false }
+	if !cutoff.IsZero() {
+		timer := time.AfterFunc(time.Until(cutoff), deployer.cutOff)
+		stopCutoff = timer.Stop
+	}
+
+	stop = func() {
+		stopCutoff()
+		cancelHost()
+	}
+	return
+}
+
+// Closes the host connection, failing any in-flight commands and transfers
+func (deployer *Deployer) cutOff() {
+	deployer.cutoffMutex.Lock()
+	defer deployer.cutoffMutex.Unlock()
+
+	deployer.cutoffReached = true
+	if deployer.state.SSHClient != nil {
+		_ = deployer.state.SSHClient.Close()
+	}
+}
+
+// Closes the host connection after a forced abort, failing any in-flight commands and transfers
+func (deployer *Deployer) abort() {
+	deployer.cutoffMutex.Lock()
+	defer deployer.cutoffMutex.Unlock()
+
+	deployer.aborted = true
+	if deployer.state.SSHClient != nil {
+		_ = deployer.state.SSHClient.Close()
+	}
+}
+
+// Stores the connected client unless the host was already cut off or aborted (client is closed instead)
+func (deployer *Deployer) setClient(client *ssh.Client) (cutOff bool) {
+	deployer.cutoffMutex.Lock()
+	defer deployer.cutoffMutex.Unlock()
+
+	if deployer.cutoffReached || deployer.aborted {
+		_ = client.Close()
+		cutOff = true
+		return
+	}
+	deployer.state.SSHClient = client
+	return
+}
+
+// True when a deadline stopped or cut off work for this host
+func (deployer *Deployer) deadlineReached(hostCtx context.Context) (reached bool) {
+	deployer.cutoffMutex.Lock()
+	reached = deployer.cutoffReached
+	deployer.cutoffMutex.Unlock()
+
+	if errors.Is(context.Cause(hostCtx), deployment.ErrDeadlineExceeded) {
+		reached = true
+	}
+	return
+}
@@ -3,37 +3,119 @@ package host
 import (
 	"context"
 	"fmt"
+	"runtime/debug"
 	"scmp/core/deployment"
+	"scmp/core/deployment/events"
+	"scmp/core/deployment/metrics"
 	"scmp/core/deployment/predeploy"
+	"scmp/core/deployment/snapshot"
+	"scmp/internal/config"
+	"scmp/internal/global"
 	"scmp/internal/logctx"
 	"scmp/internal/sshinternal"
-
-	"golang.org/x/crypto/ssh"
+	"scmp/internal/str"
+	"time"
 )
 
-// SSH's into a remote host to deploy files and run reload commands
+// Runs deployment to a single host isolated from all other hosts
+// Panics are recovered and recorded as a failure for this host only
 func (deployer *Deployer) Deploy(ctx context.Context, deployFiles *deployment.HostFiles) {
 	// Signal routine is done after return
 	defer deployer.allHostWG.Done()
 
+	var totalFiles int
+	for _, group := range deployFiles.Groups {
+		totalFiles += len(group.GetOrderedList())
+	}
+	deployer.metrics.StartHostProgress(deployer.host.EndpointName, totalFiles)
+	defer deployer.metrics.FinishHost(deployer.host.EndpointName)
+	defer deployer.metrics.FinishHostProgress(deployer.host.EndpointName)
+	defer deployer.crossHost.HostFinished(deployer.host.EndpointName, fmt.Errorf("host %s finished without deploying it", deployer.host.EndpointName))
+
+	// Hosts this host depends on take their connection slots first
+	deployer.crossHost.waitForDependencyHosts(ctx, deployer.host.EndpointName)
+
 	deployer.connLimiter <- struct{}{}
 	defer func() { <-deployer.connLimiter }()
+	deployer.crossHost.hostStarted(deployer.host.EndpointName)
+
+	// Hosts still waiting for a connection slot when deployment is stopped are never started
+	if ctx.Err() != nil {
+		deployer.recordNotStarted(ctx, deployFiles)
+		return
+	}
+	deployer.metrics.Event(events.HostStarted, deployer.host.EndpointName, "", "")
+	hostStart := time.Now()
+	defer func() { deployer.metrics.AddHostElapsed(deployer.host.EndpointName, time.Since(hostStart)) }()
+
+	ctx = logctx.AppendCtxTag(ctx, string(deployer.host.EndpointName))
+	ctx = logctx.WithHost(ctx, string(deployer.host.EndpointName))
+	ctx = WithHostOptions(ctx, deployer.host)
+	if deployer.host.RequestTTY {
+		ctx = sshinternal.WithPTY(ctx)
+	}
+
+	// Deadlines bound the total host time regardless of individual command timeouts
+	if deployer.host.HostDeadline > 0 || !deployer.runCutoff.IsZero() {
+		var stopDeadlines func()
+		ctx, stopDeadlines = deployer.startDeadlines(ctx)
+		defer func() {
+			stopDeadlines()
+			deployer.metrics.AddHostDeadline(deployer.host.EndpointName, deployer.host.HostDeadline, time.Since(hostStart), deployer.deadlineReached(ctx))
+		}()
+	}
+
+	// Forced aborts close the connection so in-flight commands and transfers end right away
+	if deployer.abortCtx != nil {
+		stopAbort := context.AfterFunc(deployer.abortCtx, deployer.abort)
+		defer stopAbort()
+	}
 
 	// Recover from panic
 	defer func() {
 		if fatalError := recover(); fatalError != nil {
-			logctx.LogStdFatal(ctx,
-				"Controller panic during deployment to host '%s': %v\n",
-				deployer.host.EndpointName, fatalError)
+			deployer.recordPanic(ctx, deployFiles, fatalError)
 		}
 	}()
 
-	ctx = logctx.AppendCtxTag(ctx, string(deployer.host.EndpointName))
+	deployer.hostDeploy(ctx, deployFiles)
+}
+
+// Records a host stopped before it started, interrupted deployments report it as such
+func (deployer *Deployer) recordNotStarted(ctx context.Context, deployFiles *deployment.HostFiles) {
+	if deployment.Interrupted(ctx) {
+		deployer.metrics.AddHostInterrupted(deployer.host.EndpointName, deployFiles)
+		return
+	}
+	deployer.metrics.AddHostNotAttempted(deployer.host.EndpointName, deployFiles)
+}
 
+// Records recovered panic as host failure (stack trace included at debug verbosity)
+func (deployer *Deployer) recordPanic(ctx context.Context, deployFiles *deployment.HostFiles, fatalError any) {
+	logctx.LogStdErr(ctx, "Controller panic during deployment to host '%s': %v\n", deployer.host.EndpointName, fatalError)
+
+	err := fmt.Errorf("controller panic during deployment: %v", fatalError)
+	if logctx.GetLogLevel(ctx) >= logctx.VerbosityDebug {
+		err = fmt.Errorf("%w: %s", err, debug.Stack())
+	}
+
+	if deployFiles != nil {
+		deployer.metrics.AddAllDeployFiles(deployer.host.EndpointName, deployFiles)
+	}
+	deployer.metrics.AddHostFailure(deployer.host.EndpointName, err)
+}
+
+// SSH's into a remote host to deploy files and run reload commands
+func (deployer *Deployer) deployHost(ctx context.Context, deployFiles *deployment.HostFiles) {
 	// Save meta info for this host in a structure to easily pass around required pieces
 	deployer.state.Name = deployer.host.EndpointName
-	deployer.state.Password = deployer.host.Password
+	deployer.state.Password = deployer.host.SudoPassword
+
+	// Uploads of every file to this host share one bandwidth limit
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+	deployer.state.Bandwidth = sshinternal.NewBandwidthLimiter(opts.BandwidthLimit)
 
+	deployer.metrics.SetHostActivity(deployer.state.Name, metrics.ProgressPreDeploy)
 	err := predeploy.RunPreDeploymentCommands(ctx, deployer.metrics, deployer.state.Name, deployFiles)
 	if err != nil {
 		err = fmt.Errorf("failed to run pre-deployment commands: %w", err)
@@ -44,22 +126,39 @@ func (deployer *Deployer) Deploy(ctx context.Context, deployFiles *deployment.Ho
 
 	select {
 	case <-ctx.Done():
-		err = fmt.Errorf("immediate stop requested before beginning deployment to host %s", deployer.state.Name)
-		deployer.metrics.AddAllDeployFiles(deployer.state.Name, deployFiles)
-		deployer.metrics.AddHostFailure(deployer.state.Name, err)
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog, "Immediate stop requested before beginning deployment to host %s\n", deployer.state.Name)
+		deployer.recordNotStarted(ctx, deployFiles)
 		return
 	default:
 	}
 
 	// Connect to the SSH server
-	var proxyClient *ssh.Client
-	deployer.state.SSHClient, proxyClient, err = sshinternal.ConnectToSSH(ctx, deployer.host, deployer.proxy)
+	deployer.metrics.SetHostActivity(deployer.state.Name, metrics.ProgressConnecting)
+	var proxyClient *sshinternal.ProxyLease
+	var connectedEndpoint string
+	client, proxyClient, connectedEndpoint, err := sshinternal.ConnectToSSH(ctx, deployer.host, deployer.proxy)
 	if err != nil {
 		err = fmt.Errorf("failed connect to SSH server: %w", err)
 		deployer.metrics.AddAllDeployFiles(deployer.state.Name, deployFiles)
 		deployer.metrics.AddHostFailure(deployer.state.Name, err)
 		return
 	}
+	if deployer.setClient(client) {
+		if proxyClient != nil {
+			_ = proxyClient.Close()
+		}
+		err = fmt.Errorf("deadline reached while connecting to SSH server")
+		deployer.metrics.AddAllDeployFiles(deployer.state.Name, deployFiles)
+		deployer.metrics.AddHostFailure(deployer.state.Name, err)
+		return
+	}
+
+	deployer.metrics.Event(events.HostConnected, deployer.state.Name, "", connectedEndpoint)
+
+	// Address is only worth reporting when the host has more than one
+	if len(deployer.host.FallbackEndpoints) > 0 {
+		deployer.metrics.SetHostEndpoint(deployer.state.Name, connectedEndpoint)
+	}
 	defer func() {
 		if proxyClient != nil {
 			lerr := proxyClient.Close()
@@ -73,7 +172,22 @@ func (deployer *Deployer) Deploy(ctx context.Context, deployFiles *deployment.Ho
 		}
 	}()
 
+	// Concurrent deployments to the same host must not interleave, wet-runs change nothing and do not lock
+	if !opts.WetRunEnabled {
+		deployer.metrics.SetHostActivity(deployer.state.Name, metrics.ProgressLocking)
+		var lockOwnerLine string
+		lockOwnerLine, err = acquireHostLock(ctx, deployer.state)
+		if err != nil {
+			deployer.metrics.AddAllDeployFiles(deployer.state.Name, deployFiles)
+			deployer.metrics.AddHostFailure(deployer.state.Name, err)
+			return
+		}
+		// Released on every return (including panics), also when the deployment was stopped
+		defer releaseHostLock(context.WithoutCancel(ctx), deployer.state, lockOwnerLine)
+	}
+
 	// Pre-deployment checks
+	deployer.metrics.SetHostActivity(deployer.state.Name, metrics.ProgressPreparing)
 	err = RemoteDeploymentPreparation(ctx, &deployer.state)
 	if err != nil {
 		err = fmt.Errorf("remote system preparation failed: %w", err)
@@ -83,20 +197,78 @@ func (deployer *Deployer) Deploy(ctx context.Context, deployFiles *deployment.Ho
 	}
 	defer CleanupRemote(ctx, deployer.state)
 
-	// Deploy files concurrently
-	for _, independentDeploymentList := range deployFiles.Groups {
-		group := newGroupDeployer(deployer)
-		deployer.deployWG.Add(1)
+	// Hosts that cannot take the files are stopped before any file is touched
+	if !opts.SkipPreflight {
+		deployer.metrics.SetHostActivity(deployer.state.Name, metrics.ProgressPreflight)
+		err = runPreflight(ctx, deployer.state, deployFiles)
+		if err != nil {
+			deployer.metrics.AddAllDeployFiles(deployer.state.Name, deployFiles)
+			deployer.metrics.AddHostFailure(deployer.state.Name, err)
+			return
+		}
+	}
 
-		if deployer.maxConcurrentDeploys > 1 {
-			go group.deploy(ctx, independentDeploymentList, deployFiles)
-		} else {
-			// Max conns of 1 disables using go routine
-			group.deploy(ctx, independentDeploymentList, deployFiles)
+	// Archive backups of this deployment are kept below the backup directory
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	archiveBackups := deployer.backupArchiveID != "" && usesArchiveBackups(deployFiles)
+	if archiveBackups {
+		err = prepareBackupArchive(ctx, deployer.state, str.RemotePath(cfg.BackupDirectory))
+		if err != nil {
+			deployer.metrics.AddAllDeployFiles(deployer.state.Name, deployFiles)
+			deployer.metrics.AddHostFailure(deployer.state.Name, err)
+			return
+		}
+		deployer.state.BackupArchivePath = str.RemotePath(cfg.BackupDirectory + "/" + deployer.backupArchiveID)
+	}
+
+	// Facts are needed before any file condition is evaluated
+	if opts.GatherFacts {
+		deployer.metrics.SetHostActivity(deployer.state.Name, metrics.ProgressGatheringFacts)
+		err = GatherFacts(ctx, &deployer.state)
+		if err != nil {
+			deployer.metrics.AddAllDeployFiles(deployer.state.Name, deployFiles)
+			deployer.metrics.AddHostFailure(deployer.state.Name, err)
+			return
+		}
+		deployer.host.Facts = deployer.state.Facts
+	}
+
+	// Extended attribute support is only needed when a file sets them
+	if usesXattrs(deployFiles) {
+		ProbeXattrSupport(ctx, &deployer.state)
+		deployer.host.Facts = deployer.state.Facts
+	}
+
+	// Remote state is captured before anything on the host is changed
+	takeSnapshot := deployer.snapshotID != "" && deployer.host.Snapshot
+	if takeSnapshot {
+		deployer.metrics.SetHostActivity(deployer.state.Name, metrics.ProgressSnapshot)
+		err = deployer.captureSnapshot(ctx, deployFiles, snapshot.PhasePre)
+		if err != nil {
+			deployer.metrics.AddAllDeployFiles(deployer.state.Name, deployFiles)
+			deployer.metrics.AddHostFailure(deployer.state.Name, err)
+			return
+		}
+	}
+
+	// Deploy files concurrently, one phase at a time
+	deployer.metrics.SetHostActivity(deployer.state.Name, metrics.ProgressDeploying)
+	deployer.deployPhases(ctx, deployFiles)
+
+	// Post-state is only informational, failures do not change the deployment result
+	if takeSnapshot {
+		deployer.metrics.SetHostActivity(deployer.state.Name, metrics.ProgressSnapshot)
+		lerr := deployer.captureSnapshot(ctx, deployFiles, snapshot.PhasePost)
+		if lerr != nil {
+			logctx.LogStdWarn(ctx, "Host %s: %v\n", deployer.state.Name, lerr)
+		}
+	}
 
-			// File groups are considered fully independent, errors do not stop further groups from starting deployment
-			// dependencies/reloads/reload groups are the mechanism to use to halt further file deployments
+	// Retention is only enforced once the host deployed without failures
+	if archiveBackups && ctx.Err() == nil && !deployer.metrics.HostHasError(deployer.state.Name) {
+		lerr := pruneBackupArchive(ctx, deployer.state, str.RemotePath(cfg.BackupDirectory), cfg.BackupRetention)
+		if lerr != nil {
+			logctx.LogStdWarn(ctx, "Host %s: %v\n", deployer.state.Name, lerr)
 		}
 	}
-	deployer.deployWG.Wait()
 }
@@ -0,0 +1,271 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"scmp/core/deployment"
+	"scmp/core/deployment/metrics"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeployPanicIsolation(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityDebug, ctx.Done())
+
+	hosts := []str.RepoRootDir{"host1", "host2", "host3"}
+	const panicHost str.RepoRootDir = "host2"
+
+	deployMetrics := metrics.New()
+
+	var wg sync.WaitGroup
+	connLimiter := make(chan struct{}, 1) // Single slot ensures a leaked slot would deadlock remaining hosts
+	for _, endpointName := range hosts {
+		hostFiles, err := deployment.NewHostFiles()
+		if err != nil {
+			t.Fatalf("unexpected hostfiles create failure: %v", err)
+		}
+		repoFilePath := str.LocalRepoPath(string(endpointName) + "/etc/file1.txt")
+		hostFiles.SetFileMetadata(repoFilePath, deployment.FileInfo{Action: deployment.ActionFileModify})
+		hostFiles.Groups = append(hostFiles.Groups, deployment.NewFileGroup([]str.LocalRepoPath{repoFilePath}))
+
+		deployer := New(&wg, connLimiter, config.EndpointInfo{EndpointName: endpointName}, nil, deployMetrics, 1, nil)
+
+		// Fake host deployment in place of SSH
+		deployer.hostDeploy = func(ctx context.Context, deployFiles *deployment.HostFiles) {
+			if endpointName == panicHost {
+				var malformedHeader map[string]string
+				malformedHeader["key"] = "value"
+			}
+			deployMetrics.AddFile(endpointName, deployFiles, repoFilePath)
+		}
+
+		wg.Add(1)
+		go deployer.Deploy(ctx, hostFiles)
+	}
+	wg.Wait()
+
+	deployMetrics.Stop()
+	summary := deployMetrics.CreateReport("", "")
+
+	if !deployMetrics.AnyErrorsPresent() {
+		t.Errorf("expected errors to be present after host panic")
+	}
+	if summary.Status != "Partial" {
+		t.Errorf("expected deployment status 'Partial', got '%s'", summary.Status)
+	}
+	if summary.Counters.CompletedHosts != 2 || summary.Counters.FailedHosts != 1 {
+		t.Errorf("expected 2 completed and 1 failed host, got %d and %d", summary.Counters.CompletedHosts, summary.Counters.FailedHosts)
+	}
+
+	for _, hostSummary := range summary.Hosts {
+		if hostSummary.Name != panicHost {
+			if hostSummary.Status != "Deployed" {
+				t.Errorf("host '%s': expected status 'Deployed', got '%s'", hostSummary.Name, hostSummary.Status)
+			}
+			continue
+		}
+
+		if hostSummary.Status != "Failed" {
+			t.Errorf("host '%s': expected status 'Failed', got '%s'", hostSummary.Name, hostSummary.Status)
+		}
+		if !strings.Contains(hostSummary.ErrorMsg, "controller panic during deployment") {
+			t.Errorf("host '%s': expected panic error message, got '%s'", hostSummary.Name, hostSummary.ErrorMsg)
+		}
+		if !strings.Contains(hostSummary.ErrorMsg, "goroutine") {
+			t.Errorf("host '%s': expected stack trace in error message, got '%s'", hostSummary.Name, hostSummary.ErrorMsg)
+		}
+	}
+}
+
+func TestDeployStoppedHostsNotAttempted(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	deployCtx, stopDeployment := context.WithCancel(ctx)
+	defer stopDeployment()
+
+	hosts := []str.RepoRootDir{"host1", "host2"}
+	const stoppingHost str.RepoRootDir = "host1"
+
+	deployMetrics := metrics.New()
+
+	var wg sync.WaitGroup
+	connLimiter := make(chan struct{}, 1)
+	for _, endpointName := range hosts {
+		hostFiles, err := deployment.NewHostFiles()
+		if err != nil {
+			t.Fatalf("unexpected hostfiles create failure: %v", err)
+		}
+		repoFilePath := str.LocalRepoPath(string(endpointName) + "/etc/file1.txt")
+		hostFiles.SetFileMetadata(repoFilePath, deployment.FileInfo{Action: deployment.ActionFileModify})
+		hostFiles.Groups = append(hostFiles.Groups, deployment.NewFileGroup([]str.LocalRepoPath{repoFilePath}))
+
+		deployer := New(&wg, connLimiter, config.EndpointInfo{EndpointName: endpointName}, nil, deployMetrics, 1, nil)
+
+		// First host deploys and then stops deployment (as an interrupt would)
+		deployer.hostDeploy = func(ctx context.Context, deployFiles *deployment.HostFiles) {
+			deployMetrics.AddFile(endpointName, deployFiles, repoFilePath)
+			if endpointName == stoppingHost {
+				stopDeployment()
+			}
+		}
+
+		// Sequential deployment guarantees second host starts after the stop
+		wg.Add(1)
+		deployer.Deploy(deployCtx, hostFiles)
+	}
+	wg.Wait()
+
+	deployMetrics.Stop()
+	summary := deployMetrics.CreateReport("main", "0123456789abcdef0123456789abcdef01234567")
+
+	if !deployMetrics.AnyErrorsPresent() {
+		t.Errorf("expected not attempted hosts to count as errors")
+	}
+	if summary.Status != "Partial" {
+		t.Errorf("expected deployment status 'Partial', got '%s'", summary.Status)
+	}
+	if summary.Counters.CompletedHosts != 1 || summary.Counters.NotAttemptedHosts != 1 || summary.Counters.NotAttemptedItems != 1 {
+		t.Errorf("expected 1 completed and 1 not attempted host, got counters %+v", summary.Counters)
+	}
+
+	for _, hostSummary := range summary.Hosts {
+		expectedStatus := "NotAttempted"
+		if hostSummary.Name == stoppingHost {
+			expectedStatus = "Deployed"
+		}
+		if hostSummary.Status != expectedStatus {
+			t.Errorf("host '%s': expected status '%s', got '%s'", hostSummary.Name, expectedStatus, hostSummary.Status)
+		}
+		for _, itemSummary := range hostSummary.Items {
+			if itemSummary.Status != expectedStatus || itemSummary.Action != deployment.ActionFileModify {
+				t.Errorf("host '%s': unexpected item summary '%+v'", hostSummary.Name, itemSummary)
+			}
+		}
+	}
+
+	// Summary output must be readable the same way as the failtracker file
+	summaryFilePath := filepath.Join(t.TempDir(), "summary.json")
+	err := summary.WriteJSON(t.Context(), summaryFilePath)
+	if err != nil {
+		t.Fatalf("failed writing summary: %v", err)
+	}
+	_, readSummary, err := metrics.GetFailTrackerCommit(summaryFilePath)
+	if err != nil {
+		t.Fatalf("failed reading written summary: %v", err)
+	}
+	if !reflect.DeepEqual(readSummary, summary) {
+		t.Errorf("written summary does not match\nexpected: %+v\ngot: %+v", summary, readSummary)
+	}
+}
+
+func TestDeployHostDeadlines(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	const (
+		hostDeadlineHost str.RepoRootDir = "host1" // Stops starting files at its own deadline
+		runCutoffHost    str.RepoRootDir = "host2" // Wedged until cut off by the deployment deadline
+		quickHost        str.RepoRootDir = "host3" // Finishes well within both deadlines
+	)
+	hosts := []str.RepoRootDir{hostDeadlineHost, runCutoffHost, quickHost}
+
+	deployMetrics := metrics.New()
+	deployMetrics.SetDeadline(time.Minute)
+	runCutoff := time.Now().Add(100 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	connLimiter := make(chan struct{}, len(hosts))
+	for _, endpointName := range hosts {
+		hostFiles, err := deployment.NewHostFiles()
+		if err != nil {
+			t.Fatalf("unexpected hostfiles create failure: %v", err)
+		}
+		deployedFile := str.LocalRepoPath(string(endpointName) + "/etc/file1.txt")
+		stoppedFile := str.LocalRepoPath(string(endpointName) + "/etc/file2.txt")
+		for _, repoFilePath := range []str.LocalRepoPath{deployedFile, stoppedFile} {
+			hostFiles.SetFileMetadata(repoFilePath, deployment.FileInfo{Action: deployment.ActionFileModify})
+		}
+		hostFiles.Groups = append(hostFiles.Groups, deployment.NewFileGroup([]str.LocalRepoPath{deployedFile, stoppedFile}))
+
+		endpointInfo := config.EndpointInfo{EndpointName: endpointName}
+		if endpointName == hostDeadlineHost {
+			endpointInfo.HostDeadline = 200 * time.Millisecond
+		}
+		deployer := New(&wg, connLimiter, endpointInfo, nil, deployMetrics, 1, nil)
+		if endpointName == quickHost {
+			deployer.SetRunDeadline(time.Now().Add(time.Minute))
+		} else {
+			deployer.SetRunDeadline(runCutoff)
+		}
+
+		// Fake host deployment that deploys one file, then waits on its deadline before recording the other as stopped
+		deployer.hostDeploy = func(ctx context.Context, deployFiles *deployment.HostFiles) {
+			deployMetrics.AddFile(endpointName, deployFiles, deployedFile)
+			switch endpointName {
+			case hostDeadlineHost:
+				<-ctx.Done()
+			case runCutoffHost:
+				for !deployer.deadlineReached(ctx) {
+					time.Sleep(10 * time.Millisecond)
+				}
+			case quickHost:
+				deployMetrics.AddFile(endpointName, deployFiles, stoppedFile)
+				return
+			}
+			deployMetrics.AddFile(endpointName, deployFiles, stoppedFile)
+			deployMetrics.AddFileFailure(endpointName, stoppedFile, fmt.Errorf("stopped"))
+		}
+
+		wg.Add(1)
+		go deployer.Deploy(ctx, hostFiles)
+	}
+	wg.Wait()
+
+	deployMetrics.Stop()
+	summary := deployMetrics.CreateReport("", "")
+
+	if summary.Deadline == "" {
+		t.Errorf("expected configured deployment deadline in summary")
+	}
+	if summary.Counters.FailedHosts != 2 || summary.Counters.CompletedHosts != 1 {
+		t.Errorf("expected 2 failed and 1 completed host, got counters %+v", summary.Counters)
+	}
+	for _, hostSummary := range summary.Hosts {
+		expectedStatus := "DeadlineExceeded"
+		if hostSummary.Name == quickHost {
+			expectedStatus = "Deployed"
+		}
+		if hostSummary.Status != expectedStatus {
+			t.Errorf("host '%s': expected status '%s', got '%s' (%s)", hostSummary.Name, expectedStatus, hostSummary.Status, hostSummary.ErrorMsg)
+		}
+		if hostSummary.ElapsedTime == "" {
+			t.Errorf("host '%s': expected elapsed time with deadline applied", hostSummary.Name)
+		}
+		if (hostSummary.Deadline != "") != (hostSummary.Name == hostDeadlineHost) {
+			t.Errorf("host '%s': unexpected configured host deadline '%s'", hostSummary.Name, hostSummary.Deadline)
+		}
+		if expectedStatus == "DeadlineExceeded" && !strings.Contains(hostSummary.ErrorMsg, "deadline exceeded") {
+			t.Errorf("host '%s': expected deadline error message, got '%s'", hostSummary.Name, hostSummary.ErrorMsg)
+		}
+	}
+
+	// Deadline failures are retried like any other failure
+	retryCtx := context.WithValue(ctx, global.ConfKey, config.Config{})
+	retryCtx = context.WithValue(retryCtx, global.OpsKey, config.Opts{})
+	commitFiles, hostOverride, err := summary.GetFailures(retryCtx, "")
+	if err != nil {
+		t.Fatalf("unexpected error retrieving failures: %v", err)
+	}
+	if len(commitFiles) != 2 || strings.Count(hostOverride, ",") != 1 {
+		t.Errorf("expected stopped files of 2 hosts for retry, got files %v hosts '%s'", commitFiles, hostOverride)
+	}
+}
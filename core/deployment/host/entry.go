@@ -1,24 +1,31 @@
 package host
 
 import (
+	"context"
 	"scmp/core/deployment/metrics"
 	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/str"
 	"sync"
 )
 
-func New(wg *sync.WaitGroup, connLimiter chan struct{}, endpointInfo config.EndpointInfo, proxyInfo config.EndpointInfo, metrics *metrics.Metrics, maxDeployConcurrency int) (deployer *Deployer) {
+func New(wg *sync.WaitGroup, connLimiter chan struct{}, endpointInfo config.EndpointInfo, proxyChain []config.EndpointInfo, metrics *metrics.Metrics, maxDeployConcurrency int, reloadCoordinator *ReloadCoordinator) (deployer *Deployer) {
 	deployer = &Deployer{
 		allHostWG:   wg,
 		connLimiter: connLimiter,
 		host:        endpointInfo,
-		proxy:       proxyInfo,
+		proxy:       proxyChain,
 
 		metrics: metrics,
 
 		deployWG:             &sync.WaitGroup{},
 		deployLimiter:        make(chan struct{}, maxDeployConcurrency),
 		maxConcurrentDeploys: maxDeployConcurrency,
+
+		reloadCoordinator: reloadCoordinator,
 	}
+	deployer.hostDeploy = deployer.deployHost
+	deployer.fileDeploy = (*fileGroup).deployFile
 	return
 }
 
@@ -28,6 +35,29 @@ func newGroupDeployer(hostDeployer *Deployer) (group *fileGroup) {
 		deployLimiter: hostDeployer.deployLimiter,
 		hostState:     hostDeployer.state,
 		metrics:       hostDeployer.metrics,
+		stateCache:    hostDeployer.stateCache,
+
+		reloadCoordinator: hostDeployer.reloadCoordinator,
+		crossHost:         hostDeployer.crossHost,
+
+		fileDeploy: hostDeployer.fileDeploy,
+	}
+	return
+}
+
+func NewReloadCoordinator() (coordinator *ReloadCoordinator) {
+	coordinator = &ReloadCoordinator{
+		slots: make(map[str.ReloadID]chan struct{}),
+	}
+	return
+}
+
+// Replaces the options in ctx with the options configured for a single host or its groups
+func WithHostOptions(ctx context.Context, hostInfo config.EndpointInfo) (hostCtx context.Context) {
+	hostCtx = ctx
+	opts, optsPresent := ctx.Value(global.OpsKey).(config.Opts)
+	if optsPresent {
+		hostCtx = context.WithValue(ctx, global.OpsKey, hostInfo.Overrides.Apply(opts))
 	}
 	return
 }
@@ -0,0 +1,89 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/logctx"
+	"scmp/internal/sshinternal"
+	"strings"
+)
+
+// Gathers remote system facts used by file conditions and fact macros
+func GatherFacts(ctx context.Context, host *sshinternal.HostMeta) (err error) {
+	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Gathering remote system facts\n")
+
+	command := sshinternal.BuildFactsGather()
+	output, err := command.SSHexec(ctx, host.SSHClient, host.Password)
+	if err != nil {
+		err = fmt.Errorf("failed to gather remote system facts: %w", err)
+		return
+	}
+
+	host.Facts, err = parseFacts(output)
+	if err != nil {
+		return
+	}
+
+	logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog,
+		"Remote facts: os_id=%s os_version=%s kernel=%s kernel_release=%s arch=%s\n",
+		host.Facts.OSID, host.Facts.OSVersion, host.Facts.Kernel, host.Facts.KernelRelease, host.Facts.Arch)
+	return
+}
+
+// Records whether the remote extended attribute tools are installed
+// Filesystems without xattr support are only found per file when attributes are set
+func ProbeXattrSupport(ctx context.Context, host *sshinternal.HostMeta) {
+	command := sshinternal.BuildXattrToolsCheck()
+	_, err := command.SSHexec(ctx, host.SSHClient, host.Password)
+	host.Facts.Xattrs = err == nil
+
+	logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Remote facts: xattrs=%t\n", host.Facts.Xattrs)
+}
+
+// Parses uname lines followed by optional os-release content
+func parseFacts(output string) (facts config.HostFacts, err error) {
+	lines := strings.Split(strings.ReplaceAll(output, "\r", ""), "\n")
+	if len(lines) < 3 {
+		err = fmt.Errorf("unexpected remote facts output: %q", output)
+		return
+	}
+	facts.Kernel = strings.TrimSpace(lines[0])
+	facts.KernelRelease = strings.TrimSpace(lines[1])
+	facts.Arch = strings.TrimSpace(lines[2])
+
+	for _, line := range lines[3:] {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if !found {
+			continue
+		}
+		value = strings.Trim(value, `"'`)
+		switch key {
+		case "ID":
+			facts.OSID = value
+		case "VERSION_ID":
+			facts.OSVersion = value
+		}
+	}
+
+	// Systems without os-release (older BSDs) are identified by their kernel
+	if facts.OSID == "" {
+		facts.OSID = strings.ToLower(facts.Kernel)
+	}
+	if facts.OSVersion == "" {
+		facts.OSVersion = facts.KernelRelease
+	}
+	return
+}
+
+// Reports whether any file of the host sets extended attributes
+func usesXattrs(deployFiles *deployment.HostFiles) (used bool) {
+	for _, repoFilePath := range deployFiles.GetUnorderedList() {
+		if len(deployFiles.GetFileInfo(repoFilePath).Xattrs) > 0 {
+			used = true
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,42 @@
+package host
+
+import (
+	"scmp/internal/config"
+	"testing"
+)
+
+func TestParseFacts(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected config.HostFacts
+	}{
+		{
+			name:     "debian",
+			output:   "Linux\n6.1.0-18-amd64\nx86_64\nPRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\nNAME=\"Debian GNU/Linux\"\nVERSION_ID=\"12\"\nID=debian\n",
+			expected: config.HostFacts{Kernel: "Linux", KernelRelease: "6.1.0-18-amd64", Arch: "x86_64", OSID: "debian", OSVersion: "12"},
+		},
+		{
+			name:     "no os-release",
+			output:   "OpenBSD\n7.4\namd64\n",
+			expected: config.HostFacts{Kernel: "OpenBSD", KernelRelease: "7.4", Arch: "amd64", OSID: "openbsd", OSVersion: "7.4"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			facts, err := parseFacts(test.output)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if facts != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, facts)
+			}
+		})
+	}
+
+	_, err := parseFacts("Linux")
+	if err == nil {
+		t.Errorf("expected error for truncated output")
+	}
+}
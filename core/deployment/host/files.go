@@ -2,131 +2,372 @@ package host
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"runtime/debug"
 	"scmp/core/deployment"
 	"scmp/core/deployment/actions"
+	"scmp/core/deployment/events"
+	"scmp/core/deployment/metrics"
+	"scmp/internal/config"
+	"scmp/internal/global"
 	"scmp/internal/logctx"
 	"scmp/internal/sshinternal"
 	"scmp/internal/str"
+	"time"
 )
 
 func (group *fileGroup) deploy(ctx context.Context, deploymentList *deployment.FileGroup, deployFiles *deployment.HostFiles) {
 	defer group.deployWG.Done()
 
+	// Files wait from here until they start (deploy slots, earlier files of the group)
+	queuedAt := time.Now()
+
 	group.deployLimiter <- struct{}{}
 	defer func() { <-group.deployLimiter }()
 
-	// Recover from panic
+	// Recover from panic - files in this group are failed, other groups continue
 	defer func() {
 		fatalError := recover()
 		if fatalError != nil {
-			logctx.LogStdFatal(ctx,
+			logctx.LogStdErr(ctx,
 				"Controller panic during group file deployment to host '%s': %v\n",
 				group.hostState.Name, fatalError)
+
+			err := fmt.Errorf("controller panic during file deployment: %v", fatalError)
+			if logctx.GetLogLevel(ctx) >= logctx.VerbosityDebug {
+				err = fmt.Errorf("%w: %s", err, debug.Stack())
+			}
+			for _, repoFilePath := range deploymentList.GetOrderedList() {
+				group.recordFailure(ctx, repoFilePath, deployFiles, err)
+			}
 		}
 	}()
 
 	reloadState := NewReloadTracker(deploymentList, deployFiles, group.hostState.Name)
 
-	// Loop through target files and deploy
-	for _, repoFilePath := range deploymentList.GetOrderedList() {
-		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Starting deployment for '%s'\n", repoFilePath)
-		info := deployFiles.GetFileInfo(repoFilePath)
-
-		skipReason := group.fileCanDeploy(ctx, info)
-		if skipReason != nil {
-			group.recordFailure(ctx, repoFilePath, deployFiles, skipReason)
-			continue
-		}
+	// Started files (and restores of their reload groups) are not cut short by an interrupt, only by deadlines or an abort
+	workCtx, stopWork := deployment.ContinueOnInterrupt(ctx)
+	defer stopWork()
 
-		select {
-		case <-ctx.Done():
+	// Independent files (different reload groups, no dependency between them) deploy concurrently
+	schedule := newFileSchedule(deploymentList, deployFiles)
+	group.runSchedule(ctx, schedule,
+		func(repoFilePath str.LocalRepoPath) {
+			group.metrics.AddFileTiming(group.hostState.Name, repoFilePath, metrics.FileTiming{QueueWait: time.Since(queuedAt)})
+			group.fileDeploy(group, workCtx, reloadState, repoFilePath, deployFiles)
+			group.metrics.AddHostFileDone(group.hostState.Name)
+			group.phase.fileFinished(group.metrics.HostFileHasError(group.hostState.Name, repoFilePath) != nil)
+		},
+		func(repoFilePath str.LocalRepoPath) {
 			err := fmt.Errorf("immediate stop requested before deploying file to host %s ", group.hostState.Name)
+			if errors.Is(context.Cause(ctx), deployment.ErrDeadlineExceeded) {
+				err = fmt.Errorf("deadline reached before deploying file to host %s", group.hostState.Name)
+			} else if deployment.Interrupted(ctx) {
+				err = fmt.Errorf("%w before deploying file to host %s", deployment.ErrInterrupted, group.hostState.Name)
+			} else if ctx.Err() == nil {
+				err = fmt.Errorf("phase '%s' stopped by a failed file before deploying file to host %s", group.phase.name, group.hostState.Name)
+			}
 			group.recordFailure(ctx, repoFilePath, deployFiles, err)
-			return
-		default:
-		}
+		},
+	)
 
-		err := actions.RunInstallationCommands(ctx, group.hostState, info)
-		if err != nil {
-			group.recordFailure(ctx, repoFilePath, deployFiles, err)
-			continue
-		}
+	// Final check for any failed reload groups that did not get restored during deployment
+	for _, reloadID := range reloadState.GetFailedReloadGroups() {
+		reloadState.RestoreReloadGroup(workCtx, group, reloadID)
+	}
 
-		err = actions.RunPreApplyCommands(ctx, group.hostState, info)
-		if err != nil {
-			group.recordFailure(ctx, repoFilePath, deployFiles, err)
-			continue
-		}
+	// Results are final once reloads (and restores) of the group are done
+	for _, repoFilePath := range deploymentList.GetOrderedList() {
+		group.crossHost.fileFinished(group.hostState.Name, repoFilePath, group.metrics.HostFileHasError(group.hostState.Name, repoFilePath))
+	}
+}
 
-		// Deploy the file
-		remoteModified, remoteMetadata, transferredBytes, err := group.applyFile(ctx, info, deployFiles)
-		if err != nil {
+// Runs all deployment steps for a single file, including the reload of its group when it is the last file in the group
+func (group *fileGroup) deployFile(ctx context.Context, reloadState *reloadTracker, repoFilePath str.LocalRepoPath, deployFiles *deployment.HostFiles) {
+	ctx = logctx.WithFile(ctx, string(repoFilePath))
+
+	// Time of the file is recorded whatever its outcome
+	timer := metrics.StartFileTimer()
+	defer func() {
+		group.metrics.AddFileTiming(group.hostState.Name, repoFilePath, timer.Finish())
+	}()
+
+	// Recover from panic - only this file is failed, other files continue
+	defer func() {
+		fatalError := recover()
+		if fatalError != nil {
+			logctx.LogStdErr(ctx,
+				"Controller panic during file deployment to host '%s': %v\n",
+				group.hostState.Name, fatalError)
+
+			err := fmt.Errorf("controller panic during file deployment: %v", fatalError)
+			if logctx.GetLogLevel(ctx) >= logctx.VerbosityDebug {
+				err = fmt.Errorf("%w: %s", err, debug.Stack())
+			}
 			group.recordFailure(ctx, repoFilePath, deployFiles, err)
 			reloadID, hasGroup := reloadState.fileGroup.GetFileReloadID(repoFilePath)
 			if hasGroup {
 				reloadState.RecordReloadGroupFailed(reloadID)
 			}
-			continue
 		}
-		if remoteMetadata != (sshinternal.RemoteFileInfo{}) {
-			reloadState.AddRemoteMetadata(info.RepoFilePath, remoteMetadata)
+	}()
+
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Starting deployment for '%s'\n", repoFilePath)
+	info := deployFiles.GetFileInfo(repoFilePath)
+
+	// Files not meant for this host still count towards their reload group (like unchanged files)
+	conditionMatched, err := deployment.EvaluateCondition(info.Condition, group.hostState.Facts)
+	if err != nil {
+		group.recordFailure(ctx, repoFilePath, deployFiles, fmt.Errorf("invalid file condition: %w", err))
+		return
+	}
+	if !conditionMatched {
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
+			"Skipping file '%s', condition '%s' is false for this host\n", repoFilePath, info.Condition)
+		group.metrics.AddFileSkipped(group.hostState.Name, deployFiles, repoFilePath, metrics.SkippedCondition)
+		clearedToReload, reloadGroup := reloadState.CheckForReload(ctx, repoFilePath, false)
+		if clearedToReload {
+			group.runReloads(ctx, reloadState, repoFilePath, deployFiles, reloadGroup)
 		}
+		return
+	}
+
+	skipReason := group.fileCanDeploy(ctx, info)
+	if skipReason == nil {
+		// Holds this file (and so its reload group) until files on other hosts it depends on are done
+		timer.Stage(metrics.StageQueued)
+		skipReason = group.waitForHostDependencies(ctx, info)
+		timer.Stage(metrics.StageCommands)
+	}
+	if skipReason != nil {
+		group.recordFailure(ctx, repoFilePath, deployFiles, skipReason)
+		return
+	}
 
-		err = actions.RunPostApplyCommands(ctx, group.hostState, info)
+	// Unchanged since the last deployment per the state cache, no remote command needed
+	if group.cachedUnchanged(ctx, info) {
+		group.metrics.Event(events.FileUnchanged, group.hostState.Name, repoFilePath, "state cache")
+		clearedToReload, reloadGroup := reloadState.CheckForReload(ctx, repoFilePath, false)
+		if clearedToReload {
+			group.runReloads(ctx, reloadState, repoFilePath, deployFiles, reloadGroup)
+		}
+		return
+	}
+
+	err = actions.RunInstallationCommands(ctx, group.hostState, info)
+	if err != nil {
+		group.recordFailure(ctx, repoFilePath, deployFiles, err)
+		return
+	}
+
+	err = actions.RunPreChecks(ctx, group.hostState, info)
+	if err != nil {
+		group.recordFailure(ctx, repoFilePath, deployFiles, fmt.Errorf("pre-check failed: %w", err))
+		return
+	}
+
+	err = actions.RunPreApplyCommands(ctx, group.hostState, info)
+	if err != nil {
+		group.recordFailure(ctx, repoFilePath, deployFiles, err)
+		return
+	}
+
+	// Wet-run outcomes depend on whether the target is already present
+	var remoteExisted bool
+	if opts.WetRunEnabled && info.Action != deployment.ActionAccountsApply {
+		remoteExisted, _, err = sshinternal.CheckRemoteFileDirExistence(ctx, group.hostState, info.TargetFilePath)
 		if err != nil {
-			group.recordFailure(ctx, repoFilePath, deployFiles, err)
-			reloadID, hasGroup := reloadState.fileGroup.GetFileReloadID(repoFilePath)
-			if hasGroup {
-				reloadState.RecordReloadGroupFailed(reloadID)
-			}
-			continue
+			group.recordFailure(ctx, repoFilePath, deployFiles, fmt.Errorf("failed checking presence on remote host: %w", err))
+			return
+		}
+	}
+
+	// Deploy the file
+	group.metrics.SetHostActivity(group.hostState.Name, metrics.ProgressTransferring+string(info.TargetFilePath))
+	group.metrics.StartHostTransfer(group.hostState.Name)
+	timer.Stage(metrics.StageTransfer)
+	remoteModified, remoteMetadata, transferredBytes, err := group.applyFile(ctx, info, deployFiles)
+	timer.Stage(metrics.StageCommands)
+	group.metrics.FinishHostTransfer(group.hostState.Name)
+	if err != nil {
+		group.recordFailure(ctx, repoFilePath, deployFiles, err)
+		reloadID, hasGroup := reloadState.fileGroup.GetFileReloadID(repoFilePath)
+		if hasGroup {
+			reloadState.RecordReloadGroupFailed(reloadID)
 		}
+		return
+	}
+	if remoteMetadata != (sshinternal.RemoteFileInfo{}) {
+		reloadState.AddRemoteMetadata(info.RepoFilePath, remoteMetadata)
+	}
 
-		// Increment byte counter post-success-file-transfer
-		group.metrics.AddHostBytes(group.hostState.Name, transferredBytes)
+	// Backups kept on the remote host are reported with the file
+	fileBackedUp := info.Action == deployment.ActionFileCreate || info.Action == deployment.ActionFileModify
+	if fileBackedUp && remoteModified && remoteMetadata.Exists && !opts.WetRunEnabled && !actions.MetadataOnlyChange(info, remoteMetadata) {
+		cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+		backupPath := actions.PersistentBackupPath(group.hostState, info, cfg.BackupSuffix)
+		if backupPath != "" {
+			group.metrics.AddFileBackup(group.hostState.Name, repoFilePath, backupPath)
+		}
+	}
 
-		// Handle reloads
-		clearedToReload, reloadGroup := reloadState.CheckForReload(ctx, repoFilePath, remoteModified)
-		if clearedToReload {
-			err = reloadState.RunReload(ctx, group, reloadGroup)
-			if err != nil {
-				logctx.LogEvent(ctx, logctx.VerbosityData, logctx.ErrorLog, "Reload Group %s: %w", reloadGroup, err)
-				group.metrics.AddFile(group.hostState.Name, deployFiles, repoFilePath)
-				group.metrics.AddFileFailure(group.hostState.Name, repoFilePath, err)
-
-				err = reloadState.RollbackReload(ctx, group, reloadGroup)
-				if err != nil {
-					logctx.LogEvent(ctx, logctx.VerbosityData, logctx.ErrorLog, "Reload Group %s Rollback: %w", reloadGroup, err)
-				}
-				continue
-			}
+	err = actions.RunPostApplyCommands(ctx, group.hostState, info)
+	if err != nil {
+		group.recordFailure(ctx, repoFilePath, deployFiles, err)
+		reloadID, hasGroup := reloadState.fileGroup.GetFileReloadID(repoFilePath)
+		if hasGroup {
+			reloadState.RecordReloadGroupFailed(reloadID)
+		}
+		return
+	}
+
+	// Validate the placed file before its reload group fires (wet-runs can only validate files already up-to-date)
+	if opts.WetRunEnabled && remoteModified {
+		if len(info.PostChecks) > 0 {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
+				"Wet-run: skipping post-checks of '%s', new content is not on the remote\n", repoFilePath)
+		}
+		info.PostChecks = nil
+	}
+	if len(info.PostChecks) > 0 {
+		group.metrics.SetHostActivity(group.hostState.Name, metrics.ProgressChecking+string(info.TargetFilePath))
+	}
+	err = actions.RunPostChecks(ctx, group.hostState, info)
+	if err != nil {
+		group.recordFailure(ctx, repoFilePath, deployFiles, fmt.Errorf("post-check failed: %w", err))
+		reloadID, hasGroup := reloadState.fileGroup.GetFileReloadID(repoFilePath)
+		if hasGroup {
+			reloadState.RecordReloadGroupFailed(reloadID)
+		} else {
+			reloadState.RestoreFile(ctx, group, repoFilePath)
+		}
+		return
+	}
+
+	// Increment byte counter post-success-file-transfer
+	group.metrics.AddHostBytes(group.hostState.Name, transferredBytes)
+	timer.AddBytes(transferredBytes)
+
+	// Handle reloads
+	clearedToReload, reloadGroup := reloadState.CheckForReload(ctx, repoFilePath, remoteModified)
+	if clearedToReload {
+		reloaded := group.runReloads(ctx, reloadState, repoFilePath, deployFiles, reloadGroup)
+		if !reloaded {
+			group.updateStateCache(ctx, info, true)
+			return
+		}
+	}
+
+	// Header-only changes are reported apart from files with new content
+	if remoteModified && actions.MetadataOnlyChange(info, remoteMetadata) {
+		group.metrics.AddFileMetadataOnly(group.hostState.Name, repoFilePath)
+	}
 
-			err = reloadState.RunPostInstall(ctx, group, reloadGroup)
-			if err != nil {
-				logctx.LogEvent(ctx, logctx.VerbosityData, logctx.ErrorLog, "Post-Install Group %s: %w", reloadGroup, err)
-				group.metrics.AddFile(group.hostState.Name, deployFiles, repoFilePath)
-				group.metrics.AddFileFailure(group.hostState.Name, repoFilePath, err)
+	// Increment metric for modification
+	if opts.WetRunEnabled {
+		group.metrics.AddFileWetRun(group.hostState.Name, deployFiles, repoFilePath, wetRunOutcome(info, remoteExisted, remoteModified))
+	} else if remoteModified {
+		group.metrics.AddFile(group.hostState.Name, deployFiles, repoFilePath)
+		group.metrics.Event(events.FileDeployed, group.hostState.Name, repoFilePath, "")
+	} else {
+		group.metrics.Event(events.FileUnchanged, group.hostState.Name, repoFilePath, "")
+	}
+	group.updateStateCache(ctx, info, false)
+}
+
+// What applying the file would do, from the remote state found before the wet-run
+func wetRunOutcome(info deployment.FileInfo, remoteExisted bool, remoteModified bool) (outcome string) {
+	switch info.Action {
+	case deployment.ActionDirDelete, deployment.ActionFileDelete, deployment.ActionSymLinkDelete:
+		outcome = metrics.WetRunUnchanged
+		if remoteExisted {
+			outcome = metrics.WetRunDelete
+		}
+		return
+	}
+
+	if !remoteModified {
+		outcome = metrics.WetRunUnchanged
+	} else if !remoteExisted {
+		outcome = metrics.WetRunCreate
+	} else {
+		outcome = metrics.WetRunModify
+	}
+	return
+}
+
+// Runs reload and post-install commands for a fully deployed reload group (failures are recorded against the triggering file)
+// Groups with a host limit wait for a free slot so only that many hosts reload the group at the same time
+func (group *fileGroup) runReloads(ctx context.Context, reloadState *reloadTracker, repoFilePath str.LocalRepoPath, deployFiles *deployment.HostFiles, reloadGroup str.ReloadID) (reloaded bool) {
+	maxHosts := reloadState.maxReloadHosts(reloadGroup)
+	if maxHosts > 0 {
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
+			"Reload group %s is limited to %d host(s) at once, waiting for a free slot\n", reloadGroup, maxHosts)
+	}
+	release, err := group.reloadCoordinator.acquire(ctx, reloadGroup, maxHosts)
+	if err != nil {
+		// Files are restored without reloads so the host keeps running its previous config
+		group.recordFailure(ctx, repoFilePath, deployFiles, err)
+		reloadState.RecordReloadGroupFailed(reloadGroup)
+		return
+	}
+	defer release()
+
+	group.metrics.SetHostActivity(group.hostState.Name, metrics.ProgressReloading+string(reloadGroup))
+	err = reloadState.RunReload(ctx, group, reloadGroup)
+	if err != nil {
+		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.ErrorLog, "Reload Group %s: %w", reloadGroup, err)
+		group.metrics.Event(events.ReloadFailed, group.hostState.Name, repoFilePath, fmt.Sprintf("reload group %s: %v", reloadGroup, err))
+		group.metrics.AddFile(group.hostState.Name, deployFiles, repoFilePath)
+		group.metrics.AddFileFailure(group.hostState.Name, repoFilePath, err)
+
+		err = reloadState.RollbackReload(ctx, group, reloadGroup)
+		if err != nil {
+			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.ErrorLog, "Reload Group %s Rollback: %w", reloadGroup, err)
+		}
+		return
+	}
+
+	// Reloaded service failing its checks puts every file of the group back and reloads again
+	err = reloadState.VerifyReload(ctx, group, reloadGroup)
+	if err != nil {
+		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.ErrorLog, "Reload Group %s: %w", reloadGroup, err)
+		group.metrics.Event(events.ReloadRolledBack, group.hostState.Name, repoFilePath, fmt.Sprintf("reload group %s: %v", reloadGroup, err))
+		rollbackErr := fmt.Errorf("%w: %w", deployment.ErrReloadRolledBack, err)
+		for _, groupFile := range reloadState.fileGroup.GetReloadIDFiles(reloadGroup) {
+			if group.metrics.HostFileSkipped(group.hostState.Name, groupFile) {
 				continue
 			}
+			group.metrics.AddFile(group.hostState.Name, deployFiles, groupFile)
+			group.metrics.AddFileFailure(group.hostState.Name, groupFile, rollbackErr)
 		}
 
-		// Increment metric for modification
-		if remoteModified {
-			group.metrics.AddFile(group.hostState.Name, deployFiles, repoFilePath)
+		err = reloadState.RollbackReload(ctx, group, reloadGroup)
+		if err != nil {
+			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.ErrorLog, "Reload Group %s Rollback: %w", reloadGroup, err)
 		}
+		return
 	}
 
-	// Final check for any failed reload groups that did not get restored in the loop
-	for _, reloadID := range reloadState.GetFailedReloadGroups() {
-		reloadState.RestoreReloadGroup(ctx, group, reloadID)
+	err = reloadState.RunPostInstall(ctx, group, reloadGroup)
+	if err != nil {
+		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.ErrorLog, "Post-Install Group %s: %w", reloadGroup, err)
+		group.metrics.AddFile(group.hostState.Name, deployFiles, repoFilePath)
+		group.metrics.AddFileFailure(group.hostState.Name, repoFilePath, err)
+		return
 	}
+	reloaded = true
+	return
 }
 
 func (group *fileGroup) recordFailure(ctx context.Context, repoFilePath str.LocalRepoPath, deployFiles *deployment.HostFiles, err error) {
 	logctx.LogEvent(ctx, logctx.VerbosityData, logctx.ErrorLog, "File '%s': %w\n", repoFilePath, err)
 	group.metrics.AddFile(group.hostState.Name, deployFiles, repoFilePath)
 	group.metrics.AddFileFailure(group.hostState.Name, repoFilePath, err)
+	group.updateStateCache(ctx, deployFiles.GetFileInfo(repoFilePath), true)
 }
 
 // Determines if file is allowed to proceed with deployment
@@ -178,12 +419,19 @@ func (group fileGroup) applyFile(ctx context.Context,
 		}
 	case deployment.ActionFileCreate, deployment.ActionFileModify:
 		data := deployFiles.GetFileData(info.Hash)
+		stream, _ := deployFiles.GetFileStream(info.Hash)
 
-		remoteModified, transferredBytes, remoteMetadata, err = actions.DeployFile(ctx, group.hostState, info, data)
+		remoteModified, transferredBytes, remoteMetadata, err = actions.DeployFile(ctx, group.hostState, info, data, stream)
 		if err != nil {
 			err = fmt.Errorf("failed deployment of file: %w", err)
 			return
 		}
+	case deployment.ActionAccountsApply:
+		remoteModified, err = actions.DeployAccounts(ctx, group.hostState, deployFiles.GetFileData(info.Hash))
+		if err != nil {
+			err = fmt.Errorf("failed deployment of users and groups: %w", err)
+			return
+		}
 	}
 	return
 }
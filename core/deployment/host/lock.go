@@ -0,0 +1,204 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Remote lock state as reported by a lock attempt
+type hostLockStatus struct {
+	acquired   bool
+	ownerLine  string // Recorded owner (controller, user, PID, and lock time)
+	remoteTime int64  // Remote clock when the lock was found held (unix seconds)
+}
+
+// Identity of this controller process written into host locks
+func lockOwner() (owner string) {
+	controllerName, err := os.Hostname()
+	if err != nil {
+		controllerName = "unknown"
+	}
+
+	userName := os.Getenv("USER")
+	currentUser, err := user.Current()
+	if err == nil {
+		userName = currentUser.Username
+	}
+	if userName == "" {
+		userName = "unknown"
+	}
+
+	owner = "controller=" + controllerName + " user=" + userName + " pid=" + strconv.Itoa(os.Getpid())
+	return
+}
+
+// Parses the output of a lock attempt
+func parseHostLock(output string) (status hostLockStatus, err error) {
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(output, "\r", ""), "\n"), "\n")
+	switch lines[0] {
+	case "acquired":
+		if len(lines) < 2 {
+			err = fmt.Errorf("lock acquired without an owner: %q", output)
+			return
+		}
+		status.acquired = true
+		status.ownerLine = lines[1]
+	case "held":
+		if len(lines) < 2 {
+			err = fmt.Errorf("unexpected lock output: %q", output)
+			return
+		}
+		status.remoteTime, err = strconv.ParseInt(strings.TrimSpace(lines[1]), 10, 64)
+		if err != nil {
+			err = fmt.Errorf("invalid remote time in lock output: %q", output)
+			return
+		}
+		if len(lines) > 2 {
+			status.ownerLine = lines[2]
+		}
+	default:
+		err = fmt.Errorf("unexpected lock output: %q", output)
+	}
+	return
+}
+
+// When the lock was taken (false when the owner did not record it)
+func (status hostLockStatus) lockedAt() (lockTime int64, known bool) {
+	for field := range strings.FieldsSeq(status.ownerLine) {
+		value, found := strings.CutPrefix(field, "time=")
+		if !found {
+			continue
+		}
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return
+		}
+		lockTime = parsed
+		known = true
+	}
+	return
+}
+
+// Time the lock has been held by the remote clock (false when unknown)
+func (status hostLockStatus) age() (age time.Duration, known bool) {
+	lockTime, known := status.lockedAt()
+	if !known {
+		return
+	}
+	age = max(time.Duration(status.remoteTime-lockTime)*time.Second, 0)
+	return
+}
+
+// Who holds the lock and for how long
+func (status hostLockStatus) holder() (description string) {
+	if status.ownerLine == "" {
+		description = "an unknown owner (lock " + RemoteLockPath + " has no owner file)"
+		return
+	}
+
+	description = status.ownerLine
+	lockTime, known := status.lockedAt()
+	if known {
+		age, _ := status.age()
+		description = strings.TrimSpace(strings.Replace(description, "time="+strconv.FormatInt(lockTime, 10), "", 1))
+		description += fmt.Sprintf(" since %s (%s ago)", time.Unix(lockTime, 0).UTC().Format(time.RFC3339), age)
+	}
+	return
+}
+
+// Takes the deployment lock of the host, waiting for another deployment to release it up to the lock wait
+// Locks older than the stale age are broken with a warning, the returned owner line releases the lock
+func acquireHostLock(ctx context.Context, host sshinternal.HostMeta) (ownerLine string, err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Acquiring deployment lock\n")
+
+	owner := lockOwner()
+	waitUntil := time.Now().Add(time.Duration(opts.LockWait) * time.Second)
+	var waitLogged bool
+	for {
+		command := sshinternal.BuildLockAcquire(str.RemotePath(RemoteLockPath), owner)
+		command.DisableSudo = opts.DisableSudo
+
+		var output string
+		output, err = command.SSHexec(ctx, host.SSHClient, host.Password)
+		if err != nil {
+			err = fmt.Errorf("failed to acquire deployment lock: %w", err)
+			return
+		}
+
+		var status hostLockStatus
+		status, err = parseHostLock(output)
+		if err != nil {
+			err = fmt.Errorf("failed to acquire deployment lock: %w", err)
+			return
+		}
+		if status.acquired {
+			ownerLine = status.ownerLine
+			return
+		}
+
+		age, ageKnown := status.age()
+		staleAge := time.Duration(opts.LockStaleAge) * time.Second
+		if ageKnown && opts.LockStaleAge > 0 && age >= staleAge {
+			logctx.LogStdWarn(ctx, "Host %s: breaking stale deployment lock held by %s\n", host.Name, status.holder())
+
+			command = sshinternal.BuildLockRemove(str.RemotePath(RemoteLockPath), status.ownerLine)
+			command.DisableSudo = opts.DisableSudo
+			_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
+			if err != nil {
+				err = fmt.Errorf("failed to break stale deployment lock: %w", err)
+				return
+			}
+			continue
+		}
+
+		if !time.Now().Before(waitUntil) {
+			err = fmt.Errorf("host is locked by another deployment: held by %s", status.holder())
+			return
+		}
+
+		if !waitLogged {
+			logctx.LogStdInfo(ctx, "Host %s: waiting up to %ds for deployment lock held by %s\n", host.Name, opts.LockWait, status.holder())
+			waitLogged = true
+		}
+
+		timer := time.NewTimer(min(lockPollInterval, time.Until(waitUntil)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = fmt.Errorf("stopped while waiting for deployment lock held by %s", status.holder())
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Removes the deployment lock of the host if this deployment still holds it
+// Errors are non-fatal, a lock left behind is broken once it is stale
+func releaseHostLock(ctx context.Context, host sshinternal.HostMeta, ownerLine string) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Releasing deployment lock\n")
+
+	command := sshinternal.BuildLockRemove(str.RemotePath(RemoteLockPath), ownerLine)
+	command.DisableSudo = opts.DisableSudo
+	output, err := command.SSHexec(ctx, host.SSHClient, host.Password)
+	if err != nil {
+		logctx.LogStdWarn(ctx, "Host %s: failed to release deployment lock %s (it is broken once older than %ds): %v\n", host.Name, RemoteLockPath, opts.LockStaleAge, err)
+		return
+	}
+	if strings.TrimSpace(output) == "not held" {
+		logctx.LogStdWarn(ctx, "Host %s: deployment lock was taken over by another deployment before release\n", host.Name)
+	}
+}
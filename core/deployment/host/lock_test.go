@@ -0,0 +1,84 @@
+package host
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHostLock(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		expected    hostLockStatus
+		expectAge   time.Duration
+		ageKnown    bool
+		expectError bool
+	}{
+		{
+			name:     "acquired",
+			output:   "acquired\ncontroller=ops01 user=alice pid=42 time=1700000000\n",
+			expected: hostLockStatus{acquired: true, ownerLine: "controller=ops01 user=alice pid=42 time=1700000000"},
+			ageKnown: true,
+		},
+		{
+			name:      "held",
+			output:    "held\n1700000600\ncontroller=ops02 user=bob pid=7 time=1700000000\n",
+			expected:  hostLockStatus{ownerLine: "controller=ops02 user=bob pid=7 time=1700000000", remoteTime: 1700000600},
+			expectAge: 10 * time.Minute,
+			ageKnown:  true,
+		},
+		{
+			name:     "held without owner",
+			output:   "held\n1700000600\n",
+			expected: hostLockStatus{remoteTime: 1700000600},
+		},
+		{
+			name:        "unexpected output",
+			output:      "sudo: a password is required\n",
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, err := parseHostLock(test.output)
+			if test.expectError {
+				if err == nil {
+					t.Errorf("expected error, got status %+v", status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if status != test.expected {
+				t.Errorf("expected status %+v, got %+v", test.expected, status)
+			}
+			if status.acquired {
+				return
+			}
+			age, known := status.age()
+			if known != test.ageKnown || age != test.expectAge {
+				t.Errorf("expected age %s (known %t), got %s (known %t)", test.expectAge, test.ageKnown, age, known)
+			}
+		})
+	}
+}
+
+func TestHostLockHolder(t *testing.T) {
+	status := hostLockStatus{ownerLine: "controller=ops02 user=bob pid=7 time=1700000000", remoteTime: 1700000090}
+	expected := "controller=ops02 user=bob pid=7 since 2023-11-14T22:13:20Z (1m30s ago)"
+	if holder := status.holder(); holder != expected {
+		t.Errorf("expected holder '%s', got '%s'", expected, holder)
+	}
+
+	status = hostLockStatus{remoteTime: 1700000090}
+	if holder := status.holder(); !strings.Contains(holder, "unknown owner") {
+		t.Errorf("expected unknown owner, got '%s'", holder)
+	}
+
+	if owner := lockOwner(); !strings.HasPrefix(owner, "controller=") || !strings.Contains(owner, " pid=") {
+		t.Errorf("unexpected lock owner '%s'", owner)
+	}
+}
@@ -0,0 +1,127 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"scmp/core/deployment"
+	"scmp/core/deployment/metrics"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+)
+
+// Sets what a failed file stops when the host deploys in phases (empty continues)
+func (deployer *Deployer) SetPhaseAbort(policy string) {
+	deployer.phaseAbort = policy
+}
+
+// Deploys file groups one phase at a time, groups of a phase deploy concurrently
+// A failed file stops the rest of its phase for the "phase" and "host" abort policies, and all later phases for "host"
+func (deployer *Deployer) deployPhases(ctx context.Context, deployFiles *deployment.HostFiles) {
+	phaseGroups := make(map[string][]*deployment.FileGroup)
+	for _, group := range deployFiles.Groups {
+		phaseGroups[group.GetPhase()] = append(phaseGroups[group.GetPhase()], group)
+	}
+
+	// Plans entirely in the default phase deploy and report as they always have
+	_, onlyDefaultPhase := phaseGroups[deployment.PhaseConfigure]
+	reportPhases := len(phaseGroups) > 1 || !onlyDefaultPhase
+
+	var stoppingPhase string
+	for _, phaseName := range deployment.Phases {
+		groups := phaseGroups[phaseName]
+		if len(groups) == 0 {
+			continue
+		}
+
+		var phaseFiles []str.LocalRepoPath
+		for _, group := range groups {
+			phaseFiles = append(phaseFiles, group.GetOrderedList()...)
+		}
+
+		// Host is stopped by an earlier phase, nothing of this phase is started
+		if stoppingPhase != "" {
+			err := fmt.Errorf("phase '%s' failed before phase '%s' started on host %s", stoppingPhase, phaseName, deployer.state.Name)
+			group := newGroupDeployer(deployer)
+			for _, repoFilePath := range phaseFiles {
+				group.recordFailure(ctx, repoFilePath, deployFiles, err)
+			}
+			deployer.metrics.AddHostPhase(deployer.state.Name, metrics.PhaseSummary{
+				Name:        phaseName,
+				Status:      metrics.PhaseNotStarted,
+				Items:       len(phaseFiles),
+				FailedItems: len(phaseFiles),
+			})
+			continue
+		}
+
+		if reportPhases {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Starting phase '%s' (%d file(s))\n", phaseName, len(phaseFiles))
+		}
+
+		phase := &phaseState{name: phaseName, policy: deployer.phaseAbort}
+		for _, independentDeploymentList := range groups {
+			group := newGroupDeployer(deployer)
+			group.phase = phase
+			deployer.deployWG.Add(1)
+
+			if deployer.maxConcurrentDeploys > 1 {
+				go group.deploy(ctx, independentDeploymentList, deployFiles)
+			} else {
+				// Max conns of 1 disables using go routine
+				group.deploy(ctx, independentDeploymentList, deployFiles)
+
+				// File groups are considered fully independent, errors do not stop further groups from starting deployment
+				// dependencies/reloads/reload groups are the mechanism to use to halt further file deployments
+			}
+		}
+		deployer.deployWG.Wait()
+
+		var failedFiles int
+		for _, repoFilePath := range phaseFiles {
+			if deployer.metrics.HostFileHasError(deployer.state.Name, repoFilePath) != nil {
+				failedFiles++
+			}
+		}
+		if failedFiles > 0 && deployer.phaseAbort == deployment.PhaseAbortHost {
+			stoppingPhase = phaseName
+		}
+
+		if !reportPhases {
+			continue
+		}
+		phaseSummary := metrics.PhaseSummary{
+			Name:        phaseName,
+			Status:      metrics.PhaseDeployed,
+			Items:       len(phaseFiles),
+			FailedItems: failedFiles,
+		}
+		if failedFiles > 0 {
+			phaseSummary.Status = metrics.PhaseFailed
+		}
+		deployer.metrics.AddHostPhase(deployer.state.Name, phaseSummary)
+	}
+}
+
+// Records the result of a finished file, a failure halts the phase unless the policy continues
+func (phase *phaseState) fileFinished(failed bool) {
+	if phase == nil || !failed {
+		return
+	}
+	if phase.policy != deployment.PhaseAbortHost && phase.policy != deployment.PhaseAbortPhase {
+		return
+	}
+	phase.mutex.Lock()
+	phase.halted = true
+	phase.mutex.Unlock()
+}
+
+// Reports whether files of the phase may no longer be started
+func (phase *phaseState) isHalted() (halted bool) {
+	if phase == nil {
+		return
+	}
+	phase.mutex.Lock()
+	halted = phase.halted
+	phase.mutex.Unlock()
+	return
+}
@@ -0,0 +1,122 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"scmp/core/deployment"
+	"scmp/core/deployment/metrics"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDeployPhasesAbortPolicy(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.OpsKey, config.Opts{})
+
+	const endpointName str.RepoRootDir = "host1"
+
+	// Two files per phase, the first file of the failing phase fails
+	phaseFile := func(phase string, name string) (repoFilePath str.LocalRepoPath) {
+		repoFilePath = str.LocalRepoPath(string(endpointName) + "/" + phase + "/" + name)
+		return
+	}
+
+	for _, policy := range []string{deployment.PhaseAbortHost, deployment.PhaseAbortPhase, deployment.PhaseAbortContinue} {
+		for failingIndex, failingPhase := range deployment.Phases {
+			t.Run(policy+" policy, "+failingPhase+" failure", func(t *testing.T) {
+				hostFiles, err := deployment.NewHostFiles()
+				if err != nil {
+					t.Fatalf("unexpected hostfiles create failure: %v", err)
+				}
+				for _, phase := range deployment.Phases {
+					files := []str.LocalRepoPath{phaseFile(phase, "a"), phaseFile(phase, "b")}
+					for _, repoFilePath := range files {
+						hostFiles.SetFileMetadata(repoFilePath, deployment.FileInfo{RepoFilePath: repoFilePath, Action: deployment.ActionFileModify, Phase: phase})
+					}
+					group := deployment.NewFileGroup(files)
+					group.SetPhase(phase)
+					hostFiles.Groups = append(hostFiles.Groups, group)
+				}
+				failingFile := phaseFile(failingPhase, "a")
+
+				deployMetrics := metrics.New()
+				deployer := New(&sync.WaitGroup{}, nil, config.EndpointInfo{EndpointName: endpointName}, nil, deployMetrics, 1, nil)
+				deployer.state.Name = endpointName
+				deployer.SetPhaseAbort(policy)
+
+				// Fake file deployment in place of SSH
+				var started []str.LocalRepoPath
+				deployer.fileDeploy = func(group *fileGroup, ctx context.Context, reloadState *reloadTracker, repoFilePath str.LocalRepoPath, deployFiles *deployment.HostFiles) {
+					started = append(started, repoFilePath)
+					if repoFilePath == failingFile {
+						group.recordFailure(ctx, repoFilePath, deployFiles, fmt.Errorf("install command failed"))
+						return
+					}
+					deployMetrics.AddFile(endpointName, deployFiles, repoFilePath)
+				}
+
+				deployer.deployPhases(ctx, hostFiles)
+
+				var expectedStarted []str.LocalRepoPath
+				expectedPhaseStatus := make(map[string]string)
+				for phaseIndex, phase := range deployment.Phases {
+					expectedPhaseStatus[phase] = metrics.PhaseDeployed
+					if phaseIndex == failingIndex {
+						expectedPhaseStatus[phase] = metrics.PhaseFailed
+					} else if phaseIndex > failingIndex && policy == deployment.PhaseAbortHost {
+						expectedPhaseStatus[phase] = metrics.PhaseNotStarted
+						continue
+					}
+
+					expectedStarted = append(expectedStarted, phaseFile(phase, "a"))
+					if phaseIndex != failingIndex || policy == deployment.PhaseAbortContinue {
+						expectedStarted = append(expectedStarted, phaseFile(phase, "b"))
+					}
+				}
+				if !slices.Equal(started, expectedStarted) {
+					t.Errorf("expected started files %v, got %v", expectedStarted, started)
+				}
+
+				deployMetrics.Stop()
+				summary := deployMetrics.CreateReport("", "")
+				if len(summary.Hosts) != 1 {
+					t.Fatalf("expected a single host summary, got %d", len(summary.Hosts))
+				}
+				hostSummary := summary.Hosts[0]
+
+				if len(hostSummary.Phases) != len(deployment.Phases) {
+					t.Fatalf("expected %d phase summaries, got %+v", len(deployment.Phases), hostSummary.Phases)
+				}
+				for index, phaseSummary := range hostSummary.Phases {
+					if phaseSummary.Name != deployment.Phases[index] || phaseSummary.Status != expectedPhaseStatus[phaseSummary.Name] {
+						t.Errorf("expected phase '%s' status '%s', got %+v", deployment.Phases[index], expectedPhaseStatus[deployment.Phases[index]], phaseSummary)
+					}
+				}
+
+				// Every file not started is still reported as failed with the reason it was stopped
+				for _, itemSummary := range hostSummary.Items {
+					wasStarted := slices.Contains(started, itemSummary.Name)
+					if itemSummary.Name == failingFile || !wasStarted {
+						if itemSummary.Status != "Failed" {
+							t.Errorf("expected file '%s' failed, got %+v", itemSummary.Name, itemSummary)
+						}
+						if !wasStarted && !strings.Contains(itemSummary.ErrorMsg, "phase '"+failingPhase+"'") {
+							t.Errorf("expected file '%s' stopped by phase '%s', got '%s'", itemSummary.Name, failingPhase, itemSummary.ErrorMsg)
+						}
+						continue
+					}
+					if itemSummary.Status != "Deployed" {
+						t.Errorf("expected file '%s' deployed, got %+v", itemSummary.Name, itemSummary)
+					}
+				}
+			})
+		}
+	}
+}
@@ -13,26 +13,16 @@ import (
 
 // Adds dynamic values for the input HostMeta
 // - OS type
+// - Remote command variants (stat and checksum)
 // - Creates randomly named temporary transfer and backup directories
 // - Sets strict permissions of login/runAs user for temp dirs
 func RemoteDeploymentPreparation(ctx context.Context, host *sshinternal.HostMeta) (err error) {
-	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Determining remote OS\n", host.Name)
-
-	command := sshinternal.BuildUnameKernel()
-	unameOutput, err := command.SSHexec(ctx, host.SSHClient, host.Password)
+	err = DetermineOSFamily(ctx, host)
 	if err != nil {
-		err = fmt.Errorf("unable to determine OS, cannot deploy: %w", err)
 		return
 	}
-
-	osName := strings.ToLower(unameOutput)
-	if strings.Contains(osName, "bsd") {
-		host.OSFamily = "bsd"
-	} else if strings.Contains(osName, "linux") {
-		host.OSFamily = "linux"
-	} else {
-		err = fmt.Errorf("received unknown os type: %s", unameOutput)
-		host.OSFamily = "unknown"
+	err = ProbeUtilities(ctx, host)
+	if err != nil {
 		return
 	}
 
@@ -54,7 +44,7 @@ func RemoteDeploymentPreparation(ctx context.Context, host *sshinternal.HostMeta
 	host.BackupPath = str.RemotePath(RemoteTmpDir + "/scmp." + backupDirSuffix)
 
 	// Create transfer and backup directory
-	command = sshinternal.BuildMkdir(host.TransferBufferDir, host.BackupPath)
+	command := sshinternal.BuildMkdir(host.TransferBufferDir, host.BackupPath)
 	command.DisableSudo = true
 	_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
 	if err != nil {
@@ -73,3 +63,45 @@ func RemoteDeploymentPreparation(ctx context.Context, host *sshinternal.HostMeta
 
 	return
 }
+
+// Sets the OS family of the host from the remote kernel name
+func DetermineOSFamily(ctx context.Context, host *sshinternal.HostMeta) (err error) {
+	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Determining remote OS\n", host.Name)
+
+	command := sshinternal.BuildUnameKernel()
+	unameOutput, err := command.SSHexec(ctx, host.SSHClient, host.Password)
+	if err != nil {
+		err = fmt.Errorf("unable to determine OS, cannot deploy: %w", err)
+		return
+	}
+
+	osName := strings.ToLower(unameOutput)
+	if strings.Contains(osName, "bsd") {
+		host.OSFamily = "bsd"
+	} else if strings.Contains(osName, "linux") {
+		host.OSFamily = "linux"
+	} else {
+		err = fmt.Errorf("received unknown os type: %s", unameOutput)
+		host.OSFamily = "unknown"
+		return
+	}
+	return
+}
+
+// Records which stat and checksum variants the host has and which required commands are missing
+// Missing commands are not an error here, pre-flight checks refuse the host
+func ProbeUtilities(ctx context.Context, host *sshinternal.HostMeta) (err error) {
+	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Probing remote utilities\n")
+
+	command := sshinternal.BuildUtilitiesProbe()
+	probeOutput, err := command.SSHexec(ctx, host.SSHClient, host.Password)
+	if err != nil {
+		err = fmt.Errorf("unable to probe remote utilities: %w", err)
+		return
+	}
+	host.Utilities = sshinternal.ParseUtilitiesProbe(probeOutput)
+
+	logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Remote utilities: stat=%s checksum=%s missing=%v\n",
+		host.Utilities.Stat, host.Utilities.Hash, host.Utilities.MissingCommands())
+	return
+}
@@ -0,0 +1,142 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/parsing"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"strconv"
+	"strings"
+)
+
+// Checks the host can take the planned files before any of them is touched
+// - Every required remote command is installed
+// - sudo works for the login user (unless disabled)
+// - Filesystems of the transfer buffer and every target directory have room for the files written to them
+func runPreflight(ctx context.Context, host sshinternal.HostMeta, deployFiles *deployment.HostFiles) (err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Running pre-flight checks\n")
+
+	err = CheckUtilities(host)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", deployment.ErrPreflightFailed, err)
+		return
+	}
+
+	if !opts.DisableSudo {
+		command := sshinternal.BuildSudoCheck()
+		command.RunAsUser = opts.RunAsUser
+		_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
+		if err != nil {
+			err = fmt.Errorf("%w: login user cannot run commands with sudo: %w", deployment.ErrPreflightFailed, err)
+			return
+		}
+	}
+
+	directories, requiredBytes := requiredSpace(host, deployFiles)
+	if len(directories) == 0 {
+		return
+	}
+
+	command := sshinternal.BuildDiskFree(directories...)
+	command.DisableSudo = opts.DisableSudo
+	command.RunAsUser = opts.RunAsUser
+	dfOutput, err := command.SSHexec(ctx, host.SSHClient, host.Password)
+	if err != nil {
+		err = fmt.Errorf("%w: failed to retrieve available disk space: %w", deployment.ErrPreflightFailed, err)
+		return
+	}
+
+	problems, err := checkDiskSpace(directories, requiredBytes, dfOutput)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", deployment.ErrPreflightFailed, err)
+		return
+	}
+	if len(problems) > 0 {
+		err = fmt.Errorf("%w: %s", deployment.ErrPreflightFailed, strings.Join(problems, "; "))
+		return
+	}
+	return
+}
+
+// Fails when probing found required remote commands missing (hosts that were not probed always pass)
+func CheckUtilities(host sshinternal.HostMeta) (err error) {
+	missingCommands := host.Utilities.MissingCommands()
+	if host.Utilities.Probed && len(missingCommands) > 0 {
+		err = fmt.Errorf("remote host is missing required command(s): %s", strings.Join(missingCommands, ", "))
+		return
+	}
+	return
+}
+
+// Bytes written to each remote directory by the transferred files of the host
+// Every transferred file passes through the transfer buffer before it is moved next to its target
+func requiredSpace(host sshinternal.HostMeta, deployFiles *deployment.HostFiles) (directories []str.RemotePath, requiredBytes map[str.RemotePath]int) {
+	requiredBytes = make(map[str.RemotePath]int)
+	for _, repoFilePath := range deployFiles.GetUnorderedList() {
+		info := deployFiles.GetFileInfo(repoFilePath)
+		if info.Action != deployment.ActionFileCreate && info.Action != deployment.ActionFileModify {
+			continue
+		}
+
+		targetDirectory := str.RemotePath(path.Dir(string(info.TargetFilePath)))
+		for _, directory := range []str.RemotePath{host.TransferBufferDir, targetDirectory} {
+			_, seen := requiredBytes[directory]
+			if !seen {
+				directories = append(directories, directory)
+			}
+			requiredBytes[directory] += info.FileSize
+		}
+	}
+	return
+}
+
+// Compares required bytes against the available space of each filesystem, directories on the same filesystem share its space
+// The df output has one POSIX line (1024-byte blocks) per directory in the same order
+func checkDiskSpace(directories []str.RemotePath, requiredBytes map[str.RemotePath]int, dfOutput string) (problems []string, err error) {
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(dfOutput, "\r", ""), "\n"), "\n")
+	if len(lines) != len(directories) {
+		err = fmt.Errorf("expected disk usage of %d directories, received %d line(s): %q", len(directories), len(lines), dfOutput)
+		return
+	}
+
+	var mountPoints []string
+	availableBytes := make(map[string]int)
+	neededBytes := make(map[string]int)
+	for index, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			err = fmt.Errorf("unexpected disk usage line for '%s': %q", directories[index], line)
+			return
+		}
+		var availableKiB int
+		availableKiB, err = strconv.Atoi(fields[3])
+		if err != nil {
+			err = fmt.Errorf("invalid available space for '%s': %q", directories[index], line)
+			return
+		}
+
+		mountPoint := strings.Join(fields[5:], " ")
+		_, seen := availableBytes[mountPoint]
+		if !seen {
+			mountPoints = append(mountPoints, mountPoint)
+		}
+		availableBytes[mountPoint] = availableKiB * 1024
+		neededBytes[mountPoint] += requiredBytes[directories[index]]
+	}
+
+	for _, mountPoint := range mountPoints {
+		if neededBytes[mountPoint] > availableBytes[mountPoint] {
+			problems = append(problems, fmt.Sprintf("not enough space on filesystem '%s' (%s needed, %s available)",
+				mountPoint, parsing.FormatBytes(neededBytes[mountPoint]), parsing.FormatBytes(availableBytes[mountPoint])))
+		}
+	}
+	return
+}
@@ -0,0 +1,66 @@
+package host
+
+import (
+	"scmp/core/deployment"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPreflightDiskSpace(t *testing.T) {
+	deployFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deployFiles.SetFileMetadata("web01/etc/nginx/nginx.conf", deployment.FileInfo{TargetFilePath: "/etc/nginx/nginx.conf", Action: deployment.ActionFileModify, FileSize: 3 * 1024})
+	deployFiles.SetFileMetadata("web01/etc/nginx/mime.types", deployment.FileInfo{TargetFilePath: "/etc/nginx/mime.types", Action: deployment.ActionFileCreate, FileSize: 2 * 1024})
+	deployFiles.SetFileMetadata("web01/srv/www/video.mp4", deployment.FileInfo{TargetFilePath: "/srv/www/video.mp4", Action: deployment.ActionFileCreate, FileSize: 40 * 1024})
+	deployFiles.SetFileMetadata("web01/etc/old.conf", deployment.FileInfo{TargetFilePath: "/etc/old.conf", Action: deployment.ActionFileDelete, FileSize: 500 * 1024})
+	deployFiles.SetFileMetadata("web01/etc/link", deployment.FileInfo{TargetFilePath: "/etc/link", Action: deployment.ActionSymLinkCreate})
+
+	host := sshinternal.HostMeta{TransferBufferDir: "/tmp/scmp.abc"}
+	directories, requiredBytes := requiredSpace(host, deployFiles)
+	slices.Sort(directories)
+	if !slices.Equal(directories, []str.RemotePath{"/etc/nginx", "/srv/www", "/tmp/scmp.abc"}) {
+		t.Fatalf("unexpected directories %v", directories)
+	}
+	if requiredBytes["/tmp/scmp.abc"] != 45*1024 || requiredBytes["/etc/nginx"] != 5*1024 || requiredBytes["/srv/www"] != 40*1024 {
+		t.Fatalf("unexpected required bytes %v", requiredBytes)
+	}
+
+	dfLine := func(available string, mountPoint string) (line string) {
+		line = "/dev/sda1 1000000 500000 " + available + " 50% " + mountPoint
+		return
+	}
+
+	// /etc and /tmp share the root filesystem, /srv is its own
+	dfOutput := dfLine("60", "/") + "\n" + dfLine("30", "/srv") + "\n" + dfLine("60", "/") + "\n"
+	problems, err := checkDiskSpace(directories, requiredBytes, dfOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(problems) != 1 || !strings.Contains(problems[0], "'/srv'") {
+		t.Errorf("expected only /srv to lack space, got %v", problems)
+	}
+
+	// Space of a shared filesystem is needed by both directories
+	dfOutput = dfLine("49", "/") + "\n" + dfLine("40", "/srv") + "\n" + dfLine("49", "/") + "\n"
+	problems, err = checkDiskSpace(directories, requiredBytes, dfOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(problems) != 1 || !strings.Contains(problems[0], "'/'") {
+		t.Errorf("expected the root filesystem to lack space, got %v", problems)
+	}
+
+	_, err = checkDiskSpace(directories, requiredBytes, dfLine("60", "/"))
+	if err == nil {
+		t.Errorf("expected error for missing df lines")
+	}
+	_, err = checkDiskSpace(directories[:1], requiredBytes, "/dev/sda1 1000000 500000 full 50% /")
+	if err == nil {
+		t.Errorf("expected error for invalid available space")
+	}
+}
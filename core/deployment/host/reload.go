@@ -11,6 +11,7 @@ import (
 	"scmp/internal/logctx"
 	"scmp/internal/sshinternal"
 	"scmp/internal/str"
+	"slices"
 	"strings"
 )
 
@@ -23,19 +24,70 @@ func NewReloadTracker(deploymentList *deployment.FileGroup, deployFiles *deploym
 		reloadIDreadyToReload:    make(map[str.ReloadID]bool),
 		remoteFileMetadatas:      make(map[str.LocalRepoPath]sshinternal.RemoteFileInfo),
 		failedReloadGroups:       make(map[str.ReloadID]bool),
+		runCommandSet:            actions.RunCommandSet,
+	}
+	return
+}
+
+// Waits until the reload group has a free slot across all hosts, release must be called once reloads are done
+// Groups without a host limit (or deployments without a coordinator) never wait
+func (coordinator *ReloadCoordinator) acquire(ctx context.Context, reloadID str.ReloadID, maxHosts int) (release func(), err error) {
+	release = func() {}
+	if coordinator == nil || maxHosts < 1 {
+		return
+	}
+
+	coordinator.mutex.Lock()
+	slots, exists := coordinator.slots[reloadID]
+	if !exists {
+		slots = make(chan struct{}, maxHosts)
+		coordinator.slots[reloadID] = slots
+	}
+	coordinator.mutex.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		err = fmt.Errorf("immediate stop requested while waiting to run reloads for group %s", reloadID)
+		return
+	}
+	release = func() { <-slots }
+	return
+}
+
+// Lowest host limit requested by any file in the reload group (0 when the group is per-host)
+func (tracker *reloadTracker) maxReloadHosts(reloadID str.ReloadID) (maxHosts int) {
+	for _, repoFilePath := range tracker.fileGroup.GetReloadIDFiles(reloadID) {
+		fileMaxHosts := tracker.hostFiles.GetFileInfo(repoFilePath).ReloadMaxHosts
+		if fileMaxHosts > 0 && (maxHosts == 0 || fileMaxHosts < maxHosts) {
+			maxHosts = fileMaxHosts
+		}
 	}
 	return
 }
 
 func (tracker *reloadTracker) AddRemoteMetadata(repoPath str.LocalRepoPath, remoteMetadata sshinternal.RemoteFileInfo) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
 	tracker.remoteFileMetadatas[repoPath] = remoteMetadata
 }
 
+func (tracker *reloadTracker) getRemoteMetadata(repoPath str.LocalRepoPath) (remoteMetadata sshinternal.RemoteFileInfo) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	remoteMetadata = tracker.remoteFileMetadatas[repoPath]
+	return
+}
+
 func (tracker *reloadTracker) RecordReloadGroupFailed(reloadID str.ReloadID) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
 	tracker.failedReloadGroups[reloadID] = true
 }
 
 func (tracker *reloadTracker) GetFailedReloadGroups() (reloadIDs []str.ReloadID) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
 	for reloadID := range tracker.failedReloadGroups {
 		reloadIDs = append(reloadIDs, reloadID)
 	}
@@ -47,6 +99,9 @@ func (tracker *reloadTracker) CheckForReload(ctx context.Context, repoFilePath s
 
 	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
 
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
 	// Nothing to do for this file, early return
 	if !fileHasReloadGroup {
 		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
@@ -96,7 +151,7 @@ func (tracker *reloadTracker) RunReload(ctx context.Context, deployGroup *fileGr
 	reloadCommands := tracker.fileGroup.GetReloadIDCommands(reloadGroup)
 
 	// Execute the commands for this reload group
-	err = actions.RunCommandSet(ctx, deployGroup.hostState, "Reload", reloadCommands)
+	err = tracker.runCommandSet(ctx, deployGroup.hostState, "Reload", reloadCommands)
 	if err != nil {
 		err = fmt.Errorf("reload failed: %w", err)
 		return
@@ -104,6 +159,32 @@ func (tracker *reloadTracker) RunReload(ctx context.Context, deployGroup *fileGr
 	return
 }
 
+// Re-runs the post-checks of every file in the reload group against the reloaded service (files whose condition excludes this host are not checked)
+func (tracker *reloadTracker) VerifyReload(ctx context.Context, deployGroup *fileGroup, reloadGroup str.ReloadID) (err error) {
+	var checkCommands []string
+	for _, repoFilePath := range tracker.fileGroup.GetReloadIDFiles(reloadGroup) {
+		info := tracker.hostFiles.GetFileInfo(repoFilePath)
+		conditionMatched, lerr := deployment.EvaluateCondition(info.Condition, deployGroup.hostState.Facts)
+		if lerr != nil || !conditionMatched {
+			continue
+		}
+
+		// Duplicate commands should only run once
+		for _, command := range info.PostChecks {
+			if !slices.Contains(checkCommands, command) {
+				checkCommands = append(checkCommands, command)
+			}
+		}
+	}
+
+	err = tracker.runCommandSet(ctx, deployGroup.hostState, "PostReloadCheck", checkCommands)
+	if err != nil {
+		err = fmt.Errorf("post-reload check failed: %w", err)
+		return
+	}
+	return
+}
+
 // Reload encountered error, rollback files
 func (tracker *reloadTracker) RollbackReload(ctx context.Context, deployGroup *fileGroup, reloadGroup str.ReloadID) (err error) {
 	failedFiles := tracker.fileGroup.GetReloadIDFilesReverse(reloadGroup)
@@ -114,7 +195,8 @@ func (tracker *reloadTracker) RollbackReload(ctx context.Context, deployGroup *f
 			"Restoring config file %s due to failed reload command\n", info.TargetFilePath)
 
 		// Restore the failed files
-		lerr := actions.RestoreOldFile(ctx, deployGroup.hostState, info.TargetFilePath, tracker.remoteFileMetadatas[failedFile])
+		deployGroup.stateCache.Remove(deployGroup.hostState.Name, info.TargetFilePath)
+		lerr := actions.RestoreOldFile(ctx, deployGroup.hostState, info, tracker.getRemoteMetadata(failedFile))
 		if lerr != nil {
 			// Only warning for restoration failures
 			logctx.LogStdWarn(ctx, "File restoration failed: %v\n", deployGroup.hostState.Name, lerr)
@@ -123,7 +205,7 @@ func (tracker *reloadTracker) RollbackReload(ctx context.Context, deployGroup *f
 
 	// Re-execute reload commands after rollback
 	reloadCommands := tracker.fileGroup.GetReloadIDCommands(reloadGroup)
-	err = actions.RunCommandSet(ctx, deployGroup.hostState, "Reload", reloadCommands)
+	err = tracker.runCommandSet(ctx, deployGroup.hostState, "Reload", reloadCommands)
 	if err != nil {
 		reloadFiles := tracker.fileGroup.GetReloadIDFiles(reloadGroup)
 
@@ -144,37 +226,15 @@ func (tracker *reloadTracker) RollbackReload(ctx context.Context, deployGroup *f
 
 // A file in a reload group failed commands before reload, restore file contents of all group files
 func (tracker *reloadTracker) RestoreReloadGroup(ctx context.Context, deployGroup *fileGroup, reloadGroup str.ReloadID) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
 	for failedFile, metadata := range tracker.remoteFileMetadatas {
 		reloadID, _ := tracker.fileGroup.GetFileReloadID(failedFile)
 		if reloadID != reloadGroup {
 			continue
 		}
-		info := tracker.hostFiles.GetFileInfo(failedFile)
-
-		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog,
-			"Restoring config file %s due to failed write/postapply command\n", info.TargetFilePath)
-
-		// Restore the failed files
-		// Only warning for restoration failures
-		switch metadata.FsType {
-		case remote.DirType:
-			lerr := actions.RestoreOldDir(ctx, deployGroup.hostState, info, metadata)
-			if lerr != nil {
-				logctx.LogStdWarn(ctx, "Directory restoration failed: %v\n", deployGroup.hostState.Name, lerr)
-			}
-		case remote.SymlinkType:
-			lerr := actions.RestoreOldLink(ctx, deployGroup.hostState, metadata)
-			if lerr != nil {
-				logctx.LogStdWarn(ctx, "Symlink restoration failed: %v\n", deployGroup.hostState.Name, lerr)
-			}
-		case remote.FileType:
-			lerr := actions.RestoreOldFile(ctx, deployGroup.hostState, info.TargetFilePath, metadata)
-			if lerr != nil {
-				logctx.LogStdWarn(ctx, "File restoration failed: %v\n", deployGroup.hostState.Name, lerr)
-			}
-		default:
-			logctx.LogStdWarn(ctx, "Unsupported restoration file type '%s' for file '%s'\n", metadata.FsType, failedFile)
-		}
+		tracker.restoreFile(ctx, deployGroup, failedFile, metadata)
 	}
 
 	logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog,
@@ -184,11 +244,52 @@ func (tracker *reloadTracker) RestoreReloadGroup(ctx context.Context, deployGrou
 	delete(tracker.failedReloadGroups, reloadGroup)
 }
 
+// A file outside of any reload group failed its post-checks, restore only that file
+func (tracker *reloadTracker) RestoreFile(ctx context.Context, deployGroup *fileGroup, repoFilePath str.LocalRepoPath) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	metadata, recorded := tracker.remoteFileMetadatas[repoFilePath]
+	if !recorded {
+		return
+	}
+	tracker.restoreFile(ctx, deployGroup, repoFilePath, metadata)
+}
+
+// Puts the previous remote version of a file back in place (only warning for restoration failures)
+func (tracker *reloadTracker) restoreFile(ctx context.Context, deployGroup *fileGroup, failedFile str.LocalRepoPath, metadata sshinternal.RemoteFileInfo) {
+	info := tracker.hostFiles.GetFileInfo(failedFile)
+
+	logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog,
+		"Restoring config file %s due to failed write/postapply/postcheck command\n", info.TargetFilePath)
+	deployGroup.stateCache.Remove(deployGroup.hostState.Name, info.TargetFilePath)
+
+	switch metadata.FsType {
+	case remote.DirType:
+		lerr := actions.RestoreOldDir(ctx, deployGroup.hostState, info, metadata)
+		if lerr != nil {
+			logctx.LogStdWarn(ctx, "Directory restoration failed: %v\n", deployGroup.hostState.Name, lerr)
+		}
+	case remote.SymlinkType:
+		lerr := actions.RestoreOldLink(ctx, deployGroup.hostState, metadata)
+		if lerr != nil {
+			logctx.LogStdWarn(ctx, "Symlink restoration failed: %v\n", deployGroup.hostState.Name, lerr)
+		}
+	case remote.FileType:
+		lerr := actions.RestoreOldFile(ctx, deployGroup.hostState, info, metadata)
+		if lerr != nil {
+			logctx.LogStdWarn(ctx, "File restoration failed: %v\n", deployGroup.hostState.Name, lerr)
+		}
+	default:
+		logctx.LogStdWarn(ctx, "Unsupported restoration file type '%s' for file '%s'\n", metadata.FsType, failedFile)
+	}
+}
+
 func (tracker *reloadTracker) RunPostInstall(ctx context.Context, deployGroup *fileGroup, reloadGroup str.ReloadID) (err error) {
 	postInstCommands := tracker.fileGroup.GetReloadIDPostInstCommands(reloadGroup)
 
 	// Execute the commands for this reload group
-	err = actions.RunCommandSet(ctx, deployGroup.hostState, "PostInstall", postInstCommands)
+	err = tracker.runCommandSet(ctx, deployGroup.hostState, "PostInstall", postInstCommands)
 	if err != nil {
 		err = fmt.Errorf("post-install failed: %w", err)
 		return
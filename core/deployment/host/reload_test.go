@@ -2,12 +2,17 @@ package host
 
 import (
 	"context"
+	"fmt"
 	"scmp/core/deployment"
+	"scmp/core/deployment/metrics"
 	"scmp/internal/config"
 	"scmp/internal/global"
 	"scmp/internal/logctx"
+	"scmp/internal/sshinternal"
 	"scmp/internal/str"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestCheckForReload(t *testing.T) {
@@ -151,3 +156,203 @@ func TestCheckForReload(t *testing.T) {
 		})
 	}
 }
+
+func TestRunReloadsAcrossHosts(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	const hostCount int = 5
+	const repoFilePath str.LocalRepoPath = "UniversalConfs/etc/app/app.conf"
+	const reloadID str.ReloadID = "app"
+
+	tests := []struct {
+		name     string
+		maxHosts int // 0 leaves the reload group per-host
+	}{
+		{"per-host without limit", 0},
+		{"serialized across hosts", 1},
+		{"limited across hosts", 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			coordinator := NewReloadCoordinator()
+			deployMetrics := metrics.New()
+
+			var mutex sync.Mutex
+			var activeHosts, mostActiveHosts, completedHosts int
+			allHostsReloading := make(chan struct{})
+
+			// Fake executor in place of SSH, a host is inside its reload section from reload start until post-install end
+			runCommandSet := func(ctx context.Context, host sshinternal.HostMeta, setName string, commands []string) (err error) {
+				switch setName {
+				case "Reload":
+					mutex.Lock()
+					activeHosts++
+					mostActiveHosts = max(mostActiveHosts, activeHosts)
+					if activeHosts == hostCount {
+						close(allHostsReloading)
+					}
+					mutex.Unlock()
+
+					if test.maxHosts == 0 {
+						// Independent hosts must all be able to reload at the same time
+						select {
+						case <-allHostsReloading:
+						case <-time.After(5 * time.Second):
+							err = fmt.Errorf("host %s reloaded alone", host.Name)
+							return
+						}
+					}
+					time.Sleep(10 * time.Millisecond)
+				case "PostInstall":
+					time.Sleep(10 * time.Millisecond)
+					mutex.Lock()
+					activeHosts--
+					completedHosts++
+					mutex.Unlock()
+				}
+				return
+			}
+
+			var wg sync.WaitGroup
+			for hostIndex := range hostCount {
+				hostFiles, err := deployment.NewHostFiles()
+				if err != nil {
+					t.Fatalf("unexpected hostfiles create failure: %v", err)
+				}
+				hostFiles.SetFileMetadata(repoFilePath, deployment.FileInfo{
+					RepoFilePath:   repoFilePath,
+					Action:         deployment.ActionFileModify,
+					Reload:         []string{"systemctl restart app"},
+					ReloadRequired: true,
+					ReloadGroup:    reloadID,
+					ReloadMaxHosts: test.maxHosts,
+				})
+				deploymentList := deployment.NewFileGroup([]str.LocalRepoPath{repoFilePath})
+				deploymentList.AppendFileToReloadID(reloadID, repoFilePath)
+				deploymentList.InitFiletoReloadID()
+				deploymentList.RecordReloadIDFileCount()
+				deploymentList.AppendCmdToReloadID(reloadID, repoFilePath, "systemctl restart app")
+
+				endpointName := str.RepoRootDir(fmt.Sprintf("host%d", hostIndex))
+				tracker := NewReloadTracker(deploymentList, hostFiles, endpointName)
+				tracker.runCommandSet = runCommandSet
+				group := &fileGroup{
+					hostState:         sshinternal.HostMeta{Name: endpointName},
+					metrics:           deployMetrics,
+					reloadCoordinator: coordinator,
+				}
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					reloaded := group.runReloads(ctx, tracker, repoFilePath, hostFiles, reloadID)
+					if !reloaded {
+						t.Errorf("host %s: expected reload to succeed, got error '%v'", endpointName, deployMetrics.HostFileHasError(endpointName, repoFilePath))
+					}
+				}()
+			}
+			wg.Wait()
+
+			if completedHosts != hostCount {
+				t.Errorf("expected %d hosts to finish reloads, got %d", hostCount, completedHosts)
+			}
+			expectedMostActive := test.maxHosts
+			if test.maxHosts == 0 {
+				expectedMostActive = hostCount
+			}
+			if mostActiveHosts != expectedMostActive {
+				t.Errorf("expected at most %d hosts reloading at once, got %d", expectedMostActive, mostActiveHosts)
+			}
+		})
+	}
+}
+
+func TestRunReloadsVerification(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	const reloadID str.ReloadID = "nginx"
+	siteConf := str.LocalRepoPath("web01/etc/nginx/sites-enabled/site.conf")
+	mainConf := str.LocalRepoPath("web01/etc/nginx/nginx.conf")
+
+	tests := []struct {
+		name            string
+		failCheck       bool
+		expectReloaded  bool
+		expectReloadRun int
+	}{
+		{"checks pass", false, true, 1},
+		{"checks fail", true, false, 2}, // reload runs again after restoring the group
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hostFiles, err := deployment.NewHostFiles()
+			if err != nil {
+				t.Fatalf("unexpected hostfiles create failure: %v", err)
+			}
+			for _, repoFilePath := range []str.LocalRepoPath{siteConf, mainConf} {
+				hostFiles.SetFileMetadata(repoFilePath, deployment.FileInfo{
+					RepoFilePath: repoFilePath,
+					Action:       deployment.ActionFileModify,
+					Reload:       []string{"systemctl reload nginx"},
+					PostChecks:   []string{"curl -sf http://localhost/health"},
+					ReloadGroup:  reloadID,
+				})
+			}
+			deploymentList := deployment.NewFileGroup([]str.LocalRepoPath{siteConf, mainConf})
+			for _, repoFilePath := range []str.LocalRepoPath{siteConf, mainConf} {
+				deploymentList.AppendFileToReloadID(reloadID, repoFilePath)
+				deploymentList.AppendCmdToReloadID(reloadID, repoFilePath, "systemctl reload nginx")
+			}
+			deploymentList.InitFiletoReloadID()
+			deploymentList.RecordReloadIDFileCount()
+
+			var reloadRuns int
+			var checkedCommands []string
+			tracker := NewReloadTracker(deploymentList, hostFiles, "web01")
+			tracker.runCommandSet = func(ctx context.Context, host sshinternal.HostMeta, setName string, commands []string) (err error) {
+				switch setName {
+				case "Reload":
+					reloadRuns++
+				case "PostReloadCheck":
+					checkedCommands = commands
+					if test.failCheck {
+						err = fmt.Errorf("error with command '%s': exit status 22", commands[0])
+					}
+				}
+				return
+			}
+			deployMetrics := metrics.New()
+			group := &fileGroup{
+				hostState: sshinternal.HostMeta{Name: "web01"},
+				metrics:   deployMetrics,
+			}
+
+			reloaded := group.runReloads(ctx, tracker, mainConf, hostFiles, reloadID)
+			if reloaded != test.expectReloaded {
+				t.Errorf("expected reloaded %t, got %t", test.expectReloaded, reloaded)
+			}
+			if reloadRuns != test.expectReloadRun {
+				t.Errorf("expected %d reload runs, got %d", test.expectReloadRun, reloadRuns)
+			}
+			if len(checkedCommands) != 1 {
+				t.Errorf("expected identical checks of the group to run once, got %v", checkedCommands)
+			}
+
+			deployMetrics.Stop()
+			for _, item := range deployMetrics.CreateReport("main", "aaa").Hosts {
+				for _, file := range item.Items {
+					if test.failCheck && file.Status != metrics.StatusRolledBack {
+						t.Errorf("expected file '%s' to be rolled back, got status '%s'", file.Name, file.Status)
+					}
+				}
+				if test.failCheck && len(item.Items) != 2 {
+					t.Errorf("expected every file of the group in the summary, got %d", len(item.Items))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package host
+
+import (
+	"context"
+	"scmp/core/deployment"
+	"scmp/internal/str"
+	"slices"
+)
+
+// Order constraints between files of a single file group
+// Files wait on their dependencies and on the previous file of their reload group, everything else may deploy concurrently
+type fileSchedule struct {
+	orderedList   []str.LocalRepoPath
+	position      map[str.LocalRepoPath]int
+	prerequisites map[str.LocalRepoPath]int                 // Count of unfinished files each file waits on
+	dependents    map[str.LocalRepoPath][]str.LocalRepoPath // Files waiting on each file
+	reloadGroups  map[str.LocalRepoPath]str.ReloadID        // Reload group of each file that has one
+}
+
+func newFileSchedule(deploymentList *deployment.FileGroup, deployFiles *deployment.HostFiles) (schedule *fileSchedule) {
+	schedule = &fileSchedule{
+		orderedList:   deploymentList.GetOrderedList(),
+		position:      make(map[str.LocalRepoPath]int),
+		prerequisites: make(map[str.LocalRepoPath]int),
+		dependents:    make(map[str.LocalRepoPath][]str.LocalRepoPath),
+		reloadGroups:  make(map[str.LocalRepoPath]str.ReloadID),
+	}
+	for index, repoFilePath := range schedule.orderedList {
+		schedule.position[repoFilePath] = index
+	}
+
+	lastReloadFile := make(map[str.ReloadID]str.LocalRepoPath)
+	for _, repoFilePath := range schedule.orderedList {
+		waitsOn := make(map[str.LocalRepoPath]struct{})
+
+		// Files within a reload group stay in deployment order
+		reloadID, hasReloadGroup := deploymentList.GetFileReloadID(repoFilePath)
+		if hasReloadGroup {
+			previousFile, hasPrevious := lastReloadFile[reloadID]
+			if hasPrevious {
+				waitsOn[previousFile] = struct{}{}
+			}
+			lastReloadFile[reloadID] = repoFilePath
+			schedule.reloadGroups[repoFilePath] = reloadID
+		}
+
+		// Dependencies outside this group (or this deployment) have no ordering to wait for
+		info := deployFiles.GetFileInfo(repoFilePath)
+		for _, dependency := range info.Dependencies {
+			dependencyPosition, inGroup := schedule.position[dependency]
+			if inGroup && dependencyPosition < schedule.position[repoFilePath] {
+				waitsOn[dependency] = struct{}{}
+			}
+		}
+
+		for prerequisite := range waitsOn {
+			schedule.dependents[prerequisite] = append(schedule.dependents[prerequisite], repoFilePath)
+		}
+		schedule.prerequisites[repoFilePath] = len(waitsOn)
+	}
+	return
+}
+
+// Runs every file in the schedule, deploying ready files concurrently when spare deploy slots are available on this host
+// The calling group already holds one slot, extra slots are only taken when free so groups never wait on each other
+// Files that are not started before a stop is requested (or the phase is halted) are passed to notStarted instead
+// After an interrupt only files completing an already started reload group are still started, so no group is left half-applied
+func (group *fileGroup) runSchedule(ctx context.Context, schedule *fileSchedule, runFile func(str.LocalRepoPath), notStarted func(str.LocalRepoPath)) {
+	type fileResult struct {
+		repoFilePath str.LocalRepoPath
+		usedOwnSlot  bool
+	}
+
+	remainingPrerequisites := make(map[str.LocalRepoPath]int, len(schedule.prerequisites))
+	var ready []str.LocalRepoPath
+	for _, repoFilePath := range schedule.orderedList {
+		remainingPrerequisites[repoFilePath] = schedule.prerequisites[repoFilePath]
+		if remainingPrerequisites[repoFilePath] == 0 {
+			ready = append(ready, repoFilePath)
+		}
+	}
+
+	finished := make(chan fileResult, len(schedule.orderedList))
+	var running int
+	var ownSlotBusy bool
+	var stopped bool
+	launched := make(map[str.LocalRepoPath]bool)
+	startedGroups := make(map[str.ReloadID]bool)
+
+	for {
+		for len(ready) > 0 && !stopped {
+			if group.phase.isHalted() || (ctx.Err() != nil && !deployment.Interrupted(ctx)) {
+				stopped = true
+				break
+			}
+			if ctx.Err() != nil {
+				ready = slices.DeleteFunc(ready, func(repoFilePath str.LocalRepoPath) bool {
+					reloadID, hasReloadGroup := schedule.reloadGroups[repoFilePath]
+					return !hasReloadGroup || !startedGroups[reloadID]
+				})
+				if len(ready) == 0 {
+					break
+				}
+			}
+
+			usedOwnSlot := !ownSlotBusy
+			if !usedOwnSlot {
+				var acquiredSlot bool
+				select {
+				case group.deployLimiter <- struct{}{}:
+					acquiredSlot = true
+				default:
+				}
+				if !acquiredSlot {
+					break
+				}
+			}
+
+			// Earliest ready file first, keeps serial deployments in the original order
+			nextIndex := 0
+			for index, repoFilePath := range ready {
+				if schedule.position[repoFilePath] < schedule.position[ready[nextIndex]] {
+					nextIndex = index
+				}
+			}
+			repoFilePath := ready[nextIndex]
+			ready = append(ready[:nextIndex], ready[nextIndex+1:]...)
+
+			if usedOwnSlot {
+				ownSlotBusy = true
+			}
+			running++
+			launched[repoFilePath] = true
+			reloadID, hasReloadGroup := schedule.reloadGroups[repoFilePath]
+			if hasReloadGroup {
+				startedGroups[reloadID] = true
+			}
+
+			go func() {
+				defer func() { finished <- fileResult{repoFilePath: repoFilePath, usedOwnSlot: usedOwnSlot} }()
+				runFile(repoFilePath)
+			}()
+		}
+
+		if running == 0 {
+			break
+		}
+
+		result := <-finished
+		running--
+		if result.usedOwnSlot {
+			ownSlotBusy = false
+		} else {
+			<-group.deployLimiter
+		}
+
+		for _, dependent := range schedule.dependents[result.repoFilePath] {
+			remainingPrerequisites[dependent]--
+			if remainingPrerequisites[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	// Only a stop request, an interrupt, or a halted phase leaves files unlaunched
+	for _, repoFilePath := range schedule.orderedList {
+		if !launched[repoFilePath] {
+			notStarted(repoFilePath)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package host
+
+import (
+	"context"
+	"scmp/core/deployment"
+	"scmp/internal/str"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Files a and b share a reload group, c has its own reload group, d depends on a
+func newTestSchedule(t *testing.T) (schedule *fileSchedule) {
+	t.Helper()
+	hostFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected hostfiles create failure: %v", err)
+	}
+	hostFiles.SetFileMetadata("host1/a", deployment.FileInfo{RepoFilePath: "host1/a"})
+	hostFiles.SetFileMetadata("host1/b", deployment.FileInfo{RepoFilePath: "host1/b"})
+	hostFiles.SetFileMetadata("host1/c", deployment.FileInfo{RepoFilePath: "host1/c"})
+	hostFiles.SetFileMetadata("host1/d", deployment.FileInfo{RepoFilePath: "host1/d", Dependencies: []str.LocalRepoPath{"host1/a", "host1/other"}})
+
+	fileGroup := deployment.NewFileGroup([]str.LocalRepoPath{"host1/a", "host1/c", "host1/b", "host1/d"})
+	fileGroup.AppendFileToReloadID("reloadX", "host1/a", "host1/b")
+	fileGroup.AppendFileToReloadID("reloadY", "host1/c")
+	fileGroup.InitFiletoReloadID()
+
+	schedule = newFileSchedule(fileGroup, hostFiles)
+	return
+}
+
+func TestNewFileSchedule(t *testing.T) {
+	schedule := newTestSchedule(t)
+
+	expectedPrerequisites := map[str.LocalRepoPath]int{"host1/a": 0, "host1/c": 0, "host1/b": 1, "host1/d": 1}
+	for repoFilePath, expectedCount := range expectedPrerequisites {
+		if schedule.prerequisites[repoFilePath] != expectedCount {
+			t.Errorf("file '%s': expected %d prerequisites, got %d", repoFilePath, expectedCount, schedule.prerequisites[repoFilePath])
+		}
+	}
+
+	dependents := schedule.dependents["host1/a"]
+	slices.Sort(dependents)
+	if !slices.Equal(dependents, []str.LocalRepoPath{"host1/b", "host1/d"}) {
+		t.Errorf("expected 'host1/a' dependents [host1/b host1/d], got %v", dependents)
+	}
+}
+
+func TestRunSchedule(t *testing.T) {
+	t.Run("concurrent", func(t *testing.T) {
+		schedule := newTestSchedule(t)
+		group := &fileGroup{deployLimiter: make(chan struct{}, 2)}
+		group.deployLimiter <- struct{}{} // Slot held by the group itself
+
+		var mutex sync.Mutex
+		finished := make(map[str.LocalRepoPath]bool)
+		cStarted := make(chan struct{})
+
+		group.runSchedule(t.Context(), schedule,
+			func(repoFilePath str.LocalRepoPath) {
+				mutex.Lock()
+				switch repoFilePath {
+				case "host1/b", "host1/d":
+					if !finished["host1/a"] {
+						t.Errorf("file '%s' started before its prerequisite finished", repoFilePath)
+					}
+				case "host1/c":
+					close(cStarted)
+				}
+				mutex.Unlock()
+
+				// Different reload groups must overlap
+				if repoFilePath == "host1/a" {
+					select {
+					case <-cStarted:
+					case <-time.After(5 * time.Second):
+						t.Errorf("file in independent reload group did not start while 'host1/a' was deploying")
+					}
+				}
+
+				mutex.Lock()
+				finished[repoFilePath] = true
+				mutex.Unlock()
+			},
+			func(repoFilePath str.LocalRepoPath) {
+				t.Errorf("file '%s' unexpectedly not started", repoFilePath)
+			},
+		)
+
+		if len(finished) != 4 {
+			t.Errorf("expected 4 deployed files, got %v", finished)
+		}
+		if len(group.deployLimiter) != 1 {
+			t.Errorf("expected extra deploy slots to be released, %d in use", len(group.deployLimiter))
+		}
+	})
+
+	t.Run("serial", func(t *testing.T) {
+		schedule := newTestSchedule(t)
+		group := &fileGroup{deployLimiter: make(chan struct{}, 1)}
+		group.deployLimiter <- struct{}{}
+
+		var order []str.LocalRepoPath
+		group.runSchedule(t.Context(), schedule,
+			func(repoFilePath str.LocalRepoPath) { order = append(order, repoFilePath) },
+			func(repoFilePath str.LocalRepoPath) { t.Errorf("file '%s' unexpectedly not started", repoFilePath) },
+		)
+
+		if !slices.Equal(order, schedule.orderedList) {
+			t.Errorf("expected serial deployment in order %v, got %v", schedule.orderedList, order)
+		}
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		schedule := newTestSchedule(t)
+		group := &fileGroup{deployLimiter: make(chan struct{}, 2)}
+		group.deployLimiter <- struct{}{}
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		var notStarted []str.LocalRepoPath
+		group.runSchedule(ctx, schedule,
+			func(repoFilePath str.LocalRepoPath) { t.Errorf("file '%s' started after stop", repoFilePath) },
+			func(repoFilePath str.LocalRepoPath) { notStarted = append(notStarted, repoFilePath) },
+		)
+
+		if len(notStarted) != 4 {
+			t.Errorf("expected all files not started, got %v", notStarted)
+		}
+	})
+	t.Run("interrupted", func(t *testing.T) {
+		schedule := newTestSchedule(t)
+		group := &fileGroup{deployLimiter: make(chan struct{}, 1)}
+		group.deployLimiter <- struct{}{}
+
+		ctx, cancel := context.WithCancelCause(t.Context())
+		defer cancel(nil)
+
+		var started, notStarted []str.LocalRepoPath
+		group.runSchedule(ctx, schedule,
+			func(repoFilePath str.LocalRepoPath) {
+				started = append(started, repoFilePath)
+				if repoFilePath == "host1/a" {
+					cancel(deployment.ErrInterrupted)
+				}
+			},
+			func(repoFilePath str.LocalRepoPath) { notStarted = append(notStarted, repoFilePath) },
+		)
+
+		// Reload group of the in-flight file still completes, nothing else starts
+		if !slices.Equal(started, []str.LocalRepoPath{"host1/a", "host1/b"}) {
+			t.Errorf("expected started files [host1/a host1/b], got %v", started)
+		}
+		if !slices.Equal(notStarted, []str.LocalRepoPath{"host1/c", "host1/d"}) {
+			t.Errorf("expected not started files [host1/c host1/d], got %v", notStarted)
+		}
+	})
+}
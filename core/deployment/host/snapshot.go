@@ -0,0 +1,44 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"scmp/core/deployment"
+	"scmp/core/deployment/snapshot"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+)
+
+// Sets the snapshot taken around this host's deployment (empty or host without Snapshot option takes none)
+func (deployer *Deployer) SetSnapshotID(snapshotID string) {
+	deployer.snapshotID = snapshotID
+}
+
+// Captures the remote state of the host's planned files for one phase of the deployment snapshot
+func (deployer *Deployer) captureSnapshot(ctx context.Context, deployFiles *deployment.HostFiles, phase string) (err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	hostDirectory := filepath.Join(cfg.SnapshotDirectory, string(deployer.state.Name))
+
+	manifest, err := snapshot.Capture(ctx, deployer.state, deployFiles, hostDirectory, deployer.snapshotID, phase, cfg.SnapshotMaxSize)
+	if err != nil {
+		err = fmt.Errorf("failed %s-deployment snapshot: %w", phase, err)
+		return
+	}
+	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
+		"Saved %s-deployment snapshot '%s' of %d item(s)\n", phase, manifest.ID, len(manifest.Entries))
+
+	if phase != snapshot.PhasePost {
+		return
+	}
+	removed, err := snapshot.Prune(hostDirectory, cfg.SnapshotRetention)
+	if err != nil {
+		err = fmt.Errorf("failed snapshot retention: %w", err)
+		return
+	}
+	if len(removed) > 0 {
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Removed %d snapshot(s) beyond retention of %d\n", len(removed), cfg.SnapshotRetention)
+	}
+	return
+}
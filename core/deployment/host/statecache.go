@@ -0,0 +1,67 @@
+package host
+
+import (
+	"context"
+	"scmp/core/deployment"
+	"scmp/core/deployment/statecache"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+)
+
+// Sets the record of last deployed file states, updated as files deploy (nil keeps none)
+func (deployer *Deployer) SetStateCache(stateCache *statecache.Cache) {
+	deployer.stateCache = stateCache
+}
+
+// Reports a file whose last deployed state matches the local file, trusting the cache instead of the remote
+// Only used with --use-cache, never for wet-runs or when installation commands of the file are requested
+func (group *fileGroup) cachedUnchanged(ctx context.Context, info deployment.FileInfo) (unchanged bool) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	if !opts.UseCache || opts.RefreshCache || opts.WetRunEnabled {
+		return
+	}
+	if info.Action != deployment.ActionFileCreate && info.Action != deployment.ActionFileModify {
+		return
+	}
+	if info.InstallOptional && opts.RunInstallCommands {
+		return
+	}
+
+	unchanged = group.stateCache.Matches(group.hostState.Name, info.TargetFilePath, cacheEntry(info))
+	if unchanged {
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
+			"File '%s' matches state cache... skipping this file\n", info.TargetFilePath)
+	}
+	return
+}
+
+// Records the state the file was left in on the remote, failed files are forgotten
+func (group *fileGroup) updateStateCache(ctx context.Context, info deployment.FileInfo, failed bool) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+	if opts.WetRunEnabled {
+		return
+	}
+
+	switch info.Action {
+	case deployment.ActionFileCreate, deployment.ActionFileModify:
+		if failed {
+			group.stateCache.Remove(group.hostState.Name, info.TargetFilePath)
+			return
+		}
+		group.stateCache.Record(group.hostState.Name, info.TargetFilePath, cacheEntry(info))
+	default:
+		// Target is no longer a deployed file (deleted, or replaced by a directory or link)
+		group.stateCache.Remove(group.hostState.Name, info.TargetFilePath)
+	}
+}
+
+func cacheEntry(info deployment.FileInfo) (entry statecache.Entry) {
+	entry = statecache.Entry{
+		Hash:        info.Hash,
+		Permissions: info.Permissions,
+		OwnerGroup:  info.OwnerGroup,
+	}
+	return
+}
@@ -2,12 +2,15 @@
 package host
 
 import (
+	"context"
 	"scmp/core/deployment"
 	"scmp/core/deployment/metrics"
+	"scmp/core/deployment/statecache"
 	"scmp/internal/config"
 	"scmp/internal/sshinternal"
 	"scmp/internal/str"
 	"sync"
+	"time"
 )
 
 // Per-host deployer state
@@ -15,15 +18,37 @@ type Deployer struct {
 	allHostWG   *sync.WaitGroup
 	connLimiter chan struct{}
 	host        config.EndpointInfo
-	proxy       config.EndpointInfo
+	proxy       []config.EndpointInfo
 
 	metrics *metrics.Metrics
 
 	state sshinternal.HostMeta
 
+	hostDeploy func(context.Context, *deployment.HostFiles) // Performs the actual host deployment (replaceable for tests)
+
 	deployWG             *sync.WaitGroup
 	deployLimiter        chan struct{}
 	maxConcurrentDeploys int
+
+	reloadCoordinator *ReloadCoordinator
+	crossHost         *CrossHostCoordinator // Files other hosts depend on (nil when no host depends on another)
+
+	runCutoff     time.Time  // When in-flight work is cut off by the deployment deadline (zero when unlimited)
+	cutoffReached bool       // Connection was closed by a deadline
+	cutoffMutex   sync.Mutex // Cut off runs on its own timer while the host deploys
+
+	abortCtx context.Context // Forced abort of the deployment, closes the host connection when done (nil never aborts)
+	aborted  bool            // Connection was closed by a forced abort
+
+	snapshotID string // Snapshot of planned files taken around the deployment (empty takes none)
+
+	backupArchiveID string // Archive directory name of archive style backups (empty keeps them in the temporary backup directory)
+
+	stateCache *statecache.Cache // Last deployed file states (nil when not in use)
+
+	phaseAbort string // What a failed file stops when the host deploys in phases (empty continues)
+
+	fileDeploy func(*fileGroup, context.Context, *reloadTracker, str.LocalRepoPath, *deployment.HostFiles) // Deploys a single file (replaceable for tests)
 }
 
 // Per-file-group deployer state
@@ -32,6 +57,49 @@ type fileGroup struct {
 	deployLimiter chan struct{}
 	hostState     sshinternal.HostMeta
 	metrics       *metrics.Metrics
+	stateCache    *statecache.Cache
+
+	reloadCoordinator *ReloadCoordinator
+	crossHost         *CrossHostCoordinator
+
+	phase      *phaseState // Phase the group deploys in (nil outside of host deployments)
+	fileDeploy func(*fileGroup, context.Context, *reloadTracker, str.LocalRepoPath, *deployment.HostFiles)
+}
+
+// Failure state of the phase currently deploying on a host, shared by all file groups of the phase
+type phaseState struct {
+	name   string
+	policy string
+	halted bool // No further files of the phase are started
+	mutex  sync.Mutex
+}
+
+// Reload slots shared by all hosts of a deployment
+// Reload groups are per-host, only groups with a MaxConcurrentHosts limit are coordinated across hosts
+type ReloadCoordinator struct {
+	slots map[str.ReloadID]chan struct{} // Hosts currently running reloads by reload group
+	mutex sync.Mutex
+}
+
+// Results of files that files on other hosts depend on, shared by all hosts of a deployment
+// Hosts only start once every host they depend on has started, so waiting hosts never hold connection slots their dependencies need
+type CrossHostCoordinator struct {
+	files     map[crossHostKey]*crossHostFile       // Depended on files by host and target path
+	dependsOn map[str.RepoRootDir][]str.RepoRootDir // Hosts whose files each host waits on
+	started   map[str.RepoRootDir]chan struct{}     // Closed once the host started (or finished without starting)
+	mutex     sync.Mutex
+}
+
+type crossHostKey struct {
+	endpointName str.RepoRootDir
+	targetPath   str.RemotePath
+}
+
+// Depended on file, done is closed once its result is known
+type crossHostFile struct {
+	repoFilePath str.LocalRepoPath
+	done         chan struct{}
+	err          error // Why the file did not deploy (nil on success)
 }
 
 type reloadTracker struct {
@@ -42,4 +110,7 @@ type reloadTracker struct {
 	reloadIDreadyToReload    map[str.ReloadID]bool                            // Signal when a reload group is cleared to reload
 	remoteFileMetadatas      map[str.LocalRepoPath]sshinternal.RemoteFileInfo // Track remote file metadata (mainly for reload failure restoration)
 	failedReloadGroups       map[str.ReloadID]bool                            // Track when a group has a member that failed, thus entire group is failed
+	mutex                    sync.Mutex                                       // Files of different reload groups are deployed concurrently
+
+	runCommandSet func(context.Context, sshinternal.HostMeta, string, []string) error // Runs reload/post-install commands (replaceable for tests)
 }
@@ -9,6 +9,7 @@ func NewHostFiles() (files *HostFiles, err error) {
 	files = &HostFiles{
 		metadata: make(map[str.LocalRepoPath]FileInfo),
 		data:     make(map[str.FileID][]byte),
+		streams:  make(map[str.FileID]StreamedContent),
 	}
 	return
 }
@@ -18,6 +19,7 @@ func (files *HostFiles) CopyGlobalFiles(sourceList []str.LocalRepoPath, allFiles
 	for _, file := range sourceList {
 		info := allFiles.GetFileInfo(file)
 		data := allFiles.GetFileData(info.Hash)
+		stream, isStreamed := allFiles.GetFileStream(info.Hash)
 
 		dataCopy := make([]byte, len(data))
 		copy(dataCopy, data)
@@ -28,6 +30,9 @@ func (files *HostFiles) CopyGlobalFiles(sourceList []str.LocalRepoPath, allFiles
 		if !alreadyLoaded {
 			files.data[info.Hash] = dataCopy
 		}
+		if isStreamed {
+			files.streams[info.Hash] = stream
+		}
 
 		files.metadata[file] = info
 
@@ -54,6 +59,15 @@ func (files *HostFiles) StoreDataOnce(identifier str.FileID, content []byte) {
 	files.mutex.Unlock()
 }
 
+func (files *HostFiles) StoreStreamOnce(identifier str.FileID, stream StreamedContent) {
+	files.mutex.Lock()
+	_, alreadyLoaded := files.streams[identifier]
+	if !alreadyLoaded {
+		files.streams[identifier] = stream
+	}
+	files.mutex.Unlock()
+}
+
 func (files *HostFiles) SetFileMetadata(path str.LocalRepoPath, metadata FileInfo) {
 	files.mutex.Lock()
 	_, alreadyLoaded := files.metadata[path]
@@ -63,6 +77,18 @@ func (files *HostFiles) SetFileMetadata(path str.LocalRepoPath, metadata FileInf
 	files.mutex.Unlock()
 }
 
+// Replaces the dependency list for a path with host-specific (resolved) dependencies
+func (files *HostFiles) SetFileDependencies(path str.LocalRepoPath, dependencies []str.LocalRepoPath) {
+	files.mutex.Lock()
+	defer files.mutex.Unlock()
+	info, validPath := files.metadata[path]
+	if !validPath {
+		return
+	}
+	info.Dependencies = dependencies
+	files.metadata[path] = info
+}
+
 func (files *HostFiles) GetFileInfo(path str.LocalRepoPath) (info FileInfo) {
 	files.mutex.RLock()
 	defer files.mutex.RUnlock()
@@ -77,6 +103,14 @@ func (files *HostFiles) GetFileData(identifier str.FileID) (data []byte) {
 	return
 }
 
+// Retrieves local location of content that is not held in memory
+func (files *HostFiles) GetFileStream(identifier str.FileID) (stream StreamedContent, isStreamed bool) {
+	files.mutex.RLock()
+	stream, isStreamed = files.streams[identifier]
+	files.mutex.RUnlock()
+	return
+}
+
 func (files *HostFiles) ChangeFileDataPointer(path str.LocalRepoPath, newIdentifier str.FileID) {
 	files.mutex.Lock()
 	defer files.mutex.Unlock()
@@ -88,6 +122,23 @@ func (files *HostFiles) ChangeFileDataPointer(path str.LocalRepoPath, newIdentif
 	files.metadata[path] = info
 }
 
+// Points the path at host-specific content, size follows the new content
+func (files *HostFiles) ReplaceFileContent(path str.LocalRepoPath, newIdentifier str.FileID, content []byte) {
+	files.mutex.Lock()
+	defer files.mutex.Unlock()
+	info, validPath := files.metadata[path]
+	if !validPath {
+		return
+	}
+	_, alreadyLoaded := files.data[newIdentifier]
+	if !alreadyLoaded {
+		files.data[newIdentifier] = content
+	}
+	info.Hash = newIdentifier
+	info.FileSize = len(content)
+	files.metadata[path] = info
+}
+
 // Removes all references in host file for the given path
 func (files *HostFiles) PurgePath(path str.LocalRepoPath) (err error) {
 	files.mutex.Lock()
@@ -120,6 +171,7 @@ func (files *HostFiles) PurgePath(path str.LocalRepoPath) (err error) {
 	if !doNotDeleteFileID {
 		// No other file shares the same content, remove from map
 		delete(files.data, fileID)
+		delete(files.streams, fileID)
 	}
 	return
 }
@@ -143,3 +195,45 @@ func (files *HostFiles) InitPostInstallCmdSet() {
 		}
 	}
 }
+
+// Finds a file with a condition or remote commands using fact macros, which need gathered host facts
+func (files *HostFiles) FactsRequired() (repoFilePath str.LocalRepoPath, required bool) {
+	files.mutex.RLock()
+	defer files.mutex.RUnlock()
+	for path, info := range files.metadata {
+		if info.Condition != "" {
+			repoFilePath, required = path, true
+			return
+		}
+		for _, commands := range [][]string{info.Install, info.PostInstall, info.Preapply, info.Postapply, info.PreChecks, info.PostChecks, info.Reload} {
+			for _, command := range commands {
+				if UsesFactMacros(command) {
+					repoFilePath, required = path, true
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// Replaces every remote and local command of the file metadata with its expanded form
+func (files *HostFiles) ExpandFileCommands(path str.LocalRepoPath, expand func(command string) string) {
+	files.mutex.Lock()
+	defer files.mutex.Unlock()
+	info, validPath := files.metadata[path]
+	if !validPath {
+		return
+	}
+	for _, commands := range []*[]string{&info.Predeploy, &info.Install, &info.PostInstall, &info.Preapply, &info.Postapply, &info.PreChecks, &info.PostChecks, &info.Reload} {
+		if len(*commands) == 0 {
+			continue
+		}
+		expanded := make([]string, 0, len(*commands))
+		for _, command := range *commands {
+			expanded = append(expanded, expand(command))
+		}
+		*commands = expanded
+	}
+	files.metadata[path] = info
+}
@@ -0,0 +1,27 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+)
+
+// True when ctx was stopped by a user interrupt
+func Interrupted(ctx context.Context) (interrupted bool) {
+	interrupted = errors.Is(context.Cause(ctx), ErrInterrupted)
+	return
+}
+
+// Context for work already started, an interrupt of ctx lets it finish while any other stop (deadlines) still ends it
+func ContinueOnInterrupt(ctx context.Context) (workCtx context.Context, stop func()) {
+	workCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	stopWatching := context.AfterFunc(ctx, func() {
+		if !Interrupted(ctx) {
+			cancel(context.Cause(ctx))
+		}
+	})
+	stop = func() {
+		stopWatching()
+		cancel(nil)
+	}
+	return
+}
@@ -0,0 +1,50 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestContinueOnInterrupt(t *testing.T) {
+	tests := []struct {
+		name        string
+		cause       error
+		expectAlive bool
+	}{
+		{
+			name:        "Interrupt keeps work running",
+			cause:       ErrInterrupted,
+			expectAlive: true,
+		},
+		{
+			name:        "Deadline stops work",
+			cause:       ErrDeadlineExceeded,
+			expectAlive: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancelCause(context.Background())
+			workCtx, stop := ContinueOnInterrupt(ctx)
+			defer stop()
+
+			cancel(test.cause)
+			if !test.expectAlive {
+				<-workCtx.Done()
+				if !errors.Is(context.Cause(workCtx), test.cause) {
+					t.Errorf("expected cause %v, got %v", test.cause, context.Cause(workCtx))
+				}
+				return
+			}
+
+			if workCtx.Err() != nil {
+				t.Errorf("expected work context to continue after interrupt, got %v", workCtx.Err())
+			}
+			if !Interrupted(ctx) {
+				t.Errorf("expected interrupted parent context")
+			}
+		})
+	}
+}
@@ -0,0 +1,439 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"scmp/core/deployment"
+	"scmp/core/deployment/host"
+	"scmp/core/deployment/metrics"
+	"scmp/core/deployment/remote"
+	"scmp/internal/config"
+	"scmp/internal/fsops"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/parsing"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Kinds of differences between the repository and a remote host
+const (
+	driftMissing     string = "missing"
+	driftContent     string = "content"
+	driftOwner       string = "owner"
+	driftPermissions string = "permissions"
+	driftType        string = "type"
+	driftLinkTarget  string = "link-target"
+	driftExtraneous  string = "extraneous"
+)
+
+// Audit outcome of every planned host
+type auditReport struct {
+	Branch   string      `json:"Branch"`
+	CommitID string      `json:"Commit-ID"`
+	Status   string      `json:"Status"`
+	Hosts    []hostAudit `json:"Hosts"`
+}
+
+type hostAudit struct {
+	Name         str.RepoRootDir `json:"Name"`
+	Error        string          `json:"Error,omitempty"`
+	AuditedItems int             `json:"Audited-Items"`
+	Drift        []driftItem     `json:"Drift"`
+}
+
+// Single difference of a remote path from the repository
+type driftItem struct {
+	Path     str.RemotePath    `json:"Path"`
+	RepoFile str.LocalRepoPath `json:"Repository-File,omitempty"` // Empty for extraneous entries
+	Kind     string            `json:"Kind"`
+	Expected string            `json:"Expected,omitempty"`
+	Actual   string            `json:"Actual,omitempty"`
+}
+
+// Compares every planned file against its remote target and reports the drift, nothing is modified on the remote
+// Status is DriftDetected when any host differs, hosts that cannot be audited fail the audit after the report
+func (run *deploymentRun) audit(ctx context.Context) (status string, err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	report := auditReport{
+		Branch:   run.deployBranch,
+		CommitID: run.commitID,
+		Status:   metrics.StatusNoDrift,
+	}
+
+	var wg sync.WaitGroup
+	var reportMutex sync.Mutex
+	connLimiter := make(chan struct{}, max(opts.MaxSSHConcurrency, 1))
+	for _, plan := range run.plans {
+		for _, endpointName := range plan.hosts {
+			wg.Go(func() {
+				connLimiter <- struct{}{}
+				defer func() { <-connLimiter }()
+
+				hostCtx := host.WithHostOptions(ctx, cfg.HostInfo[endpointName])
+				result := auditHost(hostCtx, cfg.HostInfo[endpointName], cfg.ProxyChainInfo(endpointName), plan.hostFiles[endpointName])
+
+				reportMutex.Lock()
+				report.Hosts = append(report.Hosts, result)
+				reportMutex.Unlock()
+			})
+		}
+	}
+	wg.Wait()
+
+	slices.SortFunc(report.Hosts, func(a, b hostAudit) int {
+		return strings.Compare(string(a.Name), string(b.Name))
+	})
+
+	var failedHosts int
+	for _, result := range report.Hosts {
+		if result.Error != "" {
+			failedHosts++
+		}
+		if len(result.Drift) > 0 {
+			report.Status = metrics.StatusDriftDetected
+		}
+	}
+
+	reportJSON, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		err = fmt.Errorf("failed to marshal audit report JSON: %w", err)
+		return
+	}
+
+	// JSON goes to the summary file instead of stdout when requested
+	if run.jsonSummaryRequested && opts.SummaryFile == "" {
+		logctx.LogStdInfo(ctx, "%s\n", reportJSON)
+	} else {
+		printAuditReport(ctx, report)
+	}
+
+	if opts.SummaryFile != "" {
+		var reportFilePath string
+		reportFilePath, err = fsops.ExpandHomeDirectory(opts.SummaryFile)
+		if err != nil {
+			err = fmt.Errorf("failed to find home directory for '%s': %w", opts.SummaryFile, err)
+			return
+		}
+		err = os.WriteFile(reportFilePath, []byte(logctx.Mask(ctx, string(reportJSON))+"\n"), 0600)
+		if err != nil {
+			err = fmt.Errorf("failed writing audit report file: %w", err)
+			return
+		}
+	}
+
+	status = report.Status
+	if failedHosts > 0 {
+		err = fmt.Errorf("failed to audit %d host(s)", failedHosts)
+		return
+	}
+	return
+}
+
+// Prints the drift of each host as a table
+func printAuditReport(ctx context.Context, report auditReport) {
+	var driftCount int
+	rows := [][]string{{"HOST", "PATH", "DRIFT", "EXPECTED", "ACTUAL"}}
+	for _, result := range report.Hosts {
+		if result.Error != "" {
+			logctx.LogStdErr(ctx, "Host '%s': %s\n", result.Name, result.Error)
+		}
+		for _, drift := range result.Drift {
+			rows = append(rows, []string{string(result.Name), string(drift.Path), drift.Kind, drift.Expected, drift.Actual})
+			driftCount++
+		}
+	}
+
+	if driftCount > 0 {
+		widths := make([]int, len(rows[0]))
+		for _, row := range rows {
+			for column, cell := range row {
+				widths[column] = max(widths[column], len(cell))
+			}
+		}
+		for _, row := range rows {
+			var line strings.Builder
+			for column, cell := range row {
+				if column == len(row)-1 {
+					line.WriteString(cell)
+					break
+				}
+				line.WriteString(cell + strings.Repeat(" ", widths[column]-len(cell)+2))
+			}
+			logctx.LogStdInfo(ctx, "%s\n", strings.TrimRight(line.String(), " "))
+		}
+	}
+
+	var auditedItems int
+	for _, result := range report.Hosts {
+		auditedItems += result.AuditedItems
+	}
+	logctx.LogStdInfo(ctx, "Status: %s. Audited %d item(s) on %d host(s), found %d difference(s)\n", report.Status, auditedItems, len(report.Hosts), driftCount)
+}
+
+// Audits every file planned for a single host, failures are recorded in the result instead of returned
+func auditHost(ctx context.Context, hostInfo config.EndpointInfo, proxyChain []config.EndpointInfo, hostFiles *deployment.HostFiles) (result hostAudit) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	result.Name = hostInfo.EndpointName
+
+	var err error
+	defer func() {
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}()
+
+	var hostMeta sshinternal.HostMeta
+	hostMeta.Name = hostInfo.EndpointName
+	hostMeta.Password = hostInfo.SudoPassword
+
+	var proxyClient *sshinternal.ProxyLease
+	hostMeta.SSHClient, proxyClient, _, err = sshinternal.ConnectToSSH(ctx, hostInfo, proxyChain)
+	if err != nil {
+		err = fmt.Errorf("failed connect to SSH server: %w", err)
+		return
+	}
+	defer func() {
+		if proxyClient != nil {
+			lerr := proxyClient.Close()
+			if err == nil && lerr != nil {
+				err = fmt.Errorf("proxy close: %w", lerr)
+			}
+		}
+		lerr := hostMeta.SSHClient.Close()
+		if err == nil && lerr != nil {
+			err = fmt.Errorf("client close: %w", lerr)
+		}
+	}()
+
+	err = host.DetermineOSFamily(ctx, &hostMeta)
+	if err != nil {
+		return
+	}
+	err = host.ProbeUtilities(ctx, &hostMeta)
+	if err != nil {
+		return
+	}
+	err = host.CheckUtilities(hostMeta)
+	if err != nil {
+		return
+	}
+
+	// Conditions decide which files belong on the host
+	_, factsRequired := hostFiles.FactsRequired()
+	if factsRequired {
+		err = host.GatherFacts(ctx, &hostMeta)
+		if err != nil {
+			return
+		}
+	}
+
+	// Every planned path and its parents belong in managed directories, even when a condition excludes the file
+	var items []deployment.FileInfo
+	expectedPaths := make(map[str.RemotePath]struct{})
+	for _, fileGroup := range hostFiles.Groups {
+		for _, repoFilePath := range fileGroup.GetOrderedList() {
+			info := hostFiles.GetFileInfo(repoFilePath)
+			if info.RepoFilePath == "" {
+				info.RepoFilePath = repoFilePath
+			}
+			if info.TargetFilePath == "" {
+				continue
+			}
+			for expectedPath := path.Clean(string(info.TargetFilePath)); expectedPath != "/" && expectedPath != "."; expectedPath = path.Dir(expectedPath) {
+				expectedPaths[str.RemotePath(expectedPath)] = struct{}{}
+			}
+
+			var conditionMatched bool
+			conditionMatched, err = deployment.EvaluateCondition(info.Condition, hostMeta.Facts)
+			if err != nil {
+				err = fmt.Errorf("file '%s': invalid file condition: %w", repoFilePath, err)
+				return
+			}
+			if !conditionMatched {
+				logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
+					"Not auditing file '%s', condition '%s' is false for this host\n", repoFilePath, info.Condition)
+				continue
+			}
+			items = append(items, info)
+		}
+	}
+
+	var managedDirs []str.RemotePath
+	for _, info := range items {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("stop requested during audit: %w", context.Cause(ctx))
+			return
+		}
+
+		var remoteInfo sshinternal.RemoteFileInfo
+		var audited bool
+		remoteInfo, audited, err = auditRemoteInfo(ctx, hostMeta, info)
+		if err != nil {
+			err = fmt.Errorf("file '%s': %w", info.TargetFilePath, err)
+			return
+		}
+		if !audited {
+			continue
+		}
+		result.AuditedItems++
+
+		result.Drift = append(result.Drift, compareRemote(info, remoteInfo)...)
+		isDirAction := info.Action == deployment.ActionDirCreate || info.Action == deployment.ActionDirModify
+		if isDirAction && remoteInfo.FsType == remote.DirType {
+			managedDirs = append(managedDirs, str.RemotePath(path.Clean(string(info.TargetFilePath))))
+		}
+	}
+
+	// Entries of managed directories that the repository does not know about
+	for _, managedDir := range managedDirs {
+		command := sshinternal.BuildLs(managedDir)
+		command.DisableSudo = opts.DisableSudo
+		command.RunAsUser = opts.RunAsUser
+
+		var listing string
+		listing, err = command.SSHexec(ctx, hostMeta.SSHClient, hostMeta.Password)
+		if err != nil {
+			err = fmt.Errorf("failed to list directory '%s': %w", managedDir, err)
+			return
+		}
+		for _, entry := range extraneousEntries(managedDir, listing, expectedPaths, cfg.BackupSuffix) {
+			result.Drift = append(result.Drift, driftItem{Path: entry, Kind: driftExtraneous, Actual: "present"})
+		}
+	}
+	return
+}
+
+// Retrieves the metadata (and content hash of files) of the remote target of a planned file
+// Items without a remote target to compare (deletions and user metadata) are not audited
+func auditRemoteInfo(ctx context.Context, hostMeta sshinternal.HostMeta, info deployment.FileInfo) (remoteInfo sshinternal.RemoteFileInfo, audited bool, err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	switch info.Action {
+	case deployment.ActionFileCreate, deployment.ActionFileModify,
+		deployment.ActionDirCreate, deployment.ActionDirModify,
+		deployment.ActionSymLinkCreate, deployment.ActionSymLinkModify:
+	default:
+		return
+	}
+	audited = true
+
+	exists, statOutput, err := sshinternal.CheckRemoteFileDirExistence(ctx, hostMeta, info.TargetFilePath)
+	if err != nil || !exists {
+		return
+	}
+	remoteInfo, err = sshinternal.ExtractMetadataFromStat(statOutput)
+	if err != nil {
+		return
+	}
+	remoteInfo.Exists = true
+
+	switch remoteInfo.FsType {
+	case remote.FileEmptyType:
+		remoteInfo.Hash = deployment.EmptyFileHash
+	case remote.FileType:
+		command := sshinternal.BuildHostHash(hostMeta, info.TargetFilePath)
+		command.DisableSudo = opts.DisableSudo
+		command.RunAsUser = opts.RunAsUser
+
+		var hashOutput string
+		hashOutput, err = command.SSHexec(ctx, hostMeta.SSHClient, hostMeta.Password)
+		if err != nil {
+			err = fmt.Errorf("failed to hash remote file: %w", err)
+			return
+		}
+		validHash, hash := parsing.HasHex64Prefix(hashOutput)
+		if !validHash {
+			err = fmt.Errorf("invalid hash received from remote sha256sum command")
+			return
+		}
+		remoteInfo.Hash = str.FileID(hash)
+	}
+	return
+}
+
+// Differences of a remote target from its planned file
+// A missing target or one of the wrong type is reported alone, symbolic links only compare their target
+func compareRemote(info deployment.FileInfo, remoteInfo sshinternal.RemoteFileInfo) (drift []driftItem) {
+	newDrift := func(kind string, expected string, actual string) {
+		drift = append(drift, driftItem{Path: info.TargetFilePath, RepoFile: info.RepoFilePath, Kind: kind, Expected: expected, Actual: actual})
+	}
+
+	var expectedType string
+	switch info.Action {
+	case deployment.ActionDirCreate, deployment.ActionDirModify:
+		expectedType = remote.DirType
+	case deployment.ActionSymLinkCreate, deployment.ActionSymLinkModify:
+		expectedType = remote.SymlinkType
+	default:
+		expectedType = remote.FileType
+	}
+
+	if !remoteInfo.Exists {
+		newDrift(driftMissing, expectedType, "not present")
+		return
+	}
+
+	remoteType := remoteInfo.FsType
+	if remoteType == remote.FileEmptyType {
+		remoteType = remote.FileType
+	}
+	if remoteType != expectedType {
+		newDrift(driftType, expectedType, remoteType)
+		return
+	}
+
+	if expectedType == remote.SymlinkType {
+		if remoteInfo.LinkTarget != info.LinkTarget {
+			newDrift(driftLinkTarget, string(info.LinkTarget), string(remoteInfo.LinkTarget))
+		}
+		return
+	}
+
+	if expectedType == remote.FileType && remoteInfo.Hash != info.Hash {
+		newDrift(driftContent, "sha256 "+string(info.Hash), "sha256 "+string(remoteInfo.Hash))
+	}
+	remoteOwnerGroup := remoteInfo.Owner + ":" + remoteInfo.Group
+	if info.OwnerGroup != "" && remoteOwnerGroup != info.OwnerGroup {
+		newDrift(driftOwner, info.OwnerGroup, remoteOwnerGroup)
+	}
+	if info.Permissions != 0 && remoteInfo.Permissions != info.Permissions {
+		newDrift(driftPermissions, strconv.Itoa(info.Permissions), strconv.Itoa(remoteInfo.Permissions))
+	}
+	return
+}
+
+// Entries of a directory listing (ls -A) that are not planned paths or their parents
+// Deployment backups of planned files (sibling backup directory and suffix backups) are not extraneous
+func extraneousEntries(dir str.RemotePath, listing string, expectedPaths map[str.RemotePath]struct{}, backupSuffix string) (entries []str.RemotePath) {
+	for _, name := range strings.Split(strings.ReplaceAll(listing, "\r", ""), "\n") {
+		if name == "" || name == sshinternal.SiblingBackupDir {
+			continue
+		}
+
+		entryPath := str.RemotePath(path.Join(string(dir), name))
+		if _, expected := expectedPaths[entryPath]; expected {
+			continue
+		}
+		if backupSuffix != "" {
+			backupOf, isBackup := strings.CutSuffix(string(entryPath), backupSuffix)
+			if _, expected := expectedPaths[str.RemotePath(backupOf)]; isBackup && expected {
+				continue
+			}
+		}
+		entries = append(entries, entryPath)
+	}
+	slices.Sort(entries)
+	return
+}
@@ -0,0 +1,64 @@
+package local
+
+import (
+	"scmp/core/deployment"
+	"scmp/core/deployment/remote"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"slices"
+	"testing"
+)
+
+func TestCompareRemote(t *testing.T) {
+	file := deployment.FileInfo{
+		RepoFilePath:   "host1/etc/hosts",
+		TargetFilePath: "/etc/hosts",
+		Action:         deployment.ActionFileCreate,
+		Hash:           "aaaa",
+		OwnerGroup:     "root:root",
+		Permissions:    644,
+	}
+	matching := sshinternal.RemoteFileInfo{Exists: true, FsType: remote.FileType, Hash: "aaaa", Owner: "root", Group: "root", Permissions: 644}
+
+	tests := []struct {
+		name       string
+		info       deployment.FileInfo
+		remoteInfo sshinternal.RemoteFileInfo
+		expected   []string
+	}{
+		{"matching file", file, matching, nil},
+		{"missing file", file, sshinternal.RemoteFileInfo{}, []string{driftMissing}},
+		{"directory instead of file", file, sshinternal.RemoteFileInfo{Exists: true, FsType: remote.DirType}, []string{driftType}},
+		{"content owner and permissions", file, sshinternal.RemoteFileInfo{Exists: true, FsType: remote.FileType, Hash: "bbbb", Owner: "user", Group: "root", Permissions: 600}, []string{driftContent, driftOwner, driftPermissions}},
+		{"empty remote file", deployment.FileInfo{Action: deployment.ActionFileCreate, Hash: deployment.EmptyFileHash}, sshinternal.RemoteFileInfo{Exists: true, FsType: remote.FileEmptyType, Hash: deployment.EmptyFileHash, Owner: "root", Group: "root"}, nil},
+		{"directory permissions", deployment.FileInfo{Action: deployment.ActionDirModify, OwnerGroup: "root:root", Permissions: 755}, sshinternal.RemoteFileInfo{Exists: true, FsType: remote.DirType, Owner: "root", Group: "root", Permissions: 700}, []string{driftPermissions}},
+		{"symbolic link target", deployment.FileInfo{Action: deployment.ActionSymLinkCreate, LinkTarget: "/etc/a"}, sshinternal.RemoteFileInfo{Exists: true, FsType: remote.SymlinkType, LinkTarget: "/etc/b"}, []string{driftLinkTarget}},
+	}
+
+	for _, test := range tests {
+		var kinds []string
+		for _, drift := range compareRemote(test.info, test.remoteInfo) {
+			kinds = append(kinds, drift.Kind)
+		}
+		if !slices.Equal(kinds, test.expected) {
+			t.Errorf("%s: expected drift %v, got %v", test.name, test.expected, kinds)
+		}
+	}
+}
+
+func TestExtraneousEntries(t *testing.T) {
+	expectedPaths := map[str.RemotePath]struct{}{
+		"/etc":                      {},
+		"/etc/nginx":                {},
+		"/etc/nginx/nginx.conf":     {},
+		"/etc/nginx/sites":          {},
+		"/etc/nginx/sites/site.cfg": {},
+	}
+	listing := "nginx.conf\r\nsites\nnginx.conf.bak\n" + sshinternal.SiblingBackupDir + "\nmime.types\nold.conf.bak\n"
+
+	entries := extraneousEntries("/etc/nginx", listing, expectedPaths, ".bak")
+	expected := []str.RemotePath{"/etc/nginx/mime.types", "/etc/nginx/old.conf.bak"}
+	if !slices.Equal(entries, expected) {
+		t.Errorf("expected extraneous entries %v, got %v", expected, entries)
+	}
+}
@@ -0,0 +1,127 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/secrets"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"strings"
+	"time"
+)
+
+// Copies every file of an archived deployment back to its target path on a host
+// Files keep the owner, group, and permissions they had when backed up, reload commands are not run
+func RestoreBackupArchive(ctx context.Context, hostName string, archiveID string) (err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	_, err = time.Parse(sshinternal.BackupArchiveIDFormat, archiveID)
+	if err != nil {
+		err = fmt.Errorf("invalid backup archive '%s', expected the deployment timestamp of its directory (like %s)", archiveID, sshinternal.BackupArchiveIDFormat)
+		return
+	}
+
+	endpointName := str.RepoRootDir(hostName)
+	hostInfo, hostExists := cfg.HostInfo[endpointName]
+	if !hostExists {
+		err = fmt.Errorf("host '%s' does not exist in config", hostName)
+		return
+	}
+
+	hostInfo, err = secrets.GetHostValues(ctx, hostInfo)
+	if err != nil {
+		err = fmt.Errorf("error retrieving host secrets: %w", err)
+		return
+	}
+	cfg.HostInfo[endpointName] = hostInfo
+	err = secrets.GetProxyValues(ctx, cfg.HostInfo, endpointName)
+	if err != nil {
+		err = fmt.Errorf("error retrieving proxy secrets: %w", err)
+		return
+	}
+
+	var hostMeta sshinternal.HostMeta
+	hostMeta.Name = hostInfo.EndpointName
+	hostMeta.Password = hostInfo.SudoPassword
+
+	var proxyClient *sshinternal.ProxyLease
+	hostMeta.SSHClient, proxyClient, _, err = sshinternal.ConnectToSSH(ctx, hostInfo, cfg.ProxyChainInfo(endpointName))
+	if err != nil {
+		err = fmt.Errorf("failed connect to SSH server: %w", err)
+		return
+	}
+	defer func() {
+		if proxyClient != nil {
+			lerr := proxyClient.Close()
+			if err == nil && lerr != nil {
+				err = fmt.Errorf("proxy close: %w", lerr)
+			}
+		}
+		lerr := hostMeta.SSHClient.Close()
+		if err == nil && lerr != nil {
+			err = fmt.Errorf("client close: %w", lerr)
+		}
+	}()
+
+	archivePath := str.RemotePath(cfg.BackupDirectory + "/" + archiveID)
+	command := sshinternal.BuildFindFiles(archivePath)
+	command.DisableSudo = opts.DisableSudo
+	command.RunAsUser = opts.RunAsUser
+	findOutput, err := command.SSHexec(ctx, hostMeta.SSHClient, hostMeta.Password)
+	if err != nil {
+		err = fmt.Errorf("failed to list backup archive '%s' on host '%s': %w", archivePath, hostName, err)
+		return
+	}
+
+	backups, targets := archivedFiles(archivePath, findOutput)
+	if len(backups) == 0 {
+		err = fmt.Errorf("backup archive '%s' on host '%s' has no files", archivePath, hostName)
+		return
+	}
+
+	var restored, failed int
+	for index, backupPath := range backups {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("stop requested during backup restore: %w", context.Cause(ctx))
+			return
+		}
+
+		command = sshinternal.BuildCp(backupPath, targets[index])
+		command.DisableSudo = opts.DisableSudo
+		command.RunAsUser = opts.RunAsUser
+		_, err = command.SSHexec(sshinternal.WithPhase(ctx, sshinternal.PhaseRestore), hostMeta.SSHClient, hostMeta.Password)
+		if err != nil {
+			logctx.LogStdErr(ctx, "Failed restoring '%s': %v\n", targets[index], err)
+			failed++
+			err = nil
+			continue
+		}
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Restored '%s'\n", targets[index])
+		restored++
+	}
+
+	logctx.LogStdInfo(ctx, "Restored %d of %d file(s) on host '%s' from backup archive '%s'\n", restored, len(backups), hostName, archiveID)
+	if failed > 0 {
+		err = fmt.Errorf("failed to restore %d file(s)", failed)
+		return
+	}
+	return
+}
+
+// Backup files listed by find below the archive directory and the target paths they were backed up from
+func archivedFiles(archivePath str.RemotePath, findOutput string) (backups []str.RemotePath, targets []str.RemotePath) {
+	for _, line := range strings.Split(strings.ReplaceAll(findOutput, "\r", ""), "\n") {
+		targetPath, inArchive := strings.CutPrefix(line, string(archivePath)+"/")
+		if !inArchive || targetPath == "" {
+			continue
+		}
+		backups = append(backups, str.RemotePath(line))
+		targets = append(targets, str.RemotePath(path.Clean("/"+targetPath)))
+	}
+	return
+}
@@ -0,0 +1,22 @@
+package local
+
+import (
+	"scmp/internal/str"
+	"slices"
+	"testing"
+)
+
+func TestArchivedFiles(t *testing.T) {
+	archivePath := str.RemotePath("/var/backups/scmp/20261017T142501Z")
+	findOutput := "/var/backups/scmp/20261017T142501Z/etc/nginx/nginx.conf\n" +
+		"/var/backups/scmp/20261017T142501Z/etc/hosts\r\n" +
+		"find: '/var/backups/scmp/other': Permission denied\n"
+
+	backups, targets := archivedFiles(archivePath, findOutput)
+	if !slices.Equal(targets, []str.RemotePath{"/etc/nginx/nginx.conf", "/etc/hosts"}) {
+		t.Errorf("unexpected targets %v", targets)
+	}
+	if len(backups) != 2 || backups[1] != "/var/backups/scmp/20261017T142501Z/etc/hosts" {
+		t.Errorf("unexpected backups %v", backups)
+	}
+}
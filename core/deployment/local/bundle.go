@@ -0,0 +1,542 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"scmp/core/deployment"
+	"scmp/core/deployment/events"
+	"scmp/core/deployment/metrics"
+	"scmp/core/deployment/predeploy"
+	"scmp/internal/config"
+	"scmp/internal/config/sshconfig"
+	"scmp/internal/crypto"
+	"scmp/internal/fsops"
+	"scmp/internal/gitinternal"
+	"scmp/internal/global"
+	"scmp/internal/input"
+	"scmp/internal/logctx"
+	"scmp/internal/parsing"
+	"scmp/internal/secrets"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Packages the deployment of a commit into a bundle file deployable without the repository or config file
+// Uses the same planning as a deployment, host files are bundled after DRN resolution and template rendering
+// The vault password keys the bundle HMAC and encrypts credentials and encrypted content inside the bundle
+func CreateBundle(ctx context.Context, commitID string, hostOverride string, fileOverride string, bundlePath string, allFiles bool) (err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSDeploy)
+
+	if bundlePath == "" {
+		err = fmt.Errorf("bundle creation requires an output file")
+		return
+	}
+	err = validateBundleFileName(bundlePath)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", deployment.ErrInvalidOptions, err)
+		return
+	}
+	bundlePath, err = fsops.ExpandHomeDirectory(bundlePath)
+	if err != nil {
+		err = fmt.Errorf("failed to find home directory for '%s': %w", bundlePath, err)
+		return
+	}
+	if fsops.FileExists(bundlePath) {
+		err = fmt.Errorf("bundle file '%s' already exists", bundlePath)
+		return
+	}
+
+	hostOverride, err = parsing.RetrieveURIFile(ctx, hostOverride)
+	if err != nil {
+		err = fmt.Errorf("failed to parse remote-hosts URI: %w", err)
+		return
+	}
+	fileOverride, err = parsing.RetrieveURIFile(ctx, fileOverride)
+	if err != nil {
+		err = fmt.Errorf("failed to parse local-files URI: %w", err)
+		return
+	}
+	err = validateOverrides(opts, hostOverride, fileOverride)
+	if err != nil {
+		return
+	}
+
+	var branch string
+	if commitID == "" {
+		branch, commitID, err = gitinternal.GetHead(ctx)
+		if err != nil {
+			err = fmt.Errorf("error retrieving HEAD details: %w", err)
+			return
+		}
+	}
+
+	deployMode := deployment.ModeDiff
+	if allFiles {
+		deployMode = deployment.ModeAll
+	}
+
+	plan, _, err := planDeployment(ctx, nil, deployMode, branch, commitID, cfg.HostInfo, hostOverride, fileOverride, metrics.Summary{})
+	if err != nil {
+		return
+	}
+	if len(plan.hosts) == 0 {
+		err = fmt.Errorf("no deployment files for the selected hosts from %s, bundle not created", plan.source())
+		return
+	}
+
+	vaultPassword, err := secrets.UnlockVaultPassword(ctx)
+	if err != nil {
+		err = fmt.Errorf("bundles are protected with the vault password: %w", err)
+		return
+	}
+
+	err = writeBundle(ctx, bundlePath, plan, vaultPassword)
+	if err != nil {
+		return
+	}
+
+	logctx.LogStdInfo(ctx, "Bundled %d item(s) for %d host(s) from %s into '%s'\n", plan.deployFiles.Count(), len(plan.hosts), plan.source(), bundlePath)
+	return
+}
+
+// Writes the planned hosts, their files and content, and the host config (and vault entries) needed to connect to them
+func writeBundle(ctx context.Context, bundlePath string, plan deploymentPlan, vaultPassword []byte) (err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	manifest := bundleManifest{
+		Version:         bundleFormatVersion,
+		Salt:            make([]byte, bundleSaltSize),
+		Created:         time.Now().UTC().Truncate(time.Second),
+		Branch:          plan.branch,
+		CommitID:        plan.commitID,
+		Hosts:           slices.Sorted(slices.Values(plan.hosts)),
+		Endpoints:       make(map[str.RepoRootDir]bundleEndpoint),
+		PhaseAbort:      cfg.PhaseAbort,
+		BackupSuffix:    cfg.BackupSuffix,
+		BackupDirectory: cfg.BackupDirectory,
+		BackupRetention: cfg.BackupRetention,
+		StreamThreshold: cfg.StreamThreshold,
+	}
+	_, err = rand.Read(manifest.Salt)
+	if err != nil {
+		err = fmt.Errorf("failed to generate bundle salt: %w", err)
+		return
+	}
+
+	// Proxy hops are connected through, they need their config (and credentials) as well
+	var vaultEntries []str.RepoRootDir
+	for _, endpointName := range manifest.Hosts {
+		for _, name := range append([]str.RepoRootDir{endpointName}, cfg.HostInfo[endpointName].ProxyChain...) {
+			if _, alreadyAdded := manifest.Endpoints[name]; alreadyAdded {
+				continue
+			}
+			manifest.Endpoints[name] = newBundleEndpoint(cfg.HostInfo[name])
+			if cfg.HostInfo[name].RequiresVault {
+				vaultEntries = append(vaultEntries, name)
+			}
+		}
+	}
+
+	// Content is shared by hosts with the same hash, encrypted repository content stays encrypted in the bundle
+	contentData := make(map[str.FileID][]byte)
+	contentStreams := make(map[str.FileID]deployment.StreamedContent)
+	encryptedContent := make(map[str.FileID]struct{})
+	var hostManifests []bundleHostManifest
+	for _, endpointName := range manifest.Hosts {
+		hostFiles := plan.hostFiles[endpointName]
+		hostManifest := bundleHostManifest{
+			Host:  endpointName,
+			Files: make(map[str.LocalRepoPath]deployment.FileInfo),
+		}
+		for _, repoFilePath := range hostFiles.GetUnorderedList() {
+			info := hostFiles.GetFileInfo(repoFilePath)
+			hostManifest.Files[repoFilePath] = info
+			if !bundleFileHasContent(info.Action) {
+				continue
+			}
+
+			if info.Encrypted {
+				encryptedContent[info.Hash] = struct{}{}
+			}
+			stream, isStreamed := hostFiles.GetFileStream(info.Hash)
+			if isStreamed {
+				contentStreams[info.Hash] = stream
+			} else {
+				contentData[info.Hash] = hostFiles.GetFileData(info.Hash)
+			}
+		}
+		hostManifests = append(hostManifests, hostManifest)
+	}
+	manifest.EncryptedContent = slices.Sorted(maps.Keys(encryptedContent))
+
+	writer, err := createBundleWriter(bundlePath, crypto.NewPasswordMAC(vaultPassword, manifest.Salt), manifest.Created)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			writer.abort()
+		}
+	}()
+
+	err = writer.addJSON(bundleManifestFile, manifest)
+	if err != nil {
+		return
+	}
+	for _, hostManifest := range hostManifests {
+		err = writer.addJSON(bundleHostsDirectory+string(hostManifest.Host)+bundleHostFileExt, hostManifest)
+		if err != nil {
+			return
+		}
+	}
+
+	if len(vaultEntries) > 0 {
+		var lockedVault []byte
+		lockedVault, err = secrets.LockVaultEntries(ctx, vaultEntries, vaultPassword)
+		if err != nil {
+			return
+		}
+		err = writer.add(bundleVaultFile, int64(len(lockedVault)), bytes.NewReader(lockedVault))
+		if err != nil {
+			return
+		}
+	}
+
+	for _, contentID := range slices.Sorted(maps.Keys(contentStreams)) {
+		err = writer.addFile(bundleContentDirectory+string(contentID), contentStreams[contentID].LocalPath)
+		if err != nil {
+			err = fmt.Errorf("failed bundling content '%s': %w", contentID, err)
+			return
+		}
+	}
+	for _, contentID := range slices.Sorted(maps.Keys(contentData)) {
+		content := contentData[contentID]
+		if _, isEncrypted := encryptedContent[contentID]; isEncrypted {
+			content, err = secrets.EncryptContent(content, vaultPassword)
+			if err != nil {
+				return
+			}
+		}
+		err = writer.add(bundleContentDirectory+string(contentID), int64(len(content)), bytes.NewReader(content))
+		if err != nil {
+			return
+		}
+	}
+
+	err = writer.close()
+	return
+}
+
+// Deploys the hosts of a bundle selected by the host override, using the host config carried in the bundle
+// Runs the same deployment as a repository deployment, failures are not recorded for retries (retries need the repository)
+func StartBundleDeploy(ctx context.Context, bundlePath string, hostOverride string) (status string, err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSDeploy)
+
+	hostOverride, err = parsing.RetrieveURIFile(ctx, hostOverride)
+	if err != nil {
+		err = fmt.Errorf("%w: failed to parse remote-hosts URI: %w", deployment.ErrInvalidOptions, err)
+		return
+	}
+	err = validateOverrides(opts, hostOverride, "")
+	if err != nil {
+		err = fmt.Errorf("%w: %w", deployment.ErrInvalidOptions, err)
+		return
+	}
+
+	if opts.AllBranches {
+		err = fmt.Errorf("%w: bundles deploy a single commit and cannot deploy all branches", deployment.ErrInvalidOptions)
+		return
+	}
+	rolloutRequested, failOnSkipped, jsonSummaryRequested, err := validateDeployOptions(config.Config{}, opts, deployment.ModeAll, "")
+	if err != nil {
+		err = fmt.Errorf("%w: %w", deployment.ErrInvalidOptions, err)
+		return
+	}
+	if len(failOnSkipped) > 0 {
+		logctx.LogStdWarn(ctx, "Files were skipped when the bundle was created, fail-on-skipped has no effect on bundle deployments\n")
+	}
+
+	if bundlePath == "" {
+		err = fmt.Errorf("%w: bundle deployment requires a bundle file", deployment.ErrInvalidOptions)
+		return
+	}
+	bundlePath, err = fsops.ExpandHomeDirectory(bundlePath)
+	if err != nil {
+		err = fmt.Errorf("failed to find home directory for '%s': %w", bundlePath, err)
+		return
+	}
+	if !fsops.FileExists(bundlePath) {
+		err = fmt.Errorf("bundle file '%s' does not exist", bundlePath)
+		return
+	}
+
+	var eventStream *events.Writer
+	if opts.EventStream != "" {
+		eventStream, err = events.Open(ctx, opts.EventStream, uuid.New().String())
+		if err != nil {
+			return
+		}
+	}
+	defer func() {
+		details := status
+		if err != nil {
+			details = err.Error()
+		}
+		eventStream.Emit(events.DeploymentFinished, "", "", details)
+		lerr := eventStream.Close()
+		if err == nil && lerr != nil {
+			err = fmt.Errorf("failed writing deployment events: %w", lerr)
+		}
+	}()
+
+	// Content stays on disk for the whole deployment (large content is streamed from it)
+	contentDirectory, err := os.MkdirTemp("", "scmp-bundle-*")
+	if err != nil {
+		err = fmt.Errorf("failed to create bundle content directory: %w", err)
+		return
+	}
+	defer func() {
+		_ = os.RemoveAll(contentDirectory)
+	}()
+
+	vaultPassword, err := input.AskUserSecret(ctx, "Enter password for vault", "")
+	if err != nil {
+		return
+	}
+	bundle, err := readBundle(bundlePath, vaultPassword, contentDirectory)
+	if err != nil {
+		return
+	}
+
+	ctx, err = sshconfig.SetEmbedded(ctx, bundle.config())
+	if err != nil {
+		err = fmt.Errorf("invalid bundle host config: %w", err)
+		return
+	}
+	if len(bundle.lockedVault) > 0 {
+		err = secrets.UnlockVaultEntries(ctx, bundle.lockedVault, vaultPassword)
+		if err != nil {
+			err = fmt.Errorf("failed opening bundle vault entries: %w", err)
+			return
+		}
+	}
+
+	plan, err := bundlePlan(ctx, bundle, vaultPassword, hostOverride)
+	if err != nil {
+		return
+	}
+	logctx.LogStdInfo(ctx, "Bundle of %s created %s\n", plan.source(), bundle.manifest.Created.Local().Format(time.RFC1123))
+
+	// State cache is shared with repository deployments of this user
+	failTrackerFilePath, err := fsops.ExpandHomeDirectory(filepath.Join(filepath.Dir(sshinternal.DefaultConfigPath), deployment.FailTrackerFile))
+	if err != nil {
+		err = fmt.Errorf("failed to find home directory for '%s': %w", failTrackerFilePath, err)
+		return
+	}
+
+	run := &deploymentRun{
+		plans:                []deploymentPlan{plan},
+		deployBranch:         plan.branch,
+		commitID:             plan.commitID,
+		hostOverride:         hostOverride,
+		rolloutRequested:     rolloutRequested,
+		jsonSummaryRequested: jsonSummaryRequested,
+		eventStream:          eventStream,
+		failTrackerFilePath:  failTrackerFilePath,
+	}
+	_, status, err = run.deploy(ctx)
+	return
+}
+
+// Rebuilds the deployment plan of the bundle hosts selected by the host override
+func bundlePlan(ctx context.Context, bundle openedBundle, vaultPassword []byte, hostOverride string) (plan deploymentPlan, err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	plan.branch = bundle.manifest.Branch
+	plan.commitID = bundle.manifest.CommitID
+	plan.deployFiles = deployment.NewAllFiles()
+	plan.hostFiles = make(map[str.RepoRootDir]*deployment.HostFiles)
+
+	encryptedContent := make(map[str.FileID]struct{})
+	for _, contentID := range bundle.manifest.EncryptedContent {
+		encryptedContent[contentID] = struct{}{}
+	}
+
+	// Decrypted content is loaded once and copied to every host using it
+	loadedContent := make(map[str.FileID][]byte)
+
+	for _, endpointName := range bundle.manifest.Hosts {
+		if parsing.CheckForOverride(ctx, hostOverride, string(endpointName), cfg.HostInfo) {
+			continue
+		}
+
+		var hostFiles *deployment.HostFiles
+		hostFiles, err = deployment.NewHostFiles()
+		if err != nil {
+			return
+		}
+
+		files := bundle.hosts[endpointName].Files
+		for _, repoFilePath := range slices.Sorted(maps.Keys(files)) {
+			info := files[repoFilePath]
+			hostFiles.SetFileMetadata(repoFilePath, info)
+			plan.deployFiles.AddMetadata(repoFilePath, info)
+			if !bundleFileHasContent(info.Action) {
+				continue
+			}
+
+			localPath := filepath.Join(bundle.contentDirectory, string(info.Hash))
+			contentInfo, lerr := os.Stat(localPath)
+			if lerr != nil {
+				err = fmt.Errorf("host '%s': bundle has no content for '%s'", endpointName, repoFilePath)
+				return
+			}
+
+			_, isEncrypted := encryptedContent[info.Hash]
+			if !isEncrypted && contentInfo.Size() > bundle.manifest.StreamThreshold {
+				hostFiles.StoreStreamOnce(info.Hash, deployment.StreamedContent{LocalPath: localPath, Size: contentInfo.Size()})
+				continue
+			}
+
+			content, loaded := loadedContent[info.Hash]
+			if !loaded {
+				content, err = os.ReadFile(localPath)
+				if err != nil {
+					err = fmt.Errorf("failed reading bundle content of '%s': %w", repoFilePath, err)
+					return
+				}
+				if isEncrypted {
+					content, err = secrets.DecryptContent(content, vaultPassword)
+					if err != nil {
+						err = fmt.Errorf("file '%s': %w", repoFilePath, err)
+						return
+					}
+				}
+				loadedContent[info.Hash] = content
+			}
+			hostFiles.StoreDataOnce(info.Hash, bytes.Clone(content))
+		}
+
+		plan.hosts = append(plan.hosts, endpointName)
+		plan.hostFiles[endpointName] = hostFiles
+	}
+	if len(plan.hosts) == 0 {
+		err = fmt.Errorf("no bundle hosts match the selected hosts (bundle hosts: %s)", strings.Join(str.ToStrings(bundle.manifest.Hosts), ", "))
+		return
+	}
+
+	err = predeploy.SortFiles(ctx, plan.hostFiles)
+	if err != nil {
+		err = fmt.Errorf("failed sorting bundle files: %w", err)
+		return
+	}
+	return
+}
+
+// Configuration of the bundle hosts, replacing the config file for bundle deployments
+func (bundle openedBundle) config() (cfg config.Config) {
+	cfg.PhaseAbort = bundle.manifest.PhaseAbort
+	cfg.BackupSuffix = bundle.manifest.BackupSuffix
+	cfg.BackupDirectory = bundle.manifest.BackupDirectory
+	cfg.BackupRetention = bundle.manifest.BackupRetention
+	cfg.StreamThreshold = bundle.manifest.StreamThreshold
+	cfg.HostInfo = make(map[str.RepoRootDir]config.EndpointInfo)
+	for endpointName, endpoint := range bundle.manifest.Endpoints {
+		cfg.HostInfo[endpointName] = endpoint.endpointInfo(endpointName)
+	}
+	return
+}
+
+// Only created and modified files (and user metadata) have content to transfer
+func bundleFileHasContent(action str.DeployAction) (hasContent bool) {
+	hasContent = action == deployment.ActionFileCreate || action == deployment.ActionFileModify || action == deployment.ActionAccountsApply
+	return
+}
+
+func newBundleEndpoint(hostInfo config.EndpointInfo) (endpoint bundleEndpoint) {
+	endpoint = bundleEndpoint{
+		Endpoint:          hostInfo.Endpoint,
+		FallbackEndpoints: hostInfo.FallbackEndpoints,
+		AddressFamily:     hostInfo.AddressFamily,
+		User:              hostInfo.EndpointUser,
+		IdentityFile:      homeRelativePath(hostInfo.IdentityFile),
+		PasswordRequired:  hostInfo.RequiresVault,
+		PasswordCommand:   hostInfo.PasswordCommand,
+		PasswordEnv:       hostInfo.PasswordEnv,
+		ConnectTimeout:    hostInfo.ConnectTimeout,
+		ConnectAttempts:   hostInfo.ConnectAttempts,
+		ConnectRetryDelay: hostInfo.ConnectRetryDelay,
+		HostDeadline:      hostInfo.HostDeadline,
+		Snapshot:          hostInfo.Snapshot,
+		RequireConfirm:    hostInfo.RequireConfirm,
+		RequestTTY:        hostInfo.RequestTTY,
+		ProxyJump:         hostInfo.Proxy,
+		ProxyChain:        hostInfo.ProxyChain,
+		Groups:            slices.Sorted(maps.Keys(hostInfo.UniversalGroups)),
+		Overrides:         hostInfo.Overrides,
+	}
+	return
+}
+
+func (endpoint bundleEndpoint) endpointInfo(endpointName str.RepoRootDir) (hostInfo config.EndpointInfo) {
+	hostInfo = config.EndpointInfo{
+		EndpointName:      endpointName,
+		Endpoint:          endpoint.Endpoint,
+		FallbackEndpoints: endpoint.FallbackEndpoints,
+		AddressFamily:     endpoint.AddressFamily,
+		EndpointUser:      endpoint.User,
+		IdentityFile:      endpoint.IdentityFile,
+		RequiresVault:     endpoint.PasswordRequired,
+		PasswordCommand:   endpoint.PasswordCommand,
+		PasswordEnv:       endpoint.PasswordEnv,
+		ConnectTimeout:    endpoint.ConnectTimeout,
+		ConnectAttempts:   endpoint.ConnectAttempts,
+		ConnectRetryDelay: endpoint.ConnectRetryDelay,
+		HostDeadline:      endpoint.HostDeadline,
+		Snapshot:          endpoint.Snapshot,
+		RequireConfirm:    endpoint.RequireConfirm,
+		RequestTTY:        endpoint.RequestTTY,
+		Proxy:             endpoint.ProxyJump,
+		ProxyChain:        endpoint.ProxyChain,
+		UniversalGroups:   make(map[str.RepoRootDir]struct{}),
+		Overrides:         endpoint.Overrides,
+	}
+	for _, group := range endpoint.Groups {
+		hostInfo.UniversalGroups[group] = struct{}{}
+	}
+
+	// Home directory of the deploying user
+	expandedPath, err := fsops.ExpandHomeDirectory(hostInfo.IdentityFile)
+	if err == nil {
+		hostInfo.IdentityFile = expandedPath
+	}
+	return
+}
+
+// Path inside the home directory as ~/ path, so it resolves against the home directory of whoever deploys the bundle
+func homeRelativePath(path string) (relativePath string) {
+	relativePath = path
+	homeDirectory, err := os.UserHomeDir()
+	if err != nil || homeDirectory == "" {
+		return
+	}
+	if strings.HasPrefix(path, homeDirectory+string(os.PathSeparator)) {
+		relativePath = "~/" + strings.TrimPrefix(path, homeDirectory+string(os.PathSeparator))
+	}
+	return
+}
@@ -0,0 +1,248 @@
+package local
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/secrets"
+	"scmp/internal/str"
+	"testing"
+)
+
+func testBundlePlan(t *testing.T) (ctx context.Context, plan deploymentPlan) {
+	ctx = context.Background()
+	ctx = context.WithValue(ctx, global.OpsKey, config.Opts{})
+	ctx = context.WithValue(ctx, global.ConfKey, config.Config{
+		StreamThreshold: 16,
+		HostInfo: map[str.RepoRootDir]config.EndpointInfo{
+			"host1":   {EndpointName: "host1", Endpoint: "10.0.0.1:22", EndpointUser: "deployer", RequiresVault: true, Proxy: "bastion", ProxyChain: []str.RepoRootDir{"bastion"}, UniversalGroups: map[str.RepoRootDir]struct{}{"UniversalConfs": {}}},
+			"host2":   {EndpointName: "host2", Endpoint: "10.0.0.2:22", EndpointUser: "deployer", UniversalGroups: map[str.RepoRootDir]struct{}{"UniversalConfs": {}}},
+			"bastion": {EndpointName: "bastion", Endpoint: "10.0.0.9:22", EndpointUser: "jump", RequiresVault: true},
+			"host3":   {EndpointName: "host3", Endpoint: "10.0.0.3:22", RequiresVault: true},
+		},
+		Vault: map[str.RepoRootDir]config.Credential{
+			"host1":   {LoginPassword: "host1-login", SudoPassword: "host1-sudo"},
+			"bastion": {LoginPassword: "bastion-login"},
+			"host3":   {LoginPassword: "host3-login"},
+		},
+	})
+
+	streamedPath := filepath.Join(t.TempDir(), "large")
+	err := os.WriteFile(streamedPath, []byte("large content over the stream threshold"), 0600)
+	if err != nil {
+		t.Fatalf("failed writing streamed content: %v", err)
+	}
+
+	plan = deploymentPlan{
+		branch:      "main",
+		commitID:    "abc123",
+		deployFiles: deployment.NewAllFiles(),
+		hosts:       []str.RepoRootDir{"host1", "host2"},
+		hostFiles:   make(map[str.RepoRootDir]*deployment.HostFiles),
+	}
+	for _, endpointName := range plan.hosts {
+		hostFiles, err := deployment.NewHostFiles()
+		if err != nil {
+			t.Fatalf("unexpected hostfiles create failure: %v", err)
+		}
+		files := map[str.LocalRepoPath]deployment.FileInfo{
+			"UniversalConfs/etc/app.conf":   {TargetFilePath: "/etc/app.conf", Action: deployment.ActionFileModify, Hash: "hash1", Reload: []string{"systemctl restart app"}},
+			"UniversalConfs/etc/secret":     {TargetFilePath: "/etc/secret", Action: deployment.ActionFileCreate, Hash: "hash2", Encrypted: true},
+			"UniversalConfs/opt/large":      {TargetFilePath: "/opt/large", Action: deployment.ActionFileCreate, Hash: "hash3"},
+			"UniversalConfs/etc/old.conf":   {TargetFilePath: "/etc/old.conf", Action: deployment.ActionFileDelete},
+			str.LocalRepoPath(endpointName): {TargetFilePath: "/srv", Action: deployment.ActionDirCreate},
+		}
+		for repoFilePath, info := range files {
+			info.RepoFilePath = repoFilePath
+			hostFiles.SetFileMetadata(repoFilePath, info)
+			plan.deployFiles.AddMetadata(repoFilePath, info)
+		}
+		hostFiles.StoreDataOnce("hash1", []byte("small\n"))
+		hostFiles.StoreDataOnce("hash2", []byte("secret\n"))
+		hostFiles.StoreStreamOnce("hash3", deployment.StreamedContent{LocalPath: streamedPath, Size: 39})
+		plan.hostFiles[endpointName] = hostFiles
+	}
+	return
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	ctx, plan := testBundlePlan(t)
+	vaultPassword := []byte("vault password")
+
+	bundlePath := filepath.Join(t.TempDir(), "deploy.bundle")
+	err := writeBundle(ctx, bundlePath, plan, vaultPassword)
+	if err != nil {
+		t.Fatalf("unexpected bundle write failure: %v", err)
+	}
+	err = writeBundle(ctx, bundlePath, plan, vaultPassword)
+	if err == nil {
+		t.Errorf("expected existing bundle file to be refused")
+	}
+
+	bundle, err := readBundle(bundlePath, vaultPassword, t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected bundle read failure: %v", err)
+	}
+	if bundle.manifest.CommitID != "abc123" || bundle.manifest.Branch != "main" || len(bundle.manifest.Hosts) != 2 {
+		t.Errorf("unexpected bundle manifest: %+v", bundle.manifest)
+	}
+	if _, hasProxy := bundle.manifest.Endpoints["bastion"]; !hasProxy || len(bundle.manifest.Endpoints) != 3 {
+		t.Errorf("expected bundled hosts and their proxy, got %d endpoint(s)", len(bundle.manifest.Endpoints))
+	}
+
+	// Rebuild the deployment from the bundle alone
+	bundleCtx := context.WithValue(context.Background(), global.OpsKey, config.Opts{})
+	cfg := bundle.config()
+	cfg.Vault = make(map[str.RepoRootDir]config.Credential)
+	bundleCtx = context.WithValue(bundleCtx, global.ConfKey, cfg)
+
+	err = secrets.UnlockVaultEntries(bundleCtx, bundle.lockedVault, vaultPassword)
+	if err != nil {
+		t.Fatalf("unexpected vault entries failure: %v", err)
+	}
+	if cfg.Vault["host1"].SudoPassword != "host1-sudo" || cfg.Vault["bastion"].LoginPassword != "bastion-login" {
+		t.Errorf("expected vault entries of host1 and its proxy, got %+v", cfg.Vault)
+	}
+	if _, hasUnbundled := cfg.Vault["host3"]; hasUnbundled {
+		t.Errorf("expected no vault entry for a host outside the bundle")
+	}
+	if _, inGroup := cfg.HostInfo["host1"].UniversalGroups["UniversalConfs"]; !inGroup || cfg.HostInfo["host1"].Proxy != "bastion" {
+		t.Errorf("unexpected host config from bundle: %+v", cfg.HostInfo["host1"])
+	}
+
+	rebuiltPlan, err := bundlePlan(bundleCtx, bundle, vaultPassword, "host2")
+	if err != nil {
+		t.Fatalf("unexpected bundle plan failure: %v", err)
+	}
+	if len(rebuiltPlan.hosts) != 1 || rebuiltPlan.hosts[0] != "host2" {
+		t.Fatalf("expected only the selected host, got %v", rebuiltPlan.hosts)
+	}
+	hostFiles := rebuiltPlan.hostFiles["host2"]
+	if len(hostFiles.GetUnorderedList()) != 5 || len(hostFiles.Groups) == 0 {
+		t.Errorf("expected all host files sorted into groups, got %d file(s) in %d group(s)", len(hostFiles.GetUnorderedList()), len(hostFiles.Groups))
+	}
+	if info := hostFiles.GetFileInfo("UniversalConfs/etc/app.conf"); info.Reload[0] != "systemctl restart app" {
+		t.Errorf("expected file metadata to be kept, got %+v", info)
+	}
+	if content := string(hostFiles.GetFileData("hash1")); content != "small\n" {
+		t.Errorf("expected small content, got '%s'", content)
+	}
+	if content := string(hostFiles.GetFileData("hash2")); content != "secret\n" {
+		t.Errorf("expected decrypted content, got '%s'", content)
+	}
+	stream, isStreamed := hostFiles.GetFileStream("hash3")
+	if !isStreamed {
+		t.Fatalf("expected large content to be streamed")
+	}
+	content, err := os.ReadFile(stream.LocalPath)
+	if err != nil || string(content) != "large content over the stream threshold" {
+		t.Errorf("unexpected streamed content '%s': %v", content, err)
+	}
+
+	_, err = bundlePlan(bundleCtx, bundle, vaultPassword, "host3")
+	if err == nil {
+		t.Errorf("expected error when no bundle host is selected")
+	}
+}
+
+func TestBundleIntegrity(t *testing.T) {
+	ctx, plan := testBundlePlan(t)
+	vaultPassword := []byte("vault password")
+
+	bundlePath := filepath.Join(t.TempDir(), "deploy.bundle")
+	err := writeBundle(ctx, bundlePath, plan, vaultPassword)
+	if err != nil {
+		t.Fatalf("unexpected bundle write failure: %v", err)
+	}
+
+	_, err = readBundle(bundlePath, []byte("wrong password"), t.TempDir())
+	if !errors.Is(err, deployment.ErrBundleIntegrity) {
+		t.Errorf("expected integrity error for wrong password, got '%v'", err)
+	}
+
+	alteredPath := filepath.Join(t.TempDir(), "altered.bundle")
+	alterBundleEntry(t, bundlePath, alteredPath, bundleContentDirectory+"hash1", []byte("evil!\n"))
+	_, err = readBundle(alteredPath, vaultPassword, t.TempDir())
+	if !errors.Is(err, deployment.ErrBundleIntegrity) {
+		t.Errorf("expected integrity error for altered content, got '%v'", err)
+	}
+}
+
+// Rewrites a bundle with the content of one entry replaced (without updating the HMAC)
+func alterBundleEntry(t *testing.T, bundlePath string, alteredPath string, entryName string, content []byte) {
+	bundleFile, err := os.Open(bundlePath)
+	if err != nil {
+		t.Fatalf("failed opening bundle: %v", err)
+	}
+	defer bundleFile.Close()
+	gzipReader, err := gzip.NewReader(bundleFile)
+	if err != nil {
+		t.Fatalf("failed reading bundle: %v", err)
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	var altered bytes.Buffer
+	gzipWriter := gzip.NewWriter(&altered)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("failed reading bundle entry: %v", err)
+		}
+		entry, err := io.ReadAll(tarReader)
+		if err != nil {
+			t.Fatalf("failed reading bundle entry: %v", err)
+		}
+		if header.Name == entryName {
+			entry = content
+			header.Size = int64(len(content))
+		}
+		err = tarWriter.WriteHeader(header)
+		if err == nil {
+			_, err = tarWriter.Write(entry)
+		}
+		if err != nil {
+			t.Fatalf("failed writing bundle entry: %v", err)
+		}
+	}
+	if tarWriter.Close() != nil || gzipWriter.Close() != nil {
+		t.Fatalf("failed closing altered bundle")
+	}
+
+	err = os.WriteFile(alteredPath, altered.Bytes(), 0600)
+	if err != nil {
+		t.Fatalf("failed writing altered bundle: %v", err)
+	}
+}
+
+func TestValidateBundleFileName(t *testing.T) {
+	tests := []struct {
+		bundlePath  string
+		expectedErr bool
+	}{
+		{"dmz-deploy.bundle", false},
+		{"/tmp/dmz-deploy.tar.gz", false},
+		{"dmz-deploy.tgz", false},
+		{"dmz-deploy", false},
+		{"dmz-deploy.tar.zst", true},
+		{"DMZ-DEPLOY.TAR.ZST", true},
+		{"dmz-deploy.tar", true},
+		{"dmz-deploy.zip", true},
+	}
+	for _, test := range tests {
+		err := validateBundleFileName(test.bundlePath)
+		if test.expectedErr != (err != nil) {
+			t.Errorf("'%s': expected error %t, got '%v'", test.bundlePath, test.expectedErr, err)
+		}
+	}
+}
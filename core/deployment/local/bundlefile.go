@@ -0,0 +1,422 @@
+package local
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/crypto"
+	"scmp/internal/str"
+	"strings"
+	"time"
+)
+
+const (
+	bundleFormatVersion    int    = 1
+	bundleManifestFile     string = "manifest.json" // Always the first entry, holds the HMAC key salt
+	bundleHostsDirectory   string = "hosts/"        // Per-host file metadata, one <host>.json per host
+	bundleHostFileExt      string = ".json"
+	bundleContentDirectory string = "content/"    // Deployment content, one entry per content hash
+	bundleVaultFile        string = "vault"       // Vault entries of bundle hosts (encrypted with the vault password)
+	bundleMACFile          string = "bundle.hmac" // Always the last entry, HMAC of every other entry
+	bundleSaltSize         int    = 16
+	bundleMaxMetadataSize  int64  = 64 << 20 // Largest manifest, host metadata, or vault entry read into memory
+)
+
+// Output name extensions claiming an archive or compression format other than the gzip compressed tar bundles are written as
+var bundleForeignExtensions = []string{".zst", ".zstd", ".tzst", ".xz", ".txz", ".bz2", ".tbz", ".tbz2", ".lz4", ".lzma", ".zip", ".7z", ".tar"}
+
+// Refuses bundle output names whose extension claims a different format than gzip compressed tar
+func validateBundleFileName(bundlePath string) (err error) {
+	name := strings.ToLower(filepath.Base(bundlePath))
+	for _, extension := range bundleForeignExtensions {
+		if strings.HasSuffix(name, extension) {
+			err = fmt.Errorf("bundle file '%s' has a '%s' extension but bundles are gzip compressed tar files, name it '.tar.gz' (or '.bundle')", bundlePath, extension)
+			return
+		}
+	}
+	return
+}
+
+// Deployment prepared from a repository commit, deployable without the repository or config file
+type bundleManifest struct {
+	Version          int                                `json:"Version"`
+	Salt             []byte                             `json:"Salt"` // Key derivation salt of the bundle HMAC
+	Created          time.Time                          `json:"Created"`
+	Branch           string                             `json:"Branch,omitempty"`
+	CommitID         string                             `json:"CommitHash"`
+	Hosts            []str.RepoRootDir                  `json:"Hosts"`     // Hosts with files in the bundle
+	Endpoints        map[str.RepoRootDir]bundleEndpoint `json:"Endpoints"` // Bundle hosts and their proxy hops
+	PhaseAbort       string                             `json:"PhaseAbort"`
+	BackupSuffix     string                             `json:"BackupSuffix"`
+	BackupDirectory  string                             `json:"BackupDirectory,omitempty"`
+	BackupRetention  int                                `json:"BackupRetention,omitempty"` // Archived deployments kept per host (0 keeps all)
+	StreamThreshold  int64                              `json:"StreamThreshold"`
+	EncryptedContent []str.FileID                       `json:"EncryptedContent,omitempty"` // Content encrypted in the repository, stored encrypted with the vault password
+}
+
+// Minimal host config needed to connect to a host and select it by name or group
+type bundleEndpoint struct {
+	Endpoint          string                 `json:"Endpoint,omitempty"`
+	FallbackEndpoints []string               `json:"FallbackEndpoints,omitempty"`
+	AddressFamily     string                 `json:"AddressFamily,omitempty"`
+	User              string                 `json:"User,omitempty"`
+	IdentityFile      string                 `json:"IdentityFile,omitempty"` // Paths in the home directory are kept relative to it (~/)
+	PasswordRequired  bool                   `json:"PasswordRequired,omitempty"`
+	PasswordCommand   string                 `json:"PasswordCommand,omitempty"` // Run on the deploying machine
+	PasswordEnv       string                 `json:"PasswordEnv,omitempty"`
+	ConnectTimeout    int                    `json:"ConnectTimeout,omitempty"`
+	ConnectAttempts   int                    `json:"ConnectAttempts,omitempty"`
+	ConnectRetryDelay time.Duration          `json:"ConnectRetryDelay,omitempty"`
+	HostDeadline      time.Duration          `json:"HostDeadline,omitempty"`
+	Snapshot          bool                   `json:"Snapshot,omitempty"`
+	RequireConfirm    bool                   `json:"RequireConfirmation,omitempty"`
+	RequestTTY        bool                   `json:"RequestTTY,omitempty"`
+	ProxyJump         string                 `json:"ProxyJump,omitempty"`
+	ProxyChain        []str.RepoRootDir      `json:"ProxyChain,omitempty"`
+	Groups            []str.RepoRootDir      `json:"Groups,omitempty"`
+	Overrides         config.OptionOverrides `json:"Overrides"`
+}
+
+// Planned files of a single host, after DRN resolution and template rendering for the host
+type bundleHostManifest struct {
+	Host  str.RepoRootDir                           `json:"Host"`
+	Files map[str.LocalRepoPath]deployment.FileInfo `json:"Files"`
+}
+
+// Verified bundle, content is extracted into the content directory with one file per content hash
+type openedBundle struct {
+	manifest         bundleManifest
+	hosts            map[str.RepoRootDir]bundleHostManifest
+	lockedVault      []byte
+	contentDirectory string
+}
+
+// Writes entries of a gzip compressed tar archive, every entry is covered by the HMAC written on close
+type bundleWriter struct {
+	path    string
+	file    *os.File
+	gzip    *gzip.Writer
+	tar     *tar.Writer
+	mac     hash.Hash
+	modTime time.Time
+}
+
+// Creates a new bundle file (existing files are never replaced)
+func createBundleWriter(path string, mac hash.Hash, modTime time.Time) (writer *bundleWriter, err error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		err = fmt.Errorf("failed to create bundle file: %w", err)
+		return
+	}
+
+	writer = &bundleWriter{
+		path:    path,
+		file:    file,
+		mac:     mac,
+		modTime: modTime,
+	}
+	writer.gzip = gzip.NewWriter(file)
+	writer.tar = tar.NewWriter(writer.gzip)
+	return
+}
+
+// Adds an entry of the given size, content is read from the reader
+func (writer *bundleWriter) add(name string, size int64, content io.Reader) (err error) {
+	err = writer.tar.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0600,
+		ModTime:  writer.modTime,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to write bundle entry '%s': %w", name, err)
+		return
+	}
+
+	macEntryHeader(writer.mac, name, size)
+	_, err = io.Copy(io.MultiWriter(writer.tar, writer.mac), content)
+	if err != nil {
+		err = fmt.Errorf("failed to write bundle entry '%s': %w", name, err)
+		return
+	}
+	return
+}
+
+func (writer *bundleWriter) addJSON(name string, value any) (err error) {
+	encoded, err := json.MarshalIndent(value, "", " ")
+	if err != nil {
+		err = fmt.Errorf("failed to marshal bundle entry '%s': %w", name, err)
+		return
+	}
+	err = writer.add(name, int64(len(encoded)), bytes.NewReader(encoded))
+	return
+}
+
+// Adds an entry with the content of a local file
+func (writer *bundleWriter) addFile(name string, localPath string) (err error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return
+	}
+	err = writer.add(name, fileInfo.Size(), file)
+	return
+}
+
+// Writes the HMAC of all previous entries as the last entry and completes the bundle file
+func (writer *bundleWriter) close() (err error) {
+	sum := hex.EncodeToString(writer.mac.Sum(nil))
+	err = writer.tar.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     bundleMACFile,
+		Size:     int64(len(sum)),
+		Mode:     0600,
+		ModTime:  writer.modTime,
+	})
+	if err == nil {
+		_, err = io.WriteString(writer.tar, sum)
+	}
+	if err == nil {
+		err = writer.tar.Close()
+	}
+	if err == nil {
+		err = writer.gzip.Close()
+	}
+	lerr := writer.file.Close()
+	if err == nil {
+		err = lerr
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to complete bundle file: %w", err)
+	}
+	return
+}
+
+// Removes an incomplete bundle file
+func (writer *bundleWriter) abort() {
+	_ = writer.file.Close()
+	_ = os.Remove(writer.path)
+}
+
+// Entry name and size are authenticated with the content, entries cannot be renamed or have content moved between them
+func macEntryHeader(mac hash.Hash, name string, size int64) {
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write(binary.BigEndian.AppendUint64(nil, uint64(size)))
+}
+
+// Reads a bundle and checks its HMAC with the vault password, nothing of the bundle is used unless it verifies
+// Content entries are written into the content directory (which should be empty and private)
+func readBundle(bundlePath string, vaultPassword []byte, contentDirectory string) (bundle openedBundle, err error) {
+	bundle.contentDirectory = contentDirectory
+
+	file, err := os.Open(bundlePath)
+	if err != nil {
+		err = fmt.Errorf("failed to open bundle: %w", err)
+		return
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		err = fmt.Errorf("not a deployment bundle: %w", err)
+		return
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	header, err := tarReader.Next()
+	if err != nil || header.Name != bundleManifestFile {
+		err = fmt.Errorf("not a deployment bundle: first entry is not %s", bundleManifestFile)
+		return
+	}
+	manifestJSON, err := readBundleEntry(tarReader, header, nil)
+	if err != nil {
+		return
+	}
+
+	// Version and salt are needed before anything can be verified, the manifest is parsed again once it is
+	var unverified bundleManifest
+	err = json.Unmarshal(manifestJSON, &unverified)
+	if err != nil {
+		err = fmt.Errorf("not a deployment bundle: invalid manifest: %w", err)
+		return
+	}
+	if unverified.Version != bundleFormatVersion {
+		err = fmt.Errorf("unsupported bundle format version %d (expected %d)", unverified.Version, bundleFormatVersion)
+		return
+	}
+	if len(unverified.Salt) != bundleSaltSize {
+		err = fmt.Errorf("%w: manifest has an invalid salt", deployment.ErrBundleIntegrity)
+		return
+	}
+
+	mac := crypto.NewPasswordMAC(vaultPassword, unverified.Salt)
+	macEntryHeader(mac, header.Name, header.Size)
+	mac.Write(manifestJSON)
+
+	hostsJSON := make(map[str.RepoRootDir][]byte)
+	var expectedMAC []byte
+	for {
+		header, err = tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			err = nil
+			break
+		} else if err != nil {
+			err = fmt.Errorf("failed reading bundle: %w", err)
+			return
+		}
+		if expectedMAC != nil {
+			err = fmt.Errorf("%w: entry '%s' follows the bundle HMAC", deployment.ErrBundleIntegrity, header.Name)
+			return
+		}
+		if header.Typeflag != tar.TypeReg {
+			err = fmt.Errorf("%w: entry '%s' is not a regular file", deployment.ErrBundleIntegrity, header.Name)
+			return
+		}
+
+		entryName := header.Name
+		switch {
+		case entryName == bundleMACFile:
+			var encodedMAC []byte
+			encodedMAC, err = readBundleEntry(tarReader, header, nil)
+			if err != nil {
+				return
+			}
+			expectedMAC, err = hex.DecodeString(string(encodedMAC))
+			if err != nil || len(expectedMAC) == 0 {
+				err = fmt.Errorf("%w: invalid HMAC entry", deployment.ErrBundleIntegrity)
+				return
+			}
+		case entryName == bundleVaultFile:
+			bundle.lockedVault, err = readBundleEntry(tarReader, header, mac)
+			if err != nil {
+				return
+			}
+		case strings.HasPrefix(entryName, bundleHostsDirectory) && strings.HasSuffix(entryName, bundleHostFileExt):
+			hostName := strings.TrimSuffix(strings.TrimPrefix(entryName, bundleHostsDirectory), bundleHostFileExt)
+			if !validBundleEntryName(hostName) {
+				err = fmt.Errorf("%w: invalid host entry '%s'", deployment.ErrBundleIntegrity, entryName)
+				return
+			}
+			hostsJSON[str.RepoRootDir(hostName)], err = readBundleEntry(tarReader, header, mac)
+			if err != nil {
+				return
+			}
+		case strings.HasPrefix(entryName, bundleContentDirectory):
+			contentID := strings.TrimPrefix(entryName, bundleContentDirectory)
+			if !validBundleEntryName(contentID) {
+				err = fmt.Errorf("%w: invalid content entry '%s'", deployment.ErrBundleIntegrity, entryName)
+				return
+			}
+			err = extractBundleContent(tarReader, header, mac, filepath.Join(contentDirectory, contentID))
+			if err != nil {
+				return
+			}
+		default:
+			err = fmt.Errorf("%w: unknown entry '%s'", deployment.ErrBundleIntegrity, entryName)
+			return
+		}
+	}
+
+	if expectedMAC == nil {
+		err = fmt.Errorf("%w: bundle has no HMAC (incomplete file)", deployment.ErrBundleIntegrity)
+		return
+	}
+	if !hmac.Equal(expectedMAC, mac.Sum(nil)) {
+		err = fmt.Errorf("%w: wrong vault password or bundle was altered", deployment.ErrBundleIntegrity)
+		return
+	}
+
+	// Verified from here on
+	err = json.Unmarshal(manifestJSON, &bundle.manifest)
+	if err != nil {
+		err = fmt.Errorf("invalid bundle manifest: %w", err)
+		return
+	}
+
+	bundle.hosts = make(map[str.RepoRootDir]bundleHostManifest)
+	for _, endpointName := range bundle.manifest.Hosts {
+		hostJSON, hostPresent := hostsJSON[endpointName]
+		if !hostPresent {
+			err = fmt.Errorf("bundle has no file metadata for host '%s'", endpointName)
+			return
+		}
+		var hostManifest bundleHostManifest
+		err = json.Unmarshal(hostJSON, &hostManifest)
+		if err != nil {
+			err = fmt.Errorf("invalid file metadata for host '%s': %w", endpointName, err)
+			return
+		}
+		bundle.hosts[endpointName] = hostManifest
+	}
+	return
+}
+
+// Reads an entry into memory, adding it to the HMAC unless mac is nil
+func readBundleEntry(reader io.Reader, header *tar.Header, mac hash.Hash) (content []byte, err error) {
+	if header.Size > bundleMaxMetadataSize {
+		err = fmt.Errorf("bundle entry '%s' is too large (%d bytes)", header.Name, header.Size)
+		return
+	}
+	content, err = io.ReadAll(reader)
+	if err != nil {
+		err = fmt.Errorf("failed reading bundle entry '%s': %w", header.Name, err)
+		return
+	}
+	if mac != nil {
+		macEntryHeader(mac, header.Name, header.Size)
+		mac.Write(content)
+	}
+	return
+}
+
+// Writes an entry to a new local file while adding it to the HMAC
+func extractBundleContent(reader io.Reader, header *tar.Header, mac hash.Hash, localPath string) (err error) {
+	file, err := os.OpenFile(localPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		err = fmt.Errorf("failed extracting bundle entry '%s': %w", header.Name, err)
+		return
+	}
+	defer func() {
+		lerr := file.Close()
+		if err == nil && lerr != nil {
+			err = fmt.Errorf("failed extracting bundle entry '%s': %w", header.Name, lerr)
+		}
+	}()
+
+	macEntryHeader(mac, header.Name, header.Size)
+	_, err = io.Copy(io.MultiWriter(file, mac), reader)
+	if err != nil {
+		err = fmt.Errorf("failed extracting bundle entry '%s': %w", header.Name, err)
+		return
+	}
+	return
+}
+
+// Entry names below a bundle directory are single path elements
+func validBundleEntryName(name string) (valid bool) {
+	valid = name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+	return
+}
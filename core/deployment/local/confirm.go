@@ -0,0 +1,97 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/input"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+)
+
+// Asks the user to confirm deploying to a single host
+type hostConfirmer func(ctx context.Context, endpointName str.RepoRootDir) (confirmed bool, err error)
+
+// Planned hosts marked RequireConfirmation, listed for the user
+func confirmationHosts(ctx context.Context, plans []deploymentPlan) (sensitiveHosts []str.RepoRootDir) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	for _, plan := range plans {
+		for _, endpointName := range plan.hosts {
+			if cfg.HostInfo[endpointName].RequireConfirm {
+				sensitiveHosts = append(sensitiveHosts, endpointName)
+			}
+		}
+	}
+	if len(sensitiveHosts) == 0 {
+		return
+	}
+	slices.Sort(sensitiveHosts)
+
+	logctx.LogStdInfo(ctx, "%d host(s) require confirmation before deploying:\n", len(sensitiveHosts))
+	for _, endpointName := range sensitiveHosts {
+		logctx.LogStdInfo(ctx, "  %s\n", endpointName)
+	}
+	return
+}
+
+// Removes planned hosts marked RequireConfirmation from the plans unless confirmed, before any connection is made
+// Hosts are confirmed by --confirm-host or interactively, non-interactive runs hold them back without failing
+func holdUnconfirmedHosts(ctx context.Context, plans []deploymentPlan, interactive bool, confirm hostConfirmer) (unconfirmed map[str.RepoRootDir]*deployment.HostFiles, err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	sensitiveHosts := confirmationHosts(ctx, plans)
+	if len(sensitiveHosts) == 0 {
+		return
+	}
+
+	unconfirmed = make(map[str.RepoRootDir]*deployment.HostFiles)
+	for _, endpointName := range sensitiveHosts {
+		var confirmed bool
+		if slices.Contains(opts.ConfirmHosts, string(endpointName)) {
+			confirmed = true
+		} else if interactive {
+			confirmed, err = confirm(ctx, endpointName)
+			if err != nil {
+				err = fmt.Errorf("failed to prompt for confirmation of host '%s': %w", endpointName, err)
+				return
+			}
+		}
+
+		if confirmed {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Host '%s' confirmed for deployment\n", endpointName)
+			continue
+		}
+		logctx.LogStdWarn(ctx, "Host '%s' was not confirmed and is skipped (use --confirm-host %s)\n", endpointName, endpointName)
+		unconfirmed[endpointName] = nil
+	}
+
+	for index := range plans {
+		var confirmedHosts []str.RepoRootDir
+		for _, endpointName := range plans[index].hosts {
+			_, held := unconfirmed[endpointName]
+			if held {
+				unconfirmed[endpointName] = plans[index].hostFiles[endpointName]
+				continue
+			}
+			confirmedHosts = append(confirmedHosts, endpointName)
+		}
+		plans[index].hosts = confirmedHosts
+	}
+	return
+}
+
+// Prompts for the host name, any other answer leaves the host unconfirmed
+func askHostConfirmation(ctx context.Context, endpointName str.RepoRootDir) (confirmed bool, err error) {
+	response, err := input.AskUser(ctx, fmt.Sprintf("Host '%s' requires confirmation, type its name to deploy to it", endpointName), "")
+	if err != nil && !strings.HasSuffix(err.Error(), "unexpected newline") {
+		return
+	}
+	err = nil
+	confirmed = strings.EqualFold(strings.TrimSpace(response), string(endpointName))
+	return
+}
@@ -0,0 +1,106 @@
+package local
+
+import (
+	"context"
+	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+	"testing"
+)
+
+func TestHoldUnconfirmedHosts(t *testing.T) {
+	cfg := config.Config{
+		HostInfo: map[str.RepoRootDir]config.EndpointInfo{
+			"web01": {EndpointName: "web01"},
+			"ca01":  {EndpointName: "ca01", RequireConfirm: true},
+			"db01":  {EndpointName: "db01", RequireConfirm: true},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		confirmHosts   []string
+		interactive    bool
+		answers        map[str.RepoRootDir]bool
+		expectHosts    []str.RepoRootDir
+		expectHeld     []str.RepoRootDir
+		expectPrompted []str.RepoRootDir
+	}{
+		{
+			name:           "interactive acceptance",
+			interactive:    true,
+			answers:        map[str.RepoRootDir]bool{"ca01": true, "db01": false},
+			expectHosts:    []str.RepoRootDir{"web01", "ca01"},
+			expectHeld:     []str.RepoRootDir{"db01"},
+			expectPrompted: []str.RepoRootDir{"ca01", "db01"},
+		},
+		{
+			name:           "flag acceptance",
+			confirmHosts:   []string{"db01"},
+			interactive:    true,
+			answers:        map[str.RepoRootDir]bool{"ca01": false},
+			expectHosts:    []str.RepoRootDir{"web01", "db01"},
+			expectHeld:     []str.RepoRootDir{"ca01"},
+			expectPrompted: []str.RepoRootDir{"ca01"},
+		},
+		{
+			name:         "non-interactive skip",
+			confirmHosts: []string{"ca01"},
+			expectHosts:  []str.RepoRootDir{"web01", "ca01"},
+			expectHeld:   []str.RepoRootDir{"db01"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := t.Context()
+			ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+			ctx = context.WithValue(ctx, global.ConfKey, cfg)
+			ctx = context.WithValue(ctx, global.OpsKey, config.Opts{ConfirmHosts: test.confirmHosts})
+
+			hostFiles, err := deployment.NewHostFiles()
+			if err != nil {
+				t.Fatalf("unexpected hostfiles create failure: %v", err)
+			}
+			plans := []deploymentPlan{{
+				hosts: []str.RepoRootDir{"web01", "ca01", "db01"},
+				hostFiles: map[str.RepoRootDir]*deployment.HostFiles{
+					"web01": hostFiles,
+					"ca01":  hostFiles,
+					"db01":  hostFiles,
+				},
+			}}
+
+			var prompted []str.RepoRootDir
+			confirm := func(ctx context.Context, endpointName str.RepoRootDir) (confirmed bool, err error) {
+				prompted = append(prompted, endpointName)
+				confirmed = test.answers[endpointName]
+				return
+			}
+
+			unconfirmed, err := holdUnconfirmedHosts(ctx, plans, test.interactive, confirm)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(plans[0].hosts, test.expectHosts) {
+				t.Errorf("expected planned hosts %v, got %v", test.expectHosts, plans[0].hosts)
+			}
+			if !slices.Equal(prompted, test.expectPrompted) {
+				t.Errorf("expected prompts for %v, got %v", test.expectPrompted, prompted)
+			}
+			if len(unconfirmed) != len(test.expectHeld) {
+				t.Fatalf("expected held hosts %v, got %v", test.expectHeld, unconfirmed)
+			}
+			for _, endpointName := range test.expectHeld {
+				files, held := unconfirmed[endpointName]
+				if !held || files != hostFiles {
+					t.Errorf("expected host '%s' held with its planned files", endpointName)
+				}
+			}
+		})
+	}
+}
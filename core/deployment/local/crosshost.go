@@ -0,0 +1,189 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"scmp/core/deployment"
+	"scmp/core/deployment/host"
+	"scmp/core/deployment/predeploy"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+)
+
+// Registers dependencies of files on files of other hosts and orders each batch so depended on hosts start first
+// Dependencies on hosts or target paths outside the deployment are ignored with a warning (like remote path dependencies)
+// Returns a nil coordinator when no file depends on another host
+func planCrossHostDependencies(ctx context.Context, batches [][]rolloutHost) (coordinator *host.CrossHostCoordinator, err error) {
+	hostBatch := make(map[str.RepoRootDir]int)
+	hostFiles := make(map[str.RepoRootDir]*deployment.HostFiles)
+	for batchIndex, batch := range batches {
+		for _, target := range batch {
+			hostBatch[target.endpointName] = batchIndex
+			hostFiles[target.endpointName] = target.plan.hostFiles[target.endpointName]
+		}
+	}
+
+	hostTargets := make(map[str.RepoRootDir]map[str.RemotePath]str.LocalRepoPath)
+	for _, batch := range batches {
+		for _, target := range batch {
+			dependentHost := target.endpointName
+			deployFiles := hostFiles[dependentHost]
+			if deployFiles == nil {
+				continue
+			}
+
+			for _, repoFilePath := range deployFiles.GetUnorderedList() {
+				for _, dependency := range deployFiles.GetFileInfo(repoFilePath).Dependencies {
+					endpointName, targetPath, isHostDependency := deployment.ParseHostDependency(dependency)
+					if !isHostDependency {
+						continue
+					}
+
+					if endpointName == dependentHost {
+						logctx.LogStdWarn(ctx, "File '%s': dependency '%s' is on its own host, use '%s%s' instead (ignored)\n", repoFilePath, dependency, deployment.RemoteDependencyPrefix, targetPath)
+						continue
+					}
+					dependencyBatch, hostInDeployment := hostBatch[endpointName]
+					if !hostInDeployment || hostFiles[endpointName] == nil {
+						logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog,
+							"File '%s' on host %s: dependency on host %s is ignored, host is not part of this deployment\n", repoFilePath, dependentHost, endpointName)
+						continue
+					}
+
+					targets, mapped := hostTargets[endpointName]
+					if !mapped {
+						targets = predeploy.MapTargetPaths(hostFiles[endpointName].GetUnorderedList(), hostFiles[endpointName])
+						hostTargets[endpointName] = targets
+					}
+					dependencyFile, supplied := targets[targetPath]
+					if !supplied {
+						logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog,
+							"File '%s' on host %s: dependency on '%s' of host %s is ignored, no file in this deployment supplies it\n", repoFilePath, dependentHost, targetPath, endpointName)
+						continue
+					}
+
+					if dependencyBatch > hostBatch[dependentHost] {
+						err = fmt.Errorf("file '%s' on host %s depends on '%s' of host %s, which deploys in a later rollout batch", repoFilePath, dependentHost, targetPath, endpointName)
+						return
+					}
+
+					if coordinator == nil {
+						coordinator = host.NewCrossHostCoordinator()
+					}
+					coordinator.Watch(dependentHost, endpointName, targetPath, dependencyFile)
+					logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog,
+						"File '%s' on host %s: waits on '%s' of host %s\n", repoFilePath, dependentHost, dependencyFile, endpointName)
+				}
+			}
+		}
+	}
+	if coordinator == nil {
+		return
+	}
+
+	err = checkHostDependencyCycles(coordinator, hostBatch)
+	if err != nil {
+		return
+	}
+
+	for batchIndex := range batches {
+		batches[batchIndex] = orderByHostDependencies(batches[batchIndex], coordinator)
+	}
+	return
+}
+
+// Rejects hosts that (through other hosts) depend on themselves, the hosts could never start in order
+func checkHostDependencyCycles(coordinator *host.CrossHostCoordinator, hostBatch map[str.RepoRootDir]int) (err error) {
+	hostNames := make([]str.RepoRootDir, 0, len(hostBatch))
+	for endpointName := range hostBatch {
+		hostNames = append(hostNames, endpointName)
+	}
+	slices.Sort(hostNames)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[str.RepoRootDir]int)
+	var path []str.RepoRootDir
+
+	var visit func(str.RepoRootDir) bool
+	visit = func(endpointName str.RepoRootDir) (cycleFound bool) {
+		state[endpointName] = visiting
+		path = append(path, endpointName)
+		for _, dependencyHost := range coordinator.HostDependencies(endpointName) {
+			switch state[dependencyHost] {
+			case visiting:
+				cycleStart := slices.Index(path, dependencyHost)
+				cycle := append(slices.Clone(path[cycleStart:]), dependencyHost)
+				err = fmt.Errorf("circular dependency between hosts, unable to continue: %s", strings.Join(str.ToStrings(cycle), " -> "))
+				cycleFound = true
+				return
+			case unvisited:
+				if visit(dependencyHost) {
+					cycleFound = true
+					return
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[endpointName] = visited
+		return
+	}
+
+	for _, endpointName := range hostNames {
+		if state[endpointName] == unvisited && visit(endpointName) {
+			return
+		}
+	}
+	return
+}
+
+// Moves the hosts of the same batch a host depends on in front of it, other hosts keep their order
+func orderByHostDependencies(batch []rolloutHost, coordinator *host.CrossHostCoordinator) (ordered []rolloutHost) {
+	batchHosts := make(map[str.RepoRootDir]rolloutHost, len(batch))
+	for _, target := range batch {
+		batchHosts[target.endpointName] = target
+	}
+
+	placed := make(map[str.RepoRootDir]bool, len(batch))
+	var place func(rolloutHost)
+	place = func(target rolloutHost) {
+		if placed[target.endpointName] {
+			return
+		}
+		placed[target.endpointName] = true
+		for _, dependencyHost := range coordinator.HostDependencies(target.endpointName) {
+			dependencyTarget, inBatch := batchHosts[dependencyHost]
+			if inBatch {
+				place(dependencyTarget)
+			}
+		}
+		ordered = append(ordered, target)
+	}
+
+	for _, target := range batch {
+		place(target)
+	}
+	return
+}
+
+// Shows which hosts wait on files of other hosts
+func printHostDependencies(ctx context.Context, batches [][]rolloutHost, coordinator *host.CrossHostCoordinator) {
+	if coordinator == nil {
+		return
+	}
+	logctx.LogStdInfo(ctx, "Cross-host dependencies:\n")
+	for _, batch := range batches {
+		for _, target := range batch {
+			dependencyHosts := coordinator.HostDependencies(target.endpointName)
+			if len(dependencyHosts) == 0 {
+				continue
+			}
+			logctx.LogStdInfo(ctx, "  %s waits on %s\n", target.endpointName, strings.Join(str.ToStrings(dependencyHosts), ", "))
+		}
+	}
+}
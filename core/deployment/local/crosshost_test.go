@@ -0,0 +1,108 @@
+package local
+
+import (
+	"scmp/core/deployment"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Plan of hosts whose files are given as target path to dependencies
+func crossHostTestPlan(t *testing.T, hostTargets map[str.RepoRootDir]map[str.RemotePath][]str.LocalRepoPath) (plan *deploymentPlan) {
+	plan = &deploymentPlan{hostFiles: make(map[str.RepoRootDir]*deployment.HostFiles)}
+	for endpointName, targets := range hostTargets {
+		hostFiles, err := deployment.NewHostFiles()
+		if err != nil {
+			t.Fatalf("unexpected hostfiles create failure: %v", err)
+		}
+		for targetPath, dependencies := range targets {
+			repoFilePath := str.LocalRepoPath(string(endpointName) + string(targetPath))
+			hostFiles.SetFileMetadata(repoFilePath, deployment.FileInfo{
+				RepoFilePath:   repoFilePath,
+				TargetFilePath: targetPath,
+				Dependencies:   dependencies,
+			})
+		}
+		plan.hosts = append(plan.hosts, endpointName)
+		plan.hostFiles[endpointName] = hostFiles
+	}
+	return
+}
+
+func rolloutTestBatches(plan *deploymentPlan, batchHosts ...[]str.RepoRootDir) (batches [][]rolloutHost) {
+	for _, hostNames := range batchHosts {
+		var batch []rolloutHost
+		for _, endpointName := range hostNames {
+			batch = append(batch, rolloutHost{endpointName: endpointName, plan: plan})
+		}
+		batches = append(batches, batch)
+	}
+	return
+}
+
+func TestPlanCrossHostDependencies(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	plan := crossHostTestPlan(t, map[str.RepoRootDir]map[str.RemotePath][]str.LocalRepoPath{
+		"app01": {"/etc/app.conf": {"db01:/etc/postgresql/pg_hba.conf", "db09:/etc/hosts", "db01:/etc/missing"}},
+		"app02": {"/etc/app.conf": {"db01:/etc/postgresql/pg_hba.conf"}},
+		"db01":  {"/etc/postgresql/pg_hba.conf": nil},
+		"web01": {"/etc/nginx/nginx.conf": {"app01/etc/other.conf"}},
+	})
+
+	batches := rolloutTestBatches(plan, []str.RepoRootDir{"app01", "app02", "web01", "db01"})
+	coordinator, err := planCrossHostDependencies(ctx, batches)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if coordinator == nil {
+		t.Fatalf("expected coordinator for cross-host dependencies")
+	}
+
+	// Hosts and paths outside the deployment are ignored
+	if dependencyHosts := coordinator.HostDependencies("app01"); !slices.Equal(dependencyHosts, []str.RepoRootDir{"db01"}) {
+		t.Errorf("expected app01 to only depend on db01, got %v", dependencyHosts)
+	}
+
+	// Depended on hosts move ahead of their dependents, other hosts keep their order
+	expectedOrder := []str.RepoRootDir{"db01", "app01", "app02", "web01"}
+	if order := rolloutBatchHosts(batches[0]); !slices.Equal(order, expectedOrder) {
+		t.Errorf("expected host order %v, got %v", expectedOrder, order)
+	}
+
+	// Without any cross-host dependency there is nothing to coordinate
+	plan = crossHostTestPlan(t, map[str.RepoRootDir]map[str.RemotePath][]str.LocalRepoPath{
+		"web01": {"/etc/nginx/nginx.conf": {"remote:/etc/ssl/cert.pem"}},
+	})
+	coordinator, err = planCrossHostDependencies(ctx, rolloutTestBatches(plan, []str.RepoRootDir{"web01"}))
+	if err != nil || coordinator != nil {
+		t.Errorf("expected no coordinator, got %v (error %v)", coordinator, err)
+	}
+}
+
+func TestPlanCrossHostDependenciesRefused(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	cyclePlan := crossHostTestPlan(t, map[str.RepoRootDir]map[str.RemotePath][]str.LocalRepoPath{
+		"app01": {"/etc/app.conf": {"db01:/etc/db.conf"}},
+		"db01":  {"/etc/db.conf": nil, "/etc/allow.conf": {"web01:/etc/web.conf"}},
+		"web01": {"/etc/web.conf": {"app01:/etc/app.conf"}},
+	})
+	_, err := planCrossHostDependencies(ctx, rolloutTestBatches(cyclePlan, []str.RepoRootDir{"app01", "db01", "web01"}))
+	if err == nil || !strings.Contains(err.Error(), "circular dependency between hosts") || !strings.Contains(err.Error(), "app01 -> db01 -> web01 -> app01") {
+		t.Errorf("expected host cycle error, got %v", err)
+	}
+
+	batchPlan := crossHostTestPlan(t, map[str.RepoRootDir]map[str.RemotePath][]str.LocalRepoPath{
+		"app01": {"/etc/app.conf": {"db01:/etc/db.conf"}},
+		"db01":  {"/etc/db.conf": nil},
+	})
+	_, err = planCrossHostDependencies(ctx, rolloutTestBatches(batchPlan, []str.RepoRootDir{"app01"}, []str.RepoRootDir{"db01"}))
+	if err == nil || !strings.Contains(err.Error(), "later rollout batch") {
+		t.Errorf("expected later batch error, got %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"scmp/core/deployment"
+	"scmp/core/deployment/host"
+	"scmp/core/deployment/remote"
+	"scmp/core/filesystem"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/parsing"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"strings"
+)
+
+const diffContextLines int = 3 // Unchanged lines shown around each change
+
+// Result of comparing one deployment file against its remote target
+type fileChangePreview struct {
+	differs bool
+	text    string
+}
+
+// Connects to each planned host and prints what each file would change on the remote
+// Files without differences are only shown at standard verbosity and above
+func previewContentChanges(ctx context.Context, plans []deploymentPlan) (err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	var failedHosts int
+	for _, plan := range plans {
+		if len(plans) > 1 {
+			logctx.LogStdInfo(ctx, "Content changes from %s:\n", plan.source())
+		}
+
+		for _, endpointName := range plan.hosts {
+			if ctx.Err() != nil {
+				err = fmt.Errorf("stop requested during content preview")
+				return
+			}
+
+			var previews []fileChangePreview
+			previews, err = previewHostChanges(host.WithHostOptions(ctx, cfg.HostInfo[endpointName]), cfg.HostInfo[endpointName], cfg.ProxyChainInfo(endpointName), plan.hostFiles[endpointName])
+			if err != nil {
+				logctx.LogStdErr(ctx, "Host '%s': %v\n", endpointName, err)
+				failedHosts++
+				err = nil
+				continue
+			}
+
+			var hostDiffers bool
+			for _, preview := range previews {
+				if preview.differs {
+					hostDiffers = true
+					break
+				}
+			}
+
+			headerLevel := logctx.VerbosityStandard
+			if hostDiffers {
+				headerLevel = logctx.VerbosityNone
+			}
+			logctx.LogEvent(ctx, headerLevel, logctx.InfoLog, "Host '%s':\n", endpointName)
+			for _, preview := range previews {
+				previewLevel := logctx.VerbosityStandard
+				if preview.differs {
+					previewLevel = logctx.VerbosityNone
+				}
+				logctx.LogEvent(ctx, previewLevel, logctx.InfoLog, "%s", preview.text)
+			}
+		}
+	}
+
+	if failedHosts > 0 {
+		err = fmt.Errorf("failed to preview content changes for %d host(s)", failedHosts)
+		return
+	}
+	return
+}
+
+// Compares every file deployed to a single host against the current remote content
+func previewHostChanges(ctx context.Context, hostInfo config.EndpointInfo, proxyChain []config.EndpointInfo, hostFiles *deployment.HostFiles) (previews []fileChangePreview, err error) {
+	var hostMeta sshinternal.HostMeta
+	hostMeta.Name = hostInfo.EndpointName
+	hostMeta.Password = hostInfo.SudoPassword
+
+	var proxyClient *sshinternal.ProxyLease
+	hostMeta.SSHClient, proxyClient, _, err = sshinternal.ConnectToSSH(ctx, hostInfo, proxyChain)
+	if err != nil {
+		err = fmt.Errorf("failed connect to SSH server: %w", err)
+		return
+	}
+	defer func() {
+		if proxyClient != nil {
+			lerr := proxyClient.Close()
+			if err == nil && lerr != nil {
+				err = fmt.Errorf("proxy close: %w", lerr)
+			}
+		}
+		lerr := hostMeta.SSHClient.Close()
+		if err == nil && lerr != nil {
+			err = fmt.Errorf("client close: %w", lerr)
+		}
+	}()
+
+	err = host.DetermineOSFamily(ctx, &hostMeta)
+	if err != nil {
+		return
+	}
+	err = host.ProbeUtilities(ctx, &hostMeta)
+	if err != nil {
+		return
+	}
+	err = host.CheckUtilities(hostMeta)
+	if err != nil {
+		return
+	}
+
+	for _, fileGroup := range hostFiles.Groups {
+		for _, repoFilePath := range fileGroup.GetOrderedList() {
+			info := hostFiles.GetFileInfo(repoFilePath)
+			if info.RepoFilePath == "" {
+				info.RepoFilePath = repoFilePath
+			}
+
+			var preview fileChangePreview
+			preview, err = previewFileChange(ctx, hostMeta, info, hostFiles.GetFileData(info.Hash))
+			if err != nil {
+				err = fmt.Errorf("file '%s': %w", info.TargetFilePath, err)
+				return
+			}
+			if preview.text != "" {
+				previews = append(previews, preview)
+			}
+		}
+	}
+	return
+}
+
+// Describes the content and metadata changes a single file action would make on the remote
+// Directories and symbolic links have no content and are not previewed
+func previewFileChange(ctx context.Context, hostMeta sshinternal.HostMeta, info deployment.FileInfo, localContent []byte) (preview fileChangePreview, err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	switch info.Action {
+	case deployment.ActionFileCreate, deployment.ActionFileModify, deployment.ActionFileDelete:
+	default:
+		return
+	}
+
+	remoteInfo, err := remote.GetOldRemoteInfo(ctx, hostMeta, info.TargetFilePath)
+	if err != nil {
+		return
+	}
+
+	if info.Action == deployment.ActionFileDelete {
+		if remoteInfo.Exists {
+			preview.differs = true
+			preview.text = fmt.Sprintf("  %s: remote file will be deleted (size %d, sha256 %s)\n", info.TargetFilePath, remoteInfo.Size, remoteInfo.Hash)
+		} else {
+			preview.text = fmt.Sprintf("  %s: not present on remote, nothing to delete\n", info.TargetFilePath)
+		}
+		return
+	}
+
+	var text strings.Builder
+
+	if !remoteInfo.Exists {
+		preview.differs = true
+		fmt.Fprintf(&text, "  %s: not present on remote, will be created\n", info.TargetFilePath)
+	} else {
+		remoteOwnerGroup := remoteInfo.Owner + ":" + remoteInfo.Group
+		if remoteOwnerGroup != info.OwnerGroup {
+			preview.differs = true
+			fmt.Fprintf(&text, "  %s: owner '%s' -> '%s'\n", info.TargetFilePath, remoteOwnerGroup, info.OwnerGroup)
+		}
+		if remoteInfo.Permissions != info.Permissions {
+			preview.differs = true
+			fmt.Fprintf(&text, "  %s: permissions %d -> %d\n", info.TargetFilePath, remoteInfo.Permissions, info.Permissions)
+		}
+		if remoteInfo.Hash == info.Hash {
+			if !preview.differs {
+				fmt.Fprintf(&text, "  %s: no changes\n", info.TargetFilePath)
+			}
+			preview.text = text.String()
+			return
+		}
+		preview.differs = true
+	}
+
+	// Binary content is only compared by size and hash
+	isArtifact := str.HasSuffix(info.RepoFilePath, filesystem.ArtifactPointerFileExt)
+	if isArtifact || !parsing.IsText(&localContent) {
+		writeBinaryChange(&text, info, remoteInfo)
+		preview.text = text.String()
+		return
+	}
+
+	var remoteContent []byte
+	if remoteInfo.Exists {
+		command := sshinternal.BuildCat(info.TargetFilePath)
+		command.DisableSudo = opts.DisableSudo
+		command.RunAsUser = opts.RunAsUser
+
+		var commandOutput string
+		commandOutput, err = command.SSHexec(ctx, hostMeta.SSHClient, hostMeta.Password)
+		if err != nil {
+			err = fmt.Errorf("failed to retrieve remote content: %w", err)
+			return
+		}
+		remoteContent = []byte(commandOutput)
+
+		if !parsing.IsText(&remoteContent) {
+			writeBinaryChange(&text, info, remoteInfo)
+			preview.text = text.String()
+			return
+		}
+	}
+
+	remoteName := string(hostMeta.Name) + ":" + string(info.TargetFilePath)
+	if !remoteInfo.Exists {
+		remoteName = "/dev/null"
+	}
+	diff, complete := parsing.UnifiedDiff(remoteName, string(info.RepoFilePath), string(remoteContent), string(localContent), diffContextLines)
+	if !complete {
+		fmt.Fprintf(&text, "  %s: too many changes to show a diff\n", info.TargetFilePath)
+		writeBinaryChange(&text, info, remoteInfo)
+		preview.text = text.String()
+		return
+	}
+	text.WriteString(diff)
+	preview.text = text.String()
+	return
+}
+
+// Writes size and hash of both sides for content that cannot be shown as a text diff
+func writeBinaryChange(text *strings.Builder, info deployment.FileInfo, remoteInfo sshinternal.RemoteFileInfo) {
+	fmt.Fprintf(text, "  %s: binary content differs\n", info.TargetFilePath)
+	if remoteInfo.Exists {
+		fmt.Fprintf(text, "    remote: size %d, sha256 %s\n", remoteInfo.Size, remoteInfo.Hash)
+	} else {
+		fmt.Fprintf(text, "    remote: not present\n")
+	}
+	fmt.Fprintf(text, "    local:  size %d, sha256 %s\n", info.FileSize, info.Hash)
+}
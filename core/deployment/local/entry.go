@@ -3,16 +3,17 @@ package local
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"maps"
 	"path/filepath"
-	"scmp/cli"
 	"scmp/core/deployment"
+	"scmp/core/deployment/events"
 	"scmp/core/deployment/host"
 	"scmp/core/deployment/metrics"
 	"scmp/core/deployment/predeploy"
-	"scmp/core/deployment/repository"
+	"scmp/core/deployment/snapshot"
+	"scmp/core/deployment/statecache"
 	"scmp/internal/config"
 	"scmp/internal/fsops"
 	"scmp/internal/gitinternal"
@@ -24,12 +25,17 @@ import (
 	"scmp/internal/secrets"
 	"scmp/internal/sshinternal"
 	"scmp/internal/str"
+	"slices"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 // Parses and prepares deployment information
-func StartDeploy(ctx context.Context, deployMode string, commitID string, hostOverride string, fileOverride string) (rollbackCommit bool, err error) {
+// Status is the final deployment summary status (Interrupted when stopped early, UpToDate when there was nothing to deploy)
+func StartDeploy(ctx context.Context, deployMode string, commitID string, hostOverride string, fileOverride string) (rollbackCommit bool, status string, err error) {
 	// Retrieve required deployment options
 	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
 	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
@@ -40,13 +46,19 @@ func StartDeploy(ctx context.Context, deployMode string, commitID string, hostOv
 	hostOverride, err = parsing.RetrieveURIFile(ctx, hostOverride)
 	if err != nil {
 		rollbackCommit = true
-		err = fmt.Errorf("failed to parse remote-hosts URI: %w", err)
+		err = fmt.Errorf("%w: failed to parse remote-hosts URI: %w", deployment.ErrInvalidOptions, err)
 		return
 	}
 	fileOverride, err = parsing.RetrieveURIFile(ctx, fileOverride)
 	if err != nil {
 		rollbackCommit = true
-		err = fmt.Errorf("failed to parse local-files URI: %w", err)
+		err = fmt.Errorf("%w: failed to parse local-files URI: %w", deployment.ErrInvalidOptions, err)
+		return
+	}
+	err = validateOverrides(opts, hostOverride, fileOverride)
+	if err != nil {
+		rollbackCommit = true
+		err = fmt.Errorf("%w: %w", deployment.ErrInvalidOptions, err)
 		return
 	}
 
@@ -56,6 +68,32 @@ func StartDeploy(ctx context.Context, deployMode string, commitID string, hostOv
 		return
 	}
 
+	rolloutRequested, failOnSkipped, jsonSummaryRequested, err := validateDeployOptions(cfg, opts, deployMode, commitID)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", deployment.ErrInvalidOptions, err)
+		return
+	}
+
+	// Opened early so planning failures still reach the event consumer
+	var eventStream *events.Writer
+	if opts.EventStream != "" {
+		eventStream, err = events.Open(ctx, opts.EventStream, uuid.New().String())
+		if err != nil {
+			return
+		}
+	}
+	defer func() {
+		details := status
+		if err != nil {
+			details = err.Error()
+		}
+		eventStream.Emit(events.DeploymentFinished, "", "", details)
+		lerr := eventStream.Close()
+		if err == nil && lerr != nil {
+			err = fmt.Errorf("failed writing deployment events: %w", lerr)
+		}
+	}()
+
 	// Set path to failtracker file (in config directory)
 	configDirectory := filepath.Dir(sshinternal.DefaultConfigPath)
 	failTrackerFilePath := filepath.Join(configDirectory, deployment.FailTrackerFile)
@@ -67,163 +105,235 @@ func StartDeploy(ctx context.Context, deployMode string, commitID string, hostOv
 
 	// Override commitID with one from failtracker if redeploy requested
 	var lastDeploymentSummary metrics.Summary
+	var deployBranch string
+	var failTrackerLock *metrics.FailTrackerLock
+	defer func() {
+		lerr := failTrackerLock.Unlock()
+		if err == nil && lerr != nil {
+			err = fmt.Errorf("failed releasing failtracker lock: %w", lerr)
+		}
+	}()
 	if deployMode == deployment.ModeRetry {
-		commitID, lastDeploymentSummary, err = metrics.GetFailTrackerCommit(failTrackerFilePath)
+		// Concurrent deployments must not record over the failures being retried
+		failTrackerLock, err = metrics.LockFailTracker(ctx, failTrackerFilePath, false)
 		if err != nil {
 			rollbackCommit = true
-			err = fmt.Errorf("failed to extract commitID/failures from failtracker file: %w", err)
 			return
 		}
-	}
-
-	// Open repo and get details - using HEAD commit if commitID is empty
-	// Pass by reference to ensure commitID can be used later if user did not specify one
-	tree, commit, err := gitinternal.GetCommit(ctx, &commitID)
-	if err != nil {
-		rollbackCommit = true
-		err = fmt.Errorf("error retrieving commit details: %w", err)
-		return
-	}
-	deployTree := tree
-
-	var commitFiles map[str.LocalRepoPath]str.DeployAction
 
-	// Build initial deployment list based on mode.
-	var extraHostFilter string
-	switch deployMode {
-	case deployment.ModeDiff:
-		var changedFiles []repository.GitChangedFileMetadata
-		changedFiles, err = repository.GetChangedFiles(ctx, commit)
+		commitID, lastDeploymentSummary, err = metrics.GetFailTrackerCommit(failTrackerFilePath)
 		if err != nil {
 			rollbackCommit = true
-			err = fmt.Errorf("failed to retrieve changed files: %w", err)
+			err = fmt.Errorf("failed to extract commitID/failures from failtracker file: %w", err)
 			return
 		}
-		commitFiles = repository.ParseChangedFiles(ctx, changedFiles, fileOverride)
-		extraHostFilter, err = repository.TrackDRNChanges(ctx, commitFiles, commit)
+		deployBranch = lastDeploymentSummary.Branch
+	} else if commitID == "" {
+		// Using HEAD commit if commitID is empty
+		deployBranch, commitID, err = gitinternal.GetHead(ctx)
 		if err != nil {
 			rollbackCommit = true
-			err = fmt.Errorf("failed to retrieve changed DRN files: %w", err)
-			return
-		}
-	case deployment.ModeAll:
-		commitFiles, err = repository.GetRepoFiles(ctx, tree, fileOverride)
-		if err != nil {
-			err = fmt.Errorf("failed to retrieve all files: %w", err)
-			return
-		}
-	case deployment.ModeRetry:
-		commitFiles, extraHostFilter, err = lastDeploymentSummary.GetFailures(ctx, fileOverride)
-		if err != nil {
-			err = fmt.Errorf("failed to retrieve failed files: %w", err)
+			err = fmt.Errorf("error retrieving HEAD details: %w", err)
 			return
 		}
-	case deployment.ModeRollback:
-		var changedFiles []repository.GitChangedFileMetadata
-		changedFiles, err = repository.GetChangedFiles(ctx, commit)
-		if err != nil {
-			err = fmt.Errorf("failed to retrieve changed files: %w", err)
-			return
-		}
-		commitFiles, err = repository.GetRollbackFiles(ctx, changedFiles, fileOverride)
-		if err != nil {
-			err = fmt.Errorf("failed to retrieve rollback files: %w", err)
-			return
-		}
-		deployTree, err = repository.GetParentTree(commit)
-		if err != nil {
-			err = fmt.Errorf("failed to retrieve parent commit tree: %w", err)
-			return
-		}
-		extraHostFilter, err = repository.TrackDRNChanges(ctx, commitFiles, commit)
-		if err != nil {
-			err = fmt.Errorf("failed to retrieve changed DRN files: %w", err)
-			return
-		}
-	default:
-		err = fmt.Errorf("unknown deployment mode: mode must be one of '%v'", cli.GetImmediateChildren(cli.GetCLICmds(), "deploy"))
-		return
-	}
-	if hostOverride != "" && extraHostFilter != "" {
-		hostOverride = hostOverride + "," + extraHostFilter
-	} else if extraHostFilter != "" {
-		hostOverride = extraHostFilter
 	}
 
-	if len(commitFiles) == 0 {
-		// Non-error - can happen under normal operations: When committing files outside of host directories
-		logctx.LogStdInfo(ctx, "No files available for deployment.\n")
+	skipped := deployment.NewSkipReport()
+
+	var plans []deploymentPlan
+	if opts.AllBranches {
+		plans, rollbackCommit, err = planAllBranches(ctx, skipped, deployBranch, commitID, hostOverride, fileOverride)
+	} else {
+		var plan deploymentPlan
+		plan, rollbackCommit, err = planDeployment(ctx, skipped, deployMode, deployBranch, commitID, cfg.HostInfo, hostOverride, fileOverride, lastDeploymentSummary)
+		plans = append(plans, plan)
+	}
+	if err != nil {
 		return
 	}
 
-	allHostsFiles, universalFiles, err := repository.ParseAllRepoFiles(ctx, deployTree)
-	if err != nil {
+	// Skipped files are always shown for dry-runs and plan failures, otherwise only when requested by verbosity
+	skippedSummaries := skipped.Summarize(opts.SkippedListLimit)
+	failedSkipCount := skipped.CountReasons(failOnSkipped)
+	if opts.DryRunEnabled || failedSkipCount > 0 || logctx.GetLogLevel(ctx) >= logctx.VerbosityProgress {
+		predeploy.PrintSkippedFiles(ctx, skippedSummaries)
+	}
+	if failedSkipCount > 0 {
 		rollbackCommit = true
-		err = fmt.Errorf("failed to track files by host/universal directory: %w", err)
+		err = fmt.Errorf("%d file(s) skipped for reason(s) '%s' (see skipped files report)", failedSkipCount, strings.Join(failOnSkipped, ","))
 		return
 	}
 
-	deniedUniversalFiles := predeploy.MapDeniedUniversalFiles(ctx, allHostsFiles, universalFiles)
+	run := &deploymentRun{
+		plans:                plans,
+		deployBranch:         deployBranch,
+		commitID:             commitID,
+		hostOverride:         hostOverride,
+		fileOverride:         fileOverride,
+		rolloutRequested:     rolloutRequested,
+		jsonSummaryRequested: jsonSummaryRequested,
+		skippedSummaries:     skippedSummaries,
+		eventStream:          eventStream,
+		failTrackerFilePath:  failTrackerFilePath,
+		failTrackerLock:      failTrackerLock,
+		recordFailures:       true,
+	}
+	rollbackCommit, status, err = run.deploy(ctx)
+	failTrackerLock = run.failTrackerLock
+	return
+}
+
+// Prepared plans and the state shared by every deployment of them (repository or bundle)
+type deploymentRun struct {
+	plans                []deploymentPlan
+	deployBranch         string
+	commitID             string
+	hostOverride         string // Orders rollout hosts and reports the selection, plans already contain the selected hosts
+	fileOverride         string // Only reports the selection
+	rolloutRequested     bool
+	jsonSummaryRequested bool
+	skippedSummaries     []deployment.SkipSummary
+	eventStream          *events.Writer
+	failTrackerFilePath  string                   // State cache is kept next to it
+	failTrackerLock      *metrics.FailTrackerLock // Held until the caller releases it
+	recordFailures       bool                     // Save failures to the failtracker for later retries
+}
 
-	allDeploymentHosts, allDeploymentFiles, hostDeploymentFiles := predeploy.FilterHostsAndFiles(ctx, cfg.HostInfo, deniedUniversalFiles, commitFiles, hostOverride)
-	if len(allDeploymentFiles) == 0 || len(allDeploymentHosts) == 0 {
-		// Non-error - can happen under normal operations: if user specifies change deploy mode with a host that didn't have any changes in the specified commit
-		logctx.LogStdInfo(ctx, "No deployment files for available hosts.\n")
+// Connects to the planned hosts and deploys their files, reporting and recording the outcome
+func (run *deploymentRun) deploy(ctx context.Context) (rollbackCommit bool, status string, err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	// Plans without hosts have nothing to deploy
+	run.plans = slices.DeleteFunc(run.plans, func(plan deploymentPlan) bool {
+		return len(plan.hosts) == 0
+	})
+	if len(run.plans) == 0 {
+		status = metrics.StatusUpToDate
 		return
 	}
 
-	rawFileContent, err := predeploy.LoadGitFileContent(ctx, allDeploymentFiles, deployTree)
-	if err != nil {
-		rollbackCommit = true
-		err = fmt.Errorf("error loading files: %w", err)
-		return
+	var deploymentItemCount, deploymentHostCount int
+	for _, plan := range run.plans {
+		deploymentItemCount += plan.deployFiles.Count()
+		deploymentHostCount += len(plan.hosts)
 	}
 
-	deployFiles, err := predeploy.ParseFileContent(ctx, allDeploymentFiles, rawFileContent)
-	if err != nil {
-		rollbackCommit = true
-		err = fmt.Errorf("error parsing loaded files: %w", err)
-		return
+	// Conditions and fact macros cannot be evaluated without facts, refuse instead of guessing
+	if !opts.GatherFacts && !opts.ShowContentDiff && !opts.Audit {
+		for _, plan := range run.plans {
+			for _, endpointName := range plan.hosts {
+				repoFilePath, factsRequired := plan.hostFiles[endpointName].FactsRequired()
+				if factsRequired {
+					rollbackCommit = true
+					err = fmt.Errorf("file '%s' uses a host fact condition or fact macro, facts must be gathered (use --gather-facts)", repoFilePath)
+					return
+				}
+			}
+		}
 	}
 
-	allHostFiles, err := predeploy.GroupByHost(ctx, deployFiles, hostDeploymentFiles)
+	err = network.LocalSystemChecks(ctx)
 	if err != nil {
 		rollbackCommit = true
-		err = fmt.Errorf("failed grouping host deployment files: %w", err)
+		err = fmt.Errorf("error in local system checks: %w", err)
 		return
 	}
 
-	// Resolve DRNs now, contextual by host (sort files depends on the resolved text)
-	err = predeploy.HandleDRNs(ctx, deployTree, allHostFiles, cfg.HostInfo)
-	if err != nil {
-		rollbackCommit = true
-		err = fmt.Errorf("drn: %w", err)
+	run.logSelection(ctx)
+
+	if opts.ShowContentDiff {
+		err = retrieveHostSecrets(ctx, run.plans)
+		if err != nil {
+			rollbackCommit = true
+			return
+		}
+
+		logctx.LogStdInfo(ctx, "Comparing %d item(s) against %d host(s)\n", deploymentItemCount, deploymentHostCount)
+		err = previewContentChanges(ctx, run.plans)
 		return
 	}
 
-	err = predeploy.SortFiles(ctx, allHostFiles)
-	if err != nil {
-		rollbackCommit = true
-		err = fmt.Errorf("failed sorting deployment files: %w", err)
+	if opts.Audit {
+		err = retrieveHostSecrets(ctx, run.plans)
+		if err != nil {
+			rollbackCommit = true
+			return
+		}
+
+		logctx.LogStdInfo(ctx, "Auditing %d item(s) on %d host(s)\n", deploymentItemCount, deploymentHostCount)
+		status, err = run.audit(ctx)
 		return
 	}
 
-	err = network.LocalSystemChecks(ctx)
+	logctx.LogStdInfo(ctx, "Deploying %d item(s) to %d host(s)\n", deploymentItemCount, deploymentHostCount)
+
+	// Canary and rolling deployments go through the hosts in a fixed order, otherwise all hosts are one batch
+	batches := [][]rolloutHost{planHosts(run.plans)}
+	if run.rolloutRequested {
+		batches = rolloutBatches(orderRolloutHosts(planHosts(run.plans), run.hostOverride, cfg.HostInfo, opts.RegexEnabled), opts.CanaryHosts, opts.BatchSize)
+	}
+
+	// Hosts depended on by other hosts deploy first within their batch
+	crossHost, err := planCrossHostDependencies(ctx, batches)
 	if err != nil {
 		rollbackCommit = true
-		err = fmt.Errorf("error in local system checks: %w", err)
 		return
 	}
 
-	logctx.LogStdInfo(ctx, "Deploying %d item(s) to %d host(s)\n", deployFiles.Count(), len(allDeploymentHosts))
-
 	if opts.DryRunEnabled {
-		predeploy.PrintDeploymentInformation(ctx, deployFiles, allDeploymentHosts, allHostFiles)
+		for _, plan := range run.plans {
+			if opts.AllBranches {
+				logctx.LogStdInfo(ctx, "Deployment from %s:\n", plan.source())
+			}
+			predeploy.PrintDeploymentInformation(ctx, plan.deployFiles, plan.hosts, plan.hostFiles)
+			predeploy.PrintUniversalFanout(ctx, plan.universalFanout)
+		}
+		confirmationHosts(ctx, run.plans)
+		if run.rolloutRequested {
+			printRolloutOrder(ctx, batches, opts.CanaryHosts)
+		}
+		printHostDependencies(ctx, batches, crossHost)
+
+		if opts.RunHooksOnDryRun {
+			err = runDryRunHooks(ctx, run.plans, run.deployBranch, run.commitID)
+		}
 		return
 	}
 
+	// Guard against universal files reaching more hosts than expected
+	if !opts.AcknowledgeFanout {
+		var fanoutExceedingCount int
+		for _, plan := range run.plans {
+			fanoutExceedingFiles := predeploy.FanoutExceedsThreshold(plan.universalFanout, cfg.FanoutThreshold)
+			if len(fanoutExceedingFiles) == 0 {
+				continue
+			}
+			fanoutExceedingCount += len(fanoutExceedingFiles)
+
+			exceedingFanout := make(map[str.LocalRepoPath]predeploy.UniversalFanout)
+			for _, file := range fanoutExceedingFiles {
+				exceedingFanout[file] = plan.universalFanout[file]
+			}
+			predeploy.PrintUniversalFanout(ctx, exceedingFanout)
+		}
+
+		if fanoutExceedingCount > 0 {
+			var userConfirmation string
+			userConfirmation, err = input.AskUser(ctx, fmt.Sprintf("%d universal file(s) will deploy to more than %d hosts, please confirm [y/N]", fanoutExceedingCount, cfg.FanoutThreshold), "")
+			if err != nil && !strings.HasSuffix(err.Error(), "unexpected newline") {
+				err = fmt.Errorf("failed to prompt for fanout confirmation: %w", err)
+				return
+			}
+			if userConfirmation != "y" {
+				err = fmt.Errorf("did not receive confirmation for universal file fanout, aborting deployment (use --acknowledge-fanout to skip confirmation)")
+				return
+			}
+		}
+	}
+
 	// Guard against deployments containing a large number of changes
-	if !opts.ForceEnabled && deployFiles.Count() > deployment.FileCountPromptThreshold {
+	if !opts.ForceEnabled && deploymentItemCount > deployment.FileCountPromptThreshold {
 		var userConfirmation string
 		userConfirmation, err = input.AskUser(ctx, "Large Deployment Detected, please confirm [y/N]", "")
 		if err != nil && !strings.HasSuffix(err.Error(), "unexpected newline") {
@@ -236,84 +346,252 @@ func StartDeploy(ctx context.Context, deployMode string, commitID string, hostOv
 		}
 	}
 
+	// Sensitive hosts are only deployed to once confirmed by name
+	unconfirmedHosts, err := holdUnconfirmedHosts(ctx, run.plans, input.Interactive(ctx), askHostConfirmation)
+	if err != nil {
+		return
+	}
+
 	select {
 	case <-ctx.Done():
+		status = metrics.StatusInterrupted
 		err = fmt.Errorf("immediate stop requested before deployment start")
 		return
 	default:
 	}
 
+	err = runPreDeployHook(ctx, run.plans, run.deployBranch, run.commitID)
+	if err != nil {
+		return
+	}
+
 	// Retrieve keys and passwords for any hosts that require it
-	for _, endpointName := range allDeploymentHosts {
-		// Retrieve host secrets
-		cfg.HostInfo[endpointName], err = secrets.GetHostValues(ctx, cfg.HostInfo[endpointName])
+	err = retrieveHostSecrets(ctx, run.plans)
+	if err != nil {
+		rollbackCommit = true
+		return
+	}
+
+	// Wet-runs change nothing on the remote, the cache is left as it is
+	var stateCache *statecache.Cache
+	if !opts.WetRunEnabled {
+		stateCache, err = openStateCache(ctx, run.failTrackerFilePath)
 		if err != nil {
-			rollbackCommit = true
-			err = fmt.Errorf("error retrieving host secrets: %w", err)
+			err = fmt.Errorf("error in state cache: %w", err)
 			return
 		}
-
-		// Retrieve proxy secrets (if proxy is needed)
-		proxyName := cfg.HostInfo[endpointName].Proxy
-		if proxyName != "" {
-			cfg.HostInfo[str.RepoRootDir(proxyName)], err = secrets.GetHostValues(ctx, cfg.HostInfo[str.RepoRootDir(proxyName)])
-			if err != nil {
-				rollbackCommit = true
-				err = fmt.Errorf("error retrieving proxy secrets: %w", err)
-				return
-			}
-		}
 	}
 
 	// Metric collection
 	deployMetrics := metrics.New()
+	deployMetrics.SetEventStream(run.eventStream)
 
 	// Start SSH Deployments
 	// All failures and errors from here on are soft stops - program will finish, errors are tracked within deployment metrics, git commit will NOT be rolled back
 	var wg sync.WaitGroup
 	connLimiter := make(chan struct{}, opts.MaxSSHConcurrency)
-	for _, endpointName := range allDeploymentHosts {
-		deployer := host.New(&wg,
-			connLimiter,
-			cfg.HostInfo[endpointName],
-			cfg.HostInfo[str.RepoRootDir(cfg.HostInfo[endpointName].Proxy)],
-			deployMetrics,
-			opts.MaxDeployConcurrency,
-		)
+	reloadCoordinator := host.NewReloadCoordinator()
+
+	// Interrupts in CLI mode stop any hosts/files not yet started so the partial summary is still reported
+	// In-flight files (and the rest of their reload groups) still finish unless a second interrupt aborts them
+	deployCtx := ctx
+	var abortCtx context.Context
+	username := global.AssertFromContext[string](ctx, "username", global.UserKey, "string")
+	if username == global.GlobalUsername {
+		var stopInterrupts func()
+		deployCtx, abortCtx, stopInterrupts = handleInterrupts(ctx)
+		defer stopInterrupts()
+	}
+
+	// Deadline stops admitting hosts and files a grace period before in-flight hosts are cut off
+	var runCutoff time.Time
+	if opts.DeploymentDeadline > 0 {
+		deployMetrics.SetDeadline(opts.DeploymentDeadline)
+		runCutoff = time.Now().Add(opts.DeploymentDeadline)
 
-		wg.Add(1)
-		if opts.MaxSSHConcurrency > 1 {
-			go deployer.Deploy(ctx, allHostFiles[endpointName])
+		var stopDeadline context.CancelFunc
+		deployCtx, stopDeadline = context.WithDeadlineCause(deployCtx, runCutoff.Add(-deployment.DeadlineGrace(opts.DeploymentDeadline)), deployment.ErrDeadlineExceeded)
+		defer stopDeadline()
+	}
+
+	// Status and progress lines would interleave with JSON on stdout or get lost between verbose log lines
+	stopStatusDisplay := func() {}
+	if opts.StatusLines || opts.Progress {
+		if run.jsonSummaryRequested && opts.SummaryFile == "" {
+			logctx.LogStdWarn(ctx, "Status lines disabled, JSON summary is written to stdout (use --summary-file to keep both)\n")
+		} else if opts.EventStream == events.StdoutPath {
+			logctx.LogStdWarn(ctx, "Status lines disabled, events are written to stdout (use an event file to keep both)\n")
+		} else if logctx.GetLogLevel(ctx) >= logctx.VerbosityProgress {
+			logctx.LogStdWarn(ctx, "Status lines disabled, verbose log output is already shown\n")
 		} else {
-			// Max conns of <=1 disables using go routine
-			deployer.Deploy(ctx, allHostFiles[endpointName])
+			deployMetrics.EnableProgress()
+			stopStatusDisplay = startStatusDisplay(ctx, deployMetrics, opts.StatusLines, opts.Progress)
+		}
+	}
 
-			// Don't continue to the next host on errors
-			if deployMetrics.HostHasError(endpointName) {
-				break
+	// Snapshots and archive backups of every host in this deployment share one ID (wet-runs change nothing worth capturing)
+	deploymentStart := time.Now()
+	snapshotID := snapshot.NewID(deploymentStart)
+	backupArchiveID := deploymentStart.UTC().Format(sshinternal.BackupArchiveIDFormat)
+	var snapshotHosts int
+	run.eventStream.Emit(events.DeploymentStarted, "", "", fmt.Sprintf("%d item(s) to %d host(s)", deploymentItemCount, deploymentHostCount))
+	for _, plan := range run.plans {
+		for endpointName, malformedFiles := range plan.malformedFiles {
+			for _, malformed := range malformedFiles {
+				deployMetrics.AddFileParseError(endpointName, malformed.RepoFilePath, malformed.Action, malformed.Err)
 			}
 		}
 	}
+	for endpointName, hostFiles := range unconfirmedHosts {
+		deployMetrics.AddHostConfirmationRequired(endpointName, hostFiles)
+		crossHost.HostFinished(endpointName, fmt.Errorf("host %s requires confirmation", endpointName))
+	}
+	// Sensitive hosts held back for confirmation are never part of a batch
+	for batchIndex := range batches {
+		batches[batchIndex] = slices.DeleteFunc(batches[batchIndex], func(target rolloutHost) bool {
+			return !slices.Contains(target.plan.hosts, target.endpointName)
+		})
+	}
+	batches = slices.DeleteFunc(batches, func(batch []rolloutHost) bool {
+		return len(batch) == 0
+	})
+
+	// Once a batch fails every host not yet started is halted instead of deployed
+	var haltReason string
+batchLoop:
+	for batchIndex, batch := range batches {
+		batchLabel := rolloutBatchLabel(batchIndex, opts.CanaryHosts)
+		for _, target := range batch {
+			endpointName := target.endpointName
+			if haltReason != "" {
+				deployMetrics.AddHostHalted(endpointName, target.plan.hostFiles[endpointName], haltReason)
+				crossHost.HostFinished(endpointName, fmt.Errorf("host %s halted: %s", endpointName, haltReason))
+				continue
+			}
+
+			deployer := host.New(&wg,
+				connLimiter,
+				cfg.HostInfo[endpointName],
+				cfg.ProxyChainInfo(endpointName),
+				deployMetrics,
+				opts.MaxDeployConcurrency,
+				reloadCoordinator,
+			)
+			deployer.SetRunDeadline(runCutoff)
+			deployer.SetAbort(abortCtx)
+			deployer.SetStateCache(stateCache)
+			deployer.SetPhaseAbort(cfg.PhaseAbort)
+			deployer.SetCrossHostCoordinator(crossHost)
+			if cfg.HostInfo[endpointName].Snapshot && !opts.WetRunEnabled {
+				deployer.SetSnapshotID(snapshotID)
+				snapshotHosts++
+			}
+			if !opts.WetRunEnabled {
+				deployer.SetBackupArchiveID(backupArchiveID)
+			}
+
+			// Attribute each host to the branch it deployed from
+			if opts.AllBranches {
+				deployMetrics.SetHostSource(endpointName, target.plan.branch, target.plan.commitID)
+			}
+
+			wg.Add(1)
+			if opts.MaxSSHConcurrency > 1 {
+				go deployer.Deploy(deployCtx, target.plan.hostFiles[endpointName])
+			} else {
+				// Max conns of <=1 disables using go routine
+				deployer.Deploy(deployCtx, target.plan.hostFiles[endpointName])
+
+				// Don't continue to the next host on errors
+				if deployMetrics.HostHasError(endpointName) {
+					if !run.rolloutRequested {
+						break batchLoop
+					}
+					haltReason = fmt.Sprintf("%s failed on %s", batchLabel, endpointName)
+				}
+			}
+		}
+		if !run.rolloutRequested || haltReason != "" || batchIndex == len(batches)-1 {
+			continue
+		}
+
+		// Every host of a batch finishes before the next batch starts
+		wg.Wait()
+		var failedHosts []string
+		for _, target := range batch {
+			if deployMetrics.HostFailed(target.endpointName) {
+				failedHosts = append(failedHosts, string(target.endpointName))
+			}
+		}
+		if len(failedHosts) > 0 {
+			haltReason = fmt.Sprintf("%s failed on %s", batchLabel, strings.Join(failedHosts, ", "))
+			logctx.LogStdWarn(ctx, "Rollout halted, %s\n", haltReason)
+			continue
+		}
+		if deployCtx.Err() != nil {
+			// Stopped deployments mark the remaining hosts as not attempted
+			continue
+		}
+
+		var remainingHosts int
+		for _, laterBatch := range batches[batchIndex+1:] {
+			remainingHosts += len(laterBatch)
+		}
+		batchNumber := batchIndex // Canary is batch 0
+		if opts.CanaryHosts == 0 {
+			batchNumber++
+		}
+		err = runBatchCheck(deployCtx, batchNumber, batch, remainingHosts, run.deployBranch, run.commitID)
+		if err != nil {
+			haltReason = fmt.Sprintf("%s after %s", err.Error(), batchLabel)
+			logctx.LogStdWarn(ctx, "Rollout halted, %s\n", haltReason)
+			err = nil
+			continue
+		}
+		pauseBetweenBatches(deployCtx, time.Duration(opts.BatchPause)*time.Second)
+	}
 	wg.Wait()
+	stopStatusDisplay()
+
+	if errors.Is(context.Cause(deployCtx), deployment.ErrDeadlineExceeded) {
+		logctx.LogStdWarn(ctx, "Deployment deadline of %s reached, hosts not yet started are marked as not attempted\n", opts.DeploymentDeadline)
+	} else if deployment.Interrupted(deployCtx) {
+		logctx.LogStdWarn(ctx, "Deployment interrupted, hosts and files not yet started are marked as interrupted\n")
+	} else if deployCtx.Err() != nil {
+		logctx.LogStdWarn(ctx, "Deployment stopped early, hosts not yet started are marked as not attempted\n")
+	}
 
 	deployMetrics.Stop()
-	deploymentSummary := deployMetrics.CreateReport(commitID)
+	deploymentSummary := deployMetrics.CreateReport(run.deployBranch, run.commitID)
+	deploymentSummary.Skipped = run.skippedSummaries
+	status = deploymentSummary.Status
+	if deployCtx.Err() != nil && !errors.Is(context.Cause(deployCtx), deployment.ErrDeadlineExceeded) {
+		status = metrics.StatusInterrupted
+	}
+
+	// Post hook sees every started deployment, even when recording its results fails
+	defer func() {
+		lerr := runPostDeployHook(ctx, deploymentSummary)
+		if lerr != nil {
+			err = errors.Join(err, lerr)
+		}
+	}()
 
 	if opts.WetRunEnabled {
 		logctx.LogStdInfo(ctx, "Wet-run enabled. No mutating actions taken, theoretical deployment summary:\n")
 	}
 
-	// Show user what was done during deployment
-	if opts.DetailedSummaryRequested {
+	// Show user what was done during deployment (JSON goes to summary file instead when requested)
+	if run.jsonSummaryRequested && opts.SummaryFile == "" {
 		// Detailed Summary
-		var deploymentSummaryJSON []byte
-		deploymentSummaryJSON, err = json.MarshalIndent(deploymentSummary, "", " ")
+		var deploymentSummaryJSON string
+		deploymentSummaryJSON, err = deploymentSummary.JSON()
 		if err != nil {
 			err = fmt.Errorf("failed to marshal detailed deployment summary JSON: %w", err)
 			return
 		}
 
-		logctx.LogStdInfo(ctx, "%s\n", string(deploymentSummaryJSON))
+		logctx.LogStdInfo(ctx, "%s", deploymentSummaryJSON)
 	} else {
 		logctx.LogStdInfo(ctx,
 			"Status: %s. Deployed %d item(s) (%s) to %d host(s). Deployment took %s\n",
@@ -323,29 +601,226 @@ func StartDeploy(ctx context.Context, deployMode string, commitID string, hostOv
 			deploymentSummary.Counters.CompletedHosts,
 			deploymentSummary.ElapsedTime,
 		)
+		if deploymentSummary.Counters.SkippedItems > 0 {
+			logctx.LogStdInfo(ctx, "Skipped %d item(s) whose condition is false for their host\n", deploymentSummary.Counters.SkippedItems)
+		}
+		if opts.WetRunEnabled {
+			deploymentSummary.PrintWetRunOutcomes(ctx)
+		}
+		if snapshotHosts > 0 {
+			logctx.LogStdInfo(ctx, "Snapshot '%s' requested for %d host(s), restore with 'snapshot restore'\n", snapshotID, snapshotHosts)
+		}
+		if deploymentSummary.Deadline != "" {
+			logctx.LogStdInfo(ctx, "Deadline: %s configured, %s elapsed\n", deploymentSummary.Deadline, deploymentSummary.ElapsedTime)
+		}
+		if opts.AllBranches {
+			deploymentSummary.PrintHostSources(ctx)
+		}
 
 		err = deploymentSummary.PrintFailures(ctx)
 		if err != nil {
 			err = fmt.Errorf("error in printing deployment failures: %w", err)
 			return
 		}
+		if opts.TopReport > 0 {
+			deploymentSummary.PrintSlowest(ctx, opts.TopReport)
+		}
 	}
 
-	err = deploymentSummary.SaveReport(ctx, failTrackerFilePath)
-	if err != nil {
-		err = fmt.Errorf("error in recording deployment failures: %w", err)
+	// Wet-runs change nothing, previously recorded failures still need deploying
+	if opts.WetRunEnabled {
+		err = writeSummaryFile(ctx, opts.SummaryFile, deploymentSummary)
 		return
 	}
 
-	if !deployMetrics.AnyErrorsPresent() {
-		// Remove fail tracker file after successful redeployment - best effort
-		err = os.Remove(failTrackerFilePath)
+	if run.recordFailures {
+		// Wait for any retry in progress so both deployments' failures are merged
+		if run.failTrackerLock == nil {
+			run.failTrackerLock, err = metrics.LockFailTracker(ctx, run.failTrackerFilePath, true)
+			if err != nil {
+				err = fmt.Errorf("error in recording deployment failures: %w", err)
+				return
+			}
+		}
+
+		err = deploymentSummary.SaveReport(ctx, run.failTrackerFilePath)
 		if err != nil {
-			if os.IsNotExist(err) {
-				// No warning if the file doesn't exist
-				err = nil
-			} else {
-				err = fmt.Errorf("failed removing failtracker file: %w", err)
+			err = fmt.Errorf("error in recording deployment failures: %w", err)
+			return
+		}
+	}
+
+	if stateCache != nil {
+		invalidateFailedHosts(ctx, stateCache, deploymentSummary)
+		err = stateCache.Save()
+		if err != nil {
+			err = fmt.Errorf("error in saving state cache: %w", err)
+			return
+		}
+	}
+
+	err = writeSummaryFile(ctx, opts.SummaryFile, deploymentSummary)
+	return
+}
+
+// Prints the hosts and files the overrides expanded to across all plans
+func (run *deploymentRun) logSelection(ctx context.Context) {
+	var selectedHosts []string
+	selectedFiles := make(map[str.LocalRepoPath]struct{})
+	for _, plan := range run.plans {
+		for _, endpointName := range plan.hosts {
+			selectedHosts = append(selectedHosts, string(endpointName))
+			for _, repoFilePath := range plan.hostFiles[endpointName].GetUnorderedList() {
+				selectedFiles[repoFilePath] = struct{}{}
+			}
+		}
+	}
+	parsing.LogSelection(ctx, "host", run.hostOverride, selectedHosts)
+	parsing.LogSelection(ctx, "file", run.fileOverride, str.ToStrings(slices.Collect(maps.Keys(selectedFiles))))
+}
+
+// Checks host and file overrides before any item is matched against them
+func validateOverrides(opts config.Opts, hostOverride string, fileOverride string) (err error) {
+	err = parsing.ValidateOverride(opts.RegexEnabled, hostOverride)
+	if err != nil {
+		err = fmt.Errorf("remote-hosts: %w", err)
+		return
+	}
+	err = parsing.ValidateOverride(opts.RegexEnabled, fileOverride)
+	if err != nil {
+		err = fmt.Errorf("local-files: %w", err)
+		return
+	}
+	err = parsing.ValidateOverride(opts.RegexEnabled, opts.ReplaceFiles)
+	if err != nil {
+		err = fmt.Errorf("replace-files: %w", err)
+		return
+	}
+	return
+}
+
+// Checks option combinations before anything is planned
+func validateDeployOptions(cfg config.Config, opts config.Opts, deployMode string, commitID string) (rolloutRequested bool, failOnSkipped []string, jsonSummaryRequested bool, err error) {
+	// Branch deployments always use the tip commit diff of each mapped branch
+	if opts.AllBranches {
+		if deployMode != deployment.ModeDiff {
+			err = fmt.Errorf("deploying all branches is only supported for diff deployments")
+			return
+		}
+		if commitID != "" {
+			err = fmt.Errorf("deploying all branches cannot be combined with a specific commit ID")
+			return
+		}
+		if len(cfg.BranchMappings) == 0 {
+			err = fmt.Errorf("deploying all branches requires BranchMappings in the configuration file")
+			return
+		}
+	}
+
+	if opts.ChangedSince < 0 {
+		err = fmt.Errorf("changed-since duration cannot be negative")
+		return
+	}
+	if opts.ChangedSince > 0 && deployMode != deployment.ModeAll {
+		err = fmt.Errorf("selecting files changed since a time is only supported for all deployments")
+		return
+	}
+
+	switch opts.SummaryFormat {
+	case "", deployment.SummaryFormatText, deployment.SummaryFormatJSON:
+	default:
+		err = fmt.Errorf("unknown summary format '%s', expected '%s' or '%s'", opts.SummaryFormat, deployment.SummaryFormatText, deployment.SummaryFormatJSON)
+		return
+	}
+
+	if opts.ShowContentDiff && opts.DryRunEnabled {
+		err = fmt.Errorf("showing content differences connects to remote hosts and cannot be combined with dry-run")
+		return
+	}
+
+	if opts.Audit {
+		if deployMode != deployment.ModeAll {
+			err = fmt.Errorf("auditing remote hosts is only supported for all deployments")
+			return
+		}
+		if opts.DryRunEnabled || opts.ShowContentDiff {
+			err = fmt.Errorf("auditing remote hosts cannot be combined with dry-run or showing content differences")
+			return
+		}
+	}
+
+	if opts.CanaryHosts < 0 || opts.BatchSize < 0 || opts.BatchPause < 0 {
+		err = fmt.Errorf("canary hosts, batch size, and batch pause cannot be negative")
+		return
+	}
+	rolloutRequested = opts.CanaryHosts > 0 || opts.BatchSize > 0
+	if !rolloutRequested && (opts.BatchPause > 0 || opts.BatchCheck != "") {
+		err = fmt.Errorf("batch pause and batch check require a canary or batch size")
+		return
+	}
+
+	if opts.LockWait < 0 || opts.LockStaleAge < 0 {
+		err = fmt.Errorf("lock wait and lock stale age cannot be negative")
+		return
+	}
+
+	if opts.TopReport < 0 {
+		err = fmt.Errorf("number of slowest files and hosts to report cannot be negative")
+		return
+	}
+
+	failOnSkipped, err = deployment.ParseSkipReasons(opts.FailOnSkipped)
+	if err != nil {
+		err = fmt.Errorf("invalid fail-on-skipped: %w", err)
+		return
+	}
+
+	// Events and JSON summary are both machine read, they cannot share stdout
+	jsonSummaryRequested = opts.DetailedSummaryRequested || opts.SummaryFormat == deployment.SummaryFormatJSON
+	if opts.EventStream == events.StdoutPath && jsonSummaryRequested && opts.SummaryFile == "" {
+		err = fmt.Errorf("event stream and JSON summary cannot both be written to stdout (use --summary-file or an event file)")
+		return
+	}
+	return
+}
+
+// Writes the JSON deployment summary when a summary file was requested
+func writeSummaryFile(ctx context.Context, summaryFile string, deploymentSummary metrics.Summary) (err error) {
+	if summaryFile == "" {
+		return
+	}
+
+	summaryFilePath, err := fsops.ExpandHomeDirectory(summaryFile)
+	if err != nil {
+		err = fmt.Errorf("failed to find home directory for '%s': %w", summaryFile, err)
+		return
+	}
+
+	err = deploymentSummary.WriteJSON(ctx, summaryFilePath)
+	if err != nil {
+		err = fmt.Errorf("failed writing deployment summary file: %w", err)
+		return
+	}
+	return
+}
+
+// Retrieves keys and passwords for all planned hosts and their proxies
+func retrieveHostSecrets(ctx context.Context, plans []deploymentPlan) (err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	for _, plan := range plans {
+		for _, endpointName := range plan.hosts {
+			// Retrieve host secrets
+			cfg.HostInfo[endpointName], err = secrets.GetHostValues(ctx, cfg.HostInfo[endpointName])
+			if err != nil {
+				err = fmt.Errorf("error retrieving host secrets: %w", err)
+				return
+			}
+
+			// Retrieve proxy secrets (if proxy is needed)
+			err = secrets.GetProxyValues(ctx, cfg.HostInfo, endpointName)
+			if err != nil {
+				err = fmt.Errorf("error retrieving proxy secrets: %w", err)
 				return
 			}
 		}
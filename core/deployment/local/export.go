@@ -0,0 +1,372 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"scmp/core/deployment"
+	"scmp/core/deployment/metrics"
+	"scmp/core/deployment/predeploy"
+	"scmp/core/filesystem"
+	"scmp/internal/config"
+	"scmp/internal/fsops"
+	"scmp/internal/gitinternal"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/parsing"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+)
+
+const (
+	exportFilesDirectory  string = "files"         // Per-host directory holding target path tree
+	exportMetadataFile    string = "metadata.json" // Per-host file metadata and commands
+	exportArtifactStubExt string = ".artifact-ref" // Suffix of stub files written in place of artifact content
+	exportEncryptedExt    string = ".encrypted"    // Suffix of placeholder files written in place of encrypted content
+	exportMaskedValue     string = "********"      // Replaces secret values in exported content and commands
+)
+
+// Metadata of all exported items for a single host (in deployment order)
+type exportHostMetadata struct {
+	Host     str.RepoRootDir      `json:"Host"`
+	CommitID string               `json:"CommitHash"`
+	Items    []exportItemMetadata `json:"Items"`
+}
+
+type exportItemMetadata struct {
+	RepoFilePath   str.LocalRepoPath   `json:"RepoFilePath"`
+	TargetFilePath str.RemotePath      `json:"TargetFilePath"`
+	ExportPath     string              `json:"ExportPath,omitempty"` // Relative to host export directory, empty when item has no content
+	Action         str.DeployAction    `json:"Action"`
+	Hash           str.FileID          `json:"Hash,omitempty"`
+	FileSize       int                 `json:"FileSize,omitempty"`
+	ArtifactStub   bool                `json:"ArtifactStub,omitempty"`
+	SecretsMasked  bool                `json:"SecretsMasked,omitempty"` // Secret values in content or commands were replaced (hash and size are of the unmasked content)
+	Encrypted      bool                `json:"Encrypted,omitempty"`     // Repository holds cipher text, exported as a placeholder unless secrets are included
+	OwnerGroup     string              `json:"OwnerGroup,omitempty"`
+	Permissions    int                 `json:"Permissions,omitempty"`
+	LinkTarget     str.RemotePath      `json:"LinkTarget,omitempty"`
+	Dependencies   []str.LocalRepoPath `json:"Dependencies,omitempty"`
+	Predeploy      []string            `json:"Predeploy,omitempty"`
+	Install        []string            `json:"Install,omitempty"`
+	PostInstall    []string            `json:"PostInstall,omitempty"`
+	Preapply       []string            `json:"Preapply,omitempty"`
+	Postapply      []string            `json:"Postapply,omitempty"`
+	PreChecks      []string            `json:"PreChecks,omitempty"`
+	PostChecks     []string            `json:"PostChecks,omitempty"`
+	Reload         []string            `json:"Reload,omitempty"`
+	ReloadGroup    str.ReloadID        `json:"ReloadGroup,omitempty"`
+	MaxHosts       int                 `json:"MaxConcurrentHosts,omitempty"`
+	BackupStyle    string              `json:"BackupStyle,omitempty"`
+	Condition      string              `json:"Condition,omitempty"` // Not evaluated, exports do not gather host facts
+}
+
+// Writes the fully resolved deployment content for each host to a local directory for review outside of git
+// Uses the same planning and selection as a deployment, so exported content is exactly what would be pushed to each host
+// Secrets are masked unless explicitly included
+func StartExport(ctx context.Context, commitID string, hostOverride string, fileOverride string, exportDirectory string, allFiles bool, includeArtifacts bool, includeSecrets bool) (err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSDeploy)
+
+	if exportDirectory == "" {
+		err = fmt.Errorf("export requires an output directory")
+		return
+	}
+	exportDirectory, err = fsops.ExpandHomeDirectory(exportDirectory)
+	if err != nil {
+		err = fmt.Errorf("failed to find home directory for '%s': %w", exportDirectory, err)
+		return
+	}
+
+	// Never mix exports with existing content
+	existingEntries, err := os.ReadDir(exportDirectory)
+	if err != nil && !os.IsNotExist(err) {
+		err = fmt.Errorf("failed to check output directory: %w", err)
+		return
+	} else if len(existingEntries) > 0 {
+		err = fmt.Errorf("output directory '%s' is not empty", exportDirectory)
+		return
+	}
+
+	hostOverride, err = parsing.RetrieveURIFile(ctx, hostOverride)
+	if err != nil {
+		err = fmt.Errorf("failed to parse remote-hosts URI: %w", err)
+		return
+	}
+	fileOverride, err = parsing.RetrieveURIFile(ctx, fileOverride)
+	if err != nil {
+		err = fmt.Errorf("failed to parse local-files URI: %w", err)
+		return
+	}
+	err = validateOverrides(opts, hostOverride, fileOverride)
+	if err != nil {
+		return
+	}
+
+	deployMode := deployment.ModeDiff
+	if allFiles {
+		deployMode = deployment.ModeAll
+	}
+
+	// Same option checks as the deployment being exported
+	_, failOnSkipped, _, err := validateDeployOptions(cfg, opts, deployMode, commitID)
+	if err != nil {
+		return
+	}
+
+	var branch string
+	if commitID == "" {
+		branch, commitID, err = gitinternal.GetHead(ctx)
+		if err != nil {
+			err = fmt.Errorf("error retrieving HEAD details: %w", err)
+			return
+		}
+	}
+
+	skipped := deployment.NewSkipReport()
+
+	var plans []deploymentPlan
+	if opts.AllBranches {
+		plans, _, err = planAllBranches(ctx, skipped, branch, commitID, hostOverride, fileOverride)
+	} else {
+		var plan deploymentPlan
+		plan, _, err = planDeployment(ctx, skipped, deployMode, branch, commitID, cfg.HostInfo, hostOverride, fileOverride, metrics.Summary{})
+		plans = append(plans, plan)
+	}
+	if err != nil {
+		return
+	}
+
+	// Files a deployment would refuse to skip are not exported either
+	failedSkipCount := skipped.CountReasons(failOnSkipped)
+	if failedSkipCount > 0 || logctx.GetLogLevel(ctx) >= logctx.VerbosityProgress {
+		predeploy.PrintSkippedFiles(ctx, skipped.Summarize(opts.SkippedListLimit))
+	}
+	if failedSkipCount > 0 {
+		err = fmt.Errorf("%d file(s) skipped for reason(s) '%s' (see skipped files report)", failedSkipCount, strings.Join(failOnSkipped, ","))
+		return
+	}
+
+	var secretValues []string
+	if !includeSecrets {
+		secretValues = opts.Values.SensitiveValues()
+	}
+
+	var hostCount int
+	for _, plan := range plans {
+		for _, endpointName := range plan.hosts {
+			var itemCount int
+			itemCount, err = exportHostFiles(exportDirectory, endpointName, plan.commitID, plan.hostFiles[endpointName], includeArtifacts, includeSecrets, secretValues)
+			if err != nil {
+				err = fmt.Errorf("host '%s': %w", endpointName, err)
+				return
+			}
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Exported %d item(s) for host '%s' from %s\n", itemCount, endpointName, plan.source())
+		}
+		hostCount += len(plan.hosts)
+	}
+	if hostCount == 0 {
+		return
+	}
+
+	logctx.LogStdInfo(ctx, "Exported %d host(s) to '%s'\n", hostCount, exportDirectory)
+	return
+}
+
+// Writes final content of all host files under their target paths and records their metadata
+// Artifact content is replaced by a hash reference stub unless requested, secret values are masked in content and commands
+// Encrypted content is replaced by a placeholder (without hash or size of the decrypted content) unless secrets are included
+func exportHostFiles(exportDirectory string, endpointName str.RepoRootDir, commitID string, hostFiles *deployment.HostFiles, includeArtifacts bool, includeSecrets bool, secretValues []string) (itemCount int, err error) {
+	hostDirectory := filepath.Join(exportDirectory, string(endpointName))
+
+	hostMetadata := exportHostMetadata{
+		Host:     endpointName,
+		CommitID: commitID,
+	}
+
+	for _, fileGroup := range hostFiles.Groups {
+		for _, repoFilePath := range fileGroup.GetOrderedList() {
+			info := hostFiles.GetFileInfo(repoFilePath)
+
+			item := exportItemMetadata{
+				RepoFilePath:   info.RepoFilePath,
+				TargetFilePath: info.TargetFilePath,
+				Action:         info.Action,
+				OwnerGroup:     info.OwnerGroup,
+				Permissions:    info.Permissions,
+				LinkTarget:     info.LinkTarget,
+				Dependencies:   info.Dependencies,
+				Predeploy:      info.Predeploy,
+				Install:        info.Install,
+				PostInstall:    info.PostInstall,
+				Preapply:       info.Preapply,
+				Postapply:      info.Postapply,
+				PreChecks:      info.PreChecks,
+				PostChecks:     info.PostChecks,
+				Reload:         info.Reload,
+				ReloadGroup:    info.ReloadGroup,
+				MaxHosts:       info.ReloadMaxHosts,
+				BackupStyle:    info.BackupStyle,
+				Condition:      info.Condition,
+				Encrypted:      info.Encrypted,
+			}
+			if item.RepoFilePath == "" {
+				item.RepoFilePath = repoFilePath
+			}
+			item.SecretsMasked = maskExportCommands(&item, secretValues)
+
+			switch info.Action {
+			case deployment.ActionFileCreate, deployment.ActionFileModify:
+				item.Hash = info.Hash
+				item.FileSize = info.FileSize
+
+				content := hostFiles.GetFileData(info.Hash)
+				item.ExportPath = exportTargetPath(info.TargetFilePath)
+
+				// Large binary content is only referenced by hash unless requested
+				if str.HasSuffix(repoFilePath, filesystem.ArtifactPointerFileExt) && !includeArtifacts {
+					item.ArtifactStub = true
+					item.ExportPath += exportArtifactStubExt
+					content = []byte(fmt.Sprintf("sha256:%s\n", info.Hash))
+				}
+
+				// Decrypted content never leaves the plan unless requested
+				encryptedPlaceholder := info.Encrypted && !includeSecrets
+				if encryptedPlaceholder {
+					item.Hash = ""
+					item.FileSize = 0
+					item.ExportPath += exportEncryptedExt
+					content = []byte("Content encrypted in the repository (export with --include-secrets to write it decrypted)\n")
+				} else if !item.ArtifactStub {
+					masked := maskSecrets(string(content), secretValues)
+					if masked != string(content) {
+						content = []byte(masked)
+						item.SecretsMasked = true
+					}
+				}
+
+				// Streamed artifacts are never held in memory, copy them from their local location
+				stream, isStreamed := hostFiles.GetFileStream(info.Hash)
+				if isStreamed && !item.ArtifactStub && !encryptedPlaceholder {
+					err = copyExportFile(filepath.Join(hostDirectory, item.ExportPath), stream.LocalPath)
+				} else {
+					err = writeExportFile(filepath.Join(hostDirectory, item.ExportPath), content)
+				}
+				if err != nil {
+					err = fmt.Errorf("failed exporting '%s': %w", repoFilePath, err)
+					return
+				}
+			case deployment.ActionDirCreate, deployment.ActionDirModify:
+				item.ExportPath = exportTargetPath(info.TargetFilePath)
+
+				err = os.MkdirAll(filepath.Join(hostDirectory, item.ExportPath), 0700)
+				if err != nil {
+					err = fmt.Errorf("failed exporting directory '%s': %w", repoFilePath, err)
+					return
+				}
+			}
+			// Symbolic links and deletions have no content, metadata describes the action
+
+			hostMetadata.Items = append(hostMetadata.Items, item)
+			itemCount++
+		}
+	}
+
+	metadataJSON, err := json.MarshalIndent(hostMetadata, "", " ")
+	if err != nil {
+		err = fmt.Errorf("failed to marshal host metadata: %w", err)
+		return
+	}
+	err = writeExportFile(filepath.Join(hostDirectory, exportMetadataFile), append(metadataJSON, '\n'))
+	if err != nil {
+		err = fmt.Errorf("failed writing host metadata: %w", err)
+		return
+	}
+	return
+}
+
+// Masks secret values in every command of an exported item, reports whether any command changed
+func maskExportCommands(item *exportItemMetadata, secretValues []string) (masked bool) {
+	commandLists := []*[]string{&item.Predeploy, &item.Install, &item.PostInstall, &item.Preapply, &item.Postapply, &item.PreChecks, &item.PostChecks, &item.Reload}
+	for _, commands := range commandLists {
+		if len(*commands) == 0 {
+			continue
+		}
+		maskedCommands := make([]string, len(*commands))
+		for index, command := range *commands {
+			maskedCommands[index] = maskSecrets(command, secretValues)
+			if maskedCommands[index] != command {
+				masked = true
+			}
+		}
+		*commands = maskedCommands
+	}
+	return
+}
+
+// Text with every secret value replaced, longer values first so a value containing another is masked whole
+func maskSecrets(text string, secretValues []string) (masked string) {
+	masked = text
+	sortedValues := slices.Clone(secretValues)
+	slices.SortFunc(sortedValues, func(a, b string) int {
+		return len(b) - len(a)
+	})
+	for _, value := range sortedValues {
+		if value == "" {
+			continue
+		}
+		masked = strings.ReplaceAll(masked, value, exportMaskedValue)
+	}
+	return
+}
+
+// Location of target path within host export directory (always kept inside the export directory)
+func exportTargetPath(targetFilePath str.RemotePath) (exportPath string) {
+	exportPath = filepath.Join(exportFilesDirectory, filepath.Clean("/"+string(targetFilePath)))
+	return
+}
+
+// Creates export file and any missing parent directories (owner only permissions, remote permissions are in metadata)
+func writeExportFile(path string, content []byte) (err error) {
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return
+	}
+	err = os.WriteFile(path, content, 0600)
+	return
+}
+
+// Copies local file into export (same permissions as written export files)
+func copyExportFile(path string, sourcePath string) (err error) {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return
+	}
+	destination, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return
+	}
+	defer func() {
+		lerr := destination.Close()
+		if err == nil && lerr != nil {
+			err = lerr
+		}
+	}()
+
+	_, err = io.Copy(destination, source)
+	return
+}
@@ -0,0 +1,237 @@
+package local
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"scmp/core/deployment"
+	"scmp/internal/str"
+	"strings"
+	"testing"
+)
+
+func TestExportHostFiles(t *testing.T) {
+	hostFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected hostfiles create failure: %v", err)
+	}
+
+	items := []struct {
+		repoFilePath str.LocalRepoPath
+		info         deployment.FileInfo
+		content      []byte
+	}{
+		{"host1/etc/app/app.conf", deployment.FileInfo{TargetFilePath: "/etc/app/app.conf", Action: deployment.ActionFileModify, Hash: "hash1", Reload: []string{"systemctl restart app"}}, []byte("resolved content\n")},
+		{"host1/opt/app/app.bin.remote-artifact", deployment.FileInfo{TargetFilePath: "/opt/app/app.bin", Action: deployment.ActionFileCreate, Hash: "hash2"}, []byte("binary content")},
+		{"host1/etc/app/conf.d", deployment.FileInfo{TargetFilePath: "/etc/app/conf.d", Action: deployment.ActionDirCreate}, nil},
+		{"host1/etc/app/old.conf", deployment.FileInfo{TargetFilePath: "/etc/app/old.conf", Action: deployment.ActionFileDelete}, nil},
+		{"host1/etc/escape", deployment.FileInfo{TargetFilePath: "/../../escape", Action: deployment.ActionFileCreate, Hash: "hash3"}, []byte("escape")},
+	}
+	var orderedList []str.LocalRepoPath
+	for _, item := range items {
+		item.info.RepoFilePath = item.repoFilePath
+		hostFiles.SetFileMetadata(item.repoFilePath, item.info)
+		if item.content != nil {
+			hostFiles.StoreDataOnce(item.info.Hash, item.content)
+		}
+		orderedList = append(orderedList, item.repoFilePath)
+	}
+	hostFiles.Groups = append(hostFiles.Groups, deployment.NewFileGroup(orderedList))
+
+	for _, includeArtifacts := range []bool{false, true} {
+		exportDirectory := t.TempDir()
+		itemCount, err := exportHostFiles(exportDirectory, "host1", "abc123", hostFiles, includeArtifacts, false, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got '%v'", err)
+		}
+		if itemCount != len(items) {
+			t.Errorf("expected %d exported items, got %d", len(items), itemCount)
+		}
+
+		hostDirectory := filepath.Join(exportDirectory, "host1")
+		expectedFiles := map[string]string{
+			"files/etc/app/app.conf": "resolved content\n",
+			"files/escape":           "escape",
+		}
+		if includeArtifacts {
+			expectedFiles["files/opt/app/app.bin"] = "binary content"
+		} else {
+			expectedFiles["files/opt/app/app.bin"+exportArtifactStubExt] = "sha256:hash2\n"
+		}
+		for path, expectedContent := range expectedFiles {
+			content, err := os.ReadFile(filepath.Join(hostDirectory, path))
+			if err != nil {
+				t.Errorf("expected exported file '%s': %v", path, err)
+				continue
+			}
+			if string(content) != expectedContent {
+				t.Errorf("file '%s': expected content '%s', got '%s'", path, expectedContent, content)
+			}
+		}
+
+		if _, err := os.Stat(filepath.Join(hostDirectory, "files/etc/app/conf.d")); err != nil {
+			t.Errorf("expected exported directory: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(hostDirectory, "files/etc/app/old.conf")); !os.IsNotExist(err) {
+			t.Errorf("expected no content for deleted file, got '%v'", err)
+		}
+
+		metadataFile, err := os.ReadFile(filepath.Join(hostDirectory, exportMetadataFile))
+		if err != nil {
+			t.Fatalf("failed reading metadata: %v", err)
+		}
+		var metadata exportHostMetadata
+		err = json.Unmarshal(metadataFile, &metadata)
+		if err != nil {
+			t.Fatalf("failed parsing metadata: %v", err)
+		}
+		if metadata.CommitID != "abc123" || len(metadata.Items) != len(items) {
+			t.Fatalf("unexpected metadata '%+v'", metadata)
+		}
+		if metadata.Items[0].Reload[0] != "systemctl restart app" {
+			t.Errorf("expected reload command in metadata, got '%v'", metadata.Items[0].Reload)
+		}
+		if metadata.Items[1].ArtifactStub == includeArtifacts {
+			t.Errorf("expected artifact stub to be %t, got %t", !includeArtifacts, metadata.Items[1].ArtifactStub)
+		}
+		if metadata.Items[3].Action != deployment.ActionFileDelete || metadata.Items[3].ExportPath != "" {
+			t.Errorf("unexpected metadata for deleted file '%+v'", metadata.Items[3])
+		}
+	}
+}
+
+func TestExportHostFilesMasksSecrets(t *testing.T) {
+	hostFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected hostfiles create failure: %v", err)
+	}
+	info := deployment.FileInfo{
+		RepoFilePath:   "host1/etc/app/app.conf",
+		TargetFilePath: "/etc/app/app.conf",
+		Action:         deployment.ActionFileModify,
+		Hash:           "hash1",
+		Reload:         []string{"app-reload --token s3cret-token", "systemctl restart app"},
+	}
+	hostFiles.SetFileMetadata(info.RepoFilePath, info)
+	hostFiles.StoreDataOnce(info.Hash, []byte("password = s3cret\ntoken = s3cret-token\n"))
+	hostFiles.Groups = append(hostFiles.Groups, deployment.NewFileGroup([]str.LocalRepoPath{info.RepoFilePath}))
+
+	tests := []struct {
+		name            string
+		secretValues    []string
+		expectedContent string
+		expectedReload  string
+		expectedMasked  bool
+	}{
+		{"masked", []string{"s3cret", "s3cret-token"}, "password = ********\ntoken = ********\n", "app-reload --token ********", true},
+		{"included", nil, "password = s3cret\ntoken = s3cret-token\n", "app-reload --token s3cret-token", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exportDirectory := t.TempDir()
+			_, err := exportHostFiles(exportDirectory, "host1", "abc123", hostFiles, false, test.secretValues == nil, test.secretValues)
+			if err != nil {
+				t.Fatalf("expected no error, got '%v'", err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(exportDirectory, "host1", "files/etc/app/app.conf"))
+			if err != nil {
+				t.Fatalf("expected exported file: %v", err)
+			}
+			if string(content) != test.expectedContent {
+				t.Errorf("expected content '%s', got '%s'", test.expectedContent, content)
+			}
+
+			metadataFile, err := os.ReadFile(filepath.Join(exportDirectory, "host1", exportMetadataFile))
+			if err != nil {
+				t.Fatalf("failed reading metadata: %v", err)
+			}
+			var metadata exportHostMetadata
+			err = json.Unmarshal(metadataFile, &metadata)
+			if err != nil {
+				t.Fatalf("failed parsing metadata: %v", err)
+			}
+			item := metadata.Items[0]
+			if item.Reload[0] != test.expectedReload || item.Reload[1] != "systemctl restart app" {
+				t.Errorf("expected reload commands '%s', got '%v'", test.expectedReload, item.Reload)
+			}
+			if item.SecretsMasked != test.expectedMasked {
+				t.Errorf("expected secrets masked %t, got %t", test.expectedMasked, item.SecretsMasked)
+			}
+		})
+	}
+
+	// Commands of the plan itself are left as they are
+	if hostFiles.GetFileInfo(info.RepoFilePath).Reload[0] != "app-reload --token s3cret-token" {
+		t.Errorf("expected planned commands to stay unmasked, got '%v'", hostFiles.GetFileInfo(info.RepoFilePath).Reload)
+	}
+}
+
+func TestExportHostFilesEncrypted(t *testing.T) {
+	hostFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected hostfiles create failure: %v", err)
+	}
+	info := deployment.FileInfo{
+		RepoFilePath:   "host1/etc/app/credentials.conf",
+		TargetFilePath: "/etc/app/credentials.conf",
+		Action:         deployment.ActionFileCreate,
+		Hash:           "hash1",
+		FileSize:       15,
+		Encrypted:      true,
+	}
+	hostFiles.SetFileMetadata(info.RepoFilePath, info)
+	hostFiles.StoreDataOnce(info.Hash, []byte("password=hunter\n"))
+	hostFiles.Groups = append(hostFiles.Groups, deployment.NewFileGroup([]str.LocalRepoPath{info.RepoFilePath}))
+
+	for _, includeSecrets := range []bool{false, true} {
+		exportDirectory := t.TempDir()
+		_, err := exportHostFiles(exportDirectory, "host1", "abc123", hostFiles, false, includeSecrets, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got '%v'", err)
+		}
+		hostDirectory := filepath.Join(exportDirectory, "host1")
+
+		metadataFile, err := os.ReadFile(filepath.Join(hostDirectory, exportMetadataFile))
+		if err != nil {
+			t.Fatalf("failed reading metadata: %v", err)
+		}
+		if strings.Contains(string(metadataFile), "hunter") {
+			t.Errorf("expected no decrypted content in metadata")
+		}
+		var metadata exportHostMetadata
+		err = json.Unmarshal(metadataFile, &metadata)
+		if err != nil {
+			t.Fatalf("failed parsing metadata: %v", err)
+		}
+		item := metadata.Items[0]
+		if !item.Encrypted {
+			t.Errorf("expected item marked encrypted")
+		}
+
+		_, err = os.Stat(filepath.Join(hostDirectory, "files/etc/app/credentials.conf"))
+		if includeSecrets {
+			if item.ExportPath != "files/etc/app/credentials.conf" || item.Hash != "hash1" {
+				t.Errorf("expected decrypted export with hash, got '%+v'", item)
+			}
+			if err != nil {
+				t.Errorf("expected decrypted content with included secrets: %v", err)
+			}
+			continue
+		}
+
+		if !os.IsNotExist(err) {
+			t.Errorf("expected no decrypted content without included secrets, got '%v'", err)
+		}
+		if item.ExportPath != "files/etc/app/credentials.conf"+exportEncryptedExt || item.Hash != "" || item.FileSize != 0 {
+			t.Errorf("expected placeholder without hash or size, got '%+v'", item)
+		}
+		placeholder, err := os.ReadFile(filepath.Join(hostDirectory, item.ExportPath))
+		if err != nil {
+			t.Fatalf("expected placeholder file: %v", err)
+		}
+		if strings.Contains(string(placeholder), "hunter") {
+			t.Errorf("expected placeholder without decrypted content, got '%s'", placeholder)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"scmp/core/deployment"
+	"scmp/core/deployment/predeploy"
+	"scmp/core/deployment/repository"
+	"scmp/core/filesystem"
+	"scmp/core/filesystem/metadata"
+	"scmp/internal/config"
+	"scmp/internal/gitinternal"
+	"scmp/internal/global"
+	"scmp/internal/parsing"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Commit that changed files of a deployment
+type DeployableCommit struct {
+	ID      string
+	Author  string
+	When    time.Time
+	Subject string
+	Files   []DeployableFile
+}
+
+// Deployable file changed by a commit or in the worktree
+type DeployableFile struct {
+	Path   str.LocalRepoPath
+	Action str.DeployAction
+	Hosts  []str.RepoRootDir // Hosts receiving the file
+}
+
+// Uncommitted change of a deployable file, header and content compared separately
+type DeployableChange struct {
+	DeployableFile
+	HeaderDiff  string // Unified diff of the parsed metadata header (empty when unchanged)
+	ContentDiff string // Unified diff (or summary for binary/encrypted content) of the content section (empty when unchanged)
+}
+
+// History options: deletions are always shown and offline hosts still count as receiving files
+func historyContext(ctx context.Context) (historyCtx context.Context) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+	opts.AllowDeletions = true
+	opts.IgnoreDeploymentState = true
+	historyCtx = context.WithValue(ctx, global.OpsKey, opts)
+	return
+}
+
+// Reduces changed files to those a deployment of the tree would include for the selected hosts (same filtering as a deployment)
+func deployableFiles(ctx context.Context, tree *object.Tree, commitFiles map[str.LocalRepoPath]str.DeployAction, hostOverride string) (files []DeployableFile, err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	if len(commitFiles) == 0 {
+		return
+	}
+
+	allHostsFiles, universalFiles, err := repository.ParseAllRepoFiles(ctx, tree)
+	if err != nil {
+		err = fmt.Errorf("failed to track files by host/universal directory: %w", err)
+		return
+	}
+	deniedUniversalFiles, err := predeploy.MapDeniedUniversalFiles(ctx, allHostsFiles, universalFiles)
+	if err != nil {
+		err = fmt.Errorf("failed to resolve universal file precedence: %w", err)
+		return
+	}
+
+	_, allDeploymentFiles, hostDeploymentFiles := predeploy.FilterHostsAndFiles(ctx, nil, cfg.HostInfo, deniedUniversalFiles, commitFiles, hostOverride)
+
+	fileHosts := make(map[str.LocalRepoPath][]str.RepoRootDir)
+	for endpointName, hostFiles := range hostDeploymentFiles {
+		for _, repoFilePath := range hostFiles {
+			fileHosts[repoFilePath] = append(fileHosts[repoFilePath], endpointName)
+		}
+	}
+
+	for _, repoFilePath := range slices.Sorted(maps.Keys(allDeploymentFiles)) {
+		hosts := fileHosts[repoFilePath]
+		slices.Sort(hosts)
+		files = append(files, DeployableFile{Path: repoFilePath, Action: allDeploymentFiles[repoFilePath], Hosts: hosts})
+	}
+	return
+}
+
+// Lists commits from HEAD (newest first) that changed deployable files, up to maxCount commits (zero is unlimited)
+// Commits without deployable files for the selected hosts are not listed
+func DeployableLog(ctx context.Context, hostOverride string, maxCount int) (commits []DeployableCommit, err error) {
+	ctx = historyContext(ctx)
+
+	repo, err := gitinternal.OpenRepository(ctx)
+	if err != nil {
+		return
+	}
+	head, err := repo.Head()
+	if err != nil {
+		err = fmt.Errorf("unable to get HEAD reference: %w", err)
+		return
+	}
+	commitIter, err := repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		err = fmt.Errorf("failed retrieving commit history: %w", err)
+		return
+	}
+	defer commitIter.Close()
+
+	for maxCount <= 0 || len(commits) < maxCount {
+		var commit *object.Commit
+		commit, err = commitIter.Next()
+		if err == io.EOF {
+			err = nil
+			break
+		} else if err != nil {
+			err = fmt.Errorf("failed retrieving commit: %w", err)
+			return
+		}
+
+		var tree *object.Tree
+		tree, err = commit.Tree()
+		if err != nil {
+			err = fmt.Errorf("unable to get tree of commit %s: %w", commit.Hash, err)
+			return
+		}
+
+		// First commit has no parent to compare against, all of its files are new
+		var commitFiles map[str.LocalRepoPath]str.DeployAction
+		if commit.NumParents() == 0 {
+			commitFiles, err = repository.GetRepoFiles(ctx, nil, tree, "")
+		} else {
+			var changedFiles []repository.GitChangedFileMetadata
+			changedFiles, err = repository.GetChangedFiles(ctx, commit)
+			if err == nil {
+				commitFiles = repository.ParseChangedFiles(ctx, nil, changedFiles, "")
+			}
+		}
+		if err != nil {
+			err = fmt.Errorf("commit %s: %w", commit.Hash, err)
+			return
+		}
+
+		var files []DeployableFile
+		files, err = deployableFiles(ctx, tree, commitFiles, hostOverride)
+		if err != nil {
+			err = fmt.Errorf("commit %s: %w", commit.Hash, err)
+			return
+		}
+		if len(files) == 0 {
+			continue
+		}
+
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		commits = append(commits, DeployableCommit{
+			ID:      commit.Hash.String(),
+			Author:  commit.Author.Name,
+			When:    commit.Author.When,
+			Subject: subject,
+			Files:   files,
+		})
+	}
+	return
+}
+
+// Compares uncommitted changes of deployable files against the HEAD commit
+func DeployableDiff(ctx context.Context, hostOverride string) (changes []DeployableChange, err error) {
+	ctx = historyContext(ctx)
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	var commitID string
+	tree, _, err := gitinternal.GetCommit(ctx, &commitID)
+	if err != nil {
+		err = fmt.Errorf("error retrieving commit details: %w", err)
+		return
+	}
+
+	changedFiles, err := repository.GetWorktreeChanges(ctx, tree)
+	if err != nil {
+		return
+	}
+	commitFiles := repository.ParseChangedFiles(ctx, nil, changedFiles, "")
+
+	files, err := deployableFiles(ctx, tree, commitFiles, hostOverride)
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		var oldText, newText string
+
+		committedFile, lerr := tree.File(string(file.Path))
+		if lerr == nil {
+			oldText, err = committedFile.Contents()
+			if err != nil {
+				err = fmt.Errorf("failed reading committed content of '%s': %w", file.Path, err)
+				return
+			}
+		}
+
+		newContent, lerr := os.ReadFile(filepath.Join(cfg.RepositoryPath, string(file.Path)))
+		if lerr != nil && !errors.Is(lerr, os.ErrNotExist) {
+			err = fmt.Errorf("failed reading worktree content of '%s': %w", file.Path, lerr)
+			return
+		}
+		newText = string(newContent)
+
+		change := DeployableChange{DeployableFile: file}
+		change.HeaderDiff, change.ContentDiff = diffRepoFile(file.Path, oldText, newText)
+		changes = append(changes, change)
+	}
+	return
+}
+
+// Creates separate diffs of the metadata header and the content section of two versions of a repository file
+// Text without a valid header is compared as a whole in the content diff
+func diffRepoFile(repoFilePath str.LocalRepoPath, oldText string, newText string) (headerDiff string, contentDiff string) {
+	oldName := "a/" + string(repoFilePath)
+	newName := "b/" + string(repoFilePath)
+	if oldText == "" {
+		oldName = "/dev/null"
+	}
+	if newText == "" {
+		newName = "/dev/null"
+	}
+
+	oldHeader, oldContent, oldEncrypted := splitRepoFile(oldText)
+	newHeader, newContent, newEncrypted := splitRepoFile(newText)
+
+	headerDiff, complete := parsing.UnifiedDiff(oldName, newName, oldHeader, newHeader, diffContextLines)
+	if !complete {
+		headerDiff = "  header: too many changes to show a diff\n"
+	}
+
+	if oldContent == newContent {
+		return
+	}
+
+	oldBytes := []byte(oldContent)
+	newBytes := []byte(newContent)
+	isArtifact := str.HasSuffix(repoFilePath, filesystem.ArtifactPointerFileExt)
+	switch {
+	case oldEncrypted || newEncrypted:
+		contentDiff = "  content: encrypted content differs\n"
+	case !isArtifact && (!parsing.IsText(&oldBytes) || !parsing.IsText(&newBytes)):
+		contentDiff = fmt.Sprintf("  content: binary content differs (size %d -> %d)\n", len(oldBytes), len(newBytes))
+	default:
+		contentDiff, complete = parsing.UnifiedDiff(oldName, newName, oldContent, newContent, diffContextLines)
+		if !complete {
+			contentDiff = "  content: too many changes to show a diff\n"
+		}
+	}
+	return
+}
+
+// Splits a repository file into its header (as indented JSON) and content section
+func splitRepoFile(text string) (header string, content string, encrypted bool) {
+	if text == "" {
+		return
+	}
+
+	jsonMetadata, contentSection, err := metadata.Extract(text)
+	if err != nil {
+		content = text
+		return
+	}
+
+	headerJSON, err := json.MarshalIndent(jsonMetadata, "", "  ")
+	if err != nil {
+		content = text
+		return
+	}
+	header = string(headerJSON) + "\n"
+	content = string(contentSection)
+	encrypted = jsonMetadata.Encrypted
+	return
+}
+
+// Action of a file as shown in history output
+func historyAction(action str.DeployAction) (label string) {
+	switch action {
+	case deployment.ActionFileCreate, deployment.ActionDirCreate, deployment.ActionSymLinkCreate:
+		label = "A"
+	case deployment.ActionFileDelete, deployment.ActionDirDelete, deployment.ActionSymLinkDelete:
+		label = "D"
+	default:
+		label = "M"
+	}
+	return
+}
+
+// Writes commits in a compact log format
+func PrintDeployableLog(output io.Writer, commits []DeployableCommit) {
+	for index, commit := range commits {
+		if index > 0 {
+			fmt.Fprintln(output)
+		}
+		fmt.Fprintf(output, "commit %s\n", commit.ID)
+		fmt.Fprintf(output, "Author: %s\n", commit.Author)
+		fmt.Fprintf(output, "Date:   %s\n", commit.When.Format(time.RFC1123Z))
+		fmt.Fprintf(output, "\n    %s\n\n", commit.Subject)
+		for _, file := range commit.Files {
+			fmt.Fprintf(output, "  %s %s (%s)\n", historyAction(file.Action), file.Path, strings.Join(str.ToStrings(file.Hosts), ", "))
+		}
+	}
+}
+
+// Writes worktree changes, the header diff of each file is shown before its content diff
+func PrintDeployableDiff(output io.Writer, changes []DeployableChange) {
+	for _, change := range changes {
+		fmt.Fprintf(output, "%s %s (%s)\n", historyAction(change.Action), change.Path, strings.Join(str.ToStrings(change.Hosts), ", "))
+		if change.HeaderDiff != "" {
+			fmt.Fprintf(output, "--- metadata header ---\n%s", change.HeaderDiff)
+		}
+		if change.ContentDiff != "" {
+			fmt.Fprintf(output, "--- content ---\n%s", change.ContentDiff)
+		}
+		if change.HeaderDiff == "" && change.ContentDiff == "" {
+			fmt.Fprintf(output, "  no header or content changes (file mode only)\n")
+		}
+		fmt.Fprintln(output)
+	}
+}
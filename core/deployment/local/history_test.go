@@ -0,0 +1,166 @@
+package local
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Writes (or removes, for empty content) files in the repository and commits all changes
+func commitHistoryFiles(t *testing.T, repo *git.Repository, repoPath string, message string, files map[string]string) {
+	writeHistoryFiles(t, repoPath, files)
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed opening worktree: %v", err)
+	}
+	err = worktree.AddWithOptions(&git.AddOptions{All: true})
+	if err != nil {
+		t.Fatalf("failed staging files: %v", err)
+	}
+	_, err = worktree.Commit(message, &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}})
+	if err != nil {
+		t.Fatalf("failed committing: %v", err)
+	}
+}
+
+func writeHistoryFiles(t *testing.T, repoPath string, files map[string]string) {
+	for path, content := range files {
+		fullPath := filepath.Join(repoPath, path)
+		if content == "" {
+			err := os.Remove(fullPath)
+			if err != nil {
+				t.Fatalf("failed removing file: %v", err)
+			}
+			continue
+		}
+		err := os.MkdirAll(filepath.Dir(fullPath), 0750)
+		if err != nil {
+			t.Fatalf("failed creating directory: %v", err)
+		}
+		err = os.WriteFile(fullPath, []byte(content), 0640)
+		if err != nil {
+			t.Fatalf("failed writing file: %v", err)
+		}
+	}
+}
+
+func TestDeployableHistory(t *testing.T) {
+	t.Setenv("GIT_DIR", "")
+	t.Setenv("GIT_WORK_TREE", "")
+
+	repoPath, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed resolving temp dir: %v", err)
+	}
+	repo, err := git.PlainInit(repoPath, false)
+	if err != nil {
+		t.Fatalf("failed creating repository: %v", err)
+	}
+	t.Chdir(repoPath)
+
+	const header string = "#|^^^|#\n{\"FileOwnerGroup\": \"root:root\", \"FilePermissions\": %d}\n#|^^^|#\n"
+	commitHistoryFiles(t, repo, repoPath, "initial", map[string]string{
+		"README.md":                "not deployed\n",
+		"web01/etc/motd":           strings.Replace(header, "%d", "644", 1) + "welcome\n",
+		"UniversalConfs/etc/issue": strings.Replace(header, "%d", "644", 1) + "issue\n",
+	})
+	commitHistoryFiles(t, repo, repoPath, "second\n\nbody", map[string]string{
+		"web01/etc/motd":  strings.Replace(header, "%d", "644", 1) + "welcome back\n",
+		"web02/etc/hosts": strings.Replace(header, "%d", "644", 1) + "127.0.0.1 localhost\n",
+	})
+	commitHistoryFiles(t, repo, repoPath, "documentation only", map[string]string{
+		"README.md": "still not deployed\n",
+	})
+
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.OpsKey, config.Opts{})
+	ctx = context.WithValue(ctx, global.ConfKey, config.Config{
+		RepositoryPath:     repoPath,
+		UniversalDirectory: "UniversalConfs",
+		AllUniversalGroups: map[str.RepoRootDir][]str.RepoRootDir{"UniversalConfs": {"web01", "web02"}},
+		HostInfo: map[str.RepoRootDir]config.EndpointInfo{
+			"web01": {EndpointName: "web01", UniversalGroups: map[str.RepoRootDir]struct{}{"UniversalConfs": {}}},
+			"web02": {EndpointName: "web02", UniversalGroups: map[str.RepoRootDir]struct{}{"UniversalConfs": {}}, DeploymentState: "offline"},
+		},
+	})
+
+	commits, err := DeployableLog(ctx, "", 0)
+	if err != nil {
+		t.Fatalf("unexpected log error: %v", err)
+	}
+	if len(commits) != 2 || commits[0].Subject != "second" || commits[1].Subject != "initial" {
+		t.Fatalf("expected the two commits with deployable files (newest first), got %+v", commits)
+	}
+	expectedFiles := []DeployableFile{
+		{Path: "web01/etc/motd", Action: deployment.ActionFileModify, Hosts: []str.RepoRootDir{"web01"}},
+		{Path: "web02/etc/hosts", Action: deployment.ActionFileCreate, Hosts: []str.RepoRootDir{"web02"}},
+	}
+	if !slices.EqualFunc(commits[0].Files, expectedFiles, equalDeployableFile) {
+		t.Errorf("unexpected files of second commit: %+v", commits[0].Files)
+	}
+	expectedFiles = []DeployableFile{
+		{Path: "UniversalConfs/etc/issue", Action: deployment.ActionFileCreate, Hosts: []str.RepoRootDir{"web01", "web02"}},
+		{Path: "web01/etc/motd", Action: deployment.ActionFileCreate, Hosts: []str.RepoRootDir{"web01"}},
+	}
+	if !slices.EqualFunc(commits[1].Files, expectedFiles, equalDeployableFile) {
+		t.Errorf("unexpected files of initial commit: %+v", commits[1].Files)
+	}
+
+	// Host selection reduces files and commit count
+	commits, err = DeployableLog(ctx, "web02", 1)
+	if err != nil {
+		t.Fatalf("unexpected log error: %v", err)
+	}
+	if len(commits) != 1 || len(commits[0].Files) != 1 || commits[0].Files[0].Path != "web02/etc/hosts" {
+		t.Errorf("expected only the web02 file of the newest commit, got %+v", commits)
+	}
+
+	// Uncommitted changes: header and content edit, a deletion, a non-deployable and an untracked file
+	writeHistoryFiles(t, repoPath, map[string]string{
+		"web01/etc/motd":      strings.Replace(header, "%d", "600", 1) + "welcome back\nagain\n",
+		"web02/etc/hosts":     "",
+		"README.md":           "changed\n",
+		"web01/etc/untracked": strings.Replace(header, "%d", "644", 1) + "new\n",
+	})
+
+	changes, err := DeployableDiff(ctx, "")
+	if err != nil {
+		t.Fatalf("unexpected diff error: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 deployable changes, got %+v", changes)
+	}
+
+	motd := changes[0]
+	if motd.Path != "web01/etc/motd" || motd.Action != deployment.ActionFileModify {
+		t.Errorf("unexpected first change %+v", motd.DeployableFile)
+	}
+	if !strings.Contains(motd.HeaderDiff, "-  \"FilePermissions\": 644") || !strings.Contains(motd.HeaderDiff, "+  \"FilePermissions\": 600") {
+		t.Errorf("expected permission change in header diff, got:\n%s", motd.HeaderDiff)
+	}
+	if !strings.Contains(motd.ContentDiff, "+again") || strings.Contains(motd.ContentDiff, "FilePermissions") {
+		t.Errorf("expected only content lines in content diff, got:\n%s", motd.ContentDiff)
+	}
+
+	hosts := changes[1]
+	if hosts.Path != "web02/etc/hosts" || hosts.Action != deployment.ActionFileDelete || !strings.Contains(hosts.ContentDiff, "+++ /dev/null") {
+		t.Errorf("expected deletion of web02/etc/hosts, got %+v\n%s", hosts.DeployableFile, hosts.ContentDiff)
+	}
+}
+
+func equalDeployableFile(a, b DeployableFile) bool {
+	return a.Path == b.Path && a.Action == b.Action && slices.Equal(a.Hosts, b.Hosts)
+}
@@ -0,0 +1,184 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"scmp/core/deployment/metrics"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Planned deployment given to the pre-deployment hook on stdin
+type preDeployHookInput struct {
+	CommitID    string            `json:"CommitID"`
+	Branch      string            `json:"Branch,omitempty"`
+	Hosts       []str.RepoRootDir `json:"Hosts"`
+	FileCount   int               `json:"FileCount"`
+	DryRun      bool              `json:"DryRun,omitempty"`
+	WetRun      bool              `json:"WetRun,omitempty"`
+	Deployments []hookPlan        `json:"Deployments"` // One entry per deployed commit (several when deploying all branches)
+}
+
+// Single commit of a planned deployment
+type hookPlan struct {
+	CommitID  string            `json:"CommitID"`
+	Branch    string            `json:"Branch,omitempty"`
+	Hosts     []str.RepoRootDir `json:"Hosts"`
+	FileCount int               `json:"FileCount"`
+}
+
+// Runs the configured pre-deployment hook with the plan as JSON on stdin (nothing configured does nothing)
+// A failing hook aborts the deployment before any host is connected to
+func runPreDeployHook(ctx context.Context, plans []deploymentPlan, branch string, commitID string) (err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	if cfg.PreDeployHook == "" {
+		return
+	}
+
+	hookInput := preDeployHookInput{
+		CommitID: commitID,
+		Branch:   branch,
+		DryRun:   opts.DryRunEnabled,
+		WetRun:   opts.WetRunEnabled,
+	}
+	for _, plan := range plans {
+		hookInput.Hosts = append(hookInput.Hosts, plan.hosts...)
+		hookInput.FileCount += plan.deployFiles.Count()
+		hookInput.Deployments = append(hookInput.Deployments, hookPlan{
+			CommitID:  plan.commitID,
+			Branch:    plan.branch,
+			Hosts:     plan.hosts,
+			FileCount: plan.deployFiles.Count(),
+		})
+	}
+
+	inputJSON, err := json.Marshal(hookInput)
+	if err != nil {
+		err = fmt.Errorf("failed to create pre-deployment hook input: %w", err)
+		return
+	}
+
+	hostNames := make([]string, 0, len(hookInput.Hosts))
+	for _, hostName := range hookInput.Hosts {
+		hostNames = append(hostNames, string(hostName))
+	}
+	environment := append(hookEnvironment("pre", commitID, branch, opts),
+		"SCMP_HOSTS="+strings.Join(hostNames, ","),
+		"SCMP_HOST_COUNT="+strconv.Itoa(len(hookInput.Hosts)),
+		"SCMP_FILE_COUNT="+strconv.Itoa(hookInput.FileCount),
+	)
+
+	logctx.LogStdInfo(ctx, "Running pre-deployment hook '%s'\n", cfg.PreDeployHook)
+	err = runHook(ctx, cfg.PreDeployHook, environment, inputJSON, time.Duration(opts.ExecutionTimeout)*time.Second)
+	if err != nil {
+		err = fmt.Errorf("pre-deployment hook failed, aborting deployment: %w", err)
+		return
+	}
+	return
+}
+
+// Runs the configured post-deployment hook with the final deployment summary as JSON on stdin (nothing configured does nothing)
+func runPostDeployHook(ctx context.Context, deploymentSummary metrics.Summary) (err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	if cfg.PostDeployHook == "" {
+		return
+	}
+
+	summaryJSON, err := deploymentSummary.JSON()
+	if err != nil {
+		err = fmt.Errorf("failed to create post-deployment hook input: %w", err)
+		return
+	}
+	summaryJSON = logctx.Mask(ctx, summaryJSON)
+
+	environment := append(hookEnvironment("post", deploymentSummary.CommitID, deploymentSummary.Branch, opts),
+		"SCMP_STATUS="+deploymentSummary.Status,
+	)
+
+	// Stopped deployments still report their summary
+	logctx.LogStdInfo(ctx, "Running post-deployment hook '%s'\n", cfg.PostDeployHook)
+	err = runHook(context.WithoutCancel(ctx), cfg.PostDeployHook, environment, []byte(summaryJSON), time.Duration(opts.ExecutionTimeout)*time.Second)
+	if err != nil {
+		err = fmt.Errorf("post-deployment hook failed: %w", err)
+		return
+	}
+	return
+}
+
+// Runs both hooks for a dry-run, the post hook summary only records what was planned
+func runDryRunHooks(ctx context.Context, plans []deploymentPlan, branch string, commitID string) (err error) {
+	err = runPreDeployHook(ctx, plans, branch, commitID)
+	if err != nil {
+		return
+	}
+
+	deploymentSummary := metrics.Summary{
+		Status:   metrics.StatusDryRun,
+		CommitID: commitID,
+		Branch:   branch,
+	}
+	for _, plan := range plans {
+		deploymentSummary.Counters.Hosts += len(plan.hosts)
+		deploymentSummary.Counters.Items += plan.deployFiles.Count()
+	}
+	err = runPostDeployHook(ctx, deploymentSummary)
+	return
+}
+
+// Variables shared by both hooks, appended to the controller environment
+func hookEnvironment(hookType string, commitID string, branch string, opts config.Opts) (environment []string) {
+	environment = append(os.Environ(),
+		"SCMP_HOOK="+hookType,
+		"SCMP_COMMIT_ID="+commitID,
+		"SCMP_BRANCH="+branch,
+		"SCMP_DRY_RUN="+strconv.FormatBool(opts.DryRunEnabled),
+		"SCMP_WET_RUN="+strconv.FormatBool(opts.WetRunEnabled),
+	)
+	return
+}
+
+// Runs a local executable, hook output goes to stderr so it never mixes with JSON on stdout
+// Hooks running longer than the timeout are killed
+func runHook(ctx context.Context, hookPath string, environment []string, input []byte, timeout time.Duration) (err error) {
+	hookCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		hookCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	hook := exec.CommandContext(hookCtx, hookPath)
+	hook.Env = environment
+	hook.Stdin = bytes.NewReader(input)
+	hook.Stdout = os.Stderr
+	hook.Stderr = os.Stderr
+
+	err = hook.Run()
+	if errors.Is(hookCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("'%s' did not finish within %s", hookPath, timeout)
+		return
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		err = fmt.Errorf("'%s' exited with status %d", hookPath, exitErr.ExitCode())
+		return
+	} else if err != nil {
+		err = fmt.Errorf("unable to run '%s': %w", hookPath, err)
+		return
+	}
+	return
+}
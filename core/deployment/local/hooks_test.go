@@ -0,0 +1,116 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Writes an executable shell script into the test temp directory
+func writeTestHook(t *testing.T, script string) (hookPath string) {
+	hookPath = filepath.Join(t.TempDir(), "hook.sh")
+	err := os.WriteFile(hookPath, []byte("#!/bin/sh\n"+script), 0700)
+	if err != nil {
+		t.Fatalf("failed to write test hook: %v", err)
+	}
+	return
+}
+
+func TestRunPreDeployHook(t *testing.T) {
+	outputDirectory := t.TempDir()
+	inputFile := filepath.Join(outputDirectory, "stdin")
+	envFile := filepath.Join(outputDirectory, "env")
+
+	tests := []struct {
+		name        string
+		script      string
+		expectError bool
+	}{
+		{
+			name:   "plan received",
+			script: "cat > '" + inputFile + "'\necho \"$SCMP_HOOK $SCMP_COMMIT_ID $SCMP_HOSTS $SCMP_HOST_COUNT $SCMP_FILE_COUNT\" > '" + envFile + "'\n",
+		},
+		{
+			name:        "failure aborts",
+			script:      "echo 'change window closed' >&2\nexit 3\n",
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := t.Context()
+			ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+			ctx = context.WithValue(ctx, global.ConfKey, config.Config{PreDeployHook: writeTestHook(t, test.script)})
+			ctx = context.WithValue(ctx, global.OpsKey, config.Opts{ExecutionTimeout: 10})
+
+			deployFiles := deployment.NewAllFiles()
+			deployFiles.AddMetadata("web01/etc/nginx/nginx.conf", deployment.FileInfo{})
+			plans := []deploymentPlan{{
+				branch:      "main",
+				commitID:    "abc123",
+				hosts:       []str.RepoRootDir{"web01", "web02"},
+				deployFiles: deployFiles,
+			}}
+
+			err := runPreDeployHook(ctx, plans, "main", "abc123")
+			if test.expectError {
+				if err == nil {
+					t.Fatalf("expected error from failing hook")
+				}
+				if !strings.Contains(err.Error(), "exited with status 3") {
+					t.Errorf("expected exit status in error, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			environment, err := os.ReadFile(envFile)
+			if err != nil {
+				t.Fatalf("hook did not record environment: %v", err)
+			}
+			expectedEnvironment := "pre abc123 web01,web02 2 1\n"
+			if string(environment) != expectedEnvironment {
+				t.Errorf("expected environment %q, got %q", expectedEnvironment, environment)
+			}
+
+			inputJSON, err := os.ReadFile(inputFile)
+			if err != nil {
+				t.Fatalf("hook did not record stdin: %v", err)
+			}
+			var hookInput preDeployHookInput
+			err = json.Unmarshal(inputJSON, &hookInput)
+			if err != nil {
+				t.Fatalf("hook stdin is not valid JSON: %v", err)
+			}
+			if hookInput.CommitID != "abc123" || hookInput.FileCount != 1 || !slices.Equal(hookInput.Hosts, plans[0].hosts) {
+				t.Errorf("unexpected hook input: %+v", hookInput)
+			}
+		})
+	}
+}
+
+func TestRunHookTimeout(t *testing.T) {
+	ctx := t.Context()
+	hookPath := writeTestHook(t, "exec sleep 5\n")
+
+	err := runHook(ctx, hookPath, os.Environ(), nil, 100*time.Millisecond)
+	if err == nil {
+		t.Fatalf("expected timeout error")
+	}
+	if !strings.Contains(err.Error(), "did not finish within") {
+		t.Errorf("expected timeout error, got: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package local
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"scmp/core/deployment"
+	"scmp/internal/logctx"
+	"syscall"
+)
+
+// Watches for interrupts during a deployment
+// The first interrupt stops deployCtx (cause deployment.ErrInterrupted) so nothing new starts while in-flight files finish
+// The second interrupt ends abortCtx to cut off in-flight files, after which default handling lets a third one exit immediately
+func handleInterrupts(ctx context.Context) (deployCtx context.Context, abortCtx context.Context, stop func()) {
+	deployCtx, cancelDeploy := context.WithCancelCause(ctx)
+	abortCtx, cancelAbort := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		defer signal.Stop(signals)
+
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+		logctx.LogStdWarn(ctx, "Interrupt received, finishing in-flight files (interrupt again to abort them)\n")
+		cancelDeploy(deployment.ErrInterrupted)
+
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+		logctx.LogStdWarn(ctx, "Second interrupt received, aborting in-flight files\n")
+		cancelAbort()
+	}()
+
+	stop = func() {
+		close(done)
+		cancelAbort()
+		cancelDeploy(context.Canceled)
+	}
+	return
+}
@@ -0,0 +1,202 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"scmp/core/deployment"
+	"scmp/core/deployment/predeploy"
+	"scmp/core/filesystem"
+	"scmp/core/filesystem/metadata"
+	"scmp/internal/config"
+	"scmp/internal/config/sshconfig"
+	"scmp/internal/gitinternal"
+	"scmp/internal/global"
+	"scmp/internal/secrets"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	SeverityError   string = "error"   // Deployments involving the subject fail
+	SeverityWarning string = "warning" // Likely mistake, deployments still run
+)
+
+// Single problem found in the controller configuration or the repository layout
+type ConfigFinding struct {
+	Severity string `json:"Severity"`
+	Subject  string `json:"Subject"` // Host, group, directory, file, or path the finding is about
+	Message  string `json:"Message"`
+}
+
+// All problems found by a configuration lint
+type ConfigReport struct {
+	Errors   int             `json:"Errors"`
+	Warnings int             `json:"Warnings"`
+	Findings []ConfigFinding `json:"Findings"`
+}
+
+func (report *ConfigReport) add(severity string, subject string, format string, args ...any) {
+	report.Findings = append(report.Findings, ConfigFinding{Severity: severity, Subject: subject, Message: fmt.Sprintf(format, args...)})
+	if severity == SeverityError {
+		report.Errors++
+	} else {
+		report.Warnings++
+	}
+}
+
+// Checks the controller configuration and the HEAD commit of the repository for every known problem without stopping at the first one
+// Vault entries are only compared against configured hosts when requested (requires the vault password)
+func LintConfig(ctx context.Context, configPath string, checkVault bool) (report ConfigReport) {
+	report.Findings = []ConfigFinding{}
+
+	ctx, err := sshconfig.Set(ctx, configPath)
+	if err != nil {
+		report.add(SeverityError, configPath, "%v", err)
+		return
+	}
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	lintHostEntries(cfg, &report)
+
+	var commitID string
+	tree, _, err := gitinternal.GetCommit(ctx, &commitID)
+	if err != nil {
+		report.add(SeverityError, cfg.RepositoryPath, "error retrieving commit details: %v", err)
+	} else {
+		lintRepositoryLayout(ctx, cfg, tree, &report)
+	}
+
+	if checkVault {
+		lintVaultEntries(ctx, cfg, &report)
+	}
+	return
+}
+
+// Hosts that cannot be connected to or logged in to
+func lintHostEntries(cfg config.Config, report *ConfigReport) {
+	for _, hostName := range slices.Sorted(maps.Keys(cfg.HostInfo)) {
+		hostInfo := cfg.HostInfo[hostName]
+		subject := string(hostName)
+
+		if hostInfo.EndpointError != nil {
+			report.add(SeverityError, subject, "%v", hostInfo.EndpointError)
+		} else if hostInfo.Endpoint == "" {
+			report.add(SeverityError, subject, "host has no Hostname")
+		}
+		if hostInfo.EndpointUser == "" {
+			report.add(SeverityError, subject, "host has no User")
+		}
+
+		if hostInfo.IdentityFile == "" {
+			if !hostInfo.RequiresVault && hostInfo.PasswordCommand == "" && hostInfo.PasswordEnv == "" {
+				report.add(SeverityError, subject, "host has no IdentityFile and neither PasswordRequired, PasswordCommand, nor PasswordEnv is set (no way to log in)")
+			}
+		} else {
+			identityStat, lerr := os.Stat(hostInfo.IdentityFile)
+			if os.IsNotExist(lerr) {
+				report.add(SeverityError, subject, "IdentityFile '%s' does not exist", hostInfo.IdentityFile)
+			} else if lerr != nil {
+				report.add(SeverityError, subject, "IdentityFile '%s' is not readable: %v", hostInfo.IdentityFile, lerr)
+			} else if identityStat.Mode().Perm()&0077 != 0 {
+				report.add(SeverityWarning, subject, "IdentityFile '%s' is accessible by other users (permissions %04o), expected 0600",
+					hostInfo.IdentityFile, identityStat.Mode().Perm())
+			}
+		}
+
+		if hostInfo.RequiresVault && cfg.VaultFilePath == "" {
+			report.add(SeverityError, subject, "PasswordRequired is enabled but no PasswordVault is configured")
+		}
+	}
+}
+
+// Directories without hosts, groups without directories, unparsable headers, and dependency loops in the HEAD commit
+func lintRepositoryLayout(ctx context.Context, cfg config.Config, tree *object.Tree, report *ConfigReport) {
+	deployFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		report.add(SeverityError, cfg.RepositoryPath, "%v", err)
+		return
+	}
+
+	topDirectories := make(map[str.RepoRootDir]struct{})
+	var headerFiles []str.LocalRepoPath
+	err = tree.Files().ForEach(func(file *object.File) (err error) {
+		topDirectory, _, inDirectory := strings.Cut(file.Name, "/")
+		if inDirectory {
+			topDirectories[str.RepoRootDir(topDirectory)] = struct{}{}
+		}
+
+		content, err := file.Contents()
+		if err != nil {
+			err = fmt.Errorf("failed reading '%s': %w", file.Name, err)
+			return
+		}
+		if !strings.Contains(content, filesystem.MetaDelimiter) {
+			return
+		}
+
+		repoFilePath := str.LocalRepoPath(file.Name)
+		metaHeader, _, lerr := metadata.Extract(content)
+		if lerr != nil {
+			report.add(SeverityError, file.Name, "unparsable metadata header: %v", lerr)
+			return
+		}
+		headerFiles = append(headerFiles, repoFilePath)
+		deployFiles.SetFileMetadata(repoFilePath, deployment.FileInfo{RepoFilePath: repoFilePath, Dependencies: metaHeader.Dependencies})
+		return
+	})
+	if err != nil {
+		report.add(SeverityError, cfg.RepositoryPath, "%v", err)
+		return
+	}
+
+	for _, directory := range slices.Sorted(maps.Keys(topDirectories)) {
+		// Hidden and underscore prefixed directories are ignored by deployments
+		if strings.HasPrefix(string(directory), ".") || strings.HasPrefix(string(directory), "_") {
+			continue
+		}
+		_, isHost := cfg.HostInfo[directory]
+		_, isGroup := cfg.AllUniversalGroups[directory]
+		if !isHost && !isGroup {
+			report.add(SeverityWarning, string(directory), "repository directory has no matching Host entry or group (its files are never deployed)")
+		}
+	}
+
+	for _, group := range slices.Sorted(maps.Keys(cfg.AllUniversalGroups)) {
+		if _, hasDirectory := topDirectories[group]; hasDirectory {
+			continue
+		}
+		groupHosts := slices.Clone(cfg.AllUniversalGroups[group])
+		slices.Sort(groupHosts)
+		report.add(SeverityWarning, string(group), "group has no directory in the repository (used by host(s): %s)", str.Join(groupHosts, ", "))
+	}
+
+	_, err = predeploy.HandleFileDependencies(ctx, headerFiles, deployFiles, false)
+	if err != nil {
+		report.add(SeverityError, "Dependencies", "%v", err)
+	}
+}
+
+// Vault entries without hosts and hosts requiring passwords without vault entries
+func lintVaultEntries(ctx context.Context, cfg config.Config, report *ConfigReport) {
+	entryNames, err := secrets.VaultEntryNames(ctx, cfg.VaultFilePath)
+	if err != nil {
+		report.add(SeverityError, cfg.VaultFilePath, "unable to read vault: %v", err)
+		return
+	}
+
+	for _, entryName := range entryNames {
+		if _, isHost := cfg.HostInfo[entryName]; !isHost {
+			report.add(SeverityWarning, string(entryName), "vault entry has no Host entry in the configuration (expected only for artifact servers)")
+		}
+	}
+	for _, hostName := range slices.Sorted(maps.Keys(cfg.HostInfo)) {
+		if cfg.HostInfo[hostName].RequiresVault && !slices.Contains(entryNames, hostName) {
+			report.add(SeverityError, string(hostName), "PasswordRequired is enabled but the host has no vault entry")
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package local
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestLintConfig(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.OpsKey, config.Opts{})
+	t.Setenv("GIT_DIR", "")
+	t.Setenv("GIT_WORK_TREE", "")
+
+	repoPath, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed resolving temp dir: %v", err)
+	}
+	repo, err := git.PlainInit(repoPath, false)
+	if err != nil {
+		t.Fatalf("failed creating repository: %v", err)
+	}
+
+	repoFiles := map[string]string{
+		"web01/etc/motd":          "#|^^^|#\n{\"FileOwnerGroup\": \"root:root\", \"FilePermissions\": 644}\n#|^^^|#\nwelcome\n",
+		"web01/etc/broken.conf":   "#|^^^|#\n{\"FileOwnerGroup\": \n#|^^^|#\ncontent\n",
+		"web01/etc/a.conf":        "#|^^^|#\n{\"FileOwnerGroup\": \"root:root\", \"FilePermissions\": 644, \"Dependencies\": [\"web01/etc/b.conf\"]}\n#|^^^|#\na\n",
+		"web01/etc/b.conf":        "#|^^^|#\n{\"FileOwnerGroup\": \"root:root\", \"FilePermissions\": 644, \"Dependencies\": [\"web01/etc/a.conf\"]}\n#|^^^|#\nb\n",
+		"oldhost/etc/motd":        "unmanaged\n",
+		"UniversalConfs/etc/motd": "universal\n",
+	}
+	for path, content := range repoFiles {
+		fullPath := filepath.Join(repoPath, path)
+		err = os.MkdirAll(filepath.Dir(fullPath), 0750)
+		if err != nil {
+			t.Fatalf("failed creating directory: %v", err)
+		}
+		err = os.WriteFile(fullPath, []byte(content), 0640)
+		if err != nil {
+			t.Fatalf("failed writing file: %v", err)
+		}
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed opening worktree: %v", err)
+	}
+	err = worktree.AddGlob(".")
+	if err != nil {
+		t.Fatalf("failed staging files: %v", err)
+	}
+	_, err = worktree.Commit("initial", &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}})
+	if err != nil {
+		t.Fatalf("failed committing: %v", err)
+	}
+	t.Chdir(repoPath)
+
+	configDir := t.TempDir()
+	identityFile := filepath.Join(configDir, "web01.key")
+	err = os.WriteFile(identityFile, []byte("key"), 0644)
+	if err != nil {
+		t.Fatalf("failed writing identity file: %v", err)
+	}
+	configPath := filepath.Join(configDir, "config")
+	sshConfig := "IgnoreUnknown UniversalDirectory,GroupTags\n" +
+		"UniversalDirectory UniversalConfs\n" +
+		"Host web01\n  Hostname 192.0.2.1\n  User deployer\n  IdentityFile " + identityFile + "\n  GroupTags Appliances\n" +
+		"Host web02\n  Hostname 192.0.2.2\n  IdentityFile " + filepath.Join(configDir, "missing.key") + "\n" +
+		"Host web03\n  User deployer\n"
+	err = os.WriteFile(configPath, []byte(sshConfig), 0600)
+	if err != nil {
+		t.Fatalf("failed writing SSH config: %v", err)
+	}
+
+	report := LintConfig(ctx, configPath, false)
+
+	expected := []ConfigFinding{
+		{Severity: SeverityWarning, Subject: "web01", Message: "IdentityFile '" + identityFile + "' is accessible by other users (permissions 0644), expected 0600"},
+		{Severity: SeverityError, Subject: "web02", Message: "host has no User"},
+		{Severity: SeverityError, Subject: "web02", Message: "IdentityFile '" + filepath.Join(configDir, "missing.key") + "' does not exist"},
+		{Severity: SeverityError, Subject: "web03", Message: "host has no Hostname"},
+		{Severity: SeverityError, Subject: "web03", Message: "host has no IdentityFile and neither PasswordRequired, PasswordCommand, nor PasswordEnv is set (no way to log in)"},
+		{Severity: SeverityWarning, Subject: "oldhost", Message: "repository directory has no matching Host entry or group (its files are never deployed)"},
+		{Severity: SeverityWarning, Subject: "Appliances", Message: "group has no directory in the repository (used by host(s): web01)"},
+	}
+	for _, expectedFinding := range expected {
+		found := false
+		for _, finding := range report.Findings {
+			if finding == expectedFinding {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("expected finding %+v", expectedFinding)
+		}
+	}
+
+	var foundBrokenHeader, foundCircular bool
+	for _, finding := range report.Findings {
+		switch finding.Subject {
+		case "web01/etc/broken.conf":
+			foundBrokenHeader = finding.Severity == SeverityError
+		case "Dependencies":
+			foundCircular = finding.Severity == SeverityError
+		}
+	}
+	if !foundBrokenHeader {
+		t.Errorf("expected unparsable header error, got %+v", report.Findings)
+	}
+	if !foundCircular {
+		t.Errorf("expected circular dependency error, got %+v", report.Findings)
+	}
+	if report.Errors != 6 || report.Warnings != 3 {
+		t.Errorf("expected 6 errors and 3 warnings, got %d and %d: %+v", report.Errors, report.Warnings, report.Findings)
+	}
+
+	// Unreadable configuration is a single finding instead of a failure
+	report = LintConfig(ctx, filepath.Join(configDir, "missing-config"), false)
+	if report.Errors != 1 || len(report.Findings) != 1 {
+		t.Errorf("expected a single configuration error, got %+v", report.Findings)
+	}
+}
@@ -0,0 +1,104 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"scmp/core/filesystem"
+	"scmp/core/filesystem/content"
+	"scmp/core/filesystem/metadata"
+	"scmp/internal/config"
+	"scmp/internal/gitinternal"
+	"scmp/internal/global"
+	"scmp/internal/str"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Single problem found in a repository file metadata header
+type HeaderFinding struct {
+	RepoFilePath str.LocalRepoPath
+	Message      string
+	Unsafe       bool // Header would be rejected by deployments
+}
+
+// Checks every metadata header in the HEAD commit for unsafe and suspicious values without deploying anything
+func LintHeaders(ctx context.Context) (findings []HeaderFinding, filesChecked int, err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	var commitID string
+	tree, _, err := gitinternal.GetCommit(ctx, &commitID)
+	if err != nil {
+		err = fmt.Errorf("error retrieving commit details: %w", err)
+		return
+	}
+
+	err = tree.Files().ForEach(func(file *object.File) (err error) {
+		content, err := file.Contents()
+		if err != nil {
+			err = fmt.Errorf("failed reading '%s': %w", file.Name, err)
+			return
+		}
+
+		// Files without a header are not deployed
+		if !strings.Contains(content, filesystem.MetaDelimiter) {
+			return
+		}
+		repoFilePath := str.LocalRepoPath(file.Name)
+		filesChecked++
+
+		metaHeader, fileContent, lerr := metadata.Extract(content)
+		if lerr != nil {
+			findings = append(findings, HeaderFinding{RepoFilePath: repoFilePath, Message: lerr.Error(), Unsafe: true})
+			return
+		}
+
+		lerr = metadata.Validate(metaHeader)
+		if lerr != nil {
+			for message := range strings.SplitSeq(lerr.Error(), "\n") {
+				findings = append(findings, HeaderFinding{RepoFilePath: repoFilePath, Message: message, Unsafe: true})
+			}
+		}
+		for _, warning := range metadata.Lint(metaHeader) {
+			findings = append(findings, HeaderFinding{RepoFilePath: repoFilePath, Message: warning})
+		}
+
+		// Carriage returns are silently removed during deployment unless line endings are chosen
+		normalization := metadata.EffectiveNormalization(metaHeader, cfg.Normalization)
+		if normalization.EOL == "" && metaHeader.ExternalContentLocation == "" && strings.Contains(content, "\r\n") {
+			findings = append(findings, HeaderFinding{RepoFilePath: repoFilePath, Message: "content has CRLF line endings but no Normalize eol is configured (deployed as LF)"})
+		}
+
+		message := artifactFormFinding(metaHeader, fileContent)
+		if message != "" {
+			findings = append(findings, HeaderFinding{RepoFilePath: repoFilePath, Message: message})
+		}
+		return
+	})
+	return
+}
+
+// Recommends a conversion when the storage form of a file contradicts the artifact thresholds
+func artifactFormFinding(metaHeader filesystem.MetaHeader, fileContent []byte) (message string) {
+	if metaHeader.SymbolicLinkTarget != "" {
+		return
+	}
+
+	if metaHeader.ExternalContentLocation == "" {
+		if content.ShouldBeArtifact(fileContent) {
+			message = fmt.Sprintf("content is not plain text or is larger than %d MiB, converting with 'file to-artifact' is recommended", filesystem.ArtifactSizeThreshold>>20)
+		}
+		return
+	}
+
+	// Unreadable artifacts are reported by deployments, not here
+	artifactFilePath, err := content.ArtifactFilePath(metaHeader.ExternalContentLocation)
+	if err != nil {
+		return
+	}
+	inRepo, err := content.ArtifactBelongsInRepo(artifactFilePath)
+	if err == nil && inRepo {
+		message = "artifact content is small plain text, converting with 'file from-artifact' is recommended"
+	}
+	return
+}
@@ -0,0 +1,349 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"scmp/cli"
+	"scmp/core/deployment"
+	"scmp/core/deployment/metrics"
+	"scmp/core/deployment/predeploy"
+	"scmp/core/deployment/repository"
+	"scmp/internal/config"
+	"scmp/internal/gitinternal"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/parsing"
+	"scmp/internal/str"
+	"slices"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Prepared deployment of a single commit to a set of hosts
+type deploymentPlan struct {
+	branch          string // Empty when commit is not from a known branch
+	commitID        string
+	deployFiles     *deployment.AllFiles
+	hosts           []str.RepoRootDir
+	hostFiles       map[str.RepoRootDir]*deployment.HostFiles
+	universalFanout map[str.LocalRepoPath]predeploy.UniversalFanout
+	malformedFiles  map[str.RepoRootDir][]predeploy.MalformedFile // Left out with --force, reported per host in the summary
+}
+
+// Human readable origin of the plans files
+func (plan deploymentPlan) source() (source string) {
+	source = "commit " + plan.commitID
+	if plan.branch != "" {
+		source = "branch '" + plan.branch + "' " + source
+	}
+	return
+}
+
+// Creates a plan for each mapped branch (restricted to the branches hosts) and a HEAD plan for all remaining hosts
+// Branch commits are read directly from the repository, the worktree is not changed
+func planAllBranches(ctx context.Context, skipped *deployment.SkipReport, headBranch string, headCommitID string, hostOverride string, fileOverride string) (plans []deploymentPlan, rollbackCommit bool, err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	var branches []string
+	for branch := range cfg.BranchMappings {
+		branches = append(branches, branch)
+	}
+	slices.Sort(branches)
+
+	mappedHosts := make(map[str.RepoRootDir]struct{})
+	for _, branch := range branches {
+		var branchCommitID string
+		branchCommitID, err = gitinternal.GetBranchCommitID(ctx, branch)
+		if err != nil {
+			err = fmt.Errorf("failed to resolve mapped branch: %w", err)
+			return
+		}
+
+		branchHostList := make(map[str.RepoRootDir]config.EndpointInfo)
+		for _, endpointName := range cfg.BranchMappings[branch] {
+			branchHostList[endpointName] = cfg.HostInfo[endpointName]
+			mappedHosts[endpointName] = struct{}{}
+		}
+
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
+			"Planning deployment of branch '%s' (commit %s) for %d mapped host(s)\n", branch, branchCommitID, len(branchHostList))
+
+		// Planning failures roll back the deployment commit like the single-branch path does
+		var plan deploymentPlan
+		plan, rollbackCommit, err = planDeployment(ctx, skipped, deployment.ModeDiff, branch, branchCommitID, branchHostList, hostOverride, fileOverride, metrics.Summary{})
+		if err != nil {
+			err = fmt.Errorf("branch '%s': %w", branch, err)
+			return
+		}
+		plans = append(plans, plan)
+	}
+
+	// Hosts without a mapping use HEAD
+	headHostList := make(map[str.RepoRootDir]config.EndpointInfo)
+	for endpointName, hostInfo := range cfg.HostInfo {
+		if _, hostIsMapped := mappedHosts[endpointName]; !hostIsMapped {
+			headHostList[endpointName] = hostInfo
+		}
+	}
+	if len(headHostList) == 0 {
+		return
+	}
+
+	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
+		"Planning deployment of HEAD (commit %s) for %d unmapped host(s)\n", headCommitID, len(headHostList))
+
+	plan, rollbackCommit, err := planDeployment(ctx, skipped, deployment.ModeDiff, headBranch, headCommitID, headHostList, hostOverride, fileOverride, metrics.Summary{})
+	if err != nil {
+		return
+	}
+	plans = append(plans, plan)
+	return
+}
+
+// Builds the sorted per-host deployment files for a single commit
+// Only hosts in the host list are considered for deployment
+// Returned plan has no hosts when there is nothing to deploy
+func planDeployment(ctx context.Context, skipped *deployment.SkipReport, deployMode string, branch string, commitID string, hostList map[str.RepoRootDir]config.EndpointInfo, hostOverride string, fileOverride string, lastDeploymentSummary metrics.Summary) (plan deploymentPlan, rollbackCommit bool, err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	plan.branch = branch
+	plan.commitID = commitID
+
+	// Only hosts the user asked for need repository directories (not hosts added by DRN changes)
+	requestedHosts := hostOverride
+
+	tree, commit, err := gitinternal.GetCommit(ctx, &commitID)
+	if err != nil {
+		rollbackCommit = true
+		err = fmt.Errorf("error retrieving commit details: %w", err)
+		return
+	}
+	deployTree := tree
+
+	var commitFiles map[str.LocalRepoPath]str.DeployAction
+
+	// Build initial deployment list based on mode.
+	var extraHostFilter string
+	switch deployMode {
+	case deployment.ModeDiff:
+		var changedFiles []repository.GitChangedFileMetadata
+		changedFiles, err = repository.GetChangedFiles(ctx, commit)
+		if err != nil {
+			rollbackCommit = true
+			err = fmt.Errorf("failed to retrieve changed files: %w", err)
+			return
+		}
+		commitFiles = repository.ParseChangedFiles(ctx, skipped, changedFiles, fileOverride)
+		extraHostFilter, err = repository.TrackDRNChanges(ctx, commitFiles, commit)
+		if err != nil {
+			rollbackCommit = true
+			err = fmt.Errorf("failed to retrieve changed DRN files: %w", err)
+			return
+		}
+	case deployment.ModeAll:
+		if opts.ChangedSince > 0 {
+			commitFiles, extraHostFilter, err = changedSinceFiles(ctx, skipped, commit, time.Now().Add(-opts.ChangedSince), fileOverride)
+			if err != nil {
+				err = fmt.Errorf("failed to retrieve files changed since %s: %w", opts.ChangedSince, err)
+				return
+			}
+			break
+		}
+		commitFiles, err = repository.GetRepoFiles(ctx, skipped, tree, fileOverride)
+		if err != nil {
+			err = fmt.Errorf("failed to retrieve all files: %w", err)
+			return
+		}
+	case deployment.ModeRetry:
+		commitFiles, extraHostFilter, err = lastDeploymentSummary.GetFailures(ctx, fileOverride)
+		if err != nil {
+			err = fmt.Errorf("failed to retrieve failed files: %w", err)
+			return
+		}
+	case deployment.ModeRollback:
+		var changedFiles []repository.GitChangedFileMetadata
+		changedFiles, err = repository.GetChangedFiles(ctx, commit)
+		if err != nil {
+			err = fmt.Errorf("failed to retrieve changed files: %w", err)
+			return
+		}
+		commitFiles, err = repository.GetRollbackFiles(ctx, skipped, changedFiles, fileOverride)
+		if err != nil {
+			err = fmt.Errorf("failed to retrieve rollback files: %w", err)
+			return
+		}
+		deployTree, err = repository.GetParentTree(commit)
+		if err != nil {
+			err = fmt.Errorf("failed to retrieve parent commit tree: %w", err)
+			return
+		}
+		extraHostFilter, err = repository.TrackDRNChanges(ctx, commitFiles, commit)
+		if err != nil {
+			err = fmt.Errorf("failed to retrieve changed DRN files: %w", err)
+			return
+		}
+	default:
+		err = fmt.Errorf("unknown deployment mode: mode must be one of '%v'", cli.GetImmediateChildren(cli.GetCLICmds(), "deploy"))
+		return
+	}
+	if hostOverride != "" && extraHostFilter != "" {
+		hostOverride = hostOverride + "," + extraHostFilter
+	} else if extraHostFilter != "" {
+		hostOverride = extraHostFilter
+	}
+
+	if len(commitFiles) == 0 {
+		// Non-error - can happen under normal operations: When committing files outside of host directories
+		logctx.LogStdInfo(ctx, "No files available for deployment from %s.\n", plan.source())
+		return
+	}
+
+	allHostsFiles, universalFiles, err := repository.ParseAllRepoFiles(ctx, deployTree)
+	if err != nil {
+		rollbackCommit = true
+		err = fmt.Errorf("failed to track files by host/universal directory: %w", err)
+		return
+	}
+
+	err = predeploy.ValidateHostDirectories(ctx, hostList, requestedHosts, allHostsFiles)
+	if err != nil {
+		rollbackCommit = true
+		err = fmt.Errorf("invalid remote-hosts: %w", err)
+		return
+	}
+
+	deniedUniversalFiles, err := predeploy.MapDeniedUniversalFiles(ctx, allHostsFiles, universalFiles)
+	if err != nil {
+		rollbackCommit = true
+		err = fmt.Errorf("failed to resolve universal file precedence: %w", err)
+		return
+	}
+
+	allDeploymentHosts, allDeploymentFiles, hostDeploymentFiles := predeploy.FilterHostsAndFiles(ctx, skipped, hostList, deniedUniversalFiles, commitFiles, hostOverride)
+	if len(allDeploymentFiles) == 0 || len(allDeploymentHosts) == 0 {
+		// Non-error - can happen under normal operations: if user specifies change deploy mode with a host that didn't have any changes in the specified commit
+		logctx.LogStdInfo(ctx, "No deployment files for available hosts from %s.\n", plan.source())
+		return
+	}
+
+	plan.universalFanout = predeploy.MapUniversalFanout(ctx, hostDeploymentFiles)
+
+	rawFileContent, err := predeploy.LoadGitFileContent(ctx, allDeploymentFiles, deployTree)
+	if err != nil {
+		rollbackCommit = true
+		err = fmt.Errorf("error loading files: %w", err)
+		return
+	}
+
+	var malformedFiles []predeploy.MalformedFile
+	plan.deployFiles, malformedFiles, err = predeploy.ParseFileContent(ctx, allDeploymentFiles, rawFileContent)
+	if err != nil {
+		rollbackCommit = true
+		err = fmt.Errorf("error parsing loaded files: %w", err)
+		return
+	}
+
+	// Forced deployments continue without files whose metadata header could not be parsed
+	allDeploymentHosts, plan.malformedFiles = predeploy.DropMalformedFiles(malformedFiles, allDeploymentHosts, hostDeploymentFiles)
+
+	// Files the user replaces on purpose are never held by the shrink guard
+	if opts.ReplaceFiles != "" {
+		plan.deployFiles.MarkReplacement(func(repoFilePath str.LocalRepoPath) bool {
+			return !parsing.CheckForOverride(ctx, opts.ReplaceFiles, string(repoFilePath), cfg.HostInfo)
+		})
+	}
+
+	// Files where only the header changed keep their remote content (the first commit has nothing to compare to)
+	if deployMode == deployment.ModeDiff && commit.NumParents() > 0 {
+		var parentTree *object.Tree
+		parentTree, err = repository.GetParentTree(commit)
+		if err != nil {
+			rollbackCommit = true
+			return
+		}
+		err = predeploy.MarkMetadataOnly(ctx, plan.deployFiles, rawFileContent, parentTree)
+		if err != nil {
+			rollbackCommit = true
+			err = fmt.Errorf("error comparing files to parent commit: %w", err)
+			return
+		}
+	}
+
+	plan.hostFiles, err = predeploy.GroupByHost(ctx, plan.deployFiles, hostDeploymentFiles)
+	if err != nil {
+		rollbackCommit = true
+		err = fmt.Errorf("failed grouping host deployment files: %w", err)
+		return
+	}
+
+	// Resolve DRNs now, contextual by host (sort files depends on the resolved text)
+	err = predeploy.HandleDRNs(ctx, deployTree, plan.hostFiles, cfg.HostInfo)
+	if err != nil {
+		rollbackCommit = true
+		err = fmt.Errorf("drn: %w", err)
+		return
+	}
+
+	// Templated content differs per host, rendered after DRNs so templates see resolved values
+	err = predeploy.RenderTemplates(ctx, plan.hostFiles, cfg.HostInfo)
+	if err != nil {
+		rollbackCommit = true
+		err = fmt.Errorf("template: %w", err)
+		return
+	}
+
+	// Values file macros resolve per host into the rendered output, so values are never parsed as template code
+	// Unresolved names fail planning before any connection
+	err = predeploy.SubstituteValues(ctx, plan.hostFiles, opts.Values)
+	if err != nil {
+		rollbackCommit = true
+		err = fmt.Errorf("values: %w", err)
+		return
+	}
+
+	err = predeploy.SortFiles(ctx, plan.hostFiles)
+	if err != nil {
+		rollbackCommit = true
+		err = fmt.Errorf("failed sorting deployment files: %w", err)
+		return
+	}
+
+	plan.hosts = allDeploymentHosts
+	return
+}
+
+// Files changed by the commits from the given commit back to the cutoff, with the final state of each file
+// Prints the commit range the cutoff resolved to
+func changedSinceFiles(ctx context.Context, skipped *deployment.SkipReport, commit *object.Commit, cutoff time.Time, fileOverride string) (commitFiles map[str.LocalRepoPath]str.DeployAction, extraHostFilter string, err error) {
+	commitRange, err := repository.GetCommitsSince(commit, cutoff)
+	if err != nil {
+		return
+	}
+
+	cutoffTime := cutoff.Format(time.RFC3339)
+	switch {
+	case len(commitRange.Commits) == 0:
+		logctx.LogStdInfo(ctx, "No commits since %s (commit %s is from %s).\n", cutoffTime, commit.Hash, commit.Committer.When.Format(time.RFC3339))
+		return
+	case commitRange.Base == nil:
+		logctx.LogStdInfo(ctx, "Commits since %s: %s back to the first commit %s (%d commit(s), the repository has no older commits).\n",
+			cutoffTime, commitRange.Commits[0].Hash, commitRange.Commits[len(commitRange.Commits)-1].Hash, len(commitRange.Commits))
+	default:
+		logctx.LogStdInfo(ctx, "Commits since %s: %s..%s (%d commit(s)).\n",
+			cutoffTime, commitRange.Base.Hash, commitRange.Commits[0].Hash, len(commitRange.Commits))
+	}
+
+	changedFiles, err := repository.GetChangedFilesSince(ctx, commitRange)
+	if err != nil {
+		return
+	}
+	commitFiles = repository.ParseChangedFiles(ctx, skipped, changedFiles, fileOverride)
+	extraHostFilter, err = repository.TrackDRNChangesSince(ctx, commitFiles, commitRange)
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve changed DRN files: %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,157 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/parsing"
+	"scmp/internal/str"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Single host of a rollout and the plan it deploys from
+type rolloutHost struct {
+	endpointName str.RepoRootDir
+	plan         *deploymentPlan
+}
+
+// Batch of hosts given to the batch check on stdin
+type batchCheckInput struct {
+	Batch          int               `json:"Batch"` // Zero for the canary hosts
+	Hosts          []str.RepoRootDir `json:"Hosts"`
+	RemainingHosts int               `json:"RemainingHosts"`
+}
+
+// Every host of every plan, in plan order
+func planHosts(plans []deploymentPlan) (hosts []rolloutHost) {
+	for planIndex := range plans {
+		for _, endpointName := range plans[planIndex].hosts {
+			hosts = append(hosts, rolloutHost{endpointName: endpointName, plan: &plans[planIndex]})
+		}
+	}
+	return
+}
+
+// Orders hosts by the first remote-hosts choice selecting them, hosts with the same choice (or without an override) are sorted by name
+func orderRolloutHosts(hosts []rolloutHost, hostOverride string, hostInfo map[str.RepoRootDir]config.EndpointInfo, regexEnabled bool) (ordered []rolloutHost) {
+	ranks := make(map[str.RepoRootDir]int, len(hosts))
+	for _, host := range hosts {
+		ranks[host.endpointName] = parsing.OverrideOrder(regexEnabled, hostOverride, string(host.endpointName), hostInfo[host.endpointName])
+	}
+
+	ordered = slices.Clone(hosts)
+	slices.SortStableFunc(ordered, func(a, b rolloutHost) int {
+		if ranks[a.endpointName] != ranks[b.endpointName] {
+			return ranks[a.endpointName] - ranks[b.endpointName]
+		}
+		return strings.Compare(string(a.endpointName), string(b.endpointName))
+	})
+	return
+}
+
+// Splits ordered hosts into the canary batch followed by batches of batchSize (zero puts all remaining hosts in one batch)
+func rolloutBatches(hosts []rolloutHost, canaryHosts int, batchSize int) (batches [][]rolloutHost) {
+	if canaryHosts > 0 {
+		canaryHosts = min(canaryHosts, len(hosts))
+		batches = append(batches, hosts[:canaryHosts])
+		hosts = hosts[canaryHosts:]
+	}
+	if batchSize <= 0 {
+		batchSize = len(hosts)
+	}
+	for batch := range slices.Chunk(hosts, max(batchSize, 1)) {
+		batches = append(batches, batch)
+	}
+	return
+}
+
+// Name of a batch as shown to the user
+func rolloutBatchLabel(batchIndex int, canaryHosts int) (label string) {
+	if canaryHosts > 0 {
+		if batchIndex == 0 {
+			label = "canary"
+			return
+		}
+		batchIndex--
+	}
+	label = "batch " + strconv.Itoa(batchIndex+1)
+	return
+}
+
+// Names of the hosts in a batch
+func rolloutBatchHosts(batch []rolloutHost) (hostNames []str.RepoRootDir) {
+	for _, host := range batch {
+		hostNames = append(hostNames, host.endpointName)
+	}
+	return
+}
+
+// Shows which hosts deploy in which batch
+func printRolloutOrder(ctx context.Context, batches [][]rolloutHost, canaryHosts int) {
+	logctx.LogStdInfo(ctx, "Rollout order:\n")
+	for batchIndex, batch := range batches {
+		hostNames := make([]string, 0, len(batch))
+		for _, host := range batch {
+			hostNames = append(hostNames, string(host.endpointName))
+		}
+		logctx.LogStdInfo(ctx, "  %-10s %s\n", rolloutBatchLabel(batchIndex, canaryHosts)+":", strings.Join(hostNames, ", "))
+	}
+}
+
+// Waits the requested pause before the next batch, returns early once the deployment is stopped
+func pauseBetweenBatches(ctx context.Context, pause time.Duration) {
+	if pause <= 0 {
+		return
+	}
+	logctx.LogStdInfo(ctx, "Waiting %s before the next batch\n", pause)
+	timer := time.NewTimer(pause)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// Runs the batch check with the finished batch as JSON on stdin, a failure halts the remaining batches
+func runBatchCheck(ctx context.Context, batchNumber int, batch []rolloutHost, remainingHosts int, branch string, commitID string) (err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	if opts.BatchCheck == "" {
+		return
+	}
+
+	checkInput := batchCheckInput{
+		Batch:          batchNumber,
+		Hosts:          rolloutBatchHosts(batch),
+		RemainingHosts: remainingHosts,
+	}
+	inputJSON, err := json.Marshal(checkInput)
+	if err != nil {
+		err = fmt.Errorf("failed to create batch check input: %w", err)
+		return
+	}
+
+	hostNames := make([]string, 0, len(checkInput.Hosts))
+	for _, hostName := range checkInput.Hosts {
+		hostNames = append(hostNames, string(hostName))
+	}
+	environment := append(hookEnvironment("batch", commitID, branch, opts),
+		"SCMP_BATCH="+strconv.Itoa(batchNumber),
+		"SCMP_BATCH_HOSTS="+strings.Join(hostNames, ","),
+		"SCMP_REMAINING_HOST_COUNT="+strconv.Itoa(remainingHosts),
+	)
+
+	logctx.LogStdInfo(ctx, "Running batch check '%s'\n", opts.BatchCheck)
+	err = runHook(ctx, opts.BatchCheck, environment, inputJSON, time.Duration(opts.ExecutionTimeout)*time.Second)
+	if err != nil {
+		err = fmt.Errorf("batch check failed: %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,172 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOrderRolloutHosts(t *testing.T) {
+	plans := []deploymentPlan{
+		{branch: "main", hosts: []str.RepoRootDir{"web03", "db01", "web01"}},
+		{branch: "dev", hosts: []str.RepoRootDir{"web02"}},
+	}
+	hostInfo := map[str.RepoRootDir]config.EndpointInfo{
+		"db01": {UniversalGroups: map[str.RepoRootDir]struct{}{"databases": {}}},
+	}
+
+	tests := []struct {
+		name         string
+		hostOverride string
+		expected     []str.RepoRootDir
+	}{
+		{"sorted without override", "", []str.RepoRootDir{"db01", "web01", "web02", "web03"}},
+		{"remote-hosts order", "web02,group:databases,web03,web01", []str.RepoRootDir{"web02", "db01", "web03", "web01"}},
+		{"unlisted hosts last", "web03", []str.RepoRootDir{"web03", "db01", "web01", "web02"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ordered := orderRolloutHosts(planHosts(plans), test.hostOverride, hostInfo, false)
+			if !slices.Equal(rolloutBatchHosts(ordered), test.expected) {
+				t.Errorf("expected order %v, got %v", test.expected, rolloutBatchHosts(ordered))
+			}
+		})
+	}
+
+	// Hosts keep the plan they deploy from
+	for _, host := range orderRolloutHosts(planHosts(plans), "", hostInfo, false) {
+		if host.endpointName == "web02" && host.plan.branch != "dev" {
+			t.Errorf("expected web02 to deploy from branch 'dev', got '%s'", host.plan.branch)
+		}
+	}
+}
+
+func TestRolloutBatches(t *testing.T) {
+	var hosts []rolloutHost
+	for _, name := range []str.RepoRootDir{"h1", "h2", "h3", "h4", "h5", "h6"} {
+		hosts = append(hosts, rolloutHost{endpointName: name})
+	}
+
+	tests := []struct {
+		name      string
+		canary    int
+		batchSize int
+		expected  [][]str.RepoRootDir
+		labels    []string
+	}{
+		{
+			name:      "canary then batches",
+			canary:    1,
+			batchSize: 2,
+			expected:  [][]str.RepoRootDir{{"h1"}, {"h2", "h3"}, {"h4", "h5"}, {"h6"}},
+			labels:    []string{"canary", "batch 1", "batch 2", "batch 3"},
+		},
+		{
+			name:     "canary then everything",
+			canary:   2,
+			expected: [][]str.RepoRootDir{{"h1", "h2"}, {"h3", "h4", "h5", "h6"}},
+			labels:   []string{"canary", "batch 1"},
+		},
+		{
+			name:      "batches only",
+			batchSize: 4,
+			expected:  [][]str.RepoRootDir{{"h1", "h2", "h3", "h4"}, {"h5", "h6"}},
+			labels:    []string{"batch 1", "batch 2"},
+		},
+		{
+			name:     "canary covers every host",
+			canary:   10,
+			expected: [][]str.RepoRootDir{{"h1", "h2", "h3", "h4", "h5", "h6"}},
+			labels:   []string{"canary"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			batches := rolloutBatches(hosts, test.canary, test.batchSize)
+			if len(batches) != len(test.expected) {
+				t.Fatalf("expected %d batches, got %d", len(test.expected), len(batches))
+			}
+			for batchIndex, batch := range batches {
+				if !slices.Equal(rolloutBatchHosts(batch), test.expected[batchIndex]) {
+					t.Errorf("batch %d: expected %v, got %v", batchIndex, test.expected[batchIndex], rolloutBatchHosts(batch))
+				}
+				if label := rolloutBatchLabel(batchIndex, test.canary); label != test.labels[batchIndex] {
+					t.Errorf("batch %d: expected label '%s', got '%s'", batchIndex, test.labels[batchIndex], label)
+				}
+			}
+		})
+	}
+}
+
+func TestRunBatchCheck(t *testing.T) {
+	outputDirectory := t.TempDir()
+	inputFile := filepath.Join(outputDirectory, "stdin")
+	envFile := filepath.Join(outputDirectory, "env")
+
+	tests := []struct {
+		name        string
+		script      string
+		expectError bool
+	}{
+		{
+			name:   "batch received",
+			script: "cat > '" + inputFile + "'\necho \"$SCMP_HOOK $SCMP_BATCH $SCMP_BATCH_HOSTS $SCMP_REMAINING_HOST_COUNT\" > '" + envFile + "'\n",
+		},
+		{
+			name:        "failure halts",
+			script:      "echo 'error rate too high' >&2\nexit 1\n",
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := t.Context()
+			ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+			ctx = context.WithValue(ctx, global.OpsKey, config.Opts{ExecutionTimeout: 10, BatchCheck: writeTestHook(t, test.script)})
+
+			batch := []rolloutHost{{endpointName: "web01"}, {endpointName: "web02"}}
+			err := runBatchCheck(ctx, 2, batch, 5, "main", "abc123")
+			if test.expectError {
+				if err == nil || !strings.Contains(err.Error(), "exited with status 1") {
+					t.Errorf("expected batch check failure, got '%v'", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			envOutput, err := os.ReadFile(envFile)
+			if err != nil {
+				t.Fatalf("batch check did not run: %v", err)
+			}
+			if strings.TrimSpace(string(envOutput)) != "batch 2 web01,web02 5" {
+				t.Errorf("unexpected batch check environment '%s'", envOutput)
+			}
+
+			var checkInput batchCheckInput
+			inputJSON, err := os.ReadFile(inputFile)
+			if err != nil {
+				t.Fatalf("failed reading batch check input: %v", err)
+			}
+			err = json.Unmarshal(inputJSON, &checkInput)
+			if err != nil {
+				t.Fatalf("invalid batch check input: %v", err)
+			}
+			if checkInput.Batch != 2 || checkInput.RemainingHosts != 5 || !slices.Equal(checkInput.Hosts, []str.RepoRootDir{"web01", "web02"}) {
+				t.Errorf("unexpected batch check input %+v", checkInput)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"scmp/core/deployment"
+	"scmp/core/deployment/actions"
+	"scmp/core/deployment/host"
+	"scmp/core/deployment/remote"
+	"scmp/core/deployment/snapshot"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/secrets"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+)
+
+// Lists snapshots saved for a host, oldest first
+func ListSnapshots(ctx context.Context, hostName string) (snapshots []snapshot.Info, err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	endpointName := str.RepoRootDir(hostName)
+	_, hostExists := cfg.HostInfo[endpointName]
+	if !hostExists {
+		err = fmt.Errorf("host '%s' does not exist in config", hostName)
+		return
+	}
+
+	snapshots, err = snapshot.List(filepath.Join(cfg.SnapshotDirectory, hostName))
+	return
+}
+
+// Puts the planned files of a host back to their state before the deployment of the given snapshot
+// Items that did not exist before the deployment are only removed when deletions are allowed
+func RestoreSnapshot(ctx context.Context, hostName string, snapshotID string) (err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	endpointName := str.RepoRootDir(hostName)
+	hostInfo, hostExists := cfg.HostInfo[endpointName]
+	if !hostExists {
+		err = fmt.Errorf("host '%s' does not exist in config", hostName)
+		return
+	}
+
+	hostDirectory := filepath.Join(cfg.SnapshotDirectory, hostName)
+	manifest, err := snapshot.Load(hostDirectory, snapshotID, snapshot.PhasePre)
+	if err != nil {
+		return
+	}
+
+	if opts.DryRunEnabled {
+		printRestorePlan(ctx, manifest)
+		return
+	}
+
+	hostInfo, err = secrets.GetHostValues(ctx, hostInfo)
+	if err != nil {
+		err = fmt.Errorf("error retrieving host secrets: %w", err)
+		return
+	}
+	cfg.HostInfo[endpointName] = hostInfo
+	err = secrets.GetProxyValues(ctx, cfg.HostInfo, endpointName)
+	if err != nil {
+		err = fmt.Errorf("error retrieving proxy secrets: %w", err)
+		return
+	}
+
+	var hostMeta sshinternal.HostMeta
+	hostMeta.Name = hostInfo.EndpointName
+	hostMeta.Password = hostInfo.SudoPassword
+
+	var proxyClient *sshinternal.ProxyLease
+	hostMeta.SSHClient, proxyClient, _, err = sshinternal.ConnectToSSH(ctx, hostInfo, cfg.ProxyChainInfo(endpointName))
+	if err != nil {
+		err = fmt.Errorf("failed connect to SSH server: %w", err)
+		return
+	}
+	defer func() {
+		if proxyClient != nil {
+			lerr := proxyClient.Close()
+			if err == nil && lerr != nil {
+				err = fmt.Errorf("proxy close: %w", lerr)
+			}
+		}
+		lerr := hostMeta.SSHClient.Close()
+		if err == nil && lerr != nil {
+			err = fmt.Errorf("client close: %w", lerr)
+		}
+	}()
+
+	err = host.RemoteDeploymentPreparation(ctx, &hostMeta)
+	if err != nil {
+		err = fmt.Errorf("remote preparation failed: %w", err)
+		return
+	}
+	defer host.CleanupRemote(ctx, hostMeta)
+
+	// Directories first so restored files and links have their parents
+	var restored, failed int
+	for _, restoreDirectories := range []bool{true, false} {
+		for _, entry := range manifest.Entries {
+			if (entry.Type == remote.DirType) != restoreDirectories {
+				continue
+			}
+			if ctx.Err() != nil {
+				err = fmt.Errorf("stop requested during snapshot restore: %w", context.Cause(ctx))
+				return
+			}
+
+			var changed bool
+			changed, err = restoreEntry(ctx, hostMeta, hostDirectory, manifest.ID, entry)
+			if err != nil {
+				logctx.LogStdErr(ctx, "Failed restoring '%s': %v\n", entry.TargetPath, err)
+				failed++
+				err = nil
+				continue
+			}
+			if changed {
+				restored++
+			}
+		}
+	}
+
+	logctx.LogStdInfo(ctx, "Restored %d of %d item(s) on host '%s' from snapshot '%s'\n", restored, len(manifest.Entries), hostName, manifest.ID)
+	if failed > 0 {
+		err = fmt.Errorf("failed to restore %d item(s)", failed)
+		return
+	}
+	return
+}
+
+// Returns a single remote item to its snapshot state
+func restoreEntry(ctx context.Context, hostMeta sshinternal.HostMeta, hostDirectory string, snapshotID string, entry snapshot.Entry) (changed bool, err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	if !entry.Exists {
+		if !opts.AllowDeletions {
+			logctx.LogStdWarn(ctx, "Not removing '%s' (absent before deployment) without --allow-deletions\n", entry.TargetPath)
+			return
+		}
+		changed, err = actions.DeleteFile(ctx, hostMeta, entry.TargetPath)
+		return
+	}
+	if entry.Skipped != "" {
+		logctx.LogStdWarn(ctx, "Not restoring '%s': %s\n", entry.TargetPath, entry.Skipped)
+		return
+	}
+
+	info := deployment.FileInfo{
+		RepoFilePath:   entry.RepoFilePath,
+		TargetFilePath: entry.TargetPath,
+		OwnerGroup:     entry.OwnerGroup,
+		Permissions:    entry.Permissions,
+		BackupStyle:    cfg.BackupStyle,
+	}
+
+	switch entry.Type {
+	case remote.DirType:
+		info.Action = deployment.ActionDirModify
+		changed, _, err = actions.DeployDirectory(ctx, hostMeta, info)
+	case remote.SymlinkType:
+		changed, _, err = actions.DeploySymLink(ctx, hostMeta, entry.TargetPath, entry.LinkTarget)
+	default:
+		var content []byte
+		content, err = snapshot.ReadContent(hostDirectory, snapshotID, entry.Hash)
+		if err != nil {
+			return
+		}
+		info.Action = deployment.ActionFileModify
+		info.Hash = entry.Hash
+		info.FileSize = len(content)
+		changed, _, _, err = actions.DeployFile(ctx, hostMeta, info, content, deployment.StreamedContent{})
+	}
+	return
+}
+
+// Prints what a restore would do without connecting to the host
+func printRestorePlan(ctx context.Context, manifest snapshot.Manifest) {
+	logctx.LogStdInfo(ctx, "Restore of snapshot '%s' on host '%s' (taken %s):\n", manifest.ID, manifest.Host, manifest.Created.Local().Format("2006-01-02 15:04:05"))
+	for _, entry := range manifest.Entries {
+		switch {
+		case !entry.Exists:
+			logctx.LogStdInfo(ctx, "  %s: remove (absent before deployment)\n", entry.TargetPath)
+		case entry.Skipped != "":
+			logctx.LogStdInfo(ctx, "  %s: not restored (%s)\n", entry.TargetPath, entry.Skipped)
+		case entry.Type == remote.SymlinkType:
+			logctx.LogStdInfo(ctx, "  %s: link to '%s'\n", entry.TargetPath, entry.LinkTarget)
+		default:
+			logctx.LogStdInfo(ctx, "  %s: %s %s %d\n", entry.TargetPath, entry.Type, entry.OwnerGroup, entry.Permissions)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"scmp/core/deployment/metrics"
+	"scmp/core/deployment/statecache"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+)
+
+// Loads the state cache next to the failtracker, hosts with recorded failures have their entries dropped
+// Once the cache file exists every deployment keeps it current, so entries never vouch for content replaced without --use-cache
+func openStateCache(ctx context.Context, failTrackerFilePath string) (stateCache *statecache.Cache, err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	stateCachePath := filepath.Join(filepath.Dir(failTrackerFilePath), statecache.FileName)
+	if !opts.UseCache && !opts.RefreshCache {
+		_, err = os.Stat(stateCachePath)
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+			return
+		} else if err != nil {
+			return
+		}
+	}
+
+	stateCache, err = statecache.Load(stateCachePath)
+	if err != nil {
+		return
+	}
+
+	_, failTrackerSummary, lerr := metrics.GetFailTrackerCommit(failTrackerFilePath)
+	if lerr != nil && !errors.Is(lerr, fs.ErrNotExist) {
+		err = fmt.Errorf("failed reading failtracker for state cache invalidation: %w", lerr)
+		return
+	}
+	invalidateFailedHosts(ctx, stateCache, failTrackerSummary)
+	return
+}
+
+// Drops cache entries of hosts the summary records failures for, their remote state is unknown
+func invalidateFailedHosts(ctx context.Context, stateCache *statecache.Cache, deploymentSummary metrics.Summary) {
+	for _, failedHost := range deploymentSummary.FailedHosts() {
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
+			"Dropping state cache entries of host '%s', it has recorded failures\n", failedHost)
+		stateCache.InvalidateHost(failedHost)
+	}
+}
@@ -0,0 +1,87 @@
+package local
+
+import (
+	"context"
+	"os"
+	"scmp/core/deployment"
+	"scmp/core/deployment/metrics"
+	"scmp/internal/logctx"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Shows one live line per host and/or a deployment progress line until stop is called
+// Terminals redraw lines in place, other outputs get periodic snapshots of all lines
+// With the progress line, hosts that finished are printed once above it
+func startStatusDisplay(ctx context.Context, deployMetrics *metrics.Metrics, hostLines bool, progressLine bool) (stop func()) {
+	logger := logctx.GetLogger(ctx)
+	isTerminal := term.IsTerminal(int(os.Stdout.Fd()))
+
+	interval := deployment.StatusSnapshotInterval
+	if isTerminal {
+		interval = deployment.StatusRedrawInterval
+	}
+
+	draw := func() {
+		var lines []string
+		if hostLines {
+			lines = deployMetrics.ProgressLines()
+		}
+		if progressLine {
+			for _, finishedHost := range deployMetrics.TakeFinishedHostLines() {
+				logctx.LogStdInfo(ctx, "Finished %s\n", finishedHost)
+			}
+			lines = append(lines, deployMetrics.ProgressTotalsLine())
+		}
+
+		if !isTerminal {
+			logctx.LogStdInfo(ctx, "Deployment status:\n  %s\n", strings.Join(lines, "\n  "))
+			return
+		}
+
+		// Wrapped lines would break moving the cursor back over them
+		width, _, err := term.GetSize(int(os.Stdout.Fd()))
+		if err == nil && width > 1 {
+			for index := range lines {
+				lines[index] = truncateLine(lines[index], width-1)
+			}
+		}
+		logger.DrawStatusLines(lines)
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				draw()
+			}
+		}
+	}()
+
+	stop = func() {
+		close(done)
+		<-finished
+		if isTerminal {
+			draw()
+			logger.ReleaseStatusLines()
+		}
+	}
+	return
+}
+
+func truncateLine(line string, width int) (truncated string) {
+	truncated = line
+	if len(truncated) > width {
+		truncated = truncated[:width]
+	}
+	return
+}
@@ -0,0 +1,58 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"scmp/core/deployment"
+	"scmp/core/deployment/predeploy"
+	"scmp/core/deployment/repository"
+	"scmp/internal/config"
+	"scmp/internal/gitinternal"
+	"scmp/internal/global"
+	"scmp/internal/str"
+)
+
+// Determines which hosts would receive the given repository file from HEAD commit without deploying anything
+func WhoGets(ctx context.Context, repoFilePath str.LocalRepoPath) (fileFanout predeploy.UniversalFanout, err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	var commitID string
+	tree, _, err := gitinternal.GetCommit(ctx, &commitID)
+	if err != nil {
+		err = fmt.Errorf("error retrieving commit details: %w", err)
+		return
+	}
+
+	_, err = tree.File(string(repoFilePath))
+	if err != nil {
+		err = fmt.Errorf("repository path '%s' not found in commit %s: %w", repoFilePath, commitID, err)
+		return
+	}
+
+	allHostsFiles, universalFiles, err := repository.ParseAllRepoFiles(ctx, tree)
+	if err != nil {
+		err = fmt.Errorf("failed to track files by host/universal directory: %w", err)
+		return
+	}
+
+	deniedUniversalFiles, err := predeploy.MapDeniedUniversalFiles(ctx, allHostsFiles, universalFiles)
+	if err != nil {
+		err = fmt.Errorf("failed to resolve universal file precedence: %w", err)
+		return
+	}
+
+	// Same host selection as a real deployment of this single file
+	commitFiles := map[str.LocalRepoPath]str.DeployAction{repoFilePath: deployment.ActionFileModify}
+	_, _, hostDeploymentFiles := predeploy.FilterHostsAndFiles(ctx, nil, cfg.HostInfo, deniedUniversalFiles, commitFiles, "")
+
+	universalFanout := predeploy.MapUniversalFanout(ctx, hostDeploymentFiles)
+	fileFanout, fileIsUniversal := universalFanout[repoFilePath]
+	if !fileIsUniversal {
+		fileFanout.Reason = "host directory"
+		for endpointName := range hostDeploymentFiles {
+			fileFanout.Group = endpointName
+			fileFanout.Hosts = append(fileFanout.Hosts, endpointName)
+		}
+	}
+	return
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"os"
+	"time"
+)
+
+const (
+	failTrackerLockSuffix       string        = ".lock"                // Appended to failtracker file path for the lock file
+	failTrackerLockPollInterval time.Duration = 500 * time.Millisecond // Time between lock attempts while waiting on another deployment
+	summaryFileMode             os.FileMode   = 0644                   // Permissions of written summary files
+)
+
+// Reasons files are skipped on a host during deployment (item status is "Skipped (<reason>)")
+const (
+	SkippedCondition string = "condition"
+	skippedPrefix    string = "Skipped"
+)
+
+// Item status of files held by the shrink guard (retried like failures)
+const StatusSuspiciousShrink string = "SuspiciousShrink"
+
+// Item status of files restored after their reload group failed its post-reload checks (retried like failures)
+const StatusRolledBack string = "RolledBack"
+
+// Item status of files left out of forced deployments because their metadata header could not be parsed (retried like failures)
+const StatusParseError string = "ParseError"
+
+// Host and item status of hosts marked RequireConfirmation that were not confirmed (retried like failures)
+const StatusConfirmationRequired string = "ConfirmationRequired"
+
+// Host and item status of hosts stopped by a failed pre-flight check before any file was touched (retried like failures)
+const StatusPreflightFailed string = "PreflightFailed"
+
+// Host and item status of hosts never started because an earlier rollout batch (or the canary) failed (retried like failures)
+const StatusHalted string = "Halted"
+
+// Summary status given to the post-deployment hook of dry-runs (nothing was deployed)
+const StatusDryRun string = "DryRun"
+
+// Summary status of deployments without any changed files for any host
+const StatusUpToDate string = "UpToDate"
+
+// Status of audits finding remote hosts differing from the repository
+const StatusDriftDetected string = "DriftDetected"
+
+// Status of audits finding every remote host matching the repository
+const StatusNoDrift string = "NoDrift"
+
+// Final status of deployments stopped early by an interrupt (the summary keeps the status of what was deployed)
+// Also the host and item status of hosts and files never started after the interrupt (retried like failures)
+const StatusInterrupted string = "Interrupted"
+
+// Results of deployment phases in host summaries
+const (
+	PhaseDeployed   string = "Deployed"
+	PhaseFailed     string = "Failed"
+	PhaseNotStarted string = "NotStarted" // An earlier failed phase stopped the host
+)
+
+// Outcomes of items during wet-runs (item status in place of "Deployed")
+const (
+	WetRunCreate    string = "WouldCreate"
+	WetRunModify    string = "WouldModify"
+	WetRunDelete    string = "WouldDelete"
+	WetRunUnchanged string = "Unchanged"
+)
+
+// Host activities shown in status lines
+const (
+	progressQueued         string = "queued"
+	ProgressPreDeploy      string = "running pre-deployment commands"
+	ProgressConnecting     string = "connecting"
+	ProgressLocking        string = "acquiring deployment lock"
+	ProgressPreparing      string = "preparing remote"
+	ProgressPreflight      string = "running pre-flight checks"
+	ProgressGatheringFacts string = "gathering facts"
+	ProgressSnapshot       string = "capturing snapshot"
+	ProgressDeploying      string = "deploying"
+	ProgressTransferring   string = "transferring "
+	ProgressReloading      string = "reloading "
+	ProgressChecking       string = "checking "
+)
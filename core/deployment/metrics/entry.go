@@ -7,12 +7,26 @@ import (
 
 func New() (new *Metrics) {
 	new = &Metrics{
-		hostFiles:    make(map[str.RepoRootDir][]str.LocalRepoPath),
-		hostBytes:    make(map[str.RepoRootDir]int),
-		hostsFileErr: make(map[str.RepoRootDir]map[str.LocalRepoPath]error),
-		hostErr:      make(map[str.RepoRootDir]error),
-		fileAction:   make(map[str.LocalRepoPath]str.DeployAction),
-		startTime:    time.Now(),
+		hostFiles:        make(map[str.RepoRootDir][]str.LocalRepoPath),
+		hostBytes:        make(map[str.RepoRootDir]int),
+		hostTransfer:     make(map[str.RepoRootDir]*transferWindow),
+		hostsFileErr:     make(map[str.RepoRootDir]map[str.LocalRepoPath]error),
+		hostsFileSkipped: make(map[str.RepoRootDir]map[str.LocalRepoPath]string),
+		hostsFileWetRun:  make(map[str.RepoRootDir]map[str.LocalRepoPath]string),
+		hostsFileBackup:  make(map[str.RepoRootDir]map[str.LocalRepoPath]str.RemotePath),
+		hostsMetaOnly:    make(map[str.RepoRootDir]map[str.LocalRepoPath]struct{}),
+		hostErr:          make(map[str.RepoRootDir]error),
+		fileAction:       make(map[str.LocalRepoPath]str.DeployAction),
+		hostSource:       make(map[str.RepoRootDir]deploymentSource),
+		hostEndpoint:     make(map[str.RepoRootDir]string),
+		hostNotAttempted: make(map[str.RepoRootDir]string),
+		hostUnconfirmed:  make(map[str.RepoRootDir]struct{}),
+		hostHalted:       make(map[str.RepoRootDir]string),
+		hostDeadline:     make(map[str.RepoRootDir]hostDeadline),
+		hostPhases:       make(map[str.RepoRootDir][]PhaseSummary),
+		fileTiming:       make(map[str.RepoRootDir]map[str.LocalRepoPath]FileTiming),
+		hostElapsed:      make(map[str.RepoRootDir]time.Duration),
+		startTime:        time.Now(),
 	}
 	return
 }
@@ -25,5 +39,17 @@ func (metric *Metrics) AnyErrorsPresent() (errorsPresent bool) {
 	if len(metric.hostsFileErr) > 0 {
 		errorsPresent = true
 	}
+
+	metric.hostErrMutex.Lock()
+	if len(metric.hostErr) > 0 {
+		errorsPresent = true
+	}
+	metric.hostErrMutex.Unlock()
+
+	metric.hostNotAttemptedMutex.Lock()
+	if len(metric.hostNotAttempted) > 0 {
+		errorsPresent = true
+	}
+	metric.hostNotAttemptedMutex.Unlock()
 	return
 }
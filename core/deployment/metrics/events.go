@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"scmp/core/deployment/events"
+	"scmp/internal/str"
+)
+
+// Live deployment events, only written after SetEventStream
+
+func (metric *Metrics) SetEventStream(eventStream *events.Writer) {
+	metric.eventStream = eventStream
+}
+
+// Records an event not tied to a metric (no-op without an event stream)
+func (metric *Metrics) Event(eventType string, host str.RepoRootDir, file str.LocalRepoPath, details string) {
+	metric.eventStream.Emit(eventType, host, file, details)
+}
+
+// Records the final status of a host once it is done
+func (metric *Metrics) FinishHost(host str.RepoRootDir) {
+	if metric.eventStream == nil {
+		return
+	}
+	metric.eventStream.Emit(events.HostFinished, host, "", metric.hostFinalStatus(host))
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"scmp/core/deployment"
+	"scmp/core/deployment/events"
+	"scmp/internal/str"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestEventStreamTwoHosts(t *testing.T) {
+	hostFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hostFiles.SetFileMetadata("web01/etc/nginx/nginx.conf", deployment.FileInfo{Action: deployment.ActionFileModify})
+	hostFiles.SetFileMetadata("db01/etc/my.cnf", deployment.FileInfo{Action: deployment.ActionFileModify})
+	hostFiles.SetFileMetadata("db01/etc/hosts", deployment.FileInfo{Action: deployment.ActionFileModify})
+
+	var output bytes.Buffer
+	eventStream := events.NewWriter(&output, "deploy-1")
+	metric := New()
+	metric.SetEventStream(eventStream)
+
+	// Same calls the host deployer makes, hosts running concurrently
+	eventStream.Emit(events.DeploymentStarted, "", "", "3 item(s) to 2 host(s)")
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer metric.FinishHost("web01")
+		metric.Event(events.HostStarted, "web01", "", "")
+		metric.Event(events.HostConnected, "web01", "", "192.0.2.10:22")
+		metric.AddFile("web01", hostFiles, "web01/etc/nginx/nginx.conf")
+		metric.Event(events.FileDeployed, "web01", "web01/etc/nginx/nginx.conf", "")
+	}()
+	go func() {
+		defer wg.Done()
+		defer metric.FinishHost("db01")
+		metric.Event(events.HostStarted, "db01", "", "")
+		metric.Event(events.HostConnected, "db01", "", "192.0.2.20:22")
+		metric.AddFileSkipped("db01", hostFiles, "db01/etc/hosts", SkippedCondition)
+		metric.Event(events.ReloadFailed, "db01", "db01/etc/my.cnf", "reload group mysql: exit status 1")
+		metric.AddFile("db01", hostFiles, "db01/etc/my.cnf")
+		metric.AddFileFailure("db01", "db01/etc/my.cnf", errors.New("reload failed"))
+	}()
+	wg.Wait()
+	eventStream.Emit(events.DeploymentFinished, "", "", "Partial")
+	err = eventStream.Close()
+	if err != nil {
+		t.Fatalf("unexpected error closing event stream: %v", err)
+	}
+
+	var allEvents []events.Event
+	hostSequences := make(map[str.RepoRootDir][]string)
+	scanner := bufio.NewScanner(&output)
+	for scanner.Scan() {
+		var event events.Event
+		err = json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			t.Fatalf("invalid event line '%s': %v", scanner.Text(), err)
+		}
+		if event.DeploymentID != "deploy-1" {
+			t.Errorf("expected deployment ID on every event, got %+v", event)
+		}
+		allEvents = append(allEvents, event)
+		if event.Host != "" {
+			hostSequences[event.Host] = append(hostSequences[event.Host], event.Type)
+		}
+	}
+
+	if len(allEvents) < 2 || allEvents[0].Type != events.DeploymentStarted || allEvents[len(allEvents)-1].Type != events.DeploymentFinished {
+		t.Fatalf("expected stream to start and end with deployment events, got %+v", allEvents)
+	}
+
+	expectedSequences := map[str.RepoRootDir][]string{
+		"web01": {events.HostStarted, events.HostConnected, events.FileDeployed, events.HostFinished},
+		"db01":  {events.HostStarted, events.HostConnected, events.FileSkipped, events.ReloadFailed, events.FileFailed, events.HostFinished},
+	}
+	for host, expected := range expectedSequences {
+		if !slices.Equal(hostSequences[host], expected) {
+			t.Errorf("host %s: expected events %v, got %v", host, expected, hostSequences[host])
+		}
+	}
+
+	// Final host status carried by host_finished
+	for _, event := range allEvents {
+		if event.Type != events.HostFinished {
+			continue
+		}
+		expectedStatus := map[str.RepoRootDir]string{"web01": "Deployed", "db01": "Partial (1 failed)"}[event.Host]
+		if event.Details != expectedStatus {
+			t.Errorf("host %s: expected finished status '%s', got '%s'", event.Host, expectedStatus, event.Details)
+		}
+	}
+}
@@ -29,6 +29,7 @@ func GetFailTrackerCommit(filePath string) (commitID string, prevDeploymentSumma
 		err = fmt.Errorf("commitid missing from failtracker file")
 		return
 	}
+	commitID = prevDeploymentSummary.CommitID
 	return
 }
 
@@ -49,10 +50,17 @@ func (deploymentSummary Summary) GetFailures(ctx context.Context, fileOverride s
 			return
 		}
 
-		if hostReport.Status != "Failed" && hostReport.Status != "Partial" {
+		if !hostFailed(hostReport.Status) {
 			continue
 		}
 
+		// Retry deploys from a single commit, hosts deployed from other branches cannot be included
+		if hostReport.CommitID != "" && hostReport.CommitID != deploymentSummary.CommitID {
+			err = fmt.Errorf("host '%s' failed deploying from branch '%s' commit '%s': retry only supports failures from a single commit, use 'deploy diff --all-branches' instead",
+				hostReport.Name, hostReport.Branch, hostReport.CommitID)
+			return
+		}
+
 		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "  Parsing failure for host %v\n", hostReport.Name)
 
 		// Add host to override to isolate deployment to just the failed hosts
@@ -61,7 +69,7 @@ func (deploymentSummary Summary) GetFailures(ctx context.Context, fileOverride s
 		for _, itemReport := range hostReport.Items {
 			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "   Parsing failure for file %s\n", itemReport.Name)
 
-			if itemReport.Status != "Failed" {
+			if !itemFailed(itemReport.Status) {
 				continue
 			}
 
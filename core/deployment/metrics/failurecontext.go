@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"scmp/internal/sshinternal"
+	"time"
+)
+
+// Failure context of the remote command behind an item error (nil when no remote command failed)
+func newFailureContext(err error) (failure *FailureContext) {
+	var commandErr *sshinternal.CommandError
+	if !errors.As(err, &commandErr) {
+		return
+	}
+
+	failure = &FailureContext{
+		Phase:       commandErr.Phase,
+		Command:     commandErr.Command,
+		ExitCode:    commandErr.ExitCode,
+		Output:      commandErr.Output,
+		ElapsedTime: commandErr.Elapsed.Round(time.Millisecond).String(),
+	}
+	return
+}
+
+// Phase and exit code of the failure on one line
+func (failure FailureContext) Summary() (summary string) {
+	phase := failure.Phase
+	if phase == "" {
+		phase = "remote command"
+	}
+	if failure.ExitCode == sshinternal.ExitCodeNone {
+		summary = fmt.Sprintf("%s failed without exit code after %s", phase, failure.ElapsedTime)
+	} else {
+		summary = fmt.Sprintf("%s failed with exit code %d after %s", phase, failure.ExitCode, failure.ElapsedTime)
+	}
+	return
+}
@@ -1,14 +1,17 @@
 package metrics
 
 import (
+	"fmt"
 	"scmp/core/deployment"
+	"scmp/core/deployment/events"
 	"scmp/internal/str"
+	"slices"
 )
 
 func (metric *Metrics) AddAllDeployFiles(host str.RepoRootDir, files *deployment.HostFiles) {
 	metric.hostFilesMutex.Lock()
 	for _, fileGroup := range files.Groups {
-		metric.hostFiles[host] = append(metric.hostFiles[host], fileGroup.GetOrderedList()...)
+		metric.addHostFiles(host, fileGroup.GetOrderedList()...)
 	}
 	metric.hostFilesMutex.Unlock()
 
@@ -24,7 +27,7 @@ func (metric *Metrics) AddAllDeployFiles(host str.RepoRootDir, files *deployment
 
 func (metric *Metrics) AddFile(host str.RepoRootDir, deployFiles *deployment.HostFiles, files ...str.LocalRepoPath) {
 	metric.hostFilesMutex.Lock()
-	metric.hostFiles[host] = append(metric.hostFiles[host], files...)
+	metric.addHostFiles(host, files...)
 	metric.hostFilesMutex.Unlock()
 
 	metric.fileActionMutex.Lock()
@@ -35,6 +38,16 @@ func (metric *Metrics) AddFile(host str.RepoRootDir, deployFiles *deployment.Hos
 	metric.fileActionMutex.Unlock()
 }
 
+// Tracks files for host, skipping files already tracked (caller must hold hostFilesMutex)
+func (metric *Metrics) addHostFiles(host str.RepoRootDir, files ...str.LocalRepoPath) {
+	for _, file := range files {
+		if slices.Contains(metric.hostFiles[host], file) {
+			continue
+		}
+		metric.hostFiles[host] = append(metric.hostFiles[host], file)
+	}
+}
+
 // Adds file failure error to metric tracking map for host.
 // Does not overwrite error if it already exists (preserves first found error)
 func (metric *Metrics) AddFileFailure(hostname str.RepoRootDir, file str.LocalRepoPath, err error) {
@@ -55,6 +68,67 @@ func (metric *Metrics) AddFileFailure(hostname str.RepoRootDir, file str.LocalRe
 	}
 	hostFileErr[file] = err
 	metric.hostsFileErr[hostname] = hostFileErr
+	metric.eventStream.Emit(events.FileFailed, hostname, file, err.Error())
+}
+
+// Records file left out of a forced deployment because its metadata header could not be parsed (counts as failed)
+// The file is not part of the hosts deployment files, so its action is given directly
+func (metric *Metrics) AddFileParseError(hostname str.RepoRootDir, file str.LocalRepoPath, action str.DeployAction, err error) {
+	metric.hostFilesMutex.Lock()
+	metric.addHostFiles(hostname, file)
+	metric.hostFilesMutex.Unlock()
+
+	metric.fileActionMutex.Lock()
+	metric.fileAction[file] = action
+	metric.fileActionMutex.Unlock()
+
+	metric.AddFileFailure(hostname, file, fmt.Errorf("%w: %w", deployment.ErrMalformedHeader, err))
+}
+
+// Records file as intentionally not deployed to host (not a failure)
+func (metric *Metrics) AddFileSkipped(hostname str.RepoRootDir, deployFiles *deployment.HostFiles, file str.LocalRepoPath, reason string) {
+	metric.AddFile(hostname, deployFiles, file)
+
+	metric.hostsFileSkippedMutex.Lock()
+	defer metric.hostsFileSkippedMutex.Unlock()
+	if metric.hostsFileSkipped[hostname] == nil {
+		metric.hostsFileSkipped[hostname] = make(map[str.LocalRepoPath]string)
+	}
+	metric.hostsFileSkipped[hostname][file] = reason
+	metric.eventStream.Emit(events.FileSkipped, hostname, file, reason)
+}
+
+// Records what a wet-run found the file would do on the host (counts as completed)
+func (metric *Metrics) AddFileWetRun(hostname str.RepoRootDir, deployFiles *deployment.HostFiles, file str.LocalRepoPath, outcome string) {
+	metric.AddFile(hostname, deployFiles, file)
+
+	metric.hostsFileWetRunMutex.Lock()
+	defer metric.hostsFileWetRunMutex.Unlock()
+	if metric.hostsFileWetRun[hostname] == nil {
+		metric.hostsFileWetRun[hostname] = make(map[str.LocalRepoPath]string)
+	}
+	metric.hostsFileWetRun[hostname][file] = outcome
+	metric.eventStream.Emit(events.FileWetRun, hostname, file, outcome)
+}
+
+// Records where the previous remote file was backed up to when the backup is kept after deployment
+func (metric *Metrics) AddFileBackup(hostname str.RepoRootDir, file str.LocalRepoPath, backupPath str.RemotePath) {
+	metric.hostsFileBackupMutex.Lock()
+	defer metric.hostsFileBackupMutex.Unlock()
+	if metric.hostsFileBackup[hostname] == nil {
+		metric.hostsFileBackup[hostname] = make(map[str.LocalRepoPath]str.RemotePath)
+	}
+	metric.hostsFileBackup[hostname][file] = backupPath
+}
+
+// Records that only the metadata of the file was updated on the host (content already matched)
+func (metric *Metrics) AddFileMetadataOnly(hostname str.RepoRootDir, file str.LocalRepoPath) {
+	metric.hostsMetaOnlyMutex.Lock()
+	defer metric.hostsMetaOnlyMutex.Unlock()
+	if metric.hostsMetaOnly[hostname] == nil {
+		metric.hostsMetaOnly[hostname] = make(map[str.LocalRepoPath]struct{})
+	}
+	metric.hostsMetaOnly[hostname][file] = struct{}{}
 }
 
 // Checks if the repository file path for a given host has had an error recorded
@@ -70,3 +144,12 @@ func (metric *Metrics) HostFileHasError(host str.RepoRootDir, repoFilePath str.L
 	err = hostFileErr[repoFilePath]
 	return
 }
+
+// Checks if the repository file path for a given host was recorded as not meant for the host
+func (metric *Metrics) HostFileSkipped(host str.RepoRootDir, repoFilePath str.LocalRepoPath) (skipped bool) {
+	metric.hostsFileSkippedMutex.Lock()
+	defer metric.hostsFileSkippedMutex.Unlock()
+
+	_, skipped = metric.hostsFileSkipped[host][repoFilePath]
+	return
+}
@@ -1,13 +1,18 @@
 package metrics
 
 import (
+	"scmp/core/deployment"
+	"scmp/core/deployment/events"
 	"scmp/internal/str"
+	"time"
 )
 
 func (metric *Metrics) HostHasError(host str.RepoRootDir) (errorPresent bool) {
+	metric.hostsFileErrMutex.RLock()
 	if len(metric.hostsFileErr[host]) > 0 {
 		errorPresent = true
 	}
+	metric.hostsFileErrMutex.RUnlock()
 	return
 }
 
@@ -20,6 +25,46 @@ func (metric *Metrics) AddHostBytes(host str.RepoRootDir, deployedBytes int) {
 	}
 }
 
+// Marks the start of an upload to host, FinishHostTransfer must be called once it is done
+func (metric *Metrics) StartHostTransfer(host str.RepoRootDir) {
+	metric.hostTransferMutex.Lock()
+	defer metric.hostTransferMutex.Unlock()
+	window := metric.hostTransfer[host]
+	if window == nil {
+		window = &transferWindow{}
+		metric.hostTransfer[host] = window
+	}
+	if window.active == 0 {
+		window.since = time.Now()
+	}
+	window.active++
+}
+
+func (metric *Metrics) FinishHostTransfer(host str.RepoRootDir) {
+	metric.hostTransferMutex.Lock()
+	defer metric.hostTransferMutex.Unlock()
+	window := metric.hostTransfer[host]
+	if window == nil || window.active == 0 {
+		return
+	}
+	window.active--
+	if window.active == 0 {
+		window.busy += time.Since(window.since)
+	}
+}
+
+// Transferred bytes per second while uploads to host were running (zero without uploads)
+func (metric *Metrics) hostTransferRate(host str.RepoRootDir) (bytesPerSec int) {
+	metric.hostTransferMutex.Lock()
+	defer metric.hostTransferMutex.Unlock()
+	window := metric.hostTransfer[host]
+	if window == nil || window.busy <= 0 {
+		return
+	}
+	bytesPerSec = int(float64(metric.hostBytes[host]) / window.busy.Seconds())
+	return
+}
+
 func (metric *Metrics) AddHostFailure(host str.RepoRootDir, err error) {
 	if err == nil {
 		return
@@ -27,4 +72,87 @@ func (metric *Metrics) AddHostFailure(host str.RepoRootDir, err error) {
 	metric.hostErrMutex.Lock()
 	metric.hostErr[host] = err
 	metric.hostErrMutex.Unlock()
+	metric.eventStream.Emit(events.HostFailed, host, "", err.Error())
+}
+
+// Records the branch and commit a host is deployed from
+func (metric *Metrics) SetHostSource(host str.RepoRootDir, branch string, commitID string) {
+	metric.hostSourceMutex.Lock()
+	metric.hostSource[host] = deploymentSource{branch: branch, commitID: commitID}
+	metric.hostSourceMutex.Unlock()
+}
+
+// Records the address a host was reached on
+func (metric *Metrics) SetHostEndpoint(host str.RepoRootDir, endpoint string) {
+	metric.hostEndpointMutex.Lock()
+	metric.hostEndpoint[host] = endpoint
+	metric.hostEndpointMutex.Unlock()
+}
+
+// Records a host that was never started because the deployment was stopped
+func (metric *Metrics) AddHostNotAttempted(host str.RepoRootDir, files *deployment.HostFiles) {
+	metric.addHostNotStarted(host, files, "NotAttempted")
+}
+
+// Records a host that was never started because the deployment was interrupted
+func (metric *Metrics) AddHostInterrupted(host str.RepoRootDir, files *deployment.HostFiles) {
+	metric.addHostNotStarted(host, files, StatusInterrupted)
+}
+
+func (metric *Metrics) addHostNotStarted(host str.RepoRootDir, files *deployment.HostFiles, status string) {
+	if files != nil {
+		metric.AddAllDeployFiles(host, files)
+	}
+	metric.hostNotAttemptedMutex.Lock()
+	metric.hostNotAttempted[host] = status
+	metric.hostNotAttemptedMutex.Unlock()
+	metric.eventStream.Emit(events.HostNotAttempted, host, "", "")
+}
+
+// Records a host never started because an earlier rollout batch failed
+func (metric *Metrics) AddHostHalted(host str.RepoRootDir, files *deployment.HostFiles, reason string) {
+	if files != nil {
+		metric.AddAllDeployFiles(host, files)
+	}
+	metric.hostHaltedMutex.Lock()
+	metric.hostHalted[host] = reason
+	metric.hostHaltedMutex.Unlock()
+	metric.eventStream.Emit(events.HostHalted, host, "", reason)
+}
+
+// True when the host failed, has failed files, or was not started
+func (metric *Metrics) HostFailed(host str.RepoRootDir) (failed bool) {
+	notAttempted, hostFailed, failedFiles := metric.hostOutcome(host)
+	failed = notAttempted || hostFailed || failedFiles > 0
+	return
+}
+
+// Records a host held back because its required confirmation was not given
+func (metric *Metrics) AddHostConfirmationRequired(host str.RepoRootDir, files *deployment.HostFiles) {
+	if files != nil {
+		metric.AddAllDeployFiles(host, files)
+	}
+	metric.hostUnconfirmedMutex.Lock()
+	metric.hostUnconfirmed[host] = struct{}{}
+	metric.hostUnconfirmedMutex.Unlock()
+	metric.eventStream.Emit(events.HostUnconfirmed, host, "", "")
+}
+
+// Records the configured deployment deadline
+func (metric *Metrics) SetDeadline(deadline time.Duration) {
+	metric.deadline = deadline
+}
+
+// Records how long a host deployed for when a deadline applies, reached marks hosts stopped or cut off by a deadline
+func (metric *Metrics) AddHostDeadline(host str.RepoRootDir, configured time.Duration, elapsed time.Duration, reached bool) {
+	metric.hostDeadlineMutex.Lock()
+	metric.hostDeadline[host] = hostDeadline{configured: configured, elapsed: elapsed, reached: reached}
+	metric.hostDeadlineMutex.Unlock()
+}
+
+// Records the result of a deployment phase of a host, phases are added in deployment order
+func (metric *Metrics) AddHostPhase(host str.RepoRootDir, phase PhaseSummary) {
+	metric.hostPhasesMutex.Lock()
+	metric.hostPhases[host] = append(metric.hostPhases[host], phase)
+	metric.hostPhasesMutex.Unlock()
 }
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"scmp/internal/logctx"
+	"syscall"
+	"time"
+)
+
+// Exclusive lock on the failtracker file, held through a separate lock file so the summary itself can be replaced atomically
+type FailTrackerLock struct {
+	file *os.File
+}
+
+// Locks the failtracker file against concurrent deployments
+// When wait is false, an already held lock returns an error immediately, otherwise waits until released or ctx is cancelled
+func LockFailTracker(ctx context.Context, filePath string, wait bool) (lock *FailTrackerLock, err error) {
+	lockPath := filePath + failTrackerLockSuffix
+
+	lockFile, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		err = fmt.Errorf("failed opening failtracker lock file: %w", err)
+		return
+	}
+
+	var waitLogged bool
+	for {
+		err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			_ = lockFile.Close()
+			err = fmt.Errorf("failed locking failtracker file: %w", err)
+			return
+		}
+		if !wait {
+			_ = lockFile.Close()
+			err = fmt.Errorf("another deployment is currently using the failtracker file '%s' (lock file '%s'), wait for it to finish", filePath, lockPath)
+			return
+		}
+
+		if !waitLogged {
+			logctx.LogStdInfo(ctx, "Waiting for another deployment to release the failtracker file '%s'\n", filePath)
+			waitLogged = true
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = lockFile.Close()
+			err = fmt.Errorf("stopped waiting for failtracker lock: %w", context.Cause(ctx))
+			return
+		case <-time.After(failTrackerLockPollInterval):
+		}
+	}
+
+	lock = &FailTrackerLock{file: lockFile}
+	return
+}
+
+// Releases the lock (lock file is left in place for the next deployment)
+func (lock *FailTrackerLock) Unlock() (err error) {
+	if lock == nil || lock.file == nil {
+		return
+	}
+	err = syscall.Flock(int(lock.file.Fd()), syscall.LOCK_UN)
+	lerr := lock.file.Close()
+	if err == nil {
+		err = lerr
+	}
+	lock.file = nil
+	return
+}
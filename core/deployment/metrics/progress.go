@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"fmt"
+	"scmp/internal/parsing"
+	"scmp/internal/str"
+	"slices"
+	"time"
+)
+
+// Live per-host progress for status lines, only collected after EnableProgress
+
+func (metric *Metrics) EnableProgress() {
+	metric.progressMutex.Lock()
+	metric.progress = make(map[str.RepoRootDir]*hostProgress)
+	metric.progressMutex.Unlock()
+}
+
+// Registers host as waiting to start
+func (metric *Metrics) StartHostProgress(host str.RepoRootDir, totalFiles int) {
+	metric.progressMutex.Lock()
+	defer metric.progressMutex.Unlock()
+	if metric.progress == nil {
+		return
+	}
+	metric.progress[host] = &hostProgress{totalFiles: totalFiles, activity: progressQueued}
+}
+
+// Records what the host is currently doing (clock starts on the first activity after queued)
+func (metric *Metrics) SetHostActivity(host str.RepoRootDir, activity string) {
+	metric.progressMutex.Lock()
+	defer metric.progressMutex.Unlock()
+	progress := metric.progress[host]
+	if progress == nil {
+		return
+	}
+	if progress.start.IsZero() {
+		progress.start = time.Now()
+	}
+	progress.activity = activity
+}
+
+func (metric *Metrics) AddHostFileDone(host str.RepoRootDir) {
+	metric.progressMutex.Lock()
+	defer metric.progressMutex.Unlock()
+	progress := metric.progress[host]
+	if progress == nil {
+		return
+	}
+	progress.doneFiles++
+}
+
+func (metric *Metrics) FinishHostProgress(host str.RepoRootDir) {
+	metric.progressMutex.Lock()
+	defer metric.progressMutex.Unlock()
+	progress := metric.progress[host]
+	if progress == nil {
+		return
+	}
+	progress.end = time.Now()
+}
+
+// One line per host sorted by name, finished hosts show their final status instead of activity
+func (metric *Metrics) ProgressLines() (lines []string) {
+	hosts, progressCopies := metric.progressSnapshot()
+	var nameWidth int
+	for _, host := range hosts {
+		nameWidth = max(nameWidth, len(host))
+	}
+
+	now := time.Now()
+	for _, host := range hosts {
+		lines = append(lines, metric.hostProgressLine(host, progressCopies[host], nameWidth, now))
+	}
+	return
+}
+
+// Deployment wide counters of all hosts, like "hosts: 12/80 done, 2 failed | files: 340/1200 | 18.4 MiB transferred"
+func (metric *Metrics) ProgressTotalsLine() (line string) {
+	hosts, progressCopies := metric.progressSnapshot()
+
+	var doneHosts, failedHosts, totalFiles, doneFiles, transferredBytes int
+	for _, host := range hosts {
+		progress := progressCopies[host]
+		totalFiles += progress.totalFiles
+		doneFiles += progress.doneFiles
+		if progress.end.IsZero() {
+			continue
+		}
+		doneHosts++
+		_, hostFailed, failedFiles := metric.hostOutcome(host)
+		if hostFailed || failedFiles > 0 {
+			failedHosts++
+		}
+	}
+
+	metric.hostBytesMutex.Lock()
+	for _, host := range hosts {
+		transferredBytes += metric.hostBytes[host]
+	}
+	metric.hostBytesMutex.Unlock()
+
+	line = fmt.Sprintf("hosts: %d/%d done, %d failed | files: %d/%d | %s transferred",
+		doneHosts, len(hosts), failedHosts, doneFiles, totalFiles, parsing.FormatBytes(transferredBytes))
+	return
+}
+
+// Lines of hosts that finished since the previous call, each host is returned once
+func (metric *Metrics) TakeFinishedHostLines() (lines []string) {
+	metric.progressMutex.Lock()
+	var hosts []str.RepoRootDir
+	progressCopies := make(map[str.RepoRootDir]hostProgress)
+	for host, progress := range metric.progress {
+		if progress.end.IsZero() || progress.reported {
+			continue
+		}
+		progress.reported = true
+		hosts = append(hosts, host)
+		progressCopies[host] = *progress
+	}
+	metric.progressMutex.Unlock()
+	slices.Sort(hosts)
+
+	now := time.Now()
+	for _, host := range hosts {
+		lines = append(lines, metric.hostProgressLine(host, progressCopies[host], 0, now))
+	}
+	return
+}
+
+// Copies host progress so lines are built without holding the progress lock
+func (metric *Metrics) progressSnapshot() (hosts []str.RepoRootDir, progressCopies map[str.RepoRootDir]hostProgress) {
+	metric.progressMutex.Lock()
+	defer metric.progressMutex.Unlock()
+
+	hosts = make([]str.RepoRootDir, 0, len(metric.progress))
+	progressCopies = make(map[str.RepoRootDir]hostProgress, len(metric.progress))
+	for host, progress := range metric.progress {
+		hosts = append(hosts, host)
+		progressCopies[host] = *progress
+	}
+	slices.Sort(hosts)
+	return
+}
+
+func (metric *Metrics) hostProgressLine(host str.RepoRootDir, progress hostProgress, nameWidth int, now time.Time) (line string) {
+	line = fmt.Sprintf("%-*s  [%d/%d files]", nameWidth, host, progress.doneFiles, progress.totalFiles)
+
+	end := now
+	if progress.end.IsZero() {
+		line += "  " + progress.activity
+	} else {
+		end = progress.end
+		line += "  " + metric.hostFinalStatus(host)
+	}
+
+	// Hosts never started have no rate or elapsed time
+	if progress.start.IsZero() {
+		return
+	}
+
+	elapsed := end.Sub(progress.start)
+	metric.hostBytesMutex.Lock()
+	hostBytes := metric.hostBytes[host]
+	metric.hostBytesMutex.Unlock()
+	if hostBytes > 0 && elapsed >= time.Second {
+		line += "  " + parsing.FormatBytes(int(float64(hostBytes)/elapsed.Seconds())) + "/s"
+	}
+
+	line += "  elapsed " + formatClock(elapsed)
+	return
+}
+
+// Status of a finished host from its recorded errors
+func (metric *Metrics) hostFinalStatus(host str.RepoRootDir) (status string) {
+	notAttempted, hostFailed, failedFiles := metric.hostOutcome(host)
+	if notAttempted {
+		status = "NotAttempted"
+	} else if hostFailed {
+		status = "Failed"
+	} else if failedFiles > 0 {
+		status = fmt.Sprintf("Partial (%d failed)", failedFiles)
+	} else {
+		status = "Deployed"
+	}
+	return
+}
+
+func (metric *Metrics) hostOutcome(host str.RepoRootDir) (notAttempted bool, hostFailed bool, failedFiles int) {
+	metric.hostNotAttemptedMutex.Lock()
+	_, notAttempted = metric.hostNotAttempted[host]
+	metric.hostNotAttemptedMutex.Unlock()
+
+	metric.hostErrMutex.Lock()
+	_, hostFailed = metric.hostErr[host]
+	metric.hostErrMutex.Unlock()
+
+	metric.hostsFileErrMutex.RLock()
+	failedFiles = len(metric.hostsFileErr[host])
+	metric.hostsFileErrMutex.RUnlock()
+	return
+}
+
+// Elapsed time as MM:SS (HH:MM:SS past an hour)
+func formatClock(elapsed time.Duration) (clock string) {
+	seconds := int(elapsed.Seconds())
+	if seconds >= 3600 {
+		clock = fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+	} else {
+		clock = fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+	}
+	return
+}
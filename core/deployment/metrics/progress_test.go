@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestProgressLines(t *testing.T) {
+	metric := New()
+
+	// Progress is ignored until enabled
+	metric.StartHostProgress("ignored", 1)
+	if len(metric.ProgressLines()) != 0 {
+		t.Fatalf("expected no lines before progress is enabled")
+	}
+
+	metric.EnableProgress()
+	metric.StartHostProgress("web02", 3)
+	metric.StartHostProgress("db1", 2)
+	metric.StartHostProgress("web01", 4)
+
+	metric.SetHostActivity("web01", ProgressTransferring+"/etc/nginx/nginx.conf")
+	metric.AddHostFileDone("web01")
+
+	metric.SetHostActivity("db1", ProgressDeploying)
+	metric.AddHostFileDone("db1")
+	metric.AddHostFileDone("db1")
+	metric.AddFileFailure("db1", "db1/etc/x", errors.New("failed"))
+	metric.FinishHostProgress("db1")
+
+	expectedLines := []string{
+		"db1    [2/2 files]  Partial (1 failed)  elapsed 00:00",
+		"web01  [1/4 files]  transferring /etc/nginx/nginx.conf  elapsed 00:00",
+		"web02  [0/3 files]  queued",
+	}
+	lines := metric.ProgressLines()
+	if len(lines) != len(expectedLines) {
+		t.Fatalf("expected %d lines, got %d: %q", len(expectedLines), len(lines), lines)
+	}
+	for index, expectedLine := range expectedLines {
+		if lines[index] != expectedLine {
+			t.Errorf("line %d: expected %q, got %q", index, expectedLine, lines[index])
+		}
+	}
+
+	metric.AddHostFailure("web02", errors.New("connect failed"))
+	metric.FinishHostProgress("web02")
+	if !strings.Contains(metric.ProgressLines()[2], "Failed") {
+		t.Errorf("expected failed host to show final status, got %q", metric.ProgressLines()[2])
+	}
+}
+
+func TestProgressTotalsAndFinishedHosts(t *testing.T) {
+	metric := New()
+	metric.EnableProgress()
+	metric.StartHostProgress("web01", 3)
+	metric.StartHostProgress("web02", 2)
+	metric.StartHostProgress("db1", 1)
+
+	metric.SetHostActivity("web01", ProgressDeploying)
+	metric.AddHostFileDone("web01")
+	metric.AddHostBytes("web01", 2048)
+
+	metric.SetHostActivity("db1", ProgressDeploying)
+	metric.AddHostFileDone("db1")
+	metric.AddHostBytes("db1", 1024)
+	metric.AddFileFailure("db1", "db1/etc/x", errors.New("failed"))
+	metric.FinishHostProgress("db1")
+
+	expectedTotals := "hosts: 1/3 done, 1 failed | files: 2/6 | 3.00 KiB transferred"
+	if totals := metric.ProgressTotalsLine(); totals != expectedTotals {
+		t.Errorf("expected totals %q, got %q", expectedTotals, totals)
+	}
+
+	finished := metric.TakeFinishedHostLines()
+	if len(finished) != 1 || finished[0] != "db1  [1/1 files]  Partial (1 failed)  elapsed 00:00" {
+		t.Errorf("unexpected finished host lines: %q", finished)
+	}
+	if again := metric.TakeFinishedHostLines(); len(again) != 0 {
+		t.Errorf("expected finished hosts to be returned once, got %q", again)
+	}
+
+	metric.FinishHostProgress("web02")
+	metric.FinishHostProgress("web01")
+	finished = metric.TakeFinishedHostLines()
+	if len(finished) != 2 || !strings.HasPrefix(finished[0], "web01") || !strings.HasPrefix(finished[1], "web02  [0/2 files]  Deployed") {
+		t.Errorf("unexpected finished host lines: %q", finished)
+	}
+}
@@ -3,17 +3,29 @@ package metrics
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"scmp/core/deployment"
 	"scmp/internal/logctx"
 	"scmp/internal/parsing"
+	"scmp/internal/str"
+	"slices"
 	"strings"
+	"time"
 )
 
-func (metric *Metrics) CreateReport(commitID string) (deploymentSummary Summary) {
+func (metric *Metrics) CreateReport(branch string, commitID string) (deploymentSummary Summary) {
 	deploymentSummary.ElapsedTime = parsing.FormatElapsedTime(metric.startTime.UnixMilli(), metric.endTime.UnixMilli())
 	deploymentSummary.StartTime = parsing.ConvertMStoTimestamp(metric.startTime.UnixMilli())
 	deploymentSummary.EndTime = parsing.ConvertMStoTimestamp(metric.endTime.UnixMilli())
 	deploymentSummary.CommitID = commitID
+	deploymentSummary.Branch = branch
+	if metric.deadline > 0 {
+		deploymentSummary.Deadline = formatDuration(metric.deadline)
+	}
 
 	var allHostBytes int
 	for _, bytes := range metric.hostBytes {
@@ -32,17 +44,92 @@ func (metric *Metrics) CreateReport(commitID string) (deploymentSummary Summary)
 			hostSummary.ErrorMsg = strings.ReplaceAll(hostSummary.ErrorMsg, "\n", ": ")
 			hostSummary.ErrorMsg = strings.ReplaceAll(hostSummary.ErrorMsg, "\r", ": ")
 		}
+		hostFailed := hostSummary.ErrorMsg != ""
+		hostPreflightFailed := hasErr && errors.Is(err, deployment.ErrPreflightFailed)
 		hostSummary.TotalItems = len(files)
 
+		deadline, hasDeadline := metric.hostDeadline[host]
+		if hasDeadline {
+			if deadline.configured > 0 {
+				hostSummary.Deadline = formatDuration(deadline.configured)
+			}
+			hostSummary.ElapsedTime = formatDuration(deadline.elapsed)
+		}
+
+		hostSummary.Endpoint = metric.hostEndpoint[host]
+		hostSummary.Phases = metric.hostPhases[host]
+
+		source, hostHasSource := metric.hostSource[host]
+		if hostHasSource {
+			hostSummary.Branch = source.branch
+			hostSummary.CommitID = source.commitID
+		}
+
 		if deploymentSummary.Counters.Hosts > 1 {
 			hostSummary.TransferredData = parsing.FormatBytes(metric.hostBytes[host])
 		}
+		transferRate := metric.hostTransferRate(host)
+		if transferRate > 0 {
+			hostSummary.TransferRate = parsing.FormatBytes(transferRate) + "/s"
+		}
 
 		deploymentSummary.Counters.Items += hostSummary.TotalItems
 
 		hostFileErrs := metric.hostsFileErr[host]
 
-		var hostItemsDeployed int
+		// Hosts stopped before starting have nothing deployed or failed
+		notAttemptedStatus, hostNotAttempted := metric.hostNotAttempted[host]
+		if hostNotAttempted {
+			for _, file := range files {
+				hostSummary.Items = append(hostSummary.Items, ItemSummary{
+					Name:   file,
+					Action: metric.fileAction[file],
+					Status: notAttemptedStatus,
+				})
+			}
+			hostSummary.Status = notAttemptedStatus
+			deploymentSummary.Counters.NotAttemptedItems += len(files)
+			deploymentSummary.Counters.NotAttemptedHosts++
+			deploymentSummary.Hosts = append(deploymentSummary.Hosts, hostSummary)
+			continue
+		}
+
+		// Halted hosts were never connected to, the reason names the failed batch
+		haltReason, hostHalted := metric.hostHalted[host]
+		if hostHalted {
+			for _, file := range files {
+				hostSummary.Items = append(hostSummary.Items, ItemSummary{
+					Name:   file,
+					Action: metric.fileAction[file],
+					Status: StatusHalted,
+				})
+			}
+			hostSummary.Status = StatusHalted
+			hostSummary.ErrorMsg = haltReason
+			deploymentSummary.Counters.HaltedItems += len(files)
+			deploymentSummary.Counters.HaltedHosts++
+			deploymentSummary.Hosts = append(deploymentSummary.Hosts, hostSummary)
+			continue
+		}
+
+		// Unconfirmed hosts were never connected to
+		_, hostUnconfirmed := metric.hostUnconfirmed[host]
+		if hostUnconfirmed {
+			for _, file := range files {
+				hostSummary.Items = append(hostSummary.Items, ItemSummary{
+					Name:   file,
+					Action: metric.fileAction[file],
+					Status: StatusConfirmationRequired,
+				})
+			}
+			hostSummary.Status = StatusConfirmationRequired
+			deploymentSummary.Counters.UnconfirmedItems += len(files)
+			deploymentSummary.Counters.UnconfirmedHosts++
+			deploymentSummary.Hosts = append(deploymentSummary.Hosts, hostSummary)
+			continue
+		}
+
+		var hostItemsDeployed, hostItemsInterrupted int
 		for _, file := range files {
 			var fileSummary ItemSummary
 			fileSummary.Name = file
@@ -51,17 +138,47 @@ func (metric *Metrics) CreateReport(commitID string) (deploymentSummary Summary)
 				fileSummary.ErrorMsg = err.Error()
 				fileSummary.ErrorMsg = strings.ReplaceAll(fileSummary.ErrorMsg, "\n", ": ")
 				fileSummary.ErrorMsg = strings.ReplaceAll(fileSummary.ErrorMsg, "\r", ": ")
+				fileSummary.Failure = newFailureContext(err)
 			}
 			fileSummary.Action = metric.fileAction[file]
+			fileSummary.Backup = metric.hostsFileBackup[host][file]
+			_, fileSummary.MetaOnly = metric.hostsMetaOnly[host][file]
+			fileSummary.setTiming(metric.fileTiming[host][file])
 
-			if fileSummary.ErrorMsg != "" {
-				// Individual file failure
+			if errors.Is(err, deployment.ErrInterrupted) {
+				// Files never started after an interrupt were not touched
+				fileSummary.Status = StatusInterrupted
+				hostItemsInterrupted++
+				deploymentSummary.Counters.NotAttemptedItems++
+			} else if fileSummary.ErrorMsg != "" {
+				// Individual file failure (held files are reported as such)
 				fileSummary.Status = "Failed"
+				if errors.Is(err, deployment.ErrSuspiciousShrink) {
+					fileSummary.Status = StatusSuspiciousShrink
+				} else if errors.Is(err, deployment.ErrReloadRolledBack) {
+					fileSummary.Status = StatusRolledBack
+				} else if errors.Is(err, deployment.ErrMalformedHeader) {
+					fileSummary.Status = StatusParseError
+				}
+				deploymentSummary.Counters.FailedItems++
+			} else if hostPreflightFailed {
+				// Nothing was touched on hosts failing pre-flight checks
+				fileSummary.Status = StatusPreflightFailed
 				deploymentSummary.Counters.FailedItems++
-			} else if hostSummary.ErrorMsg != "" {
+			} else if hostFailed {
 				// Entire host failures indicate every file failed
 				fileSummary.Status = "Failed"
 				deploymentSummary.Counters.FailedItems++
+			} else if skipReason, skipped := metric.hostsFileSkipped[host][file]; skipped {
+				// Skipped files were never meant for this host, host is still complete
+				fileSummary.Status = skippedPrefix + " (" + skipReason + ")"
+				hostItemsDeployed++
+				deploymentSummary.Counters.SkippedItems++
+			} else if outcome, wetRun := metric.hostsFileWetRun[host][file]; wetRun {
+				// Wet-runs report what would have happened to the file
+				fileSummary.Status = outcome
+				hostItemsDeployed++
+				deploymentSummary.Counters.CompletedItems++
 			} else {
 				// No file errors indicate it was deployed
 				fileSummary.Status = "Deployed"
@@ -71,8 +188,9 @@ func (metric *Metrics) CreateReport(commitID string) (deploymentSummary Summary)
 
 			hostSummary.Items = append(hostSummary.Items, fileSummary)
 		}
+		hostSummary.setTimingTotals(metric.hostElapsed[host])
 
-		if hostItemsDeployed == hostSummary.TotalItems {
+		if hostItemsDeployed == hostSummary.TotalItems && !hostFailed {
 			// If all items were successful, whole host deploy was successful
 			hostSummary.Status = "Deployed"
 			deploymentSummary.Counters.CompletedHosts++
@@ -80,6 +198,13 @@ func (metric *Metrics) CreateReport(commitID string) (deploymentSummary Summary)
 			// If at least one file deployed, host is partially successful
 			hostSummary.Status = "Partial"
 			deploymentSummary.Counters.FailedHosts++
+		} else if hostPreflightFailed {
+			hostSummary.Status = StatusPreflightFailed
+			deploymentSummary.Counters.FailedHosts++
+		} else if hostItemsInterrupted == hostSummary.TotalItems && !hostFailed {
+			// Interrupted before any file of the host started
+			hostSummary.Status = StatusInterrupted
+			deploymentSummary.Counters.NotAttemptedHosts++
 		} else if hostItemsDeployed == 0 {
 			// No successful files, whole host marked failed
 			hostSummary.Status = "Failed"
@@ -90,46 +215,125 @@ func (metric *Metrics) CreateReport(commitID string) (deploymentSummary Summary)
 			deploymentSummary.Counters.FailedHosts++
 		}
 
+		// Incomplete hosts stopped by a deadline are reported as such (still counted as failed)
+		if deadline.reached && hostSummary.Status != "Deployed" {
+			hostSummary.Status = "DeadlineExceeded"
+			deadlineMsg := "deadline exceeded ("
+			if hostSummary.Deadline != "" {
+				deadlineMsg += "host deadline " + hostSummary.Deadline + ", "
+			}
+			if deploymentSummary.Deadline != "" {
+				deadlineMsg += "deployment deadline " + deploymentSummary.Deadline + ", "
+			}
+			deadlineMsg += "host ran for " + hostSummary.ElapsedTime + ")"
+			if hostSummary.ErrorMsg != "" {
+				deadlineMsg += ": " + hostSummary.ErrorMsg
+			}
+			hostSummary.ErrorMsg = deadlineMsg
+		}
+
 		deploymentSummary.Hosts = append(deploymentSummary.Hosts, hostSummary)
 	}
 
-	if deploymentSummary.Counters.CompletedHosts == deploymentSummary.Counters.Hosts {
+	deploymentSummary.setStatus()
+	return
+}
+
+// Sets overall status from the host counters
+func (deploymentSummary *Summary) setStatus() {
+	incompleteHosts := deploymentSummary.Counters.FailedHosts + deploymentSummary.Counters.NotAttemptedHosts + deploymentSummary.Counters.HaltedHosts
+	attemptedHosts := deploymentSummary.Counters.Hosts - deploymentSummary.Counters.UnconfirmedHosts // Unconfirmed hosts do not fail the deployment
+	if deploymentSummary.Counters.Hosts > 0 && attemptedHosts == 0 {
+		deploymentSummary.Status = StatusConfirmationRequired
+	} else if deploymentSummary.Counters.CompletedHosts == attemptedHosts {
 		deploymentSummary.Status = "Deployed"
-	} else if deploymentSummary.Counters.CompletedHosts > 0 && deploymentSummary.Counters.FailedHosts > 0 {
+	} else if deploymentSummary.Counters.CompletedHosts > 0 && incompleteHosts > 0 {
 		deploymentSummary.Status = "Partial"
-	} else if deploymentSummary.Counters.CompletedHosts == 0 && deploymentSummary.Counters.FailedHosts > 0 {
+	} else if deploymentSummary.Counters.CompletedHosts == 0 && incompleteHosts > 0 {
 		deploymentSummary.Status = "Failed"
 	} else if deploymentSummary.Counters.Hosts == 0 {
-		deploymentSummary.Status = "UpToDate"
+		deploymentSummary.Status = StatusUpToDate
 	} else {
 		deploymentSummary.Status = "Unknown"
 	}
+}
 
+// True when any host or item did not deploy
+func (deploymentSummary Summary) HasFailures() (failed bool) {
+	failed = deploymentSummary.Counters.FailedHosts > 0 || deploymentSummary.Counters.FailedItems > 0 || deploymentSummary.Counters.NotAttemptedHosts > 0 ||
+		deploymentSummary.Counters.UnconfirmedHosts > 0 || deploymentSummary.Counters.HaltedHosts > 0
+	return
+}
+
+// Hosts with any failed, not attempted, or held item
+func (deploymentSummary Summary) FailedHosts() (hosts []str.RepoRootDir) {
+	for _, hostSummary := range deploymentSummary.Hosts {
+		failed := hostFailed(hostSummary.Status)
+		for _, itemSummary := range hostSummary.Items {
+			failed = failed || itemFailed(itemSummary.Status)
+		}
+		if failed {
+			hosts = append(hosts, hostSummary.Name)
+		}
+	}
 	return
 }
 
 // Prints custom stdout to user to show the root-cause errors
 func (deploymentSummary Summary) PrintFailures(ctx context.Context) (err error) {
-	if deploymentSummary.Counters.FailedHosts == 0 && deploymentSummary.Counters.FailedItems == 0 {
+	if !deploymentSummary.HasFailures() {
 		return
 	}
 
 	for _, hostDeployReport := range deploymentSummary.Hosts {
-		if hostDeployReport.ErrorMsg != "" || hostDeployReport.Status == "Partial" || hostDeployReport.Status == "Failed" {
-			logctx.LogStdInfo(ctx, "Host: %s\n", hostDeployReport.Name)
+		if hostDeployReport.Status == "NotAttempted" {
+			logctx.LogStdInfo(ctx, "Host: %s\n Not attempted, deployment was stopped before this host started\n", hostDeployReport.Name)
+			continue
+		}
+		if hostDeployReport.Status == StatusInterrupted {
+			logctx.LogStdInfo(ctx, "Host: %s\n Not attempted, deployment was interrupted before any file of this host started\n", hostDeployReport.Name)
+			continue
+		}
+		if hostDeployReport.Status == StatusHalted {
+			logctx.LogStdInfo(ctx, "Host: %s\n Not attempted, %s\n", hostDeployReport.Name, hostDeployReport.ErrorMsg)
+			continue
+		}
+		if hostDeployReport.Status == StatusConfirmationRequired {
+			logctx.LogStdInfo(ctx, "Host: %s\n Not deployed, host requires confirmation (use --confirm-host %s)\n", hostDeployReport.Name, hostDeployReport.Name)
+			continue
+		}
+
+		if hostDeployReport.ErrorMsg != "" || hostDeployReport.Status == "Partial" || hostDeployReport.Status == "Failed" || hostDeployReport.Status == "DeadlineExceeded" {
+			if hostDeployReport.CommitID != "" {
+				logctx.LogStdInfo(ctx, "Host: %s (branch '%s' commit %s)\n", hostDeployReport.Name, hostDeployReport.Branch, hostDeployReport.CommitID)
+			} else {
+				logctx.LogStdInfo(ctx, "Host: %s\n", hostDeployReport.Name)
+			}
 		}
 
 		if hostDeployReport.ErrorMsg != "" {
 			logctx.LogStdInfo(ctx, " Host Error: %s\n", hostDeployReport.ErrorMsg)
 		}
 
+		// Phases show how far a host got before its failures
+		for _, phaseReport := range hostDeployReport.Phases {
+			if phaseReport.Status == PhaseDeployed {
+				continue
+			}
+			logctx.LogStdInfo(ctx, " Phase '%s': %s (%d of %d item(s) failed)\n", phaseReport.Name, phaseReport.Status, phaseReport.FailedItems, phaseReport.Items)
+		}
+
 		for _, fileDeployReport := range hostDeployReport.Items {
 			fileErrorMessage := fileDeployReport.ErrorMsg
 			if fileErrorMessage == "" {
 				continue
 			}
 
-			logctx.LogStdInfo(ctx, " File: '%s'\n", fileDeployReport.Name)
+			if fileDeployReport.Failure != nil {
+				logctx.LogStdInfo(ctx, " File: '%s' (%s)\n", fileDeployReport.Name, fileDeployReport.Failure.Summary())
+			} else {
+				logctx.LogStdInfo(ctx, " File: '%s'\n", fileDeployReport.Name)
+			}
 
 			// Print all the errors in a cascading format to show root cause
 			errorLayers := strings.Split(fileErrorMessage, ": ")
@@ -146,13 +350,52 @@ func (deploymentSummary Summary) PrintFailures(ctx context.Context) (err error)
 	return
 }
 
-// Writes deployment summary to disk for deploy retry use
-func (deploymentSummary Summary) SaveReport(ctx context.Context, filePath string) (err error) {
-	if deploymentSummary.Counters.FailedHosts == 0 && deploymentSummary.Counters.FailedItems == 0 {
-		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "No failures to save (no failed hosts and no failed items)\n")
-		return
+// Prints the items a wet-run found would change and the count of each outcome
+func (deploymentSummary Summary) PrintWetRunOutcomes(ctx context.Context) {
+	outcomeCounts := make(map[string]int)
+	for _, hostDeployReport := range deploymentSummary.Hosts {
+		var hostChanges []ItemSummary
+		for _, itemReport := range hostDeployReport.Items {
+			outcomeCounts[itemReport.Status]++
+			switch itemReport.Status {
+			case WetRunCreate, WetRunModify, WetRunDelete:
+				hostChanges = append(hostChanges, itemReport)
+			}
+		}
+		if len(hostChanges) == 0 {
+			continue
+		}
+
+		logctx.LogStdInfo(ctx, "Host: %s\n", hostDeployReport.Name)
+		for _, itemReport := range hostChanges {
+			logctx.LogStdInfo(ctx, " %-11s %s\n", itemReport.Status, itemReport.Name)
+		}
 	}
 
+	logctx.LogStdInfo(ctx, "Wet-run: %d item(s) would be created, %d modified, %d deleted, %d unchanged\n",
+		outcomeCounts[WetRunCreate], outcomeCounts[WetRunModify], outcomeCounts[WetRunDelete], outcomeCounts[WetRunUnchanged])
+}
+
+// Prints the branch and commit each host deployed from
+func (deploymentSummary Summary) PrintHostSources(ctx context.Context) {
+	hosts := slices.Clone(deploymentSummary.Hosts)
+	slices.SortFunc(hosts, func(a, b HostSummary) int {
+		return strings.Compare(string(a.Name), string(b.Name))
+	})
+
+	for _, hostDeployReport := range hosts {
+		branch := hostDeployReport.Branch
+		if branch == "" {
+			branch = "(detached HEAD)"
+		}
+		logctx.LogStdInfo(ctx, " %s: %s %d item(s) from branch '%s' commit %s\n",
+			hostDeployReport.Name, hostDeployReport.Status, hostDeployReport.TotalItems, branch, hostDeployReport.CommitID)
+	}
+}
+
+// Merges deployment summary into the failtracker file for deploy retry use (caller must hold the failtracker lock)
+// File is removed once no failures remain
+func (deploymentSummary Summary) SaveReport(ctx context.Context, filePath string) (err error) {
 	defer func() {
 		// General warning on any err on return
 		if err != nil {
@@ -161,32 +404,270 @@ func (deploymentSummary Summary) SaveReport(ctx context.Context, filePath string
 		}
 	}()
 
-	// Create JSON text
+	mergedSummary := deploymentSummary
+	_, previousSummary, err := GetFailTrackerCommit(filePath)
+	if err == nil {
+		mergedSummary = deploymentSummary.MergeFailures(previousSummary)
+	} else if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	} else {
+		logctx.LogStdWarn(ctx, "Previous failtracker file could not be read and will be replaced: %v\n", err)
+		err = nil
+	}
+
+	if !mergedSummary.HasFailures() {
+		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "No failures to save (no failed hosts and no failed items)\n")
+		err = os.Remove(filePath)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				err = nil
+			} else {
+				err = fmt.Errorf("failed removing failtracker file: %w", err)
+			}
+		}
+		return
+	}
+
+	err = mergedSummary.WriteJSON(ctx, filePath)
+	return
+}
+
+// Combines previous failures with this deployment so failures not redeployed are kept
+// Items redeployed from the same commit take their new result, hosts redeployed from another commit are replaced entirely
+// Hosts absent from this deployment keep their previous failures (with the commit they failed on)
+func (deploymentSummary Summary) MergeFailures(previousSummary Summary) (mergedSummary Summary) {
+	mergedSummary = deploymentSummary
+	mergedSummary.Hosts = slices.Clone(deploymentSummary.Hosts)
+
+	hostIndex := make(map[str.RepoRootDir]int)
+	for index, hostReport := range mergedSummary.Hosts {
+		hostIndex[hostReport.Name] = index
+	}
+
+	for _, previousHost := range previousSummary.Hosts {
+		if !hostFailed(previousHost.Status) {
+			continue
+		}
+
+		previousCommitID, previousBranch := previousHost.CommitID, previousHost.Branch
+		if previousCommitID == "" {
+			previousCommitID, previousBranch = previousSummary.CommitID, previousSummary.Branch
+		}
+
+		index, redeployed := hostIndex[previousHost.Name]
+		if !redeployed {
+			if previousCommitID != mergedSummary.CommitID {
+				previousHost.CommitID, previousHost.Branch = previousCommitID, previousBranch
+			}
+			mergedSummary.Hosts = append(mergedSummary.Hosts, previousHost)
+			continue
+		}
+
+		currentHost := mergedSummary.Hosts[index]
+		currentCommitID := currentHost.CommitID
+		if currentCommitID == "" {
+			currentCommitID = mergedSummary.CommitID
+		}
+		if currentCommitID != previousCommitID {
+			continue
+		}
+
+		// Keep previous item failures that this deployment did not include
+		currentItems := make(map[str.LocalRepoPath]struct{})
+		for _, itemReport := range currentHost.Items {
+			currentItems[itemReport.Name] = struct{}{}
+		}
+		items := slices.Clone(currentHost.Items)
+		for _, itemReport := range previousHost.Items {
+			_, included := currentItems[itemReport.Name]
+			if included || !itemFailed(itemReport.Status) {
+				continue
+			}
+			items = append(items, itemReport)
+		}
+		if len(items) == len(currentHost.Items) {
+			continue
+		}
+
+		currentHost.Items = items
+		currentHost.TotalItems = len(items)
+		currentHost.Status = hostStatusFromItems(items)
+		mergedSummary.Hosts[index] = currentHost
+	}
+
+	mergedSummary.recount()
+	return
+}
+
+// Recalculates counters and overall status from host and item statuses
+func (deploymentSummary *Summary) recount() {
+	counters := &deploymentSummary.Counters
+	counters.Hosts = len(deploymentSummary.Hosts)
+	counters.Items, counters.CompletedHosts, counters.CompletedItems = 0, 0, 0
+	counters.FailedHosts, counters.FailedItems = 0, 0
+	counters.NotAttemptedHosts, counters.NotAttemptedItems, counters.SkippedItems = 0, 0, 0
+	counters.UnconfirmedHosts, counters.UnconfirmedItems = 0, 0
+	counters.HaltedHosts, counters.HaltedItems = 0, 0
+
+	for _, hostReport := range deploymentSummary.Hosts {
+		switch hostReport.Status {
+		case "Deployed":
+			counters.CompletedHosts++
+		case "NotAttempted", StatusInterrupted:
+			counters.NotAttemptedHosts++
+		case StatusConfirmationRequired:
+			counters.UnconfirmedHosts++
+		case StatusHalted:
+			counters.HaltedHosts++
+		default:
+			counters.FailedHosts++
+		}
+
+		counters.Items += len(hostReport.Items)
+		for _, itemReport := range hostReport.Items {
+			switch {
+			case itemCompleted(itemReport.Status):
+				counters.CompletedItems++
+			case itemReport.Status == "NotAttempted" || itemReport.Status == StatusInterrupted:
+				counters.NotAttemptedItems++
+			case itemReport.Status == StatusConfirmationRequired:
+				counters.UnconfirmedItems++
+			case itemReport.Status == StatusHalted:
+				counters.HaltedItems++
+			case itemSkipped(itemReport.Status):
+				counters.SkippedItems++
+			default:
+				counters.FailedItems++
+			}
+		}
+	}
+
+	deploymentSummary.setStatus()
+}
+
+// Host status from its item statuses (only used for hosts with at least one failed item)
+func hostStatusFromItems(items []ItemSummary) (status string) {
+	var deployed, notAttempted, interrupted, unconfirmed, halted, preflightFailed int
+	for _, itemReport := range items {
+		switch {
+		case itemCompleted(itemReport.Status) || itemSkipped(itemReport.Status):
+			deployed++
+		case itemReport.Status == "NotAttempted":
+			notAttempted++
+		case itemReport.Status == StatusInterrupted:
+			interrupted++
+		case itemReport.Status == StatusConfirmationRequired:
+			unconfirmed++
+		case itemReport.Status == StatusHalted:
+			halted++
+		case itemReport.Status == StatusPreflightFailed:
+			preflightFailed++
+		}
+	}
+
+	if deployed == len(items) {
+		status = "Deployed"
+	} else if deployed > 0 {
+		status = "Partial"
+	} else if notAttempted == len(items) {
+		status = "NotAttempted"
+	} else if interrupted == len(items) {
+		status = StatusInterrupted
+	} else if unconfirmed == len(items) {
+		status = StatusConfirmationRequired
+	} else if halted == len(items) {
+		status = StatusHalted
+	} else if preflightFailed == len(items) {
+		status = StatusPreflightFailed
+	} else {
+		status = "Failed"
+	}
+	return
+}
+
+func hostFailed(status string) (failed bool) {
+	failed = status == "Failed" || status == "Partial" || status == "NotAttempted" || status == "DeadlineExceeded" || status == StatusConfirmationRequired ||
+		status == StatusHalted || status == StatusPreflightFailed || status == StatusInterrupted
+	return
+}
+
+func itemFailed(status string) (failed bool) {
+	failed = status == "Failed" || status == "NotAttempted" || status == StatusSuspiciousShrink || status == StatusRolledBack || status == StatusConfirmationRequired ||
+		status == StatusHalted || status == StatusParseError || status == StatusPreflightFailed || status == StatusInterrupted
+	return
+}
+
+// Creates the JSON text of the deployment summary
+func (deploymentSummary Summary) JSON() (deploymentSummaryText string, err error) {
 	deploymentSummaryJSON, err := json.MarshalIndent(deploymentSummary, "", " ")
 	if err != nil {
 		return
 	}
-	deploymentSummaryText := string(deploymentSummaryJSON)
+	deploymentSummaryText = string(deploymentSummaryJSON) + "\n"
+	return
+}
+
+// Writes JSON deployment summary to the given file, values masked in logs are masked in the file too
+// Content goes to a temporary file in the same directory first, then replaces the old file in one rename
+func (deploymentSummary Summary) WriteJSON(ctx context.Context, filePath string) (err error) {
+	deploymentSummaryText, err := deploymentSummary.JSON()
+	if err != nil {
+		return
+	}
+	deploymentSummaryText = logctx.Mask(ctx, deploymentSummaryText)
 
-	// Add FailTracker string to fail file
-	failTrackerFile, err := os.Create(filePath)
+	summaryFile, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".tmp-*")
 	if err != nil {
 		return
 	}
+	tempPath := summaryFile.Name()
 	defer func() {
-		lerr := failTrackerFile.Close()
-		if err == nil && lerr != nil {
-			err = lerr
+		if err != nil {
+			_ = summaryFile.Close()
+			_ = os.Remove(tempPath)
 		}
 	}()
 
-	deploymentSummaryText = deploymentSummaryText + "\n"
+	_, err = summaryFile.WriteString(deploymentSummaryText)
+	if err != nil {
+		return
+	}
+	err = summaryFile.Chmod(summaryFileMode)
+	if err != nil {
+		return
+	}
+	err = summaryFile.Sync()
+	if err != nil {
+		return
+	}
+	err = summaryFile.Close()
+	if err != nil {
+		return
+	}
 
-	// Always overwrite old contents
-	_, err = failTrackerFile.WriteString(deploymentSummaryText)
+	err = os.Rename(tempPath, filePath)
 	if err != nil {
 		return
 	}
+	return
+}
+
+// Human readable duration in the same format as elapsed times
+func formatDuration(duration time.Duration) (formatted string) {
+	formatted = parsing.FormatElapsedTime(0, duration.Milliseconds())
+	return
+}
+
+// Deployed items and wet-run outcomes
+func itemCompleted(status string) (completed bool) {
+	switch status {
+	case "Deployed", WetRunCreate, WetRunModify, WetRunDelete, WetRunUnchanged:
+		completed = true
+	}
+	return
+}
 
+func itemSkipped(status string) (skipped bool) {
+	skipped = strings.HasPrefix(status, skippedPrefix)
 	return
 }
@@ -0,0 +1,603 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"scmp/core/deployment"
+	"scmp/internal/logctx"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testHost(name str.RepoRootDir, status string, items ...ItemSummary) (host HostSummary) {
+	host = HostSummary{Name: name, Status: status, TotalItems: len(items), Items: items}
+	return
+}
+
+func testItem(name str.LocalRepoPath, status string) (item ItemSummary) {
+	item = ItemSummary{Name: name, Action: "modify", Status: status}
+	if status == "Failed" {
+		item.ErrorMsg = "failed " + string(name)
+	}
+	return
+}
+
+func itemStatuses(summary Summary) (statuses map[str.RepoRootDir]map[str.LocalRepoPath]string) {
+	statuses = make(map[str.RepoRootDir]map[str.LocalRepoPath]string)
+	for _, host := range summary.Hosts {
+		statuses[host.Name] = make(map[str.LocalRepoPath]string)
+		for _, item := range host.Items {
+			statuses[host.Name][item.Name] = item.Status
+		}
+	}
+	return
+}
+
+func TestMergeFailures(t *testing.T) {
+	previous := Summary{CommitID: "aaa", Branch: "main", Hosts: []HostSummary{
+		testHost("hostA", "Failed", testItem("hostA/etc/x", "Failed"), testItem("hostA/etc/y", "Failed")),
+		testHost("hostB", "NotAttempted", testItem("hostB/etc/z", "NotAttempted")),
+		testHost("hostC", "Deployed", testItem("hostC/etc/w", "Deployed")),
+	}}
+
+	tests := []struct {
+		name             string
+		current          Summary
+		expectedStatuses map[str.RepoRootDir]map[str.LocalRepoPath]string
+		expectedCommits  map[str.RepoRootDir]string
+		expectedFailures bool
+	}{
+		{
+			name: "Partial fix keeps remaining failures",
+			current: Summary{CommitID: "aaa", Hosts: []HostSummary{
+				testHost("hostA", "Deployed", testItem("hostA/etc/x", "Deployed")),
+			}},
+			expectedStatuses: map[str.RepoRootDir]map[str.LocalRepoPath]string{
+				"hostA": {"hostA/etc/x": "Deployed", "hostA/etc/y": "Failed"},
+				"hostB": {"hostB/etc/z": "NotAttempted"},
+			},
+			expectedFailures: true,
+		},
+		{
+			name: "Still failing item takes new result",
+			current: Summary{CommitID: "aaa", Hosts: []HostSummary{
+				testHost("hostA", "Partial", testItem("hostA/etc/x", "Deployed"), testItem("hostA/etc/y", "Failed")),
+				testHost("hostB", "Deployed", testItem("hostB/etc/z", "Deployed")),
+			}},
+			expectedStatuses: map[str.RepoRootDir]map[str.LocalRepoPath]string{
+				"hostA": {"hostA/etc/x": "Deployed", "hostA/etc/y": "Failed"},
+				"hostB": {"hostB/etc/z": "Deployed"},
+			},
+			expectedFailures: true,
+		},
+		{
+			name: "All failures fixed",
+			current: Summary{CommitID: "aaa", Hosts: []HostSummary{
+				testHost("hostA", "Deployed", testItem("hostA/etc/x", "Deployed"), testItem("hostA/etc/y", "Deployed")),
+				testHost("hostB", "Deployed", testItem("hostB/etc/z", "Deployed")),
+			}},
+			expectedStatuses: map[str.RepoRootDir]map[str.LocalRepoPath]string{
+				"hostA": {"hostA/etc/x": "Deployed", "hostA/etc/y": "Deployed"},
+				"hostB": {"hostB/etc/z": "Deployed"},
+			},
+			expectedFailures: false,
+		},
+		{
+			name: "Newer commit replaces redeployed host",
+			current: Summary{CommitID: "bbb", Branch: "main", Hosts: []HostSummary{
+				testHost("hostA", "Deployed", testItem("hostA/etc/x", "Deployed")),
+			}},
+			expectedStatuses: map[str.RepoRootDir]map[str.LocalRepoPath]string{
+				"hostA": {"hostA/etc/x": "Deployed"},
+				"hostB": {"hostB/etc/z": "NotAttempted"},
+			},
+			expectedCommits:  map[str.RepoRootDir]string{"hostA": "", "hostB": "aaa"},
+			expectedFailures: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged := test.current.MergeFailures(previous)
+
+			statuses := itemStatuses(merged)
+			if len(statuses) != len(test.expectedStatuses) {
+				t.Errorf("expected hosts %v, got %v", test.expectedStatuses, statuses)
+			}
+			for host, expectedItems := range test.expectedStatuses {
+				for item, expectedStatus := range expectedItems {
+					if statuses[host][item] != expectedStatus {
+						t.Errorf("host '%s' item '%s': expected status '%s', got '%s'", host, item, expectedStatus, statuses[host][item])
+					}
+				}
+				if len(statuses[host]) != len(expectedItems) {
+					t.Errorf("host '%s': expected items %v, got %v", host, expectedItems, statuses[host])
+				}
+			}
+			for _, host := range merged.Hosts {
+				expectedCommit, checkCommit := test.expectedCommits[host.Name]
+				if checkCommit && host.CommitID != expectedCommit {
+					t.Errorf("host '%s': expected commit '%s', got '%s'", host.Name, expectedCommit, host.CommitID)
+				}
+			}
+
+			if merged.HasFailures() != test.expectedFailures {
+				t.Errorf("expected failures %t, got counters %+v", test.expectedFailures, merged.Counters)
+			}
+		})
+	}
+}
+
+func TestGetFailTrackerCommit(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "summary.json")
+
+	failTracker := Summary{CommitID: "aaa", Hosts: []HostSummary{
+		testHost("hostA", "Failed", testItem("hostA/etc/x", "Failed")),
+	}}
+	err := failTracker.WriteJSON(t.Context(), filePath)
+	if err != nil {
+		t.Fatalf("unexpected error writing failtracker: %v", err)
+	}
+
+	commitID, saved, err := GetFailTrackerCommit(filePath)
+	if err != nil {
+		t.Fatalf("unexpected error reading failtracker: %v", err)
+	}
+	if commitID != "aaa" {
+		t.Errorf("expected commit ID 'aaa', got '%s'", commitID)
+	}
+	if saved.CommitID != "aaa" || len(saved.Hosts) != 1 {
+		t.Errorf("unexpected failtracker summary %+v", saved)
+	}
+
+	err = Summary{}.WriteJSON(t.Context(), filePath)
+	if err != nil {
+		t.Fatalf("unexpected error writing failtracker: %v", err)
+	}
+	_, _, err = GetFailTrackerCommit(filePath)
+	if err == nil {
+		t.Errorf("expected error for failtracker without a commit ID")
+	}
+}
+
+func TestSaveReportMerges(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	filePath := filepath.Join(t.TempDir(), "summary.json")
+
+	first := Summary{CommitID: "aaa", Hosts: []HostSummary{
+		testHost("hostA", "Failed", testItem("hostA/etc/x", "Failed"), testItem("hostA/etc/y", "Failed")),
+	}}
+	first.recount()
+	err := first.SaveReport(ctx, filePath)
+	if err != nil {
+		t.Fatalf("unexpected error saving first report: %v", err)
+	}
+
+	second := Summary{CommitID: "aaa", Hosts: []HostSummary{
+		testHost("hostA", "Deployed", testItem("hostA/etc/x", "Deployed")),
+	}}
+	second.recount()
+	err = second.SaveReport(ctx, filePath)
+	if err != nil {
+		t.Fatalf("unexpected error saving second report: %v", err)
+	}
+
+	_, saved, err := GetFailTrackerCommit(filePath)
+	if err != nil {
+		t.Fatalf("failed reading saved report: %v", err)
+	}
+	if itemStatuses(saved)["hostA"]["hostA/etc/y"] != "Failed" {
+		t.Errorf("expected unfixed item to remain failed, got %v", itemStatuses(saved))
+	}
+	if saved.Counters.FailedItems != 1 || saved.Counters.CompletedItems != 1 || saved.Hosts[0].Status != "Partial" {
+		t.Errorf("unexpected merged counters %+v (host status '%s')", saved.Counters, saved.Hosts[0].Status)
+	}
+
+	third := Summary{CommitID: "aaa", Hosts: []HostSummary{
+		testHost("hostA", "Deployed", testItem("hostA/etc/y", "Deployed")),
+	}}
+	third.recount()
+	err = third.SaveReport(ctx, filePath)
+	if err != nil {
+		t.Fatalf("unexpected error saving third report: %v", err)
+	}
+	_, err = os.Stat(filePath)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected failtracker removed once all failures are fixed, got '%v'", err)
+	}
+
+	leftovers, _ := filepath.Glob(filePath + ".tmp-*")
+	if len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestLockFailTracker(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	filePath := filepath.Join(t.TempDir(), "summary.json")
+
+	lock, err := LockFailTracker(ctx, filePath, false)
+	if err != nil {
+		t.Fatalf("unexpected error taking lock: %v", err)
+	}
+
+	_, err = LockFailTracker(ctx, filePath, false)
+	if err == nil {
+		t.Fatalf("expected error taking held lock without waiting")
+	}
+
+	err = lock.Unlock()
+	if err != nil {
+		t.Fatalf("unexpected error releasing lock: %v", err)
+	}
+
+	lock, err = LockFailTracker(ctx, filePath, true)
+	if err != nil {
+		t.Fatalf("unexpected error taking released lock: %v", err)
+	}
+	err = lock.Unlock()
+	if err != nil {
+		t.Fatalf("unexpected error releasing lock: %v", err)
+	}
+}
+
+func TestWetRunReport(t *testing.T) {
+	deployFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deployFiles.SetFileMetadata("hostA/etc/new", deployment.FileInfo{Action: deployment.ActionFileCreate})
+	deployFiles.SetFileMetadata("hostA/etc/same", deployment.FileInfo{Action: deployment.ActionFileModify})
+	deployFiles.SetFileMetadata("hostA/etc/bad", deployment.FileInfo{Action: deployment.ActionFileModify})
+
+	metric := New()
+	metric.AddFileWetRun("hostA", deployFiles, "hostA/etc/new", WetRunCreate)
+	metric.AddFileWetRun("hostA", deployFiles, "hostA/etc/same", WetRunUnchanged)
+	metric.AddFile("hostA", deployFiles, "hostA/etc/bad")
+	metric.AddFileFailure("hostA", "hostA/etc/bad", errors.New("pre-check failed"))
+	metric.Stop()
+
+	summary := metric.CreateReport("main", "aaa")
+	expectedStatuses := map[str.LocalRepoPath]string{
+		"hostA/etc/new":  WetRunCreate,
+		"hostA/etc/same": WetRunUnchanged,
+		"hostA/etc/bad":  "Failed",
+	}
+	statuses := itemStatuses(summary)["hostA"]
+	for item, expectedStatus := range expectedStatuses {
+		if statuses[item] != expectedStatus {
+			t.Errorf("item '%s': expected status '%s', got '%s'", item, expectedStatus, statuses[item])
+		}
+	}
+	if summary.Counters.CompletedItems != 2 || summary.Counters.FailedItems != 1 || summary.Hosts[0].Status != "Partial" {
+		t.Errorf("unexpected counters %+v (host status '%s')", summary.Counters, summary.Hosts[0].Status)
+	}
+
+	recounted := summary
+	recounted.recount()
+	if recounted.Counters != summary.Counters {
+		t.Errorf("recount changed counters from %+v to %+v", summary.Counters, recounted.Counters)
+	}
+}
+
+func TestReportFailureContext(t *testing.T) {
+	deployFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deployFiles.SetFileMetadata("hostA/etc/x", deployment.FileInfo{Action: deployment.ActionFileModify})
+	deployFiles.SetFileMetadata("hostA/etc/y", deployment.FileInfo{Action: deployment.ActionFileModify})
+
+	commandErr := &sshinternal.CommandError{
+		Phase:    sshinternal.PhaseMetadata,
+		Command:  "chmod 640 /etc/x",
+		ExitCode: 1,
+		Output:   "Operation not permitted",
+		Elapsed:  1500 * time.Millisecond,
+		Err:      errors.New("Process exited with status 1"),
+	}
+
+	metric := New()
+	metric.AddFile("hostA", deployFiles, "hostA/etc/x", "hostA/etc/y")
+	metric.AddFileFailure("hostA", "hostA/etc/x", fmt.Errorf("failed deployment of file: %w", commandErr))
+	metric.AddFileFailure("hostA", "hostA/etc/y", errors.New("unable to deploy this file: dependent file failed deployment"))
+	metric.Stop()
+
+	items := make(map[str.LocalRepoPath]ItemSummary)
+	for _, item := range metric.CreateReport("main", "aaa").Hosts[0].Items {
+		items[item.Name] = item
+	}
+
+	failure := items["hostA/etc/x"].Failure
+	if failure == nil {
+		t.Fatalf("expected failure context for remote command failure")
+	}
+	expected := FailureContext{Phase: "metadata", Command: "chmod 640 /etc/x", ExitCode: 1, Output: "Operation not permitted", ElapsedTime: "1.5s"}
+	if *failure != expected {
+		t.Errorf("expected failure context %+v, got %+v", expected, *failure)
+	}
+	if failure.Summary() != "metadata failed with exit code 1 after 1.5s" {
+		t.Errorf("unexpected failure summary '%s'", failure.Summary())
+	}
+	if items["hostA/etc/y"].Failure != nil {
+		t.Errorf("expected no failure context for local failure, got %+v", items["hostA/etc/y"].Failure)
+	}
+}
+
+func TestReportSuspiciousShrink(t *testing.T) {
+	deployFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deployFiles.SetFileMetadata("hostA/etc/nginx.conf", deployment.FileInfo{Action: deployment.ActionFileModify})
+
+	metric := New()
+	metric.AddFile("hostA", deployFiles, "hostA/etc/nginx.conf")
+	metric.AddFileFailure("hostA", "hostA/etc/nginx.conf", fmt.Errorf("failed deployment of file: %w: content shrinks 90%%", deployment.ErrSuspiciousShrink))
+	metric.Stop()
+
+	summary := metric.CreateReport("main", "aaa")
+	item := summary.Hosts[0].Items[0]
+	if item.Status != StatusSuspiciousShrink {
+		t.Errorf("expected held file status '%s', got '%s'", StatusSuspiciousShrink, item.Status)
+	}
+	if summary.Counters.FailedItems != 1 || summary.Hosts[0].Status != "Failed" {
+		t.Errorf("expected held file to count as failed, got %+v (host %s)", summary.Counters, summary.Hosts[0].Status)
+	}
+	if !itemFailed(item.Status) {
+		t.Errorf("expected held file to be retried with failures")
+	}
+}
+
+func TestReportParseError(t *testing.T) {
+	deployFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deployFiles.SetFileMetadata("hostA/etc/good.conf", deployment.FileInfo{Action: deployment.ActionFileModify})
+
+	metric := New()
+	metric.AddFile("hostA", deployFiles, "hostA/etc/good.conf")
+	metric.AddFileParseError("hostA", "hostA/etc/bad.conf", deployment.ActionFileCreate, errors.New("invalid metadata header: line 3: invalid character"))
+	metric.Stop()
+
+	summary := metric.CreateReport("main", "aaa")
+	items := make(map[str.LocalRepoPath]ItemSummary)
+	for _, item := range summary.Hosts[0].Items {
+		items[item.Name] = item
+	}
+	bad := items["hostA/etc/bad.conf"]
+	if bad.Status != StatusParseError || bad.Action != deployment.ActionFileCreate || !strings.Contains(bad.ErrorMsg, "line 3") {
+		t.Errorf("unexpected malformed file item: %+v", bad)
+	}
+	if items["hostA/etc/good.conf"].Status != "Deployed" || summary.Hosts[0].Status != "Partial" {
+		t.Errorf("expected other files to deploy with a partial host, got %+v (host %s)", items["hostA/etc/good.conf"], summary.Hosts[0].Status)
+	}
+	if !itemFailed(bad.Status) {
+		t.Errorf("expected malformed file to be retried with failures")
+	}
+}
+
+func TestReportConfirmationRequired(t *testing.T) {
+	deployFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deployFiles.SetFileMetadata("UniversalConfs/etc/motd", deployment.FileInfo{Action: deployment.ActionFileModify})
+	deployFiles.Groups = append(deployFiles.Groups, deployment.NewFileGroup([]str.LocalRepoPath{"UniversalConfs/etc/motd"}))
+
+	metric := New()
+	metric.AddFile("hostA", deployFiles, "UniversalConfs/etc/motd")
+	metric.AddHostConfirmationRequired("hostB", deployFiles)
+	metric.Stop()
+
+	summary := metric.CreateReport("main", "aaa")
+	if summary.Status != "Deployed" {
+		t.Errorf("expected unconfirmed host not to fail the deployment, got status '%s'", summary.Status)
+	}
+	if summary.Counters.UnconfirmedHosts != 1 || summary.Counters.UnconfirmedItems != 1 || summary.Counters.FailedHosts != 0 {
+		t.Errorf("unexpected counters %+v", summary.Counters)
+	}
+	if itemStatuses(summary)["hostB"]["UniversalConfs/etc/motd"] != StatusConfirmationRequired {
+		t.Errorf("expected unconfirmed host items with status '%s'", StatusConfirmationRequired)
+	}
+	if !summary.HasFailures() || !slices.Equal(summary.FailedHosts(), []str.RepoRootDir{"hostB"}) {
+		t.Errorf("expected unconfirmed host kept for deploy failures")
+	}
+
+	recounted := summary
+	recounted.recount()
+	if recounted.Counters != summary.Counters || recounted.Status != summary.Status {
+		t.Errorf("recount changed counters from %+v to %+v", summary.Counters, recounted.Counters)
+	}
+
+	// Nothing attempted when every host is unconfirmed
+	onlyUnconfirmed := New()
+	onlyUnconfirmed.AddHostConfirmationRequired("hostB", deployFiles)
+	onlyUnconfirmed.Stop()
+	if status := onlyUnconfirmed.CreateReport("main", "aaa").Status; status != StatusConfirmationRequired {
+		t.Errorf("expected status '%s', got '%s'", StatusConfirmationRequired, status)
+	}
+}
+
+func TestReportHalted(t *testing.T) {
+	deployFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deployFiles.SetFileMetadata("UniversalConfs/etc/motd", deployment.FileInfo{Action: deployment.ActionFileModify})
+	deployFiles.Groups = append(deployFiles.Groups, deployment.NewFileGroup([]str.LocalRepoPath{"UniversalConfs/etc/motd"}))
+
+	metric := New()
+	metric.AddFile("hostA", deployFiles, "UniversalConfs/etc/motd")
+	metric.AddAllDeployFiles("hostB", deployFiles)
+	metric.AddHostFailure("hostB", fmt.Errorf("connection refused"))
+	metric.AddHostHalted("hostC", deployFiles, "canary failed on hostB")
+	metric.Stop()
+
+	if !metric.HostFailed("hostB") || metric.HostFailed("hostA") {
+		t.Errorf("expected only the failed host to be reported as failed")
+	}
+
+	summary := metric.CreateReport("main", "aaa")
+	if summary.Counters.HaltedHosts != 1 || summary.Counters.HaltedItems != 1 || summary.Counters.FailedHosts != 1 {
+		t.Errorf("unexpected counters %+v", summary.Counters)
+	}
+	if itemStatuses(summary)["hostC"]["UniversalConfs/etc/motd"] != StatusHalted {
+		t.Errorf("expected halted host items with status '%s'", StatusHalted)
+	}
+	for _, hostSummary := range summary.Hosts {
+		if hostSummary.Name == "hostC" && (hostSummary.Status != StatusHalted || hostSummary.ErrorMsg != "canary failed on hostB") {
+			t.Errorf("expected halted host with its reason, got status '%s' and error '%s'", hostSummary.Status, hostSummary.ErrorMsg)
+		}
+	}
+	if !slices.Contains(summary.FailedHosts(), "hostC") {
+		t.Errorf("expected halted host kept for deploy failures")
+	}
+
+	recounted := summary
+	recounted.recount()
+	if recounted.Counters != summary.Counters || recounted.Status != summary.Status {
+		t.Errorf("recount changed counters from %+v to %+v", summary.Counters, recounted.Counters)
+	}
+}
+
+func TestReportInterrupted(t *testing.T) {
+	deployFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deployFiles.SetFileMetadata("UniversalConfs/etc/motd", deployment.FileInfo{Action: deployment.ActionFileModify})
+	deployFiles.SetFileMetadata("UniversalConfs/etc/issue", deployment.FileInfo{Action: deployment.ActionFileModify})
+	deployFiles.Groups = append(deployFiles.Groups, deployment.NewFileGroup([]str.LocalRepoPath{"UniversalConfs/etc/motd", "UniversalConfs/etc/issue"}))
+
+	metric := New()
+	metric.AddAllDeployFiles("hostA", deployFiles)
+	metric.AddFile("hostA", deployFiles, "UniversalConfs/etc/motd")
+	metric.AddFileFailure("hostA", "UniversalConfs/etc/issue", fmt.Errorf("%w before deploying file to host hostA", deployment.ErrInterrupted))
+	metric.AddHostInterrupted("hostB", deployFiles)
+	metric.Stop()
+
+	summary := metric.CreateReport("main", "aaa")
+	statuses := itemStatuses(summary)
+	if statuses["hostA"]["UniversalConfs/etc/motd"] != "Deployed" || statuses["hostA"]["UniversalConfs/etc/issue"] != StatusInterrupted {
+		t.Errorf("expected deployed and interrupted items on hostA, got %v", statuses["hostA"])
+	}
+	if statuses["hostB"]["UniversalConfs/etc/motd"] != StatusInterrupted || statuses["hostB"]["UniversalConfs/etc/issue"] != StatusInterrupted {
+		t.Errorf("expected interrupted items on hostB, got %v", statuses["hostB"])
+	}
+	for _, hostSummary := range summary.Hosts {
+		if hostSummary.Name == "hostB" && hostSummary.Status != StatusInterrupted {
+			t.Errorf("expected interrupted host, got status '%s'", hostSummary.Status)
+		}
+	}
+	if summary.Counters.NotAttemptedHosts != 1 || summary.Counters.NotAttemptedItems != 3 || summary.Counters.FailedItems != 0 {
+		t.Errorf("expected interrupted items counted as not attempted, got %+v", summary.Counters)
+	}
+	failedHosts := summary.FailedHosts()
+	slices.Sort(failedHosts)
+	if !slices.Equal(failedHosts, []str.RepoRootDir{"hostA", "hostB"}) {
+		t.Errorf("expected interrupted hosts kept for deploy failures, got %v", failedHosts)
+	}
+
+	recounted := summary
+	recounted.recount()
+	if recounted.Counters != summary.Counters || recounted.Status != summary.Status {
+		t.Errorf("recount changed counters from %+v to %+v", summary.Counters, recounted.Counters)
+	}
+}
+
+func TestReportPreflightFailed(t *testing.T) {
+	deployFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deployFiles.SetFileMetadata("UniversalConfs/etc/motd", deployment.FileInfo{Action: deployment.ActionFileModify})
+	deployFiles.Groups = append(deployFiles.Groups, deployment.NewFileGroup([]str.LocalRepoPath{"UniversalConfs/etc/motd"}))
+
+	metric := New()
+	metric.AddFile("hostA", deployFiles, "UniversalConfs/etc/motd")
+	metric.AddAllDeployFiles("hostB", deployFiles)
+	metric.AddHostFailure("hostB", fmt.Errorf("%w: not enough space on filesystem '/'", deployment.ErrPreflightFailed))
+	metric.Stop()
+
+	summary := metric.CreateReport("main", "aaa")
+	if itemStatuses(summary)["hostB"]["UniversalConfs/etc/motd"] != StatusPreflightFailed {
+		t.Errorf("expected host items with status '%s'", StatusPreflightFailed)
+	}
+	for _, hostSummary := range summary.Hosts {
+		if hostSummary.Name == "hostB" && (hostSummary.Status != StatusPreflightFailed || !strings.Contains(hostSummary.ErrorMsg, "not enough space")) {
+			t.Errorf("expected failed pre-flight host with its reason, got status '%s' and error '%s'", hostSummary.Status, hostSummary.ErrorMsg)
+		}
+	}
+	if summary.Status != "Partial" || summary.Counters.FailedHosts != 1 || summary.Counters.FailedItems != 1 {
+		t.Errorf("expected pre-flight failure to count as failed, got status '%s' with %+v", summary.Status, summary.Counters)
+	}
+	if !slices.Equal(summary.FailedHosts(), []str.RepoRootDir{"hostB"}) {
+		t.Errorf("expected failed pre-flight host kept for deploy failures")
+	}
+
+	recounted := summary
+	recounted.recount()
+	if recounted.Counters != summary.Counters || recounted.Status != summary.Status {
+		t.Errorf("recount changed counters from %+v to %+v", summary.Counters, recounted.Counters)
+	}
+}
+
+func TestReportBackupPath(t *testing.T) {
+	deployFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deployFiles.SetFileMetadata("hostA/etc/motd", deployment.FileInfo{Action: deployment.ActionFileModify})
+	deployFiles.SetFileMetadata("hostA/etc/issue", deployment.FileInfo{Action: deployment.ActionFileCreate})
+
+	metric := New()
+	metric.AddFile("hostA", deployFiles, "hostA/etc/motd", "hostA/etc/issue")
+	metric.AddFileBackup("hostA", "hostA/etc/motd", "/var/backups/scmp/20261017T142501Z/etc/motd")
+	metric.AddFileMetadataOnly("hostA", "hostA/etc/issue")
+	metric.Stop()
+
+	summary := metric.CreateReport("main", "aaa")
+	for _, item := range summary.Hosts[0].Items {
+		switch item.Name {
+		case "hostA/etc/motd":
+			if item.Backup != "/var/backups/scmp/20261017T142501Z/etc/motd" {
+				t.Errorf("expected backup path of modified file, got '%s'", item.Backup)
+			}
+		case "hostA/etc/issue":
+			if item.Backup != "" {
+				t.Errorf("expected no backup path for file without backup, got '%s'", item.Backup)
+			}
+			if !item.MetaOnly {
+				t.Errorf("expected metadata only update to be reported")
+			}
+		}
+	}
+}
+
+func TestFailedHosts(t *testing.T) {
+	summary := Summary{Hosts: []HostSummary{
+		testHost("hostA", "Deployed", testItem("hostA/etc/x", "Deployed")),
+		testHost("hostB", "Partial", testItem("hostB/etc/y", "Failed"), testItem("hostB/etc/z", "Deployed")),
+		testHost("hostC", "NotAttempted", testItem("hostC/etc/w", "NotAttempted")),
+		testHost("hostD", "Deployed", testItem("hostD/etc/v", StatusSuspiciousShrink)),
+	}}
+
+	failedHosts := summary.FailedHosts()
+	expected := []str.RepoRootDir{"hostB", "hostC", "hostD"}
+	if !slices.Equal(failedHosts, expected) {
+		t.Errorf("expected failed hosts %v, got %v", expected, failedHosts)
+	}
+}
@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"cmp"
+	"context"
+	"scmp/internal/logctx"
+	"scmp/internal/parsing"
+	"scmp/internal/str"
+	"slices"
+	"time"
+)
+
+// Time a file spent on a host and the content it transferred
+type FileTiming struct {
+	QueueWait time.Duration // Waiting for a deploy slot, earlier files, or files on other hosts
+	Transfer  time.Duration // Placing content (or creating/deleting the item)
+	Commands  time.Duration // Remote commands of the file (install, checks, reloads triggered by the file)
+	Bytes     int           // Transferred content (only counted once the file deployed)
+}
+
+// Stages of a file deployment that time is attributed to
+const (
+	StageQueued   int = iota // Time counts as queue wait
+	StageCommands            // Time counts as command time
+	StageTransfer            // Time counts as transfer time
+)
+
+// Splits the time of a single file deployment into its stages, starting with commands
+type FileTimer struct {
+	timing     FileTiming
+	stage      int
+	stageStart time.Time
+}
+
+func StartFileTimer() (timer *FileTimer) {
+	timer = &FileTimer{stage: StageCommands, stageStart: time.Now()}
+	return
+}
+
+// Attributes time since the last stage change to the current stage and switches to the given stage
+func (timer *FileTimer) Stage(stage int) {
+	now := time.Now()
+	elapsed := now.Sub(timer.stageStart)
+	switch timer.stage {
+	case StageQueued:
+		timer.timing.QueueWait += elapsed
+	case StageCommands:
+		timer.timing.Commands += elapsed
+	case StageTransfer:
+		timer.timing.Transfer += elapsed
+	}
+	timer.stage = stage
+	timer.stageStart = now
+}
+
+func (timer *FileTimer) AddBytes(bytes int) {
+	timer.timing.Bytes += bytes
+}
+
+// Ends the current stage and returns the collected timing
+func (timer *FileTimer) Finish() (timing FileTiming) {
+	timer.Stage(timer.stage)
+	timing = timer.timing
+	return
+}
+
+// Adds timing of a file on host to any timing already recorded for it (a file can be timed in several steps)
+func (metric *Metrics) AddFileTiming(host str.RepoRootDir, file str.LocalRepoPath, timing FileTiming) {
+	metric.fileTimingMutex.Lock()
+	defer metric.fileTimingMutex.Unlock()
+	if metric.fileTiming[host] == nil {
+		metric.fileTiming[host] = make(map[str.LocalRepoPath]FileTiming)
+	}
+	recorded := metric.fileTiming[host][file]
+	recorded.QueueWait += timing.QueueWait
+	recorded.Transfer += timing.Transfer
+	recorded.Commands += timing.Commands
+	recorded.Bytes += timing.Bytes
+	metric.fileTiming[host][file] = recorded
+}
+
+// Records how long the host deployed for, from getting a connection slot until disconnecting
+func (metric *Metrics) AddHostElapsed(host str.RepoRootDir, elapsed time.Duration) {
+	metric.hostElapsedMutex.Lock()
+	metric.hostElapsed[host] = elapsed
+	metric.hostElapsedMutex.Unlock()
+}
+
+// Sets the timing fields of an item from the recorded file timing
+func (itemSummary *ItemSummary) setTiming(timing FileTiming) {
+	itemSummary.QueueWaitMs = timing.QueueWait.Milliseconds()
+	itemSummary.TransferMs = timing.Transfer.Milliseconds()
+	itemSummary.CommandMs = timing.Commands.Milliseconds()
+	itemSummary.TransferredBytes = timing.Bytes
+}
+
+// Sets the host timing totals from the host duration and its item timings
+func (hostSummary *HostSummary) setTimingTotals(elapsed time.Duration) {
+	hostSummary.DurationMs = elapsed.Milliseconds()
+	for _, itemSummary := range hostSummary.Items {
+		hostSummary.QueueWaitMs += itemSummary.QueueWaitMs
+		hostSummary.TransferMs += itemSummary.TransferMs
+		hostSummary.CommandMs += itemSummary.CommandMs
+		hostSummary.TransferredBytes += itemSummary.TransferredBytes
+	}
+}
+
+// Time an item was actively deployed (transfer and commands, without queue wait)
+func (itemSummary ItemSummary) activeMs() (activeMs int64) {
+	activeMs = itemSummary.TransferMs + itemSummary.CommandMs
+	return
+}
+
+// Slowest hosts (by duration) and slowest files (by transfer and command time) of the deployment, at most limit of each
+func (deploymentSummary Summary) Slowest(limit int) (hosts []HostSummary, items []SlowItem) {
+	if limit <= 0 {
+		return
+	}
+	for _, hostSummary := range deploymentSummary.Hosts {
+		if hostSummary.DurationMs > 0 {
+			hosts = append(hosts, hostSummary)
+		}
+		for _, itemSummary := range hostSummary.Items {
+			if itemSummary.activeMs() > 0 || itemSummary.QueueWaitMs > 0 {
+				items = append(items, SlowItem{Host: hostSummary.Name, Item: itemSummary})
+			}
+		}
+	}
+
+	slices.SortStableFunc(hosts, func(a, b HostSummary) int {
+		return cmp.Or(cmp.Compare(b.DurationMs, a.DurationMs), cmp.Compare(a.Name, b.Name))
+	})
+	slices.SortStableFunc(items, func(a, b SlowItem) int {
+		return cmp.Or(cmp.Compare(b.Item.activeMs(), a.Item.activeMs()), cmp.Compare(a.Host, b.Host), cmp.Compare(a.Item.Name, b.Item.Name))
+	})
+
+	hosts = hosts[:min(limit, len(hosts))]
+	items = items[:min(limit, len(items))]
+	return
+}
+
+// Prints the slowest hosts and files with the breakdown of their time and transferred size
+func (deploymentSummary Summary) PrintSlowest(ctx context.Context, limit int) {
+	hosts, items := deploymentSummary.Slowest(limit)
+	if len(hosts) == 0 && len(items) == 0 {
+		return
+	}
+
+	logctx.LogStdInfo(ctx, "Slowest %d host(s):\n", len(hosts))
+	for _, hostSummary := range hosts {
+		logctx.LogStdInfo(ctx, " %s: %s (transfer %s, commands %s, queued %s, %s)\n",
+			hostSummary.Name, formatMs(hostSummary.DurationMs), formatMs(hostSummary.TransferMs), formatMs(hostSummary.CommandMs),
+			formatMs(hostSummary.QueueWaitMs), parsing.FormatBytes(hostSummary.TransferredBytes))
+	}
+
+	logctx.LogStdInfo(ctx, "Slowest %d file(s):\n", len(items))
+	for _, slowItem := range items {
+		logctx.LogStdInfo(ctx, " %s '%s': %s (transfer %s, commands %s, queued %s, %s)\n",
+			slowItem.Host, slowItem.Item.Name, formatMs(slowItem.Item.activeMs()), formatMs(slowItem.Item.TransferMs), formatMs(slowItem.Item.CommandMs),
+			formatMs(slowItem.Item.QueueWaitMs), parsing.FormatBytes(slowItem.Item.TransferredBytes))
+	}
+}
+
+func formatMs(milliseconds int64) (formatted string) {
+	formatted = formatDuration(time.Duration(milliseconds) * time.Millisecond)
+	return
+}
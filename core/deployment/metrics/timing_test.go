@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"scmp/core/deployment"
+	"scmp/internal/str"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileTimingReport(t *testing.T) {
+	deployFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deployFiles.SetFileMetadata("UniversalConfs/opt/big.tar", deployment.FileInfo{Action: deployment.ActionFileCreate})
+	deployFiles.SetFileMetadata("UniversalConfs/etc/small", deployment.FileInfo{Action: deployment.ActionFileModify})
+
+	metric := New()
+
+	// Host goroutines record their files concurrently, queue wait and file steps add up
+	var wg sync.WaitGroup
+	for _, host := range []str.RepoRootDir{"hostA", "hostB"} {
+		for _, file := range []str.LocalRepoPath{"UniversalConfs/opt/big.tar", "UniversalConfs/etc/small"} {
+			wg.Go(func() {
+				metric.AddFile(host, deployFiles, file)
+				metric.AddFileTiming(host, file, FileTiming{QueueWait: 100 * time.Millisecond})
+				timing := FileTiming{Transfer: time.Second, Commands: 200 * time.Millisecond, Bytes: 1024}
+				if file == "UniversalConfs/opt/big.tar" && host == "hostB" {
+					timing = FileTiming{Transfer: 90 * time.Second, Commands: time.Second, Bytes: 100 << 20}
+				}
+				metric.AddFileTiming(host, file, timing)
+			})
+		}
+	}
+	wg.Wait()
+	metric.AddHostElapsed("hostA", 3*time.Second)
+	metric.AddHostElapsed("hostB", 95*time.Second)
+	metric.Stop()
+
+	summary := metric.CreateReport("main", "aaa")
+	for _, hostSummary := range summary.Hosts {
+		for _, item := range hostSummary.Items {
+			if item.QueueWaitMs != 100 {
+				t.Errorf("host %s item '%s': expected queue wait of 100ms, got %d", hostSummary.Name, item.Name, item.QueueWaitMs)
+			}
+		}
+		if hostSummary.Name == "hostA" && (hostSummary.DurationMs != 3000 || hostSummary.TransferMs != 2000 || hostSummary.CommandMs != 400 ||
+			hostSummary.QueueWaitMs != 200 || hostSummary.TransferredBytes != 2048) {
+			t.Errorf("unexpected host totals of hostA: %+v", hostSummary)
+		}
+	}
+
+	hosts, items := summary.Slowest(1)
+	if len(hosts) != 1 || hosts[0].Name != "hostB" {
+		t.Errorf("expected hostB as slowest host, got %+v", hosts)
+	}
+	if len(items) != 1 || items[0].Host != "hostB" || items[0].Item.Name != "UniversalConfs/opt/big.tar" || items[0].Item.TransferredBytes != 100<<20 {
+		t.Errorf("expected the large archive on hostB as slowest file, got %+v", items)
+	}
+
+	hosts, items = summary.Slowest(10)
+	if len(hosts) != 2 || len(items) != 4 {
+		t.Errorf("expected all hosts and files when the limit exceeds them, got %d hosts and %d files", len(hosts), len(items))
+	}
+	if items[1].Host != "hostA" || items[1].Item.Name != "UniversalConfs/etc/small" {
+		t.Errorf("expected equal durations ordered by host then file, got %s '%s'", items[1].Host, items[1].Item.Name)
+	}
+}
+
+func TestFileTimer(t *testing.T) {
+	timer := StartFileTimer()
+	time.Sleep(5 * time.Millisecond)
+	timer.Stage(StageTransfer)
+	time.Sleep(5 * time.Millisecond)
+	timer.Stage(StageQueued)
+	time.Sleep(5 * time.Millisecond)
+	timer.Stage(StageCommands)
+	timer.AddBytes(42)
+	timing := timer.Finish()
+
+	if timing.Commands < 5*time.Millisecond || timing.Transfer < 5*time.Millisecond || timing.QueueWait < 5*time.Millisecond || timing.Bytes != 42 {
+		t.Errorf("expected time attributed to every stage, got %+v", timing)
+	}
+}
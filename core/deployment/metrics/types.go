@@ -2,6 +2,8 @@
 package metrics
 
 import (
+	"scmp/core/deployment"
+	"scmp/core/deployment/events"
 	"scmp/internal/str"
 	"sync"
 	"time"
@@ -9,47 +11,137 @@ import (
 
 // Used for metrics - counting post deployment
 type Metrics struct {
-	startTime         time.Time
-	hostFiles         map[str.RepoRootDir][]str.LocalRepoPath // Key on hostname, list of files deployed to host
-	hostFilesMutex    sync.Mutex
-	hostErr           map[str.RepoRootDir]error // Error for host (agnostic of files)
-	hostErrMutex      sync.Mutex
-	hostsFileErr      map[str.RepoRootDir]map[str.LocalRepoPath]error // Key on hostname, key on repo file path, value of error (ensures file errors are always scoped to host)
-	hostsFileErrMutex sync.RWMutex
-	fileAction        map[str.LocalRepoPath]str.DeployAction
-	fileActionMutex   sync.Mutex
-	hostBytes         map[str.RepoRootDir]int
-	hostBytesMutex    sync.Mutex
-	endTime           time.Time
+	startTime             time.Time
+	hostFiles             map[str.RepoRootDir][]str.LocalRepoPath // Key on hostname, list of files deployed to host
+	hostFilesMutex        sync.Mutex
+	hostErr               map[str.RepoRootDir]error // Error for host (agnostic of files)
+	hostErrMutex          sync.Mutex
+	hostsFileErr          map[str.RepoRootDir]map[str.LocalRepoPath]error // Key on hostname, key on repo file path, value of error (ensures file errors are always scoped to host)
+	hostsFileErrMutex     sync.RWMutex
+	hostsFileSkipped      map[str.RepoRootDir]map[str.LocalRepoPath]string // Key on hostname, key on repo file path, value of skip reason
+	hostsFileSkippedMutex sync.Mutex
+	hostsFileWetRun       map[str.RepoRootDir]map[str.LocalRepoPath]string // Key on hostname, key on repo file path, value of wet-run outcome
+	hostsFileWetRunMutex  sync.Mutex
+	hostsFileBackup       map[str.RepoRootDir]map[str.LocalRepoPath]str.RemotePath // Key on hostname, key on repo file path, value of backup kept after deployment
+	hostsFileBackupMutex  sync.Mutex
+	hostsMetaOnly         map[str.RepoRootDir]map[str.LocalRepoPath]struct{} // Key on hostname, key on repo file path of files that only had their metadata updated
+	hostsMetaOnlyMutex    sync.Mutex
+	fileAction            map[str.LocalRepoPath]str.DeployAction
+	fileActionMutex       sync.Mutex
+	hostBytes             map[str.RepoRootDir]int
+	hostBytesMutex        sync.Mutex
+	hostTransfer          map[str.RepoRootDir]*transferWindow // Time spent uploading to each host
+	hostTransferMutex     sync.Mutex
+	hostSource            map[str.RepoRootDir]deploymentSource // Branch and commit each host deployed from (when not the deployment commit)
+	hostSourceMutex       sync.Mutex
+	hostEndpoint          map[str.RepoRootDir]string // Address each host was reached on (only for hosts with fallback addresses)
+	hostEndpointMutex     sync.Mutex
+	hostNotAttempted      map[str.RepoRootDir]string // Hosts never started due to deployment stop, with the status they are reported as
+	hostNotAttemptedMutex sync.Mutex
+	hostUnconfirmed       map[str.RepoRootDir]struct{} // Hosts held back for missing confirmation
+	hostUnconfirmedMutex  sync.Mutex
+	hostHalted            map[str.RepoRootDir]string // Hosts never started because an earlier rollout batch failed, with the reason
+	hostHaltedMutex       sync.Mutex
+	deadline              time.Duration                    // Configured deployment deadline (zero when unlimited)
+	hostDeadline          map[str.RepoRootDir]hostDeadline // Deployment time of hosts when any deadline applies
+	hostDeadlineMutex     sync.Mutex
+	hostPhases            map[str.RepoRootDir][]PhaseSummary // Phase results in deployment order (only for hosts deploying in phases)
+	hostPhasesMutex       sync.Mutex
+	fileTiming            map[str.RepoRootDir]map[str.LocalRepoPath]FileTiming // Key on hostname, key on repo file path, time spent by the file on the host
+	fileTimingMutex       sync.Mutex
+	hostElapsed           map[str.RepoRootDir]time.Duration // Time each started host deployed for
+	hostElapsedMutex      sync.Mutex
+	progress              map[str.RepoRootDir]*hostProgress // Live host progress (nil unless status lines are enabled)
+	progressMutex         sync.Mutex
+	eventStream           *events.Writer // Live deployment events (nil unless requested)
+	endTime               time.Time
+}
+
+type hostProgress struct {
+	totalFiles int
+	doneFiles  int
+	activity   string    // Current step, like connecting or transferring a file
+	start      time.Time // Zero while queued
+	end        time.Time // Zero while deploying
+	reported   bool      // Finished host was already returned by TakeFinishedHostLines
+}
+
+// Overlapping uploads to one host count as a single busy period
+type transferWindow struct {
+	active int       // Uploads in progress
+	since  time.Time // Start of the current busy period
+	busy   time.Duration
+}
+
+type hostDeadline struct {
+	configured time.Duration // Host deadline (zero when only the deployment deadline applies)
+	elapsed    time.Duration
+	reached    bool // Host was stopped or cut off by a deadline
+}
+
+type deploymentSource struct {
+	branch   string
+	commitID string
 }
 
 // Summary of actions done and collected metrics
-// Status could be UpToDate,Deployed,Partial,Failed
+// Status could be UpToDate,Deployed,Partial,Failed,ConfirmationRequired (hosts may also be NotAttempted, Halted, or DeadlineExceeded)
+// Same format is used for the failtracker file and the requested JSON summary output
 type Summary struct {
 	Status          string `json:"Status"`
 	StartTime       string `json:"Start-Time"`
 	EndTime         string `json:"End-Time"`
-	ElapsedTime     string `json:"Elapsed-Time"`     // Human readable
-	TransferredData string `json:"Transferred-Size"` // Human readable
+	ElapsedTime     string `json:"Elapsed-Time"`       // Human readable
+	Deadline        string `json:"Deadline,omitempty"` // Human readable, configured limit of Elapsed-Time
+	TransferredData string `json:"Transferred-Size"`   // Human readable
 	Counters        struct {
-		Hosts          int `json:"Hosts" `
-		Items          int `json:"Items"`
-		CompletedHosts int `json:"Hosts-Completed"`
-		CompletedItems int `json:"Items-Completed"`
-		FailedHosts    int `json:"Hosts-Failed"`
-		FailedItems    int `json:"Items-Failed"`
+		Hosts             int `json:"Hosts" `
+		Items             int `json:"Items"`
+		CompletedHosts    int `json:"Hosts-Completed"`
+		CompletedItems    int `json:"Items-Completed"`
+		FailedHosts       int `json:"Hosts-Failed"`
+		FailedItems       int `json:"Items-Failed"`
+		NotAttemptedHosts int `json:"Hosts-Not-Attempted,omitempty"`
+		NotAttemptedItems int `json:"Items-Not-Attempted,omitempty"`
+		UnconfirmedHosts  int `json:"Hosts-Confirmation-Required,omitempty"`
+		UnconfirmedItems  int `json:"Items-Confirmation-Required,omitempty"`
+		HaltedHosts       int `json:"Hosts-Halted,omitempty"`
+		HaltedItems       int `json:"Items-Halted,omitempty"`
+		SkippedItems      int `json:"Items-Skipped,omitempty"`
 	} `json:"Counters"`
 	CommitID string        `json:"Deployment-Commit-Hash"`
+	Branch   string        `json:"Deployment-Branch,omitempty"`
 	Hosts    []HostSummary `json:"Hosts,omitempty"`
+
+	Skipped []deployment.SkipSummary `json:"Skipped-Files,omitempty"` // Files left out while planning the deployment
 }
 
 type HostSummary struct {
-	Name            str.RepoRootDir `json:"Name"`
-	Status          string          `json:"Status,omitempty"`
-	ErrorMsg        string          `json:"Error-Message,omitempty"`
-	TotalItems      int             `json:"Total-Items,omitempty"`
-	TransferredData string          `json:"Transferred-Size,omitempty"`
-	Items           []ItemSummary   `json:"Items,omitempty"`
+	Name             str.RepoRootDir `json:"Name"`
+	Status           string          `json:"Status,omitempty"`
+	Endpoint         string          `json:"Connected-Address,omitempty"`
+	ErrorMsg         string          `json:"Error-Message,omitempty"`
+	TotalItems       int             `json:"Total-Items,omitempty"`
+	TransferredData  string          `json:"Transferred-Size,omitempty"`
+	Deadline         string          `json:"Deadline,omitempty"`      // Human readable, configured host deadline
+	ElapsedTime      string          `json:"Elapsed-Time,omitempty"`  // Human readable, only recorded when a deadline applies
+	TransferRate     string          `json:"Transfer-Rate,omitempty"` // Human readable, transferred bytes over the time uploads were running
+	Branch           string          `json:"Branch,omitempty"`
+	CommitID         string          `json:"Commit-Hash,omitempty"`
+	Phases           []PhaseSummary  `json:"Phases,omitempty"`            // Only for hosts deploying in phases
+	DurationMs       int64           `json:"Duration-Ms,omitempty"`       // From getting a connection slot until disconnecting
+	QueueWaitMs      int64           `json:"Queue-Wait-Ms,omitempty"`     // Total of the items
+	TransferMs       int64           `json:"Transfer-Ms,omitempty"`       // Total of the items
+	CommandMs        int64           `json:"Command-Ms,omitempty"`        // Total of the items
+	TransferredBytes int             `json:"Transferred-Bytes,omitempty"` // Total of the items
+	Items            []ItemSummary   `json:"Items,omitempty"`
+}
+
+type PhaseSummary struct {
+	Name        string `json:"Name"`
+	Status      string `json:"Status"`
+	Items       int    `json:"Total-Items"`
+	FailedItems int    `json:"Failed-Items,omitempty"`
 }
 
 type ItemSummary struct {
@@ -57,4 +149,27 @@ type ItemSummary struct {
 	Action   str.DeployAction  `json:"Deployment-Action"`
 	Status   string            `json:"Status,omitempty"`
 	ErrorMsg string            `json:"Error-Message,omitempty"`
+	Failure  *FailureContext   `json:"Failure-Context,omitempty"` // Only for failures of remote commands
+	Backup   str.RemotePath    `json:"Backup-Path,omitempty"`     // Remote backup of the previous file kept after deployment
+	MetaOnly bool              `json:"Metadata-Only,omitempty"`   // Only owner/group, permissions, or attributes were updated, content was not transferred
+
+	QueueWaitMs      int64 `json:"Queue-Wait-Ms,omitempty"`     // Waiting for a deploy slot, earlier files, or files on other hosts
+	TransferMs       int64 `json:"Transfer-Ms,omitempty"`       // Placing content (or creating/deleting the item)
+	CommandMs        int64 `json:"Command-Ms,omitempty"`        // Remote commands of the item (install, checks, reloads triggered by the item)
+	TransferredBytes int   `json:"Transferred-Bytes,omitempty"` // Content transferred for the item
+}
+
+// Item of a host in the slowest items report
+type SlowItem struct {
+	Host str.RepoRootDir
+	Item ItemSummary
+}
+
+// Remote context of a failed item
+type FailureContext struct {
+	Phase       string `json:"Phase,omitempty"`
+	Command     string `json:"Command"`
+	ExitCode    int    `json:"Exit-Code"` // -1 when the command never exited
+	Output      string `json:"Output,omitempty"`
+	ElapsedTime string `json:"Elapsed-Time"`
 }
@@ -0,0 +1,296 @@
+package predeploy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"scmp/internal/config"
+	"scmp/internal/crypto"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/secrets"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Hash of an empty request body (S3 GET requests)
+const emptyPayloadHash string = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+const (
+	artifactConnectTimeout        time.Duration = 30 * time.Second
+	artifactResponseHeaderTimeout time.Duration = 60 * time.Second
+)
+
+// Download client, a stalled server fails the fetch instead of holding the deployment
+// Body transfer is not bounded, large artifacts on slow links are expected
+var artifactHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: artifactConnectTimeout}).DialContext,
+		TLSHandshakeTimeout:   artifactConnectTimeout,
+		ResponseHeaderTimeout: artifactResponseHeaderTimeout,
+	},
+}
+
+// Retrieves a remote artifact into the local cache (named by its hash) and returns the cached file path
+// Content is only kept when it matches the hash in the pointer file, cached copies are verified before reuse
+func fetchArtifact(ctx context.Context, artifactPath string, trackedHash str.FileID) (cachePath string, err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	cachePath = filepath.Join(cfg.ArtifactCacheDir, string(trackedHash))
+
+	_, err = os.Stat(cachePath)
+	if err == nil {
+		var cachedHash string
+		cachedHash, err = crypto.SHA256SumStream(cachePath)
+		if err != nil {
+			err = fmt.Errorf("failed to hash cached artifact: %w", err)
+			return
+		}
+		if str.FileID(cachedHash) == trackedHash {
+			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Using cached artifact '%s' for '%s'\n", cachePath, artifactPath)
+			return
+		}
+
+		logctx.LogStdWarn(ctx, "Cached artifact '%s' does not match its hash, downloading it again\n", cachePath)
+		err = os.Remove(cachePath)
+		if err != nil {
+			err = fmt.Errorf("failed to remove corrupt cached artifact: %w", err)
+			return
+		}
+	} else if !os.IsNotExist(err) {
+		err = fmt.Errorf("failed to check artifact cache: %w", err)
+		return
+	}
+
+	request, err := newArtifactRequest(ctx, cfg, artifactPath)
+	if err != nil {
+		return
+	}
+
+	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Downloading artifact '%s'\n", artifactPath)
+	response, err := artifactHTTPClient.Do(request)
+	if err != nil {
+		err = fmt.Errorf("failed to download artifact '%s': %w", artifactPath, err)
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("failed to download artifact '%s': server responded with '%s'", artifactPath, response.Status)
+		return
+	}
+
+	err = os.MkdirAll(cfg.ArtifactCacheDir, 0700)
+	if err != nil {
+		err = fmt.Errorf("failed to create artifact cache directory: %w", err)
+		return
+	}
+
+	// Downloads are hashed while written, only verified content takes the cache name
+	downloadFile, err := os.CreateTemp(cfg.ArtifactCacheDir, ".download-*")
+	if err != nil {
+		err = fmt.Errorf("failed to create artifact download file: %w", err)
+		return
+	}
+	downloadPath := downloadFile.Name()
+	defer func() {
+		if err != nil {
+			_ = os.Remove(downloadPath)
+		}
+	}()
+
+	downloadedHash, err := crypto.SHA256SumReader(io.TeeReader(response.Body, downloadFile))
+	lerr := downloadFile.Close()
+	if err != nil {
+		err = fmt.Errorf("failed to download artifact '%s': %w", artifactPath, err)
+		return
+	}
+	if lerr != nil {
+		err = fmt.Errorf("failed to write artifact download file: %w", lerr)
+		return
+	}
+
+	if str.FileID(downloadedHash) != trackedHash {
+		err = fmt.Errorf("artifact '%s': downloaded content does not match the hash in the pointer file: expected: '%s' downloaded: '%s'",
+			artifactPath, trackedHash[:16], downloadedHash[:16])
+		return
+	}
+
+	err = os.Rename(downloadPath, cachePath)
+	if err != nil {
+		err = fmt.Errorf("failed to move artifact download into cache: %w", err)
+		return
+	}
+	return
+}
+
+// Builds the download request of a remote artifact, including any credentials
+func newArtifactRequest(ctx context.Context, cfg config.Config, artifactPath string) (request *http.Request, err error) {
+	location, err := url.Parse(artifactPath)
+	if err != nil {
+		err = fmt.Errorf("invalid artifact location '%s': %w", artifactPath, err)
+		return
+	}
+
+	// Repository content must never carry secrets
+	_, hasPassword := location.User.Password()
+	if hasPassword {
+		err = fmt.Errorf("artifact location '%s' must not contain a password, store it in the vault entry '%s' instead", location.Redacted(), location.Hostname())
+		return
+	}
+	userName := location.User.Username()
+	location.User = nil
+
+	if location.Scheme == "s3" {
+		request, err = newS3Request(ctx, cfg, location, userName)
+		return
+	}
+
+	request, err = http.NewRequestWithContext(ctx, http.MethodGet, location.String(), nil)
+	if err != nil {
+		err = fmt.Errorf("failed to create artifact request: %w", err)
+		return
+	}
+
+	// Basic authentication uses the user in the location and the login password of the vault entry named after the server
+	if userName != "" {
+		if location.Scheme != "https" {
+			err = fmt.Errorf("artifact location '%s' has a user but is not https, refusing to send vault credentials in cleartext", location.String())
+			return
+		}
+		var credential config.Credential
+		credential, err = secrets.GetServiceCredential(ctx, str.RepoRootDir(location.Hostname()))
+		if err != nil {
+			return
+		}
+		request.SetBasicAuth(userName, credential.LoginPassword)
+	}
+	return
+}
+
+// Builds a signed path-style request for an s3://bucket/key location
+// Credentials come from the AWS environment variables, or the access key ID in the location and the vault entry named after the bucket
+func newS3Request(ctx context.Context, cfg config.Config, location *url.URL, accessKeyID string) (request *http.Request, err error) {
+	bucket := location.Host
+	key := strings.TrimPrefix(location.Path, "/")
+	if bucket == "" || key == "" {
+		err = fmt.Errorf("artifact location '%s' must be in the format 's3://bucket/key'", location.String())
+		return
+	}
+
+	objectPath := "/" + bucket + "/" + key
+	objectURL := cfg.ArtifactS3Endpoint + s3EscapePath(objectPath)
+	request, err = http.NewRequestWithContext(ctx, http.MethodGet, objectURL, nil)
+	if err != nil {
+		err = fmt.Errorf("failed to create artifact request: %w", err)
+		return
+	}
+
+	secretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	sessionToken := os.Getenv("AWS_SESSION_TOKEN")
+	if accessKeyID == "" && os.Getenv("AWS_ACCESS_KEY_ID") != "" {
+		accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	} else if accessKeyID != "" {
+		var credential config.Credential
+		credential, err = secrets.GetServiceCredential(ctx, str.RepoRootDir(bucket))
+		if err != nil {
+			return
+		}
+		secretAccessKey = credential.LoginPassword
+		sessionToken = ""
+	}
+
+	// Public buckets are read without signing
+	if accessKeyID == "" {
+		return
+	}
+	if secretAccessKey == "" {
+		err = fmt.Errorf("no secret access key available for access key ID '%s'", accessKeyID)
+		return
+	}
+	if request.URL.Scheme != "https" {
+		logctx.LogStdWarn(ctx, "Signing artifact request to non-https endpoint '%s', the request (and any session token) is sent in cleartext\n", cfg.ArtifactS3Endpoint)
+	}
+	if sessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+	signS3Request(request, cfg.ArtifactS3Region, accessKeyID, secretAccessKey, time.Now())
+	return
+}
+
+// Escapes every byte of an S3 object path except unreserved characters and path separators (as required for signing)
+func s3EscapePath(objectPath string) (escapedPath string) {
+	var escaped strings.Builder
+	for _, char := range []byte(objectPath) {
+		if (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') ||
+			char == '-' || char == '_' || char == '.' || char == '~' || char == '/' {
+			escaped.WriteByte(char)
+			continue
+		}
+		fmt.Fprintf(&escaped, "%%%02X", char)
+	}
+	escapedPath = escaped.String()
+	return
+}
+
+// Adds AWS signature version 4 authorization to a request without a body, signing the host and every header already set
+func signS3Request(request *http.Request, region string, accessKeyID string, secretAccessKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+
+	canonicalValues := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		canonicalValues[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var headerNames []string
+	for name := range canonicalValues {
+		headerNames = append(headerNames, name)
+	}
+	slices.Sort(headerNames)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		canonicalHeaders.WriteString(name + ":" + canonicalValues[name] + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := []byte("AWS4" + secretAccessKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKeyID+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) (sum []byte) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	sum = mac.Sum(nil)
+	return
+}
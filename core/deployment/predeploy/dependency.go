@@ -1,17 +1,21 @@
 package predeploy
 
 import (
+	"cmp"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"scmp/core/deployment"
+	"scmp/internal/logctx"
 	"scmp/internal/str"
 	"slices"
-	"sort"
 )
 
 // Correct the order of deployment based on any present dependencies
+// Dependencies prefixed with "remote:" are resolved against whichever repository file supplies that target path for this host
 // Returns independent trees of sorted file lists (each outer array has no dependency on any other outer array)
-func HandleFileDependencies(rawDeploymentFiles []str.LocalRepoPath, deployFiles *deployment.HostFiles) (orderedDeploymentFiles [][]str.LocalRepoPath, err error) {
+// Files free to deploy in either order go smallest first (largest first when requested), as do the trees themselves
+func HandleFileDependencies(ctx context.Context, rawDeploymentFiles []str.LocalRepoPath, deployFiles *deployment.HostFiles, largeFirst bool) (orderedDeploymentFiles [][]str.LocalRepoPath, err error) {
 	// Tracking maps
 	graph := make(map[str.LocalRepoPath][]str.LocalRepoPath)
 	reverseGraph := make(map[str.LocalRepoPath][]str.LocalRepoPath)
@@ -23,12 +27,36 @@ func HandleFileDependencies(rawDeploymentFiles []str.LocalRepoPath, deployFiles
 		rawFileSet[file] = struct{}{}
 	}
 
+	// Make map of target paths for this host to resolve remote path dependencies
+	targetToRepoPath := MapTargetPaths(rawDeploymentFiles, deployFiles)
+
 	// Create dependency graph
 	for _, file := range rawDeploymentFiles {
 		info := deployFiles.GetFileInfo(file)
 		fileSet[file] = true
 
+		var resolvedDeps []str.LocalRepoPath
+		var depsResolved bool
 		for _, dep := range info.Dependencies {
+			// Translate remote path dependency to the repository path supplying it on this host
+			if str.HasPrefix(dep, deployment.RemoteDependencyPrefix) {
+				remoteDep := str.RemotePath(str.TrimPrefix(dep, string(deployment.RemoteDependencyPrefix)))
+
+				repoPath, depTargetPresent := targetToRepoPath[remoteDep]
+				if !depTargetPresent {
+					logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog,
+						"File '%s': dependency on remote path '%s' is not supplied by any file in this deployment\n", file, remoteDep)
+					resolvedDeps = append(resolvedDeps, dep)
+					continue
+				}
+
+				logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog,
+					"File '%s': resolved dependency on remote path '%s' to '%s'\n", file, remoteDep, repoPath)
+				dep = repoPath
+				depsResolved = true
+			}
+			resolvedDeps = append(resolvedDeps, dep)
+
 			// Avoid including dependency file names in deployment that are not a part of this deployment
 			_, depInDeployment := rawFileSet[dep]
 
@@ -39,6 +67,11 @@ func HandleFileDependencies(rawDeploymentFiles []str.LocalRepoPath, deployFiles
 				fileSet[dep] = true
 			}
 		}
+
+		// Store host-specific dependencies so deployment can check resolved files
+		if depsResolved {
+			deployFiles.SetFileDependencies(file, resolvedDeps)
+		}
 	}
 
 	// Find connected trees - undirected DFS
@@ -94,9 +127,16 @@ func HandleFileDependencies(rawDeploymentFiles []str.LocalRepoPath, deployFiles
 
 		var sorted []str.LocalRepoPath
 		for len(queue) > 0 {
-			file := queue[0]              // Get lead item in queue
-			queue = queue[1:]             // Remove lead item in queue
-			sorted = append(sorted, file) // Add lead item to result
+			// Take the file that should go first out of all files with their dependencies met
+			next := 0
+			for index := range queue {
+				if compareDeployOrder(deployFiles, queue[index], queue[next], largeFirst) < 0 {
+					next = index
+				}
+			}
+			file := queue[next]
+			queue = slices.Delete(queue, next, next+1)
+			sorted = append(sorted, file)
 
 			// Add dependents to result when immediately "attached" to parent
 			for _, neighbor := range subGraph[file] {
@@ -118,16 +158,75 @@ func HandleFileDependencies(rawDeploymentFiles []str.LocalRepoPath, deployFiles
 		orderedDeploymentFiles = append(orderedDeploymentFiles, sorted)
 	}
 
-	// Create stable ordering of trees based on first file in each
-	sort.Slice(orderedDeploymentFiles, func(i, j int) bool {
-		return orderedDeploymentFiles[i][0] < orderedDeploymentFiles[j][0]
+	// Create stable ordering of trees based on their total size, then on first file in each
+	treeSizes := make(map[str.LocalRepoPath]int, len(orderedDeploymentFiles))
+	for _, tree := range orderedDeploymentFiles {
+		for _, file := range tree {
+			treeSizes[tree[0]] += deployFiles.GetFileInfo(file).FileSize
+		}
+	}
+	slices.SortFunc(orderedDeploymentFiles, func(treeA, treeB []str.LocalRepoPath) int {
+		order := cmp.Compare(treeSizes[treeA[0]], treeSizes[treeB[0]])
+		if largeFirst {
+			order = -order
+		}
+		if order == 0 {
+			order = cmp.Compare(treeA[0], treeB[0])
+		}
+		return order
 	})
 
 	return
 }
 
+// Orders two files that have no dependency between them
+// Smaller files go first (larger first when requested) so quick files finish, or fail, before long transfers start
+// Files of equal size stay in lexicographic order
+func compareDeployOrder(deployFiles *deployment.HostFiles, fileA str.LocalRepoPath, fileB str.LocalRepoPath, largeFirst bool) (order int) {
+	order = compareDeploySize(deployFiles, fileA, fileB, largeFirst)
+	if order == 0 {
+		order = cmp.Compare(fileA, fileB)
+	}
+	return
+}
+
+// Size only part of deployment ordering (0 when sizes are equal)
+func compareDeploySize(deployFiles *deployment.HostFiles, fileA str.LocalRepoPath, fileB str.LocalRepoPath, largeFirst bool) (order int) {
+	order = cmp.Compare(deployFiles.GetFileInfo(fileA).FileSize, deployFiles.GetFileInfo(fileB).FileSize)
+	if largeFirst {
+		order = -order
+	}
+	return
+}
+
+// Creates lookup of target path to the repository path that supplies it for this host
+// Files being deleted are only used when nothing else supplies the same target path
+func MapTargetPaths(rawDeploymentFiles []str.LocalRepoPath, deployFiles *deployment.HostFiles) (targetToRepoPath map[str.RemotePath]str.LocalRepoPath) {
+	targetToRepoPath = make(map[str.RemotePath]str.LocalRepoPath)
+	for _, file := range rawDeploymentFiles {
+		info := deployFiles.GetFileInfo(file)
+		if info.TargetFilePath == "" {
+			continue
+		}
+
+		actionIsDelete := info.Action == deployment.ActionDirDelete || info.Action == deployment.ActionFileDelete || info.Action == deployment.ActionSymLinkDelete
+
+		existingPath, alreadyMapped := targetToRepoPath[info.TargetFilePath]
+		if alreadyMapped {
+			existingInfo := deployFiles.GetFileInfo(existingPath)
+			existingIsDelete := existingInfo.Action == deployment.ActionDirDelete || existingInfo.Action == deployment.ActionFileDelete || existingInfo.Action == deployment.ActionSymLinkDelete
+			if actionIsDelete || !existingIsDelete {
+				continue
+			}
+		}
+		targetToRepoPath[info.TargetFilePath] = file
+	}
+	return
+}
+
 // Handles merging dependency trees when they have overlapping reload commands/reload groups
-func MergeDepTrees(depTrees [][]str.LocalRepoPath, deployFiles *deployment.HostFiles) (newDepTrees [][]str.LocalRepoPath) {
+// Merged trees are interleaved by file size (keeping each tree's own order) so size ordering holds across the merged tree
+func MergeDepTrees(depTrees [][]str.LocalRepoPath, deployFiles *deployment.HostFiles, largeFirst bool) (newDepTrees [][]str.LocalRepoPath) {
 	if len(depTrees) == 0 {
 		return [][]str.LocalRepoPath{}
 	}
@@ -192,21 +291,44 @@ func MergeDepTrees(depTrees [][]str.LocalRepoPath, deployFiles *deployment.HostF
 	}
 
 	// Merge found overlaps (maintain overall input order)
-	merged := make(map[int][]str.LocalRepoPath)
+	merged := make(map[int][][]str.LocalRepoPath)
 	seen := make(map[int]bool)
 
 	for treeNum, tree := range depTrees {
 		root := findRoot(treeNum)
-		merged[root] = append(merged[root], tree...)
+		merged[root] = append(merged[root], tree)
 	}
 
 	for treeNum := range depTrees {
 		root := findRoot(treeNum)
 		if !seen[root] {
-			newDepTrees = append(newDepTrees, merged[root])
+			newDepTrees = append(newDepTrees, interleaveTrees(merged[root], deployFiles, largeFirst))
 			seen[root] = true
 		}
 	}
 
 	return
 }
+
+// Combines independent trees into one list, repeatedly taking the next file of whichever tree should go first
+// Each tree keeps its own (dependency) order, equal sizes take from the earliest tree
+func interleaveTrees(trees [][]str.LocalRepoPath, deployFiles *deployment.HostFiles, largeFirst bool) (combined []str.LocalRepoPath) {
+	positions := make([]int, len(trees))
+	for {
+		next := -1
+		for treeIndex, tree := range trees {
+			if positions[treeIndex] >= len(tree) {
+				continue
+			}
+			if next == -1 || compareDeploySize(deployFiles, tree[positions[treeIndex]], trees[next][positions[next]], largeFirst) < 0 {
+				next = treeIndex
+			}
+		}
+		if next == -1 {
+			break
+		}
+		combined = append(combined, trees[next][positions[next]])
+		positions[next]++
+	}
+	return
+}
@@ -2,11 +2,17 @@ package predeploy
 
 import (
 	"scmp/core/deployment"
+	"scmp/internal/logctx"
 	"scmp/internal/str"
+	"slices"
 	"testing"
 )
 
 func TestHandleFileDependencies(t *testing.T) {
+	// Mock Global
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
 	testCases := []struct {
 		name                string
 		hostDeploymentFiles []str.LocalRepoPath
@@ -285,7 +291,7 @@ func TestHandleFileDependencies(t *testing.T) {
 				deployFiles.SetFileMetadata(path, meta)
 			}
 
-			result, err := HandleFileDependencies(test.hostDeploymentFiles, deployFiles)
+			result, err := HandleFileDependencies(ctx, test.hostDeploymentFiles, deployFiles, false)
 
 			// Check: error, output array, and output validity
 			if test.expectedNoOutput && result != nil {
@@ -310,6 +316,145 @@ func TestHandleFileDependencies(t *testing.T) {
 	}
 }
 
+func TestHandleFileDependenciesRemotePaths(t *testing.T) {
+	// Mock Global
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	testCases := []struct {
+		name                 string
+		hostDeploymentFiles  []str.LocalRepoPath
+		testFileMeta         map[str.LocalRepoPath]deployment.FileInfo
+		expected             [][]str.LocalRepoPath
+		expectedDependencies map[str.LocalRepoPath][]str.LocalRepoPath
+	}{
+		{
+			name:                "Remote path supplied by universal directory",
+			hostDeploymentFiles: []str.LocalRepoPath{"host1/etc/nginx/nginx.conf", "UniversalConfs/etc/ssl/certs/internal-ca.crt"},
+			testFileMeta: map[str.LocalRepoPath]deployment.FileInfo{
+				"host1/etc/nginx/nginx.conf": {
+					TargetFilePath: "/etc/nginx/nginx.conf",
+					Action:         deployment.ActionFileModify,
+					Dependencies:   []str.LocalRepoPath{"remote:/etc/ssl/certs/internal-ca.crt"},
+				},
+				"UniversalConfs/etc/ssl/certs/internal-ca.crt": {
+					TargetFilePath: "/etc/ssl/certs/internal-ca.crt",
+					Action:         deployment.ActionFileModify,
+				},
+			},
+			expected: [][]str.LocalRepoPath{
+				{"UniversalConfs/etc/ssl/certs/internal-ca.crt", "host1/etc/nginx/nginx.conf"},
+			},
+			expectedDependencies: map[str.LocalRepoPath][]str.LocalRepoPath{
+				"host1/etc/nginx/nginx.conf": {"UniversalConfs/etc/ssl/certs/internal-ca.crt"},
+			},
+		},
+		{
+			name:                "Remote path supplied by host directory",
+			hostDeploymentFiles: []str.LocalRepoPath{"UniversalConfs/etc/nginx/nginx.conf", "host2/etc/ssl/certs/internal-ca.crt"},
+			testFileMeta: map[str.LocalRepoPath]deployment.FileInfo{
+				"UniversalConfs/etc/nginx/nginx.conf": {
+					TargetFilePath: "/etc/nginx/nginx.conf",
+					Action:         deployment.ActionFileModify,
+					Dependencies:   []str.LocalRepoPath{"remote:/etc/ssl/certs/internal-ca.crt"},
+				},
+				"host2/etc/ssl/certs/internal-ca.crt": {
+					TargetFilePath: "/etc/ssl/certs/internal-ca.crt",
+					Action:         deployment.ActionFileCreate,
+				},
+			},
+			expected: [][]str.LocalRepoPath{
+				{"host2/etc/ssl/certs/internal-ca.crt", "UniversalConfs/etc/nginx/nginx.conf"},
+			},
+			expectedDependencies: map[str.LocalRepoPath][]str.LocalRepoPath{
+				"UniversalConfs/etc/nginx/nginx.conf": {"host2/etc/ssl/certs/internal-ca.crt"},
+			},
+		},
+		{
+			name:                "Remote path prefers created file over deleted file",
+			hostDeploymentFiles: []str.LocalRepoPath{"host3/etc/nginx/nginx.conf", "host3/etc/ssl/certs/internal-ca.crt", "UniversalConfs/etc/ssl/certs/internal-ca.crt"},
+			testFileMeta: map[str.LocalRepoPath]deployment.FileInfo{
+				"host3/etc/nginx/nginx.conf": {
+					TargetFilePath: "/etc/nginx/nginx.conf",
+					Action:         deployment.ActionFileModify,
+					Dependencies:   []str.LocalRepoPath{"remote:/etc/ssl/certs/internal-ca.crt"},
+				},
+				"host3/etc/ssl/certs/internal-ca.crt": {
+					TargetFilePath: "/etc/ssl/certs/internal-ca.crt",
+					Action:         deployment.ActionFileDelete,
+				},
+				"UniversalConfs/etc/ssl/certs/internal-ca.crt": {
+					TargetFilePath: "/etc/ssl/certs/internal-ca.crt",
+					Action:         deployment.ActionFileCreate,
+				},
+			},
+			expected: [][]str.LocalRepoPath{
+				{"UniversalConfs/etc/ssl/certs/internal-ca.crt", "host3/etc/nginx/nginx.conf"},
+				{"host3/etc/ssl/certs/internal-ca.crt"},
+			},
+			expectedDependencies: map[str.LocalRepoPath][]str.LocalRepoPath{
+				"host3/etc/nginx/nginx.conf": {"UniversalConfs/etc/ssl/certs/internal-ca.crt"},
+			},
+		},
+		{
+			name:                "Unresolvable remote path",
+			hostDeploymentFiles: []str.LocalRepoPath{"host4/etc/nginx/nginx.conf", "host4/etc/hosts"},
+			testFileMeta: map[str.LocalRepoPath]deployment.FileInfo{
+				"host4/etc/nginx/nginx.conf": {
+					TargetFilePath: "/etc/nginx/nginx.conf",
+					Action:         deployment.ActionFileModify,
+					Dependencies:   []str.LocalRepoPath{"remote:/etc/ssl/certs/internal-ca.crt", "host4/etc/hosts"},
+				},
+				"host4/etc/hosts": {
+					TargetFilePath: "/etc/hosts",
+					Action:         deployment.ActionFileModify,
+				},
+			},
+			expected: [][]str.LocalRepoPath{
+				{"host4/etc/hosts", "host4/etc/nginx/nginx.conf"},
+			},
+			expectedDependencies: map[str.LocalRepoPath][]str.LocalRepoPath{
+				"host4/etc/nginx/nginx.conf": {"remote:/etc/ssl/certs/internal-ca.crt", "host4/etc/hosts"},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			deployFiles, err := deployment.NewHostFiles()
+			if err != nil {
+				t.Fatalf("failed init host files obj: %v", err)
+			}
+			for path, meta := range test.testFileMeta {
+				meta.RepoFilePath = path
+				deployFiles.SetFileMetadata(path, meta)
+			}
+
+			result, err := HandleFileDependencies(ctx, test.hostDeploymentFiles, deployFiles, false)
+			if err != nil {
+				t.Fatalf("expected no error, got '%v'", err)
+			}
+
+			if len(test.expected) != len(result) {
+				t.Fatalf("expected '%v', got '%v'", test.expected, result)
+			}
+			for resultTreeIndex, resultTree := range result {
+				if !slices.Equal(test.expected[resultTreeIndex], resultTree) {
+					t.Errorf("expected '%v', got '%v'", test.expected, result)
+				}
+			}
+
+			// Host copy of metadata should contain resolved dependencies
+			for path, expectedDeps := range test.expectedDependencies {
+				gotDeps := deployFiles.GetFileInfo(path).Dependencies
+				if !str.CompareArrays(expectedDeps, gotDeps) {
+					t.Errorf("file '%s': expected dependencies '%v', got '%v'", path, expectedDeps, gotDeps)
+				}
+			}
+		})
+	}
+}
+
 func TestMergeDepTrees(t *testing.T) {
 	testCases := []struct {
 		name         string
@@ -582,7 +727,7 @@ func TestMergeDepTrees(t *testing.T) {
 				deployFiles.SetFileMetadata(path, meta)
 			}
 
-			result := MergeDepTrees(test.depTrees, deployFiles)
+			result := MergeDepTrees(test.depTrees, deployFiles, false)
 
 			if len(test.expected) != len(result) {
 				t.Errorf("expected %d independent trees, got %d trees", len(test.expected), len(result))
@@ -598,3 +743,132 @@ func TestMergeDepTrees(t *testing.T) {
 		})
 	}
 }
+
+func TestDeploymentSizeOrdering(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	testCases := []struct {
+		name          string
+		files         []str.LocalRepoPath
+		testFileMeta  map[str.LocalRepoPath]deployment.FileInfo
+		largeFirst    bool
+		expectedTrees [][]str.LocalRepoPath
+	}{
+		{
+			name:  "Same level smallest first",
+			files: []str.LocalRepoPath{"dir", "big", "mid", "small"},
+			testFileMeta: map[str.LocalRepoPath]deployment.FileInfo{
+				"dir":   {},
+				"big":   {FileSize: 5000, Dependencies: []str.LocalRepoPath{"dir"}},
+				"mid":   {FileSize: 300, Dependencies: []str.LocalRepoPath{"dir"}},
+				"small": {FileSize: 10, Dependencies: []str.LocalRepoPath{"dir"}},
+			},
+			expectedTrees: [][]str.LocalRepoPath{{"dir", "small", "mid", "big"}},
+		},
+		{
+			name:  "Same level largest first",
+			files: []str.LocalRepoPath{"dir", "big", "mid", "small"},
+			testFileMeta: map[str.LocalRepoPath]deployment.FileInfo{
+				"dir":   {},
+				"big":   {FileSize: 5000, Dependencies: []str.LocalRepoPath{"dir"}},
+				"mid":   {FileSize: 300, Dependencies: []str.LocalRepoPath{"dir"}},
+				"small": {FileSize: 10, Dependencies: []str.LocalRepoPath{"dir"}},
+			},
+			largeFirst:    true,
+			expectedTrees: [][]str.LocalRepoPath{{"dir", "big", "mid", "small"}},
+		},
+		{
+			name:  "Dependency outranks size",
+			files: []str.LocalRepoPath{"tiny", "huge", "other"},
+			testFileMeta: map[str.LocalRepoPath]deployment.FileInfo{
+				"tiny":  {FileSize: 1, Dependencies: []str.LocalRepoPath{"huge"}},
+				"huge":  {FileSize: 9000},
+				"other": {FileSize: 50, Dependencies: []str.LocalRepoPath{"huge"}},
+			},
+			expectedTrees: [][]str.LocalRepoPath{{"huge", "tiny", "other"}},
+		},
+		{
+			name:  "Equal sizes stay lexicographic",
+			files: []str.LocalRepoPath{"dir", "c", "a", "b"},
+			testFileMeta: map[str.LocalRepoPath]deployment.FileInfo{
+				"dir": {},
+				"c":   {FileSize: 10, Dependencies: []str.LocalRepoPath{"dir"}},
+				"a":   {FileSize: 10, Dependencies: []str.LocalRepoPath{"dir"}},
+				"b":   {FileSize: 10, Dependencies: []str.LocalRepoPath{"dir"}},
+			},
+			largeFirst:    true,
+			expectedTrees: [][]str.LocalRepoPath{{"dir", "a", "b", "c"}},
+		},
+		{
+			name:  "Independent trees by total size",
+			files: []str.LocalRepoPath{"aaaa", "bbbb", "cccc"},
+			testFileMeta: map[str.LocalRepoPath]deployment.FileInfo{
+				"aaaa": {FileSize: 7000},
+				"bbbb": {FileSize: 20},
+				"cccc": {FileSize: 300},
+			},
+			expectedTrees: [][]str.LocalRepoPath{{"bbbb"}, {"cccc"}, {"aaaa"}},
+		},
+		{
+			name:  "Reload group kept together and interleaved by size",
+			files: []str.LocalRepoPath{"artifact", "conf", "confdep", "unrelated"},
+			testFileMeta: map[str.LocalRepoPath]deployment.FileInfo{
+				"artifact":  {FileSize: 8000, ReloadGroup: "service", ReloadRequired: true, Reload: []string{"systemctl restart service"}},
+				"conf":      {FileSize: 200, ReloadGroup: "service"},
+				"confdep":   {FileSize: 100, ReloadGroup: "service", Dependencies: []str.LocalRepoPath{"conf"}},
+				"unrelated": {FileSize: 50},
+			},
+			expectedTrees: [][]str.LocalRepoPath{{"unrelated"}, {"conf", "confdep", "artifact"}},
+		},
+		{
+			name:  "Reload group kept together largest first",
+			files: []str.LocalRepoPath{"artifact", "conf", "confdep", "unrelated"},
+			testFileMeta: map[str.LocalRepoPath]deployment.FileInfo{
+				"artifact":  {FileSize: 8000, ReloadGroup: "service", ReloadRequired: true, Reload: []string{"systemctl restart service"}},
+				"conf":      {FileSize: 200, ReloadGroup: "service"},
+				"confdep":   {FileSize: 100, ReloadGroup: "service", Dependencies: []str.LocalRepoPath{"conf"}},
+				"unrelated": {FileSize: 50},
+			},
+			largeFirst:    true,
+			expectedTrees: [][]str.LocalRepoPath{{"artifact", "conf", "confdep"}, {"unrelated"}},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			deployFiles, err := deployment.NewHostFiles()
+			if err != nil {
+				t.Fatalf("failed init host files obj: %v", err)
+			}
+			for path, meta := range test.testFileMeta {
+				deployFiles.SetFileMetadata(path, meta)
+			}
+
+			depTrees, err := HandleFileDependencies(ctx, test.files, deployFiles, test.largeFirst)
+			if err != nil {
+				t.Fatalf("expected no error, got '%v'", err)
+			}
+			result := MergeDepTrees(depTrees, deployFiles, test.largeFirst)
+
+			if len(result) != len(test.expectedTrees) {
+				t.Fatalf("expected trees '%v', got '%v'", test.expectedTrees, result)
+			}
+			for treeIndex, tree := range result {
+				if !slices.Equal(tree, test.expectedTrees[treeIndex]) {
+					t.Errorf("expected trees '%v', got '%v'", test.expectedTrees, result)
+				}
+
+				// Every dependency in the tree must deploy before the file needing it
+				for position, file := range tree {
+					for _, dependency := range test.testFileMeta[file].Dependencies {
+						dependencyPosition := slices.Index(tree, dependency)
+						if dependencyPosition == -1 || dependencyPosition > position {
+							t.Errorf("file '%s' ordered before its dependency '%s' in '%v'", file, dependency, tree)
+						}
+					}
+				}
+			}
+		})
+	}
+}
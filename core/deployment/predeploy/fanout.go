@@ -0,0 +1,105 @@
+package predeploy
+
+import (
+	"context"
+	"os"
+	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"sort"
+	"strings"
+)
+
+// Hosts receiving a single universal file and why they receive it
+type UniversalFanout struct {
+	Group  str.RepoRootDir   // Universal directory the file is in
+	Reason string            // Why hosts are receiving files from the directory
+	Hosts  []str.RepoRootDir // Sorted list of receiving hosts
+}
+
+// Finds every universal (non-host) file in the deployment and the hosts that will receive it
+func MapUniversalFanout(ctx context.Context, hostDeploymentFiles map[str.RepoRootDir][]str.LocalRepoPath) (fanout map[str.LocalRepoPath]UniversalFanout) {
+	config := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	fanout = make(map[str.LocalRepoPath]UniversalFanout)
+	for endpointName, files := range hostDeploymentFiles {
+		for _, file := range files {
+			hostAndPath := strings.SplitN(string(file), string(os.PathSeparator), 2)
+			fileRootDir := str.RepoRootDir(hostAndPath[0])
+
+			// Host specific files only ever go to one host
+			_, fileIsHostFile := config.HostInfo[fileRootDir]
+			if fileIsHostFile {
+				continue
+			}
+
+			fileFanout, fileTracked := fanout[file]
+			if !fileTracked {
+				fileFanout.Group = fileRootDir
+				if fileRootDir == config.UniversalDirectory {
+					fileFanout.Reason = "universal directory (all hosts not ignoring universal)"
+				} else {
+					fileFanout.Reason = "group tag '" + string(fileRootDir) + "'"
+				}
+			}
+			fileFanout.Hosts = append(fileFanout.Hosts, endpointName)
+			fanout[file] = fileFanout
+		}
+	}
+
+	for file, fileFanout := range fanout {
+		sort.Slice(fileFanout.Hosts, func(i, j int) bool {
+			return fileFanout.Hosts[i] < fileFanout.Hosts[j]
+		})
+		fanout[file] = fileFanout
+	}
+	return
+}
+
+// Returns universal files (sorted) that will be deployed to more hosts than the threshold
+// Threshold of 0 disables the check
+func FanoutExceedsThreshold(fanout map[str.LocalRepoPath]UniversalFanout, threshold int) (exceedingFiles []str.LocalRepoPath) {
+	if threshold <= 0 {
+		return
+	}
+
+	for file, fileFanout := range fanout {
+		if len(fileFanout.Hosts) > threshold {
+			exceedingFiles = append(exceedingFiles, file)
+		}
+	}
+	sort.Slice(exceedingFiles, func(i, j int) bool {
+		return exceedingFiles[i] < exceedingFiles[j]
+	})
+	return
+}
+
+// Print out receiving hosts for each universal file
+func PrintUniversalFanout(ctx context.Context, fanout map[str.LocalRepoPath]UniversalFanout) {
+	if len(fanout) == 0 {
+		return
+	}
+
+	files := make([]str.LocalRepoPath, 0, len(fanout))
+	for file := range fanout {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i] < files[j]
+	})
+
+	logctx.LogStdInfo(ctx, "Universal file fanout:\n")
+	for _, file := range files {
+		fileFanout := fanout[file]
+		logctx.LogStdInfo(ctx, "  %s -> %d host(s) via %s\n", file, len(fileFanout.Hosts), fileFanout.Reason)
+
+		// Only summarize when list would be too long to read
+		if len(fileFanout.Hosts) > deployment.FanoutHostListLimit {
+			continue
+		}
+		logctx.LogStdInfo(ctx, "       %s\n", str.Join(fileFanout.Hosts, ", "))
+	}
+	logctx.LogStdInfo(ctx, "\n")
+}
@@ -0,0 +1,81 @@
+package predeploy
+
+import (
+	"context"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+	"testing"
+)
+
+func TestMapUniversalFanout(t *testing.T) {
+	// Mock Global
+	config := config.Config{
+		HostInfo: map[str.RepoRootDir]config.EndpointInfo{
+			"host1": {},
+			"host2": {},
+			"host3": {},
+		},
+		UniversalDirectory: "UniversalConfs",
+	}
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.ConfKey, config)
+
+	hostDeploymentFiles := map[str.RepoRootDir][]str.LocalRepoPath{
+		"host1": {"host1/etc/hosts", "UniversalConfs/etc/resolv.conf", "UniversalConfs_NGINX/etc/nginx/nginx.conf"},
+		"host2": {"UniversalConfs/etc/resolv.conf"},
+		"host3": {"UniversalConfs/etc/resolv.conf", "UniversalConfs_NGINX/etc/nginx/nginx.conf"},
+	}
+
+	fanout := MapUniversalFanout(ctx, hostDeploymentFiles)
+
+	expected := map[str.LocalRepoPath]UniversalFanout{
+		"UniversalConfs/etc/resolv.conf": {
+			Group:  "UniversalConfs",
+			Reason: "universal directory (all hosts not ignoring universal)",
+			Hosts:  []str.RepoRootDir{"host1", "host2", "host3"},
+		},
+		"UniversalConfs_NGINX/etc/nginx/nginx.conf": {
+			Group:  "UniversalConfs_NGINX",
+			Reason: "group tag 'UniversalConfs_NGINX'",
+			Hosts:  []str.RepoRootDir{"host1", "host3"},
+		},
+	}
+
+	if len(fanout) != len(expected) {
+		t.Fatalf("expected %d universal files, got %d: %v", len(expected), len(fanout), fanout)
+	}
+	for file, expectedFanout := range expected {
+		fileFanout, fileTracked := fanout[file]
+		if !fileTracked {
+			t.Errorf("expected file '%s' in fanout, but it was missing", file)
+			continue
+		}
+		if fileFanout.Group != expectedFanout.Group || fileFanout.Reason != expectedFanout.Reason {
+			t.Errorf("file '%s': expected group '%s' reason '%s', got group '%s' reason '%s'",
+				file, expectedFanout.Group, expectedFanout.Reason, fileFanout.Group, fileFanout.Reason)
+		}
+		if !slices.Equal(fileFanout.Hosts, expectedFanout.Hosts) {
+			t.Errorf("file '%s': expected hosts '%v', got '%v'", file, expectedFanout.Hosts, fileFanout.Hosts)
+		}
+	}
+
+	tests := []struct {
+		threshold int
+		expected  []str.LocalRepoPath
+	}{
+		{threshold: 0, expected: nil},
+		{threshold: 1, expected: []str.LocalRepoPath{"UniversalConfs/etc/resolv.conf", "UniversalConfs_NGINX/etc/nginx/nginx.conf"}},
+		{threshold: 2, expected: []str.LocalRepoPath{"UniversalConfs/etc/resolv.conf"}},
+		{threshold: 3, expected: nil},
+	}
+	for _, test := range tests {
+		exceedingFiles := FanoutExceedsThreshold(fanout, test.threshold)
+		if !slices.Equal(exceedingFiles, test.expected) {
+			t.Errorf("threshold %d: expected '%v', got '%v'", test.threshold, test.expected, exceedingFiles)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package predeploy
 import (
 	"context"
 	"encoding/base64"
+	"fmt"
+	"maps"
 	"os"
 	"scmp/core/deployment"
 	"scmp/internal/config"
@@ -10,37 +12,70 @@ import (
 	"scmp/internal/logctx"
 	"scmp/internal/parsing"
 	"scmp/internal/str"
+	"slices"
 	"strings"
 )
 
-// Record universal files that are NOT to be used for each host (host has an override file)
-func MapDeniedUniversalFiles(ctx context.Context, allHostsFiles map[str.RepoRootDir]map[str.RemotePath]struct{}, universalFiles map[str.RepoRootDir]map[str.RemotePath]struct{}) (deniedUniversalFiles map[str.RepoRootDir]map[str.LocalRepoPath]struct{}) {
+// Record universal files that are NOT to be used for each host (host has an override file or a higher precedence group has the same file)
+// Precedence: host directory, then groups in GroupPriority order (or the hosts GroupTags order), then the universal directory
+// Two groups of equal precedence containing the same file path cannot be resolved and return an error naming both files
+func MapDeniedUniversalFiles(ctx context.Context, allHostsFiles map[str.RepoRootDir]map[str.RemotePath]struct{}, universalFiles map[str.RepoRootDir]map[str.RemotePath]struct{}) (deniedUniversalFiles map[str.RepoRootDir]map[str.LocalRepoPath]struct{}, err error) {
 	config := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
 
 	// Initialize map
 	deniedUniversalFiles = make(map[str.RepoRootDir]map[str.LocalRepoPath]struct{})
 
+	// Stable group order so conflicts are always reported identically
+	groupNames := slices.Sorted(maps.Keys(universalFiles))
+
 	// Created denied map for each host in config
-	for endpointName := range config.HostInfo {
+	for _, endpointName := range slices.Sorted(maps.Keys(config.HostInfo)) {
+		hostInfo := config.HostInfo[endpointName]
+
 		// Initialize inner map
 		deniedUniversalFiles[endpointName] = make(map[str.LocalRepoPath]struct{})
 
+		// Group currently selected for each file path of this host
+		selectedGroups := make(map[str.RemotePath]str.RepoRootDir)
+
 		// Find overlaps between group files and host files - record overlapping group files in denied map
-		for groupName, groupFiles := range universalFiles {
+		for _, groupName := range groupNames {
 			// Skip groups not applicable to this host
-			_, hostIsInFilesUniversalGroup := config.HostInfo[endpointName].UniversalGroups[groupName]
+			_, hostIsInFilesUniversalGroup := hostInfo.UniversalGroups[groupName]
 			if !hostIsInFilesUniversalGroup && groupName != config.UniversalDirectory {
 				continue
 			}
 
 			// Find overlap files
-			for groupFile := range groupFiles {
+			for groupFile := range universalFiles[groupName] {
+				deniedFilePath := str.FilePathJoin(str.LocalRepoPath(groupName), str.LocalRepoPath(groupFile))
+
 				_, hostHasUniversalOverride := allHostsFiles[endpointName][groupFile]
 				if hostHasUniversalOverride {
 					// Host has a file path that is also present in the group universal dir
 					// Should never deploy group universal files if host has an identical file path
-					deniedFilePath := str.FilePathJoin(str.LocalRepoPath(groupName), str.LocalRepoPath(groupFile))
 					deniedUniversalFiles[endpointName][deniedFilePath] = struct{}{}
+					continue
+				}
+
+				selectedGroup, pathIsSelected := selectedGroups[groupFile]
+				if !pathIsSelected {
+					selectedGroups[groupFile] = groupName
+					continue
+				}
+
+				selectedFilePath := str.FilePathJoin(str.LocalRepoPath(selectedGroup), str.LocalRepoPath(groupFile))
+				selectedRank := groupRank(config, hostInfo, selectedGroup)
+				fileRank := groupRank(config, hostInfo, groupName)
+				switch {
+				case fileRank < selectedRank:
+					deniedUniversalFiles[endpointName][selectedFilePath] = struct{}{}
+					selectedGroups[groupFile] = groupName
+				case fileRank > selectedRank:
+					deniedUniversalFiles[endpointName][deniedFilePath] = struct{}{}
+				default:
+					err = fmt.Errorf("host '%s': files '%s' and '%s' are in groups of equal precedence (order the groups with GroupPriority)", endpointName, selectedFilePath, deniedFilePath)
+					return
 				}
 			}
 		}
@@ -49,9 +84,58 @@ func MapDeniedUniversalFiles(ctx context.Context, allHostsFiles map[str.RepoRoot
 	return
 }
 
+// Precedence of a universal group for a host, lower ranks take precedence
+// Groups missing from GroupPriority (or from the hosts GroupTags) share the rank after all listed groups, the universal directory is always last
+func groupRank(cfg config.Config, hostInfo config.EndpointInfo, groupName str.RepoRootDir) (rank int) {
+	groupOrder := hostInfo.GroupOrder
+	if len(cfg.GroupPriority) > 0 {
+		groupOrder = cfg.GroupPriority
+	}
+
+	if groupName == cfg.UniversalDirectory {
+		rank = len(groupOrder) + 1
+		return
+	}
+
+	rank = slices.Index(groupOrder, groupName)
+	if rank < 0 {
+		rank = len(groupOrder)
+	}
+	return
+}
+
+// Ensures hosts explicitly requested for deployment have a directory in the repository
+// Hosts only present in the SSH config (usable with exec/scp) cannot be deployment targets
+func ValidateHostDirectories(ctx context.Context, hostList map[str.RepoRootDir]config.EndpointInfo, hostOverride string, allHostsFiles map[str.RepoRootDir]map[str.RemotePath]struct{}) (err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	// Regex choices cannot be checked against individual directories
+	if hostOverride == "" || opts.RegexEnabled {
+		return
+	}
+
+	for userChoice := range strings.SplitSeq(hostOverride, ",") {
+		hostName := str.RepoRootDir(strings.TrimSpace(userChoice))
+
+		// Only hosts in the list are relevant (universal groups and unknown names are handled by host filtering)
+		_, choiceIsHost := hostList[hostName]
+		if !choiceIsHost {
+			continue
+		}
+
+		_, hostHasDirectory := allHostsFiles[hostName]
+		if !hostHasDirectory {
+			err = fmt.Errorf("host '%s' has no '%s%c' directory in the root of the repository (hosts without a repository directory can only be used with exec and scp)",
+				hostName, hostName, os.PathSeparator)
+			return
+		}
+	}
+	return
+}
+
 // Uses host list and deployment files to create list of files and hosts specific to deployment
 // Also deduplicates host and universal to ensure host override files don't get clobbered
-func FilterHostsAndFiles(ctx context.Context, hostList map[str.RepoRootDir]config.EndpointInfo, deniedUniversalFiles map[str.RepoRootDir]map[str.LocalRepoPath]struct{}, commitFiles map[str.LocalRepoPath]str.DeployAction, hostOverride string) (allDeploymentHosts []str.RepoRootDir, allDeploymentFiles map[str.LocalRepoPath]str.DeployAction, hostDeploymentFiles map[str.RepoRootDir][]str.LocalRepoPath) {
+func FilterHostsAndFiles(ctx context.Context, skipped *deployment.SkipReport, hostList map[str.RepoRootDir]config.EndpointInfo, deniedUniversalFiles map[str.RepoRootDir]map[str.LocalRepoPath]struct{}, commitFiles map[str.LocalRepoPath]str.DeployAction, hostOverride string) (allDeploymentHosts []str.RepoRootDir, allDeploymentFiles map[str.LocalRepoPath]str.DeployAction, hostDeploymentFiles map[str.RepoRootDir][]str.LocalRepoPath) {
 	ctx = logctx.AppendCtxTag(ctx, logctx.NSParsing)
 
 	// Show progress to user
@@ -94,7 +178,8 @@ func FilterHostsAndFiles(ctx context.Context, hostList map[str.RepoRootDir]confi
 			// Skip if commitFile is a universal file that is not allowed for this host
 			_, fileIsDenied := hostsDeniedUniversalFiles[commitFile]
 			if fileIsDenied {
-				logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "        File is universal and host has non-universal identical file\n")
+				logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "        File is universal and host has an identical file of higher precedence\n")
+				skipped.Add(deployment.SkipDeniedUniversal, commitFile)
 				continue
 			}
 
@@ -117,6 +202,36 @@ func FilterHostsAndFiles(ctx context.Context, hostList map[str.RepoRootDir]confi
 	return
 }
 
+// Removes malformed files (left out of forced deployments) from each hosts file list and the deployment hosts
+// Hosts left without files are not deployed to, the returned malformed files per host are still reported for them
+func DropMalformedFiles(malformedFiles []MalformedFile, allDeploymentHosts []str.RepoRootDir, hostDeploymentFiles map[str.RepoRootDir][]str.LocalRepoPath) (remainingHosts []str.RepoRootDir, hostMalformedFiles map[str.RepoRootDir][]MalformedFile) {
+	hostMalformedFiles = make(map[str.RepoRootDir][]MalformedFile)
+	if len(malformedFiles) == 0 {
+		remainingHosts = allDeploymentHosts
+		return
+	}
+
+	for _, endpointName := range allDeploymentHosts {
+		hostDeploymentFiles[endpointName] = slices.DeleteFunc(hostDeploymentFiles[endpointName], func(repoFilePath str.LocalRepoPath) bool {
+			index := slices.IndexFunc(malformedFiles, func(malformed MalformedFile) bool {
+				return malformed.RepoFilePath == repoFilePath
+			})
+			if index == -1 {
+				return false
+			}
+			hostMalformedFiles[endpointName] = append(hostMalformedFiles[endpointName], malformedFiles[index])
+			return true
+		})
+
+		if len(hostDeploymentFiles[endpointName]) == 0 {
+			delete(hostDeploymentFiles, endpointName)
+			continue
+		}
+		remainingHosts = append(remainingHosts, endpointName)
+	}
+	return
+}
+
 func CreateReloadGroups(fileList []str.LocalRepoPath, deployFiles *deployment.HostFiles) (groupedDeployList *deployment.FileGroup) {
 	groupedDeployList = deployment.NewFileGroup(fileList)
 
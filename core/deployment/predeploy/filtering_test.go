@@ -2,12 +2,15 @@ package predeploy
 
 import (
 	"context"
+	"errors"
+	"maps"
 	"scmp/core/deployment"
 	"scmp/internal/config"
 	"scmp/internal/global"
 	"scmp/internal/logctx"
 	"scmp/internal/str"
 	"slices"
+	"strings"
 	"testing"
 )
 
@@ -71,7 +74,10 @@ func TestMapDeniedUniversalFiles(t *testing.T) {
 	}
 
 	// Call the function under test
-	deniedUniversalFiles := MapDeniedUniversalFiles(ctx, allHostsFiles, universalFiles)
+	deniedUniversalFiles, err := MapDeniedUniversalFiles(ctx, allHostsFiles, universalFiles)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 
 	// Expected result
 	expectedDeniedFiles := map[str.RepoRootDir]map[str.LocalRepoPath]struct{}{
@@ -104,6 +110,87 @@ func TestMapDeniedUniversalFiles(t *testing.T) {
 	}
 }
 
+func TestMapDeniedUniversalFilesPrecedence(t *testing.T) {
+	hostInfo := map[str.RepoRootDir]config.EndpointInfo{
+		"host1": {
+			UniversalGroups: map[str.RepoRootDir]struct{}{"Group_A": {}, "Group_B": {}, "UniversalConfs": {}},
+			GroupOrder:      []str.RepoRootDir{"Group_B", "Group_A"},
+		},
+		"host2": {
+			UniversalGroups: map[str.RepoRootDir]struct{}{"Group_A": {}, "Group_B": {}, "Group_C": {}, "UniversalConfs": {}},
+			GroupOrder:      []str.RepoRootDir{"Group_A", "Group_B", "Group_C"},
+		},
+	}
+	allHostsFiles := map[str.RepoRootDir]map[str.RemotePath]struct{}{
+		"host1": {"etc/host.conf": {}},
+		"host2": {},
+	}
+	universalFiles := map[str.RepoRootDir]map[str.RemotePath]struct{}{
+		"UniversalConfs": {"etc/shared.conf": {}, "etc/host.conf": {}},
+		"Group_A":        {"etc/shared.conf": {}, "etc/host.conf": {}},
+		"Group_B":        {"etc/shared.conf": {}},
+		"Group_C":        {"etc/shared.conf": {}},
+	}
+
+	tests := []struct {
+		name           string
+		groupPriority  []str.RepoRootDir
+		expectedDenied map[str.RepoRootDir][]str.LocalRepoPath
+		expectedError  string
+	}{
+		{
+			name: "GroupTags order",
+			expectedDenied: map[str.RepoRootDir][]str.LocalRepoPath{
+				"host1": {"Group_A/etc/host.conf", "Group_A/etc/shared.conf", "UniversalConfs/etc/host.conf", "UniversalConfs/etc/shared.conf"},
+				"host2": {"Group_B/etc/shared.conf", "Group_C/etc/shared.conf", "UniversalConfs/etc/host.conf", "UniversalConfs/etc/shared.conf"},
+			},
+		},
+		{
+			name:          "GroupPriority order",
+			groupPriority: []str.RepoRootDir{"Group_C", "Group_A", "Group_B"},
+			expectedDenied: map[str.RepoRootDir][]str.LocalRepoPath{
+				"host1": {"Group_A/etc/host.conf", "Group_B/etc/shared.conf", "UniversalConfs/etc/host.conf", "UniversalConfs/etc/shared.conf"},
+				"host2": {"Group_A/etc/shared.conf", "Group_B/etc/shared.conf", "UniversalConfs/etc/host.conf", "UniversalConfs/etc/shared.conf"},
+			},
+		},
+		{
+			name:          "Equal precedence",
+			groupPriority: []str.RepoRootDir{"Group_C"},
+			expectedError: "host 'host1': files 'Group_A/etc/shared.conf' and 'Group_B/etc/shared.conf' are in groups of equal precedence",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := t.Context()
+			ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+			ctx = context.WithValue(ctx, global.ConfKey, config.Config{
+				HostInfo:           hostInfo,
+				UniversalDirectory: "UniversalConfs",
+				GroupPriority:      test.groupPriority,
+			})
+
+			deniedUniversalFiles, err := MapDeniedUniversalFiles(ctx, allHostsFiles, universalFiles)
+			if test.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+					t.Fatalf("expected error containing '%s', got %v", test.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for host, expectedFiles := range test.expectedDenied {
+				deniedFiles := slices.Sorted(maps.Keys(deniedUniversalFiles[host]))
+				if !slices.Equal(deniedFiles, expectedFiles) {
+					t.Errorf("host %s: expected denied files %v, got %v", host, expectedFiles, deniedFiles)
+				}
+			}
+		})
+	}
+}
+
 func TestFilterHostsAndFiles(t *testing.T) {
 	// Mock ctx
 	ctx := t.Context()
@@ -272,7 +359,7 @@ func TestFilterHostsAndFiles(t *testing.T) {
 	for _, test := range testCases {
 		t.Run(test.name, func(t *testing.T) {
 			// Call the function under test
-			allDeploymentHosts, allDeploymentFiles, filesByHost := FilterHostsAndFiles(ctx, hostInfo, test.deniedUniversalFiles, test.commitFiles, test.hostOverride)
+			allDeploymentHosts, allDeploymentFiles, filesByHost := FilterHostsAndFiles(ctx, nil, hostInfo, test.deniedUniversalFiles, test.commitFiles, test.hostOverride)
 
 			// Validate the hosts
 			if len(allDeploymentHosts) != len(test.expectedHosts) {
@@ -307,6 +394,31 @@ func TestFilterHostsAndFiles(t *testing.T) {
 	}
 }
 
+func TestDropMalformedFiles(t *testing.T) {
+	malformedFiles := []MalformedFile{
+		{RepoFilePath: "UniversalConfs/etc/bad.conf", Action: deployment.ActionFileModify, Err: errors.New("json end delimiter missing")},
+		{RepoFilePath: "host2/etc/only.conf", Action: deployment.ActionFileCreate, Err: errors.New("json start delimiter missing")},
+	}
+	hostDeploymentFiles := map[str.RepoRootDir][]str.LocalRepoPath{
+		"host1": {"host1/etc/good.conf", "UniversalConfs/etc/bad.conf"},
+		"host2": {"host2/etc/only.conf", "UniversalConfs/etc/bad.conf"},
+	}
+
+	remainingHosts, hostMalformedFiles := DropMalformedFiles(malformedFiles, []str.RepoRootDir{"host1", "host2"}, hostDeploymentFiles)
+	if !slices.Equal(remainingHosts, []str.RepoRootDir{"host1"}) {
+		t.Errorf("expected only host1 to remain, got %v", remainingHosts)
+	}
+	if !slices.Equal(hostDeploymentFiles["host1"], []str.LocalRepoPath{"host1/etc/good.conf"}) {
+		t.Errorf("expected malformed file removed from host1, got %v", hostDeploymentFiles["host1"])
+	}
+	if _, hasHost := hostDeploymentFiles["host2"]; hasHost {
+		t.Errorf("expected host2 without remaining files to be removed")
+	}
+	if len(hostMalformedFiles["host1"]) != 1 || len(hostMalformedFiles["host2"]) != 2 {
+		t.Errorf("expected malformed files reported per host, got %+v", hostMalformedFiles)
+	}
+}
+
 func TestCreateReloadGroups(t *testing.T) {
 	testCases := []struct {
 		name             string
@@ -652,3 +764,49 @@ func TestCreateReloadGroups(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateHostDirectories(t *testing.T) {
+	// Mock Global
+	cfg := config.Config{
+		HostInfo: map[str.RepoRootDir]config.EndpointInfo{
+			"host1": {},
+			"lab01": {}, // SSH config only host
+		},
+		UniversalDirectory: "UniversalConfs",
+	}
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.ConfKey, cfg)
+
+	allHostsFiles := map[str.RepoRootDir]map[str.RemotePath]struct{}{
+		"host1": {
+			"etc/hosts": {},
+		},
+	}
+
+	tests := []struct {
+		hostOverride  string
+		regexEnabled  bool
+		expectedError string
+	}{
+		{hostOverride: ""},
+		{hostOverride: "host1"},
+		{hostOverride: "UniversalConfs"},
+		{hostOverride: "lab0.*", regexEnabled: true},
+		{hostOverride: "lab01", expectedError: "host 'lab01' has no 'lab01/' directory in the root of the repository"},
+		{hostOverride: "host1, lab01", expectedError: "host 'lab01' has no 'lab01/' directory in the root of the repository"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.hostOverride, func(t *testing.T) {
+			ctx := context.WithValue(ctx, global.OpsKey, config.Opts{RegexEnabled: test.regexEnabled})
+
+			err := ValidateHostDirectories(ctx, cfg.HostInfo, test.hostOverride, allHostsFiles)
+			if test.expectedError == "" && err != nil {
+				t.Errorf("expected no error, got '%v'", err)
+			} else if test.expectedError != "" && (err == nil || !strings.Contains(err.Error(), test.expectedError)) {
+				t.Errorf("expected error containing '%s', got '%v'", test.expectedError, err)
+			}
+		})
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/global"
 	"scmp/internal/logctx"
 	"scmp/internal/str"
+	"slices"
 )
 
 // Creates a host files map that contains copies of the global data for per-host/per-file contextual mutation
@@ -37,29 +40,46 @@ func GroupByHost(ctx context.Context, globalFiles *deployment.AllFiles, hostDepl
 
 // Takes the per-host file object and creates ordered (dependency resolved) and grouped deployment list inside HostFiles object
 func SortFiles(ctx context.Context, allHostFiles map[str.RepoRootDir]*deployment.HostFiles) (err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
 	ctx = logctx.AppendCtxTag(ctx, logctx.NSParsing)
 
 	for host, hostFiles := range allHostFiles {
 		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Host: %s: Handling dependencies\n", host)
 
-		// Reorder deployment list into independent trees and by dependencies
-		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Reordering files based on inter-file dependencies\n")
-		var depTrees [][]str.LocalRepoPath
-		depTrees, err = HandleFileDependencies(hostFiles.GetUnorderedList(), hostFiles)
+		// Phases deploy one after another, files are only ordered and grouped against files of their own phase
+		var phaseFiles map[string][]str.LocalRepoPath
+		phaseFiles, err = partitionPhases(hostFiles)
 		if err != nil {
+			err = fmt.Errorf("host %s: %w", host, err)
 			return
 		}
 
-		// Merge dependency trees to ensure similar reloads/reload groups get deployed in the same thread
-		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "  Merging dependency trees based on reload groups/commands\n")
-		depTrees = MergeDepTrees(depTrees, hostFiles)
+		for _, phase := range deployment.Phases {
+			if len(phaseFiles[phase]) == 0 {
+				continue
+			}
+
+			// Reorder deployment list into independent trees and by dependencies
+			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Reordering files of phase '%s' based on inter-file dependencies\n", phase)
+			var depTrees [][]str.LocalRepoPath
+			depTrees, err = HandleFileDependencies(ctx, phaseFiles[phase], hostFiles, opts.LargeFilesFirst)
+			if err != nil {
+				return
+			}
 
-		// Identify reload groups by command and similar commands - used to coordinate when to reload during deployment
-		for _, depTree := range depTrees {
-			logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "Grouping config files by reload commands\n")
-			independentDeploymentList := CreateReloadGroups(depTree, hostFiles)
+			// Merge dependency trees to ensure similar reloads/reload groups get deployed in the same thread
+			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "  Merging dependency trees based on reload groups/commands\n")
+			depTrees = MergeDepTrees(depTrees, hostFiles, opts.LargeFilesFirst)
 
-			hostFiles.Groups = append(hostFiles.Groups, independentDeploymentList)
+			// Identify reload groups by command and similar commands - used to coordinate when to reload during deployment
+			for _, depTree := range depTrees {
+				logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "Grouping config files by reload commands\n")
+				independentDeploymentList := CreateReloadGroups(depTree, hostFiles)
+				independentDeploymentList.SetPhase(phase)
+
+				hostFiles.Groups = append(hostFiles.Groups, independentDeploymentList)
+			}
 		}
 
 		// Group and set post-installation commands per reload group
@@ -83,6 +103,37 @@ func SortFiles(ctx context.Context, allHostFiles map[str.RepoRootDir]*deployment
 	return
 }
 
+// Splits host files by deployment phase, a file may only depend on files of its own or an earlier phase
+func partitionPhases(hostFiles *deployment.HostFiles) (phaseFiles map[string][]str.LocalRepoPath, err error) {
+	phaseFiles = make(map[string][]str.LocalRepoPath)
+
+	hostFileList := hostFiles.GetUnorderedList()
+	filePhase := make(map[str.LocalRepoPath]string, len(hostFileList))
+	for _, repoFilePath := range hostFileList {
+		phase := hostFiles.GetFileInfo(repoFilePath).Phase
+		if phase == "" {
+			phase = deployment.PhaseConfigure
+		}
+		filePhase[repoFilePath] = phase
+		phaseFiles[phase] = append(phaseFiles[phase], repoFilePath)
+	}
+
+	for _, repoFilePath := range hostFileList {
+		for _, dependency := range hostFiles.GetFileInfo(repoFilePath).Dependencies {
+			dependencyPhase, inDeployment := filePhase[dependency]
+			if !inDeployment {
+				continue
+			}
+			if slices.Index(deployment.Phases, dependencyPhase) > slices.Index(deployment.Phases, filePhase[repoFilePath]) {
+				err = fmt.Errorf("file '%s' of phase '%s' depends on '%s' of later phase '%s'",
+					repoFilePath, filePhase[repoFilePath], dependency, dependencyPhase)
+				return
+			}
+		}
+	}
+	return
+}
+
 // Removes any deletions when the same (target) file path is being created in the same deployment.
 // Prevents potential issues when a file is moved from a host-specific directory to a Universal directory (would cause delete then create).
 func removeRedundantDeletions(ctx context.Context, hostFiles *deployment.HostFiles) (err error) {
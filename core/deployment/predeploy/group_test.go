@@ -1,10 +1,14 @@
 package predeploy
 
 import (
+	"context"
 	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/global"
 	"scmp/internal/logctx"
 	"scmp/internal/str"
 	"slices"
+	"strings"
 	"testing"
 )
 
@@ -123,3 +127,70 @@ func TestRemoveRedundantDeletions(t *testing.T) {
 		})
 	}
 }
+
+func TestSortFilesPhases(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.OpsKey, config.Opts{})
+
+	newHost := func(files map[str.LocalRepoPath]deployment.FileInfo) (allHostFiles map[str.RepoRootDir]*deployment.HostFiles) {
+		hostFiles, err := deployment.NewHostFiles()
+		if err != nil {
+			t.Fatalf("unexpected hostfiles create failure: %v", err)
+		}
+		for repoFilePath, info := range files {
+			info.RepoFilePath = repoFilePath
+			info.TargetFilePath = str.RemotePath(strings.TrimPrefix(string(repoFilePath), "host1"))
+			hostFiles.SetFileMetadata(repoFilePath, info)
+		}
+		allHostFiles = map[str.RepoRootDir]*deployment.HostFiles{"host1": hostFiles}
+		return
+	}
+
+	t.Run("groups ordered by phase", func(t *testing.T) {
+		allHostFiles := newHost(map[str.LocalRepoPath]deployment.FileInfo{
+			"host1/verify.sh":    {Hash: "a", Phase: deployment.PhaseVerify, Dependencies: []str.LocalRepoPath{"host1/etc/app.conf"}},
+			"host1/etc/app.conf": {Hash: "b", ReloadRequired: true, Reload: []string{"systemctl restart app"}},
+			"host1/etc/app.env":  {Hash: "c", Phase: deployment.PhaseConfigure, ReloadRequired: true, Reload: []string{"systemctl restart app"}},
+			"host1/restart.sh":   {Hash: "d", Phase: deployment.PhaseActivate, ReloadRequired: true, Reload: []string{"systemctl restart app"}},
+			"host1/packages":     {Hash: "e", Phase: deployment.PhaseInstall},
+		})
+
+		err := SortFiles(ctx, allHostFiles)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var phases []string
+		var groupFiles [][]str.LocalRepoPath
+		for _, group := range allHostFiles["host1"].Groups {
+			phases = append(phases, group.GetPhase())
+			files := group.GetOrderedList()
+			slices.Sort(files)
+			groupFiles = append(groupFiles, files)
+		}
+		expectedPhases := []string{deployment.PhaseInstall, deployment.PhaseConfigure, deployment.PhaseActivate, deployment.PhaseVerify}
+		if !slices.Equal(phases, expectedPhases) {
+			t.Fatalf("expected group phases %v, got %v", expectedPhases, phases)
+		}
+		// Shared reload commands only merge files of the same phase
+		if !slices.Equal(groupFiles[1], []str.LocalRepoPath{"host1/etc/app.conf", "host1/etc/app.env"}) {
+			t.Errorf("expected configure files grouped together, got %v", groupFiles[1])
+		}
+		if !slices.Equal(groupFiles[2], []str.LocalRepoPath{"host1/restart.sh"}) {
+			t.Errorf("expected activate file in its own group, got %v", groupFiles[2])
+		}
+	})
+
+	t.Run("dependency on later phase", func(t *testing.T) {
+		allHostFiles := newHost(map[str.LocalRepoPath]deployment.FileInfo{
+			"host1/packages":     {Hash: "a", Phase: deployment.PhaseInstall, Dependencies: []str.LocalRepoPath{"host1/etc/app.conf"}},
+			"host1/etc/app.conf": {Hash: "b"},
+		})
+
+		err := SortFiles(ctx, allHostFiles)
+		if err == nil || !strings.Contains(err.Error(), "later phase 'configure'") {
+			t.Errorf("expected later phase dependency error, got %v", err)
+		}
+	})
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"scmp/core/deployment"
+	"scmp/core/deployment/accounts"
+	fsContent "scmp/core/filesystem/content"
 	"scmp/core/filesystem/metadata"
 	"scmp/internal/config"
 	"scmp/internal/crypto"
@@ -13,63 +16,86 @@ import (
 	"scmp/internal/global"
 	"scmp/internal/logctx"
 	"scmp/internal/parsing"
+	"scmp/internal/secrets"
+	"scmp/internal/sshinternal"
 	"scmp/internal/str"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
 // Retrieves all file content for this deployment
+// Files are looked up in the git tree in path order (tree lookups are not concurrent safe), their content is read concurrently
+// The first failing file (in path order) is reported
 func LoadGitFileContent(ctx context.Context, allDeploymentFiles map[str.LocalRepoPath]str.DeployAction, tree *object.Tree) (rawFileContent map[str.LocalRepoPath][]byte, err error) {
 	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Loading files for deployment... \n")
 
-	rawFileContent = make(map[str.LocalRepoPath][]byte)
-
-	for repoFilePath, commitFileAction := range allDeploymentFiles {
+	var repoFilePaths []str.LocalRepoPath
+	var repoFiles []*object.File
+	for _, repoFilePath := range slices.Sorted(maps.Keys(allDeploymentFiles)) {
+		commitFileAction := allDeploymentFiles[repoFilePath]
 		if commitFileAction == deployment.ActionFileDelete ||
 			commitFileAction == deployment.ActionDirDelete ||
 			commitFileAction == deployment.ActionSymLinkDelete {
 			continue
 		}
 
-		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "  Loading repository file %s\n", repoFilePath)
-
 		// Get file from git tree
 		file, lerr := tree.File(string(repoFilePath))
 		if lerr != nil {
-			err = fmt.Errorf("failed retrieving file information from git tree: %w", lerr)
+			err = fmt.Errorf("failed retrieving file information from git tree for '%s': %w", repoFilePath, lerr)
 			return
 		}
+		repoFilePaths = append(repoFilePaths, repoFilePath)
+		repoFiles = append(repoFiles, file)
+	}
 
-		reader, lerr := file.Reader()
-		if lerr != nil {
-			err = fmt.Errorf("failed retrieving file reader: %w", lerr)
-			return
-		}
-		defer func() {
-			lerr := reader.Close()
-			if err == nil && lerr != nil {
-				err = lerr
-			}
-		}()
+	contents, err := runWorkerPool(ctx, repoFiles, loadGitFile)
+	if err != nil {
+		return
+	}
 
-		content, lerr := io.ReadAll(reader)
-		if lerr != nil {
-			err = fmt.Errorf("failed reading file content: %w", lerr)
-			return
-		}
+	rawFileContent = make(map[str.LocalRepoPath][]byte, len(repoFilePaths))
+	for index, repoFilePath := range repoFilePaths {
+		rawFileContent[repoFilePath] = contents[index]
+	}
+	return
+}
 
-		rawFileContent[repoFilePath] = content
+// Reads the content of a single file from the git object storage
+func loadGitFile(ctx context.Context, file *object.File) (content []byte, err error) {
+	logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "  Loading repository file %s\n", file.Name)
+
+	reader, err := file.Reader()
+	if err != nil {
+		err = fmt.Errorf("failed retrieving file reader for '%s': %w", file.Name, err)
+		return
 	}
+	defer func() {
+		lerr := reader.Close()
+		if err == nil && lerr != nil {
+			err = lerr
+		}
+	}()
 
+	content, err = io.ReadAll(reader)
+	if err != nil {
+		err = fmt.Errorf("failed reading file content of '%s': %w", file.Name, err)
+		return
+	}
 	return
 }
 
 // Loads artifact file contents and uses hash in pointer file
-func loadArtifactContent(artifactPath string, artifactPointerPath str.LocalRepoPath, artifactPointerContent []byte, deployFiles *deployment.AllFiles) (content []byte, trackedHash str.FileID, err error) {
-	// Only allow file URIs for now
-	if !strings.HasPrefix(artifactPath, global.FileURIPrefix) {
-		err = fmt.Errorf("remote-artifact file '%s': must use '%s' before file paths in 'ExternalContentLocation' field", artifactPointerPath, global.FileURIPrefix)
+// Remote artifacts (http, https, s3) are downloaded into the local artifact cache first
+// Artifacts larger than the stream threshold are left on disk and returned as a streamed content location instead
+func loadArtifactContent(ctx context.Context, artifactPath string, artifactPointerPath str.LocalRepoPath, artifactPointerContent []byte, streamThreshold int64, deployFiles *deployment.AllFiles) (content []byte, stream deployment.StreamedContent, trackedHash str.FileID, err error) {
+	remoteArtifact := fsContent.IsRemoteArtifact(artifactPath)
+	if !remoteArtifact && !strings.HasPrefix(artifactPath, global.FileURIPrefix) {
+		err = fmt.Errorf("remote-artifact file '%s': must use '%s', '%s', '%s', or '%s' before locations in 'ExternalContentLocation' field",
+			artifactPointerPath, global.FileURIPrefix, global.HTTPURIPrefix, global.HTTPSURIPrefix, global.S3URIPrefix)
 		return
 	}
 
@@ -81,10 +107,24 @@ func loadArtifactContent(artifactPath string, artifactPointerPath str.LocalRepoP
 	}
 	trackedHash = str.FileID(hash)
 
-	// Retrieve artifact file data if not already loaded
-	if !deployFiles.AlreadyLoaded(trackedHash) {
+	// Reuse artifact content already loaded by another pointer file (keeps file size accurate)
+	if deployFiles.AlreadyLoaded(trackedHash) {
+		content = deployFiles.GetFileData(trackedHash)
+		stream, _ = deployFiles.GetFileStream(trackedHash)
+		return
+	}
+
+	var artifactFileName string
+	if remoteArtifact {
+		// Downloads are verified against the tracked hash before they are cached
+		artifactFileName, err = fetchArtifact(ctx, artifactPath, trackedHash)
+		if err != nil {
+			err = fmt.Errorf("remote-artifact file '%s': %w", artifactPointerPath, err)
+			return
+		}
+	} else {
 		// Not adhering to actual URI standards -- I just want file paths
-		artifactFileName := strings.TrimPrefix(artifactPath, global.FileURIPrefix)
+		artifactFileName = strings.TrimPrefix(artifactPath, global.FileURIPrefix)
 		artifactFileName, err = fsops.ExpandHomeDirectory(artifactFileName)
 		if err != nil {
 			err = fmt.Errorf("failed to resolve absolute path for '%s': %w", artifactFileName, err)
@@ -104,91 +144,326 @@ func loadArtifactContent(artifactPath string, artifactPointerPath str.LocalRepoP
 				artifactFileName, trackedHash[:16], actualHash[:16])
 			return
 		}
+	}
 
-		// Retrieve artifact file contents
-		content, err = os.ReadFile(artifactFileName)
-		if err != nil {
-			return
+	artifactInfo, lerr := os.Stat(artifactFileName)
+	if lerr != nil {
+		err = fmt.Errorf("failed to retrieve artifact file size: %w", lerr)
+		return
+	}
+	if artifactInfo.Size() > streamThreshold {
+		stream = deployment.StreamedContent{
+			LocalPath: artifactFileName,
+			Size:      artifactInfo.Size(),
 		}
+		return
+	}
+
+	// Retrieve artifact file contents
+	content, err = os.ReadFile(artifactFileName)
+	if err != nil {
+		return
 	}
 	return
 }
 
+// Vault password shared by all files parsed in one deployment, asked for once the first encrypted file is parsed
+type contentKeyLoader struct {
+	mutex sync.Mutex
+	key   []byte
+	err   error
+}
+
+// Unlocks the content key on first use, concurrent callers wait for (and share) the first result
+func (loader *contentKeyLoader) get(ctx context.Context) (contentKey []byte, err error) {
+	loader.mutex.Lock()
+	defer loader.mutex.Unlock()
+	if loader.key == nil && loader.err == nil {
+		loader.key, loader.err = secrets.UnlockContentKey(ctx)
+	}
+	contentKey, err = loader.key, loader.err
+	return
+}
+
+// Serializes loads of the same artifact location, different artifacts load concurrently
+type artifactLocks struct {
+	mutex sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// Locks the artifact location until the returned function is called
+func (artifacts *artifactLocks) lock(location string) (unlock func()) {
+	artifacts.mutex.Lock()
+	if artifacts.locks == nil {
+		artifacts.locks = make(map[string]*sync.Mutex)
+	}
+	locationLock, exists := artifacts.locks[location]
+	if !exists {
+		locationLock = &sync.Mutex{}
+		artifacts.locks[location] = locationLock
+	}
+	artifacts.mutex.Unlock()
+
+	locationLock.Lock()
+	unlock = locationLock.Unlock
+	return
+}
+
+// Parsed form of a single repository file
+type parsedFile struct {
+	info      deployment.FileInfo
+	content   []byte
+	stream    deployment.StreamedContent
+	warnings  []string
+	headerErr error // Metadata header could not be parsed, collected instead of stopping the other files
+}
+
+// File left out of a forced deployment because its metadata header could not be parsed
+type MalformedFile struct {
+	RepoFilePath str.LocalRepoPath
+	Action       str.DeployAction
+	Err          error
+}
+
 // Parses loaded file content and retrieves needed metadata
+// Files are parsed and hashed concurrently, the first failing file (in path order) is reported
+// Malformed metadata headers are collected across all files and reported together, with --force those files are left out instead
 // Return vales provide the content keyed on local file path for the file data, metadata, hashes, and actions
-func ParseFileContent(ctx context.Context, allDeploymentFiles map[str.LocalRepoPath]str.DeployAction, rawFileContent map[str.LocalRepoPath][]byte) (deployFiles *deployment.AllFiles, err error) {
+func ParseFileContent(ctx context.Context, allDeploymentFiles map[str.LocalRepoPath]str.DeployAction, rawFileContent map[str.LocalRepoPath][]byte) (deployFiles *deployment.AllFiles, malformedFiles []MalformedFile, err error) {
 	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
 	ctx = logctx.AppendCtxTag(ctx, logctx.NSParsing)
 	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Parsing files for deployment... \n")
 
 	// Initialize maps
 	deployFiles = deployment.NewAllFiles()
 
-	// Load file contents, metadata, hashes, and actions into their own maps
-	for repoFilePath, commitFileAction := range allDeploymentFiles {
+	// Vault password is only asked for once the first encrypted file is parsed
+	contentKey := &contentKeyLoader{}
+
+	// Pointer files of the same artifact load it one at a time, later pointers reuse the loaded content
+	artifacts := &artifactLocks{}
+
+	// Actions that do not require content loading are recorded directly, the rest is parsed by the worker pool
+	var repoFilePaths []str.LocalRepoPath
+	for _, repoFilePath := range slices.Sorted(maps.Keys(allDeploymentFiles)) {
+		commitFileAction := allDeploymentFiles[repoFilePath]
 		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Parsing repository file %s\n", repoFilePath)
 		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Marked as '%s'\n", commitFileAction)
 
-		// Actions that do not require content loading
-		if commitFileAction == deployment.ActionFileDelete ||
-			commitFileAction == deployment.ActionDirDelete ||
-			commitFileAction == deployment.ActionSymLinkDelete {
+		switch commitFileAction {
+		case deployment.ActionFileDelete, deployment.ActionDirDelete, deployment.ActionSymLinkDelete:
 			// Add it to the deploy target files so it can be deleted during ssh
 			_, deletedFilePath := parsing.TranslateLocalPathtoRemotePath(cfg.RepositoryPath, repoFilePath)
 			deployFiles.AddMetadata(repoFilePath, deployment.FileInfo{Action: commitFileAction, RepoFilePath: repoFilePath, TargetFilePath: deletedFilePath})
-			continue
-		}
-		switch commitFileAction {
 		case deployment.ActionDirCreate, deployment.ActionDirModify:
+			repoFilePaths = append(repoFilePaths, repoFilePath)
 		case deployment.ActionFileCreate, deployment.ActionFileModify:
+			repoFilePaths = append(repoFilePaths, repoFilePath)
 		case deployment.ActionSymLinkCreate, deployment.ActionSymLinkModify:
+			repoFilePaths = append(repoFilePaths, repoFilePath)
+		case deployment.ActionAccountsApply:
+			// Plain JSON without a metadata header, applied before any file of the host
+			var parsed parsedFile
+			parsed, err = parseAccountsFile(opts, repoFilePath, rawFileContent[repoFilePath])
+			if err != nil {
+				return
+			}
+			if parsed.headerErr != nil {
+				malformedFiles = append(malformedFiles, MalformedFile{RepoFilePath: repoFilePath, Action: commitFileAction, Err: parsed.headerErr})
+				continue
+			}
+			deployFiles.AddMetadata(repoFilePath, parsed.info)
+			deployFiles.StoreDataOnce(parsed.info.Hash, parsed.content)
 		default:
 			// Skip unsupported file types - safety blocker
+		}
+	}
+
+	parsedFiles, err := runWorkerPool(ctx, repoFilePaths, func(ctx context.Context, repoFilePath str.LocalRepoPath) (parsed parsedFile, err error) {
+		parsed, err = parseRepoFile(ctx, cfg, repoFilePath, allDeploymentFiles[repoFilePath], rawFileContent[repoFilePath], contentKey, artifacts, deployFiles)
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	// Results are recorded in path order so warnings and stored content do not depend on scheduling
+	for index, parsed := range parsedFiles {
+		if parsed.headerErr != nil {
+			repoFilePath := repoFilePaths[index]
+			malformedFiles = append(malformedFiles, MalformedFile{RepoFilePath: repoFilePath, Action: allDeploymentFiles[repoFilePath], Err: parsed.headerErr})
 			continue
 		}
 
-		content := rawFileContent[repoFilePath]
+		for _, warning := range parsed.warnings {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog, "File '%s': suspicious metadata: %s\n", parsed.info.RepoFilePath, warning)
+		}
+
+		deployFiles.AddMetadata(parsed.info.RepoFilePath, parsed.info)
 
-		// Retrieve metadata depending on if this is a directory or a file
-		jsonMetadata, fileContent, lerr := metadata.Extract(string(content))
-		if lerr != nil {
-			err = fmt.Errorf("file '%s': failed to separate metadata from file content: %w", repoFilePath, lerr)
+		// Put file content into map (only applies to file(s))
+		if parsed.stream.LocalPath != "" {
+			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Artifact for '%s' is %d bytes, streaming from disk during transfer\n", parsed.info.RepoFilePath, parsed.stream.Size)
+			deployFiles.StoreStreamOnce(parsed.info.Hash, parsed.stream)
+		} else if len(parsed.content) > 0 {
+			deployFiles.StoreDataOnce(parsed.info.Hash, parsed.content)
+		}
+	}
+
+	// Every malformed header is reported at once, so a single run shows everything that needs fixing
+	if len(malformedFiles) > 0 {
+		slices.SortFunc(malformedFiles, func(a, b MalformedFile) int {
+			return strings.Compare(string(a.RepoFilePath), string(b.RepoFilePath))
+		})
+		report := formatMalformedFiles(malformedFiles)
+
+		if !opts.ForceEnabled || deployFiles.IsEmpty() {
+			err = fmt.Errorf("%w in %d file(s):\n%s", deployment.ErrMalformedHeader, len(malformedFiles), report)
 			return
 		}
+		logctx.LogStdWarn(ctx, "Skipping %d file(s) with a malformed metadata header:\n%s\n", len(malformedFiles), report)
+	}
 
-		// Retrieve actual artifact contents and hash
-		var contentIdentifier str.FileID
-		if len(jsonMetadata.ExternalContentLocation) > 0 {
-			fileContent, contentIdentifier, err = loadArtifactContent(jsonMetadata.ExternalContentLocation, repoFilePath, fileContent, deployFiles)
-			if err != nil {
-				err = fmt.Errorf("failed to load artifact file content: %w", err)
-				return
+	// Guard against empty return value
+	if deployFiles.IsEmpty() {
+		err = fmt.Errorf("something went wrong, no files available to load")
+		return
+	}
+
+	return
+}
+
+// One indented line per malformed file
+func formatMalformedFiles(malformedFiles []MalformedFile) (report string) {
+	var lines []string
+	for _, malformed := range malformedFiles {
+		lines = append(lines, fmt.Sprintf("  %s: %v", malformed.RepoFilePath, malformed.Err))
+	}
+	report = strings.Join(lines, "\n")
+	return
+}
+
+// Separates, validates, and decrypts the metadata and content of a single file and hashes the deployed content
+// Only file content to be deployed is returned (never link or directory content)
+func parseRepoFile(ctx context.Context, cfg config.Config, repoFilePath str.LocalRepoPath, commitFileAction str.DeployAction, content []byte, contentKey *contentKeyLoader, artifacts *artifactLocks, deployFiles *deployment.AllFiles) (parsed parsedFile, err error) {
+	// Retrieve metadata depending on if this is a directory or a file
+	// Header errors are kept with the parsed file instead of returned, so the other files keep parsing
+	jsonMetadata, fileContent, lerr := metadata.Extract(string(content))
+	if lerr != nil {
+		parsed.headerErr = lerr
+		return
+	}
+
+	// Header fields used as remote command arguments must never carry shell syntax
+	lerr = metadata.Validate(jsonMetadata)
+	if lerr != nil {
+		parsed.headerErr = fmt.Errorf("unsafe metadata header: %w", lerr)
+		return
+	}
+	parsed.warnings = metadata.Lint(jsonMetadata)
+
+	// Only known backup styles can be requested by file
+	switch jsonMetadata.BackupStyle {
+	case "", sshinternal.BackupStyleCentral, sshinternal.BackupStyleSibling, sshinternal.BackupStyleSuffix, sshinternal.BackupStyleArchive:
+	default:
+		parsed.headerErr = fmt.Errorf("invalid BackupStyle '%s' in metadata header", jsonMetadata.BackupStyle)
+		return
+	}
+
+	// Remote receives (and is compared against) the plain text, the repository only ever holds cipher text
+	if jsonMetadata.Encrypted {
+		var key []byte
+		key, err = contentKey.get(ctx)
+		if err != nil {
+			err = fmt.Errorf("file '%s': failed to unlock encrypted content: %w", repoFilePath, err)
+			return
+		}
+		fileContent, err = secrets.DecryptContent(fileContent, key)
+		if err != nil {
+			err = fmt.Errorf("file '%s': %w", repoFilePath, err)
+			return
+		}
+	}
+
+	// Only file content is deployed
+	isSymLink := jsonMetadata.SymbolicLinkTarget != ""
+	deployableContent := !isSymLink && (commitFileAction == deployment.ActionFileCreate || commitFileAction == deployment.ActionFileModify)
+
+	// Retrieve actual artifact contents and hash
+	// Symbolic links only have a target, any content section is never hashed or deployed
+	var contentIdentifier str.FileID
+	if isSymLink {
+		fileContent = nil
+	} else if len(jsonMetadata.ExternalContentLocation) > 0 {
+		unlock := artifacts.lock(jsonMetadata.ExternalContentLocation)
+		fileContent, parsed.stream, contentIdentifier, err = loadArtifactContent(ctx, jsonMetadata.ExternalContentLocation, repoFilePath, fileContent, cfg.StreamThreshold, deployFiles)
+		if err == nil && deployableContent {
+			// Recorded right away so other pointer files to this artifact reuse it
+			if parsed.stream.LocalPath != "" {
+				deployFiles.StoreStreamOnce(contentIdentifier, parsed.stream)
+			} else if len(fileContent) > 0 {
+				deployFiles.StoreDataOnce(contentIdentifier, fileContent)
 			}
-		} else if len(fileContent) > 0 {
+		}
+		unlock()
+		if err != nil {
+			err = fmt.Errorf("failed to load artifact file content: %w", err)
+			return
+		}
+	} else {
+		// Hash reflects the deployed form of the content
+		if commitFileAction == deployment.ActionFileCreate || commitFileAction == deployment.ActionFileModify {
+			fileContent = metadata.NormalizeContent(fileContent, metadata.EffectiveNormalization(jsonMetadata, cfg.Normalization))
+		}
+
+		if len(fileContent) > 0 {
 			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Hashing file '%s' content\n", repoFilePath)
 
 			// Hash the metadata-less contents
 			contentIdentifier = str.FileID(crypto.SHA256Sum(fileContent))
-		} else if len(fileContent) == 0 {
+		} else {
 			contentIdentifier = deployment.EmptyFileHash
 		}
+	}
 
-		// Put all metadata gathered into map
-		metadata := jsonToFileInfo(ctx, repoFilePath, jsonMetadata, len(fileContent), commitFileAction, contentIdentifier)
-		deployFiles.AddMetadata(repoFilePath, metadata)
+	fileSize := len(fileContent)
+	if parsed.stream.LocalPath != "" {
+		fileSize = int(parsed.stream.Size)
+	}
 
-		// Put file content into map (only applies to file(s))
-		if len(fileContent) > 0 &&
-			(commitFileAction == deployment.ActionFileCreate || commitFileAction == deployment.ActionFileModify) {
-			deployFiles.StoreDataOnce(contentIdentifier, fileContent)
-		}
+	// Put all metadata gathered into map
+	parsed.info = jsonToFileInfo(ctx, repoFilePath, jsonMetadata, fileSize, commitFileAction, contentIdentifier)
+
+	if deployableContent {
+		parsed.content = fileContent
+	} else {
+		parsed.stream = deployment.StreamedContent{}
 	}
+	return
+}
 
-	// Guard against empty return value
-	if deployFiles.IsEmpty() {
-		err = fmt.Errorf("something went wrong, no files available to load")
+// Validates a user metadata file, its content is deployed as is (removals need both deletion options)
+// No remote path is written, so the item has no target path
+// Unparsable content is returned as the files header error like malformed metadata headers
+func parseAccountsFile(opts config.Opts, repoFilePath str.LocalRepoPath, content []byte) (parsed parsedFile, err error) {
+	spec, lerr := accounts.Parse(content)
+	if lerr != nil {
+		parsed.headerErr = lerr
+		return
+	}
+	if spec.HasRemovals() && !(opts.AllowDeletions && opts.AllowUserDeletions) {
+		err = fmt.Errorf("user metadata file '%s': users or groups marked Absent require both --allow-deletions and --allow-user-deletions", repoFilePath)
 		return
 	}
 
+	parsed.info = deployment.FileInfo{
+		Action:       deployment.ActionAccountsApply,
+		RepoFilePath: repoFilePath,
+		Hash:         str.FileID(crypto.SHA256Sum(content)),
+		FileSize:     len(content),
+		Phase:        deployment.PhaseAccounts,
+	}
+	parsed.content = content
 	return
 }
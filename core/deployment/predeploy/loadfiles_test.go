@@ -2,20 +2,32 @@ package predeploy
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"scmp/core/deployment"
 	"scmp/core/filesystem"
 	"scmp/internal/config"
+	"scmp/internal/crypto"
 	"scmp/internal/global"
 	"scmp/internal/logctx"
 	"scmp/internal/str"
 	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
 func TestParseFileContent(t *testing.T) {
 	ctx := t.Context()
 	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.OpsKey, config.Opts{})
 
 	config := config.Config{
 		RepositoryPath: "/opt/repo",
@@ -112,6 +124,15 @@ more data here`),
   "Preapply": [
     "ss -taplnu | grep 443"
   ],
+  "PreChecks": [
+    "df --output=avail /var/www"
+  ],
+  "Checks": [
+    "nginx -t"
+  ],
+  "PostChecks": [
+    "php-fpm8.3 -t"
+  ],
   "Reload": [
     "systemctl restart php8.3-fpm",
 	"systemctl is-active php8.3-fpm"
@@ -132,6 +153,8 @@ more data here`),
 					Install:          []string{"apt-get install nginx -y"},
 					PreapplyRequired: true,
 					Preapply:         []string{"ss -taplnu | grep 443"},
+					PreChecks:        []string{"df --output=avail /var/www"},
+					PostChecks:       []string{"nginx -t", "php-fpm8.3 -t"},
 					ReloadRequired:   true,
 					Reload:           []string{"systemctl restart php8.3-fpm", "systemctl is-active php8.3-fpm"},
 				},
@@ -157,6 +180,59 @@ more data here`),
 			expectedallFileData: map[str.FileID][]byte{},
 			expectedErr:         false,
 		},
+		{
+			name: "Symbolic link input",
+			allDeploymentFiles: map[str.LocalRepoPath]str.DeployAction{
+				"host1/etc/nginx/sites-enabled/site1": deployment.ActionFileModify,
+			},
+			rawFileContent: map[str.LocalRepoPath][]byte{
+				"host1/etc/nginx/sites-enabled/site1": []byte(`#|^^^|#
+{
+  "FileOwnerGroup": "root:root",
+  "FilePermissions": 777,
+  "SymbolicLinkTarget": "/etc/nginx/sites-available/site1"
+}
+#|^^^|#
+stray content
+`),
+			},
+			expectedallFileMeta: map[str.LocalRepoPath]deployment.FileInfo{
+				"host1/etc/nginx/sites-enabled/site1": {
+					RepoFilePath:   "host1/etc/nginx/sites-enabled/site1",
+					TargetFilePath: "/etc/nginx/sites-enabled/site1",
+					Action:         deployment.ActionSymLinkModify,
+					OwnerGroup:     "root:root",
+					Permissions:    777,
+					LinkTarget:     "/etc/nginx/sites-available/site1",
+				},
+			},
+			expectedallFileData: map[str.FileID][]byte{},
+			expectedErr:         false,
+		},
+		{
+			name: "Normalized content hash",
+			allDeploymentFiles: map[str.LocalRepoPath]str.DeployAction{
+				"host1/etc/crlf.conf": deployment.ActionFileModify,
+			},
+			rawFileContent: map[str.LocalRepoPath][]byte{
+				"host1/etc/crlf.conf": []byte("#|^^^|#\n{\n  \"FileOwnerGroup\": \"root:root\",\n  \"FilePermissions\": 644,\n  \"Normalize\": {\"eol\": \"crlf\", \"ensureTrailingNewline\": true}\n}\n#|^^^|#\nline1\r\nline2"),
+			},
+			expectedallFileMeta: map[str.LocalRepoPath]deployment.FileInfo{
+				"host1/etc/crlf.conf": {
+					Hash:           str.FileID(crypto.SHA256Sum([]byte("line1\r\nline2\r\n"))),
+					RepoFilePath:   "host1/etc/crlf.conf",
+					TargetFilePath: "/etc/crlf.conf",
+					Action:         deployment.ActionFileModify,
+					OwnerGroup:     "root:root",
+					Permissions:    644,
+					FileSize:       14,
+				},
+			},
+			expectedallFileData: map[str.FileID][]byte{
+				str.FileID(crypto.SHA256Sum([]byte("line1\r\nline2\r\n"))): []byte("line1\r\nline2\r\n"),
+			},
+			expectedErr: false,
+		},
 		{
 			name:                "No input",
 			allDeploymentFiles:  map[str.LocalRepoPath]str.DeployAction{},
@@ -169,7 +245,7 @@ more data here`),
 
 	for _, test := range testCases {
 		t.Run(test.name, func(t *testing.T) {
-			deployFiles, err := ParseFileContent(ctx, test.allDeploymentFiles, test.rawFileContent)
+			deployFiles, _, err := ParseFileContent(ctx, test.allDeploymentFiles, test.rawFileContent)
 
 			if err != nil && !test.expectedErr {
 				t.Fatalf("Expected no error - but got error '%v'", err)
@@ -195,3 +271,333 @@ more data here`),
 		})
 	}
 }
+
+func TestLoadArtifactContentStreaming(t *testing.T) {
+	artifactContent := []byte("artifact binary content")
+	artifactPath := filepath.Join(t.TempDir(), "artifact.bin")
+	err := os.WriteFile(artifactPath, artifactContent, 0600)
+	if err != nil {
+		t.Fatalf("failed writing artifact: %v", err)
+	}
+	artifactHash := str.FileID(crypto.SHA256Sum(artifactContent))
+	pointerContent := []byte(artifactHash)
+
+	tests := []struct {
+		name            string
+		streamThreshold int64
+		expectStreamed  bool
+	}{
+		{"below threshold", int64(len(artifactContent)), false},
+		{"above threshold", int64(len(artifactContent)) - 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deployFiles := deployment.NewAllFiles()
+
+			content, stream, trackedHash, err := loadArtifactContent(t.Context(), global.FileURIPrefix+artifactPath, "host1/opt/app.bin.remote-artifact", pointerContent, test.streamThreshold, deployFiles)
+			if err != nil {
+				t.Fatalf("expected no error, got '%v'", err)
+			}
+			if trackedHash != artifactHash {
+				t.Errorf("expected hash '%s', got '%s'", artifactHash, trackedHash)
+			}
+
+			if test.expectStreamed {
+				if content != nil || stream.LocalPath != artifactPath || stream.Size != int64(len(artifactContent)) {
+					t.Fatalf("expected streamed content at '%s', got content '%s' and stream '%+v'", artifactPath, content, stream)
+				}
+				deployFiles.StoreStreamOnce(trackedHash, stream)
+			} else {
+				if !slices.Equal(content, artifactContent) || stream.LocalPath != "" {
+					t.Fatalf("expected loaded content, got content '%s' and stream '%+v'", content, stream)
+				}
+				deployFiles.StoreDataOnce(trackedHash, content)
+			}
+
+			// Other pointer files to the same artifact reuse what was already loaded
+			reusedContent, reusedStream, _, err := loadArtifactContent(t.Context(), global.FileURIPrefix+artifactPath, "host2/opt/app.bin.remote-artifact", pointerContent, test.streamThreshold, deployFiles)
+			if err != nil {
+				t.Fatalf("expected no error, got '%v'", err)
+			}
+			if !slices.Equal(reusedContent, content) || reusedStream != stream {
+				t.Errorf("expected reused content and stream, got content '%s' and stream '%+v'", reusedContent, reusedStream)
+			}
+		})
+	}
+}
+
+func TestParseFileContentDefaultNormalization(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.ConfKey, config.Config{
+		RepositoryPath: "/opt/repo",
+		Normalization:  config.Normalization{EnsureTrailingNewline: true, StripTrailingWhitespace: true},
+	})
+	ctx = context.WithValue(ctx, global.OpsKey, config.Opts{})
+
+	const header string = "#|^^^|#\n{\"FileOwnerGroup\": \"root:root\", \"FilePermissions\": 644%s}\n#|^^^|#\n"
+	allDeploymentFiles := map[str.LocalRepoPath]str.DeployAction{
+		"host1/etc/default.conf":  deployment.ActionFileCreate,
+		"host1/etc/override.conf": deployment.ActionFileCreate,
+	}
+	rawFileContent := map[str.LocalRepoPath][]byte{
+		"host1/etc/default.conf":  []byte(fmt.Sprintf(header, "") + "key = value  \r\nother = 1"),
+		"host1/etc/override.conf": []byte(fmt.Sprintf(header, `, "Normalize": {}`) + "key = value  \r\nother = 1"),
+	}
+	expectedContent := map[str.LocalRepoPath]string{
+		"host1/etc/default.conf":  "key = value\nother = 1\n",
+		"host1/etc/override.conf": "key = value  \nother = 1",
+	}
+
+	deployFiles, _, err := ParseFileContent(ctx, allDeploymentFiles, rawFileContent)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for repoFilePath, expected := range expectedContent {
+		info := deployFiles.GetFileInfo(repoFilePath)
+		if info.Hash != str.FileID(crypto.SHA256Sum([]byte(expected))) {
+			t.Errorf("%s: hash does not match normalized content %q", repoFilePath, expected)
+		}
+		if string(deployFiles.GetFileData(info.Hash)) != expected {
+			t.Errorf("%s: expected content %q, got %q", repoFilePath, expected, deployFiles.GetFileData(info.Hash))
+		}
+	}
+}
+
+func TestParseFileContentAccounts(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.ConfKey, config.Config{RepositoryPath: "/opt/repo"})
+
+	repoFilePath := str.LocalRepoPath("host1/" + filesystem.UserMetaFileName)
+	content := []byte(`{"Groups": [{"Name": "app", "GID": 901}], "Users": [{"Name": "app", "Group": "app", "Home": "/srv/app", "System": true}, {"Name": "olduser", "Absent": true}]}`)
+	allDeploymentFiles := map[str.LocalRepoPath]str.DeployAction{repoFilePath: deployment.ActionAccountsApply}
+	rawFileContent := map[str.LocalRepoPath][]byte{repoFilePath: content}
+
+	// Removals need both deletion options
+	for _, opts := range []config.Opts{{}, {AllowDeletions: true}, {AllowUserDeletions: true}} {
+		_, _, err := ParseFileContent(context.WithValue(ctx, global.OpsKey, opts), allDeploymentFiles, rawFileContent)
+		if err == nil {
+			t.Errorf("expected users marked Absent to be refused with options %+v", opts)
+		}
+	}
+
+	ctx = context.WithValue(ctx, global.OpsKey, config.Opts{AllowDeletions: true, AllowUserDeletions: true})
+	deployFiles, _, err := ParseFileContent(ctx, allDeploymentFiles, rawFileContent)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	info := deployFiles.GetFileInfo(repoFilePath)
+	if info.Action != deployment.ActionAccountsApply || info.Phase != deployment.PhaseAccounts || info.TargetFilePath != "" {
+		t.Errorf("unexpected accounts item: %+v", info)
+	}
+	if string(deployFiles.GetFileData(info.Hash)) != string(content) {
+		t.Errorf("expected user metadata content to be kept as is")
+	}
+
+	rawFileContent[repoFilePath] = []byte(`{"Users": [{"Name": "app", "Shel": "/bin/sh"}]}`)
+	_, _, err = ParseFileContent(ctx, allDeploymentFiles, rawFileContent)
+	if !errors.Is(err, deployment.ErrMalformedHeader) {
+		t.Errorf("expected unknown user metadata field to be refused as malformed, got %v", err)
+	}
+}
+
+func TestParseFileContentMalformedHeaders(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.ConfKey, config.Config{RepositoryPath: "/opt/repo"})
+
+	const validHeader string = "#|^^^|#\n{\"FileOwnerGroup\": \"root:root\", \"FilePermissions\": 644}\n#|^^^|#\ncontent\n"
+	allDeploymentFiles := map[str.LocalRepoPath]str.DeployAction{
+		"host1/etc/good.conf":                  deployment.ActionFileCreate,
+		"host1/etc/comma.conf":                 deployment.ActionFileModify,
+		"host1/etc/unterminated.conf":          deployment.ActionFileCreate,
+		"host1/etc/type.conf":                  deployment.ActionFileModify,
+		"host1/etc/backup.conf":                deployment.ActionFileCreate,
+		"host1/" + filesystem.UserMetaFileName: deployment.ActionAccountsApply,
+	}
+	rawFileContent := map[str.LocalRepoPath][]byte{
+		"host1/etc/good.conf":                  []byte(validHeader),
+		"host1/etc/comma.conf":                 []byte("#|^^^|#\n{\n  \"FileOwnerGroup\": \"root:root\"\n  \"FilePermissions\": 644\n}\n#|^^^|#\ncontent\n"),
+		"host1/etc/unterminated.conf":          []byte("#|^^^|#\n{\"FileOwnerGroup\": \"root:root\", \"FilePermissions\": 644}\ncontent\n"),
+		"host1/etc/type.conf":                  []byte("#|^^^|#\n{\n  \"FileOwnerGroup\": \"root:root\",\n  \"FilePermissions\": \"644\"\n}\n#|^^^|#\ncontent\n"),
+		"host1/etc/backup.conf":                []byte("#|^^^|#\n{\"FileOwnerGroup\": \"root:root\", \"FilePermissions\": 644, \"BackupStyle\": \"nearby\"}\n#|^^^|#\ncontent\n"),
+		"host1/" + filesystem.UserMetaFileName: []byte(`{"Users": [{"Name": "app",}]}`),
+	}
+	expectedMalformed := []str.LocalRepoPath{
+		"host1/" + filesystem.UserMetaFileName,
+		"host1/etc/backup.conf",
+		"host1/etc/comma.conf",
+		"host1/etc/type.conf",
+		"host1/etc/unterminated.conf",
+	}
+
+	// Every malformed file is reported in one error
+	_, malformedFiles, err := ParseFileContent(context.WithValue(ctx, global.OpsKey, config.Opts{}), allDeploymentFiles, rawFileContent)
+	if !errors.Is(err, deployment.ErrMalformedHeader) {
+		t.Fatalf("expected malformed header error, got %v", err)
+	}
+	for _, repoFilePath := range expectedMalformed {
+		if !strings.Contains(err.Error(), string(repoFilePath)+": ") {
+			t.Errorf("expected '%s' in the error report, got:\n%v", repoFilePath, err)
+		}
+	}
+	if strings.Contains(err.Error(), "good.conf") {
+		t.Errorf("expected valid file to be left out of the error report, got:\n%v", err)
+	}
+	for _, expectedLocation := range []string{"comma.conf: invalid metadata header: line 4: ", "type.conf: invalid metadata header: line 4: "} {
+		if !strings.Contains(err.Error(), expectedLocation) {
+			t.Errorf("expected '%s' in the error report, got:\n%v", expectedLocation, err)
+		}
+	}
+	if len(malformedFiles) != len(expectedMalformed) {
+		t.Errorf("expected %d malformed files, got %d", len(expectedMalformed), len(malformedFiles))
+	}
+
+	// Forced deployments continue with the valid files only
+	deployFiles, malformedFiles, err := ParseFileContent(context.WithValue(ctx, global.OpsKey, config.Opts{ForceEnabled: true}), allDeploymentFiles, rawFileContent)
+	if err != nil {
+		t.Fatalf("expected malformed files to be skipped with --force, got %v", err)
+	}
+	if deployFiles.GetFileInfo("host1/etc/good.conf").Action != deployment.ActionFileCreate {
+		t.Errorf("expected valid file to be parsed")
+	}
+	var gotMalformed []str.LocalRepoPath
+	for _, malformed := range malformedFiles {
+		gotMalformed = append(gotMalformed, malformed.RepoFilePath)
+	}
+	if !slices.Equal(gotMalformed, expectedMalformed) {
+		t.Errorf("expected malformed files %v, got %v", expectedMalformed, gotMalformed)
+	}
+	if malformedFiles[0].Action != deployment.ActionAccountsApply || malformedFiles[2].Action != deployment.ActionFileModify {
+		t.Errorf("expected malformed files to keep their action, got %+v", malformedFiles)
+	}
+
+	// Nothing is left to deploy when every file is malformed
+	delete(allDeploymentFiles, "host1/etc/good.conf")
+	_, _, err = ParseFileContent(context.WithValue(ctx, global.OpsKey, config.Opts{ForceEnabled: true}), allDeploymentFiles, rawFileContent)
+	if !errors.Is(err, deployment.ErrMalformedHeader) {
+		t.Errorf("expected malformed header error when no valid file remains, got %v", err)
+	}
+}
+
+// Commits files into a new on-disk repository and returns the tree of that commit (objects are packed like a cloned repository)
+func commitTestTree(tb testing.TB, files map[string]string) (tree *object.Tree) {
+	repoPath := tb.TempDir()
+	repo, err := git.PlainInit(repoPath, false)
+	if err != nil {
+		tb.Fatalf("failed creating repository: %v", err)
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(repoPath, path)
+		err = os.MkdirAll(filepath.Dir(fullPath), 0700)
+		if err != nil {
+			tb.Fatalf("failed creating directory: %v", err)
+		}
+		err = os.WriteFile(fullPath, []byte(content), 0600)
+		if err != nil {
+			tb.Fatalf("failed writing file: %v", err)
+		}
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		tb.Fatalf("failed opening worktree: %v", err)
+	}
+	err = worktree.AddGlob(".")
+	if err != nil {
+		tb.Fatalf("failed staging files: %v", err)
+	}
+	commitHash, err := worktree.Commit("test", &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@localhost", When: time.Now()}})
+	if err != nil {
+		tb.Fatalf("failed committing files: %v", err)
+	}
+	err = repo.RepackObjects(&git.RepackConfig{})
+	if err != nil {
+		tb.Fatalf("failed packing objects: %v", err)
+	}
+
+	commit, err := repo.CommitObject(commitHash)
+	if err != nil {
+		tb.Fatalf("failed retrieving commit: %v", err)
+	}
+	tree, err = commit.Tree()
+	if err != nil {
+		tb.Fatalf("failed retrieving tree: %v", err)
+	}
+	return
+}
+
+// Repository of hosts with many small files, every file has a metadata header
+func syntheticRepoFiles(fileCount int) (files map[string]string, deploymentFiles map[str.LocalRepoPath]str.DeployAction) {
+	files = make(map[string]string, fileCount)
+	deploymentFiles = make(map[str.LocalRepoPath]str.DeployAction, fileCount)
+	for index := range fileCount {
+		path := fmt.Sprintf("host%d/etc/app/file%d.conf", index%10, index)
+		files[path] = "#|^^^|#\n{\"FileOwnerGroup\": \"root:root\", \"FilePermissions\": 644}\n#|^^^|#\n" +
+			strings.Repeat(fmt.Sprintf("setting_%d = value\n", index), 200)
+		deploymentFiles[str.LocalRepoPath(path)] = deployment.ActionFileModify
+	}
+	return
+}
+
+func TestLoadGitFileContent(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	files, deploymentFiles := syntheticRepoFiles(100)
+	tree := commitTestTree(t, files)
+
+	// Deleted files are not in the tree and are never loaded
+	deploymentFiles["host1/etc/removed.conf"] = deployment.ActionFileDelete
+
+	rawFileContent, err := LoadGitFileContent(ctx, deploymentFiles, tree)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rawFileContent) != len(files) {
+		t.Errorf("expected %d loaded files, got %d", len(files), len(rawFileContent))
+	}
+	for path, content := range files {
+		if string(rawFileContent[str.LocalRepoPath(path)]) != content {
+			t.Errorf("file %s: content mismatch", path)
+		}
+	}
+
+	// The first missing file in path order is reported
+	deploymentFiles["host0/etc/missing-b.conf"] = deployment.ActionFileModify
+	deploymentFiles["host0/etc/missing-a.conf"] = deployment.ActionFileModify
+	_, err = LoadGitFileContent(ctx, deploymentFiles, tree)
+	if err == nil || !strings.Contains(err.Error(), "'host0/etc/missing-a.conf': file not found") {
+		t.Errorf("expected file not found error for the first missing file, got %v", err)
+	}
+}
+
+// Loading and parsing of a synthetic repository with one worker (serial) and with GOMAXPROCS workers
+func BenchmarkLoadAndParseFileContent(b *testing.B) {
+	ctx := logctx.New(b.Context(), logctx.NSTest, logctx.VerbosityNone, b.Context().Done())
+	ctx = context.WithValue(ctx, global.ConfKey, config.Config{RepositoryPath: "/opt/repo"})
+	ctx = context.WithValue(ctx, global.OpsKey, config.Opts{})
+
+	files, deploymentFiles := syntheticRepoFiles(2000)
+	tree := commitTestTree(b, files)
+
+	for _, workers := range slices.Compact([]int{1, runtime.GOMAXPROCS(0)}) {
+		b.Run(fmt.Sprintf("workers-%d", workers), func(b *testing.B) {
+			previousProcs := runtime.GOMAXPROCS(workers)
+			defer runtime.GOMAXPROCS(previousProcs)
+
+			for b.Loop() {
+				rawFileContent, err := LoadGitFileContent(ctx, deploymentFiles, tree)
+				if err != nil {
+					b.Fatalf("unexpected error: %v", err)
+				}
+				_, _, err = ParseFileContent(ctx, deploymentFiles, rawFileContent)
+				if err != nil {
+					b.Fatalf("unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -2,13 +2,17 @@ package predeploy
 
 import (
 	"context"
+	"path"
 	"scmp/core/deployment"
 	"scmp/core/filesystem"
+	"scmp/core/filesystem/metadata"
 	"scmp/internal/config"
 	"scmp/internal/global"
 	"scmp/internal/logctx"
 	"scmp/internal/parsing"
+	"scmp/internal/sshinternal"
 	"scmp/internal/str"
+	"strings"
 )
 
 // Parse JSON metadata into File Info Struct
@@ -54,6 +58,7 @@ func jsonToFileInfo(ctx context.Context, repoFilePath str.LocalRepoPath, json fi
 	if json.ReloadGroup != "" {
 		info.ReloadGroup = json.ReloadGroup
 	}
+	info.ReloadMaxHosts = json.MaxConcurrentHosts
 
 	info.Preapply = json.PreapplyCommands
 	if len(info.Preapply) > 0 {
@@ -69,8 +74,12 @@ func jsonToFileInfo(ctx context.Context, repoFilePath str.LocalRepoPath, json fi
 		info.PostapplyRequired = false
 	}
 
+	info.PreChecks = json.PreCheckCommands
+	info.PostChecks = metadata.EffectivePostChecks(json)
+
 	info.Install = json.InstallCommands
 	info.PostInstall = json.PostInstallCommands
+	info.InstallOnce = json.InstallOnce
 	if len(info.Install) > 0 || len(info.PostInstall) > 0 {
 		info.InstallOptional = true
 	} else if len(info.Install) == 0 && len(info.PostInstall) == 0 {
@@ -78,6 +87,33 @@ func jsonToFileInfo(ctx context.Context, repoFilePath str.LocalRepoPath, json fi
 	}
 
 	info.Dependencies = json.Dependencies
+	info.Condition = json.Condition
+	info.TemplateEngine = json.TemplateEngine
+	info.Phase = json.Phase
+	info.ACLs = json.ACLs
+	info.SELinuxContext = json.SELinuxContext
+	info.Xattrs = json.Xattrs
+	info.Encrypted = json.Encrypted
+
+	info.MaxShrinkPercent = cfg.MaxShrinkPercent
+	if json.MaxShrinkPercent > 0 {
+		info.MaxShrinkPercent = json.MaxShrinkPercent
+	}
+
+	// Backups next to the file in directories that load every file would be loaded by the application as well
+	info.BackupStyle = cfg.BackupStyle
+	if json.BackupStyle != "" {
+		info.BackupStyle = json.BackupStyle
+	}
+	if info.BackupStyle == sshinternal.BackupStyleSuffix && isGlobLoadedDirectory(info.TargetFilePath) {
+		if json.BackupStyle == "" {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
+				"File '%s': directory is loaded by glob, using backup style '%s' instead of '%s'\n", repoFilePath, sshinternal.BackupStyleSibling, sshinternal.BackupStyleSuffix)
+			info.BackupStyle = sshinternal.BackupStyleSibling
+		} else {
+			logctx.LogStdWarn(ctx, "File '%s': backup style '%s' forced by metadata in glob loaded directory, the backup may be loaded by the application\n", repoFilePath, sshinternal.BackupStyleSuffix)
+		}
+	}
 
 	if len(fileID) > 0 {
 		info.Hash = fileID
@@ -98,6 +134,7 @@ func jsonToFileInfo(ctx context.Context, repoFilePath str.LocalRepoPath, json fi
 	logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Install Required?     %t\n", info.InstallOptional)
 	if info.InstallOptional {
 		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Install Commands      %s\n", info.Install)
+		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Install Once?         %t\n", info.InstallOnce)
 
 		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      PostInstall Commands  %s\n", info.PostInstall)
 	}
@@ -109,6 +146,12 @@ func jsonToFileInfo(ctx context.Context, repoFilePath str.LocalRepoPath, json fi
 	if info.PostapplyRequired {
 		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Postapply Commands     %s\n", info.Postapply)
 	}
+	if len(info.PreChecks) > 0 {
+		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      PreCheck Commands     %s\n", info.PreChecks)
+	}
+	if len(info.PostChecks) > 0 {
+		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      PostCheck Commands    %s\n", info.PostChecks)
+	}
 	logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Reload Required?      %t\n", info.ReloadRequired)
 	if info.ReloadRequired {
 		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Reload Commands       %s\n", info.Reload)
@@ -116,5 +159,31 @@ func jsonToFileInfo(ctx context.Context, repoFilePath str.LocalRepoPath, json fi
 	if info.ReloadGroup != "" {
 		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Reload Group          %s\n", info.ReloadGroup)
 	}
+	if info.ReloadMaxHosts > 0 {
+		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Max Concurrent Hosts  %d\n", info.ReloadMaxHosts)
+	}
+	logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Backup Style          %s\n", info.BackupStyle)
+	if info.Condition != "" {
+		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Condition             %s\n", info.Condition)
+	}
+	if info.MaxShrinkPercent > 0 {
+		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Max Shrink Percent    %d\n", info.MaxShrinkPercent)
+	}
+	return
+}
+
+// Checks if the parent directory of a remote path is commonly read in full by applications (e.g. conf.d, cron.d, sites-enabled)
+func isGlobLoadedDirectory(targetFilePath str.RemotePath) (globLoaded bool) {
+	parentDir := path.Base(path.Dir(string(targetFilePath)))
+	if strings.HasSuffix(parentDir, ".d") {
+		globLoaded = true
+		return
+	}
+	for _, enabledDir := range []string{"sites-enabled", "conf-enabled", "mods-enabled"} {
+		if parentDir == enabledDir {
+			globLoaded = true
+			return
+		}
+	}
 	return
 }
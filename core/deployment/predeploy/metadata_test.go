@@ -0,0 +1,105 @@
+package predeploy
+
+import (
+	"context"
+	"maps"
+	"scmp/core/deployment"
+	"scmp/core/filesystem"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"slices"
+	"testing"
+)
+
+func TestJsonToFileInfoBackupStyle(t *testing.T) {
+	tests := []struct {
+		name           string
+		globalStyle    string
+		fileStyle      string
+		repoFilePath   str.LocalRepoPath
+		expectedResult string
+	}{
+		{
+			name:           "Global default",
+			globalStyle:    sshinternal.BackupStyleCentral,
+			repoFilePath:   "host1/etc/nginx/nginx.conf",
+			expectedResult: sshinternal.BackupStyleCentral,
+		},
+		{
+			name:           "File override",
+			globalStyle:    sshinternal.BackupStyleCentral,
+			fileStyle:      sshinternal.BackupStyleSibling,
+			repoFilePath:   "host1/etc/nginx/nginx.conf",
+			expectedResult: sshinternal.BackupStyleSibling,
+		},
+		{
+			name:           "Global suffix outside glob directory",
+			globalStyle:    sshinternal.BackupStyleSuffix,
+			repoFilePath:   "host1/etc/nginx/nginx.conf",
+			expectedResult: sshinternal.BackupStyleSuffix,
+		},
+		{
+			name:           "Global suffix in conf.d",
+			globalStyle:    sshinternal.BackupStyleSuffix,
+			repoFilePath:   "host1/etc/nginx/conf.d/site.conf",
+			expectedResult: sshinternal.BackupStyleSibling,
+		},
+		{
+			name:           "Global suffix in sites-enabled",
+			globalStyle:    sshinternal.BackupStyleSuffix,
+			repoFilePath:   "host1/etc/nginx/sites-enabled/default",
+			expectedResult: sshinternal.BackupStyleSibling,
+		},
+		{
+			name:           "Forced suffix in cron.d",
+			globalStyle:    sshinternal.BackupStyleCentral,
+			fileStyle:      sshinternal.BackupStyleSuffix,
+			repoFilePath:   "host1/etc/cron.d/backup",
+			expectedResult: sshinternal.BackupStyleSuffix,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := t.Context()
+			ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+			ctx = context.WithValue(ctx, global.ConfKey, config.Config{BackupStyle: test.globalStyle})
+
+			header := filesystem.MetaHeader{BackupStyle: test.fileStyle}
+			info := jsonToFileInfo(ctx, test.repoFilePath, header, 10, deployment.ActionFileModify, "")
+			if info.BackupStyle != test.expectedResult {
+				t.Errorf("expected backup style '%s', got '%s'", test.expectedResult, info.BackupStyle)
+			}
+		})
+	}
+}
+
+func TestJsonToFileInfoExtendedAttributes(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.ConfKey, config.Config{BackupStyle: sshinternal.BackupStyleCentral})
+
+	header := filesystem.MetaHeader{
+		ACLs:           []string{"u:appuser:r--", "g:ops:rw-"},
+		SELinuxContext: "system_u:object_r:etc_t:s0",
+		Xattrs:         map[string]string{"user.app_role": "primary"},
+	}
+	info := jsonToFileInfo(ctx, "host1/etc/app.conf", header, 10, deployment.ActionFileModify, "")
+	if !slices.Equal(info.ACLs, header.ACLs) {
+		t.Errorf("expected ACLs %v, got %v", header.ACLs, info.ACLs)
+	}
+	if info.SELinuxContext != header.SELinuxContext {
+		t.Errorf("expected SELinux context '%s', got '%s'", header.SELinuxContext, info.SELinuxContext)
+	}
+	if !maps.Equal(info.Xattrs, header.Xattrs) {
+		t.Errorf("expected Xattrs %v, got %v", header.Xattrs, info.Xattrs)
+	}
+
+	info = jsonToFileInfo(ctx, "host1/etc/other.conf", filesystem.MetaHeader{}, 10, deployment.ActionFileModify, "")
+	if len(info.ACLs) != 0 || info.SELinuxContext != "" || len(info.Xattrs) != 0 {
+		t.Errorf("expected no extended attributes without header fields, got %v '%s' %v", info.ACLs, info.SELinuxContext, info.Xattrs)
+	}
+}
@@ -0,0 +1,88 @@
+package predeploy
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"scmp/core/deployment"
+	"scmp/core/filesystem"
+	"scmp/core/filesystem/metadata"
+	"scmp/internal/config"
+	"scmp/internal/crypto"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Header fields deciding what content is deployed from the content section
+type contentSource struct {
+	ExternalContentLocation string
+	SymbolicLinkTarget      str.RemotePath
+	Normalize               *config.Normalization
+	TemplateEngine          string
+	Encrypted               bool
+}
+
+// Marks modified files whose content section is the same as in the parent commit (only the metadata header was edited)
+// Files new to the commit, or that fail to parse in either commit, are never marked
+func MarkMetadataOnly(ctx context.Context, deployFiles *deployment.AllFiles, rawFileContent map[str.LocalRepoPath][]byte, parentTree *object.Tree) (err error) {
+	metadataOnlyFiles := make(map[str.LocalRepoPath]struct{})
+	for _, repoFilePath := range slices.Sorted(maps.Keys(rawFileContent)) {
+		if deployFiles.GetFileInfo(repoFilePath).Action != deployment.ActionFileModify {
+			continue
+		}
+
+		parentFile, lerr := parentTree.File(string(repoFilePath))
+		if lerr != nil {
+			continue
+		}
+		parentContent, lerr := loadGitFile(ctx, parentFile)
+		if lerr != nil {
+			err = fmt.Errorf("failed loading parent commit version of '%s': %w", repoFilePath, lerr)
+			return
+		}
+
+		if sameContent(parentContent, rawFileContent[repoFilePath]) {
+			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "File '%s' only changed its metadata header\n", repoFilePath)
+			metadataOnlyFiles[repoFilePath] = struct{}{}
+		}
+	}
+
+	deployFiles.MarkMetadataOnly(func(repoFilePath str.LocalRepoPath) bool {
+		_, metadataOnly := metadataOnlyFiles[repoFilePath]
+		return metadataOnly
+	})
+	return
+}
+
+// True when two versions of a repository file deploy the same content (false when either header does not parse)
+func sameContent(oldFile []byte, newFile []byte) (same bool) {
+	oldHeader, oldContent, err := metadata.Extract(string(oldFile))
+	if err != nil {
+		return
+	}
+	newHeader, newContent, err := metadata.Extract(string(newFile))
+	if err != nil {
+		return
+	}
+
+	if crypto.SHA256Sum(oldContent) != crypto.SHA256Sum(newContent) {
+		return
+	}
+	same = reflect.DeepEqual(sourceOf(oldHeader), sourceOf(newHeader))
+	return
+}
+
+func sourceOf(header filesystem.MetaHeader) (source contentSource) {
+	source = contentSource{
+		ExternalContentLocation: header.ExternalContentLocation,
+		SymbolicLinkTarget:      header.SymbolicLinkTarget,
+		Normalize:               header.Normalize,
+		TemplateEngine:          header.TemplateEngine,
+		Encrypted:               header.Encrypted,
+	}
+	return
+}
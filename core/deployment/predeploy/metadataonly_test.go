@@ -0,0 +1,32 @@
+package predeploy
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSameContent(t *testing.T) {
+	const header string = "#|^^^|#\n{\"FileOwnerGroup\": \"root:root\", \"FilePermissions\": 644%s}\n#|^^^|#\n"
+	withHeader := func(fields string, content string) []byte {
+		return []byte(fmt.Sprintf(header, fields) + content)
+	}
+
+	tests := []struct {
+		name     string
+		oldFile  []byte
+		newFile  []byte
+		expected bool
+	}{
+		{"checks added", withHeader("", "listen 80;\n"), withHeader(", \"Checks\": [\"nginx -t\"]", "listen 80;\n"), true},
+		{"content edited", withHeader("", "listen 80;\n"), withHeader("", "listen 8080;\n"), false},
+		{"template enabled", withHeader("", "listen 80;\n"), withHeader(", \"TemplateEngine\": \"go\"", "listen 80;\n"), false},
+		{"normalization changed", withHeader("", "listen 80;\n"), withHeader(", \"Normalize\": {\"eol\": \"crlf\"}", "listen 80;\n"), false},
+		{"old header malformed", []byte("listen 80;\n"), withHeader("", "listen 80;\n"), false},
+	}
+	for _, test := range tests {
+		same := sameContent(test.oldFile, test.newFile)
+		if same != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.name, test.expected, same)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package predeploy
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// Outcome of a single pool item
+type poolResult[Result any] struct {
+	index  int
+	result Result
+	err    error
+}
+
+// Runs work for every item on a pool of GOMAXPROCS workers, results are collected over a channel and returned in item order
+// Once an item fails no further items are started and the context given to running items is cancelled
+// The error of the earliest failing item (in item order) is returned, so the reported error does not depend on scheduling
+func runWorkerPool[Item any, Result any](ctx context.Context, items []Item, work func(ctx context.Context, item Item) (result Result, err error)) (results []Result, err error) {
+	poolCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int)
+	completed := make(chan poolResult[Result])
+
+	var workers sync.WaitGroup
+	for range min(runtime.GOMAXPROCS(0), len(items)) {
+		workers.Go(func() {
+			for index := range jobs {
+				result, workErr := work(poolCtx, items[index])
+				completed <- poolResult[Result]{index: index, result: result, err: workErr}
+			}
+		})
+	}
+
+	// Items are handed out in order until all are started or the pool is cancelled
+	go func() {
+		defer close(jobs)
+		for index := range items {
+			select {
+			case <-poolCtx.Done():
+				return
+			case jobs <- index:
+			}
+		}
+	}()
+
+	go func() {
+		workers.Wait()
+		close(completed)
+	}()
+
+	results = make([]Result, len(items))
+	failedIndex := len(items)
+	for completion := range completed {
+		if completion.err == nil {
+			results[completion.index] = completion.result
+			continue
+		}
+
+		// Items interrupted by the failure of another item are not the cause
+		if poolCtx.Err() != nil && errors.Is(completion.err, context.Canceled) {
+			continue
+		}
+
+		if completion.index < failedIndex {
+			failedIndex = completion.index
+			err = completion.err
+		}
+		cancel()
+	}
+
+	// Items skipped because the deployment was stopped
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		results = nil
+	}
+	return
+}
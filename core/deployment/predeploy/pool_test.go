@@ -0,0 +1,74 @@
+package predeploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRunWorkerPool(t *testing.T) {
+	items := make([]int, 2000)
+	for index := range items {
+		items[index] = index
+	}
+
+	// Results keep the item order regardless of completion order
+	results, err := runWorkerPool(t.Context(), items, func(ctx context.Context, item int) (result string, err error) {
+		result = fmt.Sprintf("item-%d", item)
+		return
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for index, result := range results {
+		if result != fmt.Sprintf("item-%d", index) {
+			t.Fatalf("expected result %d to be 'item-%d', got '%s'", index, index, result)
+		}
+	}
+
+	// Earliest failing item is reported, later items are not started once an item failed
+	var started atomic.Int64
+	results, err = runWorkerPool(t.Context(), items, func(ctx context.Context, item int) (result string, err error) {
+		started.Add(1)
+		if item == 3 || item == 5 {
+			err = fmt.Errorf("item %d failed", item)
+			return
+		}
+		if item > 5 {
+			// Running items are stopped by the failure
+			<-ctx.Done()
+			err = ctx.Err()
+		}
+		return
+	})
+	if err == nil || err.Error() != "item 3 failed" {
+		t.Errorf("expected error of item 3, got %v", err)
+	}
+	if results != nil {
+		t.Errorf("expected no results on failure, got %d", len(results))
+	}
+	if started.Load() == int64(len(items)) {
+		t.Errorf("expected remaining items to be skipped after the failure")
+	}
+
+	// Stopped context fails the pool even without failing items
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_, err = runWorkerPool(ctx, items, func(ctx context.Context, item int) (result string, err error) {
+		return
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context cancellation error, got %v", err)
+	}
+
+	// No items is not an error
+	results, err = runWorkerPool(t.Context(), []int{}, func(ctx context.Context, item int) (result string, err error) {
+		return
+	})
+	if err != nil || !slices.Equal(results, []string{}) {
+		t.Errorf("expected empty results without error, got %v, %v", results, err)
+	}
+}
@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
+	"path/filepath"
 	"scmp/core/deployment"
 	"scmp/core/deployment/metrics"
+	"scmp/core/deployment/snapshot"
 	"scmp/internal/config"
 	"scmp/internal/crypto"
 	"scmp/internal/global"
@@ -21,8 +23,14 @@ import (
 
 // Print out deployment information in dry run mode
 func PrintDeploymentInformation(ctx context.Context, deployFiles *deployment.AllFiles, allDeploymentHosts []str.RepoRootDir, hostFiles map[str.RepoRootDir]*deployment.HostFiles) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
 	config := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
 
+	sizeOrder := "smallest first"
+	if opts.LargeFilesFirst {
+		sizeOrder = "largest first"
+	}
+
 	// Notify user that program is in dry run mode
 	logctx.LogStdInfo(ctx, "Requested dry-run, aborting deployment\n")
 	logctx.LogStdInfo(ctx, "Outputting information collected for deployment:\n")
@@ -32,10 +40,20 @@ func PrintDeploymentInformation(ctx context.Context, deployFiles *deployment.All
 
 		hostInfo := config.HostInfo[endpointName]
 		PrintHostInformation(ctx, hostInfo)
-		logctx.LogStdInfo(ctx, "  Files:\n")
+		logctx.LogStdInfo(ctx, "  Files (deployment order, %s when dependencies allow):\n", sizeOrder)
 
 		deploymentList := hostFiles[endpointName]
 
+		// Remote sizes from earlier snapshots show files the shrink guard would likely hold
+		var knownSizes map[str.RemotePath]snapshot.KnownSize
+		if config.SnapshotDirectory != "" {
+			var err error
+			knownSizes, err = snapshot.LastKnownSizes(filepath.Join(config.SnapshotDirectory, string(endpointName)))
+			if err != nil {
+				logctx.LogStdWarn(ctx, "Unable to read snapshot history of host '%s': %v\n", endpointName, err)
+			}
+		}
+
 		// Identify maximum indent file name prints will need to be
 		var maxFileNameLength int
 		var maxActionLength int
@@ -60,8 +78,24 @@ func PrintDeploymentInformation(ctx context.Context, deployFiles *deployment.All
 		maxFileNameLength += 1
 		maxActionLength += 9
 
+		// Phases are only shown when the host uses more than the default phase
+		var usesPhases bool
+		for _, independentDeploymentList := range deploymentList.Groups {
+			if independentDeploymentList.GetPhase() != deployment.PhaseConfigure {
+				usesPhases = true
+			}
+		}
+		if usesPhases {
+			logctx.LogStdInfo(ctx, "     Phases deploy in order, PhaseAbort: %s\n", config.PhaseAbort)
+		}
+
 		// Print out files for this specific host
+		var currentPhase string
 		for _, independentDeploymentList := range deploymentList.Groups {
+			if usesPhases && independentDeploymentList.GetPhase() != currentPhase {
+				currentPhase = independentDeploymentList.GetPhase()
+				logctx.LogStdInfo(ctx, "     Phase %s:\n", currentPhase)
+			}
 			for _, file := range independentDeploymentList.GetOrderedList() {
 				// Format to remote path type
 				_, targetFile := parsing.TranslateLocalPathtoRemotePath(config.RepositoryPath, file)
@@ -74,9 +108,31 @@ func PrintDeploymentInformation(ctx context.Context, deployFiles *deployment.All
 				// Determine how many spaces to add after action name
 				actionIndentSpaces := maxActionLength - len(info.Action)
 
+				var sizeNote string
+				if info.FileSize > 0 {
+					sizeNote = " (" + parsing.FormatBytes(info.FileSize) + ")"
+				}
+
 				// Print what we are going to do, the local file path, and remote file path
-				logctx.LogStdInfo(ctx, "       %s:%s%s%s# %s\n",
-					info.Action, strings.Repeat(" ", actionIndentSpaces), targetFile, strings.Repeat(" ", fileIndentSpaces), file)
+				logctx.LogStdInfo(ctx, "       %s:%s%s%s# %s%s\n",
+					info.Action, strings.Repeat(" ", actionIndentSpaces), targetFile, strings.Repeat(" ", fileIndentSpaces), file, sizeNote)
+				if info.MetadataOnly {
+					logctx.LogStdInfo(ctx, "         metadata only: content unchanged since the parent commit, not transferred where the remote content matches\n")
+				}
+				if len(info.PreChecks) > 0 {
+					logctx.LogStdInfo(ctx, "         pre-checks:  %s\n", strings.Join(info.PreChecks, "; "))
+				}
+				if len(info.PostChecks) > 0 {
+					logctx.LogStdInfo(ctx, "         post-checks: %s\n", strings.Join(info.PostChecks, "; "))
+				}
+				knownSize, sizeKnown := knownSizes[info.TargetFilePath]
+				if sizeKnown && !info.Replacement && (info.Action == deployment.ActionFileCreate || info.Action == deployment.ActionFileModify) {
+					shrinkPercent, exceeds := deployment.ShrinkExceeds(knownSize.Size, info.FileSize, info.MaxShrinkPercent)
+					if exceeds {
+						logctx.LogStdInfo(ctx, "         suspicious shrink: %d%% smaller than remote size %s in snapshot %s (MaxShrinkPercent %d), would be held without --acknowledge-shrink\n",
+							shrinkPercent, parsing.FormatBytes(knownSize.Size), knownSize.SnapshotID, info.MaxShrinkPercent)
+					}
+				}
 			}
 		}
 	}
@@ -89,7 +145,13 @@ func PrintHostInformation(ctx context.Context, hostInfo config.EndpointInfo) {
 	infoOutput += fmt.Sprintf("Host: %s\n", hostInfo.EndpointName)
 	infoOutput += ("  Options:\n")
 	infoOutput += fmt.Sprintf("       Endpoint Address:  %s\n", hostInfo.Endpoint)
+	if len(hostInfo.FallbackEndpoints) > 0 {
+		infoOutput += fmt.Sprintf("       Fallback Address:  %s\n", strings.Join(hostInfo.FallbackEndpoints, ", "))
+	}
 	infoOutput += fmt.Sprintf("       SSH User:          %s\n", hostInfo.EndpointUser)
+	if hostInfo.RequireConfirm {
+		infoOutput += "       Confirmation:      required\n"
+	}
 	logctx.LogStdInfo(ctx, "%s\n", infoOutput)
 }
 
@@ -134,6 +196,13 @@ func RunPreDeploymentCommands(ctx context.Context, deployMetrics *metrics.Metric
 					predeployCommand = strings.TrimSuffix(predeployCommand, reqStdoutApSuffix)
 				}
 
+				// Streamed artifacts are never loaded into memory
+				_, isStreamed := files.GetFileStream(oldHashIndex)
+				if isStreamed && (writeConfToStdin || writeStdoutToFile || appendStdoutToFile) {
+					deployMetrics.AddFileFailure(hostname, repoFilePath, fmt.Errorf("pre-deploy command '%s': file content of streamed artifacts cannot be read or replaced by pre-deploy commands", predeployCommand))
+					continue
+				}
+
 				logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "  Running pre-deployment command '%s'\n", hostname, predeployCommand)
 
 				// Retrieve executable name
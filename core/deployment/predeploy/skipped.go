@@ -0,0 +1,32 @@
+package predeploy
+
+import (
+	"context"
+	"scmp/core/deployment"
+	"scmp/internal/logctx"
+)
+
+// Print table of files left out of the deployment by skip reason
+func PrintSkippedFiles(ctx context.Context, summaries []deployment.SkipSummary) {
+	if len(summaries) == 0 {
+		return
+	}
+
+	// Align reason column to the longest reason present
+	var reasonWidth int
+	for _, summary := range summaries {
+		reasonWidth = max(reasonWidth, len(summary.Reason))
+	}
+
+	logctx.LogStdInfo(ctx, "Skipped files:\n")
+	for _, summary := range summaries {
+		logctx.LogStdInfo(ctx, "  %-*s %5d  %s\n", reasonWidth, summary.Reason, summary.Count, summary.Description)
+		for _, file := range summary.Files {
+			logctx.LogStdInfo(ctx, "       %s\n", file)
+		}
+		if summary.Unlisted > 0 {
+			logctx.LogStdInfo(ctx, "       ...and %d more\n", summary.Unlisted)
+		}
+	}
+	logctx.LogStdInfo(ctx, "\n")
+}
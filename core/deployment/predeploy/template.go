@@ -0,0 +1,114 @@
+package predeploy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"scmp/core/deployment"
+	"scmp/core/filesystem/metadata"
+	"scmp/internal/config"
+	"scmp/internal/crypto"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+	"text/template"
+)
+
+// Host values available to file templates
+type templateData struct {
+	Name              str.RepoRootDir
+	Address           string // Endpoint without the port
+	Endpoint          string
+	FallbackEndpoints []string
+	User              string
+	AddressFamily     string
+	Proxy             string
+	DeploymentState   string
+	Groups            []str.RepoRootDir // Sorted universal groups of the host
+	Vars              map[string]string // User defined values from the config option "Vars"
+}
+
+// Reports membership of a universal group ({{if .InGroup "web"}})
+func (data templateData) InGroup(group string) (member bool) {
+	member = slices.Contains(data.Groups, str.RepoRootDir(group))
+	return
+}
+
+// Template data of a host (never includes credentials)
+func newTemplateData(endpointInfo config.EndpointInfo) (data templateData) {
+	data = templateData{
+		Name:              endpointInfo.EndpointName,
+		Address:           endpointInfo.Endpoint,
+		Endpoint:          endpointInfo.Endpoint,
+		FallbackEndpoints: endpointInfo.FallbackEndpoints,
+		User:              endpointInfo.EndpointUser,
+		AddressFamily:     endpointInfo.AddressFamily,
+		Proxy:             endpointInfo.Proxy,
+		DeploymentState:   endpointInfo.DeploymentState,
+		Vars:              endpointInfo.Vars,
+	}
+	host, _, err := net.SplitHostPort(endpointInfo.Endpoint)
+	if err == nil {
+		data.Address = host
+	}
+	for group := range endpointInfo.UniversalGroups {
+		data.Groups = append(data.Groups, group)
+	}
+	slices.Sort(data.Groups)
+	if data.Vars == nil {
+		data.Vars = make(map[string]string)
+	}
+	return
+}
+
+// Renders templated file content per host, the rendered content gets its own hash so remote comparisons use the deployed form
+func RenderTemplates(ctx context.Context,
+	allHostFiles map[str.RepoRootDir]*deployment.HostFiles,
+	hostInfo map[str.RepoRootDir]config.EndpointInfo,
+) (err error) {
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSParsing)
+
+	for hostAlias, hostFiles := range allHostFiles {
+		data := newTemplateData(hostInfo[hostAlias])
+
+		for _, file := range hostFiles.GetUnorderedList() {
+			info := hostFiles.GetFileInfo(file)
+			if info.TemplateEngine != metadata.TemplateEngineGo {
+				continue
+			}
+			if info.Action != deployment.ActionFileCreate && info.Action != deployment.ActionFileModify {
+				continue
+			}
+
+			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Host '%s': rendering template '%s'\n", hostAlias, file)
+
+			rendered, lerr := renderTemplate(file, hostFiles.GetFileData(info.Hash), data)
+			if lerr != nil {
+				err = fmt.Errorf("host '%s': %w", hostAlias, lerr)
+				return
+			}
+
+			hostFiles.ReplaceFileContent(file, str.FileID(crypto.SHA256Sum(rendered)), rendered)
+		}
+	}
+	return
+}
+
+// Executes file content as a Go text/template, unknown fields and variables are errors
+func renderTemplate(repoFilePath str.LocalRepoPath, content []byte, data templateData) (rendered []byte, err error) {
+	fileTemplate, err := template.New(string(repoFilePath)).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		err = fmt.Errorf("file '%s': invalid template: %w", repoFilePath, err)
+		return
+	}
+
+	var output bytes.Buffer
+	err = fileTemplate.Execute(&output, data)
+	if err != nil {
+		err = fmt.Errorf("file '%s': failed rendering template: %w", repoFilePath, err)
+		return
+	}
+	rendered = output.Bytes()
+	return
+}
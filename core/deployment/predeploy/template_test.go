@@ -0,0 +1,99 @@
+package predeploy
+
+import (
+	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/crypto"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplates(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	hostInfo := map[str.RepoRootDir]config.EndpointInfo{
+		"web01": {
+			EndpointName:    "web01",
+			Endpoint:        "192.0.2.10:22",
+			UniversalGroups: map[str.RepoRootDir]struct{}{"UniversalConfs_Web": {}},
+			Vars:            map[string]string{"role": "primary"},
+		},
+		"web02": {
+			EndpointName: "web02",
+			Endpoint:     "[2001:db8::20]:2222",
+			Vars:         map[string]string{"role": "standby"},
+		},
+	}
+	template := []byte("listen {{.Address}}; # {{.Name}} {{.Vars.role}}{{if .InGroup \"UniversalConfs_Web\"}} web{{end}}\n")
+	plain := []byte("{{.Name}} is not rendered\n")
+
+	allHostFiles := make(map[str.RepoRootDir]*deployment.HostFiles)
+	for hostAlias := range hostInfo {
+		hostFiles, err := deployment.NewHostFiles()
+		if err != nil {
+			t.Fatalf("unexpected hostfiles create failure: %v", err)
+		}
+		for repoFilePath, content := range map[str.LocalRepoPath][]byte{"UniversalConfs/etc/app.conf": template, "UniversalConfs/etc/motd": plain} {
+			info := deployment.FileInfo{Hash: str.FileID(crypto.SHA256Sum(content)), RepoFilePath: repoFilePath, Action: deployment.ActionFileCreate}
+			if repoFilePath == "UniversalConfs/etc/app.conf" {
+				info.TemplateEngine = "go"
+			}
+			hostFiles.SetFileMetadata(repoFilePath, info)
+			hostFiles.StoreDataOnce(info.Hash, content)
+		}
+		allHostFiles[hostAlias] = hostFiles
+	}
+
+	err := RenderTemplates(ctx, allHostFiles, hostInfo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[str.RepoRootDir]string{
+		"web01": "listen 192.0.2.10; # web01 primary web\n",
+		"web02": "listen 2001:db8::20; # web02 standby\n",
+	}
+	for hostAlias, expectedContent := range expected {
+		hostFiles := allHostFiles[hostAlias]
+		info := hostFiles.GetFileInfo("UniversalConfs/etc/app.conf")
+		rendered := string(hostFiles.GetFileData(info.Hash))
+		if rendered != expectedContent {
+			t.Errorf("host '%s': expected rendered content %q, got %q", hostAlias, expectedContent, rendered)
+		}
+		if info.Hash != str.FileID(crypto.SHA256Sum([]byte(expectedContent))) || info.FileSize != len(expectedContent) {
+			t.Errorf("host '%s': expected hash and size of the rendered content", hostAlias)
+		}
+
+		// Files without a template engine are deployed as committed
+		plainInfo := hostFiles.GetFileInfo("UniversalConfs/etc/motd")
+		if string(hostFiles.GetFileData(plainInfo.Hash)) != string(plain) {
+			t.Errorf("host '%s': expected untemplated file unchanged", hostAlias)
+		}
+	}
+}
+
+func TestRenderTemplateErrors(t *testing.T) {
+	data := newTemplateData(config.EndpointInfo{EndpointName: "web01"})
+
+	tests := []struct {
+		name          string
+		content       string
+		expectedError string
+	}{
+		{"unknown variable", "{{.Vars.missing}}", "failed rendering template"},
+		{"unknown field", "{{.Password}}", "failed rendering template"},
+		{"syntax", "{{if .Name}}", "invalid template"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := renderTemplate("web01/etc/app.conf", []byte(test.content), data)
+			if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("expected error containing '%s', got '%v'", test.expectedError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package predeploy
+
+import (
+	"context"
+	"maps"
+	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/crypto"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+)
+
+// Replaces values file macros in the metadata commands of every host file, and in the content of templated files
+// Runs after templates are rendered so values are spliced into the output, never into template source
+// Every unresolved name of every host is reported together, before any host is contacted
+func SubstituteValues(ctx context.Context, allHostFiles map[str.RepoRootDir]*deployment.HostFiles, values config.Values) (err error) {
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSParsing)
+
+	unresolved := make(map[string][]string) // value name -> hosts missing it
+	for _, hostAlias := range slices.Sorted(maps.Keys(allHostFiles)) {
+		hostFiles := allHostFiles[hostAlias]
+		hostValues := values.ForHost(hostAlias)
+
+		var hostUnresolved []string
+		expand := func(text string) (expanded string) {
+			expanded, missing := deployment.ExpandValueMacros(text, hostValues)
+			hostUnresolved = append(hostUnresolved, missing...)
+			return
+		}
+
+		for _, file := range hostFiles.GetUnorderedList() {
+			hostFiles.ExpandFileCommands(file, expand)
+
+			info := hostFiles.GetFileInfo(file)
+			if info.TemplateEngine == "" {
+				continue
+			}
+			if info.Action != deployment.ActionFileCreate && info.Action != deployment.ActionFileModify {
+				continue
+			}
+
+			content := hostFiles.GetFileData(info.Hash)
+			expanded := expand(string(content))
+			if expanded == string(content) {
+				continue
+			}
+
+			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Host '%s': substituted values in content of '%s'\n", hostAlias, file)
+			hostFiles.ReplaceFileContent(file, str.FileID(crypto.SHA256Sum([]byte(expanded))), []byte(expanded))
+		}
+
+		for _, name := range hostUnresolved {
+			if !slices.Contains(unresolved[name], string(hostAlias)) {
+				unresolved[name] = append(unresolved[name], string(hostAlias))
+			}
+		}
+	}
+
+	err = deployment.UnresolvedValuesError(unresolved)
+	return
+}
@@ -0,0 +1,123 @@
+package predeploy
+
+import (
+	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/crypto"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSubstituteValues(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	values := config.Values{
+		Global: map[string]string{"ntp_server": "192.0.2.1", "vlan": "10"},
+		Hosts:  map[str.RepoRootDir]map[string]string{"web02": {"vlan": "20"}},
+	}
+	content := []byte("server {@VAR:ntp_server}\nvlan {@VAR:vlan}\n")
+
+	newHostFiles := func(reload string) (allHostFiles map[str.RepoRootDir]*deployment.HostFiles) {
+		allHostFiles = make(map[str.RepoRootDir]*deployment.HostFiles)
+		for _, hostAlias := range []str.RepoRootDir{"web01", "web02"} {
+			hostFiles, err := deployment.NewHostFiles()
+			if err != nil {
+				t.Fatalf("unexpected hostfiles create failure: %v", err)
+			}
+			for repoFilePath, engine := range map[str.LocalRepoPath]string{"UniversalConfs/etc/ntp.conf": "go", "UniversalConfs/etc/motd": ""} {
+				info := deployment.FileInfo{
+					Hash:           str.FileID(crypto.SHA256Sum(content)),
+					RepoFilePath:   repoFilePath,
+					Action:         deployment.ActionFileCreate,
+					TemplateEngine: engine,
+					Reload:         []string{reload},
+				}
+				hostFiles.SetFileMetadata(repoFilePath, info)
+				hostFiles.StoreDataOnce(info.Hash, content)
+			}
+			allHostFiles[hostAlias] = hostFiles
+		}
+		return
+	}
+
+	allHostFiles := newHostFiles("ip link set vlan{@VAR:vlan} up")
+	err := SubstituteValues(ctx, allHostFiles, values)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for hostAlias, vlan := range map[str.RepoRootDir]string{"web01": "10", "web02": "20"} {
+		hostFiles := allHostFiles[hostAlias]
+
+		info := hostFiles.GetFileInfo("UniversalConfs/etc/ntp.conf")
+		expectedContent := "server 192.0.2.1\nvlan " + vlan + "\n"
+		if string(hostFiles.GetFileData(info.Hash)) != expectedContent {
+			t.Errorf("host '%s': expected content %q, got %q", hostAlias, expectedContent, hostFiles.GetFileData(info.Hash))
+		}
+		if !slices.Equal(info.Reload, []string{"ip link set vlan" + vlan + " up"}) {
+			t.Errorf("host '%s': expected per-host value in reload command, got %v", hostAlias, info.Reload)
+		}
+
+		// Content of files without a template engine is deployed as committed
+		plainInfo := hostFiles.GetFileInfo("UniversalConfs/etc/motd")
+		if string(hostFiles.GetFileData(plainInfo.Hash)) != string(content) {
+			t.Errorf("host '%s': expected untemplated content unchanged", hostAlias)
+		}
+	}
+
+	// Every unresolved name is reported with the hosts missing it
+	err = SubstituteValues(ctx, newHostFiles("echo {@VAR:missing} {@VAR:other}"), values)
+	expectedError := "unresolved value(s): missing (host(s) web01, web02); other (host(s) web01, web02)"
+	if err == nil || !strings.Contains(err.Error(), expectedError) {
+		t.Errorf("expected error containing '%s', got '%v'", expectedError, err)
+	}
+}
+
+func TestSubstituteValuesAfterRender(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	values := config.Values{
+		Global:    map[string]string{"password": "pa{{ss}}word"},
+		Sensitive: []string{"password"},
+	}
+	hostInfo := map[str.RepoRootDir]config.EndpointInfo{"web01": {EndpointName: "web01", Endpoint: "192.0.2.10:22"}}
+	content := []byte("host {{.Name}}\npassword {@VAR:password}\n")
+
+	hostFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected hostfiles create failure: %v", err)
+	}
+	info := deployment.FileInfo{
+		Hash:           str.FileID(crypto.SHA256Sum(content)),
+		RepoFilePath:   "UniversalConfs/etc/app.conf",
+		Action:         deployment.ActionFileCreate,
+		TemplateEngine: "go",
+	}
+	hostFiles.SetFileMetadata(info.RepoFilePath, info)
+	hostFiles.StoreDataOnce(info.Hash, content)
+	allHostFiles := map[str.RepoRootDir]*deployment.HostFiles{"web01": hostFiles}
+
+	err = RenderTemplates(ctx, allHostFiles, hostInfo)
+	if err != nil {
+		t.Fatalf("unexpected render error: %v", err)
+	}
+	err = SubstituteValues(ctx, allHostFiles, values)
+	if err != nil {
+		t.Fatalf("unexpected substitute error: %v", err)
+	}
+
+	// Template syntax inside a value is deployed literally
+	info = hostFiles.GetFileInfo("UniversalConfs/etc/app.conf")
+	expectedContent := "host web01\npassword pa{{ss}}word\n"
+	if string(hostFiles.GetFileData(info.Hash)) != expectedContent {
+		t.Errorf("expected content %q, got %q", expectedContent, hostFiles.GetFileData(info.Hash))
+	}
+	if info.Hash != str.FileID(crypto.SHA256Sum([]byte(expectedContent))) {
+		t.Errorf("expected hash of substituted content, got %s", info.Hash)
+	}
+}
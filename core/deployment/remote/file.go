@@ -11,25 +11,33 @@ import (
 	"scmp/internal/parsing"
 	"scmp/internal/sshinternal"
 	"scmp/internal/str"
+	"strings"
 )
 
 // Retrieves metadata about file/dir from stat
+// Stat and hash run as one batch, the hash step prints nothing for anything but regular files
 func GetOldRemoteInfo(ctx context.Context, host sshinternal.HostMeta, targetPath str.RemotePath) (remoteMetadata sshinternal.RemoteFileInfo, err error) {
-	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
-
-	// Find if target file exists on remote
-	exists, statOutput, err := sshinternal.CheckRemoteFileDirExistence(ctx, host, targetPath)
+	statCommand, err := sshinternal.BuildHostStat(host, targetPath)
 	if err != nil {
 		err = fmt.Errorf("failed checking file presence on remote host: %w", err)
 		return
 	}
 
-	// Return early if not present
-	remoteMetadata.Exists = exists
-	if !exists {
+	// Find if target file exists on remote and hash it if so
+	output, failedStep, err := sshinternal.RunBatch(ctx, host, statCommand, sshinternal.BuildHostHashIfFile(host, targetPath))
+	if failedStep == 0 && strings.Contains(err.Error(), "No such file or directory") {
+		// Return early if not present
+		err = nil
 		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "   File %s: remote does not exist, not extracting metadata\n", host.Name, targetPath)
 		return
+	} else if failedStep == 1 {
+		err = fmt.Errorf("hash of old config file: %w", err)
+		return
+	} else if err != nil {
+		err = fmt.Errorf("failed checking file presence on remote host: %w", err)
+		return
 	}
+	statOutput, hashOutput, _ := strings.Cut(output, "\n")
 
 	// Get metadata from the output of the remote stat command
 	remoteMetadata, err = sshinternal.ExtractMetadataFromStat(statOutput)
@@ -46,20 +54,8 @@ func GetOldRemoteInfo(ctx context.Context, host sshinternal.HostMeta, targetPath
 
 	// Only hash if its a file
 	if remoteMetadata.FsType == FileType || remoteMetadata.FsType == FileEmptyType {
-		// Get the SHA256 hash of the remote old conf file
-		command := sshinternal.BuildHashCmd(targetPath)
-		command.DisableSudo = opts.DisableSudo
-		command.RunAsUser = opts.RunAsUser
-
-		var commandOutput string
-		commandOutput, err = command.SSHexec(ctx, host.SSHClient, host.Password)
-		if err != nil {
-			err = fmt.Errorf("failed SSH Command on host during hash of old config file: %w", err)
-			return
-		}
-
 		// Parse hash command output to get just the hex
-		validHash, hash := parsing.HasHex64Prefix(commandOutput)
+		validHash, hash := parsing.HasHex64Prefix(hashOutput)
 		if !validHash {
 			err = fmt.Errorf("invalid hash received from remote sha256sum command")
 			return
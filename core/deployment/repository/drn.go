@@ -25,12 +25,6 @@ import (
 
 // Core logic for handling DRN association/references for any given deployment.
 func TrackDRNChanges(ctx context.Context, commitFiles map[str.LocalRepoPath]str.DeployAction, commit *object.Commit) (hostOverride string, err error) {
-	additions := make(map[str.LocalRepoPath]str.DeployAction)
-	var removals []str.LocalRepoPath
-
-	ctx = logctx.AppendCtxTag(ctx, logctx.NSDepEval)
-	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
-
 	parentCommit, err := commit.Parents().Next()
 	if err != nil {
 		err = fmt.Errorf("failed retrieving parent commit: %w", err)
@@ -49,6 +43,52 @@ func TrackDRNChanges(ctx context.Context, commitFiles map[str.LocalRepoPath]str.
 		return
 	}
 
+	hostOverride, err = trackDRNChanges(ctx, commitFiles, patch, tree)
+	return
+}
+
+// DRN association/references for a deployment of a commit range, DRN configs are compared between the base and the newest commit
+func TrackDRNChangesSince(ctx context.Context, commitFiles map[str.LocalRepoPath]str.DeployAction, commitRange CommitRange) (hostOverride string, err error) {
+	if len(commitRange.Commits) == 0 {
+		return
+	}
+
+	tree, err := commitRange.Commits[0].Tree()
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve commit tree: %w", err)
+		return
+	}
+	var baseTree *object.Tree
+	if commitRange.Base != nil {
+		baseTree, err = commitRange.Base.Tree()
+		if err != nil {
+			err = fmt.Errorf("failed to retrieve base commit tree: %w", err)
+			return
+		}
+	}
+
+	changes, err := object.DiffTree(baseTree, tree)
+	if err != nil {
+		err = fmt.Errorf("failed retrieving difference between commits: %w", err)
+		return
+	}
+	patch, err := changes.Patch()
+	if err != nil {
+		err = fmt.Errorf("failed retrieving difference between commits: %w", err)
+		return
+	}
+
+	hostOverride, err = trackDRNChanges(ctx, commitFiles, patch, tree)
+	return
+}
+
+func trackDRNChanges(ctx context.Context, commitFiles map[str.LocalRepoPath]str.DeployAction, patch *object.Patch, tree *object.Tree) (hostOverride string, err error) {
+	additions := make(map[str.LocalRepoPath]str.DeployAction)
+	var removals []str.LocalRepoPath
+
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSDepEval)
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
 	walker := gitinternal.NewTreeWalker(tree, cfg.RepositoryPath)
 	searcher := gitinternal.NewTreeSearcher(tree)
 	reader := gitinternal.NewTreeReader(tree)
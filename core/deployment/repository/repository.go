@@ -82,7 +82,7 @@ func GetChangedFiles(ctx context.Context, commit *object.Commit) (changedFiles [
 
 // Parses changed files according to presence, path, and mode validity
 // Marks files with create/delete/modify action for deployment
-func ParseChangedFiles(ctx context.Context, changedFiles []GitChangedFileMetadata, fileOverride string) (commitFiles map[str.LocalRepoPath]str.DeployAction) {
+func ParseChangedFiles(ctx context.Context, skipped *deployment.SkipReport, changedFiles []GitChangedFileMetadata, fileOverride string) (commitFiles map[str.LocalRepoPath]str.DeployAction) {
 	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
 	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
 
@@ -105,8 +105,10 @@ func ParseChangedFiles(ctx context.Context, changedFiles []GitChangedFileMetadat
 			continue
 		}
 
-		fromFileIsValid := fileIsValid(ctx, changedFile.fromPath, changedFile.fromMode.String())
-		toFileIsValid := fileIsValid(ctx, changedFile.toPath, changedFile.toMode.String())
+		fromFileIsValid, fromSkipReason := fileIsValid(ctx, changedFile.fromPath, changedFile.fromMode.String())
+		toFileIsValid, toSkipReason := fileIsValid(ctx, changedFile.toPath, changedFile.toMode.String())
+		skipped.Add(fromSkipReason, changedFile.fromPath)
+		skipped.Add(toSkipReason, changedFile.toPath)
 
 		if changedFile.fromPath == "" && changedFile.toPath == "" {
 			continue
@@ -122,6 +124,7 @@ func ParseChangedFiles(ctx context.Context, changedFiles []GitChangedFileMetadat
 			} else {
 				logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
 					"  Skipping deletion of file '%s'\n", changedFile.fromPath)
+				skipped.Add(deployment.SkipDeletion, changedFile.fromPath)
 			}
 		} else if changedFile.fromPath != changedFile.toPath && fromFileIsValid && toFileIsValid {
 			// Copied or renamed files
@@ -130,6 +133,8 @@ func ParseChangedFiles(ctx context.Context, changedFiles []GitChangedFileMetadat
 			// File was moved, handle the 'from' path
 			if changedFile.fromNotOnFS && opts.AllowDeletions {
 				markDeployAction(ctx, changedFile.fromPath, "delete", commitFiles)
+			} else if changedFile.fromNotOnFS {
+				skipped.Add(deployment.SkipDeletion, changedFile.fromPath)
 			}
 
 			// Handle 'to' path
@@ -149,7 +154,17 @@ func ParseChangedFiles(ctx context.Context, changedFiles []GitChangedFileMetadat
 
 func markDeployAction(ctx context.Context, path str.LocalRepoPath, actionMode string, commitFiles map[str.LocalRepoPath]str.DeployAction) {
 	isDir := str.HasSuffix(path, filesystem.DirMetaFileName)
-	if isDir {
+	if isUserMetaFile(path) {
+		// Accounts are only removed when marked Absent, never because their file is gone
+		if actionMode == "delete" {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
+				"  User Metadata '%s': deleted, remote users and groups are left as they are\n", path)
+			return
+		}
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
+			"  User Metadata '%s': marking with action '%s'\n", path, deployment.ActionAccountsApply)
+		commitFiles[path] = deployment.ActionAccountsApply
+	} else if isDir {
 		var deployAction str.DeployAction
 		switch actionMode {
 		case "create":
@@ -178,9 +193,16 @@ func markDeployAction(ctx context.Context, path str.LocalRepoPath, actionMode st
 	}
 }
 
+// User metadata files are only recognized directly in a host (or universal) directory
+func isUserMetaFile(repoFilePath str.LocalRepoPath) (isUserMeta bool) {
+	topDirectory, fileName, hasDirectory := strings.Cut(string(repoFilePath), string(os.PathSeparator))
+	isUserMeta = hasDirectory && topDirectory != "" && str.LocalRepoPath(fileName) == filesystem.UserMetaFileName
+	return
+}
+
 // Retrieves all files for current commit (regardless if changed)
 // This is used to also get all files in commit for deployment of unchanged files when requested
-func GetRepoFiles(ctx context.Context, tree *object.Tree, fileOverride string) (commitFiles map[str.LocalRepoPath]str.DeployAction, err error) {
+func GetRepoFiles(ctx context.Context, skipped *deployment.SkipReport, tree *object.Tree, fileOverride string) (commitFiles map[str.LocalRepoPath]str.DeployAction, err error) {
 	config := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
 
 	// Initialize maps
@@ -213,8 +235,10 @@ func GetRepoFiles(ctx context.Context, tree *object.Tree, fileOverride string) (
 
 		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "  Filtering file %s\n", repoFilePath)
 
-		if !fileIsValid(ctx, repoFilePath, repoFile.Mode.String()) {
+		valid, skipReason := fileIsValid(ctx, repoFilePath, repoFile.Mode.String())
+		if !valid {
 			logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "    File not valid\n")
+			skipped.Add(skipReason, repoFilePath)
 			continue
 		}
 
@@ -227,8 +251,10 @@ func GetRepoFiles(ctx context.Context, tree *object.Tree, fileOverride string) (
 
 		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "    File available\n")
 
-		// Decide if file is dir metadata or actual config
-		if str.HasSuffix(repoFilePath, filesystem.DirMetaFileName) {
+		// Decide if file is dir metadata, user metadata, or actual config
+		if isUserMetaFile(repoFilePath) {
+			commitFiles[repoFilePath] = deployment.ActionAccountsApply
+		} else if str.HasSuffix(repoFilePath, filesystem.DirMetaFileName) {
 			commitFiles[repoFilePath] = deployment.ActionDirCreate
 		} else {
 			// Add repo file to the commit map with always create action
@@ -87,6 +87,39 @@ func TestParseChangedFiles(t *testing.T) {
 				"host2/opt/prog/" + filesystem.DirMetaFileName: deployment.ActionDirModify,
 			},
 		},
+		{
+			name: "Single - Modified User Meta",
+			changedFiles: []GitChangedFileMetadata{
+				{
+					fromNotOnFS: false,
+					fromPath:    str.LocalRepoPath("host1/" + filesystem.UserMetaFileName),
+					fromMode:    filemode.FileMode(uint32(0100644)),
+					toNotOnFS:   false,
+					toPath:      str.LocalRepoPath("host1/" + filesystem.UserMetaFileName),
+					toMode:      filemode.FileMode(uint32(0100644)),
+				},
+			},
+			fileOverride: "",
+			expectedCommitFiles: map[str.LocalRepoPath]str.DeployAction{
+				"host1/" + filesystem.UserMetaFileName: deployment.ActionAccountsApply,
+			},
+		},
+		{
+			name: "Single - Deleted User Meta",
+			changedFiles: []GitChangedFileMetadata{
+				{
+					fromNotOnFS: true,
+					fromPath:    str.LocalRepoPath("host1/" + filesystem.UserMetaFileName),
+					fromMode:    filemode.FileMode(uint32(0100644)),
+					toNotOnFS:   true,
+					toPath:      "",
+					toMode:      filemode.FileMode(0),
+				},
+			},
+			allowDeletions:      true,
+			fileOverride:        "",
+			expectedCommitFiles: map[str.LocalRepoPath]str.DeployAction{},
+		},
 		{
 			name: "Single - Moved to another host with deletions",
 			changedFiles: []GitChangedFileMetadata{
@@ -251,7 +284,7 @@ func TestParseChangedFiles(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			ctx = context.WithValue(ctx, global.OpsKey, config.Opts{AllowDeletions: test.allowDeletions})
 
-			commitFiles := ParseChangedFiles(ctx, test.changedFiles, test.fileOverride)
+			commitFiles := ParseChangedFiles(ctx, nil, test.changedFiles, test.fileOverride)
 
 			if !maps.Equal(test.expectedCommitFiles, commitFiles) {
 				t.Errorf("Expected metadata does not match output metadata:\nOutput:\n%#v\n\nExpected Output:\n%#v\n", commitFiles, test.expectedCommitFiles)
@@ -260,6 +293,74 @@ func TestParseChangedFiles(t *testing.T) {
 	}
 }
 
+func TestParseChangedFilesSkipReport(t *testing.T) {
+	var cfg config.Config
+	cfg.HostInfo = map[str.RepoRootDir]config.EndpointInfo{
+		"host1": {},
+	}
+
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.ConfKey, cfg)
+	ctx = context.WithValue(ctx, global.OpsKey, config.Opts{})
+
+	regularFile := filemode.FileMode(uint32(0100644))
+	changedFiles := []GitChangedFileMetadata{
+		{fromNotOnFS: true, toPath: "host1/etc/link", toMode: filemode.FileMode(uint32(0120000))},
+		{fromNotOnFS: true, toPath: "README.md", toMode: regularFile},
+		{fromNotOnFS: true, toPath: "_notes/todo.txt", toMode: regularFile},
+		{fromNotOnFS: true, toPath: "host9/etc/file1", toMode: regularFile},
+		{fromNotOnFS: true, toPath: "host9/etc/file2", toMode: regularFile},
+		{fromNotOnFS: true, toPath: "host9/etc/file3", toMode: regularFile},
+		{fromPath: "host1/etc/old.conf", fromMode: regularFile, toNotOnFS: true},
+		{fromNotOnFS: true, toPath: "host1/etc/new.conf", toMode: regularFile},
+	}
+
+	skipped := deployment.NewSkipReport()
+	commitFiles := ParseChangedFiles(ctx, skipped, changedFiles, "")
+	// Parsing the same files again must not count them twice
+	ParseChangedFiles(ctx, skipped, changedFiles, "")
+
+	if len(commitFiles) != 1 || commitFiles["host1/etc/new.conf"] != deployment.ActionFileCreate {
+		t.Errorf("expected only new.conf to be deployed, got '%v'", commitFiles)
+	}
+	if skipped.Count() != 7 {
+		t.Errorf("expected 7 skipped files, got %d", skipped.Count())
+	}
+
+	expectedCounts := map[string]int{
+		deployment.SkipUnsupportedMode:  1,
+		deployment.SkipRepoRoot:         1,
+		deployment.SkipIgnoreDirectory:  1,
+		deployment.SkipUnknownDirectory: 3,
+		deployment.SkipDeletion:         1,
+	}
+	summaries := skipped.Summarize(2)
+	if len(summaries) != len(expectedCounts) {
+		t.Fatalf("expected %d skip reasons, got '%+v'", len(expectedCounts), summaries)
+	}
+	for _, summary := range summaries {
+		if summary.Count != expectedCounts[summary.Reason] {
+			t.Errorf("reason '%s': expected count %d, got %d", summary.Reason, expectedCounts[summary.Reason], summary.Count)
+		}
+		if len(summary.Files)+summary.Unlisted != summary.Count || len(summary.Files) > 2 {
+			t.Errorf("reason '%s': expected listing capped at 2 with remaining unlisted, got '%+v'", summary.Reason, summary)
+		}
+	}
+
+	failOn, err := deployment.ParseSkipReasons("unknown-directory, repo-root")
+	if err != nil {
+		t.Fatalf("expected no error, got '%v'", err)
+	}
+	if skipped.CountReasons(failOn) != 4 {
+		t.Errorf("expected 4 files skipped for selected reasons, got %d", skipped.CountReasons(failOn))
+	}
+	_, err = deployment.ParseSkipReasons("unsupported mode")
+	if err == nil {
+		t.Errorf("expected error for unknown skip reason")
+	}
+}
+
 func TestMapFilesByHostOrUniversal(t *testing.T) {
 	// Initialize global config
 	config := config.Config{
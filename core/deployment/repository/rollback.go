@@ -11,10 +11,10 @@ import (
 )
 
 // Generates an inverse commit files map of a given commit file change list
-func GetRollbackFiles(ctx context.Context, changedFiles []GitChangedFileMetadata, fileOverride string) (commitFiles map[str.LocalRepoPath]str.DeployAction, err error) {
+func GetRollbackFiles(ctx context.Context, skipped *deployment.SkipReport, changedFiles []GitChangedFileMetadata, fileOverride string) (commitFiles map[str.LocalRepoPath]str.DeployAction, err error) {
 	commitFiles = make(map[str.LocalRepoPath]str.DeployAction)
 
-	fwdCommitFiles := ParseChangedFiles(ctx, changedFiles, fileOverride)
+	fwdCommitFiles := ParseChangedFiles(ctx, skipped, changedFiles, fileOverride)
 	for repoPath, action := range fwdCommitFiles {
 		// Creates become deletes
 		// Deletes become creates
@@ -39,6 +39,14 @@ func GetRollbackFiles(ctx context.Context, changedFiles []GitChangedFileMetadata
 			newAction = deployment.ActionSymLinkModify
 		case deployment.ActionSymLinkDelete:
 			newAction = deployment.ActionSymLinkCreate
+		case deployment.ActionAccountsApply:
+			// Previous definitions are applied again, accounts of a file new in the commit are left as they are
+			if !existedBefore(changedFiles, repoPath) {
+				logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
+					"Not inverting user metadata '%s': file is new in this commit\n", repoPath)
+				continue
+			}
+			newAction = deployment.ActionAccountsApply
 		}
 
 		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog,
@@ -49,6 +57,17 @@ func GetRollbackFiles(ctx context.Context, changedFiles []GitChangedFileMetadata
 	return
 }
 
+// Reports whether the path was present before the commit (it is the source of a change)
+func existedBefore(changedFiles []GitChangedFileMetadata, repoPath str.LocalRepoPath) (existed bool) {
+	for _, changedFile := range changedFiles {
+		if changedFile.fromPath == repoPath {
+			existed = true
+			return
+		}
+	}
+	return
+}
+
 // Retrieves the parent tree of the given commit
 func GetParentTree(commit *object.Commit) (parentTree *object.Tree, err error) {
 	parentCommit, err := commit.Parents().Next()
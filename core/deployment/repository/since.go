@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Commits of a time window, following first parents back from the newest commit
+type CommitRange struct {
+	Commits []*object.Commit // Newest first, empty when the newest commit is older than the window
+	Base    *object.Commit   // Newest commit before the window (nil when the window reaches the first commit)
+}
+
+// Collects commits from the given commit back until the first commit committed before the cutoff
+func GetCommitsSince(commit *object.Commit, cutoff time.Time) (commitRange CommitRange, err error) {
+	for commit != nil {
+		if commit.Committer.When.Before(cutoff) {
+			commitRange.Base = commit
+			return
+		}
+		commitRange.Commits = append(commitRange.Commits, commit)
+
+		if commit.NumParents() == 0 {
+			return
+		}
+		commit, err = commit.Parent(0)
+		if err != nil {
+			err = fmt.Errorf("failed retrieving parent of commit %s: %w", commitRange.Commits[len(commitRange.Commits)-1].Hash, err)
+			return
+		}
+	}
+	return
+}
+
+// Union of files changed by the commits of the range
+// The action of each file follows its final state: files in the newest commit are created or modified (compared to the base),
+// files only in the base are deleted, and files created and removed within the range are left out
+func GetChangedFilesSince(ctx context.Context, commitRange CommitRange) (changedFiles []GitChangedFileMetadata, err error) {
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSRepo)
+	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Retrieving changed files from %d commit(s)... \n", len(commitRange.Commits))
+
+	if len(commitRange.Commits) == 0 {
+		return
+	}
+
+	changedPaths := make(map[str.LocalRepoPath]struct{})
+	for _, commit := range commitRange.Commits {
+		var paths []str.LocalRepoPath
+		paths, err = commitChangedPaths(commit)
+		if err != nil {
+			err = fmt.Errorf("commit %s: %w", commit.Hash, err)
+			return
+		}
+		for _, path := range paths {
+			changedPaths[path] = struct{}{}
+		}
+	}
+
+	newestTree, err := commitRange.Commits[0].Tree()
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve commit tree: %w", err)
+		return
+	}
+	var baseTree *object.Tree
+	if commitRange.Base != nil {
+		baseTree, err = commitRange.Base.Tree()
+		if err != nil {
+			err = fmt.Errorf("failed to retrieve base commit tree: %w", err)
+			return
+		}
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(changedPaths)) {
+		var changedFile GitChangedFileMetadata
+
+		if baseTree != nil {
+			entry, lerr := baseTree.FindEntry(string(path))
+			if lerr == nil {
+				changedFile.fromPath = path
+				changedFile.fromMode = entry.Mode
+			} else if !errors.Is(lerr, object.ErrEntryNotFound) && !errors.Is(lerr, object.ErrDirectoryNotFound) {
+				err = fmt.Errorf("failed looking up '%s' in base commit: %w", path, lerr)
+				return
+			}
+		}
+
+		entry, lerr := newestTree.FindEntry(string(path))
+		if lerr == nil {
+			changedFile.toPath = path
+			changedFile.toMode = entry.Mode
+		} else if !errors.Is(lerr, object.ErrEntryNotFound) && !errors.Is(lerr, object.ErrDirectoryNotFound) {
+			err = fmt.Errorf("failed looking up '%s' in newest commit: %w", path, lerr)
+			return
+		}
+
+		if changedFile.fromPath == "" && changedFile.toPath == "" {
+			logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "  File '%s' was created and removed within the range\n", path)
+			continue
+		}
+		changedFiles = append(changedFiles, changedFile)
+	}
+	return
+}
+
+// Paths changed by a commit compared to its first parent (all paths for the first commit)
+func commitChangedPaths(commit *object.Commit) (paths []str.LocalRepoPath, err error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve commit tree: %w", err)
+		return
+	}
+
+	var parentTree *object.Tree
+	if commit.NumParents() > 0 {
+		var parent *object.Commit
+		parent, err = commit.Parent(0)
+		if err != nil {
+			err = fmt.Errorf("failed retrieving parent commit: %w", err)
+			return
+		}
+		parentTree, err = parent.Tree()
+		if err != nil {
+			err = fmt.Errorf("failed to retrieve parent commit tree: %w", err)
+			return
+		}
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		err = fmt.Errorf("failed retrieving difference between commits: %w", err)
+		return
+	}
+	for _, change := range changes {
+		if change.From.Name != "" {
+			paths = append(paths, str.LocalRepoPath(change.From.Name))
+		}
+		if change.To.Name != "" {
+			paths = append(paths, str.LocalRepoPath(change.To.Name))
+		}
+	}
+	return
+}
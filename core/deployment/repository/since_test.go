@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"scmp/internal/logctx"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestChangedFilesSince(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := git.PlainInit(repoPath, false)
+	if err != nil {
+		t.Fatalf("failed creating repository: %v", err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed opening worktree: %v", err)
+	}
+
+	now := time.Now()
+	var commits []*object.Commit
+	commitAt := func(when time.Time, files map[string]string) {
+		for path, content := range files {
+			fullPath := filepath.Join(repoPath, path)
+			if content == "" {
+				err = os.Remove(fullPath)
+			} else {
+				err = os.MkdirAll(filepath.Dir(fullPath), 0750)
+				if err == nil {
+					err = os.WriteFile(fullPath, []byte(content), 0640)
+				}
+			}
+			if err != nil {
+				t.Fatalf("failed changing file: %v", err)
+			}
+		}
+		err = worktree.AddWithOptions(&git.AddOptions{All: true})
+		if err != nil {
+			t.Fatalf("failed staging files: %v", err)
+		}
+		signature := &object.Signature{Name: "test", Email: "test@example.com", When: when}
+		hash, err := worktree.Commit("change", &git.CommitOptions{Author: signature, Committer: signature})
+		if err != nil {
+			t.Fatalf("failed committing: %v", err)
+		}
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			t.Fatalf("failed reading commit: %v", err)
+		}
+		commits = append(commits, commit)
+	}
+
+	commitAt(now.Add(-96*time.Hour), map[string]string{"web01/etc/old": "old\n", "web01/etc/kept": "kept\n", "web01/etc/removed": "removed\n"})
+	commitAt(now.Add(-30*time.Hour), map[string]string{"web01/etc/kept": "kept twice\n", "web01/etc/temporary": "temporary\n"})
+	commitAt(now.Add(-20*time.Hour), map[string]string{"web01/etc/removed": "", "web01/etc/temporary": "", "web01/etc/new": "new\n"})
+	commitAt(now.Add(-10*time.Hour), map[string]string{"web01/etc/kept": "kept thrice\n"})
+	head := commits[len(commits)-1]
+
+	// Window inside the history
+	commitRange, err := GetCommitsSince(head, now.Add(-48*time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(commitRange.Commits) != 3 || commitRange.Base == nil || commitRange.Base.Hash != commits[0].Hash {
+		t.Fatalf("expected 3 commits after the first commit, got %d (base %v)", len(commitRange.Commits), commitRange.Base)
+	}
+
+	ctx := logctx.New(t.Context(), logctx.NSTest, logctx.VerbosityNone, t.Context().Done())
+	changedFiles, err := GetChangedFilesSince(ctx, commitRange)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []GitChangedFileMetadata{
+		{fromPath: "web01/etc/kept", toPath: "web01/etc/kept"},
+		{toPath: "web01/etc/new"},
+		{fromPath: "web01/etc/removed"},
+	}
+	if len(changedFiles) != len(expected) {
+		t.Fatalf("expected %d changed files, got %+v", len(expected), changedFiles)
+	}
+	for index, changedFile := range changedFiles {
+		if changedFile.fromPath != expected[index].fromPath || changedFile.toPath != expected[index].toPath {
+			t.Errorf("file %d: expected %s -> %s, got %s -> %s", index, expected[index].fromPath, expected[index].toPath, changedFile.fromPath, changedFile.toPath)
+		}
+	}
+
+	// Window longer than the history has no base, every file is new
+	commitRange, err = GetCommitsSince(head, now.Add(-365*24*time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(commitRange.Commits) != 4 || commitRange.Base != nil {
+		t.Fatalf("expected all 4 commits without base, got %d (base %v)", len(commitRange.Commits), commitRange.Base)
+	}
+	changedFiles, err = GetChangedFilesSince(ctx, commitRange)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, changedFile := range changedFiles {
+		if changedFile.fromPath != "" {
+			t.Errorf("expected only new files without a base, got %s -> %s", changedFile.fromPath, changedFile.toPath)
+		}
+	}
+	if len(changedFiles) != 3 {
+		t.Errorf("expected the 3 files present at HEAD, got %+v", changedFiles)
+	}
+
+	// HEAD older than the window selects nothing
+	commitRange, err = GetCommitsSince(head, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(commitRange.Commits) != 0 || commitRange.Base == nil || commitRange.Base.Hash != head.Hash {
+		t.Fatalf("expected no commits with HEAD as base, got %d", len(commitRange.Commits))
+	}
+	changedFiles, err = GetChangedFilesSince(ctx, commitRange)
+	if err != nil || len(changedFiles) != 0 {
+		t.Errorf("expected no changed files, got %+v (%v)", changedFiles, err)
+	}
+}
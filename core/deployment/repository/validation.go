@@ -21,22 +21,26 @@ import (
 //	any files in the root of the repository
 //	dirs present in global ignoredirectories array
 //	dirs that do not have a match in the controllers config
-func fileIsValid(ctx context.Context, path str.LocalRepoPath, mode string) (valid bool) {
+//
+// Skip reason is empty when there is no file at the path
+func fileIsValid(ctx context.Context, path str.LocalRepoPath, mode string) (valid bool, skipReason string) {
 	logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "  Validating file %s\n", path)
 
-	// Retrieve the type for this file
-	fileType := parsing.DetermineFileType(mode)
-	if fileType == "unsupported" {
+	// File exists, but no path
+	if path == "" {
 		return
 	}
 
-	// File exists, but no path
-	if path == "" {
+	// Retrieve the type for this file
+	fileType := parsing.DetermineFileType(mode)
+	if fileType == "unsupported" {
+		skipReason = deployment.SkipUnsupportedMode
 		return
 	}
 
 	// Ensure path conforms to SCMP directory structure
-	if repoFileIsNotValid(ctx, path) {
+	skipReason = repoFileSkipReason(ctx, path)
+	if skipReason != "" {
 		return
 	}
 
@@ -52,6 +56,12 @@ func fileIsValid(ctx context.Context, path str.LocalRepoPath, mode string) (vali
 //  4. A file inside any directory (i.e. not a file just in root of repo)
 //  5. A file not inside any top level directory with prefix _ (excluding DRN)
 func repoFileIsNotValid(ctx context.Context, repoPath str.LocalRepoPath) (fileIsNotValid bool) {
+	fileIsNotValid = repoFileSkipReason(ctx, repoPath) != ""
+	return
+}
+
+// Reason a repository relative file path is not deployable (empty when valid)
+func repoFileSkipReason(ctx context.Context, repoPath str.LocalRepoPath) (skipReason string) {
 	config := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
 	ctx = logctx.AppendCtxTag(ctx, logctx.NSValidation)
 
@@ -63,14 +73,14 @@ func repoFileIsNotValid(ctx context.Context, repoPath str.LocalRepoPath) (fileIs
 
 	// Always ignore files in root of repository
 	if !strings.ContainsRune(string(repoPath), os.PathSeparator) {
-		fileIsNotValid = true
+		skipReason = deployment.SkipRepoRoot
 		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "    File is in root of repo, skipping\n")
 		return
 	}
 
 	// Always ignore (files under) directories with underscore prefix
 	if str.HasPrefix(repoPath, deployment.IgnoreDirectoryPrefix) {
-		fileIsNotValid = true
+		skipReason = deployment.SkipIgnoreDirectory
 		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "    File is in an ignore directory, skipping\n")
 		return
 	}
@@ -84,18 +94,16 @@ func repoFileIsNotValid(ctx context.Context, repoPath str.LocalRepoPath) (fileIs
 		// file top-level dir is a valid host or the universal directory
 		if topLevelDir == configHost || topLevelDir == config.UniversalDirectory {
 			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "    File is valid (Dir matches Hostname or is Universal Dir)\n")
-			fileIsNotValid = false
 			return
 		}
 	}
 	_, fileIsInUniversalGroup := config.AllUniversalGroups[topLevelDir]
 	if fileIsInUniversalGroup {
 		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "    File is valid (Dir matches a Universal Group Dir)\n")
-		fileIsNotValid = false
 		return
 	}
 
 	logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "    File is not under a valid host directory or a universal directory, skipping\n")
-	fileIsNotValid = true
+	skipReason = deployment.SkipUnknownDirectory
 	return
 }
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"scmp/internal/gitinternal"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Retrieves file paths and file mode of uncommitted changes (staged or not) against the given HEAD tree
+// Untracked files are only included once they are added to the worktree
+func GetWorktreeChanges(ctx context.Context, headTree *object.Tree) (changedFiles []GitChangedFileMetadata, err error) {
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSRepo)
+	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Retrieving changed files from worktree... \n")
+
+	repo, err := gitinternal.OpenRepository(ctx)
+	if err != nil {
+		return
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		err = fmt.Errorf("failed retrieving worktree: %w", err)
+		return
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		err = fmt.Errorf("failed retrieving worktree status: %w", err)
+		return
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(status)) {
+		fileStatus := status[path]
+		if fileStatus.Staging == git.Untracked {
+			continue
+		}
+		if fileStatus.Staging == git.Unmodified && fileStatus.Worktree == git.Unmodified {
+			continue
+		}
+
+		var changedFile GitChangedFileMetadata
+
+		// Committed side of the change
+		headFile, lerr := headTree.File(path)
+		if lerr == nil {
+			changedFile.fromPath = str.LocalRepoPath(path)
+			changedFile.fromMode = headFile.Mode
+		}
+
+		// On-disk side of the change
+		fileInfo, lerr := worktree.Filesystem.Lstat(path)
+		if lerr == nil {
+			changedFile.toPath = str.LocalRepoPath(path)
+			changedFile.toMode, err = filemode.NewFromOSFileMode(fileInfo.Mode())
+			if err != nil {
+				err = fmt.Errorf("failed retrieving mode of '%s': %w", path, err)
+				return
+			}
+		} else if !os.IsNotExist(lerr) {
+			err = fmt.Errorf("failed retrieving worktree file '%s': %w", path, lerr)
+			return
+		}
+
+		if changedFile.fromPath == "" && changedFile.toPath == "" {
+			continue
+		}
+		changedFiles = append(changedFiles, changedFile)
+	}
+	return
+}
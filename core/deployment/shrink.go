@@ -0,0 +1,11 @@
+package deployment
+
+// Percentage the content shrinks from the current to the new size, and if that is more than allowed (zero allowed never exceeds)
+func ShrinkExceeds(currentSize int, newSize int, maxShrinkPercent int) (shrinkPercent int, exceeds bool) {
+	if currentSize <= 0 || newSize >= currentSize {
+		return
+	}
+	shrinkPercent = (currentSize - newSize) * 100 / currentSize
+	exceeds = maxShrinkPercent > 0 && shrinkPercent > maxShrinkPercent
+	return
+}
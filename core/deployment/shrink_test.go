@@ -0,0 +1,29 @@
+package deployment
+
+import "testing"
+
+func TestShrinkExceeds(t *testing.T) {
+	tests := []struct {
+		name            string
+		currentSize     int
+		newSize         int
+		maxShrink       int
+		expectedPercent int
+		expectedExceeds bool
+	}{
+		{"truncated file", 1000, 75, 50, 92, true},
+		{"shrink within limit", 1000, 600, 50, 40, false},
+		{"guard disabled", 1000, 75, 0, 92, false},
+		{"grown file", 100, 200, 10, 0, false},
+		{"empty remote file", 0, 10, 10, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			shrinkPercent, exceeds := ShrinkExceeds(test.currentSize, test.newSize, test.maxShrink)
+			if shrinkPercent != test.expectedPercent || exceeds != test.expectedExceeds {
+				t.Errorf("expected %d%% (exceeds %t), got %d%% (exceeds %t)", test.expectedPercent, test.expectedExceeds, shrinkPercent, exceeds)
+			}
+		})
+	}
+}
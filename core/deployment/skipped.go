@@ -0,0 +1,132 @@
+package deployment
+
+import (
+	"fmt"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Files left out of a deployment while parsing and filtering the repository, grouped by reason
+type SkipReport struct {
+	mutex sync.Mutex
+	files map[string]map[str.LocalRepoPath]struct{} // Key on skip reason, each file is only recorded once per reason
+}
+
+// Skipped files of a single reason, listing is capped to keep output readable on large repositories
+type SkipSummary struct {
+	Reason      string              `json:"Reason"`
+	Description string              `json:"Description"`
+	Count       int                 `json:"Count"`
+	Files       []str.LocalRepoPath `json:"Files"`
+	Unlisted    int                 `json:"Unlisted,omitempty"` // Files over the listing limit
+}
+
+func NewSkipReport() (report *SkipReport) {
+	report = &SkipReport{
+		files: make(map[string]map[str.LocalRepoPath]struct{}),
+	}
+	return
+}
+
+// Records a skipped file (no-op on nil report or empty reason)
+func (report *SkipReport) Add(reason string, repoFilePath str.LocalRepoPath) {
+	if report == nil || reason == "" || repoFilePath == "" {
+		return
+	}
+
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	if report.files[reason] == nil {
+		report.files[reason] = make(map[str.LocalRepoPath]struct{})
+	}
+	report.files[reason][repoFilePath] = struct{}{}
+}
+
+// Total skipped files across all reasons
+func (report *SkipReport) Count() (count int) {
+	if report == nil {
+		return
+	}
+
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	for _, files := range report.files {
+		count += len(files)
+	}
+	return
+}
+
+// Skipped files per reason (in skip reason order), listing at most listLimit files per reason (0 or less lists all)
+func (report *SkipReport) Summarize(listLimit int) (summaries []SkipSummary) {
+	if report == nil {
+		return
+	}
+
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	for _, reason := range SkipReasons {
+		files := report.files[reason]
+		if len(files) == 0 {
+			continue
+		}
+
+		summary := SkipSummary{
+			Reason:      reason,
+			Description: SkipReasonDescriptions[reason],
+			Count:       len(files),
+		}
+		for file := range files {
+			summary.Files = append(summary.Files, file)
+		}
+		slices.Sort(summary.Files)
+
+		if listLimit > 0 && len(summary.Files) > listLimit {
+			summary.Unlisted = len(summary.Files) - listLimit
+			summary.Files = summary.Files[:listLimit]
+		}
+		summaries = append(summaries, summary)
+	}
+	return
+}
+
+// Count of skipped files for any of the given reasons
+func (report *SkipReport) CountReasons(reasons []string) (count int) {
+	if report == nil {
+		return
+	}
+
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	for _, reason := range reasons {
+		count += len(report.files[reason])
+	}
+	return
+}
+
+// Parses comma separated skip reason names (or 'all')
+func ParseSkipReasons(reasonList string) (reasons []string, err error) {
+	for reason := range strings.SplitSeq(reasonList, ",") {
+		reason = strings.TrimSpace(reason)
+		if reason == "" {
+			continue
+		}
+		if reason == "all" {
+			reasons = slices.Clone(SkipReasons)
+			return
+		}
+		if !slices.Contains(SkipReasons, reason) {
+			err = fmt.Errorf("unknown skip reason '%s', expected one of 'all', '%s'", reason, strings.Join(SkipReasons, "', '"))
+			return
+		}
+		if !slices.Contains(reasons, reason) {
+			reasons = append(reasons, reason)
+		}
+	}
+	return
+}
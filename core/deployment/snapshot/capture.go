@@ -0,0 +1,122 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"scmp/core/deployment"
+	"scmp/core/deployment/remote"
+	"scmp/internal/config"
+	"scmp/internal/crypto"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/parsing"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Captures the remote state of every planned item of a host into the host snapshot directory
+// Only items in the host's plan are captured, content of files over maxFileSize is skipped and noted
+func Capture(ctx context.Context, host sshinternal.HostMeta, hostFiles *deployment.HostFiles, hostDirectory string, id string, phase string, maxFileSize int64) (manifest Manifest, err error) {
+	manifest = Manifest{
+		ID:      id,
+		Host:    host.Name,
+		Phase:   phase,
+		Created: time.Now().UTC(),
+	}
+
+	for _, entry := range PlannedEntries(hostFiles) {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("stop requested during snapshot: %w", context.Cause(ctx))
+			return
+		}
+
+		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Capturing %s-deployment state of '%s'\n", phase, entry.TargetPath)
+		entry, err = captureEntry(ctx, host, hostDirectory, id, entry, maxFileSize)
+		if err != nil {
+			err = fmt.Errorf("failed snapshot of '%s': %w", entry.TargetPath, err)
+			return
+		}
+		if entry.Skipped != "" {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog, "Snapshot of '%s' has no content: %s\n", entry.TargetPath, entry.Skipped)
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+
+	err = Save(hostDirectory, manifest)
+	return
+}
+
+// Remote paths of a host's plan in path order (an item planned by more than one repository file is captured once)
+func PlannedEntries(hostFiles *deployment.HostFiles) (entries []Entry) {
+	seenTargets := make(map[str.RemotePath]struct{})
+	for _, repoFilePath := range hostFiles.GetUnorderedList() {
+		info := hostFiles.GetFileInfo(repoFilePath)
+		if _, seen := seenTargets[info.TargetFilePath]; seen || info.TargetFilePath == "" {
+			continue
+		}
+		seenTargets[info.TargetFilePath] = struct{}{}
+		entries = append(entries, Entry{RepoFilePath: repoFilePath, TargetPath: info.TargetFilePath})
+	}
+	slices.SortFunc(entries, func(a, b Entry) int {
+		return strings.Compare(string(a.TargetPath), string(b.TargetPath))
+	})
+	return
+}
+
+// Records metadata of a single remote item and saves the content of regular files
+func captureEntry(ctx context.Context, host sshinternal.HostMeta, hostDirectory string, id string, entry Entry, maxFileSize int64) (captured Entry, err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+	captured = entry
+
+	exists, statOutput, err := sshinternal.CheckRemoteFileDirExistence(ctx, host, entry.TargetPath)
+	if err != nil {
+		err = fmt.Errorf("failed checking presence on remote host: %w", err)
+		return
+	}
+	if !exists {
+		return
+	}
+
+	remoteMetadata, err := sshinternal.ExtractMetadataFromStat(statOutput)
+	if err != nil {
+		return
+	}
+	captured.Exists = true
+	captured.Type = remoteMetadata.FsType
+	captured.OwnerGroup = remoteMetadata.Owner + ":" + remoteMetadata.Group
+	captured.Permissions = remoteMetadata.Permissions
+	captured.Size = remoteMetadata.Size
+	captured.LinkTarget = remoteMetadata.LinkTarget
+
+	switch remoteMetadata.FsType {
+	case remote.FileType, remote.FileEmptyType:
+	case remote.DirType, remote.SymlinkType:
+		return // Metadata is the whole state
+	default:
+		captured.Skipped = fmt.Sprintf("unsupported remote type '%s'", remoteMetadata.FsType)
+		return
+	}
+
+	if maxFileSize > 0 && int64(remoteMetadata.Size) > maxFileSize {
+		captured.Skipped = fmt.Sprintf("larger than snapshot size limit of %s", parsing.FormatBytes(int(maxFileSize)))
+		return
+	}
+
+	command := sshinternal.BuildCat(entry.TargetPath)
+	command.DisableSudo = opts.DisableSudo
+	command.RunAsUser = opts.RunAsUser
+	remoteContent, err := command.SSHexec(ctx, host.SSHClient, host.Password)
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve remote content: %w", err)
+		return
+	}
+
+	content := []byte(remoteContent)
+	captured.Size = len(content)
+	captured.Hash = str.FileID(crypto.SHA256Sum(content))
+	err = SaveContent(hostDirectory, id, captured.Hash, content)
+	return
+}
@@ -0,0 +1,14 @@
+package snapshot
+
+const (
+	PhasePre  string = "pre"  // Remote state captured before any change on the host
+	PhasePost string = "post" // Remote state captured after the host deployment finished
+
+	DefaultDirectoryName string = "scmp-snapshots" // Default snapshot directory name (in config directory)
+	DefaultMaxFileSizeMB int    = 16               // Default largest remote file whose content is captured
+	DefaultRetention     int    = 10               // Default snapshots kept per host
+
+	idTimeFormat      string = "20060102T150405.000Z" // Snapshot IDs sort in the order they were taken
+	manifestExtension string = ".json"
+	contentDirectory  string = "content" // Captured content shared by both phases, named by hash
+)
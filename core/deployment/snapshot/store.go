@@ -0,0 +1,217 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"scmp/core/deployment/remote"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Snapshot ID for a deployment started at the given time
+func NewID(start time.Time) (id string) {
+	id = start.UTC().Format(idTimeFormat)
+	return
+}
+
+// Rejects IDs that would leave the host snapshot directory
+func validateID(id string) (err error) {
+	if id == "" || id == "." || id == ".." || filepath.Base(id) != id {
+		err = fmt.Errorf("invalid snapshot ID '%s'", id)
+		return
+	}
+	return
+}
+
+// Writes the manifest of one phase, content must already be saved
+func Save(hostDirectory string, manifest Manifest) (err error) {
+	err = validateID(manifest.ID)
+	if err != nil {
+		return
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		err = fmt.Errorf("failed to marshal snapshot manifest: %w", err)
+		return
+	}
+
+	snapshotDirectory := filepath.Join(hostDirectory, manifest.ID)
+	err = os.MkdirAll(snapshotDirectory, 0700)
+	if err != nil {
+		err = fmt.Errorf("failed to create snapshot directory: %w", err)
+		return
+	}
+
+	err = os.WriteFile(filepath.Join(snapshotDirectory, manifest.Phase+manifestExtension), manifestJSON, 0600)
+	if err != nil {
+		err = fmt.Errorf("failed to write snapshot manifest: %w", err)
+		return
+	}
+	return
+}
+
+// Reads the manifest of one phase of a snapshot
+func Load(hostDirectory string, id string, phase string) (manifest Manifest, err error) {
+	err = validateID(id)
+	if err != nil {
+		return
+	}
+
+	manifestJSON, err := os.ReadFile(filepath.Join(hostDirectory, id, phase+manifestExtension))
+	if errors.Is(err, fs.ErrNotExist) {
+		err = fmt.Errorf("snapshot '%s' has no %s-deployment manifest", id, phase)
+		return
+	} else if err != nil {
+		err = fmt.Errorf("failed to read snapshot manifest: %w", err)
+		return
+	}
+
+	err = json.Unmarshal(manifestJSON, &manifest)
+	if err != nil {
+		err = fmt.Errorf("invalid snapshot manifest: %w", err)
+		return
+	}
+	return
+}
+
+// Stores captured content once per snapshot (both phases share identical content)
+func SaveContent(hostDirectory string, id string, hash str.FileID, content []byte) (err error) {
+	contentPath := filepath.Join(hostDirectory, id, contentDirectory, string(hash))
+	_, err = os.Stat(contentPath)
+	if err == nil {
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(contentPath), 0700)
+	if err != nil {
+		err = fmt.Errorf("failed to create snapshot content directory: %w", err)
+		return
+	}
+
+	err = os.WriteFile(contentPath, content, 0600)
+	if err != nil {
+		err = fmt.Errorf("failed to write snapshot content: %w", err)
+		return
+	}
+	return
+}
+
+// Reads captured content by hash
+func ReadContent(hostDirectory string, id string, hash str.FileID) (content []byte, err error) {
+	err = validateID(id)
+	if err != nil {
+		return
+	}
+	if filepath.Base(string(hash)) != string(hash) {
+		err = fmt.Errorf("invalid snapshot content hash '%s'", hash)
+		return
+	}
+
+	content, err = os.ReadFile(filepath.Join(hostDirectory, id, contentDirectory, string(hash)))
+	if err != nil {
+		err = fmt.Errorf("failed to read snapshot content: %w", err)
+		return
+	}
+	return
+}
+
+// Lists snapshots of a host, oldest first
+func List(hostDirectory string) (snapshots []Info, err error) {
+	dirEntries, err := os.ReadDir(hostDirectory)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+		return
+	} else if err != nil {
+		err = fmt.Errorf("failed to read snapshot directory: %w", err)
+		return
+	}
+
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		info := Info{ID: dirEntry.Name()}
+		for _, phase := range []string{PhasePre, PhasePost} {
+			manifest, lerr := Load(hostDirectory, info.ID, phase)
+			if lerr != nil {
+				continue
+			}
+			info.Phases = append(info.Phases, phase)
+			if phase != PhasePre {
+				continue
+			}
+			info.Entries = len(manifest.Entries)
+			for _, entry := range manifest.Entries {
+				if entry.Skipped != "" {
+					info.Skipped++
+				}
+			}
+		}
+		snapshots = append(snapshots, info)
+	}
+	slices.SortFunc(snapshots, func(a, b Info) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return
+}
+
+// Removes the oldest snapshots of a host beyond the retention count (zero keeps all)
+func Prune(hostDirectory string, keep int) (removed []string, err error) {
+	if keep <= 0 {
+		return
+	}
+
+	snapshots, err := List(hostDirectory)
+	if err != nil {
+		return
+	}
+	if len(snapshots) <= keep {
+		return
+	}
+
+	for _, snapshot := range snapshots[:len(snapshots)-keep] {
+		err = os.RemoveAll(filepath.Join(hostDirectory, snapshot.ID))
+		if err != nil {
+			err = fmt.Errorf("failed to remove snapshot '%s': %w", snapshot.ID, err)
+			return
+		}
+		removed = append(removed, snapshot.ID)
+	}
+	return
+}
+
+// Last recorded remote size of every file in the snapshots of a host (newest snapshot and phase wins)
+func LastKnownSizes(hostDirectory string) (sizes map[str.RemotePath]KnownSize, err error) {
+	snapshots, err := List(hostDirectory)
+	if err != nil {
+		return
+	}
+
+	sizes = make(map[str.RemotePath]KnownSize)
+	for _, info := range slices.Backward(snapshots) {
+		for _, phase := range []string{PhasePost, PhasePre} {
+			manifest, lerr := Load(hostDirectory, info.ID, phase)
+			if lerr != nil {
+				continue
+			}
+			for _, entry := range manifest.Entries {
+				if !entry.Exists || entry.Type == remote.DirType || entry.Type == remote.SymlinkType {
+					continue
+				}
+				_, newerKnown := sizes[entry.TargetPath]
+				if newerKnown {
+					continue
+				}
+				sizes[entry.TargetPath] = KnownSize{Size: entry.Size, SnapshotID: info.ID}
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,150 @@
+package snapshot
+
+import (
+	"maps"
+	"scmp/core/deployment"
+	"scmp/internal/str"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSaveLoadContent(t *testing.T) {
+	hostDirectory := t.TempDir()
+	id := NewID(time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC))
+
+	manifest := Manifest{ID: id, Host: "host1", Phase: PhasePre, Entries: []Entry{
+		{TargetPath: "/etc/a.conf", Exists: true, Type: "regular file", Hash: "abc", Size: 5},
+		{TargetPath: "/etc/b.conf"},
+	}}
+	err := SaveContent(hostDirectory, id, "abc", []byte("hello"))
+	if err != nil {
+		t.Fatalf("unexpected error saving content: %v", err)
+	}
+	err = Save(hostDirectory, manifest)
+	if err != nil {
+		t.Fatalf("unexpected error saving manifest: %v", err)
+	}
+
+	loaded, err := Load(hostDirectory, id, PhasePre)
+	if err != nil {
+		t.Fatalf("unexpected error loading manifest: %v", err)
+	}
+	if len(loaded.Entries) != 2 || loaded.Entries[0].Hash != "abc" || loaded.Entries[1].Exists {
+		t.Errorf("loaded manifest does not match saved: %+v", loaded)
+	}
+
+	content, err := ReadContent(hostDirectory, id, "abc")
+	if err != nil || string(content) != "hello" {
+		t.Errorf("expected content 'hello', got '%s' (%v)", content, err)
+	}
+
+	_, err = Load(hostDirectory, id, PhasePost)
+	if err == nil {
+		t.Errorf("expected error loading missing phase")
+	}
+	_, err = Load(hostDirectory, "../"+id, PhasePre)
+	if err == nil {
+		t.Errorf("expected error loading ID outside host directory")
+	}
+	_, err = ReadContent(hostDirectory, id, "../pre.json")
+	if err == nil {
+		t.Errorf("expected error reading hash outside content directory")
+	}
+}
+
+func TestListPrune(t *testing.T) {
+	hostDirectory := t.TempDir()
+	start := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	var ids []string
+	for index := range 4 {
+		id := NewID(start.Add(time.Duration(index) * time.Minute))
+		ids = append(ids, id)
+		err := Save(hostDirectory, Manifest{ID: id, Phase: PhasePre, Entries: []Entry{{TargetPath: "/etc/a.conf", Skipped: "too large"}}})
+		if err != nil {
+			t.Fatalf("unexpected error saving manifest: %v", err)
+		}
+	}
+	err := Save(hostDirectory, Manifest{ID: ids[3], Phase: PhasePost})
+	if err != nil {
+		t.Fatalf("unexpected error saving manifest: %v", err)
+	}
+
+	snapshots, err := List(hostDirectory)
+	if err != nil {
+		t.Fatalf("unexpected error listing: %v", err)
+	}
+	if len(snapshots) != 4 || snapshots[0].ID != ids[0] {
+		t.Fatalf("expected 4 snapshots oldest first, got %+v", snapshots)
+	}
+	if !slices.Equal(snapshots[3].Phases, []string{PhasePre, PhasePost}) || snapshots[3].Entries != 1 || snapshots[3].Skipped != 1 {
+		t.Errorf("unexpected info for newest snapshot: %+v", snapshots[3])
+	}
+
+	removed, err := Prune(hostDirectory, 0)
+	if err != nil || len(removed) != 0 {
+		t.Errorf("expected zero retention to keep all, removed %v (%v)", removed, err)
+	}
+
+	removed, err = Prune(hostDirectory, 2)
+	if err != nil {
+		t.Fatalf("unexpected error pruning: %v", err)
+	}
+	if !slices.Equal(removed, ids[:2]) {
+		t.Errorf("expected oldest snapshots %v removed, got %v", ids[:2], removed)
+	}
+	snapshots, _ = List(hostDirectory)
+	if len(snapshots) != 2 || snapshots[0].ID != ids[2] {
+		t.Errorf("expected newest 2 snapshots kept, got %+v", snapshots)
+	}
+}
+
+func TestPlannedEntries(t *testing.T) {
+	hostFiles, err := deployment.NewHostFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hostFiles.SetFileMetadata("host1/etc/b.conf", deployment.FileInfo{TargetFilePath: "/etc/b.conf"})
+	hostFiles.SetFileMetadata("host1/etc/a.conf", deployment.FileInfo{TargetFilePath: "/etc/a.conf"})
+	hostFiles.SetFileMetadata("UniversalConfs/etc/a.conf", deployment.FileInfo{TargetFilePath: "/etc/a.conf"})
+
+	entries := PlannedEntries(hostFiles)
+	var targets []str.RemotePath
+	for _, entry := range entries {
+		targets = append(targets, entry.TargetPath)
+	}
+	if !slices.Equal(targets, []str.RemotePath{"/etc/a.conf", "/etc/b.conf"}) {
+		t.Errorf("expected each target once in path order, got %v", targets)
+	}
+}
+
+func TestLastKnownSizes(t *testing.T) {
+	hostDirectory := t.TempDir()
+	older := NewID(time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC))
+	newer := NewID(time.Date(2025, 3, 5, 5, 6, 7, 0, time.UTC))
+
+	manifests := []Manifest{
+		{ID: older, Phase: PhasePre, Entries: []Entry{{TargetPath: "/etc/a.conf", Exists: true, Type: "regular file", Size: 100}, {TargetPath: "/etc/b.conf", Exists: true, Type: "regular file", Size: 40}}},
+		{ID: newer, Phase: PhasePre, Entries: []Entry{{TargetPath: "/etc/a.conf", Exists: true, Type: "regular file", Size: 200}, {TargetPath: "/etc/c.conf"}}},
+		{ID: newer, Phase: PhasePost, Entries: []Entry{{TargetPath: "/etc/a.conf", Exists: true, Type: "regular file", Size: 300}, {TargetPath: "/etc/d", Exists: true, Type: "directory", Size: 4096}}},
+	}
+	for _, manifest := range manifests {
+		err := Save(hostDirectory, manifest)
+		if err != nil {
+			t.Fatalf("unexpected error saving manifest: %v", err)
+		}
+	}
+
+	sizes, err := LastKnownSizes(hostDirectory)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[str.RemotePath]KnownSize{
+		"/etc/a.conf": {Size: 300, SnapshotID: newer},
+		"/etc/b.conf": {Size: 40, SnapshotID: older},
+	}
+	if !maps.Equal(sizes, expected) {
+		t.Errorf("expected newest file sizes %v, got %v", expected, sizes)
+	}
+}
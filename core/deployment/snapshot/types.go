@@ -0,0 +1,44 @@
+// Package for local copies of the remote state of planned files around a deployment
+package snapshot
+
+import (
+	"scmp/internal/str"
+	"time"
+)
+
+// Remote state of every planned item of one host at one point of a deployment
+type Manifest struct {
+	ID      string          `json:"id"`
+	Host    str.RepoRootDir `json:"host"`
+	Phase   string          `json:"phase"`
+	Created time.Time       `json:"created"`
+	Entries []Entry         `json:"entries"`
+}
+
+// Remote state of a single planned item
+type Entry struct {
+	RepoFilePath str.LocalRepoPath `json:"repoFilePath"`
+	TargetPath   str.RemotePath    `json:"targetPath"`
+	Exists       bool              `json:"exists"`
+	Type         string            `json:"type,omitempty"`
+	OwnerGroup   string            `json:"ownerGroup,omitempty"`
+	Permissions  int               `json:"permissions,omitempty"`
+	Size         int               `json:"size,omitempty"`
+	Hash         str.FileID        `json:"hash,omitempty"`
+	LinkTarget   str.RemotePath    `json:"linkTarget,omitempty"`
+	Skipped      string            `json:"skipped,omitempty"` // Reason the content was not captured
+}
+
+// Last remote size of a file recorded in any snapshot of a host
+type KnownSize struct {
+	Size       int
+	SnapshotID string
+}
+
+// Phases saved for a single snapshot of a host
+type Info struct {
+	ID      string
+	Phases  []string
+	Entries int // Items in the pre-deployment manifest
+	Skipped int // Items in the pre-deployment manifest without captured content
+}
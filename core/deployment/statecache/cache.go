@@ -0,0 +1,153 @@
+package statecache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"scmp/internal/str"
+)
+
+// Reads the cache file, a missing file is an empty cache
+func Load(path string) (cache *Cache, err error) {
+	cache = &Cache{
+		path:  path,
+		hosts: make(map[str.RepoRootDir]map[str.RemotePath]Entry),
+	}
+
+	cacheJSON, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+		return
+	} else if err != nil {
+		err = fmt.Errorf("failed to read state cache: %w", err)
+		return
+	}
+
+	err = json.Unmarshal(cacheJSON, &cache.hosts)
+	if err != nil {
+		err = fmt.Errorf("invalid state cache file '%s' (remove it to start over): %w", path, err)
+		return
+	}
+	if cache.hosts == nil {
+		cache.hosts = make(map[str.RepoRootDir]map[str.RemotePath]Entry)
+	}
+	return
+}
+
+// Writes the cache file when anything changed since Load
+func (cache *Cache) Save() (err error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if !cache.changed {
+		return
+	}
+
+	cacheJSON, err := json.MarshalIndent(cache.hosts, "", "  ")
+	if err != nil {
+		err = fmt.Errorf("failed to marshal state cache: %w", err)
+		return
+	}
+
+	// Replaced atomically so an interrupted write never leaves a truncated cache
+	cacheFile, err := os.CreateTemp(filepath.Dir(cache.path), filepath.Base(cache.path)+".tmp-*")
+	if err != nil {
+		err = fmt.Errorf("failed to create state cache: %w", err)
+		return
+	}
+	tempPath := cacheFile.Name()
+	defer func() {
+		if err != nil {
+			_ = cacheFile.Close()
+			_ = os.Remove(tempPath)
+		}
+	}()
+
+	_, err = cacheFile.Write(cacheJSON)
+	if err != nil {
+		return
+	}
+	err = cacheFile.Chmod(fileMode)
+	if err != nil {
+		return
+	}
+	err = cacheFile.Close()
+	if err != nil {
+		return
+	}
+	err = os.Rename(tempPath, cache.path)
+	if err != nil {
+		return
+	}
+	cache.changed = false
+	return
+}
+
+// Reports whether the target was last deployed with exactly this state
+// Safe to call on a nil cache
+func (cache *Cache) Matches(host str.RepoRootDir, targetPath str.RemotePath, state Entry) (matches bool) {
+	if cache == nil {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	entry, exists := cache.hosts[host][targetPath]
+	matches = exists && entry == state
+	return
+}
+
+// Records the state the target now has on the host
+func (cache *Cache) Record(host str.RepoRootDir, targetPath str.RemotePath, state Entry) {
+	if cache == nil {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if cache.hosts[host] == nil {
+		cache.hosts[host] = make(map[str.RemotePath]Entry)
+	}
+	if cache.hosts[host][targetPath] == state {
+		return
+	}
+	cache.hosts[host][targetPath] = state
+	cache.changed = true
+}
+
+// Forgets the target, its remote state is unknown
+func (cache *Cache) Remove(host str.RepoRootDir, targetPath str.RemotePath) {
+	if cache == nil {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	_, exists := cache.hosts[host][targetPath]
+	if !exists {
+		return
+	}
+	delete(cache.hosts[host], targetPath)
+	if len(cache.hosts[host]) == 0 {
+		delete(cache.hosts, host)
+	}
+	cache.changed = true
+}
+
+// Forgets every target of the host
+func (cache *Cache) InvalidateHost(host str.RepoRootDir) {
+	if cache == nil {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	_, exists := cache.hosts[host]
+	if !exists {
+		return
+	}
+	delete(cache.hosts, host)
+	cache.changed = true
+}
@@ -0,0 +1,96 @@
+package statecache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheRoundTrip(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), FileName)
+
+	cache, err := Load(cachePath)
+	if err != nil {
+		t.Fatalf("unexpected error loading missing cache: %v", err)
+	}
+	state := Entry{Hash: "abc", Permissions: 644, OwnerGroup: "root:root"}
+	if cache.Matches("web01", "/etc/hosts", state) {
+		t.Errorf("expected empty cache to match nothing")
+	}
+
+	// Nothing recorded, nothing written
+	err = cache.Save()
+	if err != nil {
+		t.Fatalf("unexpected error saving: %v", err)
+	}
+	_, err = os.Stat(cachePath)
+	if !os.IsNotExist(err) {
+		t.Errorf("expected unchanged cache not to be written")
+	}
+
+	cache.Record("web01", "/etc/hosts", state)
+	cache.Record("web01", "/etc/motd", Entry{Hash: "def", Permissions: 644, OwnerGroup: "root:root"})
+	cache.Record("db01", "/etc/hosts", state)
+	err = cache.Save()
+	if err != nil {
+		t.Fatalf("unexpected error saving: %v", err)
+	}
+
+	loaded, err := Load(cachePath)
+	if err != nil {
+		t.Fatalf("unexpected error loading: %v", err)
+	}
+	if !loaded.Matches("web01", "/etc/hosts", state) || !loaded.Matches("db01", "/etc/hosts", state) {
+		t.Errorf("expected recorded states to match after reload")
+	}
+
+	// Any difference in content or metadata needs remote verification
+	for _, changed := range []Entry{
+		{Hash: "other", Permissions: 644, OwnerGroup: "root:root"},
+		{Hash: "abc", Permissions: 600, OwnerGroup: "root:root"},
+		{Hash: "abc", Permissions: 644, OwnerGroup: "www-data:www-data"},
+	} {
+		if loaded.Matches("web01", "/etc/hosts", changed) {
+			t.Errorf("expected %+v not to match cached %+v", changed, state)
+		}
+	}
+
+	loaded.Remove("web01", "/etc/motd")
+	loaded.InvalidateHost("db01")
+	err = loaded.Save()
+	if err != nil {
+		t.Fatalf("unexpected error saving: %v", err)
+	}
+	reloaded, err := Load(cachePath)
+	if err != nil {
+		t.Fatalf("unexpected error loading: %v", err)
+	}
+	if reloaded.Matches("db01", "/etc/hosts", state) {
+		t.Errorf("expected invalidated host to match nothing")
+	}
+	if reloaded.Matches("web01", "/etc/motd", Entry{Hash: "def", Permissions: 644, OwnerGroup: "root:root"}) {
+		t.Errorf("expected removed target to match nothing")
+	}
+	if !reloaded.Matches("web01", "/etc/hosts", state) {
+		t.Errorf("expected other entries of the host kept")
+	}
+
+	// Nil cache is never trusted
+	var nilCache *Cache
+	nilCache.Record("web01", "/etc/hosts", state)
+	if nilCache.Matches("web01", "/etc/hosts", state) {
+		t.Errorf("expected nil cache to match nothing")
+	}
+}
+
+func TestCacheInvalidFile(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), FileName)
+	err := os.WriteFile(cachePath, []byte("{not json"), 0600)
+	if err != nil {
+		t.Fatalf("failed writing cache file: %v", err)
+	}
+	_, err = Load(cachePath)
+	if err == nil {
+		t.Errorf("expected error loading corrupt cache")
+	}
+}
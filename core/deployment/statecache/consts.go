@@ -0,0 +1,8 @@
+package statecache
+
+import "os"
+
+const (
+	FileName string      = ".scmp-state-cache.json" // State cache file name (in config directory)
+	fileMode os.FileMode = 0600
+)
@@ -0,0 +1,22 @@
+// Package for the local record of what was last deployed to each host, used to skip remote verification of unchanged files
+package statecache
+
+import (
+	"scmp/internal/str"
+	"sync"
+)
+
+// Last deployed state of one target file
+type Entry struct {
+	Hash        str.FileID `json:"hash"`
+	Permissions int        `json:"permissions"`
+	OwnerGroup  string     `json:"ownerGroup"`
+}
+
+// Deployed file states by host and target path, safe for concurrent hosts
+type Cache struct {
+	path    string
+	hosts   map[str.RepoRootDir]map[str.RemotePath]Entry
+	changed bool
+	mutex   sync.Mutex
+}
@@ -10,6 +10,7 @@ import (
 type AllFiles struct {
 	metadata map[str.LocalRepoPath]FileInfo
 	data     map[str.FileID][]byte
+	streams  map[str.FileID]StreamedContent // Content too large to hold in memory
 	mutex    sync.RWMutex
 }
 
@@ -18,9 +19,16 @@ type HostFiles struct {
 	Groups   []*FileGroup
 	metadata map[str.LocalRepoPath]FileInfo
 	data     map[str.FileID][]byte
+	streams  map[str.FileID]StreamedContent // Content too large to hold in memory
 	mutex    sync.RWMutex
 }
 
+// File content left on local disk and read in chunks when transferred
+type StreamedContent struct {
+	LocalPath string // Absolute path to local file
+	Size      int64
+}
+
 // Represents files to be deployed in serial for a given host
 type FileGroup struct {
 	list              []str.LocalRepoPath                             // Ordered list of files to deploy together
@@ -29,6 +37,7 @@ type FileGroup struct {
 	reloadIDfileCount map[str.ReloadID]int                            // Total files in reload group
 	reloadIDcommands  map[str.ReloadID]map[str.LocalRepoPath][]string // Ordered list of reload commands per file
 	reloadIDpostinst  map[str.ReloadID]map[str.LocalRepoPath][]string // Ordered list of post-install commands
+	phase             string                                          // Deployment phase all files of the group belong to
 	mutex             sync.RWMutex
 }
 
@@ -48,11 +57,26 @@ type FileInfo struct {
 	InstallOptional   bool
 	Install           []string
 	PostInstall       []string
+	InstallOnce       bool // Install commands run only until a remote marker records them as run
 	PreapplyRequired  bool
 	Preapply          []string
 	PostapplyRequired bool
 	Postapply         []string
+	PreChecks         []string // Preconditions run before any backup or transfer
+	PostChecks        []string // Validation run after placement, restores the file on failure
 	ReloadRequired    bool
 	Reload            []string
-	ReloadGroup       str.ReloadID // Named string defined by user to manually group files together
+	ReloadGroup       str.ReloadID      // Named string defined by user to manually group files together
+	ReloadMaxHosts    int               // Hosts allowed to run reloads of the named group at the same time (0 keeps groups per-host)
+	BackupStyle       string            // Location/naming of remote backup for this file
+	Condition         string            // Host fact condition required to deploy this file (empty always deploys)
+	MaxShrinkPercent  int               // Largest allowed content shrink against the remote file before it is held (0 disables)
+	Replacement       bool              // Replacement requested for this deployment, never held for shrinking
+	MetadataOnly      bool              // Only the metadata header changed since the parent commit, content is not backed up or transferred when the remote content matches
+	TemplateEngine    string            // Engine rendering the content per host (empty deploys content as committed)
+	Phase             string            // Deployment phase of the file on the host (empty is the configure phase)
+	ACLs              []string          // Extended ACL entries set after permissions (setfacl -m syntax)
+	SELinuxContext    string            // SELinux context set after permissions (empty leaves the context alone)
+	Xattrs            map[string]string // Extended attributes set after placement, compared against the remote file
+	Encrypted         bool              // Content is stored encrypted in the repository (held here decrypted)
 }
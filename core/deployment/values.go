@@ -0,0 +1,41 @@
+package deployment
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Values file macro ({@VAR:name}) replaced in file metadata commands, templated file content, and exec commands
+var valueMacroPattern = regexp.MustCompile(`\{@VAR:([A-Za-z0-9_.-]+)\}`)
+
+// Replaces values file macros with the host values, names without a value are left in place and returned
+func ExpandValueMacros(text string, values map[string]string) (expanded string, unresolved []string) {
+	expanded = valueMacroPattern.ReplaceAllStringFunc(text, func(macro string) string {
+		name := valueMacroPattern.FindStringSubmatch(macro)[1]
+		value, defined := values[name]
+		if !defined {
+			if !slices.Contains(unresolved, name) {
+				unresolved = append(unresolved, name)
+			}
+			return macro
+		}
+		return value
+	})
+	return
+}
+
+// Error listing every unresolved value name with the hosts missing it (nil when all names resolved)
+func UnresolvedValuesError(unresolved map[string][]string) (err error) {
+	if len(unresolved) == 0 {
+		return
+	}
+	var missing []string
+	for _, name := range slices.Sorted(maps.Keys(unresolved)) {
+		missing = append(missing, fmt.Sprintf("%s (host(s) %s)", name, strings.Join(unresolved[name], ", ")))
+	}
+	err = fmt.Errorf("unresolved value(s): %s", strings.Join(missing, "; "))
+	return
+}
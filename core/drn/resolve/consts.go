@@ -7,6 +7,8 @@ const (
 	headerPostInstall string = "PostInstall"
 	headerPreapply    string = "Preapply"
 	headerPostapply   string = "Postapply"
+	headerPreChecks   string = "PreChecks"
+	headerPostChecks  string = "PostChecks"
 	headerReload      string = "Reloads"
 	headerDeps        string = "Dependencies"
 )
@@ -20,6 +20,8 @@ func (replacer *Replacer) ExtractHeaderDRNs(hostAlias str.RepoRootDir, file str.
 		headerPostInstall: header.PostInstall,
 		headerPreapply:    header.Preapply,
 		headerPostapply:   header.Postapply,
+		headerPreChecks:   header.PreChecks,
+		headerPostChecks:  header.PostChecks,
 		headerReload:      header.Reload,
 	}
 
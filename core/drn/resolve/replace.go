@@ -17,6 +17,8 @@ func (replacer *Replacer) ReplaceHeaderDRNs(hostAlias str.RepoRootDir, file str.
 		headerPostInstall: header.PostInstall,
 		headerPreapply:    header.Preapply,
 		headerPostapply:   header.Postapply,
+		headerPreChecks:   header.PreChecks,
+		headerPostChecks:  header.PostChecks,
 		headerReload:      header.Reload,
 	}
 
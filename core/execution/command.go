@@ -3,7 +3,9 @@ package execution
 import (
 	"context"
 	"fmt"
+	"maps"
 	"os"
+	"scmp/core/deployment"
 	"scmp/core/deployment/predeploy"
 	"scmp/internal/config"
 	"scmp/internal/global"
@@ -12,15 +14,13 @@ import (
 	"scmp/internal/secrets"
 	"scmp/internal/sshinternal"
 	"scmp/internal/str"
+	"slices"
 	"sync"
+	"time"
 )
 
-// Global for script execution concurrency
-var executionErrors string
-var executionErrorsMutex sync.Mutex
-
 // Run a single adhoc command on requested hosts
-func runCmd(ctx context.Context, command string, hosts string) {
+func runCmd(ctx context.Context, command string, hosts string) (err error) {
 	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
 	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
 
@@ -32,15 +32,21 @@ func runCmd(ctx context.Context, command string, hosts string) {
 		os.Exit(1)
 	}
 
-	var err error
+	// Values file macros resolve per host before any host is contacted
+	hostCommands, err := expandHostCommands(ctx, command, hosts)
+	if err != nil {
+		return
+	}
 
 	// Retrieve keys and passwords for any hosts that require it
+	var selectedHosts []string
 	for endpointName := range cfg.HostInfo {
 		// Only retrieve for hosts specified
 		if parsing.CheckForOverride(ctx, hosts, string(endpointName), cfg.HostInfo) {
 			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "  Skipping host %s, not desired\n", endpointName)
 			continue
 		}
+		selectedHosts = append(selectedHosts, string(endpointName))
 
 		// Retrieve host secrets
 		cfg.HostInfo[endpointName], err = secrets.GetHostValues(ctx, cfg.HostInfo[endpointName])
@@ -50,15 +56,13 @@ func runCmd(ctx context.Context, command string, hosts string) {
 		}
 
 		// Retrieve proxy secrets (if proxy is needed)
-		proxyName := cfg.HostInfo[endpointName].Proxy
-		if proxyName != "" {
-			cfg.HostInfo[str.RepoRootDir(proxyName)], err = secrets.GetHostValues(ctx, cfg.HostInfo[str.RepoRootDir(proxyName)])
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error retrieving proxy secrets: %v\n", err)
-				os.Exit(1)
-			}
+		err = secrets.GetProxyValues(ctx, cfg.HostInfo, endpointName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error retrieving proxy secrets: %v\n", err)
+			os.Exit(1)
 		}
 	}
+	parsing.LogSelection(ctx, "host", hosts, selectedHosts)
 
 	logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.InfoLog, "Executing command '%s' on host(s) '%s'\n", command, hosts)
 
@@ -66,6 +70,7 @@ func runCmd(ctx context.Context, command string, hosts string) {
 	semaphore := make(chan struct{}, opts.MaxSSHConcurrency)
 
 	// Loop hosts chosen by user and prepare relevant host information for deployment
+	var results resultCollector
 	var wg sync.WaitGroup
 	for endpointName := range cfg.HostInfo {
 		skipHost := parsing.CheckForOverride(ctx, hosts, string(endpointName), cfg.HostInfo)
@@ -80,28 +85,63 @@ func runCmd(ctx context.Context, command string, hosts string) {
 			continue
 		}
 
+		if results.halted(ctx) {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "  Skipping host %s, execution failed on another host\n", endpointName)
+			continue
+		}
+
 		// Retrieve proxy secrets (if proxy is needed)
-		proxyName := cfg.HostInfo[endpointName].Proxy
-		if proxyName != "" {
-			cfg.HostInfo[str.RepoRootDir(proxyName)], err = secrets.GetHostValues(ctx, cfg.HostInfo[str.RepoRootDir(proxyName)])
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error retrieving proxy secrets: %v\n", err)
-				os.Exit(1)
-			}
+		err = secrets.GetProxyValues(ctx, cfg.HostInfo, endpointName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error retrieving proxy secrets: %v\n", err)
+			os.Exit(1)
 		}
 
 		// Run the command
 		wg.Add(1)
+		streamOutput := opts.MaxSSHConcurrency <= 1 && opts.OutputDirectory == ""
 		if opts.MaxSSHConcurrency > 1 {
-			go executeCommand(ctx, &wg, semaphore, cfg.HostInfo[endpointName], cfg.HostInfo[str.RepoRootDir(proxyName)], command, false)
+			go executeCommand(ctx, &wg, semaphore, &results, cfg.HostInfo[endpointName], cfg.ProxyChainInfo(endpointName), hostCommands[endpointName], streamOutput)
 		} else {
-			executeCommand(ctx, &wg, semaphore, cfg.HostInfo[endpointName], cfg.HostInfo[str.RepoRootDir(proxyName)], command, true)
+			executeCommand(ctx, &wg, semaphore, &results, cfg.HostInfo[endpointName], cfg.ProxyChainInfo(endpointName), hostCommands[endpointName], streamOutput)
 		}
 	}
 	wg.Wait()
+
+	if opts.OutputDirectory != "" && !opts.DryRunEnabled && !opts.WetRunEnabled {
+		err = results.writeOutputDirectory(opts.OutputDirectory)
+		if err != nil {
+			return
+		}
+	}
+	err = results.err()
+	return
 }
 
-func executeCommand(ctx context.Context, wg *sync.WaitGroup, semaphore chan struct{}, hostInfo config.EndpointInfo, proxyInfo config.EndpointInfo, command string, streamOutput bool) {
+// Command of every selected host with values file macros replaced, unresolved names of all hosts are reported together
+func expandHostCommands(ctx context.Context, command string, hosts string) (hostCommands map[str.RepoRootDir]string, err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	hostCommands = make(map[str.RepoRootDir]string)
+	unresolved := make(map[string][]string) // value name -> hosts missing it
+	for _, endpointName := range slices.Sorted(maps.Keys(cfg.HostInfo)) {
+		if parsing.CheckForOverride(ctx, hosts, string(endpointName), cfg.HostInfo) {
+			continue
+		}
+
+		expanded, missing := deployment.ExpandValueMacros(command, opts.Values.ForHost(endpointName))
+		for _, name := range missing {
+			unresolved[name] = append(unresolved[name], string(endpointName))
+		}
+		hostCommands[endpointName] = expanded
+	}
+
+	err = deployment.UnresolvedValuesError(unresolved)
+	return
+}
+
+func executeCommand(ctx context.Context, wg *sync.WaitGroup, semaphore chan struct{}, results *resultCollector, hostInfo config.EndpointInfo, proxyChain []config.EndpointInfo, command string, streamOutput bool) {
 	// Signal routine is done after return
 	defer wg.Done()
 
@@ -109,13 +149,23 @@ func executeCommand(ctx context.Context, wg *sync.WaitGroup, semaphore chan stru
 	semaphore <- struct{}{}
 	defer func() { <-semaphore }() // Release the token when the goroutine finishes
 
+	ctx = logctx.WithHost(ctx, string(hostInfo.EndpointName))
+
 	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
 
+	// Hosts waiting on the semaphore do not start once execution is halted
+	if results.halted(ctx) {
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "  Skipping host %s, execution failed on another host\n", hostInfo.EndpointName)
+		return
+	}
+	startTime := time.Now()
+
 	// Connect to the SSH server
-	client, proxyClient, err := sshinternal.ConnectToSSH(ctx, hostInfo, proxyInfo)
+	client, proxyClient, _, err := sshinternal.ConnectToSSH(ctx, hostInfo, proxyChain)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to connect to host: %v\n", err)
-		os.Exit(1)
+		logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.ErrorLog, "  Host '%s': Failed to connect to host: %v\n", hostInfo.EndpointName, err)
+		results.record(newHostResult(hostInfo.EndpointName, sshinternal.CommandCapture{}, startTime, err))
+		return
 	}
 	defer func() {
 		if proxyClient != nil {
@@ -136,29 +186,32 @@ func executeCommand(ctx context.Context, wg *sync.WaitGroup, semaphore chan stru
 
 	// Execute user command
 	var cmdOutput string
+	var capture sshinternal.CommandCapture
 	rawCmd := sshinternal.RemoteCommand{
 		Raw:          command,
 		RunAsUser:    opts.RunAsUser,
 		DisableSudo:  opts.DisableSudo,
 		Timeout:      opts.ExecutionTimeout,
 		StreamStdout: streamOutput,
+		Capture:      &capture,
+		RequestPTY:   opts.RequestPTY || hostInfo.RequestTTY,
 	}
 	if streamOutput {
 		logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.InfoLog, "  Host '%s':\n", hostInfo.EndpointName)
-		_, err = rawCmd.SSHexec(ctx, client, hostInfo.Password)
+		_, err = rawCmd.SSHexec(ctx, client, hostInfo.SudoPassword)
 	} else {
-		cmdOutput, err = rawCmd.SSHexec(ctx, client, hostInfo.Password)
+		cmdOutput, err = rawCmd.SSHexec(ctx, client, hostInfo.SudoPassword)
 	}
+	result := newHostResult(hostInfo.EndpointName, capture, startTime, err)
+	results.record(result)
 	if err != nil {
-		if opts.ForceEnabled {
-			logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.ErrorLog, " %v\n", err)
-		} else {
-			fmt.Fprintf(os.Stderr, "Command Failed: %v\n", err)
-			os.Exit(1)
-		}
+		logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.ErrorLog, "  Host '%s': Command Failed: %v\n", hostInfo.EndpointName, err)
+		return
 	}
 
-	if cmdOutput != "" {
+	if opts.OutputDirectory != "" {
+		logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.InfoLog, "  Host '%s': Command Completed Successfully (%dms)\n", hostInfo.EndpointName, result.DurationMs)
+	} else if cmdOutput != "" {
 		logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.InfoLog, "  Host '%s':\n%s\n", hostInfo.EndpointName, cmdOutput)
 	} else {
 		logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.InfoLog, "  Host '%s': Command Completed Successfully\n\n", hostInfo.EndpointName)
@@ -0,0 +1,173 @@
+package execution
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"scmp/internal/config"
+	"scmp/internal/config/sshconfig"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Starts an SSH server accepting the password and recording exec commands, returns its address and host key
+func serveTestExec(t *testing.T, password string, commands *[]string, mutex *sync.Mutex) (endpoint string, hostKey ssh.PublicKey) {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("failed creating host key signer: %v", err)
+	}
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, secret []byte) (*ssh.Permissions, error) {
+			if string(secret) != password {
+				return nil, errors.New("wrong password")
+			}
+			return nil, nil
+		},
+	}
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed starting ssh server: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(requests)
+				for newChannel := range channels {
+					channel, channelRequests, err := newChannel.Accept()
+					if err != nil {
+						continue
+					}
+					go func() {
+						for request := range channelRequests {
+							if request.Type != "exec" {
+								_ = request.Reply(false, nil)
+								continue
+							}
+							command := string(request.Payload[4:])
+							_ = request.Reply(true, nil)
+
+							mutex.Lock()
+							*commands = append(*commands, command)
+							mutex.Unlock()
+
+							_, _ = channel.Write([]byte("up 3 days\n"))
+							_, _ = channel.SendRequest("exit-status", false, binary.BigEndian.AppendUint32(nil, 0))
+							_ = channel.Close()
+						}
+					}()
+				}
+			}()
+		}
+	}()
+
+	endpoint = listener.Addr().String()
+	hostKey = signer.PublicKey()
+	return
+}
+
+// Host only defined in the SSH config (no repository directory) is selected and connected to by exec
+func TestRunCmdConfigOnlyHost(t *testing.T) {
+	const password string = "password1"
+	t.Setenv("SCMP_TEST_LAB01_PASSWORD", password)
+
+	var commands []string
+	var mutex sync.Mutex
+	serverEndpoint, hostKey := serveTestExec(t, password, &commands, &mutex)
+	serverHost, serverPort, err := net.SplitHostPort(serverEndpoint)
+	if err != nil {
+		t.Fatalf("invalid server address: %v", err)
+	}
+
+	// Repository containing a directory for host1 but none for lab01
+	repoPath := t.TempDir()
+	for _, dir := range []string{".git", "host1/etc"} {
+		err = os.MkdirAll(filepath.Join(repoPath, dir), 0700)
+		if err != nil {
+			t.Fatalf("failed creating repository directory: %v", err)
+		}
+	}
+	t.Chdir(repoPath)
+
+	configDir := t.TempDir()
+	knownHost := knownhosts.HashHostname("lab01") + " " + hostKey.Type() + " " + base64.StdEncoding.EncodeToString(hostKey.Marshal()) + "\n"
+	err = os.WriteFile(filepath.Join(configDir, "known_hosts"), []byte(knownHost), 0600)
+	if err != nil {
+		t.Fatalf("failed writing known_hosts: %v", err)
+	}
+	sshConfig := "IgnoreUnknown UniversalDirectory\n" +
+		"UniversalDirectory UniversalConfs\n" +
+		"Host host1\n  Hostname 192.0.2.1\n  Port 22\n  User deployer\n" +
+		fmt.Sprintf("Host lab01\n  Hostname %s\n  Port %s\n  User root\n  PasswordEnv SCMP_TEST_LAB01_PASSWORD\n", serverHost, serverPort)
+	configPath := filepath.Join(configDir, "config")
+	err = os.WriteFile(configPath, []byte(sshConfig), 0600)
+	if err != nil {
+		t.Fatalf("failed writing SSH config: %v", err)
+	}
+
+	outputDir := filepath.Join(t.TempDir(), "out")
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.OpsKey, config.Opts{
+		MaxSSHConcurrency: 2,
+		ExecutionTimeout:  10,
+		DisableSudo:       true,
+		OutputDirectory:   outputDir,
+	})
+	ctx, err = sshconfig.Set(ctx, configPath)
+	if err != nil {
+		t.Fatalf("unexpected config error: %v", err)
+	}
+
+	err = runCmd(ctx, "uptime", "lab01")
+	if err != nil {
+		t.Fatalf("expected command to succeed on config-only host, got '%v'", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(commands) != 1 || !strings.Contains(commands[0], "uptime") {
+		t.Errorf("expected a single 'uptime' command on lab01, got %v", commands)
+	}
+	hostOutput, err := os.ReadFile(filepath.Join(outputDir, "lab01"+hostOutputSuffix))
+	if err != nil {
+		t.Fatalf("expected output file of lab01: %v", err)
+	}
+	if !strings.Contains(string(hostOutput), "up 3 days") {
+		t.Errorf("expected command output in lab01 output file, got '%s'", hostOutput)
+	}
+	_, err = os.Stat(filepath.Join(outputDir, "host1"+hostOutputSuffix))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected host1 not selected, got '%v'", err)
+	}
+}
@@ -0,0 +1,11 @@
+package execution
+
+import "os"
+
+const (
+	ResultsFileName   string      = "results.json" // Combined results of all hosts inside the output directory
+	hostOutputSuffix  string      = ".out"         // Per-host output file suffix inside the output directory
+	resultOutputLimit int         = 1024 * 1024    // Bytes of each output stream kept per host in the combined results
+	outputDirMode     os.FileMode = 0750
+	outputFileMode    os.FileMode = 0640
+)
@@ -4,12 +4,16 @@ package execution
 import (
 	"context"
 	"fmt"
+	"scmp/internal/config"
+	"scmp/internal/global"
 	"scmp/internal/parsing"
 	"scmp/internal/str"
 	"strings"
 )
 
 func CLIEntry(ctx context.Context, executeCommands, hostOverride, remoteFileOverride string) (err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
 	// Pull contents of out file URIs
 	hostOverride, err = parsing.RetrieveURIFile(ctx, hostOverride)
 	if err != nil {
@@ -21,11 +25,16 @@ func CLIEntry(ctx context.Context, executeCommands, hostOverride, remoteFileOver
 		err = fmt.Errorf("failed to parse local-files URI: %w", err)
 		return
 	}
+	err = parsing.ValidateOverride(opts.RegexEnabled, hostOverride)
+	if err != nil {
+		err = fmt.Errorf("remote-hosts: %w", err)
+		return
+	}
 
 	if strings.HasPrefix(executeCommands, "file:") {
-		runScript(ctx, executeCommands, hostOverride, str.RemotePath(remoteFileOverride))
+		err = runScript(ctx, executeCommands, hostOverride, str.RemotePath(remoteFileOverride))
 	} else if executeCommands != "" {
-		runCmd(ctx, executeCommands, hostOverride)
+		err = runCmd(ctx, executeCommands, hostOverride)
 	}
 	return
 }
@@ -0,0 +1,159 @@
+package execution
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Builds the result of a host from its captured output and the error of its execution
+func newHostResult(hostName str.RepoRootDir, capture sshinternal.CommandCapture, startTime time.Time, err error) (result hostResult) {
+	result = hostResult{
+		Host:       hostName,
+		DurationMs: time.Since(startTime).Milliseconds(),
+		Stdout:     capture.Stdout,
+		Stderr:     capture.Stderr,
+	}
+	if err == nil {
+		return
+	}
+
+	result.Error = err.Error()
+	result.ExitCode = sshinternal.ExitCodeNone
+	var commandErr *sshinternal.CommandError
+	if errors.As(err, &commandErr) {
+		result.ExitCode = commandErr.ExitCode
+	}
+	return
+}
+
+func (result hostResult) succeeded() (success bool) {
+	success = result.ExitCode == 0 && result.Error == ""
+	return
+}
+
+func (collector *resultCollector) record(result hostResult) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	collector.results = append(collector.results, result)
+	if !result.succeeded() {
+		collector.failed = true
+	}
+}
+
+// Reports whether no further hosts should start
+// Stops after the first failure with --fail-fast, or in sequential runs without --force
+func (collector *resultCollector) halted(ctx context.Context) (stop bool) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	stop = collector.failed && (opts.FailFast || (opts.MaxSSHConcurrency <= 1 && !opts.ForceEnabled))
+	return
+}
+
+// Error naming every failed host, nil when all hosts succeeded
+func (collector *resultCollector) err() (err error) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	var failedHosts []string
+	for _, result := range collector.results {
+		if !result.succeeded() {
+			failedHosts = append(failedHosts, string(result.Host))
+		}
+	}
+	if len(failedHosts) == 0 {
+		return
+	}
+	sort.Strings(failedHosts)
+	err = fmt.Errorf("execution failed on %d host(s): %s", len(failedHosts), strings.Join(failedHosts, ", "))
+	return
+}
+
+// Writes the complete output of each host to <host>.out and the combined results of all hosts to results.json
+func (collector *resultCollector) writeOutputDirectory(outputDir string) (err error) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	err = os.MkdirAll(outputDir, outputDirMode)
+	if err != nil {
+		err = fmt.Errorf("failed to create output directory: %w", err)
+		return
+	}
+
+	results := make([]hostResult, 0, len(collector.results))
+	for _, result := range collector.results {
+		hostFile := filepath.Join(outputDir, string(result.Host)+hostOutputSuffix)
+		err = os.WriteFile(hostFile, formatHostOutput(result), outputFileMode)
+		if err != nil {
+			err = fmt.Errorf("failed to write output of host '%s': %w", result.Host, err)
+			return
+		}
+
+		var stdoutCut, stderrCut bool
+		result.Stdout, stdoutCut = truncateOutput(result.Stdout)
+		result.Stderr, stderrCut = truncateOutput(result.Stderr)
+		result.Truncated = stdoutCut || stderrCut
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Host < results[j].Host
+	})
+
+	resultsJSON, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		err = fmt.Errorf("failed to marshal execution results: %w", err)
+		return
+	}
+	err = os.WriteFile(filepath.Join(outputDir, ResultsFileName), append(resultsJSON, '\n'), outputFileMode)
+	if err != nil {
+		err = fmt.Errorf("failed to write execution results: %w", err)
+		return
+	}
+	return
+}
+
+// Plain text host output file contents
+func formatHostOutput(result hostResult) (output []byte) {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "host: %s\n", result.Host)
+	fmt.Fprintf(&builder, "exit code: %d\n", result.ExitCode)
+	fmt.Fprintf(&builder, "duration: %s\n", time.Duration(result.DurationMs)*time.Millisecond)
+	if result.Error != "" {
+		fmt.Fprintf(&builder, "error: %s\n", strings.TrimSpace(result.Error))
+	}
+	fmt.Fprintf(&builder, "\n--- stdout ---\n%s", result.Stdout)
+	if result.Stdout != "" && !strings.HasSuffix(result.Stdout, "\n") {
+		builder.WriteString("\n")
+	}
+	fmt.Fprintf(&builder, "--- stderr ---\n%s", result.Stderr)
+	if result.Stderr != "" && !strings.HasSuffix(result.Stderr, "\n") {
+		builder.WriteString("\n")
+	}
+	output = []byte(builder.String())
+	return
+}
+
+// Leading bytes of output within the combined results limit
+func truncateOutput(output string) (kept string, truncated bool) {
+	kept = output
+	if len(kept) <= resultOutputLimit {
+		return
+	}
+	kept = strings.ToValidUTF8(kept[:resultOutputLimit], "")
+	truncated = true
+	return
+}
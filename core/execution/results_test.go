@@ -0,0 +1,114 @@
+package execution
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/sshinternal"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResultCollectorOutputDirectory(t *testing.T) {
+	outputDir := filepath.Join(t.TempDir(), "out")
+	longOutput := strings.Repeat("x", resultOutputLimit+10)
+
+	var results resultCollector
+	results.record(newHostResult("web01", sshinternal.CommandCapture{Stdout: "active\n"}, time.Now(), nil))
+	results.record(newHostResult("web02", sshinternal.CommandCapture{Stdout: longOutput, Stderr: "unit not found\n"}, time.Now(),
+		&sshinternal.CommandError{Command: "journalctl", ExitCode: 3, Err: errors.New("Process exited with status 3")}))
+	results.record(newHostResult("web03", sshinternal.CommandCapture{}, time.Now(), errors.New("connection refused")))
+
+	err := results.writeOutputDirectory(outputDir)
+	if err != nil {
+		t.Fatalf("unexpected error writing output directory: %v", err)
+	}
+
+	resultsJSON, err := os.ReadFile(filepath.Join(outputDir, ResultsFileName))
+	if err != nil {
+		t.Fatalf("failed reading results: %v", err)
+	}
+	var written []hostResult
+	err = json.Unmarshal(resultsJSON, &written)
+	if err != nil {
+		t.Fatalf("invalid results JSON: %v", err)
+	}
+	if len(written) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(written))
+	}
+
+	expected := []struct {
+		host      string
+		exitCode  int
+		truncated bool
+	}{
+		{"web01", 0, false},
+		{"web02", 3, true},
+		{"web03", sshinternal.ExitCodeNone, false},
+	}
+	for index, want := range expected {
+		got := written[index]
+		if string(got.Host) != want.host || got.ExitCode != want.exitCode || got.Truncated != want.truncated {
+			t.Errorf("result %d: expected host %s exit %d truncated %t, got host %s exit %d truncated %t",
+				index, want.host, want.exitCode, want.truncated, got.Host, got.ExitCode, got.Truncated)
+		}
+	}
+	if len(written[1].Stdout) != resultOutputLimit {
+		t.Errorf("expected stdout cut to %d bytes, got %d", resultOutputLimit, len(written[1].Stdout))
+	}
+	if written[2].Error != "connection refused" {
+		t.Errorf("expected connection error recorded, got %q", written[2].Error)
+	}
+
+	// Host output files keep the complete output
+	hostOutput, err := os.ReadFile(filepath.Join(outputDir, "web02"+hostOutputSuffix))
+	if err != nil {
+		t.Fatalf("failed reading host output: %v", err)
+	}
+	if !strings.Contains(string(hostOutput), "exit code: 3\n") || !strings.Contains(string(hostOutput), longOutput+"\n--- stderr ---\nunit not found\n") {
+		t.Errorf("unexpected host output file contents:\n%.200s", hostOutput)
+	}
+
+	err = results.err()
+	if err == nil || !strings.Contains(err.Error(), "2 host(s): web02, web03") {
+		t.Errorf("expected error naming failed hosts, got %v", err)
+	}
+}
+
+func TestResultCollectorHalted(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       config.Opts
+		expectHalt bool
+	}{
+		{"concurrent keeps going", config.Opts{MaxSSHConcurrency: 10}, false},
+		{"concurrent fail fast", config.Opts{MaxSSHConcurrency: 10, FailFast: true}, true},
+		{"sequential stops", config.Opts{MaxSSHConcurrency: 1}, true},
+		{"sequential forced", config.Opts{MaxSSHConcurrency: 1, ForceEnabled: true}, false},
+		{"forced fail fast", config.Opts{MaxSSHConcurrency: 1, ForceEnabled: true, FailFast: true}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := t.Context()
+			ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+			ctx = context.WithValue(ctx, global.OpsKey, test.opts)
+
+			var results resultCollector
+			results.record(newHostResult("web01", sshinternal.CommandCapture{}, time.Now(), nil))
+			if results.halted(ctx) {
+				t.Errorf("expected no halt after success")
+			}
+			results.record(newHostResult("web02", sshinternal.CommandCapture{}, time.Now(), errors.New("failed")))
+			if results.halted(ctx) != test.expectHalt {
+				t.Errorf("expected halted %t", test.expectHalt)
+			}
+		})
+	}
+}
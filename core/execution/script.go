@@ -18,12 +18,11 @@ import (
 	"scmp/internal/str"
 	"strings"
 	"sync"
-
-	"golang.org/x/crypto/ssh"
+	"time"
 )
 
 // Run a script on host(s)
-func runScript(ctx context.Context, scriptFile string, hosts string, remoteFilePath str.RemotePath) {
+func runScript(ctx context.Context, scriptFile string, hosts string, remoteFilePath str.RemotePath) (err error) {
 	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
 	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
 
@@ -33,7 +32,7 @@ func runScript(ctx context.Context, scriptFile string, hosts string, remoteFileP
 	localScriptFilePath := strings.TrimPrefix(scriptFile, global.FileURIPrefix)
 
 	// Check for ~/ and expand if required
-	localScriptFilePath, err := fsops.ExpandHomeDirectory(localScriptFilePath)
+	localScriptFilePath, err = fsops.ExpandHomeDirectory(localScriptFilePath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to resolve absolute path for '%s': %v\n", localScriptFilePath, err)
 		os.Exit(1)
@@ -87,12 +86,14 @@ func runScript(ctx context.Context, scriptFile string, hosts string, remoteFileP
 	}
 
 	// Retrieve keys and passwords for any hosts that require it
+	var selectedHosts []string
 	for endpointName := range cfg.HostInfo {
 		// Only retrieve for hosts specified
 		if parsing.CheckForOverride(ctx, hosts, string(endpointName), cfg.HostInfo) {
 			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "  Skipping host %s, not desired\n", endpointName)
 			continue
 		}
+		selectedHosts = append(selectedHosts, string(endpointName))
 
 		// Retrieve host secrets
 		cfg.HostInfo[endpointName], err = secrets.GetHostValues(ctx, cfg.HostInfo[endpointName])
@@ -102,21 +103,20 @@ func runScript(ctx context.Context, scriptFile string, hosts string, remoteFileP
 		}
 
 		// Retrieve proxy secrets (if proxy is needed)
-		proxyName := cfg.HostInfo[endpointName].Proxy
-		if proxyName != "" {
-			cfg.HostInfo[str.RepoRootDir(proxyName)], err = secrets.GetHostValues(ctx, cfg.HostInfo[str.RepoRootDir(proxyName)])
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error retrieving proxy secrets: %v\n", err)
-				os.Exit(1)
-			}
+		err = secrets.GetProxyValues(ctx, cfg.HostInfo, endpointName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error retrieving proxy secrets: %v\n", err)
+			os.Exit(1)
 		}
 	}
+	parsing.LogSelection(ctx, "host", hosts, selectedHosts)
 
 	if opts.WetRunEnabled {
 		logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.InfoLog, "Wet-run enabled. Connections and uploads will be tested but script will NOT be executed\n")
 	}
 
 	// Run script per host
+	var results resultCollector
 	var wg sync.WaitGroup
 	for endpointName := range cfg.HostInfo {
 		// Only run against hosts specified
@@ -131,31 +131,34 @@ func runScript(ctx context.Context, scriptFile string, hosts string, remoteFileP
 			continue
 		}
 
-		proxyName := cfg.HostInfo[endpointName].Proxy
+		if results.halted(ctx) {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "  Skipping host %s, execution failed on another host\n", endpointName)
+			continue
+		}
 
 		// Upload and execute the script - disable concurrency if maxconns is 1
 		wg.Add(1)
+		streamOutput := opts.MaxSSHConcurrency <= 1 && opts.OutputDirectory == ""
 		if opts.MaxSSHConcurrency > 1 {
-			go executeScriptOnHost(ctx, &wg, semaphore, cfg.HostInfo[endpointName], cfg.HostInfo[str.RepoRootDir(proxyName)], scriptInterpreter, remoteFilePath, scriptFileBytes, scriptHash, false)
+			go executeScriptOnHost(ctx, &wg, semaphore, &results, cfg.HostInfo[endpointName], cfg.ProxyChainInfo(endpointName), scriptInterpreter, remoteFilePath, scriptFileBytes, scriptHash, streamOutput)
 		} else {
-			executeScriptOnHost(ctx, &wg, semaphore, cfg.HostInfo[endpointName], cfg.HostInfo[str.RepoRootDir(proxyName)], scriptInterpreter, remoteFilePath, scriptFileBytes, scriptHash, true)
-			if len(executionErrors) > 0 && !opts.ForceEnabled {
-				// Execution error occurred, don't continue with other hosts
-				break
-			}
+			executeScriptOnHost(ctx, &wg, semaphore, &results, cfg.HostInfo[endpointName], cfg.ProxyChainInfo(endpointName), scriptInterpreter, remoteFilePath, scriptFileBytes, scriptHash, streamOutput)
 		}
 	}
 	wg.Wait()
 
-	// Print out any errors
-	if len(executionErrors) > 0 {
-		logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.ErrorLog, "Errors:\n  %v\n", executionErrors)
+	if opts.OutputDirectory != "" && !opts.DryRunEnabled && !opts.WetRunEnabled {
+		err = results.writeOutputDirectory(opts.OutputDirectory)
+		if err != nil {
+			return
+		}
 	}
-
+	err = results.err()
+	return
 }
 
 // Connect to a host, upload a script, execute script and print output
-func executeScriptOnHost(ctx context.Context, wg *sync.WaitGroup, semaphore chan struct{}, hostInfo config.EndpointInfo, proxyInfo config.EndpointInfo, scriptInterpreter string, remoteFilePath str.RemotePath, scriptFileBytes []byte, scriptHash string, streamOutput bool) {
+func executeScriptOnHost(ctx context.Context, wg *sync.WaitGroup, semaphore chan struct{}, results *resultCollector, hostInfo config.EndpointInfo, proxyChain []config.EndpointInfo, scriptInterpreter string, remoteFilePath str.RemotePath, scriptFileBytes []byte, scriptHash string, streamOutput bool) {
 	// Signal routine is done after return
 	defer wg.Done()
 
@@ -163,21 +166,36 @@ func executeScriptOnHost(ctx context.Context, wg *sync.WaitGroup, semaphore chan
 	semaphore <- struct{}{}
 	defer func() { <-semaphore }() // Release the token when the goroutine finishes
 
+	ctx = logctx.WithHost(ctx, string(hostInfo.EndpointName))
+
 	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
 
+	// Hosts waiting on the semaphore do not start once execution is halted
+	if results.halted(ctx) {
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "  Skipping host %s, execution failed on another host\n", hostInfo.EndpointName)
+		return
+	}
+	startTime := time.Now()
+
 	// Save meta info for this host in a structure to easily pass around required pieces
 	var hostMeta sshinternal.HostMeta
 	hostMeta.Name = hostInfo.EndpointName
-	hostMeta.Password = hostInfo.Password
+	hostMeta.Password = hostInfo.SudoPassword
 
-	// Connect to the SSH server
+	// Every outcome of this host is recorded once it is known
+	var capture sshinternal.CommandCapture
 	var err error
-	var proxyClient *ssh.Client
-	hostMeta.SSHClient, proxyClient, err = sshinternal.ConnectToSSH(ctx, hostInfo, proxyInfo)
+	defer func() {
+		if err != nil {
+			logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.ErrorLog, "  Host '%s': %v\n", hostInfo.EndpointName, err)
+		}
+		results.record(newHostResult(hostInfo.EndpointName, capture, startTime, err))
+	}()
+
+	// Connect to the SSH server
+	var proxyClient *sshinternal.ProxyLease
+	hostMeta.SSHClient, proxyClient, _, err = sshinternal.ConnectToSSH(ctx, hostInfo, proxyChain)
 	if err != nil {
-		executionErrorsMutex.Lock()
-		executionErrors += fmt.Sprintf("  Host '%s': %v\n", hostInfo.EndpointName, err)
-		executionErrorsMutex.Unlock()
 		return
 	}
 	defer func() {
@@ -196,9 +214,7 @@ func executeScriptOnHost(ctx context.Context, wg *sync.WaitGroup, semaphore chan
 	err = host.RemoteDeploymentPreparation(ctx, &hostMeta)
 	if err != nil {
 		if !strings.Contains(strings.ToLower(err.Error()), "file exists") {
-			executionErrorsMutex.Lock()
-			executionErrors += fmt.Sprintf("remote system preparation failed: %v", err)
-			executionErrorsMutex.Unlock()
+			err = fmt.Errorf("remote system preparation failed: %w", err)
 			return
 		}
 		err = nil
@@ -209,19 +225,22 @@ func executeScriptOnHost(ctx context.Context, wg *sync.WaitGroup, semaphore chan
 	var scriptOutput string
 	if streamOutput {
 		logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.InfoLog, "  Host '%s':\n", hostInfo.EndpointName)
-		_, err = sshinternal.ExecuteScript(ctx, hostMeta, scriptInterpreter, remoteFilePath, scriptFileBytes, scriptHash, streamOutput)
+		_, err = sshinternal.ExecuteScript(ctx, hostMeta, scriptInterpreter, remoteFilePath, scriptFileBytes, scriptHash, streamOutput, &capture)
 	} else {
-		scriptOutput, err = sshinternal.ExecuteScript(ctx, hostMeta, scriptInterpreter, remoteFilePath, scriptFileBytes, scriptHash, streamOutput)
+		scriptOutput, err = sshinternal.ExecuteScript(ctx, hostMeta, scriptInterpreter, remoteFilePath, scriptFileBytes, scriptHash, streamOutput, &capture)
 	}
 	if err != nil {
-		executionErrorsMutex.Lock()
-		executionErrors += fmt.Sprintf("  Host '%s': %v\n", hostInfo.EndpointName, err)
-		executionErrorsMutex.Unlock()
+		return
 	}
 
-	if scriptOutput != "" {
+	if opts.WetRunEnabled {
+		return
+	}
+	if opts.OutputDirectory != "" {
+		logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.InfoLog, "  Host '%s': Script Completed Successfully (%dms)\n", hostInfo.EndpointName, time.Since(startTime).Milliseconds())
+	} else if scriptOutput != "" {
 		logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.InfoLog, "  Host '%s':\n%s\n", hostInfo.EndpointName, scriptOutput)
-	} else if err == nil && !opts.WetRunEnabled {
+	} else {
 		logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.InfoLog, "  Host '%s': Script Completed Successfully\n", hostInfo.EndpointName)
 	}
 }
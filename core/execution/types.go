@@ -0,0 +1,24 @@
+package execution
+
+import (
+	"scmp/internal/str"
+	"sync"
+)
+
+// Outcome of a command or script on one host
+type hostResult struct {
+	Host       str.RepoRootDir `json:"host"`
+	ExitCode   int             `json:"exitCode"` // -1 when the command never exited (connection failure, timeout)
+	DurationMs int64           `json:"durationMs"`
+	Stdout     string          `json:"stdout"`
+	Stderr     string          `json:"stderr"`
+	Truncated  bool            `json:"truncated"` // Stdout or stderr cut to the combined results limit (host output file is complete)
+	Error      string          `json:"error,omitempty"`
+}
+
+// Results of every host, shared by the execution goroutines
+type resultCollector struct {
+	mutex   sync.Mutex
+	results []hostResult
+	failed  bool
+}
@@ -6,4 +6,16 @@ const (
 	MetaDelimiter          string            = "#|^^^|#"                              // Start and stop delimiter for repository file metadata header
 	ArtifactPointerFileExt str.LocalRepoPath = ".remote-artifact"                     // file extension to identify 'pointer' files for artifact files
 	DirMetaFileName        str.LocalRepoPath = ".directory_metadata_information.json" // hidden file to identify parent directories metadata
+	UserMetaFileName       str.LocalRepoPath = ".user_metadata_information.json"      // hidden file (top of a host directory) describing remote users and groups
+	ArtifactSizeThreshold  int64             = 5 << 20                                // content larger than this (bytes) belongs outside of git
+	ArtifactCacheDirName   string            = "scmp-artifact-cache"                  // Default directory of downloaded artifacts (in config directory)
+	DefaultS3Region        string            = "us-east-1"                            // Region used to sign S3 requests when none is configured
+	NewFileTemplateDir     string            = ".scmp-templates"                      // Repository directory of named templates for new files
+)
+
+// Macros replaced in named templates when a new file is created from them
+const (
+	MacroHostName string = "{@HOSTNAME}" // Host (top level) directory of the new file
+	MacroFilePath string = "{@FILEPATH}" // Remote target path of the new file
+	MacroFileName string = "{@FILENAME}" // Base name of the new file
 )
@@ -3,9 +3,11 @@ package content
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"scmp/core/filesystem"
+	"scmp/internal/fsops"
 	"scmp/internal/global"
 	"scmp/internal/logctx"
 	"scmp/internal/parsing"
@@ -13,11 +15,110 @@ import (
 	"strings"
 )
 
-func HandleArtifactFiles(ctx context.Context, localFilePath *str.LocalRepoPath, fileContents *[]byte, optCache map[string]int) (externalContentLocation string, err error) {
-	fileIsPlainText := parsing.IsText(fileContents)
+// Reports whether content should be stored outside of git, either binary or larger than the artifact size threshold
+func ShouldBeArtifact(fileContents []byte) (artifact bool) {
+	artifact = !parsing.IsText(&fileContents) || int64(len(fileContents)) > filesystem.ArtifactSizeThreshold
+	return
+}
+
+// Reports whether an existing artifact file is small plain text that belongs directly in the repository
+func ArtifactBelongsInRepo(artifactFilePath string) (inRepo bool, err error) {
+	artifactFile, err := os.Open(artifactFilePath)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = artifactFile.Close()
+	}()
+
+	info, err := artifactFile.Stat()
+	if err != nil {
+		return
+	}
+	if info.Size() > filesystem.ArtifactSizeThreshold {
+		return
+	}
+
+	// Text detection only inspects the start of the content
+	leadingBytes := make([]byte, 512)
+	readBytes, err := io.ReadFull(artifactFile, leadingBytes)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return
+	}
+	err = nil
+	leadingBytes = leadingBytes[:readBytes]
+	inRepo = parsing.IsText(&leadingBytes)
+	return
+}
+
+// Artifact locations downloaded during deployment instead of read from a local file
+func IsRemoteArtifact(externalContentLocation string) (remote bool) {
+	remote = strings.HasPrefix(externalContentLocation, global.HTTPURIPrefix) ||
+		strings.HasPrefix(externalContentLocation, global.HTTPSURIPrefix) ||
+		strings.HasPrefix(externalContentLocation, global.S3URIPrefix)
+	return
+}
+
+// Resolves the artifact file path from a pointer metadata header location
+func ArtifactFilePath(externalContentLocation string) (artifactFilePath string, err error) {
+	if IsRemoteArtifact(externalContentLocation) {
+		err = fmt.Errorf("artifact location '%s' is remote and has no local file", externalContentLocation)
+		return
+	}
+	if !strings.HasPrefix(externalContentLocation, global.FileURIPrefix) {
+		err = fmt.Errorf("must use '%s' before file paths in 'ExternalContentLocation' field", global.FileURIPrefix)
+		return
+	}
+
+	artifactFilePath, err = fsops.ExpandHomeDirectory(strings.TrimPrefix(externalContentLocation, global.FileURIPrefix))
+	if err != nil {
+		err = fmt.Errorf("unable to identify home directory for file '%s': %w", externalContentLocation, err)
+		return
+	}
+	return
+}
+
+// Writes artifact content to its location outside of the repository
+func WriteArtifactFile(artifactFilePath string, fileContents []byte) (err error) {
+	err = os.MkdirAll(filepath.Dir(artifactFilePath), 0750)
+	if err != nil {
+		return
+	}
+
+	artifactFile, err := os.OpenFile(artifactFilePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = artifactFile.Close()
+	}()
+
+	_, err = artifactFile.Write(fileContents)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// Writes the pointer file tracking artifact content by its hash, metadata header is kept as given
+func WriteArtifactPointer(ctx context.Context, pointerFilePath str.LocalRepoPath, metadata filesystem.MetaHeader, artifactHash string) (err error) {
+	if !strings.HasSuffix(string(pointerFilePath), string(filesystem.ArtifactPointerFileExt)) {
+		err = fmt.Errorf("artifact pointer '%s' must end in '%s'", pointerFilePath, filesystem.ArtifactPointerFileExt)
+		return
+	}
+	if metadata.ExternalContentLocation == "" {
+		err = fmt.Errorf("artifact pointer '%s': JSON header is missing 'ExternalContentLocation' field", pointerFilePath)
+		return
+	}
 
+	hashBytes := []byte(artifactHash)
+	err = WriteRepoFile(ctx, pointerFilePath, metadata, &hashBytes)
+	return
+}
+
+func HandleArtifactFiles(ctx context.Context, localFilePath *str.LocalRepoPath, fileContents *[]byte, optCache map[string]int) (externalContentLocation string, err error) {
 	// Return early if file is not an artifact
-	if fileIsPlainText {
+	if !ShouldBeArtifact(*fileContents) {
 		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "  File is plain text, not running artifact handling logic\n")
 		return
 	}
@@ -39,7 +140,7 @@ func HandleArtifactFiles(ctx context.Context, localFilePath *str.LocalRepoPath,
 
 	// Make file depending on if plain text or binary
 	var userResponse string
-	logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.InfoLog, "  File is not plain text, it should probably be stored outside of git\n")
+	logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.InfoLog, "  File is not plain text or is large, it should probably be stored outside of git\n")
 	fmt.Print("  Specify a directory path where the actual file should be stored or enter 'none' to store file directly in repository\n")
 	if mostReusedDir != "" {
 		fmt.Printf("Default (press enter): '%v'\n", mostReusedDir)
@@ -82,20 +183,7 @@ func HandleArtifactFiles(ctx context.Context, localFilePath *str.LocalRepoPath,
 	// Store real file path in git-tracked file (set URI prefix)
 	externalContentLocation = global.FileURIPrefix + string(artifactFilePath)
 
-	err = os.MkdirAll(filepath.Dir(string(artifactFilePath)), 0750)
-	if err != nil {
-		return
-	}
-
-	artifactFile, err := os.OpenFile(string(artifactFilePath), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
-	if err != nil {
-		return
-	}
-	defer func() {
-		_ = artifactFile.Close()
-	}()
-
-	_, err = artifactFile.Write(*fileContents)
+	err = WriteArtifactFile(string(artifactFilePath), *fileContents)
 	if err != nil {
 		return
 	}
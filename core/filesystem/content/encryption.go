@@ -0,0 +1,87 @@
+package content
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"scmp/core/filesystem/metadata"
+	"scmp/internal/logctx"
+	"scmp/internal/secrets"
+	"scmp/internal/str"
+)
+
+// Encrypts the content section of a repository file with the vault password, the metadata header stays readable
+func EncryptFile(ctx context.Context, localFilePath str.LocalRepoPath) (err error) {
+	fileContents, err := os.ReadFile(string(localFilePath))
+	if err != nil {
+		err = fmt.Errorf("failed to read file: %w", err)
+		return
+	}
+
+	jsonMetadata, contentSection, err := metadata.Extract(string(fileContents))
+	if err != nil {
+		err = fmt.Errorf("failed to separate metadata from content: %w", err)
+		return
+	}
+	if jsonMetadata.Encrypted {
+		err = fmt.Errorf("file '%s' is already encrypted", localFilePath)
+		return
+	}
+	if jsonMetadata.ExternalContentLocation != "" {
+		err = fmt.Errorf("file '%s' is an artifact pointer, artifact content cannot be encrypted", localFilePath)
+		return
+	}
+
+	contentKey, err := secrets.UnlockContentKey(ctx)
+	if err != nil {
+		return
+	}
+	cipherText, err := secrets.EncryptContent(contentSection, contentKey)
+	if err != nil {
+		return
+	}
+
+	jsonMetadata.Encrypted = true
+	err = WriteRepoFile(ctx, localFilePath, jsonMetadata, &cipherText)
+	if err != nil {
+		return
+	}
+	logctx.LogStdInfo(ctx, "Encrypted content of '%s'\n", localFilePath)
+	return
+}
+
+// Writes the decrypted content section of a repository file back in place (for editing, encrypt again before committing)
+func DecryptFile(ctx context.Context, localFilePath str.LocalRepoPath) (err error) {
+	fileContents, err := os.ReadFile(string(localFilePath))
+	if err != nil {
+		err = fmt.Errorf("failed to read file: %w", err)
+		return
+	}
+
+	jsonMetadata, contentSection, err := metadata.Extract(string(fileContents))
+	if err != nil {
+		err = fmt.Errorf("failed to separate metadata from content: %w", err)
+		return
+	}
+	if !jsonMetadata.Encrypted {
+		err = fmt.Errorf("file '%s' is not encrypted", localFilePath)
+		return
+	}
+
+	contentKey, err := secrets.UnlockContentKey(ctx)
+	if err != nil {
+		return
+	}
+	plainText, err := secrets.DecryptContent(contentSection, contentKey)
+	if err != nil {
+		return
+	}
+
+	jsonMetadata.Encrypted = false
+	err = WriteRepoFile(ctx, localFilePath, jsonMetadata, &plainText)
+	if err != nil {
+		return
+	}
+	logctx.LogStdInfo(ctx, "Decrypted content of '%s', encrypt it again before committing\n", localFilePath)
+	return
+}
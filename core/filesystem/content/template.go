@@ -2,17 +2,37 @@ package content
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
 	"scmp/core/filesystem"
+	"scmp/core/filesystem/metadata"
 	"scmp/internal/fsops"
 	"scmp/internal/logctx"
 	"scmp/internal/parsing"
 	"scmp/internal/str"
+	"slices"
+	"strings"
 )
 
-// Creates a basic file at the path with JSON metadata header prefilled with example values
-func WriteTemplateFile(ctx context.Context, localPath str.LocalRepoPath, userConfirmed bool) {
+// Extensions of the two parts of a named template in the template directory
+const (
+	templateMetadataExt string = ".json"    // Metadata header JSON (required)
+	templateContentExt  string = ".content" // Boilerplate file content (optional)
+)
+
+// Creates files at the path with a JSON metadata header
+// Without a named template or source file the header is prefilled with example values
+// A named template comes from the repository template directory, a source file lends its header
+func WriteTemplateFile(ctx context.Context, localPath str.LocalRepoPath, templateName string, fromFile str.LocalRepoPath, userConfirmed bool) {
+	if templateName != "" && fromFile != "" {
+		fmt.Fprintf(os.Stderr, "Options --template and --from cannot be combined\n")
+		os.Exit(1)
+	}
+
 	path, err := parsing.RetrieveURIFile(ctx, string(localPath))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to parse files URI: %v\n", err)
@@ -27,7 +47,96 @@ func WriteTemplateFile(ctx context.Context, localPath str.LocalRepoPath, userCon
 		fileList = append(fileList, localPath)
 	}
 
-	var templateMetadata filesystem.MetaHeader
+	for _, file := range fileList {
+		if fsops.FileExists(string(file)) && !userConfirmed {
+			logctx.LogStdInfo(ctx, "Warning: Skipping file '%s' because no confirmation was received to overwrite the file\n", file)
+			continue
+		}
+
+		newMetadata, newContent, lerr := newFileTemplate(file, templateName, fromFile)
+		if lerr != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create template for file '%s': %v\n", file, lerr)
+			os.Exit(1)
+		}
+
+		err = WriteRepoFile(ctx, file, newMetadata, &newContent)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write new template file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// Names of the templates in the repository template directory
+func ListTemplates() (names []string, err error) {
+	entries, err := os.ReadDir(filesystem.NewFileTemplateDir)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("failed reading template directory: %w", err)
+		return
+	}
+
+	for _, entry := range entries {
+		name, isMetadata := strings.CutSuffix(entry.Name(), templateMetadataExt)
+		if entry.IsDir() || !isMetadata || name == "" {
+			continue
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return
+}
+
+// Header and content of a new file, an owner and group of the directory metadata file replaces the template default
+func newFileTemplate(newFile str.LocalRepoPath, templateName string, fromFile str.LocalRepoPath) (newMetadata filesystem.MetaHeader, newContent []byte, err error) {
+	inheritOwner := true
+	switch {
+	case templateName != "":
+		newMetadata, newContent, err = readNamedTemplate(templateName, newFile)
+		inheritOwner = newMetadata.TargetFileOwnerGroup == ""
+	case fromFile != "":
+		// The source header is copied, its content is left behind
+		var fileContents []byte
+		fileContents, err = os.ReadFile(string(fromFile))
+		if err != nil {
+			err = fmt.Errorf("failed reading source file: %w", err)
+			return
+		}
+		newMetadata, _, err = metadata.Extract(string(fileContents))
+		if err != nil {
+			err = fmt.Errorf("failed reading header of source file '%s': %w", fromFile, err)
+			return
+		}
+		inheritOwner = newMetadata.TargetFileOwnerGroup == ""
+
+		// New content is plain text in the repository, never an artifact pointer or cipher text
+		newMetadata.ExternalContentLocation = ""
+		newMetadata.Encrypted = false
+	default:
+		newMetadata, newContent = exampleTemplate()
+	}
+	if err != nil {
+		return
+	}
+
+	if inheritOwner {
+		ownerGroup, found, lerr := directoryOwnerGroup(newFile)
+		if lerr != nil {
+			err = lerr
+			return
+		}
+		if found {
+			newMetadata.TargetFileOwnerGroup = ownerGroup
+		}
+	}
+	return
+}
+
+// Generic header with example values of most fields
+func exampleTemplate() (templateMetadata filesystem.MetaHeader, templateData []byte) {
 	templateMetadata.TargetFilePermissions = 600
 	templateMetadata.TargetFileOwnerGroup = "root:root"
 	templateMetadata.ReloadCommands = []string{"echo check syntax", "echo reload service", "echo check service"}
@@ -35,22 +144,84 @@ func WriteTemplateFile(ctx context.Context, localPath str.LocalRepoPath, userCon
 	templateMetadata.Dependencies = []str.LocalRepoPath{"host/etc/file1", "host/etc/file2"}
 	templateMetadata.PreapplyCommands = []string{"stat /var/cache/Dir"}
 	templateMetadata.PostapplyCommands = []string{"stat /var/cache/Dir/state"}
+	templateMetadata.PreCheckCommands = []string{"systemctl cat service"}
+	templateMetadata.PostCheckCommands = []string{"echo check syntax"}
 	templateMetadata.InstallCommands = []string{"apt-get install curl -y"}
 	templateMetadata.PreDeployCommands = []string{"grep -i a <<<{@LOCALFILEDATA}"}
 
-	templateText := "This is a template file generated by SCMP controller using 'controller file new' command\n"
-	templateData := []byte(templateText)
+	templateData = []byte("This is a template file generated by SCMP controller using 'controller file new' command\n")
+	return
+}
 
-	for _, file := range fileList {
-		if fsops.FileExists(string(file)) && !userConfirmed {
-			logctx.LogStdInfo(ctx, "Warning: Skipping file '%s' because no confirmation was received to overwrite the file\n", file)
-			continue
-		}
+// Named template with the new file macros replaced in both the header and the content
+func readNamedTemplate(templateName string, newFile str.LocalRepoPath) (templateMetadata filesystem.MetaHeader, templateData []byte, err error) {
+	if strings.ContainsAny(templateName, `/\`) || strings.HasPrefix(templateName, ".") {
+		err = fmt.Errorf("invalid template name '%s'", templateName)
+		return
+	}
+	templatePath := filepath.Join(filesystem.NewFileTemplateDir, templateName)
 
-		err = WriteRepoFile(ctx, file, templateMetadata, &templateData)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to write new template file: %v\n", err)
-			os.Exit(1)
-		}
+	metadataJSON, err := os.ReadFile(templatePath + templateMetadataExt)
+	if errors.Is(err, os.ErrNotExist) {
+		err = fmt.Errorf("template '%s' does not exist (use --list-templates to show available templates)", templateName)
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("failed reading template '%s': %w", templateName, err)
+		return
+	}
+
+	templateData, err = os.ReadFile(templatePath + templateContentExt)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		err = fmt.Errorf("failed reading content of template '%s': %w", templateName, err)
+		return
+	}
+	err = nil
+
+	hostDir, targetFilePath := parsing.TranslateLocalPathtoRemotePath("", newFile)
+	macroValues := map[string]string{
+		filesystem.MacroHostName: string(hostDir),
+		filesystem.MacroFilePath: string(targetFilePath),
+		filesystem.MacroFileName: path.Base(string(targetFilePath)),
+	}
+
+	// Header values are JSON escaped so any path stays valid JSON
+	var headerPairs, contentPairs []string
+	for macro, value := range macroValues {
+		escaped, _ := json.Marshal(value)
+		headerPairs = append(headerPairs, macro, strings.Trim(string(escaped), `"`))
+		contentPairs = append(contentPairs, macro, value)
+	}
+	metadataJSON = []byte(strings.NewReplacer(headerPairs...).Replace(string(metadataJSON)))
+	templateData = []byte(strings.NewReplacer(contentPairs...).Replace(string(templateData)))
+
+	err = json.Unmarshal(metadataJSON, &templateMetadata)
+	if err != nil {
+		err = fmt.Errorf("invalid metadata JSON in template '%s': %w", templateName, err)
+		return
+	}
+	return
+}
+
+// Owner and group from the directory metadata file next to the new file
+func directoryOwnerGroup(newFile str.LocalRepoPath) (ownerGroup string, found bool, err error) {
+	dirMetadataPath := filepath.Join(filepath.Dir(string(newFile)), string(filesystem.DirMetaFileName))
+	fileContents, err := os.ReadFile(dirMetadataPath)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("failed reading directory metadata: %w", err)
+		return
+	}
+
+	dirMetadata, _, err := metadata.Extract(string(fileContents))
+	if err != nil {
+		err = fmt.Errorf("failed reading directory metadata '%s': %w", dirMetadataPath, err)
+		return
 	}
+	ownerGroup = dirMetadata.TargetFileOwnerGroup
+	found = ownerGroup != ""
+	return
 }
@@ -0,0 +1,89 @@
+package content
+
+import (
+	"os"
+	"path/filepath"
+	"scmp/core/filesystem"
+	"scmp/internal/str"
+	"slices"
+	"testing"
+)
+
+func TestNewFileTemplate(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	writeFile := func(path string, content string) {
+		err := os.MkdirAll(filepath.Dir(path), 0700)
+		if err != nil {
+			t.Fatalf("failed creating directory: %v", err)
+		}
+		err = os.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("failed writing file: %v", err)
+		}
+	}
+	writeFile(filepath.Join(filesystem.NewFileTemplateDir, "nginx.json"), `{"FileOwnerGroup":"","FilePermissions":644,"PostChecks":["nginx -t -c {@FILEPATH}"]}`)
+	writeFile(filepath.Join(filesystem.NewFileTemplateDir, "nginx.content"), "# {@FILENAME} on {@HOSTNAME}\n")
+	writeFile(filepath.Join(filesystem.NewFileTemplateDir, "owned.json"), `{"FileOwnerGroup":"root:root","FilePermissions":600}`)
+	writeFile(filepath.Join("host1", "etc", "nginx", string(filesystem.DirMetaFileName)), filesystem.MetaDelimiter+"\n{\"FileOwnerGroup\":\"root:www-data\",\"FilePermissions\":755}\n"+filesystem.MetaDelimiter+"\n")
+	writeFile(filepath.Join("host1", "etc", "app.conf"), filesystem.MetaDelimiter+"\n{\"FileOwnerGroup\":\"app:app\",\"FilePermissions\":640,\"Encrypted\":true}\n"+filesystem.MetaDelimiter+"\nsecret\n")
+
+	templateNames, err := ListTemplates()
+	if err != nil {
+		t.Fatalf("unexpected error listing templates: %v", err)
+	}
+	if !slices.Equal(templateNames, []string{"nginx", "owned"}) {
+		t.Errorf("expected templates [nginx owned], got %v", templateNames)
+	}
+
+	tests := []struct {
+		name            string
+		newFile         str.LocalRepoPath
+		templateName    string
+		fromFile        str.LocalRepoPath
+		expectedOwner   string
+		expectedContent string
+		expectedError   bool
+	}{
+		{"named template with directory owner", "host1/etc/nginx/site.conf", "nginx", "", "root:www-data", "# site.conf on host1\n", false},
+		{"named template owner kept", "host1/etc/nginx/site.conf", "owned", "", "root:root", "", false},
+		{"example template with directory owner", "host1/etc/nginx/site.conf", "", "", "root:www-data", "", false},
+		{"example template without directory metadata", "host1/etc/motd", "", "", "root:root", "", false},
+		{"source file header", "host1/etc/nginx/app.conf", "", "host1/etc/app.conf", "app:app", "", false},
+		{"unknown template", "host1/etc/motd", "missing", "", "", "", true},
+		{"template name with path", "host1/etc/motd", "../nginx", "", "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newMetadata, newContent, err := newFileTemplate(test.newFile, test.templateName, test.fromFile)
+			if test.expectedError {
+				if err == nil {
+					t.Errorf("expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if newMetadata.TargetFileOwnerGroup != test.expectedOwner {
+				t.Errorf("expected owner '%s', got '%s'", test.expectedOwner, newMetadata.TargetFileOwnerGroup)
+			}
+			if test.expectedContent != "" && string(newContent) != test.expectedContent {
+				t.Errorf("expected content %q, got %q", test.expectedContent, newContent)
+			}
+			if newMetadata.Encrypted {
+				t.Errorf("expected new file header without Encrypted")
+			}
+		})
+	}
+
+	newMetadata, _, err := newFileTemplate("host1/etc/nginx/site.conf", "nginx", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(newMetadata.PostCheckCommands, []string{"nginx -t -c /etc/nginx/site.conf"}) {
+		t.Errorf("expected file path macro in header commands, got %v", newMetadata.PostCheckCommands)
+	}
+}
@@ -32,6 +32,12 @@ func ReplaceData(ctx context.Context, srcFilePath str.LocalRepoPath, dstFilePath
 		os.Exit(1)
 	}
 
+	// Plain text data must never replace cipher text under an Encrypted header
+	if jsonMetadata.Encrypted {
+		fmt.Fprintf(os.Stderr, "File '%s' is encrypted, use 'file decrypt', replace its data, then 'file encrypt'\n", dstFilePath)
+		os.Exit(1)
+	}
+
 	var clearedToWrite bool
 	if userConfirmed {
 		clearedToWrite = true
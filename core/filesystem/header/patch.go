@@ -0,0 +1,431 @@
+package header
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"scmp/core/filesystem"
+	"scmp/core/filesystem/metadata"
+	"scmp/internal/logctx"
+	"scmp/internal/parsing"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+)
+
+const patchDiffContextLines int = 3 // Unchanged header lines shown around each change in dry-run diffs
+
+// Non-interactive changes to existing metadata headers
+// Applied in field order: JSON patch, set values, owner, then reload commands
+type Patch struct {
+	JSON         string   // JSON object of header keys to replace (null removes the key)
+	Set          []string // KEY=VALUE pairs, VALUE is JSON or a plain string
+	OwnerGroup   string   // Replacement FileOwnerGroup
+	AppendReload []string // Commands appended to Reload when not already present
+}
+
+// Single top-level key of a header, kept in file order
+type headerField struct {
+	key   string
+	value json.RawMessage
+}
+
+// Location of the header JSON inside a file
+type headerSpan struct {
+	start      int    // First byte of the line after the start delimiter
+	end        int    // First byte of the end delimiter line
+	linePrefix string // Comment prefix on every header line
+	lineEnding string // Line ending used by header lines
+}
+
+// Result of patching one file
+type patchedFile struct {
+	path      string
+	oldHeader string
+	newHeader string
+	contents  []byte
+}
+
+// Reports whether the patch has no changes to apply
+func (patch Patch) IsEmpty() (empty bool) {
+	empty = patch.JSON == "" && len(patch.Set) == 0 && patch.OwnerGroup == "" && len(patch.AppendReload) == 0
+	return
+}
+
+// Applies patch to the header of every file matching the path (or glob)
+// Every file is patched and validated before any file is written
+// Dry-run prints the header diff per file without writing
+func ApplyPatch(ctx context.Context, pathPattern str.LocalRepoPath, patch Patch, dryRun bool) {
+	filePaths, err := filepath.Glob(string(pathPattern))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid file path pattern '%s': %v\n", pathPattern, err)
+		os.Exit(1)
+	}
+	if len(filePaths) == 0 {
+		fmt.Fprintf(os.Stderr, "No files match '%s'\n", pathPattern)
+		os.Exit(1)
+	}
+
+	var patchedFiles []patchedFile
+	for _, filePath := range filePaths {
+		fileContents, err := os.ReadFile(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read contents of specified file '%s': %v\n", filePath, err)
+			os.Exit(1)
+		}
+
+		patched, err := patchFileHeader(fileContents, patch)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to patch header in file '%s': %v\n", filePath, err)
+			os.Exit(1)
+		}
+		patched.path = filePath
+		patchedFiles = append(patchedFiles, patched)
+	}
+
+	for _, patched := range patchedFiles {
+		if patched.oldHeader == patched.newHeader {
+			logctx.LogStdInfo(ctx, "Header in '%s' is unchanged\n", patched.path)
+			continue
+		}
+
+		if dryRun {
+			diff, complete := parsing.UnifiedDiff(patched.path, patched.path, patched.oldHeader, patched.newHeader, patchDiffContextLines)
+			if !complete {
+				logctx.LogStdInfo(ctx, "Header in '%s' has too many changes to show a diff\n", patched.path)
+				continue
+			}
+			logctx.LogStdInfo(ctx, "%s", diff)
+			continue
+		}
+
+		info, err := os.Stat(patched.path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to retrieve file '%s' information: %v\n", patched.path, err)
+			os.Exit(1)
+		}
+		err = os.WriteFile(patched.path, patched.contents, info.Mode().Perm())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write modified header to existing file '%s': %v\n", patched.path, err)
+			os.Exit(1)
+		}
+		logctx.LogStdInfo(ctx, "Updated header in '%s'\n", patched.path)
+	}
+}
+
+// Replaces the header JSON in file contents, leaving everything outside the header untouched
+// Key order of the existing header is kept, new keys are added at the end
+func patchFileHeader(fileContents []byte, patch Patch) (patched patchedFile, err error) {
+	span, err := locateHeader(fileContents)
+	if err != nil {
+		return
+	}
+	patched.oldHeader = string(fileContents[span.start:span.end])
+
+	fields, err := parseHeaderFields(span.unwrap(patched.oldHeader))
+	if err != nil {
+		err = fmt.Errorf("invalid metadata header: %w", err)
+		return
+	}
+
+	originalJSON, err := formatHeaderFields(fields)
+	if err != nil {
+		return
+	}
+
+	fields, err = patch.apply(fields)
+	if err != nil {
+		return
+	}
+
+	headerJSON, err := formatHeaderFields(fields)
+	if err != nil {
+		return
+	}
+
+	var newHeader filesystem.MetaHeader
+	err = json.Unmarshal(headerJSON, &newHeader)
+	if err != nil {
+		err = fmt.Errorf("patched header is invalid: %w", err)
+		return
+	}
+	err = metadata.Validate(newHeader)
+	if err != nil {
+		err = fmt.Errorf("patched header is invalid: %w", err)
+		return
+	}
+
+	// Headers with the same values keep their existing formatting
+	if bytes.Equal(originalJSON, headerJSON) {
+		patched.newHeader = patched.oldHeader
+		patched.contents = fileContents
+		return
+	}
+
+	// Commented headers carry the prefix on every line
+	headerLines := strings.Split(string(headerJSON), "\n")
+	for _, line := range headerLines {
+		patched.newHeader += span.linePrefix + line + span.lineEnding
+	}
+
+	var contents bytes.Buffer
+	contents.Write(fileContents[:span.start])
+	contents.WriteString(patched.newHeader)
+	contents.Write(fileContents[span.end:])
+	patched.contents = contents.Bytes()
+	return
+}
+
+// Applies each patch operation to the ordered header fields
+func (patch Patch) apply(fields []headerField) (patchedFields []headerField, err error) {
+	patchedFields = fields
+
+	if patch.JSON != "" {
+		var jsonPatch []headerField
+		jsonPatch, err = parseHeaderFields(patch.JSON)
+		if err != nil {
+			err = fmt.Errorf("invalid JSON patch: %w", err)
+			return
+		}
+		for _, field := range jsonPatch {
+			if bytes.Equal(bytes.TrimSpace(field.value), []byte("null")) {
+				patchedFields = removeHeaderField(patchedFields, field.key)
+				continue
+			}
+			patchedFields, err = setHeaderField(patchedFields, field.key, field.value)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	for _, assignment := range patch.Set {
+		key, value, found := strings.Cut(assignment, "=")
+		if !found {
+			err = fmt.Errorf("set value '%s' must be KEY=VALUE", assignment)
+			return
+		}
+
+		// Values that are not JSON are taken as strings so quoting is optional
+		rawValue := json.RawMessage(value)
+		if !json.Valid(rawValue) {
+			rawValue, err = json.Marshal(value)
+			if err != nil {
+				return
+			}
+		}
+		patchedFields, err = setHeaderField(patchedFields, strings.TrimSpace(key), rawValue)
+		if err != nil {
+			return
+		}
+	}
+
+	if patch.OwnerGroup != "" {
+		var rawOwner json.RawMessage
+		rawOwner, err = json.Marshal(patch.OwnerGroup)
+		if err != nil {
+			return
+		}
+		patchedFields, err = setHeaderField(patchedFields, "FileOwnerGroup", rawOwner)
+		if err != nil {
+			return
+		}
+	}
+
+	if len(patch.AppendReload) > 0 {
+		var reloadCommands []string
+		for _, field := range patchedFields {
+			if field.key != "Reload" {
+				continue
+			}
+			err = json.Unmarshal(field.value, &reloadCommands)
+			if err != nil {
+				err = fmt.Errorf("existing Reload value is not a list of commands: %w", err)
+				return
+			}
+		}
+
+		for _, command := range patch.AppendReload {
+			if !slices.Contains(reloadCommands, command) {
+				reloadCommands = append(reloadCommands, command)
+			}
+		}
+
+		var rawReload json.RawMessage
+		rawReload, err = json.Marshal(reloadCommands)
+		if err != nil {
+			return
+		}
+		patchedFields, err = setHeaderField(patchedFields, "Reload", rawReload)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Replaces the value of an existing key in place or adds the key at the end
+func setHeaderField(fields []headerField, key string, value json.RawMessage) (updatedFields []headerField, err error) {
+	if !slices.Contains(metaHeaderKeys(), key) {
+		err = fmt.Errorf("unknown header key '%s'", key)
+		return
+	}
+
+	updatedFields = fields
+	for index := range updatedFields {
+		if updatedFields[index].key == key {
+			updatedFields[index].value = value
+			return
+		}
+	}
+	updatedFields = append(updatedFields, headerField{key: key, value: value})
+	return
+}
+
+func removeHeaderField(fields []headerField, key string) (updatedFields []headerField) {
+	updatedFields = slices.DeleteFunc(fields, func(field headerField) bool {
+		return field.key == key
+	})
+	return
+}
+
+// JSON key names of every metadata header field
+func metaHeaderKeys() (keys []string) {
+	headerType := reflect.TypeFor[filesystem.MetaHeader]()
+	for index := range headerType.NumField() {
+		name, _, _ := strings.Cut(headerType.Field(index).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			keys = append(keys, name)
+		}
+	}
+	return
+}
+
+// Decodes a JSON object into its top-level keys without reordering them
+func parseHeaderFields(objectJSON string) (fields []headerField, err error) {
+	decoder := json.NewDecoder(strings.NewReader(objectJSON))
+
+	token, err := decoder.Token()
+	if err != nil {
+		return
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		err = fmt.Errorf("expected a JSON object")
+		return
+	}
+
+	for decoder.More() {
+		token, err = decoder.Token()
+		if err != nil {
+			return
+		}
+		key, ok := token.(string)
+		if !ok {
+			err = fmt.Errorf("expected an object key")
+			return
+		}
+
+		var value json.RawMessage
+		err = decoder.Decode(&value)
+		if err != nil {
+			return
+		}
+		fields = removeHeaderField(fields, key)
+		fields = append(fields, headerField{key: key, value: value})
+	}
+
+	_, err = decoder.Token()
+	if err != nil {
+		return
+	}
+	if decoder.More() {
+		err = fmt.Errorf("unexpected data after JSON object")
+	}
+	return
+}
+
+// Writes fields as an indented JSON object in the same style as new headers
+func formatHeaderFields(fields []headerField) (headerJSON []byte, err error) {
+	var compact bytes.Buffer
+	compact.WriteString("{")
+	for index, field := range fields {
+		if index > 0 {
+			compact.WriteString(",")
+		}
+		var key []byte
+		key, err = json.Marshal(field.key)
+		if err != nil {
+			return
+		}
+		compact.Write(key)
+		compact.WriteString(":")
+		compact.Write(field.value)
+	}
+	compact.WriteString("}")
+
+	var indented bytes.Buffer
+	err = json.Indent(&indented, compact.Bytes(), "", "  ")
+	if err != nil {
+		err = fmt.Errorf("error formatting metadata header: %w", err)
+		return
+	}
+	headerJSON = parsing.UnescapeShellRedirectors(indented.Bytes())
+	return
+}
+
+// Finds the header lines between the start and end delimiter lines
+func locateHeader(fileContents []byte) (span headerSpan, err error) {
+	delimiter := []byte(filesystem.MetaDelimiter)
+
+	startIndex := bytes.Index(fileContents, delimiter)
+	if startIndex == -1 {
+		err = fmt.Errorf("json start delimiter missing")
+		return
+	}
+	lineEnd := bytes.IndexByte(fileContents[startIndex:], '\n')
+	if lineEnd == -1 {
+		err = fmt.Errorf("json end delimiter missing")
+		return
+	}
+	span.start = startIndex + lineEnd + 1
+
+	endIndex := bytes.Index(fileContents[span.start:], delimiter)
+	if endIndex == -1 {
+		err = fmt.Errorf("json end delimiter missing")
+		return
+	}
+	span.end = span.start + bytes.LastIndexByte(fileContents[span.start:span.start+endIndex], '\n') + 1
+
+	span.lineEnding = "\n"
+	if bytes.Contains(fileContents[span.start:span.end], []byte("\r\n")) {
+		span.lineEnding = "\r\n"
+	}
+
+	for _, prefix := range []string{"#", "//", ";"} {
+		if bytes.HasPrefix(fileContents[span.start:span.end], []byte(prefix)) {
+			span.linePrefix = prefix
+			break
+		}
+	}
+	return
+}
+
+// Removes line endings and comment prefixes from the header lines
+func (span headerSpan) unwrap(header string) (headerJSON string) {
+	header = strings.ReplaceAll(header, "\r", "")
+	if span.linePrefix == "" {
+		headerJSON = header
+		return
+	}
+
+	lines := strings.Split(header, "\n")
+	for index, line := range lines {
+		lines[index] = strings.TrimPrefix(line, span.linePrefix)
+	}
+	headerJSON = strings.Join(lines, "\n")
+	return
+}
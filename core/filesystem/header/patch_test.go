@@ -0,0 +1,106 @@
+package header
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPatchFileHeader(t *testing.T) {
+	plainFile := "#|^^^|#\n{\n  \"FileOwnerGroup\": \"root:root\",\n  \"FilePermissions\": 644,\n  \"Reload\": [\n    \"nginx -t\"\n  ]\n}\n#|^^^|#\nserver {\n\tlisten 80;\n}\n"
+	commentedFile := "#!/bin/sh\n##|^^^|#\n#{\n#  \"FileOwnerGroup\": \"root:root\",\n#  \"FilePermissions\": 755\n#}\n##|^^^|#\necho hi\r\n"
+
+	tests := []struct {
+		name           string
+		fileContents   string
+		patch          Patch
+		expectedHeader string
+		expectError    bool
+	}{
+		{
+			name:           "append reload keeps key order",
+			fileContents:   plainFile,
+			patch:          Patch{AppendReload: []string{"systemctl reload nginx", "nginx -t"}},
+			expectedHeader: "{\n  \"FileOwnerGroup\": \"root:root\",\n  \"FilePermissions\": 644,\n  \"Reload\": [\n    \"nginx -t\",\n    \"systemctl reload nginx\"\n  ]\n}\n",
+		},
+		{
+			name:           "set owner and new key",
+			fileContents:   plainFile,
+			patch:          Patch{OwnerGroup: "root:www-data", Set: []string{"ReloadGroup=nginx"}},
+			expectedHeader: "{\n  \"FileOwnerGroup\": \"root:www-data\",\n  \"FilePermissions\": 644,\n  \"Reload\": [\n    \"nginx -t\"\n  ],\n  \"ReloadGroup\": \"nginx\"\n}\n",
+		},
+		{
+			name:           "json patch removes key",
+			fileContents:   plainFile,
+			patch:          Patch{JSON: `{"Reload":null,"FilePermissions":640}`},
+			expectedHeader: "{\n  \"FileOwnerGroup\": \"root:root\",\n  \"FilePermissions\": 640\n}\n",
+		},
+		{
+			name:           "set json list with redirect",
+			fileContents:   commentedFile,
+			patch:          Patch{Set: []string{`PostApply=["echo done > /tmp/done"]`}},
+			expectedHeader: "#{\n#  \"FileOwnerGroup\": \"root:root\",\n#  \"FilePermissions\": 755,\n#  \"PostApply\": [\n#    \"echo done > /tmp/done\"\n#  ]\n#}\n",
+		},
+		{
+			name:           "unchanged values keep formatting",
+			fileContents:   commentedFile,
+			patch:          Patch{OwnerGroup: "root:root"},
+			expectedHeader: "#{\n#  \"FileOwnerGroup\": \"root:root\",\n#  \"FilePermissions\": 755\n#}\n",
+		},
+		{
+			name:         "permissions out of range",
+			fileContents: plainFile,
+			patch:        Patch{Set: []string{"FilePermissions=17777"}},
+			expectError:  true,
+		},
+		{
+			name:         "wrong value type",
+			fileContents: plainFile,
+			patch:        Patch{Set: []string{"FilePermissions=rw-r--r--"}},
+			expectError:  true,
+		},
+		{
+			name:         "unknown key",
+			fileContents: plainFile,
+			patch:        Patch{JSON: `{"Relaod":["nginx -t"]}`},
+			expectError:  true,
+		},
+		{
+			name:         "invalid owner",
+			fileContents: plainFile,
+			patch:        Patch{OwnerGroup: "root"},
+			expectError:  true,
+		},
+		{
+			name:         "missing header",
+			fileContents: "server {}\n",
+			patch:        Patch{OwnerGroup: "root:root"},
+			expectError:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patched, err := patchFileHeader([]byte(test.fileContents), test.patch)
+			if test.expectError {
+				if err == nil {
+					t.Fatalf("expected error, got header:\n%s", patched.newHeader)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if patched.newHeader != test.expectedHeader {
+				t.Errorf("header mismatch\nexpected:\n%s\ngot:\n%s", test.expectedHeader, patched.newHeader)
+			}
+
+			// Everything outside the header is kept byte for byte
+			oldIndex := strings.Index(test.fileContents, patched.oldHeader)
+			expectedContents := test.fileContents[:oldIndex] + patched.newHeader + test.fileContents[oldIndex+len(patched.oldHeader):]
+			if string(patched.contents) != expectedContents {
+				t.Errorf("file contents outside header changed\nexpected:\n%q\ngot:\n%q", expectedContents, patched.contents)
+			}
+		})
+	}
+}
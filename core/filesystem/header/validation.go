@@ -33,13 +33,22 @@ func Verify(ctx context.Context, fileInput str.LocalRepoPath) {
 			os.Exit(1)
 		}
 
-		// Ignoring all outputs, just checking to make sure it works
-		_, _, err = metadata.Extract(string(inputFileContents))
+		// Ignoring content, just checking to make sure it works
+		metaHeader, _, err := metadata.Extract(string(inputFileContents))
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to extract contents from the specified file '%s': %v\n", filePath, err)
 			os.Exit(1)
 		}
 
+		err = metadata.Validate(metaHeader)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unsafe metadata header in file '%s': %v\n", filePath, err)
+			os.Exit(1)
+		}
+		for _, warning := range metadata.Lint(metaHeader) {
+			logctx.LogStdWarn(ctx, "File '%s': %s\n", filePath, warning)
+		}
+
 		logctx.LogStdInfo(ctx, "Metadata header in '%s' is valid\n", filePath)
 	}
 }
@@ -0,0 +1,12 @@
+package metadata
+
+import (
+	"scmp/core/filesystem"
+)
+
+// Legacy Checks commands run as post-checks, ahead of any PostChecks commands
+func EffectivePostChecks(metadata filesystem.MetaHeader) (postChecks []string) {
+	postChecks = append(postChecks, metadata.CheckCommands...)
+	postChecks = append(postChecks, metadata.PostCheckCommands...)
+	return
+}
@@ -0,0 +1,30 @@
+package metadata
+
+import (
+	"scmp/core/filesystem"
+	"slices"
+	"testing"
+)
+
+func TestEffectivePostChecks(t *testing.T) {
+	tests := []struct {
+		name               string
+		header             filesystem.MetaHeader
+		expectedPostChecks []string
+	}{
+		{"no checks", filesystem.MetaHeader{}, nil},
+		{"post checks only", filesystem.MetaHeader{PostCheckCommands: []string{"nginx -t"}}, []string{"nginx -t"}},
+		{"checks alias", filesystem.MetaHeader{CheckCommands: []string{"nginx -t"}}, []string{"nginx -t"}},
+		{"alias runs first", filesystem.MetaHeader{CheckCommands: []string{"nginx -t"}, PostCheckCommands: []string{"curl -sf localhost"}}, []string{"nginx -t", "curl -sf localhost"}},
+		{"pre checks not included", filesystem.MetaHeader{PreCheckCommands: []string{"df /"}}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			postChecks := EffectivePostChecks(test.header)
+			if !slices.Equal(postChecks, test.expectedPostChecks) {
+				t.Errorf("expected post-checks %v, got %v", test.expectedPostChecks, postChecks)
+			}
+		})
+	}
+}
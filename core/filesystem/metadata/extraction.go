@@ -3,15 +3,19 @@ package metadata
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"scmp/core/filesystem"
 	"strings"
 )
 
+// UTF-8 encoded byte order mark
+const utf8BOM = "\uFEFF"
+
 // Function to extract metadata JSON from file contents
 func Extract(fileContents string) (metadata filesystem.MetaHeader, contentSection []byte, err error) {
-	// Do not allow carriage returns
-	fileContents = strings.ReplaceAll(fileContents, "\r", "")
+	// Byte order mark (from editors on Windows) precedes the header, never the content
+	fileContents = strings.TrimPrefix(fileContents, utf8BOM)
 
 	// Handle comments around metadata header
 	fileContents = strings.Replace(fileContents, "/*"+filesystem.MetaDelimiter, filesystem.MetaDelimiter, 1)
@@ -45,6 +49,9 @@ func Extract(fileContents string) (metadata filesystem.MetaHeader, contentSectio
 	// Extract the metadata section
 	metadataSection := fileContents[startIndex:endIndex]
 
+	// Header lines may end in CRLF, content line endings are left as they are
+	metadataSection = strings.ReplaceAll(metadataSection, "\r\n", "\n")
+
 	// Handle commented out metadata lines
 	metadataSection = strings.ReplaceAll(metadataSection, "\n#", "\n")
 	metadataSection = strings.ReplaceAll(metadataSection, "\n//", "\n")
@@ -52,15 +59,38 @@ func Extract(fileContents string) (metadata filesystem.MetaHeader, contentSectio
 
 	err = json.Unmarshal([]byte(metadataSection), &metadata)
 	if err != nil {
-		err = fmt.Errorf("invalid metadata header: %w", err)
+		err = fmt.Errorf("invalid metadata header: line %d: %w", jsonErrorLine(fileContents[:startIndex], metadataSection, err), err)
 		return
 	}
 
 	// Extract the content section
 	remainingContent := fileContents[:startIndex-len(filesystem.MetaDelimiter)] + fileContents[endIndex+len(filesystem.MetaDelimiter):]
-	remainingContent = strings.TrimPrefix(remainingContent, "\n")
+	if strings.HasPrefix(remainingContent, "\r\n") {
+		remainingContent = strings.TrimPrefix(remainingContent, "\r\n")
+	} else {
+		remainingContent = strings.TrimPrefix(remainingContent, "\n")
+	}
 
 	contentSection = []byte(remainingContent)
 
 	return
 }
+
+// Line in the file of a JSON decoding error, errors without a position report the line of the start delimiter
+// Header transforms never add or remove newlines, so lines of the header section match lines of the file
+func jsonErrorLine(precedingContents string, metadataSection string, err error) (line int) {
+	line = 1 + strings.Count(precedingContents, "\n")
+
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) {
+		offset = syntaxErr.Offset
+	} else if errors.As(err, &typeErr) {
+		offset = typeErr.Offset
+	}
+	offset = min(max(offset, 0), int64(len(metadataSection)))
+
+	line += strings.Count(metadataSection[:offset], "\n")
+	return
+}
@@ -1,9 +1,11 @@
 package metadata
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"scmp/core/filesystem"
 	"scmp/internal/str"
+	"strings"
 	"testing"
 )
 
@@ -180,6 +182,53 @@ file content file content file content`,
 			expectedRemainingContent: "",
 			expectedError:            fmt.Errorf("json end delimiter missing"),
 		},
+		{
+			name:         "BOM And CRLF",
+			fileContents: "\uFEFF#|^^^|#\r\n{\r\n  \"FileOwnerGroup\": \"root:root\",\r\n  \"FilePermissions\": 644\r\n}\r\n#|^^^|#\r\nline one\r\nline two\r\n",
+			expectedMetadata: filesystem.MetaHeader{
+				TargetFileOwnerGroup:  "root:root",
+				TargetFilePermissions: 644,
+			},
+			expectedRemainingContent: "line one\r\nline two\r\n",
+			expectedError:            nil,
+		},
+		{
+			name:         "CRLF Commented Header",
+			fileContents: "#|^^^|#\r\n#{\r\n#  \"FileOwnerGroup\": \"root:root\",\r\n#  \"FilePermissions\": 640\r\n#}\r\n#|^^^|#\r\n[section]\r\nkey=value\r\n",
+			expectedMetadata: filesystem.MetaHeader{
+				TargetFileOwnerGroup:  "root:root",
+				TargetFilePermissions: 640,
+			},
+			expectedRemainingContent: "[section]\r\nkey=value\r\n",
+			expectedError:            nil,
+		},
+		{
+			name:         "CRLF End Delimiter On Last Line",
+			fileContents: "#|^^^|#\r\n{\r\n  \"FileOwnerGroup\": \"root:root\",\r\n  \"FilePermissions\": 600\r\n}\r\n#|^^^|#",
+			expectedMetadata: filesystem.MetaHeader{
+				TargetFileOwnerGroup:  "root:root",
+				TargetFilePermissions: 600,
+			},
+			expectedRemainingContent: "",
+			expectedError:            nil,
+		},
+		{
+			name:         "Mixed Line Endings",
+			fileContents: "#|^^^|#\n{\r\n  \"FileOwnerGroup\": \"root:root\",\n  \"FilePermissions\": 644\r\n}\n#|^^^|#\r\nunix line\nwindows line\r\nold mac\rline",
+			expectedMetadata: filesystem.MetaHeader{
+				TargetFileOwnerGroup:  "root:root",
+				TargetFilePermissions: 644,
+			},
+			expectedRemainingContent: "unix line\nwindows line\r\nold mac\rline",
+			expectedError:            nil,
+		},
+		{
+			name:                     "BOM Without Header",
+			fileContents:             "\uFEFFfile content\r\n",
+			expectedMetadata:         filesystem.MetaHeader{},
+			expectedRemainingContent: "",
+			expectedError:            fmt.Errorf("json start delimiter missing"),
+		},
 		{
 			name:                     "Missing Start Delimiter",
 			fileContents:             `file content file content file content`,
@@ -214,3 +263,49 @@ file content file content file content`,
 		})
 	}
 }
+
+func TestExtractMetadataErrorLine(t *testing.T) {
+	tests := []struct {
+		name         string
+		fileContents string
+		expectedLine string
+	}{
+		{
+			name:         "Missing Comma",
+			fileContents: "#|^^^|#\n{\n  \"FileOwnerGroup\": \"root:root\"\n  \"FilePermissions\": 644\n}\n#|^^^|#\ncontent\n",
+			expectedLine: "invalid metadata header: line 4: ",
+		},
+		{
+			name:         "Wrong Field Type",
+			fileContents: "file comment\r\n#|^^^|#\r\n{\r\n#  \"FileOwnerGroup\": \"root:root\",\r\n#  \"FilePermissions\": \"644\"\r\n}\r\n#|^^^|#\r\n",
+			expectedLine: "invalid metadata header: line 5: ",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := Extract(test.fileContents)
+			if err == nil {
+				t.Fatalf("expected error, but got nil")
+			}
+			if !strings.HasPrefix(err.Error(), test.expectedLine) {
+				t.Errorf("expected error starting with '%s', got '%v'", test.expectedLine, err)
+			}
+		})
+	}
+}
+
+func TestExtractMetadataContentHash(t *testing.T) {
+	content := "first line\r\nsecond line\r\n"
+	fileContents := "\uFEFF#|^^^|#\r\n{\r\n  \"FileOwnerGroup\": \"root:root\",\r\n  \"FilePermissions\": 644\r\n}\r\n#|^^^|#\r\n" + content
+
+	_, contentSection, err := Extract(fileContents)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedHash := sha256.Sum256([]byte(content))
+	if sha256.Sum256(contentSection) != expectedHash {
+		t.Errorf("expected hash of unmodified content section %x, got hash of %q", expectedHash, contentSection)
+	}
+}
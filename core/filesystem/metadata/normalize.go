@@ -0,0 +1,44 @@
+package metadata
+
+import (
+	"bytes"
+	"scmp/core/filesystem"
+	"scmp/internal/config"
+)
+
+const (
+	EOLLF   string = "lf"
+	EOLCRLF string = "crlf"
+)
+
+// Header normalization replaces the configured default entirely
+func EffectiveNormalization(metadata filesystem.MetaHeader, defaultNormalization config.Normalization) (normalization config.Normalization) {
+	normalization = defaultNormalization
+	if metadata.Normalize != nil {
+		normalization = *metadata.Normalize
+	}
+	return
+}
+
+// Applies normalization to text content (line endings are always read as LF or CRLF)
+func NormalizeContent(content []byte, normalization config.Normalization) (normalized []byte) {
+	normalized = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+
+	if normalization.StripTrailingWhitespace {
+		lines := bytes.Split(normalized, []byte("\n"))
+		for index, line := range lines {
+			lines[index] = bytes.TrimRight(line, " \t")
+		}
+		normalized = bytes.Join(lines, []byte("\n"))
+	}
+
+	// Empty files stay empty
+	if normalization.EnsureTrailingNewline && len(normalized) > 0 && !bytes.HasSuffix(normalized, []byte("\n")) {
+		normalized = append(normalized, '\n')
+	}
+
+	if normalization.EOL == EOLCRLF {
+		normalized = bytes.ReplaceAll(normalized, []byte("\n"), []byte("\r\n"))
+	}
+	return
+}
@@ -0,0 +1,51 @@
+package metadata
+
+import (
+	"scmp/core/filesystem"
+	"scmp/internal/config"
+	"testing"
+)
+
+func TestNormalizeContent(t *testing.T) {
+	tests := []struct {
+		name            string
+		content         string
+		normalization   config.Normalization
+		expectedContent string
+	}{
+		{"no normalization keeps content", "a \nb", config.Normalization{}, "a \nb"},
+		{"crlf to lf", "a\r\nb\r\n", config.Normalization{EOL: EOLLF}, "a\nb\n"},
+		{"lf to crlf", "a\nb\n", config.Normalization{EOL: EOLCRLF}, "a\r\nb\r\n"},
+		{"mixed to crlf", "a\r\nb\n", config.Normalization{EOL: EOLCRLF}, "a\r\nb\r\n"},
+		{"trailing newline added", "a\nb", config.Normalization{EnsureTrailingNewline: true}, "a\nb\n"},
+		{"trailing newline kept", "a\nb\n", config.Normalization{EnsureTrailingNewline: true}, "a\nb\n"},
+		{"trailing newline in crlf", "a\r\nb", config.Normalization{EOL: EOLCRLF, EnsureTrailingNewline: true}, "a\r\nb\r\n"},
+		{"empty stays empty", "", config.Normalization{EnsureTrailingNewline: true}, ""},
+		{"trailing whitespace", "a \t\n b  \r\nc\t", config.Normalization{StripTrailingWhitespace: true}, "a\n b\nc"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			normalized := NormalizeContent([]byte(test.content), test.normalization)
+			if string(normalized) != test.expectedContent {
+				t.Errorf("expected content %q, got %q", test.expectedContent, normalized)
+			}
+		})
+	}
+}
+
+func TestEffectiveNormalization(t *testing.T) {
+	defaultNormalization := config.Normalization{EOL: EOLLF, EnsureTrailingNewline: true}
+
+	normalization := EffectiveNormalization(filesystem.MetaHeader{}, defaultNormalization)
+	if normalization != defaultNormalization {
+		t.Errorf("expected default normalization '%+v', got '%+v'", defaultNormalization, normalization)
+	}
+
+	// Header replaces the default entirely
+	headerNormalization := config.Normalization{EOL: EOLCRLF}
+	normalization = EffectiveNormalization(filesystem.MetaHeader{Normalize: &headerNormalization}, defaultNormalization)
+	if normalization != headerNormalization {
+		t.Errorf("expected header normalization '%+v', got '%+v'", headerNormalization, normalization)
+	}
+}
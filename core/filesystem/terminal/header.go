@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"scmp/core/filesystem"
+	"scmp/core/filesystem/metadata"
 	"scmp/internal/str"
 	"strings"
 
@@ -36,6 +37,11 @@ func HeaderEditor(initialHeader filesystem.MetaHeader, fileName str.LocalRepoPat
 			fmt.Sprintf("10 PostapplyCommands         : %v", header.PostapplyCommands),
 			fmt.Sprintf("11 ReloadCommands            : %v", header.ReloadCommands),
 			fmt.Sprintf("12 ReloadGroup               : %s", header.ReloadGroup),
+			fmt.Sprintf("13 BackupStyle               : %s", header.BackupStyle),
+			fmt.Sprintf("14 MaxConcurrentHosts        : %d", header.MaxConcurrentHosts),
+			fmt.Sprintf("15 PreCheckCommands          : %v", header.PreCheckCommands),
+			fmt.Sprintf("16 PostCheckCommands         : %v", metadata.EffectivePostChecks(header)),
+			fmt.Sprintf("17 MaxShrinkPercent          : %d", header.MaxShrinkPercent),
 			"===============================",
 			"Selection  Delete Field  Exit",
 			" [ # ## ]      [ - ]     [ ! ]",
@@ -90,6 +96,18 @@ func HeaderEditor(initialHeader filesystem.MetaHeader, fileName str.LocalRepoPat
 			header.ReloadCommands = editStringSlice(reader, header.ReloadCommands, "ReloadCommands")
 		case "12":
 			header.ReloadGroup = str.ReloadID(promptString(reader, string(header.ReloadGroup), "Enter new ReloadGroup"))
+		case "13":
+			header.BackupStyle = promptString(reader, header.BackupStyle, "Enter new BackupStyle (central, sibling, suffix, archive)")
+		case "14":
+			header.MaxConcurrentHosts = promptInt(reader, header.MaxConcurrentHosts, "Enter new MaxConcurrentHosts (0 for per-host reloads)")
+		case "15":
+			header.PreCheckCommands = editStringSlice(reader, header.PreCheckCommands, "PreCheckCommands")
+		case "16":
+			// Legacy Checks commands are saved back as PostChecks
+			header.PostCheckCommands = editStringSlice(reader, metadata.EffectivePostChecks(header), "PostCheckCommands")
+			header.CheckCommands = nil
+		case "17":
+			header.MaxShrinkPercent = promptInt(reader, header.MaxShrinkPercent, "Enter new MaxShrinkPercent (0 uses config default, 100 disables)")
 		default:
 			fmt.Println("Invalid choice.")
 			waitForEnter(reader)
@@ -1,20 +1,38 @@
 // Package for all custom filesystem operations
 package filesystem
 
-import "scmp/internal/str"
+import (
+	"scmp/internal/config"
+	"scmp/internal/str"
+)
 
 // Struct for metadata json in config files
 type MetaHeader struct {
-	TargetFileOwnerGroup    string              `json:"FileOwnerGroup"`
-	TargetFilePermissions   int                 `json:"FilePermissions"`
-	ExternalContentLocation string              `json:"ExternalContentLocation,omitempty"`
-	SymbolicLinkTarget      str.RemotePath      `json:"SymbolicLinkTarget,omitempty"`
-	Dependencies            []str.LocalRepoPath `json:"Dependencies,omitempty"`
-	PreDeployCommands       []string            `json:"PreDeploy,omitempty"`
-	InstallCommands         []string            `json:"Install,omitempty"`
-	PostInstallCommands     []string            `json:"PostInstall,omitempty"`
-	PreapplyCommands        []string            `json:"PreApply,omitempty"`
-	PostapplyCommands       []string            `json:"PostApply,omitempty"`
-	ReloadCommands          []string            `json:"Reload,omitempty"`
-	ReloadGroup             str.ReloadID        `json:"ReloadGroup,omitempty"`
+	TargetFileOwnerGroup    string                `json:"FileOwnerGroup"`
+	TargetFilePermissions   int                   `json:"FilePermissions"`
+	ExternalContentLocation string                `json:"ExternalContentLocation,omitempty"`
+	SymbolicLinkTarget      str.RemotePath        `json:"SymbolicLinkTarget,omitempty"`
+	Dependencies            []str.LocalRepoPath   `json:"Dependencies,omitempty"`
+	PreDeployCommands       []string              `json:"PreDeploy,omitempty"`
+	InstallCommands         []string              `json:"Install,omitempty"`
+	PostInstallCommands     []string              `json:"PostInstall,omitempty"`
+	InstallOnce             bool                  `json:"InstallOnce,omitempty"` // Install commands are skipped once a remote marker records them as run
+	PreapplyCommands        []string              `json:"PreApply,omitempty"`
+	PostapplyCommands       []string              `json:"PostApply,omitempty"`
+	PreCheckCommands        []string              `json:"PreChecks,omitempty"`
+	PostCheckCommands       []string              `json:"PostChecks,omitempty"`
+	CheckCommands           []string              `json:"Checks,omitempty"` // Alias of PostChecks
+	ReloadCommands          []string              `json:"Reload,omitempty"`
+	ReloadGroup             str.ReloadID          `json:"ReloadGroup,omitempty"`
+	MaxConcurrentHosts      int                   `json:"MaxConcurrentHosts,omitempty"`
+	BackupStyle             string                `json:"BackupStyle,omitempty"`
+	Normalize               *config.Normalization `json:"Normalize,omitempty"`
+	Condition               string                `json:"Condition,omitempty"`        // Host fact condition, file is skipped on hosts where it is false
+	MaxShrinkPercent        int                   `json:"MaxShrinkPercent,omitempty"` // Holds the file when its content shrinks by more than this against the remote file (0 uses the config default)
+	TemplateEngine          string                `json:"TemplateEngine,omitempty"`   // Renders file content per host before deployment ("go" for text/template)
+	Phase                   string                `json:"Phase,omitempty"`            // Deployment phase of the file (install, configure, activate, verify)
+	ACLs                    []string              `json:"ACLs,omitempty"`             // Extended POSIX ACL entries applied after permissions (setfacl syntax)
+	SELinuxContext          string                `json:"SELinuxContext,omitempty"`   // SELinux security context applied after permissions
+	Xattrs                  map[string]string     `json:"Xattrs,omitempty"`           // Extended attributes (user.* or trusted.*) applied after placement
+	Encrypted               bool                  `json:"Encrypted,omitempty"`        // Content section is encrypted with the vault password, decrypted only for deployment
 }
@@ -0,0 +1,174 @@
+// Package for managing the trusted host keys of configured hosts in known_hosts
+package hostkeys
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/parsing"
+	"scmp/internal/secrets"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"slices"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Reads the host key of every selected host and prints its fingerprint and known_hosts status
+// Hosts that cannot be reached are reported and do not stop the scan
+func Scan(ctx context.Context, hostOverride string) (err error) {
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSSSH)
+
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	hostOverride, err = parsing.RetrieveURIFile(ctx, hostOverride)
+	if err != nil {
+		err = fmt.Errorf("failed to parse remote-hosts URI: %w", err)
+		return
+	}
+	err = parsing.ValidateOverride(opts.RegexEnabled, hostOverride)
+	if err != nil {
+		err = fmt.Errorf("remote-hosts: %w", err)
+		return
+	}
+
+	var failedHosts int
+	for _, endpointName := range slices.Sorted(maps.Keys(cfg.HostInfo)) {
+		if parsing.CheckForOverride(ctx, hostOverride, string(endpointName), cfg.HostInfo) {
+			continue
+		}
+
+		scanned, lerr := scanHost(ctx, cfg, endpointName)
+		if lerr != nil {
+			fmt.Fprintf(os.Stderr, "  %-20s failed: %v\n", endpointName, lerr)
+			failedHosts++
+			continue
+		}
+
+		status, lerr := sshinternal.HostKeyStatus(cfg.KnownHosts, scanned, sshinternal.KnownHostAliases(cfg.HostInfo[endpointName]))
+		if lerr != nil {
+			fmt.Fprintf(os.Stderr, "  %-20s failed: %v\n", endpointName, lerr)
+			failedHosts++
+			continue
+		}
+		fmt.Printf("  %-20s %-24s %-8s %s %s\n", endpointName, scanned.Endpoint, status, scanned.Key.Type(), ssh.FingerprintSHA256(scanned.Key))
+	}
+
+	if failedHosts > 0 {
+		err = fmt.Errorf("failed to read host keys of %d host(s)", failedHosts)
+		return
+	}
+	return
+}
+
+// Trusts the host key a host currently presents by writing a hashed known_hosts entry
+// A different key already trusted for the host is never replaced, it has to be removed first
+func Add(ctx context.Context, hostName string) (err error) {
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSSSH)
+
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	endpointName := str.RepoRootDir(hostName)
+	_, hostExists := cfg.HostInfo[endpointName]
+	if !hostExists {
+		err = fmt.Errorf("host '%s' does not exist in config", hostName)
+		return
+	}
+
+	scanned, err := scanHost(ctx, cfg, endpointName)
+	if err != nil {
+		return
+	}
+	fingerprint := scanned.Key.Type() + " " + ssh.FingerprintSHA256(scanned.Key)
+
+	status, err := sshinternal.HostKeyStatus(cfg.KnownHosts, scanned, sshinternal.KnownHostAliases(cfg.HostInfo[endpointName]))
+	if err != nil {
+		return
+	}
+	switch status {
+	case sshinternal.HostKeyKnown:
+		logctx.LogStdInfo(ctx, "Host key of '%s' (%s) is already trusted\n", hostName, fingerprint)
+		return
+	case sshinternal.HostKeyChanged:
+		err = fmt.Errorf("host '%s' presents %s but known_hosts has a different key for %s, remove it first with 'ssh-keys remove %s'",
+			hostName, fingerprint, scanned.KnownHostName, hostName)
+		return
+	}
+
+	if opts.DryRunEnabled {
+		logctx.LogStdInfo(ctx, "Dry-run requested, would trust host key of '%s' (%s) for %s\n", hostName, fingerprint, scanned.KnownHostName)
+		return
+	}
+
+	err = sshinternal.AddKnownHost(cfg.KnownHostsFilePath, scanned)
+	if err != nil {
+		return
+	}
+	logctx.LogStdInfo(ctx, "Trusted host key of '%s' (%s) for %s\n", hostName, fingerprint, scanned.KnownHostName)
+	return
+}
+
+// Removes every known_hosts entry stored under a name or resolved address of a host
+func Remove(ctx context.Context, hostName string) (err error) {
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSSSH)
+
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	endpointName := str.RepoRootDir(hostName)
+	hostInfo, hostExists := cfg.HostInfo[endpointName]
+	if !hostExists {
+		err = fmt.Errorf("host '%s' does not exist in config", hostName)
+		return
+	}
+
+	// Direct connections store keys under the address the name resolved to
+	names := sshinternal.KnownHostAliases(hostInfo)
+	for _, alias := range names[1:] {
+		addresses, lerr := net.DefaultResolver.LookupHost(ctx, alias)
+		if lerr != nil {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog, "Unable to resolve '%s', only entries stored under the name are removed: %v\n", alias, lerr)
+			continue
+		}
+		names = append(names, addresses...)
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	if opts.DryRunEnabled {
+		logctx.LogStdInfo(ctx, "Dry-run requested, would remove known_hosts entries of '%s' stored under: %v\n", hostName, names)
+		return
+	}
+
+	removed, err := sshinternal.RemoveKnownHosts(cfg.KnownHostsFilePath, names)
+	if err != nil {
+		return
+	}
+	logctx.LogStdInfo(ctx, "Removed %d known_hosts entries of '%s'\n", removed, hostName)
+	return
+}
+
+// Reads the host key of one host with its identity (the negotiated key type follows the login key) and proxy secrets
+func scanHost(ctx context.Context, cfg config.Config, endpointName str.RepoRootDir) (scanned sshinternal.ScannedHostKey, err error) {
+	hostInfo, err := secrets.GetHostValues(ctx, cfg.HostInfo[endpointName])
+	if err != nil {
+		err = fmt.Errorf("error retrieving host secrets: %w", err)
+		return
+	}
+	cfg.HostInfo[endpointName] = hostInfo
+	err = secrets.GetProxyValues(ctx, cfg.HostInfo, endpointName)
+	if err != nil {
+		err = fmt.Errorf("error retrieving proxy secrets: %w", err)
+		return
+	}
+
+	scanned, err = sshinternal.ScanHostKey(ctx, hostInfo, cfg.ProxyChainInfo(endpointName))
+	return
+}
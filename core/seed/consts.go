@@ -0,0 +1,11 @@
+package seed
+
+const (
+	DefaultParentDepth int = 10 // Parent directories above a seeded item checked for non-default metadata
+
+	// Parent directory metadata matching these is not saved to the repository
+	defaultDirOwner       string = "root"
+	defaultDirGroup       string = "root"
+	defaultBSDDirGroup    string = "wheel"
+	defaultDirPermissions int    = 755
+)
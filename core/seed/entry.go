@@ -17,8 +17,6 @@ import (
 	"scmp/internal/sshinternal"
 	"scmp/internal/str"
 	"strings"
-
-	"golang.org/x/crypto/ssh"
 )
 
 // Entry point for user to select remote files to download and format into local repository
@@ -44,6 +42,11 @@ func SeedRepositoryFiles(ctx context.Context, hostOverride string, remoteFileOve
 		fmt.Fprintf(os.Stderr, "Failed to parse local-files URI: %v\n", err)
 		os.Exit(1)
 	}
+	err = parsing.ValidateOverride(opts.RegexEnabled, hostOverride)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid remote-hosts: %v\n", err)
+		os.Exit(1)
+	}
 
 	err = network.LocalSystemChecks(ctx)
 	if err != nil {
@@ -76,18 +79,15 @@ func SeedRepositoryFiles(ctx context.Context, hostOverride string, remoteFileOve
 			os.Exit(1)
 		}
 
-		proxyName := cfg.HostInfo[endpointName].Proxy
-		if proxyName != "" {
-			cfg.HostInfo[str.RepoRootDir(proxyName)], err = secrets.GetHostValues(ctx, cfg.HostInfo[str.RepoRootDir(proxyName)])
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error retrieving proxy secrets: %v\n", err)
-				os.Exit(1)
-			}
+		err = secrets.GetProxyValues(ctx, cfg.HostInfo, endpointName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error retrieving proxy secrets: %v\n", err)
+			os.Exit(1)
 		}
 
 		// Retrieve most current global host config
 		hostInfo = cfg.HostInfo[endpointName]
-		proxyInfo := cfg.HostInfo[str.RepoRootDir(cfg.HostInfo[endpointName].Proxy)]
+		proxyChain := cfg.ProxyChainInfo(endpointName)
 
 		// If user requested dry run - print host information and abort connections
 		if opts.DryRunEnabled {
@@ -97,10 +97,10 @@ func SeedRepositoryFiles(ctx context.Context, hostOverride string, remoteFileOve
 
 		var hostMeta sshinternal.HostMeta
 		hostMeta.Name = hostInfo.EndpointName
-		hostMeta.Password = hostInfo.Password
+		hostMeta.Password = hostInfo.SudoPassword
 
-		var proxyClient *ssh.Client
-		hostMeta.SSHClient, proxyClient, err = sshinternal.ConnectToSSH(ctx, hostInfo, proxyInfo)
+		var proxyClient *sshinternal.ProxyLease
+		hostMeta.SSHClient, proxyClient, _, err = sshinternal.ConnectToSSH(ctx, hostInfo, proxyChain)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed connect to SSH server: %v\n", err)
 			os.Exit(1)
@@ -119,15 +119,25 @@ func SeedRepositoryFiles(ctx context.Context, hostOverride string, remoteFileOve
 		}()
 
 		var selectedFiles []string
-		if remoteFileOverride == "" {
-			selectedFiles, err = interactiveSelection(ctx, hostMeta)
+		if remoteFileOverride != "" {
+			// Set user choices directly
+			selectedFiles = strings.Split(remoteFileOverride, ",")
+		}
+		if remoteFileOverride == "" || opts.SeedBrowse {
+			var browsedFiles []string
+			browsedFiles, err = interactiveSelection(ctx, hostMeta, selectedFiles)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error retrieving remote file list: %v\n", err)
 				os.Exit(1)
 			}
-		} else {
-			// Set user choices directly
-			selectedFiles = strings.Split(remoteFileOverride, ",")
+			selectedFiles = append(selectedFiles, browsedFiles...)
+		}
+
+		// Patterns are expanded on the remote host
+		selectedFiles, err = expandRemoteGlobs(ctx, hostMeta, selectedFiles)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error selecting remote files: %v\n", err)
+			os.Exit(1)
 		}
 
 		err = host.RemoteDeploymentPreparation(ctx, &hostMeta)
@@ -142,7 +152,7 @@ func SeedRepositoryFiles(ctx context.Context, hostOverride string, remoteFileOve
 		// File for transfers
 		hostMeta.TransferBufferDir = hostMeta.TransferBufferDir + "/transfer"
 
-		err = sshinternal.SCPUpload(ctx, hostMeta.SSHClient, []byte{12}, hostMeta.TransferBufferDir)
+		err = sshinternal.SCPUpload(ctx, hostMeta.SSHClient, nil, []byte{12}, hostMeta.TransferBufferDir)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to initialize buffer file on remote host %s: %v\n", endpointName, err)
 			os.Exit(1)
@@ -151,6 +161,7 @@ func SeedRepositoryFiles(ctx context.Context, hostOverride string, remoteFileOve
 		optCache := &RepoUserChoiceCache{}
 		optCache.ReloadCmd = make(map[string][]string)
 		optCache.ReloadCnt = make(map[string]int)
+		optCache.ParentDirs = make(map[string]bool)
 		for _, targetFilePath := range selectedFiles {
 			err = handleSelectedFile(ctx, targetFilePath, hostMeta, optCache)
 			if err != nil {
@@ -0,0 +1,128 @@
+package seed
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+)
+
+// Reports whether a remote file selection is a glob pattern
+func isRemoteGlob(selection string) (isGlob bool) {
+	isGlob = strings.ContainsAny(selection, "*?[")
+	return
+}
+
+// Deepest directory of a glob pattern without any pattern characters (where the remote search starts)
+func remoteGlobBase(pattern string) (base string) {
+	segments := strings.Split(pattern, "/")
+	for index, segment := range segments {
+		if isRemoteGlob(segment) {
+			base = strings.Join(segments[:index], "/")
+			break
+		}
+	}
+	if base == "" {
+		base = "/"
+	}
+	return
+}
+
+// Matches a remote path against a glob pattern
+// Segments match like shell globs, a "**" segment matches any number of directories (including none)
+func matchRemoteGlob(pattern string, remotePath string) (matched bool) {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(remotePath, "/"), "/")
+	matched = matchGlobSegments(patternSegments, pathSegments)
+	return
+}
+
+func matchGlobSegments(patternSegments []string, pathSegments []string) (matched bool) {
+	for len(patternSegments) > 0 {
+		if patternSegments[0] == "**" {
+			// Trailing "**" matches everything below
+			if len(patternSegments) == 1 {
+				matched = len(pathSegments) > 0
+				return
+			}
+			for skipped := range len(pathSegments) + 1 {
+				if matchGlobSegments(patternSegments[1:], pathSegments[skipped:]) {
+					matched = true
+					return
+				}
+			}
+			return
+		}
+
+		if len(pathSegments) == 0 {
+			return
+		}
+		segmentMatched, err := path.Match(patternSegments[0], pathSegments[0])
+		if err != nil || !segmentMatched {
+			return
+		}
+		patternSegments = patternSegments[1:]
+		pathSegments = pathSegments[1:]
+	}
+	matched = len(pathSegments) == 0
+	return
+}
+
+// Replaces glob selections with the remote files they match, other selections are kept as given
+// Duplicate selections are only kept once
+func expandRemoteGlobs(ctx context.Context, host sshinternal.HostMeta, selections []string) (expanded []string, err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	for _, selection := range selections {
+		if !isRemoteGlob(selection) {
+			if !slices.Contains(expanded, selection) {
+				expanded = append(expanded, selection)
+			}
+			continue
+		}
+
+		_, err = path.Match(selection, "")
+		if err != nil || !path.IsAbs(selection) {
+			err = fmt.Errorf("invalid remote file pattern '%s': must be an absolute path with valid glob syntax", selection)
+			return
+		}
+
+		base := remoteGlobBase(selection)
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "  Selection '%s': Searching for files below '%s'\n", selection, base)
+
+		command := sshinternal.BuildFindFiles(str.RemotePath(base))
+		command.DisableSudo = opts.DisableSudo
+		command.RunAsUser = opts.RunAsUser
+
+		var findOutput string
+		findOutput, err = command.SSHexec(ctx, host.SSHClient, host.Password)
+		if err != nil {
+			err = fmt.Errorf("failed to search remote files for pattern '%s': %w", selection, err)
+			return
+		}
+
+		var matchCount int
+		for remotePath := range strings.SplitSeq(findOutput, "\n") {
+			if remotePath == "" || !matchRemoteGlob(selection, remotePath) {
+				continue
+			}
+			matchCount++
+			if !slices.Contains(expanded, remotePath) {
+				expanded = append(expanded, remotePath)
+			}
+		}
+
+		if matchCount == 0 {
+			logctx.LogStdWarn(ctx, "Remote file pattern '%s' did not match any files on host %s\n", selection, host.Name)
+			continue
+		}
+		logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.InfoLog, "Remote file pattern '%s' matched %d file(s) on host %s\n", selection, matchCount, host.Name)
+	}
+	return
+}
@@ -0,0 +1,60 @@
+package seed
+
+import (
+	"testing"
+)
+
+func TestRemoteGlobBase(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected string
+	}{
+		{"/etc/nginx/**", "/etc/nginx"},
+		{"/etc/*/conf.d/*.conf", "/etc"},
+		{"/*.conf", "/"},
+		{"/etc/ssh/sshd_config.d/?0-*.conf", "/etc/ssh/sshd_config.d"},
+	}
+
+	for _, test := range tests {
+		if base := remoteGlobBase(test.pattern); base != test.expected {
+			t.Errorf("pattern '%s': expected base '%s', got '%s'", test.pattern, test.expected, base)
+		}
+	}
+}
+
+func TestMatchRemoteGlob(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"/etc/nginx/**", "/etc/nginx/nginx.conf", true},
+		{"/etc/nginx/**", "/etc/nginx/sites-enabled/default", true},
+		{"/etc/nginx/**", "/etc/nginx", false},
+		{"/etc/nginx/*", "/etc/nginx/nginx.conf", true},
+		{"/etc/nginx/*", "/etc/nginx/sites-enabled/default", false},
+		{"/etc/**/*.conf", "/etc/resolv.conf", true},
+		{"/etc/**/*.conf", "/etc/nginx/conf.d/site.conf", true},
+		{"/etc/**/*.conf", "/etc/nginx/mime.types", false},
+		{"/etc/ssh/ssh_host_*_key.pub", "/etc/ssh/ssh_host_ed25519_key.pub", true},
+		{"/etc/ssh/ssh_host_*_key.pub", "/etc/ssh/ssh_host_ed25519_key", false},
+		{"/etc/[ab]*.conf", "/etc/adduser.conf", true},
+		{"/etc/[ab]*.conf", "/etc/resolv.conf", false},
+	}
+
+	for _, test := range tests {
+		if matched := matchRemoteGlob(test.pattern, test.path); matched != test.expected {
+			t.Errorf("pattern '%s' on '%s': expected %t, got %t", test.pattern, test.path, test.expected, matched)
+		}
+	}
+}
+
+func TestSelectionMarks(t *testing.T) {
+	dirList := []string{"hosts", "nginx/", "resolv.conf", "ssh/", "run.sh*"}
+	selectedFiles := []string{"/etc/hosts", "/etc/nginx/nginx.conf", "/etc/run.sh"}
+
+	marks := string(selectionMarks(dirList, "/etc", selectedFiles))
+	if marks != "*+  *" {
+		t.Errorf("expected marks '*+  *', got '%s'", marks)
+	}
+}
@@ -15,8 +15,6 @@ import (
 	"scmp/internal/sshinternal"
 	"scmp/internal/str"
 	"strings"
-
-	"golang.org/x/crypto/ssh"
 )
 
 // Takes a full ls -lA from a directory and extracts:
@@ -45,68 +43,131 @@ func parseDirEntries(lsDirOutput string) (dirList []string, maxNameLenght int) {
 	return
 }
 
-// Walks directory tree above file and retrieves its metadata and writes metadata files to repo if it differs from standard system umask
-func writeNewDirectoryTreeMetadata(ctx context.Context, endpointName string, remoteFilePath string, client *ssh.Client, SudoPassword string) (err error) {
+// Walks directory tree above a seeded item (up to the requested depth) and writes metadata files to repo for directories that differ from standard system umask
+// Walk stops at the first directory with default metadata
+func writeNewDirectoryTreeMetadata(ctx context.Context, host sshinternal.HostMeta, remotePath string, buildStat func(str.RemotePath) sshinternal.RemoteCommand, optCache *RepoUserChoiceCache) (err error) {
 	opts := global.AssertFromContext[config.Opts](ctx, "options", global.OpsKey, "config.Opts")
 
-	// Directory permissions to ignore
-	const defaultOwner string = "root"
-	const defaultGroup string = "root"
-	const defaultPermissions int = 755
-
-	// Path stack (init without filename)
-	remoteDirPath := filepath.Dir(remoteFilePath)
+	// Path stack (init without item name, directory selections may end in a separator)
+	remoteDirPath := filepath.Dir(strings.TrimSuffix(remotePath, "/"))
 
-	// Searching for non-default directories
-	for range global.MaxDirectoryLoopCount {
+	for range min(opts.SeedParentDepth, global.MaxDirectoryLoopCount) {
 		// Break if no more parent dirs
 		if remoteDirPath == "." || len(remoteDirPath) < 2 {
 			break
 		}
 
-		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "  File '%s': Retrieving metadata for parent directory '%s'\n", remoteFilePath, remoteDirPath)
+		defaultMetadata, checked := optCache.ParentDirs[remoteDirPath]
+		if !checked {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "  Selection '%s': Retrieving metadata for parent directory '%s'\n", remotePath, remoteDirPath)
 
-		command := sshinternal.BuildStat(str.RemotePath(remoteDirPath))
-		command.DisableSudo = opts.DisableSudo
-		command.RunAsUser = opts.RunAsUser
+			command := buildStat(str.RemotePath(remoteDirPath))
+			command.DisableSudo = opts.DisableSudo
+			command.RunAsUser = opts.RunAsUser
 
-		var directoryMetadata string
-		directoryMetadata, err = command.SSHexec(ctx, client, SudoPassword)
-		if err != nil {
-			err = fmt.Errorf("ssh command failure: %w", err)
-			return
-		}
+			var directoryMetadata string
+			directoryMetadata, err = command.SSHexec(ctx, host.SSHClient, host.Password)
+			if err != nil {
+				err = fmt.Errorf("ssh command failure: %w", err)
+				return
+			}
 
-		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "  File '%s': Parsing metadata for parent directory '%s'\n", remoteFilePath, remoteDirPath)
+			var metadata sshinternal.RemoteFileInfo
+			metadata, err = sshinternal.ExtractMetadataFromStat(directoryMetadata)
+			if err != nil {
+				return
+			}
+			if metadata.FsType != remote.DirType {
+				logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog, "Expected remote path '%s' to be directory, but got type '%s' instead\n", remoteDirPath, metadata.FsType)
+				break
+			}
 
-		var metadata sshinternal.RemoteFileInfo
-		metadata, err = sshinternal.ExtractMetadataFromStat(directoryMetadata)
-		if err != nil {
-			return
-		}
-		if metadata.FsType != remote.DirType {
-			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog, "Expected remote path to be directory, but got type '%s' instead", metadata.FsType)
-			continue
-		}
+			defaultMetadata = isDefaultDirMetadata(metadata)
+			optCache.ParentDirs[remoteDirPath] = defaultMetadata
 
-		localDirPath := str.LocalRepoPath(filepath.Join(endpointName, remoteDirPath))
+			if !defaultMetadata {
+				logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "  Selection '%s': Parent directory '%s' has non-standard metadata, saving\n", remotePath, remoteDirPath)
 
-		// Save metadata to map if not the default
-		if metadata.Owner != defaultOwner || metadata.Group != defaultGroup || metadata.Permissions != defaultPermissions {
-			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "  File '%s': Parent directory '%s' has non-standard metadata, saving\n", remoteFilePath, remoteDirPath)
-			err = content.WriteNewDirectoryMetadata(ctx, localDirPath, metadata)
-			if err != nil {
-				logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog, "unique directory save failed: %v\n", err)
-				continue
+				localDirPath := str.LocalRepoPath(filepath.Join(string(host.Name), remoteDirPath))
+				err = content.WriteNewDirectoryMetadata(ctx, localDirPath, metadata)
+				if err != nil {
+					logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog, "unique directory save failed: %v\n", err)
+					err = nil
+				}
 			}
 		}
 
+		if defaultMetadata {
+			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "  Selection '%s': Parent directory '%s' has default metadata, stopping\n", remotePath, remoteDirPath)
+			break
+		}
+
 		// Move up one directory for next loop iteration
 		remoteDirPath = filepath.Dir(remoteDirPath)
 	}
 	return
 }
 
+// Reads extended ACL entries and the SELinux context of a remote file
+// Hosts without getfacl or SELinux leave them empty, seeding continues either way
+func collectExtendedAttributes(ctx context.Context, host sshinternal.HostMeta, remotePath str.RemotePath) (aclEntries []string, securityContext string) {
+	opts := global.AssertFromContext[config.Opts](ctx, "options", global.OpsKey, "config.Opts")
+
+	command := sshinternal.BuildGetfacl(remotePath)
+	command.DisableSudo = opts.DisableSudo
+	command.RunAsUser = opts.RunAsUser
+	getfaclOutput, err := command.SSHexec(ctx, host.SSHClient, host.Password)
+	if err != nil {
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog, "  File '%s': ACLs not recorded: %v\n", remotePath, err)
+	} else {
+		aclEntries = sshinternal.ExtractACLEntries(getfaclOutput)
+	}
+
+	command = sshinternal.BuildStatContext(remotePath)
+	command.DisableSudo = opts.DisableSudo
+	command.RunAsUser = opts.RunAsUser
+	contextOutput, err := command.SSHexec(ctx, host.SSHClient, host.Password)
+	contextOutput = strings.TrimSpace(contextOutput)
+	if err != nil || contextOutput == "?" {
+		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "  File '%s': no SELinux context to record\n", remotePath)
+		return
+	}
+	securityContext = contextOutput
+	return
+}
+
+// Reads the user and trusted extended attributes of a remote file
+// Hosts without getfattr or filesystems without xattrs leave them empty, seeding continues either way
+func collectXattrs(ctx context.Context, host sshinternal.HostMeta, remotePath str.RemotePath) (xattrs map[string]string) {
+	opts := global.AssertFromContext[config.Opts](ctx, "options", global.OpsKey, "config.Opts")
+
+	command := sshinternal.BuildGetfattr(remotePath)
+	command.DisableSudo = opts.DisableSudo
+	command.RunAsUser = opts.RunAsUser
+	getfattrOutput, err := command.SSHexec(ctx, host.SSHClient, host.Password)
+	if err == nil {
+		xattrs, err = sshinternal.ExtractXattrs(getfattrOutput)
+	}
+	if err != nil {
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog, "  File '%s': extended attributes not recorded: %v\n", remotePath, err)
+		xattrs = nil
+		return
+	}
+	if len(xattrs) == 0 {
+		xattrs = nil
+	}
+	return
+}
+
+// Directory ownership and permissions that new directories receive on deployment anyways
+func isDefaultDirMetadata(metadata sshinternal.RemoteFileInfo) (isDefault bool) {
+	if metadata.Owner != defaultDirOwner || metadata.Permissions != defaultDirPermissions {
+		return
+	}
+	isDefault = metadata.Group == defaultDirGroup || metadata.Group == defaultBSDDirGroup
+	return
+}
+
 func handleNewReloadCommands(ctx context.Context, remoteFilePath string, localFilePath string, optCache *RepoUserChoiceCache) (reloadCmds []string, err error) {
 	// Recommended reload commands for known configuration files
 	// If user wants reloads, they will be prompted to use the reloads below if the file has the prefix of a map key (reloads are optional)
@@ -1,6 +1,7 @@
 package seed
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
@@ -8,6 +9,7 @@ import (
 	"scmp/core/deployment/remote"
 	"scmp/core/filesystem"
 	"scmp/core/filesystem/content"
+	"scmp/core/filesystem/metadata"
 	"scmp/internal/config"
 	"scmp/internal/global"
 	"scmp/internal/logctx"
@@ -18,6 +20,7 @@ import (
 
 // Downloads user selected files/directories and metadata and writes information to repository
 func handleSelectedFile(ctx context.Context, remoteFilePath string, host sshinternal.HostMeta, optCache *RepoUserChoiceCache) (err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
 	opts := global.AssertFromContext[config.Opts](ctx, "options", global.OpsKey, "config.Opts")
 
 	// Ensure decorators from ls do not get fed into repo
@@ -38,14 +41,16 @@ func handleSelectedFile(ctx context.Context, remoteFilePath string, host sshinte
 	osName := strings.ToLower(unameOutput)
 
 	// Build stat command based on remote OS
+	var buildStat func(str.RemotePath) sshinternal.RemoteCommand
 	if strings.Contains(osName, "bsd") {
-		command = sshinternal.BuildBSDStat(remotePath)
+		buildStat = sshinternal.BuildBSDStat
 	} else if strings.Contains(osName, "linux") {
-		command = sshinternal.BuildStat(remotePath)
+		buildStat = sshinternal.BuildStat
 	} else {
 		err = fmt.Errorf("received unknown os type: %s", unameOutput)
 		return
 	}
+	command = buildStat(remotePath)
 	command.DisableSudo = opts.DisableSudo
 	command.RunAsUser = opts.RunAsUser
 	statOutput, err := command.SSHexec(ctx, host.SSHClient, host.Password)
@@ -62,6 +67,13 @@ func handleSelectedFile(ctx context.Context, remoteFilePath string, host sshinte
 		return
 	}
 
+	// Retrieve and write to repo parent directory permissions that are unique
+	err = writeNewDirectoryTreeMetadata(ctx, host, remoteFilePath, buildStat, optCache)
+	if err != nil {
+		err = fmt.Errorf("failed to walk directory tree metadata for %s: %w", remoteFilePath, err)
+		return
+	}
+
 	if selectionMetadata.FsType == remote.DirType {
 		err = content.WriteNewDirectoryMetadata(ctx, localFilePath, selectionMetadata)
 		return
@@ -76,7 +88,7 @@ func handleSelectedFile(ctx context.Context, remoteFilePath string, host sshinte
 
 	// Custom cp, no need to use -p
 	command = sshinternal.RemoteCommand{
-		Raw:          "cp '" + remoteFilePath + "' '" + string(host.TransferBufferDir) + "'",
+		Raw:          "cp " + sshinternal.QuoteShellArg(remoteFilePath) + " " + sshinternal.QuoteShellArg(string(host.TransferBufferDir)),
 		DisableSudo:  opts.DisableSudo,
 		RunAsUser:    opts.RunAsUser,
 		Timeout:      20,
@@ -102,13 +114,6 @@ func handleSelectedFile(ctx context.Context, remoteFilePath string, host sshinte
 		return
 	}
 
-	// Retrieve and write to repo parent directory permissions that are unique
-	err = writeNewDirectoryTreeMetadata(ctx, string(host.Name), remoteFilePath, host.SSHClient, host.Password)
-	if err != nil {
-		err = fmt.Errorf("failed to walk directory tree metadata for file %s: %w", remoteFilePath, err)
-		return
-	}
-
 	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "  File '%s': Parsing metadata information\n", remoteFilePath)
 
 	// Metadata header
@@ -116,6 +121,14 @@ func handleSelectedFile(ctx context.Context, remoteFilePath string, host sshinte
 	fileMetadata.TargetFileOwnerGroup = selectionMetadata.Owner + ":" + selectionMetadata.Group
 	fileMetadata.TargetFilePermissions = selectionMetadata.Permissions
 
+	// Extended attributes are reapplied after permissions on deployment
+	if strings.Contains(osName, "linux") {
+		fileMetadata.ACLs, fileMetadata.SELinuxContext = collectExtendedAttributes(ctx, host, remotePath)
+		if opts.CaptureXattrs {
+			fileMetadata.Xattrs = collectXattrs(ctx, host, remotePath)
+		}
+	}
+
 	// Get reload commands from user
 	fileMetadata.ReloadCommands, err = handleNewReloadCommands(ctx, remoteFilePath, string(localFilePath), optCache)
 	if err != nil {
@@ -128,6 +141,19 @@ func handleSelectedFile(ctx context.Context, remoteFilePath string, host sshinte
 		return
 	}
 
+	// Text content is stored with LF line endings, remote CRLF endings are kept by the header unless LF is the configured default
+	if fileMetadata.ExternalContentLocation == "" {
+		normalization := cfg.Normalization
+		if bytes.Contains(fileContents, []byte("\r\n")) && normalization.EOL != metadata.EOLLF {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "  File '%s': Recording CRLF line endings in metadata header\n", remoteFilePath)
+			normalization.EOL = metadata.EOLCRLF
+			fileMetadata.Normalize = &normalization
+		}
+		repoNormalization := normalization
+		repoNormalization.EOL = metadata.EOLLF
+		fileContents = metadata.NormalizeContent(fileContents, repoNormalization)
+	}
+
 	// Write metadata and content to repository file
 	err = content.WriteRepoFile(ctx, localFilePath, fileMetadata, &fileContents)
 	if err != nil {
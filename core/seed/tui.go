@@ -11,12 +11,14 @@ import (
 	"scmp/internal/logctx"
 	"scmp/internal/sshinternal"
 	"scmp/internal/str"
+	"slices"
 	"strconv"
 	"strings"
 )
 
 // Runs the CLI-based menu that user will use to select which files to download
-func interactiveSelection(ctx context.Context, host sshinternal.HostMeta) (selectedFiles []string, err error) {
+// Already selected files (like given remote files) are marked in the menu but not returned
+func interactiveSelection(ctx context.Context, host sshinternal.HostMeta, preselectedFiles []string) (selectedFiles []string, err error) {
 	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
 
 	logger := logctx.GetLogger(ctx)
@@ -63,7 +65,8 @@ func interactiveSelection(ctx context.Context, host sshinternal.HostMeta) (selec
 		dirList, maxNameLenght := parseDirEntries(directoryList)
 
 		// Show Menu - Print the directory contents in columns
-		userSelections := dirListMenu(string(host.Name), maxNameLenght, dirList, directoryState.current, logVerbosityLevel)
+		marks := selectionMarks(dirList, directoryState.current, append(slices.Clone(preselectedFiles), selectedFiles...))
+		userSelections := dirListMenu(string(host.Name), maxNameLenght, dirList, marks, directoryState.current, logVerbosityLevel)
 
 		// Parse users selections
 		var userRequestedExit bool
@@ -79,9 +82,31 @@ func interactiveSelection(ctx context.Context, host sshinternal.HostMeta) (selec
 	return
 }
 
+// Marks of directory entries in the menu
+// '*' for selected entries and '+' for directories containing selected entries
+func selectionMarks(dirList []string, currentDirectory string, selectedFiles []string) (marks []byte) {
+	marks = make([]byte, len(dirList))
+	for index, name := range dirList {
+		marks[index] = ' '
+
+		absolutePath := filepath.Join(currentDirectory, strings.TrimRight(name, "*@"))
+		for _, selectedFile := range selectedFiles {
+			selectedFile = filepath.Clean(selectedFile)
+			if selectedFile == absolutePath {
+				marks[index] = '*'
+				break
+			}
+			if strings.HasSuffix(name, "/") && strings.HasPrefix(selectedFile, absolutePath+"/") {
+				marks[index] = '+'
+			}
+		}
+	}
+	return
+}
+
 // Prints out table-like menu for a directory listing
 // Prompts the user to supply their choices of files/directories and returns array of choices (in user chosen order)
-func dirListMenu(endpointName string, maxNameLenght int, dirList []string, currentDirectory string, logVerbosityLevel int) (userSelections []string) {
+func dirListMenu(endpointName string, maxNameLenght int, dirList []string, marks []byte, currentDirectory string, logVerbosityLevel int) (userSelections []string) {
 	// Menu (Table) sizing
 	const numberOfColumns int = 4
 	numberOfDirEntries := len(dirList)
@@ -98,7 +123,7 @@ func dirListMenu(endpointName string, maxNameLenght int, dirList []string, curre
 				continue
 			}
 
-			fmt.Printf("%-4d %-*s", index+1, columnWidth, dirList[index])
+			fmt.Printf("%-4d%c%-*s", index+1, marks[index], columnWidth, dirList[index])
 		}
 		fmt.Println()
 	}
@@ -106,6 +131,7 @@ func dirListMenu(endpointName string, maxNameLenght int, dirList []string, curre
 	fmt.Printf("============================================================\n")
 	fmt.Printf("     Select File     Change Dir ^/v   Recursive   Exit\n")
 	fmt.Printf("     [ # # ## ### ]  [ c0 ]  [ c# ]    [ #r ]     [ ! ]\n")
+	fmt.Printf("     (* selected, + contains selected)\n")
 	fmt.Printf("%s:%s # Type your selections: ", endpointName, currentDirectory)
 
 	reader := bufio.NewReader(os.Stdin)
@@ -123,7 +149,7 @@ func dirListMenu(endpointName string, maxNameLenght int, dirList []string, curre
 
 	// Clear menu rows - add to row count to account for the prompts (only for standard verbosity)
 	if logVerbosityLevel < 2 {
-		maxRows += 5
+		maxRows += 6
 		for maxRows > 0 {
 			fmt.Printf("\033[A\033[K")
 			maxRows--
@@ -179,13 +205,10 @@ func parseUserSelections(ctx context.Context, userSelections []string, dirList [
 
 			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "  Recursing into directory '%s' for all files\n", absolutePath)
 
-			command := sshinternal.RemoteCommand{
-				Raw:          "find '" + absolutePath + "' -type f",
-				RunAsUser:    opts.RunAsUser,
-				DisableSudo:  opts.DisableSudo,
-				Timeout:      opts.ExecutionTimeout,
-				StreamStdout: false,
-			}
+			command := sshinternal.BuildFindFiles(str.RemotePath(absolutePath))
+			command.RunAsUser = opts.RunAsUser
+			command.DisableSudo = opts.DisableSudo
+			command.Timeout = opts.ExecutionTimeout
 			findOutput, err := command.SSHexec(ctx, host.SSHClient, host.Password)
 			if err != nil {
 				return
@@ -10,4 +10,5 @@ type RepoUserChoiceCache struct {
 	ReloadCmd      map[string][]string
 	ReloadCnt      map[string]int
 	ArtifactExtDir map[string]int
+	ParentDirs     map[string]bool // Remote parent directories already checked, true when their metadata is the default
 }
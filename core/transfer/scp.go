@@ -15,8 +15,6 @@ import (
 	"scmp/internal/sshinternal"
 	"scmp/internal/str"
 	"strings"
-
-	"golang.org/x/crypto/ssh"
 )
 
 func BulkFile(ctx context.Context, hostList map[str.RepoRootDir]config.EndpointInfo, sourceHost string, sourcePath string, destHost string, destPath string) (err error) {
@@ -82,22 +80,19 @@ func BulkFile(ctx context.Context, hostList map[str.RepoRootDir]config.EndpointI
 			return
 		}
 
-		proxyName := cfg.HostInfo[hostName].Proxy
-		if proxyName != "" {
-			cfg.HostInfo[str.RepoRootDir(proxyName)], err = secrets.GetHostValues(ctx, cfg.HostInfo[str.RepoRootDir(proxyName)])
-			if err != nil {
-				err = fmt.Errorf("error retrieving proxy secrets: %w", err)
-				return
-			}
+		err = secrets.GetProxyValues(ctx, cfg.HostInfo, hostName)
+		if err != nil {
+			err = fmt.Errorf("error retrieving proxy secrets: %w", err)
+			return
 		}
 
 		// Connect
 		var hostMeta sshinternal.HostMeta
 		hostMeta.Name = cfg.HostInfo[hostName].EndpointName
-		hostMeta.Password = cfg.HostInfo[hostName].Password
+		hostMeta.Password = cfg.HostInfo[hostName].SudoPassword
 
-		var proxyClient *ssh.Client
-		hostMeta.SSHClient, proxyClient, err = sshinternal.ConnectToSSH(ctx, cfg.HostInfo[hostName], cfg.HostInfo[str.RepoRootDir(proxyName)])
+		var proxyClient *sshinternal.ProxyLease
+		hostMeta.SSHClient, proxyClient, _, err = sshinternal.ConnectToSSH(ctx, cfg.HostInfo[hostName], cfg.ProxyChainInfo(hostName))
 		if err != nil {
 			err = fmt.Errorf("failed connect to SSH server %w", err)
 			return
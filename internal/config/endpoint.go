@@ -0,0 +1,10 @@
+package config
+
+// All addresses of the host in connection order (primary first)
+func (info EndpointInfo) Endpoints() (endpoints []string) {
+	if info.Endpoint != "" {
+		endpoints = append(endpoints, info.Endpoint)
+	}
+	endpoints = append(endpoints, info.FallbackEndpoints...)
+	return
+}
@@ -0,0 +1,45 @@
+package config
+
+// Deployment options replaced for a single host (unset fields keep the command line value)
+type OptionOverrides struct {
+	DisableReloads   *bool  // Direct match to the config option "DisableReloads" (nil when unset)
+	RunAsUser        string // Direct match to the config option "RunAsUser"
+	ExecutionTimeout int    // Direct match to the config option "ExecutionTimeout" in seconds (zero when unset)
+	BandwidthLimit   int    // Direct match to the config option "BandwidthLimit" in KiB/s (zero when unset)
+}
+
+// Combines two sets of overrides, options set in higher replace the same options of overrides
+func (overrides OptionOverrides) Merge(higher OptionOverrides) (merged OptionOverrides) {
+	merged = overrides
+	if higher.DisableReloads != nil {
+		merged.DisableReloads = higher.DisableReloads
+	}
+	if higher.RunAsUser != "" {
+		merged.RunAsUser = higher.RunAsUser
+	}
+	if higher.ExecutionTimeout > 0 {
+		merged.ExecutionTimeout = higher.ExecutionTimeout
+	}
+	if higher.BandwidthLimit > 0 {
+		merged.BandwidthLimit = higher.BandwidthLimit
+	}
+	return
+}
+
+// Options for a single host deployment, set overrides take precedence over the command line
+func (overrides OptionOverrides) Apply(opts Opts) (hostOpts Opts) {
+	hostOpts = opts
+	if overrides.DisableReloads != nil {
+		hostOpts.DisableReloads = *overrides.DisableReloads
+	}
+	if overrides.RunAsUser != "" {
+		hostOpts.RunAsUser = overrides.RunAsUser
+	}
+	if overrides.ExecutionTimeout > 0 {
+		hostOpts.ExecutionTimeout = overrides.ExecutionTimeout
+	}
+	if overrides.BandwidthLimit > 0 {
+		hostOpts.BandwidthLimit = overrides.BandwidthLimit
+	}
+	return
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"net"
+	"scmp/internal/str"
+	"strings"
+)
+
+// Retrieves endpoint information of each proxy hop for a host, in connection order
+// A user or port given for the hop in the hosts ProxyJump ([user@]host[:port]) replaces the one of the hops own Host block
+func (cfg Config) ProxyChainInfo(endpointName str.RepoRootDir) (proxyChain []EndpointInfo) {
+	hops := ParseProxyJump(cfg.HostInfo[endpointName].Proxy)
+	for hopIndex, hopName := range cfg.HostInfo[endpointName].ProxyChain {
+		proxyInfo := cfg.HostInfo[hopName]
+		if hopIndex < len(hops) && hops[hopIndex].Name == hopName {
+			proxyInfo = hops[hopIndex].apply(proxyInfo)
+		}
+		proxyChain = append(proxyChain, proxyInfo)
+	}
+	return
+}
+
+// Parses a ProxyJump value into its hops (nil for none)
+func ParseProxyJump(proxyJump string) (hops []ProxyHop) {
+	if strings.ToLower(strings.TrimSpace(proxyJump)) == "none" {
+		return
+	}
+
+	for hopField := range strings.SplitSeq(proxyJump, ",") {
+		hopField = strings.TrimSpace(hopField)
+		if hopField == "" {
+			continue
+		}
+
+		var hop ProxyHop
+		user, hostPort, hasUser := strings.Cut(hopField, "@")
+		if hasUser {
+			hop.User = user
+		} else {
+			hostPort = hopField
+		}
+		host, port, err := net.SplitHostPort(hostPort)
+		if err == nil {
+			hop.Name = str.RepoRootDir(host)
+			hop.Port = port
+		} else {
+			hop.Name = str.RepoRootDir(hostPort)
+		}
+		hops = append(hops, hop)
+	}
+	return
+}
+
+// Hop endpoint information with the user and port given in ProxyJump
+func (hop ProxyHop) apply(proxyInfo EndpointInfo) (hopInfo EndpointInfo) {
+	hopInfo = proxyInfo
+	if hop.User != "" {
+		hopInfo.EndpointUser = hop.User
+	}
+	if hop.Port == "" {
+		return
+	}
+
+	hopInfo.Endpoint = withPort(proxyInfo.Endpoint, hop.Port)
+	hopInfo.FallbackEndpoints = nil
+	for _, endpoint := range proxyInfo.FallbackEndpoints {
+		hopInfo.FallbackEndpoints = append(hopInfo.FallbackEndpoints, withPort(endpoint, hop.Port))
+	}
+	return
+}
+
+// Address with its port replaced (unchanged when it has no port)
+func withPort(endpoint string, port string) (newEndpoint string) {
+	newEndpoint = endpoint
+	host, _, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return
+	}
+	newEndpoint = net.JoinHostPort(host, port)
+	return
+}
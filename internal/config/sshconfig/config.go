@@ -5,15 +5,23 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"scmp/core/deployment"
+	"scmp/core/deployment/snapshot"
+	"scmp/core/filesystem"
+	"scmp/core/filesystem/metadata"
 	"scmp/internal/config"
 	"scmp/internal/fsops"
 	"scmp/internal/gitinternal"
 	"scmp/internal/global"
+	"scmp/internal/logctx"
 	"scmp/internal/sshinternal"
 	"scmp/internal/str"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/kevinburke/ssh_config"
 )
@@ -28,13 +36,12 @@ func Set(ctx context.Context, configFilePath string) (newCtx context.Context, er
 		return
 	}
 
-	// Load Config File
-	sshConfigFile, err := os.ReadFile(configFilePath)
+	// Load Config File (and every file it includes)
+	sshConfigContents, matchHeaders, err := readConfigWithIncludes(ctx, configFilePath)
 	if err != nil {
 		err = fmt.Errorf("reading config failed: %w", err)
 		return
 	}
-	sshConfigContents := string(sshConfigFile)
 
 	// Retrieve SSH Config file options
 	sshConfig, err := ssh_config.Decode(strings.NewReader(sshConfigContents))
@@ -44,7 +51,7 @@ func Set(ctx context.Context, configFilePath string) (newCtx context.Context, er
 	}
 
 	// Do everything with relative paths inside repository
-	cfg.RepositoryPath, err = gitinternal.RetrieveRepoPath(ctx)
+	cfg.RepositoryPath, cfg.GitDirectory, err = gitinternal.DiscoverRepository(ctx)
 	if err != nil {
 		err = fmt.Errorf("failed retrieving local repository path: %w", err)
 		return
@@ -62,36 +69,17 @@ func Set(ctx context.Context, configFilePath string) (newCtx context.Context, er
 		cfg.KnownHostsFilePath = filepath.Join(sshConfDir, sshinternal.KnownHostsFile)
 	}
 
-	// Format known_hosts path correctly
-	cfg.KnownHostsFilePath, err = fsops.ExpandHomeDirectory(cfg.KnownHostsFilePath)
+	cfg.KnownHostsFilePath, cfg.KnownHosts, err = readKnownHosts(cfg.KnownHostsFilePath)
 	if err != nil {
-		err = fmt.Errorf("failed to resolve absolute path to '%s': %w", cfg.KnownHostsFilePath, err)
 		return
 	}
 
-	// Ensure known_hosts file exists, if not create it
-	_, err = os.Stat(cfg.KnownHostsFilePath)
-	if os.IsNotExist(err) {
-		var knownHostsFile *os.File
-		knownHostsFile, err = os.Create(cfg.KnownHostsFilePath)
-		if err != nil {
-			return
-		}
-		_ = knownHostsFile.Close()
-	} else if err != nil {
-		return
-	}
-
-	// Read in file
-	knownHostFile, err := os.ReadFile(cfg.KnownHostsFilePath)
+	// Command line choice replaces the prompt for unknown host keys
+	cfg.HostKeyChecking, err = hostKeyChecking(ctx)
 	if err != nil {
-		err = fmt.Errorf("unable to read known_hosts file: %w", err)
 		return
 	}
 
-	// Store all known_hosts as array
-	cfg.KnownHosts = strings.Split(string(knownHostFile), "\n")
-
 	// All config dir names in repo
 	universalDir, _ := sshConfig.Get("", "UniversalDirectory")
 	if strings.Contains(universalDir, string(os.PathSeparator)) {
@@ -108,19 +96,207 @@ func Set(ctx context.Context, configFilePath string) (newCtx context.Context, er
 		return
 	}
 
+	// Universal file host count before deployment requires confirmation
+	fanoutThreshold, _ := sshConfig.Get("", "UniversalFanoutWarningThreshold")
+	if fanoutThreshold != "" {
+		cfg.FanoutThreshold, err = strconv.Atoi(fanoutThreshold)
+		if err != nil || cfg.FanoutThreshold < 0 {
+			err = fmt.Errorf("UniversalFanoutWarningThreshold must be zero or a positive number, got '%s'", fanoutThreshold)
+			return
+		}
+	}
+
+	// Artifact size before content is streamed from disk instead of loaded into memory
+	cfg.StreamThreshold = int64(sshinternal.DefaultStreamThresholdMB) * 1024 * 1024
+	streamThreshold, _ := sshConfig.Get("", "ArtifactStreamThresholdMB")
+	if streamThreshold != "" {
+		var thresholdMB int
+		thresholdMB, err = strconv.Atoi(streamThreshold)
+		if err != nil || thresholdMB < 0 {
+			err = fmt.Errorf("ArtifactStreamThresholdMB must be zero or a positive number, got '%s'", streamThreshold)
+			return
+		}
+		cfg.StreamThreshold = int64(thresholdMB) * 1024 * 1024
+	}
+
+	// Downloaded artifacts (http, https, s3) are kept by content hash so repeated deployments do not fetch them again
+	cfg.ArtifactCacheDir, _ = sshConfig.Get("", "ArtifactCacheDirectory")
+	if cfg.ArtifactCacheDir == "" {
+		cfg.ArtifactCacheDir = filepath.Join(filepath.Dir(sshinternal.DefaultConfigPath), filesystem.ArtifactCacheDirName)
+	}
+	cfg.ArtifactCacheDir, err = fsops.ExpandHomeDirectory(cfg.ArtifactCacheDir)
+	if err != nil {
+		err = fmt.Errorf("failed to resolve absolute path to '%s': %w", cfg.ArtifactCacheDir, err)
+		return
+	}
+	cfg.ArtifactS3Region, _ = sshConfig.Get("", "ArtifactS3Region")
+	if cfg.ArtifactS3Region == "" {
+		cfg.ArtifactS3Region = os.Getenv("AWS_REGION")
+	}
+	if cfg.ArtifactS3Region == "" {
+		cfg.ArtifactS3Region = filesystem.DefaultS3Region
+	}
+	cfg.ArtifactS3Endpoint, _ = sshConfig.Get("", "ArtifactS3Endpoint")
+	if cfg.ArtifactS3Endpoint == "" {
+		cfg.ArtifactS3Endpoint = "https://s3." + cfg.ArtifactS3Region + ".amazonaws.com"
+	}
+	if !strings.HasPrefix(cfg.ArtifactS3Endpoint, global.HTTPSURIPrefix) && !strings.HasPrefix(cfg.ArtifactS3Endpoint, global.HTTPURIPrefix) {
+		err = fmt.Errorf("ArtifactS3Endpoint must be an http or https URL, got '%s'", cfg.ArtifactS3Endpoint)
+		return
+	}
+	cfg.ArtifactS3Endpoint = strings.TrimSuffix(cfg.ArtifactS3Endpoint, "/")
+
+	// Default shrink guard of files (metadata can replace it)
+	maxShrinkPercent, _ := sshConfig.Get("", "MaxShrinkPercent")
+	if maxShrinkPercent != "" {
+		cfg.MaxShrinkPercent, err = strconv.Atoi(maxShrinkPercent)
+		if err != nil || cfg.MaxShrinkPercent < 0 || cfg.MaxShrinkPercent > 100 {
+			err = fmt.Errorf("MaxShrinkPercent must be a number between 0 and 100, got '%s'", maxShrinkPercent)
+			return
+		}
+	}
+
+	// Failures in a deployment phase stop the host, the phase, or nothing
+	cfg.PhaseAbort, _ = sshConfig.Get("", "PhaseAbort")
+	switch cfg.PhaseAbort {
+	case "":
+		cfg.PhaseAbort = deployment.PhaseAbortContinue
+	case deployment.PhaseAbortHost, deployment.PhaseAbortPhase, deployment.PhaseAbortContinue:
+	default:
+		err = fmt.Errorf("PhaseAbort must be one of '%s', '%s', or '%s', got '%s'",
+			deployment.PhaseAbortHost, deployment.PhaseAbortPhase, deployment.PhaseAbortContinue, cfg.PhaseAbort)
+		return
+	}
+
+	// Local executables run around deployments
+	for _, hook := range []struct {
+		option string
+		path   *string
+	}{
+		{"PreDeployHook", &cfg.PreDeployHook},
+		{"PostDeployHook", &cfg.PostDeployHook},
+	} {
+		hookPath, _ := sshConfig.Get("", hook.option)
+		if hookPath == "" {
+			continue
+		}
+		*hook.path, err = fsops.ExpandHomeDirectory(hookPath)
+		if err != nil {
+			err = fmt.Errorf("failed to resolve absolute path to %s '%s': %w", hook.option, hookPath, err)
+			return
+		}
+	}
+
+	// Remote file backup location
+	cfg.BackupStyle, _ = sshConfig.Get("", "BackupStyle")
+	switch cfg.BackupStyle {
+	case "":
+		cfg.BackupStyle = sshinternal.BackupStyleCentral
+	case sshinternal.BackupStyleCentral, sshinternal.BackupStyleSibling, sshinternal.BackupStyleSuffix, sshinternal.BackupStyleArchive:
+	default:
+		err = fmt.Errorf("BackupStyle must be one of '%s', '%s', '%s', or '%s', got '%s'",
+			sshinternal.BackupStyleCentral, sshinternal.BackupStyleSibling, sshinternal.BackupStyleSuffix, sshinternal.BackupStyleArchive, cfg.BackupStyle)
+		return
+	}
+	cfg.BackupSuffix, _ = sshConfig.Get("", "BackupSuffix")
+	if cfg.BackupSuffix == "" {
+		cfg.BackupSuffix = sshinternal.DefaultBackupSuffix
+	} else if strings.Contains(cfg.BackupSuffix, "/") {
+		err = fmt.Errorf("BackupSuffix must not contain a path separator, got '%s'", cfg.BackupSuffix)
+		return
+	}
+	cfg.BackupDirectory, _ = sshConfig.Get("", "BackupDirectory")
+	if cfg.BackupDirectory == "" {
+		cfg.BackupDirectory = sshinternal.DefaultBackupDirectory
+	} else if !path.IsAbs(cfg.BackupDirectory) || path.Clean(cfg.BackupDirectory) == "/" {
+		err = fmt.Errorf("BackupDirectory must be an absolute path below the root directory, got '%s'", cfg.BackupDirectory)
+		return
+	}
+	cfg.BackupDirectory = path.Clean(cfg.BackupDirectory)
+	cfg.BackupRetention = sshinternal.DefaultBackupRetention
+	backupRetention, _ := sshConfig.Get("", "BackupRetention")
+	if backupRetention != "" {
+		cfg.BackupRetention, err = strconv.Atoi(backupRetention)
+		if err != nil || cfg.BackupRetention < 0 {
+			err = fmt.Errorf("BackupRetention must be zero or a positive number, got '%s'", backupRetention)
+			return
+		}
+	}
+
+	// Default content normalization (files can replace it with a Normalize header)
+	cfg.Normalization.EOL, _ = sshConfig.Get("", "NormalizeEOL")
+	cfg.Normalization.EOL = strings.ToLower(cfg.Normalization.EOL)
+	switch cfg.Normalization.EOL {
+	case "", metadata.EOLLF, metadata.EOLCRLF:
+	default:
+		err = fmt.Errorf("NormalizeEOL must be '%s' or '%s', got '%s'", metadata.EOLLF, metadata.EOLCRLF, cfg.Normalization.EOL)
+		return
+	}
+	trailingNewline, _ := sshConfig.Get("", "NormalizeTrailingNewline")
+	cfg.Normalization.EnsureTrailingNewline = strings.ToLower(trailingNewline) == "yes"
+	trailingWhitespace, _ := sshConfig.Get("", "NormalizeTrailingWhitespace")
+	cfg.Normalization.StripTrailingWhitespace = strings.ToLower(trailingWhitespace) == "yes"
+
+	// Control sockets of persistent connections (controller connect --persist)
+	cfg.ControlDirectory, _ = sshConfig.Get("", "ControlDirectory")
+	if cfg.ControlDirectory == "" {
+		cfg.ControlDirectory = filepath.Join(filepath.Dir(sshinternal.DefaultConfigPath), sshinternal.DefaultControlDirName)
+	}
+	cfg.ControlDirectory, err = fsops.ExpandHomeDirectory(cfg.ControlDirectory)
+	if err != nil {
+		err = fmt.Errorf("failed to resolve absolute path to '%s': %w", cfg.ControlDirectory, err)
+		return
+	}
+
+	// Local copies of remote state around deployments (only for hosts with snapshots enabled)
+	cfg.SnapshotDirectory, _ = sshConfig.Get("", "SnapshotDirectory")
+	if cfg.SnapshotDirectory == "" {
+		cfg.SnapshotDirectory = filepath.Join(filepath.Dir(sshinternal.DefaultConfigPath), snapshot.DefaultDirectoryName)
+	}
+	cfg.SnapshotDirectory, err = fsops.ExpandHomeDirectory(cfg.SnapshotDirectory)
+	if err != nil {
+		err = fmt.Errorf("failed to resolve absolute path to '%s': %w", cfg.SnapshotDirectory, err)
+		return
+	}
+	cfg.SnapshotMaxSize = int64(snapshot.DefaultMaxFileSizeMB) * 1024 * 1024
+	snapshotMaxSize, _ := sshConfig.Get("", "SnapshotMaxFileSizeMB")
+	if snapshotMaxSize != "" {
+		var maxSizeMB int
+		maxSizeMB, err = strconv.Atoi(snapshotMaxSize)
+		if err != nil || maxSizeMB < 1 {
+			err = fmt.Errorf("SnapshotMaxFileSizeMB must be a positive number, got '%s'", snapshotMaxSize)
+			return
+		}
+		cfg.SnapshotMaxSize = int64(maxSizeMB) * 1024 * 1024
+	}
+	cfg.SnapshotRetention = snapshot.DefaultRetention
+	snapshotRetention, _ := sshConfig.Get("", "SnapshotRetention")
+	if snapshotRetention != "" {
+		cfg.SnapshotRetention, err = strconv.Atoi(snapshotRetention)
+		if err != nil || cfg.SnapshotRetention < 0 {
+			err = fmt.Errorf("SnapshotRetention must be zero or a positive number, got '%s'", snapshotRetention)
+			return
+		}
+	}
+
 	// Initialize vault map
 	cfg.Vault = make(map[str.RepoRootDir]config.Credential)
 
 	// Array of Hosts and their info
 	cfg.HostInfo = make(map[str.RepoRootDir]config.EndpointInfo)
 	cfg.AllUniversalGroups = make(map[str.RepoRootDir][]str.RepoRootDir)
-	var hostInfo config.EndpointInfo
-	for _, host := range sshConfig.Hosts {
+	for hostIndex, host := range sshConfig.Hosts {
 		// Skip host patterns with more than one pattern
 		if len(host.Patterns) != 1 {
 			continue
 		}
 
+		// Match blocks only add options to hosts defined elsewhere
+		_, isMatchBlock := matchHeaders[hostIndex]
+		if isMatchBlock {
+			continue
+		}
+
 		// Convert host pattern to string
 		hostPattern := host.Patterns[0].String()
 
@@ -131,6 +307,9 @@ func Set(ctx context.Context, configFilePath string) (newCtx context.Context, er
 
 		hostDir := str.RepoRootDir(hostPattern)
 
+		// Fresh info per host so options never carry over from a previous host
+		var hostInfo config.EndpointInfo
+
 		// Save hostname into info map
 		hostInfo.EndpointName = hostDir
 
@@ -140,18 +319,37 @@ func Set(ctx context.Context, configFilePath string) (newCtx context.Context, er
 		// First item must be present
 		endpointAddr, _ := sshConfig.Get(hostPattern, "Hostname")
 
-		// Get port from endpoint
+		// Get port from endpoint (default SSH port when unset)
 		endpointPort, _ := sshConfig.Get(hostPattern, "Port")
+		if endpointPort == "" {
+			endpointPort = ssh_config.Default("Port")
+		}
 
 		// Network Address Parsing - only if address
 		if endpointAddr != "" && endpointPort != "" {
 			hostInfo.Endpoint, err = sshinternal.ParseEndpointAddress(endpointAddr, endpointPort)
 			if err != nil {
-				err = fmt.Errorf("failed parsing network address: %w", err)
-				return
+				hostInfo.EndpointError = fmt.Errorf("failed parsing network address: %w", err)
+			}
+		}
+
+		// Alternate addresses (comma separated) use the same port as the primary address
+		fallbackAddrs, _ := sshConfig.Get(hostPattern, "FallbackHostname")
+		if hostInfo.EndpointError == nil {
+			hostInfo.FallbackEndpoints, err = parseFallbackEndpoints(hostInfo.Endpoint, fallbackAddrs, endpointPort)
+			if err != nil {
+				hostInfo.EndpointError = fmt.Errorf("invalid FallbackHostname: %w", err)
 			}
 		}
 
+		// Unusable addresses only fail this host when it is connected to, not the whole config
+		if hostInfo.EndpointError != nil {
+			logctx.LogStdWarn(ctx, "Host '%s': %v\n", hostDir, hostInfo.EndpointError)
+			hostInfo.Endpoint = ""
+			hostInfo.FallbackEndpoints = nil
+			err = nil
+		}
+
 		// Get timeout value if present
 		connectTimeout, _ := sshConfig.Get(hostPattern, "ConnectTimeout")
 		if connectTimeout != "" {
@@ -162,8 +360,84 @@ func Set(ctx context.Context, configFilePath string) (newCtx context.Context, er
 			}
 		}
 
-		// Get proxy
+		// Retries of dial-level connection failures
+		connectAttempts, _ := sshConfig.Get(hostPattern, "ConnectAttempts")
+		if connectAttempts != "" {
+			hostInfo.ConnectAttempts, err = strconv.Atoi(connectAttempts)
+			if err != nil || hostInfo.ConnectAttempts < 1 {
+				err = fmt.Errorf("host '%s': ConnectAttempts must be a positive number, got '%s'", hostDir, connectAttempts)
+				return
+			}
+		}
+		connectRetryDelay, _ := sshConfig.Get(hostPattern, "ConnectRetryDelay")
+		if connectRetryDelay != "" {
+			hostInfo.ConnectRetryDelay, err = time.ParseDuration(connectRetryDelay)
+			if err != nil || hostInfo.ConnectRetryDelay <= 0 {
+				err = fmt.Errorf("host '%s': ConnectRetryDelay must be a duration greater than zero (like 2s), got '%s'", hostDir, connectRetryDelay)
+				return
+			}
+		}
+
+		// Command line options replace the configured retry policy of every host
+		opts, optsPresent := ctx.Value(global.OpsKey).(config.Opts)
+		if optsPresent && opts.ConnectAttempts > 0 {
+			hostInfo.ConnectAttempts = opts.ConnectAttempts
+		}
+		if optsPresent && opts.ConnectRetryDelay > 0 {
+			hostInfo.ConnectRetryDelay = opts.ConnectRetryDelay
+		}
+
+		// Total deployment time limit for this host (Go duration like 10m)
+		hostDeadline, _ := sshConfig.Get(hostPattern, "HostDeadline")
+		if hostDeadline != "" {
+			hostInfo.HostDeadline, err = time.ParseDuration(hostDeadline)
+			if err != nil {
+				err = fmt.Errorf("host '%s': failed parsing HostDeadline value: %w", hostDir, err)
+				return
+			}
+			if hostInfo.HostDeadline <= 0 {
+				err = fmt.Errorf("host '%s': HostDeadline must be greater than zero, got '%s'", hostDir, hostDeadline)
+				return
+			}
+		}
+
+		// Snapshots of planned files around deployments (command line option enables them for every host)
+		snapshotEnabled, _ := sshConfig.Get(hostPattern, "Snapshot")
+		hostInfo.Snapshot = strings.ToLower(snapshotEnabled) == "yes"
+		if optsPresent && opts.Snapshot {
+			hostInfo.Snapshot = true
+		}
+
+		// Sensitive hosts are never deployed to without confirmation naming them
+		requireConfirmation, _ := sshConfig.Get(hostPattern, "RequireConfirmation")
+		hostInfo.RequireConfirm = strings.ToLower(requireConfirmation) == "yes"
+
+		// Remote commands on a pseudo-terminal (sudo with requiretty), same values as OpenSSH
+		requestTTY, _ := sshConfig.Get(hostPattern, "RequestTTY")
+		switch strings.ToLower(requestTTY) {
+		case "yes", "force":
+			hostInfo.RequestTTY = true
+		case "", "no", "auto":
+			hostInfo.RequestTTY = false
+		default:
+			err = fmt.Errorf("host '%s': RequestTTY must be yes, force, no, or auto, got '%s'", hostDir, requestTTY)
+			return
+		}
+
+		// User defined values for file templates (comma separated name=value)
+		hostVars, _ := sshConfig.Get(hostPattern, "Vars")
+		hostInfo.Vars, err = parseHostVars(hostVars)
+		if err != nil {
+			err = fmt.Errorf("host '%s': invalid Vars: %w", hostDir, err)
+			return
+		}
+
+		// Get proxy (comma separated for multiple hops)
 		hostInfo.Proxy, _ = sshConfig.Get(hostPattern, "ProxyJump")
+		hostInfo.ProxyChain = parseProxyJump(hostInfo.Proxy)
+
+		// Address family only matters for DNS names with both IPv4 and IPv6 addresses
+		hostInfo.AddressFamily, _ = sshConfig.Get(hostPattern, "AddressFamily")
 
 		// Get identity file path
 		hostInfo.IdentityFile, _ = sshConfig.Get(hostPattern, "IdentityFile")
@@ -181,6 +455,27 @@ func Set(ctx context.Context, configFilePath string) (newCtx context.Context, er
 			hostInfo.RequiresVault = false
 		}
 
+		// External password providers, used instead of the vault for this host
+		hostInfo.PasswordCommand, _ = sshConfig.Get(hostPattern, "PasswordCommand")
+		hostInfo.PasswordEnv, _ = sshConfig.Get(hostPattern, "PasswordEnv")
+		if hostInfo.PasswordCommand != "" && hostInfo.PasswordEnv != "" {
+			err = fmt.Errorf("host '%s': PasswordCommand and PasswordEnv cannot both be set", hostDir)
+			return
+		}
+
+		// Deployment options replacing command line options for this host (group options are added once all groups are known)
+		for _, option := range overridableOptions {
+			optionValue, _ := sshConfig.Get(hostPattern, option)
+			if optionValue == "" {
+				continue
+			}
+			err = parseOptionOverride(&hostInfo.Overrides, option, optionValue)
+			if err != nil {
+				err = fmt.Errorf("host '%s': %w", hostDir, err)
+				return
+			}
+		}
+
 		// Save deployment state of this host
 		hostInfo.DeploymentState, _ = sshConfig.Get(hostPattern, "DeploymentState")
 
@@ -191,19 +486,111 @@ func Set(ctx context.Context, configFilePath string) (newCtx context.Context, er
 		ignoreUniversalString, _ := sshConfig.Get(hostPattern, "IgnoreUniversal")
 
 		// Parse config host groups into necessary global/host variables
-		hostInfo.IgnoreUniversal, hostInfo.UniversalGroups = filterHostGroups(cfg, hostDir, universalGroupsCSV, ignoreUniversalString)
+		hostInfo.IgnoreUniversal, hostInfo.UniversalGroups, hostInfo.GroupOrder = filterHostGroups(cfg, hostDir, universalGroupsCSV, ignoreUniversalString)
 
 		// write into config
 		cfg.HostInfo[hostDir] = hostInfo
 	}
 
+	// Proxy hops must be other configured hosts (requires all hosts)
+	err = validateProxyChains(cfg.HostInfo)
+	if err != nil {
+		err = fmt.Errorf("invalid ProxyJump: %w", err)
+		return
+	}
+
+	// Group option defaults, options set on the host itself take precedence (requires all groups)
+	groupOptions, _ := sshConfig.Get("", "GroupOptions")
+	groupOverrides, err := parseGroupOptions(cfg, groupOptions)
+	if err != nil {
+		err = fmt.Errorf("invalid GroupOptions: %w", err)
+		return
+	}
+	for hostName, hostInfo := range cfg.HostInfo {
+		var mergedOverrides config.OptionOverrides
+		mergedOverrides, err = mergeGroupOverrides(hostInfo.UniversalGroups, groupOverrides)
+		if err != nil {
+			err = fmt.Errorf("invalid GroupOptions for host '%s': %w", hostName, err)
+			return
+		}
+		hostInfo.Overrides = mergedOverrides.Merge(hostInfo.Overrides)
+		cfg.HostInfo[hostName] = hostInfo
+	}
+
+	// Precedence of groups containing the same file path (requires all groups)
+	groupPriority, _ := sshConfig.Get("", "GroupPriority")
+	cfg.GroupPriority, err = parseGroupPriority(cfg, groupPriority)
+	if err != nil {
+		err = fmt.Errorf("invalid GroupPriority: %w", err)
+		return
+	}
+
+	// Branches that specific hosts deploy from (requires all hosts and groups)
+	branchMappings, _ := sshConfig.Get("", "BranchMappings")
+	cfg.BranchMappings, err = parseBranchMappings(cfg, branchMappings)
+	if err != nil {
+		err = fmt.Errorf("invalid BranchMappings: %w", err)
+		return
+	}
+
 	newCtx = context.WithValue(ctx, global.ConfKey, cfg)
 	return
 }
 
+// Reads known_hosts file (created when missing), returns its absolute path and lines
+func readKnownHosts(knownHostsFilePath string) (absolutePath string, knownHosts []string, err error) {
+	// Format known_hosts path correctly
+	absolutePath, err = fsops.ExpandHomeDirectory(knownHostsFilePath)
+	if err != nil {
+		err = fmt.Errorf("failed to resolve absolute path to '%s': %w", knownHostsFilePath, err)
+		return
+	}
+
+	// Ensure known_hosts file exists, if not create it
+	_, err = os.Stat(absolutePath)
+	if os.IsNotExist(err) {
+		var knownHostsFile *os.File
+		knownHostsFile, err = os.Create(absolutePath)
+		if err != nil {
+			return
+		}
+		_ = knownHostsFile.Close()
+	} else if err != nil {
+		return
+	}
+
+	// Read in file
+	knownHostFile, err := os.ReadFile(absolutePath)
+	if err != nil {
+		err = fmt.Errorf("unable to read known_hosts file: %w", err)
+		return
+	}
+
+	// Store all known_hosts as array
+	knownHosts = strings.Split(string(knownHostFile), "\n")
+	return
+}
+
+// Handling of unknown host keys chosen on the command line (empty asks the user)
+func hostKeyChecking(ctx context.Context) (mode string, err error) {
+	hostKeyOpts, optsPresent := ctx.Value(global.OpsKey).(config.Opts)
+	if optsPresent {
+		mode = hostKeyOpts.StrictHostKeyChecking
+	}
+	switch mode {
+	case "", sshinternal.HostKeyCheckingYes, sshinternal.HostKeyCheckingNo, sshinternal.HostKeyCheckingAcceptNew:
+	default:
+		err = fmt.Errorf("strict host key checking must be one of '%s', '%s', or '%s', got '%s'",
+			sshinternal.HostKeyCheckingYes, sshinternal.HostKeyCheckingNo, sshinternal.HostKeyCheckingAcceptNew, mode)
+		return
+	}
+	return
+}
+
 // Creates two maps relating to host groups
 // First map: key'd on group and contains only groups that the host is a part of (values are empty)
-func filterHostGroups(cfg config.Config, endpointName str.RepoRootDir, universalGroupsCSV string, ignoreUniversalString string) (hostIgnoresUniversal bool, hostUniversalGroups map[str.RepoRootDir]struct{}) {
+// Group order: the GroupTags groups as listed (highest precedence first), without duplicates or the universal directory
+func filterHostGroups(cfg config.Config, endpointName str.RepoRootDir, universalGroupsCSV string, ignoreUniversalString string) (hostIgnoresUniversal bool, hostUniversalGroups map[str.RepoRootDir]struct{}, hostGroupOrder []str.RepoRootDir) {
 	// Convert CSV of host groups to array
 	universalGroupsList := strings.Split(universalGroupsCSV, ",")
 
@@ -227,6 +614,14 @@ func filterHostGroups(cfg config.Config, endpointName str.RepoRootDir, universal
 			continue
 		}
 
+		// Skip groups listed more than once
+		if _, alreadyListed := hostUniversalGroups[universalGroup]; alreadyListed {
+			continue
+		}
+		if universalGroup != cfg.UniversalDirectory {
+			hostGroupOrder = append(hostGroupOrder, universalGroup)
+		}
+
 		// Map of groups that this host is a part of
 		hostUniversalGroups[universalGroup] = struct{}{}
 
@@ -236,3 +631,75 @@ func filterHostGroups(cfg config.Config, endpointName str.RepoRootDir, universal
 
 	return
 }
+
+// Parses the comma separated universal groups of GroupPriority, highest precedence first
+func parseGroupPriority(cfg config.Config, groupPriorityCSV string) (groupPriority []str.RepoRootDir, err error) {
+	for group := range strings.SplitSeq(groupPriorityCSV, ",") {
+		groupName := str.RepoRootDir(strings.TrimSpace(group))
+		if groupName == "" {
+			continue
+		}
+		if groupName == cfg.UniversalDirectory {
+			err = fmt.Errorf("universal directory '%s' always has the lowest precedence and cannot be listed", groupName)
+			return
+		}
+		if _, groupExists := cfg.AllUniversalGroups[groupName]; !groupExists {
+			err = fmt.Errorf("'%s' is not a known universal group", groupName)
+			return
+		}
+		if slices.Contains(groupPriority, groupName) {
+			err = fmt.Errorf("group '%s' is listed more than once", groupName)
+			return
+		}
+		groupPriority = append(groupPriority, groupName)
+	}
+	return
+}
+
+// Resolves space separated "branch:selector,selector" entries into the hosts for each branch
+// Selectors can be host names or universal directory names (every host in the group)
+// A host may only deploy from a single branch
+func parseBranchMappings(cfg config.Config, branchMappingsText string) (branchMappings map[string][]str.RepoRootDir, err error) {
+	branchMappings = make(map[string][]str.RepoRootDir)
+	hostBranch := make(map[str.RepoRootDir]string)
+
+	for mapping := range strings.FieldsSeq(branchMappingsText) {
+		branch, selectorsCSV, validMapping := strings.Cut(mapping, ":")
+		if !validMapping || branch == "" || selectorsCSV == "" {
+			err = fmt.Errorf("mapping '%s' must be in the format 'branch:host,group'", mapping)
+			return
+		}
+
+		for selector := range strings.SplitSeq(selectorsCSV, ",") {
+			selectorName := str.RepoRootDir(strings.TrimSpace(selector))
+
+			var selectedHosts []str.RepoRootDir
+			if _, selectorIsHost := cfg.HostInfo[selectorName]; selectorIsHost {
+				selectedHosts = []str.RepoRootDir{selectorName}
+			} else if groupHosts, selectorIsGroup := cfg.AllUniversalGroups[selectorName]; selectorIsGroup {
+				selectedHosts = groupHosts
+			} else {
+				err = fmt.Errorf("branch '%s': '%s' is not a known host or universal group", branch, selectorName)
+				return
+			}
+
+			for _, selectedHost := range selectedHosts {
+				existingBranch, hostMapped := hostBranch[selectedHost]
+				if hostMapped && existingBranch != branch {
+					err = fmt.Errorf("host '%s' is mapped to both branch '%s' and branch '%s'", selectedHost, existingBranch, branch)
+					return
+				}
+				if hostMapped {
+					continue
+				}
+				hostBranch[selectedHost] = branch
+				branchMappings[branch] = append(branchMappings[branch], selectedHost)
+			}
+		}
+	}
+
+	for branch := range branchMappings {
+		slices.Sort(branchMappings[branch])
+	}
+	return
+}
@@ -1,9 +1,18 @@
 package sshconfig
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
 	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/parsing"
 	"scmp/internal/str"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestFilterHostGroups(t *testing.T) {
@@ -17,6 +26,7 @@ func TestFilterHostGroups(t *testing.T) {
 		ignoreUniversalString        string
 		expectedHostIgnoresUniversal bool
 		expectedHostUniversalGroups  map[str.RepoRootDir]struct{}
+		expectedHostGroupOrder       []str.RepoRootDir
 		expectedAllUniversalGroups   map[str.RepoRootDir][]str.RepoRootDir
 	}{
 		{
@@ -29,6 +39,7 @@ func TestFilterHostGroups(t *testing.T) {
 				"group2":         {},
 				"UniversalConfs": {}, // Default universal group should be added
 			},
+			expectedHostGroupOrder: []str.RepoRootDir{"group1", "group2"},
 			expectedAllUniversalGroups: map[str.RepoRootDir][]str.RepoRootDir{
 				"group1":         {"host1"},
 				"group2":         {"host1"},
@@ -43,6 +54,7 @@ func TestFilterHostGroups(t *testing.T) {
 			expectedHostUniversalGroups: map[str.RepoRootDir]struct{}{
 				"group1": {},
 			},
+			expectedHostGroupOrder: []str.RepoRootDir{"group1"},
 			expectedAllUniversalGroups: map[str.RepoRootDir][]str.RepoRootDir{
 				"group1": {"host2"},
 			},
@@ -59,6 +71,23 @@ func TestFilterHostGroups(t *testing.T) {
 				"UniversalConfs": {"host3"},
 			},
 		},
+		{
+			endpointName:                 "host4",
+			universalGroupsCSV:           "group2,group1,group2",
+			ignoreUniversalString:        "no",
+			expectedHostIgnoresUniversal: false,
+			expectedHostUniversalGroups: map[str.RepoRootDir]struct{}{
+				"group1":         {},
+				"group2":         {},
+				"UniversalConfs": {},
+			},
+			expectedHostGroupOrder: []str.RepoRootDir{"group2", "group1"}, // Listed order kept, repeats dropped
+			expectedAllUniversalGroups: map[str.RepoRootDir][]str.RepoRootDir{
+				"group1":         {"host4"},
+				"group2":         {"host4"},
+				"UniversalConfs": {"host4"},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -67,7 +96,7 @@ func TestFilterHostGroups(t *testing.T) {
 
 		t.Run(string(test.endpointName), func(t *testing.T) {
 			// Run the function
-			hostIgnoresUniversal, hostUniversalGroups := filterHostGroups(config, test.endpointName, test.universalGroupsCSV, test.ignoreUniversalString)
+			hostIgnoresUniversal, hostUniversalGroups, hostGroupOrder := filterHostGroups(config, test.endpointName, test.universalGroupsCSV, test.ignoreUniversalString)
 
 			// Check if the results match expectations
 			if hostIgnoresUniversal != test.expectedHostIgnoresUniversal {
@@ -84,6 +113,10 @@ func TestFilterHostGroups(t *testing.T) {
 				}
 			}
 
+			if !reflect.DeepEqual(hostGroupOrder, test.expectedHostGroupOrder) {
+				t.Errorf("expected group order %v, got %v", test.expectedHostGroupOrder, hostGroupOrder)
+			}
+
 			// Check the global map AllUniversalGroups
 			for group, expectedHosts := range test.expectedAllUniversalGroups {
 				if len(config.AllUniversalGroups[group]) != len(expectedHosts) {
@@ -106,3 +139,170 @@ func TestFilterHostGroups(t *testing.T) {
 		})
 	}
 }
+
+func TestParseGroupPriority(t *testing.T) {
+	cfg := config.Config{
+		UniversalDirectory: "UniversalConfs",
+		AllUniversalGroups: map[str.RepoRootDir][]str.RepoRootDir{
+			"UniversalConfs": {"host1"},
+			"Group_A":        {"host1"},
+			"Group_B":        {"host1"},
+		},
+	}
+
+	groupPriority, err := parseGroupPriority(cfg, "Group_B, Group_A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(groupPriority, []str.RepoRootDir{"Group_B", "Group_A"}) {
+		t.Errorf("unexpected group priority %v", groupPriority)
+	}
+
+	for _, invalid := range []string{"Group_C", "Group_A,Group_A", "Group_A,UniversalConfs"} {
+		_, err = parseGroupPriority(cfg, invalid)
+		if err == nil {
+			t.Errorf("expected error for '%s'", invalid)
+		}
+	}
+}
+
+func TestSetConfigOnlyHost(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.OpsKey, config.Opts{})
+
+	// Repository containing a directory for host1 but none for lab01
+	repoPath := t.TempDir()
+	for _, dir := range []string{".git", "host1/etc"} {
+		err := os.MkdirAll(filepath.Join(repoPath, dir), 0700)
+		if err != nil {
+			t.Fatalf("failed creating repository directory: %v", err)
+		}
+	}
+	t.Chdir(repoPath)
+
+	configDir := t.TempDir()
+	configPath := filepath.Join(configDir, "config")
+	sshConfig := "IgnoreUnknown UniversalDirectory\n" +
+		"UniversalDirectory UniversalConfs\n" +
+		"Host host1\n  Hostname 192.0.2.1\n  Port 22\n  User deployer\n  HostDeadline 10m\n  ConnectAttempts 5\n  ConnectRetryDelay 2s\n" +
+		"Host lab01\n  Hostname 192.0.2.50\n  Port 22\n  User root\n  RequestTTY force\n" +
+		"Host bad01\n  Hostname bad_name.example.com\n  Port 22\n  User root\n" +
+		"Host link01\n  Hostname fe80::1%eth0\n  Port 22\n  User root\n"
+	err := os.WriteFile(configPath, []byte(sshConfig), 0600)
+	if err != nil {
+		t.Fatalf("failed writing SSH config: %v", err)
+	}
+
+	ctx, err = Set(ctx, configPath)
+	if err != nil {
+		t.Fatalf("expected no error, got '%v'", err)
+	}
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	// exec/scp target any config host regardless of repository layout
+	hostInfo, hostPresent := cfg.HostInfo["lab01"]
+	if !hostPresent {
+		t.Fatalf("expected config-only host 'lab01' in host list, got '%v'", cfg.HostInfo)
+	}
+	if hostInfo.Endpoint != "192.0.2.50:22" || hostInfo.EndpointUser != "root" {
+		t.Errorf("unexpected host info for 'lab01': endpoint '%s' user '%s'", hostInfo.Endpoint, hostInfo.EndpointUser)
+	}
+	// A bad address only fails its own host
+	badInfo := cfg.HostInfo["bad01"]
+	if badInfo.EndpointError == nil || badInfo.Endpoint != "" {
+		t.Errorf("expected address error kept for 'bad01', got endpoint '%s' (%v)", badInfo.Endpoint, badInfo.EndpointError)
+	}
+	if cfg.HostInfo["link01"].Endpoint != "[fe80::1%eth0]:22" {
+		t.Errorf("expected zoned IPv6 endpoint for 'link01', got '%s'", cfg.HostInfo["link01"].Endpoint)
+	}
+	if cfg.HostInfo["host1"].HostDeadline != 10*time.Minute || hostInfo.HostDeadline != 0 {
+		t.Errorf("expected host deadline of 10m for 'host1' only, got '%s' and '%s'", cfg.HostInfo["host1"].HostDeadline, hostInfo.HostDeadline)
+	}
+	if cfg.HostInfo["host1"].ConnectAttempts != 5 || cfg.HostInfo["host1"].ConnectRetryDelay != 2*time.Second || hostInfo.ConnectAttempts != 0 {
+		t.Errorf("expected connect retry policy for 'host1' only, got %d/%s and %d", cfg.HostInfo["host1"].ConnectAttempts, cfg.HostInfo["host1"].ConnectRetryDelay, hostInfo.ConnectAttempts)
+	}
+	if !hostInfo.RequestTTY || cfg.HostInfo["host1"].RequestTTY {
+		t.Errorf("expected pseudo-terminal requested for 'lab01' only")
+	}
+	if parsing.CheckForOverride(ctx, "lab01", "lab01", cfg.HostInfo) {
+		t.Errorf("expected config-only host 'lab01' to be selected by remote-hosts override")
+	}
+}
+
+func TestParseBranchMappings(t *testing.T) {
+	// Mock global
+	cfg := config.Config{
+		HostInfo: map[str.RepoRootDir]config.EndpointInfo{
+			"stage01": {},
+			"stage02": {},
+			"prod01":  {},
+			"lab01":   {},
+		},
+		AllUniversalGroups: map[str.RepoRootDir][]str.RepoRootDir{
+			"UniversalConfs_Staging": {"stage02", "stage01"},
+			"UniversalConfs_Prod":    {"prod01"},
+		},
+	}
+
+	tests := []struct {
+		name             string
+		branchMappings   string
+		expectedMappings map[string][]str.RepoRootDir
+		expectedError    string
+	}{
+		{
+			name:             "No mappings",
+			branchMappings:   "",
+			expectedMappings: map[string][]str.RepoRootDir{},
+		},
+		{
+			name:           "Hosts and groups",
+			branchMappings: "staging:UniversalConfs_Staging,lab01 main:UniversalConfs_Prod",
+			expectedMappings: map[string][]str.RepoRootDir{
+				"staging": {"lab01", "stage01", "stage02"},
+				"main":    {"prod01"},
+			},
+		},
+		{
+			name:           "Duplicate host in same branch",
+			branchMappings: "staging:UniversalConfs_Staging,stage01",
+			expectedMappings: map[string][]str.RepoRootDir{
+				"staging": {"stage01", "stage02"},
+			},
+		},
+		{
+			name:           "Host in two branches",
+			branchMappings: "staging:UniversalConfs_Staging main:UniversalConfs_Prod,stage01",
+			expectedError:  "host 'stage01' is mapped to both branch 'staging' and branch 'main'",
+		},
+		{
+			name:           "Unknown selector",
+			branchMappings: "main:web99",
+			expectedError:  "'web99' is not a known host or universal group",
+		},
+		{
+			name:           "Missing selectors",
+			branchMappings: "main",
+			expectedError:  "must be in the format",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			branchMappings, err := parseBranchMappings(cfg, test.branchMappings)
+			if test.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+					t.Fatalf("expected error containing '%s', got '%v'", test.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got '%v'", err)
+			}
+			if !reflect.DeepEqual(branchMappings, test.expectedMappings) {
+				t.Errorf("expected mappings '%v', got '%v'", test.expectedMappings, branchMappings)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package sshconfig
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"scmp/core/deployment/snapshot"
+	"scmp/internal/config"
+	"scmp/internal/fsops"
+	"scmp/internal/global"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+)
+
+// Sets a configuration carried without a config file or repository (like the host config of a deployment bundle)
+// Local state (known hosts, control sockets, snapshots) uses the default locations in the config directory
+func SetEmbedded(ctx context.Context, cfg config.Config) (newCtx context.Context, err error) {
+	newCtx = ctx
+
+	configDirectory := filepath.Dir(sshinternal.DefaultConfigPath)
+
+	cfg.KnownHostsFilePath, cfg.KnownHosts, err = readKnownHosts(filepath.Join(configDirectory, sshinternal.KnownHostsFile))
+	if err != nil {
+		return
+	}
+	cfg.HostKeyChecking, err = hostKeyChecking(ctx)
+	if err != nil {
+		return
+	}
+
+	cfg.ControlDirectory, err = fsops.ExpandHomeDirectory(filepath.Join(configDirectory, sshinternal.DefaultControlDirName))
+	if err != nil {
+		err = fmt.Errorf("failed to resolve control directory: %w", err)
+		return
+	}
+	cfg.SnapshotDirectory, err = fsops.ExpandHomeDirectory(filepath.Join(configDirectory, snapshot.DefaultDirectoryName))
+	if err != nil {
+		err = fmt.Errorf("failed to resolve snapshot directory: %w", err)
+		return
+	}
+	cfg.SnapshotMaxSize = int64(snapshot.DefaultMaxFileSizeMB) * 1024 * 1024
+	cfg.SnapshotRetention = snapshot.DefaultRetention
+
+	if cfg.BackupSuffix == "" {
+		cfg.BackupSuffix = sshinternal.DefaultBackupSuffix
+	}
+	if cfg.BackupDirectory == "" {
+		cfg.BackupDirectory = sshinternal.DefaultBackupDirectory
+	}
+	if cfg.Vault == nil {
+		cfg.Vault = make(map[str.RepoRootDir]config.Credential)
+	}
+
+	// Command line options replace the carried retry policy and snapshot choice of every host
+	opts, optsPresent := ctx.Value(global.OpsKey).(config.Opts)
+	for endpointName, hostInfo := range cfg.HostInfo {
+		if optsPresent && opts.ConnectAttempts > 0 {
+			hostInfo.ConnectAttempts = opts.ConnectAttempts
+		}
+		if optsPresent && opts.ConnectRetryDelay > 0 {
+			hostInfo.ConnectRetryDelay = opts.ConnectRetryDelay
+		}
+		if optsPresent && opts.Snapshot {
+			hostInfo.Snapshot = true
+		}
+		cfg.HostInfo[endpointName] = hostInfo
+	}
+
+	err = validateProxyChains(cfg.HostInfo)
+	if err != nil {
+		err = fmt.Errorf("invalid ProxyJump: %w", err)
+		return
+	}
+
+	newCtx = context.WithValue(ctx, global.ConfKey, cfg)
+	return
+}
@@ -0,0 +1,159 @@
+package sshconfig
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/sshinternal"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+)
+
+// Resolves a DNS name to all of its addresses (matches net.Resolver.LookupIP)
+type ipLookup func(ctx context.Context, network string, host string) (addresses []net.IP, err error)
+
+// Checks configured host endpoints for problems that would otherwise only surface at connection time
+// Hostname resolution can be disabled for offline use
+func CheckEndpoints(ctx context.Context, resolveNames bool) (err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	var lookup ipLookup
+	if resolveNames {
+		lookup = net.DefaultResolver.LookupIP
+	}
+
+	err = checkEndpoints(ctx, cfg.HostInfo, lookup)
+	return
+}
+
+// Reports duplicate endpoint sockets, and unresolvable or dual-stack hostnames when lookup is provided
+func checkEndpoints(ctx context.Context, hostInfo map[str.RepoRootDir]config.EndpointInfo, lookup ipLookup) (err error) {
+	duplicates := findDuplicateEndpoints(hostInfo)
+	var duplicateSockets []string
+	for endpointSocket := range duplicates {
+		duplicateSockets = append(duplicateSockets, endpointSocket)
+	}
+	slices.Sort(duplicateSockets)
+	for _, endpointSocket := range duplicateSockets {
+		logctx.LogStdWarn(ctx, "Endpoint '%s' is used by multiple hosts (%s), verify this is intentional\n", endpointSocket, str.Join(duplicates[endpointSocket], ", "))
+	}
+
+	if lookup == nil {
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Skipping endpoint hostname resolution\n")
+		return
+	}
+
+	var hostNames []str.RepoRootDir
+	for hostName := range hostInfo {
+		hostNames = append(hostNames, hostName)
+	}
+	slices.Sort(hostNames)
+
+	var unresolvedHosts []string
+	for _, hostName := range hostNames {
+		info := hostInfo[hostName]
+
+		// Every configured address is checked, fallback addresses only help if they work too
+		var hostUnresolved bool
+		for _, endpoint := range info.Endpoints() {
+			endpointHost, _, lerr := net.SplitHostPort(endpoint)
+			if lerr != nil {
+				continue
+			}
+			_, lerr = netip.ParseAddr(endpointHost)
+			if lerr == nil {
+				continue
+			}
+
+			// Proxied hosts are resolved by the proxy, not locally
+			if info.Proxy != "" {
+				logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Host '%s': skipping resolution of '%s', host is reached through proxy\n", hostName, endpointHost)
+				continue
+			}
+
+			addresses, lerr := lookup(ctx, "ip", endpointHost)
+			if lerr != nil || len(addresses) == 0 {
+				logctx.LogStdErr(ctx, "Host '%s': hostname '%s' does not resolve: %v\n", hostName, endpointHost, lerr)
+				hostUnresolved = true
+				continue
+			}
+
+			var hasIPv4, hasIPv6 bool
+			for _, address := range addresses {
+				if address.To4() != nil {
+					hasIPv4 = true
+				} else {
+					hasIPv6 = true
+				}
+			}
+			addressFamily := strings.ToLower(info.AddressFamily)
+			if hasIPv4 && hasIPv6 && (addressFamily == "" || addressFamily == "any") {
+				logctx.LogStdWarn(ctx, "Host '%s': hostname '%s' has both IPv4 and IPv6 addresses and AddressFamily is not set\n", hostName, endpointHost)
+			}
+		}
+		if hostUnresolved {
+			unresolvedHosts = append(unresolvedHosts, string(hostName))
+		}
+	}
+
+	if len(unresolvedHosts) > 0 {
+		err = fmt.Errorf("endpoint hostname(s) for host(s) %s do not resolve", strings.Join(unresolvedHosts, ", "))
+		return
+	}
+	return
+}
+
+// Maps endpoint sockets shared by more than one host to the (sorted) hosts using them
+func findDuplicateEndpoints(hostInfo map[str.RepoRootDir]config.EndpointInfo) (duplicates map[string][]str.RepoRootDir) {
+	endpointHosts := make(map[string][]str.RepoRootDir)
+	for hostName, info := range hostInfo {
+		for _, endpoint := range info.Endpoints() {
+			endpointHosts[endpoint] = append(endpointHosts[endpoint], hostName)
+		}
+	}
+
+	duplicates = make(map[string][]str.RepoRootDir)
+	for endpointSocket, hosts := range endpointHosts {
+		if len(hosts) < 2 {
+			continue
+		}
+		slices.Sort(hosts)
+		duplicates[endpointSocket] = hosts
+	}
+	return
+}
+
+// Parses comma separated alternate addresses into address:port sockets (skipping the primary endpoint and duplicates)
+func parseFallbackEndpoints(primaryEndpoint string, fallbackAddrs string, endpointPort string) (fallbackEndpoints []string, err error) {
+	if strings.TrimSpace(fallbackAddrs) == "" {
+		return
+	}
+	if primaryEndpoint == "" {
+		err = fmt.Errorf("requires a Hostname")
+		return
+	}
+
+	for fallbackAddr := range strings.SplitSeq(fallbackAddrs, ",") {
+		fallbackAddr = strings.TrimSpace(fallbackAddr)
+		if fallbackAddr == "" {
+			continue
+		}
+
+		var fallbackEndpoint string
+		fallbackEndpoint, err = sshinternal.ParseEndpointAddress(fallbackAddr, endpointPort)
+		if err != nil {
+			err = fmt.Errorf("failed parsing network address: %w", err)
+			return
+		}
+		if fallbackEndpoint == primaryEndpoint || slices.Contains(fallbackEndpoints, fallbackEndpoint) {
+			continue
+		}
+		fallbackEndpoints = append(fallbackEndpoints, fallbackEndpoint)
+	}
+	return
+}
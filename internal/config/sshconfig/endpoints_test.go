@@ -0,0 +1,121 @@
+package sshconfig
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"scmp/internal/config"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"strings"
+	"testing"
+)
+
+func TestFindDuplicateEndpoints(t *testing.T) {
+	hostInfo := map[str.RepoRootDir]config.EndpointInfo{
+		"web01":     {Endpoint: "192.0.2.10:22"},
+		"web01-alt": {Endpoint: "192.0.2.10:22"},
+		"web02":     {Endpoint: "192.0.2.10:2222"},
+		"db01":      {Endpoint: "db01.example.com:22"},
+		"db01-copy": {Endpoint: "db01.example.com:22"},
+		"lab01":     {Endpoint: "[2001:db8::1]:22"},
+		"noaddr01":  {},
+		"noaddr02":  {},
+		"vpn01":     {Endpoint: "10.0.0.10:22", FallbackEndpoints: []string{"192.0.2.10:2222"}},
+	}
+
+	expected := map[string][]str.RepoRootDir{
+		"192.0.2.10:22":       {"web01", "web01-alt"},
+		"db01.example.com:22": {"db01", "db01-copy"},
+		"192.0.2.10:2222":     {"vpn01", "web02"},
+	}
+
+	duplicates := findDuplicateEndpoints(hostInfo)
+	if !reflect.DeepEqual(duplicates, expected) {
+		t.Errorf("expected duplicates '%v', got '%v'", expected, duplicates)
+	}
+}
+
+func TestCheckEndpoints(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	hostInfo := map[str.RepoRootDir]config.EndpointInfo{
+		"ip01":      {Endpoint: "192.0.2.10:22"},
+		"dual01":    {Endpoint: "dual.example.com:22"},
+		"typo01":    {Endpoint: "tpyo.example.com:22"},
+		"proxied01": {Endpoint: "internal.example.com:22", Proxy: "ip01"},
+		"vpn01":     {Endpoint: "192.0.2.30:22", FallbackEndpoints: []string{"public.example.com:22"}},
+	}
+
+	var lookedUp []string
+	lookup := func(ctx context.Context, network string, host string) (addresses []net.IP, err error) {
+		lookedUp = append(lookedUp, host)
+		if host == "dual.example.com" {
+			addresses = []net.IP{net.ParseIP("192.0.2.20"), net.ParseIP("2001:db8::20")}
+			return
+		}
+		err = fmt.Errorf("no such host")
+		return
+	}
+
+	err := checkEndpoints(ctx, hostInfo, lookup)
+	if err == nil || !strings.Contains(err.Error(), "typo01") {
+		t.Errorf("expected error naming host 'typo01', got '%v'", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "vpn01") {
+		t.Errorf("expected error naming host 'vpn01' for its fallback address, got '%v'", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "proxied01") {
+		t.Errorf("expected proxied host to be skipped, got '%v'", err)
+	}
+	if !reflect.DeepEqual(lookedUp, []string{"dual.example.com", "tpyo.example.com", "public.example.com"}) {
+		t.Errorf("unexpected hostname lookups '%v'", lookedUp)
+	}
+
+	// Offline use skips all lookups
+	lookedUp = nil
+	err = checkEndpoints(ctx, hostInfo, nil)
+	if err != nil {
+		t.Errorf("expected no error without resolution, got '%v'", err)
+	}
+	if len(lookedUp) != 0 {
+		t.Errorf("expected no lookups without resolution, got '%v'", lookedUp)
+	}
+}
+
+func TestParseFallbackEndpoints(t *testing.T) {
+	tests := []struct {
+		name              string
+		primaryEndpoint   string
+		fallbackAddrs     string
+		expectedEndpoints []string
+		expectedError     string
+	}{
+		{"None", "10.0.0.10:22", "", nil, ""},
+		{"Single", "10.0.0.10:22", "192.0.2.10", []string{"192.0.2.10:22"}, ""},
+		{"Multiple in order", "10.0.0.10:22", "Public.Example.com., 2001:db8::1", []string{"public.example.com:22", "[2001:db8::1]:22"}, ""},
+		{"Duplicates removed", "10.0.0.10:22", "10.0.0.10,192.0.2.10,192.0.2.10", []string{"192.0.2.10:22"}, ""},
+		{"Invalid address", "10.0.0.10:22", "192.0.2.300", nil, "not valid"},
+		{"No primary", "", "192.0.2.10", nil, "requires a Hostname"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fallbackEndpoints, err := parseFallbackEndpoints(test.primaryEndpoint, test.fallbackAddrs, "22")
+			if test.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+					t.Fatalf("expected error containing '%s', got '%v'", test.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got '%v'", err)
+			}
+			if !reflect.DeepEqual(fallbackEndpoints, test.expectedEndpoints) {
+				t.Errorf("expected endpoints '%v', got '%v'", test.expectedEndpoints, fallbackEndpoints)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package sshconfig
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"scmp/internal/fsops"
+	"scmp/internal/logctx"
+	"slices"
+	"strings"
+)
+
+// Deepest chain of nested Include directives (same limit as OpenSSH)
+const maxIncludeDepth int = 16
+
+// Config text with every Include directive replaced by the files it names
+type expandedConfig struct {
+	text         strings.Builder
+	headers      int              // Host blocks written so far (in decoding order)
+	matchHeaders map[int]struct{} // Host blocks written for Match blocks, they define options but no hosts
+	warnings     []string
+}
+
+// Block a line belongs to, restored after included files open their own blocks
+type blockHeader struct {
+	line    string
+	isMatch bool
+}
+
+// Reads the config file with Include directives expanded in place, so options keep OpenSSH's first-obtained-value order across files
+// Relative Include paths are resolved against the directory of the top config file (~/.ssh for the default config)
+// Match blocks are converted to Host blocks when they only use host or all criteria, other Match blocks are left out with a warning
+func readConfigWithIncludes(ctx context.Context, configFilePath string) (configText string, matchHeaders map[int]struct{}, err error) {
+	expanded := &expandedConfig{matchHeaders: make(map[int]struct{})}
+	baseDirectory := filepath.Dir(configFilePath)
+
+	err = expanded.appendFile(configFilePath, baseDirectory, nil)
+	if err != nil {
+		return
+	}
+
+	for _, warning := range expanded.warnings {
+		logctx.LogStdWarn(ctx, "%s\n", warning)
+	}
+	configText = expanded.text.String()
+	matchHeaders = expanded.matchHeaders
+	return
+}
+
+// Appends the lines of a config file, expanding its Include directives
+// includeChain holds the files currently being read, a file including one of them is a loop
+func (expanded *expandedConfig) appendFile(filePath string, baseDirectory string, includeChain []string) (err error) {
+	canonicalPath, err := filepath.EvalSymlinks(filePath)
+	if err != nil {
+		canonicalPath = filepath.Clean(filePath)
+	}
+	if slices.Contains(includeChain, canonicalPath) {
+		err = fmt.Errorf("include loop: %s -> %s", strings.Join(includeChain, " -> "), canonicalPath)
+		return
+	}
+	includeChain = append(includeChain, canonicalPath)
+	if len(includeChain) > maxIncludeDepth+1 {
+		err = fmt.Errorf("includes nested deeper than %d files: %s", maxIncludeDepth, strings.Join(includeChain, " -> "))
+		return
+	}
+
+	fileContents, err := os.ReadFile(filePath)
+	if err != nil {
+		if len(includeChain) > 1 {
+			err = fmt.Errorf("reading included config '%s' failed: %w", filePath, err)
+		}
+		return
+	}
+
+	var currentBlock *blockHeader
+	var skippingMatch bool
+	for lineNumber, line := range strings.Split(strings.TrimSuffix(string(fileContents), "\n"), "\n") {
+		keyword, arguments := splitDirective(line)
+
+		switch strings.ToLower(keyword) {
+		case "host":
+			skippingMatch = false
+			currentBlock = &blockHeader{line: line}
+			expanded.writeHeader(*currentBlock)
+			continue
+		case "match":
+			hostPatterns, supported := matchAsHostPatterns(arguments)
+			if !supported {
+				expanded.warnings = append(expanded.warnings, fmt.Sprintf("Config %s line %d: 'Match %s' is not supported, options of this Match block are ignored", filePath, lineNumber+1, arguments))
+				skippingMatch = true
+				continue
+			}
+			skippingMatch = false
+			currentBlock = &blockHeader{line: "Host " + strings.Join(hostPatterns, " "), isMatch: true}
+			expanded.writeHeader(*currentBlock)
+			continue
+		}
+
+		if skippingMatch {
+			continue
+		}
+
+		if strings.ToLower(keyword) != "include" {
+			expanded.text.WriteString(line + "\n")
+			continue
+		}
+
+		// Included files are read in place, blocks they open end with them
+		headersBefore := expanded.headers
+		for _, includePattern := range splitArguments(arguments) {
+			var matches []string
+			matches, err = includeMatches(includePattern, baseDirectory)
+			if err != nil {
+				err = fmt.Errorf("config %s line %d: %w", filePath, lineNumber+1, err)
+				return
+			}
+			for _, includedPath := range matches {
+				err = expanded.appendFile(includedPath, baseDirectory, includeChain)
+				if err != nil {
+					return
+				}
+			}
+		}
+		if expanded.headers != headersBefore {
+			if currentBlock != nil {
+				expanded.writeHeader(*currentBlock)
+			} else {
+				expanded.writeHeader(blockHeader{line: "Host *"})
+			}
+		}
+	}
+	return
+}
+
+func (expanded *expandedConfig) writeHeader(header blockHeader) {
+	expanded.headers++
+	if header.isMatch {
+		expanded.matchHeaders[expanded.headers] = struct{}{}
+	}
+	expanded.text.WriteString(header.line + "\n")
+}
+
+// Files of an Include argument in lexical order (globs matching nothing include nothing, like OpenSSH)
+// Relative patterns are resolved against the directory of the top config file, also inside included files
+func includeMatches(includePattern string, baseDirectory string) (matches []string, err error) {
+	includePattern, err = fsops.ExpandHomeDirectory(includePattern)
+	if err != nil {
+		return
+	}
+	if !filepath.IsAbs(includePattern) {
+		includePattern = filepath.Join(baseDirectory, includePattern)
+	}
+
+	globMatches, err := filepath.Glob(includePattern)
+	if err != nil {
+		err = fmt.Errorf("invalid Include pattern '%s': %w", includePattern, err)
+		return
+	}
+	slices.Sort(globMatches)
+
+	// Directories matched by a glob are not config files
+	for _, match := range globMatches {
+		info, lerr := os.Stat(match)
+		if lerr == nil && info.IsDir() {
+			continue
+		}
+		matches = append(matches, match)
+	}
+	return
+}
+
+// Host patterns of a Match block using only "all" or "host" criteria (false for any other criteria)
+func matchAsHostPatterns(arguments string) (hostPatterns []string, supported bool) {
+	fields := splitArguments(arguments)
+	switch {
+	case len(fields) == 1 && strings.ToLower(fields[0]) == "all":
+		hostPatterns = []string{"*"}
+		supported = true
+	case len(fields) == 2 && strings.ToLower(fields[0]) == "host":
+		for pattern := range strings.SplitSeq(fields[1], ",") {
+			if pattern != "" {
+				hostPatterns = append(hostPatterns, pattern)
+			}
+		}
+		supported = len(hostPatterns) > 0
+	}
+	return
+}
+
+// Keyword and arguments of a config line (keyword is empty for blank and comment lines)
+// Keywords are separated from arguments by whitespace and/or a single '='
+func splitDirective(line string) (keyword string, arguments string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+
+	keywordEnd := strings.IndexAny(line, " \t=")
+	if keywordEnd == -1 {
+		keyword = line
+		return
+	}
+	keyword = line[:keywordEnd]
+	arguments = strings.TrimSpace(line[keywordEnd:])
+	arguments = strings.TrimSpace(strings.TrimPrefix(arguments, "="))
+	return
+}
+
+// Splits whitespace separated arguments, double quotes keep whitespace inside an argument
+func splitArguments(arguments string) (fields []string) {
+	var current strings.Builder
+	var quoted, inField bool
+	for _, char := range arguments {
+		switch {
+		case char == '"':
+			quoted = !quoted
+			inField = true
+		case (char == ' ' || char == '\t') && !quoted:
+			if inField {
+				fields = append(fields, current.String())
+				current.Reset()
+				inField = false
+			}
+		default:
+			current.WriteRune(char)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, current.String())
+	}
+	return
+}
@@ -0,0 +1,155 @@
+package sshconfig
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"strings"
+	"testing"
+)
+
+func writeConfigTree(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		err := os.MkdirAll(filepath.Dir(path), 0700)
+		if err != nil {
+			t.Fatalf("failed creating config directory: %v", err)
+		}
+		err = os.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("failed writing config file: %v", err)
+		}
+	}
+}
+
+func TestSetWithIncludes(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.OpsKey, config.Opts{})
+
+	repoPath := t.TempDir()
+	err := os.MkdirAll(filepath.Join(repoPath, ".git"), 0700)
+	if err != nil {
+		t.Fatalf("failed creating repository directory: %v", err)
+	}
+	t.Chdir(repoPath)
+
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	writeConfigTree(t, homeDir, map[string]string{
+		"shared/proxies": "Host bastion01\n  Hostname 192.0.2.99\n  User jump\n",
+	})
+
+	configDir := t.TempDir()
+	writeConfigTree(t, configDir, map[string]string{
+		"config": "IgnoreUnknown UniversalDirectory\n" +
+			"UniversalDirectory UniversalConfs\n" +
+			"Include config.d/*\n" +
+			"Host *\n  IdentityFile /keys/default\n  Port 22\n" +
+			"Host db01\n  Hostname 192.0.2.20\n  User postgres\n" +
+			"Match host web*,!web02\n  IdentityFile /keys/web\n" +
+			"Match user deployer\n  IdentityFile /keys/deployer\n",
+		"config.d/10-web": "Host web01\n  Hostname 192.0.2.1\n  User deployer\n  IdentityFile /keys/web01\n" +
+			"Host web02\n  Hostname 192.0.2.2\n  User deployer\n" +
+			"Include config.d/nested/*.conf ~/shared/proxies\n",
+		"config.d/nested/30-web03.conf": "Host web03\n  Hostname 192.0.2.3\n  User deployer\n",
+		"config.d/nested/skipped.txt":   "Host ignored01\n  Hostname 192.0.2.200\n",
+	})
+
+	ctx, err = Set(ctx, filepath.Join(configDir, "config"))
+	if err != nil {
+		t.Fatalf("expected no error, got '%v'", err)
+	}
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	for _, hostName := range []str.RepoRootDir{"web01", "web02", "web03", "bastion01", "db01"} {
+		_, present := cfg.HostInfo[hostName]
+		if !present {
+			t.Errorf("expected host '%s' from the included files, got %v", hostName, cfg.HostInfo)
+		}
+	}
+	if _, present := cfg.HostInfo["ignored01"]; present {
+		t.Errorf("expected host from a file not matching the include glob to be left out")
+	}
+	if len(cfg.HostInfo) != 5 {
+		t.Errorf("expected Match blocks not to define hosts, got %d hosts", len(cfg.HostInfo))
+	}
+
+	// First obtained value wins across files: the host block, then Host *, then Match blocks
+	expectedIdentities := map[str.RepoRootDir]string{
+		"web01": "/keys/web01",
+		"web02": "/keys/default",
+		"web03": "/keys/default",
+		"db01":  "/keys/default",
+	}
+	for hostName, expectedIdentity := range expectedIdentities {
+		if cfg.HostInfo[hostName].IdentityFile != expectedIdentity {
+			t.Errorf("host '%s': expected identity '%s', got '%s'", hostName, expectedIdentity, cfg.HostInfo[hostName].IdentityFile)
+		}
+	}
+	if cfg.HostInfo["bastion01"].Endpoint != "192.0.2.99:22" || cfg.HostInfo["web03"].EndpointUser != "deployer" {
+		t.Errorf("unexpected included host info %+v %+v", cfg.HostInfo["bastion01"], cfg.HostInfo["web03"])
+	}
+	if cfg.UniversalDirectory != "UniversalConfs" {
+		t.Errorf("expected global options before the include, got '%s'", cfg.UniversalDirectory)
+	}
+}
+
+func TestReadConfigWithIncludes(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	configDir := t.TempDir()
+	writeConfigTree(t, configDir, map[string]string{
+		"config": "Host web01\n  Include web01.d/options\n  User deployer\n" +
+			"Match host web01\n  Port 2222\n" +
+			"Match exec \"test -f /tmp/x\"\n  Port 2022\n",
+		"web01.d/options": "Hostname 192.0.2.1\nHost other01\n  Hostname 192.0.2.2\n",
+	})
+
+	configText, matchHeaders, err := readConfigWithIncludes(ctx, filepath.Join(configDir, "config"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "Host web01\n" +
+		"Hostname 192.0.2.1\n" +
+		"Host other01\n  Hostname 192.0.2.2\n" +
+		"Host web01\n" + // Options after the include belong to web01 again
+		"  User deployer\n" +
+		"Host web01\n  Port 2222\n"
+	if configText != expected {
+		t.Errorf("unexpected expanded config:\n%s\nexpected:\n%s", configText, expected)
+	}
+	if len(matchHeaders) != 1 {
+		t.Errorf("expected only the supported Match block to be recorded, got %v", matchHeaders)
+	}
+	_, isMatch := matchHeaders[4]
+	if !isMatch {
+		t.Errorf("expected fourth block to come from Match, got %v", matchHeaders)
+	}
+
+	// Loops are refused naming the files
+	writeConfigTree(t, configDir, map[string]string{
+		"loop/a": "Include " + filepath.Join(configDir, "loop", "b") + "\n",
+		"loop/b": "Host web01\n  Include " + filepath.Join(configDir, "loop", "a") + "\n",
+	})
+	_, _, err = readConfigWithIncludes(ctx, filepath.Join(configDir, "loop", "a"))
+	if err == nil || !strings.Contains(err.Error(), "include loop") {
+		t.Errorf("expected include loop error, got '%v'", err)
+	}
+}
+
+func TestSplitArguments(t *testing.T) {
+	fields := splitArguments(`config.d/*  "dir with space/file" ~/x`)
+	if len(fields) != 3 || fields[0] != "config.d/*" || fields[1] != "dir with space/file" || fields[2] != "~/x" {
+		t.Errorf("unexpected fields %q", fields)
+	}
+	keyword, arguments := splitDirective("  Include=config.d/*")
+	if keyword != "Include" || arguments != "config.d/*" {
+		t.Errorf("unexpected directive '%s' '%s'", keyword, arguments)
+	}
+}
@@ -0,0 +1,140 @@
+package sshconfig
+
+import (
+	"fmt"
+	"scmp/internal/config"
+	"scmp/internal/str"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Config options that can replace command line options per host or group
+var overridableOptions = []string{"DisableReloads", "RunAsUser", "ExecutionTimeout", "BandwidthLimit"}
+
+// Validates and stores a single option value into overrides
+func parseOptionOverride(overrides *config.OptionOverrides, option string, value string) (err error) {
+	switch option {
+	case "DisableReloads":
+		var disableReloads bool
+		switch strings.ToLower(value) {
+		case "yes":
+			disableReloads = true
+		case "no":
+		default:
+			err = fmt.Errorf("DisableReloads must be 'yes' or 'no', got '%s'", value)
+			return
+		}
+		overrides.DisableReloads = &disableReloads
+	case "RunAsUser":
+		if value == "" || strings.ContainsAny(value, " \t:") {
+			err = fmt.Errorf("RunAsUser must be a single user name, got '%s'", value)
+			return
+		}
+		overrides.RunAsUser = value
+	case "ExecutionTimeout":
+		overrides.ExecutionTimeout, err = strconv.Atoi(value)
+		if err != nil || overrides.ExecutionTimeout < 1 {
+			err = fmt.Errorf("ExecutionTimeout must be a positive number of seconds, got '%s'", value)
+			return
+		}
+	case "BandwidthLimit":
+		overrides.BandwidthLimit, err = strconv.Atoi(value)
+		if err != nil || overrides.BandwidthLimit < 1 {
+			err = fmt.Errorf("BandwidthLimit must be a positive number of KiB/s, got '%s'", value)
+			return
+		}
+	default:
+		err = fmt.Errorf("unknown option '%s' (expected one of %s)", option, strings.Join(overridableOptions, ", "))
+		return
+	}
+	return
+}
+
+// Parses space separated "group:Option=value,Option=value" entries into the overrides of each universal group
+func parseGroupOptions(cfg config.Config, groupOptionsText string) (groupOverrides map[str.RepoRootDir]config.OptionOverrides, err error) {
+	groupOverrides = make(map[str.RepoRootDir]config.OptionOverrides)
+
+	for entry := range strings.FieldsSeq(groupOptionsText) {
+		group, optionsCSV, validEntry := strings.Cut(entry, ":")
+		groupName := str.RepoRootDir(group)
+		if !validEntry || groupName == "" || optionsCSV == "" {
+			err = fmt.Errorf("entry '%s' must be in the format 'group:Option=value,Option=value'", entry)
+			return
+		}
+		if _, groupExists := cfg.AllUniversalGroups[groupName]; !groupExists {
+			err = fmt.Errorf("'%s' is not a known universal group", groupName)
+			return
+		}
+		if _, duplicate := groupOverrides[groupName]; duplicate {
+			err = fmt.Errorf("group '%s' is listed more than once", groupName)
+			return
+		}
+
+		var overrides config.OptionOverrides
+		for pair := range strings.SplitSeq(optionsCSV, ",") {
+			option, value, hasValue := strings.Cut(pair, "=")
+			if !hasValue {
+				err = fmt.Errorf("group '%s': '%s' must be 'Option=value'", groupName, pair)
+				return
+			}
+			err = parseOptionOverride(&overrides, strings.TrimSpace(option), strings.TrimSpace(value))
+			if err != nil {
+				err = fmt.Errorf("group '%s': %w", groupName, err)
+				return
+			}
+		}
+		groupOverrides[groupName] = overrides
+	}
+	return
+}
+
+// Combines the overrides of every group a host is part of, groups setting one option to different values are refused
+func mergeGroupOverrides(hostGroups map[str.RepoRootDir]struct{}, groupOverrides map[str.RepoRootDir]config.OptionOverrides) (merged config.OptionOverrides, err error) {
+	var groupNames []str.RepoRootDir
+	for groupName := range hostGroups {
+		if _, hasOverrides := groupOverrides[groupName]; hasOverrides {
+			groupNames = append(groupNames, groupName)
+		}
+	}
+	slices.Sort(groupNames)
+
+	setBy := make(map[string]str.RepoRootDir)
+	for _, groupName := range groupNames {
+		overrides := groupOverrides[groupName]
+		for _, option := range overridableOptions {
+			value, isSet := overrideValue(overrides, option)
+			if !isSet {
+				continue
+			}
+			previousGroup, alreadySet := setBy[option]
+			if alreadySet {
+				previousValue, _ := overrideValue(merged, option)
+				if previousValue != value {
+					err = fmt.Errorf("groups '%s' and '%s' set %s to different values", previousGroup, groupName, option)
+					return
+				}
+			}
+			setBy[option] = groupName
+		}
+		merged = merged.Merge(overrides)
+	}
+	return
+}
+
+// Text form of a single option in overrides for comparison
+func overrideValue(overrides config.OptionOverrides, option string) (value string, isSet bool) {
+	switch option {
+	case "DisableReloads":
+		if overrides.DisableReloads != nil {
+			value, isSet = strconv.FormatBool(*overrides.DisableReloads), true
+		}
+	case "RunAsUser":
+		value, isSet = overrides.RunAsUser, overrides.RunAsUser != ""
+	case "ExecutionTimeout":
+		value, isSet = strconv.Itoa(overrides.ExecutionTimeout), overrides.ExecutionTimeout > 0
+	case "BandwidthLimit":
+		value, isSet = strconv.Itoa(overrides.BandwidthLimit), overrides.BandwidthLimit > 0
+	}
+	return
+}
@@ -0,0 +1,113 @@
+package sshconfig
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"strings"
+	"testing"
+)
+
+func TestOptionOverridePrecedence(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	repoPath := t.TempDir()
+	err := os.MkdirAll(filepath.Join(repoPath, ".git"), 0700)
+	if err != nil {
+		t.Fatalf("failed creating repository directory: %v", err)
+	}
+	t.Chdir(repoPath)
+
+	configPath := filepath.Join(t.TempDir(), "config")
+	sshConfig := "IgnoreUnknown UniversalDirectory,GroupTags,GroupOptions,DisableReloads,RunAsUser,ExecutionTimeout\n" +
+		"UniversalDirectory UniversalConfs\n" +
+		"GroupOptions UniversalConfs_Appliance:DisableReloads=yes,RunAsUser=svc-deploy,ExecutionTimeout=300\n" +
+		"Host web01\n  Hostname 192.0.2.1\n" +
+		"Host lb01\n  Hostname 192.0.2.2\n  GroupTags UniversalConfs_Appliance\n" +
+		"Host lb02\n  Hostname 192.0.2.3\n  GroupTags UniversalConfs_Appliance\n  ExecutionTimeout 600\n  DisableReloads no\n"
+	err = os.WriteFile(configPath, []byte(sshConfig), 0600)
+	if err != nil {
+		t.Fatalf("failed writing SSH config: %v", err)
+	}
+
+	flagOpts := config.Opts{DisableReloads: false, RunAsUser: "root", ExecutionTimeout: 60}
+	ctx = context.WithValue(ctx, global.OpsKey, flagOpts)
+	ctx, err = Set(ctx, configPath)
+	if err != nil {
+		t.Fatalf("expected no error, got '%v'", err)
+	}
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	tests := []struct {
+		host                   string
+		expectDisableReloads   bool
+		expectRunAsUser        string
+		expectExecutionTimeout int
+	}{
+		{host: "web01", expectDisableReloads: false, expectRunAsUser: "root", expectExecutionTimeout: 60},       // flag only
+		{host: "lb01", expectDisableReloads: true, expectRunAsUser: "svc-deploy", expectExecutionTimeout: 300},  // group over flag
+		{host: "lb02", expectDisableReloads: false, expectRunAsUser: "svc-deploy", expectExecutionTimeout: 600}, // host over group
+	}
+	for _, test := range tests {
+		hostOpts := cfg.HostInfo[str.RepoRootDir(test.host)].Overrides.Apply(flagOpts)
+		if hostOpts.DisableReloads != test.expectDisableReloads || hostOpts.RunAsUser != test.expectRunAsUser || hostOpts.ExecutionTimeout != test.expectExecutionTimeout {
+			t.Errorf("host '%s': expected reloads disabled %t, user '%s', timeout %d, got %t, '%s', %d", test.host,
+				test.expectDisableReloads, test.expectRunAsUser, test.expectExecutionTimeout,
+				hostOpts.DisableReloads, hostOpts.RunAsUser, hostOpts.ExecutionTimeout)
+		}
+	}
+}
+
+func TestParseGroupOptions(t *testing.T) {
+	cfg := config.Config{
+		AllUniversalGroups: map[str.RepoRootDir][]str.RepoRootDir{
+			"Appliances": {"lb01"},
+			"Databases":  {"db01", "lb01"},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		groupOptions  string
+		expectedError string
+	}{
+		{name: "valid", groupOptions: "Appliances:DisableReloads=yes Databases:ExecutionTimeout=900"},
+		{name: "unknown group", groupOptions: "Routers:DisableReloads=yes", expectedError: "not a known universal group"},
+		{name: "unknown option", groupOptions: "Appliances:Reloads=no", expectedError: "unknown option"},
+		{name: "invalid timeout", groupOptions: "Appliances:ExecutionTimeout=0", expectedError: "positive number"},
+		{name: "bandwidth limit", groupOptions: "Appliances:BandwidthLimit=512"},
+		{name: "invalid bandwidth limit", groupOptions: "Appliances:BandwidthLimit=fast", expectedError: "positive number"},
+		{name: "invalid bool", groupOptions: "Appliances:DisableReloads=true", expectedError: "'yes' or 'no'"},
+		{name: "missing options", groupOptions: "Appliances", expectedError: "must be in the format"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseGroupOptions(cfg, test.groupOptions)
+			if test.expectedError == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.expectedError != "" && (err == nil || !strings.Contains(err.Error(), test.expectedError)) {
+				t.Errorf("expected error containing '%s', got '%v'", test.expectedError, err)
+			}
+		})
+	}
+
+	// Groups of one host disagreeing on an option cannot be resolved
+	groupOverrides, err := parseGroupOptions(cfg, "Appliances:RunAsUser=svc-lb Databases:RunAsUser=svc-db,ExecutionTimeout=900")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = mergeGroupOverrides(map[str.RepoRootDir]struct{}{"Appliances": {}, "Databases": {}}, groupOverrides)
+	if err == nil || !strings.Contains(err.Error(), "RunAsUser") {
+		t.Errorf("expected conflicting RunAsUser error, got '%v'", err)
+	}
+	merged, err := mergeGroupOverrides(map[str.RepoRootDir]struct{}{"Databases": {}}, groupOverrides)
+	if err != nil || merged.RunAsUser != "svc-db" || merged.ExecutionTimeout != 900 {
+		t.Errorf("expected Databases overrides, got %+v (%v)", merged, err)
+	}
+}
@@ -0,0 +1,52 @@
+package sshconfig
+
+import (
+	"fmt"
+	"scmp/internal/config"
+	"scmp/internal/str"
+	"slices"
+)
+
+// Splits a ProxyJump value into the host names of its hops (in connection order), users and ports given with them apply when connecting
+func parseProxyJump(proxyJump string) (proxyChain []str.RepoRootDir) {
+	for _, hop := range config.ParseProxyJump(proxyJump) {
+		proxyChain = append(proxyChain, hop.Name)
+	}
+	return
+}
+
+// Ensures every proxy hop is a configured host and no chain loops back on itself
+func validateProxyChains(hostInfo map[str.RepoRootDir]config.EndpointInfo) (err error) {
+	var hostNames []str.RepoRootDir
+	for hostName := range hostInfo {
+		hostNames = append(hostNames, hostName)
+	}
+	slices.Sort(hostNames)
+
+	for _, hostName := range hostNames {
+		proxyChain := hostInfo[hostName].ProxyChain
+
+		seenHops := make(map[str.RepoRootDir]struct{})
+		for _, hop := range proxyChain {
+			proxyInfo, hopExists := hostInfo[hop]
+			if !hopExists {
+				err = fmt.Errorf("host '%s': proxy hop '%s' is not a configured host", hostName, hop)
+				return
+			}
+			if proxyInfo.Endpoint == "" {
+				err = fmt.Errorf("host '%s': proxy hop '%s' has no address", hostName, hop)
+				return
+			}
+			if hop == hostName {
+				err = fmt.Errorf("host '%s': cannot use itself as a proxy hop", hostName)
+				return
+			}
+			if _, duplicate := seenHops[hop]; duplicate {
+				err = fmt.Errorf("host '%s': proxy hop '%s' appears more than once", hostName, hop)
+				return
+			}
+			seenHops[hop] = struct{}{}
+		}
+	}
+	return
+}
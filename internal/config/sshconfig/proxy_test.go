@@ -0,0 +1,94 @@
+package sshconfig
+
+import (
+	"reflect"
+	"scmp/internal/config"
+	"scmp/internal/str"
+	"strings"
+	"testing"
+)
+
+func TestParseProxyJump(t *testing.T) {
+	tests := []struct {
+		proxyJump     string
+		expectedChain []str.RepoRootDir
+	}{
+		{"", nil},
+		{"none", nil},
+		{"bastion", []str.RepoRootDir{"bastion"}},
+		{"bastion,dmz-jump", []str.RepoRootDir{"bastion", "dmz-jump"}},
+		{" bastion , dmz-jump ,", []str.RepoRootDir{"bastion", "dmz-jump"}},
+		{"jump-user@bastion:2222,dmz-jump:22", []str.RepoRootDir{"bastion", "dmz-jump"}},
+	}
+
+	for _, test := range tests {
+		proxyChain := parseProxyJump(test.proxyJump)
+		if !reflect.DeepEqual(proxyChain, test.expectedChain) {
+			t.Errorf("ProxyJump '%s': expected chain '%v', got '%v'", test.proxyJump, test.expectedChain, proxyChain)
+		}
+	}
+}
+
+func TestProxyChainInfoOverrides(t *testing.T) {
+	cfg := config.Config{HostInfo: map[str.RepoRootDir]config.EndpointInfo{
+		"bastion":  {EndpointName: "bastion", Endpoint: "192.0.2.10:22", FallbackEndpoints: []string{"[2001:db8::10]:22"}, EndpointUser: "admin"},
+		"dmz-jump": {EndpointName: "dmz-jump", Endpoint: "10.0.0.5:22", EndpointUser: "jump"},
+		"target":   {EndpointName: "target", Endpoint: "10.0.1.1:22", EndpointUser: "deploy", Proxy: "jump-user@bastion:2222,dmz-jump", ProxyChain: []str.RepoRootDir{"bastion", "dmz-jump"}},
+	}}
+
+	proxyChain := cfg.ProxyChainInfo("target")
+	if len(proxyChain) != 2 {
+		t.Fatalf("expected 2 hops, got %d", len(proxyChain))
+	}
+
+	// User and port from ProxyJump replace the ones of the hops Host block
+	bastion := proxyChain[0]
+	if bastion.EndpointUser != "jump-user" || bastion.Endpoint != "192.0.2.10:2222" || !reflect.DeepEqual(bastion.FallbackEndpoints, []string{"[2001:db8::10]:2222"}) {
+		t.Errorf("unexpected bastion hop %+v", bastion)
+	}
+	if cfg.HostInfo["bastion"].EndpointUser != "admin" || cfg.HostInfo["bastion"].Endpoint != "192.0.2.10:22" {
+		t.Errorf("expected configured bastion host to be unchanged, got %+v", cfg.HostInfo["bastion"])
+	}
+
+	// Hops without overrides use their own Host block, never the targets user
+	if proxyChain[1].EndpointUser != "jump" || proxyChain[1].Endpoint != "10.0.0.5:22" {
+		t.Errorf("unexpected dmz-jump hop %+v", proxyChain[1])
+	}
+}
+
+func TestValidateProxyChains(t *testing.T) {
+	tests := []struct {
+		name          string
+		proxyChain    []str.RepoRootDir
+		expectedError string
+	}{
+		{"No proxy", nil, ""},
+		{"Two hops", []str.RepoRootDir{"bastion", "dmz-jump"}, ""},
+		{"Unknown hop", []str.RepoRootDir{"bastion", "jump99"}, "proxy hop 'jump99' is not a configured host"},
+		{"Hop without address", []str.RepoRootDir{"noaddress"}, "proxy hop 'noaddress' has no address"},
+		{"Self", []str.RepoRootDir{"bastion", "target"}, "cannot use itself as a proxy hop"},
+		{"Repeated hop", []str.RepoRootDir{"bastion", "dmz-jump", "bastion"}, "proxy hop 'bastion' appears more than once"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hostInfo := map[str.RepoRootDir]config.EndpointInfo{
+				"bastion":   {Endpoint: "192.0.2.1:22"},
+				"dmz-jump":  {Endpoint: "10.0.0.1:22"},
+				"noaddress": {},
+				"target":    {Endpoint: "10.0.1.1:22", ProxyChain: test.proxyChain},
+			}
+
+			err := validateProxyChains(hostInfo)
+			if test.expectedError == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got '%v'", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("expected error containing '%s', got '%v'", test.expectedError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package sshconfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Parses the comma separated key=value pairs of a host Vars option
+func parseHostVars(hostVars string) (vars map[string]string, err error) {
+	for pair := range strings.SplitSeq(hostVars, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !hasValue || !isVarName(key) {
+			err = fmt.Errorf("'%s' must be 'name=value' with a name of letters, digits and '_' (not starting with a digit)", pair)
+			return
+		}
+		if _, duplicate := vars[key]; duplicate {
+			err = fmt.Errorf("variable '%s' is set more than once", key)
+			return
+		}
+
+		if vars == nil {
+			vars = make(map[string]string)
+		}
+		vars[key] = strings.TrimSpace(value)
+	}
+	return
+}
+
+// Names usable as template fields (.Vars.name)
+func isVarName(name string) (valid bool) {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return
+	}
+	for _, char := range name {
+		if (char < 'a' || char > 'z') && (char < 'A' || char > 'Z') && (char < '0' || char > '9') && char != '_' {
+			return
+		}
+	}
+	valid = true
+	return
+}
@@ -0,0 +1,41 @@
+package sshconfig
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHostVars(t *testing.T) {
+	tests := []struct {
+		hostVars      string
+		expectedVars  map[string]string
+		expectedError string
+	}{
+		{"", nil, ""},
+		{"listen_ip=10.0.0.5", map[string]string{"listen_ip": "10.0.0.5"}, ""},
+		{" role = primary , dc=east,", map[string]string{"role": "primary", "dc": "east"}, ""},
+		{"motd=", map[string]string{"motd": ""}, ""},
+		{"role", nil, "must be 'name=value'"},
+		{"1st=a", nil, "must be 'name=value'"},
+		{"listen-ip=a", nil, "must be 'name=value'"},
+		{"dc=east,dc=west", nil, "set more than once"},
+	}
+
+	for _, test := range tests {
+		vars, err := parseHostVars(test.hostVars)
+		if test.expectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("Vars '%s': expected error containing '%s', got '%v'", test.hostVars, test.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Vars '%s': unexpected error '%v'", test.hostVars, err)
+			continue
+		}
+		if !reflect.DeepEqual(vars, test.expectedVars) {
+			t.Errorf("Vars '%s': expected '%v', got '%v'", test.hostVars, test.expectedVars, vars)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package config
 
 import (
 	"scmp/internal/str"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -12,49 +13,164 @@ type Config struct {
 	HostInfo           map[str.RepoRootDir]EndpointInfo      // Hold some basic information about all the hosts
 	KnownHostsFilePath string                                // Path to known server public keys - ~/.ssh/known_hosts
 	AddAllUnknownHosts bool                                  // User option to always add unknown host keys
+	HostKeyChecking    string                                // Handling of unknown host keys without prompting (yes, no, accept-new), empty asks the user
 	KnownHosts         []string                              // Content of known server public keys - ~/.ssh/known_hosts
-	RepositoryPath     string                                // Absolute path to git repository (based on current working dir)
+	RepositoryPath     string                                // Absolute path to git repository working tree (discovered from current working dir)
+	GitDirectory       string                                // Git directory when separate from the working tree (GIT_DIR)
 	UniversalDirectory str.RepoRootDir                       // Universal config directory inside git repo
 	AllUniversalGroups map[str.RepoRootDir][]str.RepoRootDir // Universal group config directory names and their respective hosts
+	GroupPriority      []str.RepoRootDir                     // Universal groups ordered from highest to lowest precedence (empty uses the GroupTags order of each host)
 	VaultFilePath      string                                // Path to password vault file
 	Vault              map[str.RepoRootDir]Credential        // Password vault
+	FanoutThreshold    int                                   // Number of hosts a single universal file can deploy to before confirmation is required (0 disables)
+	BackupStyle        string                                // Default location/naming of remote file backups
+	BackupSuffix       string                                // Suffix appended to remote file backups when using suffix backup style
+	BackupDirectory    string                                // Remote directory of archive backups, one subdirectory per deployment
+	BackupRetention    int                                   // Archived deployments kept per host (0 keeps all)
+	BranchMappings     map[string][]str.RepoRootDir          // Branch names and the (sorted) hosts that deploy from them
+	StreamThreshold    int64                                 // Artifact size in bytes above which content is streamed from disk during transfers
+	ArtifactCacheDir   string                                // Local directory holding downloaded artifacts, named by content hash
+	ArtifactS3Endpoint string                                // Base URL of the S3-compatible storage for s3:// artifacts
+	ArtifactS3Region   string                                // Region used to sign requests to the S3-compatible storage
+	Normalization      Normalization                         // Default content normalization for files without a Normalize header
+	SnapshotDirectory  string                                // Local directory holding per-host deployment snapshots
+	SnapshotMaxSize    int64                                 // Largest remote file in bytes whose content is captured in snapshots
+	SnapshotRetention  int                                   // Snapshots kept per host (0 keeps all)
+	MaxShrinkPercent   int                                   // Default largest allowed content shrink against the remote file before it is held (0 disables)
+	PhaseAbort         string                                // What a failed file stops on its host when files use deployment phases
+	PreDeployHook      string                                // Local executable run before connecting to any host, a failure aborts the deployment
+	PostDeployHook     string                                // Local executable run with the deployment summary after every started deployment
+	ControlDirectory   string                                // Local directory holding control sockets of persistent connections
 }
 
+// File content normalization applied before hashing and deployment
+type Normalization struct {
+	EOL                     string `json:"eol,omitempty"`                     // Line ending of deployed content (lf or crlf)
+	EnsureTrailingNewline   bool   `json:"ensureTrailingNewline,omitempty"`   // Append missing final line ending
+	StripTrailingWhitespace bool   `json:"stripTrailingWhitespace,omitempty"` // Remove spaces and tabs at the end of each line
+}
+
+// Per-host secrets vault entry
 type Credential struct {
-	LoginUserPassword string `json:"loginUserPassword"` // For secrets vault
+	LoginPassword     string `json:"loginPassword,omitempty"`     // SSH password/keyboard-interactive authentication (tried after any key)
+	SudoPassword      string `json:"sudoPassword,omitempty"`      // Privilege escalation password
+	BecomeMethod      string `json:"becomeMethod,omitempty"`      // Privilege escalation method (empty is sudo)
+	LoginUserPassword string `json:"loginUserPassword,omitempty"` // Single password of older vaults, used for both login and sudo
+}
+
+// Single hop of a ProxyJump value
+type ProxyHop struct {
+	Name str.RepoRootDir // Configured host of the hop
+	User string          // Login user replacing the one of the hops Host block (empty keeps it)
+	Port string          // Port replacing the one of the hops Host block (empty keeps it)
 }
 
 // Host-specific information/config
 type EndpointInfo struct {
-	DeploymentState string                       // Avoids deploying anything to host - so user can prevent deployments to otherwise up and health hosts
-	IgnoreUniversal bool                         // Prevents deployments for this host to use anything from the primary Universal configs directory
-	RequiresVault   bool                         // Direct match to the config option "PasswordRequired"
-	UniversalGroups map[str.RepoRootDir]struct{} // Map to store the CSV for config option "GroupTags"
-	EndpointName    str.RepoRootDir              // Name of host as it appears in config and in git repo top-level directory names
-	Proxy           string                       // Name of the proxy host to use (if any)
-	Endpoint        string                       // Address:port of the host
-	EndpointUser    string                       // Login user name of the host
-	IdentityFile    string                       // Key identity file path (private or public)
-	PrivateKey      ssh.Signer                   // Actual private key contents
-	KeyAlgo         string                       // Algorithm of the private key
-	Password        string                       // Password for the EndpointUser
-	ConnectTimeout  int                          // Timeout in seconds for connection to this host
+	DeploymentState   string                       // Avoids deploying anything to host - so user can prevent deployments to otherwise up and health hosts
+	IgnoreUniversal   bool                         // Prevents deployments for this host to use anything from the primary Universal configs directory
+	RequiresVault     bool                         // Direct match to the config option "PasswordRequired"
+	PasswordCommand   string                       // Direct match to the config option "PasswordCommand", local command printing the host password (before the vault)
+	PasswordEnv       string                       // Direct match to the config option "PasswordEnv", environment variable holding the host password (before the vault)
+	UniversalGroups   map[str.RepoRootDir]struct{} // Map to store the CSV for config option "GroupTags"
+	GroupOrder        []str.RepoRootDir            // Groups of config option "GroupTags" in the order they are listed (without the universal directory)
+	EndpointName      str.RepoRootDir              // Name of host as it appears in config and in git repo top-level directory names
+	Proxy             string                       // ProxyJump value as written in the config (if any)
+	ProxyChain        []str.RepoRootDir            // Names of the proxy hosts to connect through, in connection order
+	Endpoint          string                       // Address:port of the host
+	FallbackEndpoints []string                     // Alternate address:port of the host, tried in order when earlier addresses are unreachable
+	EndpointError     error                        // Reason the configured addresses are unusable (reported when connecting to the host)
+	AddressFamily     string                       // Direct match to the config option "AddressFamily" (any, inet, inet6)
+	EndpointUser      string                       // Login user name of the host
+	IdentityFile      string                       // Key identity file path (private or public)
+	PrivateKey        ssh.Signer                   // Actual private key contents
+	KeyAlgo           string                       // Algorithm of the private key
+	Password          string                       // SSH login password for the EndpointUser (tried after any key)
+	SudoPassword      string                       // Privilege escalation password for the EndpointUser
+	ConnectTimeout    int                          // Timeout in seconds for connection to this host (applies to every attempt)
+	ConnectAttempts   int                          // Connection attempts on dial-level failures (zero uses the default)
+	ConnectRetryDelay time.Duration                // Delay before the first connection retry (zero uses the default)
+	HostDeadline      time.Duration                // Maximum total deployment time for this host (zero is unlimited)
+	Snapshot          bool                         // Capture the remote state of planned files before and after deployments
+	RequireConfirm    bool                         // Direct match to the config option "RequireConfirmation", deployments need the host confirmed by name
+	RequestTTY        bool                         // Direct match to the config option "RequestTTY", remote commands run on a pseudo-terminal
+	Vars              map[string]string            // Direct match to the config option "Vars" (comma separated name=value), available to file templates
+	Overrides         OptionOverrides              // Deployment options set for this host or its groups (replace command line options)
+	Facts             HostFacts                    // Remote system facts (only gathered during deployment with --gather-facts)
+}
+
+// Remote system details gathered before deploying to a host
+type HostFacts struct {
+	Kernel        string // uname -s
+	KernelRelease string // uname -r
+	Arch          string // uname -m
+	OSID          string // ID from os-release (lowercase kernel name when missing)
+	OSVersion     string // VERSION_ID from os-release (kernel release when missing)
+	Xattrs        bool   // setfattr and getfattr are available (only probed when a file sets Xattrs)
 }
 
 // User supplied options
 type Opts struct {
-	MaxSSHConcurrency        int    // Maximum threads for ssh sessions
-	MaxDeployConcurrency     int    // Maximum threads for file deployments per host
-	DryRunEnabled            bool   // Tests deployment setup without connecting to remotes
-	WetRunEnabled            bool   // Tests deployment on remotes without mutating anything
-	RunAsUser                string // User to run commands as (not login user)
-	DisableSudo              bool   // Disable using sudo for remote commands
-	AllowDeletions           bool   // Allow deletions in local repo to delete files on remote hosts or vault entries
-	DisableReloads           bool   // Disables all deployment reload commands for this deployment
-	RunInstallCommands       bool   // Run the install command section of all relevant files metadata header section (within the given deployment)
-	IgnoreDeploymentState    bool   // Ignore any deployment state for a host in the config
-	RegexEnabled             bool   // Globally enable the use of regex for matching hosts/files
-	ForceEnabled             bool   // Atomic mode
-	DetailedSummaryRequested bool   // Generate a summary report of the deployment
-	ExecutionTimeout         int    // Timeout in seconds for user-defined commands (Reloads,checks,exec,ect.)
+	MaxSSHConcurrency        int           // Maximum threads for ssh sessions
+	MaxDeployConcurrency     int           // Maximum threads for file deployments per host
+	DryRunEnabled            bool          // Tests deployment setup without connecting to remotes
+	WetRunEnabled            bool          // Tests deployment on remotes without mutating anything
+	RunAsUser                string        // User to run commands as (not login user)
+	DisableSudo              bool          // Disable using sudo for remote commands
+	AllowDeletions           bool          // Allow deletions in local repo to delete files on remote hosts or vault entries
+	AllowUserDeletions       bool          // Allow users and groups marked Absent to be removed from remote hosts (with AllowDeletions)
+	DisableReloads           bool          // Disables all deployment reload commands for this deployment
+	RunInstallCommands       bool          // Run the install command section of all relevant files metadata header section (within the given deployment)
+	ForceInstall             bool          // Run install commands even when an InstallOnce marker records them as run
+	IgnoreDeploymentState    bool          // Ignore any deployment state for a host in the config
+	RegexEnabled             bool          // Globally enable the use of regex for matching hosts/files
+	ForceEnabled             bool          // Atomic mode
+	DetailedSummaryRequested bool          // Generate a summary report of the deployment
+	LogFile                  string        // File receiving structured log entries as they are logged
+	LogFormat                string        // Format of log file entries (text or json)
+	LogJournald              bool          // Send structured log entries to the systemd journal
+	SummaryFormat            string        // Deployment summary output format (text or json)
+	SummaryFile              string        // Write JSON deployment summary to this file instead of stdout
+	EventStream              string        // Write JSON Lines deployment events to this file (- for stdout)
+	UseCache                 bool          // Skip files whose last deployed state in the state cache matches the local file
+	RefreshCache             bool          // Verify every file on the remote and rewrite the state cache
+	ExecutionTimeout         int           // Timeout in seconds for user-defined commands (Reloads,checks,exec,ect.)
+	TransferTimeout          time.Duration // Fixed timeout for each file upload (zero scales with file size)
+	BandwidthLimit           int           // KiB/s of uploads per host, shared by concurrent uploads (zero is unlimited)
+	AcknowledgeFanout        bool          // Skip confirmation when universal files deploy to more hosts than the fanout threshold
+	AcknowledgeShrink        bool          // Deploy files that shrink by more than their MaxShrinkPercent without confirmation
+	ReplaceFiles             string        // Files intentionally replaced in this deployment (file override syntax), never held for shrinking
+	AllBranches              bool          // Deploy each mapped branch to its hosts (and HEAD to unmapped hosts) in one run
+	ChangedSince             time.Duration // Deploy all mode only selects files changed by commits within this duration before now (zero selects all files)
+	FailOnSkipped            string        // Comma separated skip reasons that fail the deployment plan when any file is skipped for them
+	SkippedListLimit         int           // Maximum skipped files listed per skip reason (0 lists all)
+	ShowContentDiff          bool          // Print remote vs local content differences of planned files instead of deploying
+	Audit                    bool          // Report remote drift from the planned files (and extraneous entries of managed directories) instead of deploying
+	LargeFilesFirst          bool          // Deploy larger files before smaller ones when dependencies allow either order
+	SeedParentDepth          int           // Maximum parent directories above seeded items to save non-default metadata for
+	SeedBrowse               bool          // Browse remote directories to select files to seed, in addition to any given remote files
+	CaptureXattrs            bool          // Seed records user and trusted extended attributes of files into headers
+	DeploymentDeadline       time.Duration // Maximum total time for a deployment run (zero is unlimited)
+	CanaryHosts              int           // Hosts deployed alone first, a failure halts every other host (zero disables)
+	BatchSize                int           // Hosts deployed per rollout batch after any canary hosts (zero deploys all remaining hosts at once)
+	BatchPause               int           // Seconds to wait between rollout batches
+	BatchCheck               string        // Local executable run between rollout batches, a failure halts the remaining batches
+	LockWait                 int           // Seconds to wait for another deployment to release a host lock (zero fails immediately)
+	LockStaleAge             int           // Seconds after which a host lock is considered abandoned and broken (zero never breaks)
+	SkipPreflight            bool          // Deploy without checking remote disk space and sudo access first
+	StatusLines              bool          // Show one live status line per host during deployment
+	Progress                 bool          // Show a live deployment wide progress line and print hosts as they finish
+	GatherFacts              bool          // Gather remote system facts before deploying for file conditions and fact macros
+	ConnectAttempts          int           // Overrides connection attempts of every host (zero keeps configured values)
+	ConnectRetryDelay        time.Duration // Overrides initial connection retry delay of every host (zero keeps configured values)
+	StrictHostKeyChecking    string        // Handling of unknown host keys instead of prompting (yes, no, accept-new)
+	Snapshot                 bool          // Capture the remote state of planned files before and after deploying to every host
+	OutputDirectory          string        // Write per-host output files and combined results of exec to this directory
+	FailFast                 bool          // Stop starting exec on further hosts after the first host fails
+	RequestPTY               bool          // Run exec commands on a pseudo-terminal on every host
+	ConfirmHosts             []string      // Hosts marked RequireConfirmation that are confirmed for this deployment
+	RunHooksOnDryRun         bool          // Run the pre- and post-deployment hooks during dry-runs
+	TopReport                int           // Slowest files and hosts printed after deployment (zero prints none)
+	ValuesFile               string        // Local YAML or JSON file with values for {@VAR:name} macros
+	Values                   Values        // Values loaded from ValuesFile
 }
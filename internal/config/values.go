@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Characters allowed in value names (referenced as {@VAR:name})
+var valueNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Deployment values loaded from a local values file (--values)
+type Values struct {
+	Global    map[string]string                     // Values for every host
+	Hosts     map[str.RepoRootDir]map[string]string // Per-host values, taking precedence over global values
+	Sensitive []string                              // Names of values masked in logs
+}
+
+// Layout of the values file, top level names other than "hosts" and "sensitive" are global values
+type valuesFile struct {
+	Hosts     map[string]map[string]any `yaml:"hosts"`
+	Sensitive []string                  `yaml:"sensitive"`
+	Global    map[string]any            `yaml:",inline"`
+}
+
+// Reads a YAML or JSON values file, an empty path loads no values
+func LoadValues(valuesPath string) (values Values, err error) {
+	values = Values{
+		Global: make(map[string]string),
+		Hosts:  make(map[str.RepoRootDir]map[string]string),
+	}
+	if valuesPath == "" {
+		return
+	}
+
+	content, err := os.ReadFile(valuesPath)
+	if err != nil {
+		err = fmt.Errorf("failed reading values file: %w", err)
+		return
+	}
+
+	var file valuesFile
+	err = yaml.UnmarshalStrict(content, &file)
+	if err != nil {
+		err = fmt.Errorf("failed parsing values file '%s': %w", valuesPath, err)
+		return
+	}
+
+	values.Global, err = scalarValues(file.Global)
+	if err != nil {
+		err = fmt.Errorf("values file '%s': %w", valuesPath, err)
+		return
+	}
+	for host, hostValues := range file.Hosts {
+		values.Hosts[str.RepoRootDir(host)], err = scalarValues(hostValues)
+		if err != nil {
+			err = fmt.Errorf("values file '%s': host '%s': %w", valuesPath, host, err)
+			return
+		}
+	}
+
+	// Masking a name that is never defined is most likely a typo leaving the secret visible
+	for _, name := range file.Sensitive {
+		_, defined := values.Global[name]
+		for _, hostValues := range values.Hosts {
+			_, definedForHost := hostValues[name]
+			defined = defined || definedForHost
+		}
+		if !defined {
+			err = fmt.Errorf("values file '%s': sensitive value '%s' is not defined", valuesPath, name)
+			return
+		}
+	}
+	values.Sensitive = file.Sensitive
+	return
+}
+
+// Values as text, nested maps and lists are rejected
+func scalarValues(raw map[string]any) (values map[string]string, err error) {
+	values = make(map[string]string, len(raw))
+	for name, value := range raw {
+		if !valueNamePattern.MatchString(name) {
+			err = fmt.Errorf("value name '%s' may only contain letters, digits, '_', '.', and '-'", name)
+			return
+		}
+		switch value.(type) {
+		case map[any]any, []any:
+			err = fmt.Errorf("value '%s' must be a single value, not a list or map", name)
+			return
+		case nil:
+			values[name] = ""
+		default:
+			values[name] = fmt.Sprint(value)
+		}
+	}
+	return
+}
+
+// Values of a host, per-host values replace global values of the same name
+func (values Values) ForHost(host str.RepoRootDir) (hostValues map[string]string) {
+	hostValues = make(map[string]string, len(values.Global))
+	maps.Copy(hostValues, values.Global)
+	maps.Copy(hostValues, values.Hosts[host])
+	return
+}
+
+// Every distinct non-empty value (global and per-host) of the sensitive names
+func (values Values) SensitiveValues() (secrets []string) {
+	for _, name := range values.Sensitive {
+		candidates := []string{values.Global[name]}
+		for _, hostValues := range values.Hosts {
+			candidates = append(candidates, hostValues[name])
+		}
+		for _, candidate := range candidates {
+			if strings.TrimSpace(candidate) != "" && !slices.Contains(secrets, candidate) {
+				secrets = append(secrets, candidate)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadValues(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		expectedWeb01 map[string]string
+		expectedError string
+	}{
+		{
+			name:          "flat yaml",
+			content:       "ntp_server: 192.0.2.1\nvlan: 10\n",
+			expectedWeb01: map[string]string{"ntp_server": "192.0.2.1", "vlan": "10"},
+		},
+		{
+			name:          "per-host yaml",
+			content:       "vlan: 10\nhosts:\n  web01:\n    vlan: 20\n    community: secret\nsensitive: [community]\n",
+			expectedWeb01: map[string]string{"vlan": "20", "community": "secret"},
+		},
+		{
+			name:          "json",
+			content:       `{"vlan": 10, "hosts": {"web01": {"vlan": "30"}}}`,
+			expectedWeb01: map[string]string{"vlan": "30"},
+		},
+		{
+			name:          "nested global",
+			content:       "ntp:\n  server: 192.0.2.1\n",
+			expectedError: "must be a single value",
+		},
+		{
+			name:          "invalid name",
+			content:       "ntp server: 192.0.2.1\n",
+			expectedError: "may only contain",
+		},
+		{
+			name:          "undefined sensitive",
+			content:       "vlan: 10\nsensitive: [vlna]\n",
+			expectedError: "sensitive value 'vlna' is not defined",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			valuesPath := filepath.Join(t.TempDir(), "values.yaml")
+			err := os.WriteFile(valuesPath, []byte(test.content), 0600)
+			if err != nil {
+				t.Fatalf("failed writing values file: %v", err)
+			}
+
+			values, err := LoadValues(valuesPath)
+			if test.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+					t.Errorf("expected error containing '%s', got '%v'", test.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			hostValues := values.ForHost("web01")
+			if len(hostValues) != len(test.expectedWeb01) {
+				t.Errorf("expected values %v, got %v", test.expectedWeb01, hostValues)
+			}
+			for name, value := range test.expectedWeb01 {
+				if hostValues[name] != value {
+					t.Errorf("expected value '%s' to be '%s', got '%s'", name, value, hostValues[name])
+				}
+			}
+		})
+	}
+}
+
+func TestSensitiveValues(t *testing.T) {
+	values := Values{
+		Global:    map[string]string{"community": "public", "vlan": "10"},
+		Hosts:     map[str.RepoRootDir]map[string]string{"web01": {"community": "private"}, "web02": {"community": "public"}},
+		Sensitive: []string{"community"},
+	}
+
+	secrets := values.SensitiveValues()
+	slices.Sort(secrets)
+	if !slices.Equal(secrets, []string{"private", "public"}) {
+		t.Errorf("expected each sensitive value once, got %v", secrets)
+	}
+}
@@ -4,14 +4,32 @@ package crypto
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 
 	"golang.org/x/crypto/chacha20poly1305"
 )
 
+// Sentinel Errors
+var (
+	ErrCipherTextTooShort = errors.New("cipher text is shorter than the salt, nonce, and authentication tag")
+	ErrAuthentication     = errors.New("cipher text failed authentication (wrong password or altered cipher text)")
+)
+
 // Encrypt a string using a password with chacha20poly1305 and return a byte array of cipher text with required salt and nonce
 func Encrypt(plainTextBytes []byte, decryptPassword []byte) (cipherTextSaltNonce []byte, err error) {
+	cipherTextSaltNonce, err = EncryptWithKDF(plainTextBytes, decryptPassword, DefaultKDFParams)
+	return
+}
+
+// Encrypt like Encrypt, deriving the key with the given argon2 parameters (they are not recorded in the cipher text)
+func EncryptWithKDF(plainTextBytes []byte, decryptPassword []byte, params KDFParams) (cipherTextSaltNonce []byte, err error) {
+	err = params.Validate()
+	if err != nil {
+		return
+	}
+
 	// Generate a salt
 	salt := make([]byte, 16) // 16 bytes salt
 	if _, err = io.ReadFull(rand.Reader, salt); err != nil {
@@ -19,7 +37,7 @@ func Encrypt(plainTextBytes []byte, decryptPassword []byte) (cipherTextSaltNonce
 	}
 
 	// Derive the encryption key using Argon2
-	key := deriveKey(decryptPassword, salt)
+	key := deriveKDFKey(decryptPassword, salt, params)
 
 	// Create a new ChaCha20-Poly1305 instance
 	aead, err := chacha20poly1305.New(key)
@@ -48,6 +66,17 @@ func Encrypt(plainTextBytes []byte, decryptPassword []byte) (cipherTextSaltNonce
 
 // Decrypt a byte array using a password with chacha20poly1305 and return a string of plain text
 func Decrypt(cipherTextSaltNonce []byte, encryptPassword []byte) (plainText string, err error) {
+	plainText, err = DecryptWithKDF(cipherTextSaltNonce, encryptPassword, DefaultKDFParams)
+	return
+}
+
+// Decrypt cipher text written by EncryptWithKDF with the same argon2 parameters
+func DecryptWithKDF(cipherTextSaltNonce []byte, encryptPassword []byte, params KDFParams) (plainText string, err error) {
+	err = params.Validate()
+	if err != nil {
+		return
+	}
+
 	// Decode base64 to raw byte array
 	cipherTextSaltNonce, err = base64.StdEncoding.DecodeString(string(cipherTextSaltNonce))
 	if err != nil {
@@ -55,13 +84,19 @@ func Decrypt(cipherTextSaltNonce []byte, encryptPassword []byte) (plainText stri
 		return
 	}
 
+	// Guard against partial cipher text before slicing
+	if len(cipherTextSaltNonce) < 28+chacha20poly1305.Overhead {
+		err = ErrCipherTextTooShort
+		return
+	}
+
 	// Extract the salt (16 bytes) and nonce (12 bytes) from the ciphertext
 	salt := cipherTextSaltNonce[:16]
 	nonce := cipherTextSaltNonce[16:28]
 	cipherTextBytes := cipherTextSaltNonce[28:]
 
 	// Derive the decryption key using Argon2
-	key := deriveKey(encryptPassword, salt)
+	key := deriveKDFKey(encryptPassword, salt, params)
 
 	// Create a new ChaCha20-Poly1305 instance
 	aead, err := chacha20poly1305.New(key)
@@ -72,6 +107,7 @@ func Decrypt(cipherTextSaltNonce []byte, encryptPassword []byte) (plainText stri
 	// Decrypt the ciphertext
 	plainTextBytes, err := aead.Open(nil, nonce, cipherTextBytes, nil)
 	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrAuthentication, err)
 		return
 	}
 
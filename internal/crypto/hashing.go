@@ -1,9 +1,11 @@
 package crypto
 
 import (
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 )
@@ -26,12 +28,13 @@ func SHA256Sum(input []byte) (hash string) {
 	return
 }
 
+// 64KB Buffer for stream hashing and chunked file reads
+const HashingBufferSize int = 64 * 1024
+
 // SHA256 Stream Hashing
 // Takes filepath, reads in globally defined amount in buffer, hashes
 // Returns hexadecimal hash string
 func SHA256SumStream(filePath string) (hash string, err error) {
-	const hashingBufferSize int = 64 * 1024 // 64KB Buffer for stream hashing
-
 	// Open the file
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -44,20 +47,28 @@ func SHA256SumStream(filePath string) (hash string, err error) {
 		}
 	}()
 
+	hash, err = SHA256SumReader(file)
+	return
+}
+
+// SHA256 Reader Hashing
+// Hashes everything remaining in reader (limit the reader to hash only part of a file)
+// Returns hexadecimal hash string
+func SHA256SumReader(reader io.Reader) (hash string, err error) {
 	// Create a new SHA-256 hash object
 	hashObject := sha256.New()
 
-	// Read the file in chunks and update the hash
-	buffer := make([]byte, hashingBufferSize)
+	// Read the input in chunks and update the hash
+	buffer := make([]byte, HashingBufferSize)
 	for {
 		var bytesRead int
-		bytesRead, err = file.Read(buffer)
+		bytesRead, err = reader.Read(buffer)
 		if err != nil && err != io.EOF {
 			return
 		}
 		if bytesRead == 0 {
 			err = nil // Ensure previous EOF error doesn't get returned
-			break     // End of file
+			break     // End of input
 		}
 
 		// Update the hash with the read data
@@ -78,3 +89,9 @@ func SHA256SumStream(filePath string) (hash string, err error) {
 
 	return
 }
+
+// Keyed SHA256 hash (HMAC) of content, the key is derived from the password the same way as for encryption
+func NewPasswordMAC(password []byte, salt []byte) (mac hash.Hash) {
+	mac = hmac.New(sha256.New, deriveKey(password, salt))
+	return
+}
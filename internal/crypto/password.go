@@ -10,16 +10,44 @@ import (
 	"golang.org/x/crypto/argon2"
 )
 
+// Argon2id cost of deriving an encryption key from a password
+type KDFParams struct {
+	Time    uint32 // Passes over memory
+	Memory  uint32 // KiB
+	Threads uint8
+}
+
+// Key derivation parameters used when none are recorded with the cipher text
+var DefaultKDFParams = KDFParams{Time: 1, Memory: 64 * 1024, Threads: 4}
+
+// Checks the parameters are accepted by argon2
+func (params KDFParams) Validate() (err error) {
+	if params.Time < 1 {
+		err = fmt.Errorf("argon2 time must be at least 1")
+		return
+	}
+	if params.Threads < 1 {
+		err = fmt.Errorf("argon2 threads must be at least 1")
+		return
+	}
+	if params.Memory < 8*uint32(params.Threads) {
+		err = fmt.Errorf("argon2 memory must be at least 8 KiB per thread")
+		return
+	}
+	return
+}
+
 // Derive a secure key from a password string using argon2
 func deriveKey(password []byte, salt []byte) (derivedKey []byte) {
-	// Argon2 parameters
-	const time = 1
-	const memory = 64 * 1024
-	const threads = 4
+	derivedKey = deriveKDFKey(password, salt, DefaultKDFParams)
+	return
+}
+
+func deriveKDFKey(password []byte, salt []byte, params KDFParams) (derivedKey []byte) {
 	const keyLength = 32
 
 	// Derive the key from the password
-	derivedKey = argon2.IDKey(password, salt, time, memory, threads, keyLength)
+	derivedKey = argon2.IDKey(password, salt, params.Time, params.Memory, params.Threads, keyLength)
 	return
 }
 
@@ -186,7 +186,12 @@ func retrieveArtifactFileNames(wg *sync.WaitGroup, semaphore chan struct{}, arti
 		return
 	}
 
-	// Only allow file URIs for now
+	// Remote artifacts are tracked by the hash the user writes into the pointer file
+	if content.IsRemoteArtifact(jsonMetadata.ExternalContentLocation) {
+		return
+	}
+
+	// Only local artifact files can be hashed
 	if !strings.HasPrefix(jsonMetadata.ExternalContentLocation, global.FileURIPrefix) {
 		tracker.logError(fmt.Errorf("'%s': must use '%s' before file paths in 'ExternalContentLocationput' field", artifactPointerFileName, global.FileURIPrefix))
 		return
@@ -281,8 +286,7 @@ func writeUpdatedArtifactHash(ctx context.Context, wg *sync.WaitGroup, semaphore
 	tracker.artifactHashMutex.Unlock()
 
 	// Write new artifact hash into pointer file
-	newArtifactHashBytes := []byte(newArtifactHash)
-	err := content.WriteRepoFile(ctx, artifactPointerFileName, metadata, &newArtifactHashBytes)
+	err := content.WriteArtifactPointer(ctx, artifactPointerFileName, metadata, newArtifactHash)
 	if err != nil {
 		tracker.logError(err)
 		return
@@ -0,0 +1,7 @@
+package gitinternal
+
+const (
+	dotGit         string = ".git"
+	gitDirEnv      string = "GIT_DIR"
+	gitWorkTreeEnv string = "GIT_WORK_TREE"
+)
@@ -0,0 +1,261 @@
+package gitinternal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"scmp/core/filesystem"
+	"scmp/core/filesystem/content"
+	"scmp/core/filesystem/metadata"
+	"scmp/internal/config"
+	"scmp/internal/crypto"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/parsing"
+	"scmp/internal/str"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+)
+
+// Moves repository file content into the artifact directory and replaces the file with a pointer, staging both changes
+func ToArtifact(ctx context.Context, filePath string, artifactDir string) (err error) {
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSArtifacts)
+
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	repoPath, err := RetrieveRepoPath(ctx)
+	if err != nil {
+		return
+	}
+	repoFilePath, err := repoRelativePath(repoPath, filePath)
+	if err != nil {
+		return
+	}
+
+	if strings.HasSuffix(repoFilePath, string(filesystem.ArtifactPointerFileExt)) {
+		err = fmt.Errorf("file '%s' is already an artifact pointer", repoFilePath)
+		return
+	}
+	pointerFilePath := repoFilePath + string(filesystem.ArtifactPointerFileExt)
+	err = refuseExisting(filepath.Join(repoPath, pointerFilePath), "artifact pointer")
+	if err != nil {
+		return
+	}
+
+	fileBytes, err := os.ReadFile(filepath.Join(repoPath, repoFilePath))
+	if err != nil {
+		err = fmt.Errorf("failed reading file: %w", err)
+		return
+	}
+	metaHeader, fileContent, err := metadata.Extract(string(fileBytes))
+	if err != nil {
+		err = fmt.Errorf("failed metadata extraction for file '%s': %w", repoFilePath, err)
+		return
+	}
+	if metaHeader.ExternalContentLocation != "" {
+		err = fmt.Errorf("file '%s' already has an 'ExternalContentLocation' in its header", repoFilePath)
+		return
+	}
+	if metaHeader.SymbolicLinkTarget != "" {
+		err = fmt.Errorf("file '%s' is a symbolic link and has no content to move", repoFilePath)
+		return
+	}
+	if metaHeader.Encrypted {
+		err = fmt.Errorf("file '%s' is encrypted, artifacts are stored unencrypted (decrypt it first if that is intended)", repoFilePath)
+		return
+	}
+	if !content.ShouldBeArtifact(fileContent) {
+		logctx.LogStdWarn(ctx, "File '%s' is plain text below the artifact size threshold, converting anyway\n", repoFilePath)
+	}
+
+	// Artifacts are deployed as stored, so header line ending choices are applied now
+	if metaHeader.Normalize != nil {
+		fileContent = metadata.NormalizeContent(fileContent, *metaHeader.Normalize)
+	}
+
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	artifactFilePath, err := absoluteFrom(currentDir, artifactDir)
+	if err != nil {
+		err = fmt.Errorf("failed to resolve artifact directory: %w", err)
+		return
+	}
+	artifactFilePath = filepath.Join(artifactFilePath, filepath.Base(repoFilePath))
+	err = refuseExisting(artifactFilePath, "artifact file")
+	if err != nil {
+		return
+	}
+
+	if opts.DryRunEnabled {
+		logctx.LogStdInfo(ctx, "Dry-run requested, would move '%s' content to '%s'\n", repoFilePath, artifactFilePath)
+		return
+	}
+
+	err = content.WriteArtifactFile(artifactFilePath, fileContent)
+	if err != nil {
+		err = fmt.Errorf("failed to write artifact file: %w", err)
+		return
+	}
+
+	metaHeader.ExternalContentLocation = global.FileURIPrefix + artifactFilePath
+	err = content.WriteArtifactPointer(ctx, str.LocalRepoPath(filepath.Join(repoPath, pointerFilePath)), metaHeader, crypto.SHA256Sum(fileContent))
+	if err != nil {
+		err = fmt.Errorf("failed to write artifact pointer: %w", err)
+		return
+	}
+
+	err = stageConversion(ctx, repoPath, repoFilePath, pointerFilePath)
+	if err != nil {
+		return
+	}
+
+	logctx.LogStdInfo(ctx, "Converted '%s' to artifact pointer '%s' (content stored at '%s')\n", repoFilePath, pointerFilePath, artifactFilePath)
+	return
+}
+
+// Inlines artifact content into the repository and removes the pointer file, staging both changes
+// The artifact file itself is left in place as other pointers may reference it
+func FromArtifact(ctx context.Context, pointerPath string) (err error) {
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSArtifacts)
+
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	repoPath, err := RetrieveRepoPath(ctx)
+	if err != nil {
+		return
+	}
+	pointerFilePath, err := repoRelativePath(repoPath, pointerPath)
+	if err != nil {
+		return
+	}
+
+	if !strings.HasSuffix(pointerFilePath, string(filesystem.ArtifactPointerFileExt)) {
+		err = fmt.Errorf("file '%s' is not an artifact pointer (missing '%s' extension)", pointerFilePath, filesystem.ArtifactPointerFileExt)
+		return
+	}
+	repoFilePath := strings.TrimSuffix(pointerFilePath, string(filesystem.ArtifactPointerFileExt))
+	err = refuseExisting(filepath.Join(repoPath, repoFilePath), "repository file")
+	if err != nil {
+		return
+	}
+
+	pointerBytes, err := os.ReadFile(filepath.Join(repoPath, pointerFilePath))
+	if err != nil {
+		err = fmt.Errorf("failed reading artifact pointer: %w", err)
+		return
+	}
+	metaHeader, pointerContent, err := metadata.Extract(string(pointerBytes))
+	if err != nil {
+		err = fmt.Errorf("failed metadata extraction for file '%s': %w", pointerFilePath, err)
+		return
+	}
+	if metaHeader.ExternalContentLocation == "" {
+		err = fmt.Errorf("'%s': JSON header is missing 'ExternalContentLocation' field", pointerFilePath)
+		return
+	}
+	artifactFilePath, err := content.ArtifactFilePath(metaHeader.ExternalContentLocation)
+	if err != nil {
+		err = fmt.Errorf("'%s': %w", pointerFilePath, err)
+		return
+	}
+
+	fileContent, err := os.ReadFile(artifactFilePath)
+	if err != nil {
+		err = fmt.Errorf("failed reading artifact file: %w", err)
+		return
+	}
+
+	_, trackedHash := parsing.HasHex64Prefix(string(pointerContent))
+	if trackedHash != crypto.SHA256Sum(fileContent) {
+		logctx.LogStdWarn(ctx, "Artifact '%s' changed since its pointer was last updated, inlining current content\n", artifactFilePath)
+	}
+	if content.ShouldBeArtifact(fileContent) {
+		logctx.LogStdWarn(ctx, "Artifact '%s' is not plain text or is above the artifact size threshold, converting anyway\n", artifactFilePath)
+	}
+
+	// Text content is stored with LF line endings, CRLF endings are kept by the header
+	if parsing.IsText(&fileContent) && bytes.Contains(fileContent, []byte("\r\n")) {
+		if metaHeader.Normalize == nil {
+			metaHeader.Normalize = &config.Normalization{EOL: metadata.EOLCRLF}
+		}
+		fileContent = bytes.ReplaceAll(fileContent, []byte("\r\n"), []byte("\n"))
+	}
+	metaHeader.ExternalContentLocation = ""
+
+	if opts.DryRunEnabled {
+		logctx.LogStdInfo(ctx, "Dry-run requested, would inline '%s' content into '%s'\n", artifactFilePath, repoFilePath)
+		return
+	}
+
+	err = content.WriteRepoFile(ctx, str.LocalRepoPath(filepath.Join(repoPath, repoFilePath)), metaHeader, &fileContent)
+	if err != nil {
+		err = fmt.Errorf("failed to write repository file: %w", err)
+		return
+	}
+
+	err = stageConversion(ctx, repoPath, pointerFilePath, repoFilePath)
+	if err != nil {
+		return
+	}
+
+	logctx.LogStdInfo(ctx, "Converted artifact pointer '%s' to repository file '%s' (artifact '%s' left in place)\n", pointerFilePath, repoFilePath, artifactFilePath)
+	return
+}
+
+// Removes the old form of a converted file and stages the removal and the new form
+func stageConversion(ctx context.Context, repoPath string, oldFilePath string, newFilePath string) (err error) {
+	worktree, _, err := OpenCWD(ctx)
+	if err != nil {
+		return
+	}
+
+	// Untracked files are only removed from disk
+	_, err = worktree.Remove(filepath.ToSlash(oldFilePath))
+	if errors.Is(err, index.ErrEntryNotFound) {
+		err = os.Remove(filepath.Join(repoPath, oldFilePath))
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to remove '%s': %w", oldFilePath, err)
+		return
+	}
+
+	_, err = worktree.Add(filepath.ToSlash(newFilePath))
+	if err != nil {
+		err = fmt.Errorf("failed to stage '%s': %w", newFilePath, err)
+		return
+	}
+	return
+}
+
+// Resolves a user given path to its path inside the repository
+func repoRelativePath(repoPath string, path string) (repoFilePath string, err error) {
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	repoFilePath, err = filepath.Rel(repoPath, absolutePath)
+	if err != nil || repoFilePath == "." || strings.HasPrefix(repoFilePath, "..") {
+		err = fmt.Errorf("path '%s' is not inside the repository", path)
+		return
+	}
+	return
+}
+
+// Conversions never overwrite an existing target
+func refuseExisting(path string, description string) (err error) {
+	_, err = os.Lstat(path)
+	if err == nil {
+		err = fmt.Errorf("%s '%s' already exists, refusing to overwrite", description, path)
+		return
+	}
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
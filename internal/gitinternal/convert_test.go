@@ -0,0 +1,116 @@
+package gitinternal
+
+import (
+	"os"
+	"path/filepath"
+	"scmp/core/filesystem"
+	"scmp/core/filesystem/metadata"
+	"scmp/internal/crypto"
+	"scmp/internal/global"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestArtifactConversionRoundTrip(t *testing.T) {
+	ctx := testGitContext(t)
+
+	repoPath, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed resolving temp dir: %v", err)
+	}
+	repo, err := git.PlainInit(repoPath, false)
+	if err != nil {
+		t.Fatalf("failed creating repository: %v", err)
+	}
+	artifactDir := filepath.Join(t.TempDir(), "artifacts")
+
+	header := "#|^^^|#\n{\n  \"FileOwnerGroup\": \"root:root\",\n  \"FilePermissions\": 644\n}\n#|^^^|#\n"
+	repoFile := filepath.Join(repoPath, "web01", "etc", "motd")
+	writeTestFile(t, repoFile, header+"welcome\n")
+	t.Chdir(filepath.Join(repoPath, "web01"))
+
+	err = ToArtifact(ctx, "etc/motd", artifactDir)
+	if err != nil {
+		t.Fatalf("unexpected to-artifact error: %v", err)
+	}
+
+	// Pointer keeps the header and tracks the moved content by hash
+	pointerFile := repoFile + string(filesystem.ArtifactPointerFileExt)
+	pointerBytes, err := os.ReadFile(pointerFile)
+	if err != nil {
+		t.Fatalf("expected pointer file: %v", err)
+	}
+	metaHeader, pointerContent, err := metadata.Extract(string(pointerBytes))
+	if err != nil {
+		t.Fatalf("invalid pointer header: %v", err)
+	}
+	artifactFile := filepath.Join(artifactDir, "motd")
+	if metaHeader.TargetFileOwnerGroup != "root:root" || metaHeader.ExternalContentLocation != global.FileURIPrefix+artifactFile {
+		t.Errorf("unexpected pointer header: %+v", metaHeader)
+	}
+	if string(pointerContent) != crypto.SHA256Sum([]byte("welcome\n")) {
+		t.Errorf("expected pointer to hold content hash, got %q", pointerContent)
+	}
+	artifactContent, err := os.ReadFile(artifactFile)
+	if err != nil || string(artifactContent) != "welcome\n" {
+		t.Errorf("expected artifact content moved, got %q (%v)", artifactContent, err)
+	}
+	_, err = os.Stat(repoFile)
+	if !os.IsNotExist(err) {
+		t.Errorf("expected repository file removed")
+	}
+	assertStaged(t, repo, "web01/etc/motd"+string(filesystem.ArtifactPointerFileExt))
+
+	// Target form already present
+	err = ToArtifact(ctx, "etc/motd"+string(filesystem.ArtifactPointerFileExt), artifactDir)
+	if err == nil || !strings.Contains(err.Error(), "already an artifact pointer") {
+		t.Errorf("expected refusal for existing pointer, got %v", err)
+	}
+	writeTestFile(t, repoFile, header+"other\n")
+	err = FromArtifact(ctx, "etc/motd"+string(filesystem.ArtifactPointerFileExt))
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected refusal for existing repository file, got %v", err)
+	}
+	err = os.Remove(repoFile)
+	if err != nil {
+		t.Fatalf("failed removing file: %v", err)
+	}
+
+	err = FromArtifact(ctx, "etc/motd"+string(filesystem.ArtifactPointerFileExt))
+	if err != nil {
+		t.Fatalf("unexpected from-artifact error: %v", err)
+	}
+	repoBytes, err := os.ReadFile(repoFile)
+	if err != nil {
+		t.Fatalf("expected repository file: %v", err)
+	}
+	metaHeader, fileContent, err := metadata.Extract(string(repoBytes))
+	if err != nil {
+		t.Fatalf("invalid repository file header: %v", err)
+	}
+	if metaHeader.ExternalContentLocation != "" || metaHeader.TargetFilePermissions != 644 || string(fileContent) != "welcome\n" {
+		t.Errorf("unexpected inlined file: %+v %q", metaHeader, fileContent)
+	}
+	_, err = os.Stat(pointerFile)
+	if !os.IsNotExist(err) {
+		t.Errorf("expected pointer file removed")
+	}
+	assertStaged(t, repo, "web01/etc/motd")
+}
+
+func assertStaged(t *testing.T, repo *git.Repository, repoFilePath string) {
+	t.Helper()
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed opening worktree: %v", err)
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		t.Fatalf("failed reading status: %v", err)
+	}
+	if status.File(repoFilePath).Staging != git.Added {
+		t.Errorf("expected '%s' staged as added, got %q", repoFilePath, status.File(repoFilePath).Staging)
+	}
+}
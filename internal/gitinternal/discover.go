@@ -0,0 +1,155 @@
+package gitinternal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"scmp/internal/config"
+	"scmp/internal/fsops"
+	"scmp/internal/global"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// Locates the working tree root and, when separate from it, the git directory
+// Precedence: configured RepositoryPath, then GIT_WORK_TREE/GIT_DIR, then the nearest directory at or above the current directory holding .git
+func DiscoverRepository(ctx context.Context) (workTree string, gitDir string, err error) {
+	// Repository already known (config set or web server selected repository)
+	cfg, confPresent := ctx.Value(global.ConfKey).(config.Config)
+	if confPresent && cfg.RepositoryPath != "" {
+		workTree, err = fsops.ExpandHomeDirectory(cfg.RepositoryPath)
+		if err != nil {
+			err = fmt.Errorf("failed parsing existing repository path: %w", err)
+			return
+		}
+		gitDir = cfg.GitDirectory
+		return
+	}
+
+	currentWorkingDir, err := os.Getwd()
+	if err != nil {
+		return
+	}
+
+	// Environment overrides, same meaning as for git itself
+	envGitDir := os.Getenv(gitDirEnv)
+	envWorkTree := os.Getenv(gitWorkTreeEnv)
+	if envGitDir != "" {
+		gitDir, err = absoluteFrom(currentWorkingDir, envGitDir)
+		if err != nil {
+			return
+		}
+		_, err = os.Stat(gitDir)
+		if err != nil {
+			err = fmt.Errorf("invalid %s: %w", gitDirEnv, err)
+			return
+		}
+	}
+	if envWorkTree != "" {
+		workTree, err = absoluteFrom(currentWorkingDir, envWorkTree)
+		if err != nil {
+			return
+		}
+		_, err = os.Stat(workTree)
+		if err != nil {
+			err = fmt.Errorf("invalid %s: %w", gitWorkTreeEnv, err)
+			return
+		}
+		return
+	}
+	if gitDir != "" {
+		// Without a work tree, git uses the current directory (or the parent of a regular .git)
+		workTree = currentWorkingDir
+		if filepath.Base(gitDir) == dotGit {
+			workTree = filepath.Dir(gitDir)
+		}
+		return
+	}
+
+	// Walk upward until a directory holds .git (directory, or file for linked worktrees)
+	directory := currentWorkingDir
+	for {
+		_, err = os.Stat(filepath.Join(directory, dotGit))
+		if err == nil {
+			workTree = directory
+			return
+		}
+		if !os.IsNotExist(err) {
+			return
+		}
+
+		parent := filepath.Dir(directory)
+		if parent == directory {
+			break
+		}
+		directory = parent
+	}
+
+	err = fmt.Errorf("not inside a git repository (or any parent directory), unable to continue")
+	return
+}
+
+// Opens the discovered repository, using a separate git directory when one is set
+func OpenRepository(ctx context.Context) (repo *git.Repository, err error) {
+	workTree, gitDir, err := DiscoverRepository(ctx)
+	if err != nil {
+		return
+	}
+
+	if gitDir == "" {
+		repo, err = git.PlainOpen(workTree)
+		if err != nil {
+			err = fmt.Errorf("unable to open repository: %w", err)
+		}
+		return
+	}
+
+	storage := filesystem.NewStorage(osfs.New(gitDir), cache.NewObjectLRUDefault())
+	repo, err = git.Open(storage, osfs.New(workTree))
+	if err != nil {
+		err = fmt.Errorf("unable to open repository with git directory '%s': %w", gitDir, err)
+		return
+	}
+	return
+}
+
+// Resolves path against base when not already absolute
+func absoluteFrom(base string, path string) (absolutePath string, err error) {
+	path, err = fsops.ExpandHomeDirectory(path)
+	if err != nil {
+		return
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	absolutePath = filepath.Clean(path)
+	return
+}
+
+// Globs given from a subdirectory are relative to it, the worktree matches them from its root
+func repoRelativeGlob(repoPath string, glob string) (repoGlob string) {
+	repoGlob = glob
+	if filepath.IsAbs(glob) {
+		relativeGlob, err := filepath.Rel(repoPath, glob)
+		if err == nil && !strings.HasPrefix(relativeGlob, "..") {
+			repoGlob = relativeGlob
+		}
+		return
+	}
+
+	currentWorkingDir, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	relativeDir, err := filepath.Rel(repoPath, currentWorkingDir)
+	if err != nil || relativeDir == "." || strings.HasPrefix(relativeDir, "..") {
+		return
+	}
+	repoGlob = filepath.Join(relativeDir, glob)
+	return
+}
@@ -0,0 +1,145 @@
+package gitinternal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func testGitContext(t *testing.T) (ctx context.Context) {
+	ctx = t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.OpsKey, config.Opts{})
+
+	// Outer git environment (hooks, CI) must not leak into discovery
+	t.Setenv(gitDirEnv, "")
+	t.Setenv(gitWorkTreeEnv, "")
+	return
+}
+
+func writeTestFile(t *testing.T, path string, content string) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		t.Fatalf("failed creating directory: %v", err)
+	}
+	err = os.WriteFile(path, []byte(content), 0640)
+	if err != nil {
+		t.Fatalf("failed writing file: %v", err)
+	}
+}
+
+func TestDiscoverFromSubdirectory(t *testing.T) {
+	ctx := testGitContext(t)
+
+	repoPath, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed resolving temp dir: %v", err)
+	}
+	_, err = git.PlainInit(repoPath, false)
+	if err != nil {
+		t.Fatalf("failed creating repository: %v", err)
+	}
+	nestedDir := filepath.Join(repoPath, "host1", "etc", "nginx")
+	writeTestFile(t, filepath.Join(nestedDir, "nginx.conf"), "worker_processes 1;\n")
+	t.Chdir(nestedDir)
+
+	discovered, err := RetrieveRepoPath(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if discovered != repoPath {
+		t.Errorf("expected repository root '%s', got '%s'", repoPath, discovered)
+	}
+
+	// Globs are relative to the current directory
+	err = Add(ctx, "nginx.conf")
+	if err != nil {
+		t.Fatalf("unexpected error adding: %v", err)
+	}
+	_, status, err := OpenCWD(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error opening worktree: %v", err)
+	}
+	fileStatus := status.File("host1/etc/nginx/nginx.conf")
+	if fileStatus.Staging != git.Added {
+		t.Errorf("expected nested file staged from subdirectory, got status '%s'", status.String())
+	}
+
+	// Outside of any repository
+	t.Chdir(t.TempDir())
+	_, err = RetrieveRepoPath(ctx)
+	if err == nil {
+		t.Errorf("expected error outside of a repository")
+	}
+}
+
+func TestDiscoverSeparateGitDir(t *testing.T) {
+	ctx := testGitContext(t)
+
+	gitDir := filepath.Join(t.TempDir(), "config.git")
+	workTree := t.TempDir()
+	_, err := git.PlainInit(gitDir, true)
+	if err != nil {
+		t.Fatalf("failed creating bare repository: %v", err)
+	}
+	writeTestFile(t, filepath.Join(workTree, "host1", "etc", "hosts"), "127.0.0.1 localhost\n")
+
+	// Run from an unrelated directory, environment alone selects the repository
+	t.Chdir(t.TempDir())
+	t.Setenv(gitDirEnv, gitDir)
+	t.Setenv(gitWorkTreeEnv, workTree)
+
+	discoveredTree, discoveredGitDir, err := DiscoverRepository(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if discoveredTree != workTree || discoveredGitDir != gitDir {
+		t.Errorf("expected work tree '%s' and git dir '%s', got '%s' and '%s'", workTree, gitDir, discoveredTree, discoveredGitDir)
+	}
+
+	worktree, status, err := OpenCWD(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error opening worktree: %v", err)
+	}
+	if status.File("host1/etc/hosts").Worktree != git.Untracked {
+		t.Errorf("expected work tree file untracked, got status '%s'", status.String())
+	}
+	_, err = worktree.Add("host1/etc/hosts")
+	if err != nil {
+		t.Fatalf("unexpected error adding: %v", err)
+	}
+	commitHash, err := worktree.Commit("initial", &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@localhost", When: time.Now()}})
+	if err != nil {
+		t.Fatalf("unexpected error committing: %v", err)
+	}
+
+	// Commit lands in the separate git directory
+	_, commitID, err := GetHead(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error reading HEAD: %v", err)
+	}
+	if commitID != commitHash.String() {
+		t.Errorf("expected HEAD '%s', got '%s'", commitHash, commitID)
+	}
+	_, err = os.Stat(filepath.Join(workTree, dotGit))
+	if !os.IsNotExist(err) {
+		t.Errorf("expected no .git in the separate work tree")
+	}
+
+	// Configured repository path takes precedence over the environment
+	otherRepo := t.TempDir()
+	cfgCtx := context.WithValue(ctx, global.ConfKey, config.Config{RepositoryPath: otherRepo})
+	discoveredTree, discoveredGitDir, err = DiscoverRepository(cfgCtx)
+	if err != nil || discoveredTree != otherRepo || discoveredGitDir != "" {
+		t.Errorf("expected configured repository '%s' without git dir, got '%s' and '%s' (%v)", otherRepo, discoveredTree, discoveredGitDir, err)
+	}
+}
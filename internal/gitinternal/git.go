@@ -5,7 +5,6 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"path/filepath"
 	"scmp/internal/config"
 	"scmp/internal/fsops"
 	"scmp/internal/global"
@@ -19,62 +18,27 @@ import (
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
-// Gets absolute path to the root of the git repository using the current working directory
+// Gets absolute path to the root of the git repository working tree
 func RetrieveRepoPath(ctx context.Context) (repoPath string, err error) {
 	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Retrieving repository file path\n")
 
-	// When we already have the repo path set in context, do not use current directory
-	_, confPresent := ctx.Value(global.ConfKey).(config.Config)
-	if confPresent {
-		config := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
-		if config.RepositoryPath != "" {
-			config.RepositoryPath, err = fsops.ExpandHomeDirectory(config.RepositoryPath)
-			if err != nil {
-				err = fmt.Errorf("failed parsing existing repository path: %w", err)
-				return
-			}
-			repoPath = config.RepositoryPath
-			return
-		}
-	}
-
-	// Get current dir (expected to be root of git repo)
-	currentWorkingDir, err := os.Getwd()
+	repoPath, _, err = DiscoverRepository(ctx)
 	if err != nil {
 		return
 	}
-	expectedDotGitPath := filepath.Join(currentWorkingDir, ".git")
-
-	// Error if .git directory is not present in current directory
-	_, err = os.Stat(expectedDotGitPath)
-	if os.IsNotExist(err) {
-		err = fmt.Errorf("not in the root of a git repository, unable to continue")
-		return
-	} else if err != nil {
-		return
-	}
 
 	// Guard against empty repo path
-	if currentWorkingDir == "" {
+	if repoPath == "" {
 		err = fmt.Errorf("failed to retrieve git repository path")
 		return
 	}
-
-	// Current dir is absolute git repo path
-	repoPath = currentWorkingDir
 	return
 }
 
 // Retrieves working tree and worktree status using git repository in current working directory
 func OpenCWD(ctx context.Context) (worktree *git.Worktree, status git.Status, err error) {
-	// Check working dir for git repo
-	repoPath, err := RetrieveRepoPath(ctx)
-	if err != nil {
-		return
-	}
-
-	// Open repository
-	repo, err := git.PlainOpen(repoPath)
+	// Open repository containing working dir
+	repo, err := OpenRepository(ctx)
 	if err != nil {
 		return
 	}
@@ -130,7 +94,7 @@ func Add(ctx context.Context, addGlob string) (err error) {
 	}
 
 	// Add all files to worktree
-	err = worktree.AddGlob(addGlob)
+	err = worktree.AddGlob(repoRelativeGlob(repoPath, addGlob))
 	if err != nil {
 		return
 	}
@@ -233,15 +197,9 @@ func Commit(ctx context.Context, gitCommitAction string) (err error) {
 func GetCommit(ctx context.Context, commitID *string) (tree *object.Tree, commit *object.Commit, err error) {
 	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Retrieving commit and tree from git repository\n")
 
-	repoPath, err := RetrieveRepoPath(ctx)
-	if err != nil {
-		return
-	}
-
 	// Open the repository
-	repo, err := git.PlainOpen(repoPath)
+	repo, err := OpenRepository(ctx)
 	if err != nil {
-		err = fmt.Errorf("unable to open repository: %w", err)
 		return
 	}
 
@@ -285,6 +243,43 @@ func GetCommit(ctx context.Context, commitID *string) (tree *object.Tree, commit
 	return
 }
 
+// Retrieves the short name of the checked out branch (empty when HEAD is detached) and its commit ID
+func GetHead(ctx context.Context) (branch string, commitID string, err error) {
+	repo, err := OpenRepository(ctx)
+	if err != nil {
+		return
+	}
+
+	ref, err := repo.Head()
+	if err != nil {
+		err = fmt.Errorf("unable to get HEAD reference: %w", err)
+		return
+	}
+
+	if ref.Name().IsBranch() {
+		branch = ref.Name().Short()
+	}
+	commitID = ref.Hash().String()
+	return
+}
+
+// Retrieves the commit ID at the tip of a local branch without changing the worktree
+func GetBranchCommitID(ctx context.Context, branch string) (commitID string, err error) {
+	repo, err := OpenRepository(ctx)
+	if err != nil {
+		return
+	}
+
+	ref, err := repo.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		err = fmt.Errorf("unable to get reference for branch '%s': %w", branch, err)
+		return
+	}
+
+	commitID = ref.Hash().String()
+	return
+}
+
 // Resets HEAD to previous commit without changing working directory
 // Only roll back commit if the program was started by a hook and if the commit rollback is requested
 // Reset commit because the current commit should reflect what is deployed in the network
@@ -297,17 +292,12 @@ func RollBackOneCommit(ctx context.Context, commitID string, calledByGitHook boo
 		return
 	}
 
-	repoPath, err := RetrieveRepoPath(ctx)
-	if err != nil {
-		return
-	}
-
 	// Warn user
 	fmt.Printf("WARNING: Removing current repository commit due to processing error.\n")
 	fmt.Printf("         Working directory is **NOT** affected.\n")
 
 	// Open the repo
-	repo, err := git.PlainOpen(repoPath)
+	repo, err := OpenRepository(ctx)
 	if err != nil {
 		err = fmt.Errorf("failed to open repository: %w", err)
 		return
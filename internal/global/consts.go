@@ -15,8 +15,13 @@ const (
 	PermKey  CtxKey = "permissions" // Users configured permissions
 	ConfKey  CtxKey = "config"      // Required configurations for the user
 	OpsKey   CtxKey = "options"     // Optional parameters defined by user
+	PhaseKey CtxKey = "phase"       // Deployment phase of remote commands (for failure context)
+	PTYKey   CtxKey = "pty"         // Remote commands run on a pseudo-terminal (RequestTTY of the host)
 
 	// Local
-	FileURIPrefix         string = "file://" // Used by the user to tell certain arguments to load file content
-	MaxDirectoryLoopCount int    = 200       // Maximum recursion for any loop over directories
+	FileURIPrefix         string = "file://"  // Used by the user to tell certain arguments to load file content
+	HTTPURIPrefix         string = "http://"  // Artifact content downloaded from a web server
+	HTTPSURIPrefix        string = "https://" // Artifact content downloaded from a web server over TLS
+	S3URIPrefix           string = "s3://"    // Artifact content downloaded from S3-compatible storage (bucket/key)
+	MaxDirectoryLoopCount int    = 200        // Maximum recursion for any loop over directories
 )
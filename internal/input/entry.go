@@ -3,10 +3,13 @@ package input
 
 import (
 	"context"
+	"os"
 	"scmp/internal/global"
 	"scmp/internal/logctx"
 	"scmp/web/api/prompt"
 	"time"
+
+	"golang.org/x/term"
 )
 
 // Generic user input gatherer
@@ -49,3 +52,15 @@ func AskUserSecret(ctx context.Context, title, details string) (response []byte,
 
 	return
 }
+
+// Reports whether prompts can be answered (web users always, CLI users only from a terminal)
+func Interactive(ctx context.Context) (interactive bool) {
+	username := global.AssertFromContext[string](ctx, "username", global.UserKey, "string")
+
+	if username != global.GlobalUsername {
+		interactive = true
+		return
+	}
+	interactive = term.IsTerminal(int(os.Stdin.Fd()))
+	return
+}
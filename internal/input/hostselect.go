@@ -0,0 +1,288 @@
+package input
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"scmp/internal/config"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Group heading of hosts without any GroupTags
+const ungroupedHosts string = "(no group)"
+
+// Interactive host list state
+type hostSelector struct {
+	hosts    []selectorHost // Display order, by group then name
+	filter   string
+	cursor   int // Position in the visible hosts
+	selected map[str.RepoRootDir]struct{}
+}
+
+type selectorHost struct {
+	name   str.RepoRootDir
+	group  string   // First GroupTags entry of the host (the heading it is listed under)
+	groups []string // All GroupTags of the host, matched by the filter
+	state  string   // DeploymentState of the host
+}
+
+// Presents the configured hosts in an interactive list and returns the confirmed selection in name order
+// Typing filters the list, space toggles the host under the cursor, tab toggles all listed hosts, enter confirms, escape cancels
+func SelectHosts(hostInfo map[str.RepoRootDir]config.EndpointInfo, preselected []str.RepoRootDir) (selectedHosts []str.RepoRootDir, err error) {
+	fd := int(os.Stdin.Fd())
+
+	// Throw error if not in terminal - stdin not available outside terminal for users
+	if !term.IsTerminal(fd) {
+		err = fmt.Errorf("not in a terminal, host selection does not work (use --select-from with a saved selection)")
+		return
+	}
+
+	selector := newHostSelector(hostInfo, preselected)
+	if len(selector.hosts) == 0 {
+		err = fmt.Errorf("no hosts in config to select from")
+		return
+	}
+
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		err = fmt.Errorf("failed to set terminal raw mode: %w", err)
+		return
+	}
+	defer func() {
+		_ = term.Restore(fd, oldState)
+		fmt.Print("\x1b[H\x1b[2J")
+	}()
+
+	keyBuffer := make([]byte, 16)
+	for {
+		_, height, lerr := term.GetSize(fd)
+		if lerr != nil {
+			height = 24
+		}
+		fmt.Print("\x1b[H\x1b[2J" + strings.Join(selector.render(height), "\r\n"))
+
+		var readBytes int
+		readBytes, err = os.Stdin.Read(keyBuffer)
+		if err != nil {
+			err = fmt.Errorf("failed to read input: %w", err)
+			return
+		}
+
+		done, cancelled := selector.handleKey(keyBuffer[:readBytes])
+		if cancelled {
+			err = fmt.Errorf("host selection cancelled")
+			return
+		}
+		if done {
+			break
+		}
+	}
+
+	selectedHosts = slices.Sorted(maps.Keys(selector.selected))
+	if len(selectedHosts) == 0 {
+		err = fmt.Errorf("no hosts selected")
+		return
+	}
+	return
+}
+
+func newHostSelector(hostInfo map[str.RepoRootDir]config.EndpointInfo, preselected []str.RepoRootDir) (selector *hostSelector) {
+	selector = &hostSelector{selected: make(map[str.RepoRootDir]struct{})}
+	for name, info := range hostInfo {
+		host := selectorHost{name: name, group: ungroupedHosts, state: info.DeploymentState}
+		for _, group := range info.GroupOrder {
+			host.groups = append(host.groups, string(group))
+		}
+		if len(host.groups) > 0 {
+			host.group = host.groups[0]
+		}
+		selector.hosts = append(selector.hosts, host)
+	}
+
+	// Grouped hosts first (by group name), hosts without groups last
+	slices.SortFunc(selector.hosts, func(a, b selectorHost) int {
+		if (a.group == ungroupedHosts) != (b.group == ungroupedHosts) {
+			if a.group == ungroupedHosts {
+				return 1
+			}
+			return -1
+		}
+		if a.group != b.group {
+			return strings.Compare(a.group, b.group)
+		}
+		return strings.Compare(string(a.name), string(b.name))
+	})
+
+	for _, name := range preselected {
+		_, exists := hostInfo[name]
+		if exists {
+			selector.selected[name] = struct{}{}
+		}
+	}
+	return
+}
+
+// Hosts matching the filter (case-insensitive substring of the name, a group, or the deployment state)
+func (selector *hostSelector) visible() (hosts []selectorHost) {
+	filter := strings.ToLower(selector.filter)
+	for _, host := range selector.hosts {
+		matched := strings.Contains(strings.ToLower(string(host.name)), filter) ||
+			strings.Contains(strings.ToLower(host.state), filter)
+		for _, group := range host.groups {
+			if strings.Contains(strings.ToLower(group), filter) {
+				matched = true
+			}
+		}
+		if matched {
+			hosts = append(hosts, host)
+		}
+	}
+	return
+}
+
+// Applies one key press (or escape sequence) to the selection
+func (selector *hostSelector) handleKey(key []byte) (done bool, cancelled bool) {
+	visibleHosts := selector.visible()
+
+	switch {
+	case bytes.Equal(key, []byte{3}), bytes.Equal(key, []byte{27}):
+		// Ctrl+C or escape
+		cancelled = true
+	case bytes.Equal(key, []byte{'\r'}), bytes.Equal(key, []byte{'\n'}):
+		done = true
+	case bytes.Equal(key, []byte("\x1b[A")), bytes.Equal(key, []byte{16}):
+		// Up arrow or Ctrl+P
+		if selector.cursor > 0 {
+			selector.cursor--
+		}
+	case bytes.Equal(key, []byte("\x1b[B")), bytes.Equal(key, []byte{14}):
+		// Down arrow or Ctrl+N
+		if selector.cursor < len(visibleHosts)-1 {
+			selector.cursor++
+		}
+	case bytes.Equal(key, []byte{' '}):
+		if selector.cursor < len(visibleHosts) {
+			selector.toggle(visibleHosts[selector.cursor].name)
+		}
+	case bytes.Equal(key, []byte{'\t'}):
+		// Selects every listed host, or deselects them when all are selected
+		allSelected := true
+		for _, host := range visibleHosts {
+			_, isSelected := selector.selected[host.name]
+			allSelected = allSelected && isSelected
+		}
+		for _, host := range visibleHosts {
+			if allSelected {
+				delete(selector.selected, host.name)
+			} else {
+				selector.selected[host.name] = struct{}{}
+			}
+		}
+	case bytes.Equal(key, []byte{127}), bytes.Equal(key, []byte{8}):
+		// Backspace
+		if selector.filter != "" {
+			selector.filter = selector.filter[:len(selector.filter)-1]
+			selector.cursor = 0
+		}
+	case len(key) == 1 && key[0] > ' ' && key[0] < 127:
+		selector.filter += string(key)
+		selector.cursor = 0
+	}
+	return
+}
+
+func (selector *hostSelector) toggle(name str.RepoRootDir) {
+	_, isSelected := selector.selected[name]
+	if isSelected {
+		delete(selector.selected, name)
+	} else {
+		selector.selected[name] = struct{}{}
+	}
+}
+
+// Screen lines of the selection, the host list scrolls to keep the cursor within the given terminal height
+func (selector *hostSelector) render(height int) (lines []string) {
+	visibleHosts := selector.visible()
+
+	lines = append(lines, fmt.Sprintf("Select hosts (%d selected, %d of %d listed)", len(selector.selected), len(visibleHosts), len(selector.hosts)))
+	lines = append(lines, "  type to filter, space toggles, tab toggles listed, enter confirms, esc cancels")
+	lines = append(lines, "Filter: "+selector.filter)
+
+	// Host rows with their group headings
+	var rows []string
+	var cursorRow int
+	var currentGroup string
+	for index, host := range visibleHosts {
+		if index == 0 || host.group != currentGroup {
+			currentGroup = host.group
+			rows = append(rows, "  "+currentGroup+":")
+		}
+
+		pointer := "  "
+		if index == selector.cursor {
+			pointer = "> "
+			cursorRow = len(rows)
+		}
+		mark := "[ ]"
+		if _, isSelected := selector.selected[host.name]; isSelected {
+			mark = "[x]"
+		}
+		row := pointer + "  " + mark + " " + string(host.name)
+		if host.state != "" {
+			row += " (" + host.state + ")"
+		}
+		rows = append(rows, row)
+	}
+	if len(visibleHosts) == 0 {
+		rows = append(rows, "  no hosts match the filter")
+	}
+
+	// Rows scroll so the cursor stays on screen
+	maxRows := max(height-len(lines), 1)
+	firstRow := 0
+	if cursorRow >= maxRows {
+		firstRow = cursorRow - maxRows + 1
+	}
+	lastRow := min(firstRow+maxRows, len(rows))
+	lines = append(lines, rows[firstRow:lastRow]...)
+	return
+}
+
+// Reads a saved host selection (one host per line, blank lines and # comments are ignored)
+func ReadHostSelection(selectionFile string) (hosts []str.RepoRootDir, err error) {
+	content, err := os.ReadFile(selectionFile)
+	if err != nil {
+		err = fmt.Errorf("failed reading host selection: %w", err)
+		return
+	}
+
+	for line := range strings.SplitSeq(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hosts = append(hosts, str.RepoRootDir(line))
+	}
+	return
+}
+
+// Saves a host selection for later use with ReadHostSelection
+func WriteHostSelection(selectionFile string, hosts []str.RepoRootDir) (err error) {
+	var content strings.Builder
+	content.WriteString("# Hosts selected for SCMP (one per line)\n")
+	for _, host := range hosts {
+		content.WriteString(string(host) + "\n")
+	}
+
+	err = os.WriteFile(selectionFile, []byte(content.String()), 0600)
+	if err != nil {
+		err = fmt.Errorf("failed saving host selection: %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,119 @@
+package input
+
+import (
+	"os"
+	"path/filepath"
+	"scmp/internal/config"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testSelectorHosts() (hostInfo map[str.RepoRootDir]config.EndpointInfo) {
+	hostInfo = map[str.RepoRootDir]config.EndpointInfo{
+		"web01":  {GroupOrder: []str.RepoRootDir{"UniversalConfs_Web"}},
+		"web02":  {GroupOrder: []str.RepoRootDir{"UniversalConfs_Web"}, DeploymentState: "offline"},
+		"db01":   {GroupOrder: []str.RepoRootDir{"UniversalConfs_DB", "UniversalConfs_Web"}},
+		"mail01": {},
+	}
+	return
+}
+
+func TestHostSelectorKeys(t *testing.T) {
+	selector := newHostSelector(testSelectorHosts(), []str.RepoRootDir{"mail01", "gone01"})
+
+	var order []str.RepoRootDir
+	for _, host := range selector.hosts {
+		order = append(order, host.name)
+	}
+	expectedOrder := []str.RepoRootDir{"db01", "web01", "web02", "mail01"}
+	if !slices.Equal(order, expectedOrder) {
+		t.Fatalf("expected hosts grouped by first group (ungrouped last) %v, got %v", expectedOrder, order)
+	}
+	if _, isSelected := selector.selected["gone01"]; isSelected {
+		t.Errorf("expected preselected host missing from config to be dropped")
+	}
+
+	// Filtering by group lists hosts with the group in any position
+	for _, key := range "_web" {
+		selector.handleKey([]byte{byte(key)})
+	}
+	if len(selector.visible()) != 3 {
+		t.Errorf("expected 3 hosts matching the group filter, got %d", len(selector.visible()))
+	}
+
+	selector.handleKey([]byte("\x1b[B"))
+	selector.handleKey([]byte{' '})
+	if _, isSelected := selector.selected["web01"]; !isSelected {
+		t.Errorf("expected space to select host under cursor, got %v", selector.selected)
+	}
+
+	// Tab selects all listed, then deselects them once all are selected
+	selector.handleKey([]byte{'\t'})
+	if len(selector.selected) != 4 {
+		t.Errorf("expected every listed host and the preselected host selected, got %v", selector.selected)
+	}
+	selector.handleKey([]byte{'\t'})
+	if len(selector.selected) != 1 {
+		t.Errorf("expected only the unlisted host to stay selected, got %v", selector.selected)
+	}
+
+	// Backspace widens the filter again
+	for range 4 {
+		selector.handleKey([]byte{127})
+	}
+	if selector.filter != "" || len(selector.visible()) != 4 {
+		t.Errorf("expected cleared filter, got '%s'", selector.filter)
+	}
+
+	done, cancelled := selector.handleKey([]byte{'\r'})
+	if !done || cancelled {
+		t.Errorf("expected enter to confirm")
+	}
+	_, cancelled = selector.handleKey([]byte{3})
+	if !cancelled {
+		t.Errorf("expected ctrl+c to cancel")
+	}
+}
+
+func TestHostSelectorRender(t *testing.T) {
+	selector := newHostSelector(testSelectorHosts(), nil)
+	selector.selected["web02"] = struct{}{}
+
+	screen := strings.Join(selector.render(40), "\n")
+	for _, expected := range []string{"1 selected, 4 of 4 listed", "  UniversalConfs_Web:", "[x] web02 (offline)", "  (no group):", ">   [ ] db01"} {
+		if !strings.Contains(screen, expected) {
+			t.Errorf("expected '%s' in rendered list:\n%s", expected, screen)
+		}
+	}
+
+	// Short terminals scroll to keep the cursor row
+	selector.cursor = 3
+	lines := selector.render(5)
+	if len(lines) != 5 || !strings.Contains(lines[4], "> ") || !strings.Contains(lines[4], "mail01") {
+		t.Errorf("expected cursor row on the last line, got %q", lines)
+	}
+}
+
+func TestHostSelectionFile(t *testing.T) {
+	selectionFile := filepath.Join(t.TempDir(), "hosts")
+	err := WriteHostSelection(selectionFile, []str.RepoRootDir{"db01", "web01"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = os.WriteFile(selectionFile+".edited", []byte("# rollout\n\n  db01\nweb01\n"), 0600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, path := range []string{selectionFile, selectionFile + ".edited"} {
+		hosts, err := ReadHostSelection(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !slices.Equal(hosts, []str.RepoRootDir{"db01", "web01"}) {
+			t.Errorf("unexpected hosts %v from %s", hosts, path)
+		}
+	}
+}
@@ -23,6 +23,8 @@ const (
 	// Context keys
 	LoggerKey  CtxKey = "logger"  // Event queue (mostly for variable log verbosity handling)
 	LogTagsKey CtxKey = "logtags" // List of tags in order of broad->specific appended/popped at various parts of the program
+	LogHostKey CtxKey = "loghost" // Host recorded in structured log entries
+	LogFileKey CtxKey = "logfile" // Repository file recorded in structured log entries
 
 	// Descriptive names for available severity levels
 	FatalLog string = "Fatal"
@@ -30,6 +32,21 @@ const (
 	WarnLog  string = "Warn"
 	InfoLog  string = "Info"
 
+	// Structured log entry formats
+	LogFormatText string = "text" // logfmt style key=value pairs
+	LogFormatJSON string = "json" // One JSON object per line
+
+	// Structured log levels (severities and Info verbosity mapped together)
+	levelFatal string = "fatal"
+	levelError string = "error"
+	levelWarn  string = "warn"
+	levelInfo  string = "info"
+	levelDebug string = "debug"
+
+	// Journald native protocol
+	journaldSocketPath string = "/run/systemd/journal/socket"
+	journaldIdentifier string = "scmp"
+
 	// Namespacing Name Components
 	NSTest       string = "Test"
 	NSLogger     string = "Logger"
@@ -58,4 +75,8 @@ const (
 
 	// Output
 	maxOutputWriteFailures int = 12 // Maximum times output write can fail before log event is dropped
+
+	// Terminal control for status lines
+	cursorUpSequence   string = "\x1b[%dA" // Moves cursor up the given number of lines
+	clearBelowSequence string = "\x1b[J"   // Clears from cursor to end of screen
 )
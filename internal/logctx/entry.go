@@ -35,6 +35,8 @@ func LogStdFatal(ctx context.Context, message string, vars ...any) {
 func LogEvent(ctx context.Context, eventLevel int, severity string, message string, vars ...any) {
 	// Retrieve current tag list
 	tags := GetTagList(ctx)
+	host, _ := ctx.Value(LogHostKey).(string)
+	file, _ := ctx.Value(LogFileKey).(string)
 
 	// Get logger pointer
 	logger := GetLogger(ctx)
@@ -51,7 +53,7 @@ func LogEvent(ctx context.Context, eventLevel int, severity string, message stri
 
 			newMsg = fmt.Sprintf(message, vars...)
 		}
-		logger.log(eventLevel, severity, tags, newMsg)
+		logger.log(eventLevel, severity, tags, host, file, newMsg)
 	}
 }
 
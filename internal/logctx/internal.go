@@ -6,7 +6,7 @@ import (
 )
 
 // Logs event
-func (logger *Logger) log(eventLevel int, eventSeverity string, tags []string, fullMessage string) {
+func (logger *Logger) log(eventLevel int, eventSeverity string, tags []string, host string, file string, fullMessage string) {
 	logger.mutex.Lock()
 	currentLevel := logger.PrintLevel
 	logger.mutex.Unlock()
@@ -18,10 +18,16 @@ func (logger *Logger) log(eventLevel int, eventSeverity string, tags []string, f
 	event := Event{
 		Timestamp: time.Now(),
 		Tags:      tags,
+		Host:      host,
+		File:      file,
 		Severity:  eventSeverity,
-		Message:   fullMessage,
+		Verbosity: eventLevel,
+		Message:   logger.mask(fullMessage),
 	}
 
+	// Structured outputs never wait on the queue, so entries are written even if the program crashes
+	logger.writeSinks(event)
+
 	logger.mutex.Lock()
 	logger.queue = append(logger.queue, event)
 	logger.cond.Signal() // Notify watcher that new event is available
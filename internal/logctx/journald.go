@@ -0,0 +1,81 @@
+package logctx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Sends entries to the systemd journal using its native datagram protocol
+type journaldSink struct {
+	conn *net.UnixConn
+}
+
+// Connects to the local systemd journal
+func NewJournaldSink() (sink Sink, err error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldSocketPath, Net: "unixgram"})
+	if err != nil {
+		err = fmt.Errorf("failed to connect to journald: %w", err)
+		return
+	}
+	sink = &journaldSink{conn: conn}
+	return
+}
+
+// Syslog priority of a structured level
+func journaldPriority(level string) (priority int) {
+	switch level {
+	case levelFatal:
+		priority = 2
+	case levelError:
+		priority = 3
+	case levelWarn:
+		priority = 4
+	case levelDebug:
+		priority = 7
+	default:
+		priority = 6
+	}
+	return
+}
+
+// Encodes event as journal fields, values containing newlines use the length-prefixed binary form
+func journaldMessage(event Event) (message []byte) {
+	entry := event.structured()
+
+	var fields bytes.Buffer
+	writeField := func(name string, value string) {
+		if value == "" {
+			return
+		}
+		if !strings.Contains(value, "\n") {
+			fields.WriteString(name + "=" + value + "\n")
+			return
+		}
+		fields.WriteString(name + "\n")
+		_ = binary.Write(&fields, binary.LittleEndian, uint64(len(value)))
+		fields.WriteString(value + "\n")
+	}
+
+	writeField("MESSAGE", entry.Message)
+	writeField("PRIORITY", strconv.Itoa(journaldPriority(entry.Level)))
+	writeField("SYSLOG_IDENTIFIER", journaldIdentifier)
+	writeField("SCMP_HOST", entry.Host)
+	writeField("SCMP_FILE", entry.File)
+	writeField("SCMP_TAGS", entry.Tags)
+	message = fields.Bytes()
+	return
+}
+
+func (sink *journaldSink) WriteEvent(event Event) (err error) {
+	_, err = sink.conn.Write(journaldMessage(event))
+	return
+}
+
+func (sink *journaldSink) Close() (err error) {
+	err = sink.conn.Close()
+	return
+}
@@ -0,0 +1,72 @@
+package logctx
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// Replacement of masked values in log messages
+const maskedValue string = "********"
+
+// Hides the values in every message logged afterwards
+func MaskValues(ctx context.Context, values ...string) {
+	logger := GetLogger(ctx)
+	if logger == nil {
+		return
+	}
+
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	// New list, messages being logged keep reading the previous one
+	masked := slices.Clone(logger.masked)
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		// JSON output (summaries, events) holds values escaped
+		forms := []string{value}
+		quoted, _ := json.Marshal(value) // Strings always marshal
+		escaped := string(quoted[1 : len(quoted)-1])
+		if escaped != value {
+			forms = append(forms, escaped)
+		}
+		for _, form := range forms {
+			if !slices.Contains(masked, form) {
+				masked = append(masked, form)
+			}
+		}
+	}
+
+	// Longer values first so a value containing another is masked whole
+	slices.SortFunc(masked, func(a, b string) int {
+		return len(b) - len(a)
+	})
+	logger.masked = masked
+}
+
+// Text with every value hidden by MaskValues replaced, for output written outside of the logger
+func Mask(ctx context.Context, text string) (masked string) {
+	masked = text
+	logger := GetLogger(ctx)
+	if logger == nil {
+		return
+	}
+	masked = logger.mask(text)
+	return
+}
+
+// Message with every masked value replaced
+func (logger *Logger) mask(message string) (masked string) {
+	logger.mutex.Lock()
+	values := logger.masked
+	logger.mutex.Unlock()
+
+	masked = message
+	for _, value := range values {
+		masked = strings.ReplaceAll(masked, value, maskedValue)
+	}
+	return
+}
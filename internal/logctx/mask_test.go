@@ -0,0 +1,52 @@
+package logctx
+
+import (
+	"testing"
+)
+
+func TestMaskValues(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	ctx := New(t.Context(), NSTest, VerbosityStandard, done)
+	MaskValues(ctx, "secret", "secret-token", "")
+
+	LogStdInfo(ctx, "token %s and %s in command", "secret-token", "secret")
+
+	logger := GetLogger(ctx)
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	if len(logger.queue) != 1 {
+		t.Fatalf("expected 1 queued event, got %d", len(logger.queue))
+	}
+	expected := "token " + maskedValue + " and " + maskedValue + " in command"
+	if logger.queue[0].Message != expected {
+		t.Errorf("expected message %q, got %q", expected, logger.queue[0].Message)
+	}
+}
+
+func TestMask(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	if Mask(t.Context(), "secret") != "secret" {
+		t.Errorf("expected text unchanged without a logger")
+	}
+
+	ctx := New(t.Context(), NSTest, VerbosityStandard, done)
+	MaskValues(ctx, "secret", `pa"ss<word>`)
+
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"token secret", "token " + maskedValue},
+		{`{"details":"pa\"ss\u003cword\u003e failed"}`, `{"details":"` + maskedValue + ` failed"}`},
+	}
+	for _, test := range tests {
+		masked := Mask(ctx, test.text)
+		if masked != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, masked)
+		}
+	}
+}
@@ -45,6 +45,17 @@ func SetLogLevel(ctx context.Context, newLevel int) {
 	}
 }
 
+// Retrieve the logger's current level (VerbosityNone when no logger is present)
+func GetLogLevel(ctx context.Context) (level int) {
+	logger := GetLogger(ctx)
+	if logger != nil {
+		logger.mutex.Lock()
+		defer logger.mutex.Unlock()
+		level = logger.PrintLevel
+	}
+	return
+}
+
 // Extracts Logger from context or returns nil
 func GetLogger(ctx context.Context) (logger *Logger) {
 	logger, ok := ctx.Value(LoggerKey).(*Logger)
@@ -130,6 +130,7 @@ func (logger *Logger) outputWriter() {
 		}
 
 		if logger.formattedOutput != nil {
+			logger.eraseStatusLines()
 			for range maxOutputWriteFailures {
 				_, err := fmt.Fprintf(logger.formattedOutput, "%s", event.Format(logger.PrintLevel))
 				if err != nil {
@@ -139,6 +140,7 @@ func (logger *Logger) outputWriter() {
 				}
 				break
 			}
+			logger.writeStatusLines()
 		}
 		logger.outMutex.Unlock()
 	}
@@ -0,0 +1,172 @@
+package logctx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Structured output receiving every recorded event as it is logged
+type Sink interface {
+	WriteEvent(event Event) (err error)
+	Close() (err error)
+}
+
+// Structured log entry (one per event)
+type structuredEntry struct {
+	Timestamp string `json:"timestamp"`
+	Level     string `json:"level"`
+	Host      string `json:"host,omitempty"`
+	File      string `json:"file,omitempty"`
+	Tags      string `json:"tags,omitempty"`
+	Message   string `json:"message"`
+}
+
+// Writes entries to a file, one complete line per write
+type fileSink struct {
+	file   io.WriteCloser
+	format string
+}
+
+// Adds a structured output to the logger
+func (logger *Logger) AddSink(sink Sink) {
+	logger.sinkMutex.Lock()
+	logger.sinks = append(logger.sinks, sink)
+	logger.sinkMutex.Unlock()
+}
+
+// Closes and removes all structured outputs
+func (logger *Logger) CloseSinks() (err error) {
+	logger.sinkMutex.Lock()
+	defer logger.sinkMutex.Unlock()
+	for _, sink := range logger.sinks {
+		err = errors.Join(err, sink.Close())
+	}
+	logger.sinks = nil
+	return
+}
+
+// Writes event to every structured output, failures are reported on stderr and do not stop logging
+func (logger *Logger) writeSinks(event Event) {
+	logger.sinkMutex.Lock()
+	defer logger.sinkMutex.Unlock()
+	for _, sink := range logger.sinks {
+		err := sink.WriteEvent(event)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "encountered failure writing to log output: %v\n", err)
+		}
+	}
+}
+
+// Severity of the event for structured outputs, Info events above Progress verbosity are debug entries
+func (event Event) Level() (level string) {
+	switch event.Severity {
+	case FatalLog:
+		level = levelFatal
+	case ErrorLog:
+		level = levelError
+	case WarnLog:
+		level = levelWarn
+	default:
+		level = levelInfo
+		if event.Verbosity > VerbosityProgress {
+			level = levelDebug
+		}
+	}
+	return
+}
+
+// Structured form of the event (message without trailing newlines)
+func (event Event) structured() (entry structuredEntry) {
+	entry = structuredEntry{
+		Timestamp: event.Timestamp.Format(time.RFC3339Nano),
+		Level:     event.Level(),
+		Host:      event.Host,
+		File:      event.File,
+		Tags:      strings.Join(event.Tags, "/"),
+		Message:   strings.TrimRight(event.Message, "\n"),
+	}
+	return
+}
+
+// Formats event as a single line (logfmt for text, an object for JSON) ending in a newline
+func FormatStructured(event Event, format string) (line []byte, err error) {
+	entry := event.structured()
+
+	switch format {
+	case LogFormatJSON:
+		line, err = json.Marshal(entry)
+		if err != nil {
+			return
+		}
+	case LogFormatText, "":
+		var text bytes.Buffer
+		text.WriteString("timestamp=" + entry.Timestamp)
+		text.WriteString(" level=" + entry.Level)
+		if entry.Host != "" {
+			text.WriteString(" host=" + logfmtValue(entry.Host))
+		}
+		if entry.File != "" {
+			text.WriteString(" file=" + logfmtValue(entry.File))
+		}
+		if entry.Tags != "" {
+			text.WriteString(" tags=" + logfmtValue(entry.Tags))
+		}
+		text.WriteString(" message=" + logfmtValue(entry.Message))
+		line = text.Bytes()
+	default:
+		err = fmt.Errorf("unknown log format '%s', expected '%s' or '%s'", format, LogFormatText, LogFormatJSON)
+		return
+	}
+	line = append(line, '\n')
+	return
+}
+
+// Quotes values that would otherwise break logfmt parsing
+func logfmtValue(value string) (formatted string) {
+	formatted = value
+	if value == "" || strings.ContainsAny(value, " =\"\\") || strings.ContainsFunc(value, func(char rune) bool { return char < ' ' || char == 0x7f }) {
+		formatted = strconv.Quote(value)
+	}
+	return
+}
+
+// Opens (appends to) a log file receiving structured entries in the given format
+func NewFileSink(path string, format string) (sink Sink, err error) {
+	switch format {
+	case LogFormatText, LogFormatJSON:
+	case "":
+		format = LogFormatText
+	default:
+		err = fmt.Errorf("unknown log format '%s', expected '%s' or '%s'", format, LogFormatText, LogFormatJSON)
+		return
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		err = fmt.Errorf("failed to open log file: %w", err)
+		return
+	}
+	sink = &fileSink{file: file, format: format}
+	return
+}
+
+func (sink *fileSink) WriteEvent(event Event) (err error) {
+	line, err := FormatStructured(event, sink.format)
+	if err != nil {
+		return
+	}
+	_, err = sink.file.Write(line)
+	return
+}
+
+func (sink *fileSink) Close() (err error) {
+	err = sink.file.Close()
+	return
+}
@@ -0,0 +1,156 @@
+package logctx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventLevel(t *testing.T) {
+	tests := []struct {
+		severity  string
+		verbosity int
+		expected  string
+	}{
+		{FatalLog, VerbosityStandard, levelFatal},
+		{ErrorLog, VerbosityDebug, levelError},
+		{WarnLog, VerbosityStandard, levelWarn},
+		{InfoLog, VerbosityStandard, levelInfo},
+		{InfoLog, VerbosityProgress, levelInfo},
+		{InfoLog, VerbosityData, levelDebug},
+	}
+
+	for _, test := range tests {
+		event := Event{Severity: test.severity, Verbosity: test.verbosity}
+		if level := event.Level(); level != test.expected {
+			t.Errorf("severity %s at verbosity %d: expected level '%s', got '%s'", test.severity, test.verbosity, test.expected, level)
+		}
+	}
+}
+
+func TestFormatStructured(t *testing.T) {
+	event := Event{
+		Timestamp: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Tags:      []string{"deploy", "web01"},
+		Host:      "web01",
+		File:      "web01/etc/nginx/nginx.conf",
+		Severity:  WarnLog,
+		Message:   "reload took \"long\"\n",
+	}
+
+	line, err := FormatStructured(event, LogFormatText)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedText := `timestamp=2026-01-02T03:04:05Z level=warn host=web01 file=web01/etc/nginx/nginx.conf tags=deploy/web01 message="reload took \"long\""` + "\n"
+	if string(line) != expectedText {
+		t.Errorf("expected text entry\n%s\ngot\n%s", expectedText, line)
+	}
+
+	line, err = FormatStructured(event, LogFormatJSON)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.HasSuffix(line, []byte("\n")) || bytes.Count(line, []byte("\n")) != 1 {
+		t.Errorf("expected a single JSON line, got %q", line)
+	}
+	var entry structuredEntry
+	err = json.Unmarshal(line, &entry)
+	if err != nil {
+		t.Fatalf("invalid JSON entry: %v", err)
+	}
+	if entry.Level != levelWarn || entry.Host != "web01" || entry.File != "web01/etc/nginx/nginx.conf" || entry.Message != `reload took "long"` {
+		t.Errorf("unexpected JSON entry %+v", entry)
+	}
+
+	_, err = FormatStructured(event, "xml")
+	if err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "scmp.log")
+
+	done := make(chan struct{})
+	defer close(done)
+	ctx := New(t.Context(), NSTest, VerbosityProgress, done)
+	logger := GetLogger(ctx)
+
+	sink, err := NewFileSink(logPath, LogFormatJSON)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	logger.AddSink(sink)
+
+	hostCtx := WithFile(WithHost(ctx, "web01"), "web01/etc/hosts")
+	LogEvent(hostCtx, VerbosityStandard, InfoLog, "deployed %d files\n", 1)
+	LogEvent(ctx, VerbosityDebug, InfoLog, "below log level\n")
+	LogEvent(ctx, VerbosityStandard, ErrorLog, "failure\n")
+
+	// Entries are on disk before the output queue is drained
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed reading log file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 entries, got %d: %s", len(lines), content)
+	}
+
+	var entry structuredEntry
+	err = json.Unmarshal([]byte(lines[0]), &entry)
+	if err != nil {
+		t.Fatalf("invalid JSON entry: %v", err)
+	}
+	if entry.Host != "web01" || entry.File != "web01/etc/hosts" || entry.Message != "deployed 1 files" || entry.Level != levelInfo {
+		t.Errorf("unexpected first entry %+v", entry)
+	}
+	if !strings.Contains(lines[1], `"level":"error"`) || strings.Contains(lines[1], `"host"`) {
+		t.Errorf("unexpected second entry %s", lines[1])
+	}
+
+	err = logger.CloseSinks()
+	if err != nil {
+		t.Errorf("unexpected error closing sinks: %v", err)
+	}
+
+	_, err = NewFileSink(logPath, "xml")
+	if err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+}
+
+func TestJournaldMessage(t *testing.T) {
+	event := Event{
+		Host:     "web01",
+		Severity: ErrorLog,
+		Message:  "first line\nsecond line\n",
+	}
+
+	message := journaldMessage(event)
+
+	// Multiline values are the field name, a little endian length, then the raw value
+	value := "first line\nsecond line"
+	var expectedMessage bytes.Buffer
+	expectedMessage.WriteString("MESSAGE\n")
+	_ = binary.Write(&expectedMessage, binary.LittleEndian, uint64(len(value)))
+	expectedMessage.WriteString(value + "\n")
+
+	if !bytes.HasPrefix(message, expectedMessage.Bytes()) {
+		t.Errorf("expected binary MESSAGE field, got %q", message)
+	}
+	for _, field := range []string{"PRIORITY=3\n", "SYSLOG_IDENTIFIER=scmp\n", "SCMP_HOST=web01\n"} {
+		if !bytes.Contains(message, []byte(field)) {
+			t.Errorf("expected field %q in %q", field, message)
+		}
+	}
+	if bytes.Contains(message, []byte("SCMP_FILE")) {
+		t.Errorf("expected empty fields to be omitted, got %q", message)
+	}
+}
@@ -0,0 +1,45 @@
+package logctx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Live status lines kept below log output on the formatted output (terminal only)
+// Log events written while lines are drawn erase them first and redraw them after, so neither tears the other
+
+// Replaces the drawn status lines in place (lines must fit the terminal width to avoid wrapping)
+func (logger *Logger) DrawStatusLines(lines []string) {
+	logger.outMutex.Lock()
+	defer logger.outMutex.Unlock()
+
+	if logger.formattedOutput == nil {
+		return
+	}
+	logger.eraseStatusLines()
+	logger.statusLines = lines
+	logger.writeStatusLines()
+}
+
+// Leaves the last drawn status lines in place and stops redrawing them around log events
+func (logger *Logger) ReleaseStatusLines() {
+	logger.outMutex.Lock()
+	logger.statusLines = nil
+	logger.outMutex.Unlock()
+}
+
+// Moves the cursor back to the first status line and clears everything below it (caller must hold outMutex)
+func (logger *Logger) eraseStatusLines() {
+	if len(logger.statusLines) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(logger.formattedOutput, "\r"+cursorUpSequence+clearBelowSequence, len(logger.statusLines))
+}
+
+// Caller must hold outMutex
+func (logger *Logger) writeStatusLines() {
+	if len(logger.statusLines) == 0 {
+		return
+	}
+	_, _ = fmt.Fprint(logger.formattedOutput, strings.Join(logger.statusLines, "\n")+"\n")
+}
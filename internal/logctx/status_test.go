@@ -0,0 +1,40 @@
+package logctx
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestStatusLinesRedrawnAroundEvents(t *testing.T) {
+	done := make(chan struct{})
+	ctx := New(context.Background(), NSTest, VerbosityStandard, done)
+	logger := GetLogger(ctx)
+
+	var output bytes.Buffer
+	logger.SetFormattedOutput(&output)
+
+	logger.DrawStatusLines([]string{"host1 first", "host2 first"})
+	logger.DrawStatusLines([]string{"host1 second", "host2 second"})
+	LogStdInfo(ctx, "log line\n")
+
+	StartOutput(ctx)
+	close(done)
+	logger.Wake()
+	logger.Wait()
+
+	logger.ReleaseStatusLines()
+	logger.DrawStatusLines(nil)
+
+	erase := "\r\x1b[2A\x1b[J"
+	expected := "host1 first\nhost2 first\n" +
+		erase + "host1 second\nhost2 second\n" +
+		erase + "log line\n" + "host1 second\nhost2 second\n"
+	if output.String() != expected {
+		t.Errorf("unexpected output\nexpected: %q\ngot:      %q", expected, output.String())
+	}
+	if !strings.HasSuffix(output.String(), "host2 second\n") {
+		t.Errorf("released status lines must stay in place")
+	}
+}
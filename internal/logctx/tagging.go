@@ -42,6 +42,18 @@ func OverwriteCtxTag(ctx context.Context, newTags []string) (newCtx context.Cont
 	return
 }
 
+// Records the host of all events logged with the returned context
+func WithHost(ctx context.Context, host string) (newCtx context.Context) {
+	newCtx = context.WithValue(ctx, LogHostKey, host)
+	return
+}
+
+// Records the repository file of all events logged with the returned context
+func WithFile(ctx context.Context, file string) (newCtx context.Context) {
+	newCtx = context.WithValue(ctx, LogFileKey, file)
+	return
+}
+
 // Extracts and copies tag list from context or returns empty array if no tags exist on context.
 func GetTagList(ctx context.Context) (tagListCopy []string) {
 	if ctx == nil {
@@ -12,7 +12,10 @@ type CtxKey string
 type Event struct {
 	Timestamp time.Time // Time when event enters log buffer
 	Severity  string
+	Verbosity int // Verbosity level the event was logged at
 	Tags      []string
+	Host      string // Host the event is about (empty outside of host work)
+	File      string // Repository file the event is about (empty outside of file work)
 	Message   string
 }
 
@@ -30,6 +33,10 @@ type Logger struct {
 	formattedOutput io.Writer
 	rawOutput       chan Event
 	outMutex        sync.Mutex // Protects switching outputs
+	sinks           []Sink     // Structured outputs written synchronously when events are logged
+	sinkMutex       sync.Mutex // Protects sinks and serializes writes to them
+	statusLines     []string   // Live status lines currently drawn below formatted output
+	masked          []string   // Values replaced in every message (longest first), protected by mutex
 
 	mutex sync.Mutex // protects buffer
 	cond  *sync.Cond // condition to signal new events
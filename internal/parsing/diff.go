@@ -0,0 +1,166 @@
+package parsing
+
+import (
+	"fmt"
+	"strings"
+)
+
+const maxDiffCells int = 4_000_000 // Limit of compared line pairs before a diff is reported incomplete
+
+// Single line of an edit script between two texts
+type diffEdit struct {
+	kind     byte // ' ' unchanged, '-' removed, '+' added
+	text     string
+	oldIndex int // Line position in old text when this edit is reached
+	newIndex int // Line position in new text when this edit is reached
+}
+
+// Creates a unified diff of two texts (empty when identical)
+// Returns incomplete when the changed region is too large to compare line by line
+func UnifiedDiff(oldName string, newName string, oldText string, newText string, contextLines int) (diff string, complete bool) {
+	edits, complete := diffLines(splitLines(oldText), splitLines(newText))
+	if !complete {
+		return
+	}
+
+	var output strings.Builder
+	for index := 0; index < len(edits); {
+		if edits[index].kind == ' ' {
+			index++
+			continue
+		}
+
+		// Extend hunk until the unchanged gap to the next change is larger than both context regions
+		start := max(0, index-contextLines)
+		end := index
+		for end < len(edits) {
+			if edits[end].kind != ' ' {
+				end++
+				continue
+			}
+			nextChange := end
+			for nextChange < len(edits) && edits[nextChange].kind == ' ' {
+				nextChange++
+			}
+			if nextChange < len(edits) && nextChange-end <= 2*contextLines {
+				end = nextChange
+				continue
+			}
+			end = min(nextChange, end+contextLines)
+			break
+		}
+
+		if output.Len() == 0 {
+			fmt.Fprintf(&output, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		writeHunk(&output, edits[start:end])
+		index = end
+	}
+
+	diff = output.String()
+	return
+}
+
+// Writes hunk header and lines (line numbers start at 1, empty ranges point at the preceding line)
+func writeHunk(output *strings.Builder, hunk []diffEdit) {
+	var oldCount, newCount int
+	for _, edit := range hunk {
+		if edit.kind != '+' {
+			oldCount++
+		}
+		if edit.kind != '-' {
+			newCount++
+		}
+	}
+	oldStart := hunk[0].oldIndex + 1
+	if oldCount == 0 {
+		oldStart--
+	}
+	newStart := hunk[0].newIndex + 1
+	if newCount == 0 {
+		newStart--
+	}
+
+	fmt.Fprintf(output, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+	for _, edit := range hunk {
+		output.WriteByte(edit.kind)
+		output.WriteString(edit.text)
+		if !strings.HasSuffix(edit.text, "\n") {
+			output.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// Splits text into lines that keep their newline (last line may not have one)
+func splitLines(text string) (lines []string) {
+	lines = strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return
+}
+
+// Creates a minimal edit script using the longest common subsequence of lines
+// Common leading and trailing lines are matched first to keep the compared region small
+func diffLines(oldLines []string, newLines []string) (edits []diffEdit, complete bool) {
+	var prefix int
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	var suffix int
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix && oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	oldMiddle := oldLines[prefix : len(oldLines)-suffix]
+	newMiddle := newLines[prefix : len(newLines)-suffix]
+	if (len(oldMiddle)+1)*(len(newMiddle)+1) > maxDiffCells {
+		return
+	}
+	complete = true
+
+	// Length of common subsequence of the remaining lines from each position onward
+	columns := len(newMiddle) + 1
+	common := make([]int, (len(oldMiddle)+1)*columns)
+	for oldIndex := len(oldMiddle) - 1; oldIndex >= 0; oldIndex-- {
+		for newIndex := len(newMiddle) - 1; newIndex >= 0; newIndex-- {
+			if oldMiddle[oldIndex] == newMiddle[newIndex] {
+				common[oldIndex*columns+newIndex] = common[(oldIndex+1)*columns+newIndex+1] + 1
+			} else {
+				common[oldIndex*columns+newIndex] = max(common[(oldIndex+1)*columns+newIndex], common[oldIndex*columns+newIndex+1])
+			}
+		}
+	}
+
+	for index := range prefix {
+		edits = append(edits, diffEdit{kind: ' ', text: oldLines[index], oldIndex: index, newIndex: index})
+	}
+
+	oldIndex, newIndex := 0, 0
+	for oldIndex < len(oldMiddle) || newIndex < len(newMiddle) {
+		edit := diffEdit{oldIndex: prefix + oldIndex, newIndex: prefix + newIndex}
+		switch {
+		case oldIndex < len(oldMiddle) && newIndex < len(newMiddle) && oldMiddle[oldIndex] == newMiddle[newIndex]:
+			edit.kind = ' '
+			edit.text = oldMiddle[oldIndex]
+			oldIndex++
+			newIndex++
+		case newIndex == len(newMiddle) || (oldIndex < len(oldMiddle) && common[(oldIndex+1)*columns+newIndex] >= common[oldIndex*columns+newIndex+1]):
+			edit.kind = '-'
+			edit.text = oldMiddle[oldIndex]
+			oldIndex++
+		default:
+			edit.kind = '+'
+			edit.text = newMiddle[newIndex]
+			newIndex++
+		}
+		edits = append(edits, edit)
+	}
+
+	for index := range suffix {
+		oldPosition := len(oldLines) - suffix + index
+		newPosition := len(newLines) - suffix + index
+		edits = append(edits, diffEdit{kind: ' ', text: oldLines[oldPosition], oldIndex: oldPosition, newIndex: newPosition})
+	}
+	return
+}
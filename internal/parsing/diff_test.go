@@ -0,0 +1,71 @@
+package parsing
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	var longText strings.Builder
+	for index := range 20 {
+		longText.WriteString("line" + string(rune('a'+index)) + "\n")
+	}
+	longOld := longText.String()
+	longNew := strings.Replace(strings.Replace(longOld, "lineb\n", "lineB\n", 1), "lines\n", "", 1)
+
+	tests := []struct {
+		name         string
+		oldText      string
+		newText      string
+		expectedDiff string
+	}{
+		{
+			name:         "identical",
+			oldText:      "a\nb\n",
+			newText:      "a\nb\n",
+			expectedDiff: "",
+		},
+		{
+			name:         "single change",
+			oldText:      "a\nb\nc\n",
+			newText:      "a\nB\nc\n",
+			expectedDiff: "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name:         "created",
+			oldText:      "",
+			newText:      "a\nb\n",
+			expectedDiff: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:         "emptied",
+			oldText:      "a\n",
+			newText:      "",
+			expectedDiff: "--- old\n+++ new\n@@ -1,1 +0,0 @@\n-a\n",
+		},
+		{
+			name:         "missing final newline",
+			oldText:      "a\nb",
+			newText:      "a\nb\n",
+			expectedDiff: "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			name:         "separate hunks",
+			oldText:      longOld,
+			newText:      longNew,
+			expectedDiff: "--- old\n+++ new\n@@ -1,5 +1,5 @@\n linea\n-lineb\n+lineB\n linec\n lined\n linee\n@@ -16,5 +16,4 @@\n linep\n lineq\n liner\n-lines\n linet\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff, complete := UnifiedDiff("old", "new", test.oldText, test.newText, 3)
+			if !complete {
+				t.Fatalf("expected complete diff")
+			}
+			if diff != test.expectedDiff {
+				t.Errorf("expected diff:\n%s\ngot:\n%s", test.expectedDiff, diff)
+			}
+		})
+	}
+}
@@ -2,16 +2,24 @@ package parsing
 
 import (
 	"context"
+	"fmt"
 	"regexp"
 	"scmp/internal/config"
 	"scmp/internal/global"
 	"scmp/internal/logctx"
 	"scmp/internal/str"
+	"slices"
 	"strings"
 )
 
+const (
+	overrideGroupPrefix   string = "group:" // Override choice selecting all hosts in a universal group
+	overrideExcludePrefix string = "!"      // Override choice removing matching items from the selection
+)
+
 // Checks for user-chosen host/file override with given host/file
 // Returns immediately if override is empty
+// Choices are comma separated, "group:NAME" selects hosts in a universal group and a leading "!" excludes matches
 func CheckForOverride(ctx context.Context, override string, current string, hostList map[str.RepoRootDir]config.EndpointInfo) (skip bool) {
 	// Retrieve required deployment options
 	opts := global.AssertFromContext[config.Opts](ctx, "options", global.OpsKey, "config.Opts")
@@ -32,44 +40,136 @@ func CheckForOverride(ctx context.Context, override string, current string, host
 		return
 	}
 
-	// Allow current item if item is part of a group
-	// Only applies to host overrides, but shouldn't affect file overrides
-	group, currentItemIsPartofGroup := hostInfo.UniversalGroups[str.RepoRootDir(override)]
-	if currentItemIsPartofGroup {
-		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "  host %s is part of group %s\n", current, group)
-		skip = false
-		return
+	// Exclusions always win, inclusions are only required when at least one is given
+	var included, hasInclusions bool
+	for userChoice := range strings.SplitSeq(override, ",") {
+		exclude := strings.HasPrefix(userChoice, overrideExcludePrefix)
+		if exclude {
+			userChoice = strings.TrimPrefix(userChoice, overrideExcludePrefix)
+		} else {
+			hasInclusions = true
+		}
+		if userChoice == "" {
+			continue
+		}
+
+		matched, err := overrideChoiceMatches(opts.RegexEnabled, userChoice, current, hostInfo)
+		if err != nil {
+			// Overrides are validated before use, an invalid choice never selects anything
+			logctx.LogStdWarn(ctx, "Invalid regular expression, skipping %s: %v\n", current, err)
+			skip = true
+			return
+		}
+		if !matched {
+			continue
+		}
+
+		if exclude {
+			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "  %s is excluded by override '%s'\n", current, userChoice)
+			skip = true
+			return
+		}
+		included = true
 	}
 
-	// Split choices on comma
-	userHostChoices := strings.SplitSeq(override, ",")
-
-	// Check each override specified against current
-	for userChoice := range userHostChoices {
-		// Only assume override choice is regex if user requested it
-		if opts.RegexEnabled {
-			// Prepare user choice as regex
-			userRegex, err := regexp.Compile(userChoice)
-			if err != nil {
-				// Invalid regex, always skip (but print high verbosity what happened)
-				logctx.LogStdWarn(ctx, "Invalid regular expression: %w", err)
-				return
-			}
-
-			// Check if user regex matches current item, if so return
-			if userRegex.MatchString(current) {
-				skip = false
-				return
-			}
+	skip = hasInclusions && !included
+	return
+}
+
+// Position of the first inclusion choice in the override that selects current
+// Items matched by no inclusion choice (or an empty override) rank after every listed choice
+func OverrideOrder(regexEnabled bool, override string, current string, hostInfo config.EndpointInfo) (rank int) {
+	rank = strings.Count(override, ",") + 1
+	var position int
+	for userChoice := range strings.SplitSeq(override, ",") {
+		position++
+		if userChoice == "" || strings.HasPrefix(userChoice, overrideExcludePrefix) {
+			continue
+		}
+		matched, err := overrideChoiceMatches(regexEnabled, userChoice, current, hostInfo)
+		if err == nil && matched {
+			rank = position - 1
+			return
 		}
+	}
+	return
+}
+
+// Checks a single override choice (without exclusion prefix) against current item
+// Group selectors (and bare group names) only match hosts that are a member of the named universal group
+func overrideChoiceMatches(regexEnabled bool, userChoice string, current string, hostInfo config.EndpointInfo) (matched bool, err error) {
+	groupName, isGroupSelector := strings.CutPrefix(userChoice, overrideGroupPrefix)
+	if isGroupSelector {
+		_, matched = hostInfo.UniversalGroups[str.RepoRootDir(groupName)]
+		return
+	}
 
-		// Don't skip if current is user choice
-		if userChoice == current {
-			skip = false
+	// Bare group names are still accepted for hosts
+	_, matched = hostInfo.UniversalGroups[str.RepoRootDir(userChoice)]
+	if matched {
+		return
+	}
+
+	// Only assume override choice is regex if user requested it
+	if regexEnabled {
+		var userRegex *regexp.Regexp
+		userRegex, err = compileOverrideRegex(userChoice)
+		if err != nil {
 			return
 		}
-		skip = true
+		matched = userRegex.MatchString(current)
+		if matched {
+			return
+		}
+	}
+
+	matched = userChoice == current
+	return
+}
+
+// Compiles a regex override choice matching the full item name
+// Choices starting with ^ or ending with $ are anchored by the user and used as given
+func compileOverrideRegex(userChoice string) (userRegex *regexp.Regexp, err error) {
+	pattern := userChoice
+	if !strings.HasPrefix(pattern, "^") && !strings.HasSuffix(pattern, "$") {
+		pattern = "^(?:" + pattern + ")$"
 	}
+	userRegex, err = regexp.Compile(pattern)
+	return
+}
 
+// Checks every choice of an override before any item is matched against it
+// With regex enabled, choices other than group selectors must be valid regular expressions
+func ValidateOverride(regexEnabled bool, override string) (err error) {
+	if !regexEnabled {
+		return
+	}
+	for userChoice := range strings.SplitSeq(override, ",") {
+		userChoice = strings.TrimPrefix(userChoice, overrideExcludePrefix)
+		if userChoice == "" || strings.HasPrefix(userChoice, overrideGroupPrefix) {
+			continue
+		}
+		_, err = compileOverrideRegex(userChoice)
+		if err != nil {
+			err = fmt.Errorf("invalid regular expression '%s': %w", userChoice, err)
+			return
+		}
+	}
 	return
 }
+
+// Prints the items an override selected with their count, so the selection can be checked before anything connects
+// Shown when an override narrowed the selection, and always during dry-runs
+func LogSelection(ctx context.Context, itemType string, override string, items []string) {
+	opts := global.AssertFromContext[config.Opts](ctx, "options", global.OpsKey, "config.Opts")
+
+	eventLevel := logctx.VerbosityStandard
+	if opts.DryRunEnabled {
+		eventLevel = logctx.VerbosityNone
+	} else if override == "" {
+		return
+	}
+
+	items = slices.Sorted(slices.Values(items))
+	logctx.LogEvent(ctx, eventLevel, logctx.InfoLog, "Selected %d %s(s): %s\n", len(items), itemType, strings.Join(items, ", "))
+}
@@ -8,6 +8,7 @@ import (
 	"scmp/internal/global"
 	"scmp/internal/logctx"
 	"scmp/internal/str"
+	"strings"
 	"testing"
 )
 
@@ -65,12 +66,34 @@ func TestCheckForOverride(t *testing.T) {
 		{"universalconfs/.*", "universalconfs/etc/hosts", false, true},
 		{"universalconfs/etc/", "universalconfs/var/log/file.txt", true, true},
 		{"universalconfs/.*", "universalconfs_ssh/etc/ssh/sshd_config", true, true},
-		{"dc0[0-9].*etc/network/interfaces", "region1_dc02_host321/etc/network/interfaces", false, true},
-		{"(?=\\d{3}-\\d{2}-\\d{4})\\d{3}-\\d{2}-\\d{4}", "123-45-6789", false, true},
+		{"dc0[0-9].*etc/network/interfaces", "region1_dc02_host321/etc/network/interfaces", true, true},
+		{".*dc0[0-9].*etc/network/interfaces", "region1_dc02_host321/etc/network/interfaces", false, true},
+		{"(?=\\d{3}-\\d{2}-\\d{4})\\d{3}-\\d{2}-\\d{4}", "123-45-6789", true, true},
 		{"(\\d+)\\s+", "1234abc", true, true},
-		{"host0*", "host0436", false, true},
+		{"host0*", "host0436", true, true},
+		{"host0.*", "host0436", false, true},
+		{"web1", "web10", true, true},
+		{"web1", "web1", false, true},
+		{"web1|web2", "web2", false, true},
+		{"^web1", "web10", false, true},
+		{"1$", "web11", false, true},
 		{"UniversalConfs_Service1", "host2", false, false},
 		{"UniversalConfs_Service1", "host3", true, false},
+		{"group:UniversalConfs_Service1", "host1", false, false},
+		{"group:UniversalConfs_Service1", "host3", true, false},
+		{"group:UniversalConfs_Service1,host3", "host3", false, false},
+		{"group:UniversalConfs_Service1,group:Other", "host2", false, false},
+		{"group:UniversalConfs_Service1,!host2", "host2", true, false},
+		{"group:UniversalConfs_Service1,!host2", "host1", false, false},
+		{"!host3", "host1", false, false},
+		{"!host3", "host3", true, false},
+		{"!group:UniversalConfs_Service1", "host1", true, false},
+		{"!group:UniversalConfs_Service1", "host3", false, false},
+		{"group:UniversalConfs_Service1", "file1.txt", true, false},
+		{"host[0-9],!host2", "host1", false, true},
+		{"host[0-9],!host2", "host2", true, true},
+		{"group:UniversalConfs_Service1,!.*2", "host2", true, true},
+		{"universalconfs/.*,!.*/etc/hosts", "universalconfs/etc/hosts", true, true},
 	}
 
 	for _, test := range tests {
@@ -88,3 +111,63 @@ func TestCheckForOverride(t *testing.T) {
 		})
 	}
 }
+
+func TestOverrideOrder(t *testing.T) {
+	groupMember := config.EndpointInfo{
+		UniversalGroups: map[str.RepoRootDir]struct{}{
+			"web": {},
+		},
+	}
+
+	tests := []struct {
+		override string
+		current  string
+		hostInfo config.EndpointInfo
+		useRegex bool
+		expected int
+	}{
+		{"host2,host1", "host1", config.EndpointInfo{}, false, 1},
+		{"host2,host1", "host2", config.EndpointInfo{}, false, 0},
+		{"host2,host1", "host3", config.EndpointInfo{}, false, 2},
+		{"!host1,host1", "host1", config.EndpointInfo{}, false, 1},
+		{"host9,group:web", "host4", groupMember, false, 1},
+		{"db.*,web.*", "web01", config.EndpointInfo{}, true, 1},
+		{"", "host1", config.EndpointInfo{}, false, 1},
+	}
+
+	for _, test := range tests {
+		testTitle := fmt.Sprintf("Override '%s' Current '%s'", test.override, test.current)
+		t.Run(testTitle, func(t *testing.T) {
+			rank := OverrideOrder(test.useRegex, test.override, test.current, test.hostInfo)
+			if rank != test.expected {
+				t.Errorf("expected rank %d, got %d", test.expected, rank)
+			}
+		})
+	}
+}
+
+func TestValidateOverride(t *testing.T) {
+	tests := []struct {
+		override    string
+		useRegex    bool
+		expectedErr string
+	}{
+		{"", true, ""},
+		{"web[0-9]+,!web1,group:Other", true, ""},
+		{"web[0-9,host2", false, ""},
+		{"host1,web[0-9", true, "invalid regular expression 'web[0-9'"},
+		{"!(unclosed", true, "invalid regular expression '(unclosed'"},
+		{"group:[weird", true, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.override, func(t *testing.T) {
+			err := ValidateOverride(test.useRegex, test.override)
+			if test.expectedErr == "" && err != nil {
+				t.Errorf("expected no error, got '%v'", err)
+			} else if test.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), test.expectedErr)) {
+				t.Errorf("expected error containing '%s', got '%v'", test.expectedErr, err)
+			}
+		})
+	}
+}
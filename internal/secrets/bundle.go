@@ -0,0 +1,78 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"scmp/internal/config"
+	"scmp/internal/crypto"
+	"scmp/internal/fsops"
+	"scmp/internal/global"
+	"scmp/internal/input"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+)
+
+// Asks for the vault password and checks it against the vault file, the opened vault is kept so host passwords do not ask again
+func UnlockVaultPassword(ctx context.Context) (vaultPassword []byte, err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSVault)
+
+	if !fsops.FileExists(cfg.VaultFilePath) && !fsops.FileExists(cfg.VaultFilePath+vaultBackupSuffix) {
+		err = fmt.Errorf("vault file %s does not exist (create it with 'secrets --modify-vault-password')", cfg.VaultFilePath)
+		return
+	}
+
+	vaultPassword, err = input.AskUserSecret(ctx, "Enter password for vault", "")
+	if err != nil {
+		return
+	}
+
+	vault, err := readVault(ctx, cfg.VaultFilePath, vaultPassword)
+	if err != nil {
+		return
+	}
+	if cfg.Vault != nil && len(cfg.Vault) == 0 {
+		maps.Copy(cfg.Vault, vault)
+	}
+	return
+}
+
+// Encrypts the opened vault entries of the given names into a vault of their own (names without an entry are left out)
+func LockVaultEntries(ctx context.Context, entryNames []str.RepoRootDir, vaultPassword []byte) (lockedVault []byte, err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	entries := make(map[str.RepoRootDir]config.Credential)
+	for _, entryName := range entryNames {
+		credential, hasEntry := cfg.Vault[entryName]
+		if hasEntry {
+			entries[entryName] = credential
+		}
+	}
+
+	unlockedVault, err := json.Marshal(entries)
+	if err != nil {
+		err = fmt.Errorf("failed to marshal vault entries: %w", err)
+		return
+	}
+	lockedVault, err = crypto.Encrypt(unlockedVault, vaultPassword)
+	if err != nil {
+		err = fmt.Errorf("failed to encrypt vault entries: %w", err)
+		return
+	}
+	return
+}
+
+// Opens a vault written by LockVaultEntries as the vault of the configuration (no vault file is read)
+func UnlockVaultEntries(ctx context.Context, lockedVault []byte, vaultPassword []byte) (err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	vault, err := decodeVault(lockedVault, vaultPassword)
+	if err != nil {
+		return
+	}
+	maps.Copy(cfg.Vault, vault)
+	return
+}
@@ -11,8 +11,23 @@ import (
 	"scmp/internal/str"
 )
 
-func CLIEntry(ctx context.Context, config config.Config, modifyVaultHost str.RepoRootDir, genNewHash bool) (err error) {
-	if modifyVaultHost != "" {
+// Subcommand is empty, "verify", or "rekey" (the argon2 override only applies to rekey)
+func CLIEntry(ctx context.Context, config config.Config, modifyVaultHost str.RepoRootDir, genNewHash bool, subcommand string, kdfOverride crypto.KDFParams) (err error) {
+	if subcommand == "verify" {
+		ctx = logctx.AppendCtxTag(ctx, logctx.NSVault)
+		err = verifyVault(ctx, config.VaultFilePath)
+		if err != nil {
+			err = fmt.Errorf("vault: %w", err)
+			return
+		}
+	} else if subcommand == "rekey" {
+		ctx = logctx.AppendCtxTag(ctx, logctx.NSVault)
+		err = rekeyVault(ctx, config.VaultFilePath, kdfOverride)
+		if err != nil {
+			err = fmt.Errorf("vault: %w", err)
+			return
+		}
+	} else if modifyVaultHost != "" {
 		err = modifyVault(ctx, modifyVaultHost, config.VaultFilePath)
 		if err != nil {
 			err = fmt.Errorf("vault: %w", err)
@@ -0,0 +1,34 @@
+package secrets
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	vaultBackupSuffix string = ".bak" // Previous vault versions are kept as <vault>.bak, <vault>.bak.1, ...
+	vaultBackupCount  int    = 3      // Number of previous vault versions to keep
+	vaultTempPattern  string = ".tmp-*"
+
+	vaultHeaderPrefix  string = "$scmp-vault$" // First line of versioned vault files, followed by the version and argon2 parameters
+	vaultFormatVersion int    = 2              // Vaults without a header line are version 1 (default argon2 parameters)
+
+	encryptedContentLineLength int = 76 // Base64 cipher text of encrypted file content is wrapped at this length
+
+	becomeMethodSudo string = "sudo" // Only supported privilege escalation method
+
+	passwordCommandTimeout   time.Duration = 10 * time.Second       // Longest a PasswordCommand may run before the host fails
+	passwordCommandWaitDelay time.Duration = 500 * time.Millisecond // Longest to wait for output pipes after the PasswordCommand is killed
+
+	// Credential choices when modifying a vault entry
+	credentialLogin string = "login"
+	credentialSudo  string = "sudo"
+	credentialBoth  string = "both"
+)
+
+// Sentinel Errors
+var (
+	ErrVaultTruncated     = errors.New("vault file appears truncated")
+	ErrVaultWrongPassword = errors.New("vault password appears incorrect")
+	ErrVaultCorrupt       = errors.New("vault file appears corrupt")
+)
@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"scmp/internal/config"
+	"scmp/internal/crypto"
+	"scmp/internal/fsops"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"slices"
+	"strings"
+)
+
+// Asks for the vault password used as the key of encrypted file content
+// The password is checked against the vault file, the opened vault is kept so host passwords do not ask again
+func UnlockContentKey(ctx context.Context) (contentKey []byte, err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSVault)
+
+	if !fsops.FileExists(cfg.VaultFilePath) && !fsops.FileExists(cfg.VaultFilePath+vaultBackupSuffix) {
+		err = fmt.Errorf("encrypted file content uses the vault password, but vault file %s does not exist (create it with 'secrets --modify-vault-password')", cfg.VaultFilePath)
+		return
+	}
+
+	contentKey, err = UnlockVaultPassword(ctx)
+	return
+}
+
+// Encrypts file content, the cipher text is wrapped into lines so it stays readable in diffs
+func EncryptContent(plainText []byte, contentKey []byte) (cipherText []byte, err error) {
+	// Encryption seals in place, the callers content is left untouched
+	encodedCipherText, err := crypto.Encrypt(bytes.Clone(plainText), contentKey)
+	if err != nil {
+		err = fmt.Errorf("failed to encrypt content: %w", err)
+		return
+	}
+
+	var wrapped bytes.Buffer
+	for line := range slices.Chunk(encodedCipherText, encryptedContentLineLength) {
+		wrapped.Write(line)
+		wrapped.WriteByte('\n')
+	}
+	cipherText = wrapped.Bytes()
+	return
+}
+
+// Decrypts file content written by EncryptContent
+func DecryptContent(cipherText []byte, contentKey []byte) (plainText []byte, err error) {
+	encodedCipherText := strings.Join(strings.Fields(string(cipherText)), "")
+	if encodedCipherText == "" {
+		err = fmt.Errorf("encrypted content is empty")
+		return
+	}
+
+	decrypted, err := crypto.Decrypt([]byte(encodedCipherText), contentKey)
+	if errors.Is(err, crypto.ErrAuthentication) {
+		err = fmt.Errorf("vault password does not decrypt this content (or the content was altered): %w", err)
+		return
+	} else if err != nil {
+		err = fmt.Errorf("encrypted content is corrupt: %w", err)
+		return
+	}
+	plainText = []byte(decrypted)
+	return
+}
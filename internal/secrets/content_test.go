@@ -0,0 +1,62 @@
+package secrets
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEncryptContent(t *testing.T) {
+	contentKey := []byte("vault-password")
+	plainText := []byte(strings.Repeat("db_password = hunter2\n", 20))
+
+	cipherText, err := EncryptContent(plainText, contentKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bytes.Contains(cipherText, []byte("hunter2")) {
+		t.Fatalf("expected no plain text in cipher text")
+	}
+	for line := range strings.Lines(string(cipherText)) {
+		if len(strings.TrimSuffix(line, "\n")) > encryptedContentLineLength {
+			t.Errorf("expected cipher text lines of at most %d characters, got %d", encryptedContentLineLength, len(line))
+		}
+	}
+	if !bytes.Equal(plainText, []byte(strings.Repeat("db_password = hunter2\n", 20))) {
+		t.Errorf("expected plain text input to be left untouched")
+	}
+
+	decrypted, err := DecryptContent(cipherText, contentKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(decrypted, plainText) {
+		t.Errorf("expected decrypted content to match the plain text")
+	}
+
+	// Line endings changed by editors do not matter
+	decrypted, err = DecryptContent(bytes.ReplaceAll(cipherText, []byte("\n"), []byte("\r\n")), contentKey)
+	if err != nil || !bytes.Equal(decrypted, plainText) {
+		t.Errorf("expected content with CRLF line endings to decrypt, got '%v'", err)
+	}
+
+	_, err = DecryptContent(cipherText, []byte("wrong-password"))
+	if err == nil || !strings.Contains(err.Error(), "does not decrypt") {
+		t.Errorf("expected wrong password to be refused, got '%v'", err)
+	}
+
+	_, err = DecryptContent([]byte("\n"), contentKey)
+	if err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Errorf("expected empty content to be refused, got '%v'", err)
+	}
+
+	// Empty files encrypt as well
+	cipherText, err = EncryptContent(nil, contentKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	decrypted, err = DecryptContent(cipherText, contentKey)
+	if err != nil || len(decrypted) != 0 {
+		t.Errorf("expected empty decrypted content, got '%s' (%v)", decrypted, err)
+	}
+}
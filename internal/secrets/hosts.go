@@ -7,6 +7,7 @@ import (
 	"scmp/internal/global"
 	"scmp/internal/logctx"
 	"scmp/internal/sshinternal"
+	"scmp/internal/str"
 )
 
 // Writes hosts secrets (key, password) into received map
@@ -18,29 +19,85 @@ func GetHostValues(ctx context.Context, oldHostInfo config.EndpointInfo) (newHos
 	// Copy current global config for this host to local
 	newHostInfo = oldHostInfo
 
-	logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "    Retrieving endpoint key\n")
+	// Hosts without an identity file log in with their vault login password instead
+	if newHostInfo.IdentityFile != "" {
+		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "    Retrieving endpoint key\n")
 
-	// Get SSH Private Key from the supplied identity file
-	newHostInfo.PrivateKey, newHostInfo.KeyAlgo, err = sshinternal.IdentityToKey(ctx, newHostInfo.IdentityFile)
+		// Get SSH Private Key from the supplied identity file
+		newHostInfo.PrivateKey, newHostInfo.KeyAlgo, err = sshinternal.IdentityToKey(ctx, newHostInfo.IdentityFile)
+		if err != nil {
+			err = fmt.Errorf("failed to retrieve private key: %w", err)
+			return
+		}
+
+		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Key: %d\n", newHostInfo.PrivateKey)
+	} else {
+		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "    Host has no identity file, using password login\n")
+	}
+
+	// External password providers come before the vault
+	password, provider, err := providerPassword(ctx, newHostInfo)
 	if err != nil {
-		err = fmt.Errorf("failed to retrieve private key: %w", err)
 		return
 	}
 
-	logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Key: %d\n", newHostInfo.PrivateKey)
+	// Retrieve passwords if required
+	if provider != "" {
+		// Provided passwords are used for both login and sudo, and never logged
+		newHostInfo.Password = password
+		newHostInfo.SudoPassword = password
 
-	// Retrieve password if required
-	if newHostInfo.RequiresVault {
-		newHostInfo.Password, err = unlockVault(ctx, newHostInfo.EndpointName, cfg.VaultFilePath)
+		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "    Retrieved host password from %s\n", provider)
+	} else if newHostInfo.RequiresVault {
+		var credential config.Credential
+		credential, err = unlockVault(ctx, newHostInfo.EndpointName, cfg.VaultFilePath)
 		if err != nil {
-			err = fmt.Errorf("error retrieving host.Password from vault: %w", err)
+			err = fmt.Errorf("error retrieving host passwords from vault: %w", err)
 			return
 		}
+		newHostInfo.Password = credential.LoginPassword
+		newHostInfo.SudoPassword = credential.SudoPassword
 
-		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Password: %s\n", newHostInfo.Password)
+		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Login Password: %s\n", newHostInfo.Password)
+		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Sudo Password: %s\n", newHostInfo.SudoPassword)
 	} else {
 		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Host does not require password\n")
 	}
 
+	if newHostInfo.PrivateKey == nil && newHostInfo.Password == "" {
+		if newHostInfo.RequiresVault {
+			err = fmt.Errorf("host has no identity file and no login password in the vault")
+		} else {
+			err = fmt.Errorf("host has no identity file and neither PasswordRequired, PasswordCommand, nor PasswordEnv is set (no login password available)")
+		}
+		return
+	}
+
+	return
+}
+
+// Writes secrets (key, password) of every proxy hop for a host into received map
+func GetProxyValues(ctx context.Context, hostInfo map[str.RepoRootDir]config.EndpointInfo, endpointName str.RepoRootDir) (err error) {
+	for _, hop := range hostInfo[endpointName].ProxyChain {
+		hostInfo[hop], err = GetHostValues(ctx, hostInfo[hop])
+		if err != nil {
+			err = fmt.Errorf("proxy hop '%s': %w", hop, err)
+			return
+		}
+	}
+	return
+}
+
+// Retrieves the vault entry of a service that is not a host (like an artifact server)
+func GetServiceCredential(ctx context.Context, entryName str.RepoRootDir) (credential config.Credential, err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	ctx = logctx.AppendCtxTag(ctx, logctx.NSVault)
+
+	credential, err = unlockVault(ctx, entryName, cfg.VaultFilePath)
+	if err != nil {
+		err = fmt.Errorf("error retrieving password of '%s' from vault: %w", entryName, err)
+		return
+	}
 	return
 }
@@ -0,0 +1,73 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"scmp/internal/config"
+	"strings"
+	"syscall"
+)
+
+// Retrieves the host password from the configured external provider (PasswordCommand or PasswordEnv)
+// The password is never logged, failures name the provider but never include its output on stdout
+func providerPassword(ctx context.Context, hostInfo config.EndpointInfo) (password string, provider string, err error) {
+	switch {
+	case hostInfo.PasswordCommand != "":
+		provider = "PasswordCommand"
+		password, err = runPasswordCommand(ctx, hostInfo.PasswordCommand)
+	case hostInfo.PasswordEnv != "":
+		provider = "PasswordEnv"
+		var present bool
+		password, present = os.LookupEnv(hostInfo.PasswordEnv)
+		if !present || password == "" {
+			err = fmt.Errorf("environment variable '%s' is not set or empty", hostInfo.PasswordEnv)
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("%s for host '%s' failed: %w", provider, hostInfo.EndpointName, err)
+	}
+	return
+}
+
+// Runs a local command through the shell, its first line on stdout is the password
+func runPasswordCommand(ctx context.Context, passwordCommand string) (password string, err error) {
+	commandCtx, cancel := context.WithTimeout(ctx, passwordCommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(commandCtx, "sh", "-c", passwordCommand)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	// Children (like gpg agents) would keep the output pipes open past the timeout, so the whole process group is killed
+	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	command.Cancel = func() error {
+		return syscall.Kill(-command.Process.Pid, syscall.SIGKILL)
+	}
+	command.WaitDelay = passwordCommandWaitDelay
+
+	err = command.Run()
+	if errors.Is(commandCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("command did not finish within %s", passwordCommandTimeout)
+		return
+	} else if err != nil {
+		err = fmt.Errorf("command '%s': %w", passwordCommand, err)
+		firstLine, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n")
+		if firstLine != "" {
+			err = fmt.Errorf("%w: %s", err, firstLine)
+		}
+		return
+	}
+
+	password, _, _ = strings.Cut(stdout.String(), "\n")
+	password = strings.TrimSuffix(password, "\r")
+	if password == "" {
+		err = fmt.Errorf("command '%s' printed no password", passwordCommand)
+		return
+	}
+	return
+}
@@ -0,0 +1,71 @@
+package secrets
+
+import (
+	"context"
+	"scmp/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProviderPassword(t *testing.T) {
+	t.Setenv("SCMP_TEST_PASSWORD", "from-env")
+	t.Setenv("SCMP_TEST_EMPTY", "")
+
+	tests := []struct {
+		name             string
+		hostInfo         config.EndpointInfo
+		expectedPassword string
+		expectedProvider string
+		expectedError    string
+	}{
+		{"no provider", config.EndpointInfo{EndpointName: "web01"}, "", "", ""},
+		{"command", config.EndpointInfo{EndpointName: "web01", PasswordCommand: "printf 'from-command\\nsecond line\\n'"}, "from-command", "PasswordCommand", ""},
+		{"failing command", config.EndpointInfo{EndpointName: "web01", PasswordCommand: "echo \"$SCMP_TEST_PASSWORD\"; echo 'entry not found' >&2; exit 1"}, "", "PasswordCommand", "PasswordCommand for host 'web01' failed"},
+		{"command without output", config.EndpointInfo{EndpointName: "web02", PasswordCommand: "true"}, "", "PasswordCommand", "printed no password"},
+		{"environment", config.EndpointInfo{EndpointName: "web01", PasswordEnv: "SCMP_TEST_PASSWORD"}, "from-env", "PasswordEnv", ""},
+		{"empty environment", config.EndpointInfo{EndpointName: "web03", PasswordEnv: "SCMP_TEST_EMPTY"}, "", "PasswordEnv", "PasswordEnv for host 'web03' failed"},
+		{"unset environment", config.EndpointInfo{EndpointName: "web03", PasswordEnv: "SCMP_TEST_UNSET"}, "", "PasswordEnv", "'SCMP_TEST_UNSET' is not set"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			password, provider, err := providerPassword(t.Context(), test.hostInfo)
+			if provider != test.expectedProvider {
+				t.Errorf("expected provider '%s', got '%s'", test.expectedProvider, provider)
+			}
+			if test.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+					t.Fatalf("expected error containing '%s', got '%v'", test.expectedError, err)
+				}
+				// Stdout of a failed command may hold the password, only stderr is reported
+				if strings.Contains(err.Error(), "from-env") {
+					t.Errorf("expected command stdout to be left out of the error, got '%v'", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if password != test.expectedPassword {
+				t.Errorf("expected password '%s', got '%s'", test.expectedPassword, password)
+			}
+		})
+	}
+}
+
+func TestRunPasswordCommandTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+
+	// Backgrounded child keeps stdout open after the shell is killed
+	start := time.Now()
+	_, err := runPasswordCommand(ctx, "sleep 6 & sleep 6; echo password")
+	elapsed := time.Since(start)
+	if err == nil {
+		t.Fatalf("expected timeout error")
+	}
+	if elapsed > 3*time.Second {
+		t.Errorf("expected command stopped shortly after the timeout, took %s", elapsed)
+	}
+}
@@ -0,0 +1,232 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"scmp/core/filesystem/metadata"
+	"scmp/internal/config"
+	"scmp/internal/crypto"
+	"scmp/internal/fsops"
+	"scmp/internal/global"
+	"scmp/internal/input"
+	"scmp/internal/logctx"
+	"strings"
+)
+
+// Re-encrypts every vault entry with a new master password and/or new argon2 parameters
+// Zero fields of the parameter override keep the current vault parameters, an empty new password keeps the current password
+func rekeyVault(ctx context.Context, vaultPath string, kdfOverride crypto.KDFParams) (err error) {
+	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
+
+	if !fsops.FileExists(vaultPath) && !fsops.FileExists(vaultPath+vaultBackupSuffix) {
+		err = fmt.Errorf("vault file %s does not exist", vaultPath)
+		return
+	}
+
+	header := currentVaultHeader(vaultPath)
+	header.KDF = overrideKDF(header.KDF, kdfOverride)
+	err = header.KDF.Validate()
+	if err != nil {
+		err = fmt.Errorf("invalid key derivation parameters: %w", err)
+		return
+	}
+
+	vaultPassword, err := input.AskUserSecret(ctx, "Enter current password for vault", "")
+	if err != nil {
+		return
+	}
+	vault, err := readVault(ctx, vaultPath, vaultPassword)
+	if err != nil {
+		return
+	}
+	maps.Copy(cfg.Vault, vault)
+
+	newPassword, err := input.AskUserSecret(ctx, "Enter new password for vault (leave empty to keep the current password)", "")
+	if err != nil {
+		return
+	}
+	if len(newPassword) > 0 {
+		var newPasswordConfirm []byte
+		newPasswordConfirm, err = input.AskUserSecret(ctx, "Enter new password for vault again", "")
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(newPassword, newPasswordConfirm) {
+			err = fmt.Errorf("passwords do not match")
+			return
+		}
+	}
+	passwordChanged := len(newPassword) > 0 && !bytes.Equal(newPassword, vaultPassword)
+
+	if passwordChanged {
+		// Encrypted content would no longer open with the vault password
+		var encryptedFiles []string
+		encryptedFiles, err = encryptedRepoFiles(cfg.RepositoryPath)
+		if err != nil {
+			err = fmt.Errorf("failed searching repository for encrypted content: %w", err)
+			return
+		}
+		if len(encryptedFiles) > 0 {
+			err = fmt.Errorf("refusing to change the password while the repository has encrypted content (decrypt it with 'file decrypt', rekey, then encrypt it again): %s", strings.Join(encryptedFiles, ", "))
+			return
+		}
+
+		// Bundles are written anywhere, so only the user knows if any still need deploying
+		var userResponse string
+		userResponse, err = input.AskUser(ctx, "Bundles created with the current password cannot be deployed after the change, type 'y' to continue", "")
+		if err != nil {
+			return
+		}
+		if userResponse != "y" {
+			err = fmt.Errorf("password change cancelled")
+			return
+		}
+	}
+
+	oldPassword := vaultPassword
+	if passwordChanged {
+		vaultPassword = newPassword
+	}
+
+	err = lockVaultWith(ctx, vaultPassword, vaultPath, header)
+	if err != nil {
+		return
+	}
+
+	// Backups (now including the vault before the rekey) must not keep opening with the old password
+	err = rekeyVaultBackups(ctx, vaultPath, oldPassword, vaultPassword, header)
+	if err != nil {
+		err = fmt.Errorf("vault re-encrypted but its backups were not: %w", err)
+		return
+	}
+
+	logctx.LogStdInfo(ctx, "Re-encrypted %d vault entries (format version %d, argon2 t=%d m=%d KiB p=%d)\n",
+		len(cfg.Vault), header.Version, header.KDF.Time, header.KDF.Memory, header.KDF.Threads)
+	return
+}
+
+// Parameters with every non-zero field of the override replacing the current one
+func overrideKDF(current crypto.KDFParams, override crypto.KDFParams) (params crypto.KDFParams) {
+	params = current
+	if override.Time != 0 {
+		params.Time = override.Time
+	}
+	if override.Memory != 0 {
+		params.Memory = override.Memory
+	}
+	if override.Threads != 0 {
+		params.Threads = override.Threads
+	}
+	return
+}
+
+// Re-encrypts every readable vault backup with the new password and parameters
+// Backups the old password does not open are overwritten and removed, so no backup keeps an older password
+func rekeyVaultBackups(ctx context.Context, vaultPath string, oldPassword []byte, newPassword []byte, header vaultHeader) (err error) {
+	for _, backupPath := range vaultBackupPaths(vaultPath) {
+		backupVault, lerr := loadVaultFile(backupPath, oldPassword)
+		if os.IsNotExist(lerr) {
+			continue
+		} else if lerr != nil {
+			logctx.LogStdWarn(ctx, "Removing vault backup '%s' that does not open with the current password: %v\n", backupPath, lerr)
+			err = shredFile(backupPath)
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		var unlockedVault, cipherText []byte
+		unlockedVault, err = json.Marshal(backupVault)
+		if err != nil {
+			return
+		}
+		cipherText, err = crypto.EncryptWithKDF(unlockedVault, newPassword, header.KDF)
+		if err != nil {
+			return
+		}
+		err = atomicWriteFile(backupPath, encodeVault(header, cipherText))
+		if err != nil {
+			err = fmt.Errorf("failed re-encrypting vault backup '%s': %w", backupPath, err)
+			return
+		}
+	}
+	return
+}
+
+// Overwrites a file with zeros before removing it
+func shredFile(path string) (err error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	_, err = file.Write(make([]byte, fileInfo.Size()))
+	if err == nil {
+		err = file.Sync()
+	}
+	lerr := file.Close()
+	if err == nil && lerr != nil {
+		err = lerr
+	}
+	if err != nil {
+		return
+	}
+
+	err = os.Remove(path)
+	return
+}
+
+// Repository files (outside .git) whose metadata header marks the content as encrypted
+func encryptedRepoFiles(repositoryPath string) (encryptedFiles []string, err error) {
+	if repositoryPath == "" {
+		return
+	}
+
+	err = filepath.WalkDir(repositoryPath, func(path string, entry fs.DirEntry, lerr error) (err error) {
+		if lerr != nil {
+			err = lerr
+			return
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				err = filepath.SkipDir
+			}
+			return
+		}
+		if !entry.Type().IsRegular() {
+			return
+		}
+
+		fileContents, err := os.ReadFile(path)
+		if err != nil {
+			return
+		}
+		// Cheap check before parsing the header
+		if !bytes.Contains(fileContents, []byte(`"Encrypted"`)) {
+			return
+		}
+		jsonMetadata, _, lerr := metadata.Extract(string(fileContents))
+		if lerr != nil || !jsonMetadata.Encrypted {
+			return
+		}
+
+		relativePath, err := filepath.Rel(repositoryPath, path)
+		if err != nil {
+			return
+		}
+		encryptedFiles = append(encryptedFiles, relativePath)
+		return
+	})
+	return
+}
@@ -0,0 +1,92 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"scmp/internal/config"
+	"scmp/internal/crypto"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+	"testing"
+)
+
+func TestRekeyVaultBackups(t *testing.T) {
+	ctx := logctx.New(t.Context(), logctx.NSTest, logctx.VerbosityNone, t.Context().Done())
+	vaultPath := filepath.Join(t.TempDir(), "vault")
+	oldPassword := []byte("password1")
+	newPassword := []byte("password2")
+
+	for _, hostPassword := range []string{"first", "second", "third"} {
+		lockedVault := lockTestVault(t, map[str.RepoRootDir]config.Credential{"host1": {SudoPassword: hostPassword}}, oldPassword)
+		err := writeVault(vaultPath, lockedVault)
+		if err != nil {
+			t.Fatalf("failed writing vault: %v", err)
+		}
+	}
+	// Oldest backup left over from a password the vault no longer uses
+	staleBackup := vaultPath + vaultBackupSuffix + ".2"
+	err := os.WriteFile(staleBackup, lockTestVault(t, map[str.RepoRootDir]config.Credential{"host1": {SudoPassword: "stale"}}, []byte("password0")), 0600)
+	if err != nil {
+		t.Fatalf("failed writing stale backup: %v", err)
+	}
+
+	header := vaultHeader{Version: vaultFormatVersion, KDF: crypto.DefaultKDFParams}
+	err = rekeyVaultBackups(ctx, vaultPath, oldPassword, newPassword, header)
+	if err != nil {
+		t.Fatalf("expected no error, got '%v'", err)
+	}
+
+	expectedPasswords := map[string]string{
+		vaultPath + vaultBackupSuffix:        "second",
+		vaultPath + vaultBackupSuffix + ".1": "first",
+	}
+	for path, expectedPassword := range expectedPasswords {
+		_, err = loadVaultFile(path, oldPassword)
+		if err == nil {
+			t.Errorf("'%s': expected old password to no longer open the backup", path)
+		}
+		vault, err := loadVaultFile(path, newPassword)
+		if err != nil {
+			t.Errorf("'%s': expected backup to open with the new password, got '%v'", path, err)
+			continue
+		}
+		if vault["host1"].SudoPassword != expectedPassword {
+			t.Errorf("'%s': expected password '%s', got '%s'", path, expectedPassword, vault["host1"].SudoPassword)
+		}
+	}
+
+	_, err = os.Stat(staleBackup)
+	if !os.IsNotExist(err) {
+		t.Errorf("expected backup unreadable with the old password to be removed, got '%v'", err)
+	}
+}
+
+func TestEncryptedRepoFiles(t *testing.T) {
+	repoPath := t.TempDir()
+	files := map[string]string{
+		"host1/etc/app/credentials.conf": "#|^^^|#\n{\"FileOwnerGroup\": \"root:root\", \"Encrypted\": true}\n#|^^^|#\nY2lwaGVy\n",
+		"host1/etc/app/plain.conf":       "#|^^^|#\n{\"FileOwnerGroup\": \"root:root\"}\n#|^^^|#\n\"Encrypted\": true\n",
+		".git/objects/ab/cdef":           "#|^^^|#\n{\"Encrypted\": true}\n#|^^^|#\n",
+	}
+	for path, contents := range files {
+		fullPath := filepath.Join(repoPath, path)
+		err := os.MkdirAll(filepath.Dir(fullPath), 0700)
+		if err != nil {
+			t.Fatalf("failed creating directory: %v", err)
+		}
+		err = os.WriteFile(fullPath, []byte(contents), 0600)
+		if err != nil {
+			t.Fatalf("failed writing file: %v", err)
+		}
+	}
+
+	encryptedFiles, err := encryptedRepoFiles(repoPath)
+	if err != nil {
+		t.Fatalf("expected no error, got '%v'", err)
+	}
+	expectedFiles := []string{filepath.Join("host1", "etc", "app", "credentials.conf")}
+	if !slices.Equal(encryptedFiles, expectedFiles) {
+		t.Errorf("expected encrypted files %v, got %v", expectedFiles, encryptedFiles)
+	}
+}
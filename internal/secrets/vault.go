@@ -5,13 +5,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"scmp/internal/config"
 	"scmp/internal/crypto"
+	"scmp/internal/fsops"
 	"scmp/internal/global"
 	"scmp/internal/input"
 	"scmp/internal/logctx"
 	"scmp/internal/str"
+	"slices"
+	"strings"
 )
 
 func modifyVault(ctx context.Context, endpointName str.RepoRootDir, vaultPath string) (err error) {
@@ -20,23 +24,12 @@ func modifyVault(ctx context.Context, endpointName str.RepoRootDir, vaultPath st
 
 	ctx = logctx.AppendCtxTag(ctx, logctx.NSVault)
 
-	// Ensure vault file exists, if not create it
+	// Existing vault (or backups of one) must be readable before changing it
 	vaultFileMeta, err := os.Stat(vaultPath)
-	if os.IsNotExist(err) {
-		var vaultFile *os.File
-		vaultFile, err = os.Create(vaultPath)
-		if err != nil {
-			return
-		}
-		vaultFileMeta, _ = vaultFile.Stat()
-		err = vaultFile.Close()
-		if err != nil {
-			err = fmt.Errorf("failed to close vault file: %w", err)
-			return
-		}
-	} else if err != nil {
+	if err != nil && !os.IsNotExist(err) {
 		return
 	}
+	vaultHasData := (err == nil && vaultFileMeta.Size() > 0) || fsops.FileExists(vaultPath+vaultBackupSuffix)
 
 	// Get unlock pass from user
 	vaultPassword, err := input.AskUserSecret(ctx, "Enter password for vault", "")
@@ -44,29 +37,13 @@ func modifyVault(ctx context.Context, endpointName str.RepoRootDir, vaultPath st
 		return
 	}
 
-	// Check if vault file already has data (size is larger than the header)
-	vaultFileSize := vaultFileMeta.Size()
-	if vaultFileSize > 28 {
-		// Read in encrypted vault file
-		var lockedVaultFile []byte
-		lockedVaultFile, err = os.ReadFile(vaultPath)
-		if err != nil {
-			err = fmt.Errorf("failed to retrieve vault file: %w", err)
-			return
-		}
-
-		// Decrypt Vault
-		var unlockedVault string
-		unlockedVault, err = crypto.Decrypt(lockedVaultFile, vaultPassword)
-		if err != nil {
-			return
-		}
-
-		// Unmarshal vault JSON into global struct
-		err = json.Unmarshal([]byte(unlockedVault), &cfg.Vault)
+	if vaultHasData {
+		var vault map[str.RepoRootDir]config.Credential
+		vault, err = readVault(ctx, vaultPath, vaultPassword)
 		if err != nil {
 			return
 		}
+		maps.Copy(cfg.Vault, vault)
 	}
 
 	_, hostExists := cfg.HostInfo[endpointName]
@@ -74,13 +51,37 @@ func modifyVault(ctx context.Context, endpointName str.RepoRootDir, vaultPath st
 		logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.InfoLog, "Warning: selected host '%s' is not defined in configuration file\n", endpointName)
 	}
 
+	// Choose which password of the host is changed
+	credentialChoice, err := input.AskUser(ctx, fmt.Sprintf("Select password to set for host '%s' (%s, %s, %s) [%s]", endpointName, credentialLogin, credentialSudo, credentialBoth, credentialBoth), "")
+	if err != nil {
+		return
+	}
+	credentialChoice = strings.ToLower(strings.TrimSpace(credentialChoice))
+	var credentialLabel string
+	switch credentialChoice {
+	case credentialLogin:
+		credentialLabel = "login"
+	case credentialSudo:
+		credentialLabel = "sudo"
+	case credentialBoth, "":
+		credentialChoice = credentialBoth
+		credentialLabel = "login and sudo"
+	default:
+		err = fmt.Errorf("unknown password type '%s', expected '%s', '%s', or '%s'", credentialChoice, credentialLogin, credentialSudo, credentialBoth)
+		return
+	}
+	setLogin := credentialChoice == credentialLogin || credentialChoice == credentialBoth
+	setSudo := credentialChoice == credentialSudo || credentialChoice == credentialBoth
+
 	// Get password from user for host
 	loginUserName := cfg.HostInfo[endpointName].EndpointUser
-	hostPassword, err := input.AskUserSecret(ctx, fmt.Sprintf("Enter %s password for host '%s' (leave empty to delete entry)", loginUserName, endpointName), "")
+	hostPassword, err := input.AskUserSecret(ctx, fmt.Sprintf("Enter %s %s password for host '%s' (leave empty to delete)", loginUserName, credentialLabel, endpointName), "")
 	if err != nil {
 		return
 	}
 
+	credential := cfg.Vault[endpointName]
+
 	// Remove password if user supplied empty password
 	if len(hostPassword) == 0 {
 		// Just return if host is not in vault
@@ -94,7 +95,7 @@ func modifyVault(ctx context.Context, endpointName str.RepoRootDir, vaultPath st
 		if opts.AllowDeletions {
 			userResponse = "y"
 		} else {
-			userResponse, err = input.AskUser(ctx, "Please type 'y' to delete vault host "+string(endpointName), "")
+			userResponse, err = input.AskUser(ctx, fmt.Sprintf("Please type 'y' to delete %s password of vault host %s", credentialLabel, endpointName), "")
 			if err != nil {
 				return
 			}
@@ -102,8 +103,21 @@ func modifyVault(ctx context.Context, endpointName str.RepoRootDir, vaultPath st
 
 		// Check if the user typed 'y' (always lower-case)
 		if userResponse == "y" {
-			// Remove vault entry for host
-			delete(cfg.Vault, endpointName)
+			if setLogin {
+				credential.LoginPassword = ""
+			}
+			if setSudo {
+				credential.SudoPassword = ""
+				credential.BecomeMethod = ""
+			}
+
+			// Remove vault entry for host once it has no passwords left
+			if credential.LoginPassword == "" && credential.SudoPassword == "" {
+				delete(cfg.Vault, endpointName)
+			} else {
+				cfg.Vault[endpointName] = credential
+			}
+			err = lockVault(ctx, vaultPassword, vaultPath)
 			return
 		} else {
 			fmt.Printf("Did not receive confirmation, exiting.\n")
@@ -112,7 +126,7 @@ func modifyVault(ctx context.Context, endpointName str.RepoRootDir, vaultPath st
 	}
 
 	// Ask again to confirm
-	hostPasswordConfirm, err := input.AskUserSecret(ctx, fmt.Sprintf("Enter '%s' password for host '%s' again: ", loginUserName, endpointName), "")
+	hostPasswordConfirm, err := input.AskUserSecret(ctx, fmt.Sprintf("Enter '%s' %s password for host '%s' again: ", loginUserName, credentialLabel, endpointName), "")
 	if err != nil {
 		return
 	}
@@ -123,9 +137,13 @@ func modifyVault(ctx context.Context, endpointName str.RepoRootDir, vaultPath st
 		return
 	}
 
-	// Modify/Add host.Password
-	var credential config.Credential
-	credential.LoginUserPassword = string(hostPassword)
+	// Modify/Add host passwords
+	if setLogin {
+		credential.LoginPassword = string(hostPassword)
+	}
+	if setSudo {
+		credential.SudoPassword = string(hostPassword)
+	}
 	cfg.Vault[endpointName] = credential
 
 	// Encrypt and write changes to vault file - return with or without error
@@ -134,7 +152,14 @@ func modifyVault(ctx context.Context, endpointName str.RepoRootDir, vaultPath st
 }
 
 // Encrypts and writes current vault data back to vault file
+// The argon2 parameters of the current vault file are kept
 func lockVault(ctx context.Context, vaultPassword []byte, vaultPath string) (err error) {
+	err = lockVaultWith(ctx, vaultPassword, vaultPath, currentVaultHeader(vaultPath))
+	return
+}
+
+// Encrypts and writes current vault data to the vault file with the given header
+func lockVaultWith(ctx context.Context, vaultPassword []byte, vaultPath string, header vaultHeader) (err error) {
 	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
 
 	// Marshal vault into json
@@ -144,18 +169,18 @@ func lockVault(ctx context.Context, vaultPassword []byte, vaultPath string) (err
 	}
 
 	// Encrypt Vault
-	lockedVault, err := crypto.Encrypt(unlockedVault, vaultPassword)
+	cipherText, err := crypto.EncryptWithKDF(unlockedVault, vaultPassword, header.KDF)
 	if err != nil {
 		return
 	}
 
 	// Write encrypted vault back to disk - return with or without error
-	err = os.WriteFile(vaultPath, lockedVault, 0600)
+	err = writeVault(vaultPath, encodeVault(header, cipherText))
 	return
 }
 
-// Opens vault and retrieves password for remote host
-func unlockVault(ctx context.Context, endpointName str.RepoRootDir, vaultPath string) (hostPassword string, err error) {
+// Opens vault and retrieves passwords for remote host
+func unlockVault(ctx context.Context, endpointName str.RepoRootDir, vaultPath string) (credential config.Credential, err error) {
 	cfg := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
 
 	logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Host requires password, unlocking vault\n")
@@ -164,11 +189,8 @@ func unlockVault(ctx context.Context, endpointName str.RepoRootDir, vaultPath st
 	if len(cfg.Vault) == 0 {
 		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Reading vault file\n")
 
-		// Read in encrypted vault file
-		var lockedVaultFile []byte
-		lockedVaultFile, err = os.ReadFile(vaultPath)
-		if err != nil {
-			err = fmt.Errorf("failed to retrieve vault file: %w", err)
+		if !fsops.FileExists(vaultPath) && !fsops.FileExists(vaultPath+vaultBackupSuffix) {
+			err = fmt.Errorf("failed to retrieve vault file: %s does not exist", vaultPath)
 			return
 		}
 
@@ -181,18 +203,12 @@ func unlockVault(ctx context.Context, endpointName str.RepoRootDir, vaultPath st
 
 		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Decrypting vault\n")
 
-		// Decrypt Vault
-		var unlockedVault string
-		unlockedVault, err = crypto.Decrypt(lockedVaultFile, vaultPassword)
-		if err != nil {
-			return
-		}
-
-		// Unmarshal vault JSON using global struct
-		err = json.Unmarshal([]byte(unlockedVault), &cfg.Vault)
+		var vault map[str.RepoRootDir]config.Credential
+		vault, err = readVault(ctx, vaultPath, vaultPassword)
 		if err != nil {
 			return
 		}
+		maps.Copy(cfg.Vault, vault)
 	}
 
 	logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "      Retrieving password from vault\n")
@@ -204,7 +220,34 @@ func unlockVault(ctx context.Context, endpointName str.RepoRootDir, vaultPath st
 		return
 	}
 
-	// Retrieve password for this host
-	hostPassword = cfg.Vault[endpointName].LoginUserPassword
+	// Retrieve passwords for this host
+	credential = cfg.Vault[endpointName]
+	if credential.BecomeMethod != "" && credential.BecomeMethod != becomeMethodSudo {
+		err = fmt.Errorf("unsupported privilege escalation method '%s' (only '%s' is supported)", credential.BecomeMethod, becomeMethodSudo)
+		return
+	}
+	return
+}
+
+// Names of every entry in the vault file, without keeping the vault open
+func VaultEntryNames(ctx context.Context, vaultPath string) (entryNames []str.RepoRootDir, err error) {
+	if !fsops.FileExists(vaultPath) && !fsops.FileExists(vaultPath+vaultBackupSuffix) {
+		err = fmt.Errorf("vault file %s does not exist", vaultPath)
+		return
+	}
+
+	vaultPassword, err := input.AskUserSecret(ctx, "Enter password for vault", "")
+	if err != nil {
+		return
+	}
+
+	vault, err := readVault(ctx, vaultPath, vaultPassword)
+	if err != nil {
+		return
+	}
+	for entryName := range vault {
+		entryNames = append(entryNames, entryName)
+	}
+	slices.Sort(entryNames)
 	return
 }
@@ -0,0 +1,272 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"scmp/internal/config"
+	"scmp/internal/crypto"
+	"scmp/internal/str"
+	"testing"
+)
+
+func lockTestVault(t *testing.T, vault map[str.RepoRootDir]config.Credential, vaultPassword []byte) (lockedVault []byte) {
+	t.Helper()
+	unlockedVault, err := json.Marshal(vault)
+	if err != nil {
+		t.Fatalf("failed marshaling vault: %v", err)
+	}
+	lockedVault, err = crypto.Encrypt(unlockedVault, vaultPassword)
+	if err != nil {
+		t.Fatalf("failed encrypting vault: %v", err)
+	}
+	return
+}
+
+// Replaces a character in the middle of the cipher text with a different valid base64 character
+func flipVaultByte(lockedVault []byte) (flipped []byte) {
+	flipped = append([]byte{}, lockedVault...)
+	middle := len(flipped) / 2
+	if flipped[middle] == 'A' {
+		flipped[middle] = 'B'
+	} else {
+		flipped[middle] = 'A'
+	}
+	return
+}
+
+func TestDecodeVault(t *testing.T) {
+	vaultPassword := []byte("password1")
+	lockedVault := lockTestVault(t, map[str.RepoRootDir]config.Credential{"host1": {SudoPassword: "secret"}}, vaultPassword)
+	notJSONVault, err := crypto.Encrypt([]byte("{not json"), vaultPassword)
+	if err != nil {
+		t.Fatalf("failed encrypting vault: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		lockedVault   []byte
+		password      []byte
+		expectedError error
+	}{
+		{"valid", lockedVault, vaultPassword, nil},
+		{"wrong password", lockedVault, []byte("password2"), ErrVaultWrongPassword},
+		{"bit flipped", flipVaultByte(lockedVault), vaultPassword, ErrVaultWrongPassword},
+		{"empty", []byte{}, vaultPassword, ErrVaultTruncated},
+		{"truncated mid block", lockedVault[:len(lockedVault)-3], vaultPassword, ErrVaultTruncated},
+		{"truncated before tag", lockedVault[:40], vaultPassword, ErrVaultTruncated},
+		{"invalid characters", append([]byte("!!"), lockedVault...), vaultPassword, ErrVaultCorrupt},
+		{"invalid contents", notJSONVault, vaultPassword, ErrVaultCorrupt},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vault, err := decodeVault(test.lockedVault, test.password)
+			if test.expectedError == nil {
+				if err != nil {
+					t.Fatalf("expected no error, got '%v'", err)
+				}
+				if vault["host1"].SudoPassword != "secret" {
+					t.Errorf("expected host1 password 'secret', got '%s'", vault["host1"].SudoPassword)
+				}
+				return
+			}
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error '%v', got '%v'", test.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestDecodeLegacyVault(t *testing.T) {
+	vaultPassword := []byte("password1")
+	lockedVault, err := crypto.Encrypt([]byte(`{"host1":{"loginUserPassword":"legacy"},"host2":{"loginPassword":"login","sudoPassword":"sudo"}}`), vaultPassword)
+	if err != nil {
+		t.Fatalf("failed encrypting vault: %v", err)
+	}
+
+	vault, err := decodeVault(lockedVault, vaultPassword)
+	if err != nil {
+		t.Fatalf("expected no error, got '%v'", err)
+	}
+
+	expectedVault := map[str.RepoRootDir]config.Credential{
+		"host1": {LoginPassword: "legacy", SudoPassword: "legacy"},
+		"host2": {LoginPassword: "login", SudoPassword: "sudo"},
+	}
+	for endpointName, expectedCredential := range expectedVault {
+		if vault[endpointName] != expectedCredential {
+			t.Errorf("%s: expected credential '%+v', got '%+v'", endpointName, expectedCredential, vault[endpointName])
+		}
+	}
+
+	// Upgraded entries are written back without the legacy field
+	unlockedVault, err := json.Marshal(vault)
+	if err != nil {
+		t.Fatalf("failed marshaling vault: %v", err)
+	}
+	if bytes.Contains(unlockedVault, []byte("loginUserPassword")) {
+		t.Errorf("expected legacy field to be dropped, got '%s'", unlockedVault)
+	}
+}
+
+func TestDecodeVersionedVault(t *testing.T) {
+	vaultPassword := []byte("password1")
+	header := vaultHeader{Version: vaultFormatVersion, KDF: crypto.KDFParams{Time: 2, Memory: 8 * 1024, Threads: 1}}
+	cipherText, err := crypto.EncryptWithKDF([]byte(`{"host1":{"sudoPassword":"secret"}}`), vaultPassword, header.KDF)
+	if err != nil {
+		t.Fatalf("failed encrypting vault: %v", err)
+	}
+	lockedVault := encodeVault(header, cipherText)
+
+	vault, err := decodeVault(lockedVault, vaultPassword)
+	if err != nil {
+		t.Fatalf("expected no error, got '%v'", err)
+	}
+	if vault["host1"].SudoPassword != "secret" {
+		t.Errorf("expected sudo password 'secret', got '%s'", vault["host1"].SudoPassword)
+	}
+
+	// Header parameters are read back without the password
+	vaultPath := filepath.Join(t.TempDir(), "vault")
+	err = os.WriteFile(vaultPath, lockedVault, 0600)
+	if err != nil {
+		t.Fatalf("failed writing vault: %v", err)
+	}
+	if currentVaultHeader(vaultPath) != header {
+		t.Errorf("expected header '%+v', got '%+v'", header, currentVaultHeader(vaultPath))
+	}
+
+	tests := []struct {
+		name          string
+		lockedVault   []byte
+		expectedError error
+	}{
+		{"header only", encodeVault(header, nil), ErrVaultTruncated},
+		{"malformed header", append([]byte(vaultHeaderPrefix+"v=2$t=x\n"), cipherText...), ErrVaultCorrupt},
+		{"newer version", encodeVault(vaultHeader{Version: vaultFormatVersion + 1, KDF: header.KDF}, cipherText), ErrVaultCorrupt},
+		{"wrong parameters", encodeVault(vaultHeader{Version: vaultFormatVersion, KDF: crypto.DefaultKDFParams}, cipherText), ErrVaultWrongPassword},
+	}
+	for _, test := range tests {
+		_, err := decodeVault(test.lockedVault, vaultPassword)
+		if !errors.Is(err, test.expectedError) {
+			t.Errorf("%s: expected error '%v', got '%v'", test.name, test.expectedError, err)
+		}
+	}
+}
+
+func TestWriteVaultBackupRotation(t *testing.T) {
+	vaultPath := filepath.Join(t.TempDir(), "vault")
+	vaultPassword := []byte("password1")
+
+	// Placeholder files are replaced without a backup
+	err := os.WriteFile(vaultPath, []byte{}, 0600)
+	if err != nil {
+		t.Fatalf("failed creating placeholder vault: %v", err)
+	}
+
+	hostPasswords := []string{"first", "second", "third", "fourth", "fifth"}
+	for _, hostPassword := range hostPasswords {
+		lockedVault := lockTestVault(t, map[str.RepoRootDir]config.Credential{"host1": {SudoPassword: hostPassword}}, vaultPassword)
+		err = writeVault(vaultPath, lockedVault)
+		if err != nil {
+			t.Fatalf("failed writing vault: %v", err)
+		}
+	}
+
+	// Newest first, oldest writes are dropped
+	expectedPasswords := map[string]string{
+		vaultPath:                            "fifth",
+		vaultPath + vaultBackupSuffix:        "fourth",
+		vaultPath + vaultBackupSuffix + ".1": "third",
+		vaultPath + vaultBackupSuffix + ".2": "second",
+	}
+	for path, expectedPassword := range expectedPasswords {
+		vault, err := loadVaultFile(path, vaultPassword)
+		if err != nil {
+			t.Errorf("failed reading '%s': %v", path, err)
+			continue
+		}
+		if vault["host1"].SudoPassword != expectedPassword {
+			t.Errorf("'%s': expected password '%s', got '%s'", path, expectedPassword, vault["host1"].SudoPassword)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(vaultPath))
+	if err != nil {
+		t.Fatalf("failed listing vault directory: %v", err)
+	}
+	if len(entries) != len(expectedPasswords) {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("expected %d files in vault directory, got '%v'", len(expectedPasswords), names)
+	}
+}
+
+func TestInspectVaultRecovery(t *testing.T) {
+	vaultPassword := []byte("password1")
+	oldVault := lockTestVault(t, map[str.RepoRootDir]config.Credential{"host1": {SudoPassword: "old"}}, vaultPassword)
+	newVault := lockTestVault(t, map[str.RepoRootDir]config.Credential{"host1": {SudoPassword: "new"}}, vaultPassword)
+
+	tests := []struct {
+		name                string
+		damage              func(lockedVault []byte) []byte
+		password            []byte
+		expectedError       error
+		expectedBackupFound bool
+	}{
+		{"readable", func(lockedVault []byte) []byte { return lockedVault }, vaultPassword, nil, false},
+		{"truncated", func(lockedVault []byte) []byte { return lockedVault[:len(lockedVault)/2+1] }, vaultPassword, ErrVaultTruncated, true},
+		{"bit flipped", flipVaultByte, vaultPassword, ErrVaultCorrupt, true},
+		{"wrong password", func(lockedVault []byte) []byte { return lockedVault }, []byte("password2"), ErrVaultWrongPassword, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vaultPath := filepath.Join(t.TempDir(), "vault")
+			err := writeVault(vaultPath, oldVault)
+			if err != nil {
+				t.Fatalf("failed writing vault: %v", err)
+			}
+			err = writeVault(vaultPath, newVault)
+			if err != nil {
+				t.Fatalf("failed writing vault: %v", err)
+			}
+
+			// Simulate damage to the current vault file after it was written
+			err = os.WriteFile(vaultPath, test.damage(newVault), 0600)
+			if err != nil {
+				t.Fatalf("failed damaging vault: %v", err)
+			}
+
+			vault, backupPath, backupVault, err := inspectVault(vaultPath, test.password)
+			if test.expectedError == nil {
+				if err != nil {
+					t.Fatalf("expected no error, got '%v'", err)
+				}
+				if vault["host1"].SudoPassword != "new" {
+					t.Errorf("expected current vault contents, got '%v'", vault)
+				}
+				return
+			}
+
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error '%v', got '%v'", test.expectedError, err)
+			}
+			if test.expectedBackupFound {
+				if backupPath != vaultPath+vaultBackupSuffix {
+					t.Errorf("expected backup '%s', got '%s'", vaultPath+vaultBackupSuffix, backupPath)
+				}
+				if backupVault["host1"].SudoPassword != "old" {
+					t.Errorf("expected backup vault contents, got '%v'", backupVault)
+				}
+			} else if backupPath != "" {
+				t.Errorf("expected no readable backup, got '%s'", backupPath)
+			}
+		})
+	}
+}
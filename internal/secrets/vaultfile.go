@@ -0,0 +1,341 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"scmp/internal/config"
+	"scmp/internal/crypto"
+	"scmp/internal/input"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"strings"
+)
+
+// Decrypts and decodes vault file contents, classifying why unusable contents could not be read
+func decodeVault(lockedVault []byte, vaultPassword []byte) (vault map[str.RepoRootDir]config.Credential, err error) {
+	lockedVault = bytes.TrimSpace(lockedVault)
+	if len(lockedVault) == 0 {
+		err = fmt.Errorf("%w: file is empty", ErrVaultTruncated)
+		return
+	}
+
+	header, lockedVault, err := splitVaultHeader(lockedVault)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrVaultCorrupt, err)
+		return
+	}
+	if len(lockedVault) == 0 {
+		err = fmt.Errorf("%w: file has no cipher text after the header", ErrVaultTruncated)
+		return
+	}
+
+	unlockedVault, err := crypto.DecryptWithKDF(lockedVault, vaultPassword, header.KDF)
+	if errors.Is(err, crypto.ErrCipherTextTooShort) {
+		err = fmt.Errorf("%w: %w", ErrVaultTruncated, err)
+		return
+	} else if errors.Is(err, crypto.ErrAuthentication) {
+		err = fmt.Errorf("%w (or vault contents were altered): %w", ErrVaultWrongPassword, err)
+		return
+	} else if err != nil {
+		// Only an incomplete final base64 block indicates the file ended early
+		if isPartialBase64(lockedVault) {
+			err = fmt.Errorf("%w: %w", ErrVaultTruncated, err)
+		} else {
+			err = fmt.Errorf("%w: %w", ErrVaultCorrupt, err)
+		}
+		return
+	}
+
+	err = json.Unmarshal([]byte(unlockedVault), &vault)
+	if err != nil {
+		err = fmt.Errorf("%w: decrypted contents are invalid: %w", ErrVaultCorrupt, err)
+		return
+	}
+	upgradeLegacyCredentials(vault)
+	return
+}
+
+// Format version and key derivation parameters of a vault file
+type vaultHeader struct {
+	Version int
+	KDF     crypto.KDFParams
+}
+
+// Splits a vault file into its header and base64 cipher text
+// Files without a header line are the unversioned format 1, encrypted with the default argon2 parameters
+func splitVaultHeader(lockedVault []byte) (header vaultHeader, cipherText []byte, err error) {
+	header = vaultHeader{Version: 1, KDF: crypto.DefaultKDFParams}
+	cipherText = lockedVault
+	if !bytes.HasPrefix(lockedVault, []byte(vaultHeaderPrefix)) {
+		return
+	}
+
+	headerLine, cipherText, _ := bytes.Cut(lockedVault, []byte("\n"))
+	cipherText = bytes.TrimSpace(cipherText)
+
+	_, err = fmt.Sscanf(strings.TrimSpace(string(headerLine)), vaultHeaderPrefix+"v=%d$t=%d,m=%d,p=%d", &header.Version, &header.KDF.Time, &header.KDF.Memory, &header.KDF.Threads)
+	if err != nil {
+		err = fmt.Errorf("invalid vault header: %w", err)
+		return
+	}
+	if header.Version > vaultFormatVersion {
+		err = fmt.Errorf("vault format version %d is newer than the supported version %d", header.Version, vaultFormatVersion)
+		return
+	}
+	err = header.KDF.Validate()
+	if err != nil {
+		err = fmt.Errorf("invalid vault header: %w", err)
+		return
+	}
+	return
+}
+
+// Vault file contents of the header line followed by the base64 cipher text
+func encodeVault(header vaultHeader, cipherText []byte) (lockedVault []byte) {
+	headerLine := fmt.Sprintf("%sv=%d$t=%d,m=%d,p=%d\n", vaultHeaderPrefix, header.Version, header.KDF.Time, header.KDF.Memory, header.KDF.Threads)
+	lockedVault = append([]byte(headerLine), cipherText...)
+	lockedVault = append(lockedVault, '\n')
+	return
+}
+
+// Header of the current vault file in the current format version
+// Missing or unreadable vault files get the default argon2 parameters
+func currentVaultHeader(vaultPath string) (header vaultHeader) {
+	header = vaultHeader{Version: vaultFormatVersion, KDF: crypto.DefaultKDFParams}
+
+	lockedVault, err := os.ReadFile(vaultPath)
+	if err != nil {
+		return
+	}
+	fileHeader, _, err := splitVaultHeader(bytes.TrimSpace(lockedVault))
+	if err != nil {
+		return
+	}
+	header.KDF = fileHeader.KDF
+	return
+}
+
+// Splits the single password of older vault entries into login and sudo passwords (rewritten in the new format on next vault modification)
+func upgradeLegacyCredentials(vault map[str.RepoRootDir]config.Credential) {
+	for endpointName, credential := range vault {
+		if credential.LoginUserPassword == "" {
+			continue
+		}
+		if credential.LoginPassword == "" {
+			credential.LoginPassword = credential.LoginUserPassword
+		}
+		if credential.SudoPassword == "" {
+			credential.SudoPassword = credential.LoginUserPassword
+		}
+		credential.LoginUserPassword = ""
+		vault[endpointName] = credential
+	}
+}
+
+// Checks if text is valid base64 that stops partway through a block
+func isPartialBase64(text []byte) (partial bool) {
+	for _, char := range text {
+		isAlphabet := (char >= 'A' && char <= 'Z') || (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9') || char == '+' || char == '/'
+		if !isAlphabet {
+			return
+		}
+	}
+	partial = len(text)%4 != 0
+	return
+}
+
+// Reads and decodes a single vault file
+func loadVaultFile(vaultPath string, vaultPassword []byte) (vault map[str.RepoRootDir]config.Credential, err error) {
+	lockedVault, err := os.ReadFile(vaultPath)
+	if err != nil {
+		return
+	}
+
+	vault, err = decodeVault(lockedVault, vaultPassword)
+	return
+}
+
+// Reads vault file, and when it cannot be used, finds the newest backup readable with the same password
+// Authentication failures are reported as corruption when a backup proves the password is correct
+func inspectVault(vaultPath string, vaultPassword []byte) (vault map[str.RepoRootDir]config.Credential, backupPath string, backupVault map[str.RepoRootDir]config.Credential, err error) {
+	vault, err = loadVaultFile(vaultPath, vaultPassword)
+	if err == nil {
+		return
+	}
+
+	for _, path := range vaultBackupPaths(vaultPath) {
+		readableVault, lerr := loadVaultFile(path, vaultPassword)
+		if lerr == nil {
+			backupPath = path
+			backupVault = readableVault
+			break
+		}
+	}
+	if backupPath == "" {
+		return
+	}
+
+	if errors.Is(err, ErrVaultWrongPassword) {
+		err = fmt.Errorf("%w: failed authentication but backup '%s' opens with the same password", ErrVaultCorrupt, backupPath)
+	}
+	return
+}
+
+// Reads vault file, offering to use the newest readable backup when the vault file is damaged
+func readVault(ctx context.Context, vaultPath string, vaultPassword []byte) (vault map[str.RepoRootDir]config.Credential, err error) {
+	vault, backupPath, backupVault, err := inspectVault(vaultPath, vaultPassword)
+	if err == nil {
+		return
+	}
+	err = fmt.Errorf("vault file '%s': %w", vaultPath, err)
+	if backupPath == "" {
+		return
+	}
+
+	logctx.LogStdErr(ctx, "Unable to read %v\n", err)
+
+	userResponse, lerr := input.AskUser(ctx, fmt.Sprintf("Please type 'y' to use the newest readable backup '%s'", backupPath), "")
+	if lerr != nil {
+		err = fmt.Errorf("%w (failed prompting for backup use: %w)", err, lerr)
+		return
+	}
+	if userResponse != "y" {
+		return
+	}
+
+	logctx.LogStdWarn(ctx, "Using vault backup '%s' (vault file is replaced on the next vault modification)\n", backupPath)
+	vault = backupVault
+	err = nil
+	return
+}
+
+// Checks vault file and its backups can be read without modifying anything
+func verifyVault(ctx context.Context, vaultPath string) (err error) {
+	vaultPassword, err := input.AskUserSecret(ctx, "Enter password for vault", "")
+	if err != nil {
+		return
+	}
+
+	vault, backupPath, _, vaultErr := inspectVault(vaultPath, vaultPassword)
+	if vaultErr != nil {
+		logctx.LogStdErr(ctx, "%s: %v\n", vaultPath, vaultErr)
+	} else {
+		logctx.LogStdInfo(ctx, "%s: OK (%d host entries)\n", vaultPath, len(vault))
+	}
+
+	for _, path := range vaultBackupPaths(vaultPath) {
+		backupVault, lerr := loadVaultFile(path, vaultPassword)
+		if os.IsNotExist(lerr) {
+			continue
+		} else if lerr != nil {
+			logctx.LogStdWarn(ctx, "%s: %v\n", path, lerr)
+			continue
+		}
+		logctx.LogStdInfo(ctx, "%s: OK (%d host entries)\n", path, len(backupVault))
+	}
+
+	if vaultErr != nil {
+		err = fmt.Errorf("vault file '%s' is not readable: %w", vaultPath, vaultErr)
+		if backupPath != "" {
+			err = fmt.Errorf("%w (newest readable backup is '%s')", err, backupPath)
+		}
+		return
+	}
+	return
+}
+
+// Writes encrypted vault to disk atomically, keeping the previous vault file as a rotated backup
+func writeVault(vaultPath string, lockedVault []byte) (err error) {
+	// Empty placeholder files are not worth keeping
+	currentVaultMeta, err := os.Stat(vaultPath)
+	if err == nil && currentVaultMeta.Size() > 0 {
+		err = rotateVaultBackups(vaultPath)
+		if err != nil {
+			err = fmt.Errorf("failed to back up current vault file: %w", err)
+			return
+		}
+	} else if err != nil && !os.IsNotExist(err) {
+		return
+	}
+
+	err = atomicWriteFile(vaultPath, lockedVault)
+	return
+}
+
+// Shifts existing backups down one position (dropping the oldest) and copies the current vault into the newest backup
+func rotateVaultBackups(vaultPath string) (err error) {
+	backupPaths := vaultBackupPaths(vaultPath)
+	for index := len(backupPaths) - 1; index > 0; index-- {
+		err = os.Rename(backupPaths[index-1], backupPaths[index])
+		if err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+
+	currentVault, err := os.ReadFile(vaultPath)
+	if err != nil {
+		return
+	}
+
+	err = atomicWriteFile(backupPaths[0], currentVault)
+	return
+}
+
+// Lists vault backup file paths, newest first
+func vaultBackupPaths(vaultPath string) (backupPaths []string) {
+	backupPaths = append(backupPaths, vaultPath+vaultBackupSuffix)
+	for index := 1; index < vaultBackupCount; index++ {
+		backupPaths = append(backupPaths, fmt.Sprintf("%s%s.%d", vaultPath, vaultBackupSuffix, index))
+	}
+	return
+}
+
+// Writes contents to a temporary file in the destination directory, flushes it to disk, then renames it over the destination
+func atomicWriteFile(path string, contents []byte) (err error) {
+	directory := filepath.Dir(path)
+
+	tempFile, err := os.CreateTemp(directory, filepath.Base(path)+vaultTempPattern)
+	if err != nil {
+		return
+	}
+	tempPath := tempFile.Name()
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tempPath)
+		}
+	}()
+
+	_, err = tempFile.Write(contents)
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	lerr := tempFile.Close()
+	if err == nil && lerr != nil {
+		err = lerr
+	}
+	if err != nil {
+		return
+	}
+
+	err = os.Rename(tempPath, path)
+	if err != nil {
+		return
+	}
+
+	// Flush directory entry so the rename survives power loss
+	parentDirectory, err := os.Open(directory)
+	if err != nil {
+		return
+	}
+	err = parentDirectory.Sync()
+	lerr = parentDirectory.Close()
+	if err == nil && lerr != nil {
+		err = lerr
+	}
+	return
+}
@@ -0,0 +1,120 @@
+package sshinternal
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Token bucket pacing uploads to one host, shared by every concurrent transfer to that host
+// Writes larger than the bucket are allowed and repaid by waiting (the bucket goes into debt)
+type BandwidthLimiter struct {
+	mutex       sync.Mutex
+	bytesPerSec float64
+	burst       float64 // Bucket size, one second of transfer
+	tokens      float64
+	last        time.Time
+	now         func() time.Time
+	sleep       func(ctx context.Context, duration time.Duration) (err error)
+}
+
+// Creates limiter for the given rate in KiB/s (nil when the rate is not positive, which never limits)
+func NewBandwidthLimiter(kibPerSec int) (limiter *BandwidthLimiter) {
+	if kibPerSec < 1 {
+		return
+	}
+	limiter = &BandwidthLimiter{
+		bytesPerSec: float64(kibPerSec) * 1024,
+		now:         time.Now,
+		sleep:       sleepContext,
+	}
+	limiter.burst = limiter.bytesPerSec
+	limiter.tokens = limiter.burst
+	limiter.last = limiter.now()
+	return
+}
+
+// Blocks until byteCount bytes may be sent
+func (limiter *BandwidthLimiter) wait(ctx context.Context, byteCount int) (err error) {
+	if limiter == nil {
+		return
+	}
+
+	limiter.mutex.Lock()
+	now := limiter.now()
+	limiter.tokens = min(limiter.burst, limiter.tokens+now.Sub(limiter.last).Seconds()*limiter.bytesPerSec)
+	limiter.last = now
+	limiter.tokens -= float64(byteCount)
+	deficit := -limiter.tokens
+	limiter.mutex.Unlock()
+
+	if deficit <= 0 {
+		return
+	}
+	err = limiter.sleep(ctx, time.Duration(deficit/limiter.bytesPerSec*float64(time.Second)))
+	return
+}
+
+// Wraps writer so every write waits for the limiter (writer is returned as is without a limiter)
+func (limiter *BandwidthLimiter) Writer(ctx context.Context, writer io.Writer) (limitedWriter io.Writer) {
+	if limiter == nil {
+		limitedWriter = writer
+		return
+	}
+	limitedWriter = &bandwidthWriter{ctx: ctx, writer: writer, limiter: limiter}
+	return
+}
+
+type bandwidthWriter struct {
+	ctx     context.Context
+	writer  io.Writer
+	limiter *BandwidthLimiter
+}
+
+func (limitedWriter *bandwidthWriter) Write(data []byte) (written int, err error) {
+	err = limitedWriter.limiter.wait(limitedWriter.ctx, len(data))
+	if err != nil {
+		return
+	}
+	written, err = limitedWriter.writer.Write(data)
+	return
+}
+
+// Wraps reader so every read waits for the limiter before returning (reader is returned as is without a limiter)
+func (limiter *BandwidthLimiter) Reader(ctx context.Context, reader io.Reader) (limitedReader io.Reader) {
+	if limiter == nil {
+		limitedReader = reader
+		return
+	}
+	limitedReader = &bandwidthReader{ctx: ctx, reader: reader, limiter: limiter}
+	return
+}
+
+type bandwidthReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *BandwidthLimiter
+}
+
+func (limitedReader *bandwidthReader) Read(data []byte) (read int, err error) {
+	read, err = limitedReader.reader.Read(data)
+	if read > 0 {
+		lerr := limitedReader.limiter.wait(limitedReader.ctx, read)
+		if lerr != nil {
+			err = lerr
+		}
+	}
+	return
+}
+
+func sleepContext(ctx context.Context, duration time.Duration) (err error) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
@@ -0,0 +1,144 @@
+package sshinternal
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Limiter on a fake clock that only advances while sleeping, returns the total time slept
+func newTestBandwidthLimiter(kibPerSec int) (limiter *BandwidthLimiter, slept *time.Duration) {
+	var clockMutex sync.Mutex
+	clock := time.Unix(0, 0)
+	slept = new(time.Duration)
+	limiter = NewBandwidthLimiter(kibPerSec)
+	limiter.now = func() time.Time {
+		clockMutex.Lock()
+		defer clockMutex.Unlock()
+		return clock
+	}
+	limiter.last = clock
+	limiter.sleep = func(ctx context.Context, duration time.Duration) (err error) {
+		clockMutex.Lock()
+		defer clockMutex.Unlock()
+		clock = clock.Add(duration)
+		*slept += duration
+		return
+	}
+	return
+}
+
+func TestBandwidthLimiterPacing(t *testing.T) {
+	ctx := context.Background()
+
+	limiter, slept := newTestBandwidthLimiter(10)
+	var output bytes.Buffer
+	writer := limiter.Writer(ctx, &output)
+
+	// First second of transfer is covered by the initial bucket
+	for range 10 {
+		_, err := writer.Write(make([]byte, 1024))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if *slept != 0 {
+		t.Errorf("expected burst without waiting, slept %v", *slept)
+	}
+
+	// Every further 10 KiB waits one second
+	for range 20 {
+		_, err := writer.Write(make([]byte, 1024))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if *slept != 2*time.Second {
+		t.Errorf("expected 2s of waiting, slept %v", *slept)
+	}
+	if output.Len() != 30*1024 {
+		t.Errorf("expected all data written, got %d bytes", output.Len())
+	}
+
+	// Writes larger than the bucket are repaid afterwards
+	_, err := writer.Write(make([]byte, 50*1024))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *slept != 7*time.Second {
+		t.Errorf("expected 7s of waiting, slept %v", *slept)
+	}
+}
+
+func TestBandwidthLimiterShared(t *testing.T) {
+	ctx := context.Background()
+
+	limiter, slept := newTestBandwidthLimiter(4)
+
+	// Concurrent transfers to one host draw from the same bucket
+	var wait sync.WaitGroup
+	for range 4 {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			var output bytes.Buffer
+			writer := limiter.Writer(ctx, &output)
+			for range 4 {
+				_, _ = writer.Write(make([]byte, 1024))
+			}
+		}()
+	}
+	wait.Wait()
+
+	if *slept < 3*time.Second {
+		t.Errorf("expected at least 3s of waiting for 16 KiB at 4 KiB/s, slept %v", *slept)
+	}
+}
+
+func TestBandwidthLimiterReader(t *testing.T) {
+	limiter, slept := newTestBandwidthLimiter(8)
+
+	// SCP uploads pace the content as it is read
+	readContent, err := io.ReadAll(limiter.Reader(context.Background(), bytes.NewReader(make([]byte, 24*1024))))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(readContent) != 24*1024 {
+		t.Errorf("expected all content read, got %d bytes", len(readContent))
+	}
+	if *slept != 2*time.Second {
+		t.Errorf("expected 2s of waiting, slept %v", *slept)
+	}
+}
+
+func TestBandwidthLimiterDisabled(t *testing.T) {
+	limiter := NewBandwidthLimiter(0)
+	if limiter != nil {
+		t.Fatalf("expected no limiter for a rate of 0")
+	}
+
+	var output bytes.Buffer
+	writer := limiter.Writer(context.Background(), &output)
+	if writer != &output {
+		t.Errorf("expected writer to be returned as is without a limiter")
+	}
+}
+
+func TestBandwidthLimiterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	limiter := NewBandwidthLimiter(1)
+	var output bytes.Buffer
+	writer := limiter.Writer(ctx, &output)
+	_, err := writer.Write(make([]byte, 4096))
+	if err != context.Canceled {
+		t.Errorf("expected canceled wait, got '%v'", err)
+	}
+	if output.Len() != 0 {
+		t.Errorf("expected nothing written after cancellation, got %d bytes", output.Len())
+	}
+}
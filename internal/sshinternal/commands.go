@@ -1,6 +1,8 @@
 package sshinternal
 
 import (
+	"encoding/hex"
+	"path"
 	"scmp/internal/str"
 	"strconv"
 	"strings"
@@ -9,6 +11,33 @@ import (
 // Constructors for remote SSH commands
 // Standardizes command names and their arguments
 
+// Wraps a single argument in single quotes for the remote shell (embedded single quotes cannot end the argument)
+func QuoteShellArg(arg string) (quoted string) {
+	quoted = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	return
+}
+
+// Runs user-supplied command text as a single argument to its own shell
+// Keeps SCMP prefixes (sudo, run-as user) separate from user content, so the entire command runs with the same privileges
+func BuildUserCommand(command string, timeout int) (remoteCommand RemoteCommand) {
+	const shellCmd string = "sh -c "
+	remoteCommand.Raw = shellCmd + QuoteShellArg(command)
+	remoteCommand.Timeout = timeout
+	return
+}
+
+// Runs the commands in order as one remote command (one round trip), stopping at the first failing step
+// The failing step prints its index on stderr and the batch exits with its status (see BatchStepError)
+func BuildBatch(commands ...RemoteCommand) (remoteCommand RemoteCommand) {
+	var steps []string
+	for index, command := range commands {
+		steps = append(steps, command.Raw+" || { status=$?; echo "+batchStepMarker+strconv.Itoa(index)+" >&2; exit $status; }")
+		remoteCommand.Timeout += command.Timeout
+	}
+	remoteCommand.Raw = "sh -c " + QuoteShellArg(strings.Join(steps, "\n"))
+	return
+}
+
 func BuildUnameKernel() (remoteCommand RemoteCommand) {
 	const unameCmd string = "uname -s"
 	remoteCommand.Raw = unameCmd
@@ -17,10 +46,19 @@ func BuildUnameKernel() (remoteCommand RemoteCommand) {
 	return
 }
 
+// Kernel name, release, and machine on the first three lines followed by os-release (if present)
+func BuildFactsGather() (remoteCommand RemoteCommand) {
+	const factsCmd string = "uname -s; uname -r; uname -m; cat /etc/os-release 2>/dev/null || true"
+	remoteCommand.Raw = factsCmd
+	remoteCommand.DisableSudo = true
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
 func BuildStat(remotePath str.RemotePath) (remoteCommand RemoteCommand) {
 	// Fixed output for extractMetadataFromStat function parsing
 	const statCmd string = "stat --format='[%n],[%F],[%U],[%G],[%a],[%s],[%N]' "
-	remoteCommand.Raw = statCmd + "'" + string(remotePath) + "'"
+	remoteCommand.Raw = statCmd + QuoteShellArg(string(remotePath))
 	remoteCommand.Timeout = DefaultRemoteCommandTimeout
 	return
 }
@@ -28,42 +66,119 @@ func BuildStat(remotePath str.RemotePath) (remoteCommand RemoteCommand) {
 func BuildBSDStat(remotePath str.RemotePath) (remoteCommand RemoteCommand) {
 	// Fixed output for extractMetadataFromStat function parsing
 	const statBsdCmd string = "stat -f '[%N],[%HT],[%Su],[%Sg],[%Lp],[%z],[target=%Y]' "
-	remoteCommand.Raw = statBsdCmd + "'" + string(remotePath) + "'"
+	remoteCommand.Raw = statBsdCmd + QuoteShellArg(string(remotePath))
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+// Same output as BuildStat for stat implementations without --format (BusyBox)
+func BuildBusyBoxStat(remotePath str.RemotePath) (remoteCommand RemoteCommand) {
+	const statBusyBoxCmd string = "stat -c '[%n],[%F],[%U],[%G],[%a],[%s],[%N]' "
+	remoteCommand.Raw = statBusyBoxCmd + QuoteShellArg(string(remotePath))
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+// Hashes the path only when it is a regular file, printing nothing otherwise
+func buildHashIfFile(hashCmd string, remotePath str.RemotePath) (remoteCommand RemoteCommand) {
+	quotedPath := QuoteShellArg(string(remotePath))
+	remoteCommand.Raw = "if [ -f " + quotedPath + " ]; then " + hashCmd + " " + quotedPath + "; fi"
+	remoteCommand.Timeout = 90
+	return
+}
+
+// Prints one line per finding: "missing <command>" for absent required commands, "stat <variant>", and "hash <command>"
+// Variants are tried in preference order, a missing line means no usable variant was found
+func BuildUtilitiesProbe() (remoteCommand RemoteCommand) {
+	var probe strings.Builder
+	probe.WriteString("for tool in " + strings.Join(RequiredUtilities, " ") + "; do command -v \"$tool\" >/dev/null 2>&1 || echo \"missing $tool\"; done; ")
+	probe.WriteString("if stat --version 2>/dev/null | grep -q -e GNU -e coreutils; then echo 'stat " + StatGNU + "'; ")
+	probe.WriteString("elif stat -c %n / >/dev/null 2>&1; then echo 'stat " + StatBusyBox + "'; ")
+	probe.WriteString("elif stat -f %N / >/dev/null 2>&1; then echo 'stat " + StatBSD + "'; fi; ")
+	probe.WriteString("if command -v sha256sum >/dev/null 2>&1; then echo 'hash " + HashSha256sum + "'; ")
+	probe.WriteString("elif command -v shasum >/dev/null 2>&1; then echo 'hash " + HashShasum + "'; ")
+	probe.WriteString("elif command -v sha256 >/dev/null 2>&1; then echo 'hash " + HashSha256 + "'; fi")
+	remoteCommand.Raw = probe.String()
+	remoteCommand.DisableSudo = true
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+// Succeeds only when the command prefix (sudo with or without password) is usable
+// Runs through sh, which restricted sudo rules already permit
+func BuildSudoCheck() (remoteCommand RemoteCommand) {
+	remoteCommand.Raw = "sh -c true"
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+// Prints the df line (POSIX format, 1024-byte blocks) of the filesystem holding each path, one line per path in order
+// Missing paths use their nearest existing parent directory
+func BuildDiskFree(remotePaths ...str.RemotePath) (remoteCommand RemoteCommand) {
+	var quotedPaths []string
+	for _, remotePath := range remotePaths {
+		quotedPaths = append(quotedPaths, QuoteShellArg(string(remotePath)))
+	}
+	dfScript := "for dir in " + strings.Join(quotedPaths, " ") + "; do " +
+		`while [ ! -d "$dir" ]; do dir=$(dirname "$dir"); done; ` +
+		`usage=$(df -Pk "$dir") || exit 1; printf '%s\n' "$usage" | tail -n 1; done`
+	remoteCommand.Raw = "sh -c " + QuoteShellArg(dfScript)
 	remoteCommand.Timeout = DefaultRemoteCommandTimeout
 	return
 }
 
 func BuildLs(remotePath str.RemotePath) (remoteCommand RemoteCommand) {
 	const lsCmd string = "ls -A "
-	remoteCommand.Raw = lsCmd + "'" + string(remotePath) + "'"
+	remoteCommand.Raw = lsCmd + QuoteShellArg(string(remotePath))
 	remoteCommand.Timeout = DefaultRemoteCommandTimeout
 	return
 }
 
 func BuildLsList(remotePath str.RemotePath) (remoteCommand RemoteCommand) {
 	const lsNamesCmd string = "ls -1AF "
-	remoteCommand.Raw = lsNamesCmd + "'" + string(remotePath) + "'"
+	remoteCommand.Raw = lsNamesCmd + QuoteShellArg(string(remotePath))
 	remoteCommand.Timeout = 15
 	return
 }
 
-func BuildHashCmd(remotePath str.RemotePath) (remoteCommand RemoteCommand) {
-	const hashCmd string = "sha256sum "
-	remoteCommand.Raw = hashCmd + "'" + string(remotePath) + "'"
+// Regular files below a directory, one path per line
+func BuildFindFiles(remotePath str.RemotePath) (remoteCommand RemoteCommand) {
+	const findCmd string = "find "
+	remoteCommand.Raw = findCmd + QuoteShellArg(string(remotePath)) + " -type f"
+	remoteCommand.Timeout = 90
+	return
+}
+
+func buildHashCmd(hashCmd string, remotePath str.RemotePath) (remoteCommand RemoteCommand) {
+	remoteCommand.Raw = hashCmd + " " + QuoteShellArg(string(remotePath))
+	remoteCommand.Timeout = 90
+	return
+}
+
+// Hashes only the leading bytes of a file (for comparing partially transferred files)
+func buildPartialHashCmd(hashCmd string, remotePath str.RemotePath, length int64) (remoteCommand RemoteCommand) {
+	remoteCommand.Raw = "head -c " + strconv.FormatInt(length, 10) + " " + QuoteShellArg(string(remotePath)) + " | " + hashCmd
+	remoteCommand.Timeout = 900
+	return
+}
+
+func BuildCat(remotePath str.RemotePath) (remoteCommand RemoteCommand) {
+	const catCmd string = "cat "
+	remoteCommand.Raw = catCmd + QuoteShellArg(string(remotePath))
 	remoteCommand.Timeout = 90
 	return
 }
 
 func BuildMv(srcRemotePath str.RemotePath, dstRemotePath str.RemotePath) (remoteCommand RemoteCommand) {
 	const mvCmd string = "mv "
-	remoteCommand.Raw = mvCmd + "'" + string(srcRemotePath) + "' '" + string(dstRemotePath) + "'"
+	remoteCommand.Raw = mvCmd + QuoteShellArg(string(srcRemotePath)) + " " + QuoteShellArg(string(dstRemotePath))
 	remoteCommand.Timeout = 90
 	return
 }
 
 func BuildCp(srcRemotePath str.RemotePath, dstRemotePath str.RemotePath) (remoteCommand RemoteCommand) {
 	const cpCmd string = "cp -p "
-	remoteCommand.Raw = cpCmd + "'" + string(srcRemotePath) + "' '" + string(dstRemotePath) + "'"
+	remoteCommand.Raw = cpCmd + QuoteShellArg(string(srcRemotePath)) + " " + QuoteShellArg(string(dstRemotePath))
 	remoteCommand.Timeout = 90
 	return
 }
@@ -73,7 +188,7 @@ func BuildMkdir(remotePaths ...str.RemotePath) (remoteCommand RemoteCommand) {
 
 	var requestedPaths []string
 	for _, remotePath := range remotePaths {
-		requestedPaths = append(requestedPaths, "'"+string(remotePath)+"'")
+		requestedPaths = append(requestedPaths, QuoteShellArg(string(remotePath)))
 	}
 	dirsToCreate := strings.Join(requestedPaths, " ")
 
@@ -87,11 +202,11 @@ func BuildChown(ownerGroup string, remotePaths ...str.RemotePath) (remoteCommand
 
 	var requestedPaths []string
 	for _, remotePath := range remotePaths {
-		requestedPaths = append(requestedPaths, "'"+string(remotePath)+"'")
+		requestedPaths = append(requestedPaths, QuoteShellArg(string(remotePath)))
 	}
 	itemsToChown := strings.Join(requestedPaths, " ")
 
-	remoteCommand.Raw = chownCmd + "'" + ownerGroup + "' " + itemsToChown
+	remoteCommand.Raw = chownCmd + QuoteShellArg(ownerGroup) + " " + itemsToChown
 	remoteCommand.Timeout = 20
 	return
 }
@@ -102,18 +217,78 @@ func BuildChmod(permissionBits int, remotePaths ...str.RemotePath) (remoteComman
 
 	var requestedPaths []string
 	for _, remotePath := range remotePaths {
-		requestedPaths = append(requestedPaths, "'"+string(remotePath)+"'")
+		requestedPaths = append(requestedPaths, QuoteShellArg(string(remotePath)))
 	}
 	itemsToChmod := strings.Join(requestedPaths, " ")
 
-	remoteCommand.Raw = chmodCmd + "'" + permissionString + "' " + itemsToChmod
+	remoteCommand.Raw = chmodCmd + QuoteShellArg(permissionString) + " " + itemsToChmod
 	remoteCommand.Timeout = 20
 	return
 }
 
+// Adds extended ACL entries, entries are comma joined as setfacl expects
+func BuildSetfacl(entries []string, remotePath str.RemotePath) (remoteCommand RemoteCommand) {
+	const setfaclCmd string = "setfacl -m "
+	remoteCommand.Raw = setfaclCmd + QuoteShellArg(strings.Join(entries, ",")) + " " + QuoteShellArg(string(remotePath))
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+// Extended ACL entries only, for parsing by ExtractACLEntries
+func BuildGetfacl(remotePath str.RemotePath) (remoteCommand RemoteCommand) {
+	const getfaclCmd string = "getfacl --omit-header --absolute-names --no-effective --skip-base "
+	remoteCommand.Raw = getfaclCmd + QuoteShellArg(string(remotePath))
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+func BuildChcon(securityContext string, remotePath str.RemotePath) (remoteCommand RemoteCommand) {
+	const chconCmd string = "chcon "
+	remoteCommand.Raw = chconCmd + QuoteShellArg(securityContext) + " " + QuoteShellArg(string(remotePath))
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+// SELinux context of a path ("?" when the host has none)
+func BuildStatContext(remotePath str.RemotePath) (remoteCommand RemoteCommand) {
+	const statContextCmd string = "stat --format='%C' "
+	remoteCommand.Raw = statContextCmd + QuoteShellArg(string(remotePath))
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+// Sets one extended attribute, the value is hex encoded so any bytes survive the shell
+func BuildSetfattr(name string, value string, remotePath str.RemotePath) (remoteCommand RemoteCommand) {
+	const setfattrCmd string = "setfattr -n "
+	remoteCommand.Raw = setfattrCmd + QuoteShellArg(name)
+	if value != "" {
+		remoteCommand.Raw += " -v 0x" + hex.EncodeToString([]byte(value))
+	}
+	remoteCommand.Raw += " " + QuoteShellArg(string(remotePath))
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+// User and trusted extended attributes with hex values, for parsing by ExtractXattrs
+func BuildGetfattr(remotePath str.RemotePath) (remoteCommand RemoteCommand) {
+	const getfattrCmd string = "getfattr --absolute-names -d -e hex -m '^(user|trusted)\\.' "
+	remoteCommand.Raw = getfattrCmd + QuoteShellArg(string(remotePath))
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+// Succeeds only when both extended attribute tools are installed
+func BuildXattrToolsCheck() (remoteCommand RemoteCommand) {
+	const checkCmd string = "command -v setfattr >/dev/null && command -v getfattr >/dev/null"
+	remoteCommand.Raw = checkCmd
+	remoteCommand.DisableSudo = true
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
 func BuildRm(remotePath str.RemotePath) (remoteCommand RemoteCommand) {
 	const rmCmd string = "rm "
-	remoteCommand.Raw = rmCmd + "'" + string(remotePath) + "'"
+	remoteCommand.Raw = rmCmd + QuoteShellArg(string(remotePath))
 	remoteCommand.Timeout = 15
 	return
 }
@@ -124,7 +299,7 @@ func BuildRmAll(remotePaths ...str.RemotePath) (remoteCommand RemoteCommand) {
 	// Concat variable input paths together
 	var requestedPaths []string
 	for _, remotePath := range remotePaths {
-		requestedPaths = append(requestedPaths, "'"+string(remotePath)+"'")
+		requestedPaths = append(requestedPaths, QuoteShellArg(string(remotePath)))
 	}
 	itemsToRemove := strings.Join(requestedPaths, " ")
 
@@ -135,21 +310,169 @@ func BuildRmAll(remotePaths ...str.RemotePath) (remoteCommand RemoteCommand) {
 
 func BuildRmdir(remotePath str.RemotePath) (remoteCommand RemoteCommand) {
 	const rmdirCmd string = "rmdir "
-	remoteCommand.Raw = rmdirCmd + "'" + string(remotePath) + "'"
+	remoteCommand.Raw = rmdirCmd + QuoteShellArg(string(remotePath))
 	remoteCommand.Timeout = DefaultRemoteCommandTimeout
 	return
 }
 
-func BuildLink(linkTarget str.RemotePath, linkName str.RemotePath) (remoteCommand RemoteCommand) {
-	const lnCmd string = "ln -snf "
-	remoteCommand.Raw = lnCmd + "'" + string(linkTarget) + "' '" + string(linkName) + "'"
+// Creates the link beside its name and renames it over whatever is there, so the path never goes missing
+// The rename never follows an existing link to a directory (-T on Linux, -h on BSD)
+func BuildLink(linkTarget str.RemotePath, linkName str.RemotePath, osFamily string) (remoteCommand RemoteCommand) {
+	noFollowFlag := "-T"
+	if osFamily == "bsd" {
+		noFollowFlag = "-h"
+	}
+
+	stagedLink := path.Join(path.Dir(string(linkName)), "."+path.Base(string(linkName))+StagedFileSuffix)
+	linkScript := "staged=" + QuoteShellArg(stagedLink) + "; " +
+		`rm -f "$staged" && ln -s ` + QuoteShellArg(string(linkTarget)) + ` "$staged" || exit 1; ` +
+		`mv -f ` + noFollowFlag + ` "$staged" ` + QuoteShellArg(string(linkName)) + ` || { rm -f "$staged"; exit 1; }`
+	remoteCommand.Raw = "sh -c " + QuoteShellArg(linkScript)
 	remoteCommand.Timeout = DefaultRemoteCommandTimeout
 	return
 }
 
 func BuildTouch(remotePath str.RemotePath) (remoteCommand RemoteCommand) {
 	const touchCmd string = "touch"
-	remoteCommand.Raw = touchCmd + " '" + string(remotePath) + "'"
+	remoteCommand.Raw = touchCmd + " " + QuoteShellArg(string(remotePath))
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+// Atomically creates the lock directory (mkdir fails when it exists) and records the owner with the remote time
+// Prints "acquired" and the recorded owner line, or "held", the remote time, and the current owner line
+func BuildLockAcquire(lockPath str.RemotePath, owner string) (remoteCommand RemoteCommand) {
+	lockScript := "lock=" + QuoteShellArg(string(lockPath)) + "; " +
+		`if mkdir "$lock" 2>/dev/null; then ` +
+		`owner=` + QuoteShellArg(owner) + `" time=$(date +%s)"; ` +
+		`printf '%s\n' "$owner" > "$lock/owner" || { rm -rf "$lock"; exit 1; }; ` +
+		`echo acquired; printf '%s\n' "$owner"; ` +
+		`else echo held; date +%s; cat "$lock/owner" 2>/dev/null; fi`
+	remoteCommand.Raw = "sh -c " + QuoteShellArg(lockScript)
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+// Prints "installed" when the marker file holds the given identity, "missing" otherwise
+func BuildInstallMarkerCheck(markerPath str.RemotePath, identity string) (remoteCommand RemoteCommand) {
+	checkScript := `if [ "$(cat ` + QuoteShellArg(string(markerPath)) + ` 2>/dev/null)" = ` + QuoteShellArg(identity) + ` ]; then echo installed; else echo missing; fi`
+	remoteCommand.Raw = "sh -c " + QuoteShellArg(checkScript)
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+// Writes the identity into the marker file through a rename, so the marker is either absent or complete
+func BuildInstallMarkerWrite(markerPath str.RemotePath, identity string) (remoteCommand RemoteCommand) {
+	writeScript := "marker=" + QuoteShellArg(string(markerPath)) + "; " +
+		`mkdir -p "$(dirname "$marker")" && chmod 755 "$(dirname "$marker")" && ` +
+		`printf '%s\n' ` + QuoteShellArg(identity) + ` > "$marker.tmp.$$" && ` +
+		`mv -f "$marker.tmp.$$" "$marker" || { rm -f "$marker.tmp.$$"; exit 1; }`
+	remoteCommand.Raw = "sh -c " + QuoteShellArg(writeScript)
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+// Removes the lock directory only while it still records the given owner line, prints "not held" otherwise
+func BuildLockRemove(lockPath str.RemotePath, ownerLine string) (remoteCommand RemoteCommand) {
+	lockScript := "lock=" + QuoteShellArg(string(lockPath)) + "; " +
+		`if [ "$(cat "$lock/owner" 2>/dev/null)" = ` + QuoteShellArg(ownerLine) + ` ]; then rm -rf "$lock"; ` +
+		`else echo 'not held'; fi`
+	remoteCommand.Raw = "sh -c " + QuoteShellArg(lockScript)
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+// Prints the passwd entry of the user, nothing (and success) when the user does not exist
+func BuildGetentPasswd(name string) (remoteCommand RemoteCommand) {
+	getentScript := "getent passwd " + QuoteShellArg(name) + ` || [ $? -eq 2 ]`
+	remoteCommand.Raw = "sh -c " + QuoteShellArg(getentScript)
+	remoteCommand.DisableSudo = true
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+// Prints the group entry of the group, nothing (and success) when the group does not exist
+func BuildGetentGroup(name string) (remoteCommand RemoteCommand) {
+	getentScript := "getent group " + QuoteShellArg(name) + ` || [ $? -eq 2 ]`
+	remoteCommand.Raw = "sh -c " + QuoteShellArg(getentScript)
+	remoteCommand.DisableSudo = true
 	remoteCommand.Timeout = DefaultRemoteCommandTimeout
 	return
 }
+
+// GID of 0 lets the host choose
+func BuildGroupadd(name string, gid int, system bool) (remoteCommand RemoteCommand) {
+	const groupaddCmd string = "groupadd"
+	remoteCommand.Raw = groupaddCmd
+	if gid > 0 {
+		remoteCommand.Raw += " -g " + strconv.Itoa(gid)
+	}
+	if system {
+		remoteCommand.Raw += " -r"
+	}
+	remoteCommand.Raw += " " + QuoteShellArg(name)
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+func BuildGroupmod(name string, gid int) (remoteCommand RemoteCommand) {
+	const groupmodCmd string = "groupmod -g "
+	remoteCommand.Raw = groupmodCmd + strconv.Itoa(gid) + " " + QuoteShellArg(name)
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+func BuildGroupdel(name string) (remoteCommand RemoteCommand) {
+	const groupdelCmd string = "groupdel "
+	remoteCommand.Raw = groupdelCmd + QuoteShellArg(name)
+	remoteCommand.Timeout = DefaultRemoteCommandTimeout
+	return
+}
+
+// Empty (or 0) options are left to the host defaults, a given home directory is created
+func BuildUseradd(name string, uid int, group string, home string, shell string, system bool) (remoteCommand RemoteCommand) {
+	const useraddCmd string = "useradd"
+	remoteCommand.Raw = useraddCmd + userOptions(uid, group, home, shell)
+	if home != "" {
+		remoteCommand.Raw += " -m"
+	}
+	if system {
+		remoteCommand.Raw += " -r"
+	}
+	remoteCommand.Raw += " " + QuoteShellArg(name)
+	remoteCommand.Timeout = 30
+	return
+}
+
+// Only given options are changed, an existing home directory is not moved
+func BuildUsermod(name string, uid int, group string, home string, shell string) (remoteCommand RemoteCommand) {
+	const usermodCmd string = "usermod"
+	remoteCommand.Raw = usermodCmd + userOptions(uid, group, home, shell) + " " + QuoteShellArg(name)
+	remoteCommand.Timeout = 30
+	return
+}
+
+// Home directory and mail spool are kept
+func BuildUserdel(name string) (remoteCommand RemoteCommand) {
+	const userdelCmd string = "userdel "
+	remoteCommand.Raw = userdelCmd + QuoteShellArg(name)
+	remoteCommand.Timeout = 30
+	return
+}
+
+// Options shared by useradd and usermod
+func userOptions(uid int, group string, home string, shell string) (options string) {
+	if uid > 0 {
+		options += " -u " + strconv.Itoa(uid)
+	}
+	if group != "" {
+		options += " -g " + QuoteShellArg(group)
+	}
+	if home != "" {
+		options += " -d " + QuoteShellArg(home)
+	}
+	if shell != "" {
+		options += " -s " + QuoteShellArg(shell)
+	}
+	return
+}
@@ -0,0 +1,373 @@
+package sshinternal
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"scmp/internal/str"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestQuoteShellArgInjection(t *testing.T) {
+	markerFile := filepath.Join(t.TempDir(), "injected")
+
+	payloads := []string{
+		"root:root; touch " + markerFile,
+		"root:root' ; touch " + markerFile + " ; '",
+		"$(touch " + markerFile + ")",
+		"`touch " + markerFile + "`",
+		"file\ntouch " + markerFile,
+		"a'\\''b && touch " + markerFile,
+	}
+
+	for _, payload := range payloads {
+		// Payload must come back from the shell as exactly one unmodified argument
+		output, err := exec.Command("sh", "-c", "printf '%s|' "+QuoteShellArg(payload)).Output()
+		if err != nil {
+			t.Fatalf("payload '%s': shell failed: %v", payload, err)
+		}
+		if string(output) != payload+"|" {
+			t.Errorf("payload '%s': expected single argument, got '%s'", payload, output)
+		}
+
+		_, err = os.Stat(markerFile)
+		if err == nil {
+			t.Fatalf("payload '%s' was executed by the shell", payload)
+		}
+	}
+}
+
+func TestBuildUserCommand(t *testing.T) {
+	command := BuildUserCommand("echo first; echo 'second'", 5)
+	if !strings.HasPrefix(command.Raw, "sh -c ") {
+		t.Fatalf("expected command to run in its own shell, got '%s'", command.Raw)
+	}
+
+	// Entire user command runs inside the wrapped shell (as if behind a sudo prefix)
+	output, err := exec.Command("sh", "-c", "env "+command.Raw).Output()
+	if err != nil {
+		t.Fatalf("command failed: %v", err)
+	}
+	if string(output) != "first\nsecond\n" {
+		t.Errorf("expected both commands inside wrapped shell, got '%s'", output)
+	}
+}
+
+func TestBuildBatch(t *testing.T) {
+	markerFile := filepath.Join(t.TempDir(), "after failure")
+	batch := []RemoteCommand{
+		{Raw: "echo first", Timeout: 5},
+		BuildUserCommand("echo 'second failed' >&2; exit 3", 10),
+		BuildTouch(str.RemotePath(markerFile)),
+	}
+	command := BuildBatch(batch...)
+	if command.Timeout != 5+10+DefaultRemoteCommandTimeout {
+		t.Errorf("expected timeout to cover all steps, got %d", command.Timeout)
+	}
+
+	var stdout, stderr strings.Builder
+	shell := exec.Command("sh", "-c", command.Raw)
+	shell.Stdout = &stdout
+	shell.Stderr = &stderr
+	err := shell.Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("expected batch to exit with the status of the failed step, got %v", err)
+	}
+	if stdout.String() != "first\n" {
+		t.Errorf("expected output of steps before the failure, got '%s'", stdout.String())
+	}
+	if _, err := os.Stat(markerFile); err == nil {
+		t.Errorf("expected steps after the failure to be skipped")
+	}
+
+	// Failure of the batch is reported as failure of the step
+	batchErr := &CommandError{Command: command.Raw, ExitCode: 3, Output: strings.TrimSpace(stderr.String()), Err: errors.New("exit status 3")}
+	step, stepErr := BatchStepError(batch, batchErr)
+	var commandErr *CommandError
+	if step != 1 || !errors.As(stepErr, &commandErr) {
+		t.Fatalf("expected second step to fail, got step %d: %v", step, stepErr)
+	}
+	if commandErr.Command != batch[1].Raw || commandErr.Output != "second failed" || commandErr.ExitCode != 3 {
+		t.Errorf("unexpected step failure: %+v", commandErr)
+	}
+
+	// Failures outside the steps are returned unchanged
+	sessionErr := &CommandError{Command: command.Raw, ExitCode: ExitCodeNone, Err: errors.New("connection lost")}
+	step, stepErr = BatchStepError(batch, sessionErr)
+	if step != -1 || stepErr != sessionErr {
+		t.Errorf("expected no failed step, got step %d: %v", step, stepErr)
+	}
+	step, stepErr = BatchStepError(batch, nil)
+	if step != -1 || stepErr != nil {
+		t.Errorf("expected no failed step for success, got step %d: %v", step, stepErr)
+	}
+}
+
+func TestBuildLock(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), ".scmp-deploy.lock")
+	owner := "controller=ops01 user=o'brien pid=42"
+
+	runLock := func(command RemoteCommand) (output string) {
+		result, err := exec.Command("sh", "-c", command.Raw).Output()
+		if err != nil {
+			t.Fatalf("lock command failed: %v", err)
+		}
+		output = string(result)
+		return
+	}
+
+	output := runLock(BuildLockAcquire(str.RemotePath(lockPath), owner))
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 2 || lines[0] != "acquired" || !strings.HasPrefix(lines[1], owner+" time=") {
+		t.Fatalf("expected lock to be acquired, got '%s'", output)
+	}
+	ownerLine := lines[1]
+
+	// Second attempt sees the current owner
+	output = runLock(BuildLockAcquire(str.RemotePath(lockPath), "controller=ops02 user=other pid=7"))
+	lines = strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 3 || lines[0] != "held" || lines[2] != ownerLine {
+		t.Fatalf("expected lock to be held by first owner, got '%s'", output)
+	}
+
+	// Only the recorded owner removes the lock
+	output = runLock(BuildLockRemove(str.RemotePath(lockPath), "controller=ops02 user=other pid=7 time=1"))
+	if strings.TrimSpace(output) != "not held" {
+		t.Errorf("expected other owner to be refused, got '%s'", output)
+	}
+	if _, err := os.Stat(lockPath); err != nil {
+		t.Fatalf("expected lock to remain: %v", err)
+	}
+
+	output = runLock(BuildLockRemove(str.RemotePath(lockPath), ownerLine))
+	if output != "" {
+		t.Errorf("unexpected remove output '%s'", output)
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("expected lock to be removed, got %v", err)
+	}
+}
+
+func TestBuildDiskFree(t *testing.T) {
+	directory := t.TempDir()
+	paths := []str.RemotePath{str.RemotePath(directory), str.RemotePath(filepath.Join(directory, "missing", "it's", "deeper"))}
+
+	output, err := exec.Command("sh", "-c", BuildDiskFree(paths...).Raw).Output()
+	if err != nil {
+		t.Fatalf("df command failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) != len(paths) {
+		t.Fatalf("expected one line per path, got '%s'", output)
+	}
+	for _, line := range lines {
+		if len(strings.Fields(line)) < 6 {
+			t.Fatalf("expected POSIX df line, got '%s'", line)
+		}
+	}
+	// Missing directories report the filesystem of their existing parent
+	firstFields, secondFields := strings.Fields(lines[0]), strings.Fields(lines[1])
+	if firstFields[len(firstFields)-1] != secondFields[len(secondFields)-1] {
+		t.Errorf("expected the same filesystem for both paths, got '%s' and '%s'", lines[0], lines[1])
+	}
+}
+
+func TestBuildInstallMarker(t *testing.T) {
+	markerPath := filepath.Join(t.TempDir(), "installed", "abc123")
+	identity := "abc123"
+
+	runMarker := func(command RemoteCommand) (output string) {
+		result, err := exec.Command("sh", "-c", command.Raw).Output()
+		if err != nil {
+			t.Fatalf("marker command failed: %v", err)
+		}
+		output = strings.TrimSpace(string(result))
+		return
+	}
+
+	output := runMarker(BuildInstallMarkerCheck(str.RemotePath(markerPath), identity))
+	if output != "missing" {
+		t.Fatalf("expected missing marker, got '%s'", output)
+	}
+
+	// Directory is created as needed and no temporary file is left behind
+	runMarker(BuildInstallMarkerWrite(str.RemotePath(markerPath), identity))
+	entries, err := os.ReadDir(filepath.Dir(markerPath))
+	if err != nil {
+		t.Fatalf("failed reading marker directory: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != filepath.Base(markerPath) {
+		t.Errorf("expected only the marker file, got %v", entries)
+	}
+
+	output = runMarker(BuildInstallMarkerCheck(str.RemotePath(markerPath), identity))
+	if output != "installed" {
+		t.Errorf("expected installed marker, got '%s'", output)
+	}
+
+	// Markers holding anything else (like a partial write) do not count
+	err = os.WriteFile(markerPath, []byte("abc"), 0644)
+	if err != nil {
+		t.Fatalf("failed writing marker: %v", err)
+	}
+	output = runMarker(BuildInstallMarkerCheck(str.RemotePath(markerPath), identity))
+	if output != "missing" {
+		t.Errorf("expected mismatched marker to be missing, got '%s'", output)
+	}
+}
+
+func TestBuildLink(t *testing.T) {
+	directory := t.TempDir()
+	linkName := filepath.Join(directory, "current")
+	oldTarget := filepath.Join(directory, "release-1")
+	newTarget := filepath.Join(directory, "release-2")
+	for _, target := range []string{oldTarget, newTarget} {
+		err := os.Mkdir(target, 0755)
+		if err != nil {
+			t.Fatalf("failed creating link target: %v", err)
+		}
+	}
+
+	runLink := func(linkTarget string) {
+		output, err := exec.Command("sh", "-c", BuildLink(str.RemotePath(linkTarget), str.RemotePath(linkName), "linux").Raw).CombinedOutput()
+		if err != nil {
+			t.Fatalf("link command failed: %v: %s", err, output)
+		}
+	}
+
+	runLink(oldTarget)
+
+	// Links to directories are replaced, not followed into the directory
+	runLink(newTarget)
+	target, err := os.Readlink(linkName)
+	if err != nil {
+		t.Fatalf("expected a link: %v", err)
+	}
+	if target != newTarget {
+		t.Errorf("expected link to '%s', got '%s'", newTarget, target)
+	}
+	entries, err := os.ReadDir(oldTarget)
+	if err != nil {
+		t.Fatalf("failed reading old target: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected old link target to stay empty, got %v", entries)
+	}
+
+	// No staged link is left behind
+	entries, err = os.ReadDir(directory)
+	if err != nil {
+		t.Fatalf("failed reading link directory: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("expected only the link and its targets, got %v", entries)
+	}
+
+	// Removing the link leaves its target alone
+	err = exec.Command("sh", "-c", BuildRm(str.RemotePath(linkName)).Raw).Run()
+	if err != nil {
+		t.Fatalf("rm command failed: %v", err)
+	}
+	if _, err = os.Lstat(linkName); !os.IsNotExist(err) {
+		t.Errorf("expected link to be removed, got %v", err)
+	}
+	if _, err = os.Stat(newTarget); err != nil {
+		t.Errorf("expected link target to remain: %v", err)
+	}
+}
+
+func TestBuildAccountCommands(t *testing.T) {
+	command := BuildUseradd("app", 901, "app", "/srv/app", "/usr/sbin/nologin", true)
+	if command.Raw != "useradd -u 901 -g 'app' -d '/srv/app' -s '/usr/sbin/nologin' -m -r 'app'" {
+		t.Errorf("unexpected useradd command '%s'", command.Raw)
+	}
+	command = BuildUseradd("app", 0, "", "", "", false)
+	if command.Raw != "useradd 'app'" {
+		t.Errorf("expected host defaults for unset options, got '%s'", command.Raw)
+	}
+	command = BuildUsermod("app", 0, "", "", "/bin/sh")
+	if command.Raw != "usermod -s '/bin/sh' 'app'" {
+		t.Errorf("expected only changed options, got '%s'", command.Raw)
+	}
+	command = BuildGroupadd("app", 901, true)
+	if command.Raw != "groupadd -g 901 -r 'app'" {
+		t.Errorf("unexpected groupadd command '%s'", command.Raw)
+	}
+
+	_, err := exec.LookPath("getent")
+	if err != nil {
+		t.Skip("getent is not available")
+	}
+
+	// Missing users are not an error, only empty output
+	output, err := exec.Command("sh", "-c", BuildGetentPasswd("scmp-missing-user").Raw).Output()
+	if err != nil || len(output) != 0 {
+		t.Errorf("expected empty success for a missing user, got '%s': %v", output, err)
+	}
+	output, err = exec.Command("sh", "-c", BuildGetentGroup("root").Raw).Output()
+	if err != nil || !strings.HasPrefix(string(output), "root:") {
+		t.Errorf("expected group entry of root, got '%s': %v", output, err)
+	}
+}
+
+func TestBuildUtilitiesProbe(t *testing.T) {
+	output, err := exec.Command("sh", "-c", BuildUtilitiesProbe().Raw).Output()
+	if err != nil {
+		t.Fatalf("probe command failed: %v", err)
+	}
+	utilities := ParseUtilitiesProbe(string(output))
+	if utilities.Stat == "" || utilities.Hash == "" || len(utilities.MissingCommands()) > 0 {
+		t.Fatalf("expected every utility on the test system, got %+v", utilities)
+	}
+
+	utilities = ParseUtilitiesProbe("missing chown\r\nstat busybox\n")
+	expected := []string{"chown", "sha256sum (or shasum, sha256)"}
+	if utilities.Stat != StatBusyBox || !slices.Equal(utilities.MissingCommands(), expected) {
+		t.Errorf("expected busybox stat and missing %v, got %+v (missing %v)", expected, utilities, utilities.MissingCommands())
+	}
+}
+
+func TestBuildHostStatVariants(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(target, []byte("content"), 0640)
+	if err != nil {
+		t.Fatalf("failed writing file: %v", err)
+	}
+
+	// GNU stat also accepts -c, both variants must parse to the same metadata
+	var parsed []RemoteFileInfo
+	for _, variant := range []string{StatGNU, StatBusyBox} {
+		host := HostMeta{Utilities: RemoteUtilities{Probed: true, Stat: variant, Hash: HashSha256sum}}
+		command, err := BuildHostStat(host, str.RemotePath(target))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", variant, err)
+		}
+		output, err := exec.Command("sh", "-c", command.Raw).Output()
+		if err != nil {
+			t.Fatalf("%s: stat command failed: %v", variant, err)
+		}
+		info, err := ExtractMetadataFromStat(string(output))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", variant, err)
+		}
+		parsed = append(parsed, info)
+	}
+	if parsed[0] != parsed[1] || parsed[0].Permissions != 640 {
+		t.Errorf("expected identical metadata with permissions 640, got %+v and %+v", parsed[0], parsed[1])
+	}
+
+	_, err = BuildHostStat(HostMeta{Utilities: RemoteUtilities{Probed: true}}, str.RemotePath(target))
+	if err == nil {
+		t.Errorf("expected error for host without a stat variant")
+	}
+	if command := BuildHostHash(HostMeta{Utilities: RemoteUtilities{Hash: HashShasum}}, "/etc/hosts"); command.Raw != "shasum -a 256 '/etc/hosts'" {
+		t.Errorf("unexpected hash command '%s'", command.Raw)
+	}
+	if command := BuildHostHash(HostMeta{}, "/etc/hosts"); command.Raw != "sha256sum '/etc/hosts'" {
+		t.Errorf("unexpected hash command '%s'", command.Raw)
+	}
+}
@@ -1,5 +1,12 @@
 package sshinternal
 
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
 const (
 	DefaultConfigPath string = "~/.ssh/config"          // Default to users home directory ssh config file
 	KnownHostsFile    string = "known_hosts"            // File name for ssh known hosts (same directory as ssh config)
@@ -7,8 +14,118 @@ const (
 	MaxSSHConnections int    = 10                       // Maximum simultaneous outbound SSH connections
 	MaxSSHChannels    int    = 4                        // Maximum simultaneous SSH channels per SSH connection
 
+	// Persistent connections (controller connect --persist)
+	DefaultControlDirName     string        = "scmp-control"   // Default directory of control sockets (in config directory)
+	DefaultControlIdleTimeout time.Duration = 10 * time.Minute // Persistent connections close after this long without relayed channels
+	controlSocketSuffix       string        = ".sock"
+	controlCloseRequest       string        = "close@scmp" // Global request asking the process holding the connection to close it
+
 	// Remote
 	DefaultRemoteCommandTimeout int = 10  // Time in seconds for (internal) remote command to be considered dead
 	DefaultConnectTimeout       int = 30  // Time in seconds for SSH connection timeout
 	DefaultCommandTimeout       int = 180 // Time in seconds for user-defined commands to be considered dead
+
+	// Connection retries on dial-level failures
+	DefaultConnectAttempts   int           = 3                // Connection attempts per host (each attempt tries every address)
+	DefaultConnectRetryDelay time.Duration = time.Second      // Delay before the first retry, doubled for every further retry
+	MaxConnectRetryDelay     time.Duration = 30 * time.Second // Upper bound of the retry delay
+
+	// Client authentication method names (as logged)
+	authMethodNone                string = "none"
+	authMethodPublicKey           string = "publickey"
+	authMethodPassword            string = "password"
+	authMethodKeyboardInteractive string = "keyboard-interactive"
+
+	// Streamed transfers
+	DefaultStreamThresholdMB int = 100 // Artifact size in megabytes above which content is streamed from disk instead of loaded into memory
+	MaxTransferAttempts      int = 3   // Attempts for a streamed transfer, later attempts resume from the last confirmed offset
+
+	// File transfer timeouts (when no fixed timeout is requested)
+	MinTransferTimeout   time.Duration = time.Minute // Time allowed for every upload regardless of size
+	MinTransferRateBytes int64         = 256 * 1024  // Slowest accepted transfer rate in bytes per second, extends the timeout for larger files
+
+	// Remote file backups
+	BackupStyleCentral  string = "central"      // Backups stored in temporary directory removed after deployment
+	BackupStyleSibling  string = "sibling"      // Backups stored in hidden directory inside the target file directory
+	BackupStyleSuffix   string = "suffix"       // Backups stored next to the target file with a suffix
+	BackupStyleArchive  string = "archive"      // Backups kept in a per-deployment directory under the backup directory
+	SiblingBackupDir    string = ".scmp-backup" // Directory name for sibling backups
+	DefaultBackupSuffix string = ".scmp-old"    // Default suffix for suffix backups
+
+	// Archive backups
+	DefaultBackupDirectory string = "/var/backups/scmp" // Remote directory holding one archive directory per deployment
+	DefaultBackupRetention int    = 10                  // Archived deployments kept per host
+	BackupArchiveIDFormat  string = "20060102T150405Z"  // Archive directory names sort in deployment order
+
+	// Remote utility variants (probed at connection time)
+	StatGNU       string = "gnu"           // stat --format
+	StatBusyBox   string = "busybox"       // stat -c (BusyBox and other non-GNU implementations of the same format)
+	StatBSD       string = "bsd"           // stat -f
+	HashSha256sum string = "sha256sum"     // GNU coreutils and BusyBox
+	HashShasum    string = "shasum -a 256" // Perl shasum (macOS and some BSDs)
+	HashSha256    string = "sha256 -r"     // BSD sha256 (-r prints the sha256sum output order)
+
+	// Content placement
+	StagedFileSuffix string = ".scmp-staged" // Suffix of hidden files staged beside their target before the final rename
+
+	// Failure context of remote commands
+	commandErrorOutputLimit int = 2048 // Trailing bytes of command output kept in failure context
+	ExitCodeNone            int = -1   // Exit code of commands that never exited (session failure, timeout)
+	ExitCodeNotFound        int = 127  // Exit code of shells for commands that are not installed
+
+	// Batched commands (several steps in one round trip)
+	batchStepMarker string = "scmp-batch-step:" // Prefix of the stderr line naming the failed step of a batch
+
+	// Pseudo-terminal commands (--request-pty, RequestTTY)
+	ptyTerm       string = "xterm"
+	ptyRows       int    = 40
+	ptyColumns    int    = 200                    // Wide enough that most tools do not wrap captured output
+	ptySpeed      uint32 = 14400                  // Terminal input/output baud rate
+	ptySudoPrompt string = "[scmp-sudo-password]" // Password prompt given to sudo, answered with the password and removed from output
 )
+
+// Deployment phases recorded in the failure context of remote commands
+const (
+	PhaseInspect  string = "inspect"  // Reading remote state
+	PhaseBackup   string = "backup"   // Copying the remote file aside
+	PhaseTransfer string = "transfer" // Placing content or creating the item
+	PhaseVerify   string = "verify"   // Confirming the placed content
+	PhaseMetadata string = "metadata" // Owner, group, and permission changes
+	PhaseDelete   string = "delete"   // Removing the item
+	PhaseRestore  string = "restore"  // Putting the previous version back after a failure
+	PhaseReload   string = "reload"   // Reload commands of a reload group
+)
+
+// Handling of unknown host keys (empty asks the user)
+const (
+	HostKeyCheckingYes       string = "yes"        // Unknown keys fail the connection
+	HostKeyCheckingNo        string = "no"         // Unknown keys are written, changed keys only warn
+	HostKeyCheckingAcceptNew string = "accept-new" // Unknown keys are written, changed keys fail the connection
+)
+
+// Host key status in known_hosts
+const (
+	HostKeyKnown   string = "known"
+	HostKeyNew     string = "new"
+	HostKeyChanged string = "changed"
+)
+
+// Sentinel Errors
+var (
+	ErrEndpointUnreachable = errors.New("address unreachable")
+	ErrSFTPNoSuchFile      = errors.New("no such file")
+	ErrTransferTimeout     = errors.New("transfer timed out")
+	ErrSudoPasswordMissing = errors.New("sudo requested a password but no password was given")
+	ErrSudoPasswordDenied  = errors.New("sudo rejected the password")
+)
+
+const openSSHKeyMagic string = "openssh-key-v1\x00" // Leading bytes of OpenSSH format private key files
+
+// Hardware-backed (FIDO2) key types mapped to the algorithm of their underlying key
+var securityKeyBaseAlgo = map[string]string{
+	ssh.KeyAlgoSKED25519:  ssh.KeyAlgoED25519,
+	ssh.KeyAlgoSKECDSA256: ssh.KeyAlgoECDSA256,
+}
+
+// Commands every deployment runs on remote hosts (checksum and stat variants are probed separately)
+var RequiredUtilities = []string{"sh", "ls", "rm", "mv", "cp", "ln", "rmdir", "mkdir", "chown", "chmod", "uname"}
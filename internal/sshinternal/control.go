@@ -0,0 +1,356 @@
+package sshinternal
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Persistent connection to one host held by 'controller connect --persist'
+// Other controller processes reach the host through the control socket, every channel they open is relayed over the held connection
+// The socket is the only access check (owned by the user, mode 0600, in a 0700 directory), so the relay protocol itself does not authenticate
+type ControlServer struct {
+	socketPath     string
+	upstream       *ssh.Client
+	listener       net.Listener
+	serverConfig   *ssh.ServerConfig
+	mutex          sync.Mutex
+	activeChannels int       // Channels currently relayed
+	lastUsed       time.Time // When the last relayed channel closed (or the server started)
+	closeRequested chan struct{}
+	requestOnce    sync.Once
+	closed         chan struct{} // Closed by Close, connections dropped afterwards are not reported
+	closeOnce      sync.Once
+}
+
+// Control socket of a host in the control directory
+// Named after the host and its login, so a changed config never reuses a connection to a different server or user
+func ControlSocketPath(controlDir string, hostInfo config.EndpointInfo) (socketPath string) {
+	target := sha256.Sum256([]byte(hostInfo.EndpointUser + "@" + hostInfo.Endpoint))
+	socketPath = filepath.Join(controlDir, string(hostInfo.EndpointName)+"-"+hex.EncodeToString(target[:4])+controlSocketSuffix)
+	return
+}
+
+// Starts listening on the control socket of a held connection
+// A stale socket left by a stopped process is replaced, a socket still served by another process is refused
+func NewControlServer(socketPath string, upstream *ssh.Client) (server *ControlServer, err error) {
+	err = os.MkdirAll(filepath.Dir(socketPath), 0700)
+	if err != nil {
+		err = fmt.Errorf("failed to create control directory: %w", err)
+		return
+	}
+	err = os.Chmod(filepath.Dir(socketPath), 0700)
+	if err != nil {
+		err = fmt.Errorf("failed to restrict control directory permissions: %w", err)
+		return
+	}
+
+	existing, err := net.Dial("unix", socketPath)
+	if err == nil {
+		_ = existing.Close()
+		err = fmt.Errorf("control socket '%s' is already held by another process", socketPath)
+		return
+	}
+	err = os.Remove(socketPath)
+	if err != nil && !os.IsNotExist(err) {
+		err = fmt.Errorf("failed to remove stale control socket: %w", err)
+		return
+	}
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		err = fmt.Errorf("failed to generate control host key: %w", err)
+		return
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		err = fmt.Errorf("failed to create control host key: %w", err)
+		return
+	}
+
+	server = &ControlServer{
+		socketPath:     socketPath,
+		upstream:       upstream,
+		serverConfig:   &ssh.ServerConfig{NoClientAuth: true, ServerVersion: SSHVersionString},
+		lastUsed:       time.Now(),
+		closeRequested: make(chan struct{}),
+		closed:         make(chan struct{}),
+	}
+	server.serverConfig.AddHostKey(signer)
+
+	server.listener, err = net.Listen("unix", socketPath)
+	if err != nil {
+		err = fmt.Errorf("failed to listen on control socket: %w", err)
+		return
+	}
+	err = os.Chmod(socketPath, 0600)
+	if err != nil {
+		_ = server.listener.Close()
+		err = fmt.Errorf("failed to restrict control socket permissions: %w", err)
+		return
+	}
+	return
+}
+
+// Accepts control connections until the server is closed or the held connection drops
+func (server *ControlServer) Serve(ctx context.Context) {
+	go func() {
+		_ = server.upstream.Wait()
+		select {
+		case <-server.closed:
+		default:
+			logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.WarnLog, "Persistent connection closed by remote host\n")
+		}
+		_ = server.listener.Close()
+	}()
+
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		go server.handleControlConn(ctx, conn)
+	}
+}
+
+// Time since the last relayed channel closed (zero while channels are open)
+func (server *ControlServer) Idle() (idle time.Duration) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.activeChannels > 0 {
+		return
+	}
+	idle = time.Since(server.lastUsed)
+	return
+}
+
+// Closed once a controller process asks the server to stop (controller connect --close)
+func (server *ControlServer) CloseRequested() (requested <-chan struct{}) {
+	requested = server.closeRequested
+	return
+}
+
+// Stops accepting control connections, removes the socket, and disconnects from the host (only the first call has an effect)
+func (server *ControlServer) Close() (err error) {
+	server.closeOnce.Do(func() {
+		close(server.closed)
+		_ = server.listener.Close()
+		_ = os.Remove(server.socketPath)
+		err = server.upstream.Close()
+		if errors.Is(err, net.ErrClosed) {
+			err = nil
+		}
+	})
+	return
+}
+
+func (server *ControlServer) handleControlConn(ctx context.Context, conn net.Conn) {
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, server.serverConfig)
+	if err != nil {
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog, "Control connection failed: %v\n", err)
+		return
+	}
+	defer serverConn.Close()
+
+	go func() {
+		for request := range requests {
+			if request.Type == controlCloseRequest {
+				_ = request.Reply(true, nil)
+				server.requestOnce.Do(func() { close(server.closeRequested) })
+				continue
+			}
+			accepted, payload, _ := server.upstream.SendRequest(request.Type, request.WantReply, request.Payload)
+			if request.WantReply {
+				_ = request.Reply(accepted, payload)
+			}
+		}
+	}()
+
+	for newChannel := range channels {
+		go server.relayChannel(ctx, newChannel)
+	}
+}
+
+// Opens the same channel on the held connection and copies data, stderr, and requests both ways until either side closes
+func (server *ControlServer) relayChannel(ctx context.Context, newChannel ssh.NewChannel) {
+	upstreamChannel, upstreamRequests, err := server.upstream.OpenChannel(newChannel.ChannelType(), newChannel.ExtraData())
+	if err != nil {
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			_ = newChannel.Reject(openErr.Reason, openErr.Message)
+		} else {
+			_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		}
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		_ = upstreamChannel.Close()
+		return
+	}
+
+	server.mutex.Lock()
+	server.activeChannels++
+	server.mutex.Unlock()
+	defer func() {
+		server.mutex.Lock()
+		server.activeChannels--
+		server.lastUsed = time.Now()
+		server.mutex.Unlock()
+	}()
+
+	logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Relaying %s channel over persistent connection\n", newChannel.ChannelType())
+
+	// Output of the host reaches the client before the channel is closed
+	// EOF ends stdout and stderr together, so it is only sent once both are copied
+	var output sync.WaitGroup
+	output.Add(2)
+	go func() {
+		defer output.Done()
+		_, _ = io.Copy(channel, upstreamChannel)
+	}()
+	go func() {
+		defer output.Done()
+		_, _ = io.Copy(channel.Stderr(), upstreamChannel.Stderr())
+	}()
+	go func() {
+		output.Wait()
+		_ = channel.CloseWrite()
+	}()
+	go func() {
+		_, _ = io.Copy(upstreamChannel, channel)
+		_ = upstreamChannel.CloseWrite()
+	}()
+	go func() {
+		for request := range requests {
+			accepted, _ := upstreamChannel.SendRequest(request.Type, request.WantReply, request.Payload)
+			if request.WantReply {
+				_ = request.Reply(accepted, nil)
+			}
+		}
+		_ = upstreamChannel.Close()
+	}()
+
+	for request := range upstreamRequests {
+		accepted, _ := channel.SendRequest(request.Type, request.WantReply, request.Payload)
+		if request.WantReply {
+			_ = request.Reply(accepted, nil)
+		}
+	}
+	output.Wait()
+	_ = channel.Close()
+}
+
+// Connects to the host through its control socket when a persistent connection is held for it
+// Missing or stale sockets return no client and no error (the caller connects directly)
+func dialControl(ctx context.Context, hostInfo config.EndpointInfo) (client *ssh.Client, err error) {
+	cfg, cfgPresent := ctx.Value(global.ConfKey).(config.Config)
+	if !cfgPresent || cfg.ControlDirectory == "" {
+		return
+	}
+	socketPath := ControlSocketPath(cfg.ControlDirectory, hostInfo)
+
+	socketInfo, err := os.Lstat(socketPath)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to check control socket: %w", err)
+		return
+	}
+
+	// Sockets of other users are never trusted
+	socketStat, isUnixStat := socketInfo.Sys().(*syscall.Stat_t)
+	if socketInfo.Mode().Type() != os.ModeSocket || !isUnixStat || int(socketStat.Uid) != os.Getuid() || socketInfo.Mode().Perm()&0077 != 0 {
+		err = fmt.Errorf("refusing control socket '%s': not a socket owned by the current user with mode 0600", socketPath)
+		return
+	}
+
+	dialer := net.Dialer{Timeout: time.Duration(DefaultRemoteCommandTimeout) * time.Second}
+	conn, lerr := dialer.DialContext(ctx, "unix", socketPath)
+	if lerr != nil {
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog, "Ignoring stale control socket '%s': %v\n", socketPath, lerr)
+		return
+	}
+
+	// The control socket is local and checked above, the host key was verified by the process holding the connection
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, socketPath, &ssh.ClientConfig{
+		User:            hostInfo.EndpointUser,
+		ClientVersion:   SSHVersionString,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         time.Duration(DefaultRemoteCommandTimeout) * time.Second,
+	})
+	if err != nil {
+		_ = conn.Close()
+		err = fmt.Errorf("failed control socket handshake: %w", err)
+		return
+	}
+	client = ssh.NewClient(clientConn, channels, requests)
+	return
+}
+
+// Asks every process holding persistent connections in the control directory to close them
+// Returns the number of control sockets that accepted the request, stale sockets are removed
+// Sockets that disappear or stop answering while their process shuts down are skipped
+func CloseControlSockets(ctx context.Context, controlDir string) (closed int, err error) {
+	entries, err := os.ReadDir(controlDir)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to read control directory: %w", err)
+		return
+	}
+
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), controlSocketSuffix) {
+			continue
+		}
+		socketPath := filepath.Join(controlDir, entry.Name())
+
+		conn, lerr := net.DialTimeout("unix", socketPath, time.Duration(DefaultRemoteCommandTimeout)*time.Second)
+		if lerr != nil {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Removing stale control socket '%s'\n", socketPath)
+			_ = os.Remove(socketPath)
+			continue
+		}
+		clientConn, channels, requests, lerr := ssh.NewClientConn(conn, socketPath, &ssh.ClientConfig{
+			ClientVersion:   SSHVersionString,
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			Timeout:         time.Duration(DefaultRemoteCommandTimeout) * time.Second,
+		})
+		if lerr != nil {
+			_ = conn.Close()
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog, "Skipping control socket '%s': %v\n", socketPath, lerr)
+			continue
+		}
+		client := ssh.NewClient(clientConn, channels, requests)
+		accepted, _, lerr := client.SendRequest(controlCloseRequest, true, nil)
+		_ = client.Close()
+		if lerr != nil || !accepted {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog, "Control socket '%s' did not accept close request: %v\n", socketPath, lerr)
+			continue
+		}
+		closed++
+	}
+	return
+}
@@ -0,0 +1,112 @@
+package sshinternal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestControlSocketRelay(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	controlDir := t.TempDir()
+	ctx = context.WithValue(ctx, global.ConfKey, config.Config{ControlDirectory: controlDir})
+
+	upstream := serveTestExec(t, func(command string) (result testExecResult) {
+		result = testExecResult{stdout: "ran " + command + "\n", stderr: "warning\n", exitStatus: 2}
+		return
+	})
+	hostInfo := config.EndpointInfo{EndpointName: "web01", EndpointUser: "deployer", Endpoint: "192.0.2.1:22"}
+
+	// Without a held connection the caller connects directly
+	client, err := dialControl(ctx, hostInfo)
+	if err != nil || client != nil {
+		t.Fatalf("expected no control connection, got %v (%v)", client, err)
+	}
+
+	server, err := NewControlServer(ControlSocketPath(controlDir, hostInfo), upstream)
+	if err != nil {
+		t.Fatalf("failed starting control server: %v", err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+	go server.Serve(ctx)
+
+	// A second process cannot take over a socket that is still served
+	_, err = NewControlServer(ControlSocketPath(controlDir, hostInfo), upstream)
+	if err == nil || !strings.Contains(err.Error(), "already held") {
+		t.Errorf("expected held socket to be refused, got '%v'", err)
+	}
+
+	client, err = dialControl(ctx, hostInfo)
+	if err != nil || client == nil {
+		t.Fatalf("expected control connection, got %v (%v)", client, err)
+	}
+	defer client.Close()
+
+	// Output, stderr, and exit status of the host are relayed
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("failed opening session: %v", err)
+	}
+	var stderr strings.Builder
+	session.Stderr = &stderr
+	output, err := session.Output("uptime")
+	var exitErr *ssh.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitStatus() != 2 {
+		t.Errorf("expected exit status 2, got '%v'", err)
+	}
+	if string(output) != "ran uptime\n" || stderr.String() != "warning\n" {
+		t.Errorf("unexpected relayed output '%s' and stderr '%s'", output, stderr.String())
+	}
+
+	// Different logins never share a socket
+	otherUser := hostInfo
+	otherUser.EndpointUser = "root"
+	if ControlSocketPath(controlDir, otherUser) == ControlSocketPath(controlDir, hostInfo) {
+		t.Errorf("expected different control sockets for different users")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Idle() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if server.Idle() == 0 {
+		t.Errorf("expected server to be idle once the session closed")
+	}
+
+	closed, err := CloseControlSockets(ctx, controlDir)
+	if err != nil || closed != 1 {
+		t.Errorf("expected one closed socket, got %d (%v)", closed, err)
+	}
+	select {
+	case <-server.CloseRequested():
+	case <-time.After(5 * time.Second):
+		t.Errorf("expected close request to reach the server")
+	}
+}
+
+func TestControlSocketOwnership(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	controlDir := t.TempDir()
+	ctx = context.WithValue(ctx, global.ConfKey, config.Config{ControlDirectory: controlDir})
+
+	hostInfo := config.EndpointInfo{EndpointName: "web01", EndpointUser: "deployer", Endpoint: "192.0.2.1:22"}
+	err := os.WriteFile(ControlSocketPath(controlDir, hostInfo), nil, 0600)
+	if err != nil {
+		t.Fatalf("failed writing fake socket: %v", err)
+	}
+
+	_, err = dialControl(ctx, hostInfo)
+	if err == nil || !strings.Contains(err.Error(), "refusing control socket") {
+		t.Errorf("expected regular file to be refused, got '%v'", err)
+	}
+}
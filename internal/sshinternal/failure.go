@@ -0,0 +1,115 @@
+package sshinternal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"scmp/internal/global"
+	"strconv"
+	"strings"
+)
+
+// Marks remote commands run with the returned context as part of a deployment phase
+func WithPhase(ctx context.Context, phase string) (phaseCtx context.Context) {
+	phaseCtx = context.WithValue(ctx, global.PhaseKey, phase)
+	return
+}
+
+func phaseFromContext(ctx context.Context) (phase string) {
+	phase, _ = ctx.Value(global.PhaseKey).(string)
+	return
+}
+
+// Reports remote commands that failed because the program is not installed
+func IsCommandNotFound(err error) (notFound bool) {
+	var commandErr *CommandError
+	if !errors.As(err, &commandErr) {
+		return
+	}
+	notFound = commandErr.ExitCode == ExitCodeNotFound || strings.Contains(commandErr.Output, "command not found")
+	return
+}
+
+// Reports remote commands that failed because the filesystem does not support the operation (ENOTSUP)
+func IsNotSupported(err error) (notSupported bool) {
+	var commandErr *CommandError
+	if !errors.As(err, &commandErr) {
+		return
+	}
+	notSupported = strings.Contains(commandErr.Output, "Operation not supported")
+	return
+}
+
+// Reports remote commands that were refused by the kernel or filesystem (EPERM)
+func IsNotPermitted(err error) (notPermitted bool) {
+	var commandErr *CommandError
+	if !errors.As(err, &commandErr) {
+		return
+	}
+	notPermitted = strings.Contains(commandErr.Output, "Operation not permitted")
+	return
+}
+
+// Finds the failed step of a batch built by BuildBatch
+// The returned error describes the step as if it ran on its own, step is -1 when no step failed (e.g. connection loss)
+func BatchStepError(batch []RemoteCommand, err error) (step int, stepErr error) {
+	step = -1
+	stepErr = err
+
+	var commandErr *CommandError
+	if !errors.As(err, &commandErr) {
+		return
+	}
+
+	// Marker is the last line written to stderr
+	output := commandErr.Output
+	markerLine := output
+	lineEnd := strings.LastIndexByte(output, '\n')
+	if lineEnd >= 0 {
+		markerLine = output[lineEnd+1:]
+		output = output[:lineEnd]
+	} else {
+		output = ""
+	}
+	if !strings.HasPrefix(markerLine, batchStepMarker) {
+		return
+	}
+	index, convErr := strconv.Atoi(strings.TrimPrefix(markerLine, batchStepMarker))
+	if convErr != nil || index < 0 || index >= len(batch) {
+		return
+	}
+
+	stepFailure := *commandErr
+	stepFailure.Command = batch[index].Raw
+	stepFailure.Output = strings.TrimSpace(output)
+	step = index
+	stepErr = &stepFailure
+	return
+}
+
+func (commandErr *CommandError) Error() (message string) {
+	message = fmt.Sprintf("error with command '%s': %v", commandErr.Command, commandErr.Err)
+	if commandErr.Output != "" {
+		message += ": " + commandErr.Output
+	}
+	return
+}
+
+func (commandErr *CommandError) Unwrap() (err error) {
+	err = commandErr.Err
+	return
+}
+
+// Last bytes of command output, cut at a line start when possible
+func tailOutput(output string) (tail string) {
+	tail = strings.TrimSpace(output)
+	if len(tail) <= commandErrorOutputLimit {
+		return
+	}
+	tail = tail[len(tail)-commandErrorOutputLimit:]
+	lineStart := strings.IndexByte(tail, '\n')
+	if lineStart >= 0 && lineStart < len(tail)-1 {
+		tail = tail[lineStart+1:]
+	}
+	return
+}
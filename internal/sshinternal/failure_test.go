@@ -0,0 +1,212 @@
+package sshinternal
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Response of the test exec server to a single command
+type testExecResult struct {
+	stdout     string
+	stderr     string
+	exitStatus uint32
+}
+
+// Starts an SSH server answering exec requests with the given handler, returns a connected client
+func serveTestExec(t *testing.T, handler func(command string) testExecResult) (client *ssh.Client) {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("failed creating host key signer: %v", err)
+	}
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed starting ssh server: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		_, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(requests)
+		for newChannel := range channels {
+			channel, channelRequests, err := newChannel.Accept()
+			if err != nil {
+				continue
+			}
+			go func() {
+				for request := range channelRequests {
+					if request.Type != "exec" {
+						_ = request.Reply(false, nil)
+						continue
+					}
+					command := string(request.Payload[4:])
+					_ = request.Reply(true, nil)
+
+					result := handler(command)
+					_, _ = channel.Write([]byte(result.stdout))
+					_, _ = channel.Stderr().Write([]byte(result.stderr))
+					_, _ = channel.SendRequest("exit-status", false, binary.BigEndian.AppendUint32(nil, result.exitStatus))
+					_ = channel.Close()
+				}
+			}()
+		}
+	}()
+
+	client, err = ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{
+		User:            "test",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("failed connecting to test ssh server: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return
+}
+
+func TestSSHexecFailureContext(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	client := serveTestExec(t, func(command string) (result testExecResult) {
+		switch {
+		case strings.HasPrefix(command, "chmod"):
+			result = testExecResult{stderr: "chmod: changing permissions of '/etc/x': Operation not permitted\n", exitStatus: 1}
+		case strings.HasPrefix(command, "check"):
+			result = testExecResult{stdout: "config test failed\n", exitStatus: 3}
+		default:
+			result = testExecResult{stdout: "ok\n"}
+		}
+		return
+	})
+
+	tests := []struct {
+		name             string
+		command          RemoteCommand
+		phase            string
+		expectedExitCode int
+		expectedOutput   string
+	}{
+		{"stderr of metadata change", RemoteCommand{Raw: "chmod 640 /etc/x", DisableSudo: true, Timeout: 5}, PhaseMetadata, 1, "chmod: changing permissions of '/etc/x': Operation not permitted"},
+		{"stdout when stderr is empty", RemoteCommand{Raw: "check /etc/x", DisableSudo: true, Timeout: 5}, "postcheck", 3, "config test failed"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.command.SSHexec(WithPhase(ctx, test.phase), client, "")
+
+			var commandErr *CommandError
+			if !errors.As(err, &commandErr) {
+				t.Fatalf("expected command error, got '%v'", err)
+			}
+			if commandErr.Phase != test.phase {
+				t.Errorf("expected phase '%s', got '%s'", test.phase, commandErr.Phase)
+			}
+			if commandErr.Command != test.command.Raw {
+				t.Errorf("expected command '%s', got '%s'", test.command.Raw, commandErr.Command)
+			}
+			if commandErr.ExitCode != test.expectedExitCode {
+				t.Errorf("expected exit code %d, got %d", test.expectedExitCode, commandErr.ExitCode)
+			}
+			if commandErr.Output != test.expectedOutput {
+				t.Errorf("expected output '%s', got '%s'", test.expectedOutput, commandErr.Output)
+			}
+			if commandErr.Elapsed <= 0 {
+				t.Errorf("expected elapsed time to be recorded")
+			}
+			if !strings.Contains(err.Error(), test.expectedOutput) {
+				t.Errorf("expected error message to include output, got '%v'", err)
+			}
+		})
+	}
+
+	// Successful commands return no error
+	output, err := RemoteCommand{Raw: "true", DisableSudo: true, Timeout: 5}.SSHexec(ctx, client, "")
+	if err != nil || output != "ok\n" {
+		t.Errorf("expected successful command, got '%s' (%v)", output, err)
+	}
+}
+
+func TestTailOutput(t *testing.T) {
+	short := "error: one line\n"
+	if tailOutput(short) != "error: one line" {
+		t.Errorf("expected short output trimmed only, got '%s'", tailOutput(short))
+	}
+
+	long := strings.Repeat("early line\n", 500) + "last line"
+	tail := tailOutput(long)
+	if len(tail) > commandErrorOutputLimit || !strings.HasSuffix(tail, "last line") || !strings.HasPrefix(tail, "early line") {
+		t.Errorf("expected tail cut at a line start within %d bytes, got %d bytes starting '%.20s'", commandErrorOutputLimit, len(tail), tail)
+	}
+}
+
+func TestUploadTransferTimeout(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	// Remote side never answers, like a write stuck on a dead mount
+	stalled := make(chan struct{})
+	t.Cleanup(func() { close(stalled) })
+	client := serveTestExec(t, func(command string) (result testExecResult) {
+		<-stalled
+		return
+	})
+
+	upload := func(uploadCtx context.Context, bufferFilePath str.RemotePath) (err error) {
+		err = SCPUpload(uploadCtx, client, nil, []byte("content"), bufferFilePath)
+		return
+	}
+
+	start := time.Now()
+	err := uploadWithTimeout(ctx, 200*time.Millisecond, 7, "/tmp/buffer", upload)
+	if !errors.Is(err, ErrTransferTimeout) {
+		t.Fatalf("expected transfer timeout, got '%v'", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("expected stalled upload to be aborted at the timeout, took %s", time.Since(start))
+	}
+
+	// Only the transfer session is closed, the host connection stays usable
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("expected connection to remain open after aborted upload, got '%v'", err)
+	}
+	_ = session.Close()
+}
+
+func TestTransferTimeout(t *testing.T) {
+	if TransferTimeout(30*time.Second, 1<<30) != 30*time.Second {
+		t.Errorf("expected configured timeout to be used regardless of size")
+	}
+	if TransferTimeout(0, 0) != MinTransferTimeout {
+		t.Errorf("expected minimum timeout for empty files")
+	}
+	if TransferTimeout(0, 100*MinTransferRateBytes) != MinTransferTimeout+100*time.Second {
+		t.Errorf("expected timeout to grow with file size")
+	}
+}
@@ -6,16 +6,20 @@ import (
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"net"
+	"net/netip"
 	"os"
 	"scmp/internal/config"
 	"scmp/internal/fsops"
 	"scmp/internal/global"
 	"scmp/internal/input"
+	"scmp/internal/logctx"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
@@ -61,76 +65,39 @@ func IdentityToKey(ctx context.Context, SSHIdentityFile string) (privateKey ssh.
 		SSHKeyType = "public"
 	}
 
-	// Load key from keyring if requested
-	if SSHKeyType == "public" {
-		// Ensure user supplied identity is a public key if requesting to use agent
-		if SSHKeyType != "public" {
-			err = fmt.Errorf("identity file is not a public key, cannot use agent without public key")
-			return
-		}
-
-		// Find auth socket for agent
-		agentSock := os.Getenv("SSH_AUTH_SOCK")
-		if agentSock == "" {
-			err = fmt.Errorf("cannot use agent, '%s' environment variable is not set", agentSock)
-			return
-		}
-
-		// Connect to agent socket
-		var agentConn net.Conn
-		agentConn, err = net.Dial("unix", agentSock)
+	// Hardware-backed key stubs (even passphrase protected) cannot sign locally, so use the agent by the public half
+	var publicKey ssh.PublicKey
+	if SSHKeyType == "" || SSHKeyType == "encrypted" {
+		publicKey, err = securityKeyPublicKey(SSHIdentity)
 		if err != nil {
-			err = fmt.Errorf("ssh agent: %w", err)
-			return
-		}
-
-		// Establish new client with agent
-		sshAgent := agent.NewClient(agentConn)
-
-		// Get list of keys in agent
-		var sshAgentKeys []*agent.Key
-		sshAgentKeys, err = sshAgent.List()
-		if err != nil {
-			err = fmt.Errorf("ssh agent key list: %w", err)
-			return
-		}
-
-		// Ensure keys are already loaded
-		if len(sshAgentKeys) == 0 {
-			err = fmt.Errorf("no keys found in agent (Did you forget something?)")
+			err = fmt.Errorf("invalid security key stub in identity file: %w", err)
 			return
+		} else if publicKey != nil {
+			SSHKeyType = "security-key"
 		}
+	}
 
-		// Parse public key from identity
-		var publicKey ssh.PublicKey
-		publicKey, _, _, _, err = ssh.ParseAuthorizedKey(SSHIdentity)
-		if err != nil {
-			err = fmt.Errorf("invalid public key in identity file: %w", err)
-			return
+	// Load key from keyring if requested
+	if SSHKeyType == "public" || SSHKeyType == "security-key" {
+		if SSHKeyType == "public" {
+			// Parse public key from identity
+			publicKey, _, _, _, err = ssh.ParseAuthorizedKey(SSHIdentity)
+			if err != nil {
+				err = fmt.Errorf("invalid public key in identity file: %w", err)
+				return
+			}
 		}
 
 		// Add key algorithm to return value for later connect
 		keyAlgo = publicKey.Type()
+		if isSecurityKeyType(keyAlgo) {
+			keyAlgo = securityKeyBaseAlgo[keyAlgo]
+		}
 
-		// Get signers from agent
-		var signers []ssh.Signer
-		signers, err = sshAgent.Signers()
+		privateKey, err = agentSigner(publicKey)
 		if err != nil {
-			err = fmt.Errorf("ssh agent signers: %w", err)
 			return
 		}
-
-		// Find matching private key to local public key
-		for _, sshAgentKey := range signers {
-			// Obtain public key from private key in keyring
-			sshAgentPubKey := sshAgentKey.PublicKey()
-
-			// Break if public key of priv key in agent matches public key from identity
-			if bytes.Equal(sshAgentPubKey.Marshal(), publicKey.Marshal()) {
-				privateKey = sshAgentKey
-				break
-			}
-		}
 	} else if SSHKeyType == "private" {
 		privateKey, err = ssh.ParsePrivateKey(SSHIdentity)
 		if err != nil {
@@ -164,8 +131,103 @@ func IdentityToKey(ctx context.Context, SSHIdentityFile string) (privateKey ssh.
 	return
 }
 
-// Validates endpoint address and port, then combines both strings
-func ParseEndpointAddress(endpointIP string, Port string) (endpointSocket string, err error) {
+// Retrieves the signer from the running SSH agent that matches the given public key
+func agentSigner(publicKey ssh.PublicKey) (signer ssh.Signer, err error) {
+	// Find auth socket for agent
+	agentSock := os.Getenv("SSH_AUTH_SOCK")
+	if agentSock == "" {
+		err = fmt.Errorf("cannot use agent, 'SSH_AUTH_SOCK' environment variable is not set")
+		return
+	}
+
+	// Connect to agent socket
+	agentConn, err := net.Dial("unix", agentSock)
+	if err != nil {
+		err = fmt.Errorf("ssh agent: %w", err)
+		return
+	}
+
+	// Establish new client with agent
+	sshAgent := agent.NewClient(agentConn)
+
+	// Get list of keys in agent
+	sshAgentKeys, err := sshAgent.List()
+	if err != nil {
+		err = fmt.Errorf("ssh agent key list: %w", err)
+		return
+	}
+
+	// Ensure keys are already loaded
+	if len(sshAgentKeys) == 0 {
+		err = fmt.Errorf("no keys found in agent (Did you forget something?)")
+		return
+	}
+
+	// Get signers from agent
+	signers, err := sshAgent.Signers()
+	if err != nil {
+		err = fmt.Errorf("ssh agent signers: %w", err)
+		return
+	}
+
+	// Find matching private key to local public key
+	for _, sshAgentKey := range signers {
+		// Break if public key of priv key in agent matches public key from identity
+		if bytes.Equal(sshAgentKey.PublicKey().Marshal(), publicKey.Marshal()) {
+			signer = sshAgentKey
+			return
+		}
+	}
+
+	if isSecurityKeyType(publicKey.Type()) {
+		err = fmt.Errorf("agent does not hold security key %s (add it with 'ssh-add -K' for resident keys or 'ssh-add <identity file>' with the security key inserted)", ssh.FingerprintSHA256(publicKey))
+	} else {
+		err = fmt.Errorf("agent does not hold key %s", ssh.FingerprintSHA256(publicKey))
+	}
+	return
+}
+
+// Extracts the public key from an OpenSSH private key file when it is a hardware-backed (FIDO2) key stub
+// Returns nil public key for any other identity contents
+func securityKeyPublicKey(identity []byte) (publicKey ssh.PublicKey, err error) {
+	block, _ := pem.Decode(identity)
+	if block == nil || block.Type != "OPENSSH PRIVATE KEY" {
+		return
+	}
+
+	if !bytes.HasPrefix(block.Bytes, []byte(openSSHKeyMagic)) {
+		return
+	}
+
+	// Public key is stored unencrypted in the header
+	var header openSSHKeyHeader
+	err = ssh.Unmarshal(block.Bytes[len(openSSHKeyMagic):], &header)
+	if err != nil {
+		err = fmt.Errorf("failed to parse key header: %w", err)
+		return
+	}
+
+	keyPublicHalf, err := ssh.ParsePublicKey(header.PubKey)
+	if err != nil {
+		err = fmt.Errorf("failed to parse public key: %w", err)
+		return
+	}
+
+	if isSecurityKeyType(keyPublicHalf.Type()) {
+		publicKey = keyPublicHalf
+	}
+	return
+}
+
+// Checks if key type is a hardware-backed (FIDO2) key
+func isSecurityKeyType(keyType string) (isSK bool) {
+	_, isSK = securityKeyBaseAlgo[keyType]
+	return
+}
+
+// Validates endpoint address (IP or DNS name) and port, then combines both strings
+// Addresses are normalized so identical endpoints always produce identical sockets
+func ParseEndpointAddress(endpointAddr string, Port string) (endpointSocket string, err error) {
 	// Verify endpoint Port
 	endpointPort, _ := strconv.Atoi(Port)
 	if endpointPort <= 0 || endpointPort > 65535 {
@@ -173,102 +235,141 @@ func ParseEndpointAddress(endpointIP string, Port string) (endpointSocket string
 		return
 	}
 
-	// Verify IP address
-	IPCheck := net.ParseIP(endpointIP)
-	if IPCheck == nil {
-		err = fmt.Errorf("endpoint ip '%s' is not valid", endpointIP)
+	endpointHost, err := NormalizeEndpointHost(endpointAddr)
+	if err != nil {
 		return
 	}
 
-	// Get endpoint socket by ipv6 or ipv4
-	if strings.Contains(endpointIP, ":") {
-		endpointSocket = "[" + endpointIP + "]" + ":" + strconv.Itoa(endpointPort)
-	} else {
-		endpointSocket = endpointIP + ":" + strconv.Itoa(endpointPort)
+	// Brackets IPv6 addresses
+	endpointSocket = net.JoinHostPort(endpointHost, strconv.Itoa(endpointPort))
+	return
+}
+
+// Time allowed for uploading a file of the given size (the configured timeout when set)
+func TransferTimeout(configuredTimeout time.Duration, transferSize int64) (timeout time.Duration) {
+	timeout = configuredTimeout
+	if timeout > 0 {
+		return
+	}
+	timeout = MinTransferTimeout + time.Duration(transferSize/MinTransferRateBytes)*time.Second
+	return
+}
+
+// Converts an IP address (optionally with IPv6 zone) to canonical form or a DNS name to lowercase without trailing dot
+func NormalizeEndpointHost(endpointAddr string) (endpointHost string, err error) {
+	endpointAddr = strings.TrimSpace(endpointAddr)
+	endpointAddr = strings.TrimPrefix(endpointAddr, "[")
+	endpointAddr = strings.TrimSuffix(endpointAddr, "]")
+
+	// IPv6 zones (fe80::1%eth0) are kept so link-local addresses stay dialable
+	IPCheck, err := netip.ParseAddr(endpointAddr)
+	if err == nil {
+		if IPCheck.Zone() == "" {
+			IPCheck = IPCheck.Unmap()
+		}
+		endpointHost = IPCheck.String()
+		return
+	}
+	err = nil
+
+	// Only digits and dots (or any colons or zone) cannot be a DNS name, so it is a malformed IP
+	if strings.Trim(endpointAddr, "0123456789.") == "" || strings.ContainsAny(endpointAddr, ":%") {
+		err = fmt.Errorf("endpoint ip '%s' is not valid", endpointAddr)
+		return
+	}
+
+	endpointHost = strings.ToLower(strings.TrimSuffix(endpointAddr, "."))
+	if !isValidHostname(endpointHost) {
+		err = fmt.Errorf("endpoint hostname '%s' is not valid", endpointAddr)
+		return
+	}
+	return
+}
+
+// Checks DNS name against RFC 1123 hostname rules
+func isValidHostname(hostname string) (valid bool) {
+	if len(hostname) == 0 || len(hostname) > 253 {
+		return
+	}
+
+	for label := range strings.SplitSeq(hostname, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return
+		}
+		if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return
+		}
+		for _, char := range label {
+			if (char < 'a' || char > 'z') && (char < '0' || char > '9') && char != '-' {
+				return
+			}
+		}
 	}
 
+	valid = true
 	return
 }
 
 // Custom HostKeyCallback for validating remote public key against known pub keys
-// If unknown, will ask user if it should trust the remote host
-func hostKeyCallback(ctx context.Context, hostname string, remote net.Addr, PubKey ssh.PublicKey) (err error) {
+// Keys pinned under another name of the same host (host name or its other addresses) are also accepted
+// If unknown, the strict host key checking mode decides, without a mode the user is asked if it should trust the remote host
+func hostKeyCallback(ctx context.Context, hostname string, remote net.Addr, PubKey ssh.PublicKey, knownAliases []string) (err error) {
 	config := global.AssertFromContext[config.Config](ctx, "config", global.ConfKey, "config.Config")
-	_ = hostname
-
 	const environmentUnknownSSHHostKey string = "UnknownSSHHostKeyAction"
 
-	// Turn remote address into format used with known_hosts file entries
-	cleanHost, _, err := net.SplitHostPort(remote.String())
+	cleanHost, err := knownHostName(hostname, remote)
 	if err != nil {
-		err = fmt.Errorf("error with ssh server key check: unable to determine hostname in address: %w", err)
 		return
 	}
 
-	// If the remote addr is IPv6, extract the address part
-	// Only inside the brackets - OpenSSH does not include brackets when checking against known_hosts
-	if strings.Contains(cleanHost, "]") {
-		cleanHost = strings.TrimPrefix(cleanHost, "[")
-		cleanHost = strings.TrimSuffix(cleanHost, "]")
-	}
-
 	// Convert ssh line protocol public key to known_hosts encoding
 	remotePubKey := base64.StdEncoding.EncodeToString(PubKey.Marshal())
 
 	// Get the public key type
 	pubKeyType := PubKey.Type()
 
-	// Find an entry that matches the host we are handshaking with
-	for _, knownhostkey := range config.KnownHosts {
-		// Separate the public key section from the hashed host section
-		knownhostkey = strings.TrimPrefix(knownhostkey, "|")
-		knownhost := strings.SplitN(knownhostkey, " ", 2)
-		if len(knownhost) < 2 {
-			continue
-		}
-
-		// Only Process hashed lines of known_hosts
-		knownHostsPart := strings.Split(knownhost[0], "|")
-		if len(knownHostsPart) < 3 || knownHostsPart[0] != "1" {
-			continue
-		}
-
-		// Retrieve fields from known_hosts hash section
-		salt := knownHostsPart[1]
-		hashedKnownHost := knownHostsPart[2]
-		knownkeysPart := strings.Fields(knownhost[1])
+	keyIsKnown, err := knownHostKeyMatches(config.KnownHosts, cleanHost, remotePubKey)
+	if err != nil || keyIsKnown {
+		// nil err means SSH is cleared to continue handshake
+		return
+	}
 
-		// Ensure Key section has at least algorithm and key fields
-		if len(knownkeysPart) < 2 {
+	for _, alias := range knownAliases {
+		if alias == "" || alias == cleanHost {
 			continue
 		}
-
-		// Hash the cleaned host name with the salt from known_hosts line
-		var saltBytes []byte
-		saltBytes, err = base64.StdEncoding.DecodeString(salt)
+		keyIsKnown, err = knownHostKeyMatches(config.KnownHosts, alias, remotePubKey)
 		if err != nil {
-			err = fmt.Errorf("error decoding salt: %w", err)
 			return
 		}
+		if keyIsKnown {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Host key of %s matches known key of %s\n", cleanHost, alias)
+			return
+		}
+	}
 
-		// Create the HMAC-SHA1 using the salt as the key
-		hmacAlgo := hmac.New(sha1.New, saltBytes)
-		hmacAlgo.Write([]byte(cleanHost))
-		hashed := hmacAlgo.Sum(nil)
-
-		// Convert hash hosts name to hex base64
-		hashedHost := base64.StdEncoding.EncodeToString(hashed)
-
-		// Compare hashed values of host and known_host host
-		if hashedHost == hashedKnownHost {
-			// Grab just the key part from known_hosts
-			localPubKey := strings.Join(knownkeysPart[1:], " ")
-			// Compare public keys
-			if localPubKey == remotePubKey {
-				// nil err means SSH is cleared to continue handshake
-				return
-			}
+	// A known host presenting a different key of the same type is refused unless host key checking is disabled, it is never prompted for or added
+	keyChanged, err := knownHostKeyChanged(config.KnownHosts, cleanHost, pubKeyType, remotePubKey)
+	if err != nil {
+		return
+	}
+	if keyChanged {
+		if config.HostKeyChecking == HostKeyCheckingNo {
+			logctx.LogStdWarn(ctx, "Host key of %s changed to %s %s, continuing without host key verification\n", cleanHost, pubKeyType, ssh.FingerprintSHA256(PubKey))
+			return
 		}
+		logctx.LogStdErr(ctx, "WARNING: host key of %s changed to %s %s, it does not match its known_hosts entry\n", cleanHost, pubKeyType, ssh.FingerprintSHA256(PubKey))
+		err = fmt.Errorf("host key of %s changed, refusing to connect (remove the old key with 'ssh-keys remove' if the change is expected)", cleanHost)
+		return
+	}
+
+	switch config.HostKeyChecking {
+	case HostKeyCheckingYes:
+		err = fmt.Errorf("host %s is not in known_hosts (strict host key checking)", cleanHost)
+		return
+	case HostKeyCheckingAcceptNew, HostKeyCheckingNo:
+		err = writeKnownHost(config.KnownHostsFilePath, cleanHost, pubKeyType, remotePubKey)
+		return
 	}
 
 	// If global was set, don't ask user to add unknown key
@@ -323,6 +424,123 @@ func hostKeyCallback(ctx context.Context, hostname string, remote net.Addr, PubK
 	return
 }
 
+// Name of the server in known_hosts entries (address without port and IPv6 brackets)
+// Connections tunneled through a proxy hop have no remote address, the address that was dialed is used instead
+func knownHostName(hostname string, remote net.Addr) (cleanHost string, err error) {
+	remoteAddress := remote.String()
+	tcpAddress, isTCP := remote.(*net.TCPAddr)
+	if isTCP && tcpAddress.IP.IsUnspecified() {
+		remoteAddress = hostname
+	}
+
+	// Turn remote address into format used with known_hosts file entries
+	cleanHost, _, err = net.SplitHostPort(remoteAddress)
+	if err != nil {
+		err = fmt.Errorf("error with ssh server key check: unable to determine hostname in address: %w", err)
+		return
+	}
+
+	// If the remote addr is IPv6, extract the address part
+	// Only inside the brackets - OpenSSH does not include brackets when checking against known_hosts
+	if strings.Contains(cleanHost, "]") {
+		cleanHost = strings.TrimPrefix(cleanHost, "[")
+		cleanHost = strings.TrimSuffix(cleanHost, "]")
+	}
+	return
+}
+
+// Checks for a hashed known_hosts entry of the host with the given key
+func knownHostKeyMatches(knownHosts []string, host string, remotePubKey string) (keyIsKnown bool, err error) {
+	// Find an entry that matches the host we are handshaking with
+	for _, knownhostkey := range knownHosts {
+		entry, isHashed := parseKnownHostLine(knownhostkey)
+		if !isHashed {
+			continue
+		}
+
+		var hostMatches bool
+		hostMatches, err = entry.matchesHost(host)
+		if err != nil {
+			return
+		}
+
+		// Compare public keys
+		if hostMatches && entry.pubKey == remotePubKey {
+			keyIsKnown = true
+			return
+		}
+	}
+
+	return
+}
+
+// Checks for a hashed known_hosts entry of the host with a different key of the same type
+func knownHostKeyChanged(knownHosts []string, host string, pubKeyType string, remotePubKey string) (keyChanged bool, err error) {
+	for _, knownhostkey := range knownHosts {
+		entry, isHashed := parseKnownHostLine(knownhostkey)
+		if !isHashed || entry.pubKeyType != pubKeyType || entry.pubKey == remotePubKey {
+			continue
+		}
+
+		var hostMatches bool
+		hostMatches, err = entry.matchesHost(host)
+		if err != nil {
+			return
+		}
+		if hostMatches {
+			keyChanged = true
+			return
+		}
+	}
+	return
+}
+
+// Splits a hashed known_hosts line into its fields (other lines are not used)
+func parseKnownHostLine(line string) (entry knownHostEntry, isHashed bool) {
+	// Separate the public key section from the hashed host section
+	line = strings.TrimPrefix(line, "|")
+	knownhost := strings.SplitN(line, " ", 2)
+	if len(knownhost) < 2 {
+		return
+	}
+
+	// Only Process hashed lines of known_hosts
+	knownHostsPart := strings.Split(knownhost[0], "|")
+	if len(knownHostsPart) < 3 || knownHostsPart[0] != "1" {
+		return
+	}
+
+	// Ensure Key section has at least algorithm and key fields
+	knownkeysPart := strings.Fields(knownhost[1])
+	if len(knownkeysPart) < 2 {
+		return
+	}
+
+	entry.salt = knownHostsPart[1]
+	entry.hashedHost = knownHostsPart[2]
+	entry.pubKeyType = knownkeysPart[0]
+	entry.pubKey = strings.Join(knownkeysPart[1:], " ")
+	isHashed = true
+	return
+}
+
+// Hashes the host name with the entry salt and compares it to the hashed host of the entry
+func (entry knownHostEntry) matchesHost(host string) (matches bool, err error) {
+	saltBytes, err := base64.StdEncoding.DecodeString(entry.salt)
+	if err != nil {
+		err = fmt.Errorf("error decoding salt: %w", err)
+		return
+	}
+
+	// Create the HMAC-SHA1 using the salt as the key
+	hmacAlgo := hmac.New(sha1.New, saltBytes)
+	hmacAlgo.Write([]byte(host))
+	hashed := hmacAlgo.Sum(nil)
+
+	matches = base64.StdEncoding.EncodeToString(hashed) == entry.hashedHost
+	return
+}
+
 // Writes new public key for remote host to known_hosts file
 func writeKnownHost(knownHostsFilePath string, cleanHost string, pubKeyType string, remotePubKey string) (err error) {
 	// Show progress to user
@@ -1,7 +1,19 @@
 package sshinternal
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"scmp/internal/logctx"
+	"strings"
 	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
 func TestParseEndpointAddress(t *testing.T) {
@@ -22,9 +34,79 @@ func TestParseEndpointAddress(t *testing.T) {
 		{
 			endpointIP:   "2001:0db8:85a3:0000:0000:8a2e:0370:7334",
 			port:         "8080",
-			expectedAddr: "[2001:0db8:85a3:0000:0000:8a2e:0370:7334]:8080",
+			expectedAddr: "[2001:db8:85a3::8a2e:370:7334]:8080",
+			expectError:  false,
+		},
+		// Bracketed IPv6 is normalized the same as unbracketed
+		{
+			endpointIP:   "[2001:DB8::1]",
+			port:         "22",
+			expectedAddr: "[2001:db8::1]:22",
+			expectError:  false,
+		},
+		// IPv6 link-local with zone is bracketed with the zone kept
+		{
+			endpointIP:   "fe80::1%eth0",
+			port:         "22",
+			expectedAddr: "[fe80::1%eth0]:22",
+			expectError:  false,
+		},
+		// Bracketed IPv6 with zone
+		{
+			endpointIP:   "[FE80::0001%eth0]",
+			port:         "2222",
+			expectedAddr: "[fe80::1%eth0]:2222",
+			expectError:  false,
+		},
+		// IPv4-mapped IPv6 is dialed as IPv4
+		{
+			endpointIP:   "::ffff:192.0.2.1",
+			port:         "22",
+			expectedAddr: "192.0.2.1:22",
 			expectError:  false,
 		},
+		// Zones only exist for IPv6
+		{
+			endpointIP:   "192.0.2.1%eth0",
+			port:         "22",
+			expectedAddr: "",
+			expectError:  true,
+		},
+		// Empty zone
+		{
+			endpointIP:   "fe80::1%",
+			port:         "22",
+			expectedAddr: "",
+			expectError:  true,
+		},
+		// DNS name is lowercased without trailing dot
+		{
+			endpointIP:   "Web01.Example.COM.",
+			port:         "22",
+			expectedAddr: "web01.example.com:22",
+			expectError:  false,
+		},
+		// Invalid DNS name characters
+		{
+			endpointIP:   "web_01.example.com",
+			port:         "22",
+			expectedAddr: "",
+			expectError:  true,
+		},
+		// Invalid DNS name label
+		{
+			endpointIP:   "-web01.example.com",
+			port:         "22",
+			expectedAddr: "",
+			expectError:  true,
+		},
+		// Invalid IPv6 address
+		{
+			endpointIP:   "2001:db8::zz",
+			port:         "22",
+			expectedAddr: "",
+			expectError:  true,
+		},
 		// Invalid IP address
 		{
 			endpointIP:   "999.999.999.999",
@@ -74,3 +156,106 @@ func TestParseEndpointAddress(t *testing.T) {
 		})
 	}
 }
+
+// Builds an OpenSSH format private key file for a hardware-backed key (key handle only, like ssh-keygen -t ed25519-sk writes)
+func securityKeyStub(t *testing.T) (stub []byte, publicKey ssh.PublicKey) {
+	t.Helper()
+	edPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating key: %v", err)
+	}
+	publicKeyBytes := ssh.Marshal(struct {
+		KeyType     string
+		PublicKey   []byte
+		Application string
+	}{ssh.KeyAlgoSKED25519, edPublicKey, "ssh:"})
+	publicKey, err = ssh.ParsePublicKey(publicKeyBytes)
+	if err != nil {
+		t.Fatalf("failed parsing generated sk public key: %v", err)
+	}
+
+	header := ssh.Marshal(openSSHKeyHeader{
+		CipherName:   "none",
+		KdfName:      "none",
+		NumKeys:      1,
+		PubKey:       publicKeyBytes,
+		PrivKeyBlock: []byte("key handle"),
+	})
+	stub = pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: append([]byte(openSSHKeyMagic), header...)})
+	return
+}
+
+// Serves an agent holding a single regular key on a temporary socket
+func serveTestAgent(t *testing.T) {
+	t.Helper()
+	_, edPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating key: %v", err)
+	}
+	keyring := agent.NewKeyring()
+	err = keyring.Add(agent.AddedKey{PrivateKey: edPrivateKey})
+	if err != nil {
+		t.Fatalf("failed adding key to agent: %v", err)
+	}
+
+	agentSock := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", agentSock)
+	if err != nil {
+		t.Fatalf("failed listening on agent socket: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = agent.ServeAgent(keyring, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", agentSock)
+}
+
+func TestSecurityKeyIdentity(t *testing.T) {
+	stub, stubPublicKey := securityKeyStub(t)
+
+	publicKey, err := securityKeyPublicKey(stub)
+	if err != nil {
+		t.Fatalf("expected no error, got '%v'", err)
+	}
+	if publicKey == nil || !bytes.Equal(publicKey.Marshal(), stubPublicKey.Marshal()) {
+		t.Fatalf("expected public key from stub, got '%v'", publicKey)
+	}
+
+	// Regular keys are not treated as security keys
+	_, edPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating key: %v", err)
+	}
+	pemBlock, err := ssh.MarshalPrivateKey(edPrivateKey, "")
+	if err != nil {
+		t.Fatalf("failed marshaling key: %v", err)
+	}
+	publicKey, err = securityKeyPublicKey(pem.EncodeToMemory(pemBlock))
+	if err != nil || publicKey != nil {
+		t.Errorf("expected regular key to be ignored, got '%v' '%v'", publicKey, err)
+	}
+
+	// Stub falls back to agent, which does not hold the key
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	identityFile := filepath.Join(t.TempDir(), "id_ed25519_sk")
+	err = os.WriteFile(identityFile, stub, 0600)
+	if err != nil {
+		t.Fatalf("failed writing identity file: %v", err)
+	}
+	serveTestAgent(t)
+
+	_, _, err = IdentityToKey(ctx, identityFile)
+	if err == nil || !strings.Contains(err.Error(), "agent does not hold security key") {
+		t.Errorf("expected missing security key error, got '%v'", err)
+	}
+}
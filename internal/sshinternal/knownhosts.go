@@ -0,0 +1,179 @@
+package sshinternal
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"scmp/internal/config"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Names the keys of a host may be pinned under (host name and the host of every address)
+func KnownHostAliases(hostInfo config.EndpointInfo) (aliases []string) {
+	aliases = []string{string(hostInfo.EndpointName)}
+	for _, endpoint := range hostInfo.Endpoints() {
+		endpointHost, _, err := net.SplitHostPort(endpoint)
+		if err == nil {
+			aliases = append(aliases, endpointHost)
+		}
+	}
+	return
+}
+
+// Reads the host key of a server without authenticating, through each proxy hop in order (if any)
+// Unreachable addresses fail over to the next configured address of the host
+func ScanHostKey(ctx context.Context, hostInfo config.EndpointInfo, proxyChain []config.EndpointInfo) (scanned ScannedHostKey, err error) {
+	if hostInfo.EndpointError != nil {
+		err = hostInfo.EndpointError
+		return
+	}
+	endpoints := hostInfo.Endpoints()
+	if len(endpoints) == 0 {
+		err = fmt.Errorf("host has no address configured")
+		return
+	}
+
+	proxyConn, err := connectProxyChain(ctx, hostInfo, proxyChain)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = proxyConn.Close()
+	}()
+
+	for _, endpoint := range endpoints {
+		scanned, err = readHostKey(ctx, proxyConn.lastClient(), hostInfo, endpoint)
+		if !errors.Is(err, ErrEndpointUnreachable) {
+			return
+		}
+	}
+	return
+}
+
+// Runs the SSH handshake to a single address only until the server presents its host key
+func readHostKey(ctx context.Context, through *ssh.Client, hostInfo config.EndpointInfo, endpoint string) (scanned ScannedHostKey, err error) {
+	SSHconfig, _ := setupSSHConfig(ctx, hostInfo)
+	SSHconfig.Auth = nil
+
+	var keyErr error
+	SSHconfig.HostKeyCallback = func(hostname string, remote net.Addr, pubKey ssh.PublicKey) error {
+		scanned.KnownHostName, keyErr = knownHostName(hostname, remote)
+		scanned.Key = pubKey
+		return fmt.Errorf("host key read, closing connection")
+	}
+
+	var conn net.Conn
+	if through == nil {
+		dialer := net.Dialer{Timeout: SSHconfig.Timeout}
+		conn, err = dialer.DialContext(ctx, "tcp", endpoint)
+	} else {
+		conn, err = through.Dial("tcp", endpoint)
+	}
+	if err != nil {
+		err = fmt.Errorf("failed TCP connection to server %s: %w: %w", endpoint, ErrEndpointUnreachable, err)
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_, _, _, err = ssh.NewClientConn(conn, endpoint, SSHconfig)
+	if scanned.Key == nil {
+		err = fmt.Errorf("failed SSH handshake to server %s: %w", endpoint, err)
+		return
+	}
+	err = keyErr
+	scanned.Endpoint = endpoint
+	return
+}
+
+// Reports whether the scanned key is in known_hosts under any name of the host, a different key of the same type under the scanned name, or neither
+func HostKeyStatus(knownHosts []string, scanned ScannedHostKey, aliases []string) (status string, err error) {
+	remotePubKey := base64.StdEncoding.EncodeToString(scanned.Key.Marshal())
+
+	for _, name := range append([]string{scanned.KnownHostName}, aliases...) {
+		var keyIsKnown bool
+		keyIsKnown, err = knownHostKeyMatches(knownHosts, name, remotePubKey)
+		if err != nil {
+			return
+		}
+		if keyIsKnown {
+			status = HostKeyKnown
+			return
+		}
+	}
+
+	keyChanged, err := knownHostKeyChanged(knownHosts, scanned.KnownHostName, scanned.Key.Type(), remotePubKey)
+	if err != nil {
+		return
+	}
+	if keyChanged {
+		status = HostKeyChanged
+		return
+	}
+	status = HostKeyNew
+	return
+}
+
+// Writes a hashed known_hosts entry for the scanned key
+func AddKnownHost(knownHostsFilePath string, scanned ScannedHostKey) (err error) {
+	err = writeKnownHost(knownHostsFilePath, scanned.KnownHostName, scanned.Key.Type(), base64.StdEncoding.EncodeToString(scanned.Key.Marshal()))
+	return
+}
+
+// Removes every hashed known_hosts entry of the given names, other lines are kept as they are
+func RemoveKnownHosts(knownHostsFilePath string, names []string) (removed int, err error) {
+	knownHostMutex.Lock()
+	defer knownHostMutex.Unlock()
+
+	fileInfo, err := os.Stat(knownHostsFilePath)
+	if err != nil {
+		err = fmt.Errorf("failed to read known_hosts file: %w", err)
+		return
+	}
+	knownHostsFile, err := os.ReadFile(knownHostsFilePath)
+	if err != nil {
+		err = fmt.Errorf("failed to read known_hosts file: %w", err)
+		return
+	}
+
+	var keptLines []string
+	for _, line := range strings.SplitAfter(string(knownHostsFile), "\n") {
+		entry, isHashed := parseKnownHostLine(strings.TrimSpace(line))
+		if !isHashed {
+			keptLines = append(keptLines, line)
+			continue
+		}
+
+		var hostMatches bool
+		for _, name := range names {
+			hostMatches, err = entry.matchesHost(name)
+			if err != nil || hostMatches {
+				break
+			}
+		}
+		if err != nil {
+			return
+		}
+		if hostMatches {
+			removed++
+			continue
+		}
+		keptLines = append(keptLines, line)
+	}
+	if removed == 0 {
+		return
+	}
+
+	err = os.WriteFile(knownHostsFilePath, []byte(strings.Join(keptLines, "")), fileInfo.Mode().Perm())
+	if err != nil {
+		err = fmt.Errorf("failed to write known_hosts file: %w", err)
+		return
+	}
+	return
+}
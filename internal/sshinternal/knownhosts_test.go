@@ -0,0 +1,202 @@
+package sshinternal
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net"
+	"os"
+	"path/filepath"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func testHostKey(t *testing.T) (hostKey ssh.PublicKey) {
+	t.Helper()
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating host key: %v", err)
+	}
+	hostKey, err = ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("failed converting host key: %v", err)
+	}
+	return
+}
+
+func TestHostKeyCallbackStrictModes(t *testing.T) {
+	knownKey := testHostKey(t)
+	otherKey := testHostKey(t)
+	knownEntry := knownhosts.HashHostname("10.0.0.5") + " " + knownKey.Type() + " " + base64.StdEncoding.EncodeToString(knownKey.Marshal())
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 22}
+
+	tests := []struct {
+		name          string
+		mode          string
+		presentedKey  ssh.PublicKey
+		expectError   bool
+		expectWritten bool
+	}{
+		{"yes known key", HostKeyCheckingYes, knownKey, false, false},
+		{"yes changed key", HostKeyCheckingYes, otherKey, true, false},
+		{"accept-new changed key", HostKeyCheckingAcceptNew, otherKey, true, false},
+		{"no changed key", HostKeyCheckingNo, otherKey, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+			err := os.WriteFile(knownHostsPath, []byte(knownEntry+"\n"), 0600)
+			if err != nil {
+				t.Fatalf("failed writing known_hosts: %v", err)
+			}
+
+			ctx := t.Context()
+			ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+			ctx = context.WithValue(ctx, global.ConfKey, config.Config{
+				KnownHosts:         []string{knownEntry},
+				KnownHostsFilePath: knownHostsPath,
+				HostKeyChecking:    test.mode,
+			})
+
+			err = hostKeyCallback(ctx, "10.0.0.5:22", remote, test.presentedKey, nil)
+			if test.expectError && err == nil {
+				t.Errorf("expected connection to be refused")
+			}
+			if !test.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			knownHosts, err := os.ReadFile(knownHostsPath)
+			if err != nil {
+				t.Fatalf("failed reading known_hosts: %v", err)
+			}
+			written := strings.Count(string(knownHosts), "\n") > 1
+			if written != test.expectWritten {
+				t.Errorf("expected key written %t, got %t", test.expectWritten, written)
+			}
+		})
+	}
+
+	// Changed keys are refused without a mode, even when every unknown host is accepted
+	for _, addAllUnknownHosts := range []bool{false, true} {
+		knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+		err := os.WriteFile(knownHostsPath, []byte(knownEntry+"\n"), 0600)
+		if err != nil {
+			t.Fatalf("failed writing known_hosts: %v", err)
+		}
+		ctx := t.Context()
+		ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+		ctx = context.WithValue(ctx, global.ConfKey, config.Config{
+			KnownHosts:         []string{knownEntry},
+			KnownHostsFilePath: knownHostsPath,
+			AddAllUnknownHosts: addAllUnknownHosts,
+		})
+
+		err = hostKeyCallback(ctx, "10.0.0.5:22", remote, otherKey, nil)
+		knownHosts, _ := os.ReadFile(knownHostsPath)
+		keyIsKnown, _ := knownHostKeyMatches(strings.Split(string(knownHosts), "\n"), "10.0.0.5", base64.StdEncoding.EncodeToString(otherKey.Marshal()))
+		if err == nil || keyIsKnown {
+			t.Errorf("add all unknown hosts %t: expected changed key refused and not written, got err '%v' written %t", addAllUnknownHosts, err, keyIsKnown)
+		}
+	}
+
+	// Unknown hosts are refused by yes and written by accept-new
+	for _, mode := range []string{HostKeyCheckingYes, HostKeyCheckingAcceptNew} {
+		knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+		err := os.WriteFile(knownHostsPath, nil, 0600)
+		if err != nil {
+			t.Fatalf("failed writing known_hosts: %v", err)
+		}
+		ctx := t.Context()
+		ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+		ctx = context.WithValue(ctx, global.ConfKey, config.Config{KnownHostsFilePath: knownHostsPath, HostKeyChecking: mode})
+
+		err = hostKeyCallback(ctx, "10.0.0.5:22", remote, otherKey, nil)
+		knownHosts, _ := os.ReadFile(knownHostsPath)
+		keyIsKnown, _ := knownHostKeyMatches(strings.Split(string(knownHosts), "\n"), "10.0.0.5", base64.StdEncoding.EncodeToString(otherKey.Marshal()))
+		if mode == HostKeyCheckingYes && (err == nil || keyIsKnown) {
+			t.Errorf("mode %s: expected unknown host refused and not written, got err '%v' written %t", mode, err, keyIsKnown)
+		}
+		if mode == HostKeyCheckingAcceptNew && (err != nil || !keyIsKnown) {
+			t.Errorf("mode %s: expected unknown host written, got err '%v' written %t", mode, err, keyIsKnown)
+		}
+	}
+}
+
+func TestScanAddRemoveKnownHost(t *testing.T) {
+	serverEndpoint, hostKey := serveTestSSH(t, nil)
+
+	knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+	otherEntry := knownhosts.HashHostname("db01") + " " + hostKey.Type() + " " + base64.StdEncoding.EncodeToString(testHostKey(t).Marshal())
+	err := os.WriteFile(knownHostsPath, []byte("# comment\n"+otherEntry+"\n"), 0600)
+	if err != nil {
+		t.Fatalf("failed writing known_hosts: %v", err)
+	}
+
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.ConfKey, config.Config{KnownHostsFilePath: knownHostsPath, HostKeyChecking: HostKeyCheckingYes})
+
+	hostInfo := config.EndpointInfo{
+		EndpointName:   "web01",
+		Endpoint:       serverEndpoint,
+		ConnectTimeout: 2,
+	}
+
+	// Key is read before authentication, unknown hosts are not refused while scanning
+	scanned, err := ScanHostKey(ctx, hostInfo, nil)
+	if err != nil {
+		t.Fatalf("unexpected scan error: %v", err)
+	}
+	if scanned.Endpoint != serverEndpoint || scanned.KnownHostName != "127.0.0.1" || ssh.FingerprintSHA256(scanned.Key) != ssh.FingerprintSHA256(hostKey) {
+		t.Fatalf("unexpected scanned key: %+v", scanned)
+	}
+
+	readKnownHosts := func() (knownHosts []string) {
+		content, err := os.ReadFile(knownHostsPath)
+		if err != nil {
+			t.Fatalf("failed reading known_hosts: %v", err)
+		}
+		knownHosts = strings.Split(string(content), "\n")
+		return
+	}
+
+	status, err := HostKeyStatus(readKnownHosts(), scanned, KnownHostAliases(hostInfo))
+	if err != nil || status != HostKeyNew {
+		t.Fatalf("expected new key, got '%s' (%v)", status, err)
+	}
+
+	err = AddKnownHost(knownHostsPath, scanned)
+	if err != nil {
+		t.Fatalf("unexpected add error: %v", err)
+	}
+	status, err = HostKeyStatus(readKnownHosts(), scanned, KnownHostAliases(hostInfo))
+	if err != nil || status != HostKeyKnown {
+		t.Fatalf("expected known key after add, got '%s' (%v)", status, err)
+	}
+
+	// Same name with another key of the same type
+	changed := scanned
+	changed.Key = testHostKey(t)
+	status, err = HostKeyStatus(readKnownHosts(), changed, KnownHostAliases(hostInfo))
+	if err != nil || status != HostKeyChanged {
+		t.Fatalf("expected changed key, got '%s' (%v)", status, err)
+	}
+
+	removed, err := RemoveKnownHosts(knownHostsPath, []string{"web01", "127.0.0.1"})
+	if err != nil || removed != 1 {
+		t.Fatalf("expected one entry removed, got %d (%v)", removed, err)
+	}
+	remaining := readKnownHosts()
+	if len(remaining) != 3 || remaining[0] != "# comment" || remaining[1] != otherEntry {
+		t.Errorf("expected other lines kept, got %q", remaining)
+	}
+}
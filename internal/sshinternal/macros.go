@@ -3,6 +3,7 @@ package sshinternal
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"scmp/core/deployment"
 	"scmp/internal/config"
@@ -11,118 +12,111 @@ import (
 	"scmp/internal/parsing"
 	"scmp/internal/str"
 	"strings"
+	"time"
 )
 
 // Transfers file into place with correct permissions and ownership
 func CreateRemoteFile(ctx context.Context, host HostMeta, targetFilePath str.RemotePath, fileContents []byte, fileContentHash string, fileOwnerGroup string, filePermissions int) (err error) {
-	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
-
-	// Check if remote dir exists, if not create
-	directoryPath := str.FilePathDir(targetFilePath)
-	directoryExists, _, err := CheckRemoteFileDirExistence(ctx, host, directoryPath)
-	if err != nil {
-		err = fmt.Errorf("failed checking directory existence: %w", err)
+	upload := func(uploadCtx context.Context, bufferFilePath str.RemotePath) (err error) {
+		err = SCPUpload(uploadCtx, host.SSHClient, host.Bandwidth, fileContents, bufferFilePath)
 		return
 	}
-	if !directoryExists {
-		command := BuildMkdir(directoryPath)
-		command.DisableSudo = opts.DisableSudo
-		command.RunAsUser = opts.RunAsUser
+	err = placeRemoteFile(ctx, host, targetFilePath, upload, int64(len(fileContents)), fileContentHash, fileOwnerGroup, filePermissions)
+	return
+}
 
-		_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
-		if err != nil {
-			err = fmt.Errorf("failed to create directory: %w", err)
-			return
-		}
+// Transfers local file into place with correct permissions and ownership, streaming content from disk
+func CreateRemoteFileFromDisk(ctx context.Context, host HostMeta, targetFilePath str.RemotePath, localFilePath string, localFileSize int64, fileContentHash string, fileOwnerGroup string, filePermissions int) (err error) {
+	upload := func(uploadCtx context.Context, bufferFilePath str.RemotePath) (err error) {
+		err = SFTPUploadFile(uploadCtx, host, localFilePath, localFileSize, bufferFilePath)
+		return
 	}
+	err = placeRemoteFile(ctx, host, targetFilePath, upload, localFileSize, fileContentHash, fileOwnerGroup, filePermissions)
+	return
+}
+
+// Uploads content to a buffer file, then moves it into place and verifies the deployed hash
+func placeRemoteFile(ctx context.Context, host HostMeta, targetFilePath str.RemotePath, upload func(uploadCtx context.Context, bufferFilePath str.RemotePath) error, transferSize int64, fileContentHash string, fileOwnerGroup string, filePermissions int) (err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+	transferCtx := WithPhase(ctx, PhaseTransfer)
+	verifyCtx := WithPhase(ctx, PhaseVerify)
 
 	// Unique file name for buffer file
 	tempFileName := str.RemotePath(base64.URLEncoding.EncodeToString([]byte(targetFilePath)))
 	bufferFilePath := host.TransferBufferDir + "/" + tempFileName
 
-	// SCP to temp file
-	err = SCPUpload(ctx, host.SSHClient, fileContents, bufferFilePath)
+	// Transfer to temp file (uploads are not commands, failure context is recorded here)
+	uploadStart := time.Now()
+	err = uploadWithTimeout(ctx, opts.TransferTimeout, transferSize, bufferFilePath, upload)
 	if err != nil {
+		err = &CommandError{Phase: PhaseTransfer, Command: "upload " + string(bufferFilePath), ExitCode: ExitCodeNone, Elapsed: time.Since(uploadStart), Err: err}
 		return
 	}
 
-	// Ensure owner/group are correct
-	command := BuildChown(fileOwnerGroup, bufferFilePath)
-	command.DisableSudo = opts.DisableSudo
-	command.RunAsUser = opts.RunAsUser
-
-	_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
-	if err != nil {
-		err = fmt.Errorf("failed SSH Command on host during owner/group change: %w", err)
-		return
-	}
-
-	// Ensure permissions are correct
-	command = BuildChmod(filePermissions, bufferFilePath)
-	command.DisableSudo = opts.DisableSudo
-	command.RunAsUser = opts.RunAsUser
-
-	_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
+	// Move file from tmp dir to actual deployment path with its final owner/group and permissions (creating the directory if missing)
+	err = moveIntoPlace(transferCtx, host, bufferFilePath, targetFilePath, fileOwnerGroup, filePermissions, true)
 	if err != nil {
-		err = fmt.Errorf("failed SSH Command on host during permissions change: %w", err)
 		return
 	}
 
-	// Move file from tmp dir to actual deployment path
-	command = BuildMv(bufferFilePath, targetFilePath)
+	// Ensure final file is present and intact
+	command := BuildHostHash(host, targetFilePath)
 	command.DisableSudo = opts.DisableSudo
 	command.RunAsUser = opts.RunAsUser
 
-	_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
-	if err != nil {
-		err = fmt.Errorf("failed to move new file into place: %w", err)
-		return
-	}
-
-	// Check if deployed file is present on disk
-	newFileExists, _, err := CheckRemoteFileDirExistence(ctx, host, targetFilePath)
-	if err != nil {
-		err = fmt.Errorf("error checking deployed file presence on remote host: %w", err)
+	hashStart := time.Now()
+	commandOutput, err := command.SSHexec(verifyCtx, host.SSHClient, host.Password)
+	if err != nil && strings.Contains(err.Error(), "No such file or directory") {
+		err = fmt.Errorf("deployed file on remote host is not present after file transfer: %w", err)
 		return
-	}
-	if !newFileExists {
-		err = fmt.Errorf("deployed file on remote host is not present after file transfer")
-		return
-	}
-
-	// Ensure final file is intact
-	command = BuildHashCmd(targetFilePath)
-	command.DisableSudo = opts.DisableSudo
-	command.RunAsUser = opts.RunAsUser
-
-	commandOutput, err := command.SSHexec(ctx, host.SSHClient, host.Password)
-	if err != nil {
-		err = fmt.Errorf("failed SSH Command on host during hash of deployed file: %w", err)
+	} else if err != nil {
+		err = fmt.Errorf("hash of deployed file: %w", err)
 		return
 	}
 
+	// Successful hash commands with unexpected output still record what the remote returned
+	hashFailure := CommandError{Phase: PhaseVerify, Command: command.Raw, Output: tailOutput(commandOutput), Elapsed: time.Since(hashStart)}
 	validHash, newRemoteFileHash := parsing.HasHex64Prefix(commandOutput)
 	if !validHash {
-		err = fmt.Errorf("invalid hash received from remote sha256sum command")
+		hashFailure.Err = fmt.Errorf("invalid hash received from remote sha256sum command")
+		err = &hashFailure
 		return
 	}
 
 	if newRemoteFileHash != fileContentHash {
-		err = fmt.Errorf("hash of config file post deployment does not match hash of pre deployment")
+		hashFailure.Err = fmt.Errorf("hash of config file post deployment does not match hash of pre deployment")
+		err = &hashFailure
 		return
 	}
 
 	return
 }
 
-func ExecuteScript(ctx context.Context, host HostMeta, scriptInterpreter string, remoteFilePath str.RemotePath, scriptFileBytes []byte, scriptHash string, streamOutput bool) (out string, err error) {
+// Runs an upload, aborting it when it exceeds the transfer timeout for its size
+func uploadWithTimeout(ctx context.Context, configuredTimeout time.Duration, transferSize int64, bufferFilePath str.RemotePath, upload func(uploadCtx context.Context, bufferFilePath str.RemotePath) error) (err error) {
+	timeout := TransferTimeout(configuredTimeout, transferSize)
+	uploadCtx, cancel := context.WithTimeoutCause(ctx, timeout, ErrTransferTimeout)
+	defer cancel()
+
+	err = upload(uploadCtx, bufferFilePath)
+	if err != nil && errors.Is(context.Cause(uploadCtx), ErrTransferTimeout) {
+		err = fmt.Errorf("%w after %s (%d bytes)", ErrTransferTimeout, timeout, transferSize)
+	}
+	return
+}
+
+func ExecuteScript(ctx context.Context, host HostMeta, scriptInterpreter string, remoteFilePath str.RemotePath, scriptFileBytes []byte, scriptHash string, streamOutput bool, capture *CommandCapture) (out string, err error) {
 	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
 
 	// Unique file name for buffer file
 	tempFileName := str.RemotePath(base64.URLEncoding.EncodeToString([]byte(remoteFilePath)))
 	bufferFilePath := host.TransferBufferDir + "/" + tempFileName
 
-	err = SCPUpload(ctx, host.SSHClient, scriptFileBytes, bufferFilePath)
+	upload := func(uploadCtx context.Context, bufferFilePath str.RemotePath) (err error) {
+		err = SCPUpload(uploadCtx, host.SSHClient, host.Bandwidth, scriptFileBytes, bufferFilePath)
+		return
+	}
+	err = uploadWithTimeout(ctx, opts.TransferTimeout, int64(len(scriptFileBytes)), bufferFilePath, upload)
 	if err != nil {
 		return
 	}
@@ -137,7 +131,7 @@ func ExecuteScript(ctx context.Context, host HostMeta, scriptInterpreter string,
 		return
 	}
 
-	command = BuildHashCmd(remoteFilePath)
+	command = BuildHostHash(host, remoteFilePath)
 	remoteScriptHash, err := command.SSHexec(ctx, host.SSHClient, host.Password)
 	if err != nil {
 		return
@@ -164,9 +158,10 @@ func ExecuteScript(ctx context.Context, host HostMeta, scriptInterpreter string,
 	}
 
 	if !opts.WetRunEnabled {
-		command.Raw = scriptInterpreter + " '" + string(remoteFilePath) + "'"
+		command.Raw = scriptInterpreter + " " + QuoteShellArg(string(remoteFilePath))
 		command.Timeout = opts.ExecutionTimeout
 		command.StreamStdout = streamOutput
+		command.Capture = capture
 		out, err = command.SSHexec(ctx, host.SSHClient, host.Password)
 		if err != nil {
 			return
@@ -209,12 +204,36 @@ func ExecuteScript(ctx context.Context, host HostMeta, scriptInterpreter string,
 	return
 }
 
-// Checks if file/dir is already present on remote host
-// Also retrieve metadata for file/dir
-func CheckRemoteFileDirExistence(ctx context.Context, host HostMeta, remotePath str.RemotePath) (exists bool, statOutput string, err error) {
+// Runs the commands as one batch (see BuildBatch) with the sudo options of the deployment
+// The error of a failed step describes that step alone, failedStep is -1 when no step failed
+func RunBatch(ctx context.Context, host HostMeta, commands ...RemoteCommand) (output string, failedStep int, err error) {
 	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
 
-	var command RemoteCommand
+	command := BuildBatch(commands...)
+	command.DisableSudo = opts.DisableSudo
+	command.RunAsUser = opts.RunAsUser
+
+	output, err = command.SSHexec(ctx, host.SSHClient, host.Password)
+	failedStep, err = BatchStepError(commands, err)
+	return
+}
+
+// Stat command of the probed stat variant (or the hosts OS family when not probed), its output is parsed by ExtractMetadataFromStat
+func BuildHostStat(host HostMeta, remotePath str.RemotePath) (command RemoteCommand, err error) {
+	if host.Utilities.Probed {
+		switch host.Utilities.Stat {
+		case StatGNU:
+			command = BuildStat(remotePath)
+		case StatBusyBox:
+			command = BuildBusyBoxStat(remotePath)
+		case StatBSD:
+			command = BuildBSDStat(remotePath)
+		default:
+			err = fmt.Errorf("no supported stat command on remote host")
+		}
+		return
+	}
+
 	switch host.OSFamily {
 	case "bsd":
 		command = BuildBSDStat(remotePath)
@@ -222,6 +241,73 @@ func CheckRemoteFileDirExistence(ctx context.Context, host HostMeta, remotePath
 		command = BuildStat(remotePath)
 	default:
 		err = fmt.Errorf("unknown OS family")
+	}
+	return
+}
+
+// Checksum command of the host (sha256sum unless probing found another)
+func (host HostMeta) hashCommand() (hashCmd string) {
+	hashCmd = host.Utilities.Hash
+	if hashCmd == "" {
+		hashCmd = HashSha256sum
+	}
+	return
+}
+
+// Hashes a remote file with the checksum command of the host
+func BuildHostHash(host HostMeta, remotePath str.RemotePath) (command RemoteCommand) {
+	command = buildHashCmd(host.hashCommand(), remotePath)
+	return
+}
+
+// Hashes the path with the checksum command of the host only when it is a regular file, printing nothing otherwise
+func BuildHostHashIfFile(host HostMeta, remotePath str.RemotePath) (command RemoteCommand) {
+	command = buildHashIfFile(host.hashCommand(), remotePath)
+	return
+}
+
+// Hashes only the leading bytes of a file with the checksum command of the host
+func BuildHostPartialHash(host HostMeta, remotePath str.RemotePath, length int64) (command RemoteCommand) {
+	command = buildPartialHashCmd(host.hashCommand(), remotePath, length)
+	return
+}
+
+// Parses the output of BuildUtilitiesProbe
+func ParseUtilitiesProbe(probeOutput string) (utilities RemoteUtilities) {
+	utilities.Probed = true
+	for line := range strings.SplitSeq(strings.ReplaceAll(probeOutput, "\r", ""), "\n") {
+		kind, value, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch kind {
+		case "missing":
+			utilities.Missing = append(utilities.Missing, value)
+		case "stat":
+			utilities.Stat = value
+		case "hash":
+			utilities.Hash = value
+		}
+	}
+	return
+}
+
+// Required commands (including stat and a checksum command) the probe did not find
+func (utilities RemoteUtilities) MissingCommands() (missing []string) {
+	missing = append(missing, utilities.Missing...)
+	if utilities.Stat == "" {
+		missing = append(missing, "stat (GNU, BusyBox, or BSD)")
+	}
+	if utilities.Hash == "" {
+		missing = append(missing, "sha256sum (or shasum, sha256)")
+	}
+	return
+}
+
+// Checks if file/dir is already present on remote host
+// Also retrieve metadata for file/dir
+func CheckRemoteFileDirExistence(ctx context.Context, host HostMeta, remotePath str.RemotePath) (exists bool, statOutput string, err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	command, err := BuildHostStat(host, remotePath)
+	if err != nil {
 		return
 	}
 	command.DisableSudo = opts.DisableSudo
@@ -241,36 +327,39 @@ func CheckRemoteFileDirExistence(ctx context.Context, host HostMeta, remotePath
 }
 
 // Modifies metadata if supplied remote file/dir metadata does not match supplied metadata
+// Permissions are first narrowed to what both the old and new metadata allow, so no step grants more than either
+// Ownership changes clear setuid and setgid bits, so final permissions are always set after the owner
 func ModifyMetadata(ctx context.Context, host HostMeta, remoteMetadata RemoteFileInfo, localMetadata deployment.FileInfo) (err error) {
 	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+	ctx = WithPhase(ctx, PhaseMetadata)
 
-	// Change permissions if different
-	if remoteMetadata.Permissions != localMetadata.Permissions {
-		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "   File '%s': changing permissions\n", host.Name, localMetadata.TargetFilePath)
-
-		command := BuildChmod(localMetadata.Permissions, localMetadata.TargetFilePath)
-		command.DisableSudo = opts.DisableSudo
-		command.RunAsUser = opts.RunAsUser
+	permissionsDiffer := remoteMetadata.Permissions != localMetadata.Permissions
+	remoteOwnerGroup := remoteMetadata.Owner + ":" + remoteMetadata.Group
+	ownershipDiffers := remoteOwnerGroup != localMetadata.OwnerGroup
 
-		_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
-		if err != nil {
-			err = fmt.Errorf("failed SSH Command on host during permissions change: %w", err)
-			return
+	var commands []RemoteCommand
+	if ownershipDiffers && permissionsDiffer {
+		commonPermissions := IntersectPermissions(remoteMetadata.Permissions, localMetadata.Permissions)
+		if commonPermissions != remoteMetadata.Permissions {
+			commands = append(commands, BuildChmod(commonPermissions, localMetadata.TargetFilePath))
 		}
 	}
+	if ownershipDiffers {
+		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "   File '%s': changing ownership\n", localMetadata.TargetFilePath)
+		commands = append(commands, BuildChown(localMetadata.OwnerGroup, localMetadata.TargetFilePath))
+	}
+	if permissionsDiffer || (ownershipDiffers && HasSpecialPermissions(localMetadata.Permissions)) {
+		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "   File '%s': changing permissions\n", localMetadata.TargetFilePath)
+		commands = append(commands, BuildChmod(localMetadata.Permissions, localMetadata.TargetFilePath))
+	}
 
-	// Change ownership if different
-	remoteOwnerGroup := remoteMetadata.Owner + ":" + remoteMetadata.Group
-	if remoteOwnerGroup != localMetadata.OwnerGroup {
-		logctx.LogEvent(ctx, logctx.VerbosityFullData, logctx.InfoLog, "   File '%s': changing ownership\n", host.Name, localMetadata.TargetFilePath)
-
-		command := BuildChown(localMetadata.OwnerGroup, localMetadata.TargetFilePath)
+	for _, command := range commands {
 		command.DisableSudo = opts.DisableSudo
 		command.RunAsUser = opts.RunAsUser
 
 		_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
 		if err != nil {
-			err = fmt.Errorf("failed SSH Command on host during owner/group change: %w", err)
+			err = fmt.Errorf("owner/group or permissions change: %w", err)
 			return
 		}
 	}
@@ -0,0 +1,131 @@
+package sshinternal
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"strconv"
+)
+
+// Moves a file to the target path with its final owner/group and permissions already applied
+// The source is secured where it is, moved to a hidden file beside the target, then renamed over the target,
+// so the target path only ever shows the old file or the fully secured new file (the rename is atomic within a directory)
+// Falls back to securing the target after the rename only when the source filesystem or tooling refuses the ownership change
+func MoveIntoPlace(ctx context.Context, host HostMeta, sourcePath str.RemotePath, targetPath str.RemotePath, ownerGroup string, permissions int) (err error) {
+	err = moveIntoPlace(ctx, host, sourcePath, targetPath, ownerGroup, permissions, false)
+	return
+}
+
+// All steps run as one batch, a failed step is reported as if it ran on its own
+func moveIntoPlace(ctx context.Context, host HostMeta, sourcePath str.RemotePath, targetPath str.RemotePath, ownerGroup string, permissions int, createDirectory bool) (err error) {
+	// Moves across filesystems copy the content, which must not happen at the target path
+	stagedPath := str.RemotePath(path.Join(path.Dir(string(targetPath)), "."+path.Base(string(targetPath))+StagedFileSuffix))
+
+	var steps []RemoteCommand
+	if createDirectory {
+		steps = append(steps, BuildMkdir(str.FilePathDir(targetPath)))
+	}
+	chownStep := len(steps)
+	steps = append(steps,
+		BuildChown(ownerGroup, sourcePath),
+		BuildChmod(permissions, sourcePath),
+		BuildMv(sourcePath, stagedPath),
+		BuildMv(stagedPath, targetPath),
+	)
+
+	_, failedStep, err := RunBatch(ctx, host, steps...)
+	switch {
+	case err == nil:
+	case failedStep < 0:
+		err = fmt.Errorf("failed to move new file into place: %w", err)
+	case createDirectory && failedStep == 0:
+		err = fmt.Errorf("failed to create directory: %w", err)
+	case failedStep == chownStep && (IsNotPermitted(err) || IsNotSupported(err) || IsCommandNotFound(err)):
+		logctx.LogStdWarn(ctx, "File '%s': unable to set owner/group before placement on host %s, setting it after the move: %v\n", targetPath, host.Name, err)
+		err = secureAfterMove(ctx, host, sourcePath, stagedPath, targetPath, ownerGroup, permissions)
+	case failedStep == chownStep:
+		err = fmt.Errorf("owner/group change: %w", err)
+	case failedStep == chownStep+1:
+		err = fmt.Errorf("permissions change: %w", err)
+	case failedStep == chownStep+2:
+		err = fmt.Errorf("failed to stage new file beside target: %w", err)
+	default:
+		err = fmt.Errorf("failed to move new file into place: %w", err)
+		lerr := runPlacementCommand(ctx, host, BuildRm(stagedPath))
+		if lerr != nil {
+			err = fmt.Errorf("%w: staged file cleanup failed: %w", err, lerr)
+		}
+	}
+	return
+}
+
+// Places the file before setting its owner/group, one command at a time
+// Ownership changes clear setuid and setgid bits, so permissions always follow the owner
+// Special bits are never granted while the file still has the wrong owner
+func secureAfterMove(ctx context.Context, host HostMeta, sourcePath str.RemotePath, stagedPath str.RemotePath, targetPath str.RemotePath, ownerGroup string, permissions int) (err error) {
+	err = runPlacementCommand(ctx, host, BuildChmod(permissions%1000, sourcePath))
+	if err != nil {
+		err = fmt.Errorf("permissions change: %w", err)
+		return
+	}
+
+	err = runPlacementCommand(ctx, host, BuildMv(sourcePath, stagedPath))
+	if err != nil {
+		err = fmt.Errorf("failed to stage new file beside target: %w", err)
+		return
+	}
+
+	err = runPlacementCommand(ctx, host, BuildMv(stagedPath, targetPath))
+	if err != nil {
+		err = fmt.Errorf("failed to move new file into place: %w", err)
+		lerr := runPlacementCommand(ctx, host, BuildRm(stagedPath))
+		if lerr != nil {
+			err = fmt.Errorf("%w: staged file cleanup failed: %w", err, lerr)
+		}
+		return
+	}
+
+	err = runPlacementCommand(ctx, host, BuildChown(ownerGroup, targetPath))
+	if err != nil {
+		err = fmt.Errorf("owner/group change: %w", err)
+		return
+	}
+	err = runPlacementCommand(ctx, host, BuildChmod(permissions, targetPath))
+	if err != nil {
+		err = fmt.Errorf("permissions change: %w", err)
+		return
+	}
+	return
+}
+
+func runPlacementCommand(ctx context.Context, host HostMeta, command RemoteCommand) (err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+	command.DisableSudo = opts.DisableSudo
+	command.RunAsUser = opts.RunAsUser
+	_, err = command.SSHexec(ctx, host.SSHClient, host.Password)
+	return
+}
+
+// Permission bits granted by both octal permission values (e.g. 640 and 604 have 600 in common)
+func IntersectPermissions(first int, second int) (common int) {
+	firstBits, err := strconv.ParseUint(strconv.Itoa(first), 8, 32)
+	if err != nil {
+		return
+	}
+	secondBits, err := strconv.ParseUint(strconv.Itoa(second), 8, 32)
+	if err != nil {
+		return
+	}
+	common, _ = strconv.Atoi(strconv.FormatUint(firstBits&secondBits, 8))
+	return
+}
+
+// Reports octal permission values with setuid, setgid or sticky bits
+func HasSpecialPermissions(permissions int) (special bool) {
+	special = permissions >= 1000
+	return
+}
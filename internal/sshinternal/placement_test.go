@@ -0,0 +1,315 @@
+package sshinternal
+
+import (
+	"context"
+	"scmp/core/deployment"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"scmp/internal/str"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Ownership, permissions and content of a file on the simulated remote host
+type simulatedFile struct {
+	ownerGroup  string
+	permissions int
+	content     string
+}
+
+// Remote filesystem answering chown, chmod, mv and rm, checking the target path after every command
+// Batches (see BuildBatch) are split into their steps, commands records every step
+type simulatedHost struct {
+	mutex      sync.Mutex
+	files      map[string]simulatedFile
+	commands   []string
+	roundTrips int
+	refuse     func(command string) (stderr string) // Failure output for commands the host refuses
+	targetPath string
+	allowed    func(file simulatedFile) (allowed bool) // States the target path may be in
+	violations []string
+}
+
+func (host *simulatedHost) handle(command string) (result testExecResult) {
+	host.mutex.Lock()
+	defer host.mutex.Unlock()
+
+	host.roundTrips++
+	script, isBatch := strings.CutPrefix(command, "sh -c '")
+	if !isBatch {
+		result = host.step(command)
+		return
+	}
+	script = strings.ReplaceAll(strings.TrimSuffix(script, "'"), `'\''`, "'")
+	for index, line := range strings.Split(script, "\n") {
+		stepCommand, _, _ := strings.Cut(line, " || {")
+		result = host.step(stepCommand)
+		if result.exitStatus != 0 {
+			result.stderr += "\n" + batchStepMarker + strconv.Itoa(index)
+			return
+		}
+	}
+	return
+}
+
+func (host *simulatedHost) step(command string) (result testExecResult) {
+	host.commands = append(host.commands, command)
+	if host.refuse != nil {
+		if stderr := host.refuse(command); stderr != "" {
+			result = testExecResult{stderr: stderr, exitStatus: 1}
+			return
+		}
+	}
+
+	fields := strings.Fields(command)
+	for index := range fields {
+		fields[index] = strings.Trim(fields[index], "'")
+	}
+	switch fields[0] {
+	case "chown":
+		file := host.files[fields[2]]
+		file.ownerGroup = fields[1]
+		// Ownership changes clear setuid and setgid bits
+		file.permissions = (file.permissions/1000&1)*1000 + file.permissions%1000
+		host.files[fields[2]] = file
+	case "chmod":
+		file := host.files[fields[2]]
+		file.permissions, _ = strconv.Atoi(fields[1])
+		host.files[fields[2]] = file
+	case "mv":
+		host.files[fields[2]] = host.files[fields[1]]
+		delete(host.files, fields[1])
+	case "rm":
+		delete(host.files, fields[1])
+	default:
+		result = testExecResult{stderr: "unexpected command", exitStatus: 1}
+		return
+	}
+
+	target, exists := host.files[host.targetPath]
+	if exists && !host.allowed(target) {
+		host.violations = append(host.violations, "after '"+command+"' target is "+target.ownerGroup+" "+strconv.Itoa(target.permissions))
+	}
+	return
+}
+
+func newPlacementContext(t *testing.T) (ctx context.Context) {
+	ctx = t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.OpsKey, config.Opts{DisableSudo: true})
+	return
+}
+
+func TestMoveIntoPlace(t *testing.T) {
+	const bufferPath string = "/tmp/scmp.buffer/key"
+	const targetPath string = "/etc/ssl/private/site.key"
+	const stagedPath string = "/etc/ssl/private/.site.key" + StagedFileSuffix
+
+	oldFile := simulatedFile{ownerGroup: "root:root", permissions: 644, content: "old"}
+	newFile := simulatedFile{ownerGroup: "root:ssl-cert", permissions: 4750, content: "new"}
+
+	tests := []struct {
+		name               string
+		refuse             func(command string) (stderr string)
+		expectedCommands   []string
+		expectedRoundTrips int
+	}{
+		{
+			name:               "secured before rename",
+			expectedRoundTrips: 1,
+			expectedCommands: []string{
+				"chown 'root:ssl-cert' '" + bufferPath + "'",
+				"chmod '4750' '" + bufferPath + "'",
+				"mv '" + bufferPath + "' '" + stagedPath + "'",
+				"mv '" + stagedPath + "' '" + targetPath + "'",
+			},
+		},
+		{
+			name: "ownership refused before rename",
+			refuse: func(command string) (stderr string) {
+				if command == "chown 'root:ssl-cert' '"+bufferPath+"'" {
+					stderr = "chown: changing ownership of '" + bufferPath + "': Operation not permitted"
+				}
+				return
+			},
+			expectedCommands: []string{
+				"chown 'root:ssl-cert' '" + bufferPath + "'",
+				"chmod '750' '" + bufferPath + "'",
+				"mv '" + bufferPath + "' '" + stagedPath + "'",
+				"mv '" + stagedPath + "' '" + targetPath + "'",
+				"chown 'root:ssl-cert' '" + targetPath + "'",
+				"chmod '4750' '" + targetPath + "'",
+			},
+			expectedRoundTrips: 6,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newPlacementContext(t)
+
+			remote := &simulatedHost{
+				files: map[string]simulatedFile{
+					bufferPath: {ownerGroup: "deployer:deployer", permissions: 640, content: "new"},
+					targetPath: oldFile,
+				},
+				refuse:     test.refuse,
+				targetPath: targetPath,
+				allowed: func(file simulatedFile) (allowed bool) {
+					allowed = file == oldFile || file == newFile
+					return
+				},
+			}
+			// Fallback order may only expose the new content with the permissions already applied, without special bits
+			if test.refuse != nil {
+				remote.allowed = func(file simulatedFile) (allowed bool) {
+					allowed = file == oldFile || file == newFile || (file.content == "new" && file.permissions == newFile.permissions%1000)
+					return
+				}
+			}
+			host := HostMeta{Name: "web01", SSHClient: serveTestExec(t, remote.handle)}
+
+			err := MoveIntoPlace(ctx, host, str.RemotePath(bufferPath), str.RemotePath(targetPath), newFile.ownerGroup, newFile.permissions)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(remote.commands, test.expectedCommands) {
+				t.Errorf("command order mismatch\nexpected: %q\ngot:      %q", test.expectedCommands, remote.commands)
+			}
+			if remote.roundTrips != test.expectedRoundTrips {
+				t.Errorf("expected %d round trip(s), got %d", test.expectedRoundTrips, remote.roundTrips)
+			}
+			for _, violation := range remote.violations {
+				t.Errorf("target exposed with wrong metadata: %s", violation)
+			}
+			if remote.files[targetPath] != newFile {
+				t.Errorf("expected final target %+v, got %+v", newFile, remote.files[targetPath])
+			}
+			if _, exists := remote.files[stagedPath]; exists {
+				t.Errorf("expected staged file to be gone")
+			}
+		})
+	}
+}
+
+func TestModifyMetadataOrder(t *testing.T) {
+	const targetPath string = "/etc/app/secret.conf"
+
+	tests := []struct {
+		name             string
+		oldFile          simulatedFile
+		newFile          simulatedFile
+		expectedCommands []string
+	}{
+		{
+			name:    "loosen permissions with new group",
+			oldFile: simulatedFile{ownerGroup: "root:root", permissions: 600},
+			newFile: simulatedFile{ownerGroup: "root:app", permissions: 640},
+			expectedCommands: []string{
+				"chown 'root:app' '" + targetPath + "'",
+				"chmod '640' '" + targetPath + "'",
+			},
+		},
+		{
+			name:    "tighten permissions with new group",
+			oldFile: simulatedFile{ownerGroup: "root:root", permissions: 644},
+			newFile: simulatedFile{ownerGroup: "root:app", permissions: 640},
+			expectedCommands: []string{
+				"chmod '640' '" + targetPath + "'",
+				"chown 'root:app' '" + targetPath + "'",
+				"chmod '640' '" + targetPath + "'",
+			},
+		},
+		{
+			name:    "swap group and other access",
+			oldFile: simulatedFile{ownerGroup: "root:root", permissions: 604},
+			newFile: simulatedFile{ownerGroup: "root:app", permissions: 640},
+			expectedCommands: []string{
+				"chmod '600' '" + targetPath + "'",
+				"chown 'root:app' '" + targetPath + "'",
+				"chmod '640' '" + targetPath + "'",
+			},
+		},
+		{
+			name:    "setuid kept across owner change",
+			oldFile: simulatedFile{ownerGroup: "root:root", permissions: 4755},
+			newFile: simulatedFile{ownerGroup: "root:wheel", permissions: 4755},
+			expectedCommands: []string{
+				"chown 'root:wheel' '" + targetPath + "'",
+				"chmod '4755' '" + targetPath + "'",
+			},
+		},
+		{
+			name:    "permissions only",
+			oldFile: simulatedFile{ownerGroup: "root:root", permissions: 644},
+			newFile: simulatedFile{ownerGroup: "root:root", permissions: 600},
+			expectedCommands: []string{
+				"chmod '600' '" + targetPath + "'",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newPlacementContext(t)
+
+			commonPermissions := IntersectPermissions(test.oldFile.permissions, test.newFile.permissions)
+			remote := &simulatedHost{
+				files:      map[string]simulatedFile{targetPath: test.oldFile},
+				targetPath: targetPath,
+				allowed: func(file simulatedFile) (allowed bool) {
+					// Intermediate states never grant more than both the old and new metadata
+					narrowed := IntersectPermissions(file.permissions, commonPermissions) == file.permissions
+					allowed = file == test.oldFile || file == test.newFile || narrowed
+					return
+				},
+			}
+			host := HostMeta{Name: "web01", SSHClient: serveTestExec(t, remote.handle)}
+
+			owner, group, _ := strings.Cut(test.oldFile.ownerGroup, ":")
+			remoteMetadata := RemoteFileInfo{Name: str.RemotePath(targetPath), Owner: owner, Group: group, Permissions: test.oldFile.permissions, Exists: true}
+			localMetadata := deployment.FileInfo{TargetFilePath: str.RemotePath(targetPath), OwnerGroup: test.newFile.ownerGroup, Permissions: test.newFile.permissions}
+
+			err := ModifyMetadata(ctx, host, remoteMetadata, localMetadata)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(remote.commands, test.expectedCommands) {
+				t.Errorf("command order mismatch\nexpected: %q\ngot:      %q", test.expectedCommands, remote.commands)
+			}
+			for _, violation := range remote.violations {
+				t.Errorf("target exposed with wrong metadata: %s", violation)
+			}
+			if remote.files[targetPath] != test.newFile {
+				t.Errorf("expected final target %+v, got %+v", test.newFile, remote.files[targetPath])
+			}
+		})
+	}
+}
+
+func TestIntersectPermissions(t *testing.T) {
+	tests := []struct {
+		first    int
+		second   int
+		expected int
+	}{
+		{644, 640, 640},
+		{604, 640, 600},
+		{4755, 755, 755},
+		{2775, 6770, 2770},
+		{0, 777, 0},
+	}
+
+	for _, test := range tests {
+		common := IntersectPermissions(test.first, test.second)
+		if common != test.expected {
+			t.Errorf("IntersectPermissions(%d, %d): expected %d, got %d", test.first, test.second, test.expected, common)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package sshinternal
+
+import (
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Proxy connections shared by all hosts reached through the same hops
+var proxyConnections = proxyPool{hops: make(map[string]*sharedProxy)}
+
+type proxyPool struct {
+	mutex sync.Mutex
+	hops  map[string]*sharedProxy // Keyed by the names of all hops up to and including this hop
+}
+
+// Single proxy hop connection, closed when the last host using it is done
+type sharedProxy struct {
+	key    string
+	client *ssh.Client
+	err    error
+	ready  chan struct{} // Closed once connection attempt finishes
+	users  int
+}
+
+// Connections to every proxy hop a host is reached through
+// Closing releases this host's use of each hop (hops are only disconnected once unused)
+type ProxyLease struct {
+	hops []*sharedProxy
+}
+
+// Reuses an existing connection for the hop, or connects using dial when none exists
+// Only one connection attempt is made at a time per hop, concurrent callers wait for its result
+func (pool *proxyPool) acquire(key string, dial func() (*ssh.Client, error)) (hop *sharedProxy, err error) {
+	pool.mutex.Lock()
+	hop, exists := pool.hops[key]
+	if exists {
+		hop.users++
+		pool.mutex.Unlock()
+
+		<-hop.ready
+		if hop.err != nil {
+			err = hop.err
+			pool.release(hop)
+		}
+		return
+	}
+
+	hop = &sharedProxy{key: key, ready: make(chan struct{}), users: 1}
+	pool.hops[key] = hop
+	pool.mutex.Unlock()
+
+	hop.client, hop.err = dial()
+	if hop.err != nil {
+		// Failed connections are not reused, the next caller tries again
+		pool.mutex.Lock()
+		if pool.hops[key] == hop {
+			delete(pool.hops, key)
+		}
+		pool.mutex.Unlock()
+	}
+	close(hop.ready)
+
+	if hop.err != nil {
+		err = hop.err
+		pool.release(hop)
+	}
+	return
+}
+
+func (pool *proxyPool) release(hop *sharedProxy) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	hop.users--
+	if hop.users > 0 {
+		return
+	}
+	if pool.hops[hop.key] == hop {
+		delete(pool.hops, hop.key)
+	}
+	if hop.client != nil {
+		_ = hop.client.Close()
+	}
+}
+
+// Client of the last hop (nil when there are no hops)
+func (lease *ProxyLease) lastClient() (client *ssh.Client) {
+	if lease == nil || len(lease.hops) == 0 {
+		return
+	}
+	client = lease.hops[len(lease.hops)-1].client
+	return
+}
+
+// Releases hops from the last to the first so no hop is disconnected before the hops tunneled through it
+func (lease *ProxyLease) Close() (err error) {
+	if lease == nil {
+		return
+	}
+	for index := len(lease.hops) - 1; index >= 0; index-- {
+		proxyConnections.release(lease.hops[index])
+	}
+	lease.hops = nil
+	return
+}
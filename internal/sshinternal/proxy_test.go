@@ -0,0 +1,70 @@
+package sshinternal
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestProxyPoolAcquire(t *testing.T) {
+	pool := proxyPool{hops: make(map[string]*sharedProxy)}
+
+	// Concurrent hosts through the same hop share one connection attempt
+	var dials atomic.Int32
+	release := make(chan struct{})
+	dial := func() (*ssh.Client, error) {
+		dials.Add(1)
+		<-release
+		return nil, nil
+	}
+
+	const hostCount int = 5
+	hops := make([]*sharedProxy, hostCount)
+	var wg sync.WaitGroup
+	for index := range hostCount {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			hops[index], err = pool.acquire("/bastion", dial)
+			if err != nil {
+				t.Errorf("expected no error, got '%v'", err)
+			}
+		}()
+	}
+	close(release)
+	wg.Wait()
+
+	if dials.Load() != 1 {
+		t.Errorf("expected 1 connection to shared hop, got %d", dials.Load())
+	}
+	if hops[0].users != hostCount {
+		t.Errorf("expected %d users of shared hop, got %d", hostCount, hops[0].users)
+	}
+
+	for _, hop := range hops {
+		pool.release(hop)
+	}
+	if len(pool.hops) != 0 {
+		t.Errorf("expected unused hops to be removed, got %d", len(pool.hops))
+	}
+
+	// Failed connections are not kept for later hosts
+	dialErr := errors.New("connection refused")
+	_, err := pool.acquire("/bastion", func() (*ssh.Client, error) { return nil, dialErr })
+	if !errors.Is(err, dialErr) {
+		t.Errorf("expected dial error, got '%v'", err)
+	}
+	if len(pool.hops) != 0 {
+		t.Errorf("expected failed hop to be removed, got %d", len(pool.hops))
+	}
+
+	hop, err := pool.acquire("/bastion", func() (*ssh.Client, error) { return nil, nil })
+	if err != nil {
+		t.Errorf("expected retry after failure to succeed, got '%v'", err)
+	}
+	pool.release(hop)
+}
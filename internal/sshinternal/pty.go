@@ -0,0 +1,203 @@
+package sshinternal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Runs every remote command using the returned context on a pseudo-terminal
+func WithPTY(ctx context.Context) (ptyCtx context.Context) {
+	ptyCtx = context.WithValue(ctx, global.PTYKey, true)
+	return
+}
+
+func ptyFromContext(ctx context.Context) (requested bool) {
+	requested, _ = ctx.Value(global.PTYKey).(bool)
+	return
+}
+
+// Output of a command running on a pseudo-terminal
+// Prompts are removed from the output and answered as they appear, partial prompts are held back until complete
+type ptyOutput struct {
+	prompt   string       // Text answered by onPrompt (empty disables prompt handling)
+	onPrompt func() error // Called for every prompt, an error stops reading the output
+	stream   io.Writer    // Receives output as it arrives (optional)
+	output   strings.Builder
+	pending  string // Received text that may still be the beginning of a prompt
+}
+
+func (out *ptyOutput) Write(data []byte) (written int, err error) {
+	written = len(data)
+	out.pending += string(data)
+
+	if out.prompt == "" {
+		out.emit(out.pending)
+		out.pending = ""
+		return
+	}
+
+	for {
+		index := strings.Index(out.pending, out.prompt)
+		if index < 0 {
+			break
+		}
+		out.emit(out.pending[:index])
+		out.pending = out.pending[index+len(out.prompt):]
+
+		err = out.onPrompt()
+		if err != nil {
+			return
+		}
+	}
+
+	// Trailing text that could still become a prompt waits for more output
+	held := 0
+	for length := min(len(out.prompt)-1, len(out.pending)); length > 0; length-- {
+		if strings.HasSuffix(out.pending, out.prompt[:length]) {
+			held = length
+			break
+		}
+	}
+	out.emit(out.pending[:len(out.pending)-held])
+	out.pending = out.pending[len(out.pending)-held:]
+	return
+}
+
+// Releases text held back as a possible prompt once the output is complete
+func (out *ptyOutput) flush() {
+	out.emit(out.pending)
+	out.pending = ""
+}
+
+func (out *ptyOutput) emit(text string) {
+	if text == "" {
+		return
+	}
+	out.output.WriteString(text)
+	if out.stream != nil {
+		_, _ = io.WriteString(out.stream, text)
+	}
+}
+
+// Runs the command on a pseudo-terminal of the session
+// stdout and stderr arrive merged, sudo prompts for a password are answered once (a second prompt means the password was rejected)
+// On timeout the command is sent SIGHUP (like a closed terminal) and the channel is closed
+func (command RemoteCommand) execPTY(ctx context.Context, session *ssh.Session, sudoPassword string, failure *CommandError) (commandOutput string, err error) {
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          0, // Password answers are never echoed into the output
+		ssh.ONLCR:         0, // Keep line endings as written by the command
+		ssh.TTY_OP_ISPEED: ptySpeed,
+		ssh.TTY_OP_OSPEED: ptySpeed,
+	}
+	err = session.RequestPty(ptyTerm, ptyRows, ptyColumns, modes)
+	if err != nil {
+		err = fmt.Errorf("failed to request pseudo-terminal: %w", err)
+		return
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		err = fmt.Errorf("failed to get stdout pipe: %w", err)
+		return
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		err = fmt.Errorf("failed to get stdin pipe: %w", err)
+		return
+	}
+
+	output := &ptyOutput{}
+	if command.StreamStdout {
+		output.stream = os.Stdout
+	}
+
+	// sudo reads the password from the terminal, the prompt is replaced so it can be recognized in the output
+	if !command.DisableSudo {
+		output.prompt = ptySudoPrompt
+		var prompted bool
+		output.onPrompt = func() (err error) {
+			if sudoPassword == "" {
+				err = ErrSudoPasswordMissing
+				return
+			}
+			if prompted {
+				err = ErrSudoPasswordDenied
+				return
+			}
+			prompted = true
+			_, err = io.WriteString(stdin, sudoPassword+"\n")
+			if err != nil {
+				err = fmt.Errorf("failed to write to command stdin: %w", err)
+			}
+			return
+		}
+	}
+	command.Raw = command.sudoPrefix("-p "+QuoteShellArg(ptySudoPrompt)+" ") + command.Raw
+
+	logctx.LogEvent(ctx, logctx.VerbosityDebug, logctx.InfoLog, "  Running command '%s' (pseudo-terminal)\n", command.Raw)
+
+	err = session.Start(command.Raw)
+	if err != nil {
+		err = fmt.Errorf("failed to start command: %w", err)
+		return
+	}
+
+	// Prompt handling failures end the command, nothing else would answer the prompt
+	outputDone := make(chan error, 1)
+	go func() {
+		_, copyErr := io.Copy(output, stdout)
+		if copyErr != nil {
+			_ = session.Close()
+		}
+		outputDone <- copyErr
+	}()
+
+	waitDone := make(chan error, 1)
+	go func() {
+		waitDone <- session.Wait()
+	}()
+
+	maxExecutionTime := time.Duration(command.Timeout) * time.Second
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), maxExecutionTime)
+	defer cancel()
+
+	select {
+	case err = <-waitDone:
+	case <-timeoutCtx.Done():
+		_ = session.Signal(ssh.SIGHUP)
+		_ = session.Close()
+		err = fmt.Errorf("closed ssh session: exceeded timeout (%d seconds)", command.Timeout)
+		return
+	}
+
+	outputErr := <-outputDone
+	output.flush()
+	commandOutput = output.output.String()
+	if command.Capture != nil {
+		command.Capture.Stdout = commandOutput
+	}
+
+	if outputErr != nil && !errors.Is(outputErr, io.EOF) {
+		failure.Output = tailOutput(commandOutput)
+		err = outputErr
+		return
+	}
+	if err != nil {
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			failure.ExitCode = exitErr.ExitStatus()
+		}
+		failure.Output = tailOutput(commandOutput)
+		return
+	}
+	return
+}
@@ -0,0 +1,225 @@
+package sshinternal
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"scmp/internal/logctx"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Starts an SSH server answering exec requests with the given handler, the handler writes to the channel and returns the exit status
+// Signals sent to the command are delivered to the handler, ptyRequested reports whether a pseudo-terminal was requested first
+func serveTestInteractive(t *testing.T, handler func(channel ssh.Channel, command string, ptyRequested bool, signals <-chan string) (exitStatus uint32)) (client *ssh.Client) {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("failed creating host key signer: %v", err)
+	}
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed starting ssh server: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		_, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(requests)
+		for newChannel := range channels {
+			channel, channelRequests, err := newChannel.Accept()
+			if err != nil {
+				continue
+			}
+			go func() {
+				var ptyRequested bool
+				signals := make(chan string, 4)
+				for request := range channelRequests {
+					switch request.Type {
+					case "pty-req":
+						ptyRequested = true
+						_ = request.Reply(true, nil)
+					case "signal":
+						signals <- string(request.Payload[4:])
+					case "exec":
+						command := string(request.Payload[4:])
+						_ = request.Reply(true, nil)
+						go func() {
+							exitStatus := handler(channel, command, ptyRequested, signals)
+							_, _ = channel.SendRequest("exit-status", false, binary.BigEndian.AppendUint32(nil, exitStatus))
+							_ = channel.Close()
+						}()
+					default:
+						_ = request.Reply(false, nil)
+					}
+				}
+			}()
+		}
+	}()
+
+	client, err = ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{
+		User:            "test",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("failed connecting to test ssh server: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return
+}
+
+// Behaves like sudo with requiretty: refuses without a terminal, prompts with the requested prompt (up to three times)
+func fakeSudo(channel ssh.Channel, command string, ptyRequested bool, signals <-chan string) (exitStatus uint32) {
+	if !ptyRequested {
+		_, _ = io.Copy(io.Discard, channel) // Password given for sudo -S
+		_, _ = channel.Stderr().Write([]byte("sudo: sorry, you must have a tty to run sudo\n"))
+		exitStatus = 1
+		return
+	}
+	stderr := io.Writer(channel) // A terminal has a single output stream
+
+	prompt := ""
+	if strings.HasPrefix(command, "sudo -p '") {
+		prompt, _, _ = strings.Cut(strings.TrimPrefix(command, "sudo -p '"), "'")
+	}
+
+	input := bufio.NewReader(channel)
+	if prompt != "" {
+		for attempt := 1; ; attempt++ {
+			// Prompt split over writes like a slow terminal
+			_, _ = channel.Write([]byte(prompt[:3]))
+			_, _ = channel.Write([]byte(prompt[3:]))
+			line, err := input.ReadString('\n')
+			if err != nil {
+				exitStatus = 1
+				return
+			}
+			if line == "secret\n" {
+				break
+			}
+			_, _ = channel.Write([]byte("Sorry, try again.\n"))
+			if attempt == 3 {
+				exitStatus = 1
+				return
+			}
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(command, "hang"):
+		signal := <-signals
+		_, _ = channel.Write([]byte("got " + signal + "\n"))
+		exitStatus = 129
+	case strings.HasSuffix(command, "fail"):
+		_, _ = stderr.Write([]byte("unit failed\n"))
+		exitStatus = 3
+	default:
+		_, _ = channel.Write([]byte("upgraded\n"))
+		_, _ = stderr.Write([]byte("warning: restart needed\n"))
+	}
+	return
+}
+
+func TestSSHexecPTY(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+
+	client := serveTestInteractive(t, fakeSudo)
+
+	// requiretty refuses commands without a terminal
+	_, err := RemoteCommand{Raw: "apt-get upgrade", Timeout: 5}.SSHexec(ctx, client, "secret")
+	if err == nil || !strings.Contains(err.Error(), "must have a tty") {
+		t.Errorf("expected tty refusal without pseudo-terminal, got '%v'", err)
+	}
+
+	// Password answered at the prompt, stderr merged, prompt removed from output
+	var capture CommandCapture
+	output, err := RemoteCommand{Raw: "apt-get upgrade", Timeout: 5, RequestPTY: true, Capture: &capture}.SSHexec(ctx, client, "secret")
+	if err != nil {
+		t.Fatalf("expected command to succeed on pseudo-terminal, got '%v'", err)
+	}
+	if output != "upgraded\nwarning: restart needed\n" || capture.Stdout != output {
+		t.Errorf("expected merged output without prompt, got '%s' (captured '%s')", output, capture.Stdout)
+	}
+
+	// Context request applies to commands not asking for a pseudo-terminal themselves
+	_, err = RemoteCommand{Raw: "apt-get upgrade", Timeout: 5}.SSHexec(WithPTY(ctx), client, "secret")
+	if err != nil {
+		t.Errorf("expected pseudo-terminal requested through context, got '%v'", err)
+	}
+
+	_, err = RemoteCommand{Raw: "apt-get upgrade", Timeout: 5, RequestPTY: true}.SSHexec(ctx, client, "wrong")
+	if !errors.Is(err, ErrSudoPasswordDenied) {
+		t.Errorf("expected rejected password error, got '%v'", err)
+	}
+
+	_, err = RemoteCommand{Raw: "apt-get upgrade", Timeout: 5, RequestPTY: true}.SSHexec(ctx, client, "")
+	if !errors.Is(err, ErrSudoPasswordMissing) {
+		t.Errorf("expected missing password error, got '%v'", err)
+	}
+
+	// Failure context comes from the merged output
+	_, err = RemoteCommand{Raw: "systemctl restart fail", Timeout: 5, RequestPTY: true}.SSHexec(ctx, client, "secret")
+	var commandErr *CommandError
+	if !errors.As(err, &commandErr) || commandErr.ExitCode != 3 || commandErr.Output != "unit failed" {
+		t.Errorf("expected exit code 3 with merged output, got '%v'", err)
+	}
+
+	// Timeout hangs up the terminal
+	start := time.Now()
+	_, err = RemoteCommand{Raw: "hang", DisableSudo: true, Timeout: 1, RequestPTY: true}.SSHexec(ctx, client, "")
+	if err == nil || !strings.Contains(err.Error(), "exceeded timeout") {
+		t.Errorf("expected timeout error, got '%v'", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("expected command to be stopped at the timeout, took %s", time.Since(start))
+	}
+}
+
+func TestPTYOutputPrompts(t *testing.T) {
+	var prompts int
+	var streamed strings.Builder
+	output := &ptyOutput{
+		prompt:   "[prompt]",
+		onPrompt: func() (err error) { prompts++; return },
+		stream:   &streamed,
+	}
+
+	for _, chunk := range []string{"before [pro", "mpt]after [", "not a prompt", " trailing [pr"} {
+		_, err := output.Write([]byte(chunk))
+		if err != nil {
+			t.Fatalf("unexpected write error: %v", err)
+		}
+	}
+	if streamed.String() != "before after [not a prompt trailing " {
+		t.Errorf("expected partial prompt held back from stream, got '%s'", streamed.String())
+	}
+	output.flush()
+
+	expected := "before after [not a prompt trailing [pr"
+	if prompts != 1 || output.output.String() != expected || streamed.String() != expected {
+		t.Errorf("expected one prompt and output '%s', got %d and '%s'", expected, prompts, output.output.String())
+	}
+}
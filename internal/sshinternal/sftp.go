@@ -0,0 +1,405 @@
+package sshinternal
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Minimal SFTP (version 3) client covering only what resumable uploads need (stat, open, write, close)
+// Packets are: uint32 length, byte type, uint32 request ID (except init/version), payload
+
+const (
+	sftpProtocolVersion uint32 = 3
+
+	sftpPacketInit    byte = 1
+	sftpPacketVersion byte = 2
+	sftpPacketOpen    byte = 3
+	sftpPacketClose   byte = 4
+	sftpPacketWrite   byte = 6
+	sftpPacketStat    byte = 17
+	sftpPacketStatus  byte = 101
+	sftpPacketHandle  byte = 102
+	sftpPacketAttrs   byte = 105
+
+	sftpOpenWrite    uint32 = 0x02
+	sftpOpenCreate   uint32 = 0x08
+	sftpOpenTruncate uint32 = 0x10
+
+	sftpAttrSize        uint32 = 0x01
+	sftpAttrPermissions uint32 = 0x04
+
+	sftpUploadPermissions uint32 = 0600 // Mode of newly created remote buffer files, owner only until moved into place
+
+	sftpStatusOK         uint32 = 0
+	sftpStatusNoSuchFile uint32 = 2
+
+	sftpMaxPacketSize  uint32 = 256 * 1024 // Largest accepted response packet
+	sftpMaxWritesInAir int    = 16         // Unacknowledged write requests allowed at once
+)
+
+// Write request awaiting its status
+type pendingWrite struct {
+	requestID    uint32
+	end          int64 // Offset after this write
+	acknowledged bool
+}
+
+type sftpConn struct {
+	input     io.Writer
+	output    io.Reader
+	session   *ssh.Session // Empty when connected to a plain stream
+	requestID uint32
+}
+
+// Opens the SFTP subsystem on a new session of the SSH connection
+func newSFTPSession(ctx context.Context, client *ssh.Client) (conn *sftpConn, err error) {
+	session, err := newSessionWithRetry(ctx, client)
+	if err != nil {
+		err = fmt.Errorf("session create: %w", err)
+		return
+	}
+
+	input, err := session.StdinPipe()
+	if err != nil {
+		_ = session.Close()
+		err = fmt.Errorf("failed to get stdin pipe: %w", err)
+		return
+	}
+	output, err := session.StdoutPipe()
+	if err != nil {
+		_ = session.Close()
+		err = fmt.Errorf("failed to get stdout pipe: %w", err)
+		return
+	}
+
+	err = session.RequestSubsystem("sftp")
+	if err != nil {
+		_ = session.Close()
+		err = fmt.Errorf("sftp subsystem unavailable on remote: %w", err)
+		return
+	}
+
+	conn, err = newSFTPConn(input, output)
+	if err != nil {
+		_ = session.Close()
+		return
+	}
+	conn.session = session
+	return
+}
+
+// Negotiates protocol version over an established SFTP stream
+func newSFTPConn(input io.Writer, output io.Reader) (conn *sftpConn, err error) {
+	conn = &sftpConn{input: input, output: output}
+
+	err = conn.sendPacket(sftpPacketInit, binary.BigEndian.AppendUint32(nil, sftpProtocolVersion))
+	if err != nil {
+		err = fmt.Errorf("failed sftp init: %w", err)
+		return
+	}
+
+	packetType, payload, err := conn.readPacket()
+	if err != nil {
+		err = fmt.Errorf("failed sftp init: %w", err)
+		return
+	}
+	if packetType != sftpPacketVersion || len(payload) < 4 {
+		err = fmt.Errorf("failed sftp init: unexpected response type %d", packetType)
+		return
+	}
+	serverVersion := binary.BigEndian.Uint32(payload)
+	if serverVersion < sftpProtocolVersion {
+		err = fmt.Errorf("failed sftp init: unsupported server version %d", serverVersion)
+		return
+	}
+	return
+}
+
+func (conn *sftpConn) Close() (err error) {
+	if conn.session == nil {
+		return
+	}
+	err = conn.session.Close()
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return
+}
+
+// Size of remote file (ErrSFTPNoSuchFile when missing)
+func (conn *sftpConn) stat(remotePath string) (size int64, err error) {
+	requestID, err := conn.sendRequest(sftpPacketStat, appendSFTPString(nil, remotePath))
+	if err != nil {
+		return
+	}
+
+	packetType, payload, err := conn.readResponse(requestID)
+	if err != nil {
+		return
+	}
+	switch packetType {
+	case sftpPacketAttrs:
+		if len(payload) < 4 {
+			err = fmt.Errorf("truncated sftp attributes")
+			return
+		}
+		attrFlags := binary.BigEndian.Uint32(payload)
+		if attrFlags&sftpAttrSize == 0 || len(payload) < 12 {
+			err = fmt.Errorf("sftp attributes missing file size")
+			return
+		}
+		size = int64(binary.BigEndian.Uint64(payload[4:]))
+	case sftpPacketStatus:
+		err = parseSFTPStatus(payload)
+		if err == nil {
+			err = fmt.Errorf("unexpected sftp status response to stat")
+		}
+	default:
+		err = fmt.Errorf("unexpected sftp response type %d to stat", packetType)
+	}
+	return
+}
+
+// Opens (creating if needed) remote file for writing, existing content is kept unless truncate is requested
+func (conn *sftpConn) openForWrite(remotePath string, truncate bool) (handle string, err error) {
+	openFlags := sftpOpenWrite | sftpOpenCreate
+	if truncate {
+		openFlags |= sftpOpenTruncate
+	}
+
+	payload := appendSFTPString(nil, remotePath)
+	payload = binary.BigEndian.AppendUint32(payload, openFlags)
+	payload = binary.BigEndian.AppendUint32(payload, sftpAttrPermissions)
+	payload = binary.BigEndian.AppendUint32(payload, sftpUploadPermissions)
+	requestID, err := conn.sendRequest(sftpPacketOpen, payload)
+	if err != nil {
+		return
+	}
+
+	packetType, response, err := conn.readResponse(requestID)
+	if err != nil {
+		return
+	}
+	switch packetType {
+	case sftpPacketHandle:
+		handle, _, err = readSFTPString(response)
+	case sftpPacketStatus:
+		err = parseSFTPStatus(response)
+		if err == nil {
+			err = fmt.Errorf("unexpected sftp status response to open")
+		}
+	default:
+		err = fmt.Errorf("unexpected sftp response type %d to open", packetType)
+	}
+	return
+}
+
+func (conn *sftpConn) closeHandle(handle string) (err error) {
+	requestID, err := conn.sendRequest(sftpPacketClose, appendSFTPString(nil, handle))
+	if err != nil {
+		return
+	}
+	err = conn.readStatus(requestID)
+	return
+}
+
+// Writes everything from reader into the open remote file starting at offset
+// Keeps several writes in flight, confirmed is the offset up to which the remote acknowledged every write
+func (conn *sftpConn) writeFrom(handle string, reader io.Reader, offset int64, chunkSize int) (confirmed int64, err error) {
+	confirmed = offset
+	var pending []pendingWrite
+	buffer := make([]byte, chunkSize)
+	var readDone bool
+
+	for !readDone || len(pending) > 0 {
+		for !readDone && len(pending) < sftpMaxWritesInAir {
+			var bytesRead int
+			bytesRead, err = io.ReadFull(reader, buffer)
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				readDone = true
+				err = nil
+			} else if err != nil {
+				err = fmt.Errorf("failed reading local content: %w", err)
+				return
+			}
+			if bytesRead == 0 {
+				break
+			}
+
+			payload := appendSFTPString(nil, handle)
+			payload = binary.BigEndian.AppendUint64(payload, uint64(offset))
+			payload = binary.BigEndian.AppendUint32(payload, uint32(bytesRead))
+			payload = append(payload, buffer[:bytesRead]...)
+
+			var requestID uint32
+			requestID, err = conn.sendRequest(sftpPacketWrite, payload)
+			if err != nil {
+				return
+			}
+			offset += int64(bytesRead)
+			pending = append(pending, pendingWrite{requestID: requestID, end: offset})
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		err = conn.readWriteStatus(pending)
+		if err != nil {
+			err = fmt.Errorf("remote write failed after %d bytes: %w", confirmed, err)
+			return
+		}
+
+		// Only writes without any unacknowledged write before them are confirmed
+		for len(pending) > 0 && pending[0].acknowledged {
+			confirmed = pending[0].end
+			pending = pending[1:]
+		}
+	}
+	return
+}
+
+// Reads one write status and marks its request as acknowledged (servers may answer out of order)
+func (conn *sftpConn) readWriteStatus(pending []pendingWrite) (err error) {
+	packetType, payload, err := conn.readPacket()
+	if err != nil {
+		return
+	}
+	if packetType != sftpPacketStatus || len(payload) < 4 {
+		err = fmt.Errorf("unexpected sftp response type %d, expected status", packetType)
+		return
+	}
+	responseID := binary.BigEndian.Uint32(payload)
+	for index := range pending {
+		if pending[index].requestID != responseID {
+			continue
+		}
+		err = parseSFTPStatus(payload[4:])
+		if err != nil {
+			return
+		}
+		pending[index].acknowledged = true
+		return
+	}
+	err = fmt.Errorf("sftp response for unknown request %d", responseID)
+	return
+}
+
+// Sends request with the next request ID
+func (conn *sftpConn) sendRequest(packetType byte, payload []byte) (requestID uint32, err error) {
+	conn.requestID++
+	requestID = conn.requestID
+	err = conn.sendPacket(packetType, append(binary.BigEndian.AppendUint32(nil, requestID), payload...))
+	return
+}
+
+func (conn *sftpConn) sendPacket(packetType byte, payload []byte) (err error) {
+	packet := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+1))
+	packet = append(packet, packetType)
+	packet = append(packet, payload...)
+	_, err = conn.input.Write(packet)
+	if err != nil {
+		err = fmt.Errorf("failed sending sftp packet: %w", err)
+		return
+	}
+	return
+}
+
+func (conn *sftpConn) readPacket() (packetType byte, payload []byte, err error) {
+	header := make([]byte, 5)
+	_, err = io.ReadFull(conn.output, header)
+	if err != nil {
+		err = fmt.Errorf("failed reading sftp packet: %w", err)
+		return
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length < 1 || length > sftpMaxPacketSize {
+		err = fmt.Errorf("invalid sftp packet length %d", length)
+		return
+	}
+	packetType = header[4]
+
+	payload = make([]byte, length-1)
+	_, err = io.ReadFull(conn.output, payload)
+	if err != nil {
+		err = fmt.Errorf("failed reading sftp packet: %w", err)
+		return
+	}
+	return
+}
+
+// Reads the next response and ensures it answers the expected request
+func (conn *sftpConn) readResponse(expectedID uint32) (packetType byte, payload []byte, err error) {
+	packetType, payload, err = conn.readPacket()
+	if err != nil {
+		return
+	}
+	if len(payload) < 4 {
+		err = fmt.Errorf("truncated sftp response")
+		return
+	}
+	responseID := binary.BigEndian.Uint32(payload)
+	if responseID != expectedID {
+		err = fmt.Errorf("sftp response for request %d received while waiting for request %d", responseID, expectedID)
+		return
+	}
+	payload = payload[4:]
+	return
+}
+
+// Reads status response, nil when remote reports success
+func (conn *sftpConn) readStatus(expectedID uint32) (err error) {
+	packetType, payload, err := conn.readResponse(expectedID)
+	if err != nil {
+		return
+	}
+	if packetType != sftpPacketStatus {
+		err = fmt.Errorf("unexpected sftp response type %d, expected status", packetType)
+		return
+	}
+	err = parseSFTPStatus(payload)
+	return
+}
+
+func parseSFTPStatus(payload []byte) (err error) {
+	if len(payload) < 4 {
+		err = fmt.Errorf("truncated sftp status")
+		return
+	}
+	statusCode := binary.BigEndian.Uint32(payload)
+	message, _, _ := readSFTPString(payload[4:])
+
+	switch statusCode {
+	case sftpStatusOK:
+	case sftpStatusNoSuchFile:
+		err = ErrSFTPNoSuchFile
+	default:
+		err = fmt.Errorf("sftp status %d: %s", statusCode, message)
+	}
+	return
+}
+
+func appendSFTPString(buffer []byte, text string) (extended []byte) {
+	extended = binary.BigEndian.AppendUint32(buffer, uint32(len(text)))
+	extended = append(extended, text...)
+	return
+}
+
+func readSFTPString(buffer []byte) (text string, remaining []byte, err error) {
+	if len(buffer) < 4 {
+		err = fmt.Errorf("truncated sftp string")
+		return
+	}
+	length := binary.BigEndian.Uint32(buffer)
+	if uint64(len(buffer)-4) < uint64(length) {
+		err = fmt.Errorf("truncated sftp string")
+		return
+	}
+	text = string(buffer[4 : 4+length])
+	remaining = buffer[4+length:]
+	return
+}
@@ -0,0 +1,168 @@
+package sshinternal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+// In-memory SFTP server for a single file, fails writes that start at or beyond failAtOffset (negative never fails)
+func serveTestSFTP(t *testing.T, requests io.Reader, responses io.Writer, files map[string][]byte, failAtOffset int64) {
+	t.Helper()
+	reply := func(packetType byte, payload []byte) {
+		packet := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+1))
+		packet = append(packet, packetType)
+		_, _ = responses.Write(append(packet, payload...))
+	}
+	status := func(requestID uint32, code uint32) {
+		payload := binary.BigEndian.AppendUint32(nil, requestID)
+		payload = binary.BigEndian.AppendUint32(payload, code)
+		payload = appendSFTPString(payload, "")
+		reply(sftpPacketStatus, appendSFTPString(payload, ""))
+	}
+
+	handles := make(map[string]string)
+	for {
+		header := make([]byte, 5)
+		_, err := io.ReadFull(requests, header)
+		if err != nil {
+			return
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header)-1)
+		_, err = io.ReadFull(requests, payload)
+		if err != nil {
+			return
+		}
+
+		if header[4] == sftpPacketInit {
+			reply(sftpPacketVersion, binary.BigEndian.AppendUint32(nil, sftpProtocolVersion))
+			continue
+		}
+		requestID := binary.BigEndian.Uint32(payload)
+		path, remaining, _ := readSFTPString(payload[4:])
+
+		switch header[4] {
+		case sftpPacketStat:
+			content, exists := files[path]
+			if !exists {
+				status(requestID, sftpStatusNoSuchFile)
+				continue
+			}
+			attrs := binary.BigEndian.AppendUint32(nil, requestID)
+			attrs = binary.BigEndian.AppendUint32(attrs, sftpAttrSize)
+			reply(sftpPacketAttrs, binary.BigEndian.AppendUint64(attrs, uint64(len(content))))
+		case sftpPacketOpen:
+			openFlags := binary.BigEndian.Uint32(remaining)
+			// Created files must not fall back to the server's default mode
+			attrFlags := binary.BigEndian.Uint32(remaining[4:])
+			if attrFlags&sftpAttrPermissions == 0 || binary.BigEndian.Uint32(remaining[8:]) != sftpUploadPermissions {
+				status(requestID, 3)
+				continue
+			}
+			if openFlags&sftpOpenTruncate != 0 {
+				files[path] = nil
+			}
+			handles["handle-"+path] = path
+			reply(sftpPacketHandle, appendSFTPString(binary.BigEndian.AppendUint32(nil, requestID), "handle-"+path))
+		case sftpPacketWrite:
+			offset := int64(binary.BigEndian.Uint64(remaining))
+			data, _, _ := readSFTPString(remaining[8:])
+			if failAtOffset >= 0 && offset >= failAtOffset {
+				status(requestID, 4)
+				continue
+			}
+			content := files[handles[path]]
+			if int64(len(content)) < offset+int64(len(data)) {
+				content = append(content, make([]byte, offset+int64(len(data))-int64(len(content)))...)
+			}
+			copy(content[offset:], data)
+			files[handles[path]] = content
+			status(requestID, sftpStatusOK)
+		case sftpPacketClose:
+			status(requestID, sftpStatusOK)
+		}
+	}
+}
+
+func TestSFTPResumeWrite(t *testing.T) {
+	localContent := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+	const chunkSize int = 1000
+
+	tests := []struct {
+		name              string
+		remoteContent     []byte // Nil when remote file is missing
+		failAtOffset      int64
+		expectedConfirmed int64
+		expectedErr       bool
+	}{
+		{"new file", nil, -1, int64(len(localContent)), false},
+		{"resume partial file", localContent[:5500], -1, int64(len(localContent)), false},
+		{"write failure", nil, 7000, 7000, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Responses are buffered like an SSH channel so pipelined writes do not block the server
+			requestReader, requestWriter := io.Pipe()
+			responseReader, responseWriter, err := os.Pipe()
+			if err != nil {
+				t.Fatalf("failed creating pipe: %v", err)
+			}
+			defer func() {
+				_ = responseReader.Close()
+			}()
+			files := make(map[string][]byte)
+			if test.remoteContent != nil {
+				files["/tmp/buffer"] = append([]byte{}, test.remoteContent...)
+			}
+			go func() {
+				serveTestSFTP(t, requestReader, responseWriter, files, test.failAtOffset)
+				_ = responseWriter.Close()
+			}()
+			defer func() {
+				_ = requestWriter.Close()
+			}()
+
+			conn, err := newSFTPConn(requestWriter, responseReader)
+			if err != nil {
+				t.Fatalf("unexpected init error: %v", err)
+			}
+
+			remoteSize, err := conn.stat("/tmp/buffer")
+			if test.remoteContent == nil {
+				if !errors.Is(err, ErrSFTPNoSuchFile) {
+					t.Fatalf("expected missing file error, got '%v'", err)
+				}
+			} else if err != nil || remoteSize != int64(len(test.remoteContent)) {
+				t.Fatalf("expected remote size %d, got %d (%v)", len(test.remoteContent), remoteSize, err)
+			}
+
+			handle, err := conn.openForWrite("/tmp/buffer", remoteSize == 0)
+			if err != nil {
+				t.Fatalf("unexpected open error: %v", err)
+			}
+
+			confirmed, err := conn.writeFrom(handle, bytes.NewReader(localContent[remoteSize:]), remoteSize, chunkSize)
+			if test.expectedErr != (err != nil) {
+				t.Fatalf("expected error %t, got '%v'", test.expectedErr, err)
+			}
+			if confirmed != test.expectedConfirmed {
+				t.Errorf("expected confirmed offset %d, got %d", test.expectedConfirmed, confirmed)
+			}
+			if test.expectedErr {
+				return
+			}
+
+			err = conn.closeHandle(handle)
+			if err != nil {
+				t.Fatalf("unexpected close error: %v", err)
+			}
+			if !bytes.Equal(files["/tmp/buffer"], localContent) {
+				t.Errorf("remote content does not match local content (got %d bytes)", len(files["/tmp/buffer"]))
+			}
+		})
+	}
+}
@@ -6,12 +6,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net"
 	"os"
 	"scmp/internal/config"
+	"scmp/internal/crypto"
 	"scmp/internal/logctx"
+	"scmp/internal/parsing"
 	"scmp/internal/str"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bramvdbogaerde/go-scp"
@@ -19,7 +23,8 @@ import (
 )
 
 // Standard SSH client configuration settings for specific host
-func setupSSHConfig(ctx context.Context, hostInfo config.EndpointInfo) (config *ssh.ClientConfig) {
+// authMethod is set to the name of the last attempted auth method (the successful one once the handshake completes)
+func setupSSHConfig(ctx context.Context, hostInfo config.EndpointInfo) (config *ssh.ClientConfig, authMethod *string) {
 	var connectTimeout time.Duration
 	if hostInfo.ConnectTimeout > 0 {
 		connectTimeout = time.Duration(hostInfo.ConnectTimeout) * time.Second
@@ -27,143 +32,260 @@ func setupSSHConfig(ctx context.Context, hostInfo config.EndpointInfo) (config *
 		connectTimeout = time.Duration(DefaultConnectTimeout) * time.Second
 	}
 
+	// Host keys pinned under any name of this host are accepted on all of its addresses
+	knownAliases := KnownHostAliases(hostInfo)
+
 	config = &ssh.ClientConfig{
-		User: hostInfo.EndpointUser,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(hostInfo.PrivateKey),
-			ssh.Password(hostInfo.Password),
-		},
+		User:          hostInfo.EndpointUser,
 		ClientVersion: SSHVersionString,
-		HostKeyAlgorithms: []string{
-			hostInfo.KeyAlgo,
-		},
 		HostKeyCallback: func(hostname string, remote net.Addr, pubKey ssh.PublicKey) error {
-			return hostKeyCallback(ctx, hostname, remote, pubKey) // Inject context into callback function
+			return hostKeyCallback(ctx, hostname, remote, pubKey, knownAliases) // Inject context into callback function
 		},
 		Timeout: connectTimeout,
 	}
+
+	// Auth methods are tried in order: publickey, password, keyboard-interactive
+	authMethod = new(string)
+	*authMethod = authMethodNone
+	if hostInfo.PrivateKey != nil {
+		config.Auth = append(config.Auth, ssh.PublicKeysCallback(func() (signers []ssh.Signer, err error) {
+			*authMethod = authMethodPublicKey
+			signers = []ssh.Signer{hostInfo.PrivateKey}
+			return
+		}))
+		config.HostKeyAlgorithms = []string{hostInfo.KeyAlgo}
+	}
+	if hostInfo.Password != "" {
+		config.Auth = append(config.Auth, ssh.PasswordCallback(func() (secret string, err error) {
+			*authMethod = authMethodPassword
+			secret = hostInfo.Password
+			return
+		}))
+		config.Auth = append(config.Auth, ssh.KeyboardInteractive(func(name string, instruction string, questions []string, echos []bool) (answers []string, err error) {
+			*authMethod = authMethodKeyboardInteractive
+			answers = passwordChallengeAnswers(hostInfo.Password, echos)
+			return
+		}))
+	}
+	return
+}
+
+// Answers every hidden keyboard-interactive prompt with the password (prompts shown in clear text are left empty)
+func passwordChallengeAnswers(password string, echos []bool) (answers []string) {
+	answers = make([]string, len(echos))
+	for index, echo := range echos {
+		if !echo {
+			answers[index] = password
+		}
+	}
 	return
 }
 
-// Handle building client config and connection to remote host
-// Attempts to automatically recover from some errors like no route to host by waiting a bit
-func ConnectToSSH(ctx context.Context, hostInfo config.EndpointInfo, proxyInfo config.EndpointInfo) (client *ssh.Client, proxyConn *ssh.Client, err error) {
+// Handle building client config and connection to remote host, through each proxy hop in order (if any)
+// Dial-level failures (refused, no route, timeouts) are retried with exponential backoff, handshake and authentication failures are not
+// Unreachable addresses fail over to the next configured address of the host within the same attempt
+func ConnectToSSH(ctx context.Context, hostInfo config.EndpointInfo, proxyChain []config.EndpointInfo) (client *ssh.Client, proxyConn *ProxyLease, connectedEndpoint string, err error) {
 	ctx = logctx.AppendCtxTag(ctx, logctx.NSSSH)
 
 	logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Connecting to SSH server\n", hostInfo.EndpointName)
 
-	// Setup config for proxy if required
-	var proxySSHconfig *ssh.ClientConfig
-	if hostInfo.Proxy != "" {
-		proxySSHconfig = setupSSHConfig(ctx, proxyInfo)
+	if hostInfo.EndpointError != nil {
+		err = hostInfo.EndpointError
+		return
 	}
 
-	SSHconfig := setupSSHConfig(ctx, hostInfo)
+	// Connections held by 'controller connect --persist' are reused instead of dialing (and authenticating) again
+	client, err = dialControl(ctx, hostInfo)
+	if err != nil || client != nil {
+		if client != nil {
+			connectedEndpoint = hostInfo.Endpoint
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Connected through persistent connection\n", hostInfo.EndpointName)
+		}
+		return
+	}
 
-	// Only attempt connection x times
-	const maxConnectionAttempts int = 3
+	endpoints := hostInfo.Endpoints()
+	if len(endpoints) == 0 {
+		err = fmt.Errorf("host has no address configured")
+		return
+	}
 
-	// Loop so some network errors can recover and try again
-	for attempts := 0; attempts <= maxConnectionAttempts; attempts++ {
-		if hostInfo.Proxy != "" {
-			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Endpoint %s: Establishing connection to SSH server through proxy %s (%d/%d)\n", hostInfo.Endpoint, proxyInfo.Endpoint, attempts, maxConnectionAttempts)
+	maxAttempts, retryDelay := connectRetryPolicy(hostInfo)
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if attempt > 1 {
+			delay := connectBackoff(retryDelay, attempt-1)
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.WarnLog,
+				"Retrying connection in %s (attempt %d/%d): %v\n", delay.Round(time.Millisecond), attempt, maxAttempts, err)
 
-			// SSH Connect to proxy
-			proxyConn, err = ssh.Dial("tcp", proxyInfo.Endpoint, proxySSHconfig)
-			retryAvailable, successfulConnection := checkConnection(err)
-			if retryAvailable {
-				logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Endpoint %s: No route to SSH proxy server (%d/%d)\n", hostInfo.Endpoint, attempts, maxConnectionAttempts)
-				continue
-			}
-			if !successfulConnection {
-				err = fmt.Errorf("failed connection to proxy server: %w", err)
+			select {
+			case <-ctx.Done():
+				err = fmt.Errorf("stopped retrying connection: %w", err)
 				return
+			case <-time.After(delay):
 			}
+		}
 
-			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Connected to SSH proxy server\n", hostInfo.EndpointName)
-
-			// TCP Connect to end server through proxy
-			var clientTunnel net.Conn
-			clientTunnel, err = proxyConn.Dial("tcp", hostInfo.Endpoint)
-			retryAvailable, successfulConnection = checkConnection(err)
-			if retryAvailable {
-				logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Endpoint %s: No route to SSH server (%d/%d)\n", hostInfo.Endpoint, attempts, maxConnectionAttempts)
-				continue
-			}
-			if !successfulConnection {
-				err = fmt.Errorf("failed TCP connection to server: %w", err)
-				return
-			}
+		client, proxyConn, connectedEndpoint, err = connectAttempt(ctx, hostInfo, proxyChain, endpoints, attempt, maxAttempts)
+		if err == nil || !errors.Is(err, ErrEndpointUnreachable) {
+			return
+		}
+	}
 
-			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Connected by TCP to SSH server\n", hostInfo.EndpointName)
-
-			// SSH Handshake with end server through proxy (error is evaluated below)
-			var clientConn ssh.Conn
-			var clientChannel <-chan ssh.NewChannel
-			var clientRequest <-chan *ssh.Request
-			clientConn, clientChannel, clientRequest, err = ssh.NewClientConn(clientTunnel, hostInfo.Endpoint, SSHconfig)
-			retryAvailable, successfulConnection = checkConnection(err)
-			if retryAvailable {
-				logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Endpoint %s: No route to SSH server (%d/%d)\n", hostInfo.Endpoint, attempts, maxConnectionAttempts)
-				continue
-			}
-			if !successfulConnection {
-				err = fmt.Errorf("failed SSH handshake to server: %w", err)
-				return
-			}
+	if maxAttempts > 1 {
+		err = fmt.Errorf("unreachable after %d attempts: %w", maxAttempts, err)
+	}
+	return
+}
 
-			// Setup Client
-			client = ssh.NewClient(clientConn, clientChannel, clientRequest)
-			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Connected to SSH server\n", hostInfo.EndpointName)
+// Attempt count and initial retry delay of the host (defaults when not configured)
+func connectRetryPolicy(hostInfo config.EndpointInfo) (maxAttempts int, retryDelay time.Duration) {
+	maxAttempts = hostInfo.ConnectAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultConnectAttempts
+	}
+	retryDelay = hostInfo.ConnectRetryDelay
+	if retryDelay <= 0 {
+		retryDelay = DefaultConnectRetryDelay
+	}
+	return
+}
 
+// Doubles the delay for every retry (capped), randomized between half and the full delay so hosts do not retry in lockstep
+func connectBackoff(retryDelay time.Duration, retry int) (delay time.Duration) {
+	delay = retryDelay
+	for range retry - 1 {
+		delay *= 2
+		if delay >= MaxConnectRetryDelay {
+			delay = MaxConnectRetryDelay
 			break
+		}
+	}
+	delay = delay/2 + rand.N(delay/2+1)
+	return
+}
+
+// Single pass over the proxy chain and every address of the host (each dial has the full connect timeout)
+func connectAttempt(ctx context.Context, hostInfo config.EndpointInfo, proxyChain []config.EndpointInfo, endpoints []string, attempt int, maxAttempts int) (client *ssh.Client, proxyConn *ProxyLease, connectedEndpoint string, err error) {
+	proxyConn, err = connectProxyChain(ctx, hostInfo, proxyChain)
+	if err != nil {
+		proxyConn = nil
+		return
+	}
+
+	for index, endpoint := range endpoints {
+		if len(proxyChain) > 0 {
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Endpoint %s: Establishing connection to SSH server through proxy %s (attempt %d/%d)\n", endpoint, proxyChain[len(proxyChain)-1].Endpoint, attempt, maxAttempts)
 		} else {
-			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Endpoint %s: Establishing connection to SSH server (%d/%d)\n", hostInfo.Endpoint, attempts, maxConnectionAttempts)
-
-			// Connect to the SSH server directly
-			client, err = ssh.Dial("tcp", hostInfo.Endpoint, SSHconfig)
-			retryAvailable, successfulConnection := checkConnection(err)
-			if retryAvailable {
-				logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Endpoint %s: No route to SSH server (%d/%d)\n", hostInfo.Endpoint, attempts, maxConnectionAttempts)
-				continue
-			}
-			if !successfulConnection {
-				err = fmt.Errorf("failed TCP connection to server: %w", err)
-				return
-			}
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Endpoint %s: Establishing connection to SSH server (attempt %d/%d)\n", endpoint, attempt, maxAttempts)
+		}
 
+		client, err = dialSSH(ctx, proxyConn.lastClient(), hostInfo, endpoint)
+		if err == nil {
+			connectedEndpoint = endpoint
 			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Connected to SSH server\n", hostInfo.EndpointName)
+			return
+		}
 
+		// Only unreachable addresses fail over (handshake and authentication failures would fail on every address)
+		if !errors.Is(err, ErrEndpointUnreachable) {
 			break
 		}
+		if index+1 < len(endpoints) {
+			logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.WarnLog, "Endpoint %s: Unreachable, failing over to %s (attempt %d/%d): %v\n", endpoint, endpoints[index+1], attempt, maxAttempts, err)
+		}
 	}
 
+	_ = proxyConn.Close()
+	proxyConn = nil
+	if len(endpoints) > 1 && errors.Is(err, ErrEndpointUnreachable) {
+		err = fmt.Errorf("all %d addresses unreachable, last error: %w", len(endpoints), err)
+	}
+	// Proxy failures already name their hop, the leg after the last hop is the target itself
+	if len(proxyChain) > 0 {
+		err = fmt.Errorf("failed connection to target '%s' through proxy '%s': %w", hostInfo.EndpointName, proxyChain[len(proxyChain)-1].EndpointName, err)
+	}
 	return
 }
 
-// Checks for recoverable network connection errors
-func checkConnection(err error) (retryAvailable bool, connectionSucceeded bool) {
-	// Determine if error is recoverable
-	if err != nil {
-		if strings.Contains(err.Error(), "no route to host") {
-			// Sleep for small time to wait for network path
-			time.Sleep(200 * time.Millisecond)
-
-			// Return to try the connection again
-			connectionSucceeded = false
-			retryAvailable = true
+// Connects (or reuses existing connections) to every proxy hop in order
+// Errors name the hop that failed
+func connectProxyChain(ctx context.Context, hostInfo config.EndpointInfo, proxyChain []config.EndpointInfo) (proxyConn *ProxyLease, err error) {
+	proxyConn = &ProxyLease{}
+
+	var hopKey string
+	for hopIndex, proxyInfo := range proxyChain {
+		hopKey += "/" + string(proxyInfo.EndpointName) + "@" + proxyInfo.Endpoint
+		previousHop := proxyConn.lastClient()
+
+		var hop *sharedProxy
+		hop, err = proxyConnections.acquire(hopKey, func() (hopClient *ssh.Client, err error) {
+			// Proxy addresses are tried in order within a single attempt, the connection is shared with other hosts
+			if proxyInfo.EndpointError != nil {
+				err = proxyInfo.EndpointError
+				return
+			}
+			if len(proxyInfo.Endpoints()) == 0 {
+				err = fmt.Errorf("host has no address configured")
+				return
+			}
+			for _, endpoint := range proxyInfo.Endpoints() {
+				logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Endpoint %s: Establishing connection to SSH proxy server %s (hop %d/%d)\n", hostInfo.Endpoint, endpoint, hopIndex+1, len(proxyChain))
+				hopClient, err = dialSSH(ctx, previousHop, proxyInfo, endpoint)
+				if !errors.Is(err, ErrEndpointUnreachable) {
+					return
+				}
+			}
 			return
-		} else {
-			// All other errors, bail from connection attempts
-			connectionSucceeded = false
-			retryAvailable = false
+		})
+		if err != nil {
+			err = fmt.Errorf("failed connection to proxy hop %d/%d '%s': %w", hopIndex+1, len(proxyChain), proxyInfo.EndpointName, err)
+			_ = proxyConn.Close()
 			return
 		}
+
+		proxyConn.hops = append(proxyConn.hops, hop)
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Connected to SSH proxy server %s\n", proxyInfo.EndpointName)
+	}
+	return
+}
+
+// Connects to a single address of an SSH server, directly or tunneled through an already connected server
+// Failures before the SSH handshake are marked unreachable
+func dialSSH(ctx context.Context, through *ssh.Client, hostInfo config.EndpointInfo, endpoint string) (client *ssh.Client, err error) {
+	SSHconfig, authMethod := setupSSHConfig(ctx, hostInfo)
+
+	// TCP Connect to server (directly or through previous hop)
+	var conn net.Conn
+	if through == nil {
+		dialer := net.Dialer{Timeout: SSHconfig.Timeout}
+		conn, err = dialer.DialContext(ctx, "tcp", endpoint)
 	} else {
-		connectionSucceeded = true
-		retryAvailable = false
+		conn, err = through.Dial("tcp", endpoint)
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		err = fmt.Errorf("failed resolving server address %s: %w: %w", endpoint, ErrEndpointUnreachable, err)
 		return
 	}
+	if err != nil {
+		err = fmt.Errorf("failed TCP connection to server %s: %w: %w", endpoint, ErrEndpointUnreachable, err)
+		return
+	}
+
+	logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Connected by TCP to SSH server\n", hostInfo.EndpointName)
+
+	// SSH Handshake with server
+	clientConn, clientChannel, clientRequest, err := ssh.NewClientConn(conn, endpoint, SSHconfig)
+	if err != nil {
+		_ = conn.Close()
+		err = fmt.Errorf("failed SSH handshake to server: %w", err)
+		return
+	}
+
+	logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "Authenticated to SSH server using %s\n", *authMethod)
+
+	client = ssh.NewClient(clientConn, clientChannel, clientRequest)
+	return
 }
 
 func watchLongTransfer(ctx context.Context, filename str.RemotePath, done chan struct{}) {
@@ -176,9 +298,16 @@ func watchLongTransfer(ctx context.Context, filename str.RemotePath, done chan s
 	}
 }
 
-// Uploads content to specified remote file path via SCP
-func SCPUpload(ctx context.Context, client *ssh.Client, localFileContent []byte, remoteFilePath str.RemotePath) (err error) {
-	transferClient, err := scp.NewClientBySSHWithTimeout(client, 900*time.Second)
+// Uploads content to specified remote file path via SCP, paced by bandwidth when set
+func SCPUpload(ctx context.Context, client *ssh.Client, bandwidth *BandwidthLimiter, localFileContent []byte, remoteFilePath str.RemotePath) (err error) {
+	// Transfer is bounded by the context (see TransferTimeout)
+	// go-scp is never cancelled itself (it closes its stdin from two goroutines when it is), the session is closed under it instead
+	transferConn := newChannelClosingConn(client)
+	defer transferConn.release()
+	stopWatching := context.AfterFunc(ctx, transferConn.closeChannels)
+	defer stopWatching()
+
+	transferClient, err := scp.NewClientBySSH(transferConn.client())
 	if err != nil {
 		err = fmt.Errorf("failed to create scp session: %w", err)
 		return
@@ -186,16 +315,18 @@ func SCPUpload(ctx context.Context, client *ssh.Client, localFileContent []byte,
 	defer transferClient.Close()
 
 	// Convert input data to a Reader for SCP pkg
-	localContentReader := bytes.NewReader(localFileContent)
+	localContentReader := bandwidth.Reader(ctx, bytes.NewReader(localFileContent))
 	localContentSize := int64(len(localFileContent))
 
 	// Transfer content to remote file path
 	done := make(chan struct{})
 	go watchLongTransfer(ctx, remoteFilePath, done)
-	err = transferClient.Copy(context.Background(), localContentReader, string(remoteFilePath), "0640", localContentSize)
+	err = transferClient.Copy(context.WithoutCancel(ctx), localContentReader, string(remoteFilePath), "0640", localContentSize)
 	close(done)
 	if err != nil {
-		if strings.Contains(err.Error(), "permission denied") {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("failed scp transfer: %w (%w)", context.Cause(ctx), err)
+		} else if strings.Contains(err.Error(), "permission denied") {
 			err = fmt.Errorf("unable to write to %s (is it writable by the user?): %w", remoteFilePath, err)
 		} else {
 			err = fmt.Errorf("failed scp transfer: %w", err)
@@ -206,6 +337,205 @@ func SCPUpload(ctx context.Context, client *ssh.Client, localFileContent []byte,
 	return
 }
 
+// View of an SSH connection that can close every channel opened through it, without closing the connection
+type channelClosingConn struct {
+	ssh.Conn
+	lock     sync.Mutex
+	channels []ssh.Channel
+	closed   bool
+	released chan struct{}
+}
+
+func newChannelClosingConn(client *ssh.Client) (conn *channelClosingConn) {
+	conn = &channelClosingConn{Conn: client.Conn, released: make(chan struct{})}
+	return
+}
+
+func (conn *channelClosingConn) OpenChannel(name string, data []byte) (channel ssh.Channel, requests <-chan *ssh.Request, err error) {
+	channel, requests, err = conn.Conn.OpenChannel(name, data)
+	if err != nil {
+		return
+	}
+
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	if conn.closed {
+		_ = channel.Close()
+		err = fmt.Errorf("transfer ended before channel opened")
+		return
+	}
+	conn.channels = append(conn.channels, channel)
+	return
+}
+
+// Client on the view for libraries that open their own sessions, the remote never opens channels or sends requests on it
+func (conn *channelClosingConn) client() (client *ssh.Client) {
+	channels := make(chan ssh.NewChannel)
+	close(channels)
+	requests := make(chan *ssh.Request)
+	close(requests)
+	client = ssh.NewClient(conn, channels, requests)
+	return
+}
+
+// Closes all channels opened through this view, and any opened later
+func (conn *channelClosingConn) closeChannels() {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	conn.closed = true
+	for _, channel := range conn.channels {
+		_ = channel.Close()
+	}
+}
+
+// Never closes the shared connection, only the channels of this view
+func (conn *channelClosingConn) Close() (err error) {
+	conn.closeChannels()
+	return
+}
+
+// Returns once the view is released, so the client built on it does not wait on the shared connection
+func (conn *channelClosingConn) Wait() (err error) {
+	<-conn.released
+	return
+}
+
+func (conn *channelClosingConn) release() {
+	close(conn.released)
+}
+
+// Uploads a local file to specified remote file path via SFTP, reading the local file in chunks
+// Interrupted transfers are retried, resuming from the remote file size when its content matches the start of the local file
+func SFTPUploadFile(ctx context.Context, host HostMeta, localFilePath string, localFileSize int64, remoteFilePath str.RemotePath) (err error) {
+	done := make(chan struct{})
+	go watchLongTransfer(ctx, remoteFilePath, done)
+	defer close(done)
+
+	for attempt := 1; attempt <= MaxTransferAttempts; attempt++ {
+		var confirmed int64
+		confirmed, err = sftpUploadAttempt(ctx, host, localFilePath, localFileSize, remoteFilePath)
+		if err == nil {
+			return
+		}
+		if ctx.Err() != nil || attempt == MaxTransferAttempts {
+			break
+		}
+		logctx.LogEvent(ctx, logctx.VerbosityStandard, logctx.WarnLog, "Transfer of '%s' interrupted after %d of %d bytes, retrying: %v\n", remoteFilePath, confirmed, localFileSize, err)
+	}
+	err = fmt.Errorf("failed sftp transfer: %w", err)
+	return
+}
+
+// Single upload attempt, continues an existing partial remote file when possible
+func sftpUploadAttempt(ctx context.Context, host HostMeta, localFilePath string, localFileSize int64, remoteFilePath str.RemotePath) (confirmed int64, err error) {
+	localFile, err := os.Open(localFilePath)
+	if err != nil {
+		err = fmt.Errorf("failed to open local file: %w", err)
+		return
+	}
+	defer func() {
+		_ = localFile.Close()
+	}()
+
+	transferConn, err := newSFTPSession(ctx, host.SSHClient)
+	if err != nil {
+		return
+	}
+	defer func() {
+		lerr := transferConn.Close()
+		if err == nil && lerr != nil {
+			err = fmt.Errorf("failed to close sftp session: %w", lerr)
+		}
+	}()
+
+	// Uploads to the host share its bandwidth limit
+	transferConn.input = host.Bandwidth.Writer(ctx, transferConn.input)
+
+	// Closing the session unblocks a stalled transfer once the context ends
+	stopWatching := context.AfterFunc(ctx, func() {
+		_ = transferConn.Close()
+	})
+	defer stopWatching()
+
+	remoteSize, err := transferConn.stat(string(remoteFilePath))
+	if errors.Is(err, ErrSFTPNoSuchFile) {
+		remoteSize = 0
+		err = nil
+	} else if err != nil {
+		err = fmt.Errorf("failed to stat remote file: %w", err)
+		return
+	}
+
+	var resumeOffset int64
+	if remoteSize > 0 && remoteSize <= localFileSize {
+		var partialMatches bool
+		partialMatches, err = partialContentMatches(ctx, host, localFile, remoteSize, remoteFilePath)
+		if err != nil {
+			return
+		}
+		if partialMatches {
+			resumeOffset = remoteSize
+			logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "Resuming transfer of '%s' at byte %d of %d\n", remoteFilePath, resumeOffset, localFileSize)
+		}
+	}
+	confirmed = resumeOffset
+
+	handle, err := transferConn.openForWrite(string(remoteFilePath), resumeOffset == 0)
+	if err != nil {
+		err = fmt.Errorf("failed to open remote file: %w", err)
+		return
+	}
+
+	_, err = localFile.Seek(resumeOffset, io.SeekStart)
+	if err != nil {
+		err = fmt.Errorf("failed to seek local file: %w", err)
+		return
+	}
+
+	confirmed, err = transferConn.writeFrom(handle, localFile, resumeOffset, crypto.HashingBufferSize)
+	if err != nil {
+		return
+	}
+
+	err = transferConn.closeHandle(handle)
+	if err != nil {
+		err = fmt.Errorf("failed to close remote file: %w", err)
+		return
+	}
+	return
+}
+
+// Compares hash of the first length bytes of the local file and the remote file
+func partialContentMatches(ctx context.Context, host HostMeta, localFile *os.File, length int64, remoteFilePath str.RemotePath) (matches bool, err error) {
+	_, err = localFile.Seek(0, io.SeekStart)
+	if err != nil {
+		err = fmt.Errorf("failed to seek local file: %w", err)
+		return
+	}
+	localHash, err := crypto.SHA256SumReader(io.LimitReader(localFile, length))
+	if err != nil {
+		err = fmt.Errorf("failed to hash local partial content: %w", err)
+		return
+	}
+
+	// Transfer buffer belongs to the login user
+	command := BuildHostPartialHash(host, remoteFilePath, length)
+	command.DisableSudo = true
+	commandOutput, err := command.SSHexec(ctx, host.SSHClient, host.Password)
+	if err != nil {
+		err = fmt.Errorf("failed to hash remote partial content: %w", err)
+		return
+	}
+
+	validHash, remoteHash := parsing.HasHex64Prefix(commandOutput)
+	if !validHash {
+		err = fmt.Errorf("invalid hash received from remote sha256sum command")
+		return
+	}
+	matches = remoteHash == localHash
+	return
+}
+
 // Downloads a remote files content via SCP
 func SCPDownload(ctx context.Context, client *ssh.Client, remoteFilePath str.RemotePath) (fileContentBytes []byte, err error) {
 	transferClient, err := scp.NewClientBySSHWithTimeout(client, 90*time.Second)
@@ -279,11 +609,38 @@ func newSessionWithRetry(ctx context.Context, client *ssh.Client) (session *ssh.
 	}
 }
 
+// Privilege escalation prefix of the command (empty when sudo is disabled)
+// passwordArgs selects how sudo reads the password
+func (command RemoteCommand) sudoPrefix(passwordArgs string) (cmdPrefix string) {
+	if command.DisableSudo {
+		return
+	}
+	cmdPrefix = "sudo " + passwordArgs
+	if command.RunAsUser != "" && command.RunAsUser != "root" {
+		// Non-root other user requested, adding su to sudo
+		cmdPrefix += "-u " + QuoteShellArg(command.RunAsUser) + " "
+	}
+	return
+}
+
 // Runs the given remote ssh command optionally with sudo
 // runAs input will change to the user using sudo if not it will use root
 // disableSudo will determine if command runs with sudo or not (default, will always use sudo)
 // Empty sudoPassword will run without assuming the user account doesn't require any passwords
 func (command RemoteCommand) SSHexec(ctx context.Context, client *ssh.Client, sudoPassword string) (commandOutput string, err error) {
+	// Every failure carries the remote context of the command
+	startTime := time.Now()
+	failure := CommandError{Phase: phaseFromContext(ctx), Command: command.Raw, ExitCode: ExitCodeNone}
+	defer func() {
+		var commandErr *CommandError
+		if err == nil || errors.As(err, &commandErr) {
+			return
+		}
+		failure.Elapsed = time.Since(startTime)
+		failure.Err = err
+		err = &failure
+	}()
+
 	ctx = logctx.AppendCtxTag(ctx, logctx.NSParsing)
 
 	// Open new session (exec)
@@ -301,6 +658,12 @@ func (command RemoteCommand) SSHexec(ctx context.Context, client *ssh.Client, su
 
 	ctx = logctx.AppendCtxTag(ctx, logctx.NSSSH)
 
+	// Commands needing a terminal (sudo with requiretty, interactive tools) answer sudo prompts from the output instead
+	if command.RequestPTY || ptyFromContext(ctx) {
+		commandOutput, err = command.execPTY(ctx, session, sudoPassword, &failure)
+		return
+	}
+
 	stdout, err := session.StdoutPipe()
 	if err != nil {
 		err = fmt.Errorf("failed to get stdout pipe: %w", err)
@@ -325,22 +688,14 @@ func (command RemoteCommand) SSHexec(ctx context.Context, client *ssh.Client, su
 		}
 	}()
 
-	cmdPrefix := "sudo "
+	var passwordArgs string
 	if sudoPassword != "" {
 		// sudo password provided, adding stdin arg to sudo
-		cmdPrefix += "-S "
-	}
-	if command.RunAsUser != "" && command.RunAsUser != "root" {
-		// Non-root other user requested, adding su to sudo
-		cmdPrefix += "-u " + command.RunAsUser + " "
-	}
-	if command.DisableSudo {
-		// No sudo requested, remove sudo prefix
-		cmdPrefix = ""
+		passwordArgs = "-S "
 	}
 
 	// Add prefix to command
-	command.Raw = cmdPrefix + command.Raw
+	command.Raw = command.sudoPrefix(passwordArgs) + command.Raw
 
 	logctx.LogEvent(ctx, logctx.VerbosityDebug, logctx.InfoLog, "  Running command '%s'\n", command.Raw)
 
@@ -417,19 +772,34 @@ func (command RemoteCommand) SSHexec(ctx context.Context, client *ssh.Client, su
 			commandstderr, errorsError = io.ReadAll(stderr)
 			if errorsError != nil {
 				// Return at any errors reading the command error
-				err = fmt.Errorf("error reading error from command '%s': %w", command.Raw, errorsError)
+				err = fmt.Errorf("error reading error from command: %w", errorsError)
 				return
 			}
 
+			var exitErr *ssh.ExitError
+			if errors.As(err, &exitErr) {
+				failure.ExitCode = exitErr.ExitStatus()
+			}
+			if command.Capture != nil {
+				_, _ = io.Copy(io.Discard, teeReader)
+				command.Capture.Stdout = stdoutBuffer.String()
+				command.Capture.Stderr = string(commandstderr)
+			}
+			failure.Output = tailOutput(string(commandstderr))
+			if failure.Output == "" {
+				_, _ = io.Copy(io.Discard, teeReader) // Unread stdout still lands in the buffer
+				failure.Output = tailOutput(stdoutBuffer.String())
+			}
+
 			if strings.Contains(string(commandstderr), "sudo: a terminal is required to read the password") {
 				// Remove ambiguous sudo errors about missing required password - error is on our side
-				err = fmt.Errorf("internal failure: command '%s' attempted to run with sudo with no given password but password was required", command.Raw)
-				return
-			} else {
-				// Return commands error
-				err = fmt.Errorf("error with command '%s': %w: %s", command.Raw, err, string(commandstderr))
-				return
+				err = fmt.Errorf("internal failure: attempted to run with sudo with no given password but password was required: %w", err)
 			}
+			// Return commands error
+			failure.Elapsed = time.Since(startTime)
+			failure.Err = err
+			err = &failure
+			return
 		} else {
 			// nil from session.Wait() means exit status zero from the command
 			exitStatusZero = true
@@ -438,7 +808,7 @@ func (command RemoteCommand) SSHexec(ctx context.Context, client *ssh.Client, su
 	case <-ctx.Done():
 		_ = session.Signal(ssh.SIGTERM)
 		_ = session.Close()
-		err = fmt.Errorf("closed ssh session: exceeded timeout (%d seconds) for command '%s'", command.Timeout, command.Raw)
+		err = fmt.Errorf("closed ssh session: exceeded timeout (%d seconds)", command.Timeout)
 		return
 	}
 
@@ -462,6 +832,10 @@ func (command RemoteCommand) SSHexec(ctx context.Context, client *ssh.Client, su
 
 		commandOutput = string(commandstdout)
 	}
+	if command.Capture != nil {
+		command.Capture.Stdout = commandOutput
+		command.Capture.Stderr = commandError
+	}
 
 	// If the command had an error on the remote side and session indicated non-zero exit status
 	if commandError != "" && !exitStatusZero {
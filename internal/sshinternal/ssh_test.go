@@ -0,0 +1,255 @@
+package sshinternal
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Starts an SSH server (accepting any client when serverConfig is nil), returns its address and host key
+func serveTestSSH(t *testing.T, serverConfig *ssh.ServerConfig) (endpoint string, hostKey ssh.PublicKey) {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("failed creating host key signer: %v", err)
+	}
+	if serverConfig == nil {
+		serverConfig = &ssh.ServerConfig{NoClientAuth: true}
+	}
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed starting ssh server: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				serverConn, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(requests)
+				for newChannel := range channels {
+					_ = newChannel.Reject(ssh.Prohibited, "test server")
+				}
+				_ = serverConn.Close()
+			}()
+		}
+	}()
+
+	endpoint = listener.Addr().String()
+	hostKey = signer.PublicKey()
+	return
+}
+
+// Address of a closed port on the loopback interface
+func unreachableEndpoint(t *testing.T) (endpoint string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed reserving port: %v", err)
+	}
+	endpoint = listener.Addr().String()
+	_ = listener.Close()
+	return
+}
+
+func TestConnectToSSHFailover(t *testing.T) {
+	serverEndpoint, hostKey := serveTestSSH(t, nil)
+
+	// Host key is only pinned under the host name, not under any address
+	knownHost := knownhosts.HashHostname("web01") + " " + hostKey.Type() + " " + base64.StdEncoding.EncodeToString(hostKey.Marshal())
+
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.ConfKey, config.Config{KnownHosts: []string{knownHost}})
+
+	hostInfo := config.EndpointInfo{
+		EndpointName:      "web01",
+		Endpoint:          unreachableEndpoint(t),
+		FallbackEndpoints: []string{serverEndpoint},
+		KeyAlgo:           ssh.KeyAlgoED25519,
+		ConnectTimeout:    2,
+	}
+
+	client, proxyConn, connectedEndpoint, err := ConnectToSSH(ctx, hostInfo, nil)
+	if err != nil {
+		t.Fatalf("expected failover to succeed, got '%v'", err)
+	}
+	defer func() { _ = client.Close() }()
+	if len(proxyConn.hops) != 0 {
+		t.Errorf("expected no proxy hops, got %d", len(proxyConn.hops))
+	}
+	if connectedEndpoint != serverEndpoint {
+		t.Errorf("expected connection on fallback '%s', got '%s'", serverEndpoint, connectedEndpoint)
+	}
+
+	// Every address unreachable
+	hostInfo.FallbackEndpoints = []string{unreachableEndpoint(t)}
+	hostInfo.ConnectAttempts = 1
+	_, _, _, err = ConnectToSSH(ctx, hostInfo, nil)
+	if !errors.Is(err, ErrEndpointUnreachable) {
+		t.Errorf("expected unreachable error, got '%v'", err)
+	}
+}
+
+func TestConnectToSSHRetries(t *testing.T) {
+	ctx := t.Context()
+	ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+	ctx = context.WithValue(ctx, global.ConfKey, config.Config{})
+
+	// Dial failures are retried up to the attempt limit
+	hostInfo := config.EndpointInfo{
+		EndpointName:      "web01",
+		Endpoint:          unreachableEndpoint(t),
+		KeyAlgo:           ssh.KeyAlgoED25519,
+		ConnectTimeout:    2,
+		ConnectAttempts:   3,
+		ConnectRetryDelay: 10 * time.Millisecond,
+	}
+	_, _, _, err := ConnectToSSH(ctx, hostInfo, nil)
+	if !errors.Is(err, ErrEndpointUnreachable) || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("expected unreachable error after 3 attempts, got '%v'", err)
+	}
+
+	// Handshake failures (rejected authentication here) are never retried
+	rejectPassword := func(conn ssh.ConnMetadata, secret []byte) (*ssh.Permissions, error) {
+		return nil, errors.New("wrong password")
+	}
+	serverEndpoint, hostKey := serveTestSSH(t, &ssh.ServerConfig{PasswordCallback: rejectPassword})
+	knownHost := knownhosts.HashHostname("web01") + " " + hostKey.Type() + " " + base64.StdEncoding.EncodeToString(hostKey.Marshal())
+	ctx = context.WithValue(ctx, global.ConfKey, config.Config{KnownHosts: []string{knownHost}})
+	hostInfo.Endpoint = serverEndpoint
+	hostInfo.Password = "password1"
+	hostInfo.ConnectRetryDelay = time.Minute
+	start := time.Now()
+	_, _, _, err = ConnectToSSH(ctx, hostInfo, nil)
+	if err == nil || errors.Is(err, ErrEndpointUnreachable) {
+		t.Errorf("expected handshake error, got '%v'", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("expected handshake failure without retries, took %s", time.Since(start))
+	}
+}
+
+func TestConnectBackoff(t *testing.T) {
+	tests := []struct {
+		retry       int
+		expectedMin time.Duration
+		expectedMax time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{2, time.Second, 2 * time.Second},
+		{4, 4 * time.Second, 8 * time.Second},
+		{10, MaxConnectRetryDelay / 2, MaxConnectRetryDelay},
+	}
+	for _, test := range tests {
+		for range 20 {
+			delay := connectBackoff(time.Second, test.retry)
+			if delay < test.expectedMin || delay > test.expectedMax {
+				t.Errorf("retry %d: expected delay between %s and %s, got %s", test.retry, test.expectedMin, test.expectedMax, delay)
+			}
+		}
+	}
+}
+
+func TestSetupSSHConfigAuthMethods(t *testing.T) {
+	const password string = "password1"
+
+	_, clientPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating client key: %v", err)
+	}
+	clientKey, err := ssh.NewSignerFromKey(clientPrivateKey)
+	if err != nil {
+		t.Fatalf("failed creating client key signer: %v", err)
+	}
+
+	acceptPassword := func(conn ssh.ConnMetadata, secret []byte) (*ssh.Permissions, error) {
+		if string(secret) != password {
+			return nil, errors.New("wrong password")
+		}
+		return nil, nil
+	}
+	acceptKeyboardInteractive := func(conn ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+		answers, err := challenge("", "", []string{"Username: ", "Password: "}, []bool{true, false})
+		if err != nil || len(answers) != 2 || answers[1] != password {
+			return nil, errors.New("wrong password")
+		}
+		return nil, nil
+	}
+	rejectKey := func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		return nil, errors.New("key not accepted")
+	}
+
+	tests := []struct {
+		name           string
+		serverConfig   *ssh.ServerConfig
+		privateKey     ssh.Signer
+		password       string
+		expectedMethod string
+		expectedErr    bool
+	}{
+		{"password only", &ssh.ServerConfig{PasswordCallback: acceptPassword}, nil, password, authMethodPassword, false},
+		{"keyboard-interactive only", &ssh.ServerConfig{KeyboardInteractiveCallback: acceptKeyboardInteractive}, nil, password, authMethodKeyboardInteractive, false},
+		{"key rejected falls back to password", &ssh.ServerConfig{PublicKeyCallback: rejectKey, PasswordCallback: acceptPassword}, clientKey, password, authMethodPassword, false},
+		{"wrong password", &ssh.ServerConfig{PasswordCallback: acceptPassword, KeyboardInteractiveCallback: acceptKeyboardInteractive}, nil, "password2", authMethodKeyboardInteractive, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			serverEndpoint, hostKey := serveTestSSH(t, test.serverConfig)
+			knownHost := knownhosts.HashHostname("web01") + " " + hostKey.Type() + " " + base64.StdEncoding.EncodeToString(hostKey.Marshal())
+
+			ctx := t.Context()
+			ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+			ctx = context.WithValue(ctx, global.ConfKey, config.Config{KnownHosts: []string{knownHost}})
+
+			hostInfo := config.EndpointInfo{
+				EndpointName:   "web01",
+				EndpointUser:   "deployer",
+				Endpoint:       serverEndpoint,
+				PrivateKey:     test.privateKey,
+				KeyAlgo:        ssh.KeyAlgoED25519,
+				Password:       test.password,
+				ConnectTimeout: 2,
+			}
+
+			clientConfig, authMethod := setupSSHConfig(ctx, hostInfo)
+			client, err := ssh.Dial("tcp", serverEndpoint, clientConfig)
+			if test.expectedErr != (err != nil) {
+				t.Fatalf("expected error %t, got '%v'", test.expectedErr, err)
+			}
+			if client != nil {
+				_ = client.Close()
+			}
+			if *authMethod != test.expectedMethod {
+				t.Errorf("expected auth method '%s', got '%s'", test.expectedMethod, *authMethod)
+			}
+		})
+	}
+}
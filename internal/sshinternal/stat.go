@@ -1,6 +1,8 @@
 package sshinternal
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"scmp/internal/str"
 	"strconv"
@@ -112,3 +114,85 @@ func ExtractMetadataFromStat(statOutput string) (fileInfo RemoteFileInfo, err er
 	fileInfo.Exists = true
 	return
 }
+
+// Parses getfacl output into the named user and group entries (setfacl syntax)
+// Base entries and the mask are left out, they follow the file permissions
+func ExtractACLEntries(getfaclOutput string) (entries []string) {
+	for _, line := range strings.Split(getfaclOutput, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry, isDefault := strings.CutPrefix(line, "default:")
+		fields := strings.Split(entry, ":")
+		if len(fields) != 3 || fields[1] == "" {
+			continue
+		}
+		if fields[0] != "user" && fields[0] != "group" {
+			continue
+		}
+
+		if isDefault {
+			entry = "default:" + entry
+		}
+		entries = append(entries, entry)
+	}
+	return
+}
+
+// Parses getfattr dump output into attribute names and their decoded values
+// Values may be hex (0x), base64 (0s), or quoted text with octal escapes depending on the getfattr encoding
+func ExtractXattrs(getfattrOutput string) (xattrs map[string]string, err error) {
+	xattrs = make(map[string]string)
+	for _, line := range strings.Split(getfattrOutput, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "getfattr:") {
+			continue
+		}
+
+		// Older versions print attributes with empty values without '='
+		name, encodedValue, _ := strings.Cut(line, "=")
+
+		var value []byte
+		switch {
+		case strings.HasPrefix(encodedValue, "0x") || strings.HasPrefix(encodedValue, "0X"):
+			value, err = hex.DecodeString(encodedValue[2:])
+		case strings.HasPrefix(encodedValue, "0s") || strings.HasPrefix(encodedValue, "0S"):
+			value, err = base64.StdEncoding.DecodeString(encodedValue[2:])
+		case len(encodedValue) >= 2 && strings.HasPrefix(encodedValue, `"`) && strings.HasSuffix(encodedValue, `"`):
+			value = unescapeXattrText(encodedValue[1 : len(encodedValue)-1])
+		default:
+			value = []byte(encodedValue)
+		}
+		if err != nil {
+			err = fmt.Errorf("invalid value of extended attribute '%s': %w", name, err)
+			return
+		}
+
+		xattrs[name] = string(value)
+	}
+	return
+}
+
+// Reverses getfattr text escaping (\ooo octal bytes and backslash escaped characters)
+func unescapeXattrText(text string) (value []byte) {
+	for index := 0; index < len(text); index++ {
+		if text[index] != '\\' || index+1 == len(text) {
+			value = append(value, text[index])
+			continue
+		}
+
+		octal := text[index+1 : min(index+4, len(text))]
+		octalValue, err := strconv.ParseUint(octal, 8, 8)
+		if len(octal) == 3 && err == nil {
+			value = append(value, byte(octalValue))
+			index += 3
+			continue
+		}
+
+		value = append(value, text[index+1])
+		index++
+	}
+	return
+}
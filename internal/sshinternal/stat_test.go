@@ -1,6 +1,8 @@
 package sshinternal
 
 import (
+	"maps"
+	"slices"
 	"testing"
 )
 
@@ -197,3 +199,83 @@ file],[regular file],[root],[root],[777],[584938593485983],[]`,
 		})
 	}
 }
+
+func TestExtractACLEntries(t *testing.T) {
+	getfaclOutput := "user::rw-\nuser:appuser:r--\ngroup::r--\ngroup:ops:rw-\nmask::rw-\nother::---\ndefault:user::rwx\ndefault:group:ops:r-x\n\n"
+
+	entries := ExtractACLEntries(getfaclOutput)
+	expected := []string{"user:appuser:r--", "group:ops:rw-", "default:group:ops:r-x"}
+	if !slices.Equal(entries, expected) {
+		t.Errorf("expected entries %v, got %v", expected, entries)
+	}
+
+	// Files with only base entries produce no output with --skip-base
+	if entries := ExtractACLEntries(""); len(entries) != 0 {
+		t.Errorf("expected no entries for empty output, got %v", entries)
+	}
+}
+
+func TestExtractXattrs(t *testing.T) {
+	tests := []struct {
+		name           string
+		getfattrOutput string
+		expected       map[string]string
+		expectError    bool
+	}{
+		{
+			name:           "Hex encoding with absolute names",
+			getfattrOutput: "# file: /etc/app/app.conf\nuser.app_role=0x7072696d617279\ntrusted.tier=0x31\n\n",
+			expected:       map[string]string{"user.app_role": "primary", "trusted.tier": "1"},
+		},
+		{
+			name:           "Relative names and stripped leading slash notice",
+			getfattrOutput: "getfattr: Removing leading '/' from absolute path names\n# file: etc/app/app.conf\nuser.app_role=0x7072696d617279\n",
+			expected:       map[string]string{"user.app_role": "primary"},
+		},
+		{
+			name:           "Text encoding with escapes",
+			getfattrOutput: "# file: /etc/app/app.conf\nuser.app_role=\"primary\"\nuser.note=\"a\\\"b\\\\c\\012d\"\n",
+			expected:       map[string]string{"user.app_role": "primary", "user.note": "a\"b\\c\nd"},
+		},
+		{
+			name:           "Base64 encoding with CRLF line endings",
+			getfattrOutput: "# file: /etc/app/app.conf\r\nuser.app_role=0scHJpbWFyeQ==\r\n",
+			expected:       map[string]string{"user.app_role": "primary"},
+		},
+		{
+			name:           "Empty values in old and new forms",
+			getfattrOutput: "# file: /etc/app/app.conf\nuser.flag\nuser.other=\"\"\n",
+			expected:       map[string]string{"user.flag": "", "user.other": ""},
+		},
+		{
+			name:           "No attributes",
+			getfattrOutput: "",
+			expected:       map[string]string{},
+		},
+		{
+			name:           "Invalid hex value",
+			getfattrOutput: "# file: /etc/app/app.conf\nuser.app_role=0xzz\n",
+			expectError:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			xattrs, err := ExtractXattrs(test.getfattrOutput)
+
+			if test.expectError {
+				if err == nil {
+					t.Fatalf("expected error, but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !maps.Equal(xattrs, test.expected) {
+				t.Errorf("expected attributes %q, got %q", test.expected, xattrs)
+			}
+		})
+	}
+}
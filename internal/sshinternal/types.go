@@ -2,18 +2,38 @@
 package sshinternal
 
 import (
+	"scmp/internal/config"
 	"scmp/internal/str"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
 
+// Remote context of a failed command, attached to every error returned by SSHexec
+type CommandError struct {
+	Phase    string        // Deployment phase the command ran in (empty outside deployments)
+	Command  string        // Command as given, without the sudo wrapper
+	ExitCode int           // ExitCodeNone when the command never exited
+	Output   string        // Trailing output of the command (stderr, or stdout when stderr is empty)
+	Elapsed  time.Duration // Time from session start to failure
+	Err      error
+}
+
 // Type for commands run remotely
 type RemoteCommand struct {
-	Raw          string // Command string
-	RunAsUser    string // Username to run command as (only with sudo)
-	DisableSudo  bool   // Run command with privileges (as login user)
-	Timeout      int    // In seconds
-	StreamStdout bool   // Progressively stream output of command to stdout of this program (almost always false)
+	Raw          string          // Command string
+	RunAsUser    string          // Username to run command as (only with sudo)
+	DisableSudo  bool            // Run command with privileges (as login user)
+	Timeout      int             // In seconds
+	StreamStdout bool            // Progressively stream output of command to stdout of this program (almost always false)
+	Capture      *CommandCapture // Receives the complete stdout and stderr of the command, also on failure (optional)
+	RequestPTY   bool            // Run on a pseudo-terminal, stderr is merged into stdout (also enabled by WithPTY)
+}
+
+// Complete output of a remote command, kept separate per stream
+type CommandCapture struct {
+	Stdout string
+	Stderr string
 }
 
 // Struct for remote file metadata
@@ -27,6 +47,7 @@ type RemoteFileInfo struct {
 	Size        int
 	LinkTarget  str.RemotePath
 	Exists      bool
+	XattrDump   string // getfattr output read before deployment, reapplied on restoration (empty when not read)
 }
 
 // Deployment host metadata to easily pass between SSH functions
@@ -37,4 +58,41 @@ type HostMeta struct {
 	SSHClient         *ssh.Client
 	TransferBufferDir str.RemotePath
 	BackupPath        str.RemotePath
+	BackupArchivePath str.RemotePath    // Archive directory of this deployment (empty unless files use archive backups)
+	Facts             config.HostFacts  // Empty unless facts were gathered
+	Utilities         RemoteUtilities   // Empty until probed (stat then follows the OS family and hashing uses sha256sum)
+	Bandwidth         *BandwidthLimiter // Paces SFTP uploads to the host (nil is unlimited)
+}
+
+// Variants of the remote commands whose syntax or output differs between systems
+type RemoteUtilities struct {
+	Probed  bool
+	Stat    string   // StatGNU, StatBusyBox, or StatBSD (empty when no usable stat was found)
+	Hash    string   // SHA256 checksum command (empty when none was found)
+	Missing []string // Required commands not found on the host
+}
+
+// Hashed known_hosts line
+type knownHostEntry struct {
+	salt       string // Base64 HMAC-SHA1 key
+	hashedHost string // Base64 HMAC-SHA1 of the host name
+	pubKeyType string
+	pubKey     string // Base64 wire encoding of the key
+}
+
+// Host key presented by a server, read without authenticating
+type ScannedHostKey struct {
+	Endpoint      string // Address the key was read from
+	KnownHostName string // Name the key is stored under in known_hosts
+	Key           ssh.PublicKey
+}
+
+// Unencrypted header of OpenSSH format private key files (after the magic bytes)
+type openSSHKeyHeader struct {
+	CipherName   string
+	KdfName      string
+	KdfOpts      string
+	NumKeys      uint32
+	PubKey       []byte
+	PrivKeyBlock []byte
 }
@@ -3,4 +3,9 @@ package setup
 const (
 	InternalCommitUserName  string = "SCMPController" // User to use when specific user is not available
 	InternalCommitUserEmail string = "scmpc@localhost"
+
+	LegacyConfigPath       string = "~/.ssh/scmpc.yaml"    // Default v4 controller configuration file
+	legacyFailTrackerFile  string = ".failtracker.meta"    // v4 failtracker file name (root of repository)
+	migrationBackupSuffix  string = ".v4-migration.bak"    // Appended to file names of backed up originals outside the repository
+	migrationBackupRepoDir string = "_v4-migration-backup" // Repository directory for backed up originals (ignored by deployments)
 )
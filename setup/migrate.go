@@ -0,0 +1,147 @@
+package setup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"scmp/internal/config"
+	"scmp/internal/fsops"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"strings"
+)
+
+// Item found during migration that could not be converted automatically
+type migrationReview struct {
+	location string // File or config section the item was found in
+	reason   string
+}
+
+// Migrates v4 controller conventions (YAML config, legacy headers, legacy failtracker) to the current layout
+// All changes are left uncommitted in the worktree and originals are backed up prior to modification
+func MigrateV4(ctx context.Context, legacyConfigPath string, sshConfigPath string, repoPath string) (err error) {
+	opts := global.AssertFromContext[config.Opts](ctx, "opts", global.OpsKey, "config.Opts")
+
+	legacyConfigPath, err = fsops.ExpandHomeDirectory(legacyConfigPath)
+	if err != nil {
+		err = fmt.Errorf("failed to resolve absolute path for '%s': %w", legacyConfigPath, err)
+		return
+	}
+	sshConfigPath, err = fsops.ExpandHomeDirectory(sshConfigPath)
+	if err != nil {
+		err = fmt.Errorf("failed to resolve absolute path for '%s': %w", sshConfigPath, err)
+		return
+	}
+	repoPath, err = filepath.Abs(repoPath)
+	if err != nil {
+		err = fmt.Errorf("failed to get absolute path to repository: %w", err)
+		return
+	}
+
+	if opts.DryRunEnabled {
+		logctx.LogStdInfo(ctx, "Dry-run requested, no files will be modified\n")
+	}
+
+	var reviews []migrationReview
+
+	// Controller configuration
+	if fsops.FileExists(legacyConfigPath) {
+		var configReviews []migrationReview
+		configReviews, err = migrateLegacyConfig(ctx, legacyConfigPath, sshConfigPath, opts.DryRunEnabled)
+		if err != nil {
+			err = fmt.Errorf("failed migrating configuration: %w", err)
+			return
+		}
+		reviews = append(reviews, configReviews...)
+	} else {
+		logctx.LogStdInfo(ctx, "No legacy configuration file found at '%s', skipping configuration migration\n", legacyConfigPath)
+	}
+
+	// Repository metadata headers
+	headerReviews, err := migrateRepositoryHeaders(ctx, repoPath, opts.DryRunEnabled)
+	if err != nil {
+		err = fmt.Errorf("failed migrating repository metadata headers: %w", err)
+		return
+	}
+	reviews = append(reviews, headerReviews...)
+
+	// Last deployment failures
+	failTrackerReviews, err := migrateLegacyFailTracker(ctx, repoPath, filepath.Dir(sshConfigPath), opts.DryRunEnabled)
+	if err != nil {
+		err = fmt.Errorf("failed migrating failtracker file: %w", err)
+		return
+	}
+	reviews = append(reviews, failTrackerReviews...)
+
+	printMigrationReport(ctx, reviews)
+	return
+}
+
+// Shows user everything that needs manual attention after migration
+func printMigrationReport(ctx context.Context, reviews []migrationReview) {
+	if len(reviews) == 0 {
+		logctx.LogStdInfo(ctx, "Migration complete, no items require manual review\n")
+		return
+	}
+
+	logctx.LogStdInfo(ctx, "Migration complete, %d item(s) require manual review:\n", len(reviews))
+	for _, review := range reviews {
+		logctx.LogStdInfo(ctx, "  %s: %s\n", review.location, review.reason)
+	}
+}
+
+// Copies original file to its backup location (does not overwrite existing backups)
+func backupOriginal(originalPath string, backupPath string) (err error) {
+	if fsops.FileExists(backupPath) {
+		err = fmt.Errorf("backup file '%s' already exists, refusing to overwrite it", backupPath)
+		return
+	}
+
+	originalInfo, err := os.Stat(originalPath)
+	if err != nil {
+		return
+	}
+
+	original, err := os.ReadFile(originalPath)
+	if err != nil {
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(backupPath), 0700)
+	if err != nil {
+		err = fmt.Errorf("failed to create backup directory: %w", err)
+		return
+	}
+
+	err = os.WriteFile(backupPath, original, originalInfo.Mode().Perm())
+	if err != nil {
+		err = fmt.Errorf("failed to write backup file: %w", err)
+		return
+	}
+	return
+}
+
+// Writes new contents over existing file while retaining existing permissions
+func overwriteFile(path string, contents string) (err error) {
+	perms := os.FileMode(0600)
+	existingInfo, err := os.Stat(path)
+	if err == nil {
+		perms = existingInfo.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return
+	}
+
+	err = os.WriteFile(path, []byte(contents), perms)
+	return
+}
+
+// Indents multi-line text for printing
+func indentText(text string, indent string) (indented string) {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for index, line := range lines {
+		lines[index] = indent + line
+	}
+	indented = strings.Join(lines, "\n") + "\n"
+	return
+}
@@ -0,0 +1,319 @@
+package setup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"scmp/internal/logctx"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kevinburke/ssh_config"
+	"gopkg.in/yaml.v2"
+)
+
+// v4 controller YAML configuration
+type legacyConfig struct {
+	TemplateDirectory string `yaml:"TemplateDirectory"`
+	PasswordVault     string `yaml:"PasswordVault"`
+	SSHClient         struct {
+		KnownHostsFile     string `yaml:"KnownHostsFile"`
+		MaximumConcurrency int    `yaml:"MaximumConcurrency"`
+	} `yaml:"SSHClient"`
+	SSHClientDefault  legacyEndpoint            `yaml:"SSHClientDefault"`
+	DeployerEndpoints map[string]legacyEndpoint `yaml:"DeployerEndpoints"`
+}
+
+// v4 per-host (and default) endpoint options
+type legacyEndpoint struct {
+	Endpoint         string   `yaml:"endpoint"`
+	EndpointPort     int      `yaml:"endpointPort"`
+	EndpointUser     string   `yaml:"endpointUser"`
+	IdentityFile     string   `yaml:"SSHIdentityFile"`
+	UseSSHAgent      bool     `yaml:"UseSSHAgent"`
+	Proxy            string   `yaml:"proxy"`
+	PasswordRequired bool     `yaml:"passwordRequired"`
+	DeploymentState  string   `yaml:"deploymentState"`
+	IgnoreTemplates  bool     `yaml:"ignoreTemplates"`
+	GroupTemplates   []string `yaml:"groupTemplates"`
+}
+
+// Converts legacy YAML config into SSH config options and merges them into the SSH config file
+func migrateLegacyConfig(ctx context.Context, legacyConfigPath string, sshConfigPath string, dryRun bool) (reviews []migrationReview, err error) {
+	logctx.LogStdInfo(ctx, "Migrating legacy configuration '%s' to '%s'\n", legacyConfigPath, sshConfigPath)
+
+	legacyConfigFile, err := os.ReadFile(legacyConfigPath)
+	if err != nil {
+		err = fmt.Errorf("failed reading legacy configuration: %w", err)
+		return
+	}
+
+	legacy, reviews, err := parseLegacyConfig(legacyConfigFile)
+	if err != nil {
+		return
+	}
+
+	var existingConfig string
+	sshConfigExists := false
+	existingConfigFile, err := os.ReadFile(sshConfigPath)
+	if err == nil {
+		existingConfig = string(existingConfigFile)
+		sshConfigExists = true
+	} else if !os.IsNotExist(err) {
+		err = fmt.Errorf("failed reading SSH configuration: %w", err)
+		return
+	}
+	err = nil
+
+	newConfig, mergeReviews, err := mergeLegacyConfig(legacy, existingConfig, legacyConfigPath)
+	if err != nil {
+		return
+	}
+	reviews = append(reviews, mergeReviews...)
+
+	logctx.LogStdInfo(ctx, "Generated SSH configuration:\n%s", indentText(newConfig, "  "))
+
+	if dryRun {
+		return
+	}
+
+	if sshConfigExists {
+		err = backupOriginal(sshConfigPath, sshConfigPath+migrationBackupSuffix)
+		if err != nil {
+			err = fmt.Errorf("failed backing up SSH configuration: %w", err)
+			return
+		}
+	}
+
+	err = overwriteFile(sshConfigPath, newConfig)
+	if err != nil {
+		err = fmt.Errorf("failed writing SSH configuration: %w", err)
+		return
+	}
+
+	// Old config is left in place (web config shares default path), but user should know it is no longer read
+	reviews = append(reviews, migrationReview{
+		location: legacyConfigPath,
+		reason:   "legacy configuration is no longer used by the controller and can be removed once migration is verified",
+	})
+	return
+}
+
+// Decodes legacy configuration and notes any options that cannot be converted
+func parseLegacyConfig(legacyConfigFile []byte) (legacy legacyConfig, reviews []migrationReview, err error) {
+	err = yaml.Unmarshal(legacyConfigFile, &legacy)
+	if err != nil {
+		err = fmt.Errorf("failed decoding legacy configuration: %w", err)
+		return
+	}
+
+	// Compare against generic decode to find options unknown to the converter
+	var rawConfig map[string]any
+	err = yaml.Unmarshal(legacyConfigFile, &rawConfig)
+	if err != nil {
+		err = fmt.Errorf("failed decoding legacy configuration: %w", err)
+		return
+	}
+	knownSections := map[string]struct{}{
+		"TemplateDirectory": {},
+		"PasswordVault":     {},
+		"SSHClient":         {},
+		"SSHClientDefault":  {},
+		"DeployerEndpoints": {},
+	}
+	var unknownSections []string
+	for section := range rawConfig {
+		if _, known := knownSections[section]; !known {
+			unknownSections = append(unknownSections, section)
+		}
+	}
+	sort.Strings(unknownSections)
+	for _, section := range unknownSections {
+		reviews = append(reviews, migrationReview{
+			location: "config:" + section,
+			reason:   "option has no equivalent and was not converted",
+		})
+	}
+
+	if legacy.SSHClient.MaximumConcurrency > 0 {
+		reviews = append(reviews, migrationReview{
+			location: "config:SSHClient.MaximumConcurrency",
+			reason:   fmt.Sprintf("concurrency is now set per invocation, use '--max-conns %d'", legacy.SSHClient.MaximumConcurrency),
+		})
+	}
+	if legacy.SSHClientDefault.UseSSHAgent {
+		reviews = append(reviews, migrationReview{
+			location: "config:SSHClientDefault.UseSSHAgent",
+			reason:   "agent use is automatic when IdentityFile points to a public key, verify IdentityFile values",
+		})
+	}
+
+	if len(legacy.DeployerEndpoints) == 0 {
+		reviews = append(reviews, migrationReview{
+			location: "config:DeployerEndpoints",
+			reason:   "no hosts found in legacy configuration",
+		})
+	}
+	return
+}
+
+// Creates new SSH config text from legacy options and any existing SSH config contents
+// Generated global options are placed after existing global options and generated hosts before existing host blocks
+// (first obtained value wins, so existing wildcard hosts do not override migrated host values)
+func mergeLegacyConfig(legacy legacyConfig, existingConfig string, legacyConfigPath string) (newConfig string, reviews []migrationReview, err error) {
+	existing, err := ssh_config.Decode(strings.NewReader(existingConfig))
+	if err != nil {
+		err = fmt.Errorf("failed decoding existing SSH configuration: %w", err)
+		return
+	}
+
+	// Hosts already present in SSH config are not overwritten
+	existingHosts := make(map[string]struct{})
+	for _, host := range existing.Hosts {
+		for _, pattern := range host.Patterns {
+			existingHosts[pattern.String()] = struct{}{}
+		}
+	}
+
+	// Global options
+	var globals strings.Builder
+	globals.WriteString("# Migrated from " + legacyConfigPath + "\n")
+	addGlobal := func(key string, value string) {
+		if value == "" {
+			return
+		}
+		existingValue, _ := existing.Get("", key)
+		if existingValue != "" {
+			if existingValue != value {
+				reviews = append(reviews, migrationReview{
+					location: "config:" + key,
+					reason:   fmt.Sprintf("existing SSH config value '%s' kept instead of legacy value '%s'", existingValue, value),
+				})
+			}
+			return
+		}
+		globals.WriteString(fmt.Sprintf("%-23s %s\n", key, value))
+	}
+	addGlobal("IgnoreUnknown", "PasswordVault,PasswordRequired,DeploymentState,UniversalDirectory,GroupTags,IgnoreUniversal")
+	addGlobal("UniversalDirectory", legacy.TemplateDirectory)
+	addGlobal("PasswordVault", legacy.PasswordVault)
+	addGlobal("UserKnownHostsFile", legacy.SSHClient.KnownHostsFile)
+
+	// Host blocks in stable order
+	hostNames := make([]string, 0, len(legacy.DeployerEndpoints))
+	for hostName := range legacy.DeployerEndpoints {
+		hostNames = append(hostNames, hostName)
+	}
+	sort.Strings(hostNames)
+
+	var hosts strings.Builder
+	for _, hostName := range hostNames {
+		if _, hostExists := existingHosts[hostName]; hostExists {
+			reviews = append(reviews, migrationReview{
+				location: "config:DeployerEndpoints." + hostName,
+				reason:   "host already defined in SSH config, legacy options were not converted",
+			})
+			continue
+		}
+
+		endpoint := mergeLegacyEndpoint(legacy.SSHClientDefault, legacy.DeployerEndpoints[hostName])
+		if endpoint.Endpoint == "" {
+			reviews = append(reviews, migrationReview{
+				location: "config:DeployerEndpoints." + hostName,
+				reason:   "host has no endpoint address",
+			})
+		}
+
+		hosts.WriteString(formatHostBlock(hostName, endpoint))
+	}
+
+	// Split existing config at first host block to retain existing global options at top
+	existingGlobals, existingHostBlocks := splitSSHConfigGlobals(existingConfig)
+
+	var config strings.Builder
+	config.WriteString(existingGlobals)
+	if existingGlobals != "" && !strings.HasSuffix(existingGlobals, "\n") {
+		config.WriteString("\n")
+	}
+	config.WriteString(globals.String())
+	config.WriteString(hosts.String())
+	config.WriteString(existingHostBlocks)
+
+	newConfig = config.String()
+	return
+}
+
+// Applies legacy default values to any options a host did not set itself
+func mergeLegacyEndpoint(defaults legacyEndpoint, host legacyEndpoint) (merged legacyEndpoint) {
+	merged = host
+	if merged.EndpointPort == 0 {
+		merged.EndpointPort = defaults.EndpointPort
+	}
+	if merged.EndpointUser == "" {
+		merged.EndpointUser = defaults.EndpointUser
+	}
+	if merged.IdentityFile == "" {
+		merged.IdentityFile = defaults.IdentityFile
+	}
+	if merged.Proxy == "" {
+		merged.Proxy = defaults.Proxy
+	}
+	if merged.DeploymentState == "" {
+		merged.DeploymentState = defaults.DeploymentState
+	}
+	merged.PasswordRequired = merged.PasswordRequired || defaults.PasswordRequired
+	return
+}
+
+// Creates SSH config host block text for a single legacy host
+func formatHostBlock(hostName string, endpoint legacyEndpoint) (block string) {
+	var hostBlock strings.Builder
+	hostBlock.WriteString("Host " + hostName + "\n")
+
+	addOption := func(key string, value string) {
+		if value == "" {
+			return
+		}
+		hostBlock.WriteString(fmt.Sprintf("        %-16s %s\n", key, value))
+	}
+	addOption("Hostname", endpoint.Endpoint)
+	if endpoint.EndpointPort > 0 {
+		addOption("Port", strconv.Itoa(endpoint.EndpointPort))
+	}
+	addOption("User", endpoint.EndpointUser)
+	addOption("IdentityFile", endpoint.IdentityFile)
+	addOption("ProxyJump", endpoint.Proxy)
+	if endpoint.PasswordRequired {
+		addOption("PasswordRequired", "yes")
+	}
+	addOption("DeploymentState", endpoint.DeploymentState)
+	addOption("GroupTags", strings.Join(endpoint.GroupTemplates, ","))
+	if endpoint.IgnoreTemplates {
+		addOption("IgnoreUniversal", "yes")
+	}
+
+	block = hostBlock.String()
+	return
+}
+
+// Separates SSH config text into global options section and host/match blocks section
+func splitSSHConfigGlobals(sshConfig string) (globals string, hostBlocks string) {
+	lines := strings.SplitAfter(sshConfig, "\n")
+	for index, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		keyword := strings.ToLower(fields[0])
+		if keyword == "host" || keyword == "match" {
+			globals = strings.Join(lines[:index], "")
+			hostBlocks = strings.Join(lines[index:], "")
+			return
+		}
+	}
+
+	globals = sshConfig
+	return
+}
@@ -0,0 +1,364 @@
+package setup
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"scmp/core/deployment"
+	"scmp/core/deployment/metrics"
+	"scmp/core/filesystem"
+	"scmp/internal/fsops"
+	"scmp/internal/logctx"
+	"scmp/internal/parsing"
+	"scmp/internal/str"
+	"sort"
+	"strings"
+)
+
+// v4 failtracker host failure line
+type legacyFailure struct {
+	EndpointName str.RepoRootDir     `json:"endpointName"`
+	Files        []str.LocalRepoPath `json:"files"`
+	ErrorMessage string              `json:"errorMessage"`
+}
+
+// Header fields removed from the current metadata header format
+var legacyHeaderFields = []string{"ReloadRequired"}
+
+// Rewrites legacy metadata headers for every file in the repository
+func migrateRepositoryHeaders(ctx context.Context, repoPath string, dryRun bool) (reviews []migrationReview, err error) {
+	logctx.LogStdInfo(ctx, "Migrating metadata headers in repository '%s'\n", repoPath)
+
+	repoFiles, err := fsops.GetAllRepoFiles(repoPath)
+	if err != nil {
+		err = fmt.Errorf("failed retrieving repository files: %w", err)
+		return
+	}
+	sort.Slice(repoFiles, func(i, j int) bool { return repoFiles[i] < repoFiles[j] })
+
+	var migratedCount int
+	for _, repoFile := range repoFiles {
+		// Skip git internals and previous migration backups
+		topDir := strings.Split(string(repoFile), string(os.PathSeparator))[0]
+		if topDir == ".git" || topDir == migrationBackupRepoDir {
+			continue
+		}
+
+		fullPath := filepath.Join(repoPath, string(repoFile))
+
+		var fileContents []byte
+		fileContents, err = os.ReadFile(fullPath)
+		if err != nil {
+			err = fmt.Errorf("failed reading '%s': %w", repoFile, err)
+			return
+		}
+
+		newContents, changed, fileReviews, lerr := migrateHeader(string(fileContents))
+		for _, review := range fileReviews {
+			review.location = string(repoFile)
+			reviews = append(reviews, review)
+		}
+		if lerr != nil {
+			reviews = append(reviews, migrationReview{
+				location: string(repoFile),
+				reason:   fmt.Sprintf("unable to migrate header: %v", lerr),
+			})
+			continue
+		}
+		if !changed {
+			continue
+		}
+
+		migratedCount++
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "  Migrating header in '%s'\n", repoFile)
+
+		if dryRun {
+			logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "  New contents of '%s':\n%s", repoFile, indentText(newContents, "    "))
+			continue
+		}
+
+		err = backupOriginal(fullPath, filepath.Join(repoPath, migrationBackupRepoDir, string(repoFile)))
+		if err != nil {
+			err = fmt.Errorf("failed backing up '%s': %w", repoFile, err)
+			return
+		}
+
+		err = overwriteFile(fullPath, newContents)
+		if err != nil {
+			err = fmt.Errorf("failed writing '%s': %w", repoFile, err)
+			return
+		}
+	}
+
+	logctx.LogStdInfo(ctx, "Migrated %d metadata header(s)\n", migratedCount)
+	if migratedCount > 0 && !dryRun {
+		logctx.LogStdInfo(ctx, "Original files backed up to '%s' (directory is ignored by deployments)\n", filepath.Join(repoPath, migrationBackupRepoDir))
+	}
+	return
+}
+
+// Removes legacy fields from a metadata header, leaving all other header fields and file content untouched
+// Files without a metadata header are returned unchanged
+func migrateHeader(fileContents string) (newContents string, changed bool, reviews []migrationReview, err error) {
+	newContents = fileContents
+
+	startIndex := strings.Index(fileContents, filesystem.MetaDelimiter)
+	if startIndex == -1 {
+		return
+	}
+	startIndex += len(filesystem.MetaDelimiter)
+
+	endIndex := strings.Index(fileContents[startIndex:], filesystem.MetaDelimiter)
+	if endIndex == -1 {
+		err = fmt.Errorf("json end delimiter missing")
+		return
+	}
+	endIndex += startIndex
+
+	// Retain delimiter line prefixes/suffixes, only the JSON section is replaced
+	rawSection := fileContents[startIndex:endIndex]
+	sectionLines := strings.Split(rawSection, "\n")
+
+	// Detect comment prefix used on JSON lines
+	var linePrefix string
+	for _, line := range sectionLines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		for _, prefix := range []string{"#", "//", ";"} {
+			if strings.HasPrefix(trimmed, prefix) {
+				linePrefix = prefix
+			}
+		}
+		break
+	}
+
+	var jsonLines []string
+	for _, line := range sectionLines {
+		jsonLines = append(jsonLines, strings.TrimPrefix(strings.TrimSpace(line), linePrefix))
+	}
+	jsonSection := strings.ReplaceAll(strings.Join(jsonLines, "\n"), "\r", "")
+
+	var header map[string]json.RawMessage
+	err = json.Unmarshal([]byte(jsonSection), &header)
+	if err != nil {
+		err = fmt.Errorf("invalid metadata header: %w", err)
+		return
+	}
+
+	// Legacy reloads were only run when explicitly required
+	reloadRequired, hasReloadRequired := header["ReloadRequired"]
+	if hasReloadRequired && string(reloadRequired) == "false" {
+		var reloadCmds []string
+		_ = json.Unmarshal(header["Reload"], &reloadCmds)
+		if len(reloadCmds) > 0 {
+			reviews = append(reviews, migrationReview{
+				reason: "ReloadRequired was false but Reload commands are present, they will now run on every change",
+			})
+		}
+	}
+
+	for _, field := range legacyHeaderFields {
+		if _, present := header[field]; present {
+			delete(header, field)
+			changed = true
+		}
+	}
+
+	// Order fields as the current header format does, any unrecognized fields last
+	var orderedKeys []string
+	knownFields := make(map[string]struct{})
+	headerType := reflect.TypeOf(filesystem.MetaHeader{})
+	for index := 0; index < headerType.NumField(); index++ {
+		key := strings.Split(headerType.Field(index).Tag.Get("json"), ",")[0]
+		knownFields[key] = struct{}{}
+		if _, present := header[key]; present {
+			orderedKeys = append(orderedKeys, key)
+		}
+	}
+	var unknownKeys []string
+	for key := range header {
+		if _, known := knownFields[key]; !known {
+			unknownKeys = append(unknownKeys, key)
+		}
+	}
+	sort.Strings(unknownKeys)
+	for _, key := range unknownKeys {
+		reviews = append(reviews, migrationReview{
+			reason: fmt.Sprintf("header field '%s' is not recognized and was left in place", key),
+		})
+	}
+	orderedKeys = append(orderedKeys, unknownKeys...)
+
+	if !changed {
+		return
+	}
+
+	// Keep any text sharing a line with the delimiters (i.e. comment markers)
+	leadingText, trailingText := "\n", ""
+	firstNewline := strings.Index(rawSection, "\n")
+	lastNewline := strings.LastIndex(rawSection, "\n")
+	if firstNewline != -1 && !strings.Contains(rawSection[:firstNewline], "{") {
+		leadingText = rawSection[:firstNewline+1]
+	}
+	if lastNewline != -1 && !strings.Contains(rawSection[lastNewline:], "}") {
+		trailingText = rawSection[lastNewline+1:]
+	}
+
+	var newHeader strings.Builder
+	newHeader.WriteString(leadingText + linePrefix + "{\n")
+	for index, key := range orderedKeys {
+		var value []byte
+		value, err = json.MarshalIndent(header[key], linePrefix+"  ", "  ")
+		if err != nil {
+			err = fmt.Errorf("failed formatting header field '%s': %w", key, err)
+			return
+		}
+		value = parsing.UnescapeShellRedirectors(value)
+
+		newHeader.WriteString(fmt.Sprintf("%s  %q: %s", linePrefix, key, value))
+		if index < len(orderedKeys)-1 {
+			newHeader.WriteString(",")
+		}
+		newHeader.WriteString("\n")
+	}
+	newHeader.WriteString(linePrefix + "}\n")
+	newHeader.WriteString(trailingText)
+
+	newContents = fileContents[:startIndex] + newHeader.String() + fileContents[endIndex:]
+	return
+}
+
+// Converts legacy failtracker in repository root to the current deployment summary file
+func migrateLegacyFailTracker(ctx context.Context, repoPath string, configDirectory string, dryRun bool) (reviews []migrationReview, err error) {
+	legacyPath := filepath.Join(repoPath, legacyFailTrackerFile)
+	if !fsops.FileExists(legacyPath) {
+		logctx.LogEvent(ctx, logctx.VerbosityProgress, logctx.InfoLog, "No legacy failtracker file found, skipping failtracker migration\n")
+		return
+	}
+
+	newPath := filepath.Join(configDirectory, deployment.FailTrackerFile)
+	logctx.LogStdInfo(ctx, "Migrating legacy failtracker '%s' to '%s'\n", legacyPath, newPath)
+
+	legacyFile, err := os.ReadFile(legacyPath)
+	if err != nil {
+		err = fmt.Errorf("failed reading legacy failtracker: %w", err)
+		return
+	}
+
+	summary, reviews, err := convertLegacyFailTracker(legacyFile)
+	if err != nil {
+		return
+	}
+
+	if dryRun {
+		logctx.LogEvent(ctx, logctx.VerbosityData, logctx.InfoLog, "  Converted %d failed host(s) and %d failed item(s)\n",
+			summary.Counters.FailedHosts, summary.Counters.FailedItems)
+		return
+	}
+
+	if fsops.FileExists(newPath) {
+		err = backupOriginal(newPath, newPath+migrationBackupSuffix)
+		if err != nil {
+			err = fmt.Errorf("failed backing up existing failtracker: %w", err)
+			return
+		}
+	}
+
+	err = summary.SaveReport(ctx, newPath)
+	if err != nil {
+		err = fmt.Errorf("failed writing failtracker: %w", err)
+		return
+	}
+
+	// Old failtracker is renamed instead of deleted so it serves as the backup
+	err = os.Rename(legacyPath, legacyPath+migrationBackupSuffix)
+	if err != nil {
+		err = fmt.Errorf("failed renaming legacy failtracker: %w", err)
+		return
+	}
+	return
+}
+
+// Parses legacy failtracker text (commitid line followed by JSON lines per failed host) into a deployment summary
+func convertLegacyFailTracker(legacyFile []byte) (summary metrics.Summary, reviews []migrationReview, err error) {
+	scanner := bufio.NewScanner(strings.NewReader(string(legacyFile)))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		commitID, isCommitLine := strings.CutPrefix(line, "commitid:")
+		if isCommitLine {
+			summary.CommitID = strings.TrimSpace(commitID)
+			continue
+		}
+
+		var failure legacyFailure
+		err = json.Unmarshal([]byte(line), &failure)
+		if err != nil {
+			err = fmt.Errorf("invalid legacy failtracker line '%s': %w", line, err)
+			return
+		}
+		if failure.EndpointName == "" {
+			err = fmt.Errorf("invalid legacy failtracker line '%s': host name is empty", line)
+			return
+		}
+
+		hostSummary := metrics.HostSummary{
+			Name:       failure.EndpointName,
+			Status:     "Failed",
+			TotalItems: len(failure.Files),
+		}
+		for _, file := range failure.Files {
+			hostSummary.Items = append(hostSummary.Items, metrics.ItemSummary{
+				Name:     file,
+				Action:   deployment.ActionFileModify,
+				Status:   "Failed",
+				ErrorMsg: failure.ErrorMessage,
+			})
+		}
+		if len(failure.Files) == 0 {
+			hostSummary.ErrorMsg = failure.ErrorMessage
+		}
+
+		summary.Hosts = append(summary.Hosts, hostSummary)
+		summary.Counters.Hosts++
+		summary.Counters.FailedHosts++
+		summary.Counters.Items += len(failure.Files)
+		summary.Counters.FailedItems += len(failure.Files)
+	}
+	err = scanner.Err()
+	if err != nil {
+		err = fmt.Errorf("failed reading legacy failtracker: %w", err)
+		return
+	}
+
+	if summary.CommitID == "" {
+		err = fmt.Errorf("commitid missing from legacy failtracker file")
+		return
+	}
+	if !parsing.IsHex40(summary.CommitID) {
+		reviews = append(reviews, migrationReview{
+			location: legacyFailTrackerFile,
+			reason:   fmt.Sprintf("commit ID '%s' is not a valid full commit hash", summary.CommitID),
+		})
+	}
+
+	summary.Status = "Failed"
+	if summary.Counters.FailedItems > 0 {
+		reviews = append(reviews, migrationReview{
+			location: legacyFailTrackerFile,
+			reason:   "legacy failures do not record deployment actions, failed items are assumed to be file modifications",
+		})
+	}
+	return
+}
@@ -0,0 +1,292 @@
+package setup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"scmp/core/deployment"
+	"scmp/core/deployment/metrics"
+	"scmp/internal/config"
+	"scmp/internal/global"
+	"scmp/internal/logctx"
+	"strings"
+	"testing"
+)
+
+const migrationFixtureDir string = "testdata/v4"
+
+func readFixture(t *testing.T, path string) (contents string) {
+	t.Helper()
+	fixture, err := os.ReadFile(filepath.Join(migrationFixtureDir, path))
+	if err != nil {
+		t.Fatalf("failed reading fixture '%s': %v", path, err)
+	}
+	contents = string(fixture)
+	return
+}
+
+// Copies fixture directory into a temporary location so it can be modified
+func copyFixtureDir(t *testing.T, source string, destination string) {
+	t.Helper()
+	err := filepath.WalkDir(source, func(path string, entry os.DirEntry, lerr error) (err error) {
+		if lerr != nil {
+			err = lerr
+			return
+		}
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return
+		}
+		target := filepath.Join(destination, rel)
+		if entry.IsDir() {
+			err = os.MkdirAll(target, 0700)
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return
+		}
+		err = os.WriteFile(target, data, 0600)
+		return
+	})
+	if err != nil {
+		t.Fatalf("failed copying fixtures: %v", err)
+	}
+}
+
+func hasReview(reviews []migrationReview, location string, reasonContains string) (found bool) {
+	for _, review := range reviews {
+		if review.location == location && strings.Contains(review.reason, reasonContains) {
+			found = true
+			return
+		}
+	}
+	return
+}
+
+func TestParseLegacyConfig(t *testing.T) {
+	legacy, reviews, err := parseLegacyConfig([]byte(readFixture(t, "scmpc.yaml")))
+	if err != nil {
+		t.Fatalf("expected no error, got '%v'", err)
+	}
+
+	if legacy.TemplateDirectory != "UniversalConfs" {
+		t.Errorf("expected template directory 'UniversalConfs', got '%s'", legacy.TemplateDirectory)
+	}
+	if len(legacy.DeployerEndpoints) != 3 {
+		t.Errorf("expected 3 endpoints, got %d", len(legacy.DeployerEndpoints))
+	}
+	if legacy.DeployerEndpoints["db01"].EndpointPort != 2202 {
+		t.Errorf("expected db01 port 2202, got %d", legacy.DeployerEndpoints["db01"].EndpointPort)
+	}
+
+	if !hasReview(reviews, "config:UpdaterProgram", "no equivalent") {
+		t.Errorf("expected review for unknown option, got '%v'", reviews)
+	}
+	if !hasReview(reviews, "config:SSHClient.MaximumConcurrency", "--max-conns 10") {
+		t.Errorf("expected review for concurrency option, got '%v'", reviews)
+	}
+
+	_, _, err = parseLegacyConfig([]byte("DeployerEndpoints: [invalid"))
+	if err == nil {
+		t.Errorf("expected error for invalid YAML, got nil")
+	}
+}
+
+func TestMergeLegacyConfig(t *testing.T) {
+	legacy, _, err := parseLegacyConfig([]byte(readFixture(t, "scmpc.yaml")))
+	if err != nil {
+		t.Fatalf("failed parsing legacy config: %v", err)
+	}
+
+	newConfig, reviews, err := mergeLegacyConfig(legacy, readFixture(t, "existing-ssh.config"), "scmpc.yaml")
+	if err != nil {
+		t.Fatalf("expected no error, got '%v'", err)
+	}
+
+	expectedConfig := readFixture(t, "expected-ssh.config")
+	if newConfig != expectedConfig {
+		t.Errorf("generated config mismatch\nexpected:\n%s\ngot:\n%s", expectedConfig, newConfig)
+	}
+
+	if !hasReview(reviews, "config:DeployerEndpoints.db01", "already defined") {
+		t.Errorf("expected review for existing host, got '%v'", reviews)
+	}
+	if !hasReview(reviews, "config:PasswordVault", "existing SSH config value") {
+		t.Errorf("expected review for conflicting global option, got '%v'", reviews)
+	}
+
+	// No existing config
+	newConfig, _, err = mergeLegacyConfig(legacy, "", "scmpc.yaml")
+	if err != nil {
+		t.Fatalf("expected no error, got '%v'", err)
+	}
+	if !strings.HasPrefix(newConfig, "# Migrated from scmpc.yaml\n") {
+		t.Errorf("expected generated globals at start of config, got:\n%s", newConfig)
+	}
+	if !strings.Contains(newConfig, "Host db01\n        Hostname         psql01.domain.com\n        Port             2202\n") {
+		t.Errorf("expected db01 host block in config, got:\n%s", newConfig)
+	}
+}
+
+func TestMigrateHeader(t *testing.T) {
+	tests := []struct {
+		path            string
+		expectedChanged bool
+		expectedReviews []string
+	}{
+		{
+			path:            "host1/etc/nginx/nginx.conf",
+			expectedChanged: true,
+		},
+		{
+			path:            "host1/etc/nginx/index.html",
+			expectedChanged: true,
+			expectedReviews: []string{"will now run on every change", "'Notes' is not recognized"},
+		},
+		{
+			path:            "UniversalConfs/etc/profile.sh",
+			expectedChanged: true,
+		},
+		{
+			path:            "UniversalConfs/etc/hosts",
+			expectedChanged: false,
+		},
+		{
+			path:            "UniversalConfs/etc/motd",
+			expectedChanged: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			input := readFixture(t, filepath.Join("repo", test.path))
+			expected := readFixture(t, filepath.Join("expected", test.path))
+
+			newContents, changed, reviews, err := migrateHeader(input)
+			if err != nil {
+				t.Fatalf("expected no error, got '%v'", err)
+			}
+			if changed != test.expectedChanged {
+				t.Errorf("expected changed to be %t, got %t", test.expectedChanged, changed)
+			}
+			if newContents != expected {
+				t.Errorf("migrated contents mismatch\nexpected:\n%s\ngot:\n%s", expected, newContents)
+			}
+			if len(reviews) != len(test.expectedReviews) {
+				t.Fatalf("expected %d reviews, got '%v'", len(test.expectedReviews), reviews)
+			}
+			for _, expectedReview := range test.expectedReviews {
+				if !hasReview(reviews, "", expectedReview) {
+					t.Errorf("expected review containing '%s', got '%v'", expectedReview, reviews)
+				}
+			}
+		})
+	}
+
+	_, _, _, err := migrateHeader("#|^^^|#\n{\"ReloadRequired\": true}\n")
+	if err == nil {
+		t.Errorf("expected error for missing end delimiter, got nil")
+	}
+}
+
+func TestConvertLegacyFailTracker(t *testing.T) {
+	summary, reviews, err := convertLegacyFailTracker([]byte(readFixture(t, "repo/.failtracker.meta")))
+	if err != nil {
+		t.Fatalf("expected no error, got '%v'", err)
+	}
+
+	if summary.CommitID != "0123456789abcdef0123456789abcdef01234567" {
+		t.Errorf("unexpected commit ID '%s'", summary.CommitID)
+	}
+	if summary.Counters.FailedHosts != 2 || summary.Counters.FailedItems != 2 {
+		t.Errorf("expected 2 failed hosts and 2 failed items, got %d and %d", summary.Counters.FailedHosts, summary.Counters.FailedItems)
+	}
+	if len(summary.Hosts) != 2 {
+		t.Fatalf("expected 2 hosts, got %d", len(summary.Hosts))
+	}
+	if summary.Hosts[0].Items[0].Action != deployment.ActionFileModify || summary.Hosts[0].Items[0].Status != "Failed" {
+		t.Errorf("unexpected item summary '%v'", summary.Hosts[0].Items[0])
+	}
+	if summary.Hosts[1].ErrorMsg != "no route to host" {
+		t.Errorf("expected host error to be retained, got '%s'", summary.Hosts[1].ErrorMsg)
+	}
+	if !hasReview(reviews, legacyFailTrackerFile, "assumed to be file modifications") {
+		t.Errorf("expected review for assumed actions, got '%v'", reviews)
+	}
+
+	_, _, err = convertLegacyFailTracker([]byte(`{"endpointName":"web01","files":[]}`))
+	if err == nil {
+		t.Errorf("expected error for missing commit ID, got nil")
+	}
+}
+
+func TestMigrateV4(t *testing.T) {
+	for _, dryRun := range []bool{true, false} {
+		t.Run(map[bool]string{true: "dry-run", false: "migrate"}[dryRun], func(t *testing.T) {
+			ctx := t.Context()
+			ctx = logctx.New(ctx, logctx.NSTest, logctx.VerbosityNone, ctx.Done())
+			ctx = context.WithValue(ctx, global.OpsKey, config.Opts{DryRunEnabled: dryRun})
+
+			tempDir := t.TempDir()
+			repoPath := filepath.Join(tempDir, "repo")
+			configDir := filepath.Join(tempDir, "ssh")
+			copyFixtureDir(t, filepath.Join(migrationFixtureDir, "repo"), repoPath)
+			copyFixtureDir(t, migrationFixtureDir, configDir)
+			sshConfigPath := filepath.Join(configDir, "existing-ssh.config")
+			legacyConfigPath := filepath.Join(configDir, "scmpc.yaml")
+
+			err := MigrateV4(ctx, legacyConfigPath, sshConfigPath, repoPath)
+			if err != nil {
+				t.Fatalf("expected no error, got '%v'", err)
+			}
+
+			migratedFile, err := os.ReadFile(filepath.Join(repoPath, "host1/etc/nginx/nginx.conf"))
+			if err != nil {
+				t.Fatalf("failed reading migrated file: %v", err)
+			}
+			failTrackerPath := filepath.Join(configDir, deployment.FailTrackerFile)
+			backupPath := filepath.Join(repoPath, migrationBackupRepoDir, "host1/etc/nginx/nginx.conf")
+
+			if dryRun {
+				if string(migratedFile) != readFixture(t, "repo/host1/etc/nginx/nginx.conf") {
+					t.Errorf("dry-run modified repository file")
+				}
+				sshConfig, _ := os.ReadFile(sshConfigPath)
+				if string(sshConfig) != readFixture(t, "existing-ssh.config") {
+					t.Errorf("dry-run modified SSH config")
+				}
+				for _, path := range []string{failTrackerPath, backupPath, sshConfigPath + migrationBackupSuffix} {
+					if _, err := os.Stat(path); !os.IsNotExist(err) {
+						t.Errorf("dry-run created file '%s'", path)
+					}
+				}
+				return
+			}
+
+			if string(migratedFile) != readFixture(t, "expected/host1/etc/nginx/nginx.conf") {
+				t.Errorf("repository file was not migrated")
+			}
+
+			backup, err := os.ReadFile(backupPath)
+			if err != nil || string(backup) != readFixture(t, "repo/host1/etc/nginx/nginx.conf") {
+				t.Errorf("expected original file backup, got error '%v'", err)
+			}
+
+			sshConfigBackup, err := os.ReadFile(sshConfigPath + migrationBackupSuffix)
+			if err != nil || string(sshConfigBackup) != readFixture(t, "existing-ssh.config") {
+				t.Errorf("expected original SSH config backup, got error '%v'", err)
+			}
+
+			commitID, _, err := metrics.GetFailTrackerCommit(failTrackerPath)
+			if err != nil {
+				t.Errorf("expected readable failtracker, got error '%v'", err)
+			} else if commitID != "0123456789abcdef0123456789abcdef01234567" {
+				t.Errorf("unexpected failtracker commit ID '%s'", commitID)
+			}
+			if _, err := os.Stat(filepath.Join(repoPath, legacyFailTrackerFile+migrationBackupSuffix)); err != nil {
+				t.Errorf("expected renamed legacy failtracker, got error '%v'", err)
+			}
+		})
+	}
+}
@@ -151,7 +151,7 @@ func NewRepository(ctx context.Context, repoPath string, initialBranchName strin
 
 	// Example file
 	const exampleFile string = ".example-metadata-header.txt"
-	content.WriteTemplateFile(ctx, str.LocalRepoPath(exampleFile), true)
+	content.WriteTemplateFile(ctx, str.LocalRepoPath(exampleFile), "", "", true)
 
 	// Stage the universal files
 	_, err = worktree.Add(exampleFile)
@@ -5,41 +5,58 @@ _controller()
 
     # Main config of options
     declare -A COMMANDS=(
-        [root_sub]="deploy web exec git install scp secrets seed version file header drn"
-        [root_opts]="--allow-deletions --force --with-summary -T --dry-run -v --verbosity -w --wet-run"
+        [root_sub]="bundle connect deploy web exec git install scp secrets seed version file header drn lint snapshot ssh-keys"
+        [root_opts]="--allow-deletions --force --with-summary --log-file --log-format --log-journald -T --dry-run -v --verbosity -w --wet-run"
 
         [web_opts]="-p --listen-port -s --start-server"
 
-        [deploy_sub]="all diff failures rollback"
-        [deploy_opts]=" -c --config --disable-privilege-escalation --disable-reloads --execution-timeout --ignore-deployment-state --install --regex -C --commitid -l --local-files -m --max-conns -r --remote-hosts -t --test-config -u --run-as-user -M --max-deploy-threads"
+        [connect_opts]="-c --config -r --remote-hosts --persist --close --idle-timeout --strict-host-key-checking"
+
+        [deploy_sub]="all diff export failures rollback"
+        [deploy_opts]=" -c --config --disable-privilege-escalation --disable-reloads --execution-timeout --transfer-timeout --bwlimit --canary --batch-size --batch-pause --batch-check --wait-for-lock --lock-stale-age --skip-preflight --acknowledge-fanout --acknowledge-shrink --allow-user-deletions --confirm-host --replace-files --all-branches --changed-since --show-diff --audit --summary-format --summary-file --top --events --out --all-files --include-artifacts --include-secrets --ignore-deployment-state --install --force-install --regex -C --commitid -l --local-files -m --max-conns -r --remote-hosts --select --select-from -t --test-config --skip-resolve -u --run-as-user -M --max-deploy-threads --snapshot --status-lines --progress --use-cache --refresh-cache --strict-host-key-checking --run-hooks-on-dry-run --quiet-errors --values"
 
         [deploy:all_opts]="__inherit__"
         [deploy:diff_opts]="__inherit__"
+        [deploy:export_opts]="__inherit__"
         [deploy:failures_opts]="__inherit__"
         [deploy:rollback_opts]="__inherit__"
 
-        [exec_opts]="-c --config --regex -r --remote-hosts -R --remote-file --disable-privilege-escalation -m --max-conns -u --run-as-user --execution-timeout"
+        [exec_opts]="-c --config --regex -r --remote-hosts --select --select-from -R --remote-file --disable-privilege-escalation -m --max-conns -u --run-as-user --execution-timeout --transfer-timeout --output-dir --fail-fast --request-pty --restore-backup --strict-host-key-checking --values"
 
-        [git_sub]="add commit status"
-        [git_opts]="-m --message"
+        [git_sub]="add commit status log diff"
+        [git_opts]="-m --message -c --config --host -n --max-count"
 
         [git:commit_opts]="__inherit__"
+        [git:log_opts]="__inherit__"
+        [git:diff_opts]="__inherit__"
+
+        [install_sub]="migrate-v4"
+        [install_opts]="--apparmor-profile --default-config --repository-branch-name --repository-path -c --config --legacy-config"
 
-        [install_opts]="--apparmor-profile --default-config --repository-branch-name --repository-path"
+        [install:migrate-v4_opts]="__inherit__"
 
-        [scp_opts]="-c --config"
+        [scp_opts]="-c --config --strict-host-key-checking"
+        [secrets_sub]="verify rekey"
         [secrets_opts]="-p --modify-vault-password"
-        [seed_opts]="-c --config --regex -r --remote-hosts -R --remote-files --ignore-deployment-state"
+
+        [secrets:verify_opts]="__inherit__"
+        [secrets:rekey_opts]="--kdf-time --kdf-memory --kdf-threads"
+
+        [seed_opts]="-c --config --regex -r --remote-hosts --select --select-from -R --remote-files --browse --ignore-deployment-state --capture-xattrs --strict-host-key-checking"
         [version_opts]="-v"
 
-        [file_sub]="new replace-data"
-        [file_opts]="-y --yes"
+        [file_sub]="new replace-data to-artifact from-artifact encrypt decrypt"
+        [file_opts]="-c --config -y --yes --template --from --list-templates"
 
         [file:new_opts]="__inherit__"
         [file:replace-data_opts]="__inherit__"
+        [file:to-artifact_opts]="__inherit__"
+        [file:from-artifact_opts]="__inherit__"
+        [file:encrypt_opts]="__inherit__"
+        [file:decrypt_opts]="__inherit__"
 
         [header_sub]="edit strip insert read verify"
-        [header_opts]="-i --in-place -C --compact -j --json-metadata"
+        [header_opts]="-i --in-place -C --compact -j --json-metadata --json --set --set-owner --append-reload"
 
         [header:edit_opts]="__inherit__"
         [header:strip_opts]="__inherit__"
@@ -55,11 +72,37 @@ _controller()
         [drn:reference_opts]="__inherit__"
         [drn:resolve-file_opts]="__inherit__"
         [drn:validate_opts]="__inherit__"
+
+        [lint_sub]="headers who-gets config"
+        [lint_opts]="-c --config --ignore-deployment-state --json --check-vault"
+
+        [lint:headers_opts]="__inherit__"
+        [lint:who-gets_opts]="__inherit__"
+        [lint:config_opts]="__inherit__"
+
+        [bundle_sub]="create deploy"
+        [bundle_opts]="-c --config -o --out -C --commitid -r --remote-hosts -l --local-files --all-files --regex -M --max-deploy-threads --install --force-install --disable-reloads --confirm-host --acknowledge-shrink --skip-preflight --allow-user-deletions --summary-format --summary-file --events --show-diff --canary --batch-size --snapshot --progress --quiet-errors --disable-privilege-escalation -u --run-as-user --execution-timeout --transfer-timeout -m --max-conns --connect-attempts --connect-retry-delay --strict-host-key-checking"
+
+        [bundle:create_opts]="__inherit__"
+        [bundle:deploy_opts]="__inherit__"
+
+        [snapshot_sub]="list restore"
+        [snapshot_opts]="-c --config --host --snapshot --disable-privilege-escalation -u --run-as-user --execution-timeout --transfer-timeout --strict-host-key-checking"
+
+        [snapshot:list_opts]="__inherit__"
+        [snapshot:restore_opts]="__inherit__"
+
+        [ssh-keys_sub]="add remove scan"
+        [ssh-keys_opts]="-c --config -r --remote-hosts --strict-host-key-checking"
+
+        [ssh-keys:add_opts]="__inherit__"
+        [ssh-keys:remove_opts]="__inherit__"
+        [ssh-keys:scan_opts]="__inherit__"
     )
 
     # Special completion options
     case "$prev" in
-        --remote-hosts|-r|--modify-vault-password|-p)
+        --remote-hosts|-r|--modify-vault-password|-p|--host)
             local ssh_config="${HOME}/.ssh/config"
             if [[ -f "$ssh_config" ]]
             then
@@ -78,6 +121,14 @@ _controller()
             mapfile -t COMPREPLY < <(compgen -W "1 5 10 15 20 50" -- "$cur")
             return 0
             ;;
+        --strict-host-key-checking)
+            mapfile -t COMPREPLY < <(compgen -W "yes no accept-new" -- "$cur")
+            return 0
+            ;;
+        --log-format)
+            mapfile -t COMPREPLY < <(compgen -W "text json" -- "$cur")
+            return 0
+            ;;
         --verbosity|-v|--verbose)
             mapfile -t COMPREPLY < <(compgen -W "0 1 2 3 4 5" -- "$cur")
             return 0
@@ -0,0 +1,7 @@
+#|^^^|#
+#{
+#  "FileOwnerGroup": "root:root",
+#  "FilePermissions": 644
+#}
+#|^^^|#
+export PATH=$PATH:/usr/local/bin
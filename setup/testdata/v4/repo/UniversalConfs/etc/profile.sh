@@ -0,0 +1,8 @@
+#|^^^|#
+#{
+#  "FileOwnerGroup": "root:root",
+#  "FilePermissions": 644,
+#  "ReloadRequired": false
+#}
+#|^^^|#
+export PATH=$PATH:/usr/local/bin
@@ -16,6 +16,7 @@ import (
 	"scmp/web/datastore"
 	"scmp/web/internal"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -45,11 +46,13 @@ func deploymentNewAPI(ctx context.Context, clientCtx context.Context, fullReq in
 
 	// Set options from request
 	opts.AllowDeletions = req.Opts.AllowDeletions
+	opts.AllowUserDeletions = req.Opts.AllowUserDeletions
 	opts.RunInstallCommands = req.Opts.RunInstallCmds
 	opts.DisableReloads = req.Opts.DisableReloads
 	opts.DisableSudo = req.Opts.DisableSudo
 	opts.IgnoreDeploymentState = req.Opts.IgnoreHostState
 	opts.ForceEnabled = req.Opts.Force
+	opts.GatherFacts = req.Opts.GatherFacts
 	if req.Opts.MaxSSHConn != 0 {
 		opts.MaxSSHConcurrency = req.Opts.MaxSSHConn
 	} else {
@@ -68,6 +71,14 @@ func deploymentNewAPI(ctx context.Context, clientCtx context.Context, fullReq in
 	if req.Opts.RunAsUser != "" {
 		opts.RunAsUser = req.Opts.RunAsUser
 	}
+	if req.Opts.Deadline != "" {
+		deadline, err := time.ParseDuration(req.Opts.Deadline)
+		if err != nil || deadline < 0 {
+			errObj.New(rpcInvalidParams, "Invalid Request", fmt.Sprintf("deadline '%s' is not a valid duration", req.Opts.Deadline))
+			return
+		}
+		opts.DeploymentDeadline = deadline
+	}
 	// Always request full
 	opts.DetailedSummaryRequested = true
 
@@ -107,7 +118,7 @@ func deploymentNewAPI(ctx context.Context, clientCtx context.Context, fullReq in
 		tracker.status = "running"
 		datastore.Put(username, deploymentID.String(), tracker)
 
-		rollbackCommit, err := local.StartDeploy(clientCtx, req.Mode, req.Opts.CommitID, req.Opts.HostOverride, req.Opts.FileOverride)
+		rollbackCommit, _, err := local.StartDeploy(clientCtx, req.Mode, req.Opts.CommitID, req.Opts.HostOverride, req.Opts.FileOverride)
 
 		tracker.status = "parsing output"
 		datastore.Put(username, deploymentID.String(), tracker)
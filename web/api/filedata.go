@@ -127,6 +127,12 @@ func contentEditAPI(baseCtx context.Context, clientCtx context.Context, fullReq
 		}
 	}
 
+	// Plain text data must never replace cipher text under an Encrypted header
+	if existingHeader.Encrypted {
+		errObj.New(rpcInvalidParams, "File content is encrypted, decrypt it with the controller before editing", "")
+		return
+	}
+
 	if noHeaderInfile {
 		err = os.WriteFile(cleanRequestPath, newData, 0640)
 	} else {
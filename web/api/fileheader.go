@@ -50,6 +50,11 @@ func fileMetadataEditAPI(baseCtx context.Context, clientCtx context.Context, ful
 		errObj.New(rpcInternalError, "Invalid metadata header", err.Error())
 		return
 	}
+	err = metadata.Validate(newHeader)
+	if err != nil {
+		errObj.New(rpcInvalidParams, "Unsafe metadata header", err.Error())
+		return
+	}
 
 	cleanRequestPath, err := validateRequestedFilePath(clientCtx, req.Path)
 	if err != nil {
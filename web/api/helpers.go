@@ -7,6 +7,7 @@ import (
 	"scmp/core/filesystem"
 	"scmp/internal/str"
 	"scmp/web/internal"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -60,6 +61,7 @@ func translateHeaderToWebMeta(filePath string, fileType string, lastModTime stri
 	}
 	webMeta.LastModified = lastModTime
 	webMeta.ReloadGroup = metadata.ReloadGroup
+	webMeta.MaxConcurrentHosts = metadata.MaxConcurrentHosts
 	webMeta.ExternalContentLocation = metadata.ExternalContentLocation
 	webMeta.Dependencies = metadata.Dependencies
 	webMeta.PreDeployCommands = metadata.PreDeployCommands
@@ -67,7 +69,11 @@ func translateHeaderToWebMeta(filePath string, fileType string, lastModTime stri
 	webMeta.PostInstallCommands = metadata.PostInstallCommands
 	webMeta.PreapplyCommands = metadata.PreapplyCommands
 	webMeta.PostapplyCommands = metadata.PostapplyCommands
+	webMeta.PreCheckCommands = metadata.PreCheckCommands
+	webMeta.PostCheckCommands = slices.Concat(metadata.CheckCommands, metadata.PostCheckCommands) // Checks alias is saved back as PostChecks
 	webMeta.ReloadCommands = metadata.ReloadCommands
+	webMeta.BackupStyle = metadata.BackupStyle
+	webMeta.Normalize = metadata.Normalize
 	return
 }
 
@@ -87,7 +93,12 @@ func translateWebMetaToHeader(webMeta FileMetadata) (metadata filesystem.MetaHea
 	metadata.PostInstallCommands = webMeta.PostInstallCommands
 	metadata.PreapplyCommands = webMeta.PreapplyCommands
 	metadata.PostapplyCommands = webMeta.PostapplyCommands
+	metadata.PreCheckCommands = webMeta.PreCheckCommands
+	metadata.PostCheckCommands = webMeta.PostCheckCommands
 	metadata.ReloadCommands = webMeta.ReloadCommands
 	metadata.ReloadGroup = webMeta.ReloadGroup
+	metadata.MaxConcurrentHosts = webMeta.MaxConcurrentHosts
+	metadata.BackupStyle = webMeta.BackupStyle
+	metadata.Normalize = webMeta.Normalize
 	return
 }
@@ -207,13 +207,7 @@ func repoCommitAPI(baseCtx context.Context, clientCtx context.Context, fullReq i
 		return
 	}
 
-	repoPath, err := gitinternal.RetrieveRepoPath(clientCtx)
-	if err != nil {
-		errObj.New(rpcInternalError, "Failed retrieving repository path", err.Error())
-		return
-	}
-
-	repo, err := git.PlainOpen(repoPath)
+	repo, err := gitinternal.OpenRepository(clientCtx)
 	if err != nil {
 		errObj.New(rpcInternalError, "Failed to refresh repository", err.Error())
 		return
@@ -355,13 +349,7 @@ func repoHistoryAPI(baseCtx context.Context, clientCtx context.Context, fullReq
 	maxCommits := req.Limit
 	commitListOffset := req.Offset
 
-	repoPath, err := gitinternal.RetrieveRepoPath(clientCtx)
-	if err != nil {
-		errObj.New(rpcInternalError, "Failed retrieving repository path", err.Error())
-		return
-	}
-
-	repo, err := git.PlainOpen(repoPath)
+	repo, err := gitinternal.OpenRepository(clientCtx)
 	if err != nil {
 		errObj.New(rpcInternalError, "Failed to refresh repository", err.Error())
 		return
@@ -424,13 +412,7 @@ func repoDiffAPI(baseCtx context.Context, clientCtx context.Context, fullReq int
 		return
 	}
 
-	repoPath, err := gitinternal.RetrieveRepoPath(clientCtx)
-	if err != nil {
-		errObj.New(rpcInternalError, "Failed retrieving repository path", err.Error())
-		return
-	}
-
-	repo, err := git.PlainOpen(repoPath)
+	repo, err := gitinternal.OpenRepository(clientCtx)
 	if err != nil {
 		errObj.New(rpcInternalError, "Failed to refresh repository", err.Error())
 		return
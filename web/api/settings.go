@@ -71,6 +71,14 @@ func hostListAPI(baseCtx context.Context, clientCtx context.Context, fullReq int
 		collectedDetails.EndpointUser = hostInfo.EndpointUser
 		collectedDetails.IdentityFile = hostInfo.IdentityFile
 		collectedDetails.ConnectTimeout = hostInfo.ConnectTimeout
+		collectedDetails.ConnectAttempts = hostInfo.ConnectAttempts
+		if hostInfo.ConnectRetryDelay > 0 {
+			collectedDetails.ConnectRetryDelay = hostInfo.ConnectRetryDelay.String()
+		}
+		if hostInfo.HostDeadline > 0 {
+			collectedDetails.HostDeadline = hostInfo.HostDeadline.String()
+		}
+		collectedDetails.RequireConfirm = hostInfo.RequireConfirm
 		hostDetails[hostName] = collectedDetails
 	}
 
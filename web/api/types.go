@@ -4,6 +4,7 @@ package api
 import (
 	"context"
 	"scmp/core/deployment/metrics"
+	"scmp/internal/config"
 	"scmp/internal/str"
 )
 
@@ -58,15 +59,19 @@ type HostList struct {
 
 // See global for more info
 type HostSettings struct {
-	DeploymentState string            `json:"state"`
-	IgnoreUniversal bool              `json:"ignoresUniversal"`
-	RequiresVault   bool              `json:"requiresVault"`
-	UniversalGroups []str.RepoRootDir `json:"groups"`
-	Proxy           string            `json:"proxy,omitempty"`
-	Endpoint        string            `json:"address"`
-	EndpointUser    string            `json:"loginUser"`
-	IdentityFile    string            `json:"identityFile,omitempty"`
-	ConnectTimeout  int               `json:"connectTimeout,omitempty"`
+	DeploymentState   string            `json:"state"`
+	IgnoreUniversal   bool              `json:"ignoresUniversal"`
+	RequiresVault     bool              `json:"requiresVault"`
+	UniversalGroups   []str.RepoRootDir `json:"groups"`
+	Proxy             string            `json:"proxy,omitempty"`
+	Endpoint          string            `json:"address"`
+	EndpointUser      string            `json:"loginUser"`
+	IdentityFile      string            `json:"identityFile,omitempty"`
+	ConnectTimeout    int               `json:"connectTimeout,omitempty"`
+	ConnectAttempts   int               `json:"connectAttempts,omitempty"`
+	ConnectRetryDelay string            `json:"connectRetryDelay,omitempty"`
+	HostDeadline      string            `json:"hostDeadline,omitempty"`
+	RequireConfirm    bool              `json:"requireConfirmation,omitempty"`
 }
 
 // ====================== FILESYSTEM ======================
@@ -84,23 +89,28 @@ type ProcessUploadReq struct {
 }
 
 type FileMetadata struct {
-	Path                    string              `json:"path"`
-	Type                    string              `json:"type"`
-	Size                    int                 `json:"size"`
-	OwnerName               string              `json:"ownerName"`
-	GroupName               string              `json:"groupName"`
-	Permissions             string              `json:"permissions"`
-	LastModified            string              `json:"lastModified,omitempty"`
-	ExternalContentLocation string              `json:"externalContentLocation,omitempty"`
-	SymbolicLinkTarget      string              `json:"symbolicLinkTarget,omitempty"`
-	Dependencies            []str.LocalRepoPath `json:"dependencies,omitempty"`
-	PreDeployCommands       []string            `json:"preDeployCommands,omitempty"`
-	InstallCommands         []string            `json:"installCommands,omitempty"`
-	PostInstallCommands     []string            `json:"postInstallCommands,omitempty"`
-	PreapplyCommands        []string            `json:"preApplyCommands,omitempty"`
-	PostapplyCommands       []string            `json:"postApplyCommands,omitempty"`
-	ReloadCommands          []string            `json:"reloadCommands,omitempty"`
-	ReloadGroup             str.ReloadID        `json:"reloadGroup,omitempty"`
+	Path                    string                `json:"path"`
+	Type                    string                `json:"type"`
+	Size                    int                   `json:"size"`
+	OwnerName               string                `json:"ownerName"`
+	GroupName               string                `json:"groupName"`
+	Permissions             string                `json:"permissions"`
+	LastModified            string                `json:"lastModified,omitempty"`
+	ExternalContentLocation string                `json:"externalContentLocation,omitempty"`
+	SymbolicLinkTarget      string                `json:"symbolicLinkTarget,omitempty"`
+	Dependencies            []str.LocalRepoPath   `json:"dependencies,omitempty"`
+	PreDeployCommands       []string              `json:"preDeployCommands,omitempty"`
+	InstallCommands         []string              `json:"installCommands,omitempty"`
+	PostInstallCommands     []string              `json:"postInstallCommands,omitempty"`
+	PreapplyCommands        []string              `json:"preApplyCommands,omitempty"`
+	PostapplyCommands       []string              `json:"postApplyCommands,omitempty"`
+	PreCheckCommands        []string              `json:"preChecks,omitempty"`
+	PostCheckCommands       []string              `json:"postChecks,omitempty"`
+	ReloadCommands          []string              `json:"reloadCommands,omitempty"`
+	ReloadGroup             str.ReloadID          `json:"reloadGroup,omitempty"`
+	MaxConcurrentHosts      int                   `json:"maxConcurrentHosts,omitempty"`
+	BackupStyle             string                `json:"backupStyle,omitempty"`
+	Normalize               *config.Normalization `json:"normalize,omitempty"`
 }
 
 type FileOp struct {
@@ -205,11 +215,13 @@ type DeployStart struct {
 	Type string `json:"type"`
 	Opts struct {
 		AllowDeletions     bool   `json:"allowDeletions"`
+		AllowUserDeletions bool   `json:"allowUserDeletions"`
 		RunInstallCmds     bool   `json:"runInstall"`
 		DisableReloads     bool   `json:"disableReloads"`
 		DisableSudo        bool   `json:"disableSudo"`
 		IgnoreHostState    bool   `json:"ignoreHostState"`
 		Force              bool   `json:"force"`
+		GatherFacts        bool   `json:"gatherFacts"`
 		AutoCommitRollback bool   `json:"autoCommitRollbackEnabled"`
 		CommitID           string `json:"commitID"`
 		HostOverride       string `json:"hostOverride"`
@@ -218,6 +230,7 @@ type DeployStart struct {
 		MaxSSHConn         int    `json:"maxSSHConnections"`
 		MaxSSHChannels     int    `json:"maxSSHChannels"`
 		CommandTimeout     int    `json:"maxCommandRuntime"`
+		Deadline           string `json:"deadline"` // Go duration like 30m, empty is unlimited
 		Verbosity          int    `json:"verbosity"`
 	} `json:"options"`
 }